@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+const userUsage = `Usage: webby user <command> [flags]
+
+Commands:
+  create -username NAME -email EMAIL [-password PASS]
+                       Create a user
+  reset-password -username NAME [-password PASS]
+                       Set a user's password
+
+Without -password the password is read from standard input.
+`
+
+// adminCommands are the subcommands that run against the database and exit
+// instead of starting the server
+var adminCommands = map[string]func(args []string) error{
+	"migrate":   runMigrate,
+	"vacuum":    runVacuum,
+	"integrity": runIntegrity,
+	"user":      runUser,
+	"scan":      runScan,
+	"claim":     runClaim,
+	"dedupe":    runDedupe,
+}
+
+// databasePath is the database in WEBBY_DATA_DIR that admin commands use
+func databasePath() string {
+	return filepath.Join(getEnv("WEBBY_DATA_DIR", "./data"), "webby.db")
+}
+
+// openCurrentDatabase opens the database with its schema brought up to
+// date, creating the data directory and database if needed
+func openCurrentDatabase() (*storage.Database, error) {
+	if err := os.MkdirAll(getEnv("WEBBY_DATA_DIR", "./data"), 0755); err != nil {
+		return nil, err
+	}
+	db, err := storage.NewDatabase(databasePath())
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	return db, nil
+}
+
+// runVacuum handles "webby vacuum", which compacts the database file
+func runVacuum(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	db, err := storage.OpenDatabase(databasePath())
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	before, _ := os.Stat(databasePath())
+	if err := db.Vacuum(); err != nil {
+		return err
+	}
+	after, _ := os.Stat(databasePath())
+	if before != nil && after != nil {
+		fmt.Printf("Vacuumed %s: %d -> %d bytes\n", databasePath(), before.Size(), after.Size())
+	}
+	return nil
+}
+
+// runIntegrity handles "webby integrity", which reports corruption, rows
+// that break foreign keys, and book files the last verification found
+// missing or changed
+func runIntegrity(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	db, err := storage.OpenDatabase(databasePath())
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	problems, err := db.IntegrityCheck()
+	if err != nil {
+		return err
+	}
+	// Left out on a database not yet migrated to record file checks
+	if files, err := db.ListFileProblems(); err == nil {
+		for _, f := range files {
+			problems = append(problems, fmt.Sprintf("book %s (%s): file %s: %s", f.BookID, f.Title, f.FilePath,
+				strings.ReplaceAll(f.Problem, "_", " ")))
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Println("ok")
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	return fmt.Errorf("%d problems found", len(problems))
+}
+
+// runUser handles "webby user", which creates users and resets passwords
+func runUser(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, userUsage)
+		return errors.New("missing user command")
+	}
+
+	command := args[0]
+	if command != "create" && command != "reset-password" {
+		fmt.Fprint(os.Stderr, userUsage)
+		return fmt.Errorf("unknown user command %q", command)
+	}
+
+	fs := flag.NewFlagSet("user "+command, flag.ContinueOnError)
+	username := fs.String("username", "", "Username")
+	email := fs.String("email", "", "Email address (create only)")
+	password := fs.String("password", "", "Password; read from standard input if empty")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	*username = strings.TrimSpace(*username)
+	if len(*username) < 3 || len(*username) > 32 {
+		return errors.New("-username must be 3-32 characters")
+	}
+	*email = strings.TrimSpace(strings.ToLower(*email))
+	if command == "create" && !strings.Contains(*email, "@") {
+		return errors.New("-email is required")
+	}
+
+	if *password == "" {
+		var err error
+		if *password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+	if len(*password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+	passwordHash, err := auth.HashPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	db, err := openCurrentDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if command == "create" {
+		exists, err := db.UserExists(*username, *email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.New("username or email already taken")
+		}
+
+		user := &models.User{
+			ID:           uuid.New().String(),
+			Username:     *username,
+			Email:        *email,
+			PasswordHash: passwordHash,
+			CreatedAt:    time.Now(),
+		}
+		if err := db.CreateUser(user); err != nil {
+			return err
+		}
+		fmt.Printf("Created user %s (%s)\n", user.Username, user.ID)
+		return nil
+	}
+
+	user, err := db.GetUserByUsername(*username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user named %q", *username)
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateUserPassword(user.ID, passwordHash); err != nil {
+		return err
+	}
+	fmt.Printf("Reset password for %s\n", user.Username)
+	return nil
+}
+
+// readPassword reads one line from standard input
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
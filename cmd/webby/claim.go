@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+const claimUsage = `Usage: webby claim -list
+       webby claim -user NAME [-visibility V] (-all | <book-id>...)
+
+Books without an owner, uploaded before accounts existed or while signed
+out, are seen and changed by everyone. -list prints them; -user gives the
+named books to NAME, and their read status and reading position move with
+them. -all gives NAME every one of them along with everything else kept
+while signed out: reading positions in any book and collections.
+-visibility is private (default), household, or public.
+`
+
+// runClaim handles "webby claim", which assigns books without an owner to a
+// user
+func runClaim(args []string) error {
+	flags := flag.NewFlagSet("claim", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, claimUsage) }
+	list := flags.Bool("list", false, "List books without an owner")
+	username := flags.String("user", "", "Username that will own the books")
+	visibility := flags.String("visibility", models.BookVisibilityPrivate, "Visibility of the claimed books")
+	all := flags.Bool("all", false, "Claim every book, reading position and collection kept without signing in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !*list && *username == "" {
+		flags.Usage()
+		return errors.New("expected -list or -user")
+	}
+	if !*list && *all == (flags.NArg() > 0) {
+		flags.Usage()
+		return errors.New("expected -all or book IDs, but not both")
+	}
+	if !models.ValidBookVisibility(*visibility) {
+		return fmt.Errorf("-visibility must be private, household, or public, not %q", *visibility)
+	}
+
+	db, err := openCurrentDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *list {
+		orphans, err := db.ListOrphanBooks()
+		if err != nil {
+			return err
+		}
+		for _, book := range orphans {
+			fmt.Printf("%s  %-5s  %q by %s\n", book.ID, book.ContentType, book.Title, book.Author)
+		}
+		fmt.Printf("%d books without an owner\n", len(orphans))
+		return nil
+	}
+
+	user, err := db.GetUserByUsername(*username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user named %q", *username)
+	}
+	if err != nil {
+		return err
+	}
+
+	var claimed []string
+	if *all {
+		claim, err := db.ClaimAnonymousLibrary(user.ID, *visibility)
+		if err != nil {
+			return err
+		}
+		claimed = claim.BookIDs
+		fmt.Printf("Gave %d reading positions and %d collections to %s\n", claim.Positions, claim.Collections, user.Username)
+	} else if claimed, err = db.ClaimOrphanBooks(user.ID, *visibility, flags.Args()); err != nil {
+		return err
+	}
+	if *visibility == models.BookVisibilityHousehold {
+		members, err := db.ListHouseholdMemberIDs(user.ID)
+		if err != nil {
+			return err
+		}
+		for _, bookID := range claimed {
+			for _, memberID := range members {
+				if err := db.ShareBook(bookID, user.ID, memberID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Gave %d books to %s\n", len(claimed), user.Username)
+	if skipped := flags.NArg() - len(claimed); !*all && skipped > 0 {
+		fmt.Printf("Skipped %d books that already have an owner or don't exist\n", skipped)
+	}
+	return nil
+}
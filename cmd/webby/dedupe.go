@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+const dedupeUsage = `Usage: webby dedupe [-dry-run]
+
+Moves book files uploaded before files were stored by content into the
+content-addressed store under books/.objects, so identical files uploaded
+by several users take disk space once. Each book keeps its own record;
+only its file path changes. Stored files no book uses are removed
+afterwards. Run it with the server stopped.
+`
+
+// runDedupe handles "webby dedupe", which moves existing book files into
+// the content-addressed store
+func runDedupe(args []string) error {
+	flags := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, dedupeUsage) }
+	dryRun := flags.Bool("dry-run", false, "Report what would be moved and saved")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return errors.New("unexpected arguments")
+	}
+
+	db, err := openCurrentDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	files, err := storage.NewFileStorage(getEnv("WEBBY_DATA_DIR", "./data"))
+	if err != nil {
+		return err
+	}
+	files.SetFileReferences(db)
+
+	result, err := storage.DedupeFiles(db, files, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Moved"
+	if *dryRun {
+		verb = "Would move"
+	}
+	fmt.Printf("%s %d files, %d duplicates sharing a stored copy, %d bytes saved\n",
+		verb, result.Moved, result.Duplicates, result.BytesSaved)
+	if result.Pruned != nil && result.Pruned.Files > 0 {
+		fmt.Printf("Removed %d unused stored files (%d bytes)\n", result.Pruned.Files, result.Pruned.Bytes)
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d files could not be moved", result.Failed)
+	}
+	return nil
+}
@@ -1,28 +1,81 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/justyntemme/webby/internal/api"
+	"github.com/justyntemme/webby/internal/apierror"
 	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/notify"
 	"github.com/justyntemme/webby/internal/storage"
 )
 
 func main() {
+	// Admin subcommands run against the database and exit
+	if len(os.Args) > 1 {
+		if run, ok := adminCommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	// Command-line flags
 	urlFlag := flag.String("url", "", "Server bind address (e.g., :8080 or 0.0.0.0:8080)")
 	disableRegFlag := flag.Bool("disable-registration", false, "Disable new user registration")
+	requireAuthFlag := flag.Bool("require-auth", false, "Require a login for all book routes, disabling the anonymous public library")
+	versionFlag := flag.Bool("version", false, "Print the version and exit")
+	checkConfigFlag := flag.Bool("check-config", false, "Check the configuration and exit, non-zero if the server couldn't start with it")
 	flag.Parse()
 
+	build := buildInfo()
+	if *versionFlag {
+		fmt.Println(versionString(build))
+		return
+	}
+
+	// Configuration problems are collected and reported together, so
+	// fixing them doesn't take a restart per mistake
+	var problems []string
+	invalid := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
 	// Configuration
 	dataDir := getEnv("WEBBY_DATA_DIR", "./data")
 	dbPath := filepath.Join(dataDir, "webby.db")
-	port := getEnv("WEBBY_PORT", "8080")
+
+	// Built-in HTTPS: "manual" with WEBBY_TLS_CERT and WEBBY_TLS_KEY, or
+	// "acme" for Let's Encrypt certificates for WEBBY_DOMAIN
+	serverTLS, err := loadTLSSettings(dataDir)
+	if err != nil {
+		invalid("Invalid TLS settings: %v", err)
+	}
+	defaultPort := "8080"
+	if serverTLS.enabled() {
+		defaultPort = "443"
+	}
+	port := getEnv("WEBBY_PORT", defaultPort)
 
 	// Determine bind address: flag takes precedence, then env, then default
 	bindAddr := ":" + port
@@ -33,6 +86,158 @@ func main() {
 	// Check if registration is disabled (flag or env var)
 	disableRegistration := *disableRegFlag || getEnv("WEBBY_DISABLE_REGISTRATION", "") == "true"
 
+	// Without this, visitors without a token can browse and delete from the
+	// shared public library
+	requireAuth := *requireAuthFlag || getEnv("WEBBY_REQUIRE_AUTH", "") == "true"
+
+	// Visibility of new uploads for users who haven't picked their own.
+	// Anonymous uploads have no owner, so they are only accepted when it is
+	// "public".
+	defaultVisibility := getEnv("WEBBY_DEFAULT_VISIBILITY", models.BookVisibilityPrivate)
+	if !models.ValidBookVisibility(defaultVisibility) {
+		invalid("Invalid WEBBY_DEFAULT_VISIBILITY: %q (want private, household, or public)", defaultVisibility)
+	}
+
+	// Comma-separated usernames that may manage any user's books
+	adminUsers := strings.Split(getEnv("WEBBY_ADMIN_USERS", ""), ",")
+
+	// New accounts must follow an emailed link before they can log in
+	requireEmailVerification := getEnv("WEBBY_REQUIRE_EMAIL_VERIFICATION", "") == "true"
+
+	// Path prefix to serve everything under, such as "/webby" behind a
+	// reverse proxy that forwards https://host/webby/ with the prefix kept
+	basePath := api.CleanBasePath(getEnv("WEBBY_BASE_PATH", ""))
+
+	// Links in password reset and verification emails start with this,
+	// base path included; without it they use the Host header of the
+	// request that sent them
+	publicURL := getEnv("WEBBY_PUBLIC_URL", "")
+	if publicURL == "" && serverTLS.mode == tlsACME && len(serverTLS.domains) > 0 {
+		publicURL = "https://" + serverTLS.domains[0] + basePath
+	}
+
+	// How often followed authors/series are checked for new releases ("0" disables)
+	releaseCheckInterval, err := time.ParseDuration(getEnv("WEBBY_RELEASE_CHECK_INTERVAL", "24h"))
+	if err != nil {
+		invalid("Invalid WEBBY_RELEASE_CHECK_INTERVAL: %v", err)
+	}
+
+	// Reading sessions left open longer than this are ended automatically ("0" disables)
+	staleSessionAge, err := time.ParseDuration(getEnv("WEBBY_STALE_SESSION_AGE", "6h"))
+	if err != nil {
+		invalid("Invalid WEBBY_STALE_SESSION_AGE: %v", err)
+	}
+
+	// Gaps between reading session heartbeats longer than this aren't counted as reading ("0" disables)
+	sessionIdleTimeout, err := time.ParseDuration(getEnv("WEBBY_SESSION_IDLE_TIMEOUT", api.DefaultSessionIdleTimeout.String()))
+	if err != nil {
+		invalid("Invalid WEBBY_SESSION_IDLE_TIMEOUT: %v", err)
+	}
+
+	// How often overdue loans are checked for reminders ("0" disables)
+	loanReminderInterval, err := time.ParseDuration(getEnv("WEBBY_LOAN_REMINDER_INTERVAL", "1h"))
+	if err != nil {
+		invalid("Invalid WEBBY_LOAN_REMINDER_INTERVAL: %v", err)
+	}
+
+	// How many EPUBs are kept open for serving chapters and resources ("0" disables)
+	epubCacheSize, err := strconv.Atoi(getEnv("WEBBY_EPUB_CACHE_SIZE", strconv.Itoa(epub.DefaultCacheSize)))
+	if err != nil || epubCacheSize < 0 {
+		invalid("Invalid WEBBY_EPUB_CACHE_SIZE: %q", os.Getenv("WEBBY_EPUB_CACHE_SIZE"))
+	}
+
+	// Largest book file accepted, in megabytes, and per-format overrides
+	// such as "pdf=300,cbz=500"
+	maxUploadMB, err := strconv.Atoi(getEnv("WEBBY_MAX_UPLOAD_MB", strconv.FormatInt(api.DefaultMaxUploadSize>>20, 10)))
+	if err != nil || maxUploadMB <= 0 {
+		invalid("Invalid WEBBY_MAX_UPLOAD_MB: %q", os.Getenv("WEBBY_MAX_UPLOAD_MB"))
+	}
+	formatUploadSizes, err := parseFormatSizes(getEnv("WEBBY_MAX_UPLOAD_MB_BY_FORMAT", ""))
+	if err != nil {
+		invalid("Invalid WEBBY_MAX_UPLOAD_MB_BY_FORMAT: %v", err)
+	}
+
+	// Uploads that would leave less free disk space than this, in megabytes, are refused
+	minFreeMB, err := strconv.Atoi(getEnv("WEBBY_MIN_FREE_SPACE_MB", strconv.FormatInt(api.DefaultMinFreeSpace>>20, 10)))
+	if err != nil || minFreeMB < 0 {
+		invalid("Invalid WEBBY_MIN_FREE_SPACE_MB: %q", os.Getenv("WEBBY_MIN_FREE_SPACE_MB"))
+	}
+
+	// How long requests may run before they're cut off ("0" disables), with
+	// a longer limit for book file uploads and overrides for routes such as
+	// "GET /api/books/:id/cbz/thumbnails=2m"
+	requestTimeout, err := time.ParseDuration(getEnv("WEBBY_REQUEST_TIMEOUT", api.DefaultRequestTimeout.String()))
+	if err != nil {
+		invalid("Invalid WEBBY_REQUEST_TIMEOUT: %v", err)
+	}
+	uploadTimeout, err := time.ParseDuration(getEnv("WEBBY_UPLOAD_TIMEOUT", api.DefaultUploadTimeout.String()))
+	if err != nil {
+		invalid("Invalid WEBBY_UPLOAD_TIMEOUT: %v", err)
+	}
+	routeTimeouts, err := parseRouteTimeouts(getEnv("WEBBY_ROUTE_TIMEOUTS", ""))
+	if err != nil {
+		invalid("Invalid WEBBY_ROUTE_TIMEOUTS: %v", err)
+	}
+
+	// How many CPU-heavy requests, such as parsing uploads, run at once, and
+	// how many more wait before the server answers 503
+	workers, err := strconv.Atoi(getEnv("WEBBY_WORKERS", strconv.Itoa(runtime.NumCPU())))
+	if err != nil || workers <= 0 {
+		invalid("Invalid WEBBY_WORKERS: %q", os.Getenv("WEBBY_WORKERS"))
+	}
+	workerQueue, err := strconv.Atoi(getEnv("WEBBY_WORKER_QUEUE", strconv.Itoa(api.DefaultWorkerQueue)))
+	if err != nil || workerQueue < 0 {
+		invalid("Invalid WEBBY_WORKER_QUEUE: %q", os.Getenv("WEBBY_WORKER_QUEUE"))
+	}
+
+	// How much of a book, in percent, its sample keeps for previews from
+	// the catalog or a share
+	samplePercent, err := strconv.Atoi(getEnv("WEBBY_SAMPLE_PERCENT", strconv.Itoa(api.DefaultSamplePercent)))
+	if err != nil || samplePercent < 1 || samplePercent > 100 {
+		invalid("Invalid WEBBY_SAMPLE_PERCENT: %q (want 1 to 100)", os.Getenv("WEBBY_SAMPLE_PERCENT"))
+	}
+
+	// Book metadata providers run as external programs, such as
+	// "isfdb=/opt/webby/isfdb.py", and how long each run may take. A
+	// lookup or refresh uses one when asked for it by name.
+	pluginTimeout, err := time.ParseDuration(getEnv("WEBBY_METADATA_PLUGIN_TIMEOUT", metadata.DefaultPluginTimeout.String()))
+	if err != nil || pluginTimeout <= 0 {
+		invalid("Invalid WEBBY_METADATA_PLUGIN_TIMEOUT: %q", os.Getenv("WEBBY_METADATA_PLUGIN_TIMEOUT"))
+	}
+	metadataPlugins, err := parseMetadataPlugins(getEnv("WEBBY_METADATA_PLUGINS", ""), pluginTimeout)
+	if err != nil {
+		invalid("Invalid WEBBY_METADATA_PLUGINS: %v", err)
+	}
+
+	// Verification email can't be sent without a mail server
+	if requireEmailVerification && !notify.NewSMTPChannel().IsConfigured() {
+		invalid("WEBBY_REQUIRE_EMAIL_VERIFICATION needs WEBBY_SMTP_HOST and WEBBY_SMTP_FROM to send verification email")
+	}
+	// Nor without a public URL, as links built from a request's Host header
+	// could point at another site
+	if requireEmailVerification && publicURL == "" {
+		invalid("WEBBY_REQUIRE_EMAIL_VERIFICATION needs WEBBY_PUBLIC_URL for the links in verification email")
+	}
+
+	problems = append(problems, checkEnvironment(dataDir, bindAddr, serverTLS)...)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			log.Print(problem)
+		}
+		log.Fatalf("Webby can't start: %d configuration problem(s); see above", len(problems))
+	}
+	for _, warning := range configWarnings() {
+		log.Printf("Warning: %s", warning)
+	}
+	if publicURL == "" && notify.NewSMTPChannel().IsConfigured() {
+		log.Print("Warning: WEBBY_PUBLIC_URL isn't set, so password reset and verification email are off")
+	}
+	if *checkConfigFlag {
+		fmt.Println("Configuration OK")
+		return
+	}
+	epub.SetCacheSize(epubCacheSize)
+
 	// Ensure data directory exists
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory: %v", err)
@@ -53,7 +258,45 @@ func main() {
 
 	// Initialize handlers
 	handler := api.NewHandler(db, files)
-	authHandler := api.NewAuthHandler(db, disableRegistration)
+	handler.SetDefaultVisibility(defaultVisibility)
+	handler.SetAdmins(adminUsers)
+	handler.SetSessionIdleTimeout(sessionIdleTimeout)
+	handler.SetUploadLimits(int64(maxUploadMB)<<20, formatUploadSizes)
+	handler.SetMinFreeSpace(int64(minFreeMB) << 20)
+	handler.SetRequestTimeouts(requestTimeout, uploadTimeout, routeTimeouts)
+	handler.SetWorkerLimits(workers, workerQueue)
+	handler.SetSamplePercent(samplePercent)
+	handler.SetOPDSPrivateNetworks(getEnv("WEBBY_OPDS_ALLOW_PRIVATE_NETWORKS", "") == "true")
+	handler.SetMetadataPlugins(metadataPlugins)
+	handler.SetBasePath(basePath)
+	handler.SetBuildInfo(build)
+	authHandler := api.NewAuthHandler(db, handler.Notifier(), api.AuthConfig{
+		DisableRegistration:      disableRegistration,
+		RequireAuth:              requireAuth,
+		RequireEmailVerification: requireEmailVerification,
+		PublicURL:                publicURL,
+	})
+
+	// Stopped by SIGINT or SIGTERM, after requests in flight finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start background jobs
+	if releaseCheckInterval > 0 {
+		handler.StartReleaseChecker(ctx, releaseCheckInterval)
+	}
+	if staleSessionAge > 0 {
+		handler.StartSessionSweeper(ctx, staleSessionAge)
+	}
+	if loanReminderInterval > 0 {
+		handler.StartLoanReminders(ctx, loanReminderInterval)
+	}
+	handler.StartStorageSnapshots(ctx)
+	handler.StartCleanup(ctx)
+	handler.StartCoverPaletteBackfill(ctx)
+	handler.StartPositionNormalization(ctx)
+	handler.StartJobQueue(ctx)
+	handler.StartMirrorSync(ctx)
 
 	// Set up Gin router
 	r := gin.Default()
@@ -61,14 +304,34 @@ func main() {
 	// Enable CORS for mobile access
 	r.Use(corsMiddleware())
 
+	// Tag each request with an ID that error responses echo back
+	r.Use(apierror.RequestIDMiddleware())
+
+	// Compress text responses, unless a reverse proxy in front already does
+	if getEnv("WEBBY_COMPRESSION", "true") != "false" {
+		r.Use(api.Compress())
+	}
+
+	// Everything is served under the base path
+	root := r.Group(basePath)
+
 	// Health check
-	r.GET("/health", handler.HealthCheck)
+	root.GET("/health", handler.HealthCheck)
+
+	// Route-level book policies: the book named by :id must be readable, or
+	// changeable, by the caller
+	canRead := handler.RequireBook(authz.Read)
+	canWrite := handler.RequireBook(authz.Write)
 
 	// API routes
-	apiGroup := r.Group("/api")
+	apiGroup := root.Group("/api")
+	apiGroup.Use(handler.RequestTimeouts(), handler.TrackLibraryWrites())
 	{
 		// API documentation (for TUI clients)
 		apiGroup.GET("", handler.APIInfo)
+		apiGroup.GET("/version", handler.GetVersion)
+		apiGroup.GET("/openapi.json", handler.OpenAPISpec)
+		apiGroup.GET("/docs", handler.APIDocs)
 
 		// Auth routes (public)
 		authGroup := apiGroup.Group("/auth")
@@ -77,27 +340,96 @@ func main() {
 			authGroup.POST("/register", authHandler.Register)
 			authGroup.POST("/login", authHandler.Login)
 			authGroup.POST("/refresh", authHandler.RefreshToken)
+			authGroup.POST("/forgot-password", authHandler.ForgotPassword)
+			authGroup.POST("/reset-password", authHandler.ResetPassword)
+			authGroup.POST("/verify-email", authHandler.VerifyEmail)
+			authGroup.POST("/resend-verification", authHandler.ResendVerification)
 		}
 
 		// Protected routes (require authentication)
 		protected := apiGroup.Group("")
-		protected.Use(auth.AuthMiddleware())
+		protected.Use(auth.AuthMiddleware(), handler.ProfileGuard())
 		{
 			// Current user
 			protected.GET("/auth/me", authHandler.GetCurrentUser)
+			protected.PUT("/auth/password", authHandler.ChangePassword)
 			protected.GET("/users/search", authHandler.SearchUsers)
+			protected.GET("/users/me/export", handler.ExportUserData)
+			protected.DELETE("/users/me", handler.DeleteAccount)
+			protected.POST("/users/me/claim-anonymous", handler.ClaimAnonymousLibrary)
+
+			// Restricted profiles: the account manages them, and an account
+			// in one only reaches the routes ProfileGuard allows
+			protected.GET("/profiles", handler.ListProfiles)
+			protected.POST("/profiles", handler.CreateProfile)
+			protected.PUT("/profiles/pin", handler.SetProfilePIN)
+			protected.PUT("/profiles/:id", handler.UpdateProfile)
+			protected.DELETE("/profiles/:id", handler.DeleteProfile)
+			protected.POST("/profiles/:id/enter", handler.EnterProfile)
+			protected.GET("/profile", handler.GetActiveProfile)
+			protected.GET("/profile/books", handler.GetProfileBooks)
+			protected.POST("/profile/exit", handler.ExitProfile)
+
+			// Library reports
+			protected.GET("/reports/metadata-issues", handler.GetMetadataIssues)
+
+			// Background jobs, such as bulk metadata refreshes
+			protected.GET("/jobs", handler.ListJobs)
+			protected.GET("/jobs/:id", handler.GetJob)
+			protected.GET("/jobs/:id/items", handler.ListJobItems)
+			protected.POST("/jobs/:id/pause", handler.PauseJob)
+			protected.POST("/jobs/:id/resume", handler.ResumeJob)
+
+			// Server administration
+			protected.GET("/admin/storage", handler.GetStorage)
+			protected.POST("/admin/covers/optimize", handler.OptimizeCovers)
+			protected.GET("/admin/cleanup", handler.GetCleanup)
+			protected.POST("/admin/cleanup", handler.RunCleanup)
+			protected.GET("/admin/integrity", handler.GetIntegrity)
+			protected.GET("/admin/workers", handler.GetWorkers)
+			protected.POST("/admin/files/verify", handler.VerifyFiles)
+			protected.POST("/admin/files/:id/accept", handler.AcceptBookFile)
+			protected.GET("/admin/comic-patterns", handler.ListComicFilenamePatterns)
+			protected.POST("/admin/comic-patterns", handler.CreateComicFilenamePattern)
+			protected.DELETE("/admin/comic-patterns/:id", handler.DeleteComicFilenamePattern)
+			protected.GET("/admin/content-restrictions", handler.ListContentRestrictions)
+			protected.PUT("/admin/users/:id/content-restriction", handler.SetContentRestriction)
+
+			// Custom fields: admins define them, everyone fills them in
+			protected.POST("/custom-fields", handler.CreateCustomField)
+			protected.PUT("/custom-fields/:id", handler.UpdateCustomField)
+			protected.DELETE("/custom-fields/:id", handler.DeleteCustomField)
+
+			// Remote OPDS catalogs to browse and import books from
+			protected.GET("/opds-sources", handler.ListOPDSSources)
+			protected.POST("/opds-sources", handler.CreateOPDSSource)
+			protected.DELETE("/opds-sources/:id", handler.DeleteOPDSSource)
+			protected.GET("/opds-sources/:id/browse", handler.BrowseOPDSSource)
+			protected.POST("/opds-sources/:id/import", handler.ImportOPDSBooks)
+
+			// Mirroring collections with other Webby servers
+			protected.GET("/sync-keys", handler.ListSyncKeys)
+			protected.POST("/sync-keys", handler.CreateSyncKey)
+			protected.DELETE("/sync-keys/:id", handler.DeleteSyncKey)
+			protected.GET("/mirrors", handler.ListMirrors)
+			protected.POST("/mirrors", handler.CreateMirror)
+			protected.DELETE("/mirrors/:id", handler.DeleteMirror)
+			protected.POST("/mirrors/:id/sync", handler.SyncMirror)
+			protected.GET("/mirrors/:id/status", handler.GetMirrorStatus)
 
 			// Reading Lists
 			protected.GET("/reading-lists", handler.ListReadingLists)
 			protected.POST("/reading-lists", handler.CreateReadingList)
 			protected.GET("/reading-lists/:id", handler.GetReadingList)
+			protected.GET("/reading-lists/:id/download", handler.DownloadReadingList)
+			protected.GET("/reading-lists/:id/cover", handler.GetReadingListCover)
 			protected.PUT("/reading-lists/:id", handler.UpdateReadingList)
 			protected.DELETE("/reading-lists/:id", handler.DeleteReadingList)
 			protected.POST("/reading-lists/:id/books/:bookId", handler.AddBookToReadingList)
 			protected.DELETE("/reading-lists/:id/books/:bookId", handler.RemoveBookFromReadingList)
 			protected.PUT("/reading-lists/:id/books/:bookId/toggle", handler.ToggleBookInReadingList)
 			protected.PUT("/reading-lists/:id/reorder", handler.ReorderReadingList)
-			protected.GET("/books/:id/reading-lists", handler.GetBookReadingLists)
+			protected.GET("/books/:id/reading-lists", canRead, handler.GetBookReadingLists)
 
 			// Custom Tags
 			protected.GET("/tags", handler.ListTags)
@@ -106,91 +438,272 @@ func main() {
 			protected.PUT("/tags/:id", handler.UpdateTag)
 			protected.DELETE("/tags/:id", handler.DeleteTag)
 			protected.GET("/tags/:id/books", handler.GetBooksByTag)
-			protected.GET("/books/:id/tags", handler.GetBookTags)
-			protected.POST("/books/:id/tags/:tagId", handler.AddTagToBook)
-			protected.DELETE("/books/:id/tags/:tagId", handler.RemoveTagFromBook)
-			protected.PUT("/books/:id/tags/:tagId/toggle", handler.ToggleBookTag)
+			protected.GET("/tags/:id/cover", handler.GetTagCover)
+			protected.GET("/books/:id/tags", canRead, handler.GetBookTags)
+			protected.POST("/books/:id/tags/:tagId", canRead, handler.AddTagToBook)
+			protected.DELETE("/books/:id/tags/:tagId", canRead, handler.RemoveTagFromBook)
+			protected.PUT("/books/:id/tags/:tagId/toggle", canRead, handler.ToggleBookTag)
 
 			// Annotations & Highlights
 			protected.GET("/annotations", handler.ListAllAnnotations)
 			protected.GET("/annotations/stats", handler.GetAnnotationStats)
-			protected.GET("/books/:id/annotations", handler.ListAnnotationsForBook)
-			protected.GET("/books/:id/annotations/chapter/:chapter", handler.ListAnnotationsForChapter)
-			protected.POST("/books/:id/annotations", handler.CreateAnnotation)
-			protected.GET("/books/:id/annotations/:annotationId", handler.GetAnnotation)
-			protected.PUT("/books/:id/annotations/:annotationId", handler.UpdateAnnotation)
-			protected.DELETE("/books/:id/annotations/:annotationId", handler.DeleteAnnotation)
+			protected.GET("/annotations/review", handler.GetHighlightReview)
+			protected.POST("/annotations/review", handler.MarkHighlightsReviewed)
+			protected.GET("/annotations/:id/citation", handler.GetAnnotationCitation)
+			protected.GET("/books/:id/annotations", canRead, handler.ListAnnotationsForBook)
+			protected.GET("/books/:id/annotations/chapter/:chapter", canRead, handler.ListAnnotationsForChapter)
+			protected.GET("/books/:id/annotations/chapter/:chapter/shared", canRead, handler.ListSharedAnnotationsForChapter)
+			protected.POST("/books/:id/annotations", canRead, handler.CreateAnnotation)
+			protected.GET("/books/:id/annotations/:annotationId", canRead, handler.GetAnnotation)
+			protected.GET("/books/:id/annotations/:annotationId/location", canRead, handler.GetAnnotationLocation)
+			protected.PUT("/books/:id/annotations/:annotationId", canRead, handler.UpdateAnnotation)
+			protected.DELETE("/books/:id/annotations/:annotationId", canRead, handler.DeleteAnnotation)
+
+			// Book notes
+			protected.GET("/books/:id/notes", canRead, handler.ListBookNotes)
+			protected.POST("/books/:id/notes", canRead, handler.CreateBookNote)
+			protected.GET("/books/:id/notes/:noteId", canRead, handler.GetBookNote)
+			protected.PUT("/books/:id/notes/:noteId", canRead, handler.UpdateBookNote)
+			protected.DELETE("/books/:id/notes/:noteId", canRead, handler.DeleteBookNote)
+			protected.GET("/books/:id/notes/:noteId/revisions", canRead, handler.GetBookNoteRevisions)
 
 			// Reading Statistics
 			protected.GET("/stats", handler.GetUserStatistics)
 			protected.GET("/stats/summary", handler.GetStatsSummary)
 			protected.GET("/stats/daily", handler.GetDailyStats)
+			protected.GET("/stats/export", handler.ExportStats)
+			protected.GET("/stats/memories", handler.GetMemories)
+			protected.GET("/stats/preferences", handler.GetStatsPreferences)
+			protected.PUT("/stats/preferences", handler.UpdateStatsPreferences)
+			protected.DELETE("/stats/history", handler.PurgeReadingHistory)
 			protected.GET("/stats/sessions", handler.GetRecentSessions)
 			protected.POST("/stats/sessions", handler.StartReadingSession)
 			protected.PUT("/stats/sessions/:id", handler.EndReadingSession)
-			protected.PUT("/books/:id/reading-session", handler.UpdateReadingSessionProgress)
-			protected.GET("/books/:id/stats", handler.GetBookReadingStats)
+			protected.PUT("/books/:id/reading-session", canRead, handler.UpdateReadingSessionProgress)
+			protected.POST("/books/:id/reading-session/pause", canRead, handler.PauseReadingSession)
+			protected.POST("/books/:id/reading-session/resume", canRead, handler.ResumeReadingSession)
+			protected.GET("/books/:id/stats", canRead, handler.GetBookReadingStats)
+
+			// Notifications
+			protected.GET("/notifications/channels", handler.ListNotificationChannels)
+			protected.POST("/notifications/channels", handler.CreateNotificationChannel)
+			protected.PUT("/notifications/channels/:id", handler.UpdateNotificationChannel)
+			protected.DELETE("/notifications/channels/:id", handler.DeleteNotificationChannel)
+			protected.POST("/notifications/channels/:id/test", handler.TestNotificationChannel)
+			protected.GET("/notifications/subscriptions", handler.GetNotificationSubscriptions)
+			protected.PUT("/notifications/subscriptions", handler.UpdateNotificationSubscriptions)
+
+			// Reading trackers
+			protected.GET("/trackers", handler.ListTrackers)
+			protected.POST("/trackers", handler.CreateTracker)
+			protected.PUT("/trackers/:id", handler.UpdateTracker)
+			protected.DELETE("/trackers/:id", handler.DeleteTracker)
+			protected.POST("/trackers/:id/test", handler.TestTracker)
+
+			// Follows & new releases
+			protected.GET("/follows", handler.ListFollows)
+			protected.POST("/follows", handler.CreateFollow)
+			protected.GET("/follows/updates", handler.GetFollowUpdates)
+			protected.POST("/follows/updates/seen", handler.MarkFollowUpdatesSeen)
+			protected.DELETE("/follows/:id", handler.DeleteFollow)
+			protected.POST("/follows/:id/check", handler.CheckFollow)
+
+			// Reviews
+			protected.GET("/reviews", handler.ListMyReviews)
+			protected.GET("/books/:id/review", canRead, handler.GetMyBookReview)
+			protected.PUT("/books/:id/review", canRead, handler.SaveBookReview)
+			protected.DELETE("/books/:id/review", canRead, handler.DeleteBookReview)
+			protected.GET("/books/:id/reviews", canRead, handler.ListBookReviews)
+
+			// Reader preferences
+			protected.GET("/reader/preferences", handler.GetReaderPreferences)
+			protected.PUT("/reader/preferences", handler.UpdateReaderPreferences)
+			protected.GET("/reader/css", handler.GetGlobalStyleOverride)
+			protected.PUT("/reader/css", handler.SaveGlobalStyleOverride)
+			protected.DELETE("/reader/css", handler.DeleteGlobalStyleOverride)
+			protected.GET("/library/preferences", handler.GetLibraryPreferences)
+			protected.PUT("/library/preferences", handler.UpdateLibraryPreferences)
+			protected.POST("/library/subject-tags/sync", handler.SyncAllSubjectTags)
+			protected.POST("/library/reorganize", handler.ReorganizeLibrary)
+			protected.GET("/books/:id/css", canRead, handler.GetBookStyleOverride)
+			protected.PUT("/books/:id/css", canRead, handler.SaveBookStyleOverride)
+			protected.DELETE("/books/:id/css", canRead, handler.DeleteBookStyleOverride)
+
+			// Lending
+			protected.GET("/loans", handler.ListLoans)
+			protected.GET("/loans/borrowed", handler.ListBorrowedBooks)
+			protected.POST("/books/:id/loans", canRead, handler.LendBook)
+			protected.POST("/loans/:id/return", handler.ReturnLoan)
+			protected.DELETE("/loans/:id", handler.DeleteLoan)
+
+			// Book clubs
+			protected.GET("/clubs", handler.ListBookClubs)
+			protected.POST("/clubs", handler.CreateBookClub)
+			protected.GET("/clubs/:id", handler.GetBookClub)
+			protected.PUT("/clubs/:id", handler.UpdateBookClub)
+			protected.DELETE("/clubs/:id", handler.DeleteBookClub)
+			protected.POST("/clubs/:id/members", handler.AddBookClubMember)
+			protected.DELETE("/clubs/:id/members/:userId", handler.RemoveBookClubMember)
+			protected.PUT("/clubs/:id/schedule", handler.SetBookClubSchedule)
+			protected.GET("/clubs/:id/comments", handler.ListBookClubComments)
+			protected.POST("/clubs/:id/comments", handler.CreateBookClubComment)
+			protected.DELETE("/clubs/:id/comments/:commentId", handler.DeleteBookClubComment)
+
+			// Reading challenges and badges
+			protected.GET("/challenges", handler.ListReadingChallenges)
+			protected.POST("/challenges", handler.CreateReadingChallenge)
+			protected.GET("/challenges/:id", handler.GetReadingChallenge)
+			protected.DELETE("/challenges/:id", handler.DeleteReadingChallenge)
+			protected.POST("/challenges/:id/participants", handler.InviteToReadingChallenge)
+			protected.DELETE("/challenges/:id/participants/:userId", handler.RemoveChallengeParticipant)
+			protected.POST("/challenges/:id/join", handler.JoinReadingChallenge)
+			protected.GET("/challenges/:id/leaderboard", handler.GetChallengeLeaderboard)
+			protected.GET("/badges", handler.ListBadges)
+
+			// Achievements
+			protected.GET("/achievements", handler.ListAchievements)
+
+			// Delta sync for offline clients
+			protected.GET("/sync", handler.GetSyncDelta)
+
+			// Devices and their download preferences
+			protected.GET("/devices", handler.ListDevices)
+			protected.POST("/devices", handler.RegisterDevice)
+			protected.PUT("/devices/:id", handler.UpdateDevice)
+			protected.POST("/devices/:id/token", handler.ResetDeviceToken)
+			protected.DELETE("/devices/:id", handler.DeleteDevice)
+
+			// Activity feed
+			protected.GET("/activity", handler.GetActivityFeed)
+			protected.GET("/activity/preferences", handler.GetActivityPreferences)
+			protected.PUT("/activity/preferences", handler.UpdateActivityPreferences)
+
+			// Comic series and crossover reading orders
+			protected.GET("/series", handler.ListComicSeries)
+			protected.POST("/series", handler.CreateComicSeries)
+			protected.GET("/series/:id", handler.GetComicSeries)
+			protected.PUT("/series/:id", handler.UpdateComicSeries)
+			protected.DELETE("/series/:id", handler.DeleteComicSeries)
+			protected.POST("/series/:id/refresh", handler.RefreshComicSeries)
+			protected.PUT("/series/:id/issues/:number", handler.UpdateComicIssueRead)
+			protected.GET("/reading-orders", handler.ListReadingOrders)
+			protected.POST("/reading-orders", handler.CreateReadingOrder)
+			protected.POST("/reading-orders/arcs", handler.ImportStoryArc)
+			protected.GET("/reading-orders/:id", handler.GetReadingOrder)
+			protected.PUT("/reading-orders/:id", handler.UpdateReadingOrder)
+			protected.DELETE("/reading-orders/:id", handler.DeleteReadingOrder)
+			protected.PUT("/reading-orders/:id/entries", handler.SetReadingOrderEntries)
+			protected.POST("/reading-orders/:id/refresh", handler.RefreshReadingOrder)
+		}
+
+		// Mirror routes for another Webby server, authenticated by sync key
+		mirrorGroup := apiGroup.Group("/mirror")
+		mirrorGroup.Use(handler.RequireSyncKey())
+		{
+			mirrorGroup.GET("/manifest", handler.GetMirrorManifest)
+			mirrorGroup.POST("/push", handler.PushMirror)
+			mirrorGroup.GET("/books/:id/file", handler.GetMirrorBookFile)
+			mirrorGroup.POST("/books/:id/file", handler.UploadMirrorBookFile)
 		}
 
 		// Book routes - use optional auth for backward compatibility
 		// When auth is present, operations are scoped to user
 		booksGroup := apiGroup.Group("")
-		booksGroup.Use(auth.OptionalAuthMiddleware())
+		booksGroup.Use(auth.LibraryMiddleware(requireAuth), handler.ProfileGuard())
 		{
 			// Books
 			booksGroup.POST("/books", handler.UploadBook)
-			booksGroup.GET("/books", handler.ListBooks)
-			booksGroup.GET("/books/:id", handler.GetBook)
-			booksGroup.DELETE("/books/:id", handler.DeleteBook)
+			booksGroup.POST("/books/physical", handler.CreatePhysicalBook)
+			booksGroup.GET("/books", handler.LibraryETag(), handler.ListBooks)
+			booksGroup.GET("/books/:id", canRead, handler.GetBook)
+			booksGroup.DELETE("/books/:id", canWrite, handler.DeleteBook)
+			booksGroup.POST("/books/:id/restore", canWrite, handler.RestoreBookData)
+			booksGroup.PUT("/books/:id/file", canWrite, handler.ReplaceBookFile)
+
+			// Editions: other formats of the same book
+			booksGroup.GET("/books/:id/files", canRead, handler.ListBookFiles)
+			booksGroup.POST("/books/:id/files", canWrite, handler.AddBookFile)
+			booksGroup.GET("/books/:id/files/:fileId", canRead, handler.GetBookEdition)
+			booksGroup.DELETE("/books/:id/files/:fileId", canWrite, handler.DeleteBookFile)
 
 			// Grouping
 			booksGroup.GET("/books/by-author", handler.GetBooksByAuthor)
 			booksGroup.GET("/books/by-series", handler.GetBooksBySeries)
+			booksGroup.GET("/books/by-language", handler.GetBooksByLanguage)
+			booksGroup.GET("/books/index", handler.LibraryETag(), handler.GetBookIndex)
+			booksGroup.GET("/books/facets", handler.LibraryETag(), handler.GetBookFacets)
+			booksGroup.GET("/search/suggest", handler.GetSearchSuggestions)
+			booksGroup.POST("/books/languages/detect", handler.DetectBookLanguages)
 
 			// Similar books recommendations
-			booksGroup.GET("/books/:id/similar", handler.GetSimilarBooks)
+			booksGroup.GET("/books/:id/similar", canRead, handler.GetSimilarBooks)
 
 			// Reading
-			booksGroup.GET("/books/:id/cover", handler.GetBookCover)
-			booksGroup.GET("/books/:id/file", handler.GetBookFile)
-			booksGroup.GET("/books/:id/toc", handler.GetTableOfContents)
-			booksGroup.GET("/books/:id/content/:chapter", handler.GetChapterContent)
-			booksGroup.GET("/books/:id/text/:chapter", handler.GetChapterText)
-			booksGroup.GET("/books/:id/resource/*path", handler.GetBookResource)
+			booksGroup.GET("/books/:id/cover", canRead, handler.GetBookCover)
+			booksGroup.GET("/books/:id/file", canRead, handler.GetBookFile)
+			booksGroup.GET("/books/:id/toc", canRead, handler.GetTableOfContents)
+			booksGroup.GET("/books/:id/content/:chapter", canRead, handler.GetChapterContent)
+			booksGroup.GET("/books/:id/text/:chapter", canRead, handler.GetChapterText)
+			booksGroup.GET("/books/:id/footnotes/:chapter", canRead, handler.GetFootnote)
+			booksGroup.GET("/books/:id/resource/*path", canRead, handler.GetBookResource)
+			booksGroup.GET("/books/:id/offline-bundle", canRead, handler.GetOfflineBundle)
+			booksGroup.GET("/books/:id/sample", canRead, handler.GetBookSample)
 
 			// CBZ comic reading
-			booksGroup.GET("/books/:id/cbz/info", handler.GetCBZInfo)
-			booksGroup.GET("/books/:id/cbz/page/:page", handler.GetCBZPage)
+			booksGroup.GET("/books/:id/cbz/info", canRead, handler.GetCBZInfo)
+			booksGroup.GET("/books/:id/cbz/page/:page", canRead, handler.GetCBZPage)
+			booksGroup.GET("/books/:id/cbz/strip", canRead, handler.GetCBZStrip)
+			booksGroup.GET("/books/:id/cbz/strip/:slice", canRead, handler.GetCBZStripSlice)
+			booksGroup.GET("/books/:id/cbz/thumbnails", canRead, handler.GetCBZThumbnails)
+			booksGroup.GET("/books/:id/pdf/text/:page", canRead, handler.GetPDFPageText)
+			booksGroup.PUT("/books/:id/reading-direction", canWrite, handler.UpdateBookReadingDirection)
+			booksGroup.PUT("/books/:id/long-strip", canWrite, handler.UpdateBookLongStrip)
+			booksGroup.PUT("/books/:id/visibility", canWrite, handler.UpdateBookVisibility)
+			booksGroup.PUT("/books/:id/age-rating", handler.UpdateBookAgeRating)
+			booksGroup.GET("/series/reading-directions", handler.ListSeriesReadingDirections)
+			booksGroup.PUT("/series/reading-directions", handler.UpdateSeriesReadingDirection)
+			booksGroup.DELETE("/series/reading-directions", handler.DeleteSeriesReadingDirection)
 
 			// Reading position
-			booksGroup.GET("/books/:id/position", handler.GetReadingPosition)
-			booksGroup.POST("/books/:id/position", handler.SaveReadingPosition)
+			booksGroup.GET("/books/:id/position", canRead, handler.GetReadingPosition)
+			booksGroup.POST("/books/:id/position", canRead, handler.SaveReadingPosition)
+			booksGroup.GET("/books/:id/cfi", canRead, handler.GetPositionCFI)
+			booksGroup.GET("/books/:id/cfi/resolve", canRead, handler.ResolvePositionCFI)
 
 			// Read status tracking
 			booksGroup.GET("/books/status/counts", handler.GetReadStatusCounts)
-			booksGroup.GET("/books/:id/status", handler.GetBookReadStatus)
-			booksGroup.PUT("/books/:id/status", handler.UpdateBookReadStatus)
+			booksGroup.GET("/books/:id/status", canRead, handler.GetBookReadStatus)
+			booksGroup.PUT("/books/:id/status", canRead, handler.UpdateBookReadStatus)
 			booksGroup.POST("/books/status/bulk", handler.BulkUpdateReadStatus)
+			booksGroup.GET("/custom-fields", handler.ListCustomFields)
+			booksGroup.PUT("/books/:id/custom-fields", canRead, handler.SetBookCustomFields)
+			booksGroup.POST("/books/custom-fields/bulk", handler.BulkSetCustomFields)
 
 			// Star ratings
-			booksGroup.GET("/books/:id/rating", handler.GetBookRating)
-			booksGroup.PUT("/books/:id/rating", handler.UpdateBookRating)
+			booksGroup.GET("/books/:id/rating", canRead, handler.GetBookRating)
+			booksGroup.PUT("/books/:id/rating", canRead, handler.UpdateBookRating)
 
 			// Book collections (for a specific book)
-			booksGroup.GET("/books/:id/collections", handler.GetBookCollections)
+			booksGroup.GET("/books/:id/collections", canRead, handler.GetBookCollections)
 
 			// Book Metadata
 			booksGroup.GET("/metadata/lookup", handler.LookupMetadata)
 			booksGroup.GET("/metadata/search", handler.SearchMetadata)
-			booksGroup.POST("/books/:id/metadata/refresh", handler.RefreshBookMetadata)
-			booksGroup.PUT("/books/:id/metadata", handler.UpdateBookMetadata)
+			booksGroup.GET("/metadata/providers", handler.ListMetadataProviders)
+			booksGroup.POST("/books/:id/metadata/refresh", canWrite, handler.RefreshBookMetadata)
+			booksGroup.PUT("/books/:id/metadata", canWrite, handler.UpdateBookMetadata)
+			booksGroup.GET("/books/:id/history", canRead, handler.GetBookHistory)
+			booksGroup.POST("/books/:id/history/:rev/revert", canWrite, handler.RevertBookRevision)
 			booksGroup.POST("/metadata/bulk-refresh", handler.BulkRefreshMetadata)
+			booksGroup.POST("/metadata/scan", handler.ScanBarcode)
 
 			// Comic Metadata
 			booksGroup.GET("/metadata/comic/status", handler.GetComicMetadataStatus)
 			booksGroup.GET("/metadata/comic/search", handler.SearchComicMetadata)
-			booksGroup.POST("/books/:id/metadata/comic/refresh", handler.RefreshComicMetadata)
-			booksGroup.POST("/books/:id/metadata/comic/reprocess", handler.ReprocessComicFilename)
+			booksGroup.GET("/metadata/comic/arcs", handler.SearchComicStoryArcs)
+			booksGroup.POST("/books/:id/metadata/comic/refresh", canWrite, handler.RefreshComicMetadata)
+			booksGroup.POST("/books/:id/metadata/comic/reprocess", canWrite, handler.ReprocessComicFilename)
+			booksGroup.POST("/metadata/comic/parse-preview", handler.PreviewComicFilename)
 
 			// Duplicate Detection
 			booksGroup.GET("/duplicates", handler.GetDuplicates)
@@ -200,25 +713,30 @@ func main() {
 
 			// Book sharing
 			booksGroup.GET("/books/shared", handler.GetSharedBooks)
-			booksGroup.GET("/books/:id/shares", handler.GetBookShares)
-			booksGroup.POST("/books/:id/share/:userId", handler.ShareBook)
-			booksGroup.DELETE("/books/:id/share/:userId", handler.UnshareBook)
+			booksGroup.GET("/books/:id/shares", canWrite, handler.GetBookShares)
+			booksGroup.POST("/books/:id/share/:userId", canWrite, handler.ShareBook)
+			booksGroup.DELETE("/books/:id/share/:userId", canWrite, handler.UnshareBook)
+			booksGroup.POST("/books/:id/transfer/:userId", handler.TransferBook)
 
 			// Collections
 			booksGroup.POST("/collections", handler.CreateCollection)
-			booksGroup.GET("/collections", handler.ListCollections)
-			booksGroup.GET("/collections/:id", handler.GetCollection)
+			booksGroup.GET("/collections", handler.LibraryETag(), handler.ListCollections)
+			booksGroup.GET("/collections/:id", handler.LibraryETag(), handler.GetCollection)
+			booksGroup.GET("/collections/:id/download", handler.DownloadCollection)
+			booksGroup.GET("/collections/:id/cover", handler.GetCollectionCover)
 			booksGroup.PUT("/collections/:id", handler.UpdateCollection)
 			booksGroup.DELETE("/collections/:id", handler.DeleteCollection)
 			booksGroup.POST("/collections/:id/books/:bookId", handler.AddBookToCollection)
 			booksGroup.DELETE("/collections/:id/books/:bookId", handler.RemoveBookFromCollection)
 			booksGroup.POST("/collections/:id/books", handler.BulkAddToCollection)
+			booksGroup.PUT("/collections/:id/reorder", handler.ReorderCollection)
 		}
 	}
 
 	// OPDS routes for e-reader apps
-	opdsGroup := r.Group("/opds/v1.2")
-	opdsGroup.Use(auth.OptionalAuthMiddleware())
+	opdsGroup := root.Group("/opds/v1.2")
+	opdsGroup.Use(auth.LibraryMiddleware(requireAuth), handler.ProfileGuard())
+	opdsGroup.Use(handler.LibraryETag())
 	{
 		// Root catalog
 		opdsGroup.GET("/catalog.xml", handler.OPDSCatalog)
@@ -226,6 +744,8 @@ func main() {
 		// Acquisition feeds
 		opdsGroup.GET("/books/all.xml", handler.OPDSAllBooks)
 		opdsGroup.GET("/books/recent.xml", handler.OPDSRecentBooks)
+		opdsGroup.GET("/books/updated.xml", handler.OPDSUpdatedBooks)
+		opdsGroup.GET("/books/on-deck.xml", handler.OPDSOnDeckBooks)
 		opdsGroup.GET("/books/ebooks.xml", handler.OPDSEBooks)
 		opdsGroup.GET("/books/comics.xml", handler.OPDSComics)
 
@@ -234,38 +754,66 @@ func main() {
 		opdsGroup.GET("/authors/:author", handler.OPDSAuthorBooks)
 		opdsGroup.GET("/series.xml", handler.OPDSSeries)
 		opdsGroup.GET("/series/:series", handler.OPDSSeriesBooks)
+		opdsGroup.GET("/reading-orders.xml", handler.OPDSReadingOrders)
+		opdsGroup.GET("/reading-orders/:id", handler.OPDSReadingOrderBooks)
+		opdsGroup.GET("/collections.xml", handler.OPDSCollections)
+		opdsGroup.GET("/collections/:id", handler.OPDSCollectionBooks)
 
 		// Search
 		opdsGroup.GET("/search.xml", handler.OPDSSearch)
 
 		// Book download
-		opdsGroup.GET("/books/:id/download", handler.OPDSDownload)
+		opdsGroup.GET("/books/:id/download", canRead, handler.OPDSDownload)
 	}
 
 	// Serve static files for web reader
-	r.Static("/static", "web/static")
-	r.GET("/reader/:id", handler.ServeReader)
+	root.Static("/static", "web/static")
+	root.GET("/reader/:id", handler.ServeReader)
 
 	// Serve auth page
-	r.GET("/auth", func(c *gin.Context) {
-		c.File("web/static/auth.html")
-	})
+	root.GET("/auth", handler.ServePage("web/static/auth.html"))
 
 	// Serve duplicates page
-	r.GET("/duplicates", func(c *gin.Context) {
-		c.File("web/static/duplicates.html")
+	root.GET("/duplicates", handler.ServePage("web/static/duplicates.html"))
+
+	// Serve the web app manifest so the library can be installed as a PWA
+	root.GET("/manifest.webmanifest", func(c *gin.Context) {
+		c.Header("Content-Type", "application/manifest+json")
+		c.File("web/static/manifest.webmanifest")
 	})
 
 	// Serve library index at root
-	r.GET("/", func(c *gin.Context) {
-		c.File("web/static/index.html")
-	})
+	root.GET("/", handler.ServePage("web/static/index.html"))
+
+	// Publish the registered routes in the API docs
+	handler.SetRoutes(r.Routes())
+
+	// A PID file for init scripts that track the server by it
+	if pidFile := getEnv("WEBBY_PID_FILE", ""); pidFile != "" {
+		removePIDFile, err := writePIDFile(pidFile)
+		if err != nil {
+			log.Fatalf("Failed to write WEBBY_PID_FILE: %v", err)
+		}
+		defer removePIDFile()
+	}
 
 	// Start server
-	log.Printf("Webby server starting on %s", bindAddr)
+	log.Printf("%s starting on %s (TLS: %s)", versionString(build), bindAddr, serverTLS.mode)
 	log.Printf("Data directory: %s", dataDir)
-	if err := r.Run(bindAddr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		<-ctx.Done()
+		log.Print("Shutting down")
+		sdNotify("STOPPING=1")
+	}()
+	err = serve(ctx, r, bindAddr, serverTLS, func() {
+		// Under a systemd Type=notify service, startup is done once the
+		// server is listening
+		if err := sdNotify("READY=1"); err != nil {
+			log.Printf("Warning: failed to notify systemd: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Server stopped: %v", err)
 	}
 }
 
@@ -276,11 +824,79 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// parseFormatSizes parses per-format sizes in megabytes, such as
+// "pdf=300,cbz=500", into bytes by format
+func parseFormatSizes(s string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		format, mb, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(mb))
+		if !ok || err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q isn't format=megabytes", entry)
+		}
+		sizes[strings.ToLower(strings.TrimSpace(format))] = int64(n) << 20
+	}
+	return sizes, nil
+}
+
+// parseRouteTimeouts parses a list like "GET /api/books/:id/cbz/thumbnails=2m"
+// into timeouts by method and route pattern
+func parseRouteTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || !hasPath || err != nil || timeout < 0 {
+			return nil, fmt.Errorf("%q isn't METHOD /path=duration", entry)
+		}
+		timeouts[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = timeout
+	}
+	return timeouts, nil
+}
+
+// pluginName is what a metadata plugin's name looks like
+var pluginName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// parseMetadataPlugins parses a list like "isfdb=/opt/webby/isfdb.py" into
+// metadata providers running each program with the given timeout
+func parseMetadataPlugins(s string, timeout time.Duration) ([]metadata.Provider, error) {
+	names := map[string]bool{metadata.NewOpenLibraryProvider().Name(): true}
+	var plugins []metadata.Provider
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, command, ok := strings.Cut(entry, "=")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || !pluginName.MatchString(name) || command == "" {
+			return nil, fmt.Errorf("%q isn't name=/path/to/program", entry)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("provider name %q is already taken", name)
+		}
+		path, err := exec.LookPath(command)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		names[name] = true
+		plugins = append(plugins, metadata.NewExecProvider(name, path, timeout))
+	}
+	return plugins, nil
+}
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, If-None-Match")
+		c.Header("Access-Control-Expose-Headers", "X-Chapter-Page, X-Chapter-Pages, X-Request-ID, ETag")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
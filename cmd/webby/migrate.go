@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+const migrateUsage = `Usage: webby migrate <command> [flags]
+
+Commands:
+  status               List migrations and whether each is applied
+  up [-dry-run]        Apply pending migrations
+  down [-steps N] [-dry-run]
+                       Revert the last N applied migrations (default 1)
+`
+
+// runMigrate handles "webby migrate", which inspects and changes the schema
+// version of the database in WEBBY_DATA_DIR
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return errors.New("missing migrate command")
+	}
+
+	command := args[0]
+	if command != "status" && command != "up" && command != "down" {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	fs := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Show what would change without changing it")
+	steps := fs.Int("steps", 1, "Number of migrations to revert (down only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	db, err := storage.OpenDatabase(databasePath())
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	switch command {
+	case "status":
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-24s %s\n", s.Version, s.Name, state)
+		}
+
+	case "up":
+		applied, err := db.MigrateUp(*dryRun)
+		printMigrations(applied, "Applied", "apply", *dryRun)
+		return err
+
+	case "down":
+		if *steps < 1 {
+			return errors.New("-steps must be at least 1")
+		}
+		reverted, err := db.MigrateDown(*steps, *dryRun)
+		printMigrations(reverted, "Reverted", "revert", *dryRun)
+		return err
+	}
+	return nil
+}
+
+// printMigrations reports the migrations an up or down run changed, or would
+// change on a dry run
+func printMigrations(migrations []storage.Migration, done, verb string, dryRun bool) {
+	if len(migrations) == 0 {
+		fmt.Printf("Nothing to %s\n", verb)
+		return
+	}
+	prefix := done
+	if dryRun {
+		prefix = "Would " + verb
+	}
+	for _, m := range migrations {
+		fmt.Printf("%s %04d_%s\n", prefix, m.Version, m.Name)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+const scanUsage = `Usage: webby scan [-user NAME] [-dry-run] <dir>
+
+Imports every EPUB, PDF, CBZ, and CBR file under dir. Files already in the
+library (same content) are skipped. Without -user, books are imported
+without an owner, as if uploaded while signed out.
+`
+
+// runScan handles "webby scan", which imports a directory of book files
+func runScan(args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, scanUsage) }
+	username := flags.String("user", "", "Username that will own the imported books")
+	dryRun := flags.Bool("dry-run", false, "List the files that would be imported")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one directory")
+	}
+	dir := flags.Arg(0)
+	if info, err := os.Stat(dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	db, err := openCurrentDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	files, err := storage.NewFileStorage(getEnv("WEBBY_DATA_DIR", "./data"))
+	if err != nil {
+		return err
+	}
+	files.SetFileReferences(db)
+
+	var userID string
+	if *username != "" {
+		user, err := db.GetUserByUsername(*username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no user named %q", *username)
+		}
+		if err != nil {
+			return err
+		}
+		userID = user.ID
+	}
+
+	importer := books.NewImporter(db, files)
+	duplicates := storage.NewDuplicateService(db, files)
+
+	var imported, skipped, failed int
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, _, ok := books.FileFormat(path); !ok {
+			return nil
+		}
+
+		check, err := duplicates.CheckForDuplicate(path, userID)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed++
+			return nil
+		}
+		if check.IsDuplicate {
+			fmt.Printf("skip %s: already in library\n", path)
+			skipped++
+			return nil
+		}
+		if *dryRun {
+			fmt.Printf("would import %s\n", path)
+			imported++
+			return nil
+		}
+
+		book, err := importFile(importer, path, userID)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed++
+			return nil
+		}
+		fmt.Printf("import %s: %q by %s\n", path, book.Title, book.Author)
+		imported++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d, skipped %d, failed %d\n", verb, imported, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed to import", failed)
+	}
+	return nil
+}
+
+// importFile imports the book file at path for userID
+func importFile(importer *books.Importer, path, userID string) (*models.Book, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return importer.Import(context.Background(), f, filepath.Base(path), info.Size(), userID)
+}
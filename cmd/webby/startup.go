@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/justyntemme/webby/internal/auth"
+)
+
+// webAssets is a file of the web app, looked for relative to the working
+// directory the server is started in
+const webAssets = "web/static/index.html"
+
+// checkEnvironment finds what would stop the server once it starts, beyond
+// settings that don't parse: an unusable data directory, bind address or
+// certificate
+func checkEnvironment(dataDir, bindAddr string, settings tlsSettings) []string {
+	var problems []string
+	if err := checkWritable(dataDir); err != nil {
+		problems = append(problems, fmt.Sprintf("WEBBY_DATA_DIR %s isn't usable: %v", dataDir, err))
+	}
+	if _, port, err := net.SplitHostPort(bindAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("Invalid bind address %q (want host:port or :port): %v", bindAddr, err))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		problems = append(problems, fmt.Sprintf("Invalid port %q in bind address %q", port, bindAddr))
+	}
+	if settings.mode == tlsManual && settings.certFile != "" && settings.keyFile != "" {
+		if _, err := tls.LoadX509KeyPair(settings.certFile, settings.keyFile); err != nil {
+			problems = append(problems, fmt.Sprintf("WEBBY_TLS_CERT and WEBBY_TLS_KEY can't be loaded: %v", err))
+		}
+	}
+	return problems
+}
+
+// configWarnings lists settings the server runs with but probably shouldn't
+func configWarnings() []string {
+	var warnings []string
+	if os.Getenv("WEBBY_JWT_SECRET") == "" {
+		warnings = append(warnings, "WEBBY_JWT_SECRET isn't set, so login tokens are signed with a publicly known key")
+	} else if len(auth.GetJWTSecret()) < 32 {
+		warnings = append(warnings, "WEBBY_JWT_SECRET is shorter than 32 characters")
+	}
+	if _, err := os.Stat(webAssets); err != nil {
+		warnings = append(warnings, fmt.Sprintf("%s wasn't found, so the web app won't load; start webby from the directory holding web/", webAssets))
+	}
+	return warnings
+}
+
+// checkWritable makes dir if it's missing and checks files can be created
+// in it
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// writePIDFile records the server's process ID for init scripts, returning
+// the function that removes it on shutdown. A file left by a server that's
+// still running is an error.
+func writePIDFile(path string) (func(), error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && processRunning(pid) {
+			return nil, fmt.Errorf("%s names process %d, which is still running", path, pid)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// processRunning reports whether a process with the ID exists
+func processRunning(pid int) bool {
+	if pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Signal 0 checks the process exists without disturbing it
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// sdNotify sends a state such as "READY=1" to systemd when it started the
+// server as a Type=notify service, and does nothing otherwise
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
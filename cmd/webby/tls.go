@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS modes, set with WEBBY_TLS_MODE
+const (
+	tlsOff    = "off"    // Plain HTTP, as behind a reverse proxy
+	tlsManual = "manual" // HTTPS with a certificate and key from files
+	tlsACME   = "acme"   // HTTPS with certificates from Let's Encrypt
+)
+
+// tlsSettings is how the server terminates TLS
+type tlsSettings struct {
+	mode     string
+	domains  []string // Hosts ACME certificates are issued for
+	email    string   // Contact for the ACME account, told about expiring certificates
+	certFile string
+	keyFile  string
+	cacheDir string // Where ACME keeps accounts and certificates
+	httpAddr string // Plain HTTP listener that answers ACME challenges and redirects to HTTPS
+}
+
+// loadTLSSettings reads the TLS settings from the environment, checking
+// each mode has what it needs
+func loadTLSSettings(dataDir string) (tlsSettings, error) {
+	settings := tlsSettings{
+		mode:     strings.ToLower(getEnv("WEBBY_TLS_MODE", tlsOff)),
+		email:    getEnv("WEBBY_ACME_EMAIL", ""),
+		certFile: getEnv("WEBBY_TLS_CERT", ""),
+		keyFile:  getEnv("WEBBY_TLS_KEY", ""),
+		cacheDir: getEnv("WEBBY_ACME_CACHE_DIR", filepath.Join(dataDir, "acme")),
+	}
+	for _, domain := range strings.Split(getEnv("WEBBY_DOMAIN", ""), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			settings.domains = append(settings.domains, strings.ToLower(domain))
+		}
+	}
+
+	switch settings.mode {
+	case tlsOff:
+	case tlsManual:
+		if settings.certFile == "" || settings.keyFile == "" {
+			return settings, errors.New("manual TLS needs WEBBY_TLS_CERT and WEBBY_TLS_KEY")
+		}
+		settings.httpAddr = getEnv("WEBBY_HTTP_ADDR", "")
+	case tlsACME:
+		if len(settings.domains) == 0 {
+			return settings, errors.New("ACME needs WEBBY_DOMAIN")
+		}
+		// Let's Encrypt checks ownership of the domain over port 80
+		settings.httpAddr = getEnv("WEBBY_HTTP_ADDR", ":80")
+	default:
+		return settings, fmt.Errorf("WEBBY_TLS_MODE is %q, want off, manual, or acme", settings.mode)
+	}
+	if settings.httpAddr == "off" {
+		settings.httpAddr = ""
+	}
+	return settings, nil
+}
+
+// enabled reports whether the server terminates TLS itself
+func (s tlsSettings) enabled() bool {
+	return s.mode != tlsOff
+}
+
+// shutdownTimeout is how long requests in flight get to finish once the
+// server is asked to stop
+const shutdownTimeout = 30 * time.Second
+
+// serve runs the server on addr, over HTTPS unless TLS is off, until ctx is
+// done, then lets requests in flight finish. ready is called once it's
+// listening. HTTPS connections negotiate HTTP/2.
+func serve(ctx context.Context, handler http.Handler, addr string, settings tlsSettings, ready func()) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	var certFile, keyFile string
+	switch settings.mode {
+	case tlsManual:
+		server.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+		certFile, keyFile = settings.certFile, settings.keyFile
+		if settings.httpAddr != "" {
+			go serveRedirects(settings.httpAddr, redirectToHTTPS(addr))
+		}
+
+	case tlsACME:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(settings.domains...),
+			Cache:      autocert.DirCache(settings.cacheDir),
+			Email:      settings.email,
+		}
+		// Includes h2, and answers TLS-ALPN challenges on the HTTPS port
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		if settings.httpAddr != "" {
+			go serveRedirects(settings.httpAddr, manager.HTTPHandler(redirectToHTTPS(addr)))
+		}
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	served := make(chan error, 1)
+	go func() {
+		if settings.enabled() {
+			served <- server.ServeTLS(listener, certFile, keyFile)
+		} else {
+			served <- server.Serve(listener)
+		}
+	}()
+	ready()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// serveRedirects runs the plain HTTP listener alongside the HTTPS one
+func serveRedirects(addr string, handler http.Handler) {
+	log.Printf("Redirecting HTTP on %s to HTTPS", addr)
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 30 * time.Second}
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("Warning: HTTP listener on %s stopped: %v", addr, err)
+	}
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS on
+// the port of httpsAddr
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
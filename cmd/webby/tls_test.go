@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadTLSSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    tlsSettings
+		wantErr string
+	}{
+		{
+			name: "off by default",
+			want: tlsSettings{mode: tlsOff, cacheDir: filepath.Join("data", "acme")},
+		},
+		{
+			name: "manual with cert and key",
+			env:  map[string]string{"WEBBY_TLS_MODE": "Manual", "WEBBY_TLS_CERT": "/etc/webby/cert.pem", "WEBBY_TLS_KEY": "/etc/webby/key.pem"},
+			want: tlsSettings{mode: tlsManual, certFile: "/etc/webby/cert.pem", keyFile: "/etc/webby/key.pem", cacheDir: filepath.Join("data", "acme")},
+		},
+		{
+			name: "manual redirects only when asked",
+			env:  map[string]string{"WEBBY_TLS_MODE": "manual", "WEBBY_TLS_CERT": "c.pem", "WEBBY_TLS_KEY": "k.pem", "WEBBY_HTTP_ADDR": ":8080"},
+			want: tlsSettings{mode: tlsManual, certFile: "c.pem", keyFile: "k.pem", cacheDir: filepath.Join("data", "acme"), httpAddr: ":8080"},
+		},
+		{
+			name:    "manual missing key",
+			env:     map[string]string{"WEBBY_TLS_MODE": "manual", "WEBBY_TLS_CERT": "c.pem"},
+			wantErr: "manual TLS needs WEBBY_TLS_CERT and WEBBY_TLS_KEY",
+		},
+		{
+			name: "acme domain list",
+			env:  map[string]string{"WEBBY_TLS_MODE": "acme", "WEBBY_DOMAIN": " Books.example.com, ,www.example.com ", "WEBBY_ACME_EMAIL": "admin@example.com"},
+			want: tlsSettings{mode: tlsACME, domains: []string{"books.example.com", "www.example.com"}, email: "admin@example.com",
+				cacheDir: filepath.Join("data", "acme"), httpAddr: ":80"},
+		},
+		{
+			name: "acme cache dir and no redirect listener",
+			env:  map[string]string{"WEBBY_TLS_MODE": "acme", "WEBBY_DOMAIN": "books.example.com", "WEBBY_ACME_CACHE_DIR": "/var/lib/webby/certs", "WEBBY_HTTP_ADDR": "off"},
+			want: tlsSettings{mode: tlsACME, domains: []string{"books.example.com"}, cacheDir: "/var/lib/webby/certs"},
+		},
+		{
+			name:    "acme missing domain",
+			env:     map[string]string{"WEBBY_TLS_MODE": "acme"},
+			wantErr: "ACME needs WEBBY_DOMAIN",
+		},
+		{
+			name:    "unknown mode",
+			env:     map[string]string{"WEBBY_TLS_MODE": "auto"},
+			wantErr: `WEBBY_TLS_MODE is "auto", want off, manual, or acme`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"WEBBY_TLS_MODE", "WEBBY_TLS_CERT", "WEBBY_TLS_KEY", "WEBBY_DOMAIN",
+				"WEBBY_ACME_EMAIL", "WEBBY_ACME_CACHE_DIR", "WEBBY_HTTP_ADDR"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			got, err := loadTLSSettings("data")
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		target    string
+		host      string
+		want      string
+	}{
+		{"default port", ":443", "/", "books.example.com", "https://books.example.com/"},
+		{"drops the HTTP port", ":443", "/api/books?page=2", "books.example.com:80", "https://books.example.com/api/books?page=2"},
+		{"keeps the base path", ":443", "/webby/opds/v1.2/catalog.xml", "books.example.com", "https://books.example.com/webby/opds/v1.2/catalog.xml"},
+		{"HTTPS on another port", ":8443", "/webby/", "books.example.com:8080", "https://books.example.com:8443/webby/"},
+		{"IPv6 host", "[::]:8443", "/", "[::1]:8080", "https://[::1]:8443/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			redirectToHTTPS(tt.httpsAddr).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/justyntemme/webby/internal/api"
+)
+
+// Set when building a release, with
+//
+//	go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo describes this binary. Without linker flags the commit is taken
+// from the version control details Go stamps into builds.
+func buildInfo() api.BuildInfo {
+	info := api.BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuiltAt:   buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if stamped, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, setting := range stamped.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// versionString is the one-line summary -version prints
+func versionString(info api.BuildInfo) string {
+	s := "webby " + info.Version
+	if info.Commit != "" {
+		s += fmt.Sprintf(" (%.12s)", info.Commit)
+	}
+	if info.BuiltAt != "" {
+		s += " built " + info.BuiltAt
+	}
+	return s + fmt.Sprintf(" with %s for %s", info.GoVersion, info.Platform)
+}
@@ -0,0 +1,154 @@
+package achievements
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/notify"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// stats holds the figures achievements are measured by
+type stats struct {
+	booksCompleted int
+	longestStreak  int
+	highlights     int
+	genres         int
+}
+
+// definition describes an achievement and how progress towards it is
+// measured
+type definition struct {
+	id          string
+	name        string
+	description string
+	target      int
+	progress    func(s stats) int
+}
+
+// definitions lists every achievement, in the order they're returned
+var definitions = []definition{
+	{models.AchievementFirstBook, "First Chapter", "Finish your first book", 1,
+		func(s stats) int { return s.booksCompleted }},
+	{models.AchievementWeekStreak, "Week Streak", "Read 7 days in a row", 7,
+		func(s stats) int { return s.longestStreak }},
+	{models.AchievementHighlights100, "Highlighter", "Make 100 highlights", 100,
+		func(s stats) int { return s.highlights }},
+	{models.AchievementGenres10, "Well Read", "Finish books from 10 different genres", 10,
+		func(s stats) int { return s.genres }},
+}
+
+// Engine awards achievements from a user's reading stats and notifies them
+// of new ones
+type Engine struct {
+	db       *storage.Database
+	notifier *notify.Service
+}
+
+// NewEngine creates an achievements engine. notifier may be nil.
+func NewEngine(db *storage.Database, notifier *notify.Service) *Engine {
+	return &Engine{db: db, notifier: notifier}
+}
+
+// Evaluate awards the user any achievements they have newly earned and
+// returns all achievements with their progress. Achievements once earned are
+// kept, even if the stats behind them later drop.
+func (e *Engine) Evaluate(userID string) ([]models.Achievement, error) {
+	s, err := e.stats(userID)
+	if err != nil {
+		return nil, err
+	}
+	earned, err := e.db.GetUserAchievements(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	achievements := make([]models.Achievement, 0, len(definitions))
+	for _, def := range definitions {
+		a := models.Achievement{
+			ID:          def.id,
+			Name:        def.name,
+			Description: def.description,
+			Target:      def.target,
+			Progress:    min(def.progress(s), def.target),
+		}
+
+		if at, ok := earned[def.id]; ok {
+			a.Earned, a.EarnedAt = true, &at
+		} else if a.Progress >= a.Target {
+			awarded, err := e.db.AwardAchievement(userID, def.id, now)
+			if err != nil {
+				return nil, err
+			}
+			a.Earned, a.EarnedAt = true, &now
+			if awarded {
+				e.notify(userID, a)
+			}
+		}
+		achievements = append(achievements, a)
+	}
+	return achievements, nil
+}
+
+// Check evaluates the user's achievements, logging rather than returning a
+// failure, for use after something that may have earned one
+func (e *Engine) Check(userID string) {
+	if userID == "" {
+		return
+	}
+	if _, err := e.Evaluate(userID); err != nil {
+		log.Printf("Warning: failed to check achievements for user %s: %v", userID, err)
+	}
+}
+
+// stats gathers the figures achievements are measured by
+func (e *Engine) stats(userID string) (stats, error) {
+	var s stats
+	var err error
+	if s.booksCompleted, err = e.db.GetCompletedBooksCount(userID); err != nil {
+		return s, err
+	}
+	if _, s.longestStreak, err = e.db.CalculateStreak(userID); err != nil {
+		return s, err
+	}
+	if s.highlights, _, err = e.db.GetAnnotationStats(userID); err != nil {
+		return s, err
+	}
+
+	subjects, err := e.db.ListCompletedBookSubjects(userID)
+	if err != nil {
+		return s, err
+	}
+	s.genres = countGenres(subjects)
+	return s, nil
+}
+
+// countGenres returns how many different subjects, ignoring case, the
+// comma-separated subject lists hold between them
+func countGenres(subjectLists []string) int {
+	genres := map[string]bool{}
+	for _, subjects := range subjectLists {
+		for _, name := range books.SubjectTagNames(subjects, nil) {
+			genres[strings.ToLower(name)] = true
+		}
+	}
+	return len(genres)
+}
+
+// notify tells the user they earned an achievement
+func (e *Engine) notify(userID string, a models.Achievement) {
+	if e.notifier == nil {
+		return
+	}
+	e.notifier.Publish(notify.Event{
+		Type:    models.NotificationEventAchievement,
+		UserID:  userID,
+		Title:   "Achievement earned: " + a.Name,
+		Message: fmt.Sprintf("You earned %q: %s.", a.Name, a.Description),
+	})
+}
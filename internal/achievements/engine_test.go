@@ -0,0 +1,111 @@
+package achievements
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+func setupTestEngine(t *testing.T) (*Engine, *storage.Database, func()) {
+	tmpFile, err := os.CreateTemp("", "webby-test-*.db")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	db, err := storage.NewDatabase(tmpFile.Name())
+	require.NoError(t, err)
+
+	cleanup := func() {
+		db.Close()
+		os.Remove(tmpFile.Name())
+		os.Remove(tmpFile.Name() + "-wal")
+		os.Remove(tmpFile.Name() + "-shm")
+	}
+	return NewEngine(db, nil), db, cleanup
+}
+
+// progress returns each achievement's progress and whether it's earned,
+// keyed by ID
+func progress(t *testing.T, e *Engine, userID string) map[string]models.Achievement {
+	achievements, err := e.Evaluate(userID)
+	require.NoError(t, err)
+	byID := map[string]models.Achievement{}
+	for _, a := range achievements {
+		byID[a.ID] = a
+	}
+	return byID
+}
+
+func TestEvaluate(t *testing.T) {
+	engine, db, cleanup := setupTestEngine(t)
+	defer cleanup()
+
+	now := time.Now()
+	userID := "user-id"
+	require.NoError(t, db.CreateUser(&models.User{ID: userID, Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: now}))
+
+	got := progress(t, engine, userID)
+	require.Len(t, got, len(definitions))
+	for _, a := range got {
+		assert.False(t, a.Earned, a.ID)
+		assert.Zero(t, a.Progress, a.ID)
+	}
+
+	// Finish 11 books between them covering 10 genres
+	for i := 0; i < 11; i++ {
+		bookID := fmt.Sprintf("book-%d", i)
+		subjects := fmt.Sprintf("Genre %d, Fiction", i%9)
+		require.NoError(t, db.CreateBook(&models.Book{ID: bookID, UserID: userID, Title: bookID, FilePath: "/" + bookID, Subjects: subjects, UploadedAt: now}))
+		require.NoError(t, db.UpdateBookReadStatus(userID, bookID, models.ReadStatusCompleted, &now))
+	}
+
+	// Read 6 days in a row, then skip a day
+	start := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, time.UTC).AddDate(0, 0, -20)
+	for day := 0; day < 8; day++ {
+		if day == 6 {
+			continue
+		}
+		at := start.AddDate(0, 0, day)
+		end := at.Add(time.Hour)
+		require.NoError(t, db.CreateReadingSession(&models.ReadingSession{
+			ID: fmt.Sprintf("session-%d", day), UserID: userID, BookID: "book-0", StartTime: at, EndTime: &end, CreatedAt: at,
+		}))
+	}
+
+	for i := 0; i < 99; i++ {
+		require.NoError(t, db.CreateAnnotation(&models.Annotation{
+			ID: fmt.Sprintf("ann-%d", i), BookID: "book-0", UserID: userID, Chapter: "1", SelectedText: "text",
+			Color: "yellow", Visibility: "private", CreatedAt: now, UpdatedAt: now,
+		}))
+	}
+
+	got = progress(t, engine, userID)
+	assert.True(t, got[models.AchievementFirstBook].Earned)
+	assert.Equal(t, 1, got[models.AchievementFirstBook].Progress, "capped at the target")
+	assert.Equal(t, models.Achievement{ID: models.AchievementWeekStreak, Name: "Week Streak", Description: "Read 7 days in a row",
+		Target: 7, Progress: 6}, got[models.AchievementWeekStreak])
+	assert.Equal(t, 99, got[models.AchievementHighlights100].Progress)
+	assert.True(t, got[models.AchievementGenres10].Earned, "9 numbered genres and fiction")
+
+	// Earned achievements are kept when the stats behind them drop
+	firstEarned := *got[models.AchievementFirstBook].EarnedAt
+	for i := 0; i < 11; i++ {
+		require.NoError(t, db.UpdateBookReadStatus(userID, fmt.Sprintf("book-%d", i), models.ReadStatusUnread, nil))
+	}
+	got = progress(t, engine, userID)
+	assert.True(t, got[models.AchievementFirstBook].Earned)
+	assert.True(t, firstEarned.Equal(*got[models.AchievementFirstBook].EarnedAt))
+	assert.True(t, got[models.AchievementGenres10].Earned)
+	assert.Zero(t, got[models.AchievementGenres10].Progress)
+}
+
+func TestCountGenres(t *testing.T) {
+	assert.Equal(t, 0, countGenres(nil))
+	assert.Equal(t, 3, countGenres([]string{"Fantasy, Adventure", "fantasy,  Horror ,", ""}))
+}
@@ -0,0 +1,300 @@
+package annotations
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/justyntemme/webby/internal/locale"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ErrInvalidCitationStyle is returned for a citation style other than APA,
+// MLA, or Chicago
+var ErrInvalidCitationStyle = errors.New("invalid citation style")
+
+// Citation styles
+const (
+	CitationAPA     = "apa"     // APA, 7th edition
+	CitationMLA     = "mla"     // MLA, 9th edition
+	CitationChicago = "chicago" // Chicago notes and bibliography, 17th edition
+)
+
+// Citation is a highlight quoted for a paper, with the book credited in a
+// citation style. The HTML forms italicize the title as the styles do.
+type Citation struct {
+	Style string `json:"style"`
+	// Quote is the highlighted text in quotation marks, followed for APA and
+	// MLA by its in-text citation
+	Quote string `json:"quote"`
+	// InText is the parenthetical citation, or for Chicago the footnote
+	InText        string `json:"in_text"`
+	InTextHTML    string `json:"in_text_html"`
+	Reference     string `json:"reference"` // The bibliography or works cited entry
+	ReferenceHTML string `json:"reference_html"`
+	Page          int    `json:"page,omitempty"` // Cited page, 0 when unknown
+}
+
+// yearPattern finds the year in a publish date of any format
+var yearPattern = regexp.MustCompile(`\b\d{4}\b`)
+
+// Cite formats a citation of an annotation's text in book. page is the page
+// it's on, or 0 to leave the page out.
+func Cite(style string, book *models.Book, ann *models.Annotation, page int) (*Citation, error) {
+	var quote, inText, reference func(c *citer) string
+	switch style {
+	case CitationAPA:
+		inText, reference = (*citer).apaInText, (*citer).apaReference
+		quote = func(c *citer) string { return quoted(ann.SelectedText, false) + " " + c.apaInText() + "." }
+	case CitationMLA:
+		inText, reference = (*citer).mlaInText, (*citer).mlaReference
+		quote = func(c *citer) string { return quoted(ann.SelectedText, false) + " " + c.mlaInText() + "." }
+	case CitationChicago:
+		inText, reference = (*citer).chicagoNote, (*citer).chicagoBibliography
+		quote = func(*citer) string { return quoted(ann.SelectedText, true) }
+	default:
+		return nil, ErrInvalidCitationStyle
+	}
+
+	plain := newCiter(book, page, func(s string) string { return s }, func(s string) string { return s })
+	rich := newCiter(book, page, html.EscapeString, func(s string) string { return "<i>" + html.EscapeString(s) + "</i>" })
+	return &Citation{
+		Style:         style,
+		Quote:         quote(plain),
+		InText:        inText(plain),
+		InTextHTML:    inText(rich),
+		Reference:     reference(plain),
+		ReferenceHTML: reference(rich),
+		Page:          page,
+	}, nil
+}
+
+// quoted puts text in quotation marks. Closing punctuation stays inside
+// them for Chicago; for the parenthetical styles it's dropped, as the
+// sentence ends after the citation.
+func quoted(text string, keepPunctuation bool) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if !keepPunctuation {
+		text = strings.TrimRight(text, ".,;:")
+	}
+	return "“" + text + "”"
+}
+
+// personName is an author's name split for citing
+type personName struct {
+	last, first string
+}
+
+// full returns the name in reading order
+func (n personName) full() string {
+	if n.first == "" {
+		return n.last
+	}
+	return n.first + " " + n.last
+}
+
+// inverted returns the name as "Last, First"
+func (n personName) inverted() string {
+	if n.first == "" {
+		return n.last
+	}
+	return n.last + ", " + n.first
+}
+
+// initials returns the name as "Last, F. M.", keeping hyphenated given
+// names hyphenated
+func (n personName) initials() string {
+	var initials []string
+	for _, given := range strings.Fields(n.first) {
+		var parts []string
+		for _, part := range strings.Split(given, "-") {
+			if r := []rune(part); len(r) > 0 {
+				parts = append(parts, string(r[0])+".")
+			}
+		}
+		initials = append(initials, strings.Join(parts, "-"))
+	}
+	if len(initials) == 0 {
+		return n.last
+	}
+	return n.last + ", " + strings.Join(initials, " ")
+}
+
+// citer renders the parts of a citation of one book, as plain text or
+// HTML depending on esc and italic
+type citer struct {
+	authors   []personName
+	title     string
+	publisher string
+	year      string
+	page      int
+	esc       func(string) string // Escapes text
+	italic    func(string) string // Escapes and italicizes a title
+}
+
+func newCiter(book *models.Book, page int, esc, italic func(string) string) *citer {
+	c := &citer{
+		title:     strings.TrimSpace(book.Title),
+		publisher: strings.TrimSpace(book.Publisher),
+		year:      yearPattern.FindString(book.PublishDate),
+		page:      page,
+		esc:       esc,
+		italic:    italic,
+	}
+	if sorted := locale.AuthorSort(book.Author); sorted != "" {
+		for _, name := range strings.Split(sorted, " & ") {
+			last, first, _ := strings.Cut(name, ", ")
+			c.authors = append(c.authors, personName{last: last, first: first})
+		}
+	}
+	return c
+}
+
+// sentence ends s with a period unless it already ends in punctuation
+func sentence(s string) string {
+	if s == "" || strings.HasSuffix(s, ".") || strings.HasSuffix(s, "?") || strings.HasSuffix(s, "!") {
+		return s
+	}
+	return s + "."
+}
+
+// list joins items with commas, and conj before the last; two items get a
+// comma before conj only if serial is set
+func list(items []string, conj string, serial bool) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		if serial {
+			return items[0] + ", " + conj + " " + items[1]
+		}
+		return items[0] + " " + conj + " " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", " + conj + " " + items[len(items)-1]
+}
+
+// joinNonEmpty joins the non-empty parts with sep
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+// surnames names the authors by surname for an in-text citation: one, two
+// joined by conj, or the first and "et al."
+func (c *citer) surnames(conj string) string {
+	switch len(c.authors) {
+	case 0:
+		return c.italic(c.title)
+	case 1:
+		return c.esc(c.authors[0].last)
+	case 2:
+		return c.esc(c.authors[0].last + " " + conj + " " + c.authors[1].last)
+	}
+	return c.esc(c.authors[0].last + " et al.")
+}
+
+// titleSentence returns the italicized title ending a sentence, with the
+// period outside the italics
+func (c *citer) titleSentence() string {
+	if c.title == "" {
+		return ""
+	}
+	return c.italic(c.title) + strings.TrimPrefix(sentence(c.title), c.title)
+}
+
+func (c *citer) apaInText() string {
+	year := c.year
+	if year == "" {
+		year = "n.d."
+	}
+	parts := []string{c.surnames("&"), c.esc(year)}
+	if c.page > 0 {
+		parts = append(parts, "p. "+strconv.Itoa(c.page))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (c *citer) apaReference() string {
+	year := c.year
+	if year == "" {
+		year = "n.d."
+	}
+	date := "(" + c.esc(year) + ")."
+	title := c.titleSentence()
+	if len(c.authors) == 0 {
+		return joinNonEmpty(" ", title, date, c.esc(sentence(c.publisher)))
+	}
+
+	var names []string
+	for _, a := range c.authors {
+		names = append(names, a.initials())
+	}
+	return joinNonEmpty(" ", c.esc(sentence(list(names, "&", true))), date, title, c.esc(sentence(c.publisher)))
+}
+
+func (c *citer) mlaInText() string {
+	if c.page > 0 {
+		return "(" + c.surnames("and") + " " + strconv.Itoa(c.page) + ")"
+	}
+	return "(" + c.surnames("and") + ")"
+}
+
+func (c *citer) mlaReference() string {
+	var authors string
+	switch len(c.authors) {
+	case 0:
+	case 1:
+		authors = c.authors[0].inverted()
+	case 2:
+		authors = c.authors[0].inverted() + ", and " + c.authors[1].full()
+	default:
+		authors = c.authors[0].inverted() + ", et al."
+	}
+	return joinNonEmpty(" ", c.esc(sentence(authors)), c.titleSentence(),
+		c.esc(sentence(joinNonEmpty(", ", c.publisher, c.year))))
+}
+
+func (c *citer) chicagoNote() string {
+	var names []string
+	if len(c.authors) > 3 {
+		names = []string{c.authors[0].full() + " et al."}
+	} else {
+		for _, a := range c.authors {
+			names = append(names, a.full())
+		}
+	}
+
+	note := c.italic(c.title)
+	if pub := joinNonEmpty(", ", c.publisher, c.year); pub != "" {
+		note += " (" + c.esc(pub) + ")"
+	}
+	if c.page > 0 {
+		note += ", " + strconv.Itoa(c.page)
+	}
+	if len(names) > 0 {
+		note = c.esc(list(names, "and", false)) + ", " + note
+	}
+	return sentence(note)
+}
+
+func (c *citer) chicagoBibliography() string {
+	var names []string
+	for i, a := range c.authors {
+		if i == 0 {
+			names = append(names, a.inverted())
+		} else {
+			names = append(names, a.full())
+		}
+	}
+	return joinNonEmpty(" ", c.esc(sentence(list(names, "and", true))), c.titleSentence(),
+		c.esc(sentence(joinNonEmpty(", ", c.publisher, c.year))))
+}
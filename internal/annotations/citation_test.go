@@ -0,0 +1,67 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestCite(t *testing.T) {
+	book := &models.Book{Title: "Moby-Dick", Author: "Herman Melville", Publisher: "Harper & Brothers", PublishDate: "1851-10-18"}
+	ann := &models.Annotation{SelectedText: "Call me\nIshmael."}
+
+	c, err := Cite(CitationAPA, book, ann, 12)
+	require.NoError(t, err)
+	assert.Equal(t, "“Call me Ishmael” (Melville, 1851, p. 12).", c.Quote)
+	assert.Equal(t, "(Melville, 1851, p. 12)", c.InText)
+	assert.Equal(t, "Melville, H. (1851). Moby-Dick. Harper & Brothers.", c.Reference)
+	assert.Equal(t, "Melville, H. (1851). <i>Moby-Dick</i>. Harper &amp; Brothers.", c.ReferenceHTML)
+
+	c, err = Cite(CitationMLA, book, ann, 12)
+	require.NoError(t, err)
+	assert.Equal(t, "“Call me Ishmael” (Melville 12).", c.Quote)
+	assert.Equal(t, "Melville, Herman. Moby-Dick. Harper & Brothers, 1851.", c.Reference)
+
+	c, err = Cite(CitationChicago, book, ann, 12)
+	require.NoError(t, err)
+	assert.Equal(t, "“Call me Ishmael.”", c.Quote, "punctuation stays inside the quotation marks")
+	assert.Equal(t, "Herman Melville, Moby-Dick (Harper & Brothers, 1851), 12.", c.InText)
+	assert.Equal(t, "Herman Melville, <i>Moby-Dick</i> (Harper &amp; Brothers, 1851), 12.", c.InTextHTML)
+	assert.Equal(t, "Melville, Herman. Moby-Dick. Harper & Brothers, 1851.", c.Reference)
+
+	_, err = Cite("harvard", book, ann, 12)
+	assert.ErrorIs(t, err, ErrInvalidCitationStyle)
+}
+
+func TestCite_SparseMetadata(t *testing.T) {
+	ann := &models.Annotation{SelectedText: "War is hell."}
+
+	// Two authors, no publisher, date, or page
+	book := &models.Book{Title: "The War", Author: "Geoffrey C. Ward & Ken Burns"}
+	c, _ := Cite(CitationAPA, book, ann, 0)
+	assert.Equal(t, "(Ward & Burns, n.d.)", c.InText)
+	assert.Equal(t, "Ward, G. C., & Burns, K. (n.d.). The War.", c.Reference)
+	c, _ = Cite(CitationMLA, book, ann, 0)
+	assert.Equal(t, "(Ward and Burns)", c.InText)
+	assert.Equal(t, "Ward, Geoffrey C., and Ken Burns. The War.", c.Reference)
+	c, _ = Cite(CitationChicago, book, ann, 0)
+	assert.Equal(t, "Geoffrey C. Ward and Ken Burns, The War.", c.InText)
+	assert.Equal(t, "Ward, Geoffrey C., and Ken Burns. The War.", c.Reference)
+
+	// Three authors are "et al." in text
+	book = &models.Book{Title: "Physics", Author: "Ann Lee; Bo Kim; Cy Young", PublishDate: "2001"}
+	c, _ = Cite(CitationAPA, book, ann, 5)
+	assert.Equal(t, "(Lee et al., 2001, p. 5)", c.InText)
+	assert.Equal(t, "Lee, A., Kim, B., & Young, C. (2001). Physics.", c.Reference)
+
+	// Without an author the title leads
+	book = &models.Book{Title: "Beowulf"}
+	c, _ = Cite(CitationAPA, book, ann, 0)
+	assert.Equal(t, "(<i>Beowulf</i>, n.d.)", c.InTextHTML)
+	assert.Equal(t, "Beowulf. (n.d.).", c.Reference)
+	c, _ = Cite(CitationMLA, book, ann, 0)
+	assert.Equal(t, "Beowulf.", c.Reference)
+}
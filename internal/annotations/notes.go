@@ -0,0 +1,121 @@
+package annotations
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ListNotes returns the user's notes on a book they can access
+func (s *Service) ListNotes(bookID, userID string) ([]*models.BookNote, error) {
+	if _, err := s.books.Authorize(bookID, userID); err != nil {
+		return nil, err
+	}
+	return nonNilNotes(s.store.GetBookNotesForBook(bookID, userID))
+}
+
+// ListAllNotes returns all of the user's book notes
+func (s *Service) ListAllNotes(userID string) ([]*models.BookNote, error) {
+	return nonNilNotes(s.store.GetAllBookNotesForUser(userID))
+}
+
+// CreateNote adds a Markdown note to a book the user can access
+func (s *Service) CreateNote(bookID, userID, title, body string) (*models.BookNote, error) {
+	if _, err := s.books.Authorize(bookID, userID); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil, ErrEmptyNote
+	}
+
+	now := time.Now()
+	note := &models.BookNote{
+		ID:        uuid.New().String(),
+		BookID:    bookID,
+		UserID:    userID,
+		Title:     strings.TrimSpace(title),
+		Body:      body,
+		Revision:  1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.CreateBookNote(note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// GetNote returns one of the user's book notes
+func (s *Service) GetNote(noteID, userID string) (*models.BookNote, error) {
+	note, err := s.store.GetBookNote(noteID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if note.UserID != userID {
+		return nil, ErrForbidden
+	}
+	return note, nil
+}
+
+// UpdateNote replaces a note's title and body, keeping the previous
+// version in its history. Saving an unchanged note adds no revision.
+func (s *Service) UpdateNote(noteID, userID, title, body string) (*models.BookNote, error) {
+	note, err := s.GetNote(noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil, ErrEmptyNote
+	}
+
+	title = strings.TrimSpace(title)
+	if title == note.Title && body == note.Body {
+		return note, nil
+	}
+	if err := s.store.UpdateBookNote(note, title, body, time.Now()); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// NoteRevisions returns the earlier versions of one of the user's notes,
+// newest first
+func (s *Service) NoteRevisions(noteID, userID string) ([]*models.BookNoteRevision, error) {
+	if _, err := s.GetNote(noteID, userID); err != nil {
+		return nil, err
+	}
+	revisions, err := s.store.GetBookNoteRevisions(noteID)
+	if err != nil {
+		return nil, err
+	}
+	if revisions == nil {
+		revisions = []*models.BookNoteRevision{}
+	}
+	return revisions, nil
+}
+
+// DeleteNote removes one of the user's book notes and its history
+func (s *Service) DeleteNote(noteID, userID string) error {
+	if _, err := s.GetNote(noteID, userID); err != nil {
+		return err
+	}
+	return s.store.DeleteBookNote(noteID)
+}
+
+func nonNilNotes(notes []*models.BookNote, err error) ([]*models.BookNote, error) {
+	if err != nil {
+		return nil, err
+	}
+	if notes == nil {
+		notes = []*models.BookNote{}
+	}
+	return notes, nil
+}
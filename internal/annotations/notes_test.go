@@ -0,0 +1,66 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateNote(t *testing.T) {
+	store := newFakeStore()
+	svc := NewService(store, fakeBooks{})
+
+	note, err := svc.CreateNote("b1", "reader", "  Thoughts  ", "# Chapter one\n\nSlow start.")
+	require.NoError(t, err)
+	assert.Equal(t, "Thoughts", note.Title)
+	assert.Equal(t, 1, note.Revision)
+	assert.Contains(t, store.notes, note.ID)
+
+	_, err = svc.CreateNote("b1", "reader", "", "  \n")
+	assert.ErrorIs(t, err, ErrEmptyNote)
+
+	_, err = svc.CreateNote("b1", "stranger", "", "text")
+	assert.ErrorIs(t, err, errForbidden, "book access errors pass through")
+
+	notes, err := svc.ListNotes("b1", "reader")
+	require.NoError(t, err)
+	assert.Len(t, notes, 1)
+
+	notes, err = svc.ListAllNotes("nobody")
+	require.NoError(t, err)
+	assert.NotNil(t, notes, "empty lists are not nil")
+}
+
+func TestNoteRevisions(t *testing.T) {
+	store := newFakeStore()
+	svc := NewService(store, fakeBooks{})
+	note, err := svc.CreateNote("b1", "reader", "Draft", "first")
+	require.NoError(t, err)
+
+	updated, err := svc.UpdateNote(note.ID, "reader", "Draft", "second")
+	require.NoError(t, err)
+	assert.Equal(t, "second", updated.Body)
+	assert.Equal(t, 2, updated.Revision)
+
+	unchanged, err := svc.UpdateNote(note.ID, "reader", "Draft", "second")
+	require.NoError(t, err)
+	assert.Equal(t, 2, unchanged.Revision, "saving the same text adds no revision")
+
+	revisions, err := svc.NoteRevisions(note.ID, "reader")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "first", revisions[0].Body)
+	assert.Equal(t, 1, revisions[0].Revision)
+
+	_, err = svc.UpdateNote(note.ID, "reader", "", "")
+	assert.ErrorIs(t, err, ErrEmptyNote)
+	_, err = svc.UpdateNote(note.ID, "someone-else", "", "hijack")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.NoteRevisions("missing", "reader")
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+
+	assert.ErrorIs(t, svc.DeleteNote(note.ID, "someone-else"), ErrForbidden)
+	require.NoError(t, svc.DeleteNote(note.ID, "reader"))
+	assert.Empty(t, store.notes)
+}
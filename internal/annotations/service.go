@@ -0,0 +1,320 @@
+// Package annotations holds the business logic for highlights and notes:
+// book access checks, color validation, ownership rules, and the revision
+// history of long-form book notes. Storage is
+// behind the Store interface so the rules can be tested without a database.
+package annotations
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when an annotation does not exist
+	ErrNotFound = errors.New("annotation not found")
+	// ErrForbidden is returned when the annotation belongs to another user
+	ErrForbidden = errors.New("access denied")
+	// ErrInvalidColor is returned for a highlight color outside the palette
+	ErrInvalidColor = errors.New("invalid highlight color")
+	// ErrInvalidVisibility is returned for a visibility other than private
+	// or shared
+	ErrInvalidVisibility = errors.New("invalid annotation visibility")
+	// ErrNoteNotFound is returned when a book note does not exist
+	ErrNoteNotFound = errors.New("note not found")
+	// ErrEmptyNote is returned for a book note with no body
+	ErrEmptyNote = errors.New("note body is empty")
+)
+
+// Colors is the highlight palette, in display order
+var Colors = []string{
+	models.HighlightColorYellow,
+	models.HighlightColorGreen,
+	models.HighlightColorBlue,
+	models.HighlightColorPink,
+	models.HighlightColorOrange,
+}
+
+// reviewIntervals are the gaps between reviews of a highlight: after its
+// nth review it's due again reviewIntervals[n-1] later, and the last
+// interval repeats
+var reviewIntervals = []time.Duration{
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	14 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+	180 * 24 * time.Hour,
+	365 * 24 * time.Hour,
+}
+
+// Store is the subset of storage.Database the annotation service uses
+type Store interface {
+	CreateAnnotation(ann *models.Annotation) error
+	GetAnnotation(annotationID string) (*models.Annotation, error)
+	GetAnnotationsForBook(bookID, userID string) ([]*models.Annotation, error)
+	GetAnnotationsForChapter(bookID, userID, chapter string) ([]*models.Annotation, error)
+	GetVisibleAnnotationsForChapter(bookID, userID, chapter string) ([]*models.Annotation, error)
+	GetAllAnnotationsForUser(userID string) ([]*models.Annotation, error)
+	UpdateAnnotation(annotationID, note, color, visibility string) error
+	UpdateAnnotationChapter(annotationID, chapter string) error
+	DeleteAnnotation(annotationID string) error
+	GetAnnotationStats(userID string) (totalAnnotations int, booksWithAnnotations int, err error)
+	GetAnnotationsForReview(userID string, now time.Time, limit int) ([]*models.ReviewHighlight, error)
+	GetAnnotationReview(annotationID string) (*models.AnnotationReview, error)
+	SaveAnnotationReview(review *models.AnnotationReview) error
+
+	CreateBookNote(note *models.BookNote) error
+	GetBookNote(noteID string) (*models.BookNote, error)
+	GetBookNotesForBook(bookID, userID string) ([]*models.BookNote, error)
+	GetAllBookNotesForUser(userID string) ([]*models.BookNote, error)
+	UpdateBookNote(note *models.BookNote, title, body string, updatedAt time.Time) error
+	GetBookNoteRevisions(noteID string) ([]*models.BookNoteRevision, error)
+	DeleteBookNote(noteID string) error
+}
+
+// BookAuthorizer checks that a user may read a book. books.Service
+// implements it.
+type BookAuthorizer interface {
+	Authorize(bookID, userID string) (*models.Book, error)
+}
+
+// Service implements annotation operations on top of a Store
+type Service struct {
+	store Store
+	books BookAuthorizer
+}
+
+// NewService creates an annotation service
+func NewService(store Store, books BookAuthorizer) *Service {
+	return &Service{store: store, books: books}
+}
+
+// Input is a new highlight or note
+type Input struct {
+	Chapter      string
+	CFI          string
+	StartOffset  int
+	EndOffset    int
+	SelectedText string
+	Note         string
+	Color        string // Defaults to yellow
+	Visibility   string // Defaults to private
+}
+
+// ValidColor reports whether color is in the highlight palette
+func ValidColor(color string) bool {
+	for _, c := range Colors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
+
+// validVisibility reports whether visibility is private or shared
+func validVisibility(visibility string) bool {
+	return visibility == models.AnnotationVisibilityPrivate || visibility == models.AnnotationVisibilityShared
+}
+
+// ListForBook returns the user's annotations in a book they can access
+func (s *Service) ListForBook(bookID, userID string) ([]*models.Annotation, error) {
+	if _, err := s.books.Authorize(bookID, userID); err != nil {
+		return nil, err
+	}
+	return nonNil(s.store.GetAnnotationsForBook(bookID, userID))
+}
+
+// ListForChapter returns the user's annotations in one chapter of a book
+func (s *Service) ListForChapter(bookID, userID, chapter string) ([]*models.Annotation, error) {
+	if _, err := s.books.Authorize(bookID, userID); err != nil {
+		return nil, err
+	}
+	return nonNil(s.store.GetAnnotationsForChapter(bookID, userID, chapter))
+}
+
+// ListVisibleForChapter returns the user's annotations in one chapter along
+// with the shared annotations of everyone else who can read the book
+func (s *Service) ListVisibleForChapter(bookID, userID, chapter string) ([]*models.Annotation, error) {
+	if _, err := s.books.Authorize(bookID, userID); err != nil {
+		return nil, err
+	}
+	return nonNil(s.store.GetVisibleAnnotationsForChapter(bookID, userID, chapter))
+}
+
+// ListAll returns all of the user's annotations
+func (s *Service) ListAll(userID string) ([]*models.Annotation, error) {
+	return nonNil(s.store.GetAllAnnotationsForUser(userID))
+}
+
+// Stats returns the user's annotation count and how many books they span
+func (s *Service) Stats(userID string) (total, books int, err error) {
+	return s.store.GetAnnotationStats(userID)
+}
+
+// Create adds an annotation to a book the user can access
+func (s *Service) Create(bookID, userID string, in Input) (*models.Annotation, error) {
+	if _, err := s.books.Authorize(bookID, userID); err != nil {
+		return nil, err
+	}
+
+	if in.Color == "" {
+		in.Color = models.HighlightColorYellow
+	} else if !ValidColor(in.Color) {
+		return nil, ErrInvalidColor
+	}
+	if in.Visibility == "" {
+		in.Visibility = models.AnnotationVisibilityPrivate
+	} else if !validVisibility(in.Visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	now := time.Now()
+	annotation := &models.Annotation{
+		ID:           uuid.New().String(),
+		BookID:       bookID,
+		UserID:       userID,
+		Chapter:      in.Chapter,
+		CFI:          in.CFI,
+		StartOffset:  in.StartOffset,
+		EndOffset:    in.EndOffset,
+		SelectedText: in.SelectedText,
+		Note:         in.Note,
+		Color:        in.Color,
+		Visibility:   in.Visibility,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.store.CreateAnnotation(annotation); err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// Get returns one of the user's annotations
+func (s *Service) Get(annotationID, userID string) (*models.Annotation, error) {
+	annotation, err := s.store.GetAnnotation(annotationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if annotation.UserID != userID {
+		return nil, ErrForbidden
+	}
+	return annotation, nil
+}
+
+// Update replaces an annotation's note and, if they are set, its color and
+// visibility
+func (s *Service) Update(annotationID, userID, note, color, visibility string) (*models.Annotation, error) {
+	annotation, err := s.Get(annotationID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if color == "" {
+		color = annotation.Color
+	} else if !ValidColor(color) {
+		return nil, ErrInvalidColor
+	}
+	if visibility == "" {
+		visibility = annotation.Visibility
+	} else if !validVisibility(visibility) {
+		return nil, ErrInvalidVisibility
+	}
+
+	if err := s.store.UpdateAnnotation(annotationID, note, color, visibility); err != nil {
+		return nil, err
+	}
+
+	annotation.Note = note
+	annotation.Color = color
+	annotation.Visibility = visibility
+	annotation.UpdatedAt = time.Now()
+	return annotation, nil
+}
+
+// MoveToChapter records that one of the user's annotations is in another
+// chapter, such as after a file replace renumbered the chapters
+func (s *Service) MoveToChapter(annotationID, userID, chapter string) (*models.Annotation, error) {
+	annotation, err := s.Get(annotationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.UpdateAnnotationChapter(annotationID, chapter); err != nil {
+		return nil, err
+	}
+	annotation.Chapter = chapter
+	return annotation, nil
+}
+
+// Delete removes one of the user's annotations
+func (s *Service) Delete(annotationID, userID string) error {
+	if _, err := s.Get(annotationID, userID); err != nil {
+		return err
+	}
+	return s.store.DeleteAnnotation(annotationID)
+}
+
+// ReviewFeed returns up to limit of the user's highlights due for review,
+// those never reviewed first
+func (s *Service) ReviewFeed(userID string, limit int) ([]*models.ReviewHighlight, error) {
+	highlights, err := s.store.GetAnnotationsForReview(userID, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	if highlights == nil {
+		highlights = []*models.ReviewHighlight{}
+	}
+	return highlights, nil
+}
+
+// MarkReviewed records that the user has seen their highlights in the
+// review, scheduling each one's next review further out than the last.
+// Nothing is recorded unless all of them belong to the user.
+func (s *Service) MarkReviewed(annotationIDs []string, userID string) ([]*models.AnnotationReview, error) {
+	for _, id := range annotationIDs {
+		if _, err := s.Get(id, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	reviews := make([]*models.AnnotationReview, 0, len(annotationIDs))
+	for _, id := range annotationIDs {
+		review, err := s.store.GetAnnotationReview(id)
+		if err == sql.ErrNoRows {
+			review = &models.AnnotationReview{AnnotationID: id}
+		} else if err != nil {
+			return nil, err
+		}
+
+		review.ReviewCount++
+		interval := reviewIntervals[min(review.ReviewCount, len(reviewIntervals))-1]
+		review.LastReviewedAt = now
+		review.NextReviewAt = now.Add(interval)
+		if err := s.store.SaveAnnotationReview(review); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+func nonNil(annotations []*models.Annotation, err error) ([]*models.Annotation, error) {
+	if err != nil {
+		return nil, err
+	}
+	if annotations == nil {
+		annotations = []*models.Annotation{}
+	}
+	return annotations, nil
+}
@@ -0,0 +1,325 @@
+package annotations
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+var errForbidden = errors.New("forbidden")
+
+// fakeStore is an in-memory Store
+type fakeStore struct {
+	annotations map[string]*models.Annotation
+	notes       map[string]*models.BookNote
+	revisions   map[string][]*models.BookNoteRevision
+	reviews     map[string]*models.AnnotationReview
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		annotations: map[string]*models.Annotation{},
+		notes:       map[string]*models.BookNote{},
+		revisions:   map[string][]*models.BookNoteRevision{},
+		reviews:     map[string]*models.AnnotationReview{},
+	}
+}
+
+func (s *fakeStore) CreateAnnotation(ann *models.Annotation) error {
+	s.annotations[ann.ID] = ann
+	return nil
+}
+
+func (s *fakeStore) GetAnnotation(annotationID string) (*models.Annotation, error) {
+	ann, ok := s.annotations[annotationID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *ann
+	return &copied, nil
+}
+
+func (s *fakeStore) filter(keep func(*models.Annotation) bool) []*models.Annotation {
+	var out []*models.Annotation
+	for _, ann := range s.annotations {
+		if keep(ann) {
+			out = append(out, ann)
+		}
+	}
+	return out
+}
+
+func (s *fakeStore) GetAnnotationsForBook(bookID, userID string) ([]*models.Annotation, error) {
+	return s.filter(func(a *models.Annotation) bool { return a.BookID == bookID && a.UserID == userID }), nil
+}
+
+func (s *fakeStore) GetAnnotationsForChapter(bookID, userID, chapter string) ([]*models.Annotation, error) {
+	return s.filter(func(a *models.Annotation) bool {
+		return a.BookID == bookID && a.UserID == userID && a.Chapter == chapter
+	}), nil
+}
+
+func (s *fakeStore) GetVisibleAnnotationsForChapter(bookID, userID, chapter string) ([]*models.Annotation, error) {
+	return s.filter(func(a *models.Annotation) bool {
+		return a.BookID == bookID && a.Chapter == chapter &&
+			(a.UserID == userID || a.Visibility == models.AnnotationVisibilityShared)
+	}), nil
+}
+
+func (s *fakeStore) GetAllAnnotationsForUser(userID string) ([]*models.Annotation, error) {
+	return s.filter(func(a *models.Annotation) bool { return a.UserID == userID }), nil
+}
+
+func (s *fakeStore) UpdateAnnotation(annotationID, note, color, visibility string) error {
+	s.annotations[annotationID].Note = note
+	s.annotations[annotationID].Color = color
+	s.annotations[annotationID].Visibility = visibility
+	return nil
+}
+
+func (s *fakeStore) UpdateAnnotationChapter(annotationID, chapter string) error {
+	s.annotations[annotationID].Chapter = chapter
+	return nil
+}
+
+func (s *fakeStore) DeleteAnnotation(annotationID string) error {
+	delete(s.annotations, annotationID)
+	return nil
+}
+
+func (s *fakeStore) GetAnnotationStats(userID string) (int, int, error) {
+	books := map[string]bool{}
+	anns, _ := s.GetAllAnnotationsForUser(userID)
+	for _, a := range anns {
+		books[a.BookID] = true
+	}
+	return len(anns), len(books), nil
+}
+
+func (s *fakeStore) GetAnnotationsForReview(userID string, now time.Time, limit int) ([]*models.ReviewHighlight, error) {
+	var out []*models.ReviewHighlight
+	for _, ann := range s.filter(func(a *models.Annotation) bool { return a.UserID == userID }) {
+		review, ok := s.reviews[ann.ID]
+		if ok && review.NextReviewAt.After(now) {
+			continue
+		}
+		h := &models.ReviewHighlight{Annotation: ann}
+		if ok {
+			h.ReviewCount = review.ReviewCount
+			h.LastReviewedAt = &review.LastReviewedAt
+		}
+		out = append(out, h)
+	}
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *fakeStore) GetAnnotationReview(annotationID string) (*models.AnnotationReview, error) {
+	review, ok := s.reviews[annotationID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *review
+	return &copied, nil
+}
+
+func (s *fakeStore) SaveAnnotationReview(review *models.AnnotationReview) error {
+	copied := *review
+	s.reviews[review.AnnotationID] = &copied
+	return nil
+}
+
+func (s *fakeStore) CreateBookNote(note *models.BookNote) error {
+	copied := *note
+	s.notes[note.ID] = &copied
+	return nil
+}
+
+func (s *fakeStore) GetBookNote(noteID string) (*models.BookNote, error) {
+	note, ok := s.notes[noteID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *note
+	return &copied, nil
+}
+
+func (s *fakeStore) filterNotes(keep func(*models.BookNote) bool) []*models.BookNote {
+	var out []*models.BookNote
+	for _, note := range s.notes {
+		if keep(note) {
+			out = append(out, note)
+		}
+	}
+	return out
+}
+
+func (s *fakeStore) GetBookNotesForBook(bookID, userID string) ([]*models.BookNote, error) {
+	return s.filterNotes(func(n *models.BookNote) bool { return n.BookID == bookID && n.UserID == userID }), nil
+}
+
+func (s *fakeStore) GetAllBookNotesForUser(userID string) ([]*models.BookNote, error) {
+	return s.filterNotes(func(n *models.BookNote) bool { return n.UserID == userID }), nil
+}
+
+func (s *fakeStore) UpdateBookNote(note *models.BookNote, title, body string, updatedAt time.Time) error {
+	stored := s.notes[note.ID]
+	s.revisions[note.ID] = append([]*models.BookNoteRevision{{
+		NoteID: stored.ID, Revision: stored.Revision, Title: stored.Title, Body: stored.Body, CreatedAt: stored.UpdatedAt,
+	}}, s.revisions[note.ID]...)
+	stored.Title, stored.Body, stored.UpdatedAt = title, body, updatedAt
+	stored.Revision++
+	*note = *stored
+	return nil
+}
+
+func (s *fakeStore) GetBookNoteRevisions(noteID string) ([]*models.BookNoteRevision, error) {
+	return s.revisions[noteID], nil
+}
+
+func (s *fakeStore) DeleteBookNote(noteID string) error {
+	delete(s.notes, noteID)
+	delete(s.revisions, noteID)
+	return nil
+}
+
+// fakeBooks lets one user read book b1
+type fakeBooks struct{}
+
+func (fakeBooks) Authorize(bookID, userID string) (*models.Book, error) {
+	if bookID != "b1" || userID != "reader" {
+		return nil, errForbidden
+	}
+	return &models.Book{ID: bookID, UserID: userID}, nil
+}
+
+func TestCreate(t *testing.T) {
+	store := newFakeStore()
+	svc := NewService(store, fakeBooks{})
+
+	ann, err := svc.Create("b1", "reader", Input{Chapter: "ch1", SelectedText: "text"})
+	require.NoError(t, err)
+	assert.Equal(t, models.HighlightColorYellow, ann.Color, "color defaults to yellow")
+	assert.Equal(t, models.AnnotationVisibilityPrivate, ann.Visibility, "annotations are private by default")
+	assert.Contains(t, store.annotations, ann.ID)
+
+	_, err = svc.Create("b1", "reader", Input{Chapter: "ch1", SelectedText: "text", Color: "purple"})
+	assert.ErrorIs(t, err, ErrInvalidColor)
+	_, err = svc.Create("b1", "reader", Input{Chapter: "ch1", SelectedText: "text", Visibility: "public"})
+	assert.ErrorIs(t, err, ErrInvalidVisibility)
+
+	_, err = svc.Create("b1", "stranger", Input{Chapter: "ch1", SelectedText: "text"})
+	assert.ErrorIs(t, err, errForbidden, "book access errors pass through")
+}
+
+func TestOwnership(t *testing.T) {
+	store := newFakeStore()
+	svc := NewService(store, fakeBooks{})
+	ann, err := svc.Create("b1", "reader", Input{Chapter: "ch1", SelectedText: "text", Color: models.HighlightColorBlue})
+	require.NoError(t, err)
+
+	_, err = svc.Get(ann.ID, "someone-else")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.Get("missing", "reader")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, svc.Delete(ann.ID, "someone-else"), ErrForbidden)
+
+	updated, err := svc.Update(ann.ID, "reader", "a note", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "a note", updated.Note)
+	assert.Equal(t, models.HighlightColorBlue, updated.Color, "empty color keeps the current one")
+	assert.Equal(t, models.AnnotationVisibilityPrivate, updated.Visibility, "empty visibility keeps the current one")
+
+	updated, err = svc.Update(ann.ID, "reader", "a note", "", models.AnnotationVisibilityShared)
+	require.NoError(t, err)
+	assert.Equal(t, models.AnnotationVisibilityShared, store.annotations[ann.ID].Visibility)
+
+	_, err = svc.Update(ann.ID, "reader", "", "purple", "")
+	assert.ErrorIs(t, err, ErrInvalidColor)
+	_, err = svc.Update(ann.ID, "reader", "", "", "public")
+	assert.ErrorIs(t, err, ErrInvalidVisibility)
+
+	require.NoError(t, svc.Delete(ann.ID, "reader"))
+	assert.Empty(t, store.annotations)
+}
+
+func TestList(t *testing.T) {
+	svc := NewService(newFakeStore(), fakeBooks{})
+
+	anns, err := svc.ListForBook("b1", "reader")
+	require.NoError(t, err)
+	assert.NotNil(t, anns, "empty lists are not nil")
+
+	_, err = svc.Create("b1", "reader", Input{Chapter: "ch1", SelectedText: "one"})
+	require.NoError(t, err)
+	_, err = svc.Create("b1", "reader", Input{Chapter: "ch2", SelectedText: "two"})
+	require.NoError(t, err)
+
+	anns, err = svc.ListForChapter("b1", "reader", "ch2")
+	require.NoError(t, err)
+	require.Len(t, anns, 1)
+	assert.Equal(t, "two", anns[0].SelectedText)
+
+	_, err = svc.ListForBook("b1", "stranger")
+	assert.ErrorIs(t, err, errForbidden)
+
+	total, books, err := svc.Stats("reader")
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 1, books)
+}
+
+func TestMarkReviewed(t *testing.T) {
+	store := newFakeStore()
+	svc := NewService(store, fakeBooks{})
+	ann, err := svc.Create("b1", "reader", Input{Chapter: "ch1", SelectedText: "text"})
+	require.NoError(t, err)
+
+	feed, err := svc.ReviewFeed("reader", 10)
+	require.NoError(t, err)
+	require.Len(t, feed, 1)
+
+	_, err = svc.MarkReviewed([]string{ann.ID}, "someone-else")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.MarkReviewed([]string{ann.ID, "missing"}, "reader")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, store.reviews, "nothing is recorded unless every highlight is the user's")
+
+	reviews, err := svc.MarkReviewed([]string{ann.ID}, "reader")
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	first := reviews[0]
+	assert.Equal(t, 1, first.ReviewCount)
+	assert.Equal(t, reviewIntervals[0], first.NextReviewAt.Sub(first.LastReviewedAt))
+
+	feed, err = svc.ReviewFeed("reader", 10)
+	require.NoError(t, err)
+	assert.Empty(t, feed, "reviewed highlights leave the feed until they're due")
+	assert.NotNil(t, feed)
+
+	reviews, err = svc.MarkReviewed([]string{ann.ID}, "reader")
+	require.NoError(t, err)
+	assert.Equal(t, 2, reviews[0].ReviewCount)
+	assert.Equal(t, reviewIntervals[1], reviews[0].NextReviewAt.Sub(reviews[0].LastReviewedAt), "each review waits longer")
+
+	store.reviews[ann.ID].ReviewCount = 100
+	reviews, err = svc.MarkReviewed([]string{ann.ID}, "reader")
+	require.NoError(t, err)
+	assert.Equal(t, reviewIntervals[len(reviewIntervals)-1], reviews[0].NextReviewAt.Sub(reviews[0].LastReviewedAt))
+}
+
+func TestValidColor(t *testing.T) {
+	for _, color := range Colors {
+		assert.True(t, ValidColor(color), color)
+	}
+	assert.False(t, ValidColor(""))
+	assert.False(t, ValidColor("purple"))
+}
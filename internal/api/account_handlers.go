@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Password and Email Verification Handlers ====================
+
+// How long emailed links stay valid, and how long sending one may take
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	accountEmailTimeout  = 30 * time.Second
+)
+
+// ForgotPassword emails a password reset link. It answers the same way
+// whether or not the address has an account, so it can't be used to find
+// out who is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "email", "Email is required")
+		return
+	}
+
+	if !h.emailLinksEnabled() {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Password reset by email isn't available on this server. Ask an administrator to reset your password.")
+		return
+	}
+
+	user, err := h.db.GetUserByEmail(strings.TrimSpace(strings.ToLower(req.Email)))
+	if err == nil {
+		h.sendPasswordResetEmail(user)
+	} else if err != sql.ErrNoRows {
+		log.Printf("Warning: failed to look up user for password reset: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an account uses that email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using the token from a reset email
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Token and password are required")
+		return
+	}
+	if len(req.Password) < 8 {
+		apierror.Invalid(c, "password", "Password must be at least 8 characters")
+		return
+	}
+
+	userID, ok := h.consumeAccountToken(c, req.Token, models.AccountTokenPasswordReset)
+	if !ok {
+		return
+	}
+	if !h.setPassword(c, userID, req.Password) {
+		return
+	}
+
+	// Following the emailed link proves the address is theirs
+	if err := h.db.SetEmailVerified(userID); err != nil {
+		log.Printf("Warning: failed to mark email verified for %s: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset. You can now log in with your new password."})
+}
+
+// ChangePassword sets a new password for the current user, who must give
+// their current one
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Current and new password are required")
+		return
+	}
+
+	user, err := h.db.GetUserByID(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+	if !auth.CheckPassword(req.CurrentPassword, user.PasswordHash) {
+		apierror.Invalid(c, "current_password", "Current password is incorrect")
+		return
+	}
+	if len(req.NewPassword) < 8 {
+		apierror.Invalid(c, "new_password", "Password must be at least 8 characters")
+		return
+	}
+
+	if !h.setPassword(c, user.ID, req.NewPassword) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// VerifyEmail confirms a new account's email address using the token from
+// its verification email, and logs the user in
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "token", "Token is required")
+		return
+	}
+
+	userID, ok := h.consumeAccountToken(c, req.Token, models.AccountTokenEmailVerification)
+	if !ok {
+		return
+	}
+	if err := h.db.SetEmailVerified(userID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify email")
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+	token, err := auth.GenerateToken(user.ID, user.Username)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified",
+		"user":    user,
+		"token":   token,
+	})
+}
+
+// ResendVerification emails a new verification link to an unverified
+// account. Like ForgotPassword it doesn't reveal whether the account exists.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "email", "Email is required")
+		return
+	}
+
+	if !h.emailLinksEnabled() {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Email isn't configured on this server")
+		return
+	}
+
+	user, err := h.db.GetUserByEmail(strings.TrimSpace(strings.ToLower(req.Email)))
+	if err == nil && !user.EmailVerified {
+		h.sendVerificationEmail(user)
+	} else if err != nil && err != sql.ErrNoRows {
+		log.Printf("Warning: failed to look up user for verification email: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If an unverified account uses that email, a new verification link has been sent",
+	})
+}
+
+// consumeAccountToken uses up an emailed token, returning the user it was
+// issued to. It writes a 400 if the token is unknown, used, or expired.
+func (h *AuthHandler) consumeAccountToken(c *gin.Context, token, purpose string) (string, bool) {
+	userID, err := h.db.ConsumeAccountToken(auth.HashAccountToken(token), purpose)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidToken, "This link is invalid or has expired")
+		return "", false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check token")
+		return "", false
+	}
+	return userID, true
+}
+
+// setPassword replaces a user's password and invalidates any reset links
+// still outstanding, writing an error response on failure
+func (h *AuthHandler) setPassword(c *gin.Context, userID, password string) bool {
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to hash password")
+		return false
+	}
+	if err := h.db.UpdateUserPassword(userID, passwordHash); err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return false
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update password")
+		return false
+	}
+
+	if err := h.db.DeleteAccountTokens(userID, models.AccountTokenPasswordReset); err != nil {
+		log.Printf("Warning: failed to clear reset tokens for %s: %v", userID, err)
+	}
+	return true
+}
+
+// sendPasswordResetEmail emails user a link for choosing a new password
+func (h *AuthHandler) sendPasswordResetEmail(user *models.User) {
+	link, ok := h.accountLink(user, models.AccountTokenPasswordReset, passwordResetTTL, "reset")
+	if !ok {
+		return
+	}
+	h.sendEmail(user.Email, "Reset your Webby password", fmt.Sprintf(
+		"Someone asked to reset the password for %s on Webby. To choose a new password, open this link within an hour:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email. Your password hasn't changed.",
+		user.Username, link))
+}
+
+// sendVerificationEmail emails user a link confirming their address
+func (h *AuthHandler) sendVerificationEmail(user *models.User) {
+	link, ok := h.accountLink(user, models.AccountTokenEmailVerification, emailVerificationTTL, "verify")
+	if !ok {
+		return
+	}
+	h.sendEmail(user.Email, "Verify your Webby email address", fmt.Sprintf(
+		"Welcome to Webby, %s! To confirm this is your email address, open this link within 48 hours:\n\n%s\n\n"+
+			"If you didn't create an account, you can ignore this email.",
+		user.Username, link))
+}
+
+// emailLinksEnabled reports whether account email can be sent. Its links
+// need the configured public URL: the request's Host header is chosen by
+// whoever sends it, so a link built from it could hand a victim's token to
+// another site.
+func (h *AuthHandler) emailLinksEnabled() bool {
+	return h.mailer.EmailConfigured() && h.config.PublicURL != ""
+}
+
+// accountLink issues a token for user and returns the sign-in page link
+// that uses it, named by param. Failures are logged.
+func (h *AuthHandler) accountLink(user *models.User, purpose string, ttl time.Duration, param string) (string, bool) {
+	if h.config.PublicURL == "" {
+		log.Printf("Warning: not sending %s email to %s: WEBBY_PUBLIC_URL isn't set", purpose, user.ID)
+		return "", false
+	}
+	token, hash, err := auth.NewAccountToken()
+	if err != nil {
+		log.Printf("Warning: failed to generate %s token: %v", purpose, err)
+		return "", false
+	}
+	if err := h.db.CreateAccountToken(hash, user.ID, purpose, time.Now().Add(ttl)); err != nil {
+		log.Printf("Warning: failed to save %s token for %s: %v", purpose, user.ID, err)
+		return "", false
+	}
+
+	return strings.TrimSuffix(h.config.PublicURL, "/") + "/auth?" + param + "=" + token, true
+}
+
+// sendEmail sends in the background, so how long the mail server takes
+// doesn't reveal whether an address has an account
+func (h *AuthHandler) sendEmail(to, subject, body string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), accountEmailTimeout)
+		defer cancel()
+		if err := h.mailer.SendEmail(ctx, to, subject, body); err != nil {
+			log.Printf("Warning: failed to send %q email: %v", subject, err)
+		}
+	}()
+}
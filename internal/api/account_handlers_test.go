@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/auth"
+)
+
+// fakeMailer records the emails it's asked to send
+type fakeMailer struct {
+	sent chan fakeEmail
+}
+
+type fakeEmail struct {
+	to, subject, body string
+}
+
+func (m *fakeMailer) SendEmail(ctx context.Context, to, subject, body string) error {
+	m.sent <- fakeEmail{to, subject, body}
+	return nil
+}
+
+func (m *fakeMailer) EmailConfigured() bool {
+	return true
+}
+
+// next returns the next email sent, failing if none arrives
+func (m *fakeMailer) next(t *testing.T) fakeEmail {
+	select {
+	case email := <-m.sent:
+		return email
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+		return fakeEmail{}
+	}
+}
+
+// testPublicURL is the public URL emailed links are built on in tests
+const testPublicURL = "https://books.example.com/webby"
+
+var linkTokenRegex = regexp.MustCompile(`/auth\?(?:reset|verify)=([A-Za-z0-9_-]+)`)
+
+// linkToken returns the token in an email's link
+func linkToken(t *testing.T, email fakeEmail) string {
+	m := linkTokenRegex.FindStringSubmatch(email.body)
+	require.NotNil(t, m, "email has no link: %s", email.body)
+	return m[1]
+}
+
+func setupAccountRouter(t *testing.T, config AuthConfig) (*gin.Engine, *fakeMailer, func()) {
+	handler, cleanup := setupTestHandler(t)
+	mailer := &fakeMailer{sent: make(chan fakeEmail, 10)}
+	authHandler := NewAuthHandler(handler.db, mailer, config)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/register", authHandler.Register)
+	r.POST("/auth/login", authHandler.Login)
+	r.POST("/auth/forgot-password", authHandler.ForgotPassword)
+	r.POST("/auth/reset-password", authHandler.ResetPassword)
+	r.POST("/auth/verify-email", authHandler.VerifyEmail)
+	r.POST("/auth/resend-verification", authHandler.ResendVerification)
+	r.PUT("/auth/password", auth.AuthMiddleware(), authHandler.ChangePassword)
+	return r, mailer, cleanup
+}
+
+// doJSON sends body to the router and returns the status and decoded response
+func doJSON(r *gin.Engine, method, path, token string, body any) (int, map[string]any) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestEmailVerification(t *testing.T) {
+	r, mailer, cleanup := setupAccountRouter(t, AuthConfig{RequireEmailVerification: true, PublicURL: testPublicURL})
+	defer cleanup()
+
+	code, resp := doJSON(r, http.MethodPost, "/auth/register", "", gin.H{
+		"username": "reader", "email": "reader@example.com", "password": "password123",
+	})
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, true, resp["verification_required"])
+	assert.Nil(t, resp["token"], "no token until the email is verified")
+
+	login := gin.H{"username": "reader", "password": "password123"}
+	code, resp = doJSON(r, http.MethodPost, "/auth/login", "", login)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "EMAIL_NOT_VERIFIED", resp["code"])
+
+	email := mailer.next(t)
+	assert.Equal(t, "reader@example.com", email.to)
+	token := linkToken(t, email)
+
+	code, resp = doJSON(r, http.MethodPost, "/auth/verify-email", "", gin.H{"token": token})
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, resp["token"])
+
+	code, _ = doJSON(r, http.MethodPost, "/auth/verify-email", "", gin.H{"token": token})
+	assert.Equal(t, http.StatusBadRequest, code, "tokens are single-use")
+
+	code, _ = doJSON(r, http.MethodPost, "/auth/login", "", login)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestPasswordReset(t *testing.T) {
+	r, mailer, cleanup := setupAccountRouter(t, AuthConfig{PublicURL: testPublicURL})
+	defer cleanup()
+
+	code, _ := doJSON(r, http.MethodPost, "/auth/register", "", gin.H{
+		"username": "reader", "email": "reader@example.com", "password": "password123",
+	})
+	require.Equal(t, http.StatusCreated, code)
+
+	// Unknown addresses get the same answer, and no email
+	code, _ = doJSON(r, http.MethodPost, "/auth/forgot-password", "", gin.H{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = doJSON(r, http.MethodPost, "/auth/forgot-password", "", gin.H{"email": "Reader@example.com"})
+	assert.Equal(t, http.StatusOK, code)
+	email := mailer.next(t)
+	assert.Equal(t, "reader@example.com", email.to)
+	token := linkToken(t, email)
+
+	code, _ = doJSON(r, http.MethodPost, "/auth/reset-password", "", gin.H{"token": token, "password": "short"})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = doJSON(r, http.MethodPost, "/auth/reset-password", "", gin.H{"token": "wrong", "password": "newpassword1"})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doJSON(r, http.MethodPost, "/auth/reset-password", "", gin.H{"token": token, "password": "newpassword1"})
+	require.Equal(t, http.StatusOK, code)
+	code, _ = doJSON(r, http.MethodPost, "/auth/reset-password", "", gin.H{"token": token, "password": "newpassword2"})
+	assert.Equal(t, http.StatusBadRequest, code, "tokens are single-use")
+
+	code, _ = doJSON(r, http.MethodPost, "/auth/login", "", gin.H{"username": "reader", "password": "password123"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = doJSON(r, http.MethodPost, "/auth/login", "", gin.H{"username": "reader", "password": "newpassword1"})
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAccountLinksIgnoreRequestHost(t *testing.T) {
+	r, mailer, cleanup := setupAccountRouter(t, AuthConfig{PublicURL: testPublicURL})
+	defer cleanup()
+
+	code, _ := doJSON(r, http.MethodPost, "/auth/register", "", gin.H{
+		"username": "reader", "email": "reader@example.com", "password": "password123",
+	})
+	require.Equal(t, http.StatusCreated, code)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/forgot-password", strings.NewReader(`{"email":"reader@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = "attacker.example"
+	req.Header.Set("X-Forwarded-Host", "attacker.example")
+	req.Header.Set("X-Forwarded-Proto", "http")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	email := mailer.next(t)
+	assert.Contains(t, email.body, testPublicURL+"/auth?reset=")
+	assert.NotContains(t, email.body, "attacker.example")
+
+	// Without a public URL there is nothing safe to link to
+	r, mailer, cleanup = setupAccountRouter(t, AuthConfig{})
+	defer cleanup()
+	for _, path := range []string{"/auth/forgot-password", "/auth/resend-verification"} {
+		code, resp := doJSON(r, http.MethodPost, path, "", gin.H{"email": "reader@example.com"})
+		assert.Equal(t, http.StatusServiceUnavailable, code, path)
+		assert.Equal(t, "SERVICE_UNAVAILABLE", resp["code"], path)
+	}
+	assert.Empty(t, mailer.sent)
+}
+
+func TestChangePassword(t *testing.T) {
+	r, _, cleanup := setupAccountRouter(t, AuthConfig{PublicURL: testPublicURL})
+	defer cleanup()
+
+	_, resp := doJSON(r, http.MethodPost, "/auth/register", "", gin.H{
+		"username": "reader", "email": "reader@example.com", "password": "password123",
+	})
+	token, _ := resp["token"].(string)
+	require.NotEmpty(t, token)
+
+	code, resp := doJSON(r, http.MethodPut, "/auth/password", token, gin.H{
+		"current_password": "wrongpassword", "new_password": "newpassword1",
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "VALIDATION_FAILED", resp["code"])
+
+	code, _ = doJSON(r, http.MethodPut, "/auth/password", "", gin.H{
+		"current_password": "password123", "new_password": "newpassword1",
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = doJSON(r, http.MethodPut, "/auth/password", token, gin.H{
+		"current_password": "password123", "new_password": "newpassword1",
+	})
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doJSON(r, http.MethodPost, "/auth/login", "", gin.H{"username": "reader", "password": "newpassword1"})
+	assert.Equal(t, http.StatusOK, code)
+}
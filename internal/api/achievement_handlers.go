@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+)
+
+// ==================== Achievement Handlers ====================
+
+// ListAchievements returns every achievement with the current user's
+// progress towards it, awarding any they have newly earned
+func (h *Handler) ListAchievements(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	achievements, err := h.achievements.Evaluate(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch achievements")
+		return
+	}
+
+	earned := 0
+	for _, a := range achievements {
+		if a.Earned {
+			earned++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"achievements": achievements,
+		"count":        len(achievements),
+		"earned":       earned,
+	})
+}
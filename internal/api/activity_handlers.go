@@ -0,0 +1,155 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Activity Handlers ====================
+
+// recordActivity publishes an event to the activity feed if the user has
+// turned publishing of its type on and isn't in privacy mode. Failures are
+// logged rather than failing the request that caused the event.
+func (h *Handler) recordActivity(userID, eventType, bookID string, rating int) {
+	if userID == "" || h.db.InPrivacyMode(userID) {
+		return
+	}
+
+	prefs, err := h.db.GetActivityPreferences(userID)
+	if err != nil {
+		log.Printf("Warning: failed to load activity preferences for user %s: %v", userID, err)
+		return
+	}
+	if !prefs.Publishes(eventType) {
+		return
+	}
+
+	event := &models.ActivityEvent{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      eventType,
+		BookID:    bookID,
+		Rating:    rating,
+		CreatedAt: time.Now(),
+	}
+	if err := h.db.RecordActivity(event); err != nil {
+		log.Printf("Warning: failed to record %s activity for book %s: %v", eventType, bookID, err)
+	}
+}
+
+// clearActivity withdraws a user's published event for a book, such as
+// when a rating is cleared
+func (h *Handler) clearActivity(userID, eventType, bookID string) {
+	if userID == "" {
+		return
+	}
+	if err := h.db.DeleteActivity(userID, eventType, bookID); err != nil {
+		log.Printf("Warning: failed to clear %s activity for book %s: %v", eventType, bookID, err)
+	}
+}
+
+// GetActivityFeed returns recent activity from the current user and the
+// users they share books with, newest first. ?limit defaults to 50 (max 200).
+func (h *Handler) GetActivityFeed(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	events, err := h.db.ListActivityFeed(userID, limit)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch activity")
+		return
+	}
+
+	if events == nil {
+		events = []*models.ActivityEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+// GetActivityPreferences returns what the current user publishes to the
+// activity feed
+func (h *Handler) GetActivityPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	prefs, err := h.db.GetActivityPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch activity preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateActivityPreferences changes what the current user publishes.
+// Only the fields present in the request are changed. Turning a type off
+// also hides what was already published of it.
+func (h *Handler) UpdateActivityPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		PublishAdded    *bool `json:"publish_added"`
+		PublishFinished *bool `json:"publish_finished"`
+		PublishRated    *bool `json:"publish_rated"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	prefs, err := h.db.GetActivityPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch activity preferences")
+		return
+	}
+
+	if req.PublishAdded != nil {
+		prefs.PublishAdded = *req.PublishAdded
+	}
+	if req.PublishFinished != nil {
+		prefs.PublishFinished = *req.PublishFinished
+	}
+	if req.PublishRated != nil {
+		prefs.PublishRated = *req.PublishRated
+	}
+
+	prefs.UpdatedAt = time.Now()
+	if err := h.db.SaveActivityPreferences(prefs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save activity preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Age Rating Handlers ====================
+
+// UpdateBookAgeRating sets who a book is suitable for, or clears it with an
+// empty age_rating. Owners may rate their books and admins may rate any
+// book; users with a content restriction may not change ratings.
+func (h *Handler) UpdateBookAgeRating(c *gin.Context) {
+	var req struct {
+		AgeRating *string `json:"age_rating" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "age_rating", "age_rating is required")
+		return
+	}
+	rating := strings.TrimSpace(*req.AgeRating)
+	if rating != "" && !models.ValidAgeRating(rating) {
+		apierror.Invalid(c, "age_rating", "age_rating must be one of: "+strings.Join(models.AgeRatings, ", ")+", or empty")
+		return
+	}
+
+	userID := auth.GetUserID(c)
+	max, err := h.db.GetUserMaxAgeRating(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch content restriction")
+		return
+	}
+	if max != "" {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Accounts with a content restriction can't change age ratings")
+		return
+	}
+
+	var book *models.Book
+	if h.isAdmin(userID) {
+		if book, err = h.lookupBook(c); err == sql.ErrNoRows {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+			return
+		} else if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+			return
+		}
+	} else {
+		var ok bool
+		if book, ok = h.authorizedBook(c, authz.Write); !ok {
+			return
+		}
+	}
+
+	if err := h.db.UpdateBookAgeRating(book.ID, rating); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update age rating")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Age rating updated",
+		"book_id":    book.ID,
+		"age_rating": rating,
+	})
+}
+
+// ListContentRestrictions returns the users with a content restriction.
+// Admins only.
+func (h *Handler) ListContentRestrictions(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	restrictions, err := h.db.ListContentRestrictions()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch content restrictions")
+		return
+	}
+	if restrictions == nil {
+		restrictions = []models.ContentRestriction{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"restrictions": restrictions,
+		"count":        len(restrictions),
+		"age_ratings":  models.AgeRatings,
+	})
+}
+
+// SetContentRestriction sets the highest age rating a user may see, or
+// lifts their restriction with an empty max_age_rating. Admins only, and
+// not on themselves, so an admin can't lock themselves out of rating books.
+func (h *Handler) SetContentRestriction(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	var req struct {
+		MaxAgeRating *string `json:"max_age_rating" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "max_age_rating", "max_age_rating is required")
+		return
+	}
+	max := strings.TrimSpace(*req.MaxAgeRating)
+	if max != "" && !models.ValidAgeRating(max) {
+		apierror.Invalid(c, "max_age_rating", "max_age_rating must be one of: "+strings.Join(models.AgeRatings, ", ")+", or empty")
+		return
+	}
+
+	user, err := h.db.GetUserByID(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch user")
+		return
+	}
+	if user.ID == auth.GetUserID(c) && max != "" {
+		apierror.Invalid(c, "max_age_rating", "Admins can't restrict their own account")
+		return
+	}
+
+	if err := h.db.SetUserMaxAgeRating(user.ID, max); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update content restriction")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ContentRestriction{UserID: user.ID, Username: user.Username, MaxAgeRating: max})
+}
+
+// visibleBooks drops the books userID's content restriction hides from
+// them
+func (h *Handler) visibleBooks(userID string, books []models.Book) ([]models.Book, error) {
+	return h.books.Visible(userID, books)
+}
+
+// visibleGroups drops the books userID's content restriction hides from
+// them from each group, and the groups left empty
+func (h *Handler) visibleGroups(userID string, grouped map[string][]models.Book) (map[string][]models.Book, error) {
+	if userID == "" {
+		return grouped, nil
+	}
+	hidden, err := h.db.HiddenBookIDs(userID)
+	if err != nil || len(hidden) == 0 {
+		return grouped, err
+	}
+	for key, books := range grouped {
+		visible := make([]models.Book, 0, len(books))
+		for _, b := range books {
+			if !hidden[b.ID] {
+				visible = append(visible, b)
+			}
+		}
+		if len(visible) == 0 {
+			delete(grouped, key)
+		} else {
+			grouped[key] = visible
+		}
+	}
+	return grouped, nil
+}
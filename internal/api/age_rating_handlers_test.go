@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestContentRestrictions(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.SetAdmins([]string{"admin"})
+	adminID := createNamedUser(t, handler, "admin")
+	kidID := createNamedUser(t, handler, "sam")
+
+	// The kid's library: a picture book, a teen novel, and a book no one
+	// has rated
+	ids := map[string]string{}
+	for _, title := range []string{"Matilda", "The Hunger Games", "Unrated Book"} {
+		book := &models.Book{ID: uuid.New().String(), UserID: kidID, Title: title, Author: "Author",
+			FilePath: "/tmp/" + title + ".epub", UploadedAt: time.Now(), ContentType: models.ContentTypeBook, FileFormat: models.FileFormatEPUB}
+		require.NoError(t, handler.db.CreateBook(book))
+		ids[title] = book.ID
+	}
+
+	call := func(userID string, handle gin.HandlerFunc, method, target, id string, body gin.H) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		data, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest(method, target, strings.NewReader(string(data)))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handle(c)
+		return w
+	}
+	rate := func(userID, title, rating string) int {
+		return call(userID, handler.UpdateBookAgeRating, http.MethodPut, "/api/books/x/age-rating", ids[title], gin.H{"age_rating": rating}).Code
+	}
+	restrict := func(userID, target, max string) int {
+		return call(userID, handler.SetContentRestriction, http.MethodPut, "/api/admin/users/x/content-restriction", target, gin.H{"max_age_rating": max}).Code
+	}
+	titles := func() []string {
+		w := call(kidID, handler.ListBooks, http.MethodGet, "/api/books", "", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Books []models.Book `json:"books"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		var out []string
+		for _, b := range resp.Books {
+			out = append(out, b.Title)
+		}
+		return out
+	}
+
+	assert.Equal(t, http.StatusOK, rate(kidID, "Matilda", models.AgeRatingAllAges), "owners rate their books")
+	assert.Equal(t, http.StatusBadRequest, rate(kidID, "Matilda", "pg"))
+
+	assert.Equal(t, http.StatusForbidden, restrict(kidID, kidID, ""), "admins only")
+	assert.Equal(t, http.StatusBadRequest, restrict(adminID, kidID, "kids"))
+	assert.Equal(t, http.StatusBadRequest, restrict(adminID, adminID, models.AgeRatingAllAges), "admins can't restrict themselves")
+	assert.Equal(t, http.StatusNotFound, restrict(adminID, "missing", models.AgeRatingAllAges))
+	assert.Equal(t, http.StatusOK, restrict(adminID, kidID, models.AgeRatingAllAges))
+
+	assert.Equal(t, http.StatusForbidden, rate(kidID, "The Hunger Games", models.AgeRatingAllAges), "restricted users can't change ratings")
+	assert.Equal(t, http.StatusOK, rate(adminID, "The Hunger Games", models.AgeRatingTeen), "admins rate any book")
+
+	w := call(adminID, handler.ListContentRestrictions, http.MethodGet, "/api/admin/content-restrictions", "", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listed struct {
+		Restrictions []models.ContentRestriction `json:"restrictions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Restrictions, 1)
+	assert.Equal(t, "sam", listed.Restrictions[0].Username)
+
+	// Only the all-ages book shows up, in lists, lookups, and OPDS
+	assert.Equal(t, []string{"Matilda"}, titles())
+	w = call(kidID, handler.GetBook, http.MethodGet, "/api/books/x", ids["The Hunger Games"], nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = call(kidID, handler.GetBookCover, http.MethodGet, "/api/books/x/cover", ids["Unrated Book"], nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", kidID) })
+	r.GET("/opds/v1.2/books/all.xml", handler.OPDSAllBooks)
+	r.GET("/opds/v1.2/search.xml", handler.OPDSSearch)
+	for _, path := range []string{"/opds/v1.2/books/all.xml", "/opds/v1.2/search.xml?q=a"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "Matilda", path)
+		assert.NotContains(t, w.Body.String(), "Hunger Games", path)
+		assert.NotContains(t, w.Body.String(), "Unrated", path)
+	}
+
+	// A teen restriction lets the teen novel through, and lifting it the rest
+	assert.Equal(t, http.StatusOK, restrict(adminID, kidID, models.AgeRatingTeen))
+	assert.Equal(t, []string{"The Hunger Games", "Matilda"}, titles())
+	assert.Equal(t, http.StatusOK, restrict(adminID, kidID, ""))
+	assert.Len(t, titles(), 3)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"regexp"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/justyntemme/webby/internal/apierror"
 	"github.com/justyntemme/webby/internal/auth"
 	"github.com/justyntemme/webby/internal/models"
 	"github.com/justyntemme/webby/internal/storage"
@@ -16,13 +18,28 @@ import (
 
 // AuthHandler contains authentication handlers
 type AuthHandler struct {
-	db                  *storage.Database
-	disableRegistration bool
+	db     *storage.Database
+	mailer Mailer
+	config AuthConfig
+}
+
+// AuthConfig holds the server's account settings
+type AuthConfig struct {
+	DisableRegistration      bool
+	RequireAuth              bool   // No anonymous access to books
+	RequireEmailVerification bool   // New accounts can't log in until their email is confirmed
+	PublicURL                string // Base of links in emails, which aren't sent when it's empty
+}
+
+// Mailer sends account email such as password reset links
+type Mailer interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+	EmailConfigured() bool
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *storage.Database, disableRegistration bool) *AuthHandler {
-	return &AuthHandler{db: db, disableRegistration: disableRegistration}
+func NewAuthHandler(db *storage.Database, mailer Mailer, config AuthConfig) *AuthHandler {
+	return &AuthHandler{db: db, mailer: mailer, config: config}
 }
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
@@ -30,8 +47,8 @@ var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]
 // Register handles user registration
 func (h *AuthHandler) Register(c *gin.Context) {
 	// Check if registration is disabled
-	if h.disableRegistration {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+	if h.config.DisableRegistration {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeRegistrationDisabled, "Registration is disabled")
 		return
 	}
 
@@ -42,66 +59,78 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username, email, and password are required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Username, email, and password are required")
 		return
 	}
 
 	// Validate username
 	req.Username = strings.TrimSpace(req.Username)
 	if len(req.Username) < 3 || len(req.Username) > 32 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be 3-32 characters"})
+		apierror.Invalid(c, "username", "Username must be 3-32 characters")
 		return
 	}
 
 	// Validate email
 	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
 	if !emailRegex.MatchString(req.Email) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		apierror.Invalid(c, "email", "Invalid email format")
 		return
 	}
 
 	// Validate password
 	if len(req.Password) < 8 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters"})
+		apierror.Invalid(c, "password", "Password must be at least 8 characters")
 		return
 	}
 
 	// Check if user exists
 	exists, err := h.db.UserExists(req.Username, req.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check user")
 		return
 	}
 	if exists {
-		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already taken"})
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "Username or email already taken")
 		return
 	}
 
 	// Hash password
 	passwordHash, err := auth.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to hash password")
 		return
 	}
 
 	// Create user
 	user := &models.User{
-		ID:           uuid.New().String(),
-		Username:     req.Username,
-		Email:        req.Email,
-		PasswordHash: passwordHash,
-		CreatedAt:    time.Now(),
+		ID:            uuid.New().String(),
+		Username:      req.Username,
+		Email:         req.Email,
+		PasswordHash:  passwordHash,
+		EmailVerified: !h.config.RequireEmailVerification,
+		CreatedAt:     time.Now(),
 	}
 
 	if err := h.db.CreateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create user")
+		return
+	}
+
+	// The account can't be used until the emailed link is followed
+	if !user.EmailVerified {
+		h.sendVerificationEmail(user)
+		c.JSON(http.StatusCreated, gin.H{
+			"message":               "User registered. Check your email to verify your account.",
+			"user":                  user,
+			"verification_required": true,
+		})
 		return
 	}
 
 	// Generate token
 	token, err := auth.GenerateToken(user.ID, user.Username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -120,7 +149,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Username and password are required")
 		return
 	}
 
@@ -130,21 +159,26 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		// Try by email
 		user, err = h.db.GetUserByEmail(req.Username)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid credentials")
 			return
 		}
 	}
 
 	// Check password
 	if !auth.CheckPassword(req.Password, user.PasswordHash) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid credentials")
+		return
+	}
+
+	if h.config.RequireEmailVerification && !user.EmailVerified {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeEmailNotVerified, "Verify your email address before logging in")
 		return
 	}
 
 	// Generate token
 	token, err := auth.GenerateToken(user.ID, user.Username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -162,13 +196,13 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		apierror.Invalid(c, "token", "Token is required")
 		return
 	}
 
 	newToken, err := auth.RefreshToken(req.Token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token")
 		return
 	}
 
@@ -181,13 +215,13 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Not authenticated")
 		return
 	}
 
 	user, err := h.db.GetUserByID(userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
 		return
 	}
 
@@ -198,14 +232,14 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 func (h *AuthHandler) SearchUsers(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" || len(query) < 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query must be at least 2 characters"})
+		apierror.Invalid(c, "q", "Search query must be at least 2 characters")
 		return
 	}
 
 	userID := auth.GetUserID(c)
 	users, err := h.db.SearchUsers(query, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search users")
 		return
 	}
 
@@ -219,6 +253,9 @@ func (h *AuthHandler) SearchUsers(c *gin.Context) {
 // GetAuthStatus returns authentication configuration status
 func (h *AuthHandler) GetAuthStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"registration_enabled": !h.disableRegistration,
+		"registration_enabled":        !h.config.DisableRegistration,
+		"auth_required":               h.config.RequireAuth,
+		"email_verification_required": h.config.RequireEmailVerification,
+		"password_reset_enabled":      h.emailLinksEnabled(),
 	})
 }
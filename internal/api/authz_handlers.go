@@ -0,0 +1,93 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Authorization ====================
+
+// Gin context keys for the book named by the :id parameter
+const (
+	contextBook       = "authz_book"  // The book RequireBook checked
+	contextBookLookup = "lookup_book" // The book lookupBook fetched
+)
+
+// RequireBook is the route-level book policy: it loads the book named by
+// the :id parameter and aborts unless the caller may perform action on it.
+func (h *Handler) RequireBook(action authz.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := h.authorizedBook(c, action); !ok {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizedBook returns the book named by the :id parameter if the caller
+// may perform action on it, writing an error response and returning false
+// otherwise. Books RequireBook already checked are reused. Books the caller
+// can't see are reported as not found so IDs can't be probed.
+func (h *Handler) authorizedBook(c *gin.Context, action authz.Action) (*models.Book, bool) {
+	if v, ok := c.Get(contextBook); ok {
+		if checked := v.(bookCheck); checked.action >= action {
+			return checked.book, true
+		}
+	}
+
+	book, err := h.lookupBook(c)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+		return nil, false
+	}
+
+	switch h.policy.Check(book, auth.GetUserID(c), action) {
+	case nil:
+	case authz.ErrNotVisible:
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return nil, false
+	default:
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can only change your own books")
+		return nil, false
+	}
+
+	c.Set(contextBook, bookCheck{book: book, action: action})
+	return book, true
+}
+
+// bookCheck is a book and the action it was authorized for
+type bookCheck struct {
+	book   *models.Book
+	action authz.Action
+}
+
+// lookupBook fetches the book named by the :id parameter once per request,
+// so the middleware and handler that each need it share one query. Code
+// that needs the book as saved after changing it fetches it again.
+func (h *Handler) lookupBook(c *gin.Context) (*models.Book, error) {
+	if v, ok := c.Get(contextBookLookup); ok {
+		lookup := v.(bookLookup)
+		return lookup.book, lookup.err
+	}
+	book, err := h.db.GetBook(c.Param("id"))
+	c.Set(contextBookLookup, bookLookup{book: book, err: err})
+	return book, err
+}
+
+// bookLookup is the result of fetching a book
+type bookLookup struct {
+	book *models.Book
+	err  error
+}
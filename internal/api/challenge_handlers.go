@@ -0,0 +1,444 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Reading Challenge Handlers ====================
+
+// ListReadingChallenges returns the challenges the current user takes part
+// in or is invited to
+func (h *Handler) ListReadingChallenges(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenges, err := h.db.ListReadingChallengesForUser(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch challenges")
+		return
+	}
+
+	if challenges == nil {
+		challenges = []*models.ReadingChallenge{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenges": challenges,
+		"count":      len(challenges),
+	})
+}
+
+// CreateReadingChallenge starts a challenge between the current user and the
+// users it names, who are invited and take part once they join
+func (h *Handler) CreateReadingChallenge(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Description string   `json:"description"`
+		Metric      string   `json:"metric" binding:"required"`
+		Target      int      `json:"target"`
+		StartDate   string   `json:"start_date" binding:"required"` // YYYY-MM-DD
+		EndDate     string   `json:"end_date" binding:"required"`   // YYYY-MM-DD, inclusive
+		Usernames   []string `json:"usernames"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Invalid(c, "name", "Name is required")
+		return
+	}
+	if !models.ValidChallengeMetric(req.Metric) {
+		apierror.Invalid(c, "metric", "Invalid metric. Must be pages, minutes, or books")
+		return
+	}
+	if req.Target < 0 {
+		apierror.Invalid(c, "target", "target can't be negative")
+		return
+	}
+	startsAt, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+	if err != nil {
+		apierror.Invalid(c, "start_date", "Invalid start_date. Use YYYY-MM-DD")
+		return
+	}
+	endsAt, err := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+	if err != nil {
+		apierror.Invalid(c, "end_date", "Invalid end_date. Use YYYY-MM-DD")
+		return
+	}
+	if endsAt.Before(startsAt) {
+		apierror.Invalid(c, "end_date", "end_date can't be before start_date")
+		return
+	}
+	// Ends at the end of the day
+	endsAt = endsAt.Add(24*time.Hour - time.Second)
+
+	var inviteeIDs []string
+	for _, username := range req.Usernames {
+		user, err := h.db.GetUserByUsername(strings.TrimSpace(username))
+		if err != nil {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found: "+username)
+			return
+		}
+		if user.ID != userID {
+			inviteeIDs = append(inviteeIDs, user.ID)
+		}
+	}
+
+	challenge := &models.ReadingChallenge{
+		ID:          uuid.New().String(),
+		OwnerID:     userID,
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Metric:      req.Metric,
+		Target:      req.Target,
+		StartsAt:    startsAt,
+		EndsAt:      endsAt,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.db.CreateReadingChallenge(challenge, inviteeIDs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create challenge")
+		return
+	}
+
+	h.respondChallenge(c, http.StatusCreated, challenge.ID, userID)
+}
+
+// GetReadingChallenge returns a challenge with everyone invited to it
+func (h *Handler) GetReadingChallenge(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenge, ok := h.getChallengeForParticipant(c, userID)
+	if !ok {
+		return
+	}
+
+	h.respondChallenge(c, http.StatusOK, challenge.ID, userID)
+}
+
+// DeleteReadingChallenge deletes a challenge. Badges already earned in it
+// are kept.
+func (h *Handler) DeleteReadingChallenge(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenge, ok := h.getOwnedChallenge(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteReadingChallenge(challenge.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete challenge")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Challenge deleted"})
+}
+
+// InviteToReadingChallenge invites a user to a challenge by username
+func (h *Handler) InviteToReadingChallenge(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenge, ok := h.getOwnedChallenge(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	user, err := h.db.GetUserByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+
+	if _, err := h.db.GetChallengeParticipant(challenge.ID, user.ID); err == nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "User is already invited")
+		return
+	} else if err != sql.ErrNoRows {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check participants")
+		return
+	}
+
+	if err := h.db.InviteChallengeParticipant(challenge.ID, user.ID, time.Now()); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to invite user")
+		return
+	}
+
+	participant, err := h.db.GetChallengeParticipant(challenge.ID, user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch participant")
+		return
+	}
+
+	c.JSON(http.StatusCreated, participant)
+}
+
+// JoinReadingChallenge accepts the current user's invitation to a
+// challenge, putting them on its leaderboard
+func (h *Handler) JoinReadingChallenge(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenge, ok := h.getChallengeForParticipant(c, userID)
+	if !ok {
+		return
+	}
+	if challenge.Joined {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Already taking part in this challenge")
+		return
+	}
+	if challenge.Ended(time.Now()) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Challenge has ended")
+		return
+	}
+
+	if err := h.db.JoinReadingChallenge(challenge.ID, userID, time.Now()); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to join challenge")
+		return
+	}
+
+	h.respondChallenge(c, http.StatusOK, challenge.ID, userID)
+}
+
+// RemoveChallengeParticipant removes a user from a challenge. The owner can
+// remove anyone but themselves; other users can only leave or decline.
+func (h *Handler) RemoveChallengeParticipant(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenge, ok := h.getChallengeForParticipant(c, userID)
+	if !ok {
+		return
+	}
+
+	participantID := c.Param("userId")
+	if participantID != userID && challenge.OwnerID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Only the challenge's owner can remove other participants")
+		return
+	}
+	if participantID == challenge.OwnerID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "The owner can't leave the challenge; delete it instead")
+		return
+	}
+
+	if _, err := h.db.GetChallengeParticipant(challenge.ID, participantID); err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "Participant not found")
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch participant")
+		return
+	}
+
+	if err := h.db.RemoveChallengeParticipant(challenge.ID, participantID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove participant")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Participant removed"})
+}
+
+// GetChallengeLeaderboard ranks a challenge's participants by their reading
+// between its start and end, awarding the badges they've earned
+func (h *Handler) GetChallengeLeaderboard(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	challenge, ok := h.getChallengeForParticipant(c, userID)
+	if !ok {
+		return
+	}
+
+	standings, err := h.challengeStandings(challenge, time.Now())
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to compute leaderboard")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge": challenge,
+		"standings": standings,
+		"ended":     challenge.Ended(time.Now()),
+	})
+}
+
+// ListBadges returns the badges the current user has earned in challenges
+func (h *Handler) ListBadges(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	// Badges are awarded as leaderboards are computed, so bring the user's
+	// challenges up to date first
+	challenges, err := h.db.ListReadingChallengesForUser(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch challenges")
+		return
+	}
+	now := time.Now()
+	for _, challenge := range challenges {
+		if challenge.Joined && !now.Before(challenge.StartsAt) {
+			if _, err := h.challengeStandings(challenge, now); err != nil {
+				log.Printf("Warning: failed to compute standings of challenge %s: %v", challenge.ID, err)
+			}
+		}
+	}
+
+	badges, err := h.db.ListUserBadges(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch badges")
+		return
+	}
+
+	if badges == nil {
+		badges = []*models.UserBadge{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"badges": badges,
+		"count":  len(badges),
+	})
+}
+
+// challengeStandings computes a challenge's leaderboard and awards badges:
+// one to each participant who has reached the target, and, once the
+// challenge has ended, one to each leader of a challenge with more than one
+// participant
+func (h *Handler) challengeStandings(challenge *models.ReadingChallenge, now time.Time) ([]models.ChallengeStanding, error) {
+	standings, err := h.db.GetChallengeStandings(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	award := func(userID, badgeType string) {
+		badge := &models.UserBadge{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			ChallengeID: challenge.ID,
+			Type:        badgeType,
+			Name:        challenge.Name,
+			AwardedAt:   now,
+		}
+		if err := h.db.AwardBadge(badge); err != nil {
+			log.Printf("Warning: failed to award %s badge of challenge %s: %v", badgeType, challenge.ID, err)
+		}
+	}
+	for _, s := range standings {
+		if s.Completed {
+			award(s.UserID, models.BadgeTypeCompleted)
+		}
+		if challenge.Ended(now) && len(standings) > 1 && s.Rank == 1 && s.Progress > 0 {
+			award(s.UserID, models.BadgeTypeWinner)
+		}
+	}
+
+	if standings == nil {
+		standings = []models.ChallengeStanding{}
+	}
+	return standings, nil
+}
+
+// respondChallenge writes a challenge with its participants
+func (h *Handler) respondChallenge(c *gin.Context, status int, challengeID, userID string) {
+	challenge, err := h.db.GetReadingChallenge(challengeID, userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch challenge")
+		return
+	}
+	if challenge.Participants, err = h.db.ListChallengeParticipants(challenge.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch participants")
+		return
+	}
+
+	c.JSON(status, challenge)
+}
+
+// getChallengeForParticipant loads the challenge from the :id param and
+// verifies the current user takes part or is invited. Other challenges are
+// reported as not found. Writes the error response and returns false if the
+// challenge can't be used.
+func (h *Handler) getChallengeForParticipant(c *gin.Context, userID string) (*models.ReadingChallenge, bool) {
+	challenge, err := h.db.GetReadingChallenge(c.Param("id"), userID)
+	if err == nil {
+		_, err = h.db.GetChallengeParticipant(challenge.ID, userID)
+	}
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeChallengeNotFound, "Challenge not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch challenge")
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+// getOwnedChallenge loads the challenge from the :id param and verifies the
+// current user owns it. Writes the error response and returns false if the
+// challenge can't be used.
+func (h *Handler) getOwnedChallenge(c *gin.Context, userID string) (*models.ReadingChallenge, bool) {
+	challenge, ok := h.getChallengeForParticipant(c, userID)
+	if !ok {
+		return nil, false
+	}
+
+	if challenge.OwnerID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Only the challenge's owner can do this")
+		return nil, false
+	}
+
+	return challenge, true
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestReadingChallenges(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	aliceID := createNamedUser(t, handler, "alice")
+	bobID := createNamedUser(t, handler, "bob")
+	carolID := createNamedUser(t, handler, "carol")
+	daveID := createNamedUser(t, handler, "dave")
+
+	now := time.Now()
+	read := func(userID string, pages int, at time.Time) {
+		bookID := "book-" + userID
+		handler.db.CreateBook(&models.Book{ID: bookID, UserID: userID, Title: "Book", FilePath: "/" + bookID, UploadedAt: now})
+		require.NoError(t, handler.db.CreateReadingSession(&models.ReadingSession{
+			ID: userID + at.String(), UserID: userID, BookID: bookID, StartTime: at, PagesRead: pages, CreatedAt: at,
+		}))
+	}
+	read(aliceID, 100, now.Add(-time.Hour))
+	read(bobID, 300, now.Add(-2*time.Hour))
+	read(bobID, 1000, now.AddDate(0, 0, -30)) // Before the challenge
+	read(carolID, 900, now.Add(-time.Hour))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.POST("/challenges", handler.CreateReadingChallenge)
+	r.GET("/challenges", handler.ListReadingChallenges)
+	r.GET("/challenges/:id", handler.GetReadingChallenge)
+	r.DELETE("/challenges/:id", handler.DeleteReadingChallenge)
+	r.POST("/challenges/:id/join", handler.JoinReadingChallenge)
+	r.DELETE("/challenges/:id/participants/:userId", handler.RemoveChallengeParticipant)
+	r.GET("/challenges/:id/leaderboard", handler.GetChallengeLeaderboard)
+	r.GET("/badges", handler.ListBadges)
+	do := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	date := func(days int) string { return now.AddDate(0, 0, days).Format("2006-01-02") }
+	create := func(body string) models.ReadingChallenge {
+		w := do(http.MethodPost, "/challenges", aliceID, body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var ch models.ReadingChallenge
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ch))
+		return ch
+	}
+	leaderboard := func(id, userID string) []models.ChallengeStanding {
+		w := do(http.MethodGet, "/challenges/"+id+"/leaderboard", userID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Standings []models.ChallengeStanding `json:"standings"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Standings
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/challenges", aliceID,
+		`{"name":"x","metric":"words","start_date":"`+date(0)+`","end_date":"`+date(1)+`"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/challenges", aliceID,
+		`{"name":"x","metric":"pages","start_date":"`+date(1)+`","end_date":"`+date(0)+`"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/challenges", aliceID,
+		`{"name":"x","metric":"pages","start_date":"`+date(0)+`","end_date":"`+date(1)+`","usernames":["nobody"]}`).Code)
+
+	pages := create(`{"name":"Most pages","metric":"pages","start_date":"` + date(-7) + `","end_date":"` + date(7) +
+		`","usernames":["bob","carol","alice"]}`)
+	require.Len(t, pages.Participants, 3)
+	assert.True(t, pages.Joined)
+	assert.Equal(t, 1, pages.ParticipantCount)
+
+	// Only those who join are on the leaderboard, and the uninvited can't see it
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/challenges/"+pages.ID, daveID, "").Code)
+	assert.Equal(t, []models.ChallengeStanding{{Rank: 1, UserID: aliceID, Username: "alice", Progress: 100}},
+		leaderboard(pages.ID, carolID))
+
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/challenges/"+pages.ID+"/join", bobID, "").Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/challenges/"+pages.ID+"/join", bobID, "").Code)
+	assert.Equal(t, []models.ChallengeStanding{
+		{Rank: 1, UserID: bobID, Username: "bob", Progress: 300},
+		{Rank: 2, UserID: aliceID, Username: "alice", Progress: 100},
+	}, leaderboard(pages.ID, aliceID))
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/challenges/"+pages.ID+"/participants/"+aliceID, bobID, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodDelete, "/challenges/"+pages.ID+"/participants/"+aliceID, aliceID, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/challenges/"+pages.ID+"/participants/"+carolID, carolID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/challenges/"+pages.ID, carolID, "").Code)
+
+	// An ended challenge awards badges for reaching the target and winning
+	done := now.AddDate(0, 0, -5)
+	require.NoError(t, handler.db.UpdateBookReadStatus(aliceID, "book-"+aliceID, models.ReadStatusCompleted, &done))
+	books := create(`{"name":"One book","metric":"books","target":1,"start_date":"` + date(-10) + `","end_date":"` + date(-2) +
+		`","usernames":["bob"]}`)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/challenges/"+books.ID+"/join", bobID, "").Code, "ended")
+	require.NoError(t, handler.db.JoinReadingChallenge(books.ID, bobID, now))
+
+	w := do(http.MethodGet, "/badges", aliceID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Badges []models.UserBadge `json:"badges"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	var types []string
+	for _, b := range resp.Badges {
+		assert.Equal(t, "One book", b.Name)
+		types = append(types, b.Type)
+	}
+	assert.ElementsMatch(t, []string{models.BadgeTypeCompleted, models.BadgeTypeWinner}, types)
+	assert.Contains(t, do(http.MethodGet, "/badges", bobID, "").Body.String(), `"count":0`, "the running challenge has no winner yet")
+
+	// Badges outlive their challenge
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/challenges/"+books.ID, bobID, "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodDelete, "/challenges/"+books.ID, aliceID, "").Code)
+	badges, err := handler.db.ListUserBadges(aliceID)
+	require.NoError(t, err)
+	require.Len(t, badges, 2)
+	assert.Empty(t, badges[0].ChallengeID)
+}
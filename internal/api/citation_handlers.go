@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/annotations"
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Citation Handlers ====================
+
+// GetAnnotationCitation formats one of the user's highlights as a quotation
+// with a citation of the book in APA, MLA, or Chicago style, for pasting
+// into a paper. The page cited is estimated for EPUBs.
+func (h *Handler) GetAnnotationCitation(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	annotation, err := h.annotations.Get(c.Param("id"), userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch annotation")
+		return
+	}
+	book, err := h.db.GetBook(annotation.BookID)
+	if err == sql.ErrNoRows || (err == nil && !h.policy.CanRead(book, userID)) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+		return
+	}
+
+	citation, err := annotations.Cite(c.DefaultQuery("style", annotations.CitationAPA), book, annotation, h.annotationPage(book, annotation))
+	if err != nil {
+		respondServiceError(c, err, "Failed to format citation")
+		return
+	}
+	c.JSON(http.StatusOK, citation)
+}
+
+// annotationPage returns the page an annotation is on, estimated for an
+// EPUB from where its text is, or 0 when that isn't known
+func (h *Handler) annotationPage(book *models.Book, annotation *models.Annotation) int {
+	if book.IsPhysical() {
+		return 0
+	}
+	structure, err := books.LoadStructure(h.db, book)
+	if err != nil {
+		log.Printf("Warning: failed to read structure of %s: %v", book.ID, err)
+		return 0
+	}
+
+	pos := models.ReadingPosition{Chapter: annotation.Chapter}
+	if book.FileFormat == models.FileFormatEPUB {
+		chapter, _ := strconv.Atoi(annotation.Chapter)
+		loc, err := epub.LocateText(book.FilePath, annotation.SelectedText, chapter)
+		if err != nil {
+			if !errors.Is(err, epub.ErrTextNotFound) {
+				log.Printf("Warning: failed to locate annotation %s: %v", annotation.ID, err)
+			}
+			return 0
+		}
+		pos = models.ReadingPosition{Chapter: strconv.Itoa(loc.Chapter), Position: loc.Progress}
+	}
+	page, _ := books.PositionPage(pos, book.FileFormat, structure)
+	return page
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/annotations"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestGetAnnotationCitation(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	otherID := createNamedUser(t, handler, "other")
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Moby-Dick", Author: "Herman Melville",
+		Publisher: "Harper & Brothers", PublishDate: "1851", FilePath: writeTextPDF(t, "Call me Ishmael."),
+		FileFormat: models.FileFormatPDF, ContentType: models.ContentTypeBook, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+	ann := &models.Annotation{ID: uuid.New().String(), BookID: book.ID, UserID: userID, Chapter: "1",
+		SelectedText: "Call me Ishmael.", Color: models.HighlightColorYellow, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, handler.db.CreateAnnotation(ann))
+
+	get := func(userID, query string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: ann.ID}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/annotations/"+ann.ID+"/citation"+query, nil)
+		handler.GetAnnotationCitation(c)
+		return w
+	}
+
+	w := get(userID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var citation annotations.Citation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &citation))
+	assert.Equal(t, annotations.CitationAPA, citation.Style, "APA is the default")
+	assert.Equal(t, "“Call me Ishmael” (Melville, 1851, p. 1).", citation.Quote)
+	assert.Equal(t, "Melville, H. (1851). <i>Moby-Dick</i>. Harper &amp; Brothers.", citation.ReferenceHTML)
+
+	w = get(userID, "?style=mla")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &citation))
+	assert.Equal(t, "(Melville 1)", citation.InText)
+
+	assert.Equal(t, http.StatusBadRequest, get(userID, "?style=harvard").Code)
+	assert.Equal(t, http.StatusForbidden, get(otherID, "").Code)
+}
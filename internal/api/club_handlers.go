@@ -0,0 +1,585 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// maxClubCommentLength limits the size of a club discussion comment
+const maxClubCommentLength = 10000
+
+// ==================== Book Club Handlers ====================
+
+// ListBookClubs returns the clubs the current user is a member of
+func (h *Handler) ListBookClubs(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	clubs, err := h.db.ListBookClubsForUser(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch clubs")
+		return
+	}
+
+	if clubs == nil {
+		clubs = []*models.BookClub{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clubs": clubs,
+		"count": len(clubs),
+	})
+}
+
+// CreateBookClub starts a club for one of the current user's books
+func (h *Handler) CreateBookClub(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		BookID      string `json:"book_id" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Invalid(c, "name", "Name is required")
+		return
+	}
+
+	book, err := h.db.GetBookForUser(req.BookID, userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+	// Members get the book shared with them, which only its owner can do
+	if book.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Only the book's owner can start a club for it")
+		return
+	}
+
+	now := time.Now()
+	club := &models.BookClub{
+		ID:          uuid.New().String(),
+		OwnerID:     userID,
+		BookID:      book.ID,
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		BookTitle:   book.Title,
+		BookAuthor:  book.Author,
+		MemberCount: 1,
+	}
+
+	if err := h.db.CreateBookClub(club); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create club")
+		return
+	}
+
+	c.JSON(http.StatusCreated, club)
+}
+
+// GetBookClub returns a club with its members and reading schedule
+func (h *Handler) GetBookClub(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getClubForMember(c, userID)
+	if !ok {
+		return
+	}
+
+	var err error
+	if club.Members, err = h.db.ListBookClubMembers(club.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch club members")
+		return
+	}
+	if club.Schedule, err = h.db.GetBookClubSchedule(club.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch club schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, club)
+}
+
+// UpdateBookClub changes a club's name and description.
+// Only the fields present in the request are changed.
+func (h *Handler) UpdateBookClub(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getOwnedClub(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			apierror.Invalid(c, "name", "Name cannot be empty")
+			return
+		}
+		club.Name = name
+	}
+	if req.Description != nil {
+		club.Description = strings.TrimSpace(*req.Description)
+	}
+
+	club.UpdatedAt = time.Now()
+	if err := h.db.UpdateBookClub(club); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update club")
+		return
+	}
+
+	c.JSON(http.StatusOK, club)
+}
+
+// DeleteBookClub deletes a club and its discussion
+func (h *Handler) DeleteBookClub(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getOwnedClub(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteBookClub(club); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete club")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Club deleted"})
+}
+
+// AddBookClubMember adds a user to a club by username, sharing the club's
+// book with them
+func (h *Handler) AddBookClubMember(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getOwnedClub(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	user, err := h.db.GetUserByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+
+	if _, err := h.db.GetBookClubMember(club.ID, user.ID); err == nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "User is already a member")
+		return
+	} else if err != sql.ErrNoRows {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check membership")
+		return
+	}
+
+	if err := h.db.AddBookClubMember(club, user.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add member")
+		return
+	}
+
+	member, err := h.db.GetBookClubMember(club.ID, user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch member")
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// RemoveBookClubMember removes a member from a club. The owner can remove
+// anyone but themselves; other members can only leave.
+func (h *Handler) RemoveBookClubMember(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getClubForMember(c, userID)
+	if !ok {
+		return
+	}
+
+	memberID := c.Param("userId")
+	if memberID != userID && club.OwnerID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Only the club's owner can remove other members")
+		return
+	}
+	if memberID == club.OwnerID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "The owner can't leave the club; delete it instead")
+		return
+	}
+
+	member, err := h.db.GetBookClubMember(club.ID, memberID)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "Member not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch member")
+		return
+	}
+
+	if err := h.db.RemoveBookClubMember(club, member); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// SetBookClubSchedule replaces a club's chapter-by-chapter reading schedule
+func (h *Handler) SetBookClubSchedule(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getOwnedClub(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Schedule []struct {
+			Chapter int    `json:"chapter"`
+			Title   string `json:"title"`
+			DueDate string `json:"due_date"` // YYYY-MM-DD
+		} `json:"schedule"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	schedule := make([]*models.BookClubScheduleEntry, 0, len(req.Schedule))
+	seen := map[int]bool{}
+	for _, e := range req.Schedule {
+		if e.Chapter < 0 {
+			apierror.Invalid(c, "schedule", "Chapters must not be negative")
+			return
+		}
+		if seen[e.Chapter] {
+			apierror.Invalid(c, "schedule", "Each chapter can only be scheduled once")
+			return
+		}
+		seen[e.Chapter] = true
+
+		due, err := time.ParseInLocation("2006-01-02", e.DueDate, time.Local)
+		if err != nil {
+			apierror.Invalid(c, "schedule", "Invalid due_date. Use YYYY-MM-DD")
+			return
+		}
+		schedule = append(schedule, &models.BookClubScheduleEntry{
+			Chapter: e.Chapter,
+			Title:   strings.TrimSpace(e.Title),
+			// Due at the end of the day
+			DueDate: due.Add(24*time.Hour - time.Second),
+		})
+	}
+
+	if err := h.db.SetBookClubSchedule(club.ID, schedule); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save schedule")
+		return
+	}
+
+	saved, err := h.db.GetBookClubSchedule(club.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch schedule")
+		return
+	}
+	if saved == nil {
+		saved = []*models.BookClubScheduleEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedule": saved})
+}
+
+// ==================== Book Club Discussion Handlers ====================
+
+// ListBookClubComments returns a club's discussion, optionally for one
+// ?chapter. Comments on chapters past the reader's position are marked as
+// spoilers and have their body withheld.
+func (h *Handler) ListBookClubComments(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getClubForMember(c, userID)
+	if !ok {
+		return
+	}
+
+	chapter := -1
+	if s := c.Query("chapter"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			apierror.Invalid(c, "chapter", "chapter must be a chapter index")
+			return
+		}
+		chapter = n
+	}
+
+	comments, err := h.db.ListBookClubComments(club.ID, chapter)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch comments")
+		return
+	}
+
+	reached := h.clubChapterReached(club.BookID, userID)
+	for _, comment := range comments {
+		if comment.Chapter > reached && comment.UserID != userID {
+			comment.Spoiler = true
+			comment.Body = ""
+		}
+	}
+
+	if comments == nil {
+		comments = []*models.BookClubComment{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments":        comments,
+		"count":           len(comments),
+		"chapter_reached": reached,
+	})
+}
+
+// CreateBookClubComment posts a comment on a chapter, or a reply to another
+// comment
+func (h *Handler) CreateBookClubComment(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getClubForMember(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Chapter  int    `json:"chapter"`
+		ParentID string `json:"parent_id"`
+		Body     string `json:"body"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		apierror.Invalid(c, "body", "Comment body cannot be empty")
+		return
+	}
+	if len(req.Body) > maxClubCommentLength {
+		apierror.Invalid(c, "body", "Comment is too long")
+		return
+	}
+
+	// Replies belong to their parent's chapter
+	if req.ParentID != "" {
+		parent, err := h.db.GetBookClubComment(req.ParentID)
+		if err != nil || parent.ClubID != club.ID {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeCommentNotFound, "Comment not found")
+			return
+		}
+		req.Chapter = parent.Chapter
+	}
+	if req.Chapter < 0 {
+		apierror.Invalid(c, "chapter", "chapter must be a chapter index")
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch user")
+		return
+	}
+
+	now := time.Now()
+	comment := &models.BookClubComment{
+		ID:        uuid.New().String(),
+		ClubID:    club.ID,
+		UserID:    userID,
+		Chapter:   req.Chapter,
+		ParentID:  req.ParentID,
+		Body:      req.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Username:  user.Username,
+	}
+
+	if err := h.db.CreateBookClubComment(comment); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save comment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// DeleteBookClubComment deletes a comment and its replies. Authors can
+// delete their own comments and the club's owner can delete any.
+func (h *Handler) DeleteBookClubComment(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	club, ok := h.getClubForMember(c, userID)
+	if !ok {
+		return
+	}
+
+	comment, err := h.db.GetBookClubComment(c.Param("commentId"))
+	if err == sql.ErrNoRows || (err == nil && comment.ClubID != club.ID) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeCommentNotFound, "Comment not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch comment")
+		return
+	}
+
+	if comment.UserID != userID && club.OwnerID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+
+	if err := h.db.DeleteBookClubComment(comment.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete comment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted"})
+}
+
+// clubChapterReached returns the furthest chapter whose discussion a member
+// can see without spoilers: the chapter they're reading, or every chapter
+// once they've finished the book. It's -1 before they start reading.
+func (h *Handler) clubChapterReached(bookID, userID string) int {
+	if status, _, err := h.db.GetBookReadStatus(userID, bookID); err == nil && status == models.ReadStatusCompleted {
+		return math.MaxInt32
+	}
+
+	pos, err := h.db.GetReadingPosition(bookID, userID)
+	if err != nil {
+		return -1
+	}
+	chapter, err := strconv.Atoi(pos.Chapter)
+	if err != nil {
+		return -1
+	}
+	return chapter
+}
+
+// getClubForMember loads the club from the :id param and verifies the
+// current user is a member. Clubs the user isn't in are reported as not
+// found. Writes the error response and returns false if the club can't be
+// used.
+func (h *Handler) getClubForMember(c *gin.Context, userID string) (*models.BookClub, bool) {
+	club, err := h.db.GetBookClub(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeClubNotFound, "Club not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch club")
+		return nil, false
+	}
+
+	if _, err := h.db.GetBookClubMember(club.ID, userID); err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeClubNotFound, "Club not found")
+		return nil, false
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check membership")
+		return nil, false
+	}
+
+	return club, true
+}
+
+// getOwnedClub loads the club from the :id param and verifies the current
+// user owns it. Writes the error response and returns false if the club
+// can't be used.
+func (h *Handler) getOwnedClub(c *gin.Context, userID string) (*models.BookClub, bool) {
+	club, ok := h.getClubForMember(c, userID)
+	if !ok {
+		return nil, false
+	}
+
+	if club.OwnerID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Only the club's owner can do this")
+		return nil, false
+	}
+
+	return club, true
+}
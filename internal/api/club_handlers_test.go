@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestBookClubDiscussion(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	readerID := createNamedUser(t, handler, "reader")
+	strangerID := createNamedUser(t, handler, "stranger")
+	bookID := setupTestBook(t, handler, ownerID)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.POST("/clubs", handler.CreateBookClub)
+	r.GET("/clubs/:id", handler.GetBookClub)
+	r.POST("/clubs/:id/members", handler.AddBookClubMember)
+	r.GET("/clubs/:id/comments", handler.ListBookClubComments)
+	r.POST("/clubs/:id/comments", handler.CreateBookClubComment)
+	do := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/clubs", ownerID, `{"book_id": "`+bookID+`", "name": "Tuesday Readers"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var club models.BookClub
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &club))
+
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/clubs/"+club.ID+"/members", ownerID, `{"username": "reader"}`).Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/clubs/"+club.ID+"/members", ownerID, `{"username": "reader"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/clubs/"+club.ID+"/members", readerID, `{"username": "stranger"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/clubs/"+club.ID, strangerID, "").Code)
+
+	// The book is now shared, but only its owner can start clubs for it
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/clubs", readerID, `{"book_id": "`+bookID+`", "name": "Mine"}`).Code)
+
+	w = do(http.MethodPost, "/clubs/"+club.ID+"/comments", ownerID, `{"chapter": 5, "body": "The twist!"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var parent models.BookClubComment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &parent))
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/clubs/"+club.ID+"/comments", ownerID, `{"chapter": 1, "body": "Good start"}`).Code)
+	w = do(http.MethodPost, "/clubs/"+club.ID+"/comments", readerID, `{"chapter": 0, "parent_id": "`+parent.ID+`", "body": "Reply"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"chapter":5`, "replies use their parent's chapter")
+
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: bookID, UserID: readerID, Chapter: "2"}))
+
+	var resp struct {
+		Comments       []models.BookClubComment `json:"comments"`
+		ChapterReached int                      `json:"chapter_reached"`
+	}
+	w = do(http.MethodGet, "/clubs/"+club.ID+"/comments", readerID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.ChapterReached)
+	require.Len(t, resp.Comments, 3)
+	for _, comment := range resp.Comments {
+		switch {
+		case comment.UserID == readerID:
+			assert.Equal(t, "Reply", comment.Body, "your own comments are never hidden")
+		case comment.Chapter > 2:
+			assert.True(t, comment.Spoiler)
+			assert.Empty(t, comment.Body)
+		default:
+			assert.Equal(t, "Good start", comment.Body)
+		}
+	}
+
+	require.NoError(t, handler.db.UpdateBookReadStatus(readerID, bookID, models.ReadStatusCompleted, nil))
+	w = do(http.MethodGet, "/clubs/"+club.ID+"/comments?chapter=5", readerID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "The twist!", "finishing the book reveals everything")
+}
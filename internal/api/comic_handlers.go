@@ -0,0 +1,310 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Reading Direction Handlers ====================
+
+// UpdateBookReadingDirection sets whether a book's pages are read left to
+// right or right to left
+func (h *Handler) UpdateBookReadingDirection(c *gin.Context) {
+	var req struct {
+		ReadingDirection string `json:"reading_direction" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "reading_direction", "reading_direction is required")
+		return
+	}
+	if !models.ValidReadingDirection(req.ReadingDirection) {
+		apierror.Invalid(c, "reading_direction", "reading_direction must be ltr or rtl")
+		return
+	}
+
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+
+	if err := h.db.UpdateBookReadingDirection(book.ID, req.ReadingDirection); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update reading direction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Reading direction updated",
+		"book_id":           book.ID,
+		"reading_direction": req.ReadingDirection,
+	})
+}
+
+// ListSeriesReadingDirections returns the reading direction set for each of
+// the user's series
+func (h *Handler) ListSeriesReadingDirections(c *gin.Context) {
+	directions, err := h.db.ListSeriesReadingDirections(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series reading directions")
+		return
+	}
+
+	if directions == nil {
+		directions = []*models.SeriesReadingDirection{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"series": directions})
+}
+
+// UpdateSeriesReadingDirection sets the reading direction new uploads in a
+// series get. Books already in the series are left as they are.
+func (h *Handler) UpdateSeriesReadingDirection(c *gin.Context) {
+	var req struct {
+		Series           string `json:"series" binding:"required"`
+		ReadingDirection string `json:"reading_direction" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Series and reading_direction are required")
+		return
+	}
+
+	req.Series = strings.TrimSpace(req.Series)
+	if req.Series == "" {
+		apierror.Invalid(c, "series", "Series cannot be empty")
+		return
+	}
+	if !models.ValidReadingDirection(req.ReadingDirection) {
+		apierror.Invalid(c, "reading_direction", "reading_direction must be ltr or rtl")
+		return
+	}
+
+	direction := &models.SeriesReadingDirection{
+		UserID:           auth.GetUserID(c),
+		Series:           req.Series,
+		ReadingDirection: req.ReadingDirection,
+		UpdatedAt:        time.Now(),
+	}
+	if err := h.db.SaveSeriesReadingDirection(direction); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save series reading direction")
+		return
+	}
+
+	c.JSON(http.StatusOK, direction)
+}
+
+// DeleteSeriesReadingDirection removes a series' reading direction, so new
+// uploads in it go back to what their files say
+func (h *Handler) DeleteSeriesReadingDirection(c *gin.Context) {
+	series := strings.TrimSpace(c.Query("series"))
+	if series == "" {
+		apierror.Invalid(c, "series", "series is required")
+		return
+	}
+
+	err := h.db.DeleteSeriesReadingDirection(auth.GetUserID(c), series)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No reading direction set for series")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete series reading direction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Series reading direction removed"})
+}
+
+// ==================== Long-Strip Handlers ====================
+
+// defaultStripSliceHeight is how tall strip slices are when ?height isn't
+// given
+const defaultStripSliceHeight = 2000
+
+// UpdateBookLongStrip sets whether a comic is read as one continuous
+// vertical strip, as webtoons are, rather than page by page
+func (h *Handler) UpdateBookLongStrip(c *gin.Context) {
+	var req struct {
+		LongStrip *bool `json:"long_strip" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "long_strip", "long_strip is required")
+		return
+	}
+
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+	if book.ContentType != models.ContentTypeComic {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "This is not a comic")
+		return
+	}
+
+	if err := h.db.UpdateBookLongStrip(book.ID, *req.LongStrip); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update long-strip mode")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Long-strip mode updated",
+		"book_id":    book.ID,
+		"long_strip": *req.LongStrip,
+	})
+}
+
+// GetCBZStrip returns where each page of a CBZ falls when the pages are
+// scaled to ?width and stacked into one strip, and how many slices of
+// ?height it's served in
+func (h *Handler) GetCBZStrip(c *gin.Context) {
+	book, width, height, ok := h.stripRequest(c)
+	if !ok {
+		return
+	}
+
+	strip, err := cbz.StripLayout(book.FilePath, width)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read comic pages")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"width":        strip.Width,
+		"height":       strip.Height,
+		"slice_height": height,
+		"slices":       strip.Slices(height),
+		"pages":        strip.Pages,
+	})
+}
+
+// GetCBZStripSlice serves one slice of a CBZ's strip as JPEG: the pages
+// scaled to ?width and stacked, cut into slices ?height tall. Slices are
+// counted from zero and the last is only as tall as what's left.
+func (h *Handler) GetCBZStripSlice(c *gin.Context) {
+	slice, err := strconv.Atoi(c.Param("slice"))
+	if err != nil || slice < 0 {
+		apierror.Invalid(c, "slice", "Invalid slice number")
+		return
+	}
+
+	book, width, height, ok := h.stripRequest(c)
+	if !ok {
+		return
+	}
+
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	strip, err := cbz.WriteStripSlice(&buf, book.FilePath, width, height, slice)
+	release()
+	if errors.Is(err, cbz.ErrSliceOutOfRange) {
+		apierror.RespondWith(c, http.StatusNotFound, apierror.CodePageNotFound, "Slice not found",
+			gin.H{"slices": strip.Slices(height)})
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to render strip slice")
+		return
+	}
+
+	c.Header("X-Strip-Width", strconv.Itoa(strip.Width))
+	c.Header("X-Strip-Height", strconv.Itoa(strip.Height))
+	c.Header("X-Strip-Slices", strconv.Itoa(strip.Slices(height)))
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, "image/jpeg", buf.Bytes())
+}
+
+// stripRequest returns the CBZ a strip request is for and its ?width and
+// ?height, writing the error response if they can't be used. A width of
+// zero means the widest page's.
+func (h *Handler) stripRequest(c *gin.Context) (*models.Book, int, int, bool) {
+	width, err := strconv.Atoi(c.DefaultQuery("width", "0"))
+	if err != nil || width < 0 || width > cbz.MaxStripWidth {
+		apierror.Invalid(c, "width", "Width must be a number of pixels up to "+strconv.Itoa(cbz.MaxStripWidth))
+		return nil, 0, 0, false
+	}
+	height, err := strconv.Atoi(c.DefaultQuery("height", strconv.Itoa(defaultStripSliceHeight)))
+	if err != nil || height <= 0 || height > cbz.MaxStripSliceHeight {
+		apierror.Invalid(c, "height", "Height must be between 1 and "+strconv.Itoa(cbz.MaxStripSliceHeight))
+		return nil, 0, 0, false
+	}
+
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	if !requireBookFile(c, book) {
+		return nil, 0, 0, false
+	}
+	if book.FileFormat != models.FileFormatCBZ {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Long strips are only available for CBZ files")
+		return nil, 0, 0, false
+	}
+	return book, width, height, true
+}
+
+// ==================== Page Thumbnail Handlers ====================
+
+// GetCBZThumbnails returns a small JPEG thumbnail of every page of a comic,
+// base64 encoded, for a reader's seek strip. They're generated on first
+// request and cached until the comic's file changes.
+func (h *Handler) GetCBZThumbnails(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	if book.FileFormat != models.FileFormatCBZ && book.FileFormat != models.FileFormatCBR {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Book is not a comic file (CBZ/CBR)")
+		return
+	}
+
+	// The thumbnails only change with the file
+	etag := fileETag(book.FilePath)
+	if etag != "" {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	thumbs, err := books.LoadThumbnails(h.files.ThumbnailsPath(book.ID), book)
+	release()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate thumbnails")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":    book.ID,
+		"count":      len(thumbs),
+		"thumbnails": thumbs,
+	})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestLongStripComic(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+
+	path := filepath.Join(t.TempDir(), "strip.cbz")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(out)
+	for i := 0; i < 3; i++ {
+		w, err := zw.Create(fmt.Sprintf("%03d.png", i+1))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(w, image.NewGray(image.Rect(0, 0, 100, 300))))
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Strip", FilePath: path,
+		FileFormat: models.FileFormatCBZ, ContentType: models.ContentTypeComic, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+
+	c, w := createAuthenticatedContext(userID)
+	c.Params = []gin.Param{{Key: "id", Value: book.ID}}
+	c.Request, _ = http.NewRequest(http.MethodPut, "/api/books/"+book.ID+"/long-strip",
+		strings.NewReader(`{"long_strip": true}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.UpdateBookLongStrip(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	saved, err := handler.db.GetBook(book.ID)
+	require.NoError(t, err)
+	assert.True(t, saved.LongStrip)
+
+	c, w = createAuthenticatedContext(userID)
+	c.Params = []gin.Param{{Key: "id", Value: book.ID}}
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/cbz/strip?width=50&height=100", nil)
+	handler.GetCBZStrip(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var layout struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+		Slices int `json:"slices"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &layout))
+	assert.Equal(t, 50, layout.Width)
+	assert.Equal(t, 450, layout.Height)
+	assert.Equal(t, 5, layout.Slices)
+
+	slice := func(n string) (int, string) {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: book.ID}, {Key: "slice", Value: n}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/cbz/strip/"+n+"?width=50&height=100", nil)
+		handler.GetCBZStripSlice(c)
+		return w.Code, w.Header().Get("Content-Type")
+	}
+	code, contentType := slice("4")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "image/jpeg", contentType)
+	code, _ = slice("5")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestGetCBZThumbnails(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+
+	path := filepath.Join(t.TempDir(), "comic.cbz")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(out)
+	for i := 0; i < 2; i++ {
+		w, err := zw.Create(fmt.Sprintf("%03d.png", i+1))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(w, image.NewGray(image.Rect(0, 0, 600, 900))))
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Comic", FilePath: path,
+		FileFormat: models.FileFormatCBZ, ContentType: models.ContentTypeComic, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: book.ID}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/cbz/thumbnails", nil)
+		c.Request.Header.Set("If-None-Match", ifNoneMatch)
+		handler.GetCBZThumbnails(c)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Count      int `json:"count"`
+		Thumbnails []struct {
+			Page   int    `json:"page"`
+			Height int    `json:"height"`
+			Data   []byte `json:"data"`
+		} `json:"thumbnails"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Count)
+	assert.Equal(t, 1, resp.Thumbnails[1].Page)
+	assert.Equal(t, 160, resp.Thumbnails[1].Height)
+	assert.NotEmpty(t, resp.Thumbnails[1].Data)
+	_, err = os.Stat(handler.files.ThumbnailsPath(book.ID))
+	assert.NoError(t, err, "the thumbnails are cached")
+
+	w = get(w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
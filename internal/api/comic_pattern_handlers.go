@@ -0,0 +1,173 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Comic Filename Pattern Handlers ====================
+
+// loadComicFilenamePatterns hands the saved custom patterns to the comic
+// filename parser. Patterns that no longer compile are logged and left out.
+func (h *Handler) loadComicFilenamePatterns() error {
+	saved, err := h.db.ListComicFilenamePatterns()
+	if err != nil {
+		return err
+	}
+	patterns := make([]*regexp.Regexp, 0, len(saved))
+	for _, p := range saved {
+		re, err := cbz.CompileFilenamePattern(p.Pattern)
+		if err != nil {
+			log.Printf("Warning: skipping comic filename pattern %s: %v", p.ID, err)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	cbz.SetFilenamePatterns(patterns)
+	return nil
+}
+
+// requireAdmin writes an error response and returns false unless the
+// current user is an admin
+func (h *Handler) requireAdmin(c *gin.Context) bool {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return false
+	}
+	if !h.isAdmin(userID) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Admin access required")
+		return false
+	}
+	return true
+}
+
+// ListComicFilenamePatterns returns the custom comic filename patterns in
+// the order they're tried. Admins only.
+func (h *Handler) ListComicFilenamePatterns(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	patterns, err := h.db.ListComicFilenamePatterns()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch comic filename patterns")
+		return
+	}
+	if patterns == nil {
+		patterns = []*models.ComicFilenamePattern{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patterns": patterns,
+		"count":    len(patterns),
+	})
+}
+
+// CreateComicFilenamePattern adds a custom comic filename pattern, tried
+// after those added before it. Admins only.
+func (h *Handler) CreateComicFilenamePattern(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	var req struct {
+		Pattern     string `json:"pattern" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "pattern is required")
+		return
+	}
+	if _, err := cbz.CompileFilenamePattern(req.Pattern); err != nil {
+		apierror.Invalid(c, "pattern", "Invalid pattern: "+err.Error())
+		return
+	}
+
+	pattern := &models.ComicFilenamePattern{
+		ID:          uuid.New().String(),
+		Pattern:     req.Pattern,
+		Description: strings.TrimSpace(req.Description),
+		CreatedBy:   auth.GetUserID(c),
+		CreatedAt:   time.Now(),
+	}
+	if err := h.db.CreateComicFilenamePattern(pattern); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save comic filename pattern")
+		return
+	}
+	if err := h.loadComicFilenamePatterns(); err != nil {
+		log.Printf("Warning: failed to reload comic filename patterns: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, pattern)
+}
+
+// DeleteComicFilenamePattern removes a custom comic filename pattern.
+// Admins only.
+func (h *Handler) DeleteComicFilenamePattern(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	err := h.db.DeleteComicFilenamePattern(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodePatternNotFound, "Comic filename pattern not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete comic filename pattern")
+		return
+	}
+	if err := h.loadComicFilenamePatterns(); err != nil {
+		log.Printf("Warning: failed to reload comic filename patterns: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comic filename pattern deleted"})
+}
+
+// PreviewComicFilename shows how a comic filename is parsed with the saved
+// patterns, and with pattern first if one is sent, so a pattern can be
+// tried before it's saved. What the built-in parser alone makes of the name
+// is included for comparison.
+func (h *Handler) PreviewComicFilename(c *gin.Context) {
+	if auth.GetUserID(c) == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Filename string `json:"filename" binding:"required"`
+		Pattern  string `json:"pattern"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "filename is required")
+		return
+	}
+
+	patterns := cbz.FilenamePatterns()
+	if req.Pattern != "" {
+		re, err := cbz.CompileFilenamePattern(req.Pattern)
+		if err != nil {
+			apierror.Invalid(c, "pattern", "Invalid pattern: "+err.Error())
+			return
+		}
+		patterns = append([]*regexp.Regexp{re}, patterns...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result":  cbz.ParseComicFilenameWith(req.Filename, patterns),
+		"builtin": cbz.ParseComicFilenameWith(req.Filename, nil),
+	})
+}
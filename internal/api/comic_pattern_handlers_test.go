@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestComicFilenamePatterns(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	defer cbz.SetFilenamePatterns(nil)
+
+	handler.SetAdmins([]string{"admin"})
+	adminID := createNamedUser(t, handler, "admin")
+	userID := setupTestUser(t, handler)
+
+	call := func(userID string, handle gin.HandlerFunc, method, id string, body gin.H) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		data, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest(method, "/api/admin/comic-patterns", strings.NewReader(string(data)))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handle(c)
+		return w
+	}
+	const scene = `^(?P<series>[A-Za-z.]+)\.(?P<issue>\d{3})\.(?P<year>\d{4})`
+	const filename = "The.Walking.Dead.193.2019.Digital.cbz"
+
+	w := call(userID, handler.CreateComicFilenamePattern, http.MethodPost, "", gin.H{"pattern": scene})
+	assert.Equal(t, http.StatusForbidden, w.Code, "admins only")
+	w = call(adminID, handler.CreateComicFilenamePattern, http.MethodPost, "", gin.H{"pattern": `^(.+)\.(\d+)$`})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "no named groups")
+
+	// Previewing an unsaved pattern
+	w = call(userID, handler.PreviewComicFilename, http.MethodPost, "", gin.H{"filename": filename, "pattern": scene})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var preview struct {
+		Result  cbz.ComicFilenameInfo `json:"result"`
+		Builtin cbz.ComicFilenameInfo `json:"builtin"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, "The Walking Dead", preview.Result.Series)
+	assert.Equal(t, 2019, preview.Result.Year)
+	assert.Equal(t, scene, preview.Result.MatchedPattern)
+	assert.Empty(t, preview.Builtin.MatchedPattern)
+
+	w = call(adminID, handler.CreateComicFilenamePattern, http.MethodPost, "",
+		gin.H{"pattern": scene, "description": "Scene releases"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.ComicFilenamePattern
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "The Walking Dead", cbz.ParseComicFilename(filename).Series, "saved patterns are used at once")
+
+	w = call(adminID, handler.ListComicFilenamePatterns, http.MethodGet, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Scene releases")
+
+	w = call(adminID, handler.DeleteComicFilenamePattern, http.MethodDelete, created.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, cbz.ParseComicFilename(filename).MatchedPattern)
+	w = call(adminID, handler.DeleteComicFilenamePattern, http.MethodDelete, created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== Response Compression ====================
+
+// compressMinSize is the smallest response body worth compressing, in bytes
+const compressMinSize = 1024
+
+// Compress gzips, or deflates, responses for clients that accept it, such
+// as JSON lists, OPDS feeds and chapter HTML. Book files, covers and comic
+// pages are already compressed and are sent as they are, as are bodies too
+// small to gain from it and partial responses to range requests.
+func Compress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptedEncoding picks gzip, then deflate, from an Accept-Encoding
+// header, returning "" when the client accepts neither
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	switch {
+	case accepted["gzip"] || accepted["*"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressible reports whether responses of a content type are worth
+// compressing: text, JSON and XML, but not archives, PDFs or images other
+// than SVG
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", mediaType == "application/xml",
+		mediaType == "application/javascript", mediaType == "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// compressWriter holds back the start of a response body until it knows
+// whether to compress it: once the body reaches compressMinSize it is
+// compressed if its type is worth it, and a shorter body is sent as it is
+// when the request finishes.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	buf      []byte
+	decided  bool
+	enc      compressor // Set once compressing
+}
+
+// compressor is what gzip and zlib writers have in common
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if !w.wantsCompression() {
+			w.decided = true
+			return w.ResponseWriter.Write(p)
+		}
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < compressMinSize {
+			return len(p), nil
+		}
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Written also counts a body held back, so handlers don't write another
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+// Flush sends what has been written so far, compressing it when it would
+// be compressed once long enough
+func (w *compressWriter) Flush() {
+	if !w.decided && len(w.buf) > 0 {
+		w.start()
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// wantsCompression reports whether the response about to be written should
+// be compressed, going by its status and headers
+func (w *compressWriter) wantsCompression() bool {
+	header := w.Header()
+	switch {
+	case w.ResponseWriter.Written(), header.Get("Content-Encoding") != "", header.Get("Content-Range") != "":
+		return false
+	case w.Status() < http.StatusOK, w.Status() == http.StatusNoContent, w.Status() == http.StatusNotModified:
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < compressMinSize {
+		return false
+	}
+	return compressible(header.Get("Content-Type"))
+}
+
+// start begins compressing, writing out the body held back so far
+func (w *compressWriter) start() error {
+	w.decided = true
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if w.encoding == "gzip" {
+		w.enc = gzip.NewWriter(w.ResponseWriter)
+	} else {
+		w.enc = zlib.NewWriter(w.ResponseWriter)
+	}
+	buf := w.buf
+	w.buf = nil
+	_, err := w.enc.Write(buf)
+	return err
+}
+
+// finish ends the response, sending a body too short to compress as it is
+func (w *compressWriter) finish() {
+	if !w.decided && len(w.buf) > 0 {
+		w.decided = true
+		w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+	if w.enc != nil {
+		w.enc.Close()
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Compress())
+	long := strings.Repeat("<p>Call me Ishmael.</p>", 200)
+	r.GET("/chapter", func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.String(http.StatusOK, long)
+	})
+	r.GET("/short", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	r.GET("/cover", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/jpeg", []byte(long))
+	})
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		return w
+	}
+
+	w := get("/chapter", "br, gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Less(t, w.Body.Len(), len(long)/2, "the body shrinks")
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, long, string(body))
+
+	w = get("/chapter", "deflate, gzip;q=0")
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	zr, err := zlib.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, long, string(body))
+
+	w = get("/chapter", "")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "the client didn't ask")
+	assert.Equal(t, long, w.Body.String())
+
+	w = get("/short", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "too short to gain from it")
+	assert.JSONEq(t, `{"ok": true}`, w.Body.String())
+
+	w = get("/cover", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "images are already compressed")
+	assert.Equal(t, long, w.Body.String())
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate", "deflate"},
+		{"GZIP;q=0.5", "gzip"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "gzip"},
+		{"br, identity", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, acceptedEncoding(tt.header), tt.header)
+	}
+}
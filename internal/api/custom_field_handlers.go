@@ -0,0 +1,482 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Custom Field Handlers ====================
+
+// customFieldKey is what a custom field's key looks like
+var customFieldKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// maxCustomTextLength is the longest text value a custom field holds
+const maxCustomTextLength = 1000
+
+// ListCustomFields returns the custom fields every book has
+func (h *Handler) ListCustomFields(c *gin.Context) {
+	fields, err := h.db.ListCustomFields()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch custom fields")
+		return
+	}
+	if fields == nil {
+		fields = []*models.CustomField{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"fields": fields,
+		"count":  len(fields),
+	})
+}
+
+// CreateCustomField adds a field to every book. Admins only.
+func (h *Handler) CreateCustomField(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	var req struct {
+		Key     string   `json:"key" binding:"required"`
+		Name    string   `json:"name" binding:"required"`
+		Type    string   `json:"type" binding:"required"`
+		Options []string `json:"options"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "key, name, and type are required")
+		return
+	}
+	if !customFieldKey.MatchString(req.Key) {
+		apierror.Invalid(c, "key", "key must be a lowercase letter followed by up to 31 lowercase letters, digits, or underscores")
+		return
+	}
+	if !models.ValidCustomFieldType(req.Type) {
+		apierror.Invalid(c, "type", "type must be text, number, bool, date, or enum")
+		return
+	}
+	options, ok := customFieldOptions(c, req.Type, req.Options)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.GetCustomFieldByKey(req.Key); err == nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "A custom field with this key already exists")
+		return
+	} else if err != sql.ErrNoRows {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check custom fields")
+		return
+	}
+
+	field := &models.CustomField{
+		ID:        uuid.New().String(),
+		Key:       req.Key,
+		Name:      strings.TrimSpace(req.Name),
+		Type:      req.Type,
+		Options:   options,
+		CreatedAt: time.Now(),
+	}
+	if err := h.db.CreateCustomField(field); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save custom field")
+		return
+	}
+
+	c.JSON(http.StatusCreated, field)
+}
+
+// UpdateCustomField renames a custom field or changes an enum's options.
+// Values no longer among the options are cleared. A field's key and type
+// can't change. Admins only.
+func (h *Handler) UpdateCustomField(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	field, ok := h.customField(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name    string   `json:"name"`
+		Options []string `json:"options"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		field.Name = name
+	}
+	if req.Options != nil {
+		options, ok := customFieldOptions(c, field.Type, req.Options)
+		if !ok {
+			return
+		}
+		field.Options = options
+	}
+
+	if err := h.db.UpdateCustomField(field); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update custom field")
+		return
+	}
+
+	c.JSON(http.StatusOK, field)
+}
+
+// DeleteCustomField removes a custom field and everyone's values of it.
+// Smart collection rules on it stop matching any book. Admins only.
+func (h *Handler) DeleteCustomField(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	err := h.db.DeleteCustomField(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeCustomFieldNotFound, "Custom field not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete custom field")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom field deleted"})
+}
+
+// customField loads the custom field named in the URL, writing an error
+// response and returning false if there is none
+func (h *Handler) customField(c *gin.Context) (*models.CustomField, bool) {
+	field, err := h.db.GetCustomField(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeCustomFieldNotFound, "Custom field not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch custom field")
+		return nil, false
+	}
+	return field, true
+}
+
+// customFieldOptions checks the options of a field of type fieldType:
+// enums need at least one, without blanks or repeats, and other types
+// none. It writes an error response and returns false if they're wrong.
+func customFieldOptions(c *gin.Context, fieldType string, options []string) ([]string, bool) {
+	if fieldType != models.CustomFieldEnum {
+		if len(options) > 0 {
+			apierror.Invalid(c, "options", "Only enum fields have options")
+			return nil, false
+		}
+		return nil, true
+	}
+
+	seen := make(map[string]bool)
+	var cleaned []string
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" || seen[option] {
+			apierror.Invalid(c, "options", "Options must be distinct and not blank")
+			return nil, false
+		}
+		seen[option] = true
+		cleaned = append(cleaned, option)
+	}
+	if len(cleaned) == 0 {
+		apierror.Invalid(c, "options", "Enum fields need at least one option")
+		return nil, false
+	}
+	return cleaned, true
+}
+
+// SetBookCustomFields saves the current user's values of custom fields for
+// a book. Fields left out are unchanged and null clears one.
+func (h *Handler) SetBookCustomFields(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Values map[string]interface{} `json:"values" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "values is required")
+		return
+	}
+	fields, values, ok := h.parseCustomValues(c, req.Values)
+	if !ok {
+		return
+	}
+
+	userID := auth.GetUserID(c)
+	if err := h.db.SetBookCustomValues(userID, []string{book.ID}, values); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save custom fields")
+		return
+	}
+
+	h.setCustomFieldsWith(fields, userID, book)
+	if book.CustomFields == nil {
+		book.CustomFields = map[string]interface{}{}
+	}
+	c.JSON(http.StatusOK, gin.H{"custom_fields": book.CustomFields})
+}
+
+// BulkSetCustomFields saves the same custom field values for many of the
+// current user's books at once. A dry run returns the books whose values
+// would change without changing them.
+func (h *Handler) BulkSetCustomFields(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	var req struct {
+		BookIDs []string               `json:"book_ids" binding:"required"`
+		Values  map[string]interface{} `json:"values" binding:"required"`
+		DryRun  bool                   `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "book_ids and values are required")
+		return
+	}
+	if len(req.BookIDs) > 100 {
+		apierror.Invalid(c, "book_ids", "Maximum 100 books per batch")
+		return
+	}
+	fields, values, ok := h.parseCustomValues(c, req.Values)
+	if !ok {
+		return
+	}
+
+	var books []*models.Book
+	var ids []string
+	for _, bookID := range req.BookIDs {
+		book, err := h.db.GetBookForUser(bookID, userID)
+		if err != nil {
+			continue // Skip books that don't exist or user doesn't have access to
+		}
+		books = append(books, book)
+		ids = append(ids, book.ID)
+	}
+	if len(books) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "No valid books to update")
+		return
+	}
+
+	current, err := h.db.GetBookCustomValues(userID, ids)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch custom fields")
+		return
+	}
+	changes := []models.BookChange{}
+	for _, book := range books {
+		change := models.BookChange{BookID: book.ID, Title: book.Title}
+		for _, field := range fields {
+			value, ok := values[field.ID]
+			if !ok || current[book.ID][field.ID] == value {
+				continue
+			}
+			change.Fields = append(change.Fields, models.FieldChange{
+				Field: models.RuleFieldCustomPrefix + field.Key,
+				Old:   current[book.ID][field.ID],
+				New:   value,
+			})
+		}
+		if len(change.Fields) > 0 {
+			changes = append(changes, change)
+		}
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"message":         "Dry run: nothing was changed",
+			"dry_run":         true,
+			"updated_count":   len(books),
+			"requested_count": len(req.BookIDs),
+			"changes":         changes,
+		})
+		return
+	}
+
+	if err := h.db.SetBookCustomValues(userID, ids, values); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save custom fields")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Custom fields updated",
+		"updated_count":   len(books),
+		"requested_count": len(req.BookIDs),
+		"changes":         changes,
+	})
+}
+
+// parseCustomValues checks values sent for custom fields, keyed by field
+// key, and converts them to their stored form keyed by field ID, with ""
+// for null. It returns every custom field too. It writes an error response
+// and returns false if a key or value is wrong.
+func (h *Handler) parseCustomValues(c *gin.Context, raw map[string]interface{}) ([]*models.CustomField, map[string]string, bool) {
+	fields, err := h.db.ListCustomFields()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch custom fields")
+		return nil, nil, false
+	}
+	byKey := make(map[string]*models.CustomField, len(fields))
+	for _, field := range fields {
+		byKey[field.Key] = field
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		field, ok := byKey[key]
+		if !ok {
+			apierror.Invalid(c, "values."+key, "No custom field has this key")
+			return nil, nil, false
+		}
+		value, err := encodeCustomValue(field, v)
+		if err != nil {
+			apierror.Invalid(c, "values."+key, err.Error())
+			return nil, nil, false
+		}
+		values[field.ID] = value
+	}
+	return fields, values, true
+}
+
+// encodeCustomValue converts a value sent for a custom field to the text
+// it's stored as, or "" for null
+func encodeCustomValue(field *models.CustomField, v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	switch field.Type {
+	case models.CustomFieldNumber:
+		var n float64
+		switch x := v.(type) {
+		case float64:
+			n = x
+		case string:
+			var err error
+			if n, err = strconv.ParseFloat(strings.TrimSpace(x), 64); err != nil {
+				return "", fmt.Errorf("%s must be a number", field.Key)
+			}
+		default:
+			return "", fmt.Errorf("%s must be a number", field.Key)
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", fmt.Errorf("%s must be a number", field.Key)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+
+	case models.CustomFieldBool:
+		switch x := v.(type) {
+		case bool:
+			return strconv.FormatBool(x), nil
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return strconv.FormatBool(b), nil
+			}
+		}
+		return "", fmt.Errorf("%s must be true or false", field.Key)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", field.Key)
+	}
+	s = strings.TrimSpace(s)
+	switch field.Type {
+	case models.CustomFieldDate:
+		if s == "" {
+			return "", nil
+		}
+		date, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a date as YYYY-MM-DD", field.Key)
+		}
+		return date.Format("2006-01-02"), nil
+	case models.CustomFieldEnum:
+		if s == "" {
+			return "", nil
+		}
+		for _, option := range field.Options {
+			if s == option {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("%s must be one of: %s", field.Key, strings.Join(field.Options, ", "))
+	}
+	if len(s) > maxCustomTextLength {
+		return "", fmt.Errorf("%s must be at most %d characters", field.Key, maxCustomTextLength)
+	}
+	return s, nil
+}
+
+// decodeCustomValue converts a stored custom field value to what responses
+// show: a number, a boolean, or the text itself
+func decodeCustomValue(field *models.CustomField, value string) interface{} {
+	switch field.Type {
+	case models.CustomFieldNumber:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case models.CustomFieldBool:
+		return value == "true"
+	}
+	return value
+}
+
+// setCustomFields fills in the user's custom field values of books
+func (h *Handler) setCustomFields(userID string, list ...*models.Book) {
+	if len(list) == 0 {
+		return
+	}
+	fields, err := h.db.ListCustomFields()
+	if err != nil {
+		log.Printf("Warning: failed to fetch custom fields: %v", err)
+		return
+	}
+	h.setCustomFieldsWith(fields, userID, list...)
+}
+
+// setCustomFieldsWith fills in the user's values of the given custom
+// fields for books
+func (h *Handler) setCustomFieldsWith(fields []*models.CustomField, userID string, list ...*models.Book) {
+	if len(fields) == 0 {
+		return
+	}
+	ids := make([]string, len(list))
+	for i, book := range list {
+		ids[i] = book.ID
+	}
+	values, err := h.db.GetBookCustomValues(userID, ids)
+	if err != nil {
+		log.Printf("Warning: failed to fetch custom field values: %v", err)
+		return
+	}
+	for _, book := range list {
+		for _, field := range fields {
+			value, ok := values[book.ID][field.ID]
+			if !ok {
+				continue
+			}
+			if book.CustomFields == nil {
+				book.CustomFields = make(map[string]interface{})
+			}
+			book.CustomFields[field.Key] = decodeCustomValue(field, value)
+		}
+	}
+}
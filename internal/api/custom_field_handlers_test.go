@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestCustomFields(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.SetAdmins([]string{"admin"})
+	adminID := createNamedUser(t, handler, "admin")
+	userID := setupTestUser(t, handler)
+	bookID := setupTestBook(t, handler, userID)
+	otherBookID := setupTestBook(t, handler, userID)
+
+	call := func(userID string, handle gin.HandlerFunc, method, id string, body gin.H) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		data, _ := json.Marshal(body)
+		c.Request, _ = http.NewRequest(method, "/api/custom-fields", strings.NewReader(string(data)))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handle(c)
+		return w
+	}
+	create := func(body gin.H) models.CustomField {
+		w := call(adminID, handler.CreateCustomField, http.MethodPost, "", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var field models.CustomField
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &field))
+		return field
+	}
+
+	w := call(userID, handler.CreateCustomField, http.MethodPost, "", gin.H{"key": "shelf", "name": "Shelf", "type": "text"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "admins only")
+	w = call(adminID, handler.CreateCustomField, http.MethodPost, "", gin.H{"key": "Shelf!", "name": "Shelf", "type": "text"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "bad key")
+	w = call(adminID, handler.CreateCustomField, http.MethodPost, "", gin.H{"key": "shelf", "name": "Shelf", "type": "enum"})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "enum without options")
+
+	shelf := create(gin.H{"key": "shelf", "name": "Shelf", "type": "enum", "options": []string{"Office", "Attic"}})
+	create(gin.H{"key": "price", "name": "Price", "type": "number"})
+	create(gin.H{"key": "signed", "name": "Signed", "type": "bool"})
+	create(gin.H{"key": "bought", "name": "Bought", "type": "date"})
+	w = call(adminID, handler.CreateCustomField, http.MethodPost, "", gin.H{"key": "shelf", "name": "Again", "type": "text"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Values are checked against the field's type
+	for _, values := range []gin.H{{"shelf": "Garage"}, {"price": "cheap"}, {"signed": "maybe"}, {"bought": "March"}, {"missing": "x"}} {
+		w = call(userID, handler.SetBookCustomFields, http.MethodPut, bookID, gin.H{"values": values})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%v", values)
+	}
+	w = call(userID, handler.SetBookCustomFields, http.MethodPut, bookID,
+		gin.H{"values": gin.H{"shelf": "Office", "price": "12.50", "signed": true, "bought": "2026-03-01"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var set struct {
+		CustomFields map[string]interface{} `json:"custom_fields"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Equal(t, map[string]interface{}{"shelf": "Office", "price": 12.5, "signed": true, "bought": "2026-03-01"}, set.CustomFields)
+
+	w = call(userID, handler.GetBook, http.MethodGet, bookID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Equal(t, "Office", book.CustomFields["shelf"])
+	w = call(adminID, handler.GetBook, http.MethodGet, bookID, nil)
+	assert.NotContains(t, w.Body.String(), "custom_fields", "values are per user")
+
+	// Bulk edit reports only real changes, and a dry run changes nothing
+	bulk := gin.H{"book_ids": []string{bookID, otherBookID, "missing"}, "values": gin.H{"shelf": "Office", "price": nil}, "dry_run": true}
+	w = call(userID, handler.BulkSetCustomFields, http.MethodPost, "", bulk)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result struct {
+		UpdatedCount int                 `json:"updated_count"`
+		Changes      []models.BookChange `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.UpdatedCount)
+	require.Len(t, result.Changes, 2)
+	for _, change := range result.Changes {
+		if change.BookID == bookID {
+			assert.Equal(t, []models.FieldChange{{Field: "custom:price", Old: "12.5", New: ""}}, change.Fields)
+		} else {
+			assert.Equal(t, []models.FieldChange{{Field: "custom:shelf", Old: "", New: "Office"}}, change.Fields)
+		}
+	}
+	values, err := handler.db.GetBookCustomValues(userID, []string{otherBookID})
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	bulk["dry_run"] = false
+	w = call(userID, handler.BulkSetCustomFields, http.MethodPost, "", bulk)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	values, err = handler.db.GetBookCustomValues(userID, []string{bookID, otherBookID})
+	require.NoError(t, err)
+	assert.Equal(t, "Office", values[otherBookID][shelf.ID])
+	assert.Len(t, values[bookID], 3, "price cleared")
+
+	// Dropping an option clears the values that used it
+	w = call(adminID, handler.UpdateCustomField, http.MethodPut, shelf.ID, gin.H{"options": []string{"Attic"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	values, err = handler.db.GetBookCustomValues(userID, []string{bookID, otherBookID})
+	require.NoError(t, err)
+	assert.NotContains(t, values[otherBookID], shelf.ID)
+
+	w = call(adminID, handler.DeleteCustomField, http.MethodDelete, shelf.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = call(adminID, handler.DeleteCustomField, http.MethodDelete, shelf.ID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/opds"
+)
+
+// ==================== Device Handlers ====================
+
+// deviceTokenHeader names the header a client sends its device token in.
+// E-readers that can't set headers pass it as ?device= instead.
+const deviceTokenHeader = "X-Device-Token"
+
+// deviceRequest is the body of a device create or update. Only the fields
+// present are changed.
+type deviceRequest struct {
+	Name            *string `json:"name"`
+	PreferredFormat *string `json:"preferred_format"`
+	MaxFileSize     *int64  `json:"max_file_size"`
+	ScreenWidth     *int    `json:"screen_width"`
+	ScreenHeight    *int    `json:"screen_height"`
+}
+
+// apply copies the request's fields to device, writing a validation error
+// and returning false if one is invalid
+func (req *deviceRequest) apply(c *gin.Context, device *models.Device) bool {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			apierror.Invalid(c, "name", "name is required")
+			return false
+		}
+		device.Name = name
+	}
+	if req.PreferredFormat != nil {
+		format := strings.ToLower(strings.TrimSpace(*req.PreferredFormat))
+		if format != "" && !models.ValidFileFormat(format) {
+			apierror.Invalid(c, "preferred_format", "preferred_format must be epub, pdf, cbz, cbr, mobi, or empty")
+			return false
+		}
+		device.PreferredFormat = format
+	}
+	if req.MaxFileSize != nil {
+		if *req.MaxFileSize < 0 {
+			apierror.Invalid(c, "max_file_size", "max_file_size can't be negative")
+			return false
+		}
+		device.MaxFileSize = *req.MaxFileSize
+	}
+	if req.ScreenWidth != nil {
+		if *req.ScreenWidth < 0 {
+			apierror.Invalid(c, "screen_width", "screen_width can't be negative")
+			return false
+		}
+		device.ScreenWidth = *req.ScreenWidth
+	}
+	if req.ScreenHeight != nil {
+		if *req.ScreenHeight < 0 {
+			apierror.Invalid(c, "screen_height", "screen_height can't be negative")
+			return false
+		}
+		device.ScreenHeight = *req.ScreenHeight
+	}
+	return true
+}
+
+// ListDevices returns the current user's devices
+func (h *Handler) ListDevices(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	devices, err := h.db.ListDevices(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch devices")
+		return
+	}
+
+	if devices == nil {
+		devices = []*models.Device{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"devices": devices,
+		"count":   len(devices),
+	})
+}
+
+// RegisterDevice adds a device for the current user. The response holds the
+// device's token, which isn't shown again.
+func (h *Handler) RegisterDevice(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req deviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+	if req.Name == nil {
+		apierror.Invalid(c, "name", "name is required")
+		return
+	}
+
+	device := &models.Device{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if !req.apply(c, device) {
+		return
+	}
+
+	token, hash, err := auth.NewAccountToken()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create device token")
+		return
+	}
+	if err := h.db.CreateDevice(device, hash); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save device")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"device": device,
+		"token":  token,
+	})
+}
+
+// UpdateDevice changes a device's name or preferences
+func (h *Handler) UpdateDevice(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	device, ok := h.getOwnedDevice(c, userID)
+	if !ok {
+		return
+	}
+
+	var req deviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+	if !req.apply(c, device) {
+		return
+	}
+
+	if err := h.db.UpdateDevice(device); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update device")
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// ResetDeviceToken gives a device a new token. The old one stops working.
+func (h *Handler) ResetDeviceToken(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	device, ok := h.getOwnedDevice(c, userID)
+	if !ok {
+		return
+	}
+
+	token, hash, err := auth.NewAccountToken()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create device token")
+		return
+	}
+	if err := h.db.SetDeviceToken(device.ID, hash); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update device")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device": device,
+		"token":  token,
+	})
+}
+
+// DeleteDevice removes a device
+func (h *Handler) DeleteDevice(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	device, ok := h.getOwnedDevice(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteDevice(device.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete device")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted"})
+}
+
+// getOwnedDevice loads the device from the :id param and verifies it
+// belongs to the current user. Writes the error response and returns false
+// if the device can't be used.
+func (h *Handler) getOwnedDevice(c *gin.Context, userID string) (*models.Device, bool) {
+	device, err := h.db.GetDevice(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeDeviceNotFound, "Device not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch device")
+		return nil, false
+	}
+
+	// Verify ownership
+	if device.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return nil, false
+	}
+
+	return device, true
+}
+
+// requestDeviceToken returns the device token a request carries, if any
+func requestDeviceToken(c *gin.Context) string {
+	if token := c.GetHeader(deviceTokenHeader); token != "" {
+		return token
+	}
+	return c.Query("device")
+}
+
+// requestDevice returns the device a request names by token, or nil if it
+// names none. An unknown token is ignored, so a reader with a stale token
+// still gets books, just not in its preferred form. The token only chooses
+// formats; it grants no access.
+func (h *Handler) requestDevice(c *gin.Context) *models.Device {
+	token := requestDeviceToken(c)
+	if token == "" {
+		return nil
+	}
+
+	device, err := h.db.GetDeviceByToken(auth.HashAccountToken(token))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Warning: failed to look up device: %v", err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	if err := h.db.TouchDevice(device.ID, now); err != nil {
+		log.Printf("Warning: failed to record use of device %s: %v", device.ID, err)
+	}
+	device.LastUsedAt = &now
+	return device
+}
+
+// bookFileForDevice returns the book's file to send: the edition asked for
+// with ?format=, else the one that suits device, else the main file. It
+// writes the error response and returns false on failure.
+func (h *Handler) bookFileForDevice(c *gin.Context, book *models.Book, device *models.Device) (models.BookFile, bool) {
+	if device == nil || c.Query("format") != "" {
+		return h.bookFileForFormat(c, book, c.Query("format"))
+	}
+
+	file, err := h.deviceFile(book, device)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book files")
+		return models.BookFile{}, false
+	}
+	return file, true
+}
+
+// deviceFile picks the book file that suits device: the first in its
+// preferred format within its size limit, else the main file or another
+// edition within the limit. When none fits, a CBZ is picked for a device
+// with a screen size, since scaling shrinks it, and otherwise the smallest
+// file.
+func (h *Handler) deviceFile(book *models.Book, device *models.Device) (models.BookFile, error) {
+	editions, err := h.db.GetBookFiles(book.ID)
+	if err != nil {
+		return models.BookFile{}, err
+	}
+
+	// The preferred format goes first; otherwise the main file leads
+	files := append([]models.BookFile{primaryFile(book)}, editions...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].FileFormat == device.PreferredFormat && files[j].FileFormat != device.PreferredFormat
+	})
+
+	for _, f := range files {
+		if device.MaxFileSize == 0 || f.FileSize <= device.MaxFileSize {
+			return f, nil
+		}
+	}
+
+	smallest := files[0]
+	for _, f := range files {
+		if scalesComic(device, f) {
+			return f, nil
+		}
+		if f.FileSize < smallest.FileSize {
+			smallest = f
+		}
+	}
+	return smallest, nil
+}
+
+// scalesComic reports whether file is a CBZ whose pages are scaled to fit
+// device's screen when sent to it
+func scalesComic(device *models.Device, file models.BookFile) bool {
+	return device != nil && file.FileFormat == models.FileFormatCBZ &&
+		(device.ScreenWidth > 0 || device.ScreenHeight > 0)
+}
+
+// serveBookFileForDevice sends file as a download named after the book,
+// with comic pages scaled to fit device's screen
+func serveBookFileForDevice(c *gin.Context, book *models.Book, file models.BookFile, device *models.Device) {
+	if !scalesComic(device, file) {
+		serveBookFile(c, book, file)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=\""+bookFileName(book)+"."+file.FileFormat+"\"")
+	c.Header("Content-Type", opds.GetMIMEType(file.FileFormat))
+	c.Status(http.StatusOK)
+
+	if err := cbz.WriteDownscaled(c.Writer, file.FilePath, device.ScreenWidth, device.ScreenHeight); err != nil {
+		log.Printf("Warning: scaling %s for device %s failed: %v", file.FilePath, device.ID, err)
+		// Nothing is written until the archive opens, so this can still
+		// be reported
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read book file")
+		}
+	}
+}
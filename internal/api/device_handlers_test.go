@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestDevices(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	otherID := createNamedUser(t, handler, "other")
+
+	// An EPUB with MOBI and PDF editions; each file holds its format name
+	save := func(format string) string {
+		path, err := handler.files.SaveBookWithExt("book-"+format, strings.NewReader(format), "."+format)
+		require.NoError(t, err)
+		return path
+	}
+	require.NoError(t, handler.db.CreateBook(&models.Book{
+		ID: "book", UserID: ownerID, Title: "Dune", Author: "Frank Herbert", FilePath: save("epub"),
+		FileFormat: models.FileFormatEPUB, FileSize: 500, UploadedAt: time.Now(),
+	}))
+	for _, f := range []struct {
+		format string
+		size   int64
+	}{{models.FileFormatMOBI, 300}, {models.FileFormatPDF, 2000}} {
+		require.NoError(t, handler.db.CreateBookFile(&models.BookFile{
+			ID: "file-" + f.format, BookID: "book", FileFormat: f.format, FilePath: save(f.format),
+			FileSize: f.size, CreatedAt: time.Now(),
+		}))
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.POST("/devices", handler.RegisterDevice)
+	r.PUT("/devices/:id", handler.UpdateDevice)
+	r.POST("/devices/:id/token", handler.ResetDeviceToken)
+	r.GET("/devices", handler.ListDevices)
+	r.GET("/books/:id/file", handler.GetBookFile)
+	r.GET("/opds/v1.2/books/all.xml", handler.OPDSAllBooks)
+	do := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	register := func(body string) (models.Device, string) {
+		w := do(http.MethodPost, "/devices", ownerID, body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			Device models.Device `json:"device"`
+			Token  string        `json:"token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.Token)
+		return resp.Device, resp.Token
+	}
+	download := func(query string) string {
+		w := do(http.MethodGet, "/books/book/file"+query, ownerID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		body, _ := io.ReadAll(w.Body)
+		return string(body)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/devices", ownerID, `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/devices", ownerID, `{"name":"Kindle","preferred_format":"azw"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/devices", ownerID, `{"name":"Kindle","max_file_size":-1}`).Code)
+
+	kindle, token := register(`{"name":" Kindle ","preferred_format":"MOBI"}`)
+	assert.Equal(t, "Kindle", kindle.Name)
+	assert.Equal(t, models.FileFormatMOBI, kindle.PreferredFormat)
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/devices/"+kindle.ID, otherID, `{"name":"Mine"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/devices/missing", ownerID, `{"name":"Mine"}`).Code)
+
+	// The device's preferred format is served, unless another is asked for
+	assert.Equal(t, "epub", download(""))
+	assert.Equal(t, "mobi", download("?device="+token))
+	assert.Equal(t, "pdf", download("?device="+token+"&format=pdf"))
+	req := httptest.NewRequest(http.MethodGet, "/books/book/file", nil)
+	req.Header.Set("X-Test-User", ownerID)
+	req.Header.Set(deviceTokenHeader, token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "mobi", w.Body.String())
+
+	// A file over the size limit gives way to the main file, and when
+	// nothing fits the smallest is sent
+	w = do(http.MethodPut, "/devices/"+kindle.ID, ownerID, `{"preferred_format":"pdf","max_file_size":1000}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "epub", download("?device="+token))
+	do(http.MethodPut, "/devices/"+kindle.ID, ownerID, `{"max_file_size":100}`)
+	assert.Equal(t, "mobi", download("?device="+token))
+
+	// Feed links keep the token
+	w = do(http.MethodGet, "/opds/v1.2/books/all.xml?device="+token, ownerID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/opds/v1.2/books/book/download?device="+token)
+	assert.Contains(t, w.Body.String(), "/opds/v1.2/books/book/download?format=pdf&amp;device="+token)
+
+	// A reset token replaces the old one, which is then ignored
+	w = do(http.MethodPost, "/devices/"+kindle.ID+"/token", ownerID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "epub", download("?device="+token))
+
+	w = do(http.MethodGet, "/devices", ownerID, "")
+	var list struct {
+		Devices []models.Device `json:"devices"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Devices, 1)
+	assert.NotNil(t, list.Devices[0].LastUsedAt)
+	assert.JSONEq(t, `{"devices":[],"count":0}`, do(http.MethodGet, "/devices", otherID, "").Body.String())
+}
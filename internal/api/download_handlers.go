@@ -0,0 +1,142 @@
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Batch Download Handlers ====================
+
+// DownloadCollection streams a ZIP of the files of every book in a
+// collection the caller can read
+func (h *Handler) DownloadCollection(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	collection, books, err := h.collections.Get(c.Param("id"), userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch collection")
+		return
+	}
+
+	h.streamBookFiles(c, collection.Name, books, false)
+}
+
+// DownloadReadingList streams a ZIP of the files of the books in one of the
+// current user's reading lists. Files are numbered in list order so an
+// e-reader sorting by name keeps it.
+func (h *Handler) DownloadReadingList(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	list, err := h.db.GetReadingList(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
+		return
+	}
+	if list.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+
+	books, err := h.db.GetBooksInReadingList(list.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	h.streamBookFiles(c, list.Name, books, true)
+}
+
+// batchFile is a book file in a batch download
+type batchFile struct {
+	name  string
+	file  models.BookFile
+	scale bool // Pages scaled to the device's screen
+}
+
+// streamBookFiles sends the files of books as a ZIP named after name. Books
+// the caller can't read, physical books, and missing files are left out.
+// With numbered set, file names start with the book's position. When the
+// request names a device, each book is sent in the form that suits it.
+func (h *Handler) streamBookFiles(c *gin.Context, name string, books []models.Book, numbered bool) {
+	userID := auth.GetUserID(c)
+	device := h.requestDevice(c)
+
+	// Files are checked before the response starts, so having nothing to
+	// send can still be reported as an error
+	var files []batchFile
+	used := map[string]bool{}
+	for _, b := range books {
+		book, err := h.db.GetBook(b.ID)
+		if err != nil || !h.policy.CanRead(book, userID) || book.IsPhysical() {
+			continue
+		}
+		file := primaryFile(book)
+		if device != nil {
+			if file, err = h.deviceFile(book, device); err != nil {
+				log.Printf("Warning: skipping book %s in download of %q: %v", book.ID, name, err)
+				continue
+			}
+		}
+		if _, err := os.Stat(file.FilePath); err != nil {
+			log.Printf("Warning: skipping %s in download of %q: %v", file.FilePath, name, err)
+			continue
+		}
+
+		base := bookFileName(book)
+		if numbered {
+			base = fmt.Sprintf("%03d - %s", len(files)+1, base)
+		}
+		filename := base + "." + file.FileFormat
+		for i := 2; used[filename]; i++ {
+			filename = fmt.Sprintf("%s (%d).%s", base, i, file.FileFormat)
+		}
+		used[filename] = true
+		files = append(files, batchFile{filename, file, scalesComic(device, file)})
+	}
+	if len(files) == 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeFileNotFound, "No downloadable book files")
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", safeFileName(name, "books")+".zip"))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	for _, f := range files {
+		var err error
+		if f.scale {
+			var w io.Writer
+			if w, err = zw.Create(f.name); err == nil {
+				err = cbz.WriteDownscaled(w, f.file.FilePath, device.ScreenWidth, device.ScreenHeight)
+			}
+		} else {
+			err = copyFileToZip(zw, f.name, f.file.FilePath)
+		}
+		if err != nil {
+			log.Printf("Warning: download of %q failed: %v", name, err)
+			return
+		}
+	}
+}
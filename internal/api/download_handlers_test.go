@@ -0,0 +1,100 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestBatchDownload(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	otherID := createNamedUser(t, handler, "other")
+
+	addBook := func(id, userID, title, author string, withFile bool) {
+		path := "/missing/" + id + ".epub"
+		if withFile {
+			var err error
+			path, err = handler.files.SaveBookWithExt(id, strings.NewReader(id), ".epub")
+			require.NoError(t, err)
+		}
+		require.NoError(t, handler.db.CreateBook(&models.Book{
+			ID: id, UserID: userID, Title: title, Author: author, FilePath: path,
+			FileFormat: models.FileFormatEPUB, UploadedAt: time.Now(),
+		}))
+	}
+	addBook("b1", ownerID, "Dune: Messiah", "Frank Herbert", true)
+	addBook("b2", ownerID, "Dune: Messiah", "Frank Herbert", true)
+	addBook("b3", ownerID, "Lost", "Nobody", false)
+	addBook("b4", otherID, "Private", "Someone", true)
+
+	list := &models.ReadingList{ID: "list", UserID: ownerID, Name: "Trip: Summer", ListType: "custom", CreatedAt: time.Now()}
+	require.NoError(t, handler.db.CreateReadingList(list))
+	for _, id := range []string{"b2", "b3", "b4", "b1"} {
+		require.NoError(t, handler.db.AddBookToReadingList(id, list.ID))
+	}
+	collection := &models.Collection{ID: "coll", UserID: ownerID, Name: "Sci-Fi", CreatedAt: time.Now()}
+	require.NoError(t, handler.db.CreateCollection(collection))
+	require.NoError(t, handler.db.BulkAddBooksToCollection([]string{"b1", "b2", "b4"}, collection.ID))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.GET("/collections/:id/download", handler.DownloadCollection)
+	r.GET("/reading-lists/:id/download", handler.DownloadReadingList)
+	download := func(path, userID string) (*httptest.ResponseRecorder, []string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Test-User", userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			return w, nil
+		}
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		return w, names
+	}
+
+	// Files are numbered in list order, leaving out missing files and books
+	// the caller can't read
+	w, names := download("/reading-lists/list/download", ownerID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `attachment; filename="Trip- Summer.zip"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, []string{
+		"001 - Frank Herbert - Dune- Messiah.epub",
+		"002 - Frank Herbert - Dune- Messiah.epub",
+	}, names)
+
+	w, _ = download("/reading-lists/list/download", otherID)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, names = download("/collections/coll/download", ownerID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{
+		"Frank Herbert - Dune- Messiah (2).epub",
+		"Frank Herbert - Dune- Messiah.epub",
+	}, names)
+
+	require.NoError(t, handler.db.RemoveBookFromCollection("b1", collection.ID))
+	require.NoError(t, handler.db.RemoveBookFromCollection("b2", collection.ID))
+	w, _ = download("/collections/coll/download", ownerID)
+	assert.Equal(t, http.StatusNotFound, w.Code, "nothing the caller can read is left")
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/opds"
+)
+
+// ==================== Edition Handlers ====================
+
+// primaryFile describes a book's main file in the same form as its extra
+// editions. It has the book's ID.
+func primaryFile(book *models.Book) models.BookFile {
+	return models.BookFile{
+		ID:         book.ID,
+		BookID:     book.ID,
+		FileFormat: book.FileFormat,
+		FilePath:   book.FilePath,
+		FileSize:   book.FileSize,
+		FileHash:   book.FileHash,
+		Primary:    true,
+		CreatedAt:  book.UploadedAt,
+	}
+}
+
+// ListBookFiles returns a book's main file followed by its extra editions
+func (h *Handler) ListBookFiles(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	editions, err := h.db.GetBookFiles(book.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book files")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files": append([]models.BookFile{primaryFile(book)}, editions...),
+	})
+}
+
+// AddBookFile attaches another format of the same book, such as a PDF or
+// MOBI alongside its EPUB
+func (h *Handler) AddBookFile(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		apierror.Invalid(c, "file", "No file provided")
+		return
+	}
+	defer file.Close()
+
+	if !h.allowUploadSize(c, header.Filename, header.Size) {
+		return
+	}
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	edition, err := h.importer.AddEdition(c.Request.Context(), book, file, header.Filename, header.Size)
+	if err != nil {
+		var invalid *books.InvalidFileError
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			requestEnded(c, err)
+		case errors.Is(err, books.ErrUnsupportedFormat):
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeUnsupportedFormat, "Unsupported file format. Please upload EPUB, PDF, CBZ, CBR, or MOBI files.")
+		case errors.Is(err, books.ErrEditionExists):
+			apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "Book already has a file in this format")
+		case errors.As(err, &invalid):
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, invalid.Message)
+		default:
+			log.Printf("Adding edition to book %s failed: %v", book.ID, err)
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save book file")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Book file added",
+		"file":    edition,
+	})
+}
+
+// GetBookEdition downloads one of a book's files by ID. The book's own ID
+// names its main file.
+func (h *Handler) GetBookEdition(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	file, ok := h.bookFileByID(c, book, c.Param("fileId"))
+	if !ok {
+		return
+	}
+	serveBookFile(c, book, file)
+}
+
+// DeleteBookFile removes one of a book's extra editions. The main file
+// can't be removed this way.
+func (h *Handler) DeleteBookFile(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+	if c.Param("fileId") == book.ID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "The main file can only be replaced, or removed by deleting the book")
+		return
+	}
+
+	file, ok := h.bookFileByID(c, book, c.Param("fileId"))
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteBookFile(file.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete book file")
+		return
+	}
+	if err := h.files.DeleteFile(file.FilePath); err != nil {
+		log.Printf("Warning: failed to delete file %s: %v", file.FilePath, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Book file deleted",
+		"file":    file,
+	})
+}
+
+// bookFileByID returns the book's file with the given ID, writing a 404 if
+// the book has none
+func (h *Handler) bookFileByID(c *gin.Context, book *models.Book, fileID string) (models.BookFile, bool) {
+	if fileID == book.ID {
+		return primaryFile(book), true
+	}
+	file, err := h.db.GetBookFile(fileID)
+	if err == sql.ErrNoRows || (err == nil && file.BookID != book.ID) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeFileNotFound, "Book file not found")
+		return models.BookFile{}, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book file")
+		return models.BookFile{}, false
+	}
+	return *file, true
+}
+
+// bookFileForFormat returns the book's file in format, or its main file
+// when format is empty, writing a 404 if the book has no such file
+func (h *Handler) bookFileForFormat(c *gin.Context, book *models.Book, format string) (models.BookFile, bool) {
+	format = strings.ToLower(format)
+	if format == "" || format == book.FileFormat {
+		return primaryFile(book), true
+	}
+	editions, err := h.db.GetBookFiles(book.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book files")
+		return models.BookFile{}, false
+	}
+	for _, f := range editions {
+		if f.FileFormat == format {
+			return f, true
+		}
+	}
+	apierror.Respond(c, http.StatusNotFound, apierror.CodeFileNotFound, "Book has no "+strings.ToUpper(format)+" file")
+	return models.BookFile{}, false
+}
+
+// serveBookFile sends file as a download named after the book
+func serveBookFile(c *gin.Context, book *models.Book, file models.BookFile) {
+	c.Header("Content-Disposition", "attachment; filename=\""+bookFileName(book)+"."+file.FileFormat+"\"")
+	c.Header("Content-Type", opds.GetMIMEType(file.FileFormat))
+	c.File(file.FilePath)
+}
+
+// maxBookFileNameLength leaves room for an extension and a numbering prefix
+// within the 255 characters file systems allow
+const maxBookFileNameLength = 200
+
+// bookFileName names a book's downloaded file "Author - Title", without the
+// extension
+func bookFileName(book *models.Book) string {
+	name := book.Title
+	if book.Author != "" {
+		name = book.Author + " - " + name
+	}
+	return safeFileName(name, book.ID)
+}
+
+// safeFileName replaces the characters that aren't allowed in file names on
+// FAT-formatted e-readers and shortens long names. Names left empty become
+// fallback.
+func safeFileName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > maxBookFileNameLength {
+		name = string(runes[:maxBookFileNameLength])
+	}
+	name = strings.TrimRight(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// bookEditions returns the extra editions of books keyed by book ID. A
+// failure is logged and treated as no editions, so feeds still list the
+// main files.
+func (h *Handler) bookEditions(list []models.Book) map[string][]models.BookFile {
+	ids := make([]string, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	editions, err := h.db.GetBookFilesForBooks(ids)
+	if err != nil {
+		log.Printf("Warning: failed to fetch book editions: %v", err)
+		return nil
+	}
+	return editions
+}
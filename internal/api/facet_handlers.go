@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/locale"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Facet Handlers ====================
+
+// facetTopTags is how many tags GetBookFacets counts
+const facetTopTags = 10
+
+// bookFilters are the filters of GET /api/books that facets respect
+type bookFilters struct {
+	contentType, readStatus, language string
+}
+
+// matches reports whether a book passes the filters, other than the one
+// named by skip
+func (f bookFilters) matches(b *models.Book, skip string) bool {
+	switch {
+	case skip != "type" && f.contentType != "" && b.ContentType != f.contentType:
+		return false
+	case skip != "status" && f.readStatus != "" && b.ReadStatus != f.readStatus:
+		return false
+	case skip != "language" && f.language != "" && locale.Normalize(b.Language) != f.language:
+		return false
+	}
+	return true
+}
+
+// GetBookFacets counts the current user's books by format, content type,
+// read status, language, rating and tag, for a filter sidebar. It takes the
+// filters of GET /api/books: formats, ratings and tags are counted over the
+// books those filters list, while each of content type, read status and
+// language is counted ignoring its own filter, so the sidebar can show
+// what choosing another value would give.
+func (h *Handler) GetBookFacets(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	filters := bookFilters{
+		contentType: c.Query("type"),
+		readStatus:  c.Query("status"),
+		language:    c.Query("language"),
+	}
+	if filters.language != "" {
+		filters.language = locale.Normalize(filters.language)
+	}
+
+	result, err := h.books.List(books.ListOptions{UserID: userID, Search: c.Query("search"), SortBy: "date"})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	facets := &models.BookFacets{
+		Formats:      map[string]int{},
+		ContentTypes: map[string]int{},
+		ReadStatuses: map[string]int{},
+		Languages:    map[string]int{},
+		Ratings:      map[int]int{},
+		Tags:         []models.TagFacet{},
+	}
+	var inView []string
+	for i := range result.Books {
+		b := &result.Books[i]
+		if filters.matches(b, "type") {
+			facets.ContentTypes[b.ContentType]++
+		}
+		if filters.matches(b, "status") {
+			facets.ReadStatuses[b.ReadStatus]++
+		}
+		if filters.matches(b, "language") {
+			facets.Languages[locale.Normalize(b.Language)]++
+		}
+		if filters.matches(b, "") {
+			facets.Formats[b.FileFormat]++
+			inView = append(inView, b.ID)
+		}
+	}
+	facets.Total = len(inView)
+
+	ratings, err := h.db.GetBookRatings(userID, inView)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch ratings")
+		return
+	}
+	for _, id := range inView {
+		facets.Ratings[ratings[id]]++
+	}
+
+	if userID != "" {
+		if facets.Tags, err = h.tagFacets(userID, inView); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, facets)
+}
+
+// tagFacets counts the user's tags on the given books, returning the
+// facetTopTags most used
+func (h *Handler) tagFacets(userID string, bookIDs []string) ([]models.TagFacet, error) {
+	tagged, err := h.db.GetBookTagIDs(userID, bookIDs)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, tagIDs := range tagged {
+		for _, id := range tagIDs {
+			counts[id]++
+		}
+	}
+
+	tags, err := h.db.ListTags(userID)
+	if err != nil {
+		return nil, err
+	}
+	facets := []models.TagFacet{}
+	for _, tag := range tags {
+		if n := counts[tag.ID]; n > 0 {
+			facets = append(facets, models.TagFacet{ID: tag.ID, Name: tag.Name, Color: tag.Color, Count: n})
+		}
+	}
+	sort.SliceStable(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Name < facets[j].Name
+	})
+	if len(facets) > facetTopTags {
+		facets = facets[:facetTopTags]
+	}
+	return facets, nil
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestGetBookFacets(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	userID := setupTestUser(t, handler)
+
+	add := func(title, contentType, format, lang string) string {
+		book := &models.Book{
+			ID: uuid.New().String(), UserID: userID, Title: title, FilePath: "/tmp/" + title,
+			UploadedAt: time.Now(), ContentType: contentType, FileFormat: format, Language: lang,
+		}
+		require.NoError(t, handler.db.CreateBook(book))
+		return book.ID
+	}
+	dune := add("Dune", models.ContentTypeBook, models.FileFormatEPUB, "en")
+	emma := add("Emma", models.ContentTypeBook, models.FileFormatPDF, "en-GB")
+	saga := add("Saga", models.ContentTypeComic, models.FileFormatCBZ, "")
+	require.NoError(t, handler.db.UpdateBookReadStatus(userID, dune, models.ReadStatusCompleted, nil))
+	require.NoError(t, handler.db.UpdateBookRating(userID, dune, 5))
+	require.NoError(t, handler.db.UpdateBookRating(userID, saga, 3))
+	for _, name := range []string{"classic", "space"} {
+		tag := &models.Tag{ID: uuid.New().String(), UserID: userID, Name: name, Color: "#3b82f6"}
+		require.NoError(t, handler.db.CreateTag(tag))
+		require.NoError(t, handler.db.AddTagToBook(emma, tag.ID))
+		if name == "space" {
+			require.NoError(t, handler.db.AddTagToBook(dune, tag.ID))
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/books/facets", handler.GetBookFacets)
+	get := func(query string) models.BookFacets {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/books/facets"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var facets models.BookFacets
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &facets))
+		return facets
+	}
+
+	facets := get("")
+	assert.Equal(t, 3, facets.Total)
+	assert.Equal(t, map[string]int{"epub": 1, "pdf": 1, "cbz": 1}, facets.Formats)
+	assert.Equal(t, map[string]int{"book": 2, "comic": 1}, facets.ContentTypes)
+	assert.Equal(t, map[string]int{"unread": 2, "completed": 1}, facets.ReadStatuses)
+	assert.Equal(t, map[string]int{"en": 2, "": 1}, facets.Languages)
+	assert.Equal(t, map[int]int{0: 1, 3: 1, 5: 1}, facets.Ratings)
+	require.Len(t, facets.Tags, 2)
+	assert.Equal(t, "space", facets.Tags[0].Name, "the most used tag first")
+	assert.Equal(t, 2, facets.Tags[0].Count)
+
+	// A filter narrows the other facets but not its own
+	facets = get("?type=book")
+	assert.Equal(t, 2, facets.Total)
+	assert.Equal(t, map[string]int{"book": 2, "comic": 1}, facets.ContentTypes)
+	assert.Equal(t, map[string]int{"epub": 1, "pdf": 1}, facets.Formats)
+	assert.Equal(t, map[string]int{"en": 2}, facets.Languages)
+	assert.Equal(t, map[int]int{0: 1, 5: 1}, facets.Ratings)
+
+	facets = get("?status=completed&language=en")
+	assert.Equal(t, 1, facets.Total)
+	assert.Equal(t, map[string]int{"unread": 1, "completed": 1}, facets.ReadStatuses)
+	require.Len(t, facets.Tags, 1)
+	assert.Equal(t, "space", facets.Tags[0].Name)
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Follow Handlers ====================
+
+// StartReleaseChecker starts the periodic new-release check for follows
+func (h *Handler) StartReleaseChecker(ctx context.Context, interval time.Duration) {
+	h.releases.Start(ctx, interval)
+}
+
+// ListFollows returns the authors and series the user follows
+func (h *Handler) ListFollows(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	follows, err := h.db.ListFollows(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch follows")
+		return
+	}
+
+	if follows == nil {
+		follows = []*models.Follow{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"follows": follows,
+		"count":   len(follows),
+	})
+}
+
+// CreateFollow follows an author or series
+func (h *Handler) CreateFollow(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Type string `json:"type" binding:"required"`
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Type and name are required")
+		return
+	}
+
+	if req.Type != models.FollowTypeAuthor && req.Type != models.FollowTypeSeries {
+		apierror.Invalid(c, "type", "Invalid type. Must be author or series")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Invalid(c, "name", "Name cannot be empty")
+		return
+	}
+
+	// Check if already following
+	existing, _ := h.db.GetFollowByName(userID, req.Type, req.Name)
+	if existing != nil {
+		apierror.RespondWith(c, http.StatusConflict, apierror.CodeAlreadyExists, "Already following", gin.H{"follow": existing})
+		return
+	}
+
+	follow := &models.Follow{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		FollowType: req.Type,
+		Name:       req.Name,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := h.db.CreateFollow(follow); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create follow")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Now following " + follow.Name,
+		"follow":  follow,
+	})
+}
+
+// DeleteFollow unfollows an author or series
+func (h *Handler) DeleteFollow(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	follow, ok := h.getOwnedFollow(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteFollow(follow.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete follow")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed " + follow.Name})
+}
+
+// CheckFollow immediately checks a follow for new releases
+func (h *Handler) CheckFollow(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	follow, ok := h.getOwnedFollow(c, userID)
+	if !ok {
+		return
+	}
+
+	updates, err := h.releases.CheckFollow(c.Request.Context(), follow)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeUpstreamFailed, "Failed to check for new releases: "+err.Error())
+		return
+	}
+
+	if updates == nil {
+		updates = []*models.FollowUpdate{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"follow":  follow,
+		"updates": updates,
+		"count":   len(updates),
+	})
+}
+
+// GetFollowUpdates returns new releases for everything the user follows
+func (h *Handler) GetFollowUpdates(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	unseenOnly := c.Query("unseen") == "true"
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	updates, err := h.db.ListFollowUpdates(userID, unseenOnly, limit)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch updates")
+		return
+	}
+
+	if updates == nil {
+		updates = []*models.FollowUpdate{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"updates": updates,
+		"count":   len(updates),
+	})
+}
+
+// MarkFollowUpdatesSeen marks updates as seen (all of them if no IDs given)
+func (h *Handler) MarkFollowUpdatesSeen(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		UpdateIDs []string `json:"update_ids"`
+	}
+
+	// Body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request")
+			return
+		}
+	}
+
+	if err := h.db.MarkFollowUpdatesSeen(userID, req.UpdateIDs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Updates marked as seen"})
+}
+
+// getOwnedFollow loads the follow from the :id param and verifies ownership.
+// Writes the error response and returns false if the follow can't be used.
+func (h *Handler) getOwnedFollow(c *gin.Context, userID string) (*models.Follow, bool) {
+	follow, err := h.db.GetFollow(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeFollowNotFound, "Follow not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch follow")
+		return nil, false
+	}
+
+	// Verify ownership
+	if follow.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return nil, false
+	}
+
+	return follow, true
+}
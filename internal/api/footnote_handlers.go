@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Footnote Handlers ====================
+
+// GetFootnote resolves an intra-book link, such as a footnote reference, to
+// the content it points at so the reader can show it in a popup, along with
+// the links back to where it's referenced
+func (h *Handler) GetFootnote(c *gin.Context) {
+	chapter, err := strconv.Atoi(c.Param("chapter"))
+	if err != nil {
+		apierror.Invalid(c, "chapter", "Invalid chapter number")
+		return
+	}
+	id := c.Query("id")
+	if id == "" {
+		apierror.Invalid(c, "id", "id is required")
+		return
+	}
+
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+	if book.FileFormat != models.FileFormatEPUB {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Book is not an EPUB")
+		return
+	}
+
+	// The note only changes with the file
+	etag := fileETag(book.FilePath)
+	if etag != "" {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+
+	// Finding the backlinks parses every chapter
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	note, err := epub.ResolveNote(book.FilePath, chapter, id, epub.SanitizeOptions{
+		ResourceURL: h.basePath + "/api/books/" + book.ID + "/resource/",
+		ChapterURL:  h.basePath + "/api/books/" + book.ID + "/content/",
+	})
+	release()
+	if errors.Is(err, epub.ErrLinkTargetNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeLinkTargetNotFound, "Link target not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to resolve link")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":   book.ID,
+		"chapter":   note.Chapter,
+		"id":        note.ID,
+		"kind":      note.Kind,
+		"html":      note.HTML,
+		"text":      note.Text,
+		"backlinks": note.Backlinks,
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/epub"
+)
+
+func TestGetFootnote(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	book := createTestEPUBBook(t, handler, userID,
+		`<p>Call me Ishmael.<a epub:type="noteref" id="ref1" href="ch2.xhtml#fn1">1</a></p>`,
+		`<aside epub:type="footnote" id="fn1"><p>A <em>biblical</em> name.</p></aside>`)
+
+	get := func(chapter, query, ifNoneMatch string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: book.ID}, {Key: "chapter", Value: chapter}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/footnotes/"+chapter+query, nil)
+		c.Request.Header.Set("If-None-Match", ifNoneMatch)
+		handler.GetFootnote(c)
+		return w
+	}
+
+	w := get("1", "?id=fn1", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Chapter   int             `json:"chapter"`
+		ID        string          `json:"id"`
+		Kind      string          `json:"kind"`
+		Text      string          `json:"text"`
+		Backlinks []epub.NoteLink `json:"backlinks"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Chapter)
+	assert.Equal(t, "fn1", resp.ID)
+	assert.Equal(t, epub.NoteKindFootnote, resp.Kind)
+	assert.Equal(t, "A biblical name.", resp.Text)
+	assert.Equal(t, []epub.NoteLink{{Chapter: 0, ID: "ref1", Href: "/api/books/" + book.ID + "/content/0#ref1"}}, resp.Backlinks)
+
+	assert.Equal(t, http.StatusNotModified, get("1", "?id=fn1", w.Header().Get("ETag")).Code)
+	assert.Equal(t, http.StatusNotFound, get("1", "?id=missing", "").Code)
+	assert.Equal(t, http.StatusNotFound, get("7", "?id=fn1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, get("1", "", "").Code, "id is required")
+	assert.Equal(t, http.StatusBadRequest, get("x", "?id=fn1", "").Code)
+}
@@ -3,10 +3,13 @@ package api
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -14,13 +17,26 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/justyntemme/webby/internal/achievements"
+	"github.com/justyntemme/webby/internal/annotations"
+	"github.com/justyntemme/webby/internal/apierror"
 	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/books"
 	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/collections"
 	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/follows"
+	"github.com/justyntemme/webby/internal/jobs"
 	"github.com/justyntemme/webby/internal/metadata"
 	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/notify"
+	"github.com/justyntemme/webby/internal/opds"
 	"github.com/justyntemme/webby/internal/pdf"
+	"github.com/justyntemme/webby/internal/positions"
 	"github.com/justyntemme/webby/internal/storage"
+	"github.com/justyntemme/webby/internal/tracker"
+	"github.com/justyntemme/webby/internal/workpool"
 )
 
 // Handler contains all HTTP handlers
@@ -30,6 +46,44 @@ type Handler struct {
 	metadata      *metadata.Service
 	comicMetadata *metadata.ComicService
 	duplicates    *storage.DuplicateService
+	notifier      *notify.Service
+	trackers      *tracker.Service
+	releases      *follows.Checker
+	books         *books.Service
+	importer      *books.Importer
+	collections   *collections.Service
+	annotations   *annotations.Service
+	positions     *positions.Service
+	jobs          *jobs.Queue
+	achievements  *achievements.Engine
+	policy        *authz.Policy
+	remoteOPDS    *opds.Client
+	routes        gin.RoutesInfo
+
+	// Visibility of new uploads by users who haven't picked their own
+	defaultVisibility string
+	// Gap between reading session heartbeats counted as idle
+	sessionIdleTimeout time.Duration
+	// Largest book file accepted, overall and by extension
+	maxUploadSize     int64
+	formatUploadSizes map[string]int64
+	// Disk space an upload must leave free
+	minFreeSpace int64
+	// How long requests may run, overall and by route
+	requestTimeout time.Duration
+	routeTimeouts  map[string]time.Duration
+	// Bounds CPU-heavy work such as parsing uploads
+	workers *workpool.Pool
+	// How much of a book its sample keeps, in percent
+	samplePercent int
+	// Path prefix the server is mounted at, like "/webby", or ""
+	basePath string
+	// The running binary's version, for GetVersion
+	build BuildInfo
+	// Usernames that may manage any user's books
+	admins map[string]bool
+	// Wrong PINs for leaving a restricted profile
+	profilePINs *pinLimiter
 }
 
 // NewHandler creates a new handler instance
@@ -45,392 +99,327 @@ func NewHandler(db *storage.Database, files *storage.FileStorage) *Handler {
 	// Initialize duplicate detection service
 	duplicateService := storage.NewDuplicateService(db, files)
 
-	return &Handler{
+	// Initialize notification service with all built-in channels
+	notifier := notify.NewDefaultService(db)
+
+	// Initialize new-release checker for followed authors and series
+	releaseChecker := follows.NewChecker(db, metadataService, comicMetadataService, notifier)
+
+	// Initialize library services the handlers delegate to
+	bookService := books.NewService(db, files)
+
+	// Files shared between books are only removed with the last of them
+	files.SetFileReferences(db)
+
+	h := &Handler{
 		db:            db,
 		files:         files,
 		metadata:      metadataService,
 		comicMetadata: comicMetadataService,
 		duplicates:    duplicateService,
+		notifier:      notifier,
+		trackers:      tracker.NewDefaultService(db),
+		releases:      releaseChecker,
+		books:         bookService,
+		importer:      books.NewImporter(db, files),
+		collections:   collections.NewService(db),
+		annotations:   annotations.NewService(db, bookService),
+		positions:     positions.NewService(db),
+		jobs:          jobs.NewQueue(db),
+		achievements:  achievements.NewEngine(db, notifier),
+		policy:        authz.NewPolicy(db),
+		remoteOPDS:    opds.NewClient(false),
+		workers:       workpool.New(runtime.NumCPU(), DefaultWorkerQueue),
+		profilePINs:   newPINLimiter(),
+
+		defaultVisibility:  models.BookVisibilityPrivate,
+		sessionIdleTimeout: DefaultSessionIdleTimeout,
+		maxUploadSize:      DefaultMaxUploadSize,
+		minFreeSpace:       DefaultMinFreeSpace,
+		samplePercent:      DefaultSamplePercent,
+	}
+	h.SetRequestTimeouts(DefaultRequestTimeout, DefaultUploadTimeout, nil)
+	h.jobs.Register(models.JobKindMetadataRefresh, h.refreshMetadataItem)
+	h.jobs.Register(models.JobKindCoverOptimize, h.optimizeCoverItem)
+	h.jobs.RegisterConcurrent(models.JobKindHashCompute, h.hashBookItem, hashWorkers)
+	h.jobs.RegisterConcurrent(models.JobKindFileVerify, h.verifyFileItem, hashWorkers)
+	h.jobs.Register(models.JobKindMirrorSync, h.syncMirrorItem)
+	if err := h.loadComicFilenamePatterns(); err != nil {
+		log.Printf("Warning: failed to load comic filename patterns: %v", err)
+	}
+	return h
+}
+
+// Notifier returns the notification service, which also sends account email
+func (h *Handler) Notifier() *notify.Service {
+	return h.notifier
+}
+
+// SetAdmins sets the usernames that may manage any user's books
+func (h *Handler) SetAdmins(usernames []string) {
+	h.admins = make(map[string]bool, len(usernames))
+	for _, name := range usernames {
+		if name = strings.TrimSpace(name); name != "" {
+			h.admins[name] = true
+		}
 	}
 }
 
+// isAdmin reports whether userID belongs to one of the admin usernames
+func (h *Handler) isAdmin(userID string) bool {
+	if userID == "" || len(h.admins) == 0 {
+		return false
+	}
+	user, err := h.db.GetUserByID(userID)
+	return err == nil && h.admins[user.Username]
+}
+
 // UploadBook handles EPUB and PDF file uploads
 func (h *Handler) UploadBook(c *gin.Context) {
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		apierror.Invalid(c, "file", "No file provided")
 		return
 	}
 	defer file.Close()
 
-	// Check file size (max 100MB)
-	if header.Size > 100*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large (max 100MB)"})
-		return
-	}
-
-	// Detect file type from extension
-	filename := strings.ToLower(header.Filename)
-	var fileFormat string
-	var fileExt string
-
-	switch {
-	case strings.HasSuffix(filename, ".epub"):
-		fileFormat = models.FileFormatEPUB
-		fileExt = ".epub"
-	case strings.HasSuffix(filename, ".pdf"):
-		fileFormat = models.FileFormatPDF
-		fileExt = ".pdf"
-	case strings.HasSuffix(filename, ".cbz"):
-		fileFormat = models.FileFormatCBZ
-		fileExt = ".cbz"
-	case strings.HasSuffix(filename, ".cbr"):
-		fileFormat = models.FileFormatCBR
-		fileExt = ".cbr"
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported file format. Please upload EPUB, PDF, CBZ, or CBR files."})
+	if !h.allowUpload(c) || !h.allowUploadSize(c, header.Filename, header.Size) {
 		return
 	}
-
-	// Generate unique ID
-	bookID := uuid.New().String()
-
-	// Save file with appropriate extension
-	filePath, err := h.files.SaveBookWithExt(bookID, file, fileExt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	release, ok := h.acquireWorker(c)
+	if !ok {
 		return
 	}
+	defer release()
 
-	// Compute file hash for duplicate detection
-	fileHash, err := storage.HashFile(filePath)
-	if err != nil {
-		log.Printf("Warning: failed to compute hash for %s: %v", filePath, err)
-		fileHash = "" // Continue without hash
-	}
-
-	var book *models.Book
-	now := time.Now()
 	userID := auth.GetUserID(c)
-
-	if fileFormat == models.FileFormatEPUB {
-		// Validate EPUB
-		if err := epub.ValidateEPUB(filePath); err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid EPUB file"})
-			return
+	book, err := h.importer.Import(c.Request.Context(), file, header.Filename, header.Size, userID)
+	if err != nil {
+		var invalid *books.InvalidFileError
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			requestEnded(c, err)
+		case errors.Is(err, books.ErrUnsupportedFormat):
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeUnsupportedFormat, "Unsupported file format. Please upload EPUB, PDF, CBZ, or CBR files.")
+		case errors.As(err, &invalid):
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, invalid.Message)
+		default:
+			log.Printf("Upload failed: %v", err)
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save book")
 		}
+		return
+	}
 
-		// Parse EPUB metadata
-		meta, err := epub.ParseEPUB(filePath)
-		if err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse EPUB metadata"})
-			return
+	if userID != "" {
+		if err := h.applyVisibility(book, h.uploadVisibility(userID)); err != nil {
+			log.Printf("Warning: failed to set visibility of %s: %v", book.ID, err)
 		}
+	}
+	h.syncSubjectTags(book, userID)
+	h.recordActivity(userID, models.ActivityBookAdded, book.ID, 0)
 
-		// Save cover if present
-		var coverPath string
-		if len(meta.CoverData) > 0 {
-			coverPath, _ = h.files.SaveCover(bookID, meta.CoverData, meta.CoverExt)
-		}
-
-		contentType := meta.ContentType
-		if contentType == "" {
-			contentType = models.ContentTypeBook
-		}
-
-		book = &models.Book{
-			ID:              bookID,
-			UserID:          userID,
-			Title:           meta.Title,
-			Author:          meta.Author,
-			Series:          meta.Series,
-			SeriesIndex:     meta.SeriesIndex,
-			FilePath:        filePath,
-			CoverPath:       coverPath,
-			FileSize:        header.Size,
-			FileHash:        fileHash,
-			UploadedAt:      now,
-			ContentType:     contentType,
-			FileFormat:      models.FileFormatEPUB,
-			ISBN:            meta.ISBN,
-			Publisher:       meta.Publisher,
-			PublishDate:     meta.PublishDate,
-			Description:     meta.Description,
-			Language:        meta.Language,
-			Subjects:        strings.Join(meta.Subjects, ", "),
-			MetadataSource:  "epub",
-			MetadataUpdated: &now,
-		}
-	} else if fileFormat == models.FileFormatPDF {
-		// Validate PDF
-		if err := pdf.ValidatePDF(filePath); err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PDF file"})
-			return
-		}
+	h.notifier.Publish(notify.Event{
+		Type:    models.NotificationEventImportFinished,
+		UserID:  userID,
+		Title:   "Import finished",
+		Message: fmt.Sprintf("%q by %s is ready to read.", book.Title, book.Author),
+		BookID:  book.ID,
+	})
 
-		// Parse PDF metadata
-		meta, err := pdf.ParsePDF(filePath)
-		if err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse PDF metadata"})
-			return
-		}
+	response := gin.H{
+		"message": "Book uploaded successfully",
+		"book":    book,
+	}
 
-		// Try to extract cover image from first page
-		var coverPath string
-		if cover, err := pdf.ExtractCover(filePath); err == nil && len(cover.Data) > 0 {
-			coverPath, _ = h.files.SaveCover(bookID, cover.Data, cover.Extension)
-		}
-
-		contentType := meta.ContentType
-		if contentType == "" {
-			contentType = models.ContentTypeBook
-		}
-
-		book = &models.Book{
-			ID:              bookID,
-			UserID:          userID,
-			Title:           meta.Title,
-			Author:          meta.Author,
-			FilePath:        filePath,
-			CoverPath:       coverPath,
-			FileSize:        header.Size,
-			FileHash:        fileHash,
-			UploadedAt:      now,
-			ContentType:     contentType,
-			FileFormat:      models.FileFormatPDF,
-			Subjects:        strings.Join(meta.Keywords, ", "),
-			MetadataSource:  "pdf",
-			MetadataUpdated: &now,
-		}
-	} else if fileFormat == models.FileFormatCBZ {
-		// Validate CBZ
-		if err := cbz.ValidateCBZ(filePath); err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CBZ file"})
-			return
+	// Offer back what was lost if this file was deleted before
+	if book.FileHash != "" {
+		deleted, err := h.db.GetDeletedBookByHash(userID, book.FileHash)
+		if err == nil {
+			response["restorable"] = deleted
+		} else if err != sql.ErrNoRows {
+			log.Printf("Warning: failed to look up deleted copies of %s: %v", book.ID, err)
 		}
+	}
 
-		// Parse CBZ metadata
-		meta, err := cbz.ParseCBZ(filePath, header.Filename)
-		if err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse CBZ metadata"})
-			return
-		}
+	c.JSON(http.StatusCreated, response)
+}
 
-		// Extract cover image from first page
-		var coverPath string
-		if cover, err := cbz.ExtractCover(filePath); err == nil && len(cover.Data) > 0 {
-			coverPath, _ = h.files.SaveCover(bookID, cover.Data, cover.Extension)
-		}
-
-		book = &models.Book{
-			ID:              bookID,
-			UserID:          userID,
-			Title:           meta.Title,
-			Author:          meta.Author,
-			Series:          meta.Series,
-			SeriesIndex:     meta.SeriesIndex,
-			FilePath:        filePath,
-			CoverPath:       coverPath,
-			FileSize:        header.Size,
-			FileHash:        fileHash,
-			UploadedAt:      now,
-			ContentType:     models.ContentTypeComic, // CBZ is always comic
-			FileFormat:      models.FileFormatCBZ,
-			MetadataSource:  "cbz",
-			MetadataUpdated: &now,
-		}
-	} else if fileFormat == models.FileFormatCBR {
-		// Validate CBR
-		if err := cbz.ValidateCBR(filePath); err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CBR file"})
-			return
-		}
+// ReplaceBookFile swaps a book's file for a new upload, such as a retail
+// EPUB for a scanned PDF. The book keeps its ID, annotations, collections,
+// tags, and reading stats; metadata is re-parsed and reading positions are
+// moved to the same point in the new file.
+func (h *Handler) ReplaceBookFile(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
 
-		// Parse CBR metadata
-		meta, err := cbz.ParseCBR(filePath, header.Filename)
-		if err != nil {
-			h.files.DeleteBook(bookID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse CBR metadata"})
-			return
-		}
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		apierror.Invalid(c, "file", "No file provided")
+		return
+	}
+	defer file.Close()
 
-		// Extract cover image from first page
-		var coverPath string
-		if cover, err := cbz.ExtractCoverCBR(filePath); err == nil && len(cover.Data) > 0 {
-			coverPath, _ = h.files.SaveCover(bookID, cover.Data, cover.Extension)
-		}
+	if !h.allowUploadSize(c, header.Filename, header.Size) {
+		return
+	}
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	defer release()
 
-		book = &models.Book{
-			ID:              bookID,
-			UserID:          userID,
-			Title:           meta.Title,
-			Author:          meta.Author,
-			Series:          meta.Series,
-			SeriesIndex:     meta.SeriesIndex,
-			FilePath:        filePath,
-			CoverPath:       coverPath,
-			FileSize:        header.Size,
-			FileHash:        fileHash,
-			UploadedAt:      now,
-			ContentType:     models.ContentTypeComic, // CBR is always comic
-			FileFormat:      models.FileFormatCBR,
-			MetadataSource:  "cbr",
-			MetadataUpdated: &now,
+	updated, err := h.importer.Replace(c.Request.Context(), book, file, header.Filename, header.Size)
+	if err != nil {
+		var invalid *books.InvalidFileError
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			requestEnded(c, err)
+		case errors.Is(err, books.ErrUnsupportedFormat):
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeUnsupportedFormat, "Unsupported file format. Please upload EPUB, PDF, CBZ, or CBR files.")
+		case errors.As(err, &invalid):
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, invalid.Message)
+		default:
+			log.Printf("Replacing file of book %s failed: %v", book.ID, err)
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to replace book file")
 		}
+		return
 	}
 
-	if err := h.db.CreateBook(book); err != nil {
-		h.files.DeleteBook(bookID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save book metadata"})
-		return
+	// CFIs point into the old file; they're worked out again from the
+	// positions as moved and the highlighted text
+	if err := h.db.ClearBookCFIs(book.ID); err != nil {
+		log.Printf("Warning: failed to clear CFIs of book %s: %v", book.ID, err)
+	} else if _, err := h.positions.NormalizeBook(updated); err != nil {
+		log.Printf("Warning: failed to normalize positions in %s: %v", book.ID, err)
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Book uploaded successfully",
-		"book":    book,
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Book file replaced",
+		"book":    updated,
 	})
 }
 
 // ListBooks returns all books with optional sorting and pagination
 func (h *Handler) ListBooks(c *gin.Context) {
-	sortBy := c.DefaultQuery("sort", "title")
-	order := c.DefaultQuery("order", "asc")
-	search := c.Query("search")
-	contentType := c.Query("type")   // "book", "comic", or empty for all
-	readStatus := c.Query("status")  // "unread", "reading", "completed", or empty for all
-	userID := auth.GetUserID(c)
-
 	// Pagination
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "0")) // 0 = no limit
-	if page < 1 {
-		page = 1
-	}
-	if limit < 0 {
-		limit = 0
-	}
-
-	var books []models.Book
-	var err error
-
-	if search != "" {
-		books, err = h.db.SearchBooksForUser(search, userID)
-		// Filter by content type and read status if specified
-		if err == nil && (contentType != "" || readStatus != "") {
-			filtered := make([]models.Book, 0)
-			for _, b := range books {
-				if contentType != "" && b.ContentType != contentType {
-					continue
-				}
-				if readStatus != "" && b.ReadStatus != readStatus {
-					continue
-				}
-				filtered = append(filtered, b)
-			}
-			books = filtered
-		}
-	} else {
-		books, err = h.db.ListBooksForUserWithFilters(userID, sortBy, order, contentType, readStatus)
-	}
 
+	// Search results come best match first unless a sort is asked for
+	search := c.Query("search")
+	sortBy := c.Query("sort")
+	if sortBy == "" {
+		sortBy = "title"
+		if search != "" {
+			sortBy = "relevance"
+		}
+	}
+
+	result, err := h.books.List(books.ListOptions{
+		UserID:      auth.GetUserID(c),
+		Search:      search,
+		SortBy:      sortBy,
+		Order:       c.DefaultQuery("order", "asc"),
+		ContentType: c.Query("type"),   // "book", "comic", or empty for all
+		ReadStatus:  c.Query("status"), // "unread", "reading", "completed", or empty for all
+		Language:    c.Query("language"),
+		Page:        page,
+		Limit:       limit,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
 		return
 	}
 
-	if books == nil {
-		books = []models.Book{}
-	}
-
-	totalCount := len(books)
-
-	// Apply pagination if limit is set
-	if limit > 0 {
-		start := (page - 1) * limit
-		end := start + limit
-		if start > len(books) {
-			books = []models.Book{}
-		} else if end > len(books) {
-			books = books[start:]
-		} else {
-			books = books[start:end]
-		}
+	list := make([]*models.Book, len(result.Books))
+	for i := range result.Books {
+		list[i] = &result.Books[i]
 	}
+	h.setMinutesRemaining(auth.GetUserID(c), list...)
+	h.setCoverPalettes(list...)
+	h.setCustomFields(auth.GetUserID(c), list...)
 
 	c.JSON(http.StatusOK, gin.H{
-		"books": books,
-		"count": len(books),
-		"total": totalCount,
-		"page":  page,
-		"limit": limit,
+		"books": result.Books,
+		"count": len(result.Books),
+		"total": result.Total,
+		"page":  result.Page,
+		"limit": result.Limit,
 	})
 }
 
 // GetBook returns a single book by ID
 func (h *Handler) GetBook(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	var book *models.Book
-	var err error
-
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	authorized, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
+	book, err := h.books.WithUserState(authorized, auth.GetUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		respondServiceError(c, err, "Failed to fetch book")
 		return
 	}
+	book.PageCount = h.bookPageCount(book)
+	h.setMinutesRemaining(auth.GetUserID(c), book)
+	h.setCoverPalettes(book)
+	h.setCustomFields(auth.GetUserID(c), book)
 
 	c.JSON(http.StatusOK, book)
 }
 
 // DeleteBook removes a book from the library
 func (h *Handler) DeleteBook(c *gin.Context) {
-	id := c.Param("id")
+	book, err := h.books.Delete(c.Param("id"), auth.GetUserID(c))
+	if err != nil {
+		respondServiceError(c, err, "Failed to delete book")
+		return
+	}
 
-	book, err := h.db.GetBook(id)
+	c.JSON(http.StatusOK, gin.H{"message": "Book deleted", "book": book})
+}
+
+// RestoreBookData brings back the owner's annotations, notes, position,
+// read status, tags, lists, and collections from a deleted copy of the
+// same file, such as after an accidental delete and re-upload
+func (h *Handler) RestoreBookData(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.db.GetDeletedBookByHash(book.UserID, book.FileHash)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No deleted copy of this book to restore from")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up deleted copy")
 		return
 	}
 
-	// Delete file
-	h.files.DeleteBook(id)
-
-	// Delete from database
-	if err := h.db.DeleteBook(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
+	if err := h.db.RestoreDeletedBook(deleted, book.ID); err != nil {
+		log.Printf("Restoring %s onto book %s failed: %v", deleted.ID, book.ID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to restore reading data")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Book deleted", "book": book})
+	c.JSON(http.StatusOK, gin.H{"message": "Reading data restored", "restored": deleted})
 }
 
 // GetBooksByAuthor returns books grouped by author
 func (h *Handler) GetBooksByAuthor(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	grouped, err := h.db.GetBooksByAuthorForUser(userID)
+	if err == nil {
+		grouped, err = h.visibleGroups(userID, grouped)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
 		return
 	}
 
@@ -441,8 +430,11 @@ func (h *Handler) GetBooksByAuthor(c *gin.Context) {
 func (h *Handler) GetBooksBySeries(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	grouped, err := h.db.GetBooksBySeriesForUser(userID)
+	if err == nil {
+		grouped, err = h.visibleGroups(userID, grouped)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
 		return
 	}
 
@@ -463,10 +455,23 @@ func (h *Handler) GetSimilarBooks(c *gin.Context) {
 	}
 
 	similarBooks, err := h.db.GetSimilarBooks(id, userID, limit)
+	var hidden map[string]bool
+	if err == nil && userID != "" {
+		hidden, err = h.db.HiddenBookIDs(userID)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch similar books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch similar books")
 		return
 	}
+	if len(hidden) > 0 {
+		visible := make([]*storage.SimilarBook, 0, len(similarBooks))
+		for _, s := range similarBooks {
+			if !hidden[s.Book.ID] {
+				visible = append(visible, s)
+			}
+		}
+		similarBooks = visible
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"book_id": id,
@@ -477,88 +482,163 @@ func (h *Handler) GetSimilarBooks(c *gin.Context) {
 
 // GetBookCover serves the book's cover image
 func (h *Handler) GetBookCover(c *gin.Context) {
-	id := c.Param("id")
-
-	book, err := h.db.GetBook(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
 
 	if book.CoverPath == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No cover available"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No cover available")
 		return
 	}
 
+	// Covers change rarely, so they're cached by file rather than by
+	// library revision
+	if etag := fileETag(book.CoverPath); etag != "" {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+	}
 	c.File(book.CoverPath)
 }
 
+// requireBookFile writes an error response and returns false if the book
+// is a physical book with no file to read or download
+func requireBookFile(c *gin.Context, book *models.Book) bool {
+	if book.IsPhysical() {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Physical books have no file")
+		return false
+	}
+	return true
+}
+
 // GetTableOfContents returns the book's table of contents
 func (h *Handler) GetTableOfContents(c *gin.Context) {
-	id := c.Param("id")
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
 
-	book, err := h.db.GetBook(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	if !requireBookFile(c, book) {
 		return
 	}
 
-	chapters, err := epub.GetTableOfContents(book.FilePath)
+	structure, err := books.LoadStructure(h.db, book)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse table of contents"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to parse table of contents")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"chapters": chapters})
+	c.JSON(http.StatusOK, gin.H{"chapters": structure.Chapters})
 }
 
 // GetChapterContent returns the HTML content of a chapter
 func (h *Handler) GetChapterContent(c *gin.Context) {
-	id := c.Param("id")
 	chapterStr := c.Param("chapter")
 
 	chapter, err := strconv.Atoi(chapterStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chapter number"})
+		apierror.Invalid(c, "chapter", "Invalid chapter number")
 		return
 	}
 
-	book, err := h.db.GetBook(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
 
-	content, err := epub.GetChapterContent(book.FilePath, chapter)
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	// Chapters are sanitized for the reader unless the original is asked for
+	var content string
+	if c.Query("raw") == "1" {
+		content, err = epub.GetChapterContent(book.FilePath, chapter)
+	} else {
+		content, err = epub.GetSanitizedChapterContent(book.FilePath, chapter, epub.SanitizeOptions{
+			ResourceURL: h.basePath + "/api/books/" + book.ID + "/resource/",
+			ChapterURL:  h.basePath + "/api/books/" + book.ID + "/content/",
+		})
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chapter content"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get chapter content")
 		return
 	}
 
 	if content == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Chapter not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeChapterNotFound, "Chapter not found")
 		return
 	}
 
+	// Optionally inject the user's reader theme and CSS overrides
+	if c.Query("apply_theme") == "1" {
+		css, err := h.chapterThemeCSS(auth.GetUserID(c), book.ID)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to load reader theme")
+			return
+		}
+		content = epub.InjectStyle(content, css)
+	}
+
+	// Optionally split oversized chapters into pages
+	if pageStr := c.Query("page"); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil || page < 1 {
+			apierror.Invalid(c, "page", "Invalid page number")
+			return
+		}
+
+		pageSize := defaultChapterPageSize
+		if sizeStr := c.Query("page_size"); sizeStr != "" {
+			pageSize, err = strconv.Atoi(sizeStr)
+			if err != nil || pageSize < minChapterPageSize {
+				apierror.Invalid(c, "page_size", fmt.Sprintf("page_size must be at least %d bytes", minChapterPageSize))
+				return
+			}
+		}
+
+		pages, err := epub.SplitChapter(content, pageSize)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to split chapter")
+			return
+		}
+		if page > len(pages) {
+			apierror.RespondWith(c, http.StatusNotFound, apierror.CodePageNotFound, "Page not found", gin.H{"pages": len(pages)})
+			return
+		}
+
+		content = pages[page-1]
+		c.Header("X-Chapter-Page", strconv.Itoa(page))
+		c.Header("X-Chapter-Pages", strconv.Itoa(len(pages)))
+	}
+
 	c.Header("Content-Type", "text/html; charset=utf-8")
 	c.String(http.StatusOK, content)
 }
 
+// Chapter pagination sizes, in bytes of rendered HTML per page
+const (
+	defaultChapterPageSize = 100 * 1024
+	minChapterPageSize     = 4 * 1024
+)
+
 // GetBookResource serves a resource file (image, CSS, etc.) from an EPUB
 func (h *Handler) GetBookResource(c *gin.Context) {
-	id := c.Param("id")
 	// The resource path is everything after /resource/
 	// Gin's wildcard includes leading slash, so we trim it
 	resourcePath := strings.TrimPrefix(c.Param("path"), "/")
 
 	if resourcePath == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource path required"})
+		apierror.Invalid(c, "path", "Resource path required")
 		return
 	}
 
-	book, err := h.db.GetBook(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+
+	if !requireBookFile(c, book) {
 		return
 	}
 
@@ -566,17 +646,20 @@ func (h *Handler) GetBookResource(c *gin.Context) {
 	if err != nil {
 		// Log for debugging
 		log.Printf("Resource not found in EPUB: %s, path: %s, error: %v", book.FilePath, resourcePath, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found", "path": resourcePath})
+		apierror.RespondWith(c, http.StatusNotFound, apierror.CodeResourceNotFound, "Resource not found", gin.H{"path": resourcePath})
 		return
 	}
 
-	// Set caching headers for resources (1 hour cache)
-	c.Header("Cache-Control", "public, max-age=3600")
+	// Set caching headers for resources (1 hour cache). Only the client may
+	// cache them, since the book may be private.
+	c.Header("Cache-Control", "private, max-age=3600")
 	c.Header("Content-Type", contentType)
 	c.Data(http.StatusOK, contentType, content)
 }
 
-// GetReadingPosition returns the saved reading position for a book
+// GetReadingPosition returns the saved reading position for a book, with
+// the page it's on when the book's page count is known. An EPUB position
+// saved before positions had CFIs is given one.
 func (h *Handler) GetReadingPosition(c *gin.Context) {
 	id := c.Param("id")
 	userID := auth.GetUserID(c)
@@ -587,11 +670,147 @@ func (h *Handler) GetReadingPosition(c *gin.Context) {
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get position"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get position")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"position": pos})
+	response := gin.H{"position": pos}
+	if book, err := h.lookupBook(c); err == nil && !book.IsPhysical() {
+		if pos.CFI == "" && book.FileFormat == models.FileFormatEPUB {
+			if err := h.positions.NormalizePosition(book, pos); err == nil && pos.CFI != "" {
+				if err := h.db.SetReadingPositionCFI(pos.BookID, pos.UserID, pos.CFI); err != nil {
+					log.Printf("Warning: failed to save CFI of position in %s: %v", id, err)
+				}
+			}
+		}
+		if structure, err := books.LoadStructure(h.db, book); err == nil {
+			if page, ok := books.PositionPage(*pos, book.FileFormat, structure); ok {
+				response["page"] = page
+				response["page_count"] = structure.PageCount
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// bookPageCount returns the book's page count, reading it from the file
+// the first time. It's 0 when unknown.
+func (h *Handler) bookPageCount(book *models.Book) int {
+	if book.IsPhysical() {
+		return 0
+	}
+	structure, err := books.LoadStructure(h.db, book)
+	if err != nil {
+		log.Printf("Warning: failed to read structure of %s: %v", book.ID, err)
+		return 0
+	}
+	return structure.PageCount
+}
+
+// setMinutesRemaining fills in the estimated reading time left in each book
+// from the user's pace and position. Books whose structure hasn't been read
+// yet are skipped rather than opening their files; completed books have
+// none left.
+func (h *Handler) setMinutesRemaining(userID string, list ...*models.Book) {
+	if userID == "" || len(list) == 0 {
+		return
+	}
+	pace, err := h.db.GetReadingPace(userID)
+	if err != nil {
+		log.Printf("Warning: failed to fetch reading pace for %s: %v", userID, err)
+		return
+	}
+	if pace == 0 {
+		return
+	}
+	positions, err := h.db.GetReadingPositionsForUser(userID)
+	if err != nil {
+		log.Printf("Warning: failed to fetch reading positions for %s: %v", userID, err)
+		return
+	}
+	byBook := make(map[string]*models.ReadingPosition, len(positions))
+	for i := range positions {
+		byBook[positions[i].BookID] = &positions[i]
+	}
+
+	for _, book := range list {
+		if book.IsPhysical() {
+			continue
+		}
+		if book.ReadStatus == models.ReadStatusCompleted {
+			none := 0
+			book.EstimatedMinutesRemaining = &none
+			continue
+		}
+		structure, ok, err := books.StoredStructure(h.db, book.ID)
+		if err != nil || !ok {
+			continue
+		}
+		if minutes, ok := books.MinutesRemaining(byBook[book.ID], book.FileFormat, structure, pace); ok {
+			book.EstimatedMinutesRemaining = &minutes
+		}
+	}
+}
+
+// setCoverPalettes fills in each book's cover palette
+func (h *Handler) setCoverPalettes(list ...*models.Book) {
+	ids := make([]string, 0, len(list))
+	for _, book := range list {
+		if book.CoverPath != "" {
+			ids = append(ids, book.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	palettes, err := h.db.GetCoverPalettes(ids)
+	if err != nil {
+		log.Printf("Warning: failed to fetch cover palettes: %v", err)
+		return
+	}
+	for _, book := range list {
+		book.CoverPalette = palettes[book.ID]
+	}
+}
+
+// coverPaletteBatch is how many covers the palette backfill reads at a time
+const coverPaletteBatch = 100
+
+// StartCoverPaletteBackfill computes the palettes of covers saved before
+// palettes were, in the background, then stops
+func (h *Handler) StartCoverPaletteBackfill(ctx context.Context) {
+	go func() {
+		for ctx.Err() == nil {
+			pending, err := h.db.ListBooksWithoutCoverPalette(coverPaletteBatch)
+			if err != nil {
+				log.Printf("Warning: failed to list covers without a palette: %v", err)
+				return
+			}
+			if len(pending) == 0 {
+				return
+			}
+			owners := make([]string, 0, len(pending))
+			for _, book := range pending {
+				// An unreadable cover gets an empty palette so it isn't
+				// tried again
+				data, err := os.ReadFile(book.CoverPath)
+				var palette []string
+				if err == nil {
+					palette = books.CoverPalette(data)
+				}
+				if err := h.db.SetCoverPalette(book.ID, palette); err != nil {
+					log.Printf("Warning: failed to save cover palette of %s: %v", book.ID, err)
+					return
+				}
+				owners = append(owners, book.UserID)
+			}
+			// Cached library responses don't have the palettes yet
+			if err := h.db.BumpLibraryRevisions(owners...); err != nil {
+				log.Printf("Warning: failed to bump library revision: %v", err)
+			}
+		}
+	}()
 }
 
 // SaveReadingPosition saves the reading position for a book
@@ -600,19 +819,24 @@ func (h *Handler) SaveReadingPosition(c *gin.Context) {
 	userID := auth.GetUserID(c)
 
 	var req struct {
-		Chapter  string  `json:"chapter" binding:"required"`
+		Chapter  string  `json:"chapter"`
 		Position float64 `json:"position"`
+		CFI      string  `json:"cfi"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.BindFailed(c, err, "Invalid request body")
+		return
+	}
+	if req.Chapter == "" && req.CFI == "" {
+		apierror.Invalid(c, "chapter", "A chapter or CFI is required")
 		return
 	}
 
 	// Verify book exists and get current status
-	book, err := h.db.GetBook(id)
+	book, err := h.lookupBook(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
@@ -621,18 +845,34 @@ func (h *Handler) SaveReadingPosition(c *gin.Context) {
 		UserID:   userID,
 		Chapter:  req.Chapter,
 		Position: req.Position,
+		CFI:      req.CFI,
+	}
+
+	// EPUB positions are kept in both forms, so clients that only
+	// understand one of them open at the same place
+	if err := h.positions.NormalizePosition(book, pos); err != nil {
+		if req.CFI != "" && errors.Is(err, positions.ErrInvalidPosition) {
+			apierror.Invalid(c, "cfi", "CFI doesn't point into this book")
+			return
+		}
+		// Saved as sent; the CFI is filled in by the normalization job
+		log.Printf("Warning: failed to normalize position in %s: %v", id, err)
+		pos.Chapter, pos.CFI = req.Chapter, ""
+	}
+	if pos.Chapter == "" {
+		apierror.Invalid(c, "chapter", "A chapter is required for this book")
+		return
 	}
 
 	if err := h.db.SaveReadingPosition(pos); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save position"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save position")
 		return
 	}
 
-	// Auto-update read status to "reading" if currently "unread"
-	if book.ReadStatus == "" || book.ReadStatus == models.ReadStatusUnread {
-		// Only update if user owns the book or it's a public book
-		if book.UserID == "" || book.UserID == userID {
-			h.db.UpdateBookReadStatus(id, models.ReadStatusReading, nil)
+	// Auto-update the user's read status to "reading" if currently "unread"
+	if status, _, err := h.db.GetBookReadStatus(userID, book.ID); err == nil && status == models.ReadStatusUnread {
+		if err := h.db.UpdateBookReadStatus(userID, book.ID, models.ReadStatusReading, nil); err == nil {
+			h.publishReadStatus(userID, book.ID, models.ReadStatusReading, nil)
 		}
 	}
 
@@ -644,14 +884,38 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok", "time": time.Now()})
 }
 
-// ServeReader serves the web reader HTML page (EPUB or PDF based on book format)
+// BuildInfo describes the running server binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuiltAt   string `json:"built_at,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"` // Operating system and architecture, like "linux/arm64"
+}
+
+// SetBuildInfo sets what GetVersion reports about the binary
+func (h *Handler) SetBuildInfo(info BuildInfo) {
+	h.build = info
+}
+
+// GetVersion reports the server's version and how it was built
+func (h *Handler) GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, h.build)
+}
+
+// ServeReader serves the web reader HTML page (EPUB or PDF based on book format).
+// The EPUB reader opens at a highlight given as ?annotation=<id>.
 func (h *Handler) ServeReader(c *gin.Context) {
 	id := c.Param("id")
 
 	// Get book to determine format
 	book, err := h.db.GetBook(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+
+	if !requireBookFile(c, book) {
 		return
 	}
 
@@ -666,85 +930,79 @@ func (h *Handler) ServeReader(c *gin.Context) {
 	}
 
 	if _, err := os.Stat(readerPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reader not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Reader not found")
 		return
 	}
-	c.File(readerPath)
+	h.servePage(c, readerPath)
 }
 
 // GetBookFile serves the actual book file (PDF or EPUB) for reading
 func (h *Handler) GetBookFile(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	var book *models.Book
-	var err error
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
 
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
+	if !requireBookFile(c, book) {
+		return
 	}
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	// Another edition can be read with ?format=, or the one that suits a
+	// device named by its token
+	device := h.requestDevice(c)
+	file, ok := h.bookFileForDevice(c, book, device)
+	if !ok {
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	if scalesComic(device, file) {
+		serveBookFileForDevice(c, book, file, device)
 		return
 	}
 
-	// Set appropriate content type
-	var contentType string
-	switch book.FileFormat {
+	c.Header("Content-Type", bookFileContentType(file.FileFormat))
+	c.Header("Content-Disposition", "inline; filename=\""+book.Title+"\"")
+	c.File(file.FilePath)
+}
+
+// bookFileContentType returns the MIME type for a book file format
+func bookFileContentType(format string) string {
+	switch format {
 	case models.FileFormatPDF:
-		contentType = "application/pdf"
+		return "application/pdf"
 	case models.FileFormatEPUB:
-		contentType = "application/epub+zip"
+		return "application/epub+zip"
 	case models.FileFormatCBZ:
-		contentType = "application/zip"
+		return "application/zip"
 	case models.FileFormatCBR:
-		contentType = "application/x-rar-compressed"
+		return "application/x-rar-compressed"
+	case models.FileFormatMOBI:
+		return "application/x-mobipocket-ebook"
 	default:
-		contentType = "application/octet-stream"
+		return "application/octet-stream"
 	}
-
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Disposition", "inline; filename=\""+book.Title+"\"")
-	c.File(book.FilePath)
 }
 
 // GetCBZPage serves a specific page from a CBZ file
 func (h *Handler) GetCBZPage(c *gin.Context) {
-	id := c.Param("id")
 	pageStr := c.Param("page")
-	userID := auth.GetUserID(c)
 
 	pageIndex, err := strconv.Atoi(pageStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number"})
+		apierror.Invalid(c, "page", "Invalid page number")
 		return
 	}
 
-	var book *models.Book
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+
+	if !requireBookFile(c, book) {
 		return
 	}
 
 	if book.FileFormat != models.FileFormatCBZ && book.FileFormat != models.FileFormatCBR {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book is not a comic file (CBZ/CBR)"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Book is not a comic file (CBZ/CBR)")
 		return
 	}
 
@@ -756,58 +1014,44 @@ func (h *Handler) GetCBZPage(c *gin.Context) {
 		data, contentType, err = cbz.GetPage(book.FilePath, pageIndex)
 	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, err.Error())
 		return
 	}
 
 	c.Header("Content-Type", contentType)
-	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("Cache-Control", "private, max-age=3600")
 	c.Data(http.StatusOK, contentType, data)
 }
 
 // GetCBZInfo returns page count and other info for a CBZ/CBR
 func (h *Handler) GetCBZInfo(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	var book *models.Book
-	var err error
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+
+	if !requireBookFile(c, book) {
 		return
 	}
 
 	if book.FileFormat != models.FileFormatCBZ && book.FileFormat != models.FileFormatCBR {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Book is not a comic file (CBZ/CBR)"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Book is not a comic file (CBZ/CBR)")
 		return
 	}
 
-	var pageCount int
-	if book.FileFormat == models.FileFormatCBR {
-		pageCount, err = cbz.GetPageCountCBR(book.FilePath)
-	} else {
-		pageCount, err = cbz.GetPageCount(book.FilePath)
-	}
+	structure, err := books.LoadStructure(h.db, book)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get page count"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get page count")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"pageCount": pageCount,
-		"title":     book.Title,
-		"author":    book.Author,
-		"series":    book.Series,
+		"pageCount":        structure.PageCount,
+		"title":            book.Title,
+		"author":           book.Author,
+		"series":           book.Series,
+		"readingDirection": book.ReadingDirection,
+		"longStrip":        book.LongStrip,
 	})
 }
 
@@ -815,237 +1059,108 @@ func (h *Handler) GetCBZInfo(c *gin.Context) {
 func (h *Handler) CreateCollection(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	var req struct {
-		Name      string `json:"name" binding:"required"`
-		IsSmart   bool   `json:"is_smart"`
-		RuleLogic string `json:"rule_logic"` // AND or OR
-		Rules     []struct {
-			Field    string `json:"field"`
-			Operator string `json:"operator"`
-			Value    string `json:"value"`
-		} `json:"rules"`
+		Name      string           `json:"name" binding:"required"`
+		ParentID  string           `json:"parent_id"` // Collection to nest it in
+		IsSmart   bool             `json:"is_smart"`
+		RuleLogic string           `json:"rule_logic"` // AND or OR
+		Rules     []collectionRule `json:"rules"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		apierror.Invalid(c, "name", "Name is required")
 		return
 	}
 
-	ruleLogic := req.RuleLogic
-	if ruleLogic == "" {
-		ruleLogic = "AND"
-	}
-
-	collection := &models.Collection{
-		ID:        uuid.New().String(),
-		UserID:    userID,
-		Name:      req.Name,
-		IsSmart:   req.IsSmart,
-		RuleLogic: ruleLogic,
-		CreatedAt: time.Now(),
-	}
-
-	if err := h.db.CreateCollection(collection); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+	collection, err := h.collections.Create(userID, req.Name, req.ParentID, req.IsSmart, req.RuleLogic, collectionRules(req.Rules))
+	if err != nil {
+		respondServiceError(c, err, "Failed to create collection")
 		return
 	}
 
-	// Add rules if this is a smart collection
-	if req.IsSmart && len(req.Rules) > 0 {
-		for _, r := range req.Rules {
-			rule := &models.CollectionRule{
-				ID:           uuid.New().String(),
-				CollectionID: collection.ID,
-				Field:        r.Field,
-				Operator:     r.Operator,
-				Value:        r.Value,
-			}
-			if err := h.db.CreateCollectionRule(rule); err != nil {
-				// Log error but continue
-				continue
-			}
-			collection.Rules = append(collection.Rules, *rule)
-		}
-	}
-
 	c.JSON(http.StatusCreated, gin.H{"message": "Collection created", "collection": collection})
 }
 
 // ListCollections returns all collections
 func (h *Handler) ListCollections(c *gin.Context) {
-	userID := auth.GetUserID(c)
-
-	collections, err := h.db.ListCollections()
+	collections, err := h.collections.List(auth.GetUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch collections")
 		return
 	}
 
-	if collections == nil {
-		collections = []models.Collection{}
-	}
-
-	// Calculate accurate book counts for each collection
-	for i := range collections {
-		var books []models.Book
-		var countErr error
-
-		if collections[i].IsSmart {
-			// For smart collections, get books matching the rules
-			books, countErr = h.db.GetSmartCollectionBooks(collections[i].ID, userID)
-		} else {
-			// For static collections, get the manually added books
-			books, countErr = h.db.GetBooksInCollection(collections[i].ID)
-		}
-
-		if countErr == nil {
-			collections[i].BookCount = len(books)
-		}
-	}
-
 	c.JSON(http.StatusOK, gin.H{"collections": collections, "count": len(collections)})
 }
 
-// GetCollection returns a collection with its books
+// GetCollection returns a collection with its books and the collections
+// nested in it. With ?rollup=true the books of every nested collection are
+// included too.
 func (h *Handler) GetCollection(c *gin.Context) {
-	id := c.Param("id")
 	userID := auth.GetUserID(c)
-
-	collection, err := h.db.GetCollection(id)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
-		return
+	get := h.collections.Get
+	if c.Query("rollup") == "true" {
+		get = h.collections.Rollup
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collection"})
-		return
+	collection, books, err := get(c.Param("id"), userID)
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
 	}
-
-	// Get rules if it's a smart collection
-	if collection.IsSmart {
-		rules, err := h.db.GetCollectionRules(id)
-		if err == nil {
-			collection.Rules = rules
-		}
-	}
-
-	var books []models.Book
-	if collection.IsSmart {
-		// For smart collections, get books matching the rules
-		books, err = h.db.GetSmartCollectionBooks(id, userID)
-	} else {
-		// For static collections, get the manually added books
-		books, err = h.db.GetBooksInCollection(id)
+	var children []models.Collection
+	if err == nil {
+		children, err = h.collections.Children(collection.ID, userID)
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		respondServiceError(c, err, "Failed to fetch collection")
 		return
 	}
 
-	if books == nil {
-		books = []models.Book{}
-	}
-
-	collection.BookCount = len(books)
-	c.JSON(http.StatusOK, gin.H{"collection": collection, "books": books})
+	c.JSON(http.StatusOK, gin.H{"collection": collection, "books": books, "children": children})
 }
 
-// UpdateCollection updates a collection's name and rules
+// UpdateCollection updates a collection's name and rules, and moves it to
+// another parent when parent_id is sent
 func (h *Handler) UpdateCollection(c *gin.Context) {
-	id := c.Param("id")
-
 	var req struct {
-		Name      string `json:"name" binding:"required"`
-		RuleLogic string `json:"rule_logic"`
-		Rules     []struct {
-			Field    string `json:"field"`
-			Operator string `json:"operator"`
-			Value    string `json:"value"`
-		} `json:"rules"`
+		Name      string           `json:"name" binding:"required"`
+		ParentID  *string          `json:"parent_id"` // "" moves it to the top level
+		RuleLogic string           `json:"rule_logic"`
+		Rules     []collectionRule `json:"rules"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
-		return
-	}
-
-	collection, err := h.db.GetCollection(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		apierror.Invalid(c, "name", "Name is required")
 		return
 	}
 
-	// Update based on whether it's a smart collection
-	if collection.IsSmart {
-		ruleLogic := req.RuleLogic
-		if ruleLogic == "" {
-			ruleLogic = collection.RuleLogic
-		}
-		if err := h.db.UpdateSmartCollection(id, req.Name, ruleLogic); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update collection"})
-			return
-		}
-
-		// Replace rules if provided
-		if len(req.Rules) > 0 {
-			// Delete existing rules
-			h.db.DeleteCollectionRules(id)
-
-			// Add new rules
-			for _, r := range req.Rules {
-				rule := &models.CollectionRule{
-					ID:           uuid.New().String(),
-					CollectionID: id,
-					Field:        r.Field,
-					Operator:     r.Operator,
-					Value:        r.Value,
-				}
-				h.db.CreateCollectionRule(rule)
-			}
-		}
-	} else {
-		if err := h.db.UpdateCollection(id, req.Name); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update collection"})
+	// Moving first leaves the collection as it was if the parent is refused
+	if req.ParentID != nil {
+		if err := h.collections.SetParent(c.Param("id"), *req.ParentID); err != nil {
+			respondServiceError(c, err, "Failed to update collection")
 			return
 		}
 	}
+	if err := h.collections.Update(c.Param("id"), req.Name, req.RuleLogic, collectionRules(req.Rules)); err != nil {
+		respondServiceError(c, err, "Failed to update collection")
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Collection updated"})
 }
 
 // DeleteCollection removes a collection
-func (h *Handler) DeleteCollection(c *gin.Context) {
-	id := c.Param("id")
-
-	if _, err := h.db.GetCollection(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
-		return
-	}
-
-	if err := h.db.DeleteCollection(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+func (h *Handler) DeleteCollection(c *gin.Context) {
+	if err := h.collections.Delete(c.Param("id")); err != nil {
+		respondServiceError(c, err, "Failed to delete collection")
 		return
 	}
+	h.files.DeleteMosaics(mosaicCollection, c.Param("id"))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
 }
 
 // AddBookToCollection adds a book to a collection
 func (h *Handler) AddBookToCollection(c *gin.Context) {
-	collectionID := c.Param("id")
-	bookID := c.Param("bookId")
-
-	if _, err := h.db.GetCollection(collectionID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
-		return
-	}
-
-	if _, err := h.db.GetBook(bookID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-
-	if err := h.db.AddBookToCollection(bookID, collectionID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add book to collection"})
+	if err := h.collections.AddBook(c.Param("id"), c.Param("bookId")); err != nil {
+		respondServiceError(c, err, "Failed to add book to collection")
 		return
 	}
 
@@ -1054,11 +1169,8 @@ func (h *Handler) AddBookToCollection(c *gin.Context) {
 
 // RemoveBookFromCollection removes a book from a collection
 func (h *Handler) RemoveBookFromCollection(c *gin.Context) {
-	collectionID := c.Param("id")
-	bookID := c.Param("bookId")
-
-	if err := h.db.RemoveBookFromCollection(bookID, collectionID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove book from collection"})
+	if err := h.collections.RemoveBook(c.Param("id"), c.Param("bookId")); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove book from collection")
 		return
 	}
 
@@ -1067,47 +1179,48 @@ func (h *Handler) RemoveBookFromCollection(c *gin.Context) {
 
 // BulkAddToCollection adds multiple books to a collection
 func (h *Handler) BulkAddToCollection(c *gin.Context) {
-	collectionID := c.Param("id")
-
 	var req struct {
 		BookIDs []string `json:"book_ids" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "book_ids is required"})
+		apierror.Invalid(c, "book_ids", "book_ids is required")
 		return
 	}
 
-	if _, err := h.db.GetCollection(collectionID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
-		return
-	}
-
-	if err := h.db.BulkAddBooksToCollection(req.BookIDs, collectionID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add books to collection"})
+	if err := h.collections.AddBooks(c.Param("id"), req.BookIDs); err != nil {
+		respondServiceError(c, err, "Failed to add books to collection")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Books added to collection", "count": len(req.BookIDs)})
 }
 
-// GetBookCollections returns all collections a book belongs to
-func (h *Handler) GetBookCollections(c *gin.Context) {
-	bookID := c.Param("id")
+// ReorderCollection sets the order of the books in a static collection
+func (h *Handler) ReorderCollection(c *gin.Context) {
+	var req struct {
+		BookIDs []string `json:"book_ids" binding:"required"`
+	}
 
-	if _, err := h.db.GetBook(bookID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "book_ids", "book_ids is required")
 		return
 	}
 
-	collections, err := h.db.GetCollectionsForBook(bookID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+	if err := h.collections.Reorder(c.Param("id"), req.BookIDs); err != nil {
+		respondServiceError(c, err, "Failed to reorder collection")
 		return
 	}
 
-	if collections == nil {
-		collections = []models.Collection{}
+	c.JSON(http.StatusOK, gin.H{"message": "Collection reordered", "collection_id": c.Param("id")})
+}
+
+// GetBookCollections returns all collections a book belongs to
+func (h *Handler) GetBookCollections(c *gin.Context) {
+	collections, err := h.collections.ForBook(c.Param("id"))
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch collections")
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"collections": collections})
@@ -1120,33 +1233,41 @@ func (h *Handler) ShareBook(c *gin.Context) {
 	currentUserID := auth.GetUserID(c)
 
 	if currentUserID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Check book ownership
-	book, err := h.db.GetBook(bookID)
+	book, err := h.lookupBook(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
 	if book.UserID != currentUserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only share your own books"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can only share your own books")
 		return
 	}
 
 	// Check target user exists
 	if _, err := h.db.GetUserByID(targetUserID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
 		return
 	}
 
 	if err := h.db.ShareBook(bookID, currentUserID, targetUserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to share book")
 		return
 	}
 
+	h.notifier.Publish(notify.Event{
+		Type:    models.NotificationEventBookShared,
+		UserID:  targetUserID,
+		Title:   "A book was shared with you",
+		Message: fmt.Sprintf("%s shared %q by %s with you.", auth.GetUsername(c), book.Title, book.Author),
+		BookID:  book.ID,
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Book shared successfully"})
 }
 
@@ -1157,42 +1278,112 @@ func (h *Handler) UnshareBook(c *gin.Context) {
 	currentUserID := auth.GetUserID(c)
 
 	if currentUserID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Check book ownership
-	book, err := h.db.GetBook(bookID)
+	book, err := h.lookupBook(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
 	if book.UserID != currentUserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only unshare your own books"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can only unshare your own books")
 		return
 	}
 
 	if err := h.db.UnshareBook(bookID, targetUserID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to unshare book")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Book unshared successfully"})
 }
 
+// TransferBook gives a book to another user, such as when consolidating
+// accounts. Only the owner or an admin may transfer it. Shares are kept;
+// "reset_read_state" starts the book unread for the new owner instead of
+// carrying over the previous owner's progress.
+func (h *Handler) TransferBook(c *gin.Context) {
+	currentUserID := auth.GetUserID(c)
+	if currentUserID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		ResetReadState bool `json:"reset_read_state"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request")
+			return
+		}
+	}
+
+	book, err := h.lookupBook(c)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+		return
+	}
+
+	if book.UserID != currentUserID && !h.isAdmin(currentUserID) {
+		if !h.policy.CanRead(book, currentUserID) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+			return
+		}
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can only transfer your own books")
+		return
+	}
+
+	targetUserID := c.Param("userId")
+	if targetUserID == book.UserID {
+		apierror.Invalid(c, "userId", "The book already belongs to this user")
+		return
+	}
+	if _, err := h.db.GetUserByID(targetUserID); err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+
+	if err := h.db.TransferBook(book.ID, targetUserID, !req.ResetReadState); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to transfer book")
+		return
+	}
+
+	book, err = h.db.GetBook(book.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Book transferred",
+		"book":    book,
+	})
+}
+
 // GetSharedBooks returns books shared with the current user
 func (h *Handler) GetSharedBooks(c *gin.Context) {
 	userID := auth.GetUserID(c)
 
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	books, err := h.db.GetSharedBooks(userID)
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shared books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch shared books")
 		return
 	}
 
@@ -1209,20 +1400,20 @@ func (h *Handler) GetBookShares(c *gin.Context) {
 	currentUserID := auth.GetUserID(c)
 
 	// Check book ownership
-	book, err := h.db.GetBook(bookID)
+	book, err := h.lookupBook(c)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
 	if book.UserID != currentUserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view shares for your own books"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can only view shares for your own books")
 		return
 	}
 
 	users, err := h.db.GetBookShares(bookID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shares"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch shares")
 		return
 	}
 
@@ -1240,24 +1431,33 @@ func (h *Handler) GetChapterText(c *gin.Context) {
 
 	chapter, err := strconv.Atoi(chapterStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chapter number"})
+		apierror.Invalid(c, "chapter", "Invalid chapter number")
 		return
 	}
 
-	book, err := h.db.GetBook(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	// Very large chapters can be fetched a chunk at a time
+	if c.Query("offset") != "" || c.Query("limit") != "" {
+		h.getChapterTextChunk(c, book, chapter)
 		return
 	}
 
 	content, err := epub.GetChapterText(book.FilePath, chapter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chapter content"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get chapter content")
 		return
 	}
 
 	if content == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Chapter not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeChapterNotFound, "Chapter not found")
 		return
 	}
 
@@ -1269,6 +1469,52 @@ func (h *Handler) GetChapterText(c *gin.Context) {
 	})
 }
 
+// Chapter text chunk sizes, in characters
+const (
+	defaultTextChunkLength = 64 * 1024
+	maxTextChunkLength     = 1024 * 1024
+)
+
+// getChapterTextChunk responds with part of a chapter's text, from the
+// offset and limit query parameters. Offsets are those of CFIs and
+// annotation locations.
+func (h *Handler) getChapterTextChunk(c *gin.Context, book *models.Book, chapter int) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		apierror.Invalid(c, "offset", "Invalid offset")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultTextChunkLength)))
+	if err != nil || limit < 1 || limit > maxTextChunkLength {
+		apierror.Invalid(c, "limit", fmt.Sprintf("limit must be between 1 and %d", maxTextChunkLength))
+		return
+	}
+
+	chunk, err := epub.GetChapterTextChunk(book.FilePath, chapter, offset, limit)
+	if errors.Is(err, epub.ErrChapterNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeChapterNotFound, "Chapter not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get chapter content")
+		return
+	}
+
+	response := gin.H{
+		"book_id":      book.ID,
+		"chapter":      chapter,
+		"content":      chunk.Text,
+		"content_type": "text/plain",
+		"offset":       chunk.Offset,
+		"total_length": chunk.Total,
+		"breaks":       chunk.Breaks,
+	}
+	if chunk.End < chunk.Total {
+		response["next_offset"] = chunk.End
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // SearchMetadata searches for book metadata and returns all matches for selection
 func (h *Handler) SearchMetadata(c *gin.Context) {
 	isbn := c.Query("isbn")
@@ -1277,24 +1523,28 @@ func (h *Handler) SearchMetadata(c *gin.Context) {
 	year := c.Query("year")
 
 	if isbn == "" && title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "At least isbn or title is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "At least isbn or title is required")
+		return
+	}
+	service, ok := h.metadataService(c, c.Query("provider"))
+	if !ok {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	results, err := h.metadata.SearchBooks(ctx, isbn, title, author)
+	results, err := service.SearchBooks(ctx, isbn, title, author)
 	if err != nil {
 		if err == metadata.ErrNoMatch {
-			c.JSON(http.StatusNotFound, gin.H{"error": "No matching metadata found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No matching metadata found")
 			return
 		}
 		if err == metadata.ErrRateLimited {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limited, please try again later"})
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search metadata"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search metadata")
 		return
 	}
 
@@ -1323,51 +1573,43 @@ func (h *Handler) LookupMetadata(c *gin.Context) {
 	author := c.Query("author")
 
 	if isbn == "" && title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "At least isbn or title is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "At least isbn or title is required")
+		return
+	}
+	service, ok := h.metadataService(c, c.Query("provider"))
+	if !ok {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	result, err := h.metadata.LookupBook(ctx, isbn, title, author)
+	result, err := service.LookupBook(ctx, isbn, title, author)
 	if err != nil {
 		if err == metadata.ErrNoMatch {
-			c.JSON(http.StatusNotFound, gin.H{"error": "No matching metadata found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No matching metadata found")
 			return
 		}
 		if err == metadata.ErrRateLimited {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limited, please try again later"})
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lookup metadata"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to lookup metadata")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"metadata": result})
 }
 
-// RefreshBookMetadata fetches and updates metadata for an existing book
+// RefreshBookMetadata fetches and updates metadata for an existing book,
+// from the provider named by the provider query parameter if there is one
 func (h *Handler) RefreshBookMetadata(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	// Get the book
-	var book *models.Book
-	var err error
-
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	service, ok := h.metadataService(c, c.Query("provider"))
+	if !ok {
 		return
 	}
 
@@ -1375,17 +1617,17 @@ func (h *Handler) RefreshBookMetadata(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	result, err := h.metadata.LookupBook(ctx, book.ISBN, book.Title, book.Author)
+	result, err := service.LookupBook(ctx, book.ISBN, book.Title, book.Author)
 	if err != nil {
 		if err == metadata.ErrNoMatch {
-			c.JSON(http.StatusNotFound, gin.H{"error": "No matching metadata found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No matching metadata found")
 			return
 		}
 		if err == metadata.ErrRateLimited {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limited, please try again later"})
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lookup metadata"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to lookup metadata")
 		return
 	}
 
@@ -1418,13 +1660,19 @@ func (h *Handler) RefreshBookMetadata(c *gin.Context) {
 	book.MetadataSource = result.Source
 	book.MetadataUpdated = &now
 
-	if err := h.db.UpdateBookMetadata(book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update metadata"})
+	if err := h.saveBookMetadata(book, auth.GetUserID(c)); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update metadata")
 		return
 	}
+	h.syncSubjectTags(book, auth.GetUserID(c))
 
-	// Write metadata to file based on format
-	switch book.FileFormat {
+	// Write metadata to file based on format, into a copy of its own if
+	// other books share the file
+	fileFormat := book.FileFormat
+	if !h.detachBookFile(book) {
+		fileFormat = ""
+	}
+	switch fileFormat {
 	case models.FileFormatEPUB:
 		epubMeta := &epub.Metadata{
 			Title:       book.Title,
@@ -1440,6 +1688,8 @@ func (h *Handler) RefreshBookMetadata(c *gin.Context) {
 		}
 		if err := epub.UpdateMetadata(book.FilePath, epubMeta); err != nil {
 			log.Printf("Warning: failed to update EPUB metadata for book %s: %v", book.ID, err)
+		} else {
+			h.recordFileWrite(book)
 		}
 	case models.FileFormatPDF:
 		pdfMeta := &pdf.Metadata{
@@ -1450,6 +1700,8 @@ func (h *Handler) RefreshBookMetadata(c *gin.Context) {
 		}
 		if err := pdf.UpdateMetadata(book.FilePath, pdfMeta); err != nil {
 			log.Printf("Warning: failed to update PDF metadata for book %s: %v", book.ID, err)
+		} else {
+			h.recordFileWrite(book)
 		}
 	}
 
@@ -1475,25 +1727,8 @@ func (h *Handler) RefreshBookMetadata(c *gin.Context) {
 
 // UpdateBookMetadata manually updates book metadata fields
 func (h *Handler) UpdateBookMetadata(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	// Get the book
-	var book *models.Book
-	var err error
-
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
 		return
 	}
 
@@ -1512,7 +1747,7 @@ func (h *Handler) UpdateBookMetadata(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.BindFailed(c, err, "Invalid request body")
 		return
 	}
 
@@ -1531,15 +1766,16 @@ func (h *Handler) UpdateBookMetadata(c *gin.Context) {
 	book.Language = req.Language
 	book.Subjects = req.Subjects
 	book.Description = req.Description
-	book.MetadataSource = "manual"
+	book.MetadataSource = models.MetadataSourceManual
 	now := time.Now()
 	book.MetadataUpdated = &now
 
 	// Update database metadata
-	if err := h.db.UpdateBookMetadata(book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update metadata"})
+	if err := h.saveBookMetadata(book, auth.GetUserID(c)); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update metadata")
 		return
 	}
+	h.syncSubjectTags(book, auth.GetUserID(c))
 
 	// Parse subjects
 	subjects := []string{}
@@ -1550,8 +1786,13 @@ func (h *Handler) UpdateBookMetadata(c *gin.Context) {
 		}
 	}
 
-	// Write metadata to file based on format
-	switch book.FileFormat {
+	// Write metadata to file based on format, into a copy of its own if
+	// other books share the file
+	fileFormat := book.FileFormat
+	if !h.detachBookFile(book) {
+		fileFormat = ""
+	}
+	switch fileFormat {
 	case models.FileFormatEPUB:
 		epubMeta := &epub.Metadata{
 			Title:       book.Title,
@@ -1567,6 +1808,8 @@ func (h *Handler) UpdateBookMetadata(c *gin.Context) {
 		}
 		if err := epub.UpdateMetadata(book.FilePath, epubMeta); err != nil {
 			log.Printf("Warning: failed to update EPUB metadata for book %s: %v", book.ID, err)
+		} else {
+			h.recordFileWrite(book)
 		}
 	case models.FileFormatPDF:
 		pdfMeta := &pdf.Metadata{
@@ -1577,6 +1820,8 @@ func (h *Handler) UpdateBookMetadata(c *gin.Context) {
 		}
 		if err := pdf.UpdateMetadata(book.FilePath, pdfMeta); err != nil {
 			log.Printf("Warning: failed to update PDF metadata for book %s: %v", book.ID, err)
+		} else {
+			h.recordFileWrite(book)
 		}
 	}
 
@@ -1607,13 +1852,12 @@ func (h *Handler) SearchComicMetadata(c *gin.Context) {
 	title := c.Query("title")
 
 	if series == "" && title == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "At least series or title is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "At least series or title is required")
 		return
 	}
 
 	if !h.comicMetadata.IsConfigured() {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":   "Comic metadata service not configured",
+		apierror.RespondWith(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Comic metadata service not configured", gin.H{
 			"message": "Set COMICVINE_API_KEY environment variable to enable comic metadata lookup",
 		})
 		return
@@ -1625,14 +1869,14 @@ func (h *Handler) SearchComicMetadata(c *gin.Context) {
 	results, err := h.comicMetadata.SearchComics(ctx, series, issue, title)
 	if err != nil {
 		if err == metadata.ErrNoMatch {
-			c.JSON(http.StatusNotFound, gin.H{"error": "No matching comic metadata found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No matching comic metadata found")
 			return
 		}
 		if err == metadata.ErrRateLimited {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limited, please try again later"})
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search comic metadata"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search comic metadata")
 		return
 	}
 
@@ -1641,37 +1885,19 @@ func (h *Handler) SearchComicMetadata(c *gin.Context) {
 
 // RefreshComicMetadata fetches and updates metadata for a comic
 func (h *Handler) RefreshComicMetadata(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	// Get the book
-	var book *models.Book
-	var err error
-
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
 		return
 	}
 
 	// Verify this is a comic
 	if book.ContentType != models.ContentTypeComic {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "This is not a comic. Use the book metadata refresh endpoint."})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "This is not a comic. Use the book metadata refresh endpoint.")
 		return
 	}
 
 	if !h.comicMetadata.IsConfigured() {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":   "Comic metadata service not configured",
+		apierror.RespondWith(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Comic metadata service not configured", gin.H{
 			"message": "Set COMICVINE_API_KEY environment variable to enable comic metadata lookup",
 		})
 		return
@@ -1703,8 +1929,7 @@ func (h *Handler) RefreshComicMetadata(c *gin.Context) {
 	result, err := h.comicMetadata.LookupComic(ctx, searchSeries, issueNumber, book.Title, year)
 	if err != nil {
 		if err == metadata.ErrNoMatch {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":       "No matching comic metadata found",
+			apierror.RespondWith(c, http.StatusNotFound, apierror.CodeNotFound, "No matching comic metadata found", gin.H{
 				"parsed_info": gin.H{
 					"series":       searchSeries,
 					"issue_number": issueNumber,
@@ -1714,10 +1939,10 @@ func (h *Handler) RefreshComicMetadata(c *gin.Context) {
 			return
 		}
 		if err == metadata.ErrRateLimited {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limited, please try again later"})
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lookup comic metadata"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to lookup comic metadata")
 		return
 	}
 
@@ -1759,10 +1984,11 @@ func (h *Handler) RefreshComicMetadata(c *gin.Context) {
 	book.MetadataSource = result.Source
 	book.MetadataUpdated = &now
 
-	if err := h.db.UpdateBookMetadata(book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update metadata"})
+	if err := h.saveBookMetadata(book, auth.GetUserID(c)); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update metadata")
 		return
 	}
+	h.syncSubjectTags(book, auth.GetUserID(c))
 
 	// Reorganize book to correct folder structure
 	newPaths, err := h.files.ReorganizeBook(book.FilePath, book.CoverPath, book.Author, book.Series, book.Title)
@@ -1801,31 +2027,14 @@ func (h *Handler) GetComicMetadataStatus(c *gin.Context) {
 
 // ReprocessComicFilename re-parses a comic's filename to extract better metadata
 func (h *Handler) ReprocessComicFilename(c *gin.Context) {
-	id := c.Param("id")
-	userID := auth.GetUserID(c)
-
-	// Get the book
-	var book *models.Book
-	var err error
-
-	if userID != "" {
-		book, err = h.db.GetBookForUser(id, userID)
-	} else {
-		book, err = h.db.GetBook(id)
-	}
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
 		return
 	}
 
 	// Verify this is a comic
 	if book.ContentType != models.ContentTypeComic {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "This is not a comic"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "This is not a comic")
 		return
 	}
 
@@ -1843,11 +2052,11 @@ func (h *Handler) ReprocessComicFilename(c *gin.Context) {
 	book.SeriesIndex = parsedInfo.IssueFloat
 
 	now := time.Now()
-	book.MetadataSource = "filename"
+	book.MetadataSource = models.MetadataSourceFilename
 	book.MetadataUpdated = &now
 
-	if err := h.db.UpdateBookMetadata(book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update metadata"})
+	if err := h.saveBookMetadata(book, auth.GetUserID(c)); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update metadata")
 		return
 	}
 
@@ -1871,278 +2080,103 @@ func (h *Handler) ReprocessComicFilename(c *gin.Context) {
 	})
 }
 
-// APIInfo returns API documentation for TUI/programmatic clients
+// APIInfo returns API documentation for TUI/programmatic clients. The
+// endpoint list is derived from the registered routes; see /api/openapi.json
+// for the full OpenAPI document.
 func (h *Handler) APIInfo(c *gin.Context) {
-	endpoints := []gin.H{
-		{"method": "GET", "path": "/health", "description": "Health check"},
-		{"method": "GET", "path": "/api", "description": "API documentation"},
-
-		// Auth
-		{"method": "POST", "path": "/api/auth/register", "description": "Register new user", "body": "username, email, password"},
-		{"method": "POST", "path": "/api/auth/login", "description": "Login", "body": "username, password"},
-		{"method": "POST", "path": "/api/auth/refresh", "description": "Refresh JWT token", "body": "token"},
-		{"method": "GET", "path": "/api/auth/me", "description": "Get current user", "auth": true},
-		{"method": "GET", "path": "/api/users/search", "description": "Search users", "query": "q", "auth": true},
-
-		// Books
-		{"method": "POST", "path": "/api/books", "description": "Upload EPUB/PDF/CBZ", "body": "file (multipart)"},
-		{"method": "GET", "path": "/api/books", "description": "List books", "query": "sort, order, search, page, limit, type (book/comic)"},
-		{"method": "GET", "path": "/api/books/:id", "description": "Get book by ID"},
-		{"method": "DELETE", "path": "/api/books/:id", "description": "Delete book"},
-		{"method": "GET", "path": "/api/books/by-author", "description": "Books grouped by author"},
-		{"method": "GET", "path": "/api/books/by-series", "description": "Books grouped by series"},
-
-		// Reading
-		{"method": "GET", "path": "/api/books/:id/cover", "description": "Get book cover image"},
-		{"method": "GET", "path": "/api/books/:id/file", "description": "Get book file (PDF/EPUB/CBZ)"},
-		{"method": "GET", "path": "/api/books/:id/toc", "description": "Get table of contents (EPUB only)"},
-		{"method": "GET", "path": "/api/books/:id/content/:chapter", "description": "Get chapter HTML content (EPUB only)"},
-		{"method": "GET", "path": "/api/books/:id/text/:chapter", "description": "Get chapter plain text (EPUB only, TUI-friendly)"},
-		{"method": "GET", "path": "/api/books/:id/cbz/info", "description": "Get CBZ comic info and page count"},
-		{"method": "GET", "path": "/api/books/:id/cbz/page/:page", "description": "Get specific page from CBZ"},
-		{"method": "GET", "path": "/api/books/:id/position", "description": "Get reading position"},
-		{"method": "POST", "path": "/api/books/:id/position", "description": "Save reading position", "body": "chapter, position"},
-
-		// Book Metadata
-		{"method": "GET", "path": "/api/metadata/lookup", "description": "Lookup book metadata from external sources", "query": "isbn, title, author"},
-		{"method": "GET", "path": "/api/metadata/search", "description": "Search for book metadata and return all matches", "query": "isbn, title, author"},
-		{"method": "POST", "path": "/api/books/:id/metadata/refresh", "description": "Refresh book metadata from external sources"},
-		{"method": "PUT", "path": "/api/books/:id/metadata", "description": "Manually update book metadata", "body": "title, author, series, series_index, isbn, publisher, publish_date, language, subjects, description"},
-		{"method": "POST", "path": "/api/metadata/bulk-refresh", "description": "Refresh metadata for multiple books", "body": "book_ids, content_type"},
-
-		// Comic Metadata
-		{"method": "GET", "path": "/api/metadata/comic/status", "description": "Check if comic metadata service is configured"},
-		{"method": "GET", "path": "/api/metadata/comic/search", "description": "Search for comic metadata from ComicVine", "query": "series, issue, title"},
-		{"method": "POST", "path": "/api/books/:id/metadata/comic/refresh", "description": "Refresh comic metadata from ComicVine"},
-
-		// Duplicate Detection
-		{"method": "GET", "path": "/api/duplicates", "description": "Find duplicate books by file hash"},
-		{"method": "GET", "path": "/api/duplicates/status", "description": "Get hash computation status"},
-		{"method": "POST", "path": "/api/duplicates/compute", "description": "Compute hashes for books without them"},
-		{"method": "POST", "path": "/api/duplicates/merge", "description": "Merge duplicate books", "body": "keep_id, delete_ids"},
-
-		// Sharing
-		{"method": "GET", "path": "/api/books/shared", "description": "Get books shared with you", "auth": true},
-		{"method": "GET", "path": "/api/books/:id/shares", "description": "Get users book is shared with", "auth": true},
-		{"method": "POST", "path": "/api/books/:id/share/:userId", "description": "Share book with user", "auth": true},
-		{"method": "DELETE", "path": "/api/books/:id/share/:userId", "description": "Unshare book", "auth": true},
-
-		// Collections
-		{"method": "POST", "path": "/api/collections", "description": "Create collection", "body": "name"},
-		{"method": "GET", "path": "/api/collections", "description": "List collections"},
-		{"method": "GET", "path": "/api/collections/:id", "description": "Get collection with books"},
-		{"method": "PUT", "path": "/api/collections/:id", "description": "Update collection", "body": "name"},
-		{"method": "DELETE", "path": "/api/collections/:id", "description": "Delete collection"},
-		{"method": "POST", "path": "/api/collections/:id/books/:bookId", "description": "Add book to collection"},
-		{"method": "DELETE", "path": "/api/collections/:id/books/:bookId", "description": "Remove book from collection"},
-		{"method": "POST", "path": "/api/collections/:id/books", "description": "Bulk add books", "body": "book_ids"},
-		{"method": "GET", "path": "/api/books/:id/collections", "description": "Get collections for book"},
+	endpoints := []gin.H{}
+	for _, r := range h.documentedRoutes() {
+		endpoint := gin.H{"method": r.Method, "path": r.Path, "description": r.Summary}
+		if r.Query != "" {
+			endpoint["query"] = r.Query
+		}
+		if r.Body != "" {
+			endpoint["body"] = r.Body
+		}
+		if r.Auth == authRequired {
+			endpoint["auth"] = true
+		}
+		endpoints = append(endpoints, endpoint)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"name":        "Webby API",
-		"version":     "1.0.0",
+		"version":     apiVersion,
 		"description": "EPUB/PDF/CBZ library API for web and TUI clients",
+		"openapi":     h.basePath + "/api/openapi.json",
+		"docs":        h.basePath + "/api/docs",
 		"endpoints":   endpoints,
 	})
 }
 
-// BulkRefreshMetadata refreshes metadata for multiple books at once
+// BulkRefreshMetadata queues a background job refreshing the metadata of
+// several books, or all of a content type. Its progress is followed, and it
+// is paused and resumed, through the job endpoints. A dry run looks the
+// books up and records each one's field changes without saving them. Books
+// are looked up with the named provider if one is given.
 func (h *Handler) BulkRefreshMetadata(c *gin.Context) {
 	userID := auth.GetUserID(c)
 
 	var req struct {
 		BookIDs     []string `json:"book_ids"`
 		ContentType string   `json:"content_type"` // Optional: "book" or "comic" to refresh all of that type
+		DryRun      bool     `json:"dry_run"`
+		Provider    string   `json:"provider"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		apierror.BindFailed(c, err, "Invalid request body")
+		return
+	}
+	req.Provider = strings.TrimSpace(req.Provider)
+	if _, ok := h.metadataService(c, req.Provider); !ok {
 		return
 	}
 
 	// If book_ids is empty but content_type is specified, get all books of that type
-	var booksToRefresh []models.Book
+	var bookIDs []string
 	if len(req.BookIDs) == 0 && req.ContentType != "" {
 		books, err := h.db.ListBooksForUserWithFilter(userID, "title", "asc", req.ContentType)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
 			return
 		}
-		booksToRefresh = books
+		for _, book := range books {
+			bookIDs = append(bookIDs, book.ID)
+		}
 	} else if len(req.BookIDs) > 0 {
 		for _, id := range req.BookIDs {
-			var book *models.Book
-			var err error
-			if userID != "" {
-				book, err = h.db.GetBookForUser(id, userID)
-			} else {
-				book, err = h.db.GetBook(id)
-			}
-			if err == nil && book != nil {
-				booksToRefresh = append(booksToRefresh, *book)
+			// Books the user may not change are skipped
+			book, err := h.db.GetBook(id)
+			if err == nil && h.policy.CanWrite(book, userID) {
+				bookIDs = append(bookIDs, book.ID)
 			}
 		}
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either book_ids or content_type is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Either book_ids or content_type is required")
 		return
 	}
 
-	if len(booksToRefresh) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"message":   "No books to refresh",
-			"processed": 0,
-			"succeeded": 0,
-			"failed":    0,
-		})
+	if len(bookIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "No books to refresh"})
 		return
 	}
 
-	// Limit batch size to prevent timeouts
-	maxBatch := 50
-	if len(booksToRefresh) > maxBatch {
-		booksToRefresh = booksToRefresh[:maxBatch]
-	}
-
-	ctx := c.Request.Context()
-	results := make([]gin.H, 0)
-	succeeded := 0
-	failed := 0
-
-	for _, book := range booksToRefresh {
-		var result gin.H
-
-		if book.ContentType == models.ContentTypeComic {
-			// Use comic metadata service
-			if !h.comicMetadata.IsConfigured() {
-				result = gin.H{
-					"book_id": book.ID,
-					"title":   book.Title,
-					"status":  "skipped",
-					"reason":  "Comic metadata service not configured",
-				}
-				failed++
-			} else {
-				// Re-parse filename for better matching
-				filename := filepath.Base(book.FilePath)
-				parsedInfo := cbz.ParseComicFilename(filename)
-
-				searchSeries := book.Series
-				if parsedInfo.Series != "" {
-					searchSeries = parsedInfo.Series
-				}
-
-				issueNumber := parsedInfo.IssueNumber
-				if issueNumber == "" && book.SeriesIndex > 0 {
-					issueNumber = strconv.FormatFloat(book.SeriesIndex, 'f', -1, 64)
-				}
-
-				comicResult, err := h.comicMetadata.LookupComic(ctx, searchSeries, issueNumber, book.Title, parsedInfo.Year)
-				if err != nil || comicResult == nil || comicResult.Confidence < 0.5 {
-					result = gin.H{
-						"book_id": book.ID,
-						"title":   book.Title,
-						"status":  "failed",
-						"reason":  "No matching metadata found",
-					}
-					failed++
-				} else {
-					// Update book metadata
-					now := time.Now()
-					if comicResult.Title != "" {
-						book.Title = comicResult.Title
-					}
-					if comicResult.Series != "" {
-						book.Series = comicResult.Series
-					}
-					if len(comicResult.Writers) > 0 {
-						book.Author = comicResult.Writers[0]
-					}
-					book.Publisher = comicResult.Publisher
-					book.PublishDate = comicResult.ReleaseDate
-					book.Description = comicResult.Description
-					book.MetadataSource = comicResult.Source
-					book.MetadataUpdated = &now
-
-					if err := h.db.UpdateBookMetadata(&book); err != nil {
-						result = gin.H{
-							"book_id": book.ID,
-							"title":   book.Title,
-							"status":  "failed",
-							"reason":  "Failed to save metadata",
-						}
-						failed++
-					} else {
-						result = gin.H{
-							"book_id":    book.ID,
-							"title":      book.Title,
-							"status":     "success",
-							"confidence": comicResult.Confidence,
-						}
-						succeeded++
-					}
-				}
-			}
-		} else {
-			// Use book metadata service
-			bookResult, err := h.metadata.LookupBook(ctx, book.ISBN, book.Title, book.Author)
-			if err != nil || bookResult == nil || bookResult.Confidence < 0.5 {
-				result = gin.H{
-					"book_id": book.ID,
-					"title":   book.Title,
-					"status":  "failed",
-					"reason":  "No matching metadata found",
-				}
-				failed++
-			} else {
-				// Update book metadata
-				now := time.Now()
-				book.Title = bookResult.Title
-				if len(bookResult.Authors) > 0 {
-					book.Author = bookResult.Authors[0]
-				}
-				if bookResult.ISBN13 != "" {
-					book.ISBN = bookResult.ISBN13
-				} else if bookResult.ISBN10 != "" {
-					book.ISBN = bookResult.ISBN10
-				}
-				book.Publisher = bookResult.Publisher
-				book.PublishDate = bookResult.PublishDate
-				book.Description = bookResult.Description
-				book.Language = bookResult.Language
-				book.Subjects = strings.Join(bookResult.Subjects, ", ")
-				book.MetadataSource = bookResult.Source
-				book.MetadataUpdated = &now
-
-				if err := h.db.UpdateBookMetadata(&book); err != nil {
-					result = gin.H{
-						"book_id": book.ID,
-						"title":   book.Title,
-						"status":  "failed",
-						"reason":  "Failed to save metadata",
-					}
-					failed++
-				} else {
-					result = gin.H{
-						"book_id":    book.ID,
-						"title":      book.Title,
-						"status":     "success",
-						"confidence": bookResult.Confidence,
-					}
-					succeeded++
-				}
-			}
-		}
-
-		results = append(results, result)
+	job, err := h.jobs.Submit(&models.Job{
+		UserID:   userID,
+		Kind:     models.JobKindMetadataRefresh,
+		DryRun:   req.DryRun,
+		Provider: req.Provider,
+	}, bookIDs)
+	if err != nil {
+		log.Printf("Failed to queue metadata refresh: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to queue metadata refresh")
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "Bulk metadata refresh complete",
-		"processed": len(booksToRefresh),
-		"succeeded": succeeded,
-		"failed":    failed,
-		"results":   results,
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Bulk metadata refresh queued",
+		"job":     job,
 	})
 }
 
@@ -2152,7 +2186,7 @@ func (h *Handler) GetDuplicates(c *gin.Context) {
 
 	groups, err := h.duplicates.FindDuplicates(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicates"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to find duplicates")
 		return
 	}
 
@@ -2170,9 +2204,27 @@ func (h *Handler) GetDuplicates(c *gin.Context) {
 		})
 	}
 
+	// Same title and author in different formats; merging keeps these as
+	// editions rather than deleting them
+	editionGroups, err := h.duplicates.FindEditionCandidates(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to find duplicates")
+		return
+	}
+	editions := make([]gin.H, 0, len(editionGroups))
+	for _, g := range editionGroups {
+		editions = append(editions, gin.H{
+			"title":  g.Title,
+			"author": g.Author,
+			"count":  len(g.Books),
+			"books":  g.Books,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"groups": response,
-		"count":  len(groups),
+		"groups":         response,
+		"count":          len(groups),
+		"edition_groups": editions,
 	})
 }
 
@@ -2182,13 +2234,13 @@ func (h *Handler) GetDuplicatesStatus(c *gin.Context) {
 
 	unhashed, err := h.db.CountBooksWithoutHash(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get status"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get status")
 		return
 	}
 
 	groups, err := h.duplicates.FindDuplicates(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count duplicates"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to count duplicates")
 		return
 	}
 
@@ -2205,21 +2257,32 @@ func (h *Handler) GetDuplicatesStatus(c *gin.Context) {
 	})
 }
 
-// ComputeHashes computes missing file hashes for duplicate detection
+// ComputeHashes queues a background job hashing the files of books
+// without hashes, for duplicate detection. Its progress is at
+// /api/jobs/:id.
 func (h *Handler) ComputeHashes(c *gin.Context) {
 	userID := auth.GetUserID(c)
 
-	progress, err := h.duplicates.ComputeMissingHashes(userID, 100)
+	bookIDs, err := h.db.ListBookIDsWithoutHash(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute hashes"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+	if len(bookIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Every book is already hashed"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "Hash computation complete",
-		"total":     progress.Total,
-		"processed": progress.Processed,
-		"failed":    progress.Failed,
+	job, err := h.jobs.Enqueue(userID, models.JobKindHashCompute, false, bookIDs)
+	if err != nil {
+		log.Printf("Failed to queue hash computation: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to queue hash computation")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Hash computation queued",
+		"job":     job,
 	})
 }
 
@@ -2230,28 +2293,38 @@ func (h *Handler) MergeDuplicates(c *gin.Context) {
 	var req struct {
 		KeepID    string   `json:"keep_id" binding:"required"`
 		DeleteIDs []string `json:"delete_ids" binding:"required"`
+		DryRun    bool     `json:"dry_run"` // Report what would be deleted and moved without doing it
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "keep_id and delete_ids are required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "keep_id and delete_ids are required")
 		return
 	}
 
-	result, err := h.duplicates.MergeDuplicates(req.KeepID, req.DeleteIDs, userID)
+	merge := h.duplicates.MergeDuplicates
+	message := "Duplicates merged successfully"
+	if req.DryRun {
+		merge = h.duplicates.PlanMerge
+		message = "Dry run: nothing was changed"
+	}
+	result, err := merge(req.KeepID, req.DeleteIDs, userID)
 	if err != nil {
 		if err == storage.ErrNotOwner {
-			c.JSON(http.StatusForbidden, gin.H{"error": "You can only merge your own books"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can only merge your own books")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge duplicates"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to merge duplicates")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":       "Duplicates merged successfully",
+		"message":       message,
+		"dry_run":       req.DryRun,
 		"kept_book":     result.KeptBook,
 		"deleted_books": result.DeletedBooks,
+		"editions":      result.Editions,
 		"files_removed": result.FilesRemoved,
+		"changes":       result.Changes,
 	})
 }
 
@@ -2263,7 +2336,7 @@ func (h *Handler) GetBookReadStatus(c *gin.Context) {
 	// Verify book exists and user has access
 	book, err := h.db.GetBookForUser(id, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
@@ -2284,26 +2357,20 @@ func (h *Handler) UpdateBookReadStatus(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
+		apierror.Invalid(c, "status", "status is required")
 		return
 	}
 
 	// Validate status value
 	if req.Status != models.ReadStatusUnread && req.Status != models.ReadStatusReading && req.Status != models.ReadStatusCompleted {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be 'unread', 'reading', or 'completed'"})
+		apierror.Invalid(c, "status", "Invalid status. Must be 'unread', 'reading', or 'completed'")
 		return
 	}
 
 	// Verify book exists and user has access
 	book, err := h.db.GetBookForUser(id, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-
-	// Check ownership for modification
-	if book.UserID != "" && book.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only update status for your own books"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
@@ -2314,11 +2381,22 @@ func (h *Handler) UpdateBookReadStatus(c *gin.Context) {
 		dateCompleted = &now
 	}
 
-	if err := h.db.UpdateBookReadStatus(id, req.Status, dateCompleted); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update read status"})
+	// Status is tracked per user, so shared books can be updated too
+	if err := h.db.UpdateBookReadStatus(userID, book.ID, req.Status, dateCompleted); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update read status")
 		return
 	}
 
+	if req.Status == models.ReadStatusCompleted {
+		h.recordActivity(userID, models.ActivityBookFinished, book.ID, 0)
+		h.achievements.Check(userID)
+	} else {
+		h.clearActivity(userID, models.ActivityBookFinished, book.ID)
+	}
+	if req.Status != book.ReadStatus {
+		h.publishReadStatus(userID, book.ID, req.Status, dateCompleted)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":        "Read status updated",
 		"book_id":        id,
@@ -2333,54 +2411,73 @@ func (h *Handler) GetReadStatusCounts(c *gin.Context) {
 
 	counts, err := h.db.GetReadStatusCounts(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get status counts"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get status counts")
 		return
 	}
 
 	c.JSON(http.StatusOK, counts)
 }
 
-// BulkUpdateReadStatus updates read status for multiple books
+// BulkUpdateReadStatus updates read status for multiple books. A dry run
+// returns the books whose status would change without changing them.
 func (h *Handler) BulkUpdateReadStatus(c *gin.Context) {
 	userID := auth.GetUserID(c)
 
 	var req struct {
 		BookIDs []string `json:"book_ids" binding:"required"`
 		Status  string   `json:"status" binding:"required"`
+		DryRun  bool     `json:"dry_run"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "book_ids and status are required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "book_ids and status are required")
 		return
 	}
 
 	// Validate status value
 	if req.Status != models.ReadStatusUnread && req.Status != models.ReadStatusReading && req.Status != models.ReadStatusCompleted {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be 'unread', 'reading', or 'completed'"})
+		apierror.Invalid(c, "status", "Invalid status. Must be 'unread', 'reading', or 'completed'")
 		return
 	}
 
 	// Limit batch size
 	if len(req.BookIDs) > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Maximum 100 books per batch"})
+		apierror.Invalid(c, "book_ids", "Maximum 100 books per batch")
 		return
 	}
 
-	// Verify ownership of all books
+	// Verify access to all books
 	var validBookIDs []string
+	changes := []models.BookChange{}
 	for _, bookID := range req.BookIDs {
 		book, err := h.db.GetBookForUser(bookID, userID)
 		if err != nil {
 			continue // Skip books that don't exist or user doesn't have access to
 		}
-		// Only allow updating own books
-		if book.UserID == "" || book.UserID == userID {
-			validBookIDs = append(validBookIDs, bookID)
+		validBookIDs = append(validBookIDs, bookID)
+		if book.ReadStatus != req.Status {
+			changes = append(changes, models.BookChange{
+				BookID: book.ID,
+				Title:  book.Title,
+				Fields: []models.FieldChange{{Field: "read_status", Old: book.ReadStatus, New: req.Status}},
+			})
 		}
 	}
 
 	if len(validBookIDs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid books to update"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "No valid books to update")
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"message":         "Dry run: nothing was changed",
+			"dry_run":         true,
+			"updated_count":   len(validBookIDs),
+			"requested_count": len(req.BookIDs),
+			"status":          req.Status,
+			"changes":         changes,
+		})
 		return
 	}
 
@@ -2391,16 +2488,31 @@ func (h *Handler) BulkUpdateReadStatus(c *gin.Context) {
 		dateCompleted = &now
 	}
 
-	if err := h.db.BulkUpdateBookReadStatus(validBookIDs, req.Status, dateCompleted); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update read status"})
+	if err := h.db.BulkUpdateBookReadStatus(userID, validBookIDs, req.Status, dateCompleted); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update read status")
 		return
 	}
 
+	for _, bookID := range validBookIDs {
+		if req.Status == models.ReadStatusCompleted {
+			h.recordActivity(userID, models.ActivityBookFinished, bookID, 0)
+		} else {
+			h.clearActivity(userID, models.ActivityBookFinished, bookID)
+		}
+	}
+	if req.Status == models.ReadStatusCompleted {
+		h.achievements.Check(userID)
+	}
+	for _, change := range changes {
+		h.publishReadStatus(userID, change.BookID, req.Status, dateCompleted)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":         "Read status updated",
 		"updated_count":   len(validBookIDs),
 		"requested_count": len(req.BookIDs),
 		"status":          req.Status,
+		"changes":         changes,
 	})
 }
 
@@ -2421,7 +2533,7 @@ func (h *Handler) GetBookRating(c *gin.Context) {
 	}
 
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
@@ -2441,32 +2553,33 @@ func (h *Handler) UpdateBookRating(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "rating is required"})
+		apierror.Invalid(c, "rating", "rating is required")
 		return
 	}
 
 	// Validate rating range (0-5)
 	if req.Rating < 0 || req.Rating > 5 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Rating must be between 0 and 5"})
+		apierror.Invalid(c, "rating", "Rating must be between 0 and 5")
 		return
 	}
 
 	// Verify book exists and user has access
 	book, err := h.db.GetBookForUser(id, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
-	// Check ownership for modification
-	if book.UserID != "" && book.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You can only rate your own books"})
+	// Ratings are per user, so shared books can be rated too
+	if err := h.db.UpdateBookRating(userID, book.ID, req.Rating); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update rating")
 		return
 	}
 
-	if err := h.db.UpdateBookRating(id, req.Rating); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rating"})
-		return
+	if req.Rating > 0 {
+		h.recordActivity(userID, models.ActivityBookRated, book.ID, req.Rating)
+	} else {
+		h.clearActivity(userID, models.ActivityBookRated, book.ID)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -2482,7 +2595,7 @@ func (h *Handler) UpdateBookRating(c *gin.Context) {
 func (h *Handler) ListReadingLists(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -2493,7 +2606,7 @@ func (h *Handler) ListReadingLists(c *gin.Context) {
 
 	lists, err := h.db.ListReadingLists(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading lists"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading lists")
 		return
 	}
 
@@ -2512,30 +2625,33 @@ func (h *Handler) GetReadingList(c *gin.Context) {
 	id := c.Param("id")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	list, err := h.db.GetReadingList(id)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	// Verify ownership
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	// Get books in the list
 	books, err := h.db.GetBooksInReadingList(id)
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
 		return
 	}
 
@@ -2553,7 +2669,7 @@ func (h *Handler) GetReadingList(c *gin.Context) {
 func (h *Handler) CreateReadingList(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -2562,7 +2678,7 @@ func (h *Handler) CreateReadingList(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		apierror.Invalid(c, "name", "name is required")
 		return
 	}
 
@@ -2575,7 +2691,7 @@ func (h *Handler) CreateReadingList(c *gin.Context) {
 	}
 
 	if err := h.db.CreateReadingList(list); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create reading list")
 		return
 	}
 
@@ -2590,7 +2706,7 @@ func (h *Handler) UpdateReadingList(c *gin.Context) {
 	id := c.Param("id")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -2599,28 +2715,28 @@ func (h *Handler) UpdateReadingList(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		apierror.Invalid(c, "name", "name is required")
 		return
 	}
 
 	// Verify list exists and user owns it
 	list, err := h.db.GetReadingList(id)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	if err := h.db.UpdateReadingList(id, req.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update reading list")
 		return
 	}
 
@@ -2636,36 +2752,37 @@ func (h *Handler) DeleteReadingList(c *gin.Context) {
 	id := c.Param("id")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Verify list exists and user owns it
 	list, err := h.db.GetReadingList(id)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	// Don't allow deleting system lists
 	if list.ListType != models.ReadingListCustom {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete system reading lists"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot delete system reading lists")
 		return
 	}
 
 	if err := h.db.DeleteReadingList(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete reading list")
 		return
 	}
+	h.files.DeleteMosaics(mosaicReadingList, id)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Reading list deleted",
@@ -2678,39 +2795,39 @@ func (h *Handler) AddBookToReadingList(c *gin.Context) {
 	bookID := c.Param("bookId")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Verify list exists and user owns it
 	list, err := h.db.GetReadingList(listID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	// Verify book exists and user has access
 	_, err = h.db.GetBookForUser(bookID, userID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
 		return
 	}
 
 	if err := h.db.AddBookToReadingList(bookID, listID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add book to list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add book to list")
 		return
 	}
 
@@ -2727,28 +2844,28 @@ func (h *Handler) RemoveBookFromReadingList(c *gin.Context) {
 	bookID := c.Param("bookId")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Verify list exists and user owns it
 	list, err := h.db.GetReadingList(listID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	if err := h.db.RemoveBookFromReadingList(bookID, listID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove book from list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove book from list")
 		return
 	}
 
@@ -2764,24 +2881,18 @@ func (h *Handler) GetBookReadingLists(c *gin.Context) {
 	bookID := c.Param("id")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Verify book exists and user has access
-	_, err := h.db.GetBookForUser(bookID, userID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	if _, ok := h.authorizedBook(c, authz.Read); !ok {
 		return
 	}
 
 	lists, err := h.db.GetReadingListsForBook(bookID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading lists"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading lists")
 		return
 	}
 
@@ -2801,54 +2912,54 @@ func (h *Handler) ToggleBookInReadingList(c *gin.Context) {
 	bookID := c.Param("bookId")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	// Verify list exists and user owns it
 	list, err := h.db.GetReadingList(listID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	// Verify book exists and user has access
 	_, err = h.db.GetBookForUser(bookID, userID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
 		return
 	}
 
 	// Check if book is already in the list
 	inList, err := h.db.IsBookInReadingList(bookID, listID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check list membership"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check list membership")
 		return
 	}
 
 	var action string
 	if inList {
 		if err := h.db.RemoveBookFromReadingList(bookID, listID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove book from list"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove book from list")
 			return
 		}
 		action = "removed"
 	} else {
 		if err := h.db.AddBookToReadingList(bookID, listID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add book to list"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add book to list")
 			return
 		}
 		action = "added"
@@ -2868,7 +2979,7 @@ func (h *Handler) ReorderReadingList(c *gin.Context) {
 	listID := c.Param("id")
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -2877,28 +2988,28 @@ func (h *Handler) ReorderReadingList(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "book_ids is required"})
+		apierror.Invalid(c, "book_ids", "book_ids is required")
 		return
 	}
 
 	// Verify list exists and user owns it
 	list, err := h.db.GetReadingList(listID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
 		return
 	}
 
 	if list.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	if err := h.db.ReorderReadingList(listID, req.BookIDs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder reading list"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to reorder reading list")
 		return
 	}
 
@@ -2914,13 +3025,13 @@ func (h *Handler) ReorderReadingList(c *gin.Context) {
 func (h *Handler) ListTags(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	tags, err := h.db.ListTags(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
 		return
 	}
 
@@ -2938,7 +3049,7 @@ func (h *Handler) ListTags(c *gin.Context) {
 func (h *Handler) CreateTag(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -2948,14 +3059,14 @@ func (h *Handler) CreateTag(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		apierror.Invalid(c, "name", "Name is required")
 		return
 	}
 
 	// Validate name
 	req.Name = strings.TrimSpace(req.Name)
 	if req.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Tag name cannot be empty"})
+		apierror.Invalid(c, "name", "Tag name cannot be empty")
 		return
 	}
 
@@ -2967,7 +3078,7 @@ func (h *Handler) CreateTag(c *gin.Context) {
 	// Check if tag already exists
 	existing, _ := h.db.GetTagByName(userID, req.Name)
 	if existing != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Tag already exists", "tag": existing})
+		apierror.RespondWith(c, http.StatusConflict, apierror.CodeAlreadyExists, "Tag already exists", gin.H{"tag": existing})
 		return
 	}
 
@@ -2980,7 +3091,7 @@ func (h *Handler) CreateTag(c *gin.Context) {
 	}
 
 	if err := h.db.CreateTag(tag); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create tag")
 		return
 	}
 
@@ -2994,24 +3105,24 @@ func (h *Handler) CreateTag(c *gin.Context) {
 func (h *Handler) GetTag(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	tagID := c.Param("id")
 	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	// Verify ownership
 	if tag.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
@@ -3022,24 +3133,24 @@ func (h *Handler) GetTag(c *gin.Context) {
 func (h *Handler) UpdateTag(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	tagID := c.Param("id")
 	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	// Verify ownership
 	if tag.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
@@ -3049,7 +3160,7 @@ func (h *Handler) UpdateTag(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		apierror.BindFailed(c, err, "Invalid request")
 		return
 	}
 
@@ -3067,13 +3178,13 @@ func (h *Handler) UpdateTag(c *gin.Context) {
 	if name != tag.Name {
 		existing, _ := h.db.GetTagByName(userID, name)
 		if existing != nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Tag with this name already exists"})
+			apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "Tag with this name already exists")
 			return
 		}
 	}
 
 	if err := h.db.UpdateTag(tagID, name, color); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update tag")
 		return
 	}
 
@@ -3090,31 +3201,32 @@ func (h *Handler) UpdateTag(c *gin.Context) {
 func (h *Handler) DeleteTag(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	tagID := c.Param("id")
 	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	// Verify ownership
 	if tag.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	if err := h.db.DeleteTag(tagID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete tag")
 		return
 	}
+	h.files.DeleteMosaics(mosaicTag, tagID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Tag deleted",
@@ -3126,20 +3238,15 @@ func (h *Handler) DeleteTag(c *gin.Context) {
 func (h *Handler) GetBookTags(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	bookID := c.Param("id")
-
-	// Verify book exists and user has access
-	book, err := h.db.GetBookForUser(bookID, userID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	bookID := c.Param("id")
+
+	// Verify book exists and user has access
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
 
@@ -3147,14 +3254,15 @@ func (h *Handler) GetBookTags(c *gin.Context) {
 		// Check if shared
 		shared, _ := h.db.IsBookSharedWith(bookID, userID)
 		if !shared {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 			return
 		}
 	}
 
-	tags, err := h.db.GetBookTags(bookID)
+	// Tags are per user; other users' tags on a shared book aren't returned
+	tags, err := h.db.GetBookTags(bookID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
 		return
 	}
 
@@ -3173,47 +3281,36 @@ func (h *Handler) GetBookTags(c *gin.Context) {
 func (h *Handler) AddTagToBook(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	bookID := c.Param("id")
 	tagID := c.Param("tagId")
 
-	// Verify book exists and user owns it
-	book, err := h.db.GetBookForUser(bookID, userID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
-		return
-	}
-
-	if book.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Can only tag your own books"})
+	// Verify book exists and user has access (tags are per user, so shared books can be tagged)
+	if _, ok := h.authorizedBook(c, authz.Read); !ok {
 		return
 	}
 
 	// Verify tag exists and user owns it
 	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	if tag.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Can only use your own tags"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Can only use your own tags")
 		return
 	}
 
 	if err := h.db.AddTagToBook(bookID, tagID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add tag to book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add tag to book")
 		return
 	}
 
@@ -3228,31 +3325,36 @@ func (h *Handler) AddTagToBook(c *gin.Context) {
 func (h *Handler) RemoveTagFromBook(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	bookID := c.Param("id")
 	tagID := c.Param("tagId")
 
-	// Verify book exists and user owns it
-	book, err := h.db.GetBookForUser(bookID, userID)
+	// Verify book exists and user has access (tags are per user, so shared books can be tagged)
+	if _, ok := h.authorizedBook(c, authz.Read); !ok {
+		return
+	}
+
+	// Verify tag exists and user owns it
+	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
-	if book.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Can only modify tags on your own books"})
+	if tag.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Can only modify your own tags")
 		return
 	}
 
 	if err := h.db.RemoveTagFromBook(bookID, tagID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove tag from book"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove tag from book")
 		return
 	}
 
@@ -3267,48 +3369,37 @@ func (h *Handler) RemoveTagFromBook(c *gin.Context) {
 func (h *Handler) ToggleBookTag(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	bookID := c.Param("id")
 	tagID := c.Param("tagId")
 
-	// Verify book exists and user owns it
-	book, err := h.db.GetBookForUser(bookID, userID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
-		return
-	}
-
-	if book.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Can only tag your own books"})
+	// Verify book exists and user has access (tags are per user, so shared books can be tagged)
+	if _, ok := h.authorizedBook(c, authz.Read); !ok {
 		return
 	}
 
 	// Verify tag exists and user owns it
 	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	if tag.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Can only use your own tags"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Can only use your own tags")
 		return
 	}
 
 	inTag, err := h.db.ToggleBookTag(bookID, tagID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to toggle tag")
 		return
 	}
 
@@ -3323,7 +3414,7 @@ func (h *Handler) ToggleBookTag(c *gin.Context) {
 func (h *Handler) GetBooksByTag(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -3332,28 +3423,36 @@ func (h *Handler) GetBooksByTag(c *gin.Context) {
 	// Verify tag exists and user owns it
 	tag, err := h.db.GetTag(tagID)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tag"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
 		return
 	}
 
 	if tag.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 
 	books, err := h.db.GetBooksByTag(tagID)
+	var hidden map[string]bool
+	if err == nil {
+		hidden, err = h.db.HiddenBookIDs(userID)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
 		return
 	}
 
-	if books == nil {
-		books = []*models.Book{}
+	visible := []*models.Book{}
+	for _, b := range books {
+		if !hidden[b.ID] {
+			visible = append(visible, b)
+		}
 	}
+	books = visible
 
 	c.JSON(http.StatusOK, gin.H{
 		"tag":   tag,
@@ -3368,42 +3467,16 @@ func (h *Handler) GetBooksByTag(c *gin.Context) {
 func (h *Handler) ListAnnotationsForBook(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-
-	bookID := c.Param("id")
-
-	// Verify book exists and user has access
-	book, err := h.db.GetBook(bookID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
-		return
-	}
-
-	// Check access (owner or shared with)
-	if book.UserID != userID {
-		shared, _ := h.db.IsBookSharedWith(bookID, userID)
-		if !shared {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-			return
-		}
-	}
 
-	annotations, err := h.db.GetAnnotationsForBook(bookID, userID)
+	annotations, err := h.annotations.ListForBook(c.Param("id"), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotations"})
+		respondServiceError(c, err, "Failed to fetch annotations")
 		return
 	}
 
-	if annotations == nil {
-		annotations = []*models.Annotation{}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"annotations": annotations,
 		"count":       len(annotations),
@@ -3414,41 +3487,36 @@ func (h *Handler) ListAnnotationsForBook(c *gin.Context) {
 func (h *Handler) ListAnnotationsForChapter(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	bookID := c.Param("id")
-	chapter := c.Param("chapter")
-
-	// Verify book exists and user has access
-	book, err := h.db.GetBook(bookID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
+	annotations, err := h.annotations.ListForChapter(c.Param("id"), userID, c.Param("chapter"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		respondServiceError(c, err, "Failed to fetch annotations")
 		return
 	}
 
-	// Check access
-	if book.UserID != userID {
-		shared, _ := h.db.IsBookSharedWith(bookID, userID)
-		if !shared {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-			return
-		}
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"annotations": annotations,
+		"count":       len(annotations),
+	})
+}
 
-	annotations, err := h.db.GetAnnotationsForChapter(bookID, userID, chapter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotations"})
+// ListSharedAnnotationsForChapter returns the current user's annotations in
+// a chapter along with the shared annotations of everyone else who can read
+// the book, each with its author's username
+func (h *Handler) ListSharedAnnotationsForChapter(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	if annotations == nil {
-		annotations = []*models.Annotation{}
+	annotations, err := h.annotations.ListVisibleForChapter(c.Param("id"), userID, c.Param("chapter"))
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch annotations")
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -3461,32 +3529,10 @@ func (h *Handler) ListAnnotationsForChapter(c *gin.Context) {
 func (h *Handler) CreateAnnotation(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-		return
-	}
-
-	bookID := c.Param("id")
-
-	// Verify book exists and user has access
-	book, err := h.db.GetBook(bookID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	// Check access
-	if book.UserID != userID {
-		shared, _ := h.db.IsBookSharedWith(bookID, userID)
-		if !shared {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-			return
-		}
-	}
-
 	var req struct {
 		Chapter      string `json:"chapter" binding:"required"`
 		CFI          string `json:"cfi"`
@@ -3495,48 +3541,45 @@ func (h *Handler) CreateAnnotation(c *gin.Context) {
 		SelectedText string `json:"selected_text" binding:"required"`
 		Note         string `json:"note"`
 		Color        string `json:"color"`
+		Visibility   string `json:"visibility"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Chapter and selected_text are required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Chapter and selected_text are required")
 		return
 	}
 
-	// Validate color
-	validColors := map[string]bool{
-		models.HighlightColorYellow: true,
-		models.HighlightColorGreen:  true,
-		models.HighlightColorBlue:   true,
-		models.HighlightColorPink:   true,
-		models.HighlightColorOrange: true,
-	}
-	if req.Color == "" {
-		req.Color = models.HighlightColorYellow
-	} else if !validColors[req.Color] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid highlight color. Use: yellow, green, blue, pink, or orange"})
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
+	// In an EPUB a CFI sent decides the chapter, and without one it's
+	// worked out from the highlighted text
+	placed := &models.Annotation{Chapter: req.Chapter, CFI: req.CFI, StartOffset: req.StartOffset, SelectedText: req.SelectedText}
+	if err := h.positions.NormalizeAnnotation(book, placed); err != nil {
+		if req.CFI != "" && errors.Is(err, positions.ErrInvalidPosition) {
+			apierror.Invalid(c, "cfi", "CFI doesn't point into this book")
+			return
+		}
+		log.Printf("Warning: failed to place annotation in %s: %v", book.ID, err)
+		placed.Chapter, placed.CFI = req.Chapter, ""
+	}
 
-	now := time.Now()
-	annotation := &models.Annotation{
-		ID:           uuid.New().String(),
-		BookID:       bookID,
-		UserID:       userID,
-		Chapter:      req.Chapter,
-		CFI:          req.CFI,
+	annotation, err := h.annotations.Create(book.ID, userID, annotations.Input{
+		Chapter:      placed.Chapter,
+		CFI:          placed.CFI,
 		StartOffset:  req.StartOffset,
 		EndOffset:    req.EndOffset,
 		SelectedText: req.SelectedText,
 		Note:         req.Note,
 		Color:        req.Color,
-		CreatedAt:    now,
-		UpdatedAt:    now,
-	}
-
-	if err := h.db.CreateAnnotation(annotation); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create annotation"})
+		Visibility:   req.Visibility,
+	})
+	if err != nil {
+		respondServiceError(c, err, "Failed to create annotation")
 		return
 	}
+	h.achievements.Check(userID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":    "Annotation created",
@@ -3548,171 +3591,308 @@ func (h *Handler) CreateAnnotation(c *gin.Context) {
 func (h *Handler) GetAnnotation(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	annotation, err := h.annotations.Get(c.Param("annotationId"), userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch annotation")
 		return
 	}
 
-	annotationID := c.Param("annotationId")
+	c.JSON(http.StatusOK, annotation)
+}
 
-	annotation, err := h.db.GetAnnotation(annotationID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Annotation not found"})
+// GetAnnotationLocation resolves one of the user's annotations to the
+// chapter and the point in it where its highlighted text is, for opening
+// the reader at the highlight. The recorded chapter is searched first and
+// then those nearest it, so a highlight is still found after a file replace
+// renumbered the chapters; one found elsewhere is moved to that chapter.
+// Without the text in the book the recorded chapter is returned with found
+// false. The annotation's CFI is filled in when it had none.
+func (h *Handler) GetAnnotationLocation(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
 		return
 	}
+	annotation, err := h.annotations.Get(c.Param("annotationId"), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotation"})
+		respondServiceError(c, err, "Failed to fetch annotation")
 		return
 	}
-
-	// Verify ownership
-	if annotation.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	if annotation.BookID != book.ID {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeAnnotationNotFound, "Annotation not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, annotation)
+	chapter, _ := strconv.Atoi(annotation.Chapter)
+	location := &epub.TextLocation{Chapter: chapter}
+	found := false
+	if book.FileFormat == models.FileFormatEPUB && book.FilePath != "" {
+		loc, err := epub.LocateText(book.FilePath, annotation.SelectedText, chapter)
+		switch {
+		case err == nil:
+			location = loc
+			found = true
+		case !errors.Is(err, epub.ErrTextNotFound):
+			log.Printf("Warning: failed to locate annotation %s: %v", annotation.ID, err)
+		}
+	}
+	if found && location.Chapter != chapter {
+		if _, err := h.annotations.MoveToChapter(annotation.ID, userID, strconv.Itoa(location.Chapter)); err != nil {
+			log.Printf("Warning: failed to move annotation %s to chapter %d: %v", annotation.ID, location.Chapter, err)
+		}
+		// and its CFI, which pointed into the old chapter
+		annotation.Chapter, annotation.CFI = strconv.Itoa(location.Chapter), ""
+	}
+	if found && annotation.CFI == "" {
+		if err := h.positions.NormalizeAnnotation(book, annotation); err != nil {
+			log.Printf("Warning: failed to place annotation %s: %v", annotation.ID, err)
+		}
+		if err := h.db.SetAnnotationCFI(annotation.ID, annotation.CFI); err != nil {
+			log.Printf("Warning: failed to save CFI of annotation %s: %v", annotation.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"annotation_id": annotation.ID,
+		"chapter":       location.Chapter,
+		"offset":        location.Offset,
+		"progress":      location.Progress,
+		"cfi":           annotation.CFI,
+		"found":         found,
+	})
 }
 
 // UpdateAnnotation updates an annotation's note and/or color
 func (h *Handler) UpdateAnnotation(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	annotationID := c.Param("annotationId")
+	var req struct {
+		Note       string `json:"note"`
+		Color      string `json:"color"`
+		Visibility string `json:"visibility"`
+	}
 
-	annotation, err := h.db.GetAnnotation(annotationID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Annotation not found"})
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
 		return
 	}
+
+	annotation, err := h.annotations.Update(c.Param("annotationId"), userID, req.Note, req.Color, req.Visibility)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotation"})
+		respondServiceError(c, err, "Failed to update annotation")
 		return
 	}
 
-	// Verify ownership
-	if annotation.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Annotation updated",
+		"annotation": annotation,
+	})
+}
+
+// DeleteAnnotation removes an annotation
+func (h *Handler) DeleteAnnotation(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	var req struct {
-		Note  string `json:"note"`
-		Color string `json:"color"`
+	if err := h.annotations.Delete(c.Param("annotationId"), userID); err != nil {
+		respondServiceError(c, err, "Failed to delete annotation")
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	c.JSON(http.StatusOK, gin.H{"message": "Annotation deleted"})
+}
+
+// ListAllAnnotations returns all annotations and book notes for the current
+// user, for export
+func (h *Handler) ListAllAnnotations(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	// Use existing values if not provided
-	note := req.Note
-	color := req.Color
-	if color == "" {
-		color = annotation.Color
-	} else {
-		// Validate color if provided
-		validColors := map[string]bool{
-			models.HighlightColorYellow: true,
-			models.HighlightColorGreen:  true,
-			models.HighlightColorBlue:   true,
-			models.HighlightColorPink:   true,
-			models.HighlightColorOrange: true,
-		}
-		if !validColors[color] {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid highlight color"})
-			return
-		}
+	annotations, err := h.annotations.ListAll(userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch annotations")
+		return
+	}
+
+	notes, err := h.annotations.ListAllNotes(userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch notes")
+		return
 	}
 
-	if err := h.db.UpdateAnnotation(annotationID, note, color); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update annotation"})
+	c.JSON(http.StatusOK, gin.H{
+		"annotations": annotations,
+		"count":       len(annotations),
+		"notes":       notes,
+	})
+}
+
+// ==================== Book Notes API ====================
+
+// ListBookNotes returns the current user's notes on a book
+func (h *Handler) ListBookNotes(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	annotation.Note = note
-	annotation.Color = color
-	annotation.UpdatedAt = time.Now()
+	notes, err := h.annotations.ListNotes(c.Param("id"), userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch notes")
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":    "Annotation updated",
-		"annotation": annotation,
+		"notes": notes,
+		"count": len(notes),
 	})
 }
 
-// DeleteAnnotation removes an annotation
-func (h *Handler) DeleteAnnotation(c *gin.Context) {
+// CreateBookNote adds a long-form Markdown note to a book
+func (h *Handler) CreateBookNote(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	annotationID := c.Param("annotationId")
+	var req struct {
+		Title string `json:"title"`
+		Body  string `json:"body" binding:"required"`
+	}
 
-	annotation, err := h.db.GetAnnotation(annotationID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Annotation not found"})
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "body", "body is required")
 		return
 	}
+
+	note, err := h.annotations.CreateNote(c.Param("id"), userID, req.Title, req.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotation"})
+		respondServiceError(c, err, "Failed to create note")
 		return
 	}
 
-	// Verify ownership
-	if annotation.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Note created",
+		"note":    note,
+	})
+}
+
+// GetBookNote returns a specific book note
+func (h *Handler) GetBookNote(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	if err := h.db.DeleteAnnotation(annotationID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete annotation"})
+	note, err := h.annotations.GetNote(c.Param("noteId"), userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch note")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Annotation deleted"})
+	c.JSON(http.StatusOK, note)
 }
 
-// ListAllAnnotations returns all annotations for the current user
-func (h *Handler) ListAllAnnotations(c *gin.Context) {
+// UpdateBookNote replaces a book note's title and body, keeping the
+// previous version in its history
+func (h *Handler) UpdateBookNote(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Title string `json:"title"`
+		Body  string `json:"body" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "body", "body is required")
 		return
 	}
 
-	annotations, err := h.db.GetAllAnnotationsForUser(userID)
+	note, err := h.annotations.UpdateNote(c.Param("noteId"), userID, req.Title, req.Body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotations"})
+		respondServiceError(c, err, "Failed to update note")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Note updated",
+		"note":    note,
+	})
+}
+
+// GetBookNoteRevisions returns the earlier versions of a book note
+func (h *Handler) GetBookNoteRevisions(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	if annotations == nil {
-		annotations = []*models.Annotation{}
+	revisions, err := h.annotations.NoteRevisions(c.Param("noteId"), userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch note revisions")
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"annotations": annotations,
-		"count":       len(annotations),
+		"revisions": revisions,
+		"count":     len(revisions),
 	})
 }
 
+// DeleteBookNote removes a book note and its history
+func (h *Handler) DeleteBookNote(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if err := h.annotations.DeleteNote(c.Param("noteId"), userID); err != nil {
+		respondServiceError(c, err, "Failed to delete note")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted"})
+}
+
 // GetAnnotationStats returns annotation statistics for the current user
 func (h *Handler) GetAnnotationStats(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	totalAnnotations, booksWithAnnotations, err := h.db.GetAnnotationStats(userID)
+	totalAnnotations, booksWithAnnotations, err := h.annotations.Stats(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch annotation stats"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch annotation stats")
 		return
 	}
 
@@ -3721,3 +3901,62 @@ func (h *Handler) GetAnnotationStats(c *gin.Context) {
 		"books_with_annotations": booksWithAnnotations,
 	})
 }
+
+// GetHighlightReview returns a few of the user's highlights to look back
+// on, spaced-repetition style: ones never reviewed come first, oldest
+// first, and each one reviewed comes back after a longer gap than the last
+func (h *Handler) GetHighlightReview(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if err != nil || limit <= 0 {
+		limit = 5
+	}
+	if limit > 50 {
+		limit = 50
+	}
+
+	highlights, err := h.annotations.ReviewFeed(userID, limit)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch highlights for review")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"highlights": highlights,
+		"count":      len(highlights),
+	})
+}
+
+// MarkHighlightsReviewed records that the user has seen highlights from
+// the review, so they're not shown again until they're next due
+func (h *Handler) MarkHighlightsReviewed(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		AnnotationIDs []string `json:"annotation_ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "annotation_ids", "annotation_ids must list at least one highlight")
+		return
+	}
+
+	reviews, err := h.annotations.MarkReviewed(req.AnnotationIDs, userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to mark highlights reviewed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"count":   len(reviews),
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/justyntemme/webby/internal/apierror"
 	"github.com/justyntemme/webby/internal/models"
 	"github.com/justyntemme/webby/internal/storage"
 )
@@ -360,6 +362,97 @@ func TestGetAnnotation_NotFound(t *testing.T) {
 	handler.GetAnnotation(c)
 
 	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var response apierror.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, apierror.CodeAnnotationNotFound, response.Code)
+	assert.Equal(t, "Annotation not found", response.Error)
+}
+
+func TestGetAnnotationLocation(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+
+	// The book's file was replaced with an edition that has a foreword
+	// before the chapter the highlight was made in
+	epubPath := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(epubPath)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"META-INF/container.xml": `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"content.opf": `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Book</dc:title></metadata>
+  <manifest>
+    <item id="foreword" href="foreword.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="foreword"/><itemref idref="ch1"/></spine>
+</package>`,
+		"foreword.xhtml": `<html><body><p>A foreword.</p></body></html>`,
+		"ch1.xhtml":      `<html><body><p>Call me Ishmael. Some years ago, never mind how long precisely.</p></body></html>`,
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	now := time.Now()
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Book", FilePath: epubPath,
+		FileFormat: models.FileFormatEPUB, UploadedAt: now}
+	require.NoError(t, handler.db.CreateBook(book))
+	ann := &models.Annotation{ID: uuid.New().String(), BookID: book.ID, UserID: userID, Chapter: "0",
+		SelectedText: "Some years ago", Color: models.HighlightColorYellow, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, handler.db.CreateAnnotation(ann))
+
+	locate := func(annotationID string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{
+			{Key: "id", Value: book.ID},
+			{Key: "annotationId", Value: annotationID},
+		}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/annotations/"+annotationID+"/location", nil)
+		handler.GetAnnotationLocation(c)
+		return w
+	}
+
+	w := locate(ann.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var location struct {
+		Chapter  int     `json:"chapter"`
+		Offset   int     `json:"offset"`
+		Progress float64 `json:"progress"`
+		Found    bool    `json:"found"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &location))
+	assert.True(t, location.Found)
+	assert.Equal(t, 1, location.Chapter)
+	assert.Equal(t, len("Call me Ishmael. "), location.Offset)
+	assert.Greater(t, location.Progress, 0.0)
+
+	moved, err := handler.db.GetAnnotation(ann.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "1", moved.Chapter, "the highlight now shows in the chapter it's in")
+	assert.Equal(t, "epubcfi(/6/4[ch1]!/4/2/1:17)", moved.CFI, "and has a CFI there")
+
+	// Text no longer in the book falls back to the recorded chapter
+	removed := &models.Annotation{ID: uuid.New().String(), BookID: book.ID, UserID: userID, Chapter: "0",
+		SelectedText: "Removed text", Color: models.HighlightColorYellow, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, handler.db.CreateAnnotation(removed))
+	w = locate(removed.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &location))
+	assert.False(t, location.Found)
+	assert.Equal(t, 0, location.Chapter)
+	assert.Zero(t, location.Offset)
+
+	assert.Equal(t, http.StatusNotFound, locate("missing").Code)
 }
 
 func TestUpdateAnnotation(t *testing.T) {
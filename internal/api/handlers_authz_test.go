@@ -0,0 +1,315 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// createNamedUser creates a user with the given username and returns the ID
+func createNamedUser(t *testing.T, handler *Handler, username string) string {
+	user := &models.User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		Email:        username + "@example.com",
+		PasswordHash: "hashedpassword",
+		CreatedAt:    time.Now(),
+	}
+	require.NoError(t, handler.db.CreateUser(user))
+	return user.ID
+}
+
+func TestRequireBook(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	friendID := createNamedUser(t, handler, "friend")
+	strangerID := createNamedUser(t, handler, "stranger")
+	bookID := setupTestBook(t, handler, ownerID)
+	require.NoError(t, handler.db.ShareBook(bookID, ownerID, friendID))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if userID := c.GetHeader("X-Test-User"); userID != "" {
+			c.Set("user_id", userID)
+		}
+	})
+	r.GET("/books/:id", handler.RequireBook(authz.Read), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	r.PUT("/books/:id", handler.RequireBook(authz.Write), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	do := func(method, path, userID string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if userID != "" {
+			req.Header.Set("X-Test-User", userID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		userID string
+		want   int
+	}{
+		{"owner reads", http.MethodGet, ownerID, http.StatusNoContent},
+		{"owner writes", http.MethodPut, ownerID, http.StatusNoContent},
+		{"shared user reads", http.MethodGet, friendID, http.StatusNoContent},
+		{"shared user can't write", http.MethodPut, friendID, http.StatusForbidden},
+		{"stranger can't see", http.MethodGet, strangerID, http.StatusNotFound},
+		{"stranger can't write", http.MethodPut, strangerID, http.StatusNotFound},
+		{"anonymous can't see", http.MethodGet, "", http.StatusNotFound},
+		{"anonymous can't write", http.MethodPut, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, do(tt.method, "/books/"+bookID, tt.userID))
+		})
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/books/missing", ownerID))
+}
+
+func TestBookLookedUpOncePerRequest(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	bookID := setupTestBook(t, handler, userID)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	group := r.Group("/api")
+	group.Use(handler.TrackLibraryWrites())
+	var fetched *models.Book
+	group.PUT("/books/:id", func(c *gin.Context) {
+		// Later lookups are answered without the database
+		fetched, _ = handler.lookupBook(c)
+		require.NoError(t, handler.db.DeleteBook(bookID))
+		c.Next()
+	}, handler.RequireBook(authz.Write), func(c *gin.Context) {
+		book, ok := handler.authorizedBook(c, authz.Read)
+		require.True(t, ok)
+		assert.Same(t, fetched, book)
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/books/"+bookID, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	require.NotNil(t, fetched)
+	assert.Equal(t, bookID, fetched.ID)
+}
+
+func TestGetBookUsesCheckedBook(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	friendID := createNamedUser(t, handler, "friend")
+	bookID := setupTestBook(t, handler, ownerID)
+	require.NoError(t, handler.db.ShareBook(bookID, ownerID, friendID))
+	require.NoError(t, handler.db.UpdateBookRating(ownerID, bookID, 2))
+	require.NoError(t, handler.db.UpdateBookRating(friendID, bookID, 5))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.GET("/books/:id", handler.RequireBook(authz.Read), func(c *gin.Context) {
+		// The handler must not fetch the book again
+		require.NoError(t, handler.db.UpdateBookLanguage(bookID, "fr"))
+	}, handler.GetBook)
+
+	req := httptest.NewRequest(http.MethodGet, "/books/"+bookID, nil)
+	req.Header.Set("X-Test-User", friendID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Empty(t, book.Language, "the book checked by RequireBook is served")
+	assert.Equal(t, 5, book.Rating, "the user's own rating, not the owner's")
+}
+
+func TestDeleteBookRequiresWriteAccess(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	friendID := createNamedUser(t, handler, "friend")
+	bookID := setupTestBook(t, handler, ownerID)
+	require.NoError(t, handler.db.ShareBook(bookID, ownerID, friendID))
+
+	// Called without the route policy, the handler still enforces it
+	c, w := createAuthenticatedContext(friendID)
+	c.Params = gin.Params{{Key: "id", Value: bookID}}
+	c.Request = httptest.NewRequest(http.MethodDelete, "/api/books/"+bookID, strings.NewReader(""))
+	handler.DeleteBook(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	_, err := handler.db.GetBook(bookID)
+	assert.NoError(t, err, "book should not be deleted")
+}
+
+func TestRestoreBookData(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	friendID := createNamedUser(t, handler, "friend")
+	bookID := setupTestBook(t, handler, ownerID)
+	require.NoError(t, handler.db.UpdateBookFileHash(bookID, "same-file"))
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: bookID, UserID: ownerID, Chapter: "7", Position: 0.25}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.DELETE("/books/:id", handler.DeleteBook)
+	r.POST("/books/:id/restore", handler.RestoreBookData)
+	do := func(method, path, userID string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Test-User", userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, do(http.MethodDelete, "/books/"+bookID, ownerID))
+
+	// The same file is uploaded again
+	newID := setupTestBook(t, handler, ownerID)
+	require.NoError(t, handler.db.UpdateBookFileHash(newID, "same-file"))
+	require.NoError(t, handler.db.ShareBook(newID, ownerID, friendID))
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/books/"+newID+"/restore", friendID))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/books/"+newID+"/restore", ownerID))
+	pos, err := handler.db.GetReadingPosition(newID, ownerID)
+	require.NoError(t, err)
+	assert.Equal(t, "7", pos.Chapter)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/books/"+newID+"/restore", ownerID), "nothing left to restore")
+}
+
+func TestReadingEndpointsEnforceBookAccess(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	friendID := createNamedUser(t, handler, "friend")
+	strangerID := createNamedUser(t, handler, "stranger")
+	bookID := setupTestBook(t, handler, ownerID)
+	require.NoError(t, handler.db.ShareBook(bookID, ownerID, friendID))
+
+	// Registered without the route policy so the handlers' own checks are tested
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.GET("/books/:id/cover", handler.GetBookCover)
+	r.GET("/books/:id/toc", handler.GetTableOfContents)
+	r.GET("/books/:id/content/:chapter", handler.GetChapterContent)
+	r.GET("/books/:id/resource/*path", handler.GetBookResource)
+
+	paths := []string{"/cover", "/toc", "/content/0", "/resource/images/cover.png"}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			get := func(userID string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/books/"+bookID+path, nil)
+				req.Header.Set("X-Test-User", userID)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			for _, userID := range []string{strangerID, ""} {
+				w := get(userID)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+				assert.Contains(t, w.Body.String(), "BOOK_NOT_FOUND")
+			}
+
+			// The test book has no cover or file, so allowed requests fail
+			// later, but not on access
+			for _, userID := range []string{ownerID, friendID} {
+				assert.NotContains(t, get(userID).Body.String(), "BOOK_NOT_FOUND")
+			}
+		})
+	}
+}
+
+func TestTransferBook(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	newOwnerID := createNamedUser(t, handler, "newowner")
+	friendID := createNamedUser(t, handler, "friend")
+	adminID := createNamedUser(t, handler, "admin")
+	handler.SetAdmins([]string{"admin"})
+
+	for _, id := range []string{"kept", "reset"} {
+		require.NoError(t, handler.db.CreateBook(&models.Book{
+			ID: id, UserID: ownerID, Title: id, FilePath: "/" + id + ".epub", UploadedAt: time.Now(),
+		}))
+		require.NoError(t, handler.db.ShareBook(id, ownerID, friendID))
+		require.NoError(t, handler.db.ShareBook(id, ownerID, newOwnerID))
+		require.NoError(t, handler.db.UpdateBookReadStatus(ownerID, id, models.ReadStatusReading, nil))
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.POST("/books/:id/transfer/:userId", handler.TransferBook)
+	do := func(path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, do("/books/kept/transfer/"+friendID, friendID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do("/books/kept/transfer/missing", ownerID, "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("/books/kept/transfer/"+ownerID, ownerID, "").Code)
+
+	w := do("/books/kept/transfer/"+newOwnerID, ownerID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	book, err := handler.db.GetBook("kept")
+	require.NoError(t, err)
+	assert.Equal(t, newOwnerID, book.UserID)
+	assert.Equal(t, models.ReadStatusReading, book.ReadStatus, "read state moves with the book")
+
+	shares, err := handler.db.GetBookShares("kept")
+	require.NoError(t, err)
+	require.Len(t, shares, 1, "the new owner's own share is dropped")
+	assert.Equal(t, friendID, shares[0].ID)
+	shared, err := handler.db.GetSharedBooks(friendID)
+	require.NoError(t, err)
+	assert.Len(t, shared, 2)
+
+	// Admins may transfer books they don't own
+	w = do("/books/reset/transfer/"+newOwnerID, adminID, `{"reset_read_state":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	book, err = handler.db.GetBook("reset")
+	require.NoError(t, err)
+	assert.Equal(t, newOwnerID, book.UserID)
+	assert.Equal(t, models.ReadStatusUnread, book.ReadStatus)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryETag(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	bookID := setupTestBook(t, handler, userID)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	api := r.Group("/api")
+	api.Use(handler.TrackLibraryWrites())
+	api.GET("/books", handler.LibraryETag(), handler.ListBooks)
+	api.PUT("/books/:id/rating", handler.UpdateBookRating)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/books", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Unchanged library
+	w := get(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// A failed write doesn't change the revision
+	req := httptest.NewRequest(http.MethodPut, "/api/books/"+bookID+"/rating", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, http.StatusNotModified, get(etag).Code)
+
+	// A successful write does
+	req = httptest.NewRequest(http.MethodPut, "/api/books/"+bookID+"/rating", strings.NewReader(`{"rating": 4}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	w = get(etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestEtagMatches(t *testing.T) {
+	assert.True(t, etagMatches(`W/"1-ab"`, `W/"1-ab"`))
+	assert.True(t, etagMatches(`"1-ab"`, `W/"1-ab"`))
+	assert.True(t, etagMatches(`"x", W/"1-ab"`, `W/"1-ab"`))
+	assert.True(t, etagMatches(`*`, `W/"1-ab"`))
+	assert.False(t, etagMatches(``, `W/"1-ab"`))
+	assert.False(t, etagMatches(`W/"2-ab"`, `W/"1-ab"`))
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestRoutes registers a few documented routes and one undocumented
+// route with a router and records them on the handler
+func setupTestRoutes(handler *Handler) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api", handler.APIInfo)
+	r.GET("/api/books/:id", handler.GetBook)
+	r.GET("/api/books/:id/resource/*path", handler.GetBookResource)
+	r.POST("/api/books", handler.UploadBook)
+	r.GET("/api/reader/preferences", handler.GetReaderPreferences)
+	r.GET("/api/undocumented/:id", handler.HealthCheck)
+	r.GET("/opds/v1.2/catalog.xml", handler.OPDSCatalog)
+	handler.SetRoutes(r.Routes())
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	setupTestRoutes(handler)
+
+	c, w := createAuthenticatedContext("")
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	handler.OpenAPISpec(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Summary     string `json:"summary"`
+			Parameters  []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			RequestBody map[string]any   `json:"requestBody"`
+			Responses   map[string]any   `json:"responses"`
+			Security    []map[string]any `json:"security"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec.OpenAPI)
+
+	// Only registered API routes are published
+	assert.Len(t, spec.Paths, 6)
+	assert.NotContains(t, spec.Paths, "/api/openapi.json")
+	assert.NotContains(t, spec.Paths, "/opds/v1.2/catalog.xml")
+
+	getBook := spec.Paths["/api/books/{id}"]["get"]
+	assert.Equal(t, "GetBook", getBook.OperationID)
+	assert.Equal(t, "Get book by ID", getBook.Summary)
+	require.Len(t, getBook.Parameters, 1)
+	assert.Equal(t, "id", getBook.Parameters[0].Name)
+	assert.Equal(t, "path", getBook.Parameters[0].In)
+	assert.Len(t, getBook.Security, 2, "optional auth allows anonymous access")
+	assert.Contains(t, spec.Components.Schemas, "Book")
+	assert.Contains(t, spec.Components.Schemas["Book"].Properties, "title")
+
+	resource := spec.Paths["/api/books/{id}/resource/{path}"]["get"]
+	assert.Len(t, resource.Parameters, 2)
+
+	upload := spec.Paths["/api/books"]["post"]
+	assert.Contains(t, upload.Responses, "201")
+	assert.Contains(t, upload.RequestBody["content"], "multipart/form-data")
+
+	prefs := spec.Paths["/api/reader/preferences"]["get"]
+	require.Len(t, prefs.Security, 1)
+	assert.Contains(t, prefs.Security[0], "bearerAuth")
+	assert.Contains(t, spec.Components.Schemas, "ReaderPreferences")
+
+	undocumented := spec.Paths["/api/undocumented/{id}"]["get"]
+	assert.Equal(t, "HealthCheck", undocumented.OperationID)
+	assert.Equal(t, "Health check", undocumented.Summary)
+}
+
+func TestAPIInfoUsesRegisteredRoutes(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	setupTestRoutes(handler)
+
+	c, w := createAuthenticatedContext("")
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api", nil)
+	handler.APIInfo(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		OpenAPI   string           `json:"openapi"`
+		Endpoints []map[string]any `json:"endpoints"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "/api/openapi.json", response.OpenAPI)
+	require.Len(t, response.Endpoints, 6)
+	assert.Equal(t, "/api", response.Endpoints[0]["path"])
+	assert.Equal(t, "/api/undocumented/:id", response.Endpoints[5]["path"])
+}
+
+func TestAPIRouteDocsUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, group := range apiRoutes {
+		for _, doc := range group.Routes {
+			key := routeKey(doc.Method, doc.Path)
+			assert.False(t, seen[key], "%s documented twice", key)
+			seen[key] = true
+		}
+	}
+}
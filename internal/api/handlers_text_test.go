@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetChapterTextChunks(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	book := createTestEPUBBook(t, handler, userID, "<p>One two three.</p>\n<p>Four five six.</p>")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: book.ID}, {Key: "chapter", Value: "0"}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/text/0"+query, nil)
+		handler.GetChapterText(c)
+		return w
+	}
+
+	type chunk struct {
+		Content     string `json:"content"`
+		Offset      int    `json:"offset"`
+		TotalLength int    `json:"total_length"`
+		Breaks      []int  `json:"breaks"`
+		NextOffset  *int   `json:"next_offset"`
+	}
+	var text string
+	offset := 0
+	for i := 0; ; i++ {
+		require.Less(t, i, 10)
+		w := get("?limit=20&offset=" + strconv.Itoa(offset))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp chunk
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, offset, resp.Offset)
+		assert.Equal(t, 29, resp.TotalLength)
+		text += resp.Content
+		if resp.NextOffset == nil {
+			break
+		}
+		if i == 0 {
+			assert.Equal(t, "One two three. ", resp.Content, "the chunk ends where the next paragraph starts")
+		}
+		offset = *resp.NextOffset
+	}
+	assert.Equal(t, "One two three. Four five six.", text, "the chunks join up")
+
+	assert.Equal(t, http.StatusBadRequest, get("?limit=0").Code)
+	assert.Equal(t, http.StatusBadRequest, get("?offset=-1").Code)
+}
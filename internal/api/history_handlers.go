@@ -0,0 +1,128 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Metadata History Handlers ====================
+
+// saveBookMetadata saves a book's metadata, recording the fields that
+// changed as a revision by userID from book.MetadataSource
+func (h *Handler) saveBookMetadata(book *models.Book, userID string) error {
+	_, err := h.reviseBookMetadata(book, userID, 0)
+	return err
+}
+
+// reviseBookMetadata saves a book's metadata and returns the revision it
+// recorded, or nil if no field changed. revertOf is the revision being
+// reverted, if any. A revision that fails to save is logged rather than
+// failing the update.
+func (h *Handler) reviseBookMetadata(book *models.Book, userID string, revertOf int) (*models.MetadataRevision, error) {
+	old, err := h.db.GetBook(book.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.db.UpdateBookMetadata(book); err != nil {
+		return nil, err
+	}
+
+	changes := books.MetadataChanges(old, book)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	rev := &models.MetadataRevision{
+		BookID:    book.ID,
+		UserID:    userID,
+		Source:    book.MetadataSource,
+		Changes:   changes,
+		RevertOf:  revertOf,
+		CreatedAt: time.Now(),
+	}
+	if err := h.db.AddMetadataRevision(rev); err != nil {
+		log.Printf("Warning: failed to record metadata revision for book %s: %v", book.ID, err)
+		return nil, nil
+	}
+	return rev, nil
+}
+
+// GetBookHistory returns a book's metadata revisions, newest first
+func (h *Handler) GetBookHistory(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+
+	revs, err := h.db.ListMetadataRevisions(book.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch metadata history")
+		return
+	}
+	if revs == nil {
+		revs = []*models.MetadataRevision{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revisions": revs,
+		"count":     len(revs),
+	})
+}
+
+// RevertBookRevision sets the fields a revision changed back to the values
+// they had before it, recording the revert as a new revision
+func (h *Handler) RevertBookRevision(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+
+	revNum, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeRevisionNotFound, "Revision not found")
+		return
+	}
+	rev, err := h.db.GetMetadataRevision(book.ID, revNum)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeRevisionNotFound, "Revision not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch revision")
+		return
+	}
+
+	reverted := *book
+	books.RevertMetadataChanges(&reverted, rev.Changes)
+	reverted.MetadataSource = models.MetadataSourceRevert
+	now := time.Now()
+	reverted.MetadataUpdated = &now
+
+	if len(books.MetadataChanges(book, &reverted)) == 0 {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "The book already has the values this revision replaced")
+		return
+	}
+
+	userID := auth.GetUserID(c)
+	revision, err := h.reviseBookMetadata(&reverted, userID, rev.Revision)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update metadata")
+		return
+	}
+	h.syncSubjectTags(&reverted, userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"book":     &reverted,
+		"revision": revision,
+	})
+}
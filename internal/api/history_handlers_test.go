@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestBookHistoryRevert(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	bookID := setupTestBook(t, handler, userID)
+
+	// A manual edit, then a bad refresh
+	book, err := handler.db.GetBook(bookID)
+	require.NoError(t, err)
+	book.Publisher = "Ace"
+	book.MetadataSource = models.MetadataSourceManual
+	require.NoError(t, handler.saveBookMetadata(book, userID))
+	book.Author = "Wrong Author"
+	book.Publisher = "Wrong Publisher"
+	book.MetadataSource = "openlibrary"
+	require.NoError(t, handler.saveBookMetadata(book, userID))
+	require.NoError(t, handler.saveBookMetadata(book, userID), "an update changing nothing isn't recorded")
+
+	call := func(handle gin.HandlerFunc, method, rev string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: bookID}, {Key: "rev", Value: rev}}
+		c.Request, _ = http.NewRequest(method, "/api/books/"+bookID+"/history", nil)
+		handle(c)
+		return w
+	}
+
+	w := call(handler.GetBookHistory, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var history struct {
+		Revisions []models.MetadataRevision `json:"revisions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Revisions, 2)
+	assert.Equal(t, 2, history.Revisions[0].Revision, "newest first")
+	assert.Equal(t, "openlibrary", history.Revisions[0].Source)
+	assert.Equal(t, []models.FieldChange{
+		{Field: "author", Old: "Test Author", New: "Wrong Author"},
+		{Field: "publisher", Old: "Ace", New: "Wrong Publisher"},
+	}, history.Revisions[0].Changes)
+
+	w = call(handler.RevertBookRevision, http.MethodPost, "2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var reverted struct {
+		Book     models.Book             `json:"book"`
+		Revision models.MetadataRevision `json:"revision"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reverted))
+	assert.Equal(t, 3, reverted.Revision.Revision)
+	assert.Equal(t, 2, reverted.Revision.RevertOf)
+	assert.Equal(t, models.MetadataSourceRevert, reverted.Revision.Source)
+
+	saved, err := handler.db.GetBook(bookID)
+	require.NoError(t, err)
+	assert.Equal(t, "Test Author", saved.Author)
+	assert.Equal(t, "Ace", saved.Publisher, "the manual edit before the refresh is kept")
+
+	w = call(handler.RevertBookRevision, http.MethodPost, "2")
+	assert.Equal(t, http.StatusConflict, w.Code, "already reverted")
+	w = call(handler.RevertBookRevision, http.MethodPost, "9")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
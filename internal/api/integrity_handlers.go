@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// ==================== Integrity Handlers ====================
+
+// VerifyFiles queues a job re-hashing every book's file on disk and
+// comparing it with what's recorded, to find files that were corrupted,
+// edited outside webby, or removed. Admins only.
+func (h *Handler) VerifyFiles(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	bookIDs, err := h.db.ListBookIDsWithFiles()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+	if len(bookIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "No files to verify"})
+		return
+	}
+
+	job, err := h.jobs.Enqueue(auth.GetUserID(c), models.JobKindFileVerify, false, bookIDs)
+	if err != nil {
+		log.Printf("Failed to queue file verification: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to queue file verification")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "File verification queued",
+		"job":     job,
+	})
+}
+
+// GetIntegrity reports problems with the database, from SQLite's own
+// checks, and with book files, as found by the last verification. Admins
+// only.
+func (h *Handler) GetIntegrity(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	database, err := h.db.IntegrityCheck()
+	if err != nil {
+		log.Printf("Failed to check database integrity: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check database integrity")
+		return
+	}
+	if database == nil {
+		database = []string{}
+	}
+	files, err := h.db.ListFileProblems()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch file problems")
+		return
+	}
+	if files == nil {
+		files = []models.FileProblem{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       len(database) == 0 && len(files) == 0,
+		"database": database,
+		"files":    files,
+	})
+}
+
+// AcceptBookFile takes a book's file as it is now to be what it should be,
+// clearing a problem found by verification, as after deliberately editing
+// the file outside webby. Admins only.
+func (h *Handler) AcceptBookFile(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	book, err := h.db.GetBook(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+		return
+	}
+
+	info, err := os.Stat(book.FilePath)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeFileNotFound, "Book file not found")
+		return
+	}
+	hash, err := storage.HashFile(book.FilePath)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read book file")
+		return
+	}
+	if err := h.db.SetExpectedFile(book.ID, hash, info.Size()); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save file check")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File accepted"})
+}
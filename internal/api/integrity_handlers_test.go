@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+func TestVerifyFiles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	t.Cleanup(cleanup)
+	handler.SetAdmins([]string{"admin"})
+
+	adminID := createNamedUser(t, handler, "admin")
+	userID := setupTestUser(t, handler)
+
+	// Books whose files are intact, edited by webby, edited outside it,
+	// and gone
+	dir := t.TempDir()
+	books := map[string]*models.Book{}
+	for _, name := range []string{"intact", "rewritten", "edited", "gone"} {
+		path := filepath.Join(dir, name+".epub")
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+		book := &models.Book{ID: name, UserID: userID, Title: name, FilePath: path, FileSize: int64(len(name)),
+			FileHash: storage.HashBytes([]byte(name)), FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}
+		require.NoError(t, handler.db.CreateBook(book))
+		books[name] = book
+	}
+	require.NoError(t, os.WriteFile(books["rewritten"].FilePath, []byte("new metadata"), 0644))
+	handler.recordFileWrite(books["rewritten"])
+	require.NoError(t, os.WriteFile(books["edited"].FilePath, []byte("tampered"), 0644))
+	require.NoError(t, os.Remove(books["gone"].FilePath))
+
+	c, w := createAuthenticatedContext(userID)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/admin/files/verify", nil)
+	handler.VerifyFiles(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	c, w = createAuthenticatedContext(adminID)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/admin/files/verify", nil)
+	handler.VerifyFiles(c)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued struct {
+		Job models.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+
+	startJobQueue(t, handler)
+	require.Eventually(t, func() bool {
+		job, err := handler.db.GetJob(queued.Job.ID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	integrity := func() map[string]string {
+		c, w := createAuthenticatedContext(adminID)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/admin/integrity", nil)
+		handler.GetIntegrity(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			OK    bool                 `json:"ok"`
+			Files []models.FileProblem `json:"files"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		problems := map[string]string{}
+		for _, f := range resp.Files {
+			problems[f.BookID] = f.Problem
+		}
+		assert.Equal(t, len(problems) == 0, resp.OK)
+		return problems
+	}
+	assert.Equal(t, map[string]string{
+		"edited": models.FileProblemModified,
+		"gone":   models.FileProblemMissing,
+	}, integrity(), "webby's own writes aren't problems")
+
+	c, w = createAuthenticatedContext(adminID)
+	c.Params = gin.Params{{Key: "id", Value: "edited"}}
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/admin/files/edited/accept", nil)
+	handler.AcceptBookFile(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, map[string]string{"gone": models.FileProblemMissing}, integrity())
+}
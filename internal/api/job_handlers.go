@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// ==================== Job Handlers ====================
+
+// maxMetadataAttempts is how many times a bulk refresh looks a book up while
+// providers answer 429. The provider's rate limiter doubles its delay after
+// each, so the last attempts are minutes apart.
+const maxMetadataAttempts = 10
+
+// hashWorkers is how many books a hash computation or file verification
+// job hashes at once
+const hashWorkers = 4
+
+// fileProblemReasons are the job item reasons for each file problem
+var fileProblemReasons = map[string]string{
+	models.FileProblemMissing:      "File is missing",
+	models.FileProblemUnreadable:   "File can't be read",
+	models.FileProblemModified:     "File changed outside webby",
+	models.FileProblemSizeMismatch: "File size differs from the recorded size",
+}
+
+// jobItemStatuses are the statuses a job's items can be filtered to
+var jobItemStatuses = map[string]bool{
+	models.JobItemPending:   true,
+	models.JobItemSucceeded: true,
+	models.JobItemFailed:    true,
+	models.JobItemSkipped:   true,
+}
+
+// StartJobQueue works through queued jobs in the background, resuming those
+// the server was running when it last stopped
+func (h *Handler) StartJobQueue(ctx context.Context) {
+	h.jobs.Start(ctx)
+}
+
+// refreshMetadataItem is the worker for bulk metadata refreshes: it looks
+// one book up and saves what's found, recording the fields that changed. In
+// a dry run nothing is saved. A book is looked up again while providers turn
+// it away, and failed once they've done so maxMetadataAttempts times.
+func (h *Handler) refreshMetadataItem(ctx context.Context, job *models.Job, item *models.JobItem) {
+	book, err := h.db.GetBook(item.ItemID)
+	if err != nil || !h.policy.CanWrite(book, job.UserID) {
+		item.Status, item.Reason = models.JobItemSkipped, "Book no longer available"
+		return
+	}
+	if book.ContentType == models.ContentTypeComic && !h.comicMetadata.IsConfigured() {
+		item.Status, item.Reason = models.JobItemSkipped, "Comic metadata service not configured"
+		return
+	}
+
+	var updated *models.Book
+	for {
+		item.Attempts++
+		updated, err = h.lookupBookMetadata(ctx, book, job.Provider)
+		if !errors.Is(err, metadata.ErrRateLimited) || item.Attempts >= maxMetadataAttempts {
+			break
+		}
+	}
+	if err == nil {
+		item.Changes = books.MetadataChanges(book, updated)
+		if !job.DryRun {
+			if err = h.saveBookMetadata(updated, job.UserID); err == nil {
+				h.syncSubjectTags(updated, job.UserID)
+			}
+		}
+	}
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Left pending to be looked up when the job resumes
+		return
+	case err == nil:
+		item.Status = models.JobItemSucceeded
+	case errors.Is(err, metadata.ErrRateLimited):
+		item.Status, item.Reason = models.JobItemFailed, "Metadata provider is rate limiting requests"
+	case errors.Is(err, metadata.ErrNoMatch):
+		item.Status, item.Reason = models.JobItemFailed, "No matching metadata found"
+	case errors.Is(err, metadata.ErrProviderDown):
+		log.Printf("Metadata lookup for book %s failed: %v", book.ID, err)
+		item.Status, item.Reason = models.JobItemFailed, "Metadata provider is unavailable"
+	default:
+		log.Printf("Failed to save refreshed metadata for book %s: %v", book.ID, err)
+		item.Status, item.Reason = models.JobItemFailed, "Failed to save metadata"
+	}
+}
+
+// lookupBookMetadata looks a book up with the book or comic metadata
+// service, returning a copy of the book updated with the match. Books, but
+// not comics, are looked up with the provider named, if any. A match with
+// confidence under 0.5 counts as none.
+func (h *Handler) lookupBookMetadata(ctx context.Context, original *models.Book, provider string) (*models.Book, error) {
+	book := *original
+	now := time.Now()
+	if book.ContentType == models.ContentTypeComic {
+		// Re-parse filename for better matching
+		parsedInfo := cbz.ParseComicFilename(filepath.Base(book.FilePath))
+
+		searchSeries := book.Series
+		if parsedInfo.Series != "" {
+			searchSeries = parsedInfo.Series
+		}
+
+		issueNumber := parsedInfo.IssueNumber
+		if issueNumber == "" && book.SeriesIndex > 0 {
+			issueNumber = strconv.FormatFloat(book.SeriesIndex, 'f', -1, 64)
+		}
+
+		result, err := h.comicMetadata.LookupComic(ctx, searchSeries, issueNumber, book.Title, parsedInfo.Year)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil || result.Confidence < 0.5 {
+			return nil, metadata.ErrNoMatch
+		}
+		if result.Title != "" {
+			book.Title = result.Title
+		}
+		if result.Series != "" {
+			book.Series = result.Series
+		}
+		if len(result.Writers) > 0 {
+			book.Author = result.Writers[0]
+		}
+		book.Publisher = result.Publisher
+		book.PublishDate = result.ReleaseDate
+		book.Description = result.Description
+		book.MetadataSource = result.Source
+	} else {
+		service, ok := h.metadata.Using(provider)
+		if !ok {
+			return nil, fmt.Errorf("%w: no provider named %s", metadata.ErrProviderDown, provider)
+		}
+		result, err := service.LookupBook(ctx, book.ISBN, book.Title, book.Author)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil || result.Confidence < 0.5 {
+			return nil, metadata.ErrNoMatch
+		}
+		book.Title = result.Title
+		if len(result.Authors) > 0 {
+			book.Author = result.Authors[0]
+		}
+		if result.ISBN13 != "" {
+			book.ISBN = result.ISBN13
+		} else if result.ISBN10 != "" {
+			book.ISBN = result.ISBN10
+		}
+		book.Publisher = result.Publisher
+		book.PublishDate = result.PublishDate
+		book.Description = result.Description
+		book.Language = result.Language
+		book.Subjects = strings.Join(result.Subjects, ", ")
+		book.MetadataSource = result.Source
+	}
+	book.MetadataUpdated = &now
+	return &book, nil
+}
+
+// optimizeCoverItem is the worker for cover backfills: it scales down one
+// book's cover if it's oversized, recording how many bytes it took before
+// and after. In a dry run nothing is saved.
+func (h *Handler) optimizeCoverItem(ctx context.Context, job *models.Job, item *models.JobItem) {
+	book, err := h.db.GetBook(item.ItemID)
+	if err != nil || book.CoverPath == "" {
+		item.Status, item.Reason = models.JobItemSkipped, "Book no longer has a cover"
+		return
+	}
+	data, err := os.ReadFile(book.CoverPath)
+	if err != nil {
+		item.Status, item.Reason = models.JobItemFailed, "Failed to read cover"
+		return
+	}
+
+	ext := filepath.Ext(book.CoverPath)
+	optimized, newExt := books.OptimizeCover(data, ext)
+	if len(optimized) >= len(data) {
+		item.Status, item.Reason = models.JobItemSkipped, "Cover is already small enough"
+		return
+	}
+	item.Changes = []models.FieldChange{{Field: "cover_bytes", Old: strconv.Itoa(len(data)), New: strconv.Itoa(len(optimized))}}
+
+	if !job.DryRun {
+		path, err := h.files.SaveCoverAt(book.CoverPath, optimized, newExt)
+		if err != nil {
+			log.Printf("Failed to save optimized cover for book %s: %v", book.ID, err)
+			item.Status, item.Reason = models.JobItemFailed, "Failed to save cover"
+			return
+		}
+		if path != book.CoverPath {
+			if err := h.db.UpdateBookFilePaths(book.ID, book.FilePath, path); err != nil {
+				h.files.DeleteFile(path)
+				item.Status, item.Reason = models.JobItemFailed, "Failed to save cover"
+				return
+			}
+			h.files.DeleteFile(book.CoverPath)
+		}
+	}
+	item.Status = models.JobItemSucceeded
+}
+
+// hashBookItem is the worker for hash computation: it hashes one book's
+// file for duplicate detection. Several run at once, each on its own book.
+// In a dry run the hash isn't saved.
+func (h *Handler) hashBookItem(ctx context.Context, job *models.Job, item *models.JobItem) {
+	book, err := h.db.GetBook(item.ItemID)
+	if err != nil {
+		item.Status, item.Reason = models.JobItemSkipped, "Book no longer available"
+		return
+	}
+	if book.FileHash != "" {
+		item.Status, item.Reason = models.JobItemSkipped, "Book is already hashed"
+		return
+	}
+
+	hash, err := storage.HashFile(book.FilePath)
+	if err != nil {
+		log.Printf("Failed to compute hash for book %s: %v", book.ID, err)
+		item.Status, item.Reason = models.JobItemFailed, "Failed to read book file"
+		return
+	}
+	item.Changes = []models.FieldChange{{Field: "file_hash", New: hash}}
+
+	if !job.DryRun {
+		if err := h.db.UpdateBookFileHash(book.ID, hash); err != nil {
+			log.Printf("Failed to save hash for book %s: %v", book.ID, err)
+			item.Status, item.Reason = models.JobItemFailed, "Failed to save hash"
+			return
+		}
+	}
+	item.Status = models.JobItemSucceeded
+}
+
+// verifyFileItem is the worker for file verification: it re-hashes one
+// book's file and compares it with what's recorded, saving the result for
+// the integrity report. Books with a problem fail with it as the reason.
+func (h *Handler) verifyFileItem(ctx context.Context, job *models.Job, item *models.JobItem) {
+	book, err := h.db.GetBook(item.ItemID)
+	if err != nil {
+		item.Status, item.Reason = models.JobItemSkipped, "Book no longer available"
+		return
+	}
+	hash, size, err := h.db.ExpectedFile(book.ID)
+	if err != nil {
+		item.Status, item.Reason = models.JobItemFailed, "Failed to read recorded hash"
+		return
+	}
+
+	problem, expected, actual := storage.VerifyFile(book.FilePath, hash, size)
+	if err := h.db.SaveFileCheck(book.ID, problem, expected, actual); err != nil {
+		log.Printf("Failed to save file check for book %s: %v", book.ID, err)
+	}
+	switch problem {
+	case "":
+		item.Status = models.JobItemSucceeded
+	case models.FileProblemModified:
+		item.Changes = []models.FieldChange{{Field: "file_hash", Old: expected, New: actual}}
+	case models.FileProblemSizeMismatch:
+		item.Changes = []models.FieldChange{{Field: "file_size", Old: expected, New: actual}}
+	}
+	if problem != "" {
+		item.Status, item.Reason = models.JobItemFailed, fileProblemReasons[problem]
+	}
+}
+
+// ListJobs returns the current user's background jobs, newest first
+func (h *Handler) ListJobs(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	list, err := h.db.ListJobs(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch jobs")
+		return
+	}
+	if list == nil {
+		list = []*models.Job{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  list,
+		"count": len(list),
+	})
+}
+
+// GetJob returns a job's progress
+func (h *Handler) GetJob(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	job, ok := h.getOwnedJob(c, userID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ListJobItems returns a job's items and how each went. ?status= limits
+// them to one status, such as failed.
+func (h *Handler) ListJobItems(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && !jobItemStatuses[status] {
+		apierror.Invalid(c, "status", "Status must be pending, succeeded, failed or skipped")
+		return
+	}
+
+	job, ok := h.getOwnedJob(c, userID)
+	if !ok {
+		return
+	}
+
+	items, err := h.db.ListJobItems(job.ID, status)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch job items")
+		return
+	}
+	if items == nil {
+		items = []*models.JobItem{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// PauseJob stops a queued or running job after the item it's working on
+func (h *Handler) PauseJob(c *gin.Context) {
+	h.transitionJob(c, "pause")
+}
+
+// ResumeJob queues a paused job again, to carry on from its first
+// unfinished item
+func (h *Handler) ResumeJob(c *gin.Context) {
+	h.transitionJob(c, "resume")
+}
+
+// transitionJob pauses or resumes the current user's job
+func (h *Handler) transitionJob(c *gin.Context, action string) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	job, ok := h.getOwnedJob(c, userID)
+	if !ok {
+		return
+	}
+
+	var changed bool
+	var err error
+	if action == "pause" {
+		changed, err = h.jobs.Pause(job.ID)
+	} else {
+		changed, err = h.jobs.Resume(job.ID)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to "+action+" job")
+		return
+	}
+	if !changed {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Job can't be "+action+"d while "+job.Status)
+		return
+	}
+
+	job, err = h.db.GetJob(job.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// getOwnedJob returns the job named in the URL if it belongs to userID,
+// writing the error response if not
+func (h *Handler) getOwnedJob(c *gin.Context, userID string) (*models.Job, bool) {
+	job, err := h.db.GetJob(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && job.UserID != userID) {
+		// Other users' jobs aren't revealed
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeJobNotFound, "Job not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch job")
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// startJobQueue works through handler's queued jobs until the test ends.
+// The job being worked is let finish before the handler's files are
+// removed, so the handler must be cleaned up with t.Cleanup, not defer.
+func startJobQueue(t *testing.T, handler *Handler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handler.StartJobQueue(ctx)
+	t.Cleanup(func() {
+		cancel()
+		handler.jobs.Wait()
+	})
+}
+
+func TestBulkRefreshMetadataJob(t *testing.T) {
+	// Comics are skipped without a ComicVine key, so nothing is looked up
+	t.Setenv("COMICVINE_API_KEY", "")
+	handler, cleanup := setupTestHandler(t)
+	t.Cleanup(cleanup)
+
+	userID := setupTestUser(t, handler)
+	otherID := createNamedUser(t, handler, "other")
+	var bookIDs []string
+	for _, title := range []string{"Saga #1", "Saga #2", "Saga #3"} {
+		book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: title, FilePath: "/tmp/saga.cbz",
+			FileFormat: models.FileFormatCBZ, ContentType: models.ContentTypeComic, UploadedAt: time.Now()}
+		require.NoError(t, handler.db.CreateBook(book))
+		bookIDs = append(bookIDs, book.ID)
+	}
+
+	c, w := createAuthenticatedContext(userID)
+	body, _ := json.Marshal(gin.H{"book_ids": bookIDs})
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/metadata/bulk-refresh", strings.NewReader(string(body)))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.BulkRefreshMetadata(c)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued struct {
+		Job models.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+	assert.Equal(t, 3, queued.Job.Total)
+	assert.Equal(t, models.JobStatusQueued, queued.Job.Status)
+
+	startJobQueue(t, handler)
+	require.Eventually(t, func() bool {
+		job, err := handler.db.GetJob(queued.Job.ID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	call := func(userID string, handle gin.HandlerFunc, method, path string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: queued.Job.ID}}
+		c.Request, _ = http.NewRequest(method, path, nil)
+		handle(c)
+		return w
+	}
+
+	w = call(userID, handler.GetJob, http.MethodGet, "/api/jobs/"+queued.Job.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var job models.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, 3, job.Processed)
+	assert.Equal(t, 3, job.Skipped)
+	assert.NotNil(t, job.FinishedAt)
+
+	w = call(userID, handler.ListJobItems, http.MethodGet, "/api/jobs/"+queued.Job.ID+"/items?status=skipped")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var items struct {
+		Items []models.JobItem `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items.Items, 3)
+	assert.Equal(t, bookIDs[0], items.Items[0].ItemID)
+	assert.Equal(t, "Comic metadata service not configured", items.Items[0].Reason)
+
+	w = call(userID, handler.ListJobItems, http.MethodGet, "/api/jobs/"+queued.Job.ID+"/items?status=done")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call(userID, handler.ResumeJob, http.MethodPost, "/api/jobs/"+queued.Job.ID+"/resume")
+	assert.Equal(t, http.StatusConflict, w.Code, "a finished job can't be resumed")
+	w = call(otherID, handler.GetJob, http.MethodGet, "/api/jobs/"+queued.Job.ID)
+	assert.Equal(t, http.StatusNotFound, w.Code, "other users' jobs are hidden")
+}
+
+func TestOptimizeCoversJob(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	t.Cleanup(cleanup)
+	handler.SetAdmins([]string{"admin"})
+
+	adminID := createNamedUser(t, handler, "admin")
+	userID := setupTestUser(t, handler)
+
+	// A noisy PNG just wider than covers are kept. It's short so the job
+	// is quick under the race detector.
+	width, height := books.CoverMaxWidth+100, 150
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{uint8(rng.IntN(256)), uint8(y), uint8(x), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	coverPath, err := handler.files.SaveCover("cover", buf.Bytes(), ".png")
+	require.NoError(t, err)
+	bookID := setupTestBook(t, handler, userID)
+	require.NoError(t, handler.db.UpdateBookFilePaths(bookID, "/tmp/test.epub", coverPath))
+
+	optimize := func(userID string, dryRun bool) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		body, _ := json.Marshal(gin.H{"dry_run": dryRun})
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/admin/covers/optimize", strings.NewReader(string(body)))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.OptimizeCovers(c)
+		return w
+	}
+	w := optimize(userID, false)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = optimize(adminID, false)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued struct {
+		Job models.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+
+	startJobQueue(t, handler)
+	require.Eventually(t, func() bool {
+		job, err := handler.db.GetJob(queued.Job.ID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	items, err := handler.db.ListJobItems(queued.Job.ID, "")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, models.JobItemSucceeded, items[0].Status, items[0].Reason)
+	require.Len(t, items[0].Changes, 1)
+	assert.Equal(t, strconv.Itoa(buf.Len()), items[0].Changes[0].Old)
+
+	book, err := handler.db.GetBook(bookID)
+	require.NoError(t, err)
+	assert.Equal(t, ".jpg", filepath.Ext(book.CoverPath))
+	_, err = os.Stat(coverPath)
+	assert.True(t, os.IsNotExist(err), "the old cover is removed")
+	data, err := os.ReadFile(book.CoverPath)
+	require.NoError(t, err)
+	assert.Equal(t, items[0].Changes[0].New, strconv.Itoa(len(data)))
+}
+
+func TestComputeHashesJob(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	t.Cleanup(cleanup)
+
+	userID := setupTestUser(t, handler)
+	dir := t.TempDir()
+	paths := map[string]string{}
+	for _, name := range []string{"one.epub", "two.epub", "missing.epub"} {
+		path := filepath.Join(dir, name)
+		if name != "missing.epub" {
+			require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+		}
+		bookID := setupTestBook(t, handler, userID)
+		require.NoError(t, handler.db.UpdateBookFilePaths(bookID, path, ""))
+		paths[bookID] = path
+	}
+
+	c, w := createAuthenticatedContext(userID)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/duplicates/compute", nil)
+	handler.ComputeHashes(c)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued struct {
+		Job models.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+	assert.Equal(t, models.JobKindHashCompute, queued.Job.Kind)
+	assert.Equal(t, 3, queued.Job.Total)
+
+	startJobQueue(t, handler)
+	require.Eventually(t, func() bool {
+		job, err := handler.db.GetJob(queued.Job.ID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	job, err := handler.db.GetJob(queued.Job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+	for bookID, path := range paths {
+		book, err := handler.db.GetBook(bookID)
+		require.NoError(t, err)
+		if want, err := storage.HashFile(path); err == nil {
+			assert.Equal(t, want, book.FileHash)
+		} else {
+			assert.Empty(t, book.FileHash, "a missing file isn't hashed")
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/locale"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Language Handlers ====================
+
+// GetBooksByLanguage returns books grouped by language code
+func (h *Handler) GetBooksByLanguage(c *gin.Context) {
+	grouped, err := h.books.ByLanguage(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"languages": grouped})
+}
+
+// GetBookIndex returns an A–Z index of the books GET /api/books lists when
+// sorted by title or author, with the same order and filters, so clients
+// can jump to a letter without fetching the whole library
+func (h *Handler) GetBookIndex(c *gin.Context) {
+	by := c.DefaultQuery("by", "title")
+	if by != "title" && by != "author" {
+		apierror.Invalid(c, "by", "by must be title or author")
+		return
+	}
+	order := "asc"
+	if c.Query("order") == "desc" {
+		order = "desc"
+	}
+
+	letters, total, err := h.books.Index(books.ListOptions{
+		UserID:      auth.GetUserID(c),
+		SortBy:      by,
+		Order:       order,
+		ContentType: c.Query("type"),
+		ReadStatus:  c.Query("status"),
+		Language:    c.Query("language"),
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"by":      by,
+		"order":   order,
+		"total":   total,
+		"letters": letters,
+	})
+}
+
+// DetectBookLanguages fills in the language of the user's EPUBs that have
+// none, guessing it from their text
+func (h *Handler) DetectBookLanguages(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	list, err := h.db.ListBooksForUserWithFilter(userID, "title", "asc", models.ContentTypeBook)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	processed, detected := 0, 0
+	for i := range list {
+		book := &list[i]
+		if book.Language != "" || book.FileFormat != models.FileFormatEPUB || book.IsPhysical() {
+			continue
+		}
+		if !h.policy.CanWrite(book, userID) {
+			continue
+		}
+
+		processed++
+		lang := books.DetectLanguage(book.FilePath)
+		if lang == "" {
+			continue
+		}
+		if err := h.db.UpdateBookLanguage(book.ID, lang); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save book language")
+			return
+		}
+		detected++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"processed": processed,
+		"detected":  detected,
+	})
+}
+
+// ==================== Library Preference Handlers ====================
+
+// GetLibraryPreferences returns how the current user's library is ordered,
+// whether metadata subjects become tags, and the visibility of new uploads
+func (h *Handler) GetLibraryPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	prefs, err := h.db.GetLibraryPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateLibraryPreferences updates the current user's library preferences.
+// Only the fields present in the request are changed.
+func (h *Handler) UpdateLibraryPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		SortLocale        *string           `json:"sort_locale"`
+		IgnoreArticles    *bool             `json:"ignore_articles"`
+		SubjectTags       *bool             `json:"subject_tags"`
+		SubjectTagMap     map[string]string `json:"subject_tag_map"`
+		DefaultVisibility *string           `json:"default_visibility"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	prefs, err := h.db.GetLibraryPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library preferences")
+		return
+	}
+
+	if req.SortLocale != nil {
+		tag := strings.TrimSpace(*req.SortLocale)
+		if !locale.ValidSortLocale(tag) {
+			apierror.Invalid(c, "sort_locale", "sort_locale must be a language tag such as en, de, or fr-CA")
+			return
+		}
+		prefs.SortLocale = tag
+	}
+	if req.IgnoreArticles != nil {
+		prefs.IgnoreArticles = *req.IgnoreArticles
+	}
+	if req.SubjectTags != nil {
+		prefs.SubjectTags = *req.SubjectTags
+	}
+	if req.SubjectTagMap != nil {
+		// A map given in the request replaces the stored one
+		tagMap := make(map[string]string, len(req.SubjectTagMap))
+		for subject, tag := range req.SubjectTagMap {
+			key := books.NormalizeSubject(subject)
+			if key == "" {
+				apierror.Invalid(c, "subject_tag_map", "Subjects in subject_tag_map must not be empty")
+				return
+			}
+			tagMap[key] = strings.TrimSpace(tag)
+		}
+		prefs.SubjectTagMap = tagMap
+	}
+	if req.DefaultVisibility != nil {
+		// "" goes back to the server default
+		if *req.DefaultVisibility != "" && !models.ValidBookVisibility(*req.DefaultVisibility) {
+			apierror.Invalid(c, "default_visibility", "default_visibility must be private, household, public, or empty")
+			return
+		}
+		prefs.DefaultVisibility = *req.DefaultVisibility
+	}
+
+	prefs.UpdatedAt = time.Now()
+	if err := h.db.SaveLibraryPreferences(prefs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save library preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// ==================== Subject Tag Handlers ====================
+
+// syncSubjectTags turns a book's metadata subjects into tags for userID when
+// they have subject tags turned on. Failures are logged rather than failing
+// the metadata update that triggered the sync.
+func (h *Handler) syncSubjectTags(book *models.Book, userID string) {
+	if userID == "" {
+		return
+	}
+
+	prefs, err := h.db.GetLibraryPreferences(userID)
+	if err != nil {
+		log.Printf("Warning: failed to load library preferences for subject tags: %v", err)
+		return
+	}
+	if !prefs.SubjectTags {
+		return
+	}
+
+	names := books.SubjectTagNames(book.Subjects, prefs.SubjectTagMap)
+	if err := h.db.SyncSubjectTags(book.ID, userID, names); err != nil {
+		log.Printf("Warning: failed to sync subject tags for book %s: %v", book.ID, err)
+	}
+}
+
+// SyncAllSubjectTags re-syncs the subject tags of every book in the current
+// user's library, such as after turning subject tags on or changing the
+// mapping. With dry_run it reports the tags each book would gain and lose
+// without changing them.
+func (h *Handler) SyncAllSubjectTags(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request")
+			return
+		}
+	}
+
+	prefs, err := h.db.GetLibraryPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch library preferences")
+		return
+	}
+	if !prefs.SubjectTags {
+		apierror.Invalid(c, "subject_tags", "Turn on subject_tags in library preferences first")
+		return
+	}
+
+	list, err := h.db.ListBooksForUserWithFilter(userID, "title", "asc", "")
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	changes := make([]models.BookChange, 0)
+	for i := range list {
+		book := &list[i]
+		names := books.SubjectTagNames(book.Subjects, prefs.SubjectTagMap)
+
+		current, err := h.db.GetBookTags(book.ID, userID)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book tags")
+			return
+		}
+		subjectTags, err := h.db.GetSubjectTagNames(book.ID, userID)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book tags")
+			return
+		}
+		currentNames := make([]string, len(current))
+		for j, tag := range current {
+			currentNames[j] = tag.Name
+		}
+		added, removed := books.SubjectTagChanges(currentNames, subjectTags, names)
+		if len(added) > 0 || len(removed) > 0 {
+			changes = append(changes, models.BookChange{BookID: book.ID, Title: book.Title,
+				TagsAdded: added, TagsRemoved: removed})
+		}
+
+		if req.DryRun {
+			continue
+		}
+		if err := h.db.SyncSubjectTags(book.ID, userID, names); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to sync subject tags")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":   req.DryRun,
+		"processed": len(list),
+		"changes":   changes,
+	})
+}
+
+// ==================== Reorganize Handlers ====================
+
+// ReorganizeLibrary moves the current user's book files into the
+// Author/Series/Title folders their metadata calls for, such as after
+// editing authors by hand. book_ids limits it to some books; otherwise the
+// whole library is done. With dry_run it reports the moves without making
+// them.
+func (h *Handler) ReorganizeLibrary(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		BookIDs []string `json:"book_ids"`
+		DryRun  bool     `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request")
+			return
+		}
+	}
+
+	var list []*models.Book
+	if len(req.BookIDs) > 0 {
+		for _, id := range req.BookIDs {
+			if book, err := h.db.GetBook(id); err == nil {
+				list = append(list, book)
+			}
+		}
+	} else {
+		all, err := h.db.ListBooksForUserWithFilter(userID, "title", "asc", "")
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+			return
+		}
+		for i := range all {
+			list = append(list, &all[i])
+		}
+	}
+
+	processed, moved := 0, 0
+	changes := make([]models.BookChange, 0)
+	for _, book := range list {
+		// Books the user may not change, and those without a file, are skipped
+		if book.IsPhysical() || !h.policy.CanWrite(book, userID) {
+			continue
+		}
+		processed++
+
+		newPaths := h.files.PlanReorganize(book.FilePath, book.CoverPath, book.Author, book.Series, book.Title)
+		if !req.DryRun {
+			var err error
+			newPaths, err = h.files.ReorganizeBook(book.FilePath, book.CoverPath, book.Author, book.Series, book.Title)
+			if err != nil {
+				log.Printf("Warning: failed to reorganize book %s: %v", book.ID, err)
+				continue
+			}
+		}
+		if newPaths.BookPath == book.FilePath && newPaths.CoverPath == book.CoverPath {
+			continue
+		}
+		if !req.DryRun {
+			if err := h.db.UpdateBookFilePaths(book.ID, newPaths.BookPath, newPaths.CoverPath); err != nil {
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save file paths")
+				return
+			}
+		}
+
+		change := models.BookChange{BookID: book.ID, Title: book.Title}
+		if newPaths.BookPath != book.FilePath {
+			change.Moves = append(change.Moves, models.FileMove{From: book.FilePath, To: newPaths.BookPath})
+		}
+		if newPaths.CoverPath != book.CoverPath {
+			change.Moves = append(change.Moves, models.FileMove{From: book.CoverPath, To: newPaths.CoverPath})
+		}
+		changes = append(changes, change)
+		moved++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":   req.DryRun,
+		"processed": processed,
+		"moved":     moved,
+		"changes":   changes,
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestReorganizeLibraryDryRun(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	otherID := createNamedUser(t, handler, "other")
+	path := filepath.Join(t.TempDir(), "upload.epub")
+	require.NoError(t, os.WriteFile(path, []byte("epub"), 0644))
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Dune", Author: "Frank Herbert",
+		FilePath: path, FileFormat: models.FileFormatEPUB, ContentType: models.ContentTypeBook, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+	othersBook := setupTestBook(t, handler, otherID)
+
+	reorganize := func(dryRun bool) (int, []models.BookChange) {
+		c, w := createAuthenticatedContext(userID)
+		body, _ := json.Marshal(gin.H{"book_ids": []string{book.ID, othersBook}, "dry_run": dryRun})
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/library/reorganize", strings.NewReader(string(body)))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.ReorganizeLibrary(c)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Processed int                 `json:"processed"`
+			Changes   []models.BookChange `json:"changes"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Processed, resp.Changes
+	}
+
+	processed, planned := reorganize(true)
+	assert.Equal(t, 1, processed, "other users' books are left out")
+	require.Len(t, planned, 1)
+	require.Len(t, planned[0].Moves, 1)
+	assert.Equal(t, path, planned[0].Moves[0].From)
+	assert.Equal(t, filepath.Join("Frank Herbert", "Dune.epub"),
+		filepath.Join(filepath.Base(filepath.Dir(planned[0].Moves[0].To)), filepath.Base(planned[0].Moves[0].To)))
+	_, err := os.Stat(path)
+	assert.NoError(t, err, "a dry run moves nothing")
+
+	_, moved := reorganize(false)
+	assert.Equal(t, planned, moved)
+	saved, err := handler.db.GetBook(book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, planned[0].Moves[0].To, saved.FilePath)
+	_, err = os.Stat(saved.FilePath)
+	assert.NoError(t, err)
+}
+
+func TestBulkUpdateReadStatusDryRun(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	bookID := setupTestBook(t, handler, userID)
+
+	c, w := createAuthenticatedContext(userID)
+	body, _ := json.Marshal(gin.H{"book_ids": []string{bookID}, "status": models.ReadStatusCompleted, "dry_run": true})
+	c.Request, _ = http.NewRequest(http.MethodPost, "/api/books/status/bulk", strings.NewReader(string(body)))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.BulkUpdateReadStatus(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		DryRun  bool                `json:"dry_run"`
+		Changes []models.BookChange `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	require.Len(t, resp.Changes, 1)
+	assert.Equal(t, []models.FieldChange{{Field: "read_status", Old: models.ReadStatusUnread, New: models.ReadStatusCompleted}},
+		resp.Changes[0].Fields)
+
+	book, err := handler.db.GetBook(bookID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusUnread, book.ReadStatus, "a dry run changes nothing")
+}
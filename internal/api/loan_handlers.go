@@ -0,0 +1,301 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/notify"
+)
+
+// ==================== Loan Handlers ====================
+
+// StartLoanReminders periodically sends one reminder for each loan that has
+// gone past its due date without being returned
+func (h *Handler) StartLoanReminders(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			h.sendOverdueLoanReminders(time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sendOverdueLoanReminders notifies the lender (and the borrower, when they
+// are a user) about each newly overdue loan
+func (h *Handler) sendOverdueLoanReminders(now time.Time) {
+	loans, err := h.db.ListOverdueLoansToRemind(now)
+	if err != nil {
+		log.Printf("Warning: failed to list overdue loans: %v", err)
+		return
+	}
+
+	for _, loan := range loans {
+		due := loan.DueDate.Format("Jan 2, 2006")
+		h.notifier.Publish(notify.Event{
+			Type:    models.NotificationEventLoanOverdue,
+			UserID:  loan.UserID,
+			Title:   "A book you lent is overdue",
+			Message: fmt.Sprintf("%q, lent to %s, was due back on %s.", loan.BookTitle, loan.BorrowerName, due),
+			BookID:  loan.BookID,
+		})
+		if loan.BorrowerUserID != "" {
+			h.notifier.Publish(notify.Event{
+				Type:    models.NotificationEventLoanOverdue,
+				UserID:  loan.BorrowerUserID,
+				Title:   "A book you borrowed is overdue",
+				Message: fmt.Sprintf("%q was due back on %s.", loan.BookTitle, due),
+				BookID:  loan.BookID,
+			})
+		}
+
+		if err := h.db.MarkBookLoanReminded(loan.ID, now); err != nil {
+			log.Printf("Warning: failed to mark loan %s reminded: %v", loan.ID, err)
+		}
+	}
+}
+
+// ListLoans returns the books the current user has lent out.
+// ?status=active (default), overdue, or all (includes returned loans)
+func (h *Handler) ListLoans(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	status := c.DefaultQuery("status", "active")
+	if status != "active" && status != "overdue" && status != "all" {
+		apierror.Invalid(c, "status", "Invalid status. Must be active, overdue, or all")
+		return
+	}
+
+	loans, err := h.db.ListBookLoans(userID, status == "all")
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch loans")
+		return
+	}
+
+	if status == "overdue" {
+		overdue := []*models.BookLoan{}
+		for _, loan := range loans {
+			if loan.Overdue {
+				overdue = append(overdue, loan)
+			}
+		}
+		loans = overdue
+	}
+
+	if loans == nil {
+		loans = []*models.BookLoan{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"loans": loans,
+		"count": len(loans),
+	})
+}
+
+// ListBorrowedBooks returns outstanding loans where the current user is the borrower
+func (h *Handler) ListBorrowedBooks(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	loans, err := h.db.ListBorrowedBooks(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch loans")
+		return
+	}
+
+	if loans == nil {
+		loans = []*models.BookLoan{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"loans": loans,
+		"count": len(loans),
+	})
+}
+
+// LendBook records a book as lent to a named person or another user
+func (h *Handler) LendBook(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	bookID := c.Param("id")
+	book, err := h.db.GetBookForUser(bookID, userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+
+	var req struct {
+		BorrowerName   string `json:"borrower_name"`
+		BorrowerUserID string `json:"borrower_user_id"`
+		DueDate        string `json:"due_date"` // YYYY-MM-DD
+		Notes          string `json:"notes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.BorrowerName = strings.TrimSpace(req.BorrowerName)
+	if req.BorrowerUserID != "" {
+		if req.BorrowerUserID == userID {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Cannot lend a book to yourself")
+			return
+		}
+		borrower, err := h.db.GetUserByID(req.BorrowerUserID)
+		if err != nil {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+			return
+		}
+		if req.BorrowerName == "" {
+			req.BorrowerName = borrower.Username
+		}
+	}
+	if req.BorrowerName == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "borrower_name or borrower_user_id is required")
+		return
+	}
+
+	var dueDate *time.Time
+	if req.DueDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.DueDate, time.Local)
+		if err != nil {
+			apierror.Invalid(c, "due_date", "Invalid due_date. Use YYYY-MM-DD")
+			return
+		}
+		// Due at the end of the day
+		parsed = parsed.Add(24*time.Hour - time.Second)
+		dueDate = &parsed
+	}
+
+	if _, err := h.db.GetActiveBookLoan(userID, bookID); err == nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Book is already lent out")
+		return
+	} else if err != sql.ErrNoRows {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check loans")
+		return
+	}
+
+	loan := &models.BookLoan{
+		ID:             uuid.New().String(),
+		BookID:         bookID,
+		UserID:         userID,
+		BorrowerName:   req.BorrowerName,
+		BorrowerUserID: req.BorrowerUserID,
+		Notes:          strings.TrimSpace(req.Notes),
+		LentAt:         time.Now(),
+		DueDate:        dueDate,
+		BookTitle:      book.Title,
+		BookAuthor:     book.Author,
+	}
+
+	if err := h.db.CreateBookLoan(loan); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save loan")
+		return
+	}
+	loan.Overdue = loan.IsOverdue(time.Now())
+
+	c.JSON(http.StatusCreated, loan)
+}
+
+// ReturnLoan marks a lent book as returned
+func (h *Handler) ReturnLoan(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	loan, ok := h.getOwnedLoan(c, userID)
+	if !ok {
+		return
+	}
+
+	if loan.ReturnedAt != nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Loan is already returned")
+		return
+	}
+
+	now := time.Now()
+	if err := h.db.MarkBookLoanReturned(loan.ID, now); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update loan")
+		return
+	}
+	loan.ReturnedAt = &now
+	loan.Overdue = false
+
+	c.JSON(http.StatusOK, loan)
+}
+
+// DeleteLoan removes a loan record
+func (h *Handler) DeleteLoan(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	loan, ok := h.getOwnedLoan(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteBookLoan(loan.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete loan")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Loan deleted"})
+}
+
+// getOwnedLoan loads the loan from the :id param and verifies the current
+// user is the lender. Writes the error response and returns false if the
+// loan can't be used.
+func (h *Handler) getOwnedLoan(c *gin.Context, userID string) (*models.BookLoan, bool) {
+	loan, err := h.db.GetBookLoan(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeLoanNotFound, "Loan not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch loan")
+		return nil, false
+	}
+
+	// Verify ownership
+	if loan.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return nil, false
+	}
+
+	return loan, true
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/metadata"
+)
+
+// ==================== Metadata Plugin Handlers ====================
+
+// SetMetadataPlugins adds metadata providers that lookups and refreshes
+// use when asked for them by name, such as operators' scraper scripts
+func (h *Handler) SetMetadataPlugins(plugins []metadata.Provider) {
+	for _, p := range plugins {
+		h.metadata.AddPlugin(p)
+	}
+}
+
+// ListMetadataProviders returns the names of the book metadata providers a
+// lookup, search, or refresh can ask for with its provider parameter
+func (h *Handler) ListMetadataProviders(c *gin.Context) {
+	names := h.metadata.ProviderNames()
+	c.JSON(http.StatusOK, gin.H{
+		"providers": names,
+		"count":     len(names),
+	})
+}
+
+// metadataService returns the book metadata service limited to the
+// provider named name, or the usual one if name is empty. It writes an
+// error response and returns false if there's no such provider.
+func (h *Handler) metadataService(c *gin.Context, name string) (*metadata.Service, bool) {
+	service, ok := h.metadata.Using(strings.TrimSpace(name))
+	if !ok {
+		apierror.Invalid(c, "provider", fmt.Sprintf("provider must be one of: %s", strings.Join(h.metadata.ProviderNames(), ", ")))
+		return nil, false
+	}
+	return service, true
+}
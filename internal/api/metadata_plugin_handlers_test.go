@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// fakeProvider answers every lookup with the same book
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string { return "fake" }
+
+func (fakeProvider) LookupByISBN(ctx context.Context, isbn string) (*metadata.BookMetadata, error) {
+	return &metadata.BookMetadata{Title: "Dune", Authors: []string{"Frank Herbert"}, Source: "fake"}, nil
+}
+
+func (p fakeProvider) Search(ctx context.Context, title, author string) ([]metadata.BookMetadata, error) {
+	result, _ := p.LookupByISBN(ctx, "")
+	return []metadata.BookMetadata{*result}, nil
+}
+
+func (fakeProvider) GetCoverURL(isbn string, size metadata.CoverSize) string { return "" }
+
+func TestMetadataPlugins(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	t.Cleanup(cleanup)
+	handler.SetMetadataPlugins([]metadata.Provider{fakeProvider{}})
+	userID := setupTestUser(t, handler)
+
+	c, w := createAuthenticatedContext(userID)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/metadata/providers", nil)
+	handler.ListMetadataProviders(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Providers []string `json:"providers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, []string{"openlibrary", "fake"}, list.Providers)
+
+	c, w = createAuthenticatedContext(userID)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/metadata/lookup?title=dune&provider=fake", nil)
+	handler.LookupMetadata(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"source":"fake"`)
+
+	c, w = createAuthenticatedContext(userID)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/metadata/lookup?title=dune&provider=missing", nil)
+	handler.LookupMetadata(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "provider must be one of: openlibrary, fake")
+
+	// A bulk refresh keeps the provider it was asked for until it runs
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "dune", FilePath: "/tmp/dune.epub",
+		FileFormat: models.FileFormatEPUB, ContentType: models.ContentTypeBook, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+
+	bulk := func(body string) *models.Job {
+		c, w := createAuthenticatedContext(userID)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/metadata/bulk-refresh", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.BulkRefreshMetadata(c)
+		if w.Code != http.StatusAccepted {
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			return nil
+		}
+		var queued struct {
+			Job models.Job `json:"job"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+		return &queued.Job
+	}
+	assert.Nil(t, bulk(`{"book_ids": ["`+book.ID+`"], "provider": "missing"}`))
+	job := bulk(`{"book_ids": ["` + book.ID + `"], "provider": "fake"}`)
+	require.NotNil(t, job)
+	assert.Equal(t, "fake", job.Provider)
+
+	startJobQueue(t, handler)
+	require.Eventually(t, func() bool {
+		job, err := handler.db.GetJob(job.ID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	saved, err := handler.db.GetJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "fake", saved.Provider)
+	assert.Equal(t, 1, saved.Succeeded)
+	updated, err := handler.db.GetBook(book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", updated.Title)
+	assert.Equal(t, "Frank Herbert", updated.Author)
+	assert.Equal(t, "fake", updated.MetadataSource)
+}
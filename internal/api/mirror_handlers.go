@@ -0,0 +1,1031 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/mirror"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Sync Key Handlers ====================
+
+// contextSyncKey is the Gin context key for the sync key a request from
+// another server was made with
+const contextSyncKey = "sync_key"
+
+// ListSyncKeys returns the current user's sync keys
+func (h *Handler) ListSyncKeys(c *gin.Context) {
+	keys, err := h.db.ListSyncKeys(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch sync keys")
+		return
+	}
+	if keys == nil {
+		keys = []*models.SyncKey{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys":  keys,
+		"count": len(keys),
+	})
+}
+
+// CreateSyncKey adds a sync key another server mirrors the current user's
+// named collections with. The response holds the key's token, which isn't
+// shown again.
+func (h *Handler) CreateSyncKey(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Collections []string `json:"collections" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "name and collections are required")
+		return
+	}
+
+	key := &models.SyncKey{
+		ID:          uuid.New().String(),
+		UserID:      auth.GetUserID(c),
+		Name:        strings.TrimSpace(req.Name),
+		Collections: collectionNames(req.Collections),
+		CreatedAt:   time.Now(),
+	}
+	if key.Name == "" {
+		apierror.Invalid(c, "name", "name is required")
+		return
+	}
+	if len(key.Collections) == 0 {
+		apierror.Invalid(c, "collections", "Name at least one collection to sync")
+		return
+	}
+	token, hash, err := auth.NewAccountToken()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create sync key")
+		return
+	}
+	if err := h.db.CreateSyncKey(key, hash); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save sync key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":   key,
+		"token": token,
+	})
+}
+
+// DeleteSyncKey removes one of the current user's sync keys. Servers using
+// it can no longer sync, and books they pushed are kept.
+func (h *Handler) DeleteSyncKey(c *gin.Context) {
+	err := h.db.DeleteSyncKey(c.Param("id"), auth.GetUserID(c))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeSyncKeyNotFound, "Sync key not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete sync key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sync key deleted"})
+}
+
+// RequireSyncKey authenticates requests from another Webby server by the
+// sync key in the X-Sync-Key header. They act as the key's user.
+func (h *Handler) RequireSyncKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(mirror.KeyHeader)
+		if token == "" {
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "A sync key is required")
+			c.Abort()
+			return
+		}
+		key, err := h.db.GetSyncKeyByToken(auth.HashAccountToken(token))
+		if err == sql.ErrNoRows {
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid sync key")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check sync key")
+			c.Abort()
+			return
+		}
+
+		if err := h.db.TouchSyncKey(key.ID, time.Now()); err != nil {
+			log.Printf("Warning: failed to record use of sync key %s: %v", key.ID, err)
+		}
+		c.Set(auth.ContextUserID, key.UserID)
+		c.Set(contextSyncKey, key)
+		c.Next()
+	}
+}
+
+// requestSyncKey returns the sync key RequireSyncKey checked
+func requestSyncKey(c *gin.Context) *models.SyncKey {
+	return c.MustGet(contextSyncKey).(*models.SyncKey)
+}
+
+// syncKeyReaches reports whether a sync key was made for the collection
+// with the given name
+func syncKeyReaches(key *models.SyncKey, name string) bool {
+	for _, allowed := range key.Collections {
+		if strings.EqualFold(allowed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncKeyAllows checks that the request's sync key was made for each named
+// collection, writing a 403 response and returning false if not
+func syncKeyAllows(c *gin.Context, names []string) bool {
+	key := requestSyncKey(c)
+	for _, name := range names {
+		if !syncKeyReaches(key, name) {
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden,
+				fmt.Sprintf("This sync key isn't for the collection %q", name))
+			return false
+		}
+	}
+	return true
+}
+
+// syncKeyHasBook reports whether a book is in one of the collections a sync
+// key was made for. Collections that no longer exist are passed over.
+func (h *Handler) syncKeyHasBook(key *models.SyncKey, bookID string) (bool, error) {
+	all, err := h.collections.List(key.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, collection := range all {
+		if !syncKeyReaches(key, collection.Name) {
+			continue
+		}
+		_, members, err := h.collections.Get(collection.ID, key.UserID)
+		if err != nil {
+			return false, err
+		}
+		for _, member := range members {
+			if member.ID == bookID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// collectionNames trims the collection names in a request, dropping blank
+// ones and repeats that differ only in case
+func collectionNames(names []string) []string {
+	var kept []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
+
+// ==================== Mirror Handlers ====================
+
+const (
+	// mirrorCheckTimeout is how long the other server has to answer when a
+	// mirror is added
+	mirrorCheckTimeout = 20 * time.Second
+	// minMirrorInterval is the shortest interval mirrors sync on by
+	// themselves
+	minMirrorInterval = 5
+)
+
+// ListMirrors returns the current user's mirrors
+func (h *Handler) ListMirrors(c *gin.Context) {
+	mirrors, err := h.db.ListMirrors(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch mirrors")
+		return
+	}
+	if mirrors == nil {
+		mirrors = []*models.Mirror{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mirrors": mirrors,
+		"count":   len(mirrors),
+	})
+}
+
+// CreateMirror adds a mirror for the current user. The other server is
+// asked for a manifest first, so a wrong URL or key, or for a pull a
+// collection it doesn't have, is caught before the mirror is saved.
+func (h *Handler) CreateMirror(c *gin.Context) {
+	var req struct {
+		Name            string   `json:"name" binding:"required"`
+		URL             string   `json:"url" binding:"required"`
+		APIKey          string   `json:"api_key" binding:"required"`
+		Direction       string   `json:"direction" binding:"required"`
+		Collections     []string `json:"collections" binding:"required"`
+		IncludeFiles    bool     `json:"include_files"`
+		ConflictRule    string   `json:"conflict_rule"`
+		IntervalMinutes int      `json:"interval_minutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "name, url, api_key, direction, and collections are required")
+		return
+	}
+
+	userID := auth.GetUserID(c)
+	m := &models.Mirror{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		Name:            strings.TrimSpace(req.Name),
+		URL:             strings.TrimRight(strings.TrimSpace(req.URL), "/"),
+		APIKey:          req.APIKey,
+		Direction:       req.Direction,
+		IncludeFiles:    req.IncludeFiles,
+		ConflictRule:    req.ConflictRule,
+		IntervalMinutes: req.IntervalMinutes,
+		Collections:     collectionNames(req.Collections),
+		CreatedAt:       time.Now(),
+	}
+	if m.ConflictRule == "" {
+		m.ConflictRule = models.MirrorConflictSource
+	}
+
+	u, err := url.Parse(m.URL)
+	switch {
+	case m.Name == "":
+		apierror.Invalid(c, "name", "name is required")
+		return
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		apierror.Invalid(c, "url", "url must be an http or https URL")
+		return
+	case m.Direction != models.MirrorPull && m.Direction != models.MirrorPush:
+		apierror.Invalid(c, "direction", "direction must be pull or push")
+		return
+	case len(m.Collections) == 0:
+		apierror.Invalid(c, "collections", "Name at least one collection to sync")
+		return
+	case !validConflictRule(m.ConflictRule):
+		apierror.Invalid(c, "conflict_rule", "conflict_rule must be source, destination, or newest")
+		return
+	case m.IntervalMinutes != 0 && m.IntervalMinutes < minMirrorInterval:
+		apierror.Invalid(c, "interval_minutes", fmt.Sprintf("interval_minutes must be 0 or at least %d", minMirrorInterval))
+		return
+	}
+
+	if m.Direction == models.MirrorPush {
+		if _, missing, err := h.buildMirrorManifest(userID, m.Collections); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch collections")
+			return
+		} else if missing != "" {
+			apierror.Invalid(c, "collections", fmt.Sprintf("No collection named %q", missing))
+			return
+		}
+	}
+
+	// A push only needs the key to work; a pull needs the collections too
+	ctx, cancel := context.WithTimeout(c.Request.Context(), mirrorCheckTimeout)
+	defer cancel()
+	var check []string
+	if m.Direction == models.MirrorPull {
+		check = m.Collections
+	}
+	if _, err := mirror.NewClient(m.URL, m.APIKey).Manifest(ctx, check); err != nil {
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeUpstreamFailed, "Failed to reach the other server: "+err.Error())
+		return
+	}
+
+	if err := h.db.CreateMirror(m); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save mirror")
+		return
+	}
+
+	c.JSON(http.StatusCreated, m)
+}
+
+// validConflictRule reports whether rule is one a mirror can use
+func validConflictRule(rule string) bool {
+	switch rule {
+	case models.MirrorConflictSource, models.MirrorConflictDestination, models.MirrorConflictNewest:
+		return true
+	}
+	return false
+}
+
+// DeleteMirror removes one of the current user's mirrors. Books it synced
+// are kept on both servers.
+func (h *Handler) DeleteMirror(c *gin.Context) {
+	m, ok := h.ownedMirror(c)
+	if !ok {
+		return
+	}
+	if err := h.db.DeleteMirror(m.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete mirror")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mirror deleted"})
+}
+
+// SyncMirror queues a sync of one of the current user's mirrors as a
+// background job
+func (h *Handler) SyncMirror(c *gin.Context) {
+	m, ok := h.ownedMirror(c)
+	if !ok {
+		return
+	}
+	if job := h.mirrorSyncJob(m); job != nil && job.Status == models.JobStatusPaused {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "This mirror's sync is paused; resume its job instead")
+		return
+	} else if job != nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "This mirror is already syncing")
+		return
+	}
+
+	job, err := h.queueMirrorSync(m)
+	if err != nil {
+		log.Printf("Failed to queue sync of mirror %s: %v", m.ID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to queue mirror sync")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Mirror sync queued",
+		"job":     job,
+	})
+}
+
+// GetMirrorStatus reports how one of the current user's mirrors last
+// synced, whether it's syncing now or paused partway, and when it next
+// syncs by itself
+func (h *Handler) GetMirrorStatus(c *gin.Context) {
+	m, ok := h.ownedMirror(c)
+	if !ok {
+		return
+	}
+
+	status := gin.H{
+		"mirror_id":    m.ID,
+		"syncing":      false,
+		"last_sync_at": m.LastSyncAt,
+		"last_status":  m.LastStatus,
+		"last_error":   m.LastError,
+		"last_result":  m.LastResult,
+		"next_sync_at": nextMirrorSync(m),
+	}
+	if job := h.mirrorSyncJob(m); job != nil {
+		status["syncing"] = job.Status != models.JobStatusPaused
+		status["job"] = job
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// StartMirrorSync queues the syncs of mirrors that sync on an interval as
+// they come due, checking every minute until ctx is cancelled
+func (h *Handler) StartMirrorSync(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			mirrors, err := h.db.ListScheduledMirrors()
+			if err != nil {
+				log.Printf("Warning: failed to list mirrors: %v", err)
+				continue
+			}
+			now := time.Now()
+			for _, m := range mirrors {
+				if next := nextMirrorSync(m); next.After(now) || h.mirrorSyncJob(m) != nil {
+					continue
+				}
+				if _, err := h.queueMirrorSync(m); err != nil {
+					log.Printf("Warning: failed to queue sync of mirror %s: %v", m.ID, err)
+				}
+			}
+		}
+	}()
+}
+
+// nextMirrorSync returns when a mirror next syncs by itself, or nil if it
+// only syncs when asked
+func nextMirrorSync(m *models.Mirror) *time.Time {
+	if m.IntervalMinutes <= 0 {
+		return nil
+	}
+	next := m.CreatedAt
+	if m.LastSyncAt != nil {
+		next = *m.LastSyncAt
+	}
+	next = next.Add(time.Duration(m.IntervalMinutes) * time.Minute)
+	return &next
+}
+
+// mirrorSyncJob returns the job syncing a mirror, or nil if it finished.
+// A paused job is returned too, so no second sync is queued beside it.
+func (h *Handler) mirrorSyncJob(m *models.Mirror) *models.Job {
+	if m.LastJobID == "" {
+		return nil
+	}
+	job, err := h.db.GetJob(m.LastJobID)
+	if err != nil || job.Status == models.JobStatusCompleted {
+		return nil
+	}
+	return job
+}
+
+// queueMirrorSync queues a job syncing a mirror
+func (h *Handler) queueMirrorSync(m *models.Mirror) (*models.Job, error) {
+	job, err := h.jobs.Enqueue(m.UserID, models.JobKindMirrorSync, false, []string{m.ID})
+	if err != nil {
+		return nil, err
+	}
+	m.LastJobID = job.ID
+	return job, h.db.SetMirrorJob(m.ID, job.ID)
+}
+
+// ownedMirror loads the current user's mirror named in the URL, writing an
+// error response and returning false if there is none
+func (h *Handler) ownedMirror(c *gin.Context) (*models.Mirror, bool) {
+	m, err := h.db.GetMirror(c.Param("id"))
+	if err == nil && m.UserID != auth.GetUserID(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeMirrorNotFound, "Mirror not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch mirror")
+		return nil, false
+	}
+	return m, true
+}
+
+// syncMirrorItem is the worker for mirror syncs: it syncs the mirror the
+// item names and records how it went on the mirror
+func (h *Handler) syncMirrorItem(ctx context.Context, job *models.Job, item *models.JobItem) {
+	m, err := h.db.GetMirror(item.ItemID)
+	if err != nil {
+		item.Status, item.Reason = models.JobItemSkipped, "Mirror no longer exists"
+		return
+	}
+
+	result, err := h.runMirror(ctx, m)
+	if ctx.Err() != nil {
+		// Left pending, so the sync runs again when the job resumes
+		return
+	}
+	status, message := models.MirrorStatusOK, ""
+	item.Status = models.JobItemSucceeded
+	if err != nil {
+		status, message = models.MirrorStatusFailed, err.Error()
+		item.Status, item.Reason = models.JobItemFailed, message
+	}
+	if err := h.db.FinishMirrorSync(m.ID, time.Now(), status, message, result); err != nil {
+		log.Printf("Warning: failed to record sync of mirror %s: %v", m.ID, err)
+	}
+}
+
+// runMirror syncs a mirror: a pull applies the other server's manifest
+// here, and a push sends this server's to it, then uploads the files it
+// asks for
+func (h *Handler) runMirror(ctx context.Context, m *models.Mirror) (*models.MirrorResult, error) {
+	client := mirror.NewClient(m.URL, m.APIKey)
+	if m.Direction == models.MirrorPull {
+		manifest, err := client.Manifest(ctx, m.Collections)
+		if err != nil {
+			return nil, err
+		}
+		var fetch mirrorFetch
+		if m.IncludeFiles {
+			fetch = func(ctx context.Context, b mirror.Book) (*models.Book, string) {
+				resp, err := client.DownloadFile(ctx, b.ID)
+				if err != nil {
+					return nil, "Download failed: " + err.Error()
+				}
+				defer resp.Body.Close()
+				return h.addMirroredBook(ctx, m.ID, m.UserID, b, resp.Body, max(resp.ContentLength, 0), mirrorFilename(resp, b))
+			}
+		}
+		result, _ := h.applyMirrorManifest(ctx, m.ID, m.UserID, manifest, m.ConflictRule, fetch, false)
+		return result, nil
+	}
+
+	manifest, missing, err := h.buildMirrorManifest(m.UserID, m.Collections)
+	if err != nil {
+		return nil, err
+	}
+	if missing != "" {
+		return nil, fmt.Errorf("no collection named %q", missing)
+	}
+	req := mirror.PushRequest{Manifest: *manifest, ConflictRule: m.ConflictRule, IncludeFiles: m.IncludeFiles}
+	pushed, err := client.Push(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	result := &pushed.Result
+	if len(pushed.NeedFiles) == 0 {
+		return result, nil
+	}
+
+	sent := make(map[string]mirror.Book, len(manifest.Books))
+	for _, b := range manifest.Books {
+		sent[b.ID] = b
+	}
+	for _, id := range pushed.NeedFiles {
+		b, ok := sent[id]
+		if !ok {
+			continue
+		}
+		if reason := h.uploadMirroredBook(ctx, client, b); reason != "" {
+			result.Skipped = append(result.Skipped, models.MirrorSkip{SourceID: b.ID, Title: b.Title, Reason: reason})
+			continue
+		}
+		result.Created++
+		result.FilesCopied++
+	}
+	// The books just uploaded are added to their collections by pushing
+	// the manifest again
+	if _, err := client.Push(ctx, req); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// uploadMirroredBook sends the other server the file of a book a push
+// asked for, returning why it couldn't, or ""
+func (h *Handler) uploadMirroredBook(ctx context.Context, client *mirror.Client, b mirror.Book) string {
+	book, err := h.db.GetBook(b.ID)
+	if err != nil || book.IsPhysical() {
+		return "Book no longer has a file"
+	}
+	f, err := os.Open(book.FilePath)
+	if err != nil {
+		return "Failed to read book file"
+	}
+	defer f.Close()
+	if err := client.UploadFile(ctx, b, bookFileName(book)+"."+book.FileFormat, f); err != nil {
+		return "Upload failed: " + err.Error()
+	}
+	return ""
+}
+
+// mirrorFilename names a file downloaded from another server: the name it
+// gave the file if that has the right extension, else the book's ID
+func mirrorFilename(resp *http.Response, b mirror.Book) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name := path.Base(params["filename"])
+		if f, _, ok := books.FileFormat(name); ok && f == b.FileFormat {
+			return name
+		}
+	}
+	return b.ID + "." + b.FileFormat
+}
+
+// ==================== Mirror Sync ====================
+
+// mirrorFetch downloads and adds a book that's missing on the destination,
+// returning it, or nil and why it couldn't
+type mirrorFetch func(ctx context.Context, b mirror.Book) (*models.Book, string)
+
+// buildMirrorManifest describes the named collections of userID's library,
+// with the books in them userID can see. It returns the first name with no
+// collection, if any.
+func (h *Handler) buildMirrorManifest(userID string, names []string) (*mirror.Manifest, string, error) {
+	all, err := h.collections.List(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest := &mirror.Manifest{Collections: []mirror.Collection{}, Books: []mirror.Book{}}
+	added := make(map[string]bool)
+	for _, name := range names {
+		var found *models.Collection
+		for i := range all {
+			if strings.EqualFold(all[i].Name, name) {
+				found = &all[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, name, nil
+		}
+
+		_, members, err := h.collections.Get(found.ID, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		collection := mirror.Collection{Name: found.Name, BookIDs: []string{}}
+		for _, member := range members {
+			// Members are listed with only some of their columns
+			book, err := h.db.GetBook(member.ID)
+			if err != nil || !h.policy.CanRead(book, userID) {
+				continue
+			}
+			collection.BookIDs = append(collection.BookIDs, book.ID)
+			if !added[book.ID] {
+				added[book.ID] = true
+				manifest.Books = append(manifest.Books, mirror.FromBook(book))
+			}
+		}
+		manifest.Collections = append(manifest.Collections, collection)
+	}
+	return manifest, "", nil
+}
+
+// applyMirrorManifest syncs a source's manifest into userID's library.
+// peerID is the mirror pulling it or the sync key it was pushed with.
+// Books already here get the source's metadata by the conflict rule;
+// missing ones are fetched, or, when wantFiles is set, returned to be
+// uploaded, or else skipped. Physical books are always added. The named
+// collections are then made to hold the same books.
+func (h *Handler) applyMirrorManifest(ctx context.Context, peerID, userID string, manifest *mirror.Manifest, rule string, fetch mirrorFetch, wantFiles bool) (*models.MirrorResult, []string) {
+	result := &models.MirrorResult{Conflicts: []models.MirrorConflict{}, Skipped: []models.MirrorSkip{}}
+	needFiles := []string{}
+	local := make(map[string]string, len(manifest.Books)) // Source ID to book ID here
+
+	for _, b := range manifest.Books {
+		if ctx.Err() != nil {
+			return result, needFiles
+		}
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, models.MirrorSkip{SourceID: b.ID, Title: b.Title, Reason: reason})
+		}
+
+		book, synced := h.mirroredBook(peerID, userID, b)
+		if book == nil {
+			var reason string
+			switch {
+			case b.IsPhysical():
+				book, reason = h.addMirroredBook(ctx, peerID, userID, b, nil, 0, "")
+			case fetch != nil:
+				if book, reason = fetch(ctx, b); book != nil {
+					result.FilesCopied++
+				}
+			case wantFiles:
+				needFiles = append(needFiles, b.ID)
+				continue
+			default:
+				reason = "Not in this library, and files aren't copied"
+			}
+			if book == nil {
+				skip(reason)
+				continue
+			}
+			result.Created++
+			local[b.ID] = book.ID
+			continue
+		}
+
+		outcome := mirror.Resolve(rule, b, mirror.FromBook(book), synced)
+		switch outcome {
+		case mirror.Unchanged:
+			result.Unchanged++
+		case mirror.ConflictKept:
+			result.Conflicts = append(result.Conflicts, models.MirrorConflict{
+				BookID: book.ID, Title: book.Title, Kept: models.MirrorConflictDestination,
+			})
+		case mirror.TakeSource, mirror.ConflictTook:
+			updated := *book
+			b.ApplyTo(&updated)
+			if err := h.saveBookMetadata(&updated, userID); err != nil {
+				log.Printf("Failed to save mirrored metadata of %s: %v", book.ID, err)
+				skip("Failed to save book")
+				continue
+			}
+			h.syncSubjectTags(&updated, userID)
+			result.Updated++
+			if outcome == mirror.ConflictTook {
+				result.Conflicts = append(result.Conflicts, models.MirrorConflict{
+					BookID: book.ID, Title: updated.Title, Kept: models.MirrorConflictSource,
+				})
+			}
+		}
+		if err := h.db.SaveMirrorBook(peerID, b.ID, book.ID, b.Fingerprint()); err != nil {
+			log.Printf("Warning: failed to record mirrored book %s: %v", book.ID, err)
+		}
+		local[b.ID] = book.ID
+	}
+
+	h.syncMirrorCollections(peerID, userID, manifest.Collections, local, result)
+	return result, needFiles
+}
+
+// mirroredBook returns userID's copy of a source's book and the
+// fingerprint of the source's metadata when it was last synced: the book
+// synced from the peer before, else one with the same file, which hasn't
+// been synced. It returns nil if there is neither.
+func (h *Handler) mirroredBook(peerID, userID string, b mirror.Book) (*models.Book, string) {
+	if bookID, synced, err := h.db.GetMirrorBook(peerID, b.ID); err == nil {
+		if book, err := h.db.GetBook(bookID); err == nil && book.UserID == userID {
+			return book, synced
+		}
+	}
+	if b.FileHash == "" {
+		return nil, ""
+	}
+	matches, err := h.db.GetBooksByHash(b.FileHash)
+	if err != nil {
+		return nil, ""
+	}
+	for i := range matches {
+		if matches[i].UserID == userID {
+			return &matches[i], ""
+		}
+	}
+	return nil, ""
+}
+
+// addMirroredBook adds a source's book to userID's library with the
+// source's metadata, importing its file from r, or without a file for a
+// physical book. It returns the book, or nil and why it couldn't.
+func (h *Handler) addMirroredBook(ctx context.Context, peerID, userID string, b mirror.Book, r io.Reader, size int64, filename string) (*models.Book, string) {
+	var book *models.Book
+	if b.IsPhysical() {
+		book = &models.Book{
+			ID:            uuid.New().String(),
+			UserID:        userID,
+			UploadedAt:    time.Now(),
+			ContentType:   b.ContentType,
+			ContentSource: models.ContentSourcePhysical,
+		}
+		if book.ContentType != models.ContentTypeComic {
+			book.ContentType = models.ContentTypeBook
+		}
+		b.ApplyTo(book)
+		if err := h.db.CreateBook(book); err != nil {
+			log.Printf("Failed to save mirrored book: %v", err)
+			return nil, "Failed to save book"
+		}
+		if userID != "" {
+			if err := h.applyVisibility(book, h.uploadVisibility(userID)); err != nil {
+				log.Printf("Warning: failed to set visibility of %s: %v", book.ID, err)
+			}
+		}
+	} else {
+		var reason string
+		if book, reason = h.importDownload(ctx, r, size, filename, userID); book == nil {
+			return nil, reason
+		}
+		updated := *book
+		b.ApplyTo(&updated)
+		if err := h.saveBookMetadata(&updated, userID); err != nil {
+			log.Printf("Warning: failed to save mirrored metadata of %s: %v", book.ID, err)
+		} else {
+			*book = updated
+		}
+	}
+
+	if err := h.db.SaveMirrorBook(peerID, b.ID, book.ID, b.Fingerprint()); err != nil {
+		log.Printf("Warning: failed to record mirrored book %s: %v", book.ID, err)
+	}
+	h.syncSubjectTags(book, userID)
+	h.recordActivity(userID, models.ActivityBookAdded, book.ID, 0)
+	return book, ""
+}
+
+// syncMirrorCollections makes userID's collections with the manifest's
+// names hold the same books, creating them if needed. Only books synced
+// from the peer are removed, so books added here stay.
+func (h *Handler) syncMirrorCollections(peerID, userID string, collections []mirror.Collection, local map[string]string, result *models.MirrorResult) {
+	existing, err := h.collections.List(userID)
+	if err != nil {
+		log.Printf("Failed to fetch collections to mirror: %v", err)
+		return
+	}
+	mirroredIDs, err := h.db.ListMirrorBookIDs(peerID)
+	if err != nil {
+		log.Printf("Failed to fetch mirrored books: %v", err)
+		return
+	}
+	mirrored := make(map[string]bool, len(mirroredIDs))
+	for _, id := range mirroredIDs {
+		mirrored[id] = true
+	}
+
+	for _, mc := range collections {
+		var target *models.Collection
+		smart := false
+		for i := range existing {
+			if strings.EqualFold(existing[i].Name, mc.Name) {
+				if !existing[i].IsSmart {
+					target = &existing[i]
+					break
+				}
+				smart = true
+			}
+		}
+		if target == nil && smart {
+			result.Skipped = append(result.Skipped, models.MirrorSkip{Title: mc.Name, Reason: "A smart collection here has this name"})
+			continue
+		}
+		if target == nil {
+			if target, err = h.collections.Create(userID, mc.Name, "", false, "", nil); err != nil {
+				log.Printf("Failed to create mirrored collection %q: %v", mc.Name, err)
+				continue
+			}
+			existing = append(existing, *target)
+		}
+
+		_, members, err := h.collections.Get(target.ID, userID)
+		if err != nil {
+			log.Printf("Failed to fetch mirrored collection %q: %v", mc.Name, err)
+			continue
+		}
+		want := make(map[string]bool, len(mc.BookIDs))
+		var add []string
+		for _, sourceID := range mc.BookIDs {
+			if id, ok := local[sourceID]; ok && !want[id] {
+				want[id] = true
+				add = append(add, id)
+			}
+		}
+		have := make(map[string]bool, len(members))
+		for _, member := range members {
+			have[member.ID] = true
+			if mirrored[member.ID] && !want[member.ID] {
+				if err := h.collections.RemoveBook(target.ID, member.ID); err != nil {
+					log.Printf("Warning: failed to remove %s from collection %q: %v", member.ID, mc.Name, err)
+				}
+			}
+		}
+		var missing []string
+		for _, id := range add {
+			if !have[id] {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			if err := h.collections.AddBooks(target.ID, missing); err != nil {
+				log.Printf("Warning: failed to add books to collection %q: %v", mc.Name, err)
+			}
+		}
+		result.Collections++
+	}
+}
+
+// ==================== Mirror Peer Handlers ====================
+
+// GetMirrorManifest describes the collections named by the collection
+// query parameters, with the books in them the sync key's user can see,
+// for a server pulling them. The key must have been made for each one.
+func (h *Handler) GetMirrorManifest(c *gin.Context) {
+	names := c.QueryArray("collection")
+	if !syncKeyAllows(c, names) {
+		return
+	}
+	manifest, missing, err := h.buildMirrorManifest(auth.GetUserID(c), names)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch collections")
+		return
+	}
+	if missing != "" {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeCollectionNotFound, fmt.Sprintf("No collection named %q", missing))
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// PushMirror syncs a manifest another server pushed into the sync key's
+// user's library, listing the books whose files it should upload. Every
+// collection in it must be one the key was made for.
+func (h *Handler) PushMirror(c *gin.Context) {
+	var req mirror.PushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid manifest")
+		return
+	}
+	if req.ConflictRule == "" {
+		req.ConflictRule = models.MirrorConflictSource
+	}
+	if !validConflictRule(req.ConflictRule) {
+		apierror.Invalid(c, "conflict_rule", "conflict_rule must be source, destination, or newest")
+		return
+	}
+	names := make([]string, len(req.Manifest.Collections))
+	for i, collection := range req.Manifest.Collections {
+		names[i] = collection.Name
+	}
+	if !syncKeyAllows(c, names) {
+		return
+	}
+
+	result, needFiles := h.applyMirrorManifest(c.Request.Context(), requestSyncKey(c).ID, auth.GetUserID(c),
+		&req.Manifest, req.ConflictRule, nil, req.IncludeFiles)
+	if err := c.Request.Context().Err(); err != nil {
+		requestEnded(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mirror.PushResponse{Result: *result, NeedFiles: needFiles})
+}
+
+// GetMirrorBookFile sends the main file of a book the sync key's user can
+// see, for a server pulling it. Only books in the key's collections are
+// sent.
+func (h *Handler) GetMirrorBookFile(c *gin.Context) {
+	book, err := h.db.GetBook(c.Param("id"))
+	if err == nil && !h.policy.CanRead(book, auth.GetUserID(c)) {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		var reached bool
+		if reached, err = h.syncKeyHasBook(requestSyncKey(c), book.ID); err == nil && !reached {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch book")
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	serveBookFile(c, book, primaryFile(book))
+}
+
+// UploadMirrorBookFile adds a book a push asked for to the sync key's
+// user's library, from a multipart form with the book's file and, as the
+// book field, its manifest entry. A book already added is returned as is.
+func (h *Handler) UploadMirrorBookFile(c *gin.Context) {
+	key := requestSyncKey(c)
+	userID := auth.GetUserID(c)
+
+	var b mirror.Book
+	if err := json.Unmarshal([]byte(c.PostForm("book")), &b); err != nil {
+		apierror.Invalid(c, "book", "book must be the book's manifest entry")
+		return
+	}
+	b.ID = c.Param("id")
+	if existing, _ := h.mirroredBook(key.ID, userID, b); existing != nil {
+		c.JSON(http.StatusOK, gin.H{"book": existing})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		apierror.Invalid(c, "file", "No file provided")
+		return
+	}
+	if !h.allowUploadSize(c, header.Filename, header.Size) {
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read uploaded file")
+		return
+	}
+	defer file.Close()
+
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	book, reason := h.addMirroredBook(c.Request.Context(), key.ID, userID, b, file, header.Size, header.Filename)
+	if err := c.Request.Context().Err(); err != nil {
+		requestEnded(c, err)
+		return
+	}
+	if book == nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, reason)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"book": book})
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/mirror"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// mirrorPeer serves a handler's mirror endpoints, as another Webby server
+// would
+func mirrorPeer(t *testing.T, handler *Handler) *httptest.Server {
+	r := gin.New()
+	peer := r.Group("/api/mirror")
+	peer.Use(handler.RequireSyncKey())
+	peer.GET("/manifest", handler.GetMirrorManifest)
+	peer.POST("/push", handler.PushMirror)
+	peer.GET("/books/:id/file", handler.GetMirrorBookFile)
+	peer.POST("/books/:id/file", handler.UploadMirrorBookFile)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// mirrorLibrary gives userID a "Classics" collection holding an EPUB and a
+// paper book, returning them in that order
+func mirrorLibrary(t *testing.T, handler *Handler, userID string) (*models.Book, *models.Book) {
+	epub := createTestEPUBBook(t, handler, userID, "<p>Call me Ishmael.</p>")
+	epub.Title, epub.Author = "Moby-Dick", "Herman Melville"
+	require.NoError(t, handler.db.UpdateBookMetadata(epub))
+	paper := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Walden", Author: "Henry David Thoreau",
+		ContentType: models.ContentTypeBook, ContentSource: models.ContentSourcePhysical, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(paper))
+
+	collection, err := handler.collections.Create(userID, "Classics", "", false, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, handler.collections.AddBooks(collection.ID, []string{epub.ID, paper.ID}))
+	return epub, paper
+}
+
+// mirrorCall runs a mirror handler as userID
+func mirrorCall(userID string, handle gin.HandlerFunc, method, target, body, id string) *httptest.ResponseRecorder {
+	c, w := createAuthenticatedContext(userID)
+	c.Params = []gin.Param{{Key: "id", Value: id}}
+	c.Request, _ = http.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handle(c)
+	return w
+}
+
+// newSyncKey creates a sync key for userID's "Classics" collection and
+// returns its token
+func newSyncKey(t *testing.T, handler *Handler, userID string) string {
+	w := mirrorCall(userID, handler.CreateSyncKey, http.MethodPost, "/api/sync-keys", `{"name": "Laptop", "collections": ["Classics"]}`, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Token)
+	return created.Token
+}
+
+// syncMirror syncs a mirror and waits for it to finish
+func syncMirror(t *testing.T, handler *Handler, userID, mirrorID string) *models.Mirror {
+	w := mirrorCall(userID, handler.SyncMirror, http.MethodPost, "/api/mirrors/"+mirrorID+"/sync", "", mirrorID)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued struct {
+		Job models.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+	require.Eventually(t, func() bool {
+		job, err := handler.db.GetJob(queued.Job.ID)
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	m, err := handler.db.GetMirror(mirrorID)
+	require.NoError(t, err)
+	require.Equal(t, models.MirrorStatusOK, m.LastStatus, m.LastError)
+	return m
+}
+
+// mirroredCollection returns the titles in userID's collection with the
+// given name
+func mirroredCollection(t *testing.T, handler *Handler, userID, name string) []string {
+	all, err := handler.collections.List(userID)
+	require.NoError(t, err)
+	for _, collection := range all {
+		if collection.Name == name {
+			_, members, err := handler.collections.Get(collection.ID, userID)
+			require.NoError(t, err)
+			var titles []string
+			for _, b := range members {
+				titles = append(titles, b.Title)
+			}
+			return titles
+		}
+	}
+	t.Fatalf("no collection named %q", name)
+	return nil
+}
+
+func TestMirrorPull(t *testing.T) {
+	source, cleanupSource := setupTestHandler(t)
+	t.Cleanup(cleanupSource)
+	dest, cleanupDest := setupTestHandler(t)
+	t.Cleanup(cleanupDest)
+
+	sourceUser := setupTestUser(t, source)
+	destUser := setupTestUser(t, dest)
+	epub, _ := mirrorLibrary(t, source, sourceUser)
+	token := newSyncKey(t, source, sourceUser)
+	server := mirrorPeer(t, source)
+
+	// Only requests with a valid key are answered
+	for key, code := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, token: http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/mirror/manifest?collection=Classics", nil)
+		req.Header.Set(mirror.KeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, code, resp.StatusCode, "key %q", key)
+	}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		return mirrorCall(destUser, dest.CreateMirror, http.MethodPost, "/api/mirrors", body, "")
+	}
+	w := create(`{"name": "Home", "url": "` + server.URL + `", "api_key": "` + token + `", "direction": "pull", "collections": ["Poetry"]}`)
+	assert.Equal(t, http.StatusBadGateway, w.Code, "the other server has no such collection")
+	w = create(`{"name": "Home", "url": "` + server.URL + `", "api_key": "` + token + `", "direction": "pull", "collections": ["Classics"], "interval_minutes": 1}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = create(`{"name": "Home", "url": "` + server.URL + `", "api_key": "` + token + `", "direction": "pull", "collections": ["Classics"], "include_files": true}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), token)
+	var created models.Mirror
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	startJobQueue(t, dest)
+
+	m := syncMirror(t, dest, destUser, created.ID)
+	require.NotNil(t, m.LastResult)
+	assert.Equal(t, 2, m.LastResult.Created)
+	assert.Equal(t, 1, m.LastResult.FilesCopied)
+	assert.Equal(t, 1, m.LastResult.Collections)
+	assert.ElementsMatch(t, []string{"Moby-Dick", "Walden"}, mirroredCollection(t, dest, destUser, "Classics"))
+
+	// Only the source changed, so its edit is copied
+	epub.Title = "Moby-Dick; or, The Whale"
+	require.NoError(t, source.db.UpdateBookMetadata(epub))
+	m = syncMirror(t, dest, destUser, created.ID)
+	assert.Equal(t, 0, m.LastResult.Created)
+	assert.Equal(t, 1, m.LastResult.Updated)
+	assert.Equal(t, 1, m.LastResult.Unchanged)
+	assert.Empty(t, m.LastResult.Conflicts)
+	assert.Contains(t, mirroredCollection(t, dest, destUser, "Classics"), "Moby-Dick; or, The Whale")
+
+	// Only the destination changed, so its edit is kept
+	destBooks, err := dest.db.ListBooksForUser(destUser, "title", "asc")
+	require.NoError(t, err)
+	for i := range destBooks {
+		if destBooks[i].Title == "Walden" {
+			destBooks[i].Title = "Walden; or, Life in the Woods"
+			require.NoError(t, dest.db.UpdateBookMetadata(&destBooks[i]))
+		}
+	}
+	m = syncMirror(t, dest, destUser, created.ID)
+	assert.Equal(t, 2, m.LastResult.Unchanged)
+	assert.Contains(t, mirroredCollection(t, dest, destUser, "Classics"), "Walden; or, Life in the Woods")
+
+	w = mirrorCall(destUser, dest.GetMirrorStatus, http.MethodGet, "/api/mirrors/"+created.ID+"/status", "", created.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var status struct {
+		Syncing    bool                 `json:"syncing"`
+		LastStatus string               `json:"last_status"`
+		LastResult *models.MirrorResult `json:"last_result"`
+		NextSyncAt *time.Time           `json:"next_sync_at"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.False(t, status.Syncing)
+	assert.Equal(t, models.MirrorStatusOK, status.LastStatus)
+	assert.Equal(t, 2, status.LastResult.Unchanged)
+	assert.Nil(t, status.NextSyncAt, "the mirror only syncs when asked")
+
+	otherID := createNamedUser(t, dest, "other")
+	w = mirrorCall(otherID, dest.GetMirrorStatus, http.MethodGet, "/api/mirrors/"+created.ID+"/status", "", created.ID)
+	assert.Equal(t, http.StatusNotFound, w.Code, "mirrors are private")
+}
+
+func TestMirrorSyncKeyScope(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	epub, _ := mirrorLibrary(t, handler, userID)
+	private := createTestEPUBBook(t, handler, userID, "<p>Dear diary.</p>")
+	collection, err := handler.collections.Create(userID, "Private", "", false, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, handler.collections.AddBooks(collection.ID, []string{private.ID}))
+
+	w := mirrorCall(userID, handler.CreateSyncKey, http.MethodPost, "/api/sync-keys", `{"name": "Laptop", "collections": [" "]}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a key needs a collection")
+	token := newSyncKey(t, handler, userID)
+	server := mirrorPeer(t, handler)
+
+	get := func(path string) int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set(mirror.KeyHeader, token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get("/api/mirror/manifest?collection=classics"))
+	assert.Equal(t, http.StatusForbidden, get("/api/mirror/manifest?collection=Classics&collection=Private"))
+	assert.Equal(t, http.StatusOK, get("/api/mirror/books/"+epub.ID+"/file"))
+	assert.Equal(t, http.StatusNotFound, get("/api/mirror/books/"+private.ID+"/file"),
+		"the user can read the book, but it isn't in the key's collections")
+
+	body := `{"manifest": {"collections": [{"name": "Private", "book_ids": []}], "books": []}}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/mirror/push", strings.NewReader(body))
+	req.Header.Set(mirror.KeyHeader, token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "pushes are held to the key's collections too")
+}
+
+func TestMirrorPausedSync(t *testing.T) {
+	source, cleanupSource := setupTestHandler(t)
+	defer cleanupSource()
+	dest, cleanupDest := setupTestHandler(t)
+	defer cleanupDest()
+
+	sourceUser := setupTestUser(t, source)
+	destUser := setupTestUser(t, dest)
+	mirrorLibrary(t, source, sourceUser)
+	token := newSyncKey(t, source, sourceUser)
+	server := mirrorPeer(t, source)
+
+	w := mirrorCall(destUser, dest.CreateMirror, http.MethodPost, "/api/mirrors",
+		`{"name": "Home", "url": "`+server.URL+`", "api_key": "`+token+`", "direction": "pull", "collections": ["Classics"]}`, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.Mirror
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	// The job queue isn't started, so the sync stays queued until paused
+	w = mirrorCall(destUser, dest.SyncMirror, http.MethodPost, "/api/mirrors/"+created.ID+"/sync", "", created.ID)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var queued struct {
+		Job models.Job `json:"job"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &queued))
+
+	status := func() (bool, *models.Job) {
+		w := mirrorCall(destUser, dest.GetMirrorStatus, http.MethodGet, "/api/mirrors/"+created.ID+"/status", "", created.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var status struct {
+			Syncing bool        `json:"syncing"`
+			Job     *models.Job `json:"job"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		return status.Syncing, status.Job
+	}
+	syncing, job := status()
+	assert.True(t, syncing)
+	require.NotNil(t, job)
+	assert.Equal(t, models.JobStatusQueued, job.Status)
+
+	paused, err := dest.jobs.Pause(queued.Job.ID)
+	require.NoError(t, err)
+	require.True(t, paused)
+	syncing, job = status()
+	assert.False(t, syncing, "a paused sync isn't running")
+	require.NotNil(t, job)
+	assert.Equal(t, models.JobStatusPaused, job.Status)
+
+	w = mirrorCall(destUser, dest.SyncMirror, http.MethodPost, "/api/mirrors/"+created.ID+"/sync", "", created.ID)
+	assert.Equal(t, http.StatusConflict, w.Code, "the paused job is resumed rather than queued again")
+}
+
+func TestMirrorPush(t *testing.T) {
+	source, cleanupSource := setupTestHandler(t)
+	t.Cleanup(cleanupSource)
+	dest, cleanupDest := setupTestHandler(t)
+	t.Cleanup(cleanupDest)
+
+	sourceUser := setupTestUser(t, source)
+	destUser := setupTestUser(t, dest)
+	epub, _ := mirrorLibrary(t, source, sourceUser)
+	token := newSyncKey(t, dest, destUser)
+	server := mirrorPeer(t, dest)
+
+	w := mirrorCall(sourceUser, source.CreateMirror, http.MethodPost, "/api/mirrors",
+		`{"name": "Away", "url": "`+server.URL+`", "api_key": "`+token+`", "direction": "push", "collections": ["Poetry"]}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "only collections this server has can be pushed")
+	w = mirrorCall(sourceUser, source.CreateMirror, http.MethodPost, "/api/mirrors",
+		`{"name": "Away", "url": "`+server.URL+`", "api_key": "`+token+`", "direction": "push", "collections": ["classics"], "include_files": true, "conflict_rule": "destination"}`, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.Mirror
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	startJobQueue(t, source)
+
+	m := syncMirror(t, source, sourceUser, created.ID)
+	assert.Equal(t, 2, m.LastResult.Created, "the paper book is added, and the EPUB's file uploaded")
+	assert.Equal(t, 1, m.LastResult.FilesCopied)
+	assert.ElementsMatch(t, []string{"Moby-Dick", "Walden"}, mirroredCollection(t, dest, destUser, "Classics"))
+
+	// Both sides edit the same book, and the destination's edit is kept
+	epub.Title = "Moby-Dick; or, The Whale"
+	require.NoError(t, source.db.UpdateBookMetadata(epub))
+	destBooks, err := dest.db.ListBooksForUser(destUser, "title", "asc")
+	require.NoError(t, err)
+	for i := range destBooks {
+		if destBooks[i].Title == "Moby-Dick" {
+			destBooks[i].Title = "Moby-Dick (Annotated)"
+			require.NoError(t, dest.db.UpdateBookMetadata(&destBooks[i]))
+		}
+	}
+	m = syncMirror(t, source, sourceUser, created.ID)
+	require.Len(t, m.LastResult.Conflicts, 1)
+	assert.Equal(t, models.MirrorConflictDestination, m.LastResult.Conflicts[0].Kept)
+	assert.Contains(t, mirroredCollection(t, dest, destUser, "Classics"), "Moby-Dick (Annotated)")
+}
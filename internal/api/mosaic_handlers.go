@@ -0,0 +1,157 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+)
+
+// ==================== Cover Mosaic Handlers ====================
+
+// Kinds of group with a cover mosaic, as named in its cache file
+const (
+	mosaicCollection  = "collection"
+	mosaicTag         = "tag"
+	mosaicReadingList = "reading-list"
+)
+
+// GetCollectionCover serves a mosaic of the covers of the first books in a
+// collection
+func (h *Handler) GetCollectionCover(c *gin.Context) {
+	collection, members, err := h.collections.Get(c.Param("id"), auth.GetUserID(c))
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch collection")
+		return
+	}
+	h.serveMosaic(c, mosaicCollection, collection.ID, bookIDs(members))
+}
+
+// GetTagCover serves a mosaic of the covers of the first books with one of
+// the current user's tags
+func (h *Handler) GetTagCover(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	tag, err := h.db.GetTag(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tag")
+		return
+	}
+	if tag.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+
+	tagged, err := h.db.GetBooksByTag(tag.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+	ids := make([]string, len(tagged))
+	for i, book := range tagged {
+		ids[i] = book.ID
+	}
+	h.serveMosaic(c, mosaicTag, tag.ID, ids)
+}
+
+// GetReadingListCover serves a mosaic of the covers of the first books in
+// one of the current user's reading lists, in list order
+func (h *Handler) GetReadingListCover(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	list, err := h.db.GetReadingList(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingListNotFound, "Reading list not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading list")
+		return
+	}
+	if list.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+
+	listed, err := h.db.GetBooksInReadingList(list.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+	h.serveMosaic(c, mosaicReadingList, list.ID, bookIDs(listed))
+}
+
+// serveMosaic serves the cover mosaic of a group of books, made from the
+// first covers the caller can see. Mosaics are cached by the covers in
+// them, so one is made again when the group's first books or their covers
+// change.
+func (h *Handler) serveMosaic(c *gin.Context, kind, id string, memberIDs []string) {
+	userID := auth.GetUserID(c)
+	var covers []string
+	digest := sha256.New()
+	for _, memberID := range memberIDs {
+		if len(covers) == books.MosaicCovers {
+			break
+		}
+		book, err := h.db.GetBook(memberID)
+		if err != nil || book.CoverPath == "" || !h.policy.CanRead(book, userID) {
+			continue
+		}
+		etag := fileETag(book.CoverPath)
+		if etag == "" {
+			continue
+		}
+		covers = append(covers, book.CoverPath)
+		digest.Write([]byte(book.CoverPath + etag + "\n"))
+	}
+	if len(covers) == 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No covers to show")
+		return
+	}
+
+	path := h.files.MosaicPath(kind, id, hex.EncodeToString(digest.Sum(nil))[:16])
+	if _, err := os.Stat(path); err != nil {
+		data, err := books.CoverMosaic(covers)
+		if errors.Is(err, books.ErrNoCovers) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No covers to show")
+			return
+		}
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to make cover mosaic")
+			return
+		}
+		// A failed cache write only costs making it again next time
+		if err := h.files.SaveMosaic(path, data); err != nil {
+			log.Printf("Warning: failed to cache cover mosaic of %s %s: %v", kind, id, err)
+			c.Data(http.StatusOK, "image/jpeg", data)
+			return
+		}
+	}
+
+	if etag := fileETag(path); etag != "" {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	c.File(path)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestCoverMosaics(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	userID := setupTestUser(t, handler)
+	otherID := createNamedUser(t, handler, "other")
+
+	// Books with small solid covers, and one without a cover
+	var bookIDs []string
+	for i, c := range []color.RGBA{{0xff, 0, 0, 0xff}, {0, 0xff, 0, 0xff}, {0, 0, 0xff, 0xff}} {
+		img := image.NewRGBA(image.Rect(0, 0, 20, 30))
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 20; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		id := uuid.New().String()
+		coverPath, err := handler.files.SaveCover(id, buf.Bytes(), ".png")
+		require.NoError(t, err)
+		require.NoError(t, handler.db.CreateBook(&models.Book{
+			ID: id, UserID: userID, Title: string(rune('A' + i)), FilePath: "/tmp/test.epub",
+			CoverPath: coverPath, UploadedAt: time.Now(), ContentType: models.ContentTypeBook,
+		}))
+		bookIDs = append(bookIDs, id)
+	}
+	bareID := setupTestBook(t, handler, userID)
+
+	list := &models.ReadingList{ID: uuid.New().String(), UserID: userID, Name: "Summer", ListType: models.ReadingListCustom}
+	require.NoError(t, handler.db.CreateReadingList(list))
+	for _, id := range append([]string{bareID}, bookIDs[:2]...) {
+		require.NoError(t, handler.db.AddBookToReadingList(id, list.ID))
+	}
+	tag := &models.Tag{ID: uuid.New().String(), UserID: otherID, Name: "Theirs"}
+	require.NoError(t, handler.db.CreateTag(tag))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/reading-lists/:id/cover", handler.GetReadingListCover)
+	r.GET("/tags/:id/cover", handler.GetTagCover)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/reading-lists/" + list.ID + "/cover")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	cached, err := filepath.Glob(handler.files.MosaicPath(mosaicReadingList, list.ID, "*"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+	assert.Equal(t, etag, get("/reading-lists/"+list.ID+"/cover").Header().Get("ETag"), "served from the cache")
+
+	// Changing the books makes a new mosaic in place of the old one
+	require.NoError(t, handler.db.AddBookToReadingList(bookIDs[2], list.ID))
+	w = get("/reading-lists/" + list.ID + "/cover")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	_, err = os.Stat(cached[0])
+	assert.True(t, os.IsNotExist(err), "the old mosaic is removed")
+
+	assert.Equal(t, http.StatusForbidden, get("/tags/"+tag.ID+"/cover").Code)
+	assert.Equal(t, http.StatusNotFound, get("/tags/missing/cover").Code)
+
+	empty := &models.ReadingList{ID: uuid.New().String(), UserID: userID, Name: "Empty", ListType: models.ReadingListCustom}
+	require.NoError(t, handler.db.CreateReadingList(empty))
+	require.NoError(t, handler.db.AddBookToReadingList(bareID, empty.ID))
+	assert.Equal(t, http.StatusNotFound, get("/reading-lists/"+empty.ID+"/cover").Code, "no covers to show")
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/notify"
+)
+
+// ==================== Notification Handlers ====================
+
+// ListNotificationChannels returns the user's notification channels
+func (h *Handler) ListNotificationChannels(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	channels, err := h.db.ListNotificationChannels(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch notification channels")
+		return
+	}
+
+	if channels == nil {
+		channels = []*models.NotificationChannel{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channels":  channels,
+		"count":     len(channels),
+		"available": h.notifier.AvailableChannels(),
+	})
+}
+
+// CreateNotificationChannel adds a new notification destination
+func (h *Handler) CreateNotificationChannel(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Type    string `json:"type" binding:"required"`
+		Name    string `json:"name"`
+		Target  string `json:"target" binding:"required"`
+		Token   string `json:"token"`
+		Enabled *bool  `json:"enabled"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Type and target are required")
+		return
+	}
+
+	if !h.notifier.IsSupported(req.Type) {
+		apierror.Invalid(c, "type", "Invalid channel type. Must be email, webhook, ntfy, or gotify")
+		return
+	}
+
+	req.Target = strings.TrimSpace(req.Target)
+	if msg := validateNotificationTarget(req.Type, req.Target); msg != "" {
+		apierror.Invalid(c, "target", msg)
+		return
+	}
+
+	if req.Type == models.NotificationChannelGotify && req.Token == "" {
+		apierror.Invalid(c, "token", "Gotify channels require an application token")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = req.Type
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	channel := &models.NotificationChannel{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      req.Type,
+		Name:      name,
+		Target:    req.Target,
+		Token:     req.Token,
+		HasToken:  req.Token != "",
+		Enabled:   enabled,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.db.CreateNotificationChannel(channel); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create notification channel")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Notification channel created",
+		"channel": channel,
+	})
+}
+
+// UpdateNotificationChannel updates a notification destination
+func (h *Handler) UpdateNotificationChannel(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	channel, ok := h.getOwnedNotificationChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name    string  `json:"name"`
+		Target  string  `json:"target"`
+		Token   *string `json:"token"`
+		Enabled *bool   `json:"enabled"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	// Use existing values if not provided
+	if name := strings.TrimSpace(req.Name); name != "" {
+		channel.Name = name
+	}
+	if target := strings.TrimSpace(req.Target); target != "" {
+		if msg := validateNotificationTarget(channel.Type, target); msg != "" {
+			apierror.Invalid(c, "target", msg)
+			return
+		}
+		channel.Target = target
+	}
+	if req.Token != nil {
+		channel.Token = *req.Token
+		channel.HasToken = channel.Token != ""
+	}
+	if req.Enabled != nil {
+		channel.Enabled = *req.Enabled
+	}
+
+	if err := h.db.UpdateNotificationChannel(channel); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update notification channel")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notification channel updated",
+		"channel": channel,
+	})
+}
+
+// DeleteNotificationChannel removes a notification destination
+func (h *Handler) DeleteNotificationChannel(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	channel, ok := h.getOwnedNotificationChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteNotificationChannel(channel.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete notification channel")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification channel deleted"})
+}
+
+// TestNotificationChannel sends a test notification through a channel
+func (h *Handler) TestNotificationChannel(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	channel, ok := h.getOwnedNotificationChannel(c, userID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	err := h.notifier.Send(ctx, channel, notify.Event{
+		Type:    "test",
+		UserID:  userID,
+		Title:   "Webby test notification",
+		Message: "Notifications from Webby are working.",
+	})
+	if err == notify.ErrChannelNotReady {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "This channel type is not configured on the server")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeUpstreamFailed, "Failed to send test notification: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test notification sent"})
+}
+
+// GetNotificationSubscriptions returns the user's event subscription settings
+func (h *Handler) GetNotificationSubscriptions(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	subs, err := h.db.GetNotificationSubscriptions(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch notification subscriptions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
+
+// UpdateNotificationSubscriptions enables or disables events for the user
+func (h *Handler) UpdateNotificationSubscriptions(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Subscriptions map[string]bool `json:"subscriptions" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "subscriptions", "subscriptions is required")
+		return
+	}
+
+	for eventType := range req.Subscriptions {
+		if _, ok := models.NotificationEvents[eventType]; !ok {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Unknown event type: "+eventType)
+			return
+		}
+	}
+
+	for eventType, enabled := range req.Subscriptions {
+		if err := h.db.SetNotificationSubscription(userID, eventType, enabled); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update notification subscriptions")
+			return
+		}
+	}
+
+	subs, err := h.db.GetNotificationSubscriptions(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch notification subscriptions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Notification subscriptions updated",
+		"subscriptions": subs,
+	})
+}
+
+// getOwnedNotificationChannel loads the channel from the :id param and verifies ownership.
+// Writes the error response and returns false if the channel can't be used.
+func (h *Handler) getOwnedNotificationChannel(c *gin.Context, userID string) (*models.NotificationChannel, bool) {
+	channel, err := h.db.GetNotificationChannel(c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "Notification channel not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch notification channel")
+		return nil, false
+	}
+
+	// Verify ownership
+	if channel.UserID != userID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return nil, false
+	}
+
+	return channel, true
+}
+
+// validateNotificationTarget checks the target format for a channel type.
+// Returns an error message, or an empty string if the target is valid.
+func validateNotificationTarget(channelType, target string) string {
+	if target == "" {
+		return "Target is required"
+	}
+
+	if channelType == models.NotificationChannelEmail {
+		if !emailRegex.MatchString(target) {
+			return "Invalid email address"
+		}
+		return ""
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "Target must be an http or https URL"
+	}
+	return ""
+}
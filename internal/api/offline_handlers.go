@@ -0,0 +1,259 @@
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// offlineBundleVersion is bumped when the bundle layout changes
+const offlineBundleVersion = 1
+
+// ==================== Offline Bundle Handlers ====================
+
+// offlineBundle describes everything the web reader needs to open a book
+// without a connection. In zip bundles it is stored as bundle.json and each
+// entry's content lives at its Path; in JSON bundles content is inline.
+type offlineBundle struct {
+	Version     int                     `json:"version"`
+	GeneratedAt time.Time               `json:"generated_at"`
+	Book        *models.Book            `json:"book"`
+	TOC         []epub.Chapter          `json:"toc,omitempty"`
+	Chapters    []*offlineEntry         `json:"chapters,omitempty"`
+	Resources   []*offlineEntry         `json:"resources,omitempty"`
+	File        *offlineEntry           `json:"file,omitempty"` // PDF/CBZ/CBR books
+	Position    *models.ReadingPosition `json:"position"`
+	Annotations []*models.Annotation    `json:"annotations"`
+}
+
+// offlineEntry maps an API URL the reader fetches to content in the bundle
+type offlineEntry struct {
+	URL       string `json:"url"`
+	Path      string `json:"path,omitempty"` // Zip entry name
+	MediaType string `json:"media_type"`
+	Content   string `json:"content,omitempty"`  // JSON bundles only
+	Encoding  string `json:"encoding,omitempty"` // "base64" for binary content
+}
+
+// GetOfflineBundle packages a book for offline reading: sanitized chapters,
+// resources, TOC, and the user's position and annotations. EPUBs can be
+// bundled as zip (default) or JSON; other formats include the book file and
+// are zip only.
+func (h *Handler) GetOfflineBundle(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "json" {
+		apierror.Invalid(c, "format", "Invalid format. Must be zip or json")
+		return
+	}
+	if format == "json" && book.FileFormat != models.FileFormatEPUB {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "JSON bundles are only available for EPUB books. Use format=zip")
+		return
+	}
+
+	bundle := &offlineBundle{
+		Version:     offlineBundleVersion,
+		GeneratedAt: time.Now(),
+		Book:        book,
+		Annotations: []*models.Annotation{},
+	}
+
+	if userID != "" {
+		pos, err := h.db.GetReadingPosition(book.ID, userID)
+		if err != nil && err != sql.ErrNoRows {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading position")
+			return
+		}
+		bundle.Position = pos
+
+		annotations, err := h.db.GetAnnotationsForBook(book.ID, userID)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch annotations")
+			return
+		}
+		if annotations != nil {
+			bundle.Annotations = annotations
+		}
+	}
+
+	// Chapters are small enough to hold in memory; resources are streamed
+	// into the zip as the EPUB is read
+	var chapterContent []string
+	if book.FileFormat == models.FileFormatEPUB {
+		toc, err := epub.GetTableOfContents(book.FilePath)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read table of contents")
+			return
+		}
+		bundle.TOC = toc
+
+		opts := epub.SanitizeOptions{
+			ResourceURL: h.basePath + "/api/books/" + book.ID + "/resource/",
+			ChapterURL:  h.basePath + "/api/books/" + book.ID + "/content/",
+		}
+		for i, ch := range toc {
+			content, err := epub.GetChapterContent(book.FilePath, i)
+			if err == nil && content != "" {
+				content, err = epub.SanitizeChapter(content, ch.Href, toc, opts)
+			}
+			if err != nil {
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read chapter "+strconv.Itoa(i))
+				return
+			}
+
+			entry := &offlineEntry{
+				URL:       opts.ChapterURL + strconv.Itoa(i),
+				Path:      fmt.Sprintf("chapters/%d.html", i),
+				MediaType: "text/html",
+			}
+			if format == "json" {
+				entry.Path = ""
+				entry.Content = content
+			}
+			bundle.Chapters = append(bundle.Chapters, entry)
+			chapterContent = append(chapterContent, content)
+		}
+	}
+
+	if format == "json" {
+		h.writeJSONBundle(c, book, bundle)
+		return
+	}
+	h.writeZipBundle(c, book, bundle, chapterContent)
+}
+
+// writeJSONBundle inlines the EPUB's resources as base64 and sends the bundle
+func (h *Handler) writeJSONBundle(c *gin.Context, book *models.Book, bundle *offlineBundle) {
+	err := epub.WalkResources(book.FilePath, func(res epub.Resource, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		bundle.Resources = append(bundle.Resources, &offlineEntry{
+			URL:       h.basePath + "/api/books/" + book.ID + "/resource/" + epub.EscapePath(res.Path),
+			MediaType: res.MediaType,
+			Content:   base64.StdEncoding.EncodeToString(data),
+			Encoding:  "base64",
+		})
+		return nil
+	})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read book resources")
+		return
+	}
+
+	c.JSON(http.StatusOK, bundle)
+}
+
+// writeZipBundle streams the bundle as a zip. Headers are sent before the
+// book is read, so failures part way through are logged and the download is
+// cut short.
+func (h *Handler) writeZipBundle(c *gin.Context, book *models.Book, bundle *offlineBundle, chapters []string) {
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", book.ID+"-offline.zip"))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	fail := func(err error) {
+		log.Printf("Warning: offline bundle for book %s failed: %v", book.ID, err)
+	}
+
+	for i, content := range chapters {
+		w, err := zw.Create(bundle.Chapters[i].Path)
+		if err == nil {
+			_, err = io.WriteString(w, content)
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	if book.FileFormat == models.FileFormatEPUB {
+		err := epub.WalkResources(book.FilePath, func(res epub.Resource, r io.Reader) error {
+			entry := &offlineEntry{
+				URL:       h.basePath + "/api/books/" + book.ID + "/resource/" + epub.EscapePath(res.Path),
+				Path:      "resources/" + res.Path,
+				MediaType: res.MediaType,
+			}
+			w, err := zw.Create(entry.Path)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, r); err != nil {
+				return err
+			}
+			bundle.Resources = append(bundle.Resources, entry)
+			return nil
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+	} else {
+		bundle.File = &offlineEntry{
+			URL:       h.basePath + "/api/books/" + book.ID + "/file",
+			Path:      "file" + filepath.Ext(book.FilePath),
+			MediaType: bookFileContentType(book.FileFormat),
+		}
+		if err := copyFileToZip(zw, bundle.File.Path, book.FilePath); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	// The index goes last so it can list the resources that were written
+	w, err := zw.Create("bundle.json")
+	if err == nil {
+		err = json.NewEncoder(w).Encode(bundle)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// copyFileToZip adds a file from disk to a zip under the given name
+func copyFileToZip(zw *zip.Writer, name, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Book files are already compressed, so store them as-is
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -1,14 +1,20 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
-	"path/filepath"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/justyntemme/webby/internal/apierror"
 	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/locale"
+	"github.com/justyntemme/webby/internal/models"
 	"github.com/justyntemme/webby/internal/opds"
 )
 
@@ -21,9 +27,49 @@ func getBaseURL(c *gin.Context) string {
 	return scheme + "://" + c.Request.Host
 }
 
+// withoutPhysical drops physical books, which have no file to download
+func withoutPhysical(books []models.Book) []models.Book {
+	filtered := make([]models.Book, 0, len(books))
+	for _, book := range books {
+		if !book.IsPhysical() {
+			filtered = append(filtered, book)
+		}
+	}
+	return filtered
+}
+
+// groupsWithoutPhysical drops physical books from grouped books, removing groups left empty
+func groupsWithoutPhysical(groups map[string][]models.Book) map[string][]models.Book {
+	for key, books := range groups {
+		if books = withoutPhysical(books); len(books) > 0 {
+			groups[key] = books
+		} else {
+			delete(groups, key)
+		}
+	}
+	return groups
+}
+
+// writeFeed sends an OPDS feed. When the request names a device, the feed's
+// links keep its token, so the reader's next requests and downloads name
+// it too.
+func (h *Handler) writeFeed(c *gin.Context, feed *opds.Feed, contentType string) {
+	if device := h.requestDevice(c); device != nil {
+		feed.AddQueryParam(h.baseURL(c)+"/opds/", "device", requestDeviceToken(c))
+	}
+
+	xml, err := feed.ToXML()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate feed")
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, xml)
+}
+
 // OPDSCatalog serves the root OPDS navigation catalog
 func (h *Handler) OPDSCatalog(c *gin.Context) {
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	feed := opds.NewNavigationFeed(
@@ -51,6 +97,20 @@ func (h *Handler) OPDSCatalog(c *gin.Context) {
 		"Recently added books",
 	)
 
+	feed.AddNavigationEntry(
+		"On Deck",
+		"urn:webby:catalog:on-deck",
+		baseURL+"/opds/v1.2/books/on-deck.xml",
+		"Books you're in the middle of",
+	)
+
+	feed.AddNavigationEntry(
+		"Recently Updated",
+		"urn:webby:catalog:updated",
+		baseURL+"/opds/v1.2/books/updated.xml",
+		"Books whose details recently changed",
+	)
+
 	feed.AddNavigationEntry(
 		"By Author",
 		"urn:webby:catalog:authors",
@@ -79,27 +139,39 @@ func (h *Handler) OPDSCatalog(c *gin.Context) {
 		"Comic books (CBZ/CBR)",
 	)
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
+	feed.AddNavigationEntry(
+		"Reading Orders",
+		"urn:webby:catalog:reading-orders",
+		baseURL+"/opds/v1.2/reading-orders.xml",
+		"Story arcs and crossovers in reading order",
+	)
 
-	c.Data(http.StatusOK, opds.OPDSCatalogType, xml)
+	feed.AddNavigationEntry(
+		"Collections",
+		"urn:webby:catalog:collections",
+		baseURL+"/opds/v1.2/collections.xml",
+		"Your collections",
+	)
+
+	h.writeFeed(c, feed, opds.OPDSCatalogType)
 }
 
 // OPDSAllBooks serves an acquisition feed of all books
 func (h *Handler) OPDSAllBooks(c *gin.Context) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/books/all.xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	books, err := h.db.ListBooksForUser(userID, "title", "asc")
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
 		return
 	}
+	books = withoutPhysical(books)
 
 	feed := opds.NewAcquisitionFeed(
 		"All Books",
@@ -108,31 +180,30 @@ func (h *Handler) OPDSAllBooks(c *gin.Context) {
 		startURL,
 	)
 
+	editions := h.bookEditions(books)
 	for _, book := range books {
-		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSRecentBooks serves an acquisition feed of recently added books
 func (h *Handler) OPDSRecentBooks(c *gin.Context) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/books/recent.xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	books, err := h.db.ListBooksForUser(userID, "uploaded_at", "desc")
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
 		return
 	}
+	books = withoutPhysical(books)
 
 	// Limit to 50 most recent
 	if len(books) > 50 {
@@ -146,31 +217,133 @@ func (h *Handler) OPDSRecentBooks(c *gin.Context) {
 		startURL,
 	)
 
+	editions := h.bookEditions(books)
 	for _, book := range books {
-		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
 	}
 
-	xml, err := feed.ToXML()
+	h.writeFeed(c, feed, opds.OPDSFeedType)
+}
+
+// OPDSUpdatedBooks serves an acquisition feed of books whose metadata was
+// recently edited or refreshed, each dated by that change
+func (h *Handler) OPDSUpdatedBooks(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	baseURL := h.baseURL(c)
+	selfURL := baseURL + "/opds/v1.2/books/updated.xml"
+	startURL := baseURL + "/opds/v1.2/catalog.xml"
+
+	books, err := h.db.ListRecentlyUpdatedBooks(userID, 50)
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
+		return
+	}
+	books = withoutPhysical(books)
+
+	feed := opds.NewAcquisitionFeed(
+		"Recently Updated",
+		"urn:webby:catalog:updated",
+		selfURL,
+		startURL,
+	)
+
+	editions := h.bookEditions(books)
+	for _, book := range books {
+		entry := opds.BookToEntry(&book, baseURL, editions[book.ID]...)
+		entry.Updated = *book.MetadataUpdated
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	h.writeFeed(c, feed, opds.OPDSFeedType)
+}
+
+// OPDSOnDeckBooks serves an acquisition feed of the books the user is in
+// the middle of: those with a reading position that aren't finished, most
+// recently read first and dated by it, then any others marked as reading
+func (h *Handler) OPDSOnDeckBooks(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	baseURL := h.baseURL(c)
+	selfURL := baseURL + "/opds/v1.2/books/on-deck.xml"
+	startURL := baseURL + "/opds/v1.2/catalog.xml"
+
+	library, err := h.db.ListBooksForUser(userID, "title", "asc")
+	if err == nil {
+		library, err = h.visibleBooks(userID, library)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
+		return
+	}
+	positions, err := h.db.GetReadingPositionsForUser(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading positions")
 		return
 	}
 
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	byID := make(map[string]models.Book, len(library))
+	for _, book := range library {
+		byID[book.ID] = book
+	}
+	var books []models.Book
+	lastRead := make(map[string]time.Time)
+	for _, pos := range positions {
+		book, ok := byID[pos.BookID]
+		if !ok || book.ReadStatus == models.ReadStatusCompleted {
+			continue
+		}
+		books = append(books, book)
+		lastRead[book.ID] = pos.UpdatedAt
+	}
+	for _, book := range library {
+		if _, ok := lastRead[book.ID]; !ok && book.ReadStatus == models.ReadStatusReading {
+			books = append(books, book)
+		}
+	}
+	books = withoutPhysical(books)
+
+	// Limit to the 50 most recently read
+	if len(books) > 50 {
+		books = books[:50]
+	}
+
+	feed := opds.NewAcquisitionFeed(
+		"On Deck",
+		"urn:webby:catalog:on-deck",
+		selfURL,
+		startURL,
+	)
+
+	editions := h.bookEditions(books)
+	for _, book := range books {
+		entry := opds.BookToEntry(&book, baseURL, editions[book.ID]...)
+		if at, ok := lastRead[book.ID]; ok {
+			entry.Updated = at
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSEBooks serves an acquisition feed of ebooks only
 func (h *Handler) OPDSEBooks(c *gin.Context) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/books/ebooks.xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	books, err := h.db.ListBooksForUserWithFilter(userID, "title", "asc", "book")
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
 		return
 	}
+	books = withoutPhysical(books)
 
 	feed := opds.NewAcquisitionFeed(
 		"eBooks",
@@ -179,31 +352,30 @@ func (h *Handler) OPDSEBooks(c *gin.Context) {
 		startURL,
 	)
 
+	editions := h.bookEditions(books)
 	for _, book := range books {
-		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSComics serves an acquisition feed of comics only
 func (h *Handler) OPDSComics(c *gin.Context) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/books/comics.xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	books, err := h.db.ListBooksForUserWithFilter(userID, "title", "asc", "comic")
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
 		return
 	}
+	books = withoutPhysical(books)
 
 	feed := opds.NewAcquisitionFeed(
 		"Comics",
@@ -212,31 +384,30 @@ func (h *Handler) OPDSComics(c *gin.Context) {
 		startURL,
 	)
 
+	editions := h.bookEditions(books)
 	for _, book := range books {
-		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSAuthors serves a navigation feed of all authors
 func (h *Handler) OPDSAuthors(c *gin.Context) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/authors.xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	authorBooks, err := h.db.GetBooksByAuthorForUser(userID)
+	if err == nil {
+		authorBooks, err = h.visibleGroups(userID, authorBooks)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get authors"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get authors")
 		return
 	}
+	authorBooks = groupsWithoutPhysical(authorBooks)
 
 	feed := opds.NewNavigationFeed(
 		"Authors",
@@ -245,12 +416,14 @@ func (h *Handler) OPDSAuthors(c *gin.Context) {
 		startURL,
 	)
 
-	// Get sorted list of authors
+	// Authors in "Last, First" order
 	var authors []string
 	for author := range authorBooks {
 		authors = append(authors, author)
 	}
-	sort.Strings(authors)
+	sort.Slice(authors, func(i, j int) bool {
+		return strings.ToLower(authorBooks[authors[i]][0].SortAuthor) < strings.ToLower(authorBooks[authors[j]][0].SortAuthor)
+	})
 
 	for _, authorName := range authors {
 		displayName := authorName
@@ -267,13 +440,7 @@ func (h *Handler) OPDSAuthors(c *gin.Context) {
 		)
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSCatalogType, xml)
+	h.writeFeed(c, feed, opds.OPDSCatalogType)
 }
 
 // OPDSAuthorBooks serves an acquisition feed of books by a specific author
@@ -283,15 +450,19 @@ func (h *Handler) OPDSAuthorBooks(c *gin.Context) {
 	author = strings.TrimSuffix(author, ".xml")
 
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/authors/" + strings.ReplaceAll(author, " ", "%20") + ".xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	books, err := h.db.ListBooksForUser(userID, "title", "asc")
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
 		return
 	}
+	books = withoutPhysical(books)
 
 	displayAuthor := author
 	if displayAuthor == "" {
@@ -305,33 +476,34 @@ func (h *Handler) OPDSAuthorBooks(c *gin.Context) {
 		startURL,
 	)
 
+	// Match other spellings of the name too, as the authors feed groups them
+	sortAuthor := locale.AuthorSort(author)
+	editions := h.bookEditions(books)
 	for _, book := range books {
-		if strings.EqualFold(book.Author, author) {
-			feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
+		if strings.EqualFold(book.SortAuthor, sortAuthor) {
+			feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
 		}
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSSeries serves a navigation feed of all series
 func (h *Handler) OPDSSeries(c *gin.Context) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/series.xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	seriesBooks, err := h.db.GetBooksBySeriesForUser(userID)
+	if err == nil {
+		seriesBooks, err = h.visibleGroups(userID, seriesBooks)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get series"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get series")
 		return
 	}
+	seriesBooks = groupsWithoutPhysical(seriesBooks)
 
 	feed := opds.NewNavigationFeed(
 		"Series",
@@ -361,13 +533,7 @@ func (h *Handler) OPDSSeries(c *gin.Context) {
 		)
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSCatalogType, xml)
+	h.writeFeed(c, feed, opds.OPDSCatalogType)
 }
 
 // OPDSSeriesBooks serves an acquisition feed of books in a specific series
@@ -376,15 +542,19 @@ func (h *Handler) OPDSSeriesBooks(c *gin.Context) {
 	series = strings.TrimSuffix(series, ".xml")
 
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 	selfURL := baseURL + "/opds/v1.2/series/" + strings.ReplaceAll(series, " ", "%20") + ".xml"
 	startURL := baseURL + "/opds/v1.2/catalog.xml"
 
 	books, err := h.db.ListBooksForUser(userID, "series_index", "asc")
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
 		return
 	}
+	books = withoutPhysical(books)
 
 	displaySeries := series
 	if displaySeries == "" {
@@ -398,24 +568,177 @@ func (h *Handler) OPDSSeriesBooks(c *gin.Context) {
 		startURL,
 	)
 
+	editions := h.bookEditions(books)
 	for _, book := range books {
 		if strings.EqualFold(book.Series, series) || (series == "" && book.Series == "") {
-			feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
+			feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
 		}
 	}
 
-	xml, err := feed.ToXML()
+	h.writeFeed(c, feed, opds.OPDSFeedType)
+}
+
+// OPDSReadingOrders serves a navigation feed of the user's reading orders,
+// including imported story arcs
+func (h *Handler) OPDSReadingOrders(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	baseURL := h.baseURL(c)
+	selfURL := baseURL + "/opds/v1.2/reading-orders.xml"
+	startURL := baseURL + "/opds/v1.2/catalog.xml"
+
+	var orders []*models.ReadingOrder
+	if userID != "" {
+		var err error
+		if orders, err = h.db.ListReadingOrders(userID); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list reading orders")
+			return
+		}
+	}
+
+	feed := opds.NewNavigationFeed(
+		"Reading Orders",
+		"urn:webby:catalog:reading-orders",
+		selfURL,
+		startURL,
+	)
+
+	for _, order := range orders {
+		feed.AddNavigationEntry(
+			order.Name,
+			"urn:webby:reading-order:"+order.ID,
+			baseURL+"/opds/v1.2/reading-orders/"+order.ID+".xml",
+			order.Description,
+		)
+	}
+
+	h.writeFeed(c, feed, opds.OPDSCatalogType)
+}
+
+// OPDSReadingOrderBooks serves an acquisition feed of the issues of a
+// reading order that are in the library, in reading order
+func (h *Handler) OPDSReadingOrderBooks(c *gin.Context) {
+	orderID := strings.TrimSuffix(c.Param("id"), ".xml")
+
+	userID := auth.GetUserID(c)
+	baseURL := h.baseURL(c)
+	selfURL := baseURL + "/opds/v1.2/reading-orders/" + orderID + ".xml"
+	startURL := baseURL + "/opds/v1.2/catalog.xml"
+
+	order, err := h.db.GetReadingOrder(orderID)
+	if err != nil || userID == "" || order.UserID != userID {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingOrderNotFound, "Reading order not found")
+		return
+	}
+	if err := h.loadReadingOrderEntries(userID, order); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list reading order entries")
+		return
+	}
+
+	var books []models.Book
+	for _, entry := range order.Entries {
+		if entry.BookID == "" {
+			continue
+		}
+		book, err := h.db.GetBookForUser(entry.BookID, userID)
+		if err != nil {
+			continue
+		}
+		books = append(books, *book)
+	}
+	books = withoutPhysical(books)
+
+	feed := opds.NewAcquisitionFeed(
+		order.Name,
+		"urn:webby:reading-order:"+order.ID,
+		selfURL,
+		startURL,
+	)
+
+	editions := h.bookEditions(books)
+	for _, book := range books {
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
+	}
+
+	h.writeFeed(c, feed, opds.OPDSFeedType)
+}
+
+// OPDSCollections serves a navigation feed of the collections, each
+// pictured by the mosaic of its first covers
+func (h *Handler) OPDSCollections(c *gin.Context) {
+	baseURL := h.baseURL(c)
+	selfURL := baseURL + "/opds/v1.2/collections.xml"
+	startURL := baseURL + "/opds/v1.2/catalog.xml"
+
+	collections, err := h.collections.List(auth.GetUserID(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list collections")
 		return
 	}
 
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	feed := opds.NewNavigationFeed(
+		"Collections",
+		"urn:webby:catalog:collections",
+		selfURL,
+		startURL,
+	)
+
+	for _, collection := range collections {
+		feed.AddNavigationEntryWithImage(
+			collection.Name,
+			"urn:webby:collection:"+collection.ID,
+			baseURL+"/opds/v1.2/collections/"+collection.ID+".xml",
+			fmt.Sprintf("%d books", collection.BookCount),
+			baseURL+"/api/collections/"+collection.ID+"/cover",
+		)
+	}
+
+	h.writeFeed(c, feed, opds.OPDSCatalogType)
+}
+
+// OPDSCollectionBooks serves an acquisition feed of the books in a
+// collection
+func (h *Handler) OPDSCollectionBooks(c *gin.Context) {
+	collectionID := strings.TrimSuffix(c.Param("id"), ".xml")
+
+	userID := auth.GetUserID(c)
+	baseURL := h.baseURL(c)
+	selfURL := baseURL + "/opds/v1.2/collections/" + collectionID + ".xml"
+	startURL := baseURL + "/opds/v1.2/catalog.xml"
+
+	collection, members, err := h.collections.Get(collectionID, userID)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch collection")
+		return
+	}
+
+	var books []models.Book
+	for _, member := range members {
+		book, err := h.db.GetBookForUser(member.ID, userID)
+		if err != nil {
+			continue
+		}
+		books = append(books, *book)
+	}
+	books = withoutPhysical(books)
+
+	feed := opds.NewAcquisitionFeed(
+		collection.Name,
+		"urn:webby:collection:"+collection.ID,
+		selfURL,
+		startURL,
+	)
+
+	editions := h.bookEditions(books)
+	for _, book := range books {
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL, editions[book.ID]...))
+	}
+
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSSearch serves the OpenSearch description document
 func (h *Handler) OPDSSearch(c *gin.Context) {
-	baseURL := getBaseURL(c)
+	baseURL := h.baseURL(c)
 
 	// Check if this is a search query
 	query := c.Query("q")
@@ -426,48 +749,62 @@ func (h *Handler) OPDSSearch(c *gin.Context) {
 
 	// Return OpenSearch description document
 	searchURL := baseURL + "/opds/v1.2/search.xml"
+	if device := h.requestDevice(c); device != nil {
+		searchURL += "?device=" + url.QueryEscape(requestDeviceToken(c))
+	}
 	xml := opds.OpenSearchDescription(baseURL, searchURL)
 	c.Data(http.StatusOK, opds.OPDSSearchType, []byte(xml))
 }
 
-// OPDSSearchResults serves search results as an acquisition feed
+// OPDS search page sizes, used when a reader doesn't ask for one and as the
+// most it may ask for
+const (
+	opdsSearchPageSize    = 50
+	opdsSearchMaxPageSize = 200
+)
+
+// OPDSSearchResults serves one page of search results as an acquisition
+// feed, matching title, author, series, subjects, and description
 func (h *Handler) OPDSSearchResults(c *gin.Context, query string) {
 	userID := auth.GetUserID(c)
-	baseURL := getBaseURL(c)
-	selfURL := baseURL + "/opds/v1.2/search.xml?q=" + strings.ReplaceAll(query, " ", "%20")
-	startURL := baseURL + "/opds/v1.2/catalog.xml"
+	baseURL := h.baseURL(c)
 
-	books, err := h.db.ListBooksForUser(userID, "title", "asc")
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(opdsSearchPageSize)))
+	if err != nil || size < 1 {
+		size = opdsSearchPageSize
+	}
+	if size > opdsSearchMaxPageSize {
+		size = opdsSearchMaxPageSize
+	}
+
+	books, total, err := h.db.SearchCatalog(userID, query, (page-1)*size, size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list books"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search books")
 		return
 	}
 
+	pageURL := func(page int) string {
+		return fmt.Sprintf("%s/opds/v1.2/search.xml?q=%s&page=%d&size=%d", baseURL, url.QueryEscape(query), page, size)
+	}
 	feed := opds.NewAcquisitionFeed(
 		"Search Results: "+query,
-		"urn:webby:search:"+query,
-		selfURL,
-		startURL,
+		"urn:webby:search:"+url.QueryEscape(query),
+		pageURL(page),
+		baseURL+"/opds/v1.2/catalog.xml",
 	)
+	feed.AddSearchLink(baseURL + "/opds/v1.2/search.xml")
+	feed.Paginate(page, size, total, pageURL)
 
-	queryLower := strings.ToLower(query)
-	for _, book := range books {
-		// Search in title, author, series, and description
-		if strings.Contains(strings.ToLower(book.Title), queryLower) ||
-			strings.Contains(strings.ToLower(book.Author), queryLower) ||
-			strings.Contains(strings.ToLower(book.Series), queryLower) ||
-			strings.Contains(strings.ToLower(book.Description), queryLower) {
-			feed.Entries = append(feed.Entries, opds.BookToEntry(&book, baseURL))
-		}
+	editions := h.bookEditions(books)
+	for i := range books {
+		feed.Entries = append(feed.Entries, opds.BookToEntry(&books[i], baseURL, editions[books[i].ID]...))
 	}
 
-	xml, err := feed.ToXML()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
-		return
-	}
-
-	c.Data(http.StatusOK, opds.OPDSFeedType, xml)
+	h.writeFeed(c, feed, opds.OPDSFeedType)
 }
 
 // OPDSDownload serves a book file for download via OPDS
@@ -477,31 +814,20 @@ func (h *Handler) OPDSDownload(c *gin.Context) {
 
 	book, err := h.db.GetBookForUser(bookID, userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
 		return
 	}
 
-	// Check if file exists
-	bookPath := h.files.GetBookPath(bookID)
-	if bookPath == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	if !requireBookFile(c, book) {
 		return
 	}
 
-	// Set headers for download
-	filename := book.Title
-	if book.Author != "" {
-		filename = book.Author + " - " + filename
-	}
-	filename = strings.ReplaceAll(filename, "/", "-")
-	filename = strings.ReplaceAll(filename, "\\", "-")
-
-	ext := filepath.Ext(book.FilePath)
-	if ext == "" {
-		ext = "." + book.FileFormat
+	// Readers can ask for another edition with ?format=, or get the one
+	// that suits their device
+	device := h.requestDevice(c)
+	file, ok := h.bookFileForDevice(c, book, device)
+	if !ok {
+		return
 	}
-
-	c.Header("Content-Disposition", "attachment; filename=\""+filename+ext+"\"")
-	c.Header("Content-Type", opds.GetMIMEType(book.FileFormat))
-	c.File(book.FilePath)
+	serveBookFileForDevice(c, book, file, device)
 }
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestOPDSOnDeckAndUpdatedFeeds(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	userID := setupTestUser(t, handler)
+
+	added := time.Now().Add(-time.Hour)
+	add := func(title string) *models.Book {
+		book := &models.Book{
+			ID: uuid.New().String(), UserID: userID, Title: title, FilePath: "/tmp/" + title + ".epub",
+			UploadedAt: added, MetadataUpdated: &added, ContentType: models.ContentTypeBook, FileFormat: models.FileFormatEPUB,
+		}
+		require.NoError(t, handler.db.CreateBook(book))
+		return book
+	}
+	dune, emma, saga, ulysses := add("Dune"), add("Emma"), add("Saga"), add("Ulysses")
+
+	// Emma was read after Dune; Saga is finished; Ulysses is only marked
+	now := time.Now()
+	for _, b := range []*models.Book{dune, emma, saga} {
+		require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: b.ID, UserID: userID, Chapter: "1", Position: 0.5}))
+	}
+	require.NoError(t, handler.db.UpdateBookReadStatus(userID, saga.ID, models.ReadStatusCompleted, &now))
+	require.NoError(t, handler.db.UpdateBookReadStatus(userID, ulysses.ID, models.ReadStatusReading, nil))
+
+	// Only Emma's details changed after it was added
+	emma.Title = "Emma (Annotated)"
+	emma.MetadataUpdated = &now
+	require.NoError(t, handler.db.UpdateBookMetadata(emma))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/opds/v1.2/books/on-deck.xml", handler.OPDSOnDeckBooks)
+	r.GET("/opds/v1.2/books/updated.xml", handler.OPDSUpdatedBooks)
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Body.String()
+	}
+
+	feed := get("/opds/v1.2/books/on-deck.xml")
+	assert.NotContains(t, feed, "Saga")
+	emmaAt, duneAt, ulyssesAt := strings.Index(feed, "Emma"), strings.Index(feed, "Dune"), strings.Index(feed, "Ulysses")
+	require.True(t, emmaAt > 0 && duneAt > 0 && ulyssesAt > 0, feed)
+	assert.Less(t, emmaAt, duneAt, "most recently read first")
+	assert.Less(t, duneAt, ulyssesAt, "books without a position last")
+
+	feed = get("/opds/v1.2/books/updated.xml")
+	assert.Contains(t, feed, "Emma (Annotated)")
+	assert.NotContains(t, feed, "Dune")
+}
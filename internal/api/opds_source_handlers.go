@@ -0,0 +1,410 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/opds"
+)
+
+// ==================== OPDS Source Handlers ====================
+
+const (
+	// opdsCatalogTimeout is how long a remote catalog has to send a page
+	opdsCatalogTimeout = 20 * time.Second
+	// maxOPDSImport is the most books imported from a catalog at once
+	maxOPDSImport = 20
+)
+
+// opdsFormatPreference is the order a remote entry's files are picked in
+// when it offers several
+var opdsFormatPreference = []string{
+	models.FileFormatEPUB, models.FileFormatCBZ, models.FileFormatPDF, models.FileFormatCBR,
+}
+
+// ListOPDSSources returns the current user's remote OPDS catalogs
+func (h *Handler) ListOPDSSources(c *gin.Context) {
+	sources, err := h.db.ListOPDSSources(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch OPDS sources")
+		return
+	}
+	if sources == nil {
+		sources = []*models.OPDSSource{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sources": sources,
+		"count":   len(sources),
+	})
+}
+
+// CreateOPDSSource adds a remote OPDS catalog, such as another Calibre-Web
+// or Kavita server, after checking it answers with a catalog
+func (h *Handler) CreateOPDSSource(c *gin.Context) {
+	var req struct {
+		Name     string `json:"name" binding:"required"`
+		URL      string `json:"url" binding:"required"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "name and url are required")
+		return
+	}
+	base, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		apierror.Invalid(c, "url", "url must be an http or https URL")
+		return
+	}
+
+	source := &models.OPDSSource{
+		ID:        uuid.New().String(),
+		UserID:    auth.GetUserID(c),
+		Name:      strings.TrimSpace(req.Name),
+		URL:       base.String(),
+		Username:  strings.TrimSpace(req.Username),
+		Password:  req.Password,
+		CreatedAt: time.Now(),
+	}
+	if _, err := h.remoteOPDS.Catalog(c.Request.Context(), source.URL, base, opdsCredentials(source), opdsCatalogTimeout); err != nil {
+		respondOPDSFailure(c, err)
+		return
+	}
+
+	if err := h.db.CreateOPDSSource(source); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save OPDS source")
+		return
+	}
+
+	c.JSON(http.StatusCreated, source)
+}
+
+// DeleteOPDSSource removes one of the current user's remote OPDS catalogs.
+// Books imported from it are kept.
+func (h *Handler) DeleteOPDSSource(c *gin.Context) {
+	source, ok := h.opdsSource(c)
+	if !ok {
+		return
+	}
+	if err := h.db.DeleteOPDSSource(source.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete OPDS source")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "OPDS source deleted"})
+}
+
+// BrowseOPDSSource returns a page of a remote catalog: its root, the page
+// at the url query parameter, which must be on the catalog's server, or the
+// results of searching it for q
+func (h *Handler) BrowseOPDSSource(c *gin.Context) {
+	source, ok := h.opdsSource(c)
+	if !ok {
+		return
+	}
+	base, _ := url.Parse(source.URL)
+	pageURL, ok := opdsPageURL(c, source, c.Query("url"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	creds := opdsCredentials(source)
+	page, err := h.remoteOPDS.Catalog(ctx, pageURL, base, creds, opdsCatalogTimeout)
+	if err == nil {
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			var searchURL string
+			searchURL, err = h.remoteOPDS.SearchURL(ctx, page, q, base, creds, opdsCatalogTimeout)
+			if err == nil && searchURL == "" {
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "This catalog can't be searched")
+				return
+			}
+			if err == nil {
+				page, err = h.remoteOPDS.Catalog(ctx, searchURL, base, creds, opdsCatalogTimeout)
+			}
+		}
+	}
+	if err != nil {
+		respondOPDSFailure(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// SetOPDSPrivateNetworks sets whether remote catalogs may be on loopback
+// and private addresses, such as another server on the same LAN. Off by
+// default, so users can't have webby reach hosts on its network.
+func (h *Handler) SetOPDSPrivateNetworks(allow bool) {
+	h.remoteOPDS = opds.NewClient(allow)
+}
+
+// respondOPDSFailure reports a remote catalog that couldn't be read. What
+// the remote server answered is logged rather than returned, as it could
+// describe hosts the user can't reach themselves.
+func respondOPDSFailure(c *gin.Context, err error) {
+	if errors.Is(err, opds.ErrPrivateAddress) {
+		apierror.Invalid(c, "url", "The catalog must be on a public server")
+		return
+	}
+	log.Printf("Warning: failed to read OPDS catalog: %v", err)
+	apierror.Respond(c, http.StatusBadGateway, apierror.CodeUpstreamFailed, "Failed to read the catalog")
+}
+
+// ImportOPDSBooks downloads books from a page of a remote catalog into the
+// current user's library, by the IDs of their entries on that page. Each
+// book is imported like an upload, then given the catalog's title, author,
+// description, publisher, language, date, and categories where it has them,
+// and its cover if the file has none. Books that fail are listed with why.
+func (h *Handler) ImportOPDSBooks(c *gin.Context) {
+	source, ok := h.opdsSource(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL      string   `json:"url"`
+		EntryIDs []string `json:"entry_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "entry_ids is required")
+		return
+	}
+	if len(req.EntryIDs) == 0 || len(req.EntryIDs) > maxOPDSImport {
+		apierror.Invalid(c, "entry_ids", fmt.Sprintf("Import between 1 and %d books at once", maxOPDSImport))
+		return
+	}
+	pageURL, ok := opdsPageURL(c, source, req.URL)
+	if !ok {
+		return
+	}
+
+	base, _ := url.Parse(source.URL)
+	creds := opdsCredentials(source)
+	page, err := h.remoteOPDS.Catalog(c.Request.Context(), pageURL, base, creds, opdsCatalogTimeout)
+	if err != nil {
+		respondOPDSFailure(c, err)
+		return
+	}
+	entries := make(map[string]opds.CatalogEntry, len(page.Entries))
+	for _, entry := range page.Entries {
+		entries[entry.ID] = entry
+	}
+
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	userID := auth.GetUserID(c)
+	imported := []*models.Book{}
+	failed := []gin.H{}
+	for _, id := range req.EntryIDs {
+		entry, found := entries[id]
+		if !found {
+			failed = append(failed, gin.H{"entry_id": id, "reason": "No entry with this ID on the page"})
+			continue
+		}
+		book, reason := h.importOPDSEntry(c.Request.Context(), base, creds, entry, userID)
+		if err := c.Request.Context().Err(); err != nil {
+			requestEnded(c, err)
+			return
+		}
+		if book == nil {
+			failed = append(failed, gin.H{"entry_id": id, "title": entry.Title, "reason": reason})
+			continue
+		}
+		imported = append(imported, book)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imported":       imported,
+		"failed":         failed,
+		"imported_count": len(imported),
+		"failed_count":   len(failed),
+	})
+}
+
+// importOPDSEntry downloads the file of a remote catalog entry and imports
+// it for userID, returning the book, or nil and why it can't
+func (h *Handler) importOPDSEntry(ctx context.Context, base *url.URL, creds opds.Credentials, entry opds.CatalogEntry, userID string) (*models.Book, string) {
+	acquisition, ok := pickAcquisition(entry.Acquisitions)
+	if !ok {
+		return nil, "No file in a supported format"
+	}
+
+	resp, err := h.remoteOPDS.Get(ctx, acquisition.Href, base, creds)
+	if errors.Is(err, opds.ErrPrivateAddress) {
+		return nil, "The file isn't on a public server"
+	}
+	if err != nil {
+		log.Printf("Warning: failed to download %s from an OPDS catalog: %v", acquisition.Href, err)
+		return nil, "Download failed"
+	}
+	defer resp.Body.Close()
+
+	book, reason := h.importDownload(ctx, resp.Body, max(resp.ContentLength, 0),
+		opdsFilename(resp, entry, acquisition.Format), userID)
+	if book == nil {
+		return nil, reason
+	}
+	h.applyOPDSMetadata(ctx, book, entry, base, creds, userID)
+	h.syncSubjectTags(book, userID)
+	h.recordActivity(userID, models.ActivityBookAdded, book.ID, 0)
+	return book, ""
+}
+
+// applyOPDSMetadata gives an imported book the metadata of its catalog
+// entry where the entry has it, and the entry's cover if the file had none
+func (h *Handler) applyOPDSMetadata(ctx context.Context, book *models.Book, entry opds.CatalogEntry, base *url.URL, creds opds.Credentials, userID string) {
+	updated := *book
+	set := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	set(&updated.Title, entry.Title)
+	set(&updated.Author, entry.Author)
+	set(&updated.Description, entry.Summary)
+	set(&updated.Publisher, entry.Publisher)
+	set(&updated.Language, entry.Language)
+	set(&updated.PublishDate, entry.Issued)
+	set(&updated.Subjects, strings.Join(entry.Categories, ", "))
+	if len(books.MetadataChanges(book, &updated)) > 0 {
+		now := time.Now()
+		updated.MetadataSource = models.MetadataSourceOPDS
+		updated.MetadataUpdated = &now
+		if err := h.saveBookMetadata(&updated, userID); err != nil {
+			log.Printf("Warning: failed to save catalog metadata of %s: %v", book.ID, err)
+		} else {
+			*book = updated
+		}
+	}
+
+	if book.CoverPath != "" || entry.Cover == "" {
+		return
+	}
+	resp, err := h.remoteOPDS.Get(ctx, entry.Cover, base, creds)
+	if err != nil {
+		log.Printf("Warning: failed to download cover of %s: %v", book.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+	data, ext, err := readCover(resp.Body)
+	if err != nil {
+		log.Printf("Warning: failed to read cover of %s: %v", book.ID, err)
+		return
+	}
+	data, ext = books.OptimizeCover(data, ext)
+	coverPath, err := h.files.SaveCover(book.ID, data, ext)
+	if err != nil {
+		log.Printf("Warning: failed to save cover of %s: %v", book.ID, err)
+		return
+	}
+	if err := h.db.UpdateBookFilePaths(book.ID, book.FilePath, coverPath); err != nil {
+		log.Printf("Warning: failed to save cover of %s: %v", book.ID, err)
+		return
+	}
+	book.CoverPath = coverPath
+	book.CoverPalette = books.CoverPalette(data)
+	if err := h.db.SetCoverPalette(book.ID, book.CoverPalette); err != nil {
+		log.Printf("Warning: failed to save cover palette of %s: %v", book.ID, err)
+	}
+}
+
+// pickAcquisition returns the file of an entry to import, in the format
+// webby prefers of those it can import
+func pickAcquisition(acquisitions []opds.Acquisition) (opds.Acquisition, bool) {
+	for _, format := range opdsFormatPreference {
+		for _, a := range acquisitions {
+			if a.Format == format {
+				return a, true
+			}
+		}
+	}
+	return opds.Acquisition{}, false
+}
+
+// opdsFilename names a downloaded file: the name the server gave it, or
+// the last part of its URL, if that has the right extension, and otherwise
+// the entry's title with the format's extension
+func opdsFilename(resp *http.Response, entry opds.CatalogEntry, format string) string {
+	var candidates []string
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		candidates = append(candidates, path.Base(params["filename"]))
+	}
+	candidates = append(candidates, path.Base(resp.Request.URL.Path))
+	for _, name := range candidates {
+		if f, _, ok := books.FileFormat(name); ok && f == format {
+			return name
+		}
+	}
+
+	title := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, entry.Title)
+	if title == "" {
+		title = "book"
+	}
+	return title + "." + format
+}
+
+// opdsSource loads the current user's remote OPDS catalog named in the URL,
+// writing an error response and returning false if there is none
+func (h *Handler) opdsSource(c *gin.Context) (*models.OPDSSource, bool) {
+	source, err := h.db.GetOPDSSource(c.Param("id"))
+	if err == nil && source.UserID != auth.GetUserID(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeOPDSSourceNotFound, "OPDS source not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch OPDS source")
+		return nil, false
+	}
+	return source, true
+}
+
+// opdsPageURL returns the catalog page a request asks for: pageURL, which
+// must be on the source's server, or the source's root if it's empty. It
+// writes an error response and returns false if pageURL is elsewhere.
+func opdsPageURL(c *gin.Context, source *models.OPDSSource, pageURL string) (string, bool) {
+	if pageURL == "" {
+		return source.URL, true
+	}
+	base, _ := url.Parse(source.URL)
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Scheme != base.Scheme || u.Host != base.Host {
+		apierror.Invalid(c, "url", "url must be a page of this source's catalog")
+		return "", false
+	}
+	return u.String(), true
+}
+
+// opdsCredentials returns what a source's catalog is logged in to with
+func opdsCredentials(source *models.OPDSSource) opds.Credentials {
+	return opds.Credentials{Username: source.Username, Password: source.Password}
+}
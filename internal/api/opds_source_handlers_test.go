@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/opds"
+)
+
+// remoteCatalog serves a small OPDS catalog behind a login, like another
+// Calibre-Web server, with one importable book
+func remoteCatalog(t *testing.T, epubData []byte) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/opds", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Remote Library</title>
+  <link rel="search" type="application/atom+xml" href="/opds/search?q={searchTerms}"/>
+  <entry>
+    <id>new</id>
+    <title>New Books</title>
+    <link type="application/atom+xml;profile=opds-catalog;kind=acquisition" href="opds/new"/>
+  </entry>
+</feed>`))
+	})
+	books := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/terms/">
+  <title>New Books</title>
+  <entry>
+    <id>urn:book:1</id>
+    <title>Moby-Dick</title>
+    <author><name>Herman Melville</name></author>
+    <content type="html">&lt;p&gt;A whale of a tale.&lt;/p&gt;</content>
+    <dc:language>en</dc:language>
+    <category term="classics" label="Classics"/>
+    <link rel="http://opds-spec.org/acquisition" type="application/pdf" href="/download/1.pdf"/>
+    <link rel="http://opds-spec.org/acquisition" type="application/epub+zip" href="/download/1"/>
+  </entry>
+  <entry>
+    <id>urn:book:2</id>
+    <title>Kindle Only</title>
+    <link rel="http://opds-spec.org/acquisition" type="application/x-mobipocket-ebook" href="/download/2"/>
+  </entry>
+</feed>`))
+	}
+	mux.HandleFunc("/opds/new", books)
+	mux.HandleFunc("/opds/search", books)
+	mux.HandleFunc("/download/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="moby.epub"`)
+		w.Write(epubData)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "reader" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOPDSSources(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	userID := setupTestUser(t, handler)
+	otherID := createNamedUser(t, handler, "other")
+
+	epubData, err := os.ReadFile(createTestEPUBBook(t, handler, otherID, "<p>Call me Ishmael.</p>").FilePath)
+	require.NoError(t, err)
+	server := remoteCatalog(t, epubData)
+
+	call := func(userID string, handle gin.HandlerFunc, method, target, body, sourceID string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: sourceID}}
+		c.Request, _ = http.NewRequest(method, target, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handle(c)
+		return w
+	}
+
+	// Hosts on the server's own network are refused unless allowed
+	w := call(userID, handler.CreateOPDSSource, http.MethodPost, "/api/opds-sources",
+		`{"name": "Remote", "url": "`+server.URL+`/opds", "username": "reader", "password": "secret"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	handler.SetOPDSPrivateNetworks(true)
+	w = call(userID, handler.CreateOPDSSource, http.MethodPost, "/api/opds-sources",
+		`{"name": "Metadata", "url": "http://169.254.169.254/latest/meta-data/"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "link-local addresses are always refused")
+
+	w = call(userID, handler.CreateOPDSSource, http.MethodPost, "/api/opds-sources",
+		`{"name": "Remote", "url": "`+server.URL+`/opds", "username": "reader", "password": "wrong"}`, "")
+	assert.Equal(t, http.StatusBadGateway, w.Code, "a catalog that can't be read isn't added")
+	assert.NotContains(t, w.Body.String(), "401", "what the remote server answered isn't passed on")
+
+	w = call(userID, handler.CreateOPDSSource, http.MethodPost, "/api/opds-sources",
+		`{"name": "Remote", "url": "`+server.URL+`/opds", "username": "reader", "password": "secret"}`, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "secret")
+	var source models.OPDSSource
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &source))
+	assert.True(t, source.HasPassword)
+
+	w = call(otherID, handler.BrowseOPDSSource, http.MethodGet, "/api/opds-sources/"+source.ID+"/browse", "", source.ID)
+	assert.Equal(t, http.StatusNotFound, w.Code, "sources are private")
+
+	browse := func(query string) *opds.CatalogPage {
+		w := call(userID, handler.BrowseOPDSSource, http.MethodGet, "/api/opds-sources/"+source.ID+"/browse"+query, "", source.ID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var page opds.CatalogPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return &page
+	}
+	root := browse("")
+	assert.Equal(t, "Remote Library", root.Title)
+	require.Len(t, root.Entries, 1)
+	newBooks := root.Entries[0].Navigation
+	assert.Equal(t, server.URL+"/opds/new", newBooks)
+
+	page := browse("?url=" + url.QueryEscape(newBooks))
+	require.Len(t, page.Entries, 2)
+	moby := page.Entries[0]
+	assert.Equal(t, "Herman Melville", moby.Author)
+	assert.Equal(t, "A whale of a tale.", moby.Summary)
+	assert.Equal(t, []string{"Classics"}, moby.Categories)
+	require.Len(t, moby.Acquisitions, 2)
+	assert.Equal(t, "epub", moby.Acquisitions[1].Format)
+	assert.Empty(t, page.Entries[1].Acquisitions[0].Format, "webby can't import MOBI")
+
+	assert.Len(t, browse("?q=moby").Entries, 2)
+
+	w = call(userID, handler.BrowseOPDSSource, http.MethodGet,
+		"/api/opds-sources/"+source.ID+"/browse?url="+url.QueryEscape("http://elsewhere.example/opds"), "", source.ID)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "only the source's own server is browsed")
+
+	w = call(userID, handler.ImportOPDSBooks, http.MethodPost, "/api/opds-sources/"+source.ID+"/import",
+		`{"url": "`+newBooks+`", "entry_ids": ["urn:book:1", "urn:book:2", "urn:book:3"]}`, source.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result struct {
+		Imported []models.Book `json:"imported"`
+		Failed   []struct {
+			EntryID string `json:"entry_id"`
+			Reason  string `json:"reason"`
+		} `json:"failed"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Len(t, result.Imported, 1)
+	require.Len(t, result.Failed, 2)
+	assert.Equal(t, "No file in a supported format", result.Failed[0].Reason)
+	assert.Equal(t, "urn:book:3", result.Failed[1].EntryID)
+
+	book, err := handler.db.GetBook(result.Imported[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, userID, book.UserID)
+	assert.Equal(t, models.FileFormatEPUB, book.FileFormat)
+	assert.Equal(t, "Moby-Dick", book.Title, "the catalog's title wins over the file's")
+	assert.Equal(t, "Herman Melville", book.Author)
+	assert.Equal(t, "Classics", book.Subjects)
+	assert.Equal(t, models.MetadataSourceOPDS, book.MetadataSource)
+
+	w = call(userID, handler.DeleteOPDSSource, http.MethodDelete, "/api/opds-sources/"+source.ID, "", source.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = call(userID, handler.ListOPDSSources, http.MethodGet, "/api/opds-sources", "", "")
+	assert.JSONEq(t, `{"sources": [], "count": 0}`, w.Body.String())
+	_, err = handler.db.GetBook(book.ID)
+	assert.NoError(t, err, "imported books are kept")
+}
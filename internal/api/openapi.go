@@ -0,0 +1,842 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/annotations"
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/mirror"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/opds"
+	"github.com/justyntemme/webby/internal/positions"
+	"github.com/justyntemme/webby/internal/workpool"
+)
+
+// ==================== API Documentation ====================
+
+// apiVersion is reported by /api and the OpenAPI document
+const apiVersion = "1.0.0"
+
+// authMode describes how a route uses the Authorization header
+type authMode int
+
+const (
+	authNone     authMode = iota
+	authOptional          // Scoped to the user when a token is sent
+	authRequired
+	authSyncKey // Another server's sync key in X-Sync-Key instead of a token
+)
+
+// routeDoc documents one route. Query and Body list parameter names
+// separated by commas; a parenthesized note after a name becomes its
+// description.
+type routeDoc struct {
+	Method   string
+	Path     string // Gin syntax, e.g. /api/books/:id
+	Summary  string
+	Query    string
+	Body     string
+	Status   int    // Success status, defaults to 200
+	Produces string // Non-JSON response content type
+	Response any    // Sample value or fields used to derive the response schema
+}
+
+// routeGroup documents routes that share a tag and auth mode
+type routeGroup struct {
+	Tag    string
+	Auth   authMode
+	Routes []routeDoc
+}
+
+// responseFields describes a JSON object response by sample values
+type responseFields map[string]any
+
+// messageResponse is the common {"message": "..."} response
+var messageResponse = responseFields{"message": ""}
+
+// apiRoutes documents the API. Only routes registered with the router are
+// published, so entries for removed routes drop out of the docs and routes
+// missing here are still listed with a summary derived from their handler.
+var apiRoutes = []routeGroup{
+	{Tag: "Utility", Auth: authNone, Routes: []routeDoc{
+		{Method: "GET", Path: "/health", Summary: "Health check", Response: responseFields{"status": "", "time": time.Time{}}},
+		{Method: "GET", Path: "/api", Summary: "API overview and endpoint list"},
+		{Method: "GET", Path: "/api/version", Summary: "Server version and build details", Response: BuildInfo{}},
+		{Method: "GET", Path: "/api/openapi.json", Summary: "OpenAPI 3 document for this API"},
+		{Method: "GET", Path: "/api/docs", Summary: "Interactive API documentation (Swagger UI)", Produces: "text/html"},
+	}},
+	{Tag: "Auth", Auth: authNone, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/auth/status", Summary: "Get authentication configuration"},
+		{Method: "POST", Path: "/api/auth/register", Summary: "Register new user", Body: "username, email, password", Status: http.StatusCreated, Response: responseFields{"message": "", "user": models.User{}, "token": ""}},
+		{Method: "POST", Path: "/api/auth/login", Summary: "Login", Body: "username, password", Response: responseFields{"message": "", "user": models.User{}, "token": ""}},
+		{Method: "POST", Path: "/api/auth/refresh", Summary: "Refresh JWT token", Body: "token", Response: responseFields{"token": ""}},
+		{Method: "POST", Path: "/api/auth/forgot-password", Summary: "Email a password reset link", Body: "email", Response: responseFields{"message": ""}},
+		{Method: "POST", Path: "/api/auth/reset-password", Summary: "Set a new password with a reset token", Body: "token, password", Response: responseFields{"message": ""}},
+		{Method: "POST", Path: "/api/auth/verify-email", Summary: "Confirm an email address and log in", Body: "token", Response: responseFields{"message": "", "user": models.User{}, "token": ""}},
+		{Method: "POST", Path: "/api/auth/resend-verification", Summary: "Email a new verification link", Body: "email", Response: responseFields{"message": ""}},
+	}},
+	{Tag: "Auth", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/auth/me", Summary: "Get current user", Response: responseFields{"user": models.User{}}},
+		{Method: "PUT", Path: "/api/auth/password", Summary: "Change password", Body: "current_password, new_password", Response: responseFields{"message": ""}},
+		{Method: "GET", Path: "/api/users/search", Summary: "Search users", Query: "q", Response: responseFields{"users": []models.User{}}},
+		{Method: "GET", Path: "/api/users/me/export", Summary: "Download all of your data as a zip", Query: "files", Produces: "application/zip"},
+		{Method: "DELETE", Path: "/api/users/me", Summary: "Delete your account and everything you own", Body: "password", Response: responseFields{"message": "", "books_deleted": 0}},
+		{Method: "POST", Path: "/api/users/me/claim-anonymous", Summary: "Take over the books, reading positions and collections kept without signing in (admins, or the only account)", Body: "visibility", Response: responseFields{"message": "", "claimed": models.AnonymousClaim{}}},
+	}},
+	{Tag: "Profiles", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/profiles", Summary: "List your restricted profiles", Response: responseFields{"profiles": []models.Profile{}, "count": 0, "pin_set": false}},
+		{Method: "POST", Path: "/api/profiles", Summary: "Add a restricted profile", Body: "name, max_age_rating, collection_ids", Status: http.StatusCreated, Response: models.Profile{}},
+		{Method: "PUT", Path: "/api/profiles/pin", Summary: "Set the PIN for leaving a profile", Body: "password, pin", Response: responseFields{"message": ""}},
+		{Method: "PUT", Path: "/api/profiles/:id", Summary: "Update a restricted profile", Body: "name, max_age_rating, collection_ids", Response: models.Profile{}},
+		{Method: "DELETE", Path: "/api/profiles/:id", Summary: "Delete a restricted profile", Response: responseFields{"message": ""}},
+		{Method: "POST", Path: "/api/profiles/:id/enter", Summary: "Switch to a restricted profile", Response: responseFields{"token": "", "profile": models.Profile{}}},
+		{Method: "GET", Path: "/api/profile", Summary: "Get the profile you're in", Response: responseFields{"profile": models.Profile{}}},
+		{Method: "GET", Path: "/api/profile/books", Summary: "List the books the profile you're in may read", Response: responseFields{"books": []models.ProfileBook{}, "count": 0}},
+		{Method: "POST", Path: "/api/profile/exit", Summary: "Leave a restricted profile with the PIN", Body: "pin", Response: responseFields{"token": ""}},
+	}},
+	{Tag: "Books", Auth: authOptional, Routes: []routeDoc{
+		{Method: "POST", Path: "/api/books", Summary: "Upload EPUB/PDF/CBZ/CBR", Body: "file (multipart)", Status: http.StatusCreated, Response: responseFields{"message": "", "book": models.Book{}, "restorable": models.DeletedBook{}}},
+		{Method: "POST", Path: "/api/books/physical", Summary: "Catalog a physical book without a file", Body: "title, author, series, series_index, isbn, publisher, publish_date, language, subjects, description, content_type, lookup", Status: http.StatusCreated, Response: responseFields{"message": "", "book": models.Book{}}},
+		{Method: "GET", Path: "/api/books", Summary: "List books", Query: "sort (title/author/series/date/relevance), order, search, type (book/comic), status, language, page, limit", Response: responseFields{"books": []models.Book{}, "count": 0, "total": 0, "page": 0, "limit": 0}},
+		{Method: "GET", Path: "/api/books/:id", Summary: "Get book by ID", Response: models.Book{}},
+		{Method: "DELETE", Path: "/api/books/:id", Summary: "Delete book", Response: responseFields{"message": "", "book": models.Book{}}},
+		{Method: "POST", Path: "/api/books/:id/restore", Summary: "Restore reading data from a deleted copy of the same file", Response: responseFields{"message": "", "restored": models.DeletedBook{}}},
+		{Method: "PUT", Path: "/api/books/:id/file", Summary: "Replace a book's file, keeping its ID and history", Body: "file (multipart)", Response: responseFields{"message": "", "book": models.Book{}}},
+		{Method: "GET", Path: "/api/books/:id/files", Summary: "List a book's main file and extra editions", Response: responseFields{"files": []models.BookFile{}}},
+		{Method: "POST", Path: "/api/books/:id/files", Summary: "Attach another format of a book", Body: "file (multipart)", Status: http.StatusCreated, Response: responseFields{"message": "", "file": models.BookFile{}}},
+		{Method: "GET", Path: "/api/books/:id/files/:fileId", Summary: "Download one of a book's files"},
+		{Method: "DELETE", Path: "/api/books/:id/files/:fileId", Summary: "Remove an extra edition", Response: responseFields{"message": "", "file": models.BookFile{}}},
+		{Method: "GET", Path: "/api/books/by-author", Summary: "Books grouped by author"},
+		{Method: "GET", Path: "/api/books/by-series", Summary: "Books grouped by series"},
+		{Method: "GET", Path: "/api/books/by-language", Summary: "Books grouped by language"},
+		{Method: "GET", Path: "/api/books/index", Summary: "Get an A–Z index of the book list: how many books are under each letter and the offset of the first", Query: "by, order, type, status, language", Response: responseFields{"by": "", "order": "", "total": 0, "letters": []models.LetterBucket{}}},
+		{Method: "GET", Path: "/api/books/facets", Summary: "Count your books by format, content type, read status, language, rating and top tags, for a filter sidebar", Query: "search, type, status, language", Response: models.BookFacets{}},
+		{Method: "GET", Path: "/api/search/suggest", Summary: "Suggest titles, authors, series and tags matching a partly typed search", Query: "q, limit", Response: responseFields{"suggestions": []models.SearchSuggestion{}}},
+		{Method: "POST", Path: "/api/books/languages/detect", Summary: "Detect the language of EPUBs that have none", Response: responseFields{"processed": 0, "detected": 0}},
+		{Method: "GET", Path: "/api/books/:id/similar", Summary: "Get similar books", Query: "limit"},
+	}},
+	{Tag: "Reading", Auth: authOptional, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/books/:id/cover", Summary: "Get book cover image", Produces: "image/*"},
+		{Method: "GET", Path: "/api/books/:id/file", Summary: "Get book file (PDF/EPUB/CBZ/CBR)", Query: "format, device", Produces: "application/octet-stream"},
+		{Method: "GET", Path: "/api/books/:id/toc", Summary: "Get table of contents (EPUB only)", Response: responseFields{"chapters": []epub.Chapter{}}},
+		{Method: "GET", Path: "/api/books/:id/content/:chapter", Summary: "Get chapter HTML content (EPUB only)", Query: "apply_theme (1 to inject reader theme and CSS overrides), page, page_size (split into pages), raw (1 for unsanitized HTML)", Produces: "text/html"},
+		{Method: "GET", Path: "/api/books/:id/text/:chapter", Summary: "Get chapter plain text (EPUB only, TUI-friendly)", Query: "offset, limit (fetch a chunk of the chapter's text, in characters)", Response: responseFields{"book_id": "", "chapter": 0, "content": "", "content_type": ""}},
+		{Method: "GET", Path: "/api/books/:id/footnotes/:chapter", Summary: "Resolve a footnote or other intra-book link to its content (EPUB only)", Query: "id (required, the link's fragment)", Response: responseFields{"book_id": "", "chapter": 0, "id": "", "kind": "", "html": "", "text": "", "backlinks": []epub.NoteLink{}}},
+		{Method: "GET", Path: "/api/books/:id/pdf/text/:page", Summary: "Get the text of a PDF page (PDF only, TUI-friendly)", Response: responseFields{"book_id": "", "page": 0, "page_count": 0, "text": "", "image_only": false, "content_type": ""}},
+		{Method: "GET", Path: "/api/books/:id/resource/*path", Summary: "Get an image, stylesheet, or font from an EPUB", Produces: "application/octet-stream"},
+		{Method: "GET", Path: "/api/books/:id/offline-bundle", Summary: "Download everything needed to read a book offline", Query: "format (zip/json)", Produces: "application/zip"},
+		{Method: "GET", Path: "/api/books/:id/sample", Summary: "Get the start of a book, to preview it before asking for the whole file", Produces: "application/octet-stream"},
+		{Method: "GET", Path: "/api/books/:id/cbz/info", Summary: "Get comic info and page count", Response: responseFields{"pageCount": 0, "title": "", "author": "", "series": "", "readingDirection": ""}},
+		{Method: "GET", Path: "/api/books/:id/cbz/page/:page", Summary: "Get a comic page image", Produces: "image/*"},
+		{Method: "GET", Path: "/api/books/:id/cbz/strip", Summary: "Get the layout of a CBZ's pages stacked into one vertical strip", Query: "width (0 for the widest page), height (slice height)", Response: responseFields{"width": 0, "height": 0, "slice_height": 0, "slices": 0, "pages": []cbz.StripPage{}}},
+		{Method: "GET", Path: "/api/books/:id/cbz/strip/:slice", Summary: "Get one slice of a CBZ's vertical strip", Query: "width, height", Produces: "image/jpeg"},
+		{Method: "GET", Path: "/api/books/:id/cbz/thumbnails", Summary: "Get a small thumbnail of every comic page for a seek strip", Response: responseFields{"book_id": "", "count": 0, "thumbnails": []cbz.Thumbnail{}}},
+		{Method: "PUT", Path: "/api/books/:id/long-strip", Summary: "Set whether a comic is read as a continuous vertical strip", Body: "long_strip", Response: responseFields{"message": "", "book_id": "", "long_strip": false}},
+		{Method: "PUT", Path: "/api/books/:id/visibility", Summary: "Set who besides the owner can see a book", Body: "visibility (private/household/public)", Response: responseFields{"message": "", "book_id": "", "visibility": ""}},
+		{Method: "PUT", Path: "/api/books/:id/age-rating", Summary: "Set who a book is suitable for (owner or admin; not restricted accounts)", Body: "age_rating (all_ages/teen/mature/adult, or empty)", Response: responseFields{"message": "", "book_id": "", "age_rating": ""}},
+		{Method: "PUT", Path: "/api/books/:id/reading-direction", Summary: "Set a book's reading direction", Body: "reading_direction (ltr/rtl)", Response: responseFields{"message": "", "book_id": "", "reading_direction": ""}},
+		{Method: "GET", Path: "/api/series/reading-directions", Summary: "List series reading directions", Response: responseFields{"series": []models.SeriesReadingDirection{}}},
+		{Method: "PUT", Path: "/api/series/reading-directions", Summary: "Set the reading direction new uploads in a series get", Body: "series, reading_direction (ltr/rtl)", Response: models.SeriesReadingDirection{}},
+		{Method: "DELETE", Path: "/api/series/reading-directions", Summary: "Remove a series reading direction", Query: "series"},
+		{Method: "GET", Path: "/api/books/:id/position", Summary: "Get reading position", Response: responseFields{"position": &models.ReadingPosition{}}},
+		{Method: "POST", Path: "/api/books/:id/position", Summary: "Save reading position", Body: "chapter, position, cfi (chapter or cfi required)", Response: responseFields{"message": "", "position": models.ReadingPosition{}}},
+		{Method: "GET", Path: "/api/books/:id/cfi", Summary: "Convert a chapter and progress or character offset in an EPUB to a CFI", Query: "chapter, progress, offset", Response: positions.Location{}},
+		{Method: "GET", Path: "/api/books/:id/cfi/resolve", Summary: "Convert a CFI to the chapter and progress through it", Query: "cfi", Response: positions.Location{}},
+	}},
+	{Tag: "Read Status", Auth: authOptional, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/books/status/counts", Summary: "Count books by read status"},
+		{Method: "GET", Path: "/api/books/:id/status", Summary: "Get read status"},
+		{Method: "PUT", Path: "/api/books/:id/status", Summary: "Update read status", Body: "status (unread/reading/completed)"},
+		{Method: "POST", Path: "/api/books/status/bulk", Summary: "Update read status for multiple books", Body: "book_ids, status, dry_run"},
+		{Method: "GET", Path: "/api/custom-fields", Summary: "List the custom fields every book has", Response: responseFields{"fields": []models.CustomField{}, "count": 0}},
+		{Method: "POST", Path: "/api/custom-fields", Summary: "Add a custom field to every book (admins only)", Body: "key, name, type (text/number/bool/date/enum), options", Status: http.StatusCreated, Response: models.CustomField{}},
+		{Method: "PUT", Path: "/api/custom-fields/:id", Summary: "Rename a custom field or change an enum's options (admins only)", Body: "name, options", Response: models.CustomField{}},
+		{Method: "DELETE", Path: "/api/custom-fields/:id", Summary: "Remove a custom field and all its values (admins only)"},
+		{Method: "PUT", Path: "/api/books/:id/custom-fields", Summary: "Set your custom field values for a book", Body: "values", Response: responseFields{"custom_fields": map[string]interface{}{}}},
+		{Method: "POST", Path: "/api/books/custom-fields/bulk", Summary: "Set custom field values for multiple books", Body: "book_ids, values, dry_run", Response: responseFields{"message": "", "updated_count": 0, "requested_count": 0, "changes": []models.BookChange{}}},
+		{Method: "GET", Path: "/api/books/:id/rating", Summary: "Get star rating"},
+		{Method: "PUT", Path: "/api/books/:id/rating", Summary: "Update star rating", Body: "rating (0-5)"},
+	}},
+	{Tag: "Metadata", Auth: authOptional, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/metadata/lookup", Summary: "Lookup book metadata from external sources", Query: "isbn, title, author, provider"},
+		{Method: "GET", Path: "/api/metadata/search", Summary: "Search for book metadata and return all matches", Query: "isbn, title, author, year, provider"},
+		{Method: "GET", Path: "/api/metadata/providers", Summary: "List the book metadata providers a lookup or refresh can ask for", Response: responseFields{"providers": []string{}, "count": 0}},
+		{Method: "POST", Path: "/api/books/:id/metadata/refresh", Summary: "Refresh book metadata from external sources", Query: "provider"},
+		{Method: "PUT", Path: "/api/books/:id/metadata", Summary: "Manually update book metadata", Body: "title, author, series, series_index, isbn, publisher, publish_date, language, subjects, description"},
+		{Method: "GET", Path: "/api/books/:id/history", Summary: "List a book's metadata revisions, newest first", Response: responseFields{"revisions": []models.MetadataRevision{}, "count": 0}},
+		{Method: "POST", Path: "/api/books/:id/history/:rev/revert", Summary: "Set the fields a metadata revision changed back to their old values", Response: responseFields{"book": models.Book{}, "revision": models.MetadataRevision{}}},
+		{Method: "POST", Path: "/api/metadata/bulk-refresh", Summary: "Queue a background job refreshing metadata for multiple books", Body: "book_ids, content_type, dry_run, provider", Status: http.StatusAccepted, Response: responseFields{"message": "", "job": models.Job{}}},
+		{Method: "POST", Path: "/api/metadata/scan", Summary: "Look up a book from a scanned barcode", Body: "code"},
+		{Method: "GET", Path: "/api/metadata/comic/status", Summary: "Check if comic metadata service is configured"},
+		{Method: "GET", Path: "/api/metadata/comic/search", Summary: "Search for comic metadata from ComicVine", Query: "series, issue, title"},
+		{Method: "GET", Path: "/api/metadata/comic/arcs", Summary: "Search for story arcs on ComicVine", Query: "name", Response: responseFields{"results": []metadata.StoryArcMetadata{}, "count": 0}},
+		{Method: "POST", Path: "/api/books/:id/metadata/comic/refresh", Summary: "Refresh comic metadata from ComicVine"},
+		{Method: "POST", Path: "/api/books/:id/metadata/comic/reprocess", Summary: "Re-parse comic metadata from the filename"},
+		{Method: "POST", Path: "/api/metadata/comic/parse-preview", Summary: "Show how a comic filename is parsed, optionally with an unsaved pattern", Body: "filename, pattern", Response: responseFields{"result": cbz.ComicFilenameInfo{}, "builtin": cbz.ComicFilenameInfo{}}},
+	}},
+	{Tag: "Duplicates", Auth: authOptional, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/duplicates", Summary: "Find duplicate books by file hash, and editions by title"},
+		{Method: "GET", Path: "/api/duplicates/status", Summary: "Get hash computation status"},
+		{Method: "POST", Path: "/api/duplicates/compute", Summary: "Queue a job hashing books without hashes", Status: http.StatusAccepted, Response: responseFields{"message": "", "job": models.Job{}}},
+		{Method: "POST", Path: "/api/duplicates/merge", Summary: "Merge duplicate books", Body: "keep_id, delete_ids, dry_run"},
+	}},
+	{Tag: "Sharing", Auth: authOptional, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/books/shared", Summary: "Get books shared with you", Response: responseFields{"books": []models.Book{}, "count": 0}},
+		{Method: "GET", Path: "/api/books/:id/shares", Summary: "Get users book is shared with", Response: responseFields{"shared_with": []models.User{}}},
+		{Method: "POST", Path: "/api/books/:id/share/:userId", Summary: "Share book with user", Response: messageResponse},
+		{Method: "DELETE", Path: "/api/books/:id/share/:userId", Summary: "Unshare book", Response: messageResponse},
+		{Method: "POST", Path: "/api/books/:id/transfer/:userId", Summary: "Give a book to another user", Body: "reset_read_state", Response: responseFields{"message": "", "book": models.Book{}}},
+	}},
+	{Tag: "Collections", Auth: authOptional, Routes: []routeDoc{
+		{Method: "POST", Path: "/api/collections", Summary: "Create collection", Body: "name, parent_id, is_smart, rule_logic, rules", Status: http.StatusCreated, Response: responseFields{"message": "", "collection": models.Collection{}}},
+		{Method: "GET", Path: "/api/collections", Summary: "List collections", Response: responseFields{"collections": []models.Collection{}, "count": 0}},
+		{Method: "GET", Path: "/api/collections/:id", Summary: "Get collection with books and subcollections", Query: "rollup", Response: responseFields{"collection": models.Collection{}, "books": []models.Book{}, "children": []models.Collection{}}},
+		{Method: "GET", Path: "/api/collections/:id/download", Summary: "Download the collection's book files as a zip", Query: "device", Produces: "application/zip"},
+		{Method: "GET", Path: "/api/collections/:id/cover", Summary: "Get a mosaic of the covers of the collection's first four books", Produces: "image/jpeg"},
+		{Method: "PUT", Path: "/api/collections/:id", Summary: "Update collection", Body: "name, parent_id, rule_logic, rules", Response: messageResponse},
+		{Method: "DELETE", Path: "/api/collections/:id", Summary: "Delete collection", Response: messageResponse},
+		{Method: "POST", Path: "/api/collections/:id/books/:bookId", Summary: "Add book to collection", Response: messageResponse},
+		{Method: "DELETE", Path: "/api/collections/:id/books/:bookId", Summary: "Remove book from collection", Response: messageResponse},
+		{Method: "POST", Path: "/api/collections/:id/books", Summary: "Bulk add books", Body: "book_ids", Response: responseFields{"message": "", "count": 0}},
+		{Method: "PUT", Path: "/api/collections/:id/reorder", Summary: "Reorder books in a static collection", Body: "book_ids", Response: responseFields{"message": "", "collection_id": ""}},
+		{Method: "GET", Path: "/api/books/:id/collections", Summary: "Get collections for book", Response: responseFields{"collections": []models.Collection{}}},
+	}},
+	{Tag: "Reading Lists", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/reading-lists", Summary: "List reading lists", Response: responseFields{"lists": []models.ReadingList{}, "count": 0}},
+		{Method: "POST", Path: "/api/reading-lists", Summary: "Create reading list", Body: "name", Status: http.StatusCreated, Response: responseFields{"message": "", "list": models.ReadingList{}}},
+		{Method: "GET", Path: "/api/reading-lists/:id", Summary: "Get reading list with books", Response: responseFields{"list": models.ReadingList{}, "books": []models.Book{}}},
+		{Method: "GET", Path: "/api/reading-lists/:id/download", Summary: "Download the list's book files as a zip, numbered in list order", Query: "device", Produces: "application/zip"},
+		{Method: "GET", Path: "/api/reading-lists/:id/cover", Summary: "Get a mosaic of the covers of the list's first four books", Produces: "image/jpeg"},
+		{Method: "PUT", Path: "/api/reading-lists/:id", Summary: "Rename reading list", Body: "name"},
+		{Method: "DELETE", Path: "/api/reading-lists/:id", Summary: "Delete reading list"},
+		{Method: "POST", Path: "/api/reading-lists/:id/books/:bookId", Summary: "Add book to reading list"},
+		{Method: "DELETE", Path: "/api/reading-lists/:id/books/:bookId", Summary: "Remove book from reading list"},
+		{Method: "PUT", Path: "/api/reading-lists/:id/books/:bookId/toggle", Summary: "Toggle book in reading list"},
+		{Method: "PUT", Path: "/api/reading-lists/:id/reorder", Summary: "Reorder books in reading list", Body: "book_ids"},
+		{Method: "GET", Path: "/api/books/:id/reading-lists", Summary: "Get reading lists containing a book"},
+	}},
+	{Tag: "Tags", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/tags", Summary: "List tags", Response: responseFields{"tags": []models.Tag{}, "count": 0}},
+		{Method: "POST", Path: "/api/tags", Summary: "Create tag", Body: "name, color", Status: http.StatusCreated, Response: responseFields{"message": "", "tag": models.Tag{}}},
+		{Method: "GET", Path: "/api/tags/:id", Summary: "Get tag", Response: models.Tag{}},
+		{Method: "PUT", Path: "/api/tags/:id", Summary: "Update tag", Body: "name, color"},
+		{Method: "DELETE", Path: "/api/tags/:id", Summary: "Delete tag"},
+		{Method: "GET", Path: "/api/tags/:id/books", Summary: "Get books with tag", Response: responseFields{"tag": models.Tag{}, "books": []models.Book{}, "count": 0}},
+		{Method: "GET", Path: "/api/tags/:id/cover", Summary: "Get a mosaic of the covers of four books with the tag", Produces: "image/jpeg"},
+		{Method: "GET", Path: "/api/books/:id/tags", Summary: "Get tags for book"},
+		{Method: "POST", Path: "/api/books/:id/tags/:tagId", Summary: "Add tag to book"},
+		{Method: "DELETE", Path: "/api/books/:id/tags/:tagId", Summary: "Remove tag from book"},
+		{Method: "PUT", Path: "/api/books/:id/tags/:tagId/toggle", Summary: "Toggle tag on book"},
+	}},
+	{Tag: "Annotations", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/annotations", Summary: "Export all annotations and book notes", Response: responseFields{"annotations": []models.Annotation{}, "count": 0, "notes": []models.BookNote{}}},
+		{Method: "GET", Path: "/api/annotations/stats", Summary: "Get annotation statistics"},
+		{Method: "GET", Path: "/api/annotations/review", Summary: "Get highlights due for review, never-reviewed first", Query: "limit", Response: responseFields{"highlights": []models.ReviewHighlight{}, "count": 0}},
+		{Method: "POST", Path: "/api/annotations/review", Summary: "Mark highlights reviewed, scheduling their next review", Body: "annotation_ids", Response: responseFields{"reviews": []models.AnnotationReview{}, "count": 0}},
+		{Method: "GET", Path: "/api/annotations/:id/citation", Summary: "Quote a highlight with a citation of its book", Query: "style (apa, mla, or chicago; default apa)", Response: annotations.Citation{}},
+		{Method: "GET", Path: "/api/books/:id/annotations", Summary: "List annotations for book", Response: responseFields{"annotations": []models.Annotation{}, "count": 0}},
+		{Method: "GET", Path: "/api/books/:id/annotations/chapter/:chapter", Summary: "List annotations for chapter", Response: responseFields{"annotations": []models.Annotation{}, "count": 0}},
+		{Method: "GET", Path: "/api/books/:id/annotations/chapter/:chapter/shared", Summary: "List your and other readers' shared annotations for chapter", Response: responseFields{"annotations": []models.Annotation{}, "count": 0}},
+		{Method: "POST", Path: "/api/books/:id/annotations", Summary: "Create annotation", Body: "chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility", Status: http.StatusCreated, Response: responseFields{"message": "", "annotation": models.Annotation{}}},
+		{Method: "GET", Path: "/api/books/:id/annotations/:annotationId", Summary: "Get annotation", Response: models.Annotation{}},
+		{Method: "GET", Path: "/api/books/:id/annotations/:annotationId/location", Summary: "Resolve annotation to the chapter and point in it where its text is", Response: responseFields{"annotation_id": "", "chapter": 0, "offset": 0, "progress": 0.0, "cfi": "", "found": false}},
+		{Method: "PUT", Path: "/api/books/:id/annotations/:annotationId", Summary: "Update annotation", Body: "note, color, visibility"},
+		{Method: "DELETE", Path: "/api/books/:id/annotations/:annotationId", Summary: "Delete annotation", Response: messageResponse},
+		{Method: "GET", Path: "/api/books/:id/notes", Summary: "List book notes", Response: responseFields{"notes": []models.BookNote{}, "count": 0}},
+		{Method: "POST", Path: "/api/books/:id/notes", Summary: "Create a Markdown book note", Body: "title, body", Status: http.StatusCreated, Response: responseFields{"message": "", "note": models.BookNote{}}},
+		{Method: "GET", Path: "/api/books/:id/notes/:noteId", Summary: "Get book note", Response: models.BookNote{}},
+		{Method: "PUT", Path: "/api/books/:id/notes/:noteId", Summary: "Update book note, keeping the previous version", Body: "title, body", Response: responseFields{"message": "", "note": models.BookNote{}}},
+		{Method: "DELETE", Path: "/api/books/:id/notes/:noteId", Summary: "Delete book note and its history", Response: messageResponse},
+		{Method: "GET", Path: "/api/books/:id/notes/:noteId/revisions", Summary: "List a book note's earlier versions", Response: responseFields{"revisions": []models.BookNoteRevision{}, "count": 0}},
+	}},
+	{Tag: "Statistics", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/stats", Summary: "Get reading statistics", Response: models.UserStatistics{}},
+		{Method: "GET", Path: "/api/stats/summary", Summary: "Get reading statistics summary"},
+		{Method: "GET", Path: "/api/stats/daily", Summary: "Get daily reading statistics", Query: "days"},
+		{Method: "GET", Path: "/api/stats/export", Summary: "Export reading sessions and daily totals as JSON or CSV", Query: "from, to, format (json/csv), data (sessions/daily, for CSV)", Response: responseFields{"from": "", "to": "", "timezone": "", "sessions": []statsExportSession{}, "daily": []statsExportDay{}}},
+		{Method: "GET", Path: "/api/stats/memories", Summary: "Books finished and highlights made on this date in past years", Query: "date", Response: responseFields{"date": "", "memories": []models.Memory{}, "count": 0}},
+		{Method: "GET", Path: "/api/stats/preferences", Summary: "Get the timezone your stats count days in", Response: models.StatsPreferences{}},
+		{Method: "PUT", Path: "/api/stats/preferences", Summary: "Set the timezone your stats and streaks count days in, and privacy mode", Body: "timezone, privacy_mode", Response: models.StatsPreferences{}},
+		{Method: "DELETE", Path: "/api/stats/history", Summary: "Delete your reading sessions, stats, and published activity", Response: messageResponse},
+		{Method: "GET", Path: "/api/stats/sessions", Summary: "List recent reading sessions", Query: "limit", Response: []models.ReadingSession{}},
+		{Method: "POST", Path: "/api/stats/sessions", Summary: "Start reading session", Body: "book_id", Status: http.StatusCreated, Response: models.ReadingSession{}},
+		{Method: "PUT", Path: "/api/stats/sessions/:id", Summary: "End reading session", Body: "pages_read, chapters_read", Response: models.ReadingSession{}},
+		{Method: "PUT", Path: "/api/books/:id/reading-session", Summary: "Update reading session progress and record a heartbeat", Body: "pages_read, chapters_read", Response: models.ReadingSession{}},
+		{Method: "POST", Path: "/api/books/:id/reading-session/pause", Summary: "Pause a reading session's clock", Response: models.ReadingSession{}},
+		{Method: "POST", Path: "/api/books/:id/reading-session/resume", Summary: "Resume a paused reading session", Response: models.ReadingSession{}},
+		{Method: "GET", Path: "/api/books/:id/stats", Summary: "Get reading statistics for book"},
+	}},
+	{Tag: "Notifications", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/notifications/channels", Summary: "List notification channels", Response: responseFields{"channels": []models.NotificationChannel{}, "count": 0, "available": []string{}}},
+		{Method: "POST", Path: "/api/notifications/channels", Summary: "Create notification channel", Body: "type, name, target, token, enabled", Status: http.StatusCreated},
+		{Method: "PUT", Path: "/api/notifications/channels/:id", Summary: "Update notification channel", Body: "name, target, token, enabled"},
+		{Method: "DELETE", Path: "/api/notifications/channels/:id", Summary: "Delete notification channel", Response: messageResponse},
+		{Method: "POST", Path: "/api/notifications/channels/:id/test", Summary: "Send test notification", Response: messageResponse},
+		{Method: "GET", Path: "/api/notifications/subscriptions", Summary: "Get notification subscriptions", Response: responseFields{"subscriptions": []models.NotificationSubscription{}}},
+		{Method: "PUT", Path: "/api/notifications/subscriptions", Summary: "Update notification subscriptions", Body: "subscriptions"},
+	}},
+	{Tag: "Trackers", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/trackers", Summary: "List reading trackers your read status changes are sent to", Response: responseFields{"trackers": []models.TrackerConnection{}, "count": 0, "available": []string{}}},
+		{Method: "POST", Path: "/api/trackers", Summary: "Connect a reading tracker, such as Hardcover or a webhook", Body: "type, name, target, token, enabled", Status: http.StatusCreated, Response: models.TrackerConnection{}},
+		{Method: "PUT", Path: "/api/trackers/:id", Summary: "Update a reading tracker", Body: "name, target, token, enabled", Response: models.TrackerConnection{}},
+		{Method: "DELETE", Path: "/api/trackers/:id", Summary: "Disconnect a reading tracker", Response: messageResponse},
+		{Method: "POST", Path: "/api/trackers/:id/test", Summary: "Check a reading tracker can be reached, changing nothing on it", Response: messageResponse},
+	}},
+	{Tag: "Follows", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/follows", Summary: "List followed authors and series", Response: responseFields{"follows": []models.Follow{}, "count": 0}},
+		{Method: "POST", Path: "/api/follows", Summary: "Follow an author or series", Body: "type (author/series), name", Status: http.StatusCreated, Response: responseFields{"message": "", "follow": models.Follow{}}},
+		{Method: "GET", Path: "/api/follows/updates", Summary: "List new releases", Query: "unseen, limit", Response: responseFields{"updates": []models.FollowUpdate{}, "count": 0}},
+		{Method: "POST", Path: "/api/follows/updates/seen", Summary: "Mark new releases as seen", Body: "update_ids", Response: messageResponse},
+		{Method: "DELETE", Path: "/api/follows/:id", Summary: "Unfollow", Response: messageResponse},
+		{Method: "POST", Path: "/api/follows/:id/check", Summary: "Check for new releases now"},
+	}},
+	{Tag: "Reviews", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/reviews", Summary: "List your reviews", Response: responseFields{"reviews": []models.BookReview{}, "count": 0}},
+		{Method: "GET", Path: "/api/books/:id/review", Summary: "Get your review of a book", Response: models.BookReview{}},
+		{Method: "PUT", Path: "/api/books/:id/review", Summary: "Save your review of a book", Body: "rating, review, spoiler, read_date", Response: responseFields{"message": "", "review": models.BookReview{}}},
+		{Method: "DELETE", Path: "/api/books/:id/review", Summary: "Delete your review of a book", Response: messageResponse},
+		{Method: "GET", Path: "/api/books/:id/reviews", Summary: "List reviews of a book", Response: responseFields{"book_id": "", "reviews": []models.BookReview{}, "count": 0, "average_rating": 0.0}},
+	}},
+	{Tag: "Library Preferences", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/library/preferences", Summary: "Get library sort and subject tag preferences", Response: models.LibraryPreferences{}},
+		{Method: "PUT", Path: "/api/library/preferences", Summary: "Update library sort and subject tag preferences", Body: "sort_locale, ignore_articles, subject_tags, subject_tag_map, default_visibility", Response: models.LibraryPreferences{}},
+		{Method: "POST", Path: "/api/library/subject-tags/sync", Summary: "Turn every book's metadata subjects into tags", Body: "dry_run", Response: responseFields{"dry_run": false, "processed": 0, "changes": []models.BookChange{}}},
+		{Method: "POST", Path: "/api/library/reorganize", Summary: "Move book files into Author/Series/Title folders", Body: "book_ids, dry_run", Response: responseFields{"dry_run": false, "processed": 0, "moved": 0, "changes": []models.BookChange{}}},
+	}},
+	{Tag: "Reader Preferences", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/reader/preferences", Summary: "Get reader preferences (font, theme, page-turn mode)", Response: models.ReaderPreferences{}},
+		{Method: "PUT", Path: "/api/reader/preferences", Summary: "Update reader preferences", Body: "font_family, font_size, line_height, margins, theme, page_turn_mode, comic_fit_mode", Response: models.ReaderPreferences{}},
+		{Method: "GET", Path: "/api/reader/css", Summary: "Get CSS applied to every EPUB chapter", Response: models.StyleOverride{}},
+		{Method: "PUT", Path: "/api/reader/css", Summary: "Set CSS applied to every EPUB chapter with ?apply_theme=1", Body: "css", Response: models.StyleOverride{}},
+		{Method: "DELETE", Path: "/api/reader/css", Summary: "Remove CSS applied to every EPUB chapter", Response: messageResponse},
+		{Method: "GET", Path: "/api/books/:id/css", Summary: "Get CSS applied to this book's chapters", Response: models.StyleOverride{}},
+		{Method: "PUT", Path: "/api/books/:id/css", Summary: "Set CSS applied to this book's chapters with ?apply_theme=1", Body: "css", Response: models.StyleOverride{}},
+		{Method: "DELETE", Path: "/api/books/:id/css", Summary: "Remove CSS applied to this book's chapters", Response: messageResponse},
+	}},
+	{Tag: "Lending", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/loans", Summary: "List books you have lent out", Query: "status (active/overdue/all)", Response: responseFields{"loans": []models.BookLoan{}, "count": 0}},
+		{Method: "GET", Path: "/api/loans/borrowed", Summary: "List books lent to you", Response: responseFields{"loans": []models.BookLoan{}, "count": 0}},
+		{Method: "POST", Path: "/api/books/:id/loans", Summary: "Lend a book", Body: "borrower_name, borrower_user_id, due_date (YYYY-MM-DD), notes", Status: http.StatusCreated, Response: models.BookLoan{}},
+		{Method: "POST", Path: "/api/loans/:id/return", Summary: "Mark a loan returned", Response: models.BookLoan{}},
+		{Method: "DELETE", Path: "/api/loans/:id", Summary: "Delete a loan record", Response: messageResponse},
+	}},
+	{Tag: "Book Clubs", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/clubs", Summary: "List your book clubs", Response: responseFields{"clubs": []models.BookClub{}, "count": 0}},
+		{Method: "POST", Path: "/api/clubs", Summary: "Start a book club for one of your books", Body: "book_id, name, description", Status: http.StatusCreated, Response: models.BookClub{}},
+		{Method: "GET", Path: "/api/clubs/:id", Summary: "Get a club with its members and schedule", Response: models.BookClub{}},
+		{Method: "PUT", Path: "/api/clubs/:id", Summary: "Rename a club or change its description", Body: "name, description", Response: models.BookClub{}},
+		{Method: "DELETE", Path: "/api/clubs/:id", Summary: "Delete a club and its discussion", Response: messageResponse},
+		{Method: "POST", Path: "/api/clubs/:id/members", Summary: "Add a member, sharing the book with them", Body: "username", Status: http.StatusCreated, Response: models.BookClubMember{}},
+		{Method: "DELETE", Path: "/api/clubs/:id/members/:userId", Summary: "Remove a member or leave a club", Response: messageResponse},
+		{Method: "PUT", Path: "/api/clubs/:id/schedule", Summary: "Replace a club's reading schedule", Body: "schedule [{chapter, title, due_date (YYYY-MM-DD)}]", Response: responseFields{"schedule": []models.BookClubScheduleEntry{}}},
+		{Method: "GET", Path: "/api/clubs/:id/comments", Summary: "List a club's discussion, hiding spoilers past your position", Query: "chapter", Response: responseFields{"comments": []models.BookClubComment{}, "count": 0, "chapter_reached": 0}},
+		{Method: "POST", Path: "/api/clubs/:id/comments", Summary: "Comment on a chapter or reply to a comment", Body: "chapter, parent_id, body", Status: http.StatusCreated, Response: models.BookClubComment{}},
+		{Method: "DELETE", Path: "/api/clubs/:id/comments/:commentId", Summary: "Delete a comment and its replies", Response: messageResponse},
+	}},
+	{Tag: "Challenges", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/challenges", Summary: "List the challenges you take part in or are invited to", Response: responseFields{"challenges": []models.ReadingChallenge{}, "count": 0}},
+		{Method: "POST", Path: "/api/challenges", Summary: "Start a reading challenge and invite users to it", Body: "name, description, metric, target, start_date, end_date, usernames", Status: http.StatusCreated, Response: models.ReadingChallenge{}},
+		{Method: "GET", Path: "/api/challenges/:id", Summary: "Get a challenge with everyone invited to it", Response: models.ReadingChallenge{}},
+		{Method: "DELETE", Path: "/api/challenges/:id", Summary: "Delete a challenge, keeping the badges earned in it", Response: messageResponse},
+		{Method: "POST", Path: "/api/challenges/:id/participants", Summary: "Invite a user to a challenge", Body: "username", Status: http.StatusCreated, Response: models.ChallengeParticipant{}},
+		{Method: "DELETE", Path: "/api/challenges/:id/participants/:userId", Summary: "Remove a participant, or leave or decline a challenge", Response: messageResponse},
+		{Method: "POST", Path: "/api/challenges/:id/join", Summary: "Accept an invitation to a challenge", Response: models.ReadingChallenge{}},
+		{Method: "GET", Path: "/api/challenges/:id/leaderboard", Summary: "Rank a challenge's participants by their reading", Response: responseFields{"challenge": models.ReadingChallenge{}, "standings": []models.ChallengeStanding{}, "ended": false}},
+		{Method: "GET", Path: "/api/badges", Summary: "List the badges you've earned in challenges", Response: responseFields{"badges": []models.UserBadge{}, "count": 0}},
+	}},
+	{Tag: "Achievements", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/achievements", Summary: "List achievements with your progress, awarding any newly earned", Response: responseFields{"achievements": []models.Achievement{}, "count": 0, "earned": 0}},
+	}},
+	{Tag: "Devices", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/devices", Summary: "List your devices", Response: responseFields{"devices": []models.Device{}, "count": 0}},
+		{Method: "POST", Path: "/api/devices", Summary: "Register a device and get its token", Body: "name, preferred_format, max_file_size, screen_width, screen_height", Status: http.StatusCreated, Response: responseFields{"device": models.Device{}, "token": ""}},
+		{Method: "PUT", Path: "/api/devices/:id", Summary: "Change a device's name or download preferences", Body: "name, preferred_format, max_file_size, screen_width, screen_height", Response: models.Device{}},
+		{Method: "POST", Path: "/api/devices/:id/token", Summary: "Replace a device's token", Response: responseFields{"device": models.Device{}, "token": ""}},
+		{Method: "DELETE", Path: "/api/devices/:id", Summary: "Remove a device", Response: messageResponse},
+	}},
+	{Tag: "Activity", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/activity", Summary: "List recent activity from you and the users you share books with", Query: "limit", Response: responseFields{"events": []models.ActivityEvent{}, "count": 0}},
+		{Method: "GET", Path: "/api/activity/preferences", Summary: "Get what you publish to the activity feed", Response: models.ActivityPreferences{}},
+		{Method: "PUT", Path: "/api/activity/preferences", Summary: "Choose what you publish to the activity feed", Body: "publish_added, publish_finished, publish_rated", Response: models.ActivityPreferences{}},
+	}},
+	{Tag: "Sync", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/sync", Summary: "Get what changed in your library since a cursor, or everything without one", Query: "since, limit", Response: models.SyncDelta{}},
+	}},
+	{Tag: "Comic Series", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/series", Summary: "List your comic series with owned and read issue counts", Response: responseFields{"series": []models.ComicSeries{}, "count": 0}},
+		{Method: "POST", Path: "/api/series", Summary: "Add a comic series", Body: "name, publisher, start_year, volume, total_issues, description", Status: http.StatusCreated, Response: models.ComicSeries{}},
+		{Method: "GET", Path: "/api/series/:id", Summary: "Get a series with its issue checklist", Response: models.ComicSeries{}},
+		{Method: "PUT", Path: "/api/series/:id", Summary: "Update a series' details", Body: "publisher, start_year, volume, total_issues, description", Response: models.ComicSeries{}},
+		{Method: "DELETE", Path: "/api/series/:id", Summary: "Delete a series and its read marks", Response: messageResponse},
+		{Method: "POST", Path: "/api/series/:id/refresh", Summary: "Fill in series details from ComicVine", Response: models.ComicSeries{}},
+		{Method: "PUT", Path: "/api/series/:id/issues/:number", Summary: "Mark an issue read or unread", Body: "read", Response: models.ComicIssue{}},
+		{Method: "GET", Path: "/api/reading-orders", Summary: "List your reading orders", Response: responseFields{"reading_orders": []models.ReadingOrder{}, "count": 0}},
+		{Method: "POST", Path: "/api/reading-orders", Summary: "Create a reading order", Body: "name, description", Status: http.StatusCreated, Response: models.ReadingOrder{}},
+		{Method: "POST", Path: "/api/reading-orders/arcs", Summary: "Import a ComicVine story arc as a reading order", Body: "source_id", Status: http.StatusCreated, Response: models.ReadingOrder{}},
+		{Method: "GET", Path: "/api/reading-orders/:id", Summary: "Get a reading order with its issues", Response: models.ReadingOrder{}},
+		{Method: "PUT", Path: "/api/reading-orders/:id", Summary: "Rename a reading order or change its description", Body: "name, description", Response: models.ReadingOrder{}},
+		{Method: "DELETE", Path: "/api/reading-orders/:id", Summary: "Delete a reading order", Response: messageResponse},
+		{Method: "PUT", Path: "/api/reading-orders/:id/entries", Summary: "Replace a reading order's issues", Body: "entries [{series_id, issue_number}]", Response: models.ReadingOrder{}},
+		{Method: "POST", Path: "/api/reading-orders/:id/refresh", Summary: "Update an imported story arc's issues from ComicVine", Response: models.ReadingOrder{}},
+	}},
+	{Tag: "Reports", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/reports/metadata-issues", Summary: "List books with duplicate ISBNs, missing covers or descriptions, file-name titles, empty files, or unknown authors", Query: "issue", Response: models.MetadataReport{}},
+	}},
+	{Tag: "Jobs", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/jobs", Summary: "List your background jobs, newest first", Response: responseFields{"jobs": []models.Job{}, "count": 0}},
+		{Method: "GET", Path: "/api/jobs/:id", Summary: "Get a job's progress", Response: models.Job{}},
+		{Method: "GET", Path: "/api/jobs/:id/items", Summary: "List a job's items and how each went", Query: "status", Response: responseFields{"items": []models.JobItem{}, "count": 0}},
+		{Method: "POST", Path: "/api/jobs/:id/pause", Summary: "Pause a queued or running job after its current item", Response: models.Job{}},
+		{Method: "POST", Path: "/api/jobs/:id/resume", Summary: "Resume a paused job from its first unfinished item", Response: models.Job{}},
+	}},
+	{Tag: "OPDS Sources", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/opds-sources", Summary: "List your remote OPDS catalogs", Response: responseFields{"sources": []models.OPDSSource{}, "count": 0}},
+		{Method: "POST", Path: "/api/opds-sources", Summary: "Add a remote OPDS catalog, such as another Calibre-Web or Kavita server", Body: "name, url, username, password", Status: http.StatusCreated, Response: models.OPDSSource{}},
+		{Method: "DELETE", Path: "/api/opds-sources/:id", Summary: "Remove a remote OPDS catalog; books imported from it are kept"},
+		{Method: "GET", Path: "/api/opds-sources/:id/browse", Summary: "Browse or search a remote OPDS catalog", Query: "url, q", Response: opds.CatalogPage{}},
+		{Method: "POST", Path: "/api/opds-sources/:id/import", Summary: "Download books from a page of a remote OPDS catalog into your library", Body: "url, entry_ids", Response: responseFields{"imported": []models.Book{}, "failed": []responseFields{}, "imported_count": 0, "failed_count": 0}},
+	}},
+	{Tag: "Mirrors", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/sync-keys", Summary: "List the keys other servers mirror your collections with", Response: responseFields{"keys": []models.SyncKey{}, "count": 0}},
+		{Method: "POST", Path: "/api/sync-keys", Summary: "Create a sync key for another server, for the named collections; its token is only shown now", Body: "name, collections", Status: http.StatusCreated, Response: responseFields{"key": models.SyncKey{}, "token": ""}},
+		{Method: "DELETE", Path: "/api/sync-keys/:id", Summary: "Revoke a sync key"},
+		{Method: "GET", Path: "/api/mirrors", Summary: "List the servers your collections are pulled from or pushed to", Response: responseFields{"mirrors": []models.Mirror{}, "count": 0}},
+		{Method: "POST", Path: "/api/mirrors", Summary: "Mirror collections from or to another Webby server", Body: "name, url, api_key, direction, collections, include_files, conflict_rule, interval_minutes", Status: http.StatusCreated, Response: models.Mirror{}},
+		{Method: "DELETE", Path: "/api/mirrors/:id", Summary: "Stop mirroring with a server; synced books are kept"},
+		{Method: "POST", Path: "/api/mirrors/:id/sync", Summary: "Queue a sync of a mirror now", Status: http.StatusAccepted, Response: responseFields{"message": "", "job": models.Job{}}},
+		{Method: "GET", Path: "/api/mirrors/:id/status", Summary: "Report a mirror's last sync, whether it's syncing, and when it next syncs", Response: responseFields{"mirror_id": "", "syncing": false, "job": models.Job{}, "last_sync_at": time.Time{}, "last_status": "", "last_error": "", "last_result": models.MirrorResult{}, "next_sync_at": time.Time{}}},
+	}},
+	{Tag: "Mirror Peers", Auth: authSyncKey, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/mirror/manifest", Summary: "Describe collections and their books for a server pulling them", Query: "collection (repeated, by name)", Response: mirror.Manifest{}},
+		{Method: "POST", Path: "/api/mirror/push", Summary: "Sync a pushed manifest into the key's library", Body: "manifest, conflict_rule, include_files", Response: mirror.PushResponse{}},
+		{Method: "GET", Path: "/api/mirror/books/:id/file", Summary: "Download a book's main file for a server pulling it", Produces: "application/octet-stream"},
+		{Method: "POST", Path: "/api/mirror/books/:id/file", Summary: "Upload the file of a book a push asked for", Body: "file (multipart), book (its manifest entry as JSON)", Status: http.StatusCreated, Response: responseFields{"book": models.Book{}}},
+	}},
+	{Tag: "Administration", Auth: authRequired, Routes: []routeDoc{
+		{Method: "GET", Path: "/api/admin/storage", Summary: "Report free disk space, data directory usage, upload limits, and growth (admins only)", Response: responseFields{"free_bytes": 0, "total_bytes": 0, "usage": models.StorageUsage{}, "limits": responseFields{"max_upload_bytes": 0, "format_max_upload_bytes": map[string]int64{}, "min_free_bytes": 0}, "trend": []models.StorageSnapshot{}}},
+		{Method: "GET", Path: "/api/admin/cleanup", Summary: "List the latest data directory cleanups and what they've reclaimed in all (admins only)", Response: responseFields{"runs": []models.CleanupRun{}, "total_files": 0, "total_bytes": 0}},
+		{Method: "POST", Path: "/api/admin/cleanup", Summary: "Clean leftover uploads, temporary files and orphaned covers and thumbnails from the data directory now (admins only)", Response: models.CleanupRun{}},
+		{Method: "GET", Path: "/api/admin/workers", Summary: "Report the load on the workers for CPU-heavy requests (admins only)", Response: workpool.Stats{}},
+		{Method: "GET", Path: "/api/admin/integrity", Summary: "Report database problems and book files that failed verification (admins only)", Response: responseFields{"ok": false, "database": []string{}, "files": []models.FileProblem{}}},
+		{Method: "POST", Path: "/api/admin/files/verify", Summary: "Queue a job re-hashing every book file to find changed or missing files (admins only)", Status: http.StatusAccepted, Response: responseFields{"message": "", "job": models.Job{}}},
+		{Method: "POST", Path: "/api/admin/files/:id/accept", Summary: "Accept a book's file as it is now, clearing its verification problem (admins only)"},
+		{Method: "POST", Path: "/api/admin/covers/optimize", Summary: "Queue a job scaling down oversized covers (admins only)", Body: "dry_run", Status: http.StatusAccepted, Response: responseFields{"message": "", "job": models.Job{}}},
+		{Method: "GET", Path: "/api/admin/comic-patterns", Summary: "List custom comic filename patterns in the order they're tried (admins only)", Response: responseFields{"patterns": []models.ComicFilenamePattern{}, "count": 0}},
+		{Method: "POST", Path: "/api/admin/comic-patterns", Summary: "Add a custom comic filename pattern (admins only)", Body: "pattern, description", Status: http.StatusCreated, Response: models.ComicFilenamePattern{}},
+		{Method: "DELETE", Path: "/api/admin/comic-patterns/:id", Summary: "Remove a custom comic filename pattern (admins only)"},
+		{Method: "GET", Path: "/api/admin/content-restrictions", Summary: "List the users with a content restriction (admins only)", Response: responseFields{"restrictions": []models.ContentRestriction{}, "count": 0, "age_ratings": []string{}}},
+		{Method: "PUT", Path: "/api/admin/users/:id/content-restriction", Summary: "Set the highest age rating a user may see, or lift it (admins only)", Body: "max_age_rating (all_ages/teen/mature/adult, or empty)", Response: models.ContentRestriction{}},
+	}},
+}
+
+// routeKey identifies a route in the docs
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// documentedRoute pairs a route's docs with its group
+type documentedRoute struct {
+	routeDoc
+	Tag  string
+	Auth authMode
+}
+
+// SetRoutes records the routes registered with the router so the API docs
+// describe exactly what is served. Call it after all routes are added.
+// Paths are recorded without the base path.
+func (h *Handler) SetRoutes(routes gin.RoutesInfo) {
+	h.routes = make(gin.RoutesInfo, len(routes))
+	for i, r := range routes {
+		r.Path = strings.TrimPrefix(r.Path, h.basePath)
+		h.routes[i] = r
+	}
+}
+
+// documentedRoutes returns the registered API routes with their docs, in
+// documentation order followed by any undocumented routes
+func (h *Handler) documentedRoutes() []documentedRoute {
+	registered := make(map[string]gin.RouteInfo, len(h.routes))
+	for _, r := range h.routes {
+		if r.Path == "/health" || r.Path == "/api" || strings.HasPrefix(r.Path, "/api/") {
+			registered[routeKey(r.Method, r.Path)] = r
+		}
+	}
+
+	var result []documentedRoute
+	for _, group := range apiRoutes {
+		for _, doc := range group.Routes {
+			key := routeKey(doc.Method, doc.Path)
+			if _, ok := registered[key]; !ok {
+				continue
+			}
+			delete(registered, key)
+			result = append(result, documentedRoute{routeDoc: doc, Tag: group.Tag, Auth: group.Auth})
+		}
+	}
+
+	// Routes nobody documented yet are still listed
+	var rest []string
+	for key := range registered {
+		rest = append(rest, key)
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		r := registered[key]
+		result = append(result, documentedRoute{
+			routeDoc: routeDoc{Method: r.Method, Path: r.Path, Summary: handlerSummary(r.Handler)},
+			Tag:      "Other",
+			Auth:     authOptional,
+		})
+	}
+
+	return result
+}
+
+// handlerName returns the bare function name from a Gin handler name like
+// github.com/justyntemme/webby/internal/api.(*Handler).ListBooks-fm
+func handlerName(handler string) string {
+	name := handler[strings.LastIndex(handler, ".")+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// handlerSummary turns a handler name like ListBooks into "List books"
+func handlerSummary(handler string) string {
+	var b strings.Builder
+	for i, r := range handlerName(handler) {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte(' ')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitParams parses a Query or Body list like "page, type (book/comic)"
+// into names and descriptions
+func splitParams(list string) (names, descriptions []string) {
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, desc := part, ""
+		if i := strings.Index(part, " ("); i > 0 && strings.HasSuffix(part, ")") {
+			name, desc = part[:i], part[i+2:len(part)-1]
+		}
+		names = append(names, name)
+		descriptions = append(descriptions, desc)
+	}
+	return names, descriptions
+}
+
+// openAPIPath converts /api/books/:id/resource/*path to
+// /api/books/{id}/resource/{path} and returns the path parameter names
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID names an operation after its handler, falling back to the
+// method and path for routes that were not registered with a named handler
+func operationID(r documentedRoute, handlers map[string]string) string {
+	if name := handlers[routeKey(r.Method, r.Path)]; name != "" && !strings.HasPrefix(name, "func") {
+		return name
+	}
+	id := strings.ToLower(r.Method)
+	for _, seg := range strings.Split(r.Path, "/") {
+		seg = strings.Trim(seg, ":*{}")
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// buildOpenAPISpec generates the OpenAPI 3 document from the registered
+// routes and their docs
+func (h *Handler) buildOpenAPISpec() gin.H {
+	schemas := newSchemaRegistry()
+	handlers := make(map[string]string, len(h.routes))
+	for _, r := range h.routes {
+		handlers[routeKey(r.Method, r.Path)] = handlerName(r.Handler)
+	}
+
+	errorResponse := gin.H{
+		"description": "Error",
+		"content": gin.H{"application/json": gin.H{
+			"schema": schemas.schemaFor(reflect.TypeOf(apierror.ErrorResponse{}), nil),
+		}},
+	}
+
+	paths := gin.H{}
+	tagSeen := map[string]bool{}
+	var tags []gin.H
+
+	for _, r := range h.documentedRoutes() {
+		path, pathParams := openAPIPath(r.Path)
+
+		var params []gin.H
+		for _, name := range pathParams {
+			params = append(params, gin.H{"name": name, "in": "path", "required": true, "schema": gin.H{"type": "string"}})
+		}
+		names, descs := splitParams(r.Query)
+		for i, name := range names {
+			param := gin.H{"name": name, "in": "query", "schema": gin.H{"type": "string"}}
+			if descs[i] != "" {
+				param["description"] = descs[i]
+			}
+			params = append(params, param)
+		}
+
+		status := r.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := gin.H{"description": http.StatusText(status)}
+		switch {
+		case r.Produces != "":
+			success["content"] = gin.H{r.Produces: gin.H{"schema": gin.H{"type": "string", "format": "binary"}}}
+		case r.Response != nil:
+			success["content"] = gin.H{"application/json": gin.H{"schema": schemas.schemaFor(reflect.TypeOf(r.Response), r.Response)}}
+		default:
+			success["content"] = gin.H{"application/json": gin.H{"schema": gin.H{"type": "object"}}}
+		}
+
+		op := gin.H{
+			"operationId": operationID(r, handlers),
+			"summary":     r.Summary,
+			"tags":        []string{r.Tag},
+			"responses": gin.H{
+				strconv.Itoa(status): success,
+				"default":            errorResponse,
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if body := requestBody(r.Body); body != nil {
+			op["requestBody"] = body
+		}
+		switch r.Auth {
+		case authRequired:
+			op["security"] = []gin.H{{"bearerAuth": []string{}}}
+		case authOptional:
+			op["security"] = []gin.H{{}, {"bearerAuth": []string{}}}
+		case authSyncKey:
+			op["security"] = []gin.H{{"syncKey": []string{}}}
+		case authNone:
+			op["security"] = []gin.H{}
+		}
+
+		item, ok := paths[path].(gin.H)
+		if !ok {
+			item = gin.H{}
+			paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = op
+
+		if !tagSeen[r.Tag] {
+			tagSeen[r.Tag] = true
+			tags = append(tags, gin.H{"name": r.Tag})
+		}
+	}
+
+	spec := gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "Webby API",
+			"version":     apiVersion,
+			"description": "EPUB/PDF/CBZ library API for web and TUI clients",
+		},
+		"tags":  tags,
+		"paths": paths,
+		"components": gin.H{
+			"schemas": schemas.schemas,
+			"securitySchemes": gin.H{
+				"bearerAuth": gin.H{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"syncKey":    gin.H{"type": "apiKey", "in": "header", "name": mirror.KeyHeader},
+			},
+		},
+	}
+	// Paths are relative to the base path the server is mounted at
+	if h.basePath != "" {
+		spec["servers"] = []gin.H{{"url": h.basePath}}
+	}
+	return spec
+}
+
+// requestBody describes a Body list as a JSON object, or a multipart form
+// when the body is a file upload
+func requestBody(list string) gin.H {
+	names, descs := splitParams(list)
+	if len(names) == 0 {
+		return nil
+	}
+
+	contentType := "application/json"
+	props := gin.H{}
+	for i, name := range names {
+		prop := gin.H{}
+		if descs[i] == "multipart" {
+			contentType = "multipart/form-data"
+			prop["type"] = "string"
+			prop["format"] = "binary"
+		} else if descs[i] != "" {
+			prop["description"] = descs[i]
+		}
+		props[name] = prop
+	}
+
+	return gin.H{
+		"required": true,
+		"content": gin.H{contentType: gin.H{"schema": gin.H{
+			"type":       "object",
+			"properties": props,
+		}}},
+	}
+}
+
+// schemaRegistry converts Go types to OpenAPI schemas, collecting named
+// structs as reusable components
+type schemaRegistry struct {
+	schemas gin.H
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: gin.H{}, names: map[reflect.Type]string{}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema for a type. value is only used for responseFields,
+// whose property types come from their sample values.
+func (s *schemaRegistry) schemaFor(t reflect.Type, value any) gin.H {
+	if f, ok := value.(responseFields); ok {
+		props := gin.H{}
+		for name, v := range f {
+			if v == nil {
+				props[name] = gin.H{}
+				continue
+			}
+			props[name] = s.schemaFor(reflect.TypeOf(v), v)
+		}
+		return gin.H{"type": "object", "properties": props}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.schemaFor(t.Elem(), nil)
+		if _, isRef := schema["$ref"]; isRef {
+			return gin.H{"allOf": []gin.H{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return gin.H{"type": "string", "format": "byte"}
+		}
+		return gin.H{"type": "array", "items": s.schemaFor(t.Elem(), nil)}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": s.schemaFor(t.Elem(), nil)}
+	case reflect.Struct:
+		if t == timeType {
+			return gin.H{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + s.component(t)}
+	default:
+		return gin.H{}
+	}
+}
+
+// component registers a named struct and returns its component name.
+// Names that collide across packages are prefixed with the package name.
+func (s *schemaRegistry) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	for _, existing := range s.names {
+		if existing == name {
+			pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+			name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+			break
+		}
+	}
+
+	// Register before building so self-referencing types terminate
+	s.names[t] = name
+	s.schemas[name] = s.structSchema(t)
+	return name
+}
+
+// structSchema describes a struct's JSON fields, flattening embedded structs
+func (s *schemaRegistry) structSchema(t reflect.Type) gin.H {
+	props := gin.H{}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				collect(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = s.schemaFor(f.Type, nil)
+		}
+	}
+	collect(t)
+	return gin.H{"type": "object", "properties": props}
+}
+
+// OpenAPISpec serves the OpenAPI 3 document for the API
+func (h *Handler) OpenAPISpec(c *gin.Context) {
+	c.JSON(http.StatusOK, h.buildOpenAPISpec())
+}
+
+// APIDocs serves Swagger UI for the OpenAPI document
+func (h *Handler) APIDocs(c *gin.Context) {
+	h.servePage(c, "web/static/api-docs.html")
+}
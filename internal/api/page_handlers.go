@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+)
+
+// ==================== Web Pages ====================
+
+// pageBase is the base URL tag of the web app's pages. Their links are
+// relative to it, so pointing it at the base path moves them all.
+const pageBase = `<base href="/">`
+
+// CleanBasePath turns a configured base path like "webby/" into the prefix
+// routes are mounted under, "/webby". The root is "".
+func CleanBasePath(basePath string) string {
+	cleaned := strings.Trim(path.Clean("/"+basePath), "/")
+	if cleaned == "" {
+		return ""
+	}
+	return "/" + cleaned
+}
+
+// SetBasePath sets the path prefix the server is mounted under, such as
+// "/webby" behind a reverse proxy, for the links it generates. Call it
+// before SetRoutes.
+func (h *Handler) SetBasePath(basePath string) {
+	h.basePath = basePath
+}
+
+// baseURL is the server's URL as the client reached it, with the base path
+func (h *Handler) baseURL(c *gin.Context) string {
+	return getBaseURL(c) + h.basePath
+}
+
+// routePath is the pattern of the route a request matched, without the
+// base path, like "/api/books/:id"
+func (h *Handler) routePath(c *gin.Context) string {
+	return strings.TrimPrefix(c.FullPath(), h.basePath)
+}
+
+// ServePage serves a page of the web app
+func (h *Handler) ServePage(file string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.servePage(c, file)
+	}
+}
+
+// servePage serves an HTML page of the web app, pointing its base URL at
+// the base path when there is one
+func (h *Handler) servePage(c *gin.Context, file string) {
+	if h.basePath == "" {
+		c.File(file)
+		return
+	}
+
+	page, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Page not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read page")
+		return
+	}
+	page = bytes.Replace(page, []byte(pageBase), []byte(`<base href="`+h.basePath+`/">`), 1)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":         "",
+		"/":        "",
+		"webby":    "/webby",
+		"/webby/":  "/webby",
+		"a//b/":    "/a/b",
+		"/library": "/library",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, CleanBasePath(in), in)
+	}
+}
+
+func TestServePageUnderBasePath(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	page := filepath.Join(t.TempDir(), "index.html")
+	require.NoError(t, os.WriteFile(page, []byte(`<head><base href="/"></head><a href="auth">Sign in</a>`), 0644))
+
+	gin.SetMode(gin.TestMode)
+	get := func(basePath, path string) *httptest.ResponseRecorder {
+		handler.SetBasePath(basePath)
+		r := gin.New()
+		root := r.Group(basePath)
+		root.GET("/", handler.ServePage(page))
+		root.GET("/api/info", handler.APIInfo)
+		handler.SetRoutes(r.Routes())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("", "/")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<base href="/">`)
+
+	w = get("/webby", "/webby/")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<base href="/webby/">`, "the page's links move under the base path")
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = get("/webby", "/webby/api/info")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"openapi":"/webby/api/openapi.json"`)
+	assert.Contains(t, w.Body.String(), `"path":"/api/info"`, "routes are documented without the base path")
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== PDF Text Handlers ====================
+
+// GetPDFPageText returns the text of one page of a PDF, for text-only
+// readers and indexing. The text of every page is extracted on first
+// request and cached until the PDF's file changes. Pages of a scan have no
+// text and are flagged image_only.
+func (h *Handler) GetPDFPageText(c *gin.Context) {
+	page, err := strconv.Atoi(c.Param("page"))
+	if err != nil || page < 1 {
+		apierror.Invalid(c, "page", "Invalid page number")
+		return
+	}
+
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+	if book.FileFormat != models.FileFormatPDF {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Book is not a PDF")
+		return
+	}
+
+	// The text only changes with the file
+	etag := fileETag(book.FilePath)
+	if etag != "" {
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	pages, err := books.LoadPDFText(h.files.PDFTextPath(book.ID), book)
+	release()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to extract PDF text")
+		return
+	}
+	if page > len(pages) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodePageNotFound, "Page not found")
+		return
+	}
+
+	text := pages[page-1]
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":      book.ID,
+		"page":         text.Page,
+		"page_count":   len(pages),
+		"text":         text.Text,
+		"image_only":   text.ImageOnly,
+		"content_type": "text/plain",
+	})
+}
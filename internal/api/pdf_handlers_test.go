@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// writeTextPDF writes a single-page PDF whose page shows text in Helvetica
+func writeTextPDF(t *testing.T, text string) string {
+	content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var sb strings.Builder
+	sb.WriteString("%PDF-1.4\n")
+	var offsets []int
+	for i, obj := range objects {
+		offsets = append(offsets, sb.Len())
+		fmt.Fprintf(&sb, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := sb.Len()
+	fmt.Fprintf(&sb, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&sb, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&sb, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	path := filepath.Join(t.TempDir(), "book.pdf")
+	require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0644))
+	return path
+}
+
+func TestGetPDFPageText(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Manual", FilePath: writeTextPDF(t, "Hello PDF"),
+		FileFormat: models.FileFormatPDF, ContentType: models.ContentTypeBook, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+	epubID := setupTestBook(t, handler, userID)
+
+	get := func(id, page, ifNoneMatch string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: id}, {Key: "page", Value: page}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+id+"/pdf/text/"+page, nil)
+		c.Request.Header.Set("If-None-Match", ifNoneMatch)
+		handler.GetPDFPageText(c)
+		return w
+	}
+
+	w := get(book.ID, "1", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Page      int    `json:"page"`
+		PageCount int    `json:"page_count"`
+		Text      string `json:"text"`
+		ImageOnly bool   `json:"image_only"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Page)
+	assert.Equal(t, 1, resp.PageCount)
+	assert.Equal(t, "Hello PDF", resp.Text)
+	assert.False(t, resp.ImageOnly)
+	_, err := os.Stat(handler.files.PDFTextPath(book.ID))
+	assert.NoError(t, err, "the text is cached")
+
+	assert.Equal(t, http.StatusNotModified, get(book.ID, "1", w.Header().Get("ETag")).Code)
+	assert.Equal(t, http.StatusNotFound, get(book.ID, "2", "").Code)
+	assert.Equal(t, http.StatusBadRequest, get(book.ID, "0", "").Code)
+	assert.Equal(t, http.StatusBadRequest, get(epubID, "1", "").Code, "not a PDF")
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/barcode"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// maxCoverDownloadSize is the largest cover image fetched from a metadata provider
+const maxCoverDownloadSize = 5 * 1024 * 1024
+
+// ==================== Physical Book Handlers ====================
+
+// CreatePhysicalBook catalogs a paper book without a file. With "lookup"
+// set, missing fields (and the cover) are filled in from the ISBN's metadata.
+func (h *Handler) CreatePhysicalBook(c *gin.Context) {
+	if !h.allowUpload(c) {
+		return
+	}
+	userID := auth.GetUserID(c)
+
+	var req struct {
+		Title       string  `json:"title"`
+		Author      string  `json:"author"`
+		Series      string  `json:"series"`
+		SeriesIndex float64 `json:"series_index"`
+		ISBN        string  `json:"isbn"`
+		Publisher   string  `json:"publisher"`
+		PublishDate string  `json:"publish_date"`
+		Language    string  `json:"language"`
+		Subjects    string  `json:"subjects"`
+		Description string  `json:"description"`
+		ContentType string  `json:"content_type"`
+		Lookup      bool    `json:"lookup"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request body")
+		return
+	}
+
+	if req.ContentType == "" {
+		req.ContentType = models.ContentTypeBook
+	}
+	if req.ContentType != models.ContentTypeBook && req.ContentType != models.ContentTypeComic {
+		apierror.Invalid(c, "content_type", "Invalid content_type. Must be book or comic")
+		return
+	}
+
+	if req.ISBN != "" {
+		isbn, err := barcode.NormalizeISBN(req.ISBN)
+		if err != nil {
+			apierror.Invalid(c, "isbn", "Invalid ISBN")
+			return
+		}
+		req.ISBN = isbn
+	}
+
+	if req.Lookup && req.ISBN == "" {
+		apierror.Invalid(c, "isbn", "An ISBN is required for lookup")
+		return
+	}
+
+	bookID := uuid.New().String()
+	now := time.Now()
+	book := &models.Book{
+		ID:             bookID,
+		UserID:         userID,
+		Title:          strings.TrimSpace(req.Title),
+		Author:         strings.TrimSpace(req.Author),
+		Series:         req.Series,
+		SeriesIndex:    req.SeriesIndex,
+		ISBN:           req.ISBN,
+		Publisher:      req.Publisher,
+		PublishDate:    req.PublishDate,
+		Language:       req.Language,
+		Subjects:       req.Subjects,
+		Description:    req.Description,
+		UploadedAt:     now,
+		ContentType:    req.ContentType,
+		ContentSource:  models.ContentSourcePhysical,
+		MetadataSource: models.MetadataSourceManual,
+	}
+
+	if req.Lookup {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		meta, err := h.metadata.LookupBook(ctx, req.ISBN, "", "")
+		if err == nil && meta != nil {
+			// Fields given in the request win over looked-up metadata
+			if book.Title == "" {
+				book.Title = meta.Title
+			}
+			if book.Author == "" {
+				book.Author = strings.Join(meta.Authors, ", ")
+			}
+			if book.Publisher == "" {
+				book.Publisher = meta.Publisher
+			}
+			if book.PublishDate == "" {
+				book.PublishDate = meta.PublishDate
+			}
+			if book.Language == "" {
+				book.Language = meta.Language
+			}
+			if book.Subjects == "" {
+				book.Subjects = strings.Join(meta.Subjects, ", ")
+			}
+			if book.Description == "" {
+				book.Description = meta.Description
+			}
+			book.MetadataSource = meta.Source
+			book.MetadataUpdated = &now
+
+			if meta.CoverURL != "" {
+				if data, ext, err := fetchCover(ctx, meta.CoverURL); err == nil {
+					data, ext = books.OptimizeCover(data, ext)
+					if book.CoverPath, err = h.files.SaveCover(bookID, data, ext); err == nil {
+						book.CoverPalette = books.CoverPalette(data)
+					}
+				}
+			}
+		}
+	}
+
+	if book.Title == "" {
+		apierror.Invalid(c, "title", "Title is required")
+		return
+	}
+
+	if err := h.db.CreateBook(book); err != nil {
+		h.files.DeleteBook(bookID)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save book")
+		return
+	}
+	if userID != "" {
+		if err := h.applyVisibility(book, h.uploadVisibility(userID)); err != nil {
+			log.Printf("Warning: failed to set visibility of %s: %v", book.ID, err)
+		}
+	}
+	h.syncSubjectTags(book, userID)
+	h.recordActivity(userID, models.ActivityBookAdded, book.ID, 0)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Physical book added",
+		"book":    book,
+	})
+}
+
+// fetchCover downloads a cover image, returning its data and file extension
+func fetchCover(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("cover download failed: %s", resp.Status)
+	}
+	return readCover(resp.Body)
+}
+
+// readCover reads a downloaded cover image, returning its data and file
+// extension
+func readCover(r io.Reader) ([]byte, string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxCoverDownloadSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxCoverDownloadSize {
+		return nil, "", fmt.Errorf("cover image too large")
+	}
+
+	var ext string
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	default:
+		return nil, "", fmt.Errorf("cover is not an image")
+	}
+	return data, ext, nil
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/positions"
+)
+
+// ==================== Position Handlers ====================
+
+// StartPositionNormalization gives the reading positions and annotations
+// saved before positions had CFIs theirs, in the background, then stops
+func (h *Handler) StartPositionNormalization(ctx context.Context) {
+	go func() {
+		result, err := h.positions.NormalizeAll(ctx)
+		if err != nil {
+			log.Printf("Warning: failed to normalize reading positions: %v", err)
+			return
+		}
+		if result.Positions+result.Annotations > 0 {
+			log.Printf("Normalized %d reading positions and %d annotations to CFIs (%d couldn't be placed)",
+				result.Positions, result.Annotations, result.Failed)
+		}
+	}()
+}
+
+// respondPositionError writes the response for an error from the position
+// service
+func respondPositionError(c *gin.Context, err error, field string) {
+	switch {
+	case errors.Is(err, positions.ErrUnsupportedFormat):
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeUnsupportedFormat, "CFIs are only supported for EPUBs")
+	case errors.Is(err, positions.ErrInvalidPosition):
+		apierror.Invalid(c, field, "Position isn't in this book")
+	default:
+		log.Printf("Failed to convert position: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to convert position")
+	}
+}
+
+// GetPositionCFI converts a chapter index and either progress through the
+// chapter, from 0 to 1, or a character offset into it to a CFI, for clients
+// that record positions the first way
+func (h *Handler) GetPositionCFI(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	chapter, err := strconv.Atoi(c.Query("chapter"))
+	if err != nil {
+		apierror.Invalid(c, "chapter", "Chapter must be a chapter index")
+		return
+	}
+
+	var loc *positions.Location
+	if offset := c.Query("offset"); offset != "" {
+		n, convErr := strconv.Atoi(offset)
+		if convErr != nil {
+			apierror.Invalid(c, "offset", "Offset must be a number of characters")
+			return
+		}
+		loc, err = h.positions.FromOffset(book, chapter, n)
+	} else {
+		progress, convErr := strconv.ParseFloat(c.DefaultQuery("progress", "0"), 64)
+		if convErr != nil {
+			apierror.Invalid(c, "progress", "Progress must be a number from 0 to 1")
+			return
+		}
+		loc, err = h.positions.FromChapter(book, chapter, progress)
+	}
+	if err != nil {
+		respondPositionError(c, err, "chapter")
+		return
+	}
+
+	c.JSON(http.StatusOK, loc)
+}
+
+// ResolvePositionCFI converts a CFI, such as one from another reader, to
+// the chapter index and progress through it the web reader uses, along
+// with the CFI's canonical form
+func (h *Handler) ResolvePositionCFI(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	cfi := c.Query("cfi")
+	if cfi == "" {
+		apierror.Invalid(c, "cfi", "CFI is required")
+		return
+	}
+	loc, err := h.positions.FromCFI(book, cfi)
+	if err != nil {
+		respondPositionError(c, err, "cfi")
+		return
+	}
+
+	c.JSON(http.StatusOK, loc)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/positions"
+)
+
+// createTestEPUBBook adds an EPUB with a chapter of each body to userID's
+// library
+func createTestEPUBBook(t *testing.T, handler *Handler, userID string, bodies ...string) *models.Book {
+	epubPath := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(epubPath)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+
+	var manifest, spine strings.Builder
+	files := map[string]string{
+		"META-INF/container.xml": `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+	}
+	for i, body := range bodies {
+		id := "ch" + strconv.Itoa(i+1)
+		manifest.WriteString(`<item id="` + id + `" href="` + id + `.xhtml" media-type="application/xhtml+xml"/>`)
+		spine.WriteString(`<itemref idref="` + id + `"/>`)
+		files[id+".xhtml"] = `<html><body>` + body + `</body></html>`
+	}
+	files["content.opf"] = `<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Book</dc:title></metadata>
+  <manifest>` + manifest.String() + `</manifest>
+  <spine>` + spine.String() + `</spine>
+</package>`
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	book := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Book", FilePath: epubPath,
+		FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(book))
+	return book
+}
+
+func TestReadingPositionCFIs(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	book := createTestEPUBBook(t, handler, userID,
+		"<p>A foreword.</p>",
+		"<p>Call me Ishmael. Some years ago, never mind how long precisely.</p>")
+
+	save := func(body string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: book.ID}}
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/books/"+book.ID+"/position", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.SaveReadingPosition(c)
+		return w
+	}
+
+	// A client that only records CFIs gets the chapter and progress filled in
+	w := save(`{"cfi": "epubcfi(/6/4[ch2]!/4/2/1:17)"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	pos, err := handler.db.GetReadingPosition(book.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "1", pos.Chapter)
+	assert.Greater(t, pos.Position, 0.0)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:17)", pos.CFI)
+
+	w = save(`{"cfi": "epubcfi(/6/40!/4/2/1:0)"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a CFI outside the book")
+	w = save(`{"position": 0.5}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "neither a chapter nor a CFI")
+
+	// A position saved before CFIs gets one when it's next fetched
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: book.ID, UserID: userID, Chapter: "0"}))
+	c, w := createAuthenticatedContext(userID)
+	c.Params = []gin.Param{{Key: "id", Value: book.ID}}
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+"/position", nil)
+	handler.GetReadingPosition(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Position models.ReadingPosition `json:"position"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "epubcfi(/6/2[ch1]!/4/2/1:0)", response.Position.CFI)
+	pos, err = handler.db.GetReadingPosition(book.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, response.Position.CFI, pos.CFI, "and keeps it")
+}
+
+func TestConvertPositions(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := setupTestUser(t, handler)
+	book := createTestEPUBBook(t, handler, userID,
+		"<p>A foreword.</p>",
+		"<p>Call me Ishmael. Some years ago, never mind how long precisely.</p>")
+
+	convert := func(handle gin.HandlerFunc, path string, query url.Values) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: book.ID}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+book.ID+path+"?"+query.Encode(), nil)
+		handle(c)
+		return w
+	}
+
+	w := convert(handler.GetPositionCFI, "/cfi", url.Values{"chapter": {"1"}, "offset": {"17"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var loc positions.Location
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loc))
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:17)", loc.CFI)
+	assert.Equal(t, 1, loc.Chapter)
+
+	// A range from another reader resolves to its start
+	w = convert(handler.ResolvePositionCFI, "/cfi/resolve", url.Values{"cfi": {"epubcfi(/6/4[ch2]!/4/2,/1:17,/1:31)"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &loc))
+	assert.Equal(t, 1, loc.Chapter)
+	assert.Equal(t, 17, loc.Offset)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:17)", loc.CFI)
+
+	w = convert(handler.ResolvePositionCFI, "/cfi/resolve", url.Values{"cfi": {"not a cfi"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = convert(handler.GetPositionCFI, "/cfi", url.Values{"chapter": {"7"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,509 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/collections"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Profile Handlers ====================
+
+const (
+	// Wrong PINs allowed before leaving a profile is locked
+	profilePINMaxFailures = 5
+	// How long leaving a profile stays locked after too many wrong PINs
+	profilePINLockout = 5 * time.Minute
+)
+
+// contextProfile is the gin context key ProfileGuard stores the active
+// profile under
+const contextProfile = "webby.profile"
+
+// profileRoutes are the routes open to an account in a restricted profile:
+// finding and reading the profile's books, and leaving the profile
+var profileRoutes = map[string]bool{
+	"GET /api/auth/me":                      true,
+	"GET /api/profile":                      true,
+	"GET /api/profile/books":                true,
+	"POST /api/profile/exit":                true,
+	"GET /api/books/:id":                    true,
+	"GET /api/books/:id/cover":              true,
+	"GET /api/books/:id/file":               true,
+	"GET /api/books/:id/toc":                true,
+	"GET /api/books/:id/content/:chapter":   true,
+	"GET /api/books/:id/text/:chapter":      true,
+	"GET /api/books/:id/footnotes/:chapter": true,
+	"GET /api/books/:id/resource/*path":     true,
+	"GET /api/books/:id/cbz/info":           true,
+	"GET /api/books/:id/cbz/page/:page":     true,
+	"GET /api/books/:id/cbz/strip":          true,
+	"GET /api/books/:id/cbz/strip/:slice":   true,
+	"GET /api/books/:id/cbz/thumbnails":     true,
+	"GET /api/books/:id/pdf/text/:page":     true,
+	"GET /api/books/:id/position":           true,
+	"POST /api/books/:id/position":          true,
+}
+
+// ProfileGuard limits accounts in a restricted profile to profileRoutes,
+// and the book routes among them to the profile's books. Anything else,
+// including every OPDS route, is refused. Requests outside a profile pass
+// through untouched.
+func (h *Handler) ProfileGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth.GetProfileID(c) == "" {
+			c.Next()
+			return
+		}
+		profile, ok := h.activeProfile(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		route := strings.TrimPrefix(c.FullPath(), h.basePath)
+		if !profileRoutes[c.Request.Method+" "+route] {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeProfileRestricted, "Not available in a restricted profile")
+			return
+		}
+
+		if strings.HasPrefix(route, "/api/books/:id") {
+			books, err := h.profileBooks(profile)
+			if err != nil {
+				apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile books")
+				return
+			}
+			found := false
+			for _, book := range books {
+				if book.ID == c.Param("id") {
+					found = true
+					break
+				}
+			}
+			if !found {
+				apierror.Abort(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// activeProfile returns the profile the caller's token is for, writing an
+// error response and returning false if it no longer exists
+func (h *Handler) activeProfile(c *gin.Context) (*models.Profile, bool) {
+	if v, ok := c.Get(contextProfile); ok {
+		return v.(*models.Profile), true
+	}
+
+	profileID := auth.GetProfileID(c)
+	if profileID == "" {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeProfileNotFound, "Not in a profile")
+		return nil, false
+	}
+	profile, err := h.db.GetProfile(profileID)
+	if err == sql.ErrNoRows || (err == nil && profile.UserID != auth.GetUserID(c)) {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Profile no longer exists")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile")
+		return nil, false
+	}
+
+	c.Set(contextProfile, profile)
+	return profile, true
+}
+
+// profileBooks returns the books a profile may see: the members of its
+// collections that the account may read and that are within the profile's
+// age rating. Profiles hold a handful of collections, so each member is
+// looked up in full for its read status and rating.
+func (h *Handler) profileBooks(profile *models.Profile) ([]*models.Book, error) {
+	seen := map[string]bool{}
+	var books []*models.Book
+	for _, collectionID := range profile.CollectionIDs {
+		_, members, err := h.collections.Get(collectionID, profile.UserID)
+		if errors.Is(err, collections.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if seen[member.ID] {
+				continue
+			}
+			seen[member.ID] = true
+
+			book, err := h.db.GetBookForUser(member.ID, profile.UserID)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if h.policy.CanRead(book, profile.UserID) && models.AgeRatingAllowed(profile.MaxAgeRating, book.AgeRating) {
+				books = append(books, book)
+			}
+		}
+	}
+	return books, nil
+}
+
+// profileRequest is the body for creating or updating a profile
+type profileRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	MaxAgeRating  string   `json:"max_age_rating"`
+	CollectionIDs []string `json:"collection_ids"`
+}
+
+// bindProfile validates a profile request into profile, writing an error
+// response and returning false if it's invalid
+func (h *Handler) bindProfile(c *gin.Context, profile *models.Profile) bool {
+	var req profileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "name", "name is required")
+		return false
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		apierror.Invalid(c, "name", "name is required")
+		return false
+	}
+	max := strings.TrimSpace(req.MaxAgeRating)
+	if max != "" && !models.ValidAgeRating(max) {
+		apierror.Invalid(c, "max_age_rating", "max_age_rating must be one of: "+strings.Join(models.AgeRatings, ", ")+", or empty")
+		return false
+	}
+
+	existing, err := h.collections.List(profile.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch collections")
+		return false
+	}
+	known := make(map[string]bool, len(existing))
+	for _, collection := range existing {
+		known[collection.ID] = true
+	}
+	ids := []string{}
+	for _, id := range req.CollectionIDs {
+		if !known[id] {
+			apierror.Invalid(c, "collection_ids", "Unknown collection: "+id)
+			return false
+		}
+		ids = append(ids, id)
+	}
+
+	profile.Name = name
+	profile.MaxAgeRating = max
+	profile.CollectionIDs = ids
+	return true
+}
+
+// ownedProfile returns the caller's profile named by the :id parameter,
+// writing an error response and returning false if there is none
+func (h *Handler) ownedProfile(c *gin.Context) (*models.Profile, bool) {
+	profile, err := h.db.GetProfile(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && profile.UserID != auth.GetUserID(c)) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeProfileNotFound, "Profile not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile")
+		return nil, false
+	}
+	return profile, true
+}
+
+// ListProfiles returns the caller's restricted profiles and whether the
+// PIN for leaving them is set
+func (h *Handler) ListProfiles(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	profiles, err := h.db.ListProfiles(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profiles")
+		return
+	}
+	if profiles == nil {
+		profiles = []*models.Profile{}
+	}
+	hash, err := h.db.GetProfilePINHash(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile PIN")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": profiles,
+		"count":    len(profiles),
+		"pin_set":  hash != "",
+	})
+}
+
+// CreateProfile adds a restricted profile limited to some collections and,
+// optionally, an age rating
+func (h *Handler) CreateProfile(c *gin.Context) {
+	profile := &models.Profile{
+		ID:        uuid.New().String(),
+		UserID:    auth.GetUserID(c),
+		CreatedAt: time.Now(),
+	}
+	if !h.bindProfile(c, profile) {
+		return
+	}
+
+	if err := h.db.CreateProfile(profile); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create profile")
+		return
+	}
+
+	c.JSON(http.StatusCreated, profile)
+}
+
+// UpdateProfile replaces a profile's name, age rating, and collections
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	profile, ok := h.ownedProfile(c)
+	if !ok || !h.bindProfile(c, profile) {
+		return
+	}
+
+	if err := h.db.UpdateProfile(profile); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteProfile removes a profile. Devices still in it are signed out.
+func (h *Handler) DeleteProfile(c *gin.Context) {
+	profile, ok := h.ownedProfile(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteProfile(profile.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile deleted"})
+}
+
+// SetProfilePIN sets the PIN needed to leave a profile. The account
+// password is required so someone in a profile who learns the PIN can't
+// change it.
+func (h *Handler) SetProfilePIN(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		PIN      string `json:"pin" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "password and pin are required")
+		return
+	}
+	if !validProfilePIN(req.PIN) {
+		apierror.Invalid(c, "pin", "PIN must be 4 to 8 digits")
+		return
+	}
+
+	user, err := h.db.GetUserByID(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+	if !auth.CheckPassword(req.Password, user.PasswordHash) {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Incorrect password")
+		return
+	}
+
+	hash, err := auth.HashPassword(req.PIN)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set PIN")
+		return
+	}
+	if err := h.db.SetProfilePINHash(user.ID, hash); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set PIN")
+		return
+	}
+	h.profilePINs.reset(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile PIN set"})
+}
+
+// EnterProfile switches the account to a restricted profile, returning a
+// token limited to it. A PIN must be set first, or there'd be no way to
+// keep the profile from switching back.
+func (h *Handler) EnterProfile(c *gin.Context) {
+	profile, ok := h.ownedProfile(c)
+	if !ok {
+		return
+	}
+	hash, err := h.db.GetProfilePINHash(profile.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile PIN")
+		return
+	}
+	if hash == "" {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Set a profile PIN before entering a profile")
+		return
+	}
+
+	token, err := auth.GenerateProfileToken(profile.UserID, auth.GetUsername(c), profile.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "profile": profile})
+}
+
+// GetActiveProfile returns the profile the caller is in
+func (h *Handler) GetActiveProfile(c *gin.Context) {
+	profile, ok := h.activeProfile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// GetProfileBooks returns the books the caller's profile may read, in the
+// simplified form profiles see
+func (h *Handler) GetProfileBooks(c *gin.Context) {
+	profile, ok := h.activeProfile(c)
+	if !ok {
+		return
+	}
+	books, err := h.profileBooks(profile)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile books")
+		return
+	}
+
+	simplified := make([]models.ProfileBook, 0, len(books))
+	for _, book := range books {
+		simplified = append(simplified, models.ProfileBook{
+			ID:          book.ID,
+			Title:       book.Title,
+			Author:      book.Author,
+			Series:      book.Series,
+			SeriesIndex: book.SeriesIndex,
+			ContentType: book.ContentType,
+			FileFormat:  book.FileFormat,
+			ReadStatus:  book.ReadStatus,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"books": simplified, "count": len(simplified)})
+}
+
+// ExitProfile switches the account back out of its profile with the PIN,
+// returning an unrestricted token. Too many wrong PINs lock it for a while.
+func (h *Handler) ExitProfile(c *gin.Context) {
+	profile, ok := h.activeProfile(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		PIN string `json:"pin" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "pin", "pin is required")
+		return
+	}
+
+	if wait := h.profilePINs.locked(profile.UserID); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many wrong PINs, please try again later")
+		return
+	}
+
+	hash, err := h.db.GetProfilePINHash(profile.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch profile PIN")
+		return
+	}
+	if hash == "" || !auth.CheckPassword(req.PIN, hash) {
+		h.profilePINs.fail(profile.UserID)
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Incorrect PIN")
+		return
+	}
+	h.profilePINs.reset(profile.UserID)
+
+	token, err := auth.GenerateToken(profile.UserID, auth.GetUsername(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// validProfilePIN reports whether pin is 4 to 8 digits
+func validProfilePIN(pin string) bool {
+	if len(pin) < 4 || len(pin) > 8 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pinLimiter counts wrong profile PINs by account, locking an account out
+// of leaving its profile after too many
+type pinLimiter struct {
+	mu          sync.Mutex
+	failures    map[string]int
+	lockedUntil map[string]time.Time
+}
+
+func newPINLimiter() *pinLimiter {
+	return &pinLimiter{failures: map[string]int{}, lockedUntil: map[string]time.Time{}}
+}
+
+// locked returns how much longer userID is locked out, or 0
+func (l *pinLimiter) locked(userID string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if wait := time.Until(l.lockedUntil[userID]); wait > 0 {
+		return wait
+	}
+	delete(l.lockedUntil, userID)
+	return 0
+}
+
+// fail records a wrong PIN for userID, locking them out after too many
+func (l *pinLimiter) fail(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures[userID]++
+	if l.failures[userID] >= profilePINMaxFailures {
+		l.lockedUntil[userID] = time.Now().Add(profilePINLockout)
+		delete(l.failures, userID)
+	}
+}
+
+// reset clears userID's wrong PINs
+func (l *pinLimiter) reset(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, userID)
+	delete(l.lockedUntil, userID)
+}
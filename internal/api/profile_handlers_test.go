@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestRestrictedProfiles(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	hash, err := auth.HashPassword("secret123")
+	require.NoError(t, err)
+	parent := &models.User{ID: uuid.New().String(), Username: "parent", Email: "parent@example.com", PasswordHash: hash, CreatedAt: time.Now()}
+	require.NoError(t, handler.db.CreateUser(parent))
+
+	ids := map[string]string{}
+	for _, title := range []string{"Matilda", "The Hunger Games", "Tax Records"} {
+		book := &models.Book{ID: uuid.New().String(), UserID: parent.ID, Title: title, Author: "Author",
+			FilePath: "/tmp/" + title + ".epub", UploadedAt: time.Now(), ContentType: models.ContentTypeBook, FileFormat: models.FileFormatEPUB}
+		require.NoError(t, handler.db.CreateBook(book))
+		ids[title] = book.ID
+	}
+	require.NoError(t, handler.db.UpdateBookAgeRating(ids["Matilda"], models.AgeRatingAllAges))
+	require.NoError(t, handler.db.UpdateBookAgeRating(ids["The Hunger Games"], models.AgeRatingTeen))
+	kids, err := handler.collections.Create(parent.ID, "Kids", "", false, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, handler.collections.AddBooks(kids.ID, []string{ids["Matilda"], ids["The Hunger Games"]}))
+
+	r := gin.New()
+	api := r.Group("/api")
+	api.Use(auth.AuthMiddleware(), handler.ProfileGuard())
+	api.GET("/profiles", handler.ListProfiles)
+	api.POST("/profiles", handler.CreateProfile)
+	api.PUT("/profiles/pin", handler.SetProfilePIN)
+	api.POST("/profiles/:id/enter", handler.EnterProfile)
+	api.GET("/profile/books", handler.GetProfileBooks)
+	api.POST("/profile/exit", handler.ExitProfile)
+	api.GET("/books/:id", handler.RequireBook(authz.Read), handler.GetBook)
+	api.DELETE("/books/:id", handler.RequireBook(authz.Write), handler.DeleteBook)
+
+	call := func(token, method, path string, body gin.H) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	tokenFrom := func(w *httptest.ResponseRecorder) string {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.Token)
+		return resp.Token
+	}
+
+	parentToken, err := auth.GenerateToken(parent.ID, parent.Username)
+	require.NoError(t, err)
+
+	w := call(parentToken, http.MethodPost, "/api/profiles", gin.H{"name": "Sam", "collection_ids": []string{"missing"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "collections must exist")
+	w = call(parentToken, http.MethodPost, "/api/profiles", gin.H{"name": "Sam", "max_age_rating": models.AgeRatingAllAges, "collection_ids": []string{kids.ID}})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var profile models.Profile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+	assert.Equal(t, []string{kids.ID}, profile.CollectionIDs)
+
+	// Entering needs a PIN, and setting one needs the account password
+	w = call(parentToken, http.MethodPost, "/api/profiles/"+profile.ID+"/enter", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = call(parentToken, http.MethodPut, "/api/profiles/pin", gin.H{"password": "wrong", "pin": "1234"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = call(parentToken, http.MethodPut, "/api/profiles/pin", gin.H{"password": "secret123", "pin": "12ab"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call(parentToken, http.MethodPut, "/api/profiles/pin", gin.H{"password": "secret123", "pin": "1234"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	profileToken := tokenFrom(call(parentToken, http.MethodPost, "/api/profiles/"+profile.ID+"/enter", nil))
+
+	// The profile sees the all-ages book in its collection, simplified
+	w = call(profileToken, http.MethodGet, "/api/profile/books", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listed struct {
+		Books []map[string]interface{} `json:"books"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Books, 1)
+	assert.Equal(t, "Matilda", listed.Books[0]["title"])
+	assert.NotContains(t, listed.Books[0], "file_path")
+
+	assert.Equal(t, http.StatusOK, call(profileToken, http.MethodGet, "/api/books/"+ids["Matilda"], nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(profileToken, http.MethodGet, "/api/books/"+ids["The Hunger Games"], nil).Code, "above the profile's age rating")
+	assert.Equal(t, http.StatusNotFound, call(profileToken, http.MethodGet, "/api/books/"+ids["Tax Records"], nil).Code, "outside the profile's collections")
+
+	// Nothing else is reachable
+	w = call(profileToken, http.MethodDelete, "/api/books/"+ids["Matilda"], nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "PROFILE_RESTRICTED")
+	assert.Equal(t, http.StatusForbidden, call(profileToken, http.MethodGet, "/api/profiles", nil).Code)
+	assert.Equal(t, http.StatusForbidden, call(profileToken, http.MethodPut, "/api/profiles/pin", gin.H{"password": "secret123", "pin": "0000"}).Code)
+
+	// Leaving needs the PIN, and too many wrong ones lock it
+	assert.Equal(t, http.StatusUnauthorized, call(profileToken, http.MethodPost, "/api/profile/exit", gin.H{"pin": "9999"}).Code)
+	fullToken := tokenFrom(call(profileToken, http.MethodPost, "/api/profile/exit", gin.H{"pin": "1234"}))
+	assert.Equal(t, http.StatusOK, call(fullToken, http.MethodGet, "/api/books/"+ids["Tax Records"], nil).Code)
+
+	for i := 0; i < profilePINMaxFailures; i++ {
+		assert.Equal(t, http.StatusUnauthorized, call(profileToken, http.MethodPost, "/api/profile/exit", gin.H{"pin": "9999"}).Code)
+	}
+	w = call(profileToken, http.MethodPost, "/api/profile/exit", gin.H{"pin": "1234"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Deleting the profile signs it out
+	require.NoError(t, handler.db.DeleteProfile(profile.ID))
+	assert.Equal(t, http.StatusUnauthorized, call(profileToken, http.MethodGet, "/api/profile/books", nil).Code)
+}
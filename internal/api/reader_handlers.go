@@ -0,0 +1,312 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Reader Preference Handlers ====================
+
+// GetReaderPreferences returns the current user's reader settings
+func (h *Handler) GetReaderPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	prefs, err := h.db.GetReaderPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reader preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateReaderPreferences updates the current user's reader settings.
+// Only the fields present in the request are changed.
+func (h *Handler) UpdateReaderPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		FontFamily   *string  `json:"font_family"`
+		FontSize     *int     `json:"font_size"`
+		LineHeight   *float64 `json:"line_height"`
+		Margins      *int     `json:"margins"`
+		Theme        *string  `json:"theme"`
+		PageTurnMode *string  `json:"page_turn_mode"`
+		ComicFitMode *string  `json:"comic_fit_mode"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	prefs, err := h.db.GetReaderPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reader preferences")
+		return
+	}
+
+	if req.FontFamily != nil {
+		family := strings.TrimSpace(*req.FontFamily)
+		if family == "" || len(family) > 100 {
+			apierror.Invalid(c, "font_family", "font_family must be 1-100 characters")
+			return
+		}
+		prefs.FontFamily = family
+	}
+	if req.FontSize != nil {
+		if *req.FontSize < 8 || *req.FontSize > 72 {
+			apierror.Invalid(c, "font_size", "font_size must be between 8 and 72")
+			return
+		}
+		prefs.FontSize = *req.FontSize
+	}
+	if req.LineHeight != nil {
+		if *req.LineHeight < 1 || *req.LineHeight > 3 {
+			apierror.Invalid(c, "line_height", "line_height must be between 1.0 and 3.0")
+			return
+		}
+		prefs.LineHeight = *req.LineHeight
+	}
+	if req.Margins != nil {
+		if *req.Margins < 0 || *req.Margins > 25 {
+			apierror.Invalid(c, "margins", "margins must be between 0 and 25")
+			return
+		}
+		prefs.Margins = *req.Margins
+	}
+	if req.Theme != nil {
+		switch *req.Theme {
+		case models.ReaderThemeDay, models.ReaderThemeSepia, models.ReaderThemeNight:
+			prefs.Theme = *req.Theme
+		default:
+			apierror.Invalid(c, "theme", "Invalid theme. Must be day, sepia, or night")
+			return
+		}
+	}
+	if req.PageTurnMode != nil {
+		switch *req.PageTurnMode {
+		case models.PageTurnPaginated, models.PageTurnContinuous:
+			prefs.PageTurnMode = *req.PageTurnMode
+		default:
+			apierror.Invalid(c, "page_turn_mode", "Invalid page_turn_mode. Must be paginated or continuous")
+			return
+		}
+	}
+	if req.ComicFitMode != nil {
+		switch *req.ComicFitMode {
+		case models.ComicFitContain, models.ComicFitWidth, models.ComicFitHeight:
+			prefs.ComicFitMode = *req.ComicFitMode
+		default:
+			apierror.Invalid(c, "comic_fit_mode", "Invalid comic_fit_mode. Must be contain, width, or height")
+			return
+		}
+	}
+
+	prefs.UpdatedAt = time.Now()
+	if err := h.db.SaveReaderPreferences(prefs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save reader preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// ==================== Style Override Handlers ====================
+
+// maxStyleOverrideSize is the largest CSS override accepted
+const maxStyleOverrideSize = 64 * 1024
+
+// readerThemeColors maps reader themes to background and text colors,
+// matching the web reader
+var readerThemeColors = map[string][2]string{
+	models.ReaderThemeDay:   {"#fefefe", "#333"},
+	models.ReaderThemeSepia: {"#f4ecd8", "#5b4636"},
+	models.ReaderThemeNight: {"#1a1a1a", "#e0e0e0"},
+}
+
+// themeCSS renders reader preferences as CSS for chapter content
+func themeCSS(p *models.ReaderPreferences) string {
+	colors, ok := readerThemeColors[p.Theme]
+	if !ok {
+		colors = readerThemeColors[models.ReaderThemeDay]
+	}
+	family := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "<", "").Replace(p.FontFamily)
+
+	return fmt.Sprintf(`html, body {
+  background: %s !important;
+  color: %s !important;
+}
+body {
+  font-family: "%s", serif !important;
+  font-size: %dpx !important;
+  line-height: %g !important;
+  margin: 0 %d%% !important;
+}
+p, li, blockquote, dd, td {
+  font-size: inherit !important;
+  line-height: inherit !important;
+  font-family: inherit !important;
+}`, colors[0], colors[1], family, p.FontSize, p.LineHeight, p.Margins)
+}
+
+// chapterThemeCSS builds the CSS injected into chapters with ?apply_theme=1:
+// the user's reader theme, then their global override, then the book's
+func (h *Handler) chapterThemeCSS(userID, bookID string) (string, error) {
+	if userID == "" {
+		return themeCSS(models.DefaultReaderPreferences("")), nil
+	}
+
+	prefs, err := h.db.GetReaderPreferences(userID)
+	if err != nil {
+		return "", err
+	}
+	overrides, err := h.db.GetStyleOverridesForBook(userID, bookID)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(append([]string{themeCSS(prefs)}, overrides...), "\n\n"), nil
+}
+
+// GetGlobalStyleOverride returns the CSS the current user applies to every book
+func (h *Handler) GetGlobalStyleOverride(c *gin.Context) {
+	h.getStyleOverride(c, "")
+}
+
+// SaveGlobalStyleOverride sets the CSS the current user applies to every book
+func (h *Handler) SaveGlobalStyleOverride(c *gin.Context) {
+	h.saveStyleOverride(c, "")
+}
+
+// DeleteGlobalStyleOverride removes the current user's global CSS
+func (h *Handler) DeleteGlobalStyleOverride(c *gin.Context) {
+	h.deleteStyleOverride(c, "")
+}
+
+// GetBookStyleOverride returns the current user's CSS for one book
+func (h *Handler) GetBookStyleOverride(c *gin.Context) {
+	h.getStyleOverride(c, c.Param("id"))
+}
+
+// SaveBookStyleOverride sets the current user's CSS for one book
+func (h *Handler) SaveBookStyleOverride(c *gin.Context) {
+	h.saveStyleOverride(c, c.Param("id"))
+}
+
+// DeleteBookStyleOverride removes the current user's CSS for one book
+func (h *Handler) DeleteBookStyleOverride(c *gin.Context) {
+	h.deleteStyleOverride(c, c.Param("id"))
+}
+
+func (h *Handler) getStyleOverride(c *gin.Context, bookID string) {
+	userID, ok := h.styleOverrideUser(c, bookID)
+	if !ok {
+		return
+	}
+
+	override, err := h.db.GetStyleOverride(userID, bookID)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeStyleOverrideNotFound, "Style override not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch style override")
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+func (h *Handler) saveStyleOverride(c *gin.Context, bookID string) {
+	userID, ok := h.styleOverrideUser(c, bookID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CSS string `json:"css"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.CSS = strings.TrimSpace(req.CSS)
+	if req.CSS == "" {
+		apierror.Invalid(c, "css", "css is required")
+		return
+	}
+	if len(req.CSS) > maxStyleOverrideSize {
+		apierror.Invalid(c, "css", "CSS too large (max 64KB)")
+		return
+	}
+	if strings.Contains(strings.ToLower(req.CSS), "</style") {
+		apierror.Invalid(c, "css", "CSS must not contain </style>")
+		return
+	}
+
+	override := &models.StyleOverride{
+		UserID:    userID,
+		BookID:    bookID,
+		CSS:       req.CSS,
+		UpdatedAt: time.Now(),
+	}
+	if err := h.db.SaveStyleOverride(override); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save style override")
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+func (h *Handler) deleteStyleOverride(c *gin.Context, bookID string) {
+	userID, ok := h.styleOverrideUser(c, bookID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteStyleOverride(userID, bookID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete style override")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Style override deleted"})
+}
+
+// styleOverrideUser checks the request is authenticated and, for book
+// overrides, that the user can access the book. Writes the error response
+// and returns false otherwise.
+func (h *Handler) styleOverrideUser(c *gin.Context, bookID string) (string, bool) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return "", false
+	}
+
+	if bookID != "" {
+		if _, err := h.db.GetBookForUser(bookID, userID); err != nil {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+			return "", false
+		}
+	}
+
+	return userID, true
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Report Handlers ====================
+
+// metadataIssueKinds are the issues the metadata report can be filtered to
+var metadataIssueKinds = map[string]bool{
+	models.MetadataIssueDuplicateISBN:      true,
+	models.MetadataIssueMissingCover:       true,
+	models.MetadataIssueMissingDescription: true,
+	models.MetadataIssueSuspiciousTitle:    true,
+	models.MetadataIssueEmptyFile:          true,
+	models.MetadataIssueUnknownAuthor:      true,
+}
+
+// GetMetadataIssues lists the books in the user's library with metadata
+// worth cleaning up: duplicate ISBNs, missing covers and descriptions,
+// titles that look like file names, empty files, and unknown authors.
+// ?issue= limits the books listed to one kind; counts cover them all.
+func (h *Handler) GetMetadataIssues(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	issue := c.Query("issue")
+	if issue != "" && !metadataIssueKinds[issue] {
+		apierror.Invalid(c, "issue", "Unknown issue kind")
+		return
+	}
+
+	list, err := h.db.ListBooksForMetadataReport(userID)
+	if err != nil {
+		log.Printf("Failed to list books for metadata report: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to build metadata report")
+		return
+	}
+
+	report := books.MetadataIssues(list)
+	if issue != "" {
+		filtered := []models.ReportedBook{}
+		for _, book := range report.Books {
+			for _, kind := range book.Issues {
+				if kind == issue {
+					filtered = append(filtered, book)
+					break
+				}
+			}
+		}
+		report.Books = filtered
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Review Handlers ====================
+
+// ListMyReviews returns all reviews written by the current user
+func (h *Handler) ListMyReviews(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	reviews, err := h.db.ListReviewsByUser(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reviews")
+		return
+	}
+
+	if reviews == nil {
+		reviews = []*models.BookReview{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews": reviews,
+		"count":   len(reviews),
+	})
+}
+
+// GetMyBookReview returns the current user's review of a book
+func (h *Handler) GetMyBookReview(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	bookID := c.Param("id")
+	if _, err := h.db.GetBookForUser(bookID, userID); err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+
+	review, err := h.db.GetBookReview(bookID, userID)
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReviewNotFound, "Review not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch review")
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// SaveBookReview creates or updates the current user's review of a book
+func (h *Handler) SaveBookReview(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	bookID := c.Param("id")
+	if _, err := h.db.GetBookForUser(bookID, userID); err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+
+	var req struct {
+		Rating   float64 `json:"rating"`
+		Review   string  `json:"review"`
+		Spoiler  bool    `json:"spoiler"`
+		ReadDate string  `json:"read_date"` // YYYY-MM-DD
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	// Validate rating range (0-5) in half-star steps
+	if req.Rating < 0 || req.Rating > 5 || req.Rating*2 != math.Trunc(req.Rating*2) {
+		apierror.Invalid(c, "rating", "Rating must be between 0 and 5 in steps of 0.5")
+		return
+	}
+
+	req.Review = strings.TrimSpace(req.Review)
+	if req.Rating == 0 && req.Review == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "A rating or review is required")
+		return
+	}
+
+	var readDate *time.Time
+	if req.ReadDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.ReadDate)
+		if err != nil {
+			apierror.Invalid(c, "read_date", "Invalid read_date. Use YYYY-MM-DD")
+			return
+		}
+		readDate = &parsed
+	}
+
+	now := time.Now()
+	review := &models.BookReview{
+		ID:        uuid.New().String(),
+		BookID:    bookID,
+		UserID:    userID,
+		Rating:    req.Rating,
+		Review:    req.Review,
+		Spoiler:   req.Spoiler,
+		ReadDate:  readDate,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Keep the original ID and creation time when editing
+	if existing, err := h.db.GetBookReview(bookID, userID); err == nil {
+		review.ID = existing.ID
+		review.CreatedAt = existing.CreatedAt
+	}
+
+	if err := h.db.SaveBookReview(review); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save review")
+		return
+	}
+
+	// Keep the user's whole-star rating in sync for sorting and smart collections
+	rating := int(math.Round(req.Rating))
+	h.db.UpdateBookRating(userID, bookID, rating)
+	if rating > 0 {
+		h.recordActivity(userID, models.ActivityBookRated, bookID, rating)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Review saved",
+		"review":  review,
+	})
+}
+
+// DeleteBookReview removes the current user's review of a book
+func (h *Handler) DeleteBookReview(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	bookID := c.Param("id")
+	if _, err := h.db.GetBookReview(bookID, userID); err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReviewNotFound, "Review not found")
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch review")
+		return
+	}
+
+	if err := h.db.DeleteBookReview(bookID, userID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete review")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review deleted"})
+}
+
+// ListBookReviews returns reviews of a book from the owner and the users it is shared with
+func (h *Handler) ListBookReviews(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	bookID := c.Param("id")
+	if _, err := h.db.GetBookForUser(bookID, userID); err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+		return
+	}
+
+	reviews, err := h.db.ListHouseholdReviews(bookID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reviews")
+		return
+	}
+
+	if reviews == nil {
+		reviews = []*models.BookReview{}
+	}
+
+	// Average only counts reviews that include a rating
+	var total float64
+	var rated int
+	for _, r := range reviews {
+		if r.Rating > 0 {
+			total += r.Rating
+			rated++
+		}
+	}
+	var average float64
+	if rated > 0 {
+		average = math.Round(total/float64(rated)*10) / 10
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"book_id":        bookID,
+		"reviews":        reviews,
+		"count":          len(reviews),
+		"average_rating": average,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/opds"
+)
+
+// ==================== Sample Handlers ====================
+
+// DefaultSamplePercent is how much of a book its sample keeps
+const DefaultSamplePercent = 10
+
+// SetSamplePercent sets how much of a book, from 1 to 100 percent, its
+// sample keeps
+func (h *Handler) SetSamplePercent(percent int) {
+	h.samplePercent = percent
+}
+
+// GetBookSample serves the start of a book, so someone it's shared with or
+// who finds it in the catalog can preview it before asking for the whole
+// file. EPUBs keep the start of their text; comics and PDFs their first
+// pages, with a CBR's sent as a CBZ.
+func (h *Handler) GetBookSample(c *gin.Context) {
+	book, ok := h.authorizedBook(c, authz.Read)
+	if !ok {
+		return
+	}
+	if !requireBookFile(c, book) {
+		return
+	}
+
+	// The sample only changes with the file and the configured size
+	etag := fileETag(book.FilePath)
+	if etag != "" {
+		etag = strings.TrimSuffix(etag, `"`) + "-" + strconv.Itoa(h.samplePercent) + `"`
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "private, no-cache")
+		if etagMatches(c.GetHeader("If-None-Match"), etag) {
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+	}
+
+	release, ok := h.acquireWorker(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	format := books.SampleFormat(book.FileFormat)
+	c.Header("Content-Disposition", "inline; filename=\""+bookFileName(book)+" (sample)."+format+"\"")
+	c.Header("Content-Type", opds.GetMIMEType(format))
+	c.Status(http.StatusOK)
+
+	if err := books.WriteSample(c.Writer, h.db, book, h.samplePercent); err != nil {
+		log.Printf("Warning: writing a sample of book %s failed: %v", book.ID, err)
+		// Nothing is written until the file has been read, so this can
+		// still be reported
+		if c.Writer.Written() {
+			return
+		}
+		c.Header("Content-Disposition", "")
+		c.Header("ETag", "")
+		if errors.Is(err, books.ErrUnsupportedFormat) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Samples aren't available for this format")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read book file")
+	}
+}
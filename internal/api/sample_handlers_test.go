@@ -0,0 +1,75 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/pdf"
+)
+
+func TestGetBookSample(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetSamplePercent(50)
+
+	userID := setupTestUser(t, handler)
+	book := createTestEPUBBook(t, handler, userID, "<p>One.</p>", "<p>Two.</p>")
+	pdfBook := &models.Book{ID: uuid.New().String(), UserID: userID, Title: "Manual", FilePath: writeTextPDF(t, "Hello PDF"),
+		FileFormat: models.FileFormatPDF, ContentType: models.ContentTypeBook, UploadedAt: time.Now()}
+	require.NoError(t, handler.db.CreateBook(pdfBook))
+
+	get := func(id, ifNoneMatch string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/books/"+id+"/sample", nil)
+		c.Request.Header.Set("If-None-Match", ifNoneMatch)
+		handler.GetBookSample(c)
+		return w
+	}
+
+	w := get(book.ID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/epub+zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "(sample).epub")
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	chapters := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		chapters[f.Name] = string(data)
+	}
+	assert.Contains(t, chapters["ch1.xhtml"], "One.")
+	assert.NotContains(t, chapters["ch2.xhtml"], "Two.", "the rest of the book is left out")
+
+	assert.Equal(t, http.StatusNotModified, get(book.ID, w.Header().Get("ETag")).Code)
+	handler.SetSamplePercent(100)
+	assert.Equal(t, http.StatusOK, get(book.ID, w.Header().Get("ETag")).Code, "the sample changes with its size")
+
+	w = get(pdfBook.ID, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	samplePath := filepath.Join(t.TempDir(), "sample.pdf")
+	require.NoError(t, os.WriteFile(samplePath, w.Body.Bytes(), 0644))
+	pages, err := pdf.GetPageCount(samplePath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pages, "at least one page is kept")
+
+	assert.Equal(t, http.StatusNotFound, get(uuid.New().String(), "").Code)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/barcode"
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// maxScanImageSize is the largest barcode photo accepted by ScanBarcode
+const maxScanImageSize = 10 * 1024 * 1024
+
+// ==================== Barcode Scan Handlers ====================
+
+// ScanBarcode decodes an ISBN from a barcode photo (or a raw EAN-13/ISBN
+// string), looks up its metadata, and reports whether it's already in the library
+func (h *Handler) ScanBarcode(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	var code, source string
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		code = c.PostForm("code")
+		source = "code"
+
+		if file, header, err := c.Request.FormFile("image"); err == nil {
+			defer file.Close()
+
+			if header.Size > maxScanImageSize {
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeFileTooLarge, "Image too large (max 10MB)")
+				return
+			}
+
+			release, ok := h.acquireWorker(c)
+			if !ok {
+				return
+			}
+			decoded, err := barcode.DecodeReader(file)
+			release()
+			if err == barcode.ErrNotFound {
+				apierror.Respond(c, http.StatusUnprocessableEntity, apierror.CodeBarcodeNotFound, "No barcode found in image")
+				return
+			}
+			if err != nil {
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeUnsupportedFormat, "Unsupported or invalid image. Use JPEG, PNG, or GIF")
+				return
+			}
+			code = decoded
+			source = "image"
+		}
+	} else {
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request")
+			return
+		}
+		code = req.Code
+		source = "code"
+	}
+
+	if strings.TrimSpace(code) == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "An image or code is required")
+		return
+	}
+
+	isbn, err := barcode.NormalizeISBN(code)
+	if err != nil {
+		apierror.RespondWith(c, http.StatusBadRequest, apierror.CodeBadRequest, "Barcode is not a valid ISBN", gin.H{"barcode": code})
+		return
+	}
+	isbn10 := barcode.ISBN13To10(isbn)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	// A missing or failed lookup still lets the library check go ahead
+	result, err := h.metadata.LookupBook(ctx, isbn, "", "")
+	if err == metadata.ErrRateLimited {
+		apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
+		return
+	}
+
+	matches, err := h.db.FindBooksByISBN(userID, isbn, isbn10)
+	if err == nil {
+		matches, err = h.visibleBooks(userID, matches)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check library")
+		return
+	}
+	if matches == nil {
+		matches = []models.Book{}
+	}
+
+	// Fall back to a title match for books imported without an ISBN
+	inLibrary := len(matches) > 0
+	if !inLibrary && result != nil && result.Title != "" {
+		inLibrary, _ = h.db.HasBookWithTitle(userID, result.Title)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"isbn":       isbn,
+		"isbn10":     isbn10,
+		"source":     source,
+		"metadata":   result,
+		"in_library": inLibrary,
+		"matches":    matches,
+	})
+}
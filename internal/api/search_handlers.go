@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/search"
+)
+
+// ==================== Search Handlers ====================
+
+// Suggestions returned of each type by default, and at most
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 20
+)
+
+// suggestion is a candidate suggestion with how well it matches
+type suggestion struct {
+	models.SearchSuggestion
+	score float64
+}
+
+// GetSearchSuggestions suggests titles, authors, series, and tags matching
+// a partly typed search, for search boxes that complete as the user types.
+// Matching is as forgiving as book search; each type gives its best matches
+// first, then those with the most books.
+func (h *Handler) GetSearchSuggestions(c *gin.Context) {
+	limit := defaultSuggestions
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSuggestions {
+			apierror.Invalid(c, "limit", "limit must be between 1 and "+strconv.Itoa(maxSuggestions))
+			return
+		}
+		limit = n
+	}
+
+	query := search.NewQuery(c.Query("q"))
+	if query.Empty() {
+		c.JSON(http.StatusOK, gin.H{"suggestions": []models.SearchSuggestion{}})
+		return
+	}
+
+	userID := auth.GetUserID(c)
+	result, err := h.books.List(books.ListOptions{UserID: userID, SortBy: "title"})
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+
+	var titles []suggestion
+	authors := make(map[string]*suggestion)
+	series := make(map[string]*suggestion)
+	for _, b := range result.Books {
+		if score := query.Score(search.Field{Text: b.Title, Weight: 1}); score > 0 {
+			titles = append(titles, suggestion{models.SearchSuggestion{Type: models.SuggestionTitle, Text: b.Title, ID: b.ID}, score})
+		}
+		countSuggestion(authors, query, models.SuggestionAuthor, b.Author)
+		countSuggestion(series, query, models.SuggestionSeries, b.Series)
+	}
+
+	var tags []suggestion
+	if userID != "" {
+		userTags, err := h.db.ListTags(userID)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tags")
+			return
+		}
+		for _, tag := range userTags {
+			if score := query.Score(search.Field{Text: tag.Name, Weight: 1}); score > 0 {
+				tags = append(tags, suggestion{models.SearchSuggestion{Type: models.SuggestionTag, Text: tag.Name, ID: tag.ID, Count: tag.BookCount}, score})
+			}
+		}
+	}
+
+	suggestions := []models.SearchSuggestion{}
+	for _, group := range [][]suggestion{titles, suggestionValues(authors), suggestionValues(series), tags} {
+		suggestions = append(suggestions, bestSuggestions(group, limit)...)
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// countSuggestion counts a book toward the suggestion for an author or
+// series, if it matches the query. Names that don't match are kept as nil
+// so each is only scored once.
+func countSuggestion(seen map[string]*suggestion, query *search.Query, kind, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	key := strings.ToLower(text)
+	if s, ok := seen[key]; ok {
+		if s != nil {
+			s.Count++
+		}
+		return
+	}
+	seen[key] = nil
+	if score := query.Score(search.Field{Text: text, Weight: 1}); score > 0 {
+		seen[key] = &suggestion{models.SearchSuggestion{Type: kind, Text: text, Count: 1}, score}
+	}
+}
+
+// suggestionValues returns the matching suggestions of a map
+func suggestionValues(seen map[string]*suggestion) []suggestion {
+	var out []suggestion
+	for _, s := range seen {
+		if s != nil {
+			out = append(out, *s)
+		}
+	}
+	return out
+}
+
+// bestSuggestions returns the limit best matching suggestions, breaking
+// ties by book count and then alphabetically
+func bestSuggestions(group []suggestion, limit int) []models.SearchSuggestion {
+	sort.SliceStable(group, func(i, j int) bool {
+		a, b := group[i], group[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return strings.ToLower(a.Text) < strings.ToLower(b.Text)
+	})
+	if len(group) > limit {
+		group = group[:limit]
+	}
+	out := make([]models.SearchSuggestion, len(group))
+	for i, s := range group {
+		out[i] = s.SearchSuggestion
+	}
+	return out
+}
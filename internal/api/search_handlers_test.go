@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestGetSearchSuggestions(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	userID := setupTestUser(t, handler)
+
+	var hobbitID string
+	for _, b := range []struct{ title, author, series string }{
+		{"The Hobbit", "J.R.R. Tolkien", ""},
+		{"The Fellowship of the Ring", "J.R.R. Tolkien", "The Lord of the Rings"},
+		{"The Two Towers", "J.R.R. Tolkien", "The Lord of the Rings"},
+		{"Tolkien: A Biography", "Humphrey Carpenter", ""},
+		{"Dune", "Frank Herbert", "Dune"},
+	} {
+		book := &models.Book{
+			ID: uuid.New().String(), UserID: userID, Title: b.title, Author: b.author, Series: b.series,
+			FilePath: "/tmp/" + b.title, UploadedAt: time.Now(), ContentType: models.ContentTypeBook,
+		}
+		require.NoError(t, handler.db.CreateBook(book))
+		if b.title == "The Hobbit" {
+			hobbitID = book.ID
+		}
+	}
+	tag := &models.Tag{ID: uuid.New().String(), UserID: userID, Name: "tolkien-reread", Color: "#3b82f6"}
+	require.NoError(t, handler.db.CreateTag(tag))
+	require.NoError(t, handler.db.AddTagToBook(hobbitID, tag.ID))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/search/suggest", handler.GetSearchSuggestions)
+	get := func(query string) (int, []models.SearchSuggestion) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search/suggest"+query, nil))
+		var resp struct {
+			Suggestions []models.SearchSuggestion `json:"suggestions"`
+		}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		}
+		return w.Code, resp.Suggestions
+	}
+
+	code, suggestions := get("?q=tolkein")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []models.SearchSuggestion{
+		{Type: models.SuggestionTitle, Text: "Tolkien: A Biography", ID: suggestions[0].ID},
+		{Type: models.SuggestionAuthor, Text: "J.R.R. Tolkien", Count: 3},
+		{Type: models.SuggestionTag, Text: "tolkien-reread", ID: tag.ID, Count: 1},
+	}, suggestions)
+
+	_, suggestions = get("?q=the&limit=1")
+	require.Len(t, suggestions, 2)
+	assert.Equal(t, models.SuggestionTitle, suggestions[0].Type)
+	assert.Equal(t, models.SearchSuggestion{Type: models.SuggestionSeries, Text: "The Lord of the Rings", Count: 2}, suggestions[1])
+
+	_, suggestions = get("?q=")
+	assert.Empty(t, suggestions)
+
+	code, _ = get("?q=dune&limit=50")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,986 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// maxReadingOrderEntries limits the size of a reading order
+const maxReadingOrderEntries = 1000
+
+// ==================== Comic Series Handlers ====================
+
+// ListComicSeries returns the current user's comic series with how many
+// issues they own and have read. Series are created for every comic series
+// in the library that doesn't have one yet.
+func (h *Handler) ListComicSeries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if err := h.db.EnsureComicSeries(userID); err != nil {
+		log.Printf("Warning: Failed to create comic series: %v", err)
+	}
+
+	series, err := h.db.ListComicSeries(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series")
+		return
+	}
+
+	for _, s := range series {
+		if err := h.buildIssueChecklist(userID, s); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+			return
+		}
+		// The checklist is only returned for a single series
+		s.Issues = nil
+	}
+
+	if series == nil {
+		series = []*models.ComicSeries{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series": series,
+		"count":  len(series),
+	})
+}
+
+// CreateComicSeries adds a series, such as one the user is collecting but
+// has no issues of yet
+func (h *Handler) CreateComicSeries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Publisher   string `json:"publisher"`
+		StartYear   int    `json:"start_year"`
+		Volume      int    `json:"volume"`
+		TotalIssues int    `json:"total_issues"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Invalid(c, "name", "Name is required")
+		return
+	}
+	if req.StartYear < 0 || req.Volume < 0 || req.TotalIssues < 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "start_year, volume, and total_issues must not be negative")
+		return
+	}
+
+	if _, err := h.db.GetComicSeriesByName(userID, req.Name); err == nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "A series with this name already exists")
+		return
+	} else if err != sql.ErrNoRows {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check series")
+		return
+	}
+
+	now := time.Now()
+	series := &models.ComicSeries{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        req.Name,
+		Publisher:   strings.TrimSpace(req.Publisher),
+		StartYear:   req.StartYear,
+		Volume:      req.Volume,
+		TotalIssues: req.TotalIssues,
+		Description: strings.TrimSpace(req.Description),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := h.db.CreateComicSeries(series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create series")
+		return
+	}
+
+	if err := h.buildIssueChecklist(userID, series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+		return
+	}
+
+	c.JSON(http.StatusCreated, series)
+}
+
+// GetComicSeries returns a series with its issue checklist
+func (h *Handler) GetComicSeries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	series, ok := h.getOwnedSeries(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.buildIssueChecklist(userID, series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// UpdateComicSeries changes a series' details.
+// Only the fields present in the request are changed.
+func (h *Handler) UpdateComicSeries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	series, ok := h.getOwnedSeries(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Publisher   *string `json:"publisher"`
+		StartYear   *int    `json:"start_year"`
+		Volume      *int    `json:"volume"`
+		TotalIssues *int    `json:"total_issues"`
+		Description *string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	for _, n := range []*int{req.StartYear, req.Volume, req.TotalIssues} {
+		if n != nil && *n < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "start_year, volume, and total_issues must not be negative")
+			return
+		}
+	}
+
+	if req.Publisher != nil {
+		series.Publisher = strings.TrimSpace(*req.Publisher)
+	}
+	if req.StartYear != nil {
+		series.StartYear = *req.StartYear
+	}
+	if req.Volume != nil {
+		series.Volume = *req.Volume
+	}
+	if req.TotalIssues != nil {
+		series.TotalIssues = *req.TotalIssues
+	}
+	if req.Description != nil {
+		series.Description = strings.TrimSpace(*req.Description)
+	}
+
+	series.UpdatedAt = time.Now()
+	if err := h.db.UpdateComicSeries(series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update series")
+		return
+	}
+
+	if err := h.buildIssueChecklist(userID, series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// DeleteComicSeries deletes a series and its read marks. Its comics are
+// kept, and listing series creates it again while any are in the library.
+func (h *Handler) DeleteComicSeries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	series, ok := h.getOwnedSeries(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteComicSeries(series.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete series")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Series deleted"})
+}
+
+// RefreshComicSeries fills in a series' publisher, start year, total issues,
+// and description from ComicVine
+func (h *Handler) RefreshComicSeries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	series, ok := h.getOwnedSeries(c, userID)
+	if !ok {
+		return
+	}
+
+	if !h.comicMetadata.IsConfigured() {
+		apierror.RespondWith(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Comic metadata service not configured", gin.H{
+			"message": "Set COMICVINE_API_KEY environment variable to enable comic metadata lookup",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	result, err := h.comicMetadata.LookupSeries(ctx, series.Name)
+	if err != nil {
+		if err == metadata.ErrNoMatch {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No matching series found")
+			return
+		}
+		if err == metadata.ErrRateLimited {
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to lookup series metadata")
+		return
+	}
+
+	if result.Publisher != "" {
+		series.Publisher = result.Publisher
+	}
+	if result.StartYear > 0 {
+		series.StartYear = result.StartYear
+	}
+	if result.TotalIssues > 0 {
+		series.TotalIssues = result.TotalIssues
+	}
+	if result.Description != "" {
+		series.Description = result.Description
+	}
+	series.MetadataSource = result.Source
+	series.SourceID = result.SourceID
+	series.UpdatedAt = time.Now()
+
+	if err := h.db.UpdateComicSeries(series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update series")
+		return
+	}
+
+	if err := h.buildIssueChecklist(userID, series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// UpdateComicIssueRead marks an issue of a series read or unread. Issues in
+// the library have their read status changed; others are marked on the
+// series.
+func (h *Handler) UpdateComicIssueRead(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	series, ok := h.getOwnedSeries(c, userID)
+	if !ok {
+		return
+	}
+
+	number := comicIssueNumber(c.Param("number"))
+	if number == "" {
+		apierror.Invalid(c, "number", "Issue number is required")
+		return
+	}
+
+	var req struct {
+		Read *bool `json:"read"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+	if req.Read == nil {
+		apierror.Invalid(c, "read", "read is required")
+		return
+	}
+
+	if err := h.buildIssueChecklist(userID, series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+		return
+	}
+	var bookID string
+	for _, issue := range series.Issues {
+		if issue.Number == number {
+			bookID = issue.BookID
+		}
+	}
+
+	now := time.Now()
+	var err error
+	switch {
+	case *req.Read && bookID != "":
+		if err = h.db.UpdateBookReadStatus(userID, bookID, models.ReadStatusCompleted, &now); err == nil {
+			h.recordActivity(userID, models.ActivityBookFinished, bookID, 0)
+			h.achievements.Check(userID)
+			h.publishReadStatus(userID, bookID, models.ReadStatusCompleted, &now)
+		}
+	case *req.Read:
+		err = h.db.MarkComicIssueRead(series.ID, number, now)
+	default:
+		if bookID != "" {
+			if err = h.db.UpdateBookReadStatus(userID, bookID, models.ReadStatusUnread, nil); err == nil {
+				h.clearActivity(userID, models.ActivityBookFinished, bookID)
+				h.publishReadStatus(userID, bookID, models.ReadStatusUnread, nil)
+			}
+		}
+		if err == nil {
+			err = h.db.UnmarkComicIssueRead(series.ID, number)
+		}
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update issue")
+		return
+	}
+
+	if err := h.buildIssueChecklist(userID, series); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series issues")
+		return
+	}
+	for _, issue := range series.Issues {
+		if issue.Number == number {
+			c.JSON(http.StatusOK, issue)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, &models.ComicIssue{Number: number})
+}
+
+// ==================== Reading Order Handlers ====================
+
+// ListReadingOrders returns the current user's reading orders
+func (h *Handler) ListReadingOrders(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	orders, err := h.db.ListReadingOrders(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading orders")
+		return
+	}
+
+	if orders == nil {
+		orders = []*models.ReadingOrder{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reading_orders": orders,
+		"count":          len(orders),
+	})
+}
+
+// CreateReadingOrder starts an empty reading order
+func (h *Handler) CreateReadingOrder(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		apierror.Invalid(c, "name", "Name is required")
+		return
+	}
+
+	now := time.Now()
+	order := &models.ReadingOrder{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := h.db.CreateReadingOrder(order); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create reading order")
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// GetReadingOrder returns a reading order with its entries, showing which
+// issues are in the library and which have been read
+func (h *Handler) GetReadingOrder(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	order, ok := h.getOwnedReadingOrder(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.loadReadingOrderEntries(userID, order); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading order entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdateReadingOrder changes a reading order's name and description.
+// Only the fields present in the request are changed.
+func (h *Handler) UpdateReadingOrder(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	order, ok := h.getOwnedReadingOrder(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			apierror.Invalid(c, "name", "Name cannot be empty")
+			return
+		}
+		order.Name = name
+	}
+	if req.Description != nil {
+		order.Description = strings.TrimSpace(*req.Description)
+	}
+
+	order.UpdatedAt = time.Now()
+	if err := h.db.UpdateReadingOrder(order); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update reading order")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// DeleteReadingOrder deletes a reading order
+func (h *Handler) DeleteReadingOrder(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	order, ok := h.getOwnedReadingOrder(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteReadingOrder(order.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete reading order")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reading order deleted"})
+}
+
+// SetReadingOrderEntries replaces a reading order's issues. Entries can come
+// from any of the user's series, in any order.
+func (h *Handler) SetReadingOrderEntries(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	order, ok := h.getOwnedReadingOrder(c, userID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Entries []struct {
+			SeriesID    string `json:"series_id"`
+			IssueNumber string `json:"issue_number"`
+		} `json:"entries"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	if len(req.Entries) > maxReadingOrderEntries {
+		apierror.Invalid(c, "entries", "Maximum 1000 entries per reading order")
+		return
+	}
+
+	entries := make([]*models.ReadingOrderEntry, 0, len(req.Entries))
+	owned := map[string]bool{}
+	for _, e := range req.Entries {
+		if !owned[e.SeriesID] {
+			series, err := h.db.GetComicSeries(e.SeriesID)
+			if err != nil || series.UserID != userID {
+				apierror.Respond(c, http.StatusNotFound, apierror.CodeSeriesNotFound, "Series not found")
+				return
+			}
+			owned[e.SeriesID] = true
+		}
+
+		number := comicIssueNumber(e.IssueNumber)
+		if number == "" {
+			apierror.Invalid(c, "entries", "Every entry needs an issue_number")
+			return
+		}
+		entries = append(entries, &models.ReadingOrderEntry{SeriesID: e.SeriesID, IssueNumber: number})
+	}
+
+	if err := h.db.SetReadingOrderEntries(order.ID, entries); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save reading order entries")
+		return
+	}
+
+	order, err := h.db.GetReadingOrder(order.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading order")
+		return
+	}
+	if err := h.loadReadingOrderEntries(userID, order); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading order entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ==================== Series Helpers ====================
+
+// comicIssueNumber normalizes an issue number so "#007" and "7.0" are the
+// same issue. Non-numeric issue numbers, such as "Annual 1", are kept as is.
+func comicIssueNumber(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if n, err := strconv.ParseFloat(s, 64); err == nil && n >= 0 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return s
+}
+
+// buildIssueChecklist fills in a series' issue checklist: issues 1 to its
+// total, plus any others that are in the library or marked read. Comics
+// without an issue number aren't listed.
+func (h *Handler) buildIssueChecklist(userID string, series *models.ComicSeries) error {
+	books, err := h.db.ListComicSeriesBooks(userID, series.Name)
+	if err == nil {
+		books, err = h.visibleBooks(userID, books)
+	}
+	if err != nil {
+		return err
+	}
+	reads, err := h.db.ListComicIssueReads(series.ID)
+	if err != nil {
+		return err
+	}
+
+	byNumber := map[string]*models.ComicIssue{}
+	var issues []*models.ComicIssue
+	issue := func(number string) *models.ComicIssue {
+		if i, ok := byNumber[number]; ok {
+			return i
+		}
+		i := &models.ComicIssue{Number: number}
+		byNumber[number] = i
+		issues = append(issues, i)
+		return i
+	}
+
+	for n := 1; n <= series.TotalIssues; n++ {
+		issue(strconv.Itoa(n))
+	}
+
+	series.OwnedIssues = 0
+	for _, b := range books {
+		if b.SeriesIndex <= 0 {
+			continue
+		}
+		i := issue(strconv.FormatFloat(b.SeriesIndex, 'f', -1, 64))
+		// Duplicate copies of an issue count once
+		if i.BookID != "" {
+			continue
+		}
+		i.BookID = b.ID
+		i.Title = b.Title
+		if b.ReadStatus == models.ReadStatusCompleted {
+			i.Read = true
+			i.ReadAt = b.DateCompleted
+		}
+		series.OwnedIssues++
+	}
+
+	for number, at := range reads {
+		i := issue(number)
+		if !i.Read {
+			at := at
+			i.Read = true
+			i.ReadAt = &at
+		}
+	}
+
+	// Numbered issues in order, then the rest alphabetically
+	sort.SliceStable(issues, func(a, b int) bool {
+		na, errA := strconv.ParseFloat(issues[a].Number, 64)
+		nb, errB := strconv.ParseFloat(issues[b].Number, 64)
+		switch {
+		case errA == nil && errB == nil:
+			return na < nb
+		case errA == nil || errB == nil:
+			return errA == nil
+		}
+		return issues[a].Number < issues[b].Number
+	})
+
+	series.ReadIssues = 0
+	for _, i := range issues {
+		if i.Read {
+			series.ReadIssues++
+		}
+	}
+	series.Issues = issues
+	return nil
+}
+
+// loadReadingOrderEntries fills in a reading order's entries along with
+// whether each issue is in the library and has been read
+func (h *Handler) loadReadingOrderEntries(userID string, order *models.ReadingOrder) error {
+	entries, err := h.db.ListReadingOrderEntries(order.ID)
+	if err != nil {
+		return err
+	}
+
+	checklists := map[string]map[string]*models.ComicIssue{}
+	for _, e := range entries {
+		checklist, ok := checklists[e.SeriesID]
+		if !ok {
+			series, err := h.db.GetComicSeries(e.SeriesID)
+			if err != nil {
+				return err
+			}
+			if err := h.buildIssueChecklist(userID, series); err != nil {
+				return err
+			}
+			checklist = map[string]*models.ComicIssue{}
+			for _, i := range series.Issues {
+				checklist[i.Number] = i
+			}
+			checklists[e.SeriesID] = checklist
+		}
+
+		if i, ok := checklist[e.IssueNumber]; ok {
+			e.BookID = i.BookID
+			e.Read = i.Read
+		}
+	}
+
+	if entries == nil {
+		entries = []*models.ReadingOrderEntry{}
+	}
+	order.Entries = entries
+	order.EntryCount = len(entries)
+	return nil
+}
+
+// getOwnedSeries loads the series from the :id param and verifies the
+// current user owns it. Writes the error response and returns false if the
+// series can't be used.
+func (h *Handler) getOwnedSeries(c *gin.Context, userID string) (*models.ComicSeries, bool) {
+	series, err := h.db.GetComicSeries(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && series.UserID != userID) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeSeriesNotFound, "Series not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch series")
+		return nil, false
+	}
+	return series, true
+}
+
+// getOwnedReadingOrder loads the reading order from the :id param and
+// verifies the current user owns it. Writes the error response and returns
+// false if the reading order can't be used.
+func (h *Handler) getOwnedReadingOrder(c *gin.Context, userID string) (*models.ReadingOrder, bool) {
+	order, err := h.db.GetReadingOrder(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && order.UserID != userID) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeReadingOrderNotFound, "Reading order not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading order")
+		return nil, false
+	}
+	return order, true
+}
+
+// ==================== Story Arc Handlers ====================
+
+// SearchComicStoryArcs searches ComicVine for story arcs to import as
+// reading orders
+func (h *Handler) SearchComicStoryArcs(c *gin.Context) {
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		apierror.Invalid(c, "name", "name is required")
+		return
+	}
+
+	if !h.comicMetadata.IsConfigured() {
+		apierror.RespondWith(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Comic metadata service not configured", gin.H{
+			"message": "Set COMICVINE_API_KEY environment variable to enable comic metadata lookup",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	results, err := h.comicMetadata.SearchStoryArcs(ctx, name)
+	if err != nil {
+		if err == metadata.ErrNoMatch {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No matching story arcs found")
+			return
+		}
+		if err == metadata.ErrRateLimited {
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search story arcs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results, "count": len(results)})
+}
+
+// ImportStoryArc creates a reading order from a ComicVine story arc, adding
+// series for the arc's issues that aren't in the library yet
+func (h *Handler) ImportStoryArc(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		SourceID string `json:"source_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	arc, ok := h.fetchStoryArc(c, strings.TrimSpace(req.SourceID))
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	order := &models.ReadingOrder{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Name:           arc.Name,
+		Description:    arc.Description,
+		MetadataSource: arc.Source,
+		SourceID:       arc.SourceID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if order.Name == "" {
+		order.Name = "Story arc " + arc.SourceID
+	}
+
+	if err := h.db.CreateReadingOrder(order); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create reading order")
+		return
+	}
+	if err := h.applyStoryArc(userID, order, arc); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save reading order entries")
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// RefreshReadingOrder replaces an imported story arc's entries with the
+// arc's current issues from ComicVine. Its name and description are kept.
+func (h *Handler) RefreshReadingOrder(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	order, ok := h.getOwnedReadingOrder(c, userID)
+	if !ok {
+		return
+	}
+	if order.SourceID == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "This reading order wasn't imported from a story arc")
+		return
+	}
+
+	arc, ok := h.fetchStoryArc(c, order.SourceID)
+	if !ok {
+		return
+	}
+
+	if err := h.applyStoryArc(userID, order, arc); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save reading order entries")
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// fetchStoryArc looks up a story arc on ComicVine. Writes the error response
+// and returns false if it can't be fetched.
+func (h *Handler) fetchStoryArc(c *gin.Context, sourceID string) (*metadata.StoryArcMetadata, bool) {
+	if _, err := strconv.Atoi(sourceID); err != nil {
+		apierror.Invalid(c, "source_id", "source_id must be a ComicVine story arc ID")
+		return nil, false
+	}
+
+	if !h.comicMetadata.IsConfigured() {
+		apierror.RespondWith(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "Comic metadata service not configured", gin.H{
+			"message": "Set COMICVINE_API_KEY environment variable to enable comic metadata lookup",
+		})
+		return nil, false
+	}
+
+	// Large events take several requests to fetch
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	arc, err := h.comicMetadata.GetStoryArc(ctx, sourceID)
+	if err != nil {
+		if err == metadata.ErrNoMatch {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Story arc not found")
+			return nil, false
+		}
+		if err == metadata.ErrRateLimited {
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limited, please try again later")
+			return nil, false
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch story arc")
+		return nil, false
+	}
+	return arc, true
+}
+
+// applyStoryArc replaces a reading order's entries with a story arc's
+// issues, creating series the user doesn't have yet, and loads the result
+func (h *Handler) applyStoryArc(userID string, order *models.ReadingOrder, arc *metadata.StoryArcMetadata) error {
+	seriesIDs := map[string]string{}
+	seen := map[string]bool{}
+	var entries []*models.ReadingOrderEntry
+	for _, issue := range arc.Issues {
+		number := comicIssueNumber(issue.IssueNumber)
+		name := strings.TrimSpace(issue.Series)
+		if number == "" || name == "" {
+			continue
+		}
+
+		key := strings.ToLower(name)
+		seriesID, ok := seriesIDs[key]
+		if !ok {
+			series, err := h.db.GetComicSeriesByName(userID, name)
+			if err == sql.ErrNoRows {
+				now := time.Now()
+				series = &models.ComicSeries{
+					ID:        uuid.New().String(),
+					UserID:    userID,
+					Name:      name,
+					CreatedAt: now,
+					UpdatedAt: now,
+				}
+				err = h.db.CreateComicSeries(series)
+			}
+			if err != nil {
+				return err
+			}
+			seriesID = series.ID
+			seriesIDs[key] = seriesID
+		}
+
+		// Issues listed twice are read once, at their first position
+		if seen[seriesID+"#"+number] {
+			continue
+		}
+		seen[seriesID+"#"+number] = true
+		entries = append(entries, &models.ReadingOrderEntry{SeriesID: seriesID, IssueNumber: number})
+	}
+
+	if err := h.db.SetReadingOrderEntries(order.ID, entries); err != nil {
+		return err
+	}
+	return h.loadReadingOrderEntries(userID, order)
+}
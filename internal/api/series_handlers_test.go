@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestComicSeriesChecklist(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	otherID := createNamedUser(t, handler, "other")
+	for _, issue := range []struct {
+		id    string
+		index float64
+	}{{"saga-1", 1}, {"saga-3", 3}} {
+		id := issue.id
+		require.NoError(t, handler.db.CreateBook(&models.Book{
+			ID: id, UserID: userID, Title: id, Series: "Saga", SeriesIndex: issue.index,
+			FilePath: "/" + id + ".cbz", FileFormat: models.FileFormatCBZ, ContentType: models.ContentTypeComic, UploadedAt: time.Now(),
+		}))
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.GET("/series", handler.ListComicSeries)
+	r.POST("/series", handler.CreateComicSeries)
+	r.GET("/series/:id", handler.GetComicSeries)
+	r.PUT("/series/:id", handler.UpdateComicSeries)
+	r.PUT("/series/:id/issues/:number", handler.UpdateComicIssueRead)
+	r.POST("/reading-orders", handler.CreateReadingOrder)
+	r.GET("/reading-orders/:id", handler.GetReadingOrder)
+	r.PUT("/reading-orders/:id/entries", handler.SetReadingOrderEntries)
+	do := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	var list struct {
+		Series []models.ComicSeries `json:"series"`
+	}
+	w := do(http.MethodGet, "/series", userID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Series, 1, "series are created from the library")
+	saga := list.Series[0]
+	assert.Equal(t, 2, saga.OwnedIssues)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/series/"+saga.ID, otherID, "").Code)
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/series", userID, `{"name": "saga"}`).Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/series/"+saga.ID, userID, `{"total_issues": 4}`).Code)
+
+	// Issue 2 isn't in the library, issue 3 is
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/series/"+saga.ID+"/issues/%23002", userID, `{"read": true}`).Code)
+	w = do(http.MethodPut, "/series/"+saga.ID+"/issues/3.0", userID, `{"read": true}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"book_id":"saga-3"`)
+	status, _, err := handler.db.GetBookReadStatus(userID, "saga-3")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusCompleted, status)
+
+	var series models.ComicSeries
+	w = do(http.MethodGet, "/series/"+saga.ID, userID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	require.Len(t, series.Issues, 4)
+	var numbers []string
+	for _, issue := range series.Issues {
+		numbers = append(numbers, issue.Number)
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4"}, numbers)
+	assert.Equal(t, 2, series.ReadIssues)
+	assert.Empty(t, series.Issues[1].BookID)
+
+	w = do(http.MethodPost, "/series", userID, `{"name": "Monstress", "total_issues": 2}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var monstress models.ComicSeries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &monstress))
+
+	w = do(http.MethodPost, "/reading-orders", userID, `{"name": "Crossover"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var order models.ReadingOrder
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/reading-orders/"+order.ID+"/entries", otherID, `{"entries": []}`).Code)
+	w = do(http.MethodPut, "/reading-orders/"+order.ID+"/entries", userID,
+		`{"entries": [{"series_id": "`+saga.ID+`", "issue_number": "3"}, {"series_id": "`+monstress.ID+`", "issue_number": "1"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	require.Len(t, order.Entries, 2)
+	assert.True(t, order.Entries[0].Read)
+	assert.Equal(t, "saga-3", order.Entries[0].BookID)
+	assert.Equal(t, "Monstress", order.Entries[1].SeriesName)
+	assert.False(t, order.Entries[1].Read)
+}
+
+// fakeArcProvider serves a fixed story arc
+type fakeArcProvider struct {
+	arc metadata.StoryArcMetadata
+}
+
+func (p *fakeArcProvider) Name() string { return "fake" }
+func (p *fakeArcProvider) SearchBySeriesAndIssue(ctx context.Context, series, issueNumber string) ([]metadata.ComicMetadata, error) {
+	return nil, metadata.ErrNoMatch
+}
+func (p *fakeArcProvider) SearchByTitle(ctx context.Context, title string) ([]metadata.ComicMetadata, error) {
+	return nil, metadata.ErrNoMatch
+}
+func (p *fakeArcProvider) GetIssueDetails(ctx context.Context, sourceID string) (*metadata.ComicMetadata, error) {
+	return nil, metadata.ErrNoMatch
+}
+func (p *fakeArcProvider) SearchStoryArcs(ctx context.Context, name string) ([]metadata.StoryArcMetadata, error) {
+	return []metadata.StoryArcMetadata{p.arc}, nil
+}
+func (p *fakeArcProvider) GetStoryArc(ctx context.Context, sourceID string) (*metadata.StoryArcMetadata, error) {
+	if sourceID != p.arc.SourceID {
+		return nil, metadata.ErrNoMatch
+	}
+	arc := p.arc
+	return &arc, nil
+}
+
+func TestImportStoryArc(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.comicMetadata = metadata.NewComicService(&fakeArcProvider{arc: metadata.StoryArcMetadata{
+		Name: "Infinity Gauntlet", Source: "fake", SourceID: "42",
+		Issues: []metadata.ComicMetadata{
+			{Series: "Infinity Gauntlet", IssueNumber: "1"},
+			{Series: "Silver Surfer", IssueNumber: "50"},
+			{Series: "infinity gauntlet", IssueNumber: "2"},
+			{Series: "Silver Surfer", IssueNumber: "50"},
+		},
+	}})
+
+	userID := createNamedUser(t, handler, "reader")
+	require.NoError(t, handler.db.CreateBook(&models.Book{
+		ID: "surfer-50", UserID: userID, Title: "Silver Surfer #50", Series: "Silver Surfer", SeriesIndex: 50,
+		FilePath: "/surfer-50.cbz", FileFormat: models.FileFormatCBZ, ContentType: models.ContentTypeComic, UploadedAt: time.Now(),
+	}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.POST("/reading-orders/arcs", handler.ImportStoryArc)
+	r.POST("/reading-orders/:id/refresh", handler.RefreshReadingOrder)
+	r.GET("/opds/v1.2/reading-orders/:id", handler.OPDSReadingOrderBooks)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/reading-orders/arcs", `{"source_id": "7"}`).Code)
+
+	w := do(http.MethodPost, "/reading-orders/arcs", `{"source_id": "42"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var order models.ReadingOrder
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	assert.Equal(t, "Infinity Gauntlet", order.Name)
+	assert.Equal(t, "42", order.SourceID)
+	require.Len(t, order.Entries, 3, "repeated issues are listed once")
+	assert.Equal(t, order.Entries[0].SeriesID, order.Entries[2].SeriesID, "series names match ignoring case")
+	assert.Equal(t, "surfer-50", order.Entries[1].BookID)
+
+	series, err := handler.db.ListComicSeries(userID)
+	require.NoError(t, err)
+	assert.Len(t, series, 2, "missing series are added")
+
+	w = do(http.MethodPost, "/reading-orders/"+order.ID+"/refresh", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"entry_count":3`)
+
+	w = do(http.MethodGet, "/opds/v1.2/reading-orders/"+order.ID+".xml", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Silver Surfer #50")
+	assert.Equal(t, 1, strings.Count(w.Body.String(), "<entry>"), "only issues in the library are listed")
+}
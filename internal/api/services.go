@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/annotations"
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/collections"
+)
+
+// ==================== Service Errors ====================
+
+// respondServiceError maps an error from the book, collection, or
+// annotation service to an API error. Anything unrecognized is a 500 with
+// the given message.
+func respondServiceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, books.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeBookNotFound, "Book not found")
+	case errors.Is(err, collections.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeCollectionNotFound, "Collection not found")
+	case errors.Is(err, collections.ErrParentCycle):
+		apierror.Invalid(c, "parent_id", "A collection can't be nested in itself or its subcollections")
+	case errors.Is(err, collections.ErrSmartCollection):
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Smart collections are ordered by title and can't be reordered")
+	case errors.Is(err, annotations.ErrNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeAnnotationNotFound, "Annotation not found")
+	case errors.Is(err, annotations.ErrNoteNotFound):
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNoteNotFound, "Note not found")
+	case errors.Is(err, books.ErrForbidden), errors.Is(err, annotations.ErrForbidden):
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+	case errors.Is(err, annotations.ErrInvalidColor):
+		apierror.Invalid(c, "color", "Invalid highlight color. Use: yellow, green, blue, pink, or orange")
+	case errors.Is(err, annotations.ErrInvalidVisibility):
+		apierror.Invalid(c, "visibility", "Invalid visibility. Use: private or shared")
+	case errors.Is(err, annotations.ErrEmptyNote):
+		apierror.Invalid(c, "body", "Note body cannot be empty")
+	case errors.Is(err, annotations.ErrInvalidCitationStyle):
+		apierror.Invalid(c, "style", "Invalid citation style. Use: apa, mla, or chicago")
+	default:
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, message)
+	}
+}
+
+// collectionRule is a smart collection rule in a request body
+type collectionRule struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// collectionRules converts request rules for the collection service
+func collectionRules(rules []collectionRule) []collections.Rule {
+	out := make([]collections.Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, collections.Rule{Field: r.Field, Operator: r.Operator, Value: r.Value})
+	}
+	return out
+}
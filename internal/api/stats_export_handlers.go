@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+)
+
+// ==================== Stats Export Handlers ====================
+
+// statsExportSession is a reading session in a stats export. Times are in
+// the user's stats timezone.
+type statsExportSession struct {
+	ID              string `json:"id"`
+	BookID          string `json:"book_id"`
+	BookTitle       string `json:"book_title"`
+	BookAuthor      string `json:"book_author"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time,omitempty"` // Empty while in progress
+	DurationSeconds int    `json:"duration_seconds"`
+	PausedSeconds   int    `json:"paused_seconds"`
+	PagesRead       int    `json:"pages_read"`
+	ChaptersRead    int    `json:"chapters_read"`
+}
+
+// statsExportDay is one day's totals in a stats export
+type statsExportDay struct {
+	Date         string `json:"date"`
+	PagesRead    int    `json:"pages_read"`
+	ChaptersRead int    `json:"chapters_read"`
+	TimeSeconds  int    `json:"time_seconds"`
+	BooksTouched int    `json:"books_touched"`
+}
+
+// ExportStats returns the current user's reading sessions and daily totals
+// between two dates, inclusive, as JSON or as CSV for spreadsheets. Dates
+// are days in the user's stats timezone; without from everything up to to
+// is exported, and to defaults to today. A CSV holds one table, chosen with
+// data=sessions (the default) or data=daily.
+func (h *Handler) ExportStats(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		apierror.Invalid(c, "format", "Invalid format. Must be json or csv")
+		return
+	}
+	data := c.DefaultQuery("data", "sessions")
+	if data != "sessions" && data != "daily" {
+		apierror.Invalid(c, "data", "Invalid data. Must be sessions or daily")
+		return
+	}
+
+	loc := h.db.UserLocation(userID)
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if s := c.Query("to"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			apierror.Invalid(c, "to", "to must be a date like 2026-01-31")
+			return
+		}
+		to = t
+	}
+	var from time.Time
+	if s := c.Query("from"); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			apierror.Invalid(c, "from", "from must be a date like 2026-01-01")
+			return
+		}
+		if t.After(to) {
+			apierror.Invalid(c, "from", "from must not be after to")
+			return
+		}
+		from = t
+	}
+
+	sessions, err := h.db.GetAllReadingSessions(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch reading sessions")
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+	exportSessions := make([]statsExportSession, 0, len(sessions))
+	for _, s := range sessions {
+		if s.StartTime.Before(from) || !s.StartTime.Before(end) {
+			continue
+		}
+		row := statsExportSession{
+			ID:              s.ID,
+			BookID:          s.BookID,
+			BookTitle:       s.BookTitle,
+			BookAuthor:      s.BookAuthor,
+			StartTime:       s.StartTime.In(loc).Format(time.RFC3339),
+			DurationSeconds: s.DurationSeconds,
+			PausedSeconds:   s.PausedSeconds,
+			PagesRead:       s.PagesRead,
+			ChaptersRead:    s.ChaptersRead,
+		}
+		if s.EndTime != nil {
+			row.EndTime = s.EndTime.In(loc).Format(time.RFC3339)
+		}
+		exportSessions = append(exportSessions, row)
+	}
+
+	daily, err := h.db.GetDailyReadingStats(userID, from, to)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get daily stats")
+		return
+	}
+	exportDays := make([]statsExportDay, 0, len(daily))
+	for _, d := range daily {
+		exportDays = append(exportDays, statsExportDay{
+			Date:         d.ReadingDate.Format("2006-01-02"),
+			PagesRead:    d.PagesRead,
+			ChaptersRead: d.ChaptersRead,
+			TimeSeconds:  d.TimeSeconds,
+			BooksTouched: d.BooksTouched,
+		})
+	}
+
+	fromStr := ""
+	if !from.IsZero() {
+		fromStr = from.Format("2006-01-02")
+	}
+	toStr := to.Format("2006-01-02")
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"from":     fromStr,
+			"to":       toStr,
+			"timezone": loc.String(),
+			"sessions": exportSessions,
+			"daily":    exportDays,
+		})
+		return
+	}
+
+	var rows [][]string
+	if data == "sessions" {
+		rows = append(rows, []string{"session_id", "book_id", "book_title", "book_author", "start_time", "end_time",
+			"duration_seconds", "paused_seconds", "pages_read", "chapters_read"})
+		for _, s := range exportSessions {
+			rows = append(rows, []string{s.ID, s.BookID, csvText(s.BookTitle), csvText(s.BookAuthor), s.StartTime, s.EndTime,
+				strconv.Itoa(s.DurationSeconds), strconv.Itoa(s.PausedSeconds), strconv.Itoa(s.PagesRead), strconv.Itoa(s.ChaptersRead)})
+		}
+	} else {
+		rows = append(rows, []string{"date", "pages_read", "chapters_read", "time_seconds", "books_touched"})
+		for _, d := range exportDays {
+			rows = append(rows, []string{d.Date, strconv.Itoa(d.PagesRead), strconv.Itoa(d.ChaptersRead),
+				strconv.Itoa(d.TimeSeconds), strconv.Itoa(d.BooksTouched)})
+		}
+	}
+
+	name := "webby-reading-" + data + "-" + toStr + ".csv"
+	if fromStr != "" {
+		name = "webby-reading-" + data + "-" + fromStr + "-to-" + toStr + ".csv"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	// Rows are already in memory, so a write error only means the client
+	// went away
+	csv.NewWriter(c.Writer).WriteAll(rows)
+}
+
+// csvText keeps spreadsheets from treating text such as a book title as a
+// formula by prefixing an apostrophe when it starts with one of their
+// formula characters
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestExportStats(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	require.NoError(t, handler.db.SaveStatsPreferences(&models.StatsPreferences{UserID: userID, Timezone: "UTC", UpdatedAt: time.Now()}))
+	require.NoError(t, handler.db.CreateBook(&models.Book{ID: "book", UserID: userID, Title: "=Formula", Author: "Author",
+		FilePath: "/book", UploadedAt: time.Now()}))
+
+	for _, day := range []int{3, 10, 20} {
+		start := time.Date(2026, 1, day, 21, 0, 0, 0, time.UTC)
+		end := start.Add(30 * time.Minute)
+		session := &models.ReadingSession{ID: strconv.Itoa(day), UserID: userID, BookID: "book", StartTime: start, CreatedAt: start}
+		require.NoError(t, handler.db.CreateReadingSession(session))
+		session.EndTime = &end
+		session.DurationSeconds = 1800
+		session.PagesRead = 10
+		require.NoError(t, handler.db.FinishReadingSession(session))
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/stats/export", handler.ExportStats)
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/stats/export?"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("from=2026-01-05&to=2026-01-20")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Timezone string               `json:"timezone"`
+		Sessions []statsExportSession `json:"sessions"`
+		Daily    []statsExportDay     `json:"daily"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "UTC", resp.Timezone)
+	require.Len(t, resp.Sessions, 2, "the last day is included")
+	assert.Equal(t, "=Formula", resp.Sessions[0].BookTitle)
+	assert.Equal(t, "2026-01-10T21:00:00Z", resp.Sessions[0].StartTime)
+	require.Len(t, resp.Daily, 2)
+	assert.Equal(t, "2026-01-10", resp.Daily[0].Date)
+	assert.Equal(t, 1800, resp.Daily[0].TimeSeconds)
+
+	w = get("format=csv&to=2026-01-10")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+	rows, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, "book_title", rows[0][2])
+	assert.Equal(t, "'=Formula", rows[1][2], "titles can't run as formulas")
+	assert.Equal(t, "1800", rows[1][6])
+
+	w = get("format=csv&data=daily")
+	require.Equal(t, http.StatusOK, w.Code)
+	rows, err = csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, []string{"2026-01-03", "10", "0", "1800", "1"}, rows[1])
+
+	assert.Equal(t, http.StatusBadRequest, get("format=xml").Code)
+	assert.Equal(t, http.StatusBadRequest, get("from=2026-02-01&to=2026-01-01").Code)
+	assert.Equal(t, http.StatusBadRequest, get("from=yesterday").Code)
+}
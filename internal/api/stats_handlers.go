@@ -1,23 +1,72 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/justyntemme/webby/internal/apierror"
 	"github.com/justyntemme/webby/internal/auth"
 	"github.com/justyntemme/webby/internal/models"
 )
 
+// DefaultSessionIdleTimeout is the gap between reading session heartbeats
+// past which the reader is taken to have been idle
+const DefaultSessionIdleTimeout = 10 * time.Minute
+
+// SetSessionIdleTimeout sets the gap between reading session heartbeats past
+// which the time isn't counted as reading. Zero counts every gap.
+func (h *Handler) SetSessionIdleTimeout(timeout time.Duration) {
+	h.sessionIdleTimeout = timeout
+}
+
+// StartSessionSweeper periodically ends reading sessions older than maxAge that
+// were never ended (e.g. the reader tab was closed), so they count towards stats
+// and stop shadowing new sessions for the same book
+func (h *Handler) StartSessionSweeper(ctx context.Context, maxAge time.Duration) {
+	interval := maxAge / 4
+	if interval > 15*time.Minute || interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			closed, err := h.db.CloseStaleReadingSessions(time.Now().Add(-maxAge))
+			if err != nil {
+				log.Printf("Warning: failed to close stale reading sessions: %v", err)
+			} else if closed > 0 {
+				log.Printf("Closed %d stale reading sessions", closed)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
 // StartReadingSession starts a new reading session
 func (h *Handler) StartReadingSession(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if !h.trackingAllowed(c, userID) {
 		return
 	}
 
@@ -25,7 +74,7 @@ func (h *Handler) StartReadingSession(c *gin.Context) {
 		BookID string `json:"book_id" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		apierror.BindFailed(c, err, "Invalid request")
 		return
 	}
 
@@ -47,7 +96,7 @@ func (h *Handler) StartReadingSession(c *gin.Context) {
 	}
 
 	if err := h.db.CreateReadingSession(session); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to start session")
 		return
 	}
 
@@ -58,7 +107,11 @@ func (h *Handler) StartReadingSession(c *gin.Context) {
 func (h *Handler) EndReadingSession(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if !h.trackingAllowed(c, userID) {
 		return
 	}
 
@@ -78,83 +131,149 @@ func (h *Handler) EndReadingSession(c *gin.Context) {
 	session, err := h.db.GetActiveReadingSession(userID, sessionID)
 	if err != nil {
 		// Try to find by session ID in case bookID was passed
-		c.JSON(http.StatusNotFound, gin.H{"error": "Active session not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeSessionNotFound, "Active session not found")
 		return
 	}
 
-	// Calculate duration
-	endTime := time.Now()
-	duration := int(endTime.Sub(session.StartTime).Seconds())
+	if !h.validPagesRead(c, session.BookID, req.PagesRead) {
+		return
+	}
 
-	session.EndTime = &endTime
+	// Duration leaves out time paused or idle
+	session.Finish(time.Now(), h.sessionIdleTimeout)
 	session.PagesRead = req.PagesRead
 	session.ChaptersRead = req.ChaptersRead
-	session.DurationSeconds = duration
 
-	if err := h.db.UpdateReadingSession(session); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end session"})
+	if err := h.db.FinishReadingSession(session); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to end session")
 		return
 	}
-
-	// Update daily stats
-	h.db.UpdateDailyStats(userID, time.Now(), req.PagesRead, req.ChaptersRead, duration, session.BookID)
-
-	// Update user statistics
-	stats, _ := h.db.GetOrCreateUserStatistics(userID)
-	if stats != nil {
-		stats.TotalPagesRead += req.PagesRead
-		stats.TotalChaptersRead += req.ChaptersRead
-		stats.TotalTimeSeconds += duration
-		now := time.Now()
-		stats.LastReadingDate = &now
-
-		// Update streak
-		current, longest, _ := h.db.CalculateStreak(userID)
-		stats.CurrentStreak = current
-		if longest > stats.LongestStreak {
-			stats.LongestStreak = longest
-		}
-
-		// Update completed books count
-		completedCount, _ := h.db.GetCompletedBooksCount(userID)
-		stats.TotalBooksRead = completedCount
-
-		h.db.UpdateUserStatistics(stats)
-	}
+	h.achievements.Check(userID)
 
 	c.JSON(http.StatusOK, session)
 }
 
-// UpdateReadingSessionProgress updates an active reading session's progress
+// UpdateReadingSessionProgress updates an active reading session's progress.
+// Each call is also a heartbeat: it resumes a paused session, and a gap
+// since the last one longer than the idle timeout isn't counted as reading.
+// Only the fields present in the request are changed.
 func (h *Handler) UpdateReadingSessionProgress(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
-	bookID := c.Param("bookId")
+	if !h.trackingAllowed(c, userID) {
+		return
+	}
+
+	bookID := c.Param("id")
 
 	var req struct {
-		PagesRead    int `json:"pages_read"`
-		ChaptersRead int `json:"chapters_read"`
+		PagesRead    *int `json:"pages_read"`
+		ChaptersRead *int `json:"chapters_read"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		apierror.BindFailed(c, err, "Invalid request")
 		return
 	}
 
 	session, err := h.db.GetActiveReadingSession(userID, bookID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active session found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No active session found")
 		return
 	}
 
-	session.PagesRead = req.PagesRead
-	session.ChaptersRead = req.ChaptersRead
+	if req.PagesRead != nil && !h.validPagesRead(c, bookID, *req.PagesRead) {
+		return
+	}
+
+	session.Heartbeat(time.Now(), h.sessionIdleTimeout)
+	if req.PagesRead != nil {
+		session.PagesRead = *req.PagesRead
+	}
+	if req.ChaptersRead != nil {
+		session.ChaptersRead = *req.ChaptersRead
+	}
+
+	if err := h.db.UpdateReadingSession(session); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update session")
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// trackingAllowed reports whether the user's reading may be recorded,
+// writing a TRACKING_DISABLED error if they're in privacy mode
+func (h *Handler) trackingAllowed(c *gin.Context, userID string) bool {
+	if h.db.InPrivacyMode(userID) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeTrackingDisabled, "Reading tracking is turned off in privacy mode")
+		return false
+	}
+	return true
+}
+
+// validPagesRead reports whether pages is a possible number of pages read
+// in a session of the book, writing a validation error if not. Any number
+// is accepted while the book's page count isn't known.
+func (h *Handler) validPagesRead(c *gin.Context, bookID string, pages int) bool {
+	if pages < 0 {
+		apierror.Invalid(c, "pages_read", "pages_read can't be negative")
+		return false
+	}
+	_, pageCount, _, err := h.db.GetBookStructure(bookID)
+	if err == nil && pageCount > 0 && pages > pageCount {
+		apierror.Invalid(c, "pages_read", fmt.Sprintf("pages_read can't be more than the book's %d pages", pageCount))
+		return false
+	}
+	return true
+}
+
+// PauseReadingSession stops the clock of the current user's active session
+// for a book, such as when the reader is hidden. Pausing a paused session
+// changes nothing.
+func (h *Handler) PauseReadingSession(c *gin.Context) {
+	h.changeReadingSession(c, func(session *models.ReadingSession, now time.Time) {
+		session.Pause(now)
+	})
+}
+
+// ResumeReadingSession restarts the clock of the current user's paused
+// session for a book. Resuming a running session changes nothing.
+func (h *Handler) ResumeReadingSession(c *gin.Context) {
+	h.changeReadingSession(c, func(session *models.ReadingSession, now time.Time) {
+		session.Resume(now)
+	})
+}
+
+// changeReadingSession applies change to the current user's active session
+// for the book in the :id param, saves it, and responds with it
+func (h *Handler) changeReadingSession(c *gin.Context, change func(session *models.ReadingSession, now time.Time)) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if !h.trackingAllowed(c, userID) {
+		return
+	}
+
+	session, err := h.db.GetActiveReadingSession(userID, c.Param("id"))
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeSessionNotFound, "Active session not found")
+		return
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch session")
+		return
+	}
 
+	change(session, time.Now())
 	if err := h.db.UpdateReadingSession(session); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update session"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update session")
 		return
 	}
 
@@ -165,13 +284,13 @@ func (h *Handler) UpdateReadingSessionProgress(c *gin.Context) {
 func (h *Handler) GetUserStatistics(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	stats, err := h.db.GetOrCreateUserStatistics(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statistics"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get statistics")
 		return
 	}
 
@@ -191,7 +310,7 @@ func (h *Handler) GetUserStatistics(c *gin.Context) {
 func (h *Handler) GetDailyStats(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -205,12 +324,13 @@ func (h *Handler) GetDailyStats(c *gin.Context) {
 		days = 365
 	}
 
-	endDate := time.Now()
+	// Days are counted in the user's timezone
+	endDate := time.Now().In(h.db.UserLocation(userID))
 	startDate := endDate.AddDate(0, 0, -days)
 
 	stats, err := h.db.GetDailyReadingStats(userID, startDate, endDate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get daily stats"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get daily stats")
 		return
 	}
 
@@ -245,11 +365,103 @@ func (h *Handler) GetDailyStats(c *gin.Context) {
 	c.JSON(http.StatusOK, fullStats)
 }
 
+// GetStatsPreferences returns the timezone the current user's stats count
+// days in
+func (h *Handler) GetStatsPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	prefs, err := h.db.GetStatsPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch stats preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateStatsPreferences sets the timezone the current user's stats count
+// days in, and privacy mode. Daily stats already recorded keep the day they
+// were counted on. Turning privacy mode on discards sessions in progress;
+// what was recorded before stays until the user purges it.
+func (h *Handler) UpdateStatsPreferences(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Timezone    *string `json:"timezone"`
+		PrivacyMode *bool   `json:"privacy_mode"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	prefs, err := h.db.GetStatsPreferences(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch stats preferences")
+		return
+	}
+
+	if req.Timezone != nil {
+		timezone := strings.TrimSpace(*req.Timezone)
+		// "Local" would silently follow the server
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			apierror.Invalid(c, "timezone", "timezone must be an IANA timezone name, such as America/New_York, or empty")
+			return
+		}
+		prefs.Timezone = timezone
+	}
+	enteringPrivacy := false
+	if req.PrivacyMode != nil {
+		enteringPrivacy = *req.PrivacyMode && !prefs.PrivacyMode
+		prefs.PrivacyMode = *req.PrivacyMode
+	}
+
+	prefs.UpdatedAt = time.Now()
+	if err := h.db.SaveStatsPreferences(prefs); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save stats preferences")
+		return
+	}
+	if enteringPrivacy {
+		if err := h.db.DiscardActiveReadingSessions(userID); err != nil {
+			log.Printf("Warning: failed to discard reading sessions of user %s: %v", userID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// PurgeReadingHistory deletes the current user's reading sessions, daily
+// and overall reading stats, and published activity. Reading positions,
+// statuses, and achievements already earned are kept.
+func (h *Handler) PurgeReadingHistory(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	if err := h.db.PurgeReadingHistory(userID); err != nil {
+		log.Printf("Failed to purge reading history of user %s: %v", userID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete reading history")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reading history deleted"})
+}
+
 // GetRecentSessions returns recent reading sessions
 func (h *Handler) GetRecentSessions(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -264,18 +476,68 @@ func (h *Handler) GetRecentSessions(c *gin.Context) {
 
 	sessions, err := h.db.GetRecentReadingSessions(userID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get sessions")
 		return
 	}
 
 	c.JSON(http.StatusOK, sessions)
 }
 
+// GetMemories returns the books the user finished and the highlights they
+// made on this calendar date, in their timezone, in earlier years. date
+// (YYYY-MM-DD) asks for another day, such as the client's local date.
+func (h *Handler) GetMemories(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	day := time.Now().In(h.db.UserLocation(userID))
+	if v := c.Query("date"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			apierror.Invalid(c, "date", "Invalid date. Use YYYY-MM-DD")
+			return
+		}
+		day = parsed
+	}
+
+	memories, err := h.db.GetMemories(userID, memoryDays(day), day.Year())
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get memories")
+		return
+	}
+	for i := range memories {
+		memories[i].YearsAgo = day.Year() - memories[i].Date.Year()
+	}
+	if memories == nil {
+		memories = []models.Memory{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":     day.Format("2006-01-02"),
+		"memories": memories,
+		"count":    len(memories),
+	})
+}
+
+// memoryDays returns the "MM-DD" dates whose memories show on day. In years
+// without a February 29th, its memories show on the 28th.
+func memoryDays(day time.Time) []string {
+	days := []string{day.Format("01-02")}
+	leap := time.Date(day.Year(), time.February, 29, 0, 0, 0, 0, time.UTC).Month() == time.February
+	if day.Month() == time.February && day.Day() == 28 && !leap {
+		days = append(days, "02-29")
+	}
+	return days
+}
+
 // GetBookReadingStats returns reading statistics for a specific book
 func (h *Handler) GetBookReadingStats(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
@@ -283,7 +545,7 @@ func (h *Handler) GetBookReadingStats(c *gin.Context) {
 
 	totalTime, pagesRead, sessionsCount, err := h.db.GetReadingStatsForBook(userID, bookID)
 	if err != nil && err != sql.ErrNoRows {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get book stats"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get book stats")
 		return
 	}
 
@@ -312,13 +574,13 @@ func (h *Handler) GetBookReadingStats(c *gin.Context) {
 func (h *Handler) GetStatsSummary(c *gin.Context) {
 	userID := auth.GetUserID(c)
 	if userID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
 		return
 	}
 
 	stats, err := h.db.GetOrCreateUserStatistics(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statistics"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get statistics")
 		return
 	}
 
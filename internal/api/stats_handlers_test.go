@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestReadingSessionPauseAndIdle(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	now := time.Now()
+	for _, id := range []string{"book", "other"} {
+		require.NoError(t, handler.db.CreateBook(&models.Book{ID: id, UserID: userID, Title: id, FilePath: "/" + id, UploadedAt: now}))
+	}
+
+	// Opened two hours ago and left
+	start := now.Add(-2 * time.Hour)
+	require.NoError(t, handler.db.CreateReadingSession(&models.ReadingSession{
+		ID: "session", UserID: userID, BookID: "book", StartTime: start, CreatedAt: start,
+	}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.PUT("/books/:id/reading-session", handler.UpdateReadingSessionProgress)
+	r.POST("/books/:id/reading-session/pause", handler.PauseReadingSession)
+	r.POST("/books/:id/reading-session/resume", handler.ResumeReadingSession)
+	r.PUT("/stats/sessions/:id", handler.EndReadingSession)
+	do := func(method, path, body string) models.ReadingSession {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var session models.ReadingSession
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+		return session
+	}
+
+	// The first heartbeat leaves the idle gap out
+	session := do(http.MethodPut, "/books/book/reading-session", `{"pages_read":5}`)
+	assert.InDelta(t, 7200, session.PausedSeconds, 2)
+	require.NotNil(t, session.LastActiveAt)
+	session = do(http.MethodPut, "/books/book/reading-session", `{}`)
+	assert.Equal(t, 5, session.PagesRead, "a plain heartbeat keeps progress")
+
+	session = do(http.MethodPost, "/books/book/reading-session/pause", "")
+	require.NotNil(t, session.PausedAt)
+	paused := *session.PausedAt
+	session = do(http.MethodPost, "/books/book/reading-session/pause", "")
+	assert.True(t, paused.Equal(*session.PausedAt), "pausing again changes nothing")
+	session = do(http.MethodPost, "/books/book/reading-session/resume", "")
+	assert.Nil(t, session.PausedAt)
+
+	session = do(http.MethodPut, "/stats/sessions/book", `{"pages_read":6}`)
+	require.NotNil(t, session.EndTime)
+	assert.Less(t, session.DurationSeconds, 60)
+
+	req := httptest.NewRequest(http.MethodPost, "/books/other/reading-session/pause", nil)
+	req.Header.Set("X-Test-User", userID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A session left paused is closed when it was paused
+	pausedAt := start.Add(20 * time.Minute)
+	require.NoError(t, handler.db.CreateReadingSession(&models.ReadingSession{
+		ID: "stale", UserID: userID, BookID: "other", StartTime: start, CreatedAt: start,
+	}))
+	stale, err := handler.db.GetActiveReadingSession(userID, "other")
+	require.NoError(t, err)
+	stale.Pause(pausedAt)
+	stale.PausedSeconds = 300
+	require.NoError(t, handler.db.UpdateReadingSession(stale))
+
+	closed, err := handler.db.CloseStaleReadingSessions(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, closed)
+	sessions, err := handler.db.GetRecentReadingSessions(userID, 10)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, s := range sessions {
+		if s.ID == "stale" {
+			assert.True(t, pausedAt.Equal(*s.EndTime))
+			assert.Equal(t, 15*60, s.DurationSeconds)
+			assert.Nil(t, s.PausedAt)
+		}
+	}
+}
+
+func TestReadingSessionPagesReadLimit(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	now := time.Now()
+	require.NoError(t, handler.db.CreateBook(&models.Book{ID: "book", UserID: userID, Title: "Book", FilePath: "/book", UploadedAt: now}))
+	require.NoError(t, handler.db.SaveBookStructure("book", "[]", 40))
+	require.NoError(t, handler.db.CreateReadingSession(&models.ReadingSession{
+		ID: "session", UserID: userID, BookID: "book", StartTime: now, CreatedAt: now,
+	}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.PUT("/books/:id/reading-session", handler.UpdateReadingSessionProgress)
+	r.PUT("/stats/sessions/:id", handler.EndReadingSession)
+	do := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/books/book/reading-session", `{"pages_read":41}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/books/book/reading-session", `{"pages_read":-1}`))
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/books/book/reading-session", `{"pages_read":40}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/stats/sessions/book", `{"pages_read":100}`))
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/stats/sessions/book", `{"pages_read":12}`))
+}
+
+func TestEstimatedMinutesRemaining(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	now := time.Now()
+	for _, id := range []string{"started", "unopened", "unknown"} {
+		require.NoError(t, handler.db.CreateBook(&models.Book{ID: id, UserID: userID, Title: id, FilePath: "/" + id,
+			FileFormat: models.FileFormatPDF, UploadedAt: now}))
+	}
+	require.NoError(t, handler.db.SaveBookStructure("started", "[]", 100))
+	require.NoError(t, handler.db.SaveBookStructure("unopened", "[]", 30))
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: "started", UserID: userID, Chapter: "51", UpdatedAt: now}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/books", handler.ListBooks)
+	r.GET("/books/:id", handler.GetBook)
+	list := func() map[string]*int {
+		req := httptest.NewRequest(http.MethodGet, "/books", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Books []models.Book `json:"books"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		remaining := make(map[string]*int)
+		for _, b := range resp.Books {
+			remaining[b.ID] = b.EstimatedMinutesRemaining
+		}
+		return remaining
+	}
+
+	// Without a pace there's nothing to estimate from
+	assert.Nil(t, list()["started"])
+
+	// Two minutes a page
+	stats, err := handler.db.GetOrCreateUserStatistics(userID)
+	require.NoError(t, err)
+	stats.TotalPagesRead = 30
+	stats.TotalTimeSeconds = 3600
+	require.NoError(t, handler.db.UpdateUserStatistics(stats))
+
+	remaining := list()
+	require.NotNil(t, remaining["started"])
+	assert.Equal(t, 100, *remaining["started"])
+	require.NotNil(t, remaining["unopened"])
+	assert.Equal(t, 60, *remaining["unopened"])
+	assert.Nil(t, remaining["unknown"], "books whose length isn't known yet are left out")
+
+	req := httptest.NewRequest(http.MethodGet, "/books/started", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	require.NotNil(t, book.EstimatedMinutesRemaining)
+	assert.Equal(t, 100, *book.EstimatedMinutesRemaining)
+}
+
+func TestStatsPrivacyMode(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	now := time.Now()
+	require.NoError(t, handler.db.CreateBook(&models.Book{ID: "book", UserID: userID, Title: "Book", FilePath: "/book", UploadedAt: now}))
+	require.NoError(t, handler.db.SaveActivityPreferences(&models.ActivityPreferences{UserID: userID, PublishFinished: true, UpdatedAt: now}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.PUT("/stats/preferences", handler.UpdateStatsPreferences)
+	r.DELETE("/stats/history", handler.PurgeReadingHistory)
+	r.POST("/stats/sessions", handler.StartReadingSession)
+	r.PUT("/stats/sessions/:id", handler.EndReadingSession)
+	r.PUT("/books/:id/reading-session", handler.UpdateReadingSessionProgress)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A finished session and a published event from before
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/stats/sessions", `{"book_id":"book"}`).Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/stats/sessions/book", `{"pages_read":10}`).Code)
+	handler.recordActivity(userID, models.ActivityBookFinished, "book", 0)
+	feed, err := handler.db.ListActivityFeed(userID, 10)
+	require.NoError(t, err)
+	require.Len(t, feed, 1)
+
+	// Turning privacy mode on drops the session in progress
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/stats/sessions", `{"book_id":"book"}`).Code)
+	w := do(http.MethodPut, "/stats/preferences", `{"privacy_mode":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var prefs models.StatsPreferences
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &prefs))
+	assert.True(t, prefs.PrivacyMode)
+	_, err = handler.db.GetActiveReadingSession(userID, "book")
+	assert.Error(t, err)
+
+	w = do(http.MethodPost, "/stats/sessions", `{"book_id":"book"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "TRACKING_DISABLED")
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/books/book/reading-session", `{"pages_read":3}`).Code)
+
+	// Nothing is published, and what was is hidden
+	handler.recordActivity(userID, models.ActivityBookAdded, "book", 0)
+	feed, err = handler.db.ListActivityFeed(userID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, feed)
+
+	// History is kept until purged
+	sessions, err := handler.db.GetAllReadingSessions(userID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	require.Equal(t, http.StatusOK, do(http.MethodDelete, "/stats/history", "").Code)
+	sessions, err = handler.db.GetAllReadingSessions(userID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	daily, err := handler.db.GetDailyReadingStats(userID, now.AddDate(0, 0, -1), now.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Empty(t, daily)
+	stats, err := handler.db.GetOrCreateUserStatistics(userID)
+	require.NoError(t, err)
+	assert.Zero(t, stats.TotalPagesRead)
+
+	// Turning it off again tracks reading again
+	require.Equal(t, http.StatusOK, do(http.MethodPut, "/stats/preferences", `{"privacy_mode":false}`).Code)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/stats/sessions", `{"book_id":"book"}`).Code)
+}
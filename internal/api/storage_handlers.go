@@ -0,0 +1,420 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// ==================== Storage Handlers ====================
+
+const (
+	// DefaultMaxUploadSize is the largest book file accepted when no limit
+	// is configured
+	DefaultMaxUploadSize int64 = 100 << 20
+	// DefaultMinFreeSpace is the disk space an upload must leave free
+	DefaultMinFreeSpace int64 = 100 << 20
+
+	// storageTrendDays is how far back the storage report's trend goes
+	storageTrendDays = 90
+)
+
+// SetUploadLimits sets the largest book file accepted, overall and for
+// formats named by extension, such as "pdf", that need a different limit
+func (h *Handler) SetUploadLimits(maxSize int64, perFormat map[string]int64) {
+	h.maxUploadSize = maxSize
+	h.formatUploadSizes = make(map[string]int64, len(perFormat))
+	for format, size := range perFormat {
+		h.formatUploadSizes[strings.ToLower(format)] = size
+	}
+}
+
+// SetMinFreeSpace sets the disk space, in bytes, an upload must leave free.
+// Zero only refuses uploads that don't fit at all.
+func (h *Handler) SetMinFreeSpace(bytes int64) {
+	h.minFreeSpace = bytes
+}
+
+// uploadSizeLimit returns the largest file accepted with filename's
+// extension
+func (h *Handler) uploadSizeLimit(filename string) int64 {
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	if size, ok := h.formatUploadSizes[format]; ok {
+		return size
+	}
+	return h.maxUploadSize
+}
+
+// allowUploadSize reports whether a file of size bytes may be saved: it
+// must be within the size limit for its format and leave the minimum free
+// space on disk. Writes the error response and returns false otherwise.
+// When free space can't be read the upload goes ahead.
+func (h *Handler) allowUploadSize(c *gin.Context, filename string, size int64) bool {
+	if status, code, message := h.refuseUploadSize(filename, size); status != 0 {
+		apierror.Respond(c, status, code, message)
+		return false
+	}
+	return true
+}
+
+// refuseUploadSize is allowUploadSize's check, returning the status, code,
+// and message of the error response, or a zero status if the file may be
+// saved
+func (h *Handler) refuseUploadSize(filename string, size int64) (int, apierror.Code, string) {
+	if limit := h.uploadSizeLimit(filename); size > limit {
+		return http.StatusBadRequest, apierror.CodeFileTooLarge, fmt.Sprintf("File too large (max %dMB)", limit>>20)
+	}
+
+	free, _, err := h.files.DiskSpace()
+	if err != nil {
+		log.Printf("Warning: failed to read free disk space: %v", err)
+		return 0, "", ""
+	}
+	if int64(free) < size+h.minFreeSpace {
+		log.Printf("Refused a %d byte upload with %d bytes free", size, free)
+		return http.StatusInsufficientStorage, apierror.CodeQuotaExceeded, "Not enough disk space on the server for this file"
+	}
+	return 0, "", ""
+}
+
+// importDownload imports a book file downloaded from another server for
+// userID, like an upload: size is the length the server gave, or 0 if it
+// gave none, and filename decides the format. It returns the book, or nil
+// and why it couldn't be imported.
+func (h *Handler) importDownload(ctx context.Context, body io.Reader, size int64, filename, userID string) (*models.Book, string) {
+	if status, _, message := h.refuseUploadSize(filename, size); status != 0 {
+		return nil, message
+	}
+
+	// Downloaded to a temporary file first, so its size is known
+	tmp, err := os.CreateTemp("", "webby-download-*")
+	if err != nil {
+		log.Printf("Failed to create a file to download into: %v", err)
+		return nil, "Failed to save book"
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	limit := h.uploadSizeLimit(filename)
+	size, err = io.Copy(tmp, io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, "Download failed: " + err.Error()
+	}
+	if size > limit {
+		return nil, fmt.Sprintf("File too large (max %dMB)", limit>>20)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, "Download failed: " + err.Error()
+	}
+
+	book, err := h.importer.Import(ctx, tmp, filename, size, userID)
+	if err != nil {
+		var invalid *books.InvalidFileError
+		switch {
+		case errors.Is(err, books.ErrUnsupportedFormat):
+			return nil, "Unsupported file format"
+		case errors.As(err, &invalid):
+			return nil, invalid.Message
+		case ctx.Err() != nil:
+			return nil, ctx.Err().Error()
+		}
+		log.Printf("Importing downloaded %s failed: %v", filename, err)
+		return nil, "Failed to save book"
+	}
+
+	if userID != "" {
+		if err := h.applyVisibility(book, h.uploadVisibility(userID)); err != nil {
+			log.Printf("Warning: failed to set visibility of %s: %v", book.ID, err)
+		}
+	}
+	return book, ""
+}
+
+// storageSnapshot measures the data directory's disk use now
+func (h *Handler) storageSnapshot(now time.Time) (*models.StorageSnapshot, error) {
+	free, _, err := h.files.DiskSpace()
+	if err != nil {
+		return nil, err
+	}
+	booksSize, coversSize, err := h.files.Usage()
+	if err != nil {
+		return nil, err
+	}
+	dbSize, err := h.db.Size()
+	if err != nil {
+		return nil, err
+	}
+	return &models.StorageSnapshot{
+		Date:          now.Format("2006-01-02"),
+		FreeBytes:     int64(free),
+		BooksBytes:    booksSize,
+		CoversBytes:   coversSize,
+		DatabaseBytes: dbSize,
+		RecordedAt:    now,
+	}, nil
+}
+
+// StartStorageSnapshots records the data directory's disk use once a day,
+// for the trend in the storage report
+func (h *Handler) StartStorageSnapshots(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if snapshot, err := h.storageSnapshot(time.Now()); err != nil {
+				log.Printf("Warning: failed to measure storage: %v", err)
+			} else if err := h.db.SaveStorageSnapshot(snapshot); err != nil {
+				log.Printf("Warning: failed to save storage snapshot: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// detachBookFile gives book a file of its own when it uses a stored object
+// other books may share, so writing metadata into it changes only this
+// book. It returns false if the file mustn't be written to.
+func (h *Handler) detachBookFile(book *models.Book) bool {
+	if book.FileFormat != models.FileFormatEPUB && book.FileFormat != models.FileFormatPDF {
+		return true
+	}
+	path, err := h.files.DetachObject(book.ID, book.FilePath)
+	if err != nil {
+		log.Printf("Warning: failed to copy the file of book %s: %v", book.ID, err)
+		return false
+	}
+	if path == book.FilePath {
+		return true
+	}
+	if err := h.db.UpdateBookFilePaths(book.ID, path, book.CoverPath); err != nil {
+		log.Printf("Warning: failed to update file path for book %s: %v", book.ID, err)
+		h.files.DeleteFile(path)
+		return false
+	}
+
+	shared := book.FilePath
+	book.FilePath = path
+	if err := h.files.DeleteFile(shared); err != nil {
+		log.Printf("Warning: failed to release file %s: %v", shared, err)
+	}
+	return true
+}
+
+// recordFileWrite notes what webby just wrote into book's file, so
+// verifying the file later doesn't take the change for corruption
+func (h *Handler) recordFileWrite(book *models.Book) {
+	info, err := os.Stat(book.FilePath)
+	var hash string
+	if err == nil {
+		hash, err = storage.HashFile(book.FilePath)
+	}
+	if err == nil {
+		err = h.db.SetExpectedFile(book.ID, hash, info.Size())
+	}
+	if err != nil {
+		log.Printf("Warning: failed to record the rewritten file of book %s: %v", book.ID, err)
+	}
+}
+
+// StartCleanup cleans the data directory once a day, removing leftover
+// uploads, temporary files, unused stored files, and covers and
+// thumbnails of books that are gone. Deletes remove most files as they
+// go; this catches those kept because they were in use moments before,
+// or left by a crash.
+func (h *Handler) StartCleanup(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := h.runCleanup(); err != nil {
+				log.Printf("Warning: failed to clean the data directory: %v", err)
+			}
+		}
+	}()
+}
+
+// runCleanup cleans the data directory and records what was removed
+func (h *Handler) runCleanup() (*models.CleanupRun, error) {
+	run, err := h.files.Cleanup()
+	if err != nil {
+		return nil, err
+	}
+	if run.Files > 0 {
+		log.Printf("Cleaned up %d leftover files (%d bytes)", run.Files, run.Bytes)
+	}
+	if err := h.db.SaveCleanupRun(run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetStorage reports free disk space, what the data directory uses it for,
+// the upload limits, and daily snapshots of the last 90 days. Admins only.
+func (h *Handler) GetStorage(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	now := time.Now()
+	snapshot, err := h.storageSnapshot(now)
+	if err != nil {
+		log.Printf("Failed to measure storage: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to measure storage")
+		return
+	}
+	_, total, err := h.files.DiskSpace()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to measure storage")
+		return
+	}
+
+	// Today's figures are current, so the trend ends with them
+	if err := h.db.SaveStorageSnapshot(snapshot); err != nil {
+		log.Printf("Warning: failed to save storage snapshot: %v", err)
+	}
+	trend, err := h.db.ListStorageSnapshots(now.AddDate(0, 0, -storageTrendDays))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch storage history")
+		return
+	}
+	if trend == nil {
+		trend = []models.StorageSnapshot{}
+	}
+
+	perFormat := h.formatUploadSizes
+	if perFormat == nil {
+		perFormat = map[string]int64{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"free_bytes":  snapshot.FreeBytes,
+		"total_bytes": total,
+		"usage": models.StorageUsage{
+			BooksBytes:    snapshot.BooksBytes,
+			CoversBytes:   snapshot.CoversBytes,
+			DatabaseBytes: snapshot.DatabaseBytes,
+			TotalBytes:    snapshot.BooksBytes + snapshot.CoversBytes + snapshot.DatabaseBytes,
+		},
+		"limits": gin.H{
+			"max_upload_bytes":        h.maxUploadSize,
+			"format_max_upload_bytes": perFormat,
+			"min_free_bytes":          h.minFreeSpace,
+		},
+		"trend": trend,
+	})
+}
+
+// OptimizeCovers queues a job that scales down every oversized cover in the
+// library, saved before covers were scaled at import. Admins only. A dry
+// run records how much each cover would shrink without changing it.
+func (h *Handler) OptimizeCovers(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	var req struct {
+		DryRun bool `json:"dry_run"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request body")
+			return
+		}
+	}
+
+	bookIDs, err := h.db.ListBookIDsWithCovers()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch books")
+		return
+	}
+	if len(bookIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "No covers to optimize"})
+		return
+	}
+
+	job, err := h.jobs.Enqueue(auth.GetUserID(c), models.JobKindCoverOptimize, req.DryRun, bookIDs)
+	if err != nil {
+		log.Printf("Failed to queue cover optimization: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to queue cover optimization")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Cover optimization queued",
+		"job":     job,
+	})
+}
+
+// cleanupHistory is how many past cleanups the cleanup report lists
+const cleanupHistory = 30
+
+// GetCleanup reports the latest cleanups of the data directory and how
+// much they've reclaimed in all. Admins only.
+func (h *Handler) GetCleanup(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	runs, err := h.db.ListCleanupRuns(cleanupHistory)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch cleanups")
+		return
+	}
+	if runs == nil {
+		runs = []models.CleanupRun{}
+	}
+	files, bytes, err := h.db.CleanupTotals()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch cleanups")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":        runs,
+		"total_files": files,
+		"total_bytes": bytes,
+	})
+}
+
+// RunCleanup cleans the data directory now rather than waiting for the
+// daily cleanup. Admins only.
+func (h *Handler) RunCleanup(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+
+	run, err := h.runCleanup()
+	if err != nil {
+		log.Printf("Failed to clean the data directory: %v", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to clean the data directory")
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
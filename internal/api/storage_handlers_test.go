@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestUploadLimits(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	handler.SetUploadLimits(1<<20, map[string]int64{"PDF": 2 << 20})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.POST("/books", handler.UploadBook)
+	upload := func(filename string, size int) (int, string) {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		fw, err := w.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		_, err = fw.Write(make([]byte, size))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/books", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		var resp struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp.Code
+	}
+
+	status, code := upload("big.epub", 3<<19)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "FILE_TOO_LARGE", code)
+
+	// The PDF limit is higher, so the file gets as far as being checked
+	status, code = upload("big.pdf", 3<<19)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "INVALID_FILE", code)
+
+	handler.SetMinFreeSpace(1 << 62)
+	status, code = upload("small.pdf", 10)
+	assert.Equal(t, http.StatusInsufficientStorage, status)
+	assert.Equal(t, "QUOTA_EXCEEDED", code)
+}
+
+func TestGetStorage(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	adminID := createNamedUser(t, handler, "admin")
+	readerID := createNamedUser(t, handler, "reader")
+	handler.SetAdmins([]string{"admin"})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.GET("/admin/storage", handler.GetStorage)
+	get := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/storage", nil)
+		req.Header.Set("X-Test-User", userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, get(readerID).Code)
+
+	w := get(adminID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		FreeBytes  int64                    `json:"free_bytes"`
+		TotalBytes int64                    `json:"total_bytes"`
+		Usage      models.StorageUsage      `json:"usage"`
+		Trend      []models.StorageSnapshot `json:"trend"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Positive(t, resp.FreeBytes)
+	assert.GreaterOrEqual(t, resp.TotalBytes, resp.FreeBytes)
+	assert.Positive(t, resp.Usage.DatabaseBytes)
+	require.Len(t, resp.Trend, 1, "fetching the report records today's snapshot")
+
+	// Fetching again replaces today's snapshot
+	require.Equal(t, http.StatusOK, get(adminID).Code)
+	trend, err := handler.db.ListStorageSnapshots(resp.Trend[0].RecordedAt.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	assert.Len(t, trend, 1)
+}
+
+func TestCleanupEndpoints(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	adminID := createNamedUser(t, handler, "admin")
+	readerID := createNamedUser(t, handler, "reader")
+	handler.SetAdmins([]string{"admin"})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.GET("/admin/cleanup", handler.GetCleanup)
+	r.POST("/admin/cleanup", handler.RunCleanup)
+	do := func(method, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/cleanup", nil)
+		req.Header.Set("X-Test-User", userID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, readerID).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, readerID).Code)
+
+	w := do(http.MethodPost, adminID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var run models.CleanupRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+	assert.Positive(t, run.ID)
+
+	w = do(http.MethodGet, adminID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Runs       []models.CleanupRun `json:"runs"`
+		TotalFiles int                 `json:"total_files"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Runs, 1)
+	assert.Equal(t, run.ID, resp.Runs[0].ID)
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Sync Handlers ====================
+
+// GetSyncDelta returns what changed in the current user's library since the
+// ?since cursor a previous sync returned: books (with the user's read status
+// and rating), reading positions, annotations, tags, reading lists, and the
+// books in each, plus deletions. Without a cursor, or with one the server
+// doesn't know, everything is returned with "full" set. ?limit caps the
+// changes per response (default 500, max 1000); "has_more" says to sync
+// again from the returned cursor.
+func (h *Handler) GetSyncDelta(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var since int64
+	if v := c.Query("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil || since < 0 {
+			apierror.Invalid(c, "since", "since must be a cursor returned by a previous sync")
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit <= 0 {
+		limit = 500
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	// The cursor is read first, so changes made while the response is
+	// built are sent again next time rather than missed
+	cursor, err := h.db.GetSyncCursor()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to read sync cursor")
+		return
+	}
+
+	var delta *models.SyncDelta
+	if since == 0 || since > cursor {
+		delta, err = h.fullSync(userID)
+		if delta != nil {
+			delta.Cursor = cursor
+		}
+	} else {
+		delta, err = h.syncChanges(userID, since, cursor, limit)
+	}
+	if err != nil {
+		log.Printf("Sync for user %s failed: %v", userID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to sync")
+		return
+	}
+
+	c.JSON(http.StatusOK, delta)
+}
+
+// newSyncDelta returns a delta with empty rather than nil lists
+func newSyncDelta() *models.SyncDelta {
+	return &models.SyncDelta{
+		Books:            []*models.Book{},
+		Positions:        []models.ReadingPosition{},
+		Annotations:      []*models.Annotation{},
+		Tags:             []*models.Tag{},
+		BookTags:         []models.BookTag{},
+		ReadingLists:     []models.ReadingList{},
+		ReadingListBooks: []models.ReadingListBook{},
+		Deleted:          []models.SyncDeletion{},
+	}
+}
+
+// fullSync returns everything in a user's library
+func (h *Handler) fullSync(userID string) (*models.SyncDelta, error) {
+	delta := newSyncDelta()
+	delta.Full = true
+
+	list, err := h.db.ListBooksForUser(userID, "title", "asc")
+	if err == nil {
+		list, err = h.visibleBooks(userID, list)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	for _, b := range list {
+		book, err := h.db.GetBookForUser(b.ID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("get book %s: %w", b.ID, err)
+		}
+		delta.Books = append(delta.Books, book)
+	}
+
+	positions, err := h.db.GetReadingPositionsForUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list reading positions: %w", err)
+	}
+	delta.Positions = append(delta.Positions, positions...)
+
+	annotations, err := h.db.GetAllAnnotationsForUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list annotations: %w", err)
+	}
+	delta.Annotations = append(delta.Annotations, annotations...)
+
+	tags, err := h.db.ListTags(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list tags: %w", err)
+	}
+	delta.Tags = append(delta.Tags, tags...)
+
+	bookTags, err := h.db.ListBookTagsForUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list book tags: %w", err)
+	}
+	delta.BookTags = append(delta.BookTags, bookTags...)
+
+	lists, err := h.db.ListReadingLists(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list reading lists: %w", err)
+	}
+	delta.ReadingLists = append(delta.ReadingLists, lists...)
+
+	listBooks, err := h.db.ListReadingListBooksForUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list reading list books: %w", err)
+	}
+	delta.ReadingListBooks = append(delta.ReadingListBooks, listBooks...)
+
+	return delta, nil
+}
+
+// syncChanges returns the current state of each entity a user changed after
+// since, and tombstones for the ones that are gone
+func (h *Handler) syncChanges(userID string, since, cursor int64, limit int) (*models.SyncDelta, error) {
+	changes, err := h.db.ListSyncChanges(userID, since, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("list changes: %w", err)
+	}
+
+	delta := newSyncDelta()
+	delta.Cursor = cursor
+	if len(changes) > limit {
+		changes = changes[:limit]
+		delta.HasMore = true
+		delta.Cursor = changes[len(changes)-1].Seq
+	} else if len(changes) > 0 && changes[len(changes)-1].Seq > cursor {
+		delta.Cursor = changes[len(changes)-1].Seq
+	}
+
+	for _, ch := range changes {
+		found := false
+		if !ch.Deleted {
+			if found, err = h.addSyncEntity(delta, userID, ch); err != nil {
+				return nil, fmt.Errorf("load %s %s: %w", ch.Entity, ch.EntityID, err)
+			}
+		}
+		if !found {
+			delta.Deleted = append(delta.Deleted, models.SyncDeletion{Entity: ch.Entity, ID: ch.EntityID})
+		}
+	}
+	return delta, nil
+}
+
+// addSyncEntity adds the current state of a changed entity to delta,
+// reporting false if it no longer exists
+func (h *Handler) addSyncEntity(delta *models.SyncDelta, userID string, ch models.SyncChange) (bool, error) {
+	first, second, _ := strings.Cut(ch.EntityID, ":")
+
+	var err error
+	switch ch.Entity {
+	case models.SyncEntityBook:
+		var book *models.Book
+		if book, err = h.db.GetBookForUser(ch.EntityID, userID); err == nil {
+			// Read status on books shared with the user isn't part of
+			// their library
+			if book.UserID != userID {
+				return true, nil
+			}
+			delta.Books = append(delta.Books, book)
+		}
+	case models.SyncEntityPosition:
+		var pos *models.ReadingPosition
+		if pos, err = h.db.GetReadingPosition(ch.EntityID, userID); err == nil {
+			delta.Positions = append(delta.Positions, *pos)
+		}
+	case models.SyncEntityAnnotation:
+		var a *models.Annotation
+		if a, err = h.db.GetAnnotation(ch.EntityID); err == nil {
+			delta.Annotations = append(delta.Annotations, a)
+		}
+	case models.SyncEntityTag:
+		var tag *models.Tag
+		if tag, err = h.db.GetTag(ch.EntityID); err == nil {
+			delta.Tags = append(delta.Tags, tag)
+		}
+	case models.SyncEntityBookTag:
+		var bt *models.BookTag
+		if bt, err = h.db.GetBookTag(first, second); err == nil {
+			delta.BookTags = append(delta.BookTags, *bt)
+		}
+	case models.SyncEntityReadingList:
+		var list *models.ReadingList
+		if list, err = h.db.GetReadingList(ch.EntityID); err == nil {
+			delta.ReadingLists = append(delta.ReadingLists, *list)
+		}
+	case models.SyncEntityReadingListBook:
+		var lb *models.ReadingListBook
+		if lb, err = h.db.GetReadingListBook(first, second); err == nil {
+			delta.ReadingListBooks = append(delta.ReadingListBooks, *lb)
+		}
+	default:
+		return true, nil
+	}
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestSyncDelta(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	otherID := createNamedUser(t, handler, "other")
+	for _, b := range []struct{ id, userID string }{{"b1", userID}, {"b2", userID}, {"theirs", otherID}} {
+		require.NoError(t, handler.db.CreateBook(&models.Book{
+			ID: b.id, UserID: b.userID, Title: b.id, FilePath: "/" + b.id + ".epub", UploadedAt: time.Now(),
+		}))
+	}
+	tag := &models.Tag{ID: "tag", UserID: userID, Name: "Favorites", Color: "#fff", CreatedAt: time.Now()}
+	require.NoError(t, handler.db.CreateTag(tag))
+	require.NoError(t, handler.db.AddTagToBook("b1", tag.ID))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.GET("/sync", handler.GetSyncDelta)
+	sync := func(query string) *models.SyncDelta {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sync"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var delta models.SyncDelta
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &delta))
+		return &delta
+	}
+
+	full := sync("")
+	assert.True(t, full.Full)
+	assert.Len(t, full.Books, 2, "other users' books are left out")
+	require.Len(t, full.Tags, 1)
+	assert.Equal(t, []models.BookTag{{BookID: "b1", TagID: "tag", AddedAt: full.BookTags[0].AddedAt}}, full.BookTags)
+	assert.NotZero(t, full.Cursor)
+
+	delta := sync(fmt.Sprintf("?since=%d", full.Cursor))
+	assert.False(t, delta.Full)
+	assert.Empty(t, delta.Books)
+	assert.Equal(t, full.Cursor, delta.Cursor)
+
+	// Changes since the cursor come back once each, and deletions as
+	// tombstones
+	require.NoError(t, handler.db.UpdateBookReadStatus(userID, "b1", models.ReadStatusReading, nil))
+	require.NoError(t, handler.db.UpdateBookRating(userID, "b1", 4))
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{
+		BookID: "b1", UserID: userID, Chapter: "2", Position: 0.5, UpdatedAt: time.Now(),
+	}))
+	require.NoError(t, handler.db.UpdateBookReadStatus(otherID, "theirs", models.ReadStatusCompleted, nil))
+	require.NoError(t, handler.db.DeleteBook("b2"))
+
+	delta = sync(fmt.Sprintf("?since=%d", full.Cursor))
+	require.Len(t, delta.Books, 1)
+	assert.Equal(t, "b1", delta.Books[0].ID)
+	assert.Equal(t, models.ReadStatusReading, delta.Books[0].ReadStatus)
+	assert.Equal(t, 4, delta.Books[0].Rating)
+	require.Len(t, delta.Positions, 1)
+	assert.Equal(t, "2", delta.Positions[0].Chapter)
+	assert.Equal(t, []models.SyncDeletion{{Entity: models.SyncEntityBook, ID: "b2"}}, delta.Deleted)
+	assert.Greater(t, delta.Cursor, full.Cursor)
+
+	// A small limit pages through the same changes
+	page := sync(fmt.Sprintf("?since=%d&limit=1", full.Cursor))
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Books, 1)
+	page = sync(fmt.Sprintf("?since=%d&limit=1", page.Cursor))
+	assert.True(t, page.HasMore)
+	assert.Len(t, page.Positions, 1)
+	page = sync(fmt.Sprintf("?since=%d&limit=1", page.Cursor))
+	assert.False(t, page.HasMore)
+	assert.Len(t, page.Deleted, 1)
+
+	// Untagging removes the pair
+	require.NoError(t, handler.db.RemoveTagFromBook("b1", tag.ID))
+	delta = sync(fmt.Sprintf("?since=%d", page.Cursor))
+	assert.Equal(t, []models.SyncDeletion{{Entity: models.SyncEntityBookTag, ID: "b1:tag"}}, delta.Deleted)
+
+	// An unknown cursor gets everything
+	assert.True(t, sync("?since=999999").Full)
+}
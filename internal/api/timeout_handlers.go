@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+)
+
+// ==================== Request Timeouts ====================
+
+const (
+	// DefaultRequestTimeout is how long a request may run when no timeout
+	// is configured
+	DefaultRequestTimeout = 60 * time.Second
+	// DefaultUploadTimeout is the same for requests that upload a book file
+	DefaultUploadTimeout = 10 * time.Minute
+
+	// statusClientClosedRequest is logged for requests whose client
+	// disconnected before the response, following nginx
+	statusClientClosedRequest = 499
+)
+
+// uploadRoutes are the routes that save and parse an uploaded or
+// downloaded book file, which get the upload timeout
+var uploadRoutes = []string{
+	"POST /api/books",
+	"PUT /api/books/:id/file",
+	"POST /api/books/:id/files",
+	"POST /api/opds-sources/:id/import",
+	"POST /api/mirror/books/:id/file",
+}
+
+// SetRequestTimeouts sets how long requests may run: book file uploads get
+// upload, other requests defaultTimeout, and the routes in perRoute, keyed
+// by method and path pattern like "GET /api/books/:id/cbz/thumbnails",
+// their own. Zero lets requests run until they finish.
+func (h *Handler) SetRequestTimeouts(defaultTimeout, upload time.Duration, perRoute map[string]time.Duration) {
+	h.requestTimeout = defaultTimeout
+	h.routeTimeouts = make(map[string]time.Duration, len(uploadRoutes)+len(perRoute))
+	for _, route := range uploadRoutes {
+		h.routeTimeouts[route] = upload
+	}
+	for route, timeout := range perRoute {
+		h.routeTimeouts[route] = timeout
+	}
+}
+
+// RequestTimeouts ends each request's context once its route's timeout
+// has passed. Work that's passed the request context, such as an upload's
+// parsing, stops then, as it does when the client disconnects. It's used
+// once for all routes since a handler's context can shorten its deadline
+// but not extend it.
+func (h *Handler) RequestTimeouts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := h.routeTimeouts[c.Request.Method+" "+h.routePath(c)]
+		if !ok {
+			timeout = h.requestTimeout
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// requestEnded writes the response for a request whose context ended
+// before its work was done, err being the context's error. One that ran
+// out of time gets 503; a client that disconnected isn't there to read a
+// response, so the request is only aborted.
+func requestEnded(c *gin.Context, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeTimeout, "Request timed out")
+		return
+	}
+	c.AbortWithStatus(statusClientClosedRequest)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTimeouts(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	handler.SetRequestTimeouts(time.Minute, time.Hour, map[string]time.Duration{"GET /api/export": 0})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	group := r.Group("/api", handler.RequestTimeouts())
+	remaining := func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		if !ok {
+			c.String(http.StatusOK, "none")
+			return
+		}
+		c.String(http.StatusOK, time.Until(deadline).Round(time.Minute).String())
+	}
+	group.GET("/books", remaining)
+	group.POST("/books", remaining)
+	group.GET("/export", remaining)
+
+	get := func(method, path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Body.String()
+	}
+	assert.Equal(t, "1m0s", get(http.MethodGet, "/api/books"))
+	assert.Equal(t, "1h0m0s", get(http.MethodPost, "/api/books"), "uploads get longer")
+	assert.Equal(t, "none", get(http.MethodGet, "/api/export"), "zero turns the timeout off")
+}
+
+func TestUploadTimesOut(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	userID := createNamedUser(t, handler, "reader")
+	handler.SetRequestTimeouts(time.Minute, time.Nanosecond, nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.POST("/api/books", handler.RequestTimeouts(), handler.UploadBook)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "book.epub")
+	require.NoError(t, err)
+	_, err = fw.Write(make([]byte, 1024))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/books", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+	var resp struct {
+		Code string `json:"code"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "TIMEOUT", resp.Code)
+
+	books, err := handler.db.ListBooks("", "")
+	require.NoError(t, err)
+	assert.Empty(t, books, "the timed-out upload isn't kept")
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/tracker"
+)
+
+// ==================== Tracker Handlers ====================
+
+// ListTrackers returns the current user's reading trackers
+func (h *Handler) ListTrackers(c *gin.Context) {
+	conns, err := h.db.ListTrackerConnections(auth.GetUserID(c))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch trackers")
+		return
+	}
+	if conns == nil {
+		conns = []*models.TrackerConnection{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trackers":  conns,
+		"count":     len(conns),
+		"available": h.trackers.Types(),
+	})
+}
+
+// CreateTracker connects the current user to a reading tracker, which is
+// sent their read status changes from then on
+func (h *Handler) CreateTracker(c *gin.Context) {
+	var req struct {
+		Type    string `json:"type" binding:"required"`
+		Name    string `json:"name"`
+		Target  string `json:"target"`
+		Token   string `json:"token"`
+		Enabled *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "type is required")
+		return
+	}
+
+	if !h.trackers.IsSupported(req.Type) {
+		apierror.Invalid(c, "type", "Invalid tracker type. Must be one of: "+strings.Join(h.trackers.Types(), ", "))
+		return
+	}
+
+	conn := &models.TrackerConnection{
+		ID:        uuid.New().String(),
+		UserID:    auth.GetUserID(c),
+		Type:      req.Type,
+		Name:      strings.TrimSpace(req.Name),
+		Target:    strings.TrimSpace(req.Target),
+		Token:     strings.TrimSpace(req.Token),
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	}
+	if conn.Name == "" {
+		conn.Name = conn.Type
+	}
+	if conn.Target == "" && conn.Type == models.TrackerHardcover {
+		conn.Target = tracker.HardcoverAPI
+	}
+	if req.Enabled != nil {
+		conn.Enabled = *req.Enabled
+	}
+
+	if msg := validateNotificationTarget(models.NotificationChannelWebhook, conn.Target); msg != "" {
+		apierror.Invalid(c, "target", msg)
+		return
+	}
+	if conn.Type == models.TrackerHardcover && conn.Token == "" {
+		apierror.Invalid(c, "token", "Hardcover trackers require an API key")
+		return
+	}
+
+	if err := h.db.CreateTrackerConnection(conn); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save tracker")
+		return
+	}
+
+	c.JSON(http.StatusCreated, conn)
+}
+
+// UpdateTracker changes one of the current user's reading trackers
+func (h *Handler) UpdateTracker(c *gin.Context) {
+	conn, ok := h.ownedTracker(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name    string  `json:"name"`
+		Target  string  `json:"target"`
+		Token   *string `json:"token"`
+		Enabled *bool   `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.BindFailed(c, err, "Invalid request")
+		return
+	}
+
+	// Use existing values if not provided
+	if name := strings.TrimSpace(req.Name); name != "" {
+		conn.Name = name
+	}
+	if target := strings.TrimSpace(req.Target); target != "" {
+		if msg := validateNotificationTarget(models.NotificationChannelWebhook, target); msg != "" {
+			apierror.Invalid(c, "target", msg)
+			return
+		}
+		conn.Target = target
+	}
+	if req.Token != nil {
+		conn.Token = strings.TrimSpace(*req.Token)
+		if conn.Type == models.TrackerHardcover && conn.Token == "" {
+			apierror.Invalid(c, "token", "Hardcover trackers require an API key")
+			return
+		}
+	}
+	if req.Enabled != nil {
+		conn.Enabled = *req.Enabled
+	}
+
+	if err := h.db.UpdateTrackerConnection(conn); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update tracker")
+		return
+	}
+
+	c.JSON(http.StatusOK, conn)
+}
+
+// DeleteTracker disconnects one of the current user's reading trackers.
+// What was already sent stays on the tracker.
+func (h *Handler) DeleteTracker(c *gin.Context) {
+	conn, ok := h.ownedTracker(c)
+	if !ok {
+		return
+	}
+	if err := h.db.DeleteTrackerConnection(conn.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete tracker")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tracker deleted"})
+}
+
+// TestTracker checks that one of the current user's reading trackers can
+// be reached with its settings, without changing anything on it
+func (h *Handler) TestTracker(c *gin.Context) {
+	conn, ok := h.ownedTracker(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	if err := h.trackers.Check(ctx, conn); err != nil {
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeUpstreamFailed, "Tracker check failed: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tracker is working"})
+}
+
+// ownedTracker loads the current user's reading tracker named in the URL,
+// writing an error response and returning false if there is none
+func (h *Handler) ownedTracker(c *gin.Context) (*models.TrackerConnection, bool) {
+	conn, err := h.db.GetTrackerConnection(c.Param("id"))
+	if err == nil && conn.UserID != auth.GetUserID(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeTrackerNotFound, "Tracker not found")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to fetch tracker")
+		return nil, false
+	}
+	return conn, true
+}
+
+// publishReadStatus sends a user's new read status for a book to their
+// reading trackers in the background
+func (h *Handler) publishReadStatus(userID, bookID, status string, dateCompleted *time.Time) {
+	if userID == "" {
+		return
+	}
+	book, err := h.db.GetBook(bookID)
+	if err != nil {
+		log.Printf("Warning: failed to load book %s for trackers: %v", bookID, err)
+		return
+	}
+	h.trackers.Publish(tracker.NewUpdate(userID, book, status, dateCompleted))
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/tracker"
+)
+
+func TestTrackers(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	userID := setupTestUser(t, handler)
+	otherID := createNamedUser(t, handler, "other")
+	bookID := setupTestBook(t, handler, userID)
+
+	var mu sync.Mutex
+	var received []tracker.Update
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var update tracker.Update
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		mu.Lock()
+		received = append(received, update)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	call := func(userID string, handle gin.HandlerFunc, method, target, body, id string) *httptest.ResponseRecorder {
+		c, w := createAuthenticatedContext(userID)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		c.Request, _ = http.NewRequest(method, target, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handle(c)
+		return w
+	}
+
+	w := call(userID, handler.CreateTracker, http.MethodPost, "/api/trackers", `{"type": "goodreads"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call(userID, handler.CreateTracker, http.MethodPost, "/api/trackers", `{"type": "hardcover"}`, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Hardcover needs an API key")
+	w = call(userID, handler.CreateTracker, http.MethodPost, "/api/trackers", `{"type": "hardcover", "token": "key"}`, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var hardcover models.TrackerConnection
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hardcover))
+	assert.Equal(t, tracker.HardcoverAPI, hardcover.Target)
+	assert.True(t, hardcover.HasToken)
+	assert.NotContains(t, w.Body.String(), `"key"`)
+
+	// Only enabled trackers are sent updates
+	w = call(userID, handler.UpdateTracker, http.MethodPut, "/api/trackers/"+hardcover.ID, `{"enabled": false}`, hardcover.ID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = call(userID, handler.CreateTracker, http.MethodPost, "/api/trackers", `{"type": "webhook", "target": "`+server.URL+`"}`, "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var webhook models.TrackerConnection
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &webhook))
+
+	w = call(otherID, handler.DeleteTracker, http.MethodDelete, "/api/trackers/"+webhook.ID, "", webhook.ID)
+	assert.Equal(t, http.StatusNotFound, w.Code, "trackers are private")
+
+	w = call(userID, handler.UpdateBookReadStatus, http.MethodPut, "/api/books/"+bookID+"/status", `{"status": "completed"}`, bookID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Eventually(t, func() bool {
+		conn, err := handler.db.GetTrackerConnection(webhook.ID)
+		return err == nil && conn.LastSentAt != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	require.Len(t, received, 1)
+	assert.Equal(t, models.TrackerEventBookFinished, received[0].Event)
+	assert.Equal(t, bookID, received[0].BookID)
+	assert.NotNil(t, received[0].DateCompleted)
+	mu.Unlock()
+
+	conn, err := handler.db.GetTrackerConnection(hardcover.ID)
+	require.NoError(t, err)
+	assert.Nil(t, conn.LastSentAt, "disabled trackers aren't sent updates")
+
+	w = call(userID, handler.TestTracker, http.MethodPost, "/api/trackers/"+webhook.ID+"/test", "", webhook.ID)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = call(userID, handler.DeleteTracker, http.MethodDelete, "/api/trackers/"+webhook.ID, "", webhook.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = call(userID, handler.ListTrackers, http.MethodGet, "/api/trackers", "", "")
+	var list struct {
+		Trackers  []models.TrackerConnection `json:"trackers"`
+		Available []string                   `json:"available"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Trackers, 1)
+	assert.Equal(t, []string{models.TrackerHardcover, models.TrackerWebhook}, list.Available)
+}
@@ -0,0 +1,481 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// userExportVersion is bumped when the export layout changes
+const userExportVersion = 1
+
+// ==================== Account Data Handlers ====================
+
+// userExportIndex is export.json, the first entry of a data export
+type userExportIndex struct {
+	Version     int          `json:"version"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	User        *models.User `json:"user"`
+	Sections    []string     `json:"sections"`   // JSON files in the archive
+	BookFiles   bool         `json:"book_files"` // Whether files/ holds the books themselves
+}
+
+// exportedBook is a book in books.json with its editions and, when files
+// are included, where they are in the archive
+type exportedBook struct {
+	*models.Book
+	Editions []models.BookFile `json:"editions,omitempty"`
+	Files    []string          `json:"files,omitempty"`
+}
+
+// exportedGroup is a reading list, tag, or collection with the IDs of its books
+type exportedGroup struct {
+	Group   any      `json:"group"`
+	BookIDs []string `json:"book_ids"`
+}
+
+// exportSection is one JSON file of a data export
+type exportSection struct {
+	name string
+	data any
+}
+
+// exportFile is a book file copied into a data export
+type exportFile struct {
+	name, path string
+}
+
+// ExportUserData downloads everything stored for the current user as a zip:
+// their books' metadata, annotations and notes, reading history and
+// statistics, lists, tags, collections, and settings. With files=true the
+// book files they own are included too.
+func (h *Handler) ExportUserData(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	includeFiles := false
+	if v := c.Query("files"); v != "" {
+		var err error
+		if includeFiles, err = strconv.ParseBool(v); err != nil {
+			apierror.Invalid(c, "files", "files must be true or false")
+			return
+		}
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+
+	// Everything is read before the response starts, so a failure can
+	// still be reported as an error
+	sections, files, err := h.gatherUserData(userID, includeFiles)
+	if err != nil {
+		log.Printf("Exporting data for user %s failed: %v", userID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export account data")
+		return
+	}
+
+	index := userExportIndex{
+		Version:     userExportVersion,
+		GeneratedAt: time.Now(),
+		User:        user,
+		BookFiles:   includeFiles,
+	}
+	for _, s := range sections {
+		index.Sections = append(index.Sections, s.name)
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "webby-export-"+user.Username+"-"+index.GeneratedAt.Format("2006-01-02")+".zip"))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+
+	sections = append([]exportSection{{"export.json", index}}, sections...)
+	for _, s := range sections {
+		w, err := zw.Create(s.name)
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(s.data)
+		}
+		if err != nil {
+			log.Printf("Warning: data export for user %s failed: %v", userID, err)
+			return
+		}
+	}
+	for _, f := range files {
+		if err := copyFileToZip(zw, f.name, f.path); err != nil {
+			log.Printf("Warning: data export for user %s failed: %v", userID, err)
+			return
+		}
+	}
+}
+
+// gatherUserData reads each section of a user's data export, and lists the
+// book files to include when includeFiles is set
+func (h *Handler) gatherUserData(userID string, includeFiles bool) ([]exportSection, []exportFile, error) {
+	var sections []exportSection
+	var files []exportFile
+	add := func(name string, data any) {
+		sections = append(sections, exportSection{name, data})
+	}
+
+	// Books, with full metadata and the user's read status and rating
+	list, err := h.db.ListBooksForUser(userID, "title", "asc")
+	if err == nil {
+		list, err = h.visibleBooks(userID, list)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("list books: %w", err)
+	}
+	editions := h.bookEditions(list)
+	books := make([]exportedBook, 0, len(list))
+	for _, b := range list {
+		book, err := h.db.GetBookForUser(b.ID, userID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get book %s: %w", b.ID, err)
+		}
+		eb := exportedBook{Book: book, Editions: editions[book.ID]}
+		if includeFiles && !book.IsPhysical() {
+			for _, f := range append([]models.BookFile{primaryFile(book)}, eb.Editions...) {
+				// A missing file shouldn't cut the export short
+				if _, err := os.Stat(f.FilePath); err != nil {
+					log.Printf("Warning: skipping %s in data export: %v", f.FilePath, err)
+					continue
+				}
+				name := "files/" + book.ID + "." + f.FileFormat
+				eb.Files = append(eb.Files, name)
+				files = append(files, exportFile{name, f.FilePath})
+			}
+		}
+		books = append(books, eb)
+	}
+	add("books.json", books)
+
+	annotations, err := h.db.GetAllAnnotationsForUser(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list annotations: %w", err)
+	}
+	add("annotations.json", orEmpty(annotations))
+
+	notes, err := h.db.GetAllBookNotesForUser(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list notes: %w", err)
+	}
+	add("notes.json", orEmpty(notes))
+
+	reviews, err := h.db.ListReviewsByUser(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list reviews: %w", err)
+	}
+	add("reviews.json", orEmpty(reviews))
+
+	positions, err := h.db.GetReadingPositionsForUser(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list reading positions: %w", err)
+	}
+	add("reading_positions.json", orEmpty(positions))
+
+	sessions, err := h.db.GetAllReadingSessions(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list reading sessions: %w", err)
+	}
+	add("reading_sessions.json", orEmpty(sessions))
+
+	stats, err := h.db.GetOrCreateUserStatistics(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get statistics: %w", err)
+	}
+	daily, err := h.db.GetDailyReadingStats(userID, time.Time{}, time.Now())
+	if err != nil {
+		return nil, nil, fmt.Errorf("get daily statistics: %w", err)
+	}
+	add("statistics.json", gin.H{"summary": stats, "daily": orEmpty(daily)})
+
+	lists, err := h.db.ListReadingLists(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list reading lists: %w", err)
+	}
+	exportedLists := make([]exportedGroup, 0, len(lists))
+	for _, l := range lists {
+		listBooks, err := h.db.GetBooksInReadingList(l.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list books in reading list %s: %w", l.ID, err)
+		}
+		exportedLists = append(exportedLists, exportedGroup{l, bookIDs(listBooks)})
+	}
+	add("reading_lists.json", exportedLists)
+
+	tags, err := h.db.ListTags(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list tags: %w", err)
+	}
+	exportedTags := make([]exportedGroup, 0, len(tags))
+	for _, t := range tags {
+		tagBooks, err := h.db.GetBooksByTag(t.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list books with tag %s: %w", t.ID, err)
+		}
+		ids := make([]string, 0, len(tagBooks))
+		for _, b := range tagBooks {
+			ids = append(ids, b.ID)
+		}
+		exportedTags = append(exportedTags, exportedGroup{t, ids})
+	}
+	add("tags.json", exportedTags)
+
+	collections, err := h.db.ListCollections()
+	if err != nil {
+		return nil, nil, fmt.Errorf("list collections: %w", err)
+	}
+	exportedCollections := []exportedGroup{}
+	for _, col := range collections {
+		if col.UserID != userID {
+			continue
+		}
+		// Smart collections are exported as their rules; their books
+		// follow from those
+		if col.IsSmart {
+			if col.Rules, err = h.db.GetCollectionRules(col.ID); err != nil {
+				return nil, nil, fmt.Errorf("get rules of collection %s: %w", col.ID, err)
+			}
+			exportedCollections = append(exportedCollections, exportedGroup{col, []string{}})
+			continue
+		}
+		colBooks, err := h.db.GetBooksInCollection(col.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list books in collection %s: %w", col.ID, err)
+		}
+		exportedCollections = append(exportedCollections, exportedGroup{col, bookIDs(colBooks)})
+	}
+	add("collections.json", exportedCollections)
+
+	follows, err := h.db.ListFollows(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list follows: %w", err)
+	}
+	add("follows.json", orEmpty(follows))
+
+	lent, err := h.db.ListBookLoans(userID, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list loans: %w", err)
+	}
+	borrowed, err := h.db.ListBorrowedBooks(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list borrowed books: %w", err)
+	}
+	add("loans.json", gin.H{"lent": orEmpty(lent), "borrowed": orEmpty(borrowed)})
+
+	readerPrefs, err := h.db.GetReaderPreferences(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get reader preferences: %w", err)
+	}
+	libraryPrefs, err := h.db.GetLibraryPreferences(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get library preferences: %w", err)
+	}
+	statsPrefs, err := h.db.GetStatsPreferences(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get stats preferences: %w", err)
+	}
+	directions, err := h.db.ListSeriesReadingDirections(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list series reading directions: %w", err)
+	}
+	channels, err := h.db.ListNotificationChannels(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list notification channels: %w", err)
+	}
+	subscriptions, err := h.db.GetNotificationSubscriptions(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list notification subscriptions: %w", err)
+	}
+	devices, err := h.db.ListDevices(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list devices: %w", err)
+	}
+	add("settings.json", gin.H{
+		"reader":                     readerPrefs,
+		"library":                    libraryPrefs,
+		"stats":                      statsPrefs,
+		"series_reading_directions":  orEmpty(directions),
+		"notification_channels":      orEmpty(channels),
+		"notification_subscriptions": orEmpty(subscriptions),
+		"devices":                    orEmpty(devices),
+	})
+
+	return sections, files, nil
+}
+
+// DeleteAccount permanently removes the current user with their books and
+// everything else stored for them. The password must be given again to
+// confirm.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	userID := auth.GetUserID(c)
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "password", "Password is required to delete your account")
+		return
+	}
+
+	user, err := h.db.GetUserByID(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "User not found")
+		return
+	}
+	if !auth.CheckPassword(req.Password, user.PasswordHash) {
+		apierror.Invalid(c, "password", "Password is incorrect")
+		return
+	}
+
+	// Owned books are listed first; their rows go with the account but the
+	// files are removed here
+	owned, err := h.db.ListBooksForUser(userID, "title", "asc")
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
+		return
+	}
+
+	// Stored files may be shared with other users' books, so they're
+	// released by path once the rows are gone
+	bookIDs := make([]string, len(owned))
+	var paths []string
+	for i, book := range owned {
+		bookIDs[i] = book.ID
+		paths = append(paths, book.FilePath)
+	}
+	editions, err := h.db.GetBookFilesForBooks(bookIDs)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list books")
+		return
+	}
+	for _, files := range editions {
+		for _, f := range files {
+			paths = append(paths, f.FilePath)
+		}
+	}
+
+	if err := h.db.DeleteUser(userID); err != nil {
+		log.Printf("Deleting user %s failed: %v", userID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete account")
+		return
+	}
+	for _, book := range owned {
+		if err := h.files.DeleteBook(book.ID); err != nil {
+			log.Printf("Warning: failed to delete files of book %s: %v", book.ID, err)
+		}
+	}
+	for _, path := range paths {
+		if err := h.files.DeleteFile(path); err != nil {
+			log.Printf("Warning: failed to delete file %s: %v", path, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Account deleted",
+		"books_deleted": len(owned),
+	})
+}
+
+// ClaimAnonymousLibrary gives the current user everything kept without
+// signing in: books without an owner, reading positions and read status,
+// and collections. It is for servers used anonymously before accounts were
+// turned on, so only an admin, or the sole account, may claim them.
+func (h *Handler) ClaimAnonymousLibrary(c *gin.Context) {
+	userID := auth.GetUserID(c)
+	if userID == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required")
+		return
+	}
+
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.BindFailed(c, err, "Invalid request")
+			return
+		}
+	}
+	if req.Visibility == "" {
+		req.Visibility = h.uploadVisibility(userID)
+	} else if !models.ValidBookVisibility(req.Visibility) {
+		apierror.Invalid(c, "visibility", "visibility must be private, household, or public")
+		return
+	}
+
+	if !h.isAdmin(userID) {
+		count, err := h.db.CountUsers()
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to count users")
+			return
+		}
+		if count > 1 {
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden,
+				"Only an admin can claim the anonymous library once there are other accounts")
+			return
+		}
+	}
+
+	claim, err := h.db.ClaimAnonymousLibrary(userID, req.Visibility)
+	if err != nil {
+		log.Printf("Claiming the anonymous library for user %s failed: %v", userID, err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to claim the anonymous library")
+		return
+	}
+	claim.BookIDs = orEmpty(claim.BookIDs)
+
+	if req.Visibility == models.BookVisibilityHousehold && len(claim.BookIDs) > 0 {
+		members, err := h.db.ListHouseholdMemberIDs(userID)
+		if err != nil {
+			log.Printf("Warning: failed to list household of user %s: %v", userID, err)
+		}
+		for _, bookID := range claim.BookIDs {
+			for _, memberID := range members {
+				if err := h.db.ShareBook(bookID, userID, memberID); err != nil {
+					log.Printf("Warning: failed to share book %s with %s: %v", bookID, memberID, err)
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Anonymous library claimed",
+		"claimed": claim,
+	})
+}
+
+// bookIDs returns the IDs of books
+func bookIDs(books []models.Book) []string {
+	ids := make([]string, 0, len(books))
+	for _, b := range books {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// orEmpty returns list, or an empty list if it's nil, so exports always
+// have JSON arrays
+func orEmpty[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// setupUserDataTest creates a user with the password "password123" who owns
+// one book with a file on disk, and a router for the account data routes
+func setupUserDataTest(t *testing.T) (*Handler, *gin.Engine, string, *models.Book, func()) {
+	handler, cleanup := setupTestHandler(t)
+
+	hash, err := auth.HashPassword("password123")
+	require.NoError(t, err)
+	user := &models.User{
+		ID:           uuid.New().String(),
+		Username:     "reader",
+		Email:        "reader@example.com",
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	require.NoError(t, handler.db.CreateUser(user))
+
+	bookID := uuid.New().String()
+	path, err := handler.files.SaveBookWithExt(bookID, strings.NewReader("epub contents"), ".epub")
+	require.NoError(t, err)
+	book := &models.Book{
+		ID:          bookID,
+		UserID:      user.ID,
+		Title:       "Exported Book",
+		Author:      "Test Author",
+		FilePath:    path,
+		UploadedAt:  time.Now(),
+		ContentType: models.ContentTypeBook,
+		FileFormat:  models.FileFormatEPUB,
+	}
+	require.NoError(t, handler.db.CreateBook(book))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+	})
+	r.GET("/users/me/export", handler.ExportUserData)
+	r.DELETE("/users/me", handler.DeleteAccount)
+	r.POST("/users/me/claim-anonymous", handler.ClaimAnonymousLibrary)
+	return handler, r, user.ID, book, cleanup
+}
+
+func TestExportUserData(t *testing.T) {
+	handler, r, userID, book, cleanup := setupUserDataTest(t)
+	defer cleanup()
+
+	require.NoError(t, handler.db.CreateAnnotation(&models.Annotation{
+		ID:           uuid.New().String(),
+		BookID:       book.ID,
+		UserID:       userID,
+		Chapter:      "0",
+		SelectedText: "A memorable line",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}))
+
+	export := func(query string) map[string][]byte {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/me/export"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		require.NoError(t, err)
+		entries := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			entries[f.Name], err = io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+		}
+		return entries
+	}
+
+	entries := export("")
+	var index userExportIndex
+	require.NoError(t, json.Unmarshal(entries["export.json"], &index))
+	assert.Equal(t, "reader", index.User.Username)
+	assert.False(t, index.BookFiles)
+	for _, name := range index.Sections {
+		assert.Contains(t, entries, name)
+	}
+
+	var books []map[string]any
+	require.NoError(t, json.Unmarshal(entries["books.json"], &books))
+	require.Len(t, books, 1)
+	assert.Equal(t, "Exported Book", books[0]["title"])
+	assert.Contains(t, string(entries["annotations.json"]), "A memorable line")
+	assert.NotContains(t, entries, "files/"+book.ID+".epub", "files are only included when asked for")
+
+	entries = export("?files=true")
+	assert.Equal(t, "epub contents", string(entries["files/"+book.ID+".epub"]))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/me/export?files=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	handler, r, userID, book, cleanup := setupUserDataTest(t)
+	defer cleanup()
+
+	deleteAccount := func(body string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/users/me", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, deleteAccount(`{}`))
+	assert.Equal(t, http.StatusBadRequest, deleteAccount(`{"password": "wrongpassword"}`))
+	_, err := handler.db.GetUserByID(userID)
+	require.NoError(t, err, "nothing is deleted without the right password")
+
+	assert.Equal(t, http.StatusOK, deleteAccount(`{"password": "password123"}`))
+	_, err = handler.db.GetUserByID(userID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = handler.db.GetBook(book.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = os.Stat(book.FilePath)
+	assert.True(t, os.IsNotExist(err), "owned book files are removed")
+}
+
+func TestClaimAnonymousLibrary(t *testing.T) {
+	handler, r, userID, book, cleanup := setupUserDataTest(t)
+	defer cleanup()
+
+	orphanID := setupTestBook(t, handler, "")
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: orphanID, Chapter: "ch3", Position: 0.5}))
+	require.NoError(t, handler.db.SaveReadingPosition(&models.ReadingPosition{BookID: book.ID, Chapter: "ch1", Position: 0.2}))
+	_, err := handler.collections.Create("", "Favorites", "", false, "", nil)
+	require.NoError(t, err)
+
+	claim := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users/me/claim-anonymous", strings.NewReader(`{"visibility": "public"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := claim()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Claimed models.AnonymousClaim `json:"claimed"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{orphanID}, resp.Claimed.BookIDs)
+	assert.Equal(t, 2, resp.Claimed.Positions)
+	assert.Equal(t, 1, resp.Claimed.Collections)
+
+	got, err := handler.db.GetBook(orphanID)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+	assert.Equal(t, models.BookVisibilityPublic, got.Visibility)
+	pos, err := handler.db.GetReadingPosition(book.ID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "ch1", pos.Chapter, "positions in books that already had an owner move too")
+	collections, err := handler.collections.List(userID)
+	require.NoError(t, err)
+	require.Len(t, collections, 1)
+	assert.Equal(t, "Favorites", collections[0].Name)
+
+	// Once someone else has an account only an admin may claim
+	createNamedUser(t, handler, "latecomer")
+	assert.Equal(t, http.StatusForbidden, claim().Code)
+	handler.SetAdmins([]string{"reader"})
+	assert.Equal(t, http.StatusOK, claim().Code)
+}
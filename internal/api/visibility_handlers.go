@@ -0,0 +1,109 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/auth"
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Visibility Handlers ====================
+
+// SetDefaultVisibility sets the visibility of new uploads by users who
+// haven't picked their own. Anonymous uploads, which have no owner and so
+// are seen by everyone, are only accepted when it is public.
+func (h *Handler) SetDefaultVisibility(visibility string) {
+	h.defaultVisibility = visibility
+}
+
+// uploadVisibility returns the visibility a user's new books get: their own
+// default if they set one, otherwise the server's
+func (h *Handler) uploadVisibility(userID string) string {
+	prefs, err := h.db.GetLibraryPreferences(userID)
+	if err != nil {
+		log.Printf("Warning: failed to load library preferences for user %s: %v", userID, err)
+		return h.defaultVisibility
+	}
+	if prefs.DefaultVisibility != "" {
+		return prefs.DefaultVisibility
+	}
+	return h.defaultVisibility
+}
+
+// allowUpload reports whether the caller may add books, writing a 401 for
+// anonymous callers unless the server keeps new books public
+func (h *Handler) allowUpload(c *gin.Context) bool {
+	if auth.GetUserID(c) != "" || h.defaultVisibility == models.BookVisibilityPublic {
+		return true
+	}
+	apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authentication required to add books")
+	return false
+}
+
+// applyVisibility stores a book's visibility and, for household books,
+// shares it with everyone its owner shares books with
+func (h *Handler) applyVisibility(book *models.Book, visibility string) error {
+	if book.Visibility != visibility {
+		if err := h.db.SetBookVisibility(book.ID, visibility); err != nil {
+			return err
+		}
+		book.Visibility = visibility
+	}
+	if visibility != models.BookVisibilityHousehold {
+		return nil
+	}
+
+	members, err := h.db.ListHouseholdMemberIDs(book.UserID)
+	if err != nil {
+		return err
+	}
+	for _, memberID := range members {
+		if err := h.db.ShareBook(book.ID, book.UserID, memberID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateBookVisibility changes who besides the owner can see a book. Making
+// a book household shares it with the owner's household; shares made before
+// are kept when it is made private again.
+func (h *Handler) UpdateBookVisibility(c *gin.Context) {
+	var req struct {
+		Visibility string `json:"visibility" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Invalid(c, "visibility", "visibility is required")
+		return
+	}
+	if !models.ValidBookVisibility(req.Visibility) {
+		apierror.Invalid(c, "visibility", "visibility must be private, household, or public")
+		return
+	}
+
+	book, ok := h.authorizedBook(c, authz.Write)
+	if !ok {
+		return
+	}
+	if book.UserID == "" {
+		apierror.Invalid(c, "visibility", "Books without an owner are always public")
+		return
+	}
+
+	if err := h.applyVisibility(book, req.Visibility); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update visibility")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Visibility updated",
+		"book_id":    book.ID,
+		"visibility": book.Visibility,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestUploadVisibility(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	ownerID := createNamedUser(t, handler, "owner")
+	friendID := createNamedUser(t, handler, "friend")
+	strangerID := createNamedUser(t, handler, "stranger")
+	require.NoError(t, handler.db.CreateBook(&models.Book{
+		ID: "shared", UserID: ownerID, Title: "Shared", FilePath: "/s.epub", UploadedAt: time.Now(),
+	}))
+	require.NoError(t, handler.db.ShareBook("shared", ownerID, friendID))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Test-User")) })
+	r.POST("/books/physical", handler.CreatePhysicalBook)
+	r.PUT("/books/:id/visibility", handler.RequireBook(authz.Write), handler.UpdateBookVisibility)
+	r.PUT("/library/preferences", handler.UpdateLibraryPreferences)
+	do := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Test-User", userID)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	create := func(userID string) *models.Book {
+		w := do(http.MethodPost, "/books/physical", userID, `{"title":"Paper"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp struct {
+			Book models.Book `json:"book"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return &resp.Book
+	}
+
+	// Ownerless books are only accepted when the server keeps uploads public
+	w := do(http.MethodPost, "/books/physical", "", `{"title":"Paper"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	handler.SetDefaultVisibility(models.BookVisibilityPublic)
+	assert.Empty(t, create("").UserID)
+	assert.Equal(t, models.BookVisibilityPublic, create(ownerID).Visibility)
+	handler.SetDefaultVisibility(models.BookVisibilityPrivate)
+
+	w = do(http.MethodPut, "/library/preferences", ownerID, `{"default_visibility":"everyone"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do(http.MethodPut, "/library/preferences", ownerID, `{"default_visibility":"household"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	book := create(ownerID)
+	assert.Equal(t, models.BookVisibilityHousehold, book.Visibility)
+	shared, err := handler.db.IsBookSharedWith(book.ID, friendID)
+	require.NoError(t, err)
+	assert.True(t, shared, "household books are shared with the owner's household")
+
+	w = do(http.MethodPut, "/books/"+book.ID+"/visibility", friendID, `{"visibility":"public"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "share recipients can't change visibility")
+	w = do(http.MethodPut, "/books/"+book.ID+"/visibility", ownerID, `{"visibility":"public"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err = handler.db.GetBookForUser(book.ID, strangerID)
+	assert.NoError(t, err, "public books are readable by anyone")
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
+	"github.com/justyntemme/webby/internal/workpool"
+)
+
+// ==================== Worker Pool Handlers ====================
+
+// DefaultWorkerQueue is how many CPU-heavy requests wait for a worker
+// before more are turned away, when no limit is configured
+const DefaultWorkerQueue = 16
+
+// SetWorkerLimits sets how many CPU-heavy requests, such as parsing an
+// upload or scaling comic pages, run at once, and how many more wait for
+// a turn before the server answers 503
+func (h *Handler) SetWorkerLimits(workers, queue int) {
+	h.workers = workpool.New(workers, queue)
+}
+
+// acquireWorker takes a worker from the pool that bounds CPU-heavy work,
+// returning the function that frees it. When the pool is saturated it
+// writes 503 with a Retry-After header and returns false, as it does if
+// the request ends while waiting.
+func (h *Handler) acquireWorker(c *gin.Context) (func(), bool) {
+	release, err := h.workers.Acquire(c.Request.Context())
+	switch {
+	case err == nil:
+		return release, true
+	case errors.Is(err, workpool.ErrSaturated):
+		c.Header("Retry-After", strconv.Itoa(int(h.workers.RetryAfter().Seconds())))
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServerBusy, "Server is busy, try again shortly")
+	default:
+		requestEnded(c, err)
+	}
+	return nil, false
+}
+
+// GetWorkers reports the load on the pool of workers for CPU-heavy
+// requests. Admins only.
+func (h *Handler) GetWorkers(c *gin.Context) {
+	if !h.requireAdmin(c) {
+		return
+	}
+	c.JSON(http.StatusOK, h.workers.Stats())
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/workpool"
+)
+
+func TestUploadWhenWorkersBusy(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetAdmins([]string{"admin"})
+
+	adminID := createNamedUser(t, handler, "admin")
+	handler.SetWorkerLimits(1, 0)
+	release, err := handler.workers.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", adminID) })
+	r.POST("/books", handler.UploadBook)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "book.epub")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("epub"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "/books", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	var resp struct {
+		Code string `json:"code"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "SERVER_BUSY", resp.Code)
+
+	c, w := createAuthenticatedContext(adminID)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/api/admin/workers", nil)
+	handler.GetWorkers(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats workpool.Stats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, workpool.Stats{Workers: 1, Busy: 1, Rejected: 1}, stats)
+}
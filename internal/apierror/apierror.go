@@ -0,0 +1,221 @@
+// Package apierror defines the JSON error envelope returned by every API
+// endpoint, its machine-readable codes, and request ID tracking.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// Code is a machine-readable error identifier. Clients should branch on the
+// code rather than the human-readable message.
+type Code string
+
+// General error codes
+const (
+	CodeBadRequest         Code = "BAD_REQUEST"
+	CodeInvalidRequest     Code = "INVALID_REQUEST" // Body could not be parsed
+	CodeValidationFailed   Code = "VALIDATION_FAILED"
+	CodeUnauthorized       Code = "UNAUTHORIZED"
+	CodeInvalidToken       Code = "INVALID_TOKEN"
+	CodeTokenExpired       Code = "TOKEN_EXPIRED"
+	CodeInvalidCredentials Code = "INVALID_CREDENTIALS"
+	CodeForbidden          Code = "FORBIDDEN"
+	CodeNotFound           Code = "NOT_FOUND"
+	CodeConflict           Code = "CONFLICT"
+	CodeAlreadyExists      Code = "ALREADY_EXISTS"
+	CodeQuotaExceeded      Code = "QUOTA_EXCEEDED"
+	CodeRateLimited        Code = "RATE_LIMITED"
+	CodeInternal           Code = "INTERNAL_ERROR"
+	CodeUpstreamFailed     Code = "UPSTREAM_ERROR"
+	CodeServiceUnavailable Code = "SERVICE_UNAVAILABLE"
+	CodeTimeout            Code = "TIMEOUT"     // Request ran past its route's timeout
+	CodeServerBusy         Code = "SERVER_BUSY" // Too much CPU-heavy work queued; see Retry-After
+)
+
+// Feature-specific error codes
+const (
+	CodeRegistrationDisabled Code = "REGISTRATION_DISABLED"
+	CodeEmailNotVerified     Code = "EMAIL_NOT_VERIFIED"
+	CodeFileTooLarge         Code = "FILE_TOO_LARGE"
+	CodeUnsupportedFormat    Code = "UNSUPPORTED_FORMAT"
+	CodeInvalidFile          Code = "INVALID_FILE"
+	CodeBarcodeNotFound      Code = "BARCODE_NOT_FOUND"
+	CodeTrackingDisabled     Code = "TRACKING_DISABLED"
+	CodeProfileRestricted    Code = "PROFILE_RESTRICTED" // Not available while in a restricted profile
+
+	CodeBookNotFound          Code = "BOOK_NOT_FOUND"
+	CodeFileNotFound          Code = "FILE_NOT_FOUND"
+	CodeChapterNotFound       Code = "CHAPTER_NOT_FOUND"
+	CodePageNotFound          Code = "PAGE_NOT_FOUND"
+	CodeLinkTargetNotFound    Code = "LINK_TARGET_NOT_FOUND"
+	CodeResourceNotFound      Code = "RESOURCE_NOT_FOUND"
+	CodeUserNotFound          Code = "USER_NOT_FOUND"
+	CodeCollectionNotFound    Code = "COLLECTION_NOT_FOUND"
+	CodeReadingListNotFound   Code = "READING_LIST_NOT_FOUND"
+	CodeTagNotFound           Code = "TAG_NOT_FOUND"
+	CodeAnnotationNotFound    Code = "ANNOTATION_NOT_FOUND"
+	CodeNoteNotFound          Code = "NOTE_NOT_FOUND"
+	CodeReviewNotFound        Code = "REVIEW_NOT_FOUND"
+	CodeLoanNotFound          Code = "LOAN_NOT_FOUND"
+	CodeClubNotFound          Code = "CLUB_NOT_FOUND"
+	CodeCommentNotFound       Code = "COMMENT_NOT_FOUND"
+	CodeSeriesNotFound        Code = "SERIES_NOT_FOUND"
+	CodeReadingOrderNotFound  Code = "READING_ORDER_NOT_FOUND"
+	CodeFollowNotFound        Code = "FOLLOW_NOT_FOUND"
+	CodeChannelNotFound       Code = "CHANNEL_NOT_FOUND"
+	CodeSessionNotFound       Code = "SESSION_NOT_FOUND"
+	CodeStyleOverrideNotFound Code = "STYLE_OVERRIDE_NOT_FOUND"
+	CodeDeviceNotFound        Code = "DEVICE_NOT_FOUND"
+	CodeChallengeNotFound     Code = "CHALLENGE_NOT_FOUND"
+	CodeJobNotFound           Code = "JOB_NOT_FOUND"
+	CodeRevisionNotFound      Code = "REVISION_NOT_FOUND"
+	CodePatternNotFound       Code = "PATTERN_NOT_FOUND"
+	CodeCustomFieldNotFound   Code = "CUSTOM_FIELD_NOT_FOUND"
+	CodeOPDSSourceNotFound    Code = "OPDS_SOURCE_NOT_FOUND"
+	CodeSyncKeyNotFound       Code = "SYNC_KEY_NOT_FOUND"
+	CodeMirrorNotFound        Code = "MIRROR_NOT_FOUND"
+	CodeTrackerNotFound       Code = "TRACKER_NOT_FOUND"
+	CodeProfileNotFound       Code = "PROFILE_NOT_FOUND"
+)
+
+// ErrorResponse is the JSON body of every error response. Error keeps the
+// human-readable message older clients display.
+type ErrorResponse struct {
+	Error     string       `json:"error"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Details   []FieldError `json:"details,omitempty"`
+}
+
+// FieldError describes a problem with one request field or parameter
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Respond writes an error response
+func Respond(c *gin.Context, status int, code Code, message string) {
+	c.JSON(status, newResponse(c, code, message, nil))
+}
+
+// RespondWith writes an error response with extra top-level fields, for
+// errors that carry context such as the conflicting record
+func RespondWith(c *gin.Context, status int, code Code, message string, extra gin.H) {
+	body := gin.H{}
+	for k, v := range extra {
+		body[k] = v
+	}
+	resp := newResponse(c, code, message, nil)
+	body["error"] = resp.Error
+	body["code"] = resp.Code
+	if resp.RequestID != "" {
+		body["request_id"] = resp.RequestID
+	}
+	c.JSON(status, body)
+}
+
+// Abort writes an error response and stops the handler chain. Use it from
+// middleware.
+func Abort(c *gin.Context, status int, code Code, message string) {
+	c.AbortWithStatusJSON(status, newResponse(c, code, message, nil))
+}
+
+// Invalid writes a 400 validation error for a single field
+func Invalid(c *gin.Context, field, message string) {
+	Validation(c, message, FieldError{Field: field, Message: message})
+}
+
+// Validation writes a 400 validation error listing each invalid field
+func Validation(c *gin.Context, message string, details ...FieldError) {
+	c.JSON(http.StatusBadRequest, newResponse(c, CodeValidationFailed, message, details))
+}
+
+// BindFailed writes the response for a request body that failed to bind.
+// Missing required fields are reported as validation details; anything else
+// is a malformed body.
+func BindFailed(c *gin.Context, err error, message string) {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		Respond(c, http.StatusBadRequest, CodeInvalidRequest, message)
+		return
+	}
+
+	details := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		field := snakeCase(fe.Field())
+		msg := field + " is invalid"
+		if fe.Tag() == "required" {
+			msg = field + " is required"
+		}
+		details = append(details, FieldError{Field: field, Message: msg})
+	}
+	Validation(c, message, details...)
+}
+
+func newResponse(c *gin.Context, code Code, message string, details []FieldError) *ErrorResponse {
+	return &ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: RequestID(c),
+		Details:   details,
+	}
+}
+
+// snakeCase converts a Go field name like BookIDs to book_ids
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at a lower-to-upper change, or at the last
+			// capital of an acronym followed by lowercase (IDList -> id_list)
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && runes[i+1] != 's')) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ==================== Request IDs ====================
+
+const (
+	// HeaderRequestID carries the request ID on requests and responses
+	HeaderRequestID = "X-Request-ID"
+	// ContextRequestID is the key for the request ID in gin context
+	ContextRequestID = "request_id"
+)
+
+// validRequestID limits client-supplied IDs to short, log-safe values
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDMiddleware tags each request with an ID, reusing the client's
+// X-Request-ID when it is well formed, and echoes it in the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID.MatchString(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set(ContextRequestID, id)
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// RequestID returns the current request's ID, or "" outside the middleware
+func RequestID(c *gin.Context) string {
+	return c.GetString(ContextRequestID)
+}
@@ -0,0 +1,133 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a single request through the request ID middleware and handler
+func serve(t *testing.T, requestID string, handler gin.HandlerFunc) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.POST("/test", handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(`{"name": ""}`))
+	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set(HeaderRequestID, requestID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w, body
+}
+
+func TestRespond(t *testing.T) {
+	w, body := serve(t, "", func(c *gin.Context) {
+		Respond(c, http.StatusNotFound, CodeBookNotFound, "Book not found")
+	})
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Book not found", body["error"])
+	assert.Equal(t, "BOOK_NOT_FOUND", body["code"])
+	assert.NotEmpty(t, body["request_id"])
+	assert.Equal(t, body["request_id"], w.Header().Get(HeaderRequestID))
+	assert.NotContains(t, body, "details")
+}
+
+func TestRequestIDFromClient(t *testing.T) {
+	w, body := serve(t, "client-id.42", func(c *gin.Context) {
+		Respond(c, http.StatusInternalServerError, CodeInternal, "Failed")
+	})
+	assert.Equal(t, "client-id.42", body["request_id"])
+	assert.Equal(t, "client-id.42", w.Header().Get(HeaderRequestID))
+
+	// Malformed IDs are replaced
+	_, body = serve(t, "bad id\n", func(c *gin.Context) {
+		Respond(c, http.StatusInternalServerError, CodeInternal, "Failed")
+	})
+	assert.NotEqual(t, "bad id\n", body["request_id"])
+	assert.NotEmpty(t, body["request_id"])
+}
+
+func TestRespondWith(t *testing.T) {
+	w, body := serve(t, "", func(c *gin.Context) {
+		RespondWith(c, http.StatusConflict, CodeAlreadyExists, "Tag already exists", gin.H{"tag": "t1", "code": "ignored"})
+	})
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "ALREADY_EXISTS", body["code"], "extra fields cannot override the envelope")
+	assert.Equal(t, "t1", body["tag"])
+}
+
+func TestInvalid(t *testing.T) {
+	w, body := serve(t, "", func(c *gin.Context) {
+		Invalid(c, "font_size", "font_size must be between 8 and 72")
+	})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "VALIDATION_FAILED", body["code"])
+	assert.Equal(t, []any{map[string]any{
+		"field":   "font_size",
+		"message": "font_size must be between 8 and 72",
+	}}, body["details"])
+}
+
+func TestBindFailed(t *testing.T) {
+	t.Run("missing required fields", func(t *testing.T) {
+		_, body := serve(t, "", func(c *gin.Context) {
+			var req struct {
+				Name    string   `json:"name" binding:"required"`
+				BookIDs []string `json:"book_ids" binding:"required"`
+			}
+			err := c.ShouldBindJSON(&req)
+			require.Error(t, err)
+			BindFailed(c, err, "Invalid request")
+		})
+
+		assert.Equal(t, "VALIDATION_FAILED", body["code"])
+		assert.Equal(t, "Invalid request", body["error"])
+		assert.Equal(t, []any{
+			map[string]any{"field": "name", "message": "name is required"},
+			map[string]any{"field": "book_ids", "message": "book_ids is required"},
+		}, body["details"])
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		_, body := serve(t, "", func(c *gin.Context) {
+			var req struct {
+				Name int `json:"name"`
+			}
+			err := c.ShouldBindJSON(&req)
+			require.Error(t, err)
+			BindFailed(c, err, "Invalid request")
+		})
+
+		assert.Equal(t, "INVALID_REQUEST", body["code"])
+		assert.NotContains(t, body, "details")
+	})
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":        "name",
+		"BookIDs":     "book_ids",
+		"ContentType": "content_type",
+		"IDList":      "id_list",
+		"ISBN":        "isbn",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, snakeCase(in), in)
+	}
+}
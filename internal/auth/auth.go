@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"os"
 	"time"
@@ -19,6 +23,9 @@ var (
 type Claims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	// ProfileID is set while the account has switched to a restricted
+	// profile
+	ProfileID string `json:"profile_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -45,9 +52,16 @@ func CheckPassword(password, hash string) bool {
 
 // GenerateToken creates a new JWT token for a user
 func GenerateToken(userID, username string) (string, error) {
+	return GenerateProfileToken(userID, username, "")
+}
+
+// GenerateProfileToken creates a new JWT token for a user switched to one
+// of their restricted profiles
+func GenerateProfileToken(userID, username, profileID string) (string, error) {
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		ProfileID: profileID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -90,5 +104,23 @@ func RefreshToken(tokenString string) (string, error) {
 		return "", err
 	}
 
-	return GenerateToken(claims.UserID, claims.Username)
+	return GenerateProfileToken(claims.UserID, claims.Username, claims.ProfileID)
+}
+
+// NewAccountToken creates a random single-use token for a password reset or
+// email verification link, returning it along with the hash to store
+func NewAccountToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAccountToken(token), nil
+}
+
+// HashAccountToken returns the hash an account token is stored and looked
+// up by. The tokens are random, so a fast unsalted hash is enough.
+func HashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -74,3 +77,83 @@ func TestRefreshToken(t *testing.T) {
 	assert.Equal(t, userID, claims.UserID)
 	assert.Equal(t, username, claims.Username)
 }
+
+func TestProfileToken(t *testing.T) {
+	token, err := GenerateProfileToken("test-user-id", "testuser", "profile-1")
+	require.NoError(t, err)
+
+	claims, err := ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "test-user-id", claims.UserID)
+	assert.Equal(t, "profile-1", claims.ProfileID)
+
+	// Refreshing keeps the account in the profile
+	newToken, err := RefreshToken(token)
+	require.NoError(t, err)
+	claims, err = ValidateToken(newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "profile-1", claims.ProfileID)
+
+	r := gin.New()
+	var gotProfile string
+	r.GET("/me", AuthMiddleware(), func(c *gin.Context) {
+		gotProfile = GetProfileID(c)
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "profile-1", gotProfile)
+}
+
+func TestAccountToken(t *testing.T) {
+	token, hash, err := NewAccountToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, HashAccountToken(token))
+
+	other, _, err := NewAccountToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestLibraryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token, err := GenerateToken("user-1", "reader")
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name        string
+		requireAuth bool
+		header      string
+		wantStatus  int
+		wantUser    string
+	}{
+		{"anonymous allowed", false, "", http.StatusOK, ""},
+		{"invalid token ignored", false, "Bearer nope", http.StatusOK, ""},
+		{"anonymous rejected", true, "", http.StatusUnauthorized, ""},
+		{"invalid token rejected", true, "Bearer nope", http.StatusUnauthorized, ""},
+		{"token accepted", true, "Bearer " + token, http.StatusOK, "user-1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			var gotUser string
+			r.GET("/books", LibraryMiddleware(tt.requireAuth), func(c *gin.Context) {
+				gotUser = GetUserID(c)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/books", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantUser, gotUser)
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/justyntemme/webby/internal/apierror"
 )
 
 const (
@@ -12,6 +14,9 @@ const (
 	ContextUserID = "user_id"
 	// ContextUsername is the key for username in gin context
 	ContextUsername = "username"
+	// ContextProfileID is the key for the active restricted profile's ID in
+	// gin context
+	ContextProfileID = "profile_id"
 )
 
 // AuthMiddleware validates JWT tokens and sets user context
@@ -19,16 +24,14 @@ func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid authorization header format")
 			return
 		}
 
@@ -36,17 +39,19 @@ func AuthMiddleware() gin.HandlerFunc {
 		claims, err := ValidateToken(tokenString)
 		if err != nil {
 			if err == ErrExpiredToken {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+				apierror.Abort(c, http.StatusUnauthorized, apierror.CodeTokenExpired, "Token expired")
 			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token")
 			}
-			c.Abort()
 			return
 		}
 
 		// Set user info in context
 		c.Set(ContextUserID, claims.UserID)
 		c.Set(ContextUsername, claims.Username)
+		if claims.ProfileID != "" {
+			c.Set(ContextProfileID, claims.ProfileID)
+		}
 
 		c.Next()
 	}
@@ -72,12 +77,25 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		if err == nil {
 			c.Set(ContextUserID, claims.UserID)
 			c.Set(ContextUsername, claims.Username)
+			if claims.ProfileID != "" {
+				c.Set(ContextProfileID, claims.ProfileID)
+			}
 		}
 
 		c.Next()
 	}
 }
 
+// LibraryMiddleware returns the middleware for the book and OPDS routes.
+// Normally auth is optional there and anonymous visitors share a public
+// library; with requireAuth every request needs a valid token.
+func LibraryMiddleware(requireAuth bool) gin.HandlerFunc {
+	if requireAuth {
+		return AuthMiddleware()
+	}
+	return OptionalAuthMiddleware()
+}
+
 // GetUserID retrieves the user ID from the gin context
 func GetUserID(c *gin.Context) string {
 	if userID, exists := c.Get(ContextUserID); exists {
@@ -93,3 +111,12 @@ func GetUsername(c *gin.Context) string {
 	}
 	return ""
 }
+
+// GetProfileID retrieves the active restricted profile's ID from the gin
+// context, or "" when the account isn't in a profile
+func GetProfileID(c *gin.Context) string {
+	if profileID, exists := c.Get(ContextProfileID); exists {
+		return profileID.(string)
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Package authz decides who may read and change a book. Handlers and
+// services ask the Policy rather than comparing owner IDs themselves, so
+// owner, share, and public rules are the same on every route.
+package authz
+
+import (
+	"errors"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+var (
+	// ErrNotVisible is returned when the user may not see the book at all.
+	// Handlers report it as not found so book IDs can't be probed.
+	ErrNotVisible = errors.New("book not visible")
+	// ErrForbidden is returned when the user can see the book but may not
+	// perform the action
+	ErrForbidden = errors.New("access denied")
+)
+
+// Action is what a caller wants to do with a book
+type Action int
+
+const (
+	// Read covers viewing a book's details, cover, content, and files
+	Read Action = iota
+	// Write covers changing or deleting the book itself
+	Write
+)
+
+// String returns the action name
+func (a Action) String() string {
+	if a == Write {
+		return "write"
+	}
+	return "read"
+}
+
+// ShareChecker reports whether a book has been shared with a user.
+// storage.Database implements it.
+type ShareChecker interface {
+	IsBookSharedWith(bookID, userID string) (bool, error)
+}
+
+// RestrictionChecker reports whether a user's content restriction hides a
+// book from them. storage.Database implements it.
+type RestrictionChecker interface {
+	IsBookHiddenFrom(bookID, userID string) (bool, error)
+}
+
+// Store is what the policy looks books up in
+type Store interface {
+	ShareChecker
+	RestrictionChecker
+}
+
+// Policy holds the book access rules:
+//
+//   - Books without an owner (uploaded before accounts existed) are public:
+//     anyone may read and change them.
+//   - Owners may read and change their books.
+//   - Books their owner made public may be read by anyone.
+//   - Users a book is shared with may read it, but not change it.
+//   - Anonymous callers on optional-auth routes may only read books without
+//     an owner or made public, and only change those without an owner.
+//   - Users with a content restriction may not read books rated above it,
+//     or unrated ones, whoever owns them. It wins over every rule above.
+type Policy struct {
+	store Store
+}
+
+// NewPolicy creates a policy that looks up shares and content restrictions
+// in store
+func NewPolicy(store Store) *Policy {
+	return &Policy{store: store}
+}
+
+// CanRead reports whether userID may read book
+func (p *Policy) CanRead(book *models.Book, userID string) bool {
+	if userID != "" {
+		// A failed lookup hides the book rather than risk showing it
+		hidden, err := p.store.IsBookHiddenFrom(book.ID, userID)
+		if err != nil || hidden {
+			return false
+		}
+	}
+	if book.UserID == "" || book.UserID == userID {
+		return true
+	}
+	if book.Visibility == models.BookVisibilityPublic {
+		return true
+	}
+	if userID == "" {
+		return false
+	}
+	shared, err := p.store.IsBookSharedWith(book.ID, userID)
+	return err == nil && shared
+}
+
+// CanWrite reports whether userID may change or delete book
+func (p *Policy) CanWrite(book *models.Book, userID string) bool {
+	return book.UserID == "" || book.UserID == userID
+}
+
+// Check returns nil if userID may perform action on book, ErrNotVisible if
+// they may not see it, and ErrForbidden if they may see it but not perform
+// the action
+func (p *Policy) Check(book *models.Book, userID string, action Action) error {
+	if !p.CanRead(book, userID) {
+		return ErrNotVisible
+	}
+	if action == Write && !p.CanWrite(book, userID) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// fakeStore maps book IDs to the users they are shared with and the users
+// whose content restriction hides them
+type fakeStore struct {
+	shares, hidden map[string][]string
+}
+
+func (f fakeStore) IsBookSharedWith(bookID, userID string) (bool, error) {
+	return contains(f.shares[bookID], userID), nil
+}
+
+func (f fakeStore) IsBookHiddenFrom(bookID, userID string) (bool, error) {
+	return contains(f.hidden[bookID], userID), nil
+}
+
+func contains(users []string, userID string) bool {
+	for _, u := range users {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPolicy(t *testing.T) {
+	policy := NewPolicy(fakeStore{
+		shares: map[string][]string{"owned": {"friend", "kid"}},
+		hidden: map[string][]string{"owned": {"kid"}, "public": {"kid"}, "kids": {"kid"}},
+	})
+	owned := &models.Book{ID: "owned", UserID: "owner"}
+	kids := &models.Book{ID: "kids", UserID: "kid"}
+	public := &models.Book{ID: "public"}
+	published := &models.Book{ID: "published", UserID: "owner", Visibility: models.BookVisibilityPublic}
+
+	tests := []struct {
+		name   string
+		book   *models.Book
+		userID string
+		read   bool
+		write  bool
+	}{
+		{"owner", owned, "owner", true, true},
+		{"shared with", owned, "friend", true, false},
+		{"stranger", owned, "stranger", false, false},
+		{"anonymous", owned, "", false, false},
+		{"public book", public, "stranger", true, true},
+		{"public book anonymous", public, "", true, true},
+		{"published book", published, "stranger", true, false},
+		{"published book anonymous", published, "", true, false},
+		{"restricted shared with", owned, "kid", false, false},
+		{"restricted public book", public, "kid", false, true},
+		{"restricted owner", kids, "kid", false, true},
+		{"published book restricted", published, "kid", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.read, policy.CanRead(tt.book, tt.userID))
+			assert.Equal(t, tt.write, policy.CanWrite(tt.book, tt.userID))
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := NewPolicy(fakeStore{
+		shares: map[string][]string{"owned": {"friend", "kid"}},
+		hidden: map[string][]string{"owned": {"kid"}},
+	})
+	owned := &models.Book{ID: "owned", UserID: "owner"}
+
+	assert.NoError(t, policy.Check(owned, "owner", Write))
+	assert.NoError(t, policy.Check(owned, "friend", Read))
+	assert.ErrorIs(t, policy.Check(owned, "friend", Write), ErrForbidden)
+	assert.ErrorIs(t, policy.Check(owned, "stranger", Read), ErrNotVisible)
+	assert.ErrorIs(t, policy.Check(owned, "stranger", Write), ErrNotVisible)
+	assert.ErrorIs(t, policy.Check(owned, "kid", Read), ErrNotVisible)
+}
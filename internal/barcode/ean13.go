@@ -0,0 +1,366 @@
+package barcode
+
+import (
+	"errors"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"io"
+	"math"
+	"strings"
+)
+
+var (
+	ErrNotFound    = errors.New("no EAN-13 barcode found in image")
+	ErrInvalidCode = errors.New("invalid EAN-13 or ISBN")
+)
+
+// EAN-13 is 95 modules wide and made up of 59 alternating bars and spaces:
+// a 3-run start guard, 6 left digits of 4 runs, a 5-run middle guard,
+// 6 right digits of 4 runs, and a 3-run end guard.
+const (
+	eanModules = 95
+	eanRuns    = 59
+)
+
+// Run widths (in modules) for each digit. Left-half digits use either the
+// L (odd parity) or G (even parity) code and start with a space; right-half
+// digits use the R code, which has the same widths as L but starts with a bar.
+var (
+	lCodes = [10][4]float64{
+		{3, 2, 1, 1}, {2, 2, 2, 1}, {2, 1, 2, 2}, {1, 4, 1, 1}, {1, 1, 3, 2},
+		{1, 2, 3, 1}, {1, 1, 1, 4}, {1, 3, 1, 2}, {1, 2, 1, 3}, {3, 1, 1, 2},
+	}
+	gCodes = [10][4]float64{
+		{1, 1, 2, 3}, {1, 2, 2, 2}, {2, 2, 1, 2}, {1, 1, 4, 1}, {2, 3, 1, 1},
+		{1, 3, 2, 1}, {4, 1, 1, 1}, {2, 1, 3, 1}, {3, 1, 2, 1}, {2, 1, 1, 3},
+	}
+)
+
+// firstDigitParity maps the L/G parity pattern of the left half to the
+// implied leading digit, which isn't encoded with bars of its own
+var firstDigitParity = map[string]int{
+	"LLLLLL": 0, "LLGLGG": 1, "LLGGLG": 2, "LLGGGL": 3, "LGLLGG": 4,
+	"LGGLLG": 5, "LGGGLL": 6, "LGLGLG": 7, "LGLGGL": 8, "LGGLGL": 9,
+}
+
+// maxDigitError is the largest summed width error (in modules) accepted when
+// matching a digit, to reject noise that happens to have the right run count
+const maxDigitError = 2.0
+
+// DecodeReader decodes an image (JPEG, PNG, or GIF) and scans it for an
+// EAN-13 barcode
+func DecodeReader(r io.Reader) (string, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return "", err
+	}
+	return Decode(img)
+}
+
+// Decode scans an image for an EAN-13 barcode and returns its 13 digits.
+// Rows are scanned first, then columns, so barcodes photographed sideways
+// or upside down are still found.
+func Decode(img image.Image) (string, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return "", ErrNotFound
+	}
+
+	gray := make([]uint8, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			gray[y*width+x] = uint8((299*r + 587*g + 114*b) / 1000 >> 8)
+		}
+	}
+
+	line := make([]uint8, max(width, height))
+	for _, i := range scanOrder(height) {
+		for x := 0; x < width; x++ {
+			line[x] = gray[i*width+x]
+		}
+		if code, ok := decodeLine(line[:width]); ok {
+			return code, nil
+		}
+	}
+	for _, i := range scanOrder(width) {
+		for y := 0; y < height; y++ {
+			line[y] = gray[y*width+i]
+		}
+		if code, ok := decodeLine(line[:height]); ok {
+			return code, nil
+		}
+	}
+
+	return "", ErrNotFound
+}
+
+// scanOrder returns line indexes to scan, starting in the middle (where
+// barcodes usually are in a photo) and working outwards
+func scanOrder(n int) []int {
+	const lines = 32
+	step := n / lines
+	if step < 1 {
+		step = 1
+	}
+
+	mid := n / 2
+	order := []int{mid}
+	for offset := step; mid-offset >= 0 || mid+offset < n; offset += step {
+		if mid-offset >= 0 {
+			order = append(order, mid-offset)
+		}
+		if mid+offset < n {
+			order = append(order, mid+offset)
+		}
+	}
+	return order
+}
+
+// decodeLine binarizes one scan line and looks for an EAN-13 in either direction
+func decodeLine(line []uint8) (string, bool) {
+	lo, hi := uint8(255), uint8(0)
+	for _, v := range line {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	if hi-lo < 32 {
+		return "", false // not enough contrast
+	}
+	threshold := lo + (hi-lo)/2
+
+	// Run-length encode, starting from the first dark pixel
+	var runs []float64
+	dark := true
+	count := 0
+	started := false
+	for _, v := range line {
+		isDark := v < threshold
+		if !started {
+			if !isDark {
+				continue
+			}
+			started = true
+		}
+		if isDark == dark {
+			count++
+			continue
+		}
+		runs = append(runs, float64(count))
+		dark = isDark
+		count = 1
+	}
+	if started {
+		runs = append(runs, float64(count))
+	}
+
+	if code, ok := decodeRuns(runs); ok {
+		return code, true
+	}
+
+	// Try the other direction for upside-down barcodes. Drop the trailing
+	// space so the reversed runs also start on a bar.
+	if len(runs)%2 == 0 {
+		runs = runs[:len(runs)-1]
+	}
+	reversed := make([]float64, len(runs))
+	for i, r := range runs {
+		reversed[len(runs)-1-i] = r
+	}
+	return decodeRuns(reversed)
+}
+
+// decodeRuns looks for an EAN-13 symbol in a sequence of run widths. Even
+// indexes are bars, odd indexes are spaces.
+func decodeRuns(runs []float64) (string, bool) {
+	for start := 0; start+eanRuns <= len(runs); start += 2 {
+		if code, ok := decodeSymbol(runs[start : start+eanRuns]); ok {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// decodeSymbol decodes exactly 59 runs beginning with the start guard
+func decodeSymbol(runs []float64) (string, bool) {
+	var total float64
+	for _, r := range runs {
+		total += r
+	}
+	module := total / eanModules
+
+	// Guards are single-module bars and spaces
+	isGuard := func(rs []float64) bool {
+		for _, r := range rs {
+			if r < module*0.4 || r > module*2 {
+				return false
+			}
+		}
+		return true
+	}
+	if !isGuard(runs[0:3]) || !isGuard(runs[27:32]) || !isGuard(runs[56:59]) {
+		return "", false
+	}
+
+	digits := make([]byte, 13)
+	parity := make([]byte, 6)
+	for i := 0; i < 6; i++ {
+		d, g, ok := matchDigit(runs[3+i*4:7+i*4], true)
+		if !ok {
+			return "", false
+		}
+		digits[i+1] = byte('0' + d)
+		parity[i] = 'L'
+		if g {
+			parity[i] = 'G'
+		}
+	}
+	for i := 0; i < 6; i++ {
+		d, _, ok := matchDigit(runs[32+i*4:36+i*4], false)
+		if !ok {
+			return "", false
+		}
+		digits[i+7] = byte('0' + d)
+	}
+
+	first, ok := firstDigitParity[string(parity)]
+	if !ok {
+		return "", false
+	}
+	digits[0] = byte('0' + first)
+
+	code := string(digits)
+	if !ValidEAN13(code) {
+		return "", false
+	}
+	return code, true
+}
+
+// matchDigit finds the digit whose pattern best matches four runs. For the
+// left half, G codes are also tried and reported.
+func matchDigit(runs []float64, left bool) (digit int, even bool, ok bool) {
+	var sum float64
+	for _, r := range runs {
+		sum += r
+	}
+	if sum == 0 {
+		return 0, false, false
+	}
+
+	best := math.MaxFloat64
+	try := func(codes *[10][4]float64, isG bool) {
+		for d, code := range codes {
+			var diff float64
+			for i, r := range runs {
+				diff += math.Abs(r*7/sum - code[i])
+			}
+			if diff < best {
+				best, digit, even = diff, d, isG
+			}
+		}
+	}
+	try(&lCodes, false)
+	if left {
+		try(&gCodes, true)
+	}
+
+	return digit, even, best <= maxDigitError
+}
+
+// ValidEAN13 reports whether code is 13 digits with a correct check digit
+func ValidEAN13(code string) bool {
+	if len(code) != 13 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 13; i++ {
+		c := code[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// IsISBN reports whether an EAN-13 is in the Bookland (978/979) range
+func IsISBN(ean string) bool {
+	return strings.HasPrefix(ean, "978") || strings.HasPrefix(ean, "979")
+}
+
+// NormalizeISBN cleans up a scanned or typed code and returns it as an
+// ISBN-13. Accepts EAN-13 digits or an ISBN-10, with or without hyphens.
+func NormalizeISBN(raw string) (string, error) {
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(raw)))
+
+	switch len(code) {
+	case 13:
+		if !ValidEAN13(code) || !IsISBN(code) {
+			return "", ErrInvalidCode
+		}
+		return code, nil
+	case 10:
+		return ISBN10To13(code)
+	}
+	return "", ErrInvalidCode
+}
+
+// ISBN10To13 converts an ISBN-10 (validating its check digit) to ISBN-13
+func ISBN10To13(isbn10 string) (string, error) {
+	if len(isbn10) != 10 {
+		return "", ErrInvalidCode
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		c := isbn10[i]
+		var d int
+		switch {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c == 'X' && i == 9:
+			d = 10
+		default:
+			return "", ErrInvalidCode
+		}
+		sum += d * (10 - i)
+	}
+	if sum%11 != 0 {
+		return "", ErrInvalidCode
+	}
+
+	body := "978" + isbn10[:9]
+	check := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		check += d
+	}
+	return body + string(rune('0'+(10-check%10)%10)), nil
+}
+
+// ISBN13To10 converts a 978-prefixed ISBN-13 to ISBN-10. Returns an empty
+// string for 979 ISBNs, which have no ISBN-10 form.
+func ISBN13To10(isbn13 string) string {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return ""
+	}
+	body := isbn13[3:12]
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X"
+	}
+	return body + string(rune('0'+check))
+}
@@ -0,0 +1,157 @@
+package barcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// renderEAN13 draws a barcode with the given module width and quiet zones
+func renderEAN13(t *testing.T, code string, moduleWidth, height int) *image.Gray {
+	t.Helper()
+	require.True(t, ValidEAN13(code))
+
+	var parity string
+	for p, d := range firstDigitParity {
+		if d == int(code[0]-'0') {
+			parity = p
+		}
+	}
+
+	// Build module widths as alternating runs, starting with a bar
+	runs := []float64{1, 1, 1}
+	for i := 1; i <= 6; i++ {
+		d := code[i] - '0'
+		if parity[i-1] == 'G' {
+			runs = append(runs, gCodes[d][:]...)
+		} else {
+			runs = append(runs, lCodes[d][:]...)
+		}
+	}
+	runs = append(runs, 1, 1, 1, 1, 1)
+	for i := 7; i <= 12; i++ {
+		runs = append(runs, lCodes[code[i]-'0'][:]...)
+	}
+	runs = append(runs, 1, 1, 1)
+
+	quiet := 10 * moduleWidth
+	img := image.NewGray(image.Rect(0, 0, eanModules*moduleWidth+2*quiet, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	x := quiet
+	for i, r := range runs {
+		w := int(r) * moduleWidth
+		if i%2 == 0 {
+			for dx := 0; dx < w; dx++ {
+				for y := 0; y < height; y++ {
+					img.SetGray(x+dx, y, color.Gray{Y: 20})
+				}
+			}
+		}
+		x += w
+	}
+	return img
+}
+
+// rotate90 returns the image rotated a quarter turn clockwise
+func rotate90(src *image.Gray) *image.Gray {
+	b := src.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetGray(b.Dy()-1-y, x, src.GrayAt(x, y))
+		}
+	}
+	return dst
+}
+
+// rotate180 returns the image turned upside down
+func rotate180(src *image.Gray) *image.Gray {
+	b := src.Bounds()
+	dst := image.NewGray(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetGray(b.Dx()-1-x, b.Dy()-1-y, src.GrayAt(x, y))
+		}
+	}
+	return dst
+}
+
+func TestDecode(t *testing.T) {
+	codes := []string{"9780306406157", "9781861972712", "9791032305690", "4006381333931"}
+
+	for _, code := range codes {
+		img := renderEAN13(t, code, 3, 60)
+
+		got, err := Decode(img)
+		require.NoError(t, err, code)
+		assert.Equal(t, code, got)
+
+		got, err = Decode(rotate180(img))
+		require.NoError(t, err, code)
+		assert.Equal(t, code, got, "upside down")
+
+		got, err = Decode(rotate90(img))
+		require.NoError(t, err, code)
+		assert.Equal(t, code, got, "sideways")
+	}
+}
+
+func TestDecodeReader(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, renderEAN13(t, "9780306406157", 2, 40)))
+
+	got, err := DecodeReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "9780306406157", got)
+}
+
+func TestDecodeNoBarcode(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i % 7 * 30)
+	}
+
+	_, err := Decode(img)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"9780306406157", "9780306406157", false},
+		{"978-0-306-40615-7", "9780306406157", false},
+		{"0306406152", "9780306406157", false},
+		{"0-8044-2957-X", "9780804429573", false},
+		{"9780306406158", "", true}, // bad check digit
+		{"0306406153", "", true},    // bad ISBN-10 check digit
+		{"4006381333931", "", true}, // valid EAN-13, but not a book
+		{"12345", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeISBN(tt.input)
+		if tt.wantErr {
+			assert.Error(t, err, tt.input)
+			continue
+		}
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestISBN13To10(t *testing.T) {
+	assert.Equal(t, "0306406152", ISBN13To10("9780306406157"))
+	assert.Equal(t, "080442957X", ISBN13To10("9780804429573"))
+	assert.Equal(t, "", ISBN13To10("9791032305690"))
+}
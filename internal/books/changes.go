@@ -0,0 +1,57 @@
+package books
+
+import (
+	"strconv"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// metadataFields are the book fields metadata updates change, by their JSON
+// names, with how to read and set each as a string
+var metadataFields = []struct {
+	name  string
+	value func(*models.Book) string
+	set   func(*models.Book, string)
+}{
+	{"title", func(b *models.Book) string { return b.Title }, func(b *models.Book, v string) { b.Title = v }},
+	{"author", func(b *models.Book) string { return b.Author }, func(b *models.Book, v string) { b.Author = v }},
+	{"series", func(b *models.Book) string { return b.Series }, func(b *models.Book, v string) { b.Series = v }},
+	{"series_index", func(b *models.Book) string {
+		if b.SeriesIndex == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(b.SeriesIndex, 'f', -1, 64)
+	}, func(b *models.Book, v string) {
+		b.SeriesIndex, _ = strconv.ParseFloat(v, 64) // "" is no index
+	}},
+	{"isbn", func(b *models.Book) string { return b.ISBN }, func(b *models.Book, v string) { b.ISBN = v }},
+	{"publisher", func(b *models.Book) string { return b.Publisher }, func(b *models.Book, v string) { b.Publisher = v }},
+	{"publish_date", func(b *models.Book) string { return b.PublishDate }, func(b *models.Book, v string) { b.PublishDate = v }},
+	{"description", func(b *models.Book) string { return b.Description }, func(b *models.Book, v string) { b.Description = v }},
+	{"language", func(b *models.Book) string { return b.Language }, func(b *models.Book, v string) { b.Language = v }},
+	{"subjects", func(b *models.Book) string { return b.Subjects }, func(b *models.Book, v string) { b.Subjects = v }},
+}
+
+// MetadataChanges lists the metadata fields that differ between a book and
+// its updated copy, in a fixed order
+func MetadataChanges(old, updated *models.Book) []models.FieldChange {
+	var changes []models.FieldChange
+	for _, f := range metadataFields {
+		if before, after := f.value(old), f.value(updated); before != after {
+			changes = append(changes, models.FieldChange{Field: f.name, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// RevertMetadataChanges sets the fields changes changed back to their old
+// values. Fields that aren't metadata are ignored.
+func RevertMetadataChanges(book *models.Book, changes []models.FieldChange) {
+	for _, change := range changes {
+		for _, f := range metadataFields {
+			if f.name == change.Field {
+				f.set(book, change.Old)
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package books
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestMetadataChanges(t *testing.T) {
+	old := &models.Book{Title: "Dune", Author: "Unknown", SeriesIndex: 1}
+	updated := &models.Book{Title: "Dune", Author: "Frank Herbert", Publisher: "Ace"}
+
+	changes := MetadataChanges(old, updated)
+	assert.Equal(t, []models.FieldChange{
+		{Field: "author", Old: "Unknown", New: "Frank Herbert"},
+		{Field: "series_index", Old: "1", New: ""},
+		{Field: "publisher", Old: "", New: "Ace"},
+	}, changes)
+	assert.Empty(t, MetadataChanges(old, old))
+
+	// Reverting the changes brings the old values back
+	RevertMetadataChanges(updated, append(changes, models.FieldChange{Field: "read_status", Old: "reading"}))
+	assert.Equal(t, old, updated)
+}
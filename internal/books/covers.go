@@ -0,0 +1,58 @@
+package books
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// Covers bigger than CoverMaxWidth by CoverMaxHeight, or than
+// coverMaxBytes, are scaled down and saved as JPEG. Some EPUBs embed
+// covers of several megabytes that list views would otherwise download
+// whole.
+const (
+	CoverMaxWidth  = 800
+	CoverMaxHeight = 1200
+
+	coverMaxBytes = 400 * 1024
+	coverQuality  = 85
+)
+
+// OptimizeCover returns a cover scaled to fit CoverMaxWidth by
+// CoverMaxHeight and re-encoded as JPEG, with its extension, if it's
+// oversized and that makes it smaller. Otherwise, or if the image can't be
+// decoded, it returns the cover unchanged.
+func OptimizeCover(data []byte, ext string) ([]byte, string) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, ext
+	}
+	if cfg.Width <= CoverMaxWidth && cfg.Height <= CoverMaxHeight && len(data) <= coverMaxBytes {
+		return data, ext
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, ext
+	}
+	width, height := cfg.Width, cfg.Height
+	scale := min(1, float64(CoverMaxWidth)/float64(width), float64(CoverMaxHeight)/float64(height))
+	width, height = max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+
+	// JPEG has no transparency, so transparent covers are laid on white
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: coverQuality}); err != nil {
+		return data, ext
+	}
+	if buf.Len() >= len(data) {
+		return data, ext
+	}
+	return buf.Bytes(), ".jpg"
+}
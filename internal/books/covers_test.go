@@ -0,0 +1,48 @@
+package books
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimizeCover(t *testing.T) {
+	// Noise, which PNG can't compress, as in a scanned cover
+	rng := rand.New(rand.NewPCG(1, 2))
+	encode := func(w, h int) []byte {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.Set(x, y, color.NRGBA{uint8(rng.IntN(256)), uint8(y), uint8(x), 0xff})
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+
+	big := encode(1600, 2400)
+	data, ext := OptimizeCover(big, ".png")
+	assert.Equal(t, ".jpg", ext)
+	assert.Less(t, len(data), len(big))
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, CoverMaxWidth, cfg.Width)
+	assert.Equal(t, CoverMaxHeight, cfg.Height)
+
+	small := encode(200, 300)
+	data, ext = OptimizeCover(small, ".png")
+	assert.Equal(t, small, data, "small covers are kept as they are")
+	assert.Equal(t, ".png", ext)
+
+	data, ext = OptimizeCover([]byte("not an image"), ".jpg")
+	assert.Equal(t, []byte("not an image"), data)
+	assert.Equal(t, ".jpg", ext)
+}
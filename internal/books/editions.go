@@ -0,0 +1,159 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/pdf"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// ErrEditionExists is returned when a book already has a file in the
+// format of a new edition
+var ErrEditionExists = errors.New("book already has a file in this format")
+
+// EditionFormat is like FileFormat but also accepts formats that can only
+// be kept as an extra edition
+func EditionFormat(filename string) (format, ext string, ok bool) {
+	if format, ext, ok := FileFormat(filename); ok {
+		return format, ext, true
+	}
+	if strings.HasSuffix(strings.ToLower(filename), ".mobi") {
+		return models.FileFormatMOBI, ".mobi", true
+	}
+	return "", "", false
+}
+
+// AddEdition attaches the file read from r to book as another edition of
+// the same work. The book's metadata and main file are unchanged. Once ctx
+// is done the edition is dropped and ctx's error returned.
+func (i *Importer) AddEdition(ctx context.Context, book *models.Book, r io.Reader, filename string, size int64) (*models.BookFile, error) {
+	format, ext, ok := EditionFormat(filename)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+	if err := i.checkNewEdition(book, format); err != nil {
+		return nil, err
+	}
+
+	savedPath, err := i.files.SaveEdition(book.ID, contextReader{ctx, r}, format, ext)
+	if err != nil {
+		return nil, fmt.Errorf("save file: %w", err)
+	}
+
+	// The contents may show a different format than the name did
+	sniffed, filePath, err := resolveFormat(savedPath, format, true)
+	if err != nil {
+		i.files.DeleteFile(savedPath)
+		return nil, err
+	}
+	if sniffed != format {
+		if err := i.checkNewEdition(book, sniffed); err != nil {
+			i.files.DeleteFile(filePath)
+			return nil, err
+		}
+		format = sniffed
+	}
+
+	err = validateFile(filePath, format)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		i.files.DeleteFile(filePath)
+		return nil, err
+	}
+
+	edition := &models.BookFile{
+		ID:         uuid.New().String(),
+		BookID:     book.ID,
+		FileFormat: format,
+		FilePath:   filePath,
+		FileSize:   size,
+		CreatedAt:  time.Now(),
+	}
+	edition.FileHash, err = storage.HashFile(filePath)
+	if ctx.Err() != nil {
+		i.files.DeleteFile(filePath)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Warning: failed to compute hash for %s: %v", filePath, err)
+	} else {
+		edition.FilePath = i.storeObject(filePath, edition.FileHash)
+	}
+	if err := i.store.CreateBookFile(edition); err != nil {
+		i.files.DeleteFile(edition.FilePath)
+		return nil, fmt.Errorf("save edition: %w", err)
+	}
+	return edition, nil
+}
+
+// checkNewEdition returns ErrEditionExists if book already has a file in
+// format
+func (i *Importer) checkNewEdition(book *models.Book, format string) error {
+	if format == book.FileFormat {
+		return ErrEditionExists
+	}
+	existing, err := i.store.GetBookFiles(book.ID)
+	if err != nil {
+		return err
+	}
+	for _, f := range existing {
+		if f.FileFormat == format {
+			return ErrEditionExists
+		}
+	}
+	return nil
+}
+
+// validateFile checks that the file at filePath is valid for format
+func validateFile(filePath, format string) error {
+	var err error
+	switch format {
+	case models.FileFormatEPUB:
+		err = epub.ValidateEPUB(filePath)
+	case models.FileFormatPDF:
+		err = pdf.ValidatePDF(filePath)
+	case models.FileFormatCBZ:
+		err = cbz.ValidateCBZ(filePath)
+	case models.FileFormatCBR:
+		err = cbz.ValidateCBR(filePath)
+	case models.FileFormatMOBI:
+		err = validateMOBI(filePath)
+	}
+	if err != nil {
+		return &InvalidFileError{"Invalid " + strings.ToUpper(format) + " file", err}
+	}
+	return nil
+}
+
+// validateMOBI checks for the BOOKMOBI type and creator in a MOBI file's
+// Palm database header
+func validateMOBI(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 68)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if string(header[60:68]) != "BOOKMOBI" {
+		return errors.New("not a MOBI file")
+	}
+	return nil
+}
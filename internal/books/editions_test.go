@@ -0,0 +1,64 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// testMOBI builds the start of a MOBI file: a Palm database header with the
+// BOOKMOBI type and creator
+func testMOBI() []byte {
+	header := make([]byte, 78)
+	copy(header, "Some Book")
+	copy(header[60:], "BOOKMOBI")
+	return header
+}
+
+func TestAddEdition(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	data := testEPUB(t)
+	book, err := importer.Import(context.Background(), bytes.NewReader(data), "book.epub", int64(len(data)), "user-1")
+	require.NoError(t, err)
+
+	mobi := testMOBI()
+	edition, err := importer.AddEdition(context.Background(), book, bytes.NewReader(mobi), "Book.MOBI", int64(len(mobi)))
+	require.NoError(t, err)
+	assert.Equal(t, book.ID, edition.BookID)
+	assert.Equal(t, models.FileFormatMOBI, edition.FileFormat)
+	assert.NotEmpty(t, edition.FileHash)
+	assert.Len(t, store.editions, 1)
+	assert.Len(t, store.created, 1, "no new book is created")
+
+	_, err = importer.AddEdition(context.Background(), book, bytes.NewReader(mobi), "again.mobi", int64(len(mobi)))
+	assert.ErrorIs(t, err, ErrEditionExists)
+
+	_, err = importer.AddEdition(context.Background(), book, bytes.NewReader(data), "same.epub", int64(len(data)))
+	assert.ErrorIs(t, err, ErrEditionExists, "the main file's format counts too")
+}
+
+func TestAddEditionRejectsBadFiles(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+	book := &models.Book{ID: "book-1", FileFormat: models.FileFormatEPUB}
+
+	_, err := importer.AddEdition(context.Background(), book, strings.NewReader("text"), "notes.txt", 4)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	_, err = importer.AddEdition(context.Background(), book, strings.NewReader("not a mobi file"), "book.mobi", 15)
+	var invalid *InvalidFileError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "Invalid MOBI file", invalid.Message)
+	assert.Len(t, files.deleted, 1, "the saved file is removed")
+	assert.Empty(t, store.editions)
+}
@@ -0,0 +1,350 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/locale"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/pdf"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// ErrUnsupportedFormat is returned when a file isn't EPUB, PDF, CBZ, or CBR
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// InvalidFileError is returned when a file has a supported extension but
+// can't be validated or parsed
+type InvalidFileError struct {
+	Message string
+	Err     error
+}
+
+func (e *InvalidFileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *InvalidFileError) Unwrap() error {
+	return e.Err
+}
+
+// ImportStore is the subset of storage.Database an import, file
+// replacement, or new edition uses
+type ImportStore interface {
+	StructureStore
+	CreateBook(book *models.Book) error
+	UpdateBookFile(book *models.Book) error
+	CreateBookFile(file *models.BookFile) error
+	GetBookFiles(bookID string) ([]models.BookFile, error)
+	GetSeriesReadingDirection(userID, series string) (string, error)
+	GetReadingPositionsForBook(bookID string) ([]models.ReadingPosition, error)
+	SaveReadingPosition(pos *models.ReadingPosition) error
+}
+
+// ImportFiles stores a book's file and cover on disk
+type ImportFiles interface {
+	SaveBookWithExt(id string, reader io.Reader, ext string) (string, error)
+	SaveCover(id string, data []byte, ext string) (string, error)
+	ReplaceBookFile(id, oldPath, stagedPath, ext string) (string, error)
+	SaveEdition(id string, reader io.Reader, format, ext string) (string, error)
+	StoreObject(path, hash string) (string, error)
+	DeleteFile(path string) error
+	DeleteBook(bookID string) error
+}
+
+// Importer adds book files to the library. The upload endpoint and the
+// scan command share it so both extract metadata the same way.
+type Importer struct {
+	store ImportStore
+	files ImportFiles
+}
+
+// NewImporter creates a book importer
+func NewImporter(store ImportStore, files ImportFiles) *Importer {
+	return &Importer{store: store, files: files}
+}
+
+// FileFormat returns the file format and extension for a filename, or false
+// if the format isn't supported
+func FileFormat(filename string) (format, ext string, ok bool) {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".epub"):
+		return models.FileFormatEPUB, ".epub", true
+	case strings.HasSuffix(name, ".pdf"):
+		return models.FileFormatPDF, ".pdf", true
+	case strings.HasSuffix(name, ".cbz"):
+		return models.FileFormatCBZ, ".cbz", true
+	case strings.HasSuffix(name, ".cbr"):
+		return models.FileFormatCBR, ".cbr", true
+	}
+	return "", "", false
+}
+
+// Import saves the file read from r, extracts its metadata and cover, and
+// creates the book for userID. filename is the original name, used for the
+// format and for comic metadata parsed from the name. On failure nothing
+// is left on disk. Once ctx is done the import stops at its next step and
+// returns ctx's error, so a client that's gone doesn't hold a worker.
+func (i *Importer) Import(ctx context.Context, r io.Reader, filename string, size int64, userID string) (*models.Book, error) {
+	fileFormat, fileExt, ok := FileFormat(filename)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	bookID := uuid.New().String()
+	filePath, err := i.files.SaveBookWithExt(bookID, contextReader{ctx, r}, fileExt)
+	if err != nil {
+		return nil, fmt.Errorf("save file: %w", err)
+	}
+
+	// The extension is only a claim; the contents decide how it's parsed
+	fileFormat, filePath, err = resolveFormat(filePath, fileFormat, false)
+	if err != nil {
+		i.files.DeleteBook(bookID)
+		return nil, err
+	}
+
+	book, err := i.parse(ctx, bookID, filePath, filename, fileFormat)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		i.files.DeleteBook(bookID)
+		return nil, err
+	}
+
+	// Hash for duplicate detection; the import continues without one
+	book.FileHash, err = storage.HashFile(filePath)
+	if ctx.Err() != nil {
+		i.files.DeleteBook(bookID)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Warning: failed to compute hash for %s: %v", filePath, err)
+	} else {
+		book.FilePath = i.storeObject(filePath, book.FileHash)
+	}
+	book.UserID = userID
+	book.FileSize = size
+
+	// A series default chosen by the user wins over what the file says
+	if book.Series != "" {
+		if direction, err := i.store.GetSeriesReadingDirection(userID, book.Series); err != nil {
+			log.Printf("Warning: failed to get reading direction for series %q: %v", book.Series, err)
+		} else if direction != "" {
+			book.ReadingDirection = direction
+		}
+	}
+
+	if err := i.store.CreateBook(book); err != nil {
+		i.files.DeleteBook(bookID)
+		i.files.DeleteFile(book.FilePath)
+		return nil, fmt.Errorf("save book metadata: %w", err)
+	}
+
+	// Store the table of contents or page count now so browsing doesn't
+	// reopen the file; if this fails it's read on first use instead
+	if structure, err := ReadStructure(book.FilePath, fileFormat); err != nil {
+		log.Printf("Warning: failed to read structure of %s: %v", book.FilePath, err)
+	} else if err := SaveStructure(i.store, bookID, structure); err != nil {
+		log.Printf("Warning: failed to save structure of %s: %v", bookID, err)
+	}
+	return book, nil
+}
+
+// storeObject moves the file at filePath into the content-addressed store,
+// so a file shared by several books is kept once, and returns its new
+// path. If that fails the file stays where it is and its path is returned.
+func (i *Importer) storeObject(filePath, hash string) string {
+	stored, err := i.files.StoreObject(filePath, hash)
+	if err != nil {
+		log.Printf("Warning: failed to store %s by content: %v", filePath, err)
+		return filePath
+	}
+	return stored
+}
+
+// contextReader stops reading once ctx is done, so the rest of an upload
+// whose request has ended isn't saved
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// parse validates the saved file and builds its book from the embedded
+// metadata. It returns ctx's error if ctx is done once the file is
+// validated, before the slower parsing starts.
+func (i *Importer) parse(ctx context.Context, bookID, filePath, filename, fileFormat string) (*models.Book, error) {
+	now := time.Now()
+	book := &models.Book{
+		ID:              bookID,
+		FilePath:        filePath,
+		UploadedAt:      now,
+		FileFormat:      fileFormat,
+		MetadataUpdated: &now,
+	}
+
+	switch fileFormat {
+	case models.FileFormatEPUB:
+		if err := epub.ValidateEPUB(filePath); err != nil {
+			return nil, &InvalidFileError{"Invalid EPUB file", err}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		meta, err := epub.ParseEPUB(filePath)
+		if err != nil {
+			return nil, &InvalidFileError{"Failed to parse EPUB metadata", err}
+		}
+		if len(meta.CoverData) > 0 {
+			i.saveCover(book, meta.CoverData, meta.CoverExt)
+		}
+
+		book.Title = meta.Title
+		book.Author = meta.Author
+		book.Series = meta.Series
+		book.SeriesIndex = meta.SeriesIndex
+		book.ContentType = meta.ContentType
+		book.ISBN = meta.ISBN
+		book.Publisher = meta.Publisher
+		book.PublishDate = meta.PublishDate
+		book.Description = meta.Description
+		book.Language = meta.Language
+		if book.Language == "" {
+			book.Language = DetectLanguage(filePath)
+		}
+		book.Subjects = strings.Join(meta.Subjects, ", ")
+		book.MetadataSource = "epub"
+
+	case models.FileFormatPDF:
+		if err := pdf.ValidatePDF(filePath); err != nil {
+			return nil, &InvalidFileError{"Invalid PDF file", err}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		meta, err := pdf.ParsePDF(filePath)
+		if err != nil {
+			return nil, &InvalidFileError{"Failed to parse PDF metadata", err}
+		}
+		// Try to extract cover image from first page
+		if cover, err := pdf.ExtractCover(filePath); err == nil && len(cover.Data) > 0 {
+			i.saveCover(book, cover.Data, cover.Extension)
+		}
+
+		book.Title = meta.Title
+		book.Author = meta.Author
+		book.ContentType = meta.ContentType
+		book.Subjects = strings.Join(meta.Keywords, ", ")
+		book.MetadataSource = "pdf"
+
+	case models.FileFormatCBZ:
+		if err := cbz.ValidateCBZ(filePath); err != nil {
+			return nil, &InvalidFileError{"Invalid CBZ file", err}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		meta, err := cbz.ParseCBZ(filePath, filename)
+		if err != nil {
+			return nil, &InvalidFileError{"Failed to parse CBZ metadata", err}
+		}
+		if cover, err := cbz.ExtractCover(filePath); err == nil && len(cover.Data) > 0 {
+			i.saveCover(book, cover.Data, cover.Extension)
+		}
+
+		book.Title = meta.Title
+		book.Author = meta.Author
+		book.Series = meta.Series
+		book.SeriesIndex = meta.SeriesIndex
+		book.ContentType = models.ContentTypeComic // CBZ is always comic
+		book.MetadataSource = "cbz"
+		if meta.Manga {
+			book.ReadingDirection = models.ReadingDirectionRTL
+		}
+		book.LongStrip = meta.LongStrip
+		book.AgeRating = models.NormalizeAgeRating(meta.AgeRating)
+
+	case models.FileFormatCBR:
+		if err := cbz.ValidateCBR(filePath); err != nil {
+			return nil, &InvalidFileError{"Invalid CBR file", err}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		meta, err := cbz.ParseCBR(filePath, filename)
+		if err != nil {
+			return nil, &InvalidFileError{"Failed to parse CBR metadata", err}
+		}
+		if cover, err := cbz.ExtractCoverCBR(filePath); err == nil && len(cover.Data) > 0 {
+			i.saveCover(book, cover.Data, cover.Extension)
+		}
+
+		book.Title = meta.Title
+		book.Author = meta.Author
+		book.Series = meta.Series
+		book.SeriesIndex = meta.SeriesIndex
+		book.ContentType = models.ContentTypeComic // CBR is always comic
+		book.MetadataSource = "cbr"
+		if meta.Manga {
+			book.ReadingDirection = models.ReadingDirectionRTL
+		}
+		book.AgeRating = models.NormalizeAgeRating(meta.AgeRating)
+	}
+
+	if book.ContentType == "" {
+		book.ContentType = models.ContentTypeBook
+	}
+	return book, nil
+}
+
+// saveCover saves book's cover image, scaled down if it's oversized, and
+// records its palette. A cover that can't be saved is left out.
+func (i *Importer) saveCover(book *models.Book, data []byte, ext string) {
+	data, ext = OptimizeCover(data, ext)
+	path, err := i.files.SaveCover(book.ID, data, ext)
+	if err != nil {
+		return
+	}
+	book.CoverPath = path
+	book.CoverPalette = CoverPalette(data)
+}
+
+// detectSampleChapters and detectSampleBytes bound how much of an EPUB is
+// read to guess its language
+const (
+	detectSampleChapters = 5
+	detectSampleBytes    = 20000
+)
+
+// DetectLanguage guesses an EPUB's language from the text of its first
+// chapters, returning "" if it can't tell
+func DetectLanguage(filePath string) string {
+	var sample strings.Builder
+	for i := 0; i < detectSampleChapters && sample.Len() < detectSampleBytes; i++ {
+		text, err := epub.GetChapterText(filePath, i)
+		if err != nil {
+			break
+		}
+		sample.WriteString(text)
+		sample.WriteString(" ")
+	}
+	return locale.Detect(sample.String())
+}
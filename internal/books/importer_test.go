@@ -0,0 +1,347 @@
+package books
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// diskFiles stores imported files in a temporary directory
+type diskFiles struct {
+	dir     string
+	deleted []string
+}
+
+func (f *diskFiles) SaveBookWithExt(id string, reader io.Reader, ext string) (string, error) {
+	path := filepath.Join(f.dir, id+ext)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, reader)
+	return path, err
+}
+
+func (f *diskFiles) SaveCover(id string, data []byte, ext string) (string, error) {
+	return "", nil
+}
+
+func (f *diskFiles) ReplaceBookFile(id, oldPath, stagedPath, ext string) (string, error) {
+	newPath := filepath.Join(f.dir, id+ext)
+	if err := os.Rename(stagedPath, newPath); err != nil {
+		return "", err
+	}
+	if oldPath != newPath {
+		os.Remove(oldPath)
+	}
+	return newPath, nil
+}
+
+func (f *diskFiles) SaveEdition(id string, reader io.Reader, format, ext string) (string, error) {
+	return f.SaveBookWithExt(id+".edition-"+format, reader, ext)
+}
+
+// StoreObject keeps one copy of each file's content, named by its hash
+func (f *diskFiles) StoreObject(path, hash string) (string, error) {
+	dst := filepath.Join(f.dir, "objects", hash+filepath.Ext(path))
+	if _, err := os.Stat(dst); err == nil {
+		return dst, os.Remove(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(path, dst)
+}
+
+func (f *diskFiles) DeleteFile(path string) error {
+	f.deleted = append(f.deleted, path)
+	return os.Remove(path)
+}
+
+func (f *diskFiles) DeleteBook(bookID string) error {
+	f.deleted = append(f.deleted, bookID)
+	return nil
+}
+
+// createStore records created and updated books, their editions,
+// structures, and reading positions
+type createStore struct {
+	created    []*models.Book
+	updated    []*models.Book
+	editions   []models.BookFile
+	positions  []models.ReadingPosition
+	directions map[string]string // series -> reading direction
+	structures map[string]string // book ID -> table of contents JSON
+	pages      map[string]int
+}
+
+func (s *createStore) CreateBook(book *models.Book) error {
+	s.created = append(s.created, book)
+	return nil
+}
+
+func (s *createStore) UpdateBookFile(book *models.Book) error {
+	s.updated = append(s.updated, book)
+	delete(s.structures, book.ID)
+	return nil
+}
+
+func (s *createStore) CreateBookFile(file *models.BookFile) error {
+	s.editions = append(s.editions, *file)
+	return nil
+}
+
+func (s *createStore) GetBookFiles(bookID string) ([]models.BookFile, error) {
+	var files []models.BookFile
+	for _, f := range s.editions {
+		if f.BookID == bookID {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (s *createStore) GetReadingPositionsForBook(bookID string) ([]models.ReadingPosition, error) {
+	var positions []models.ReadingPosition
+	for _, pos := range s.positions {
+		if pos.BookID == bookID {
+			positions = append(positions, pos)
+		}
+	}
+	return positions, nil
+}
+
+func (s *createStore) SaveReadingPosition(pos *models.ReadingPosition) error {
+	for i := range s.positions {
+		if s.positions[i].BookID == pos.BookID && s.positions[i].UserID == pos.UserID {
+			s.positions[i] = *pos
+			return nil
+		}
+	}
+	s.positions = append(s.positions, *pos)
+	return nil
+}
+
+func (s *createStore) GetSeriesReadingDirection(userID, series string) (string, error) {
+	return s.directions[series], nil
+}
+
+func (s *createStore) GetBookStructure(bookID string) (string, int, bool, error) {
+	toc, ok := s.structures[bookID]
+	return toc, s.pages[bookID], ok, nil
+}
+
+func (s *createStore) SaveBookStructure(bookID, tocJSON string, pageCount int) error {
+	if s.structures == nil {
+		s.structures, s.pages = map[string]string{}, map[string]int{}
+	}
+	s.structures[bookID] = tocJSON
+	s.pages[bookID] = pageCount
+	return nil
+}
+
+// testCBZ builds a one-page CBZ in memory with the given ComicInfo.xml
+func testCBZ(t *testing.T, comicInfo string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"ComicInfo.xml": comicInfo,
+		"001.jpg":       "not really a jpeg",
+	} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// testEPUB builds a minimal EPUB in memory
+func testEPUB(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`,
+		"content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Imported Title</dc:title>
+    <dc:creator>Imported Author</dc:creator>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+  </spine>
+</package>`,
+		"ch1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Hello</p></body></html>`,
+	}
+	for name, body := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestFileFormat(t *testing.T) {
+	format, ext, ok := FileFormat("Some Book.EPUB")
+	assert.True(t, ok)
+	assert.Equal(t, models.FileFormatEPUB, format)
+	assert.Equal(t, ".epub", ext)
+
+	_, _, ok = FileFormat("notes.txt")
+	assert.False(t, ok)
+}
+
+func TestImportEPUB(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	data := testEPUB(t)
+	book, err := importer.Import(context.Background(), bytes.NewReader(data), "book.epub", int64(len(data)), "user-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Imported Title", book.Title)
+	assert.Equal(t, "Imported Author", book.Author)
+	assert.Equal(t, "en", book.Language)
+	assert.Equal(t, "user-1", book.UserID)
+	assert.Equal(t, models.ContentTypeBook, book.ContentType)
+	assert.Equal(t, models.FileFormatEPUB, book.FileFormat)
+	assert.Equal(t, int64(len(data)), book.FileSize)
+	assert.NotEmpty(t, book.FileHash)
+	assert.Len(t, store.created, 1)
+	assert.Contains(t, store.structures[book.ID], `"href":"ch1.xhtml"`, "the table of contents is stored at import")
+}
+
+func TestImportSharesIdenticalFiles(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	data := testEPUB(t)
+	first, err := importer.Import(context.Background(), bytes.NewReader(data), "book.epub", int64(len(data)), "user-1")
+	require.NoError(t, err)
+	second, err := importer.Import(context.Background(), bytes.NewReader(data), "copy.epub", int64(len(data)), "user-2")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, first.FilePath, second.FilePath, "both books use one stored copy")
+	assert.Equal(t, filepath.Join(files.dir, "objects", first.FileHash+".epub"), first.FilePath)
+
+	entries, err := os.ReadDir(files.dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.Equal(t, "objects", e.Name(), "no per-book copies are left behind")
+	}
+}
+
+func TestImportRejectsBadFiles(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	_, err := importer.Import(context.Background(), strings.NewReader("text"), "notes.txt", 4, "")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	_, err = importer.Import(context.Background(), strings.NewReader("not a zip"), "broken.epub", 9, "")
+	var invalid *InvalidFileError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "Invalid EPUB file", invalid.Message)
+	assert.Len(t, files.deleted, 1, "the saved file is removed")
+	assert.Empty(t, store.created)
+}
+
+// cancelAtEOF cancels a context once its reader has been read to the end,
+// as when a client disconnects after its upload is saved
+type cancelAtEOF struct {
+	io.Reader
+	cancel context.CancelFunc
+}
+
+func (r cancelAtEOF) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.cancel()
+	}
+	return n, err
+}
+
+func TestImportStopsWhenCancelled(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+	data := testEPUB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := importer.Import(ctx, bytes.NewReader(data), "book.epub", int64(len(data)), "")
+	assert.ErrorIs(t, err, context.Canceled, "nothing is read once the request has ended")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err = importer.Import(ctx, cancelAtEOF{bytes.NewReader(data), cancel}, "book.epub", int64(len(data)), "")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, files.deleted, 1, "the saved file is removed")
+	assert.Empty(t, store.created)
+}
+
+func TestImportReadingDirection(t *testing.T) {
+	store := &createStore{directions: map[string]string{"Western Series": models.ReadingDirectionRTL}}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	manga := testCBZ(t, `<ComicInfo><Series>Some Manga</Series><Manga>YesAndRightToLeft</Manga></ComicInfo>`)
+	book, err := importer.Import(context.Background(), bytes.NewReader(manga), "manga.cbz", int64(len(manga)), "")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadingDirectionRTL, book.ReadingDirection, "manga is read right-to-left")
+	assert.Equal(t, 1, store.pages[book.ID], "the page count is stored at import")
+
+	comic := testCBZ(t, `<ComicInfo><Series>Other Series</Series><Manga>No</Manga></ComicInfo>`)
+	book, err = importer.Import(context.Background(), bytes.NewReader(comic), "comic.cbz", int64(len(comic)), "")
+	require.NoError(t, err)
+	assert.Empty(t, book.ReadingDirection, "left to default")
+
+	comic = testCBZ(t, `<ComicInfo><Series>Western Series</Series></ComicInfo>`)
+	book, err = importer.Import(context.Background(), bytes.NewReader(comic), "comic.cbz", int64(len(comic)), "")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadingDirectionRTL, book.ReadingDirection, "series default applies")
+}
+
+func TestImportAgeRating(t *testing.T) {
+	importer := NewImporter(&createStore{}, &diskFiles{dir: t.TempDir()})
+
+	for rating, want := range map[string]string{
+		"Everyone":        models.AgeRatingAllAges,
+		"Teen":            models.AgeRatingTeen,
+		"Mature 17+":      models.AgeRatingMature,
+		"Adults Only 18+": models.AgeRatingAdult,
+		"Rating Pending":  "",
+	} {
+		comic := testCBZ(t, `<ComicInfo><Series>Some Series</Series><AgeRating>`+rating+`</AgeRating></ComicInfo>`)
+		book, err := importer.Import(context.Background(), bytes.NewReader(comic), "comic.cbz", int64(len(comic)), "")
+		require.NoError(t, err)
+		assert.Equal(t, want, book.AgeRating, rating)
+	}
+}
@@ -0,0 +1,152 @@
+package books
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/justyntemme/webby/internal/barcode"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// placeholderTitles and placeholderAuthors are what parsers and uploads
+// fill in when a file has no title or author, compared in lower case
+var (
+	placeholderTitles  = map[string]bool{"unknown": true, "unknown title": true, "untitled": true}
+	placeholderAuthors = map[string]bool{
+		"": true, "unknown": true, "unknown author": true, "[unknown]": true, "n/a": true, "none": true, "author": true,
+	}
+)
+
+// fileExtensionRe matches a title ending in a book or archive file
+// extension
+var fileExtensionRe = regexp.MustCompile(`(?i)\.(epub|pdf|cbz|cbr|mobi|azw3?|txt|zip|rar)$`)
+
+// hashLikeRe matches download and scanner names: long runs of hex digits,
+// with or without the dashes of a UUID
+var hashLikeRe = regexp.MustCompile(`(?i)^[0-9a-f-]{16,}$`)
+
+// SuspiciousTitle reports whether title looks like a file name or a
+// placeholder rather than a book's real title, as when a file had no
+// metadata and its name was used instead
+func SuspiciousTitle(title string) bool {
+	title = strings.TrimSpace(title)
+	if title == "" || placeholderTitles[strings.ToLower(title)] {
+		return true
+	}
+	if fileExtensionRe.MatchString(title) || hashLikeRe.MatchString(title) {
+		return true
+	}
+	if !strings.ContainsRune(title, ' ') {
+		// Words joined by underscores or dots instead of spaces, as in
+		// "the_great_gatsby" or "Great.Gatsby.2004", or by several dashes
+		if strings.ContainsAny(title, "_.") || strings.Count(title, "-") >= 2 {
+			return true
+		}
+	}
+	// A long number, such as an ISBN used as the file name; short ones
+	// are real titles like "1984"
+	return len(title) >= 8 && !strings.ContainsFunc(title, func(r rune) bool { return !unicode.IsDigit(r) })
+}
+
+// UnknownAuthor reports whether author is empty or a placeholder
+func UnknownAuthor(author string) bool {
+	return placeholderAuthors[strings.ToLower(strings.TrimSpace(author))]
+}
+
+// isbnKey returns the form books' ISBNs are compared in: the ISBN-13 of a
+// valid ISBN-10 or ISBN-13, or the ISBN with punctuation removed
+func isbnKey(isbn string) string {
+	if normalized, err := barcode.NormalizeISBN(isbn); err == nil {
+		return normalized
+	}
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+}
+
+// emptyFile reports whether a book's file has no content, by its recorded
+// size or the file on disk
+func emptyFile(book models.Book) bool {
+	if book.IsPhysical() {
+		return false
+	}
+	if book.FileSize == 0 {
+		return true
+	}
+	info, err := os.Stat(book.FilePath)
+	return err == nil && info.Size() == 0
+}
+
+// MetadataIssues checks each book for metadata worth fixing: ISBNs shared
+// with another book, a missing cover or description, a title that looks
+// like a file name, an empty file, and an unknown author. Paper books have
+// no file to check.
+func MetadataIssues(list []models.Book) *models.MetadataReport {
+	report := &models.MetadataReport{
+		TotalBooks:     len(list),
+		Counts:         make(map[string]int),
+		DuplicateISBNs: []models.ISBNGroup{},
+		Books:          []models.ReportedBook{},
+	}
+
+	// Books sharing an ISBN, in the order each ISBN was first seen
+	byISBN := make(map[string][]int)
+	var isbns []string
+	for i, book := range list {
+		if key := isbnKey(book.ISBN); key != "" {
+			if _, ok := byISBN[key]; !ok {
+				isbns = append(isbns, key)
+			}
+			byISBN[key] = append(byISBN[key], i)
+		}
+	}
+
+	reported := make([]models.ReportedBook, len(list))
+	for i, book := range list {
+		var issues []string
+		if len(byISBN[isbnKey(book.ISBN)]) > 1 {
+			issues = append(issues, models.MetadataIssueDuplicateISBN)
+		}
+		if book.CoverPath == "" {
+			issues = append(issues, models.MetadataIssueMissingCover)
+		}
+		if strings.TrimSpace(book.Description) == "" {
+			issues = append(issues, models.MetadataIssueMissingDescription)
+		}
+		if SuspiciousTitle(book.Title) {
+			issues = append(issues, models.MetadataIssueSuspiciousTitle)
+		}
+		if emptyFile(book) {
+			issues = append(issues, models.MetadataIssueEmptyFile)
+		}
+		if UnknownAuthor(book.Author) {
+			issues = append(issues, models.MetadataIssueUnknownAuthor)
+		}
+
+		reported[i] = models.ReportedBook{
+			ID:         book.ID,
+			Title:      book.Title,
+			Author:     book.Author,
+			ISBN:       book.ISBN,
+			FileFormat: book.FileFormat,
+			Issues:     issues,
+		}
+		for _, issue := range issues {
+			report.Counts[issue]++
+		}
+		if len(issues) > 0 {
+			report.Books = append(report.Books, reported[i])
+		}
+	}
+
+	for _, key := range isbns {
+		if indexes := byISBN[key]; len(indexes) > 1 {
+			group := models.ISBNGroup{ISBN: key}
+			for _, i := range indexes {
+				group.Books = append(group.Books, reported[i])
+			}
+			report.DuplicateISBNs = append(report.DuplicateISBNs, group)
+		}
+	}
+	return report
+}
@@ -0,0 +1,81 @@
+package books
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestSuspiciousTitle(t *testing.T) {
+	for title, want := range map[string]bool{
+		"Dune":                                 false,
+		"1984":                                 false,
+		"11/22/63":                             false,
+		"Mr. Penumbra's 24-Hour Bookstore":     false,
+		"Catch-22":                             false,
+		"":                                     true,
+		"Unknown":                              true,
+		"dune.epub":                            true,
+		"the_great_gatsby":                     true,
+		"Great.Gatsby.2004":                    true,
+		"the-great-gatsby":                     true,
+		"9780441013593":                        true,
+		"3f2504e0-4f89-11d3-9a0c-0305e82c3301": true,
+	} {
+		assert.Equal(t, want, SuspiciousTitle(title), title)
+	}
+
+	assert.True(t, UnknownAuthor(" unknown author "))
+	assert.True(t, UnknownAuthor(""))
+	assert.False(t, UnknownAuthor("Anonymous"))
+}
+
+func TestMetadataIssues(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	list := []models.Book{
+		{ID: "dune", Title: "Dune", Author: "Frank Herbert", ISBN: "0-441-01359-7", Description: "Spice.",
+			CoverPath: "dune.jpg", FilePath: file("dune.epub", "epub"), FileSize: 4, FileFormat: models.FileFormatEPUB},
+		{ID: "dune-pdf", Title: "Dune", Author: "Frank Herbert", ISBN: "978-0441013593",
+			CoverPath: "dune.jpg", FilePath: file("dune.pdf", "pdf"), FileSize: 3, FileFormat: models.FileFormatPDF},
+		{ID: "scan", Title: "scan_0042", Author: "Unknown", Description: "?",
+			FilePath: file("scan.cbz", ""), FileSize: 10, FileFormat: models.FileFormatCBZ},
+		{ID: "paper", Title: "Emma", Author: "Jane Austen", Description: "Matchmaking.", CoverPath: "emma.jpg",
+			ContentSource: models.ContentSourcePhysical},
+	}
+
+	report := MetadataIssues(list)
+	assert.Equal(t, 4, report.TotalBooks)
+	assert.Equal(t, map[string]int{
+		models.MetadataIssueDuplicateISBN:      2,
+		models.MetadataIssueMissingCover:       1,
+		models.MetadataIssueMissingDescription: 1,
+		models.MetadataIssueSuspiciousTitle:    1,
+		models.MetadataIssueEmptyFile:          1,
+		models.MetadataIssueUnknownAuthor:      1,
+	}, report.Counts)
+
+	require.Len(t, report.DuplicateISBNs, 1, "an ISBN-10 matches its ISBN-13")
+	assert.Equal(t, "9780441013593", report.DuplicateISBNs[0].ISBN)
+	assert.Len(t, report.DuplicateISBNs[0].Books, 2)
+
+	require.Len(t, report.Books, 3, "the paper book has nothing to fix")
+	assert.Equal(t, []string{models.MetadataIssueDuplicateISBN}, report.Books[0].Issues)
+	assert.Equal(t, []string{models.MetadataIssueDuplicateISBN, models.MetadataIssueMissingDescription}, report.Books[1].Issues)
+	assert.Equal(t, []string{
+		models.MetadataIssueMissingCover,
+		models.MetadataIssueSuspiciousTitle,
+		models.MetadataIssueEmptyFile,
+		models.MetadataIssueUnknownAuthor,
+	}, report.Books[2].Issues, "a file emptied on disk is caught despite its recorded size")
+}
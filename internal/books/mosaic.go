@@ -0,0 +1,93 @@
+package books
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// A cover mosaic is MosaicCovers covers in a 2 by 2 grid, each tile the
+// usual 2:3 shape of a book cover, so the mosaic is one too
+const (
+	MosaicCovers = 4
+
+	mosaicTileWidth  = 300
+	mosaicTileHeight = 450
+	mosaicGap        = 4
+	mosaicQuality    = 85
+)
+
+// mosaicBackground shows in the gaps and in tiles without a cover
+var mosaicBackground = color.RGBA{0x2a, 0x2a, 0x2e, 0xff}
+
+// ErrNoCovers is returned by CoverMosaic when none of the covers can be read
+var ErrNoCovers = errors.New("no covers to make a mosaic from")
+
+// CoverMosaic lays up to MosaicCovers cover images out in a grid and
+// returns it as a JPEG, for collections, tags and reading lists. Covers are
+// cropped to fill their tile, left to right and top to bottom; covers that
+// can't be read are skipped, and tiles left over stay empty.
+func CoverMosaic(coverPaths []string) ([]byte, error) {
+	width := 2*mosaicTileWidth + mosaicGap
+	height := 2*mosaicTileHeight + mosaicGap
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(mosaicBackground), image.Point{}, draw.Src)
+
+	tiles := 0
+	for _, path := range coverPaths {
+		if tiles == MosaicCovers {
+			break
+		}
+		src, err := decodeCover(path)
+		if err != nil {
+			continue
+		}
+		x := (tiles % 2) * (mosaicTileWidth + mosaicGap)
+		y := (tiles / 2) * (mosaicTileHeight + mosaicGap)
+		tile := image.Rect(x, y, x+mosaicTileWidth, y+mosaicTileHeight)
+		// Transparent covers are laid on white, as OptimizeCover does
+		draw.Draw(dst, tile, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, tile, src, cropToFill(src.Bounds(), tile), draw.Over, nil)
+		tiles++
+	}
+	if tiles == 0 {
+		return nil, ErrNoCovers
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: mosaicQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCover reads the cover image at path
+func decodeCover(path string) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// cropToFill returns the middle of src with the shape of tile, so scaling
+// it into tile fills the tile without stretching
+func cropToFill(src, tile image.Rectangle) image.Rectangle {
+	sw, sh := src.Dx(), src.Dy()
+	tw, th := tile.Dx(), tile.Dy()
+	if sw*th > sh*tw {
+		// Wider than the tile: trim the sides
+		w := sh * tw / th
+		x := src.Min.X + (sw-w)/2
+		return image.Rect(x, src.Min.Y, x+w, src.Max.Y)
+	}
+	h := sw * th / tw
+	y := src.Min.Y + (sh-h)/2
+	return image.Rect(src.Min.X, y, src.Max.X, y+h)
+}
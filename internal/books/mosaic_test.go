@@ -0,0 +1,65 @@
+package books
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverMosaic(t *testing.T) {
+	dir := t.TempDir()
+	writeCover := func(name string, w, h int, c color.Color) string {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+		return path
+	}
+	red := writeCover("red.png", 200, 300, color.RGBA{0xff, 0, 0, 0xff})
+	blue := writeCover("blue.png", 400, 200, color.RGBA{0, 0, 0xff, 0xff})
+	broken := filepath.Join(dir, "broken.jpg")
+	require.NoError(t, os.WriteFile(broken, []byte("not an image"), 0644))
+
+	data, err := CoverMosaic([]string{red, broken, blue, filepath.Join(dir, "missing.jpg")})
+	require.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 2*mosaicTileWidth+mosaicGap, img.Bounds().Dx())
+	assert.Equal(t, 2*mosaicTileHeight+mosaicGap, img.Bounds().Dy())
+
+	near := func(x, y int, want color.RGBA) {
+		r, g, b, _ := img.At(x, y).RGBA()
+		got := []int{int(r >> 8), int(g >> 8), int(b >> 8)}
+		for i, w := range []uint8{want.R, want.G, want.B} {
+			assert.InDelta(t, int(w), got[i], 24, "pixel at %d,%d", x, y)
+		}
+	}
+	// Unreadable covers are skipped, so blue takes the second tile
+	near(mosaicTileWidth/2, mosaicTileHeight/2, color.RGBA{0xff, 0, 0, 0xff})
+	near(mosaicTileWidth+mosaicGap+mosaicTileWidth/2, mosaicTileHeight/2, color.RGBA{0, 0, 0xff, 0xff})
+	near(mosaicTileWidth/2, mosaicTileHeight+mosaicGap+mosaicTileHeight/2, mosaicBackground)
+
+	_, err = CoverMosaic([]string{broken})
+	assert.ErrorIs(t, err, ErrNoCovers)
+}
+
+func TestCropToFill(t *testing.T) {
+	tile := image.Rect(0, 0, 300, 450)
+	assert.Equal(t, image.Rect(50, 0, 250, 300), cropToFill(image.Rect(0, 0, 300, 300), tile))
+	assert.Equal(t, image.Rect(0, 75, 200, 375), cropToFill(image.Rect(0, 0, 200, 450), tile))
+	assert.Equal(t, image.Rect(0, 0, 200, 300), cropToFill(image.Rect(0, 0, 200, 300), tile))
+}
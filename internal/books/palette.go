@@ -0,0 +1,103 @@
+package books
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"sort"
+
+	_ "golang.org/x/image/bmp"  // register BMP decoder
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+const (
+	// paletteColors is how many dominant colors a cover's palette holds
+	paletteColors = 5
+	// paletteSamples is roughly how many pixels along each side of a cover
+	// are sampled; more only slows imports without changing the result
+	paletteSamples = 64
+	// paletteMinDistance is how far apart, in RGB, palette colors must be,
+	// so a gradient doesn't fill the palette with shades of one color
+	paletteMinDistance = 48
+)
+
+// CoverPalette returns the dominant colors of a cover image as "#rrggbb"
+// strings, the most common first, for clients to show as a placeholder
+// while the image loads. It returns nil if the image can't be decoded.
+func CoverPalette(data []byte) []string {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil
+	}
+
+	// Pixels are counted in buckets of similar colors, each remembering
+	// the average of what fell in it
+	type bucket struct {
+		key        int
+		r, g, b, n int
+	}
+	buckets := make(map[int]*bucket)
+	step := max(1, max(bounds.Dx(), bounds.Dy())/paletteSamples)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue // Mostly transparent
+			}
+			r, g, b = r>>8, g>>8, b>>8
+			key := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{key: key}
+				buckets[key] = bk
+			}
+			bk.r += int(r)
+			bk.g += int(g)
+			bk.b += int(b)
+			bk.n++
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].n != sorted[j].n {
+			return sorted[i].n > sorted[j].n
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	var chosen [][3]int
+	for _, bk := range sorted {
+		c := [3]int{bk.r / bk.n, bk.g / bk.n, bk.b / bk.n}
+		distinct := true
+		for _, prev := range chosen {
+			dr, dg, db := c[0]-prev[0], c[1]-prev[1], c[2]-prev[2]
+			if dr*dr+dg*dg+db*db < paletteMinDistance*paletteMinDistance {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			chosen = append(chosen, c)
+			if len(chosen) == paletteColors {
+				break
+			}
+		}
+	}
+
+	palette := make([]string, len(chosen))
+	for i, c := range chosen {
+		palette[i] = fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+	}
+	return palette
+}
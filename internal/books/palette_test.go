@@ -0,0 +1,39 @@
+package books
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverPalette(t *testing.T) {
+	// Mostly navy with a cream band and a few near-navy pixels that
+	// shouldn't show up as a color of their own
+	img := image.NewRGBA(image.Rect(0, 0, 100, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 100; x++ {
+			c := color.RGBA{0x1d, 0x2b, 0x3a, 0xff}
+			switch {
+			case y >= 100:
+				c = color.RGBA{0xe8, 0xd5, 0xa4, 0xff}
+			case x < 10:
+				c = color.RGBA{0x22, 0x30, 0x40, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	palette := CoverPalette(buf.Bytes())
+	require.Len(t, palette, 2)
+	assert.Equal(t, "#1d2b3a", palette[0])
+	assert.Equal(t, "#e8d5a4", palette[1])
+
+	assert.Nil(t, CoverPalette([]byte("not an image")))
+}
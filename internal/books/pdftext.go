@@ -0,0 +1,43 @@
+package books
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/pdf"
+)
+
+// LoadPDFText returns the text of every page of a PDF from the cache file
+// at cachePath, extracting and caching it when there is none or the PDF's
+// file has changed since
+func LoadPDFText(cachePath string, book *models.Book) ([]pdf.PageText, error) {
+	if book.FileFormat != models.FileFormatPDF {
+		return nil, fmt.Errorf("%s files have no PDF text", book.FileFormat)
+	}
+	file, err := os.Stat(book.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	if cached, err := os.Stat(cachePath); err == nil && cached.ModTime().After(file.ModTime()) {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var pages []pdf.PageText
+			if json.Unmarshal(data, &pages) == nil {
+				return pages, nil
+			}
+		}
+	}
+
+	pages, err := pdf.ExtractText(book.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed cache write only costs extracting it again next time
+	if err := writeCache(cachePath, pages); err != nil {
+		log.Printf("Warning: failed to cache PDF text for book %s: %v", book.ID, err)
+	}
+	return pages, nil
+}
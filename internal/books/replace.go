@@ -0,0 +1,268 @@
+package books
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// Replace swaps book's file for the one read from r, such as a retail EPUB
+// for a scanned PDF, keeping the book's ID and everything attached to it.
+// Metadata is re-parsed from the new file, with fields it leaves empty kept
+// from the book, and each reader's position is moved to the same point in
+// the new file. On failure, or once ctx is done before the new file is in
+// place, the book and its file are unchanged.
+func (i *Importer) Replace(ctx context.Context, book *models.Book, r io.Reader, filename string, size int64) (*models.Book, error) {
+	fileFormat, fileExt, ok := FileFormat(filename)
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Positions are placed using the old file's layout; without it they're
+	// left as they are
+	oldStructure, err := LoadStructure(i.store, book)
+	if err != nil {
+		log.Printf("Warning: failed to read structure of %s: %v", book.ID, err)
+	}
+
+	stagedPath, err := i.files.SaveBookWithExt(book.ID+"-replacement", contextReader{ctx, r}, fileExt)
+	if err != nil {
+		return nil, fmt.Errorf("save file: %w", err)
+	}
+
+	sniffedFormat, sniffedPath, err := resolveFormat(stagedPath, fileFormat, false)
+	if err != nil {
+		os.Remove(stagedPath)
+		return nil, err
+	}
+	fileFormat, stagedPath, fileExt = sniffedFormat, sniffedPath, "."+sniffedFormat
+
+	parsed, err := i.parse(ctx, book.ID, stagedPath, filename, fileFormat)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		os.Remove(stagedPath)
+		return nil, err
+	}
+
+	updated := *book
+	mergeParsed(&updated, parsed)
+	updated.FileFormat = fileFormat
+	updated.FileSize = size
+	updated.FilePath = ""
+	updated.FileHash, err = storage.HashFile(stagedPath)
+	if ctx.Err() != nil {
+		os.Remove(stagedPath)
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("Warning: failed to compute hash for %s: %v", stagedPath, err)
+	} else if updated.FilePath, err = i.files.StoreObject(stagedPath, updated.FileHash); err != nil {
+		log.Printf("Warning: failed to store %s by content: %v", stagedPath, err)
+	}
+
+	if updated.FilePath == "" {
+		// Without a hash the new file takes the book's own name instead
+		updated.FilePath, err = i.files.ReplaceBookFile(book.ID, book.FilePath, stagedPath, fileExt)
+		if updated.FilePath == "" {
+			os.Remove(stagedPath)
+			return nil, fmt.Errorf("replace file: %w", err)
+		}
+		if err != nil {
+			log.Printf("Warning: failed to remove old file %s: %v", book.FilePath, err)
+		}
+	}
+
+	if err := i.store.UpdateBookFile(&updated); err != nil {
+		return nil, fmt.Errorf("save book metadata: %w", err)
+	}
+	if updated.FilePath != book.FilePath {
+		// Only now that the book no longer uses it, in case it's shared
+		if err := i.files.DeleteFile(book.FilePath); err != nil {
+			log.Printf("Warning: failed to remove old file %s: %v", book.FilePath, err)
+		}
+	}
+
+	newStructure, err := ReadStructure(updated.FilePath, fileFormat)
+	if err != nil {
+		log.Printf("Warning: failed to read structure of %s: %v", updated.FilePath, err)
+		return &updated, nil
+	}
+	if err := SaveStructure(i.store, book.ID, newStructure); err != nil {
+		log.Printf("Warning: failed to save structure of %s: %v", book.ID, err)
+	}
+	if oldStructure != nil {
+		i.migratePositions(book.ID, book.FileFormat, oldStructure, fileFormat, newStructure)
+	}
+	return &updated, nil
+}
+
+// mergeParsed copies what was parsed from a replacement file onto book.
+// Descriptive fields the file leaves empty keep the book's values, so edits
+// and fetched metadata aren't lost to a file with less of it.
+func mergeParsed(book, parsed *models.Book) {
+	for _, f := range []struct{ dst, src *string }{
+		{&book.Title, &parsed.Title},
+		{&book.Author, &parsed.Author},
+		{&book.Series, &parsed.Series},
+		{&book.ISBN, &parsed.ISBN},
+		{&book.Publisher, &parsed.Publisher},
+		{&book.PublishDate, &parsed.PublishDate},
+		{&book.Description, &parsed.Description},
+		{&book.Language, &parsed.Language},
+		{&book.Subjects, &parsed.Subjects},
+		{&book.CoverPath, &parsed.CoverPath},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if parsed.CoverPath != "" {
+		book.CoverPalette = parsed.CoverPalette
+	}
+	if parsed.SeriesIndex != 0 {
+		book.SeriesIndex = parsed.SeriesIndex
+	}
+	if parsed.ReadingDirection == models.ReadingDirectionRTL {
+		book.ReadingDirection = models.ReadingDirectionRTL
+	}
+	if parsed.LongStrip {
+		book.LongStrip = true
+	}
+	book.ContentType = parsed.ContentType
+	book.MetadataSource = parsed.MetadataSource
+	book.MetadataUpdated = parsed.MetadataUpdated
+}
+
+// migratePositions moves every reader's position in a book to the same
+// fraction of the way through its new file
+func (i *Importer) migratePositions(bookID, oldFormat string, oldStructure *Structure, newFormat string, newStructure *Structure) {
+	positions, err := i.store.GetReadingPositionsForBook(bookID)
+	if err != nil {
+		log.Printf("Warning: failed to fetch reading positions for %s: %v", bookID, err)
+		return
+	}
+
+	for _, pos := range positions {
+		progress, ok := positionProgress(pos, oldFormat, oldStructure)
+		if !ok {
+			continue
+		}
+		pos.Chapter, pos.Position, ok = progressPosition(progress, newFormat, newStructure)
+		if !ok {
+			continue
+		}
+		// A CFI into the old file no longer points anywhere
+		pos.CFI = ""
+		if err := i.store.SaveReadingPosition(&pos); err != nil {
+			log.Printf("Warning: failed to migrate reading position for %s: %v", bookID, err)
+		}
+	}
+}
+
+// positionProgress returns how far through a book pos is, from 0 to 1. EPUB
+// positions are a chapter index and the fraction through it; PDF positions
+// are 1-based pages and comic positions 0-based pages.
+func positionProgress(pos models.ReadingPosition, format string, s *Structure) (float64, bool) {
+	n, err := strconv.Atoi(pos.Chapter)
+	if err != nil {
+		return 0, false
+	}
+
+	var progress float64
+	switch format {
+	case models.FileFormatEPUB:
+		if len(s.Chapters) == 0 {
+			return 0, false
+		}
+		progress = (float64(n) + math.Min(math.Max(pos.Position, 0), 1)) / float64(len(s.Chapters))
+	case models.FileFormatPDF:
+		if s.PageCount == 0 {
+			return 0, false
+		}
+		progress = float64(n-1) / float64(s.PageCount)
+	case models.FileFormatCBZ, models.FileFormatCBR:
+		if s.PageCount == 0 {
+			return 0, false
+		}
+		progress = float64(n) / float64(s.PageCount)
+	default:
+		return 0, false
+	}
+	return math.Min(math.Max(progress, 0), 1), true
+}
+
+// PositionPage returns the 1-based page pos is on, estimated for EPUBs
+// from how far through the book it is, or false if the page count isn't
+// known
+func PositionPage(pos models.ReadingPosition, format string, s *Structure) (int, bool) {
+	if s.PageCount == 0 {
+		return 0, false
+	}
+	if format == models.FileFormatPDF {
+		n, err := strconv.Atoi(pos.Chapter)
+		if err != nil {
+			return 0, false
+		}
+		return min(max(n, 1), s.PageCount), true
+	}
+
+	progress, ok := positionProgress(pos, format, s)
+	if !ok {
+		return 0, false
+	}
+	return min(int(progress*float64(s.PageCount))+1, s.PageCount), true
+}
+
+// MinutesRemaining estimates the minutes left to read a book at a pace of
+// minutesPerPage, from pos or from the start when pos is nil. It's false
+// when the book's page count or the pace isn't known.
+func MinutesRemaining(pos *models.ReadingPosition, format string, s *Structure, minutesPerPage float64) (int, bool) {
+	if s.PageCount == 0 || minutesPerPage <= 0 {
+		return 0, false
+	}
+
+	progress := 0.0
+	if pos != nil {
+		var ok bool
+		if progress, ok = positionProgress(*pos, format, s); !ok {
+			return 0, false
+		}
+	}
+	pages := (1 - progress) * float64(s.PageCount)
+	return int(math.Ceil(pages * minutesPerPage)), true
+}
+
+// progressPosition is the inverse of positionProgress, returning the
+// position the given fraction of the way through a book
+func progressPosition(progress float64, format string, s *Structure) (chapter string, position float64, ok bool) {
+	switch format {
+	case models.FileFormatEPUB:
+		n := len(s.Chapters)
+		if n == 0 {
+			return "", 0, false
+		}
+		x := progress * float64(n)
+		index := min(int(x), n-1)
+		return strconv.Itoa(index), math.Min(x-float64(index), 1), true
+	case models.FileFormatPDF:
+		if s.PageCount == 0 {
+			return "", 0, false
+		}
+		return strconv.Itoa(min(int(progress*float64(s.PageCount)), s.PageCount-1) + 1), 0, true
+	case models.FileFormatCBZ, models.FileFormatCBR:
+		if s.PageCount == 0 {
+			return "", 0, false
+		}
+		return strconv.Itoa(min(int(progress*float64(s.PageCount)), s.PageCount-1)), 0, true
+	}
+	return "", 0, false
+}
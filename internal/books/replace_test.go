@@ -0,0 +1,137 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestReplace(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	comic := testCBZ(t, `<ComicInfo><Series>Kept Series</Series></ComicInfo>`)
+	book, err := importer.Import(context.Background(), bytes.NewReader(comic), "scan.cbz", int64(len(comic)), "user-1")
+	require.NoError(t, err)
+	oldPath := book.FilePath
+
+	// Halfway through a ten-page scan
+	store.pages[book.ID] = 10
+	store.positions = []models.ReadingPosition{{BookID: book.ID, UserID: "user-1", Chapter: "5"}}
+
+	data := testEPUB(t)
+	updated, err := importer.Replace(context.Background(), book, bytes.NewReader(data), "retail.epub", int64(len(data)))
+	require.NoError(t, err)
+
+	assert.Equal(t, book.ID, updated.ID)
+	assert.Equal(t, "Imported Title", updated.Title, "metadata is re-parsed")
+	assert.Equal(t, "Kept Series", updated.Series, "fields the new file lacks are kept")
+	assert.Equal(t, models.FileFormatEPUB, updated.FileFormat)
+	assert.Equal(t, models.ContentTypeBook, updated.ContentType)
+	assert.Equal(t, int64(len(data)), updated.FileSize)
+	require.Len(t, store.updated, 1)
+
+	_, err = os.Stat(oldPath)
+	assert.True(t, os.IsNotExist(err), "the old file is removed")
+	assert.Contains(t, store.structures[book.ID], `"href":"ch1.xhtml"`)
+
+	require.Len(t, store.positions, 1)
+	assert.Equal(t, "0", store.positions[0].Chapter)
+	assert.InDelta(t, 0.5, store.positions[0].Position, 0.001, "halfway through the only chapter")
+}
+
+func TestReplaceRejectsBadFiles(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	data := testEPUB(t)
+	book, err := importer.Import(context.Background(), bytes.NewReader(data), "book.epub", int64(len(data)), "")
+	require.NoError(t, err)
+
+	_, err = importer.Replace(context.Background(), book, strings.NewReader("not a zip"), "broken.epub", 9)
+	var invalid *InvalidFileError
+	require.ErrorAs(t, err, &invalid)
+	assert.Empty(t, store.updated)
+	_, err = os.Stat(book.FilePath)
+	assert.NoError(t, err, "the original file is untouched")
+}
+
+func TestPositionMigration(t *testing.T) {
+	tests := []struct {
+		name        string
+		fromFormat  string
+		from        *Structure
+		pos         models.ReadingPosition
+		toFormat    string
+		to          *Structure
+		wantChapter string
+		wantPos     float64
+	}{
+		{"pdf page to epub chapter", models.FileFormatPDF, &Structure{PageCount: 100}, models.ReadingPosition{Chapter: "51"},
+			models.FileFormatEPUB, &Structure{Chapters: make([]epub.Chapter, 10)}, "5", 0},
+		{"epub chapter to pdf page", models.FileFormatEPUB, &Structure{Chapters: make([]epub.Chapter, 4)}, models.ReadingPosition{Chapter: "2", Position: 0.5},
+			models.FileFormatPDF, &Structure{PageCount: 200}, "126", 0},
+		{"last comic page", models.FileFormatCBZ, &Structure{PageCount: 20}, models.ReadingPosition{Chapter: "19"},
+			models.FileFormatCBR, &Structure{PageCount: 40}, "38", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, ok := positionProgress(tt.pos, tt.fromFormat, tt.from)
+			require.True(t, ok)
+			chapter, pos, ok := progressPosition(progress, tt.toFormat, tt.to)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantChapter, chapter)
+			assert.InDelta(t, tt.wantPos, pos, 0.001)
+		})
+	}
+
+	_, ok := positionProgress(models.ReadingPosition{Chapter: "intro"}, models.FileFormatEPUB, &Structure{})
+	assert.False(t, ok, "positions that aren't indexes are left alone")
+}
+
+func TestPositionPage(t *testing.T) {
+	epubs := &Structure{Chapters: make([]epub.Chapter, 4), PageCount: 200}
+
+	page, ok := PositionPage(models.ReadingPosition{Chapter: "2", Position: 0.5}, models.FileFormatEPUB, epubs)
+	require.True(t, ok)
+	assert.Equal(t, 126, page)
+
+	page, ok = PositionPage(models.ReadingPosition{Chapter: "3", Position: 1}, models.FileFormatEPUB, epubs)
+	require.True(t, ok)
+	assert.Equal(t, 200, page, "the end of the book is its last page")
+
+	page, ok = PositionPage(models.ReadingPosition{Chapter: "500"}, models.FileFormatPDF, &Structure{PageCount: 100})
+	require.True(t, ok)
+	assert.Equal(t, 100, page)
+
+	_, ok = PositionPage(models.ReadingPosition{Chapter: "1"}, models.FileFormatEPUB, &Structure{Chapters: make([]epub.Chapter, 4)})
+	assert.False(t, ok, "no page count, no page")
+}
+
+func TestMinutesRemaining(t *testing.T) {
+	pdfs := &Structure{PageCount: 100}
+
+	minutes, ok := MinutesRemaining(nil, models.FileFormatPDF, pdfs, 1.5)
+	require.True(t, ok)
+	assert.Equal(t, 150, minutes, "unopened books are read from the start")
+
+	minutes, ok = MinutesRemaining(&models.ReadingPosition{Chapter: "76"}, models.FileFormatPDF, pdfs, 2)
+	require.True(t, ok)
+	assert.Equal(t, 50, minutes)
+
+	_, ok = MinutesRemaining(nil, models.FileFormatPDF, pdfs, 0)
+	assert.False(t, ok, "no pace, no estimate")
+	_, ok = MinutesRemaining(nil, models.FileFormatEPUB, &Structure{Chapters: make([]epub.Chapter, 3)}, 1)
+	assert.False(t, ok, "no page count, no estimate")
+}
@@ -0,0 +1,51 @@
+package books
+
+import (
+	"io"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/pdf"
+)
+
+// SampleFormat returns the file format of a book's sample. A CBR's is a
+// CBZ, as RAR archives can't be written.
+func SampleFormat(fileFormat string) string {
+	if fileFormat == models.FileFormatCBR {
+		return models.FileFormatCBZ
+	}
+	return fileFormat
+}
+
+// SamplePages returns how many of a book's pages a sample of percent of it
+// keeps, at least one
+func SamplePages(pageCount, percent int) int {
+	return max(1, (pageCount*percent+99)/100)
+}
+
+// WriteSample writes the first percent of a book to w, in the format
+// SampleFormat gives: an EPUB of the start of its text, or the first pages
+// of a comic or PDF
+func WriteSample(w io.Writer, store StructureStore, book *models.Book, percent int) error {
+	if book.FileFormat == models.FileFormatEPUB {
+		return epub.WriteSample(book.FilePath, w, percent)
+	}
+
+	var write func(io.Writer, string, int) error
+	switch book.FileFormat {
+	case models.FileFormatCBZ:
+		write = cbz.WriteFirstPages
+	case models.FileFormatCBR:
+		write = cbz.WriteFirstPagesCBR
+	case models.FileFormatPDF:
+		write = pdf.WriteFirstPages
+	default:
+		return ErrUnsupportedFormat
+	}
+	s, err := LoadStructure(store, book)
+	if err != nil {
+		return err
+	}
+	return write(w, book.FilePath, SamplePages(s.PageCount, percent))
+}
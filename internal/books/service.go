@@ -0,0 +1,366 @@
+// Package books holds the library's book business logic: listing, lookup,
+// access checks, and deletion. HTTP handlers call the Service; storage is
+// behind the Store interface so the rules can be tested without a database.
+package books
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/justyntemme/webby/internal/authz"
+	"github.com/justyntemme/webby/internal/locale"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a book does not exist or is not visible
+	// to the user
+	ErrNotFound = errors.New("book not found")
+	// ErrForbidden is returned when a book exists but the user may not
+	// access it
+	ErrForbidden = errors.New("access denied")
+)
+
+// Store is the subset of storage.Database the book service uses
+type Store interface {
+	GetBook(id string) (*models.Book, error)
+	GetBookForUser(id, userID string) (*models.Book, error)
+	GetUserBookState(userID, bookID string) (string, *time.Time, int, error)
+	IsBookSharedWith(bookID, userID string) (bool, error)
+	IsBookHiddenFrom(bookID, userID string) (bool, error) // For the access policy
+	HiddenBookIDs(userID string) (map[string]bool, error)
+	ListBooksForUserWithFilters(userID, sortBy, order, contentType, readStatus string) ([]models.Book, error)
+	SearchBooksForUser(query, userID string) ([]models.Book, error)
+	TombstoneBook(book *models.Book) error
+	GetBookFiles(bookID string) ([]models.BookFile, error)
+	GetLibraryPreferences(userID string) (*models.LibraryPreferences, error)
+}
+
+// FileRemover deletes a book's files from disk
+type FileRemover interface {
+	DeleteBook(bookID string) error
+	DeleteFile(path string) error
+}
+
+// Service implements book operations on top of a Store
+type Service struct {
+	store  Store
+	files  FileRemover
+	policy *authz.Policy
+}
+
+// NewService creates a book service
+func NewService(store Store, files FileRemover) *Service {
+	return &Service{store: store, files: files, policy: authz.NewPolicy(store)}
+}
+
+// ListOptions filters, sorts, and paginates a book list
+type ListOptions struct {
+	UserID      string
+	Search      string
+	SortBy      string // "relevance" keeps search results best match first
+	Order       string
+	ContentType string // "book", "comic", or empty for all
+	ReadStatus  string // "unread", "reading", "completed", or empty for all
+	Language    string // Language code such as "en", or empty for all
+	Page        int    // 1-based
+	Limit       int    // 0 = no limit
+}
+
+// ListResult is one page of books
+type ListResult struct {
+	Books []models.Book
+	Total int // Matching books before pagination
+	Page  int
+	Limit int
+}
+
+// List returns the user's books matching opts
+func (s *Service) List(opts ListOptions) (*ListResult, error) {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.Limit < 0 {
+		opts.Limit = 0
+	}
+
+	var books []models.Book
+	var err error
+	if opts.Search != "" {
+		books, err = s.store.SearchBooksForUser(opts.Search, opts.UserID)
+		// Search doesn't filter, so apply content type and read status here
+		if err == nil && (opts.ContentType != "" || opts.ReadStatus != "") {
+			filtered := make([]models.Book, 0)
+			for _, b := range books {
+				if opts.ContentType != "" && b.ContentType != opts.ContentType {
+					continue
+				}
+				if opts.ReadStatus != "" && b.ReadStatus != opts.ReadStatus {
+					continue
+				}
+				filtered = append(filtered, b)
+			}
+			books = filtered
+		}
+	} else {
+		books, err = s.store.ListBooksForUserWithFilters(opts.UserID, opts.SortBy, opts.Order, opts.ContentType, opts.ReadStatus)
+	}
+	if err == nil {
+		books, err = s.Visible(opts.UserID, books)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Language != "" {
+		want := locale.Normalize(opts.Language)
+		filtered := make([]models.Book, 0)
+		for _, b := range books {
+			if locale.Normalize(b.Language) == want {
+				filtered = append(filtered, b)
+			}
+		}
+		books = filtered
+	}
+
+	if opts.SortBy == "title" {
+		if err := s.sortTitles(books, opts.UserID, opts.Order == "desc"); err != nil {
+			return nil, err
+		}
+	}
+
+	if books == nil {
+		books = []models.Book{}
+	}
+
+	result := &ListResult{Books: books, Total: len(books), Page: opts.Page, Limit: opts.Limit}
+	if opts.Limit > 0 {
+		start := (opts.Page - 1) * opts.Limit
+		end := start + opts.Limit
+		if start > len(books) {
+			result.Books = []models.Book{}
+		} else if end > len(books) {
+			result.Books = books[start:]
+		} else {
+			result.Books = books[start:end]
+		}
+	}
+	return result, nil
+}
+
+// Index files the books List returns for opts under the letter each is
+// sorted by, opts.SortBy being "title" or "author", so clients can jump to
+// a letter of a long list. Buckets are in list order, and each gives the
+// offset of its first book in the full list; a letter that turns up again
+// further down, as books without an author do, is counted in its first
+// bucket. It also returns how many books there are.
+func (s *Service) Index(opts ListOptions) ([]models.LetterBucket, int, error) {
+	opts.Search, opts.Page, opts.Limit = "", 1, 0
+	result, err := s.List(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var sorter *locale.TitleSorter
+	if opts.SortBy == "title" {
+		if sorter, err = s.titleSorter(opts.UserID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	buckets := []models.LetterBucket{}
+	seen := make(map[string]int) // letter -> index in buckets
+	for i, b := range result.Books {
+		var key string
+		if sorter != nil {
+			key = sorter.Key(b.Title, b.Language)
+		} else if key = b.SortAuthor; key == "" {
+			key = locale.AuthorSort(b.Author)
+		}
+
+		letter := locale.IndexLetter(key)
+		if at, ok := seen[letter]; ok {
+			buckets[at].Count++
+			continue
+		}
+		seen[letter] = len(buckets)
+		buckets = append(buckets, models.LetterBucket{Letter: letter, Count: 1, Offset: i})
+	}
+	return buckets, result.Total, nil
+}
+
+// ByLanguage returns the user's books grouped by normalized language code,
+// each group in title order. Books without a language are grouped under "".
+func (s *Service) ByLanguage(userID string) (map[string][]models.Book, error) {
+	books, err := s.store.ListBooksForUserWithFilters(userID, "title", "asc", "", "")
+	if err == nil {
+		books, err = s.Visible(userID, books)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sortTitles(books, userID, false); err != nil {
+		return nil, err
+	}
+
+	grouped := make(map[string][]models.Book)
+	for _, b := range books {
+		lang := locale.Normalize(b.Language)
+		grouped[lang] = append(grouped[lang], b)
+	}
+	return grouped, nil
+}
+
+// Visible drops the books userID's content restriction hides from them,
+// keeping the rest in order. Books are returned as they are for users
+// without a restriction.
+func (s *Service) Visible(userID string, books []models.Book) ([]models.Book, error) {
+	if userID == "" {
+		return books, nil
+	}
+	hidden, err := s.store.HiddenBookIDs(userID)
+	if err != nil || len(hidden) == 0 {
+		return books, err
+	}
+	visible := make([]models.Book, 0, len(books))
+	for _, b := range books {
+		if !hidden[b.ID] {
+			visible = append(visible, b)
+		}
+	}
+	return visible, nil
+}
+
+// sortTitles orders books by title using the user's sort locale, ignoring
+// leading articles in each book's language if they've asked to
+func (s *Service) sortTitles(books []models.Book, userID string, desc bool) error {
+	sorter, err := s.titleSorter(userID)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]string, len(books))
+	for _, b := range books {
+		keys[b.ID] = sorter.Key(b.Title, b.Language)
+	}
+	sort.SliceStable(books, func(i, j int) bool {
+		c := sorter.Compare(keys[books[i].ID], keys[books[j].ID])
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+// titleSorter returns a sorter for the user's sort locale and article
+// preference
+func (s *Service) titleSorter(userID string) (*locale.TitleSorter, error) {
+	prefs := models.DefaultLibraryPreferences(userID)
+	if userID != "" {
+		var err error
+		if prefs, err = s.store.GetLibraryPreferences(userID); err != nil {
+			return nil, err
+		}
+	}
+	return locale.NewTitleSorter(prefs.SortLocale, prefs.IgnoreArticles), nil
+}
+
+// Get returns a book. Signed-in users only see books they own or that are
+// shared with them, and that their content restriction allows, along with
+// their own read status and rating; anonymous callers only see public
+// books, with the owner's view.
+func (s *Service) Get(id, userID string) (*models.Book, error) {
+	var book *models.Book
+	var err error
+	if userID != "" {
+		book, err = s.store.GetBookForUser(id, userID)
+	} else {
+		book, err = s.store.GetBook(id)
+		if err == nil && !s.policy.CanRead(book, userID) {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return book, err
+}
+
+// WithUserState returns a copy of a book already fetched and checked
+// against the access policy, such as the one RequireBook keeps for the
+// request, with userID's own read status and rating. The owner and
+// anonymous callers get the owner's view, as fetched.
+func (s *Service) WithUserState(book *models.Book, userID string) (*models.Book, error) {
+	copied := *book
+	if userID == "" || userID == book.UserID {
+		return &copied, nil
+	}
+	status, dateCompleted, rating, err := s.store.GetUserBookState(userID, book.ID)
+	if err != nil {
+		return nil, err
+	}
+	copied.ReadStatus, copied.DateCompleted, copied.Rating = status, dateCompleted, rating
+	return &copied, nil
+}
+
+// Authorize returns the book if the access policy lets the user read it
+func (s *Service) Authorize(bookID, userID string) (*models.Book, error) {
+	book, err := s.store.GetBook(bookID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.policy.CanRead(book, userID) {
+		return nil, ErrForbidden
+	}
+	return book, nil
+}
+
+// Delete removes a book's files and its record, returning the deleted book.
+// Only users the access policy lets change the book may delete it. The
+// owner's reading data is kept in a tombstone in case the same file is
+// uploaded again.
+func (s *Service) Delete(id, userID string) (*models.Book, error) {
+	book, err := s.store.GetBook(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.policy.Check(book, userID, authz.Write) {
+	case nil:
+	case authz.ErrNotVisible:
+		return nil, ErrNotFound
+	default:
+		return nil, ErrForbidden
+	}
+
+	// Editions are deleted with the record, so their paths are read first
+	editions, err := s.store.GetBookFiles(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// A missing file shouldn't keep the record around
+	s.files.DeleteBook(id)
+
+	if err := s.store.TombstoneBook(book); err != nil {
+		return nil, err
+	}
+
+	// Files in the content-addressed store go only once no other book
+	// shares them, which can't be told until this one's records are gone
+	s.files.DeleteFile(book.FilePath)
+	for _, f := range editions {
+		s.files.DeleteFile(f.FilePath)
+	}
+	return book, nil
+}
@@ -0,0 +1,360 @@
+package books
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// fakeStore is an in-memory Store
+type fakeStore struct {
+	books    map[string]*models.Book
+	shares   map[string][]string // book ID -> user IDs
+	prefs    map[string]*models.LibraryPreferences
+	editions map[string][]models.BookFile // book ID -> extra editions
+	limits   map[string]string            // user ID -> highest age rating they may see
+	ratings  map[string]int               // user ID + book ID -> rating
+}
+
+func newFakeStore(books ...*models.Book) *fakeStore {
+	s := &fakeStore{books: map[string]*models.Book{}, shares: map[string][]string{}, prefs: map[string]*models.LibraryPreferences{},
+		editions: map[string][]models.BookFile{}, limits: map[string]string{}, ratings: map[string]int{}}
+	for _, b := range books {
+		s.books[b.ID] = b
+	}
+	return s
+}
+
+func (s *fakeStore) GetBook(id string) (*models.Book, error) {
+	b, ok := s.books[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *b
+	return &copied, nil
+}
+
+func (s *fakeStore) GetBookForUser(id, userID string) (*models.Book, error) {
+	b, err := s.GetBook(id)
+	if err != nil {
+		return nil, err
+	}
+	if shared, _ := s.IsBookSharedWith(id, userID); b.UserID != userID && !shared {
+		return nil, sql.ErrNoRows
+	}
+	if !models.AgeRatingAllowed(s.limits[userID], b.AgeRating) {
+		return nil, sql.ErrNoRows
+	}
+	return b, nil
+}
+
+func (s *fakeStore) GetUserBookState(userID, bookID string) (string, *time.Time, int, error) {
+	rating, ok := s.ratings[userID+bookID]
+	if !ok {
+		return models.ReadStatusUnread, nil, 0, nil
+	}
+	return models.ReadStatusReading, nil, rating, nil
+}
+
+func (s *fakeStore) IsBookSharedWith(bookID, userID string) (bool, error) {
+	for _, u := range s.shares[bookID] {
+		if u == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeStore) IsBookHiddenFrom(bookID, userID string) (bool, error) {
+	b, ok := s.books[bookID]
+	return ok && !models.AgeRatingAllowed(s.limits[userID], b.AgeRating), nil
+}
+
+func (s *fakeStore) HiddenBookIDs(userID string) (map[string]bool, error) {
+	if s.limits[userID] == "" {
+		return nil, nil
+	}
+	hidden := make(map[string]bool)
+	for id := range s.books {
+		if h, _ := s.IsBookHiddenFrom(id, userID); h {
+			hidden[id] = true
+		}
+	}
+	return hidden, nil
+}
+
+func (s *fakeStore) ListBooksForUserWithFilters(userID, sortBy, order, contentType, readStatus string) ([]models.Book, error) {
+	var out []models.Book
+	for _, id := range []string{"b1", "b2", "b3", "b4", "b5"} {
+		if b, ok := s.books[id]; ok && b.UserID == userID {
+			out = append(out, *b)
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) SearchBooksForUser(query, userID string) ([]models.Book, error) {
+	return s.ListBooksForUserWithFilters(userID, "", "", "", "")
+}
+
+func (s *fakeStore) TombstoneBook(book *models.Book) error {
+	delete(s.books, book.ID)
+	delete(s.editions, book.ID)
+	return nil
+}
+
+func (s *fakeStore) GetBookFiles(bookID string) ([]models.BookFile, error) {
+	return s.editions[bookID], nil
+}
+
+func (s *fakeStore) GetLibraryPreferences(userID string) (*models.LibraryPreferences, error) {
+	if p, ok := s.prefs[userID]; ok {
+		return p, nil
+	}
+	return models.DefaultLibraryPreferences(userID), nil
+}
+
+// fakeFiles records deleted books and files
+type fakeFiles struct {
+	deleted []string
+}
+
+func (f *fakeFiles) DeleteBook(bookID string) error {
+	f.deleted = append(f.deleted, bookID)
+	return nil
+}
+
+func (f *fakeFiles) DeleteFile(path string) error {
+	f.deleted = append(f.deleted, path)
+	return nil
+}
+
+func TestList(t *testing.T) {
+	store := newFakeStore(
+		&models.Book{ID: "b1", UserID: "u1", ContentType: "book", ReadStatus: "unread"},
+		&models.Book{ID: "b2", UserID: "u1", ContentType: "comic", ReadStatus: "unread"},
+		&models.Book{ID: "b3", UserID: "u1", ContentType: "book", ReadStatus: "completed"},
+		&models.Book{ID: "b4", UserID: "u2", ContentType: "book"},
+	)
+	svc := NewService(store, &fakeFiles{})
+
+	t.Run("paginates", func(t *testing.T) {
+		result, err := svc.List(ListOptions{UserID: "u1", Page: 2, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Total)
+		require.Len(t, result.Books, 1)
+		assert.Equal(t, "b3", result.Books[0].ID)
+	})
+
+	t.Run("page past the end", func(t *testing.T) {
+		result, err := svc.List(ListOptions{UserID: "u1", Page: 5, Limit: 2})
+		require.NoError(t, err)
+		assert.NotNil(t, result.Books)
+		assert.Empty(t, result.Books)
+	})
+
+	t.Run("normalizes page and limit", func(t *testing.T) {
+		result, err := svc.List(ListOptions{UserID: "u1", Page: 0, Limit: -1})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Page)
+		assert.Equal(t, 0, result.Limit)
+		assert.Len(t, result.Books, 3)
+	})
+
+	t.Run("search applies filters", func(t *testing.T) {
+		result, err := svc.List(ListOptions{UserID: "u1", Search: "x", ContentType: "book", ReadStatus: "unread"})
+		require.NoError(t, err)
+		require.Len(t, result.Books, 1)
+		assert.Equal(t, "b1", result.Books[0].ID)
+	})
+
+	t.Run("empty library", func(t *testing.T) {
+		result, err := svc.List(ListOptions{UserID: "nobody"})
+		require.NoError(t, err)
+		assert.NotNil(t, result.Books)
+	})
+}
+
+func TestListTitleOrderAndLanguage(t *testing.T) {
+	store := newFakeStore(
+		&models.Book{ID: "b1", UserID: "u1", Title: "Zebra", Language: "en"},
+		&models.Book{ID: "b2", UserID: "u1", Title: "The Hobbit", Language: "en"},
+		&models.Book{ID: "b3", UserID: "u1", Title: "Die Verwandlung", Language: "de-DE"},
+		&models.Book{ID: "b4", UserID: "u1", Title: "apple"},
+	)
+	svc := NewService(store, &fakeFiles{})
+
+	ids := func(books []models.Book) []string {
+		var out []string
+		for _, b := range books {
+			out = append(out, b.ID)
+		}
+		return out
+	}
+
+	result, err := svc.List(ListOptions{UserID: "u1", SortBy: "title"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b4", "b2", "b3", "b1"}, ids(result.Books), "articles are ignored in each book's language")
+
+	result, err = svc.List(ListOptions{UserID: "u1", SortBy: "title", Order: "desc"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b1", "b3", "b2", "b4"}, ids(result.Books))
+
+	store.prefs["u1"] = &models.LibraryPreferences{UserID: "u1", SortLocale: "en", IgnoreArticles: false}
+	result, err = svc.List(ListOptions{UserID: "u1", SortBy: "title"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b4", "b3", "b2", "b1"}, ids(result.Books))
+
+	result, err = svc.List(ListOptions{UserID: "u1", Language: "de"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b3"}, ids(result.Books))
+
+	grouped, err := svc.ByLanguage("u1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b2", "b1"}, ids(grouped["en"]))
+	assert.Equal(t, []string{"b3"}, ids(grouped["de"]))
+	assert.Equal(t, []string{"b4"}, ids(grouped[""]))
+}
+
+func TestGetAndAuthorize(t *testing.T) {
+	store := newFakeStore(&models.Book{ID: "b1", UserID: "owner"})
+	store.shares["b1"] = []string{"friend"}
+	svc := NewService(store, &fakeFiles{})
+
+	_, err := svc.Get("missing", "owner")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = svc.Get("b1", "stranger")
+	assert.ErrorIs(t, err, ErrNotFound, "books not visible to the user look missing")
+
+	_, err = svc.Get("b1", "")
+	assert.ErrorIs(t, err, ErrNotFound, "anonymous callers only see public books")
+
+	_, err = svc.Authorize("b1", "owner")
+	assert.NoError(t, err)
+	_, err = svc.Authorize("b1", "friend")
+	assert.NoError(t, err)
+	_, err = svc.Authorize("b1", "stranger")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = svc.Authorize("b1", "")
+	assert.ErrorIs(t, err, ErrForbidden, "anonymous callers only read public books")
+	_, err = svc.Authorize("missing", "owner")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestWithUserState(t *testing.T) {
+	store := newFakeStore()
+	store.ratings["friendb1"] = 4
+	svc := NewService(store, &fakeFiles{})
+	book := &models.Book{ID: "b1", UserID: "owner", ReadStatus: models.ReadStatusCompleted, Rating: 5}
+
+	got, err := svc.WithUserState(book, "friend")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusReading, got.ReadStatus)
+	assert.Equal(t, 4, got.Rating)
+	assert.Equal(t, 5, book.Rating, "the fetched book is left as it was")
+
+	for _, userID := range []string{"owner", ""} {
+		got, err = svc.WithUserState(book, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 5, got.Rating, "the owner's view")
+	}
+}
+
+func TestContentRestriction(t *testing.T) {
+	store := newFakeStore(
+		&models.Book{ID: "b1", UserID: "kid", Title: "Matilda", AgeRating: models.AgeRatingAllAges},
+		&models.Book{ID: "b2", UserID: "kid", Title: "The Hunger Games", AgeRating: models.AgeRatingTeen},
+		&models.Book{ID: "b3", UserID: "kid", Title: "Unrated"},
+	)
+	store.limits["kid"] = models.AgeRatingAllAges
+	svc := NewService(store, &fakeFiles{})
+
+	result, err := svc.List(ListOptions{UserID: "kid"})
+	require.NoError(t, err)
+	require.Len(t, result.Books, 1)
+	assert.Equal(t, "b1", result.Books[0].ID)
+	assert.Equal(t, 1, result.Total)
+
+	grouped, err := svc.ByLanguage("kid")
+	require.NoError(t, err)
+	assert.Len(t, grouped[""], 1)
+
+	_, err = svc.Get("b2", "kid")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = svc.Authorize("b3", "kid")
+	assert.ErrorIs(t, err, ErrForbidden, "unrated books are hidden from restricted users")
+	_, err = svc.Authorize("b2", "")
+	assert.ErrorIs(t, err, ErrForbidden, "anonymous callers only read public books")
+
+	store.limits["kid"] = models.AgeRatingTeen
+	result, err = svc.List(ListOptions{UserID: "kid"})
+	require.NoError(t, err)
+	assert.Len(t, result.Books, 2)
+}
+
+func TestDelete(t *testing.T) {
+	store := newFakeStore(&models.Book{ID: "b1", UserID: "u1", Title: "Dune", FilePath: "objects/aa.epub"})
+	store.editions["b1"] = []models.BookFile{{BookID: "b1", FileFormat: "pdf", FilePath: "objects/bb.pdf"}}
+	files := &fakeFiles{}
+	svc := NewService(store, files)
+
+	_, err := svc.Delete("b1", "stranger")
+	assert.ErrorIs(t, err, ErrNotFound)
+	store.shares["b1"] = []string{"friend"}
+	_, err = svc.Delete("b1", "friend")
+	assert.ErrorIs(t, err, ErrForbidden, "shared users can read but not delete")
+	assert.Empty(t, files.deleted)
+
+	book, err := svc.Delete("b1", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Dune", book.Title)
+	assert.Equal(t, []string{"b1", "objects/aa.epub", "objects/bb.pdf"}, files.deleted,
+		"stored files are released after the records using them are gone")
+	assert.NotContains(t, store.books, "b1")
+
+	_, err = svc.Delete("b1", "u1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestIndex(t *testing.T) {
+	store := newFakeStore(
+		&models.Book{ID: "b1", UserID: "u1", Title: "Zebra", Author: "Émile Zola"},
+		&models.Book{ID: "b2", UserID: "u1", Title: "The Hobbit", Language: "en", Author: "J.R.R. Tolkien", SortAuthor: "Tolkien, J.R.R."},
+		&models.Book{ID: "b3", UserID: "u1", Title: "1984", Author: "George Orwell"},
+		&models.Book{ID: "b4", UserID: "u1", Title: "Hamlet"},
+	)
+	svc := NewService(store, &fakeFiles{})
+
+	letters, total, err := svc.Index(ListOptions{UserID: "u1", SortBy: "title"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+	assert.Equal(t, []models.LetterBucket{
+		{Letter: "#", Count: 1, Offset: 0},
+		{Letter: "H", Count: 2, Offset: 1},
+		{Letter: "Z", Count: 1, Offset: 3},
+	}, letters, "The Hobbit is under H")
+
+	letters, _, err = svc.Index(ListOptions{UserID: "u1", SortBy: "title", Order: "desc"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.LetterBucket{
+		{Letter: "Z", Count: 1, Offset: 0},
+		{Letter: "H", Count: 2, Offset: 1},
+		{Letter: "#", Count: 1, Offset: 3},
+	}, letters, "buckets follow the list order")
+
+	// The fake store keeps insertion order for author sorting
+	letters, _, err = svc.Index(ListOptions{UserID: "u1", SortBy: "author"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.LetterBucket{
+		{Letter: "Z", Count: 1, Offset: 0},
+		{Letter: "T", Count: 1, Offset: 1},
+		{Letter: "O", Count: 1, Offset: 2},
+		{Letter: "#", Count: 1, Offset: 3},
+	}, letters, "authors are filed by surname")
+}
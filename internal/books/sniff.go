@@ -0,0 +1,111 @@
+package books
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// Signatures at the start of supported files. A PDF's may come after a few
+// bytes of junk, so it's searched for in the first sniffBytes.
+var (
+	magicPDF  = []byte("%PDF-")
+	magicZIP  = []byte("PK\x03\x04")
+	magicRAR  = []byte("Rar!\x1a\x07") // RAR 4 and 5
+	magicMOBI = []byte("BOOKMOBI")     // Palm database type and creator, at offset 60
+)
+
+const sniffBytes = 1024
+
+// SniffFormat returns the format of the file at filePath judged by its
+// contents, or "" if it isn't a supported format. ZIP archives are EPUBs if
+// they have the EPUB mimetype entry or an OCF container, and comics
+// otherwise.
+func SniffFormat(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffBytes)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, magicZIP):
+		return sniffZIP(filePath), nil
+	case bytes.HasPrefix(header, magicRAR):
+		return models.FileFormatCBR, nil
+	case len(header) >= 68 && bytes.Equal(header[60:68], magicMOBI):
+		return models.FileFormatMOBI, nil
+	case bytes.Contains(header, magicPDF):
+		return models.FileFormatPDF, nil
+	}
+	return "", nil
+}
+
+// sniffZIP tells EPUBs from comic archives, returning "" if the archive
+// can't be read
+func sniffZIP(filePath string) string {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		switch f.Name {
+		case "META-INF/container.xml":
+			return models.FileFormatEPUB
+		case "mimetype":
+			rc, err := f.Open()
+			if err != nil {
+				continue
+			}
+			mimetype, _ := io.ReadAll(io.LimitReader(rc, 64))
+			rc.Close()
+			if strings.TrimSpace(string(mimetype)) == "application/epub+zip" {
+				return models.FileFormatEPUB
+			}
+		}
+	}
+	return models.FileFormatCBZ
+}
+
+// resolveFormat checks the saved file at filePath against the format its
+// name claimed. A file in another supported format, such as a .cbz that is
+// really a RAR archive, is renamed to match and its real format returned;
+// one that matches no supported format is rejected. MOBI files are only
+// accepted with allowMOBI, as they can only be extra editions.
+func resolveFormat(filePath, claimed string, allowMOBI bool) (format, path string, err error) {
+	sniffed, err := SniffFormat(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	invalid := "Invalid " + strings.ToUpper(claimed) + " file"
+	if sniffed == "" {
+		return "", "", &InvalidFileError{invalid, errors.New("contents don't match any supported format")}
+	}
+	if sniffed == models.FileFormatMOBI && !allowMOBI {
+		return "", "", &InvalidFileError{invalid, errors.New("MOBI files can only be added as an extra edition")}
+	}
+	if sniffed == claimed {
+		return claimed, filePath, nil
+	}
+
+	path = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "." + sniffed
+	if err := os.Rename(filePath, path); err != nil {
+		return "", "", err
+	}
+	return sniffed, path, nil
+}
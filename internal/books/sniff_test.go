@@ -0,0 +1,76 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestSniffFormat(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"epub", testEPUB(t), models.FileFormatEPUB},
+		{"comic zip", testCBZ(t, `<ComicInfo/>`), models.FileFormatCBZ},
+		{"pdf", []byte("%PDF-1.7\n..."), models.FileFormatPDF},
+		{"pdf after junk", append([]byte("\xef\xbb\xbf\n"), "%PDF-1.4"...), models.FileFormatPDF},
+		{"rar", []byte("Rar!\x1a\x07\x01\x00rest"), models.FileFormatCBR},
+		{"mobi", testMOBI(), models.FileFormatMOBI},
+		{"executable", []byte("MZ\x90\x00\x03\x00\x00\x00"), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			require.NoError(t, os.WriteFile(path, tt.content, 0644))
+			got, err := SniffFormat(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestImportSniffsFormat(t *testing.T) {
+	store := &createStore{}
+	files := &diskFiles{dir: t.TempDir()}
+	importer := NewImporter(store, files)
+
+	// A comic archive misnamed as an EPUB is imported as a CBZ
+	comic := testCBZ(t, `<ComicInfo><Series>Misnamed</Series></ComicInfo>`)
+	book, err := importer.Import(context.Background(), bytes.NewReader(comic), "comic.epub", int64(len(comic)), "")
+	require.NoError(t, err)
+	assert.Equal(t, models.FileFormatCBZ, book.FileFormat)
+	assert.Equal(t, ".cbz", filepath.Ext(book.FilePath))
+	assert.Equal(t, models.ContentTypeComic, book.ContentType)
+
+	// A RAR archive named .cbz goes to the CBR parser
+	rar := []byte("Rar!\x1a\x07\x00not really a rar archive")
+	_, err = importer.Import(context.Background(), bytes.NewReader(rar), "comic.cbz", int64(len(rar)), "")
+	var invalid *InvalidFileError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "Invalid CBR file", invalid.Message)
+
+	// A renamed executable isn't kept
+	exe := []byte("MZ\x90\x00\x03\x00\x00\x00")
+	_, err = importer.Import(context.Background(), bytes.NewReader(exe), "book.epub", int64(len(exe)), "")
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "Invalid EPUB file", invalid.Message)
+	assert.Len(t, store.created, 1)
+
+	// MOBI files can't be imported as books
+	mobi := testMOBI()
+	_, err = importer.Import(context.Background(), bytes.NewReader(mobi), "book.epub", int64(len(mobi)), "")
+	require.ErrorAs(t, err, &invalid)
+	assert.Contains(t, invalid.Error(), "extra edition")
+}
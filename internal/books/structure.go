@@ -0,0 +1,91 @@
+package books
+
+import (
+	"encoding/json"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/pdf"
+)
+
+// Structure is what a reader needs to navigate a book, read from its file:
+// an EPUB's chapters, or the page count of a comic or PDF. EPUBs have no
+// pages, so theirs is estimated from the length of their text.
+type Structure struct {
+	Chapters  []epub.Chapter
+	PageCount int
+}
+
+// StructureStore keeps computed structures so files aren't reopened on
+// every request
+type StructureStore interface {
+	GetBookStructure(bookID string) (tocJSON string, pageCount int, ok bool, err error)
+	SaveBookStructure(bookID, tocJSON string, pageCount int) error
+}
+
+// ReadStructure reads a book's structure from its file
+func ReadStructure(filePath, fileFormat string) (*Structure, error) {
+	s := &Structure{}
+	var err error
+	switch fileFormat {
+	case models.FileFormatEPUB:
+		if s.Chapters, err = epub.GetTableOfContents(filePath); err == nil {
+			s.PageCount, err = epub.EstimatePageCount(filePath)
+		}
+	case models.FileFormatCBZ:
+		s.PageCount, err = cbz.GetPageCount(filePath)
+	case models.FileFormatCBR:
+		s.PageCount, err = cbz.GetPageCountCBR(filePath)
+	case models.FileFormatPDF:
+		s.PageCount, err = pdf.GetPageCount(filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveStructure stores a book's structure
+func SaveStructure(store StructureStore, bookID string, s *Structure) error {
+	toc, err := json.Marshal(s.Chapters)
+	if err != nil {
+		return err
+	}
+	return store.SaveBookStructure(bookID, string(toc), s.PageCount)
+}
+
+// LoadStructure returns a book's stored structure, reading it from the
+// file and storing it when there's none yet
+func LoadStructure(store StructureStore, book *models.Book) (*Structure, error) {
+	s, ok, err := StoredStructure(store, book.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return s, nil
+	}
+
+	s, err = ReadStructure(book.FilePath, book.FileFormat)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveStructure(store, book.ID, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StoredStructure returns a book's stored structure without reading its
+// file. ok is false if none is stored or it can't be decoded.
+func StoredStructure(store StructureStore, bookID string) (s *Structure, ok bool, err error) {
+	tocJSON, pageCount, ok, err := store.GetBookStructure(bookID)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	s = &Structure{PageCount: pageCount}
+	if err := json.Unmarshal([]byte(tocJSON), &s.Chapters); err != nil {
+		return nil, false, nil
+	}
+	return s, true, nil
+}
@@ -0,0 +1,50 @@
+package books
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestLoadStructure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comic.cbz")
+	require.NoError(t, os.WriteFile(path, testCBZ(t, `<ComicInfo/>`), 0644))
+	book := &models.Book{ID: "b1", FilePath: path, FileFormat: models.FileFormatCBZ}
+	store := &createStore{}
+
+	// Nothing stored yet: read from the file and kept
+	s, err := LoadStructure(store, book)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.PageCount)
+	assert.Equal(t, 1, store.pages["b1"])
+
+	// Stored: the file isn't read again
+	require.NoError(t, os.Remove(path))
+	store.pages["b1"] = 7
+	s, err = LoadStructure(store, book)
+	require.NoError(t, err)
+	assert.Equal(t, 7, s.PageCount)
+}
+
+func TestLoadStructureEPUB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	require.NoError(t, os.WriteFile(path, testEPUB(t), 0644))
+	book := &models.Book{ID: "b1", FilePath: path, FileFormat: models.FileFormatEPUB}
+	store := &createStore{}
+
+	s, err := LoadStructure(store, book)
+	require.NoError(t, err)
+	require.Len(t, s.Chapters, 1)
+	assert.Equal(t, 1, s.PageCount, "EPUB pages are estimated from the text")
+
+	// A second load decodes the stored chapters
+	s, err = LoadStructure(store, book)
+	require.NoError(t, err)
+	require.Len(t, s.Chapters, 1)
+	assert.Equal(t, "ch1.xhtml", s.Chapters[0].Href)
+}
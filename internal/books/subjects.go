@@ -0,0 +1,64 @@
+package books
+
+import "strings"
+
+// maxSubjectTagLength skips subjects too long to be useful as tags, such
+// as whole sentences some providers put in the subject list
+const maxSubjectTagLength = 50
+
+// SubjectTagNames returns the tags a book's comma-separated subjects become.
+// tagMap renames subjects, keyed by the lowercased subject; a subject
+// mapped to "" is ignored. Names are deduplicated ignoring case.
+func SubjectTagNames(subjects string, tagMap map[string]string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, subject := range strings.Split(subjects, ",") {
+		name := strings.TrimSpace(subject)
+		if mapped, ok := tagMap[NormalizeSubject(name)]; ok {
+			name = strings.TrimSpace(mapped)
+		}
+		if name == "" || len(name) > maxSubjectTagLength {
+			continue
+		}
+
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// NormalizeSubject returns the form subjects are matched in: trimmed and
+// lowercased
+func NormalizeSubject(subject string) string {
+	return strings.ToLower(strings.TrimSpace(subject))
+}
+
+// SubjectTagChanges works out what syncing a book's subject tags to names
+// does, the way Database.SyncSubjectTags does it: names not on the book yet
+// are added, and subject tags no longer among names are removed. Tags added
+// by hand are kept. Names compare ignoring case.
+func SubjectTagChanges(current, subjectTags, names []string) (added, removed []string) {
+	has := func(list []string, name string) bool {
+		for _, n := range list {
+			if strings.EqualFold(n, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range names {
+		if !has(current, name) && !has(added, name) {
+			added = append(added, name)
+		}
+	}
+	for _, name := range subjectTags {
+		if !has(names, name) {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,34 @@
+package books
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectTagNames(t *testing.T) {
+	tagMap := map[string]string{
+		"science fiction": "Sci-Fi",
+		"sf":              "sci-fi",
+		"general":         "",
+	}
+
+	tests := []struct {
+		name     string
+		subjects string
+		want     []string
+	}{
+		{"empty", "", nil},
+		{"plain", "Fantasy, Dragons", []string{"Fantasy", "Dragons"}},
+		{"mapped ignoring case", "Science Fiction, SF", []string{"Sci-Fi"}},
+		{"blocked", "General, Fiction", []string{"Fiction"}},
+		{"duplicates", "fantasy, Fantasy ,", []string{"fantasy"}},
+		{"too long", "History, " + strings.Repeat("x", 60), []string{"History"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SubjectTagNames(tt.subjects, tagMap))
+		})
+	}
+}
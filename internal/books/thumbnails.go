@@ -0,0 +1,76 @@
+package books
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// LoadThumbnails returns thumbnails of a comic's pages from the cache file
+// at cachePath, generating and caching them when there are none or the
+// comic's file has changed since
+func LoadThumbnails(cachePath string, book *models.Book) ([]cbz.Thumbnail, error) {
+	file, err := os.Stat(book.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	if cached, err := os.Stat(cachePath); err == nil && cached.ModTime().After(file.ModTime()) {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var thumbs []cbz.Thumbnail
+			if json.Unmarshal(data, &thumbs) == nil {
+				return thumbs, nil
+			}
+		}
+	}
+
+	var thumbs []cbz.Thumbnail
+	switch book.FileFormat {
+	case models.FileFormatCBZ:
+		thumbs, err = cbz.PageThumbnails(book.FilePath)
+	case models.FileFormatCBR:
+		thumbs, err = cbz.PageThumbnailsCBR(book.FilePath)
+	default:
+		return nil, fmt.Errorf("%s files have no page thumbnails", book.FileFormat)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed cache write only costs generating them again next time
+	if err := writeCache(cachePath, thumbs); err != nil {
+		log.Printf("Warning: failed to cache thumbnails for book %s: %v", book.ID, err)
+	}
+	return thumbs, nil
+}
+
+// writeCache saves v as JSON to cachePath, through a temporary file so a
+// concurrent reader never sees half of it
+func writeCache(cachePath string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".cache-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package books
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/cbz"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestLoadThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	book := &models.Book{ID: "comic", FilePath: filepath.Join(dir, "comic.cbz"), FileFormat: models.FileFormatCBZ}
+	require.NoError(t, os.WriteFile(book.FilePath, testCBZ(t, "<ComicInfo/>"), 0644))
+	cachePath := filepath.Join(dir, "comic.json")
+
+	thumbs, err := LoadThumbnails(cachePath, book)
+	require.NoError(t, err)
+	assert.Equal(t, []cbz.Thumbnail{{Page: 0}}, thumbs, "a page that can't be decoded has no thumbnail")
+	_, err = os.Stat(cachePath)
+	require.NoError(t, err)
+
+	// Served from the cache while it's newer than the file
+	require.NoError(t, os.WriteFile(cachePath, []byte(`[{"page":0,"width":1,"height":1}]`), 0644))
+	thumbs, err = LoadThumbnails(cachePath, book)
+	require.NoError(t, err)
+	assert.Equal(t, []cbz.Thumbnail{{Page: 0, Width: 1, Height: 1}}, thumbs)
+
+	// And generated again once the file changes
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(book.FilePath, later, later))
+	thumbs, err = LoadThumbnails(cachePath, book)
+	require.NoError(t, err)
+	assert.Equal(t, []cbz.Thumbnail{{Page: 0}}, thumbs)
+
+	_, err = LoadThumbnails(cachePath, &models.Book{FilePath: book.FilePath, FileFormat: models.FileFormatEPUB})
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // register GIF decoder
+	"image/jpeg"
+	_ "image/png" // register PNG decoder
+	"io"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/bmp" // register BMP decoder
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+// downscaleQuality is the JPEG quality of scaled pages
+const downscaleQuality = 85
+
+// WriteDownscaled writes a copy of a CBZ to w with each page larger than
+// maxWidth by maxHeight scaled down to fit and saved as JPEG. A zero bound
+// leaves that dimension unlimited. Other files, and pages that fit or
+// can't be decoded, are copied unchanged.
+func WriteDownscaled(w io.Writer, filePath string, maxWidth, maxHeight int) error {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open CBZ: %w", err)
+	}
+	defer r.Close()
+
+	zw := zip.NewWriter(w)
+	for _, f := range r.File {
+		ext := strings.ToLower(filepath.Ext(f.Name))
+		if !imageExtensions[ext] || f.FileInfo().IsDir() {
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+		scaled, ok := downscalePage(data, maxWidth, maxHeight)
+		if !ok {
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     strings.TrimSuffix(f.Name, filepath.Ext(f.Name)) + ".jpg",
+			Method:   zip.Store, // JPEG doesn't compress further
+			Modified: f.Modified,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := pw.Write(scaled); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// downscalePage returns a page scaled to fit the bounds as JPEG, or false
+// if it already fits or can't be decoded
+func downscalePage(data []byte, maxWidth, maxHeight int) ([]byte, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	width, height := fitWithin(cfg.Width, cfg.Height, maxWidth, maxHeight)
+	if width == cfg.Width && height == cfg.Height {
+		return nil, false
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: downscaleQuality}); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// fitWithin returns the largest size with the aspect ratio of width by
+// height that fits the bounds, never larger than the original
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+// readZipFile reads the contents of a file in a zip
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,80 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDownscaled(t *testing.T) {
+	page := func(w, h int) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))))
+		return buf.Bytes()
+	}
+
+	path := filepath.Join(t.TempDir(), "comic.cbz")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(out)
+	for name, data := range map[string][]byte{
+		"ComicInfo.xml": []byte("<ComicInfo/>"),
+		"001.png":       page(400, 200),
+		"002.png":       page(50, 80),
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDownscaled(&buf, path, 100, 0))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	sizes := map[string]image.Point{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		cfg, _, err := image.DecodeConfig(rc)
+		rc.Close()
+		if err == nil {
+			sizes[f.Name] = image.Pt(cfg.Width, cfg.Height)
+		} else {
+			sizes[f.Name] = image.Point{}
+		}
+	}
+
+	assert.Equal(t, map[string]image.Point{
+		"ComicInfo.xml": {},
+		"001.jpg":       {100, 50}, // Scaled to fit, keeping its shape
+		"002.png":       {50, 80},  // Already fits
+	}, sizes)
+}
+
+func TestFitWithin(t *testing.T) {
+	tests := []struct {
+		w, h, maxW, maxH int
+		wantW, wantH     int
+	}{
+		{1000, 2000, 500, 500, 250, 500},
+		{1000, 2000, 0, 1000, 500, 1000},
+		{1000, 500, 400, 0, 400, 200},
+		{300, 300, 500, 500, 300, 300},
+		{300, 300, 0, 0, 300, 300},
+	}
+	for _, tt := range tests {
+		w, h := fitWithin(tt.w, tt.h, tt.maxW, tt.maxH)
+		assert.Equal(t, [2]int{tt.wantW, tt.wantH}, [2]int{w, h}, "%dx%d in %dx%d", tt.w, tt.h, tt.maxW, tt.maxH)
+	}
+}
@@ -8,13 +8,14 @@ import (
 
 // ComicFilenameInfo contains parsed metadata from a comic filename
 type ComicFilenameInfo struct {
-	Series      string  // Cleaned series name
-	Title       string  // Full cleaned title (series + issue info)
-	IssueNumber string  // Issue number as string (could be "1", "001", "1.5", "Annual 1")
-	IssueFloat  float64 // Issue number as float for sorting
-	Volume      int     // Volume number if present
-	Year        int     // Publication year if found
-	RawFilename string  // Original filename for reference
+	Series         string  `json:"series"`                    // Cleaned series name
+	Title          string  `json:"title"`                     // Full cleaned title (series + issue info)
+	IssueNumber    string  `json:"issue_number"`              // Issue number as string (could be "1", "001", "1.5", "Annual 1")
+	IssueFloat     float64 `json:"issue_float"`               // Issue number as float for sorting
+	Volume         int     `json:"volume"`                    // Volume number if present
+	Year           int     `json:"year"`                      // Publication year if found
+	RawFilename    string  `json:"raw_filename"`              // Original filename for reference
+	MatchedPattern string  `json:"matched_pattern,omitempty"` // Custom pattern that matched, if any
 }
 
 // Common digital release group tags to strip
@@ -80,8 +81,17 @@ var (
 	trailingDashPattern = regexp.MustCompile(`\s*[-–—]\s*$`)
 )
 
-// ParseComicFilename extracts metadata from a comic filename
+// ParseComicFilename extracts metadata from a comic filename. The custom
+// patterns set with SetFilenamePatterns are tried before the built-in ones.
 func ParseComicFilename(filename string) *ComicFilenameInfo {
+	return ParseComicFilenameWith(filename, FilenamePatterns())
+}
+
+// ParseComicFilenameWith extracts metadata from a comic filename, trying
+// patterns in order before the built-in ones. The first pattern that
+// matches sets the fields its groups captured; the built-ins fill in the
+// rest.
+func ParseComicFilenameWith(filename string, patterns []*regexp.Regexp) *ComicFilenameInfo {
 	info := &ComicFilenameInfo{
 		RawFilename: filename,
 	}
@@ -141,8 +151,19 @@ func ParseComicFilename(filename string) *ComicFilenameInfo {
 
 	info.Series = seriesName
 
+	// Custom patterns override what the built-in ones found
+	for _, pattern := range patterns {
+		if applyFilenamePattern(info, pattern, name) {
+			break
+		}
+	}
+	if info.Title != "" {
+		// Set by the pattern's title group
+		return info
+	}
+
 	// Build a clean title
-	title := seriesName
+	title := info.Series
 	if info.Volume > 0 {
 		title += " Vol. " + strconv.Itoa(info.Volume)
 	}
@@ -0,0 +1,115 @@
+package cbz
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// filenamePatternGroups are the named groups a custom filename pattern may
+// capture
+var filenamePatternGroups = map[string]bool{
+	"series": true,
+	"issue":  true,
+	"volume": true,
+	"year":   true,
+	"title":  true,
+}
+
+// maxFilenamePatternLength keeps custom patterns to a reasonable size
+const maxFilenamePatternLength = 500
+
+var (
+	filenamePatternsMu sync.RWMutex
+	filenamePatterns   []*regexp.Regexp
+)
+
+// SetFilenamePatterns sets the custom patterns ParseComicFilename tries
+// before the built-in ones, in order
+func SetFilenamePatterns(patterns []*regexp.Regexp) {
+	filenamePatternsMu.Lock()
+	defer filenamePatternsMu.Unlock()
+	filenamePatterns = patterns
+}
+
+// FilenamePatterns returns the custom patterns ParseComicFilename tries
+func FilenamePatterns() []*regexp.Regexp {
+	filenamePatternsMu.RLock()
+	defer filenamePatternsMu.RUnlock()
+	return filenamePatterns
+}
+
+// CompileFilenamePattern compiles a custom filename pattern. It must
+// capture series or issue with a named group, such as (?P<series>...), and
+// may also capture volume, year and title. Patterns are matched against the
+// filename without its extension.
+func CompileFilenamePattern(expr string) (*regexp.Regexp, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, errors.New("pattern is empty")
+	}
+	if len(expr) > maxFilenamePatternLength {
+		return nil, fmt.Errorf("pattern is longer than %d characters", maxFilenamePatternLength)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	named := make(map[string]bool)
+	for _, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if !filenamePatternGroups[name] {
+			return nil, fmt.Errorf("unknown group %q (want series, issue, volume, year or title)", name)
+		}
+		named[name] = true
+	}
+	if !named["series"] && !named["issue"] {
+		return nil, errors.New("pattern must capture series or issue")
+	}
+	return re, nil
+}
+
+// applyFilenamePattern sets the fields of info that pattern's groups
+// capture from name, reporting whether it matched. Groups that match
+// nothing, and numbers that don't parse, are left to the built-in parse.
+func applyFilenamePattern(info *ComicFilenameInfo, pattern *regexp.Regexp, name string) bool {
+	matches := pattern.FindStringSubmatch(name)
+	if matches == nil {
+		return false
+	}
+	for i, group := range pattern.SubexpNames() {
+		value := strings.TrimSpace(matches[i])
+		if group == "" || value == "" {
+			continue
+		}
+		switch group {
+		case "series":
+			if !strings.Contains(value, " ") {
+				// Scene names separate words with dots or underscores
+				value = strings.NewReplacer(".", " ", "_", " ").Replace(value)
+			}
+			value = multiSpacePattern.ReplaceAllString(value, " ")
+			info.Series = strings.TrimSpace(trailingDashPattern.ReplaceAllString(value, ""))
+		case "issue":
+			info.IssueNumber = value
+			info.IssueFloat, _ = strconv.ParseFloat(value, 64)
+		case "volume":
+			if v, err := strconv.Atoi(value); err == nil {
+				info.Volume = v
+			}
+		case "year":
+			if y, err := strconv.Atoi(value); err == nil && y >= 1900 && y <= 2100 {
+				info.Year = y
+			}
+		case "title":
+			info.Title = value
+		}
+	}
+	info.MatchedPattern = pattern.String()
+	return true
+}
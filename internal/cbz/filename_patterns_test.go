@@ -0,0 +1,50 @@
+package cbz
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileFilenamePattern(t *testing.T) {
+	_, err := CompileFilenamePattern(`^(?P<series>.+?)\.(?P<issue>\d+)$`)
+	assert.NoError(t, err)
+
+	for _, expr := range []string{
+		"",
+		`(?P<series>.+`,
+		`^(.+)\.(\d+)$`,
+		`^(?P<series>.+)\.(?P<number>\d+)$`,
+	} {
+		_, err := CompileFilenamePattern(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestParseComicFilenameWithPatterns(t *testing.T) {
+	scene, err := CompileFilenamePattern(`^(?P<series>[A-Za-z.]+)\.(?P<issue>\d{3})\.(?P<year>\d{4})`)
+	require.NoError(t, err)
+	unmatched := regexp.MustCompile(`^never (?P<series>.+)$`)
+	patterns := []*regexp.Regexp{unmatched, scene}
+
+	info := ParseComicFilenameWith("The.Walking.Dead.193.2019.Digital.cbz", patterns)
+	assert.Equal(t, "The Walking Dead", info.Series)
+	assert.Equal(t, "193", info.IssueNumber)
+	assert.Equal(t, 193.0, info.IssueFloat)
+	assert.Equal(t, 2019, info.Year)
+	assert.Equal(t, "The Walking Dead #193 (2019)", info.Title)
+	assert.Equal(t, scene.String(), info.MatchedPattern)
+
+	// Names the patterns don't match fall back to the built-ins
+	info = ParseComicFilenameWith("Batman #1 (2020).cbz", patterns)
+	assert.Equal(t, "Batman", info.Series)
+	assert.Equal(t, "1", info.IssueNumber)
+	assert.Empty(t, info.MatchedPattern)
+
+	// Registered patterns are used by ParseComicFilename
+	SetFilenamePatterns([]*regexp.Regexp{scene})
+	defer SetFilenamePatterns(nil)
+	assert.Equal(t, "The Walking Dead", ParseComicFilename("The.Walking.Dead.193.2019.cbz").Series)
+}
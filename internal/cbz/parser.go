@@ -22,6 +22,9 @@ type Metadata struct {
 	PageCount   int
 	ContentType string // Always "comic" for CBZ/CBR
 	RawFilename string // Original filename for reference
+	Manga       bool   // Read right-to-left
+	LongStrip   bool   // Pages are slices of one tall strip, as in webtoons
+	AgeRating   string // ComicInfo's AgeRating as written, such as "Teen" or "Mature 17+"
 }
 
 // CoverImage contains extracted cover image data
@@ -61,6 +64,7 @@ func ParseCBZ(filePath, originalFilename string) (*Metadata, error) {
 		}
 	}
 	meta.PageCount = len(imageFiles)
+	meta.LongStrip = detectLongStrip(sortedPages(&r.Reader))
 
 	// Parse filename using the robust parser
 	meta.RawFilename = originalFilename
@@ -89,6 +93,8 @@ func ParseCBZ(filePath, originalFilename string) (*Metadata, error) {
 				if info.Writer != "" {
 					meta.Author = info.Writer
 				}
+				meta.Manga = info.IsManga()
+				meta.AgeRating = info.AgeRating
 			}
 			break
 		}
@@ -305,10 +311,18 @@ func getImageContentType(ext string) string {
 
 // ComicInfo represents the ComicInfo.xml metadata format
 type ComicInfo struct {
-	Title  string
-	Series string
-	Number float64
-	Writer string
+	Title     string
+	Series    string
+	Number    float64
+	Writer    string
+	Manga     string // "Yes", "YesAndRightToLeft", "No", or "Unknown"
+	AgeRating string // Such as "Everyone", "Teen", "Mature 17+", or "Unknown"
+}
+
+// IsManga reports whether the comic is marked as manga. ComicInfo's "Yes"
+// doesn't say which way the pages go, but manga is read right-to-left.
+func (c *ComicInfo) IsManga() bool {
+	return strings.EqualFold(c.Manga, "Yes") || strings.EqualFold(c.Manga, "YesAndRightToLeft")
 }
 
 // parseComicInfo parses ComicInfo.xml from a zip file entry
@@ -331,6 +345,8 @@ func parseComicInfo(f *zip.File) (*ComicInfo, error) {
 	info.Title = extractXMLValue(content, "Title")
 	info.Series = extractXMLValue(content, "Series")
 	info.Writer = extractXMLValue(content, "Writer")
+	info.Manga = extractXMLValue(content, "Manga")
+	info.AgeRating = extractXMLValue(content, "AgeRating")
 
 	if numStr := extractXMLValue(content, "Number"); numStr != "" {
 		fmt.Sscanf(numStr, "%f", &info.Number)
@@ -428,6 +444,8 @@ func ParseCBR(filePath, originalFilename string) (*Metadata, error) {
 			if info.Writer != "" {
 				meta.Author = info.Writer
 			}
+			meta.Manga = info.IsManga()
+			meta.AgeRating = info.AgeRating
 		}
 	}
 
@@ -665,6 +683,8 @@ func parseComicInfoData(data []byte) *ComicInfo {
 	info.Title = extractXMLValue(content, "Title")
 	info.Series = extractXMLValue(content, "Series")
 	info.Writer = extractXMLValue(content, "Writer")
+	info.Manga = extractXMLValue(content, "Manga")
+	info.AgeRating = extractXMLValue(content, "AgeRating")
 
 	if numStr := extractXMLValue(content, "Number"); numStr != "" {
 		fmt.Sscanf(numStr, "%f", &info.Number)
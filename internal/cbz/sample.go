@@ -0,0 +1,107 @@
+package cbz
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nwaples/rardecode/v2"
+)
+
+// WriteFirstPages writes a CBZ of the first n pages of a CBZ to w, with its
+// other files such as ComicInfo.xml
+func WriteFirstPages(w io.Writer, filePath string, n int) error {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open CBZ: %w", err)
+	}
+	defer r.Close()
+
+	dropped := make(map[*zip.File]bool)
+	if pages := sortedPages(&r.Reader); len(pages) > n {
+		for _, f := range pages[n:] {
+			dropped[f] = true
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range r.File {
+		if dropped[f] {
+			continue
+		}
+		if err := zw.Copy(f); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// WriteFirstPagesCBR writes a CBZ of the first n pages of a CBR to w, with
+// its other files such as ComicInfo.xml
+func WriteFirstPagesCBR(w io.Writer, filePath string, n int) error {
+	// The archive is read twice, as pages are ordered by name and RAR files
+	// can't be read out of order
+	pages, err := GetPageListCBR(filePath)
+	if err != nil {
+		return err
+	}
+	if len(pages) > n {
+		pages = pages[:n]
+	}
+	kept := make(map[string]bool, len(pages))
+	for _, name := range pages {
+		kept[name] = true
+	}
+
+	r, err := rardecode.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open CBR: %w", err)
+	}
+	defer r.Close()
+
+	zw := zip.NewWriter(w)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CBR: %w", err)
+		}
+		if header.IsDir {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(header.Name))
+		if imageExtensions[ext] && !kept[header.Name] {
+			continue
+		}
+
+		method := zip.Deflate
+		if imageExtensions[ext] {
+			method = zip.Store // Images don't compress further
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     filepath.ToSlash(header.Name),
+			Method:   method,
+			Modified: modTime(header.ModificationTime),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, r); err != nil {
+			return fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// modTime returns t, or now if the archive didn't record one
+func modTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,39 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFirstPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "comic.cbz")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(out)
+	// Out of order, as pages are read by name
+	for _, name := range []string{"003.png", "ComicInfo.xml", "001.png", "002.png"} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFirstPages(&buf, path, 2))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"ComicInfo.xml", "001.png", "002.png"}, names)
+}
@@ -0,0 +1,199 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Long-strip comics, such as webtoons, are drawn as one tall image cut into
+// pages. Readers show them as a continuous vertical strip rather than page
+// by page.
+const (
+	// longStripRatio is how many times taller than wide a page must be to
+	// count as part of a strip
+	longStripRatio = 2.5
+
+	// longStripSample is how many pages after the cover are checked when
+	// guessing whether a comic is a long strip
+	longStripSample = 10
+
+	// MaxStripWidth and MaxStripSliceHeight bound the slices WriteStripSlice
+	// renders
+	MaxStripWidth       = 2000
+	MaxStripSliceHeight = 8000
+)
+
+// ErrSliceOutOfRange is returned for a slice that starts past the end of the
+// strip
+var ErrSliceOutOfRange = errors.New("slice is past the end of the strip")
+
+// StripPage is where a page falls in a strip: Y is the offset of its top
+// edge and Height its height, both at the strip's width
+type StripPage struct {
+	Page   int `json:"page"`
+	Y      int `json:"y"`
+	Height int `json:"height"`
+}
+
+// Strip is the layout of a comic's pages scaled to one width and stacked
+// top to bottom. Pages that can't be decoded take no space.
+type Strip struct {
+	Width  int         `json:"width"`
+	Height int         `json:"height"`
+	Pages  []StripPage `json:"pages"`
+}
+
+// Slices returns how many slices of sliceHeight cover the strip
+func (s *Strip) Slices(sliceHeight int) int {
+	if sliceHeight <= 0 {
+		return 0
+	}
+	return (s.Height + sliceHeight - 1) / sliceHeight
+}
+
+// sortedPages returns a CBZ's page images in reading order
+func sortedPages(r *zip.Reader) []*zip.File {
+	var pages []*zip.File
+	for _, f := range r.File {
+		ext := strings.ToLower(filepath.Ext(f.Name))
+		if imageExtensions[ext] && !strings.HasPrefix(filepath.Base(f.Name), ".") {
+			pages = append(pages, f)
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Name < pages[j].Name
+	})
+	return pages
+}
+
+// pageConfig reads the dimensions of a page without decoding it
+func pageConfig(f *zip.File) (image.Config, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer rc.Close()
+	cfg, _, err := image.DecodeConfig(rc)
+	return cfg, err
+}
+
+// detectLongStrip guesses whether pages are a long strip: most of the
+// pages after the cover are much taller than they are wide
+func detectLongStrip(pages []*zip.File) bool {
+	if len(pages) > 1 {
+		pages = pages[1:]
+	}
+	if len(pages) > longStripSample {
+		pages = pages[:longStripSample]
+	}
+	tall, checked := 0, 0
+	for _, f := range pages {
+		cfg, err := pageConfig(f)
+		if err != nil || cfg.Width == 0 {
+			continue
+		}
+		checked++
+		if float64(cfg.Height) >= longStripRatio*float64(cfg.Width) {
+			tall++
+		}
+	}
+	return checked > 0 && tall*2 > checked
+}
+
+// layoutStrip scales pages to width and stacks them. A width of zero uses
+// the widest page, up to MaxStripWidth.
+func layoutStrip(pages []*zip.File, width int) *Strip {
+	configs := make([]image.Config, len(pages))
+	widest := 0
+	for i, f := range pages {
+		if cfg, err := pageConfig(f); err == nil {
+			configs[i] = cfg
+			widest = max(widest, cfg.Width)
+		}
+	}
+	if width <= 0 {
+		width = widest
+	}
+	width = min(max(width, 1), MaxStripWidth)
+
+	strip := &Strip{Width: width, Pages: make([]StripPage, 0, len(pages))}
+	for i, cfg := range configs {
+		height := 0
+		if cfg.Width > 0 {
+			height = max(1, int(float64(cfg.Height)*float64(width)/float64(cfg.Width)+0.5))
+		}
+		strip.Pages = append(strip.Pages, StripPage{Page: i, Y: strip.Height, Height: height})
+		strip.Height += height
+	}
+	return strip
+}
+
+// StripLayout returns the layout of a CBZ's pages scaled to width and
+// stacked. A width of zero uses the widest page, up to MaxStripWidth.
+func StripLayout(filePath string, width int) (*Strip, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CBZ: %w", err)
+	}
+	defer r.Close()
+	return layoutStrip(sortedPages(&r.Reader), width), nil
+}
+
+// WriteStripSlice writes one slice of a CBZ's strip to w as JPEG: the
+// pages scaled to width and stacked, cut into slices sliceHeight tall, of
+// which slice is counted from zero. The last slice is only as tall as what
+// is left of the strip. It returns the strip's layout.
+func WriteStripSlice(w io.Writer, filePath string, width, sliceHeight, slice int) (*Strip, error) {
+	if sliceHeight <= 0 || sliceHeight > MaxStripSliceHeight {
+		return nil, fmt.Errorf("slice height must be between 1 and %d", MaxStripSliceHeight)
+	}
+
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CBZ: %w", err)
+	}
+	defer r.Close()
+
+	pages := sortedPages(&r.Reader)
+	strip := layoutStrip(pages, width)
+	top := slice * sliceHeight
+	if slice < 0 || top >= strip.Height {
+		return strip, ErrSliceOutOfRange
+	}
+	bottom := min(top+sliceHeight, strip.Height)
+
+	dst := image.NewRGBA(image.Rect(0, 0, strip.Width, bottom-top))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for _, p := range strip.Pages {
+		if p.Height == 0 || p.Y+p.Height <= top || p.Y >= bottom {
+			continue
+		}
+		data, err := readZipFile(pages[p.Page])
+		if err != nil {
+			return strip, err
+		}
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			continue // Left blank, as it was in the layout
+		}
+		// Only the part of the page inside the slice is drawn
+		rect := image.Rect(0, p.Y-top, strip.Width, p.Y-top+p.Height)
+		draw.CatmullRom.Scale(dst, rect, src, src.Bounds(), draw.Over, nil)
+	}
+
+	if err := jpeg.Encode(w, dst, &jpeg.Options{Quality: downscaleQuality}); err != nil {
+		return strip, err
+	}
+	return strip, nil
+}
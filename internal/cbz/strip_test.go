@@ -0,0 +1,83 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeStripCBZ writes a CBZ whose pages have the given sizes
+func writeStripCBZ(t *testing.T, sizes ...image.Point) string {
+	path := filepath.Join(t.TempDir(), "strip.cbz")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(out)
+	for i, size := range sizes {
+		w, err := zw.Create(fmt.Sprintf("%03d.png", i+1))
+		require.NoError(t, err)
+		require.NoError(t, png.Encode(w, image.NewGray(image.Rect(0, 0, size.X, size.Y))))
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, out.Close())
+	return path
+}
+
+func TestParseCBZLongStrip(t *testing.T) {
+	// A cover followed by pages of one tall strip
+	strip := writeStripCBZ(t, image.Pt(80, 120), image.Pt(80, 400), image.Pt(80, 400), image.Pt(80, 300))
+	meta, err := ParseCBZ(strip, "Tower of God 001.cbz")
+	require.NoError(t, err)
+	assert.True(t, meta.LongStrip)
+
+	pages := writeStripCBZ(t, image.Pt(80, 120), image.Pt(80, 120), image.Pt(80, 400))
+	meta, err = ParseCBZ(pages, "Saga 001.cbz")
+	require.NoError(t, err)
+	assert.False(t, meta.LongStrip)
+}
+
+func TestStripLayout(t *testing.T) {
+	path := writeStripCBZ(t, image.Pt(100, 300), image.Pt(50, 100))
+
+	strip, err := StripLayout(path, 0)
+	require.NoError(t, err)
+	assert.Equal(t, &Strip{Width: 100, Height: 500, Pages: []StripPage{
+		{Page: 0, Y: 0, Height: 300},
+		{Page: 1, Y: 300, Height: 200}, // Scaled up to the widest page
+	}}, strip)
+
+	strip, err = StripLayout(path, 50)
+	require.NoError(t, err)
+	assert.Equal(t, 250, strip.Height)
+	assert.Equal(t, 3, strip.Slices(100))
+}
+
+func TestWriteStripSlice(t *testing.T) {
+	path := writeStripCBZ(t, image.Pt(100, 300), image.Pt(50, 100))
+
+	sliceSize := func(slice int) image.Point {
+		var buf bytes.Buffer
+		_, err := WriteStripSlice(&buf, path, 0, 200, slice)
+		require.NoError(t, err)
+		cfg, err := jpeg.DecodeConfig(&buf)
+		require.NoError(t, err)
+		return image.Pt(cfg.Width, cfg.Height)
+	}
+	assert.Equal(t, image.Pt(100, 200), sliceSize(0))
+	assert.Equal(t, image.Pt(100, 200), sliceSize(1))
+	assert.Equal(t, image.Pt(100, 100), sliceSize(2), "the last slice is what's left")
+
+	var buf bytes.Buffer
+	strip, err := WriteStripSlice(&buf, path, 0, 200, 3)
+	assert.ErrorIs(t, err, ErrSliceOutOfRange)
+	assert.Equal(t, 3, strip.Slices(200))
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,117 @@
+package cbz
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nwaples/rardecode/v2"
+	"golang.org/x/image/draw"
+)
+
+// Page thumbnails fit within ThumbnailMaxWidth by ThumbnailMaxHeight, small
+// enough for a reader to show every page in a seek strip
+const (
+	ThumbnailMaxWidth  = 240
+	ThumbnailMaxHeight = 160
+
+	// thumbnailQuality is the JPEG quality of page thumbnails
+	thumbnailQuality = 70
+)
+
+// Thumbnail is a small JPEG of one page. Data is empty for a page that
+// can't be decoded.
+type Thumbnail struct {
+	Page   int    `json:"page"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// PageThumbnails returns a thumbnail of each page of a CBZ, in reading order
+func PageThumbnails(filePath string) ([]Thumbnail, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CBZ: %w", err)
+	}
+	defer r.Close()
+
+	pages := sortedPages(&r.Reader)
+	thumbs := make([]Thumbnail, 0, len(pages))
+	for i, f := range pages {
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		thumbs = append(thumbs, thumbnailPage(i, data))
+	}
+	return thumbs, nil
+}
+
+// PageThumbnailsCBR returns a thumbnail of each page of a CBR, in reading
+// order. The archive is read once, as RAR files can't be read out of order.
+func PageThumbnailsCBR(filePath string) ([]Thumbnail, error) {
+	r, err := rardecode.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CBR: %w", err)
+	}
+	defer r.Close()
+
+	byName := make(map[string]Thumbnail)
+	var names []string
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CBR: %w", err)
+		}
+
+		ext := strings.ToLower(filepath.Ext(header.Name))
+		if !imageExtensions[ext] || strings.HasPrefix(filepath.Base(header.Name), ".") {
+			continue
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page: %w", err)
+		}
+		names = append(names, header.Name)
+		byName[header.Name] = thumbnailPage(0, data)
+	}
+
+	sort.Strings(names)
+	thumbs := make([]Thumbnail, 0, len(names))
+	for i, name := range names {
+		thumb := byName[name]
+		thumb.Page = i
+		thumbs = append(thumbs, thumb)
+	}
+	return thumbs, nil
+}
+
+// thumbnailPage scales a page to fit the thumbnail bounds as JPEG
+func thumbnailPage(page int, data []byte) Thumbnail {
+	thumb := Thumbnail{Page: page}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return thumb
+	}
+	bounds := src.Bounds()
+	width, height := fitWithin(bounds.Dx(), bounds.Dy(), ThumbnailMaxWidth, ThumbnailMaxHeight)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return thumb
+	}
+	thumb.Width, thumb.Height, thumb.Data = width, height, buf.Bytes()
+	return thumb
+}
@@ -0,0 +1,33 @@
+package cbz
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageThumbnails(t *testing.T) {
+	path := writeStripCBZ(t, image.Pt(600, 900), image.Pt(1200, 900), image.Pt(100, 50))
+
+	thumbs, err := PageThumbnails(path)
+	require.NoError(t, err)
+	require.Len(t, thumbs, 3)
+
+	sizes := make([]image.Point, len(thumbs))
+	for i, thumb := range thumbs {
+		assert.Equal(t, i, thumb.Page)
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumb.Data))
+		require.NoError(t, err)
+		assert.Equal(t, image.Pt(thumb.Width, thumb.Height), image.Pt(cfg.Width, cfg.Height))
+		sizes[i] = image.Pt(cfg.Width, cfg.Height)
+	}
+	assert.Equal(t, []image.Point{
+		{106, 160}, // Fit to the height
+		{213, 160}, // A spread, still within the width
+		{100, 50},  // Already small enough
+	}, sizes)
+}
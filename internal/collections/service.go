@@ -0,0 +1,364 @@
+// Package collections holds the business logic for static and smart
+// collections. Storage is behind the Store interface so the rules can be
+// tested without a database.
+package collections
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ErrNotFound is returned when a collection does not exist
+var ErrNotFound = errors.New("collection not found")
+
+// ErrParentCycle is returned when a collection would be nested in itself or
+// one of its subcollections
+var ErrParentCycle = errors.New("collection can't be nested in itself")
+
+// ErrSmartCollection is returned when reordering a smart collection, whose
+// matches are ordered by title
+var ErrSmartCollection = errors.New("smart collections can't be reordered")
+
+// Store is the subset of storage.Database the collection service uses
+type Store interface {
+	CreateCollection(collection *models.Collection) error
+	GetCollection(id string) (*models.Collection, error)
+	ListCollections() ([]models.Collection, error)
+	ListCollectionsWithCounts(userID string) ([]models.Collection, error)
+	UpdateCollection(id, name string) error
+	UpdateSmartCollection(id, name, ruleLogic string) error
+	SetCollectionParent(id, parentID string) error
+	DeleteCollection(id string) error
+	CreateCollectionRule(rule *models.CollectionRule) error
+	GetCollectionRules(collectionID string) ([]models.CollectionRule, error)
+	DeleteCollectionRules(collectionID string) error
+	AddBookToCollection(bookID, collectionID string) error
+	RemoveBookFromCollection(bookID, collectionID string) error
+	BulkAddBooksToCollection(bookIDs []string, collectionID string) error
+	ReorderCollection(collectionID string, bookIDs []string) error
+	GetBooksInCollection(collectionID string) ([]models.Book, error)
+	GetSmartCollectionBooks(collectionID, userID string) ([]models.Book, error)
+	GetCollectionsForBook(bookID string) ([]models.Collection, error)
+	GetBook(id string) (*models.Book, error)
+}
+
+// Service implements collection operations on top of a Store
+type Service struct {
+	store Store
+}
+
+// NewService creates a collection service
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Rule is one smart collection condition
+type Rule struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Create adds a collection, nested in parentID unless it's empty. Rules are
+// only kept for smart collections, and RuleLogic defaults to AND.
+func (s *Service) Create(userID, name, parentID string, isSmart bool, ruleLogic string, rules []Rule) (*models.Collection, error) {
+	if ruleLogic == "" {
+		ruleLogic = "AND"
+	}
+	if parentID != "" {
+		if _, err := s.find(parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	collection := &models.Collection{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		IsSmart:   isSmart,
+		RuleLogic: ruleLogic,
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.CreateCollection(collection); err != nil {
+		return nil, err
+	}
+	if parentID != "" {
+		if err := s.store.SetCollectionParent(collection.ID, parentID); err != nil {
+			return nil, err
+		}
+		collection.ParentID = parentID
+	}
+
+	if isSmart {
+		collection.Rules = s.addRules(collection.ID, rules)
+	}
+	return collection, nil
+}
+
+// List returns every collection with its current book count. Smart
+// collections count their matches in the user's library.
+func (s *Service) List(userID string) ([]models.Collection, error) {
+	collections, err := s.store.ListCollectionsWithCounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	if collections == nil {
+		collections = []models.Collection{}
+	}
+	return collections, nil
+}
+
+// Get returns a collection, its rules, and the books in it. Smart
+// collections are evaluated against the user's library.
+func (s *Service) Get(id, userID string) (*models.Collection, []models.Book, error) {
+	collection, err := s.find(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if collection.IsSmart {
+		if rules, err := s.store.GetCollectionRules(id); err == nil {
+			collection.Rules = rules
+		}
+	}
+
+	members, err := s.members(collection, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if members == nil {
+		members = []models.Book{}
+	}
+
+	collection.BookCount = len(members)
+	return collection, members, nil
+}
+
+// Update renames a collection. For smart collections it also sets the rule
+// logic (keeping the current one if empty) and replaces the rules when any
+// are given.
+func (s *Service) Update(id, name, ruleLogic string, rules []Rule) error {
+	collection, err := s.find(id)
+	if err != nil {
+		return err
+	}
+
+	if !collection.IsSmart {
+		return s.store.UpdateCollection(id, name)
+	}
+
+	if ruleLogic == "" {
+		ruleLogic = collection.RuleLogic
+	}
+	if err := s.store.UpdateSmartCollection(id, name, ruleLogic); err != nil {
+		return err
+	}
+
+	if len(rules) > 0 {
+		s.store.DeleteCollectionRules(id)
+		s.addRules(id, rules)
+	}
+	return nil
+}
+
+// SetParent nests a collection in another, or moves it to the top level if
+// parentID is empty
+func (s *Service) SetParent(id, parentID string) error {
+	if _, err := s.find(id); err != nil {
+		return err
+	}
+	// Walk up from the new parent; finding the collection there means it
+	// would end up inside itself
+	for ancestor := parentID; ancestor != ""; {
+		if ancestor == id {
+			return ErrParentCycle
+		}
+		parent, err := s.find(ancestor)
+		if err != nil {
+			return err
+		}
+		ancestor = parent.ParentID
+	}
+	return s.store.SetCollectionParent(id, parentID)
+}
+
+// Children returns the collections nested directly in a collection, with
+// their book counts
+func (s *Service) Children(id, userID string) ([]models.Collection, error) {
+	all, err := s.store.ListCollectionsWithCounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	children := []models.Collection{}
+	for _, c := range all {
+		if c.ParentID == id {
+			children = append(children, c)
+		}
+	}
+	return children, nil
+}
+
+// Rollup returns a collection and the books in it and every collection
+// nested in it, at any depth. Each book is listed once: the collection's
+// own books come first, then each subcollection's in name order, depth
+// first.
+func (s *Service) Rollup(id, userID string) (*models.Collection, []models.Book, error) {
+	collection, own, err := s.Get(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := s.store.ListCollections()
+	if err != nil {
+		return nil, nil, err
+	}
+	children := map[string][]models.Collection{}
+	for _, c := range all {
+		if c.ParentID != "" {
+			children[c.ParentID] = append(children[c.ParentID], c)
+		}
+	}
+
+	visited := map[string]bool{id: true}
+	listed := map[string]bool{}
+	members := []models.Book{}
+	add := func(books []models.Book) {
+		for _, b := range books {
+			if !listed[b.ID] {
+				listed[b.ID] = true
+				members = append(members, b)
+			}
+		}
+	}
+	add(own)
+	var walk func(parentID string) error
+	walk = func(parentID string) error {
+		for i := range children[parentID] {
+			child := &children[parentID][i]
+			// Guards against a cycle written to the database directly
+			if visited[child.ID] {
+				continue
+			}
+			visited[child.ID] = true
+			books, err := s.members(child, userID)
+			if err != nil {
+				return err
+			}
+			add(books)
+			if err := walk(child.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(id); err != nil {
+		return nil, nil, err
+	}
+
+	collection.BookCount = len(members)
+	return collection, members, nil
+}
+
+// Reorder sets the order of the books in a static collection
+func (s *Service) Reorder(id string, bookIDs []string) error {
+	collection, err := s.find(id)
+	if err != nil {
+		return err
+	}
+	if collection.IsSmart {
+		return ErrSmartCollection
+	}
+	return s.store.ReorderCollection(id, bookIDs)
+}
+
+// Delete removes a collection. Collections nested in it move to the top
+// level.
+func (s *Service) Delete(id string) error {
+	if _, err := s.find(id); err != nil {
+		return err
+	}
+	return s.store.DeleteCollection(id)
+}
+
+// AddBook adds a book to a static collection
+func (s *Service) AddBook(collectionID, bookID string) error {
+	if _, err := s.find(collectionID); err != nil {
+		return err
+	}
+	if _, err := s.store.GetBook(bookID); err != nil {
+		return books.ErrNotFound
+	}
+	return s.store.AddBookToCollection(bookID, collectionID)
+}
+
+// RemoveBook removes a book from a collection
+func (s *Service) RemoveBook(collectionID, bookID string) error {
+	return s.store.RemoveBookFromCollection(bookID, collectionID)
+}
+
+// AddBooks adds several books to a collection at once
+func (s *Service) AddBooks(collectionID string, bookIDs []string) error {
+	if _, err := s.find(collectionID); err != nil {
+		return err
+	}
+	return s.store.BulkAddBooksToCollection(bookIDs, collectionID)
+}
+
+// ForBook returns the collections a book belongs to
+func (s *Service) ForBook(bookID string) ([]models.Collection, error) {
+	if _, err := s.store.GetBook(bookID); err != nil {
+		return nil, books.ErrNotFound
+	}
+
+	collections, err := s.store.GetCollectionsForBook(bookID)
+	if err != nil {
+		return nil, err
+	}
+	if collections == nil {
+		collections = []models.Collection{}
+	}
+	return collections, nil
+}
+
+// find looks up a collection, mapping a missing row to ErrNotFound
+func (s *Service) find(id string) (*models.Collection, error) {
+	collection, err := s.store.GetCollection(id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return collection, err
+}
+
+// members returns a collection's members: rule matches for smart collections,
+// manually added books otherwise
+func (s *Service) members(collection *models.Collection, userID string) ([]models.Book, error) {
+	if collection.IsSmart {
+		return s.store.GetSmartCollectionBooks(collection.ID, userID)
+	}
+	return s.store.GetBooksInCollection(collection.ID)
+}
+
+// addRules stores rules for a collection, skipping any that fail, and
+// returns the ones saved
+func (s *Service) addRules(collectionID string, rules []Rule) []models.CollectionRule {
+	var saved []models.CollectionRule
+	for _, r := range rules {
+		rule := &models.CollectionRule{
+			ID:           uuid.New().String(),
+			CollectionID: collectionID,
+			Field:        r.Field,
+			Operator:     r.Operator,
+			Value:        r.Value,
+		}
+		if err := s.store.CreateCollectionRule(rule); err != nil {
+			continue
+		}
+		saved = append(saved, *rule)
+	}
+	return saved
+}
@@ -0,0 +1,295 @@
+package collections
+
+import (
+	"database/sql"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/books"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// fakeStore is an in-memory Store. Smart collections match every book.
+type fakeStore struct {
+	collections map[string]*models.Collection
+	rules       map[string][]models.CollectionRule
+	members     map[string][]string // collection ID -> book IDs
+	books       map[string]models.Book
+}
+
+func newFakeStore(bookIDs ...string) *fakeStore {
+	s := &fakeStore{
+		collections: map[string]*models.Collection{},
+		rules:       map[string][]models.CollectionRule{},
+		members:     map[string][]string{},
+		books:       map[string]models.Book{},
+	}
+	for _, id := range bookIDs {
+		s.books[id] = models.Book{ID: id}
+	}
+	return s
+}
+
+func (s *fakeStore) CreateCollection(collection *models.Collection) error {
+	copied := *collection
+	s.collections[collection.ID] = &copied
+	return nil
+}
+
+func (s *fakeStore) GetCollection(id string) (*models.Collection, error) {
+	c, ok := s.collections[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (s *fakeStore) ListCollections() ([]models.Collection, error) {
+	var out []models.Collection
+	for _, c := range s.collections {
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (s *fakeStore) ListCollectionsWithCounts(userID string) ([]models.Collection, error) {
+	var out []models.Collection
+	for _, c := range s.collections {
+		copied := *c
+		copied.BookCount = len(s.members[c.ID])
+		if c.IsSmart {
+			copied.BookCount = len(s.books)
+		}
+		out = append(out, copied)
+	}
+	return out, nil
+}
+
+func (s *fakeStore) UpdateCollection(id, name string) error {
+	s.collections[id].Name = name
+	return nil
+}
+
+func (s *fakeStore) UpdateSmartCollection(id, name, ruleLogic string) error {
+	s.collections[id].Name = name
+	s.collections[id].RuleLogic = ruleLogic
+	return nil
+}
+
+func (s *fakeStore) SetCollectionParent(id, parentID string) error {
+	s.collections[id].ParentID = parentID
+	return nil
+}
+
+func (s *fakeStore) DeleteCollection(id string) error {
+	delete(s.collections, id)
+	return nil
+}
+
+func (s *fakeStore) CreateCollectionRule(rule *models.CollectionRule) error {
+	s.rules[rule.CollectionID] = append(s.rules[rule.CollectionID], *rule)
+	return nil
+}
+
+func (s *fakeStore) GetCollectionRules(collectionID string) ([]models.CollectionRule, error) {
+	return s.rules[collectionID], nil
+}
+
+func (s *fakeStore) DeleteCollectionRules(collectionID string) error {
+	delete(s.rules, collectionID)
+	return nil
+}
+
+func (s *fakeStore) AddBookToCollection(bookID, collectionID string) error {
+	s.members[collectionID] = append(s.members[collectionID], bookID)
+	return nil
+}
+
+func (s *fakeStore) RemoveBookFromCollection(bookID, collectionID string) error {
+	kept := s.members[collectionID][:0]
+	for _, id := range s.members[collectionID] {
+		if id != bookID {
+			kept = append(kept, id)
+		}
+	}
+	s.members[collectionID] = kept
+	return nil
+}
+
+func (s *fakeStore) BulkAddBooksToCollection(bookIDs []string, collectionID string) error {
+	s.members[collectionID] = append(s.members[collectionID], bookIDs...)
+	return nil
+}
+
+func (s *fakeStore) ReorderCollection(collectionID string, bookIDs []string) error {
+	s.members[collectionID] = bookIDs
+	return nil
+}
+
+func (s *fakeStore) GetBooksInCollection(collectionID string) ([]models.Book, error) {
+	var out []models.Book
+	for _, id := range s.members[collectionID] {
+		out = append(out, s.books[id])
+	}
+	return out, nil
+}
+
+func (s *fakeStore) GetSmartCollectionBooks(collectionID, userID string) ([]models.Book, error) {
+	var out []models.Book
+	for _, b := range s.books {
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func (s *fakeStore) GetCollectionsForBook(bookID string) ([]models.Collection, error) {
+	var out []models.Collection
+	for collectionID, ids := range s.members {
+		for _, id := range ids {
+			if id == bookID {
+				out = append(out, *s.collections[collectionID])
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *fakeStore) GetBook(id string) (*models.Book, error) {
+	b, ok := s.books[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &b, nil
+}
+
+func TestStaticCollection(t *testing.T) {
+	store := newFakeStore("b1", "b2")
+	svc := NewService(store)
+
+	collection, err := svc.Create("u1", "Favorites", "", false, "", []Rule{{Field: "author", Operator: "equals", Value: "x"}})
+	require.NoError(t, err)
+	assert.Equal(t, "AND", collection.RuleLogic, "rule logic defaults to AND")
+	assert.Empty(t, collection.Rules, "static collections ignore rules")
+
+	require.NoError(t, svc.AddBook(collection.ID, "b1"))
+	assert.ErrorIs(t, svc.AddBook(collection.ID, "missing"), books.ErrNotFound)
+	assert.ErrorIs(t, svc.AddBook("missing", "b1"), ErrNotFound)
+
+	got, members, err := svc.Get(collection.ID, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.BookCount)
+	require.Len(t, members, 1)
+
+	forBook, err := svc.ForBook("b1")
+	require.NoError(t, err)
+	require.Len(t, forBook, 1)
+	_, err = svc.ForBook("missing")
+	assert.ErrorIs(t, err, books.ErrNotFound)
+
+	require.NoError(t, svc.RemoveBook(collection.ID, "b1"))
+	_, members, err = svc.Get(collection.ID, "u1")
+	require.NoError(t, err)
+	assert.NotNil(t, members)
+	assert.Empty(t, members)
+
+	require.NoError(t, svc.Update(collection.ID, "Renamed", "", nil))
+	assert.Equal(t, "Renamed", store.collections[collection.ID].Name)
+
+	require.NoError(t, svc.Delete(collection.ID))
+	assert.ErrorIs(t, svc.Delete(collection.ID), ErrNotFound)
+}
+
+func TestSmartCollection(t *testing.T) {
+	store := newFakeStore("b1", "b2", "b3")
+	svc := NewService(store)
+
+	collection, err := svc.Create("u1", "Sci-fi", "", true, "OR", []Rule{
+		{Field: models.RuleFieldTags, Operator: "contains", Value: "sci-fi"},
+	})
+	require.NoError(t, err)
+	require.Len(t, collection.Rules, 1)
+
+	list, err := svc.List("u1")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 3, list[0].BookCount)
+
+	// Empty rule logic keeps the current one; new rules replace the old
+	require.NoError(t, svc.Update(collection.ID, "Space", "", []Rule{
+		{Field: models.RuleFieldAuthor, Operator: "equals", Value: "a"},
+		{Field: models.RuleFieldTitle, Operator: "contains", Value: "b"},
+	}))
+	got, _, err := svc.Get(collection.ID, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "OR", got.RuleLogic)
+	assert.Equal(t, "Space", got.Name)
+	assert.Len(t, got.Rules, 2)
+}
+
+func TestListEmpty(t *testing.T) {
+	list, err := NewService(newFakeStore()).List("u1")
+	require.NoError(t, err)
+	assert.NotNil(t, list)
+}
+
+func TestNestedCollections(t *testing.T) {
+	store := newFakeStore("b1", "b2", "b3")
+	svc := NewService(store)
+
+	comics, err := svc.Create("u1", "Comics", "", false, "", nil)
+	require.NoError(t, err)
+	marvel, err := svc.Create("u1", "Marvel", comics.ID, false, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, comics.ID, marvel.ParentID)
+	xmen, err := svc.Create("u1", "X-Men", marvel.ID, false, "", nil)
+	require.NoError(t, err)
+	_, err = svc.Create("u1", "Orphan", "missing", false, "", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, svc.AddBook(comics.ID, "b1"))
+	require.NoError(t, svc.AddBook(xmen.ID, "b2"))
+	require.NoError(t, svc.AddBook(xmen.ID, "b1"))
+	require.NoError(t, svc.AddBook(marvel.ID, "b3"))
+
+	children, err := svc.Children(comics.ID, "u1")
+	require.NoError(t, err)
+	require.Len(t, children, 1)
+	assert.Equal(t, marvel.ID, children[0].ID)
+
+	// Own books first, then depth first, each book once
+	got, members, err := svc.Rollup(comics.ID, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.BookCount)
+	var ids []string
+	for _, b := range members {
+		ids = append(ids, b.ID)
+	}
+	assert.Equal(t, []string{"b1", "b3", "b2"}, ids)
+
+	assert.ErrorIs(t, svc.SetParent(comics.ID, xmen.ID), ErrParentCycle)
+	assert.ErrorIs(t, svc.SetParent(comics.ID, comics.ID), ErrParentCycle)
+	assert.ErrorIs(t, svc.SetParent(comics.ID, "missing"), ErrNotFound)
+	require.NoError(t, svc.SetParent(xmen.ID, ""))
+	assert.Empty(t, store.collections[xmen.ID].ParentID)
+}
+
+func TestReorderCollection(t *testing.T) {
+	store := newFakeStore("b1", "b2")
+	svc := NewService(store)
+
+	collection, err := svc.Create("u1", "Queue", "", false, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, svc.AddBooks(collection.ID, []string{"b1", "b2"}))
+	require.NoError(t, svc.Reorder(collection.ID, []string{"b2", "b1"}))
+	assert.Equal(t, []string{"b2", "b1"}, store.members[collection.ID])
+
+	smart, err := svc.Create("u1", "Everything", "", true, "", nil)
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.Reorder(smart.ID, []string{"b1"}), ErrSmartCollection)
+	assert.ErrorIs(t, svc.Reorder("missing", nil), ErrNotFound)
+}
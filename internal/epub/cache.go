@@ -0,0 +1,193 @@
+package epub
+
+import (
+	"archive/zip"
+	"container/list"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is how many EPUBs are kept open by default
+const DefaultCacheSize = 32
+
+// archive is an open EPUB with its zip directory indexed by name. The table
+// of contents is parsed on first use.
+type archive struct {
+	path    string
+	modTime time.Time
+	size    int64
+
+	zr    *zip.ReadCloser
+	files map[string]*zip.File // Lowercased name -> entry
+
+	tocOnce  sync.Once
+	chapters []Chapter
+	tocErr   error
+
+	// Guarded by the cache's mutex. An evicted archive is closed once the
+	// last reader releases it.
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+// find returns the entry named name, ignoring case
+func (a *archive) find(name string) (*zip.File, bool) {
+	f, ok := a.files[strings.ToLower(name)]
+	return f, ok
+}
+
+// open opens the entry named name, ignoring case
+func (a *archive) open(name string) (io.ReadCloser, error) {
+	f, ok := a.find(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return f.Open()
+}
+
+// readFile returns the contents of the entry named name
+func (a *archive) readFile(name string) ([]byte, error) {
+	rc, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// tableOfContents returns the book's chapters, parsing them once
+func (a *archive) tableOfContents() ([]Chapter, error) {
+	a.tocOnce.Do(func() {
+		a.chapters, a.tocErr = readTableOfContents(&a.zr.Reader)
+	})
+	return a.chapters, a.tocErr
+}
+
+// archiveCache keeps recently read EPUBs open so serving a chapter and its
+// images and stylesheets doesn't reopen and re-parse the zip each time.
+// Entries are checked against the file's size and modification time, so a
+// replaced file is reopened.
+type archiveCache struct {
+	mu      sync.Mutex
+	max     int
+	lru     *list.List // Front is most recently used
+	entries map[string]*archive
+}
+
+var cache = &archiveCache{
+	max:     DefaultCacheSize,
+	lru:     list.New(),
+	entries: map[string]*archive{},
+}
+
+// SetCacheSize sets how many EPUBs are kept open; 0 disables the cache
+func SetCacheSize(n int) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	cache.max = n
+	cache.evictOverLimit()
+}
+
+// Invalidate drops filePath from the cache, for when the file is deleted
+// or rewritten
+func Invalidate(filePath string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if a, ok := cache.entries[filePath]; ok {
+		cache.remove(a)
+	}
+}
+
+// openArchive returns the EPUB at filePath, from the cache when it's
+// unchanged. Callers must release it when done.
+func openArchive(filePath string) (*archive, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	if a, ok := cache.entries[filePath]; ok {
+		if a.size == info.Size() && a.modTime.Equal(info.ModTime()) {
+			a.refs++
+			cache.lru.MoveToFront(a.elem)
+			cache.mu.Unlock()
+			return a, nil
+		}
+		cache.remove(a)
+	}
+	cache.mu.Unlock()
+
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	a := &archive{
+		path:    filePath,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		zr:      zr,
+		files:   make(map[string]*zip.File, len(zr.File)),
+		refs:    1,
+	}
+	for _, f := range zr.File {
+		// Keep the first of names that differ only in case
+		if _, dup := a.files[strings.ToLower(f.Name)]; !dup {
+			a.files[strings.ToLower(f.Name)] = f
+		}
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.max == 0 {
+		a.evicted = true
+		return a, nil
+	}
+	if existing, ok := cache.entries[filePath]; ok {
+		// Another request opened it first
+		cache.remove(existing)
+	}
+	a.elem = cache.lru.PushFront(a)
+	cache.entries[filePath] = a
+	cache.evictOverLimit()
+	return a, nil
+}
+
+// release marks the caller as done with a, closing it if it was evicted
+// while in use
+func (a *archive) release() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	a.refs--
+	if a.evicted && a.refs == 0 {
+		a.zr.Close()
+	}
+}
+
+// remove takes a out of the cache. c.mu must be held.
+func (c *archiveCache) remove(a *archive) {
+	if a.evicted {
+		return
+	}
+	a.evicted = true
+	c.lru.Remove(a.elem)
+	delete(c.entries, a.path)
+	if a.refs == 0 {
+		a.zr.Close()
+	}
+}
+
+// evictOverLimit removes the least recently used archives until the cache
+// fits. c.mu must be held.
+func (c *archiveCache) evictOverLimit() {
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back().Value.(*archive))
+	}
+}
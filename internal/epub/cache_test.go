@@ -0,0 +1,65 @@
+package epub
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveCacheReuse(t *testing.T) {
+	epubPath := createTestEPUB(t)
+	defer os.Remove(epubPath)
+	defer Invalidate(epubPath)
+
+	first, err := openArchive(epubPath)
+	require.NoError(t, err)
+	first.release()
+
+	second, err := openArchive(epubPath)
+	require.NoError(t, err)
+	second.release()
+	assert.Same(t, first, second, "an unchanged file is served from the cache")
+
+	// Rewriting the file reopens it
+	require.NoError(t, os.Chtimes(epubPath, time.Now(), time.Now().Add(time.Minute)))
+	third, err := openArchive(epubPath)
+	require.NoError(t, err)
+	third.release()
+	assert.NotSame(t, first, third)
+	assert.True(t, first.evicted)
+
+	Invalidate(epubPath)
+	assert.True(t, third.evicted)
+	assert.NotContains(t, cache.entries, epubPath)
+}
+
+func TestArchiveCacheEviction(t *testing.T) {
+	SetCacheSize(1)
+	defer SetCacheSize(DefaultCacheSize)
+
+	pathA := createTestEPUB(t)
+	defer os.Remove(pathA)
+	pathB := createTestEPUB(t)
+	defer os.Remove(pathB)
+
+	a, err := openArchive(pathA)
+	require.NoError(t, err)
+
+	// Opening another book evicts the first, but it stays usable until released
+	b, err := openArchive(pathB)
+	require.NoError(t, err)
+	b.release()
+	assert.True(t, a.evicted)
+	content, err := a.readFile("OEBPS/chapter1.xhtml")
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "first chapter")
+	a.release()
+
+	chapters, err := GetTableOfContents(pathA)
+	require.NoError(t, err)
+	assert.Len(t, chapters, 1)
+	assert.Len(t, cache.entries, 1)
+}
@@ -0,0 +1,443 @@
+package epub
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// ==================== Canonical Fragment Identifiers ====================
+
+var (
+	// ErrInvalidCFI is returned for a string that isn't an EPUB CFI
+	ErrInvalidCFI = errors.New("invalid CFI")
+	// ErrChapterNotFound is returned for a chapter index or CFI outside the
+	// book's spine
+	ErrChapterNotFound = errors.New("chapter not found in book")
+)
+
+// CFI is a location in an EPUB as a Canonical Fragment Identifier, as
+// described at https://idpf.org/epub/linking/cfi/. Only what webby resolves
+// is kept: the spine item, and a path to a node in its content document
+// with a character offset. Ranges keep their start, and temporal, spatial
+// and text assertions are dropped.
+type CFI struct {
+	Spine  int    // Index of the item in the spine
+	IDRef  string // The spine item's idref, when the CFI asserts it
+	Path   []int  // Steps from the document's root element, empty for the item itself
+	Offset int    // Characters before the location in the text node Path ends at
+}
+
+// ParseCFI parses an epubcfi(...) string. The bare path inside is accepted
+// too, as some readers store CFIs that way.
+func ParseCFI(s string) (*CFI, error) {
+	body := strings.TrimSpace(s)
+	if strings.HasPrefix(body, "epubcfi(") && strings.HasSuffix(body, ")") {
+		body = body[len("epubcfi(") : len(body)-1]
+	}
+	if !strings.HasPrefix(body, "/") {
+		return nil, ErrInvalidCFI
+	}
+
+	// A range is the path to the common parent, then the start and the end
+	switch parts := splitCFI(body, ','); len(parts) {
+	case 1:
+	case 3:
+		body = parts[0] + parts[1]
+	default:
+		return nil, ErrInvalidCFI
+	}
+
+	parts := splitCFI(body, '!')
+	if len(parts) > 2 {
+		// Indirection into a nested document, which readers don't show
+		return nil, ErrInvalidCFI
+	}
+	steps, idref, _, err := parseCFIPath(parts[0])
+	if err != nil || len(steps) != 2 {
+		return nil, ErrInvalidCFI
+	}
+	spineStep := steps[1]
+	if spineStep < 2 || spineStep%2 != 0 {
+		return nil, ErrInvalidCFI
+	}
+
+	cfi := &CFI{Spine: spineStep/2 - 1, IDRef: idref}
+	if len(parts) == 2 {
+		if cfi.Path, _, cfi.Offset, err = parseCFIPath(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return cfi, nil
+}
+
+// String formats the CFI. The spine is taken to be the package document's
+// third child, as it is in every EPUB the spec's examples and readers
+// produce.
+func (c *CFI) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "epubcfi(/6/%d", 2*(c.Spine+1))
+	if c.IDRef != "" {
+		b.WriteString("[" + escapeCFI(c.IDRef) + "]")
+	}
+	if len(c.Path) > 0 {
+		b.WriteString("!")
+		for _, step := range c.Path {
+			fmt.Fprintf(&b, "/%d", step)
+		}
+		fmt.Fprintf(&b, ":%d", c.Offset)
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// splitCFI splits s at each sep outside an assertion's brackets that isn't
+// escaped with ^
+func splitCFI(s string, sep byte) []string {
+	var parts []string
+	start, inBrackets := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '^':
+			i++
+		case '[':
+			inBrackets = true
+		case ']':
+			inBrackets = false
+		case sep:
+			if !inBrackets {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseCFIPath reads steps such as /4/2[id] and an optional :offset. It
+// returns the idref asserted on the last step, if any.
+func parseCFIPath(s string) (steps []int, idref string, offset int, err error) {
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '/', ':':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			n, convErr := strconv.Atoi(s[i+1 : j])
+			if convErr != nil {
+				return nil, "", 0, ErrInvalidCFI
+			}
+			assertion := ""
+			if j < len(s) && s[j] == '[' {
+				if assertion, j, err = readCFIAssertion(s, j); err != nil {
+					return nil, "", 0, err
+				}
+			}
+			if s[i] == ':' {
+				// Nothing locates further than a character offset
+				return steps, idref, n, nil
+			}
+			steps = append(steps, n)
+			idref, _, _ = strings.Cut(assertion, ";")
+			i = j
+		case '~', '@':
+			// Temporal and spatial offsets only matter for media
+			return steps, idref, 0, nil
+		default:
+			return nil, "", 0, ErrInvalidCFI
+		}
+	}
+	if len(steps) == 0 {
+		return nil, "", 0, ErrInvalidCFI
+	}
+	return steps, idref, 0, nil
+}
+
+// readCFIAssertion reads the bracketed assertion starting at s[i], returning
+// it unescaped and the index after its closing bracket
+func readCFIAssertion(s string, i int) (string, int, error) {
+	var b strings.Builder
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '^':
+			j++
+			if j < len(s) {
+				b.WriteByte(s[j])
+			}
+		case ']':
+			return b.String(), j + 1, nil
+		default:
+			b.WriteByte(s[j])
+		}
+	}
+	return "", 0, ErrInvalidCFI
+}
+
+// escapeCFI escapes the characters with a meaning in CFIs
+func escapeCFI(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("^[](),;=", r) {
+			b.WriteByte('^')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ==================== Chapter Text Points ====================
+
+// textPoint is a character in a content document: the steps to its text
+// node from the root element and its offset in that node
+type textPoint struct {
+	path   []int
+	offset int
+}
+
+// compare orders points in document order: -1 if p is before q, 0 if
+// they're the same, and 1 if p is after q. An element comes before the text
+// inside it.
+func (p textPoint) compare(q textPoint) int {
+	for i := 0; i < len(p.path) && i < len(q.path); i++ {
+		if p.path[i] != q.path[i] {
+			if p.path[i] < q.path[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(p.path) != len(q.path):
+		if len(p.path) < len(q.path) {
+			return -1
+		}
+		return 1
+	case p.offset < q.offset:
+		return -1
+	case p.offset > q.offset:
+		return 1
+	}
+	return 0
+}
+
+// chapterText is the text of a chapter's body with whitespace collapsed as
+// a reader lays it out, and where in the document each character came from
+type chapterText struct {
+	text   []rune
+	points []textPoint
+	blocks []int // Offsets in text where a block element starts, after the first
+}
+
+// readChapterText walks a content document's DOM. Steps are counted as the
+// CFI spec does, elements at even steps and the runs of text around them at
+// odd ones, and offsets in UTF-16 code units as DOM strings are.
+func readChapterText(content string) (*chapterText, error) {
+	doc, err := parseChapter(content)
+	if err != nil {
+		return nil, err
+	}
+	ct := &chapterText{}
+	if root := findElement(doc, "html"); root != nil {
+		ct.walk(root, nil, false)
+	}
+	if n := len(ct.text); n > 0 && ct.text[n-1] == ' ' {
+		ct.text, ct.points = ct.text[:n-1], ct.points[:n-1]
+	}
+	if n := len(ct.blocks); n > 0 && ct.blocks[n-1] >= len(ct.text) {
+		ct.blocks = ct.blocks[:n-1]
+	}
+	return ct, nil
+}
+
+func (ct *chapterText) walk(n *html.Node, path []int, inBody bool) {
+	elements := 0
+	// Code units of the text run since the last element
+	runOffset := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.ElementNode:
+			elements++
+			runOffset = 0
+			if c.Data == "style" || removedElements[c.Data] {
+				continue
+			}
+			if inBody && blockElements[c.Data] {
+				ct.blockAt(len(ct.text))
+			}
+			ct.walk(c, append(path[:len(path):len(path)], 2*elements), inBody || c.Data == "body")
+		case html.TextNode:
+			step := append(path[:len(path):len(path)], 2*elements+1)
+			for _, r := range c.Data {
+				if inBody {
+					if !unicode.IsSpace(r) {
+						ct.add(r, step, runOffset)
+					} else if n := len(ct.text); n > 0 && ct.text[n-1] != ' ' {
+						ct.add(' ', step, runOffset)
+					}
+				}
+				runOffset++
+				if r > 0xffff {
+					runOffset++
+				}
+			}
+		}
+	}
+}
+
+func (ct *chapterText) add(r rune, path []int, offset int) {
+	ct.text = append(ct.text, r)
+	ct.points = append(ct.points, textPoint{path: path, offset: offset})
+}
+
+// blockAt records that a block starts at offset i of the text, unless it's
+// the start of the text or the block inside another starting there
+func (ct *chapterText) blockAt(i int) {
+	if i > 0 && (len(ct.blocks) == 0 || ct.blocks[len(ct.blocks)-1] != i) {
+		ct.blocks = append(ct.blocks, i)
+	}
+}
+
+// splitPoint returns where to end a piece of the text running from start
+// to at most end: the last block start in its second half, or else the
+// last word start there, or else end
+func (ct *chapterText) splitPoint(start, end int) int {
+	floor := start + (end-start)/2
+	for i := len(ct.blocks) - 1; i >= 0; i-- {
+		if b := ct.blocks[i]; b > floor && b <= end {
+			return b
+		} else if b <= floor {
+			break
+		}
+	}
+	for i := end - 1; i >= floor; i-- {
+		if ct.text[i] == ' ' {
+			return i + 1
+		}
+	}
+	return end
+}
+
+// cfiAt returns the CFI of character i of the chapter's text, or of the
+// chapter itself when it has none
+func (ct *chapterText) cfiAt(chapter Chapter, i int) string {
+	cfi := &CFI{Spine: chapter.Index, IDRef: chapter.ID}
+	if len(ct.points) > 0 {
+		p := ct.points[max(0, min(i, len(ct.points)-1))]
+		cfi.Path, cfi.Offset = p.path, p.offset
+	}
+	return cfi.String()
+}
+
+// readChapter returns the table of contents entry and text of chapter index
+func readChapter(filePath string, index int) (Chapter, *chapterText, error) {
+	a, err := openArchive(filePath)
+	if err != nil {
+		return Chapter{}, nil, err
+	}
+	defer a.release()
+
+	chapters, err := a.tableOfContents()
+	if err != nil {
+		return Chapter{}, nil, err
+	}
+	if index < 0 || index >= len(chapters) {
+		return Chapter{}, nil, ErrChapterNotFound
+	}
+	content, err := a.readFile(chapters[index].Href)
+	if err != nil {
+		return Chapter{}, nil, err
+	}
+	ct, err := readChapterText(string(content))
+	return chapters[index], ct, err
+}
+
+// ==================== Conversions ====================
+
+// ChapterCFI returns the CFI of the point progress, from 0 to 1, of the way
+// through a chapter's text. Chapters are indexes into the table of contents.
+func ChapterCFI(filePath string, chapter int, progress float64) (string, error) {
+	ch, ct, err := readChapter(filePath, chapter)
+	if err != nil {
+		return "", err
+	}
+	return ct.cfiAt(ch, int(progress*float64(len(ct.text)))), nil
+}
+
+// OffsetCFI returns the CFI of the character offset characters into a
+// chapter's text, with whitespace collapsed
+func OffsetCFI(filePath string, chapter, offset int) (string, error) {
+	ch, ct, err := readChapter(filePath, chapter)
+	if err != nil {
+		return "", err
+	}
+	return ct.cfiAt(ch, offset), nil
+}
+
+// TextCFI returns the CFI of the start of the first copy of text in a
+// chapter, comparing with whitespace collapsed. It returns ErrTextNotFound
+// if the chapter doesn't contain the text.
+func TextCFI(filePath string, chapter int, text string) (string, error) {
+	needle := strings.Join(strings.Fields(text), " ")
+	if needle == "" {
+		return "", ErrTextNotFound
+	}
+	ch, ct, err := readChapter(filePath, chapter)
+	if err != nil {
+		return "", err
+	}
+	haystack := string(ct.text)
+	idx := strings.Index(haystack, needle)
+	if idx < 0 {
+		return "", ErrTextNotFound
+	}
+	return ct.cfiAt(ch, len([]rune(haystack[:idx]))), nil
+}
+
+// ResolveCFI returns the chapter a CFI points into and where in its text.
+// The spine item is matched by the idref the CFI asserts before its index,
+// so CFIs from an edition with extra spine items still resolve.
+func ResolveCFI(filePath, s string) (*TextLocation, error) {
+	cfi, err := ParseCFI(s)
+	if err != nil {
+		return nil, err
+	}
+	chapters, err := GetTableOfContents(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, ch := range chapters {
+		if cfi.IDRef != "" && ch.ID == cfi.IDRef {
+			index = i
+			break
+		}
+		if ch.Index == cfi.Spine && index < 0 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, ErrChapterNotFound
+	}
+
+	_, ct, err := readChapter(filePath, index)
+	if err != nil {
+		return nil, err
+	}
+	loc := &TextLocation{Chapter: index}
+	if len(cfi.Path) == 0 || len(ct.text) == 0 {
+		return loc, nil
+	}
+	target := textPoint{path: cfi.Path, offset: cfi.Offset}
+	loc.Offset = sort.Search(len(ct.points), func(i int) bool {
+		return ct.points[i].compare(target) >= 0
+	})
+	loc.Progress = float64(loc.Offset) / float64(len(ct.text))
+	return loc, nil
+}
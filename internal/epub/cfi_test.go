@@ -0,0 +1,94 @@
+package epub
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCFI(t *testing.T) {
+	cfi, err := ParseCFI("epubcfi(/6/4[ch2]!/4/2/1:3)")
+	require.NoError(t, err)
+	assert.Equal(t, &CFI{Spine: 1, IDRef: "ch2", Path: []int{4, 2, 1}, Offset: 3}, cfi)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:3)", cfi.String())
+
+	// Ranges resolve to their start
+	cfi, err = ParseCFI("epubcfi(/6/4[ch2]!/4/2,/1:3,/3:9)")
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 2, 1}, cfi.Path)
+	assert.Equal(t, 3, cfi.Offset)
+
+	// Assertions may hold escaped brackets and parameters
+	cfi, err = ParseCFI("epubcfi(/6/2[a^[b;s=x]!/4[body01]/1:0[;s=a])")
+	require.NoError(t, err)
+	assert.Equal(t, "a[b", cfi.IDRef)
+	assert.Equal(t, []int{4, 1}, cfi.Path)
+	assert.Equal(t, "epubcfi(/6/2[a^[b]!/4/1:0)", cfi.String())
+
+	cfi, err = ParseCFI("/6/4[chap01ref]!/4/2/2/1:0")
+	require.NoError(t, err, "a bare path is accepted")
+	assert.Equal(t, "epubcfi(/6/4[chap01ref]!/4/2/2/1:0)", cfi.String())
+
+	for _, s := range []string{"", "6/4!/4/1:0", "epubcfi()", "epubcfi(/6/4!/4/1:0", "epubcfi(/6/3!/4/1:0)", "epubcfi(/6/4!/x)", "epubcfi(/6/4[ch2!/4)"} {
+		_, err := ParseCFI(s)
+		assert.ErrorIs(t, err, ErrInvalidCFI, s)
+	}
+}
+
+func TestCFIConversions(t *testing.T) {
+	epubPath := createTestEPUBWithChapters(t,
+		"<p>Foreword.</p>",
+		"<p>It was a dark and stormy night.</p>",
+		"<p>The rain fell &amp; the <em>wind</em>\n  howled.</p>",
+	)
+	defer os.Remove(epubPath)
+
+	cfi, err := TextCFI(epubPath, 2, "the wind\nhowled")
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/6[ch3]!/4/2/1:16)", cfi)
+	cfi, err = TextCFI(epubPath, 2, "wind")
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/6[ch3]!/4/2/2/1:0)", cfi, "text inside an element")
+	cfi, err = TextCFI(epubPath, 2, "howled")
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/6[ch3]!/4/2/3:3)", cfi, "offsets count the whitespace the reader collapses")
+
+	loc, err := ResolveCFI(epubPath, "epubcfi(/6/6[ch3]!/4/2/1:16)")
+	require.NoError(t, err)
+	assert.Equal(t, 2, loc.Chapter)
+	assert.Equal(t, len("The rain fell & "), loc.Offset)
+
+	cfi, err = ChapterCFI(epubPath, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:0)", cfi)
+	cfi, err = ChapterCFI(epubPath, 1, 0.5)
+	require.NoError(t, err)
+	loc, err = ResolveCFI(epubPath, cfi)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loc.Chapter)
+	assert.InDelta(t, 0.5, loc.Progress, 0.05, "progress survives the round trip")
+
+	cfi, err = OffsetCFI(epubPath, 1, len("It was "))
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:7)", cfi)
+
+	// The asserted idref wins over a spine index from another edition
+	loc, err = ResolveCFI(epubPath, "epubcfi(/6/8[ch2]!/4/2/1:0)")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loc.Chapter)
+
+	// A CFI of the chapter itself is its start
+	loc, err = ResolveCFI(epubPath, "epubcfi(/6/2)")
+	require.NoError(t, err)
+	assert.Equal(t, 0, loc.Chapter)
+	assert.Zero(t, loc.Progress)
+
+	_, err = TextCFI(epubPath, 1, "not in the chapter")
+	assert.ErrorIs(t, err, ErrTextNotFound)
+	_, err = ChapterCFI(epubPath, 9, 0)
+	assert.ErrorIs(t, err, ErrChapterNotFound)
+	_, err = ResolveCFI(epubPath, "epubcfi(/6/40!/4/1:0)")
+	assert.ErrorIs(t, err, ErrChapterNotFound)
+}
@@ -0,0 +1,237 @@
+package epub
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrLinkTargetNotFound is returned by ResolveNote when the chapter has no
+// element with the ID
+var ErrLinkTargetNotFound = errors.New("link target not found")
+
+// Note kinds, from the epub:type or ARIA role of the target or an element
+// around it
+const (
+	NoteKindFootnote = "footnote"
+	NoteKindEndnote  = "endnote"
+	NoteKindNote     = "note"
+)
+
+// noteKinds maps epub:type and role values to note kinds
+var noteKinds = map[string]string{
+	"footnote": NoteKindFootnote, "doc-footnote": NoteKindFootnote,
+	"endnote": NoteKindEndnote, "rearnote": NoteKindEndnote, "doc-endnote": NoteKindEndnote,
+	"note": NoteKindNote,
+}
+
+// blockElements are the elements a note's snippet may be, and that start a
+// new block of a chapter's text. An ID on an inline element, such as an
+// empty anchor at the start of a paragraph, resolves to the block around it.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "li": true, "aside": true, "section": true, "blockquote": true,
+	"dd": true, "dt": true, "td": true, "th": true, "figure": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "ul": true, "ol": true, "dl": true, "tr": true, "article": true, "header": true, "footer": true,
+}
+
+// Note is the content an intra-book link points at, such as a footnote,
+// for showing in a popup instead of jumping there
+type Note struct {
+	Chapter int    `json:"chapter"`
+	ID      string `json:"id"`
+	Kind    string `json:"kind,omitempty"` // footnote, endnote, note, or empty for other targets
+	HTML    string `json:"html"`           // Sanitized like chapter content
+	Text    string `json:"text"`
+	// Backlinks lead back to the links to the note in the book
+	Backlinks []NoteLink `json:"backlinks"`
+}
+
+// NoteLink is a place in the book a link leads to
+type NoteLink struct {
+	Chapter int    `json:"chapter"`
+	ID      string `json:"id,omitempty"`
+	Href    string `json:"href"` // Chapter URL from SanitizeOptions, with the fragment
+}
+
+// ResolveNote returns the element with the given ID in a chapter, widened
+// to the note or block it's part of, with its links rewritten as chapter
+// content is (see SanitizeChapter).
+func ResolveNote(filePath string, chapter int, id string, opts SanitizeOptions) (*Note, error) {
+	a, err := openArchive(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer a.release()
+
+	chapters, err := a.tableOfContents()
+	if err != nil {
+		return nil, err
+	}
+	if chapter < 0 || chapter >= len(chapters) || id == "" {
+		return nil, ErrLinkTargetNotFound
+	}
+
+	content, err := a.readFile(chapters[chapter].Href)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseChapter(string(content))
+	if err != nil {
+		return nil, err
+	}
+	target := findByID(doc, id)
+	if target == nil {
+		return nil, ErrLinkTargetNotFound
+	}
+
+	snippet, kind := noteSnippet(target)
+	note := &Note{Chapter: chapter, ID: id, Kind: kind}
+	note.Backlinks = referencesTo(a, chapters, chapter, id, opts)
+
+	s := newSanitizer(chapters[chapter].Href, chapters, opts)
+	s.rewriteElement(snippet)
+	s.walk(snippet)
+	if note.HTML, err = renderNode(snippet); err != nil {
+		return nil, err
+	}
+	note.Text = strings.Join(strings.Fields(html.UnescapeString(StripHTML(note.HTML))), " ")
+	return note, nil
+}
+
+// findByID returns the element under n with the ID, or an old-style
+// <a name>
+func findByID(n *html.Node, id string) *html.Node {
+	if n.Type == html.ElementNode {
+		for _, a := range n.Attr {
+			if (a.Key == "id" || (a.Key == "name" && n.Data == "a")) && a.Val == id {
+				return n
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findByID(c, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// noteSnippet returns the element to show for a link target and its note
+// kind: the nearest note element around it, or else the nearest block
+func noteSnippet(target *html.Node) (*html.Node, string) {
+	block := target
+	for n := target; n != nil && n.Type == html.ElementNode && n.Data != "body"; n = n.Parent {
+		if kind := nodeNoteKind(n); kind != "" {
+			return n, kind
+		}
+		if !blockElements[block.Data] && blockElements[n.Data] {
+			block = n
+		}
+	}
+	return block, ""
+}
+
+// nodeNoteKind returns the note kind an element's epub:type or role marks
+// it as, or ""
+func nodeNoteKind(n *html.Node) string {
+	for _, a := range n.Attr {
+		if a.Key != "epub:type" && a.Key != "role" {
+			continue
+		}
+		for _, value := range strings.Fields(a.Val) {
+			if kind, ok := noteKinds[value]; ok {
+				return kind
+			}
+		}
+	}
+	return ""
+}
+
+// linkTarget resolves an href in the sanitizer's chapter, numbered
+// chapter, to the chapter and fragment it leads to
+func (s *sanitizer) linkTarget(href string, chapter int) (int, string, bool) {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return 0, "", false
+	}
+	if u.Path == "" {
+		return chapter, u.Fragment, u.Fragment != ""
+	}
+	index, ok := s.chapters[s.resolve(u.Path)]
+	return index, u.Fragment, ok
+}
+
+// referencesTo finds the links in the book to the element with the ID in
+// chapter, searching that chapter first and then the rest in order. Each
+// leads to the link's own ID, or that of the element around it such as a
+// <sup>, or to the start of its chapter if neither has one.
+func referencesTo(a *archive, chapters []Chapter, chapter int, id string, opts SanitizeOptions) []NoteLink {
+	order := []int{chapter}
+	for i := range chapters {
+		if i != chapter {
+			order = append(order, i)
+		}
+	}
+
+	refs := []NoteLink{}
+	for _, i := range order {
+		content, err := a.readFile(chapters[i].Href)
+		if err != nil {
+			continue
+		}
+		doc, err := parseChapter(string(content))
+		if err != nil {
+			continue
+		}
+		s := newSanitizer(chapters[i].Href, chapters, opts)
+		eachLink(doc, func(link *html.Node, href string) {
+			if index, fragment, ok := s.linkTarget(href, i); !ok || index != chapter || fragment != id {
+				return
+			}
+			refID := attr(link, "id")
+			if refID == "" && link.Parent != nil {
+				refID = attr(link.Parent, "id")
+			}
+			refs = append(refs, NoteLink{Chapter: i, ID: refID, Href: chapterLink(opts, i, refID)})
+		})
+	}
+	return refs
+}
+
+// eachLink calls fn with each <a> under n that has an href
+func eachLink(n *html.Node, fn func(link *html.Node, href string)) {
+	if n.Type == html.ElementNode && n.Data == "a" {
+		for _, a := range n.Attr {
+			if a.Key == "href" && a.Namespace == "" {
+				fn(n, a.Val)
+				break
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		eachLink(c, fn)
+	}
+}
+
+// attr returns an element's attribute, or ""
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// chapterLink returns the URL of a place in a chapter
+func chapterLink(opts SanitizeOptions, chapter int, id string) string {
+	link := opts.ChapterURL + strconv.Itoa(chapter)
+	if id != "" {
+		link += "#" + (&url.URL{Fragment: id}).EscapedFragment()
+	}
+	return link
+}
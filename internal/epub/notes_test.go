@@ -0,0 +1,48 @@
+package epub
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveNote(t *testing.T) {
+	epubPath := createTestEPUBWithChapters(t,
+		// A chapter with a footnote referenced from its text
+		`<p>Call me Ishmael.<a epub:type="noteref" id="ref1" href="#fn1">1</a></p>
+<aside epub:type="footnote" id="fn1"><p>A <em>biblical</em> name. See <a href="ch2.xhtml#en1">the endnote</a>.</p></aside>`,
+		// An endnote, and an old-style anchor
+		`<ol><li epub:type="endnote" id="en1"><p>More on names. <a href="ch1.xhtml#ref1">Back</a></p></li></ol>
+<p><a name="plain"></a>A plain target.</p>`,
+		// A reference to the plain target from another chapter
+		`<p>As noted<sup id="ref2"><a href="ch2.xhtml#plain">*</a></sup>.</p>`,
+	)
+	defer os.Remove(epubPath)
+
+	note, err := ResolveNote(epubPath, 0, "fn1", testSanitizeOptions)
+	require.NoError(t, err)
+	assert.Equal(t, NoteKindFootnote, note.Kind)
+	assert.Equal(t, "A biblical name. See the endnote.", note.Text)
+	assert.Contains(t, note.HTML, `<aside epub:type="footnote" id="fn1">`)
+	assert.Contains(t, note.HTML, `href="/api/books/b1/content/1#en1"`, "links are rewritten like chapter content")
+	assert.Equal(t, []NoteLink{{Chapter: 0, ID: "ref1", Href: "/api/books/b1/content/0#ref1"}}, note.Backlinks)
+
+	note, err = ResolveNote(epubPath, 1, "en1", testSanitizeOptions)
+	require.NoError(t, err)
+	assert.Equal(t, NoteKindEndnote, note.Kind)
+	assert.Equal(t, []NoteLink{{Chapter: 0, Href: "/api/books/b1/content/0"}}, note.Backlinks, "a link with no ID leads to its chapter")
+
+	// An anchor widens to its paragraph
+	note, err = ResolveNote(epubPath, 1, "plain", testSanitizeOptions)
+	require.NoError(t, err)
+	assert.Empty(t, note.Kind)
+	assert.Equal(t, "A plain target.", note.Text)
+	assert.Equal(t, []NoteLink{{Chapter: 2, ID: "ref2", Href: "/api/books/b1/content/2#ref2"}}, note.Backlinks)
+
+	_, err = ResolveNote(epubPath, 0, "missing", testSanitizeOptions)
+	assert.ErrorIs(t, err, ErrLinkTargetNotFound)
+	_, err = ResolveNote(epubPath, 5, "fn1", testSanitizeOptions)
+	assert.ErrorIs(t, err, ErrLinkTargetNotFound)
+}
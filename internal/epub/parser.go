@@ -3,12 +3,16 @@ package epub
 import (
 	"archive/zip"
 	"encoding/xml"
+	"errors"
+	"html"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Content type constants
@@ -207,22 +211,21 @@ func ParseEPUB(filePath string) (*Metadata, error) {
 		}
 	}
 
-	// Extract cover
-	coverID := findCoverID(pkg)
-	if coverID != "" {
-		opfDir := path.Dir(opfPath)
-		for _, item := range pkg.Manifest.Items {
-			if item.ID == coverID {
-				coverPath := item.Href
-				if opfDir != "." {
-					coverPath = path.Join(opfDir, coverPath)
-				}
-				if coverFile, err := findFile(&r.Reader, coverPath); err == nil {
-					meta.CoverData, _ = io.ReadAll(coverFile)
-					meta.CoverExt = path.Ext(coverPath)
-				}
-				break
-			}
+	// Extract cover. Without a declared one, the first image the reader
+	// sees is the likeliest cover, then the first image listed at all.
+	opfDir := path.Dir(opfPath)
+	coverPath := manifestPath(pkg, opfDir, findCoverID(pkg))
+	if coverPath == "" {
+		coverPath = firstSpineImage(&r.Reader, pkg, opfDir)
+	}
+	if coverPath == "" {
+		coverPath = manifestPath(pkg, opfDir, firstImageID(pkg))
+	}
+	if coverPath != "" {
+		if coverFile, err := findFile(&r.Reader, coverPath); err == nil {
+			meta.CoverData, _ = io.ReadAll(coverFile)
+			meta.CoverExt = path.Ext(coverPath)
+			coverFile.Close()
 		}
 	}
 
@@ -339,17 +342,29 @@ func detectContentType(pkg *Package, meta *Metadata) string {
 
 // GetTableOfContents returns the book's table of contents
 func GetTableOfContents(filePath string) ([]Chapter, error) {
-	r, err := zip.OpenReader(filePath)
+	a, err := openArchive(filePath)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
+	defer a.release()
 
+	chapters, err := a.tableOfContents()
+	if err != nil {
+		return nil, err
+	}
+	// The cached slice is shared, so callers get their own copy
+	return append([]Chapter(nil), chapters...), nil
+}
+
+// readTableOfContents builds the chapter list from the spine of an EPUB's
+// first rootfile
+func readTableOfContents(r *zip.Reader) ([]Chapter, error) {
 	// Find container.xml
-	containerFile, err := findFile(&r.Reader, "META-INF/container.xml")
+	containerFile, err := findFile(r, "META-INF/container.xml")
 	if err != nil {
 		return nil, err
 	}
+	defer containerFile.Close()
 
 	container := &Container{}
 	if err := parseXML(containerFile, container); err != nil {
@@ -362,10 +377,11 @@ func GetTableOfContents(filePath string) ([]Chapter, error) {
 
 	// Parse OPF file
 	opfPath := container.RootFiles[0].FullPath
-	opfFile, err := findFile(&r.Reader, opfPath)
+	opfFile, err := findFile(r, opfPath)
 	if err != nil {
 		return nil, err
 	}
+	defer opfFile.Close()
 
 	pkg := &Package{}
 	if err := parseXML(opfFile, pkg); err != nil {
@@ -396,7 +412,8 @@ func GetTableOfContents(filePath string) ([]Chapter, error) {
 			Index: i,
 			ID:    item.IDRef,
 			Href:  fullPath,
-			Title: extractChapterTitle(&r.Reader, fullPath, i),
+			Title: extractChapterTitle(r, fullPath, i),
+			Size:  fileSize(r, fullPath),
 		})
 	}
 
@@ -409,11 +426,20 @@ type Chapter struct {
 	ID    string `json:"id"`
 	Href  string `json:"href"`
 	Title string `json:"title"`
+	// Bytes of the chapter's XHTML, so readers can tell ahead of time
+	// which chapters are worth fetching in pages
+	Size int64 `json:"size,omitempty"`
 }
 
 // GetChapterContent returns the HTML content of a specific chapter
 func GetChapterContent(filePath string, chapterIndex int) (string, error) {
-	chapters, err := GetTableOfContents(filePath)
+	a, err := openArchive(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer a.release()
+
+	chapters, err := a.tableOfContents()
 	if err != nil {
 		return "", err
 	}
@@ -422,34 +448,52 @@ func GetChapterContent(filePath string, chapterIndex int) (string, error) {
 		return "", nil
 	}
 
-	r, err := zip.OpenReader(filePath)
+	content, err := a.readFile(chapters[chapterIndex].Href)
 	if err != nil {
 		return "", err
 	}
-	defer r.Close()
 
-	chapter := chapters[chapterIndex]
-	file, err := findFile(&r.Reader, chapter.Href)
+	return string(content), nil
+}
+
+// charsPerPage is the amount of text counted as a page when estimating an
+// EPUB's page count, about a page of a printed paperback
+const charsPerPage = 1500
+
+// EstimatePageCount estimates how many printed pages an EPUB would fill from
+// the length of its chapters' text. Chapters that can't be read are skipped.
+func EstimatePageCount(filePath string) (int, error) {
+	a, err := openArchive(filePath)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
+	defer a.release()
 
-	content, err := io.ReadAll(file)
+	chapters, err := a.tableOfContents()
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	return string(content), nil
+	chars := 0
+	for _, ch := range chapters {
+		content, err := a.readFile(ch.Href)
+		if err != nil {
+			continue
+		}
+		chars += utf8.RuneCountInString(StripHTML(string(content)))
+	}
+	return (chars + charsPerPage - 1) / charsPerPage, nil
 }
 
 // GetResource extracts a resource file (image, CSS, etc.) from an EPUB
 // The resourcePath is relative to the EPUB's OEBPS or content directory
 func GetResource(filePath string, resourcePath string) ([]byte, string, error) {
-	r, err := zip.OpenReader(filePath)
+	a, err := openArchive(filePath)
 	if err != nil {
 		return nil, "", err
 	}
-	defer r.Close()
+	defer a.release()
+	r := a.zr
 
 	// Clean the resource path - remove leading slashes and normalize
 	resourcePath = strings.TrimPrefix(resourcePath, "/")
@@ -458,14 +502,14 @@ func GetResource(filePath string, resourcePath string) ([]byte, string, error) {
 	var file io.ReadCloser
 
 	// Strategy 1: Try the exact path
-	file, err = findFile(&r.Reader, resourcePath)
+	file, err = a.open(resourcePath)
 
 	// Strategy 2: Try common EPUB directory prefixes
 	if err != nil {
 		prefixes := []string{"OEBPS/", "OPS/", "EPUB/", "Content/", "content/"}
 		for _, prefix := range prefixes {
 			testPath := prefix + resourcePath
-			file, err = findFile(&r.Reader, testPath)
+			file, err = a.open(testPath)
 			if err == nil {
 				break
 			}
@@ -519,6 +563,94 @@ func GetResource(filePath string, resourcePath string) ([]byte, string, error) {
 	return content, contentType, nil
 }
 
+// Resource is a non-chapter file from an EPUB's manifest (image, CSS, font, etc.)
+type Resource struct {
+	Path      string `json:"path"` // Path inside the EPUB archive
+	MediaType string `json:"media_type"`
+}
+
+// WalkResources calls fn for every manifest item that isn't a spine chapter
+// or the NCX, with a reader for its contents. Items missing from the archive
+// are skipped.
+func WalkResources(filePath string, fn func(res Resource, r io.Reader) error) error {
+	a, err := openArchive(filePath)
+	if err != nil {
+		return err
+	}
+	defer a.release()
+
+	opfPath, pkg, err := a.readPackage()
+	if err != nil || pkg == nil {
+		return err
+	}
+
+	spine := make(map[string]bool, len(pkg.Spine.Items))
+	for _, item := range pkg.Spine.Items {
+		spine[item.IDRef] = true
+	}
+
+	opfDir := path.Dir(opfPath)
+	for _, item := range pkg.Manifest.Items {
+		if spine[item.ID] || item.MediaType == "application/x-dtbncx+xml" {
+			continue
+		}
+
+		fullPath := manifestFile(opfDir, item.Href)
+		file, err := a.open(fullPath)
+		if err != nil {
+			continue
+		}
+		mediaType := item.MediaType
+		if mediaType == "" {
+			mediaType = getMimeType(fullPath)
+		}
+		err = fn(Resource{Path: fullPath, MediaType: mediaType}, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPackage returns the path and parsed contents of the book's OPF, or a
+// nil package if the container names none
+func (a *archive) readPackage() (string, *Package, error) {
+	rc, err := a.open("META-INF/container.xml")
+	if err != nil {
+		return "", nil, err
+	}
+	container := &Container{}
+	err = parseXML(rc, container)
+	rc.Close()
+	if err != nil || len(container.RootFiles) == 0 {
+		return "", nil, err
+	}
+
+	opfPath := container.RootFiles[0].FullPath
+	rc, err = a.open(opfPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rc.Close()
+	pkg := &Package{}
+	if err := parseXML(rc, pkg); err != nil {
+		return "", nil, err
+	}
+	return opfPath, pkg, nil
+}
+
+// manifestFile returns the archive path of a manifest item's href
+func manifestFile(opfDir, href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	if opfDir == "." {
+		return href
+	}
+	return path.Join(opfDir, href)
+}
+
 // getMimeType returns the MIME type based on file extension
 func getMimeType(filePath string) string {
 	ext := strings.ToLower(path.Ext(filePath))
@@ -563,6 +695,17 @@ func findFile(r *zip.Reader, name string) (io.ReadCloser, error) {
 	return nil, os.ErrNotExist
 }
 
+// fileSize returns the uncompressed size of the entry named name, or 0 if
+// there's none
+func fileSize(r *zip.Reader, name string) int64 {
+	for _, f := range r.File {
+		if f.Name == name || strings.EqualFold(f.Name, name) {
+			return int64(f.UncompressedSize64)
+		}
+	}
+	return 0
+}
+
 func parseXML(r io.Reader, v interface{}) error {
 	decoder := xml.NewDecoder(r)
 	return decoder.Decode(v)
@@ -591,14 +734,83 @@ func findCoverID(pkg *Package) string {
 		}
 	}
 
-	// Fallback: find the first image in the manifest
-	// This helps when no explicit cover is defined
+	return ""
+}
+
+// firstImageID returns the ID of the first image in the manifest, or ""
+func firstImageID(pkg *Package) string {
 	for _, item := range pkg.Manifest.Items {
 		if strings.HasPrefix(item.MediaType, "image/") {
 			return item.ID
 		}
 	}
+	return ""
+}
+
+// manifestPath returns the archive path of the manifest item with the given
+// ID, or "" if there is none
+func manifestPath(pkg *Package, opfDir, id string) string {
+	if id == "" {
+		return ""
+	}
+	for _, item := range pkg.Manifest.Items {
+		if item.ID == id {
+			if opfDir == "." {
+				return item.Href
+			}
+			return path.Join(opfDir, item.Href)
+		}
+	}
+	return ""
+}
 
+// coverSpineDocuments is how many documents at the start of the spine are
+// searched for a cover image; an image further in is an illustration
+const coverSpineDocuments = 3
+
+// spineImageRe matches the source of an <img> or an SVG <image>, as cover
+// pages wrap the picture in either
+var spineImageRe = regexp.MustCompile(`(?i)<(?:img|image)\b[^>]*?\s(?:src|xlink:href|href)\s*=\s*["']([^"']+)["']`)
+
+// firstSpineImage returns the archive path of the first image shown in the
+// opening documents of the spine, or "" if they show none
+func firstSpineImage(r *zip.Reader, pkg *Package, opfDir string) string {
+	for i, item := range pkg.Spine.Items {
+		if i == coverSpineDocuments {
+			break
+		}
+		docPath := manifestPath(pkg, opfDir, item.IDRef)
+		if docPath == "" {
+			continue
+		}
+		file, err := findFile(r, docPath)
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, m := range spineImageRe.FindAllStringSubmatch(string(content), -1) {
+			src := m[1]
+			if strings.Contains(src, ":") {
+				continue // Remote or data: URLs aren't in the archive
+			}
+			if unescaped, err := url.PathUnescape(src); err == nil {
+				src = unescaped
+			}
+			imagePath := path.Join(path.Dir(docPath), strings.SplitN(src, "#", 2)[0])
+			if !strings.HasPrefix(getMimeType(imagePath), "image/") {
+				continue
+			}
+			if f, err := findFile(r, imagePath); err == nil {
+				f.Close()
+				return imagePath
+			}
+		}
+	}
 	return ""
 }
 
@@ -690,6 +902,108 @@ func GetChapterText(filePath string, chapterIndex int) (string, error) {
 	return StripHTML(html), nil
 }
 
+// TextChunk is part of a chapter's text, with whitespace collapsed and
+// offsets counted as for CFIs and TextLocation, for delivering very large
+// chapters a piece at a time
+type TextChunk struct {
+	Offset int    // Characters of the chapter's text before the chunk
+	End    int    // Offset of the character after the chunk
+	Total  int    // Characters in the chapter's text
+	Text   string // The characters from Offset to End
+	// Offsets in the chunk where a paragraph or other block starts. No
+	// space separates blocks in the text unless the markup had one.
+	Breaks []int
+}
+
+// GetChapterTextChunk returns up to limit characters of a chapter's text
+// from offset. A chunk ending before the chapter does is cut short to end
+// at the start of a block, or failing that between words, unless that
+// would lose more than half of it.
+func GetChapterTextChunk(filePath string, chapter, offset, limit int) (*TextChunk, error) {
+	_, ct, err := readChapter(filePath, chapter)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(ct.text)
+	start := max(0, min(offset, total))
+	end := min(start+max(limit, 0), total)
+	if end < total {
+		end = ct.splitPoint(start, end)
+	}
+
+	breaks := []int{}
+	for _, b := range ct.blocks {
+		if b > start && b < end {
+			breaks = append(breaks, b)
+		}
+	}
+	return &TextChunk{Offset: start, End: end, Total: total, Text: string(ct.text[start:end]), Breaks: breaks}, nil
+}
+
+// ErrTextNotFound is returned by LocateText when no chapter contains the
+// text
+var ErrTextNotFound = errors.New("text not found in book")
+
+// TextLocation is where a passage of text is in an EPUB
+type TextLocation struct {
+	Chapter  int     // Index into the table of contents
+	Offset   int     // Characters of the chapter's text before the passage
+	Progress float64 // Offset as a fraction of the chapter's text, from 0 to 1
+}
+
+// LocateText finds a passage, such as a highlight's selected text, in an
+// EPUB's chapters. Whitespace is collapsed before comparing, since readers
+// select text as it's laid out. Chapter near is searched first and then
+// those around it, nearest first, so a passage that appears more than once
+// resolves to the copy closest to where it was.
+func LocateText(filePath, text string, near int) (*TextLocation, error) {
+	needle := strings.Join(strings.Fields(text), " ")
+	if needle == "" {
+		return nil, ErrTextNotFound
+	}
+
+	a, err := openArchive(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer a.release()
+
+	chapters, err := a.tableOfContents()
+	if err != nil {
+		return nil, err
+	}
+
+	near = max(0, min(near, len(chapters)-1))
+	for d := 0; d < len(chapters); d++ {
+		candidates := []int{near + d}
+		if d > 0 {
+			candidates = append(candidates, near-d)
+		}
+		for _, i := range candidates {
+			if i < 0 || i >= len(chapters) {
+				continue
+			}
+			content, err := a.readFile(chapters[i].Href)
+			if err != nil {
+				continue
+			}
+			chapterText := strings.Join(strings.Fields(html.UnescapeString(StripHTML(string(content)))), " ")
+			idx := strings.Index(chapterText, needle)
+			if idx < 0 {
+				continue
+			}
+			offset := utf8.RuneCountInString(chapterText[:idx])
+			return &TextLocation{
+				Chapter:  i,
+				Offset:   offset,
+				Progress: float64(offset) / float64(utf8.RuneCountInString(chapterText)),
+			}, nil
+		}
+	}
+	return nil, ErrTextNotFound
+}
+
 // StripHTML removes HTML tags and returns plain text
 func StripHTML(html string) string {
 	// Remove script and style elements entirely
@@ -725,3 +1039,24 @@ func StripHTML(html string) string {
 
 	return strings.TrimSpace(html)
 }
+
+// InjectStyle adds a <style> element to a chapter's HTML. It goes at the end
+// of <head> so it overrides the publisher's stylesheets, falling back to the
+// start of <body> (or the document) for chapters without a head.
+func InjectStyle(html, css string) string {
+	if css == "" {
+		return html
+	}
+	// Keep the CSS from closing the style element early
+	closeRe := regexp.MustCompile(`(?i)</style`)
+	css = closeRe.ReplaceAllString(css, `<\/style`)
+	style := `<style type="text/css" id="webby-theme">` + "\n" + css + "\n</style>"
+
+	if loc := regexp.MustCompile(`(?i)</head\s*>`).FindStringIndex(html); loc != nil {
+		return html[:loc[0]] + style + "\n" + html[loc[0]:]
+	}
+	if loc := regexp.MustCompile(`(?i)<body[^>]*>`).FindStringIndex(html); loc != nil {
+		return html[:loc[1]] + "\n" + style + html[loc[1]:]
+	}
+	return style + "\n" + html
+}
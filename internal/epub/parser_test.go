@@ -2,7 +2,9 @@ package epub
 
 import (
 	"archive/zip"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -201,6 +203,19 @@ func TestGetChapterText(t *testing.T) {
 	assert.NotContains(t, text, "<p>")
 }
 
+func TestEstimatePageCount(t *testing.T) {
+	epubPath := createTestEPUB(t)
+	defer os.Remove(epubPath)
+
+	// A short chapter still makes a page
+	pages, err := EstimatePageCount(epubPath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pages)
+
+	_, err = EstimatePageCount("/nonexistent.epub")
+	assert.Error(t, err)
+}
+
 // createTestEPUBWithMetadata creates an EPUB with extended metadata fields
 func createTestEPUBWithMetadata(t *testing.T) string {
 	tmpFile, err := os.CreateTemp("", "test-metadata-*.epub")
@@ -343,3 +358,182 @@ func TestNormalizeISBN(t *testing.T) {
 		})
 	}
 }
+
+func TestInjectStyle(t *testing.T) {
+	css := "body { color: red; }"
+
+	t.Run("end of head", func(t *testing.T) {
+		html := `<html><head><link rel="stylesheet" href="book.css"/></head><body><p>Hi</p></body></html>`
+		result := InjectStyle(html, css)
+		assert.Contains(t, result, `href="book.css"/><style type="text/css" id="webby-theme">`)
+		assert.Contains(t, result, "</style>\n</head>")
+	})
+
+	t.Run("no head", func(t *testing.T) {
+		result := InjectStyle(`<BODY class="x"><p>Hi</p></BODY>`, css)
+		assert.True(t, strings.HasPrefix(result, `<BODY class="x">`+"\n<style"))
+	})
+
+	t.Run("fragment", func(t *testing.T) {
+		result := InjectStyle(`<p>Hi</p>`, css)
+		assert.True(t, strings.HasPrefix(result, "<style"))
+		assert.True(t, strings.HasSuffix(result, "<p>Hi</p>"))
+	})
+
+	t.Run("cannot close style early", func(t *testing.T) {
+		result := InjectStyle(`<p>Hi</p>`, `p{}</STYLE><script>alert(1)</script>`)
+		assert.Equal(t, 1, strings.Count(strings.ToLower(result), "</style"))
+	})
+
+	t.Run("empty css", func(t *testing.T) {
+		assert.Equal(t, "<p>Hi</p>", InjectStyle("<p>Hi</p>", ""))
+	})
+}
+
+func TestParseEPUBCoverFromSpine(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test-cover-*.epub")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	w := zip.NewWriter(tmpFile)
+	for _, f := range []struct{ name, content string }{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>No Declared Cover</dc:title>
+  </metadata>
+  <manifest>
+    <item id="logo" href="images/logo.png" media-type="image/png"/>
+    <item id="front" href="images/front%20page.jpg" media-type="image/jpeg"/>
+    <item id="titlepage" href="text/title.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="titlepage"/>
+  </spine>
+</package>`},
+		{"OEBPS/text/title.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:xlink="http://www.w3.org/1999/xlink">
+<body><svg><image width="600" height="800" xlink:href="../images/front%20page.jpg"/></svg></body>
+</html>`},
+		{"OEBPS/images/logo.png", "logo"},
+		{"OEBPS/images/front page.jpg", "front"},
+	} {
+		fw, err := w.Create(f.name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(f.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, tmpFile.Close())
+
+	meta, err := ParseEPUB(tmpFile.Name())
+	require.NoError(t, err)
+	assert.Equal(t, "front", string(meta.CoverData), "the image on the first page wins over the first one listed")
+	assert.Equal(t, ".jpg", meta.CoverExt)
+}
+
+// createTestEPUBWithChapters writes an EPUB with a chapter for each body
+func createTestEPUBWithChapters(t *testing.T, bodies ...string) string {
+	t.Helper()
+	tmpFile, err := os.CreateTemp("", "test-chapters-*.epub")
+	require.NoError(t, err)
+	defer tmpFile.Close()
+
+	var manifest, spine strings.Builder
+	w := zip.NewWriter(tmpFile)
+	for i, body := range bodies {
+		id := fmt.Sprintf("ch%d", i+1)
+		fmt.Fprintf(&manifest, `<item id="%s" href="%s.xhtml" media-type="application/xhtml+xml"/>`, id, id)
+		fmt.Fprintf(&spine, `<itemref idref="%s"/>`, id)
+		f, err := w.Create("OEBPS/" + id + ".xhtml")
+		require.NoError(t, err)
+		f.Write([]byte(`<html xmlns="http://www.w3.org/1999/xhtml"><body>` + body + `</body></html>`))
+	}
+	for name, content := range map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Chapters</dc:title></metadata>
+  <manifest>` + manifest.String() + `</manifest>
+  <spine>` + spine.String() + `</spine>
+</package>`,
+	} {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, w.Close())
+	return tmpFile.Name()
+}
+
+func TestLocateText(t *testing.T) {
+	epubPath := createTestEPUBWithChapters(t,
+		"<p>Foreword.</p>",
+		"<p>It was a dark and stormy night.</p>",
+		"<p>The rain fell &amp; the wind\n  howled.</p><p>It was a dark and stormy night.</p>",
+	)
+	defer os.Remove(epubPath)
+
+	loc, err := LocateText(epubPath, "the wind howled", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loc.Chapter)
+	assert.Equal(t, len("The rain fell & "), loc.Offset, "entities and line breaks are read as the reader shows them")
+	assert.Greater(t, loc.Progress, 0.0)
+	assert.Less(t, loc.Progress, 1.0)
+
+	// The copy nearest the recorded chapter wins
+	loc, err = LocateText(epubPath, "a dark and stormy night", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loc.Chapter)
+	loc, err = LocateText(epubPath, "a dark and stormy night", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, loc.Chapter)
+	assert.Equal(t, len("It was "), loc.Offset)
+
+	_, err = LocateText(epubPath, "not in the book", 1)
+	assert.ErrorIs(t, err, ErrTextNotFound)
+}
+
+func TestGetChapterTextChunk(t *testing.T) {
+	epubPath := createTestEPUBWithChapters(t,
+		"<h1>Title</h1>\n<p>One two three.</p>\n<p>Four five six.</p>",
+	)
+	defer os.Remove(epubPath)
+
+	chunk, err := GetChapterTextChunk(epubPath, 0, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, &TextChunk{Offset: 0, End: 35, Total: 35, Text: "Title One two three. Four five six.", Breaks: []int{6, 21}}, chunk)
+
+	// A chunk ends at the last block in its second half
+	chunk, err = GetChapterTextChunk(epubPath, 0, 0, 25)
+	require.NoError(t, err)
+	assert.Equal(t, "Title One two three. ", chunk.Text)
+	assert.Equal(t, 21, chunk.End)
+	assert.Equal(t, []int{6}, chunk.Breaks)
+
+	// or else between words
+	chunk, err = GetChapterTextChunk(epubPath, 0, 21, 10)
+	require.NoError(t, err)
+	assert.Equal(t, "Four five ", chunk.Text)
+	assert.Empty(t, chunk.Breaks)
+
+	chunk, err = GetChapterTextChunk(epubPath, 0, 100, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 35, chunk.Offset)
+	assert.Empty(t, chunk.Text)
+
+	_, err = GetChapterTextChunk(epubPath, 5, 0, 10)
+	assert.ErrorIs(t, err, ErrChapterNotFound)
+
+	chapters, err := GetTableOfContents(epubPath)
+	require.NoError(t, err)
+	assert.Greater(t, chapters[0].Size, int64(0), "chapter sizes are hints for splitting")
+}
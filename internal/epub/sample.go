@@ -0,0 +1,184 @@
+package epub
+
+import (
+	"archive/zip"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// sampleEnd replaces the chapters past the end of a sample, so the package
+// and navigation still point at files that exist
+const sampleEnd = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>End of sample</title></head>
+<body><p>This is the end of the sample.</p></body></html>`
+
+// WriteSample writes an EPUB of the first percent of a book's text to w.
+// The chapter the sample ends in is cut between elements, and the chapters
+// after it are replaced by a notice. Images only the rest of the book uses
+// are left out, except the cover.
+func WriteSample(filePath string, w io.Writer, percent int) error {
+	a, err := openArchive(filePath)
+	if err != nil {
+		return err
+	}
+	defer a.release()
+
+	chapters, err := a.tableOfContents()
+	if err != nil {
+		return err
+	}
+	replaced, err := sampleChapters(a, chapters, percent)
+	if err != nil {
+		return err
+	}
+
+	opfPath, pkg, err := a.readPackage()
+	if err != nil {
+		return err
+	}
+	dropped := map[string]bool{} // Lowercased paths of images left out
+	var droppedIDs []string
+	if pkg != nil {
+		used := sampleText(a, pkg, path.Dir(opfPath), replaced)
+		coverID := findCoverID(pkg)
+		for _, item := range pkg.Manifest.Items {
+			if !strings.HasPrefix(item.MediaType, "image/") || item.ID == coverID {
+				continue
+			}
+			file := manifestFile(path.Dir(opfPath), item.Href)
+			name := path.Base(file)
+			if escaped := (&url.URL{Path: name}).EscapedPath(); !strings.Contains(used, name) && !strings.Contains(used, escaped) {
+				dropped[strings.ToLower(file)] = true
+				droppedIDs = append(droppedIDs, item.ID)
+			}
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range a.zr.File {
+		name := strings.ToLower(f.Name)
+		var content string
+		switch {
+		case dropped[name]:
+			continue
+		case f.Name == "mimetype":
+			// Readers expect it first and uncompressed, as it was
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		case strings.EqualFold(f.Name, opfPath) && len(droppedIDs) > 0:
+			data, err := a.readFile(f.Name)
+			if err != nil {
+				return err
+			}
+			content = removeManifestItems(string(data), droppedIDs)
+		default:
+			var ok bool
+			if content, ok = replaced[name]; !ok {
+				if err := zw.Copy(f); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		fw, err := zw.Create(f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// sampleChapters returns the content of the chapters a sample of percent of
+// the book's text changes, by lowercased path: the one it ends in, cut
+// short, and the notice for those after it
+func sampleChapters(a *archive, chapters []Chapter, percent int) (map[string]string, error) {
+	contents := make([]string, len(chapters))
+	lengths := make([]int, len(chapters))
+	total := 0
+	for i, ch := range chapters {
+		data, err := a.readFile(ch.Href)
+		if err != nil {
+			continue
+		}
+		ct, err := readChapterText(string(data))
+		if err != nil {
+			return nil, err
+		}
+		contents[i], lengths[i] = string(data), len(ct.text)
+		total += lengths[i]
+	}
+	if total == 0 {
+		// A book of images, such as a fixed-layout comic, is sampled by
+		// chapter
+		for i := range lengths {
+			lengths[i] = 1
+		}
+		total = len(chapters)
+	}
+
+	replaced := map[string]string{}
+	budget := (total*percent + 99) / 100
+	used := 0
+	for i, ch := range chapters {
+		switch {
+		case used >= budget && contents[i] != "":
+			replaced[strings.ToLower(ch.Href)] = sampleEnd
+		case used+lengths[i] > budget:
+			// Keep the part of the chapter's markup in proportion to the
+			// text the sample has left
+			keep := float64(budget-used) / float64(lengths[i])
+			pages, err := SplitChapter(contents[i], max(1, int(keep*float64(len(contents[i])))))
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasPrefix(contents[i], "<?xml") {
+				pages[0] = `<?xml version="1.0" encoding="utf-8"?>` + "\n" + pages[0]
+			}
+			replaced[strings.ToLower(ch.Href)] = pages[0]
+		}
+		used += lengths[i]
+	}
+	return replaced, nil
+}
+
+// sampleText returns the markup a sample keeps that may refer to images: its
+// chapters and the book's stylesheets
+func sampleText(a *archive, pkg *Package, opfDir string, replaced map[string]string) string {
+	var b strings.Builder
+	for _, item := range pkg.Manifest.Items {
+		if item.MediaType != "application/xhtml+xml" && item.MediaType != "text/css" {
+			continue
+		}
+		name := manifestFile(opfDir, item.Href)
+		if content, ok := replaced[strings.ToLower(name)]; ok {
+			b.WriteString(content)
+			continue
+		}
+		data, err := a.readFile(name)
+		if err != nil {
+			continue
+		}
+		b.Write(data)
+	}
+	return b.String()
+}
+
+// removeManifestItems removes the manifest items with the given IDs from an
+// OPF
+func removeManifestItems(opf string, ids []string) string {
+	for _, id := range ids {
+		re := regexp.MustCompile(`<item\b[^>]*\bid=["']` + regexp.QuoteMeta(id) + `["'][^>]*/>\s*`)
+		opf = re.ReplaceAllString(opf, "")
+	}
+	return opf
+}
@@ -0,0 +1,108 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readSample writes a sample of an EPUB and returns its files by name
+func readSample(t *testing.T, epubPath string, percent int) map[string]string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, WriteSample(epubPath, &buf, percent))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestWriteSample(t *testing.T) {
+	paragraph := "<p>" + strings.Repeat("word ", 20) + "</p>"
+	epubPath := createTestEPUBWithChapters(t,
+		strings.Repeat(paragraph, 4),
+		strings.Repeat(paragraph, 4),
+		strings.Repeat(paragraph, 4),
+		strings.Repeat(paragraph, 4),
+	)
+	defer os.Remove(epubPath)
+
+	// Half the text is the first two chapters
+	files := readSample(t, epubPath, 50)
+	original := readSample(t, epubPath, 100)
+	assert.Equal(t, original["OEBPS/ch1.xhtml"], files["OEBPS/ch1.xhtml"])
+	assert.Equal(t, original["OEBPS/ch2.xhtml"], files["OEBPS/ch2.xhtml"])
+	assert.Equal(t, sampleEnd, files["OEBPS/ch3.xhtml"])
+	assert.Equal(t, sampleEnd, files["OEBPS/ch4.xhtml"])
+	assert.Equal(t, original["OEBPS/content.opf"], files["OEBPS/content.opf"])
+
+	// A sample ending partway through a chapter cuts it between paragraphs
+	files = readSample(t, epubPath, 30)
+	assert.Equal(t, original["OEBPS/ch1.xhtml"], files["OEBPS/ch1.xhtml"])
+	ch2 := files["OEBPS/ch2.xhtml"]
+	assert.NotEqual(t, original["OEBPS/ch2.xhtml"], ch2)
+	assert.Contains(t, ch2, "</p>")
+	assert.Less(t, strings.Count(ch2, "<p>"), 4)
+	assert.Equal(t, sampleEnd, files["OEBPS/ch3.xhtml"])
+}
+
+func TestWriteSampleImages(t *testing.T) {
+	tmp, err := os.CreateTemp("", "test-sample-*.epub")
+	require.NoError(t, err)
+	defer os.Remove(tmp.Name())
+
+	zw := zip.NewWriter(tmp)
+	for _, file := range []struct{ name, content string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Pictures</dc:title><meta name="cover" content="cover"/></metadata>
+  <manifest>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="ch2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="cover" href="images/cover.jpg" media-type="image/jpeg"/>
+    <item id="map" href="images/map.png" media-type="image/png"/>
+    <item id="plate" href="images/plate.png" media-type="image/png"/>
+  </manifest>
+  <spine><itemref idref="ch1"/><itemref idref="ch2"/></spine>
+</package>`},
+		{"OEBPS/ch1.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Map one.</p><img src="images/map.png"/></body></html>`},
+		{"OEBPS/ch2.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Plate 2.</p><img src="images/plate.png"/></body></html>`},
+		{"OEBPS/images/cover.jpg", "cover"},
+		{"OEBPS/images/map.png", "map"},
+		{"OEBPS/images/plate.png", "plate"},
+	} {
+		f, err := zw.Create(file.name)
+		require.NoError(t, err)
+		f.Write([]byte(file.content))
+	}
+	require.NoError(t, zw.Close())
+	tmp.Close()
+
+	files := readSample(t, tmp.Name(), 50)
+	assert.Contains(t, files, "OEBPS/images/cover.jpg", "the cover is kept")
+	assert.Contains(t, files, "OEBPS/images/map.png")
+	assert.NotContains(t, files, "OEBPS/images/plate.png", "only the rest of the book uses it")
+	assert.Contains(t, files["OEBPS/content.opf"], `id="map"`)
+	assert.NotContains(t, files["OEBPS/content.opf"], `id="plate"`)
+	assert.Equal(t, sampleEnd, files["OEBPS/ch2.xhtml"])
+}
@@ -0,0 +1,418 @@
+package epub
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SanitizeOptions controls how chapter HTML is rewritten for the reader
+type SanitizeOptions struct {
+	// ResourceURL prefixes rewritten image/CSS/media links,
+	// e.g. "/api/books/<id>/resource/"
+	ResourceURL string
+
+	// ChapterURL prefixes links to other chapters, followed by the chapter
+	// index, e.g. "/api/books/<id>/content/"
+	ChapterURL string
+}
+
+// removedElements are dropped from chapters along with their content. <base>
+// would break link resolution and the rest can run code or embed other pages.
+var removedElements = map[string]bool{
+	"script": true, "noscript": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "base": true,
+}
+
+// voidElements never have content, so "<br/>" is the only form they take
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+var (
+	selfClosingRe = regexp.MustCompile(`<([a-zA-Z][\w:-]*)(\s[^<>]*?)?/>`)
+	cssURLRe      = regexp.MustCompile(`(?i)url\(\s*(['"]?)([^'")]+)(['"]?)\s*\)`)
+	cssImportRe   = regexp.MustCompile(`(?i)@import\s+(['"])([^'"]+)(['"])`)
+)
+
+// GetSanitizedChapterContent returns a chapter's HTML with scripts removed
+// and internal links rewritten to API URLs (see SanitizeChapter)
+func GetSanitizedChapterContent(filePath string, chapterIndex int, opts SanitizeOptions) (string, error) {
+	chapters, err := GetTableOfContents(filePath)
+	if err != nil {
+		return "", err
+	}
+	if chapterIndex < 0 || chapterIndex >= len(chapters) {
+		return "", nil
+	}
+
+	content, err := GetChapterContent(filePath, chapterIndex)
+	if err != nil || content == "" {
+		return content, err
+	}
+	return SanitizeChapter(content, chapters[chapterIndex].Href, chapters, opts)
+}
+
+// SanitizeChapter makes chapter HTML safe to show in the reader. Scripts,
+// embeds, and event handler attributes are removed, image/CSS/media references
+// are resolved against the chapter's path and pointed at opts.ResourceURL,
+// links to other chapters are pointed at opts.ChapterURL (with a data-chapter
+// attribute holding the index), and external links open in a new tab.
+func SanitizeChapter(content, chapterHref string, chapters []Chapter, opts SanitizeOptions) (string, error) {
+	doc, err := parseChapter(content)
+	if err != nil {
+		return "", err
+	}
+
+	s := newSanitizer(chapterHref, chapters, opts)
+	s.walk(doc)
+
+	return renderNode(doc)
+}
+
+// newSanitizer returns a sanitizer for the chapter at chapterHref
+func newSanitizer(chapterHref string, chapters []Chapter, opts SanitizeOptions) *sanitizer {
+	s := &sanitizer{
+		opts:        opts,
+		chapterHref: chapterHref,
+		chapterDir:  path.Dir(chapterHref),
+		chapters:    make(map[string]int, len(chapters)),
+	}
+	for i, ch := range chapters {
+		s.chapters[ch.Href] = i
+	}
+	return s
+}
+
+// parseChapter parses XHTML with the HTML5 parser. Self-closing non-void
+// tags are expanded first: the HTML5 parser ignores the slash, so an empty
+// <title/> would otherwise swallow the rest of the document.
+func parseChapter(content string) (*html.Node, error) {
+	content = selfClosingRe.ReplaceAllStringFunc(content, func(tag string) string {
+		m := selfClosingRe.FindStringSubmatch(tag)
+		if voidElements[strings.ToLower(m[1])] {
+			return tag
+		}
+		return "<" + m[1] + m[2] + "></" + m[1] + ">"
+	})
+	return html.Parse(strings.NewReader(content))
+}
+
+func renderNode(n *html.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+type sanitizer struct {
+	opts        SanitizeOptions
+	chapterHref string
+	chapterDir  string
+	chapters    map[string]int
+}
+
+func (s *sanitizer) walk(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && (removedElements[c.Data] || isMetaRefresh(c)) {
+			n.RemoveChild(c)
+		} else {
+			if c.Type == html.ElementNode {
+				s.rewriteElement(c)
+			}
+			s.walk(c)
+		}
+		c = next
+	}
+}
+
+// rewriteElement strips unsafe attributes and rewrites references
+func (s *sanitizer) rewriteElement(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") || isScriptURL(a.Val) {
+			continue
+		}
+
+		switch {
+		case key == "style":
+			a.Val = s.rewriteCSS(a.Val)
+		case key == "src" || key == "poster" || (key == "href" && (n.Data == "image" || n.Data == "link")):
+			a.Val = s.resourceURL(a.Val)
+		case key == "href" && a.Namespace == "xlink":
+			a.Val = s.resourceURL(a.Val)
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+
+	switch n.Data {
+	case "a":
+		s.rewriteLink(n)
+	case "style":
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				c.Data = s.rewriteCSS(c.Data)
+			}
+		}
+	}
+}
+
+// rewriteLink points internal links at the chapter or resource endpoints
+// and opens external links outside the reader
+func (s *sanitizer) rewriteLink(n *html.Node) {
+	for i, a := range n.Attr {
+		if a.Key != "href" || a.Namespace != "" {
+			continue
+		}
+
+		u, err := url.Parse(strings.TrimSpace(a.Val))
+		if err != nil {
+			return
+		}
+		if u.Scheme != "" || u.Host != "" {
+			setAttr(n, "target", "_blank")
+			setAttr(n, "rel", "noopener noreferrer")
+			return
+		}
+		if u.Path == "" {
+			return // Fragment within this chapter
+		}
+
+		target := s.resolve(u.Path)
+		fragment := ""
+		if u.Fragment != "" {
+			fragment = "#" + u.EscapedFragment()
+		}
+
+		if target == s.chapterHref {
+			n.Attr[i].Val = fragment
+			if fragment == "" {
+				n.Attr[i].Val = "#"
+			}
+			return
+		}
+		if index, ok := s.chapters[target]; ok {
+			n.Attr[i].Val = s.opts.ChapterURL + strconv.Itoa(index) + fragment
+			setAttr(n, "data-chapter", strconv.Itoa(index))
+			return
+		}
+		n.Attr[i].Val = s.opts.ResourceURL + EscapePath(target) + fragment
+		return
+	}
+}
+
+// rewriteCSS rewrites url() and @import references in a stylesheet or style attribute
+func (s *sanitizer) rewriteCSS(css string) string {
+	css = cssURLRe.ReplaceAllStringFunc(css, func(m string) string {
+		parts := cssURLRe.FindStringSubmatch(m)
+		return "url(" + parts[1] + s.resourceURL(parts[2]) + parts[3] + ")"
+	})
+	return cssImportRe.ReplaceAllStringFunc(css, func(m string) string {
+		parts := cssImportRe.FindStringSubmatch(m)
+		return "@import " + parts[1] + s.resourceURL(parts[2]) + parts[3]
+	})
+}
+
+// resourceURL rewrites a reference relative to the chapter to the resource
+// endpoint. External, data:, and fragment-only references are left alone.
+func (s *sanitizer) resourceURL(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(strings.ToLower(ref), "data:") {
+		return ref
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return ref
+	}
+	if s.opts.ResourceURL != "" && strings.HasPrefix(ref, s.opts.ResourceURL) {
+		return ref
+	}
+
+	result := s.opts.ResourceURL + EscapePath(s.resolve(u.Path))
+	if u.Fragment != "" {
+		result += "#" + u.EscapedFragment()
+	}
+	return result
+}
+
+// resolve turns a reference into a path inside the EPUB archive
+func (s *sanitizer) resolve(ref string) string {
+	var p string
+	if strings.HasPrefix(ref, "/") {
+		p = path.Clean(ref)
+	} else {
+		p = path.Join(s.chapterDir, ref)
+	}
+	// Never climb above the archive root
+	for strings.HasPrefix(p, "../") {
+		p = strings.TrimPrefix(p, "../")
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// EscapePath percent-encodes an archive path for use in a URL
+func EscapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// isScriptURL reports whether an attribute value is a javascript: or
+// vbscript: URL, ignoring the whitespace and case tricks browsers accept
+func isScriptURL(val string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(val))
+	return strings.HasPrefix(cleaned, "javascript:") || strings.HasPrefix(cleaned, "vbscript:")
+}
+
+// isMetaRefresh reports whether n is a <meta http-equiv="refresh">, which
+// could navigate the reader away
+func isMetaRefresh(n *html.Node) bool {
+	if n.Data != "meta" {
+		return false
+	}
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, "http-equiv") && strings.EqualFold(strings.TrimSpace(a.Val), "refresh") {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttr sets an attribute, replacing any existing value
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key && a.Namespace == "" {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// SplitChapter splits chapter HTML into pages of roughly maxBytes of body
+// content each. Every page keeps the chapter's <head> so styles still apply.
+// Breaks fall between elements; a container larger than maxBytes is split
+// across copies of itself, and an element that can't be split gets a page
+// of its own even if it's too big.
+func SplitChapter(content string, maxBytes int) ([]string, error) {
+	doc, err := parseChapter(content)
+	if err != nil {
+		return nil, err
+	}
+
+	body := findElement(doc, "body")
+	if body == nil {
+		return []string{content}, nil
+	}
+
+	var nodes []*html.Node
+	for c := body.FirstChild; c != nil; {
+		next := c.NextSibling
+		body.RemoveChild(c)
+		nodes = append(nodes, c)
+		c = next
+	}
+
+	chunks := chunkNodes(nodes, maxBytes)
+	if len(chunks) == 0 {
+		chunks = [][]*html.Node{nil}
+	}
+
+	pages := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		for _, n := range chunk {
+			body.AppendChild(n)
+		}
+		page, err := renderNode(doc)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+		for _, n := range chunk {
+			body.RemoveChild(n)
+		}
+	}
+	return pages, nil
+}
+
+// chunkNodes groups sibling nodes (detached from their parent) into chunks
+// of roughly maxBytes rendered HTML each
+func chunkNodes(nodes []*html.Node, maxBytes int) [][]*html.Node {
+	var chunks [][]*html.Node
+	var current []*html.Node
+	size := 0
+
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, current)
+			current, size = nil, 0
+		}
+	}
+
+	for _, n := range nodes {
+		nodeSize := renderedSize(n)
+
+		// Split oversized containers, e.g. a <div> wrapping the whole chapter
+		if nodeSize > maxBytes && n.Type == html.ElementNode && n.FirstChild != nil && n.FirstChild != n.LastChild {
+			flush()
+
+			var children []*html.Node
+			for c := n.FirstChild; c != nil; {
+				next := c.NextSibling
+				n.RemoveChild(c)
+				children = append(children, c)
+				c = next
+			}
+			for _, part := range chunkNodes(children, maxBytes) {
+				wrapper := &html.Node{Type: n.Type, DataAtom: n.DataAtom, Data: n.Data, Namespace: n.Namespace, Attr: n.Attr}
+				for _, c := range part {
+					wrapper.AppendChild(c)
+				}
+				chunks = append(chunks, []*html.Node{wrapper})
+			}
+			continue
+		}
+
+		if size+nodeSize > maxBytes {
+			flush()
+		}
+		current = append(current, n)
+		size += nodeSize
+	}
+	flush()
+
+	return chunks
+}
+
+func renderedSize(n *html.Node) int {
+	var buf bytes.Buffer
+	html.Render(&buf, n)
+	return buf.Len()
+}
+
+// findElement returns the first element with the given tag name
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package epub
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSanitizeOptions = SanitizeOptions{
+	ResourceURL: "/api/books/b1/resource/",
+	ChapterURL:  "/api/books/b1/content/",
+}
+
+var testChapters = []Chapter{
+	{Index: 0, Href: "OEBPS/Text/ch1.xhtml"},
+	{Index: 1, Href: "OEBPS/Text/ch2.xhtml"},
+}
+
+func sanitize(t *testing.T, content string) string {
+	t.Helper()
+	result, err := SanitizeChapter(content, "OEBPS/Text/ch1.xhtml", testChapters, testSanitizeOptions)
+	require.NoError(t, err)
+	return result
+}
+
+func TestSanitizeChapterStripsScripts(t *testing.T) {
+	result := sanitize(t, `<html><head><script src="x.js"/><meta http-equiv="refresh" content="0;url=http://evil"/></head>
+<body onload="alert(1)"><p onclick="steal()">Text</p><a href=" JavaScript:alert(1)">link</a>
+<iframe src="http://example.com"></iframe><script>alert(2)</script><p>After</p></body></html>`)
+
+	assert.NotContains(t, result, "<script")
+	assert.NotContains(t, result, "<iframe")
+	assert.NotContains(t, result, "refresh")
+	assert.NotContains(t, strings.ToLower(result), "javascript:")
+	assert.NotContains(t, result, "onload")
+	assert.NotContains(t, result, "onclick")
+	assert.Contains(t, result, "<p>Text</p>")
+	assert.Contains(t, result, "<p>After</p>", "self-closing script must not swallow the body")
+}
+
+func TestSanitizeChapterRewritesResources(t *testing.T) {
+	result := sanitize(t, `<html><head><title/><link rel="stylesheet" href="../Styles/book.css"/>
+<style>@import "../Styles/extra.css"; body { background: url('../Images/bg.png'); }</style></head>
+<body><img src="../Images/fig%201.jpg"/><img src="data:image/png;base64,AAAA"/>
+<svg><image xlink:href="../Images/cover.jpg"/></svg>
+<div style="background-image: url(/OEBPS/Images/tile.gif)">x</div>
+<img src="http://example.com/remote.png"/></body></html>`)
+
+	assert.Contains(t, result, `href="/api/books/b1/resource/OEBPS/Styles/book.css"`)
+	assert.Contains(t, result, `@import "/api/books/b1/resource/OEBPS/Styles/extra.css"`)
+	assert.Contains(t, result, `url('/api/books/b1/resource/OEBPS/Images/bg.png')`)
+	assert.Contains(t, result, `src="/api/books/b1/resource/OEBPS/Images/fig%201.jpg"`)
+	assert.Contains(t, result, `src="data:image/png;base64,AAAA"`)
+	assert.Contains(t, result, `xlink:href="/api/books/b1/resource/OEBPS/Images/cover.jpg"`)
+	assert.Contains(t, result, `url(/api/books/b1/resource/OEBPS/Images/tile.gif)`)
+	assert.Contains(t, result, `src="http://example.com/remote.png"`)
+}
+
+func TestSanitizeChapterRewritesLinks(t *testing.T) {
+	result := sanitize(t, `<html><body>
+<a href="ch2.xhtml#note-3">next</a>
+<a href="/OEBPS/Text/ch1.xhtml#top">self</a>
+<a href="#local">local</a>
+<a href="../Images/map.png">map</a>
+<a href="https://example.com">web</a>
+</body></html>`)
+
+	assert.Contains(t, result, `<a href="/api/books/b1/content/1#note-3" data-chapter="1">next</a>`)
+	assert.Contains(t, result, `<a href="#top">self</a>`)
+	assert.Contains(t, result, `<a href="#local">local</a>`)
+	assert.Contains(t, result, `<a href="/api/books/b1/resource/OEBPS/Images/map.png">map</a>`)
+	assert.Contains(t, result, `<a href="https://example.com" target="_blank" rel="noopener noreferrer">web</a>`)
+}
+
+func TestSanitizeChapterStaysInArchive(t *testing.T) {
+	result := sanitize(t, `<img src="../../../../etc/passwd"/>`)
+	assert.Contains(t, result, `src="/api/books/b1/resource/etc/passwd"`)
+}
+
+func TestGetSanitizedChapterContent(t *testing.T) {
+	epubPath := createTestEPUB(t)
+	defer os.Remove(epubPath)
+
+	content, err := GetSanitizedChapterContent(epubPath, 0, testSanitizeOptions)
+	require.NoError(t, err)
+	assert.Contains(t, content, "<h1>Chapter 1: Introduction</h1>")
+
+	content, err = GetSanitizedChapterContent(epubPath, 5, testSanitizeOptions)
+	require.NoError(t, err)
+	assert.Empty(t, content)
+}
+
+func TestSplitChapter(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&body, "<p>Paragraph %d with some filler text to take up space.</p>\n", i)
+	}
+
+	t.Run("top-level paragraphs", func(t *testing.T) {
+		content := `<html><head><title>Ch</title><link rel="stylesheet" href="a.css"/></head><body>` + body.String() + `</body></html>`
+		pages, err := SplitChapter(content, 1024)
+		require.NoError(t, err)
+		require.Greater(t, len(pages), 4)
+
+		for i, page := range pages {
+			assert.Contains(t, page, `<link rel="stylesheet" href="a.css"/>`, "page %d keeps the head", i)
+			assert.Less(t, len(page), 1024+200, "page %d", i)
+		}
+		assert.Contains(t, pages[0], "Paragraph 0 ")
+		assert.Contains(t, pages[len(pages)-1], "Paragraph 99 ")
+
+		// Every paragraph appears exactly once
+		all := strings.Join(pages, "")
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, 1, strings.Count(all, fmt.Sprintf("Paragraph %d ", i)))
+		}
+	})
+
+	t.Run("wrapper div", func(t *testing.T) {
+		content := `<html><body><div class="chapter">` + body.String() + `</div></body></html>`
+		pages, err := SplitChapter(content, 1024)
+		require.NoError(t, err)
+		require.Greater(t, len(pages), 4)
+		for _, page := range pages {
+			assert.Contains(t, page, `<div class="chapter">`)
+		}
+	})
+
+	t.Run("small chapter", func(t *testing.T) {
+		pages, err := SplitChapter(`<html><body><p>Short</p></body></html>`, 1024)
+		require.NoError(t, err)
+		require.Len(t, pages, 1)
+		assert.Contains(t, pages[0], "<p>Short</p>")
+	})
+}
+
+// createEPUBWithResources writes an EPUB with a stylesheet, an image (with a
+// space in its name), and an NCX alongside one chapter
+func createEPUBWithResources(t *testing.T) string {
+	t.Helper()
+	tmpFile, err := os.CreateTemp("", "test-*.epub")
+	require.NoError(t, err)
+	defer tmpFile.Close()
+
+	w := zip.NewWriter(tmpFile)
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Resources</dc:title></metadata>
+  <manifest>
+    <item id="ch1" href="Text/ch1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="Styles/book.css" media-type="text/css"/>
+    <item id="img" href="Images/fig%201.jpg" media-type="image/jpeg"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="missing" href="Images/missing.png" media-type="image/png"/>
+  </manifest>
+  <spine><itemref idref="ch1"/></spine>
+</package>`,
+		"OEBPS/Text/ch1.xhtml":   `<html><head><link rel="stylesheet" href="../Styles/book.css"/></head><body><img src="../Images/fig%201.jpg"/></body></html>`,
+		"OEBPS/Styles/book.css":  `body { margin: 0; }`,
+		"OEBPS/Images/fig 1.jpg": "jpeg-bytes",
+		"OEBPS/toc.ncx":          "<ncx/>",
+	}
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, w.Close())
+	return tmpFile.Name()
+}
+
+func TestWalkResources(t *testing.T) {
+	epubPath := createEPUBWithResources(t)
+	defer os.Remove(epubPath)
+
+	found := map[string]string{}
+	err := WalkResources(epubPath, func(res Resource, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		found[res.Path] = res.MediaType + ":" + string(data)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Chapters, the NCX, and items missing from the archive are skipped
+	assert.Equal(t, map[string]string{
+		"OEBPS/Styles/book.css":  "text/css:body { margin: 0; }",
+		"OEBPS/Images/fig 1.jpg": "image/jpeg:jpeg-bytes",
+	}, found)
+}
@@ -10,6 +10,10 @@ import (
 	"strings"
 )
 
+// TempFilePattern names the temporary copies UpdateMetadata writes in the
+// system temporary directory, as a glob
+const TempFilePattern = "epub-update-*.epub"
+
 // UpdateMetadata updates the metadata inside an EPUB file
 func UpdateMetadata(filePath string, meta *Metadata) error {
 	// Read the original EPUB
@@ -50,7 +54,7 @@ func UpdateMetadata(filePath string, meta *Metadata) error {
 	updatedOPF := updateOPFContent(string(opfContent), meta)
 
 	// Create a temporary file for the new EPUB
-	tmpFile, err := os.CreateTemp("", "epub-update-*.epub")
+	tmpFile, err := os.CreateTemp("", TempFilePattern)
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -124,6 +128,7 @@ func UpdateMetadata(filePath string, meta *Metadata) error {
 		}
 		os.Remove(tmpPath)
 	}
+	Invalidate(filePath)
 
 	return nil
 }
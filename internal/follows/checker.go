@@ -0,0 +1,254 @@
+package follows
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/notify"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// Checker periodically queries metadata providers for new releases by
+// followed authors and series
+type Checker struct {
+	db            *storage.Database
+	metadata      *metadata.Service
+	comicMetadata *metadata.ComicService
+	notifier      *notify.Service
+	timeout       time.Duration
+}
+
+// NewChecker creates a release checker
+func NewChecker(db *storage.Database, meta *metadata.Service, comics *metadata.ComicService, notifier *notify.Service) *Checker {
+	return &Checker{
+		db:            db,
+		metadata:      meta,
+		comicMetadata: comics,
+		notifier:      notifier,
+		timeout:       30 * time.Second,
+	}
+}
+
+// Start runs CheckDue on the given interval until the context is cancelled
+func (c *Checker) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		c.CheckDue(ctx, interval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.CheckDue(ctx, interval)
+			}
+		}
+	}()
+}
+
+// CheckDue checks every follow that hasn't been checked within the interval
+func (c *Checker) CheckDue(ctx context.Context, interval time.Duration) {
+	follows, err := c.db.ListFollowsDueForCheck(time.Now().Add(-interval))
+	if err != nil {
+		log.Printf("Warning: failed to list follows for release check: %v", err)
+		return
+	}
+
+	for _, f := range follows {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := c.CheckFollow(ctx, f); err != nil {
+			log.Printf("Warning: release check failed for %s %q: %v", f.FollowType, f.Name, err)
+		}
+	}
+}
+
+// CheckFollow looks up releases for one follow and records any new ones.
+// Notifications are only sent after the first check so that following
+// someone doesn't immediately flood the user with their back catalogue.
+func (c *Checker) CheckFollow(ctx context.Context, f *models.Follow) ([]*models.FollowUpdate, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var candidates []*models.FollowUpdate
+	var err error
+	switch f.FollowType {
+	case models.FollowTypeAuthor:
+		candidates, err = c.authorReleases(ctx, f)
+	case models.FollowTypeSeries:
+		candidates, err = c.seriesReleases(ctx, f)
+	default:
+		return nil, fmt.Errorf("unknown follow type: %s", f.FollowType)
+	}
+	if err != nil && err != metadata.ErrNoMatch {
+		return nil, err
+	}
+
+	// Only releases from around the time of following onwards count as new
+	minYear := f.CreatedAt.Year() - 1
+	now := time.Now()
+
+	var created []*models.FollowUpdate
+	for _, u := range candidates {
+		if year := releaseYear(u.ReleaseDate); year > 0 && year < minYear {
+			continue
+		}
+		if c.inLibrary(f.UserID, u) {
+			continue
+		}
+
+		u.ID = uuid.New().String()
+		u.FollowID = f.ID
+		u.UserID = f.UserID
+		u.CreatedAt = now
+
+		inserted, err := c.db.CreateFollowUpdate(u)
+		if err != nil {
+			return created, err
+		}
+		if inserted {
+			created = append(created, u)
+		}
+	}
+
+	if f.LastCheckedAt != nil {
+		for _, u := range created {
+			c.notify(f, u)
+		}
+	}
+
+	if err := c.db.UpdateFollowChecked(f.ID, now); err != nil {
+		return created, err
+	}
+	f.LastCheckedAt = &now
+
+	return created, nil
+}
+
+// authorReleases returns the author's newest books from the book providers
+func (c *Checker) authorReleases(ctx context.Context, f *models.Follow) ([]*models.FollowUpdate, error) {
+	results, err := c.metadata.SearchByAuthor(ctx, f.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []*models.FollowUpdate
+	for _, r := range results {
+		updates = append(updates, bookToUpdate(r))
+	}
+	return updates, nil
+}
+
+// seriesReleases returns the newest entries in a series. Comic series use
+// the comic provider when it is configured, otherwise the book providers.
+func (c *Checker) seriesReleases(ctx context.Context, f *models.Follow) ([]*models.FollowUpdate, error) {
+	if c.comicMetadata != nil && c.comicMetadata.IsConfigured() {
+		issues, err := c.comicMetadata.LatestIssues(ctx, f.Name)
+		if err == nil && len(issues) > 0 {
+			var updates []*models.FollowUpdate
+			for _, issue := range issues {
+				updates = append(updates, &models.FollowUpdate{
+					Title:       issue.Title,
+					Author:      strings.Join(issue.Writers, ", "),
+					Series:      issue.Series,
+					IssueNumber: issue.IssueNumber,
+					ReleaseDate: issue.ReleaseDate,
+					CoverURL:    issue.CoverURL,
+					Source:      issue.Source,
+					SourceID:    issue.SourceID,
+				})
+			}
+			return updates, nil
+		}
+	}
+
+	results, err := c.metadata.SearchBooks(ctx, "", f.Name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []*models.FollowUpdate
+	for _, r := range results {
+		u := bookToUpdate(r)
+		u.Series = f.Name
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// inLibrary reports whether a release is already in the user's library
+func (c *Checker) inLibrary(userID string, u *models.FollowUpdate) bool {
+	if u.Series != "" && u.IssueNumber != "" {
+		if index, err := strconv.ParseFloat(u.IssueNumber, 64); err == nil {
+			if found, _ := c.db.HasBookInSeries(userID, u.Series, index); found {
+				return true
+			}
+		}
+	}
+	found, _ := c.db.HasBookWithTitle(userID, u.Title)
+	return found
+}
+
+// notify publishes a release notification for a follow update
+func (c *Checker) notify(f *models.Follow, u *models.FollowUpdate) {
+	if c.notifier == nil {
+		return
+	}
+
+	event := notify.Event{
+		UserID:  f.UserID,
+		Message: u.Title,
+	}
+	if f.FollowType == models.FollowTypeSeries {
+		event.Type = models.NotificationEventSeriesNewBook
+		event.Title = fmt.Sprintf("New in %s", f.Name)
+	} else {
+		event.Type = models.NotificationEventAuthorNewBook
+		event.Title = fmt.Sprintf("New from %s", f.Name)
+	}
+	if u.ReleaseDate != "" {
+		event.Message = fmt.Sprintf("%s (%s)", u.Title, u.ReleaseDate)
+	}
+
+	c.notifier.Publish(event)
+}
+
+// bookToUpdate converts book metadata into a follow update
+func bookToUpdate(r metadata.BookMetadata) *models.FollowUpdate {
+	sourceID := r.ISBN13
+	if sourceID == "" {
+		sourceID = r.ISBN10
+	}
+	if sourceID == "" {
+		sourceID = strings.ToLower(strings.TrimSpace(r.Title))
+	}
+
+	return &models.FollowUpdate{
+		Title:       r.Title,
+		Author:      strings.Join(r.Authors, ", "),
+		ReleaseDate: r.PublishDate,
+		CoverURL:    r.CoverURL,
+		Source:      r.Source,
+		SourceID:    sourceID,
+	}
+}
+
+// releaseYear extracts a four-digit year from a release date, or 0 if none
+func releaseYear(date string) int {
+	for i := 0; i+4 <= len(date); i++ {
+		if year, err := strconv.Atoi(date[i : i+4]); err == nil && year > 1000 {
+			return year
+		}
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package follows
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/metadata"
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// mockAuthorProvider implements metadata.Provider and metadata.AuthorProvider for testing
+type mockAuthorProvider struct {
+	results []metadata.BookMetadata
+}
+
+func (m *mockAuthorProvider) Name() string { return "mock" }
+
+func (m *mockAuthorProvider) LookupByISBN(ctx context.Context, isbn string) (*metadata.BookMetadata, error) {
+	return nil, metadata.ErrNoMatch
+}
+
+func (m *mockAuthorProvider) Search(ctx context.Context, title, author string) ([]metadata.BookMetadata, error) {
+	return nil, metadata.ErrNoMatch
+}
+
+func (m *mockAuthorProvider) GetCoverURL(isbn string, size metadata.CoverSize) string { return "" }
+
+func (m *mockAuthorProvider) SearchByAuthor(ctx context.Context, author string) ([]metadata.BookMetadata, error) {
+	return m.results, nil
+}
+
+func setupTestChecker(t *testing.T, provider metadata.Provider) (*Checker, *storage.Database, func()) {
+	tmpFile, err := os.CreateTemp("", "webby-test-*.db")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	db, err := storage.NewDatabase(tmpFile.Name())
+	require.NoError(t, err)
+
+	checker := NewChecker(db, metadata.NewService(provider, nil), nil, nil)
+
+	cleanup := func() {
+		db.Close()
+		os.Remove(tmpFile.Name())
+		os.Remove(tmpFile.Name() + "-wal")
+		os.Remove(tmpFile.Name() + "-shm")
+	}
+	return checker, db, cleanup
+}
+
+func TestCheckFollowAuthor(t *testing.T) {
+	thisYear := time.Now().Format("2006")
+	provider := &mockAuthorProvider{
+		results: []metadata.BookMetadata{
+			{Title: "Brand New Book", Authors: []string{"Author"}, ISBN13: "9780000000001", PublishDate: thisYear, Source: "mock"},
+			{Title: "Owned Book", Authors: []string{"Author"}, ISBN13: "9780000000002", Source: "mock"},
+			{Title: "Ancient Book", Authors: []string{"Author"}, ISBN13: "9780000000003", PublishDate: "1970", Source: "mock"},
+		},
+	}
+
+	checker, db, cleanup := setupTestChecker(t, provider)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+	book := &models.Book{ID: "book-id", UserID: user.ID, Title: "Owned Book", Author: "Author", FilePath: "/path.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	follow := &models.Follow{ID: "follow-id", UserID: user.ID, FollowType: models.FollowTypeAuthor, Name: "Author", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateFollow(follow))
+
+	// Owned and old releases are skipped
+	updates, err := checker.CheckFollow(context.Background(), follow)
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "Brand New Book", updates[0].Title)
+	assert.NotNil(t, follow.LastCheckedAt)
+	assert.Equal(t, thisYear, updates[0].ReleaseDate)
+
+	// Releases are only recorded once
+	updates, err = checker.CheckFollow(context.Background(), follow)
+	require.NoError(t, err)
+	assert.Empty(t, updates)
+
+	feed, err := db.ListFollowUpdates(user.ID, true, 0)
+	require.NoError(t, err)
+	require.Len(t, feed, 1)
+	assert.Equal(t, "Author", feed[0].FollowName)
+
+	require.NoError(t, db.MarkFollowUpdatesSeen(user.ID, nil))
+	feed, err = db.ListFollowUpdates(user.ID, true, 0)
+	require.NoError(t, err)
+	assert.Empty(t, feed)
+}
+
+func TestReleaseYear(t *testing.T) {
+	assert.Equal(t, 2019, releaseYear("2019-05-12"))
+	assert.Equal(t, 2021, releaseYear("March 2021"))
+	assert.Equal(t, 0, releaseYear(""))
+}
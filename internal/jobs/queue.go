@@ -0,0 +1,271 @@
+// Package jobs runs long tasks over many items, such as refreshing the
+// metadata of a whole library, in the background one job at a time. Each
+// item's result is saved as it finishes, so a job that's paused, or cut off
+// by the server stopping, resumes with the first item it hadn't finished.
+// Storage is behind the Store interface so the queue can be tested without
+// a database.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// Store is the subset of storage.Database the queue uses
+type Store interface {
+	CreateJob(job *models.Job, itemIDs []string) error
+	GetJob(jobID string) (*models.Job, error)
+	NextQueuedJob() (*models.Job, error)
+	TransitionJob(jobID string, from []string, status string) (bool, error)
+	RequeueRunningJobs() error
+	ListJobItems(jobID, status string) ([]*models.JobItem, error)
+	FinishJobItem(item *models.JobItem) error
+}
+
+// Worker works one item of a job, setting its Status, and its Reason when
+// it didn't succeed. An item it leaves pending, as it should when ctx is
+// cancelled partway, is worked again when the job resumes.
+type Worker func(ctx context.Context, job *models.Job, item *models.JobItem)
+
+// Queue runs queued jobs with the worker registered for their kind
+type Queue struct {
+	store       Store
+	workers     map[string]Worker
+	concurrency map[string]int // Items of a kind's job worked at once
+	wake        chan struct{}
+	stopped     sync.WaitGroup // Done once the loop Start began returns
+
+	mu      sync.Mutex
+	running string             // ID of the job being worked
+	cancel  context.CancelFunc // Stops the job being worked
+}
+
+// NewQueue creates a job queue
+func NewQueue(store Store) *Queue {
+	return &Queue{
+		store:       store,
+		workers:     make(map[string]Worker),
+		concurrency: make(map[string]int),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Register sets the worker for jobs of a kind. Workers are registered
+// before the queue starts.
+func (q *Queue) Register(kind string, worker Worker) {
+	q.RegisterConcurrent(kind, worker, 1)
+}
+
+// RegisterConcurrent is like Register, but up to n of a job's items are
+// worked at once, for workers that are safe to run concurrently and spend
+// their time waiting on disk or the network
+func (q *Queue) RegisterConcurrent(kind string, worker Worker, n int) {
+	q.workers[kind] = worker
+	q.concurrency[kind] = max(n, 1)
+}
+
+// Enqueue creates a job of kind over itemIDs and queues it behind any
+// others. A dry run's worker records what it would change instead of
+// changing it.
+func (q *Queue) Enqueue(userID, kind string, dryRun bool, itemIDs []string) (*models.Job, error) {
+	return q.Submit(&models.Job{UserID: userID, Kind: kind, DryRun: dryRun}, itemIDs)
+}
+
+// Submit is like Enqueue, taking a job with its user, kind, and options
+// such as DryRun and Provider set. The rest of the job is filled in.
+func (q *Queue) Submit(job *models.Job, itemIDs []string) (*models.Job, error) {
+	if q.workers[job.Kind] == nil {
+		return nil, fmt.Errorf("no worker for %s jobs", job.Kind)
+	}
+	now := time.Now()
+	job.ID = uuid.New().String()
+	job.Status = models.JobStatusQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if err := q.store.CreateJob(job, itemIDs); err != nil {
+		return nil, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// Pause stops a queued or running job after the item it's working on,
+// reporting whether it was queued or running
+func (q *Queue) Pause(jobID string) (bool, error) {
+	paused, err := q.store.TransitionJob(jobID, []string{models.JobStatusQueued, models.JobStatusRunning},
+		models.JobStatusPaused)
+	if err != nil || !paused {
+		return false, err
+	}
+	q.mu.Lock()
+	if q.running == jobID {
+		q.cancel()
+	}
+	q.mu.Unlock()
+	return true, nil
+}
+
+// Resume queues a paused job again, reporting whether it was paused. It
+// carries on from its first unfinished item.
+func (q *Queue) Resume(jobID string) (bool, error) {
+	resumed, err := q.store.TransitionJob(jobID, []string{models.JobStatusPaused}, models.JobStatusQueued)
+	if err != nil || !resumed {
+		return false, err
+	}
+	q.notify()
+	return true, nil
+}
+
+// notify wakes the queue to look for queued jobs
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start works through queued jobs in the background until ctx is done,
+// beginning with any that were running when the server last stopped
+func (q *Queue) Start(ctx context.Context) {
+	if err := q.store.RequeueRunningJobs(); err != nil {
+		log.Printf("Warning: failed to requeue interrupted jobs: %v", err)
+	}
+	q.stopped.Add(1)
+	go func() {
+		defer q.stopped.Done()
+		for {
+			for ctx.Err() == nil {
+				ran, err := q.runNext(ctx)
+				if err != nil {
+					log.Printf("Warning: job queue: %v", err)
+				}
+				if !ran || err != nil {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the queue has stopped after Start's ctx is done. The
+// items being worked then are finished first, or left pending if their
+// worker gives up on ctx.
+func (q *Queue) Wait() {
+	q.stopped.Wait()
+}
+
+// runNext works the job that has been queued longest, reporting whether
+// there was one
+func (q *Queue) runNext(ctx context.Context) (bool, error) {
+	job, err := q.store.NextQueuedJob()
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	worker := q.workers[job.Kind]
+	if worker == nil {
+		// Left for a server that knows the kind
+		q.store.TransitionJob(job.ID, []string{models.JobStatusQueued}, models.JobStatusPaused)
+		return true, fmt.Errorf("no worker for %s job %s", job.Kind, job.ID)
+	}
+
+	// Marked as running before it starts, so pausing it from here on
+	// cancels it
+	jobCtx, cancel := context.WithCancel(ctx)
+	q.mu.Lock()
+	q.running, q.cancel = job.ID, cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.running, q.cancel = "", nil
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	started, err := q.store.TransitionJob(job.ID, []string{models.JobStatusQueued}, models.JobStatusRunning)
+	if err != nil || !started {
+		// Paused since it was picked
+		return err == nil, err
+	}
+	job.Status = models.JobStatusRunning
+
+	if err := q.work(jobCtx, job, worker); err != nil {
+		// Paused, to be resumed once whatever failed is fixed
+		q.store.TransitionJob(job.ID, []string{models.JobStatusRunning}, models.JobStatusPaused)
+		return true, fmt.Errorf("job %s: %w", job.ID, err)
+	}
+	if jobCtx.Err() != nil {
+		// Paused, or the server is stopping; either way the job picks up
+		// from its first pending item
+		return true, nil
+	}
+	_, err = q.store.TransitionJob(job.ID, []string{models.JobStatusRunning}, models.JobStatusCompleted)
+	return true, err
+}
+
+// work runs worker over a job's pending items, as many at once as its kind
+// allows, saving each result, until they're done or ctx is. Items are
+// started in order.
+func (q *Queue) work(ctx context.Context, job *models.Job, worker Worker) error {
+	items, err := q.store.ListJobItems(job.ID, models.JobItemPending)
+	if err != nil {
+		return err
+	}
+
+	// Cancelled too if a result can't be saved
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex // Serializes saving results
+		saveErr error
+	)
+	slots := make(chan struct{}, max(q.concurrency[job.Kind], 1))
+	for _, item := range items {
+		// A slot is taken before checking ctx, so an item that pauses the
+		// job stops the next from starting
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			worker(ctx, job, item)
+			if item.Status == models.JobItemPending {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if saveErr != nil {
+				return
+			}
+			if err := q.store.FinishJobItem(item); err != nil {
+				saveErr = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return saveErr
+}
@@ -0,0 +1,279 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// fakeStore keeps jobs and their items in memory
+type fakeStore struct {
+	mu    sync.Mutex
+	jobs  []*models.Job
+	items map[string][]*models.JobItem
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{items: make(map[string][]*models.JobItem)}
+}
+
+func (f *fakeStore) CreateJob(job *models.Job, itemIDs []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job.Total = len(itemIDs)
+	copied := *job
+	f.jobs = append(f.jobs, &copied)
+	for seq, id := range itemIDs {
+		f.items[job.ID] = append(f.items[job.ID], &models.JobItem{JobID: job.ID, Seq: seq, ItemID: id,
+			Status: models.JobItemPending})
+	}
+	return nil
+}
+
+func (f *fakeStore) GetJob(jobID string) (*models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.ID == jobID {
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeStore) NextQueuedJob() (*models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.Status == models.JobStatusQueued {
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeStore) TransitionJob(jobID string, from []string, status string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.ID != jobID {
+			continue
+		}
+		for _, s := range from {
+			if job.Status == s {
+				job.Status = status
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeStore) RequeueRunningJobs() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.Status == models.JobStatusRunning {
+			job.Status = models.JobStatusQueued
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) ListJobItems(jobID, status string) ([]*models.JobItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var items []*models.JobItem
+	for _, item := range f.items[jobID] {
+		if status == "" || item.Status == status {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeStore) FinishJobItem(item *models.JobItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*f.items[item.JobID][item.Seq] = *item
+	for _, job := range f.jobs {
+		if job.ID == item.JobID {
+			job.Processed++
+			switch item.Status {
+			case models.JobItemSucceeded:
+				job.Succeeded++
+			case models.JobItemFailed:
+				job.Failed++
+			}
+		}
+	}
+	return nil
+}
+
+func TestQueueRunsJobs(t *testing.T) {
+	store := newFakeStore()
+	q := NewQueue(store)
+
+	var worked []string
+	q.Register("test", func(ctx context.Context, job *models.Job, item *models.JobItem) {
+		worked = append(worked, item.ItemID)
+		item.Status = models.JobItemSucceeded
+		if item.ItemID == "b" {
+			item.Status, item.Reason = models.JobItemFailed, "No match"
+		}
+	})
+
+	_, err := q.Enqueue("user", "other", false, []string{"a"})
+	assert.Error(t, err, "a kind without a worker")
+
+	job, err := q.Enqueue("user", "test", false, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	ran, err := q.runNext(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ran)
+
+	job, err = store.GetJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, worked)
+	assert.Equal(t, models.JobStatusCompleted, job.Status)
+	assert.Equal(t, 3, job.Processed)
+	assert.Equal(t, 2, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+
+	ran, err = q.runNext(context.Background())
+	require.NoError(t, err)
+	assert.False(t, ran, "nothing left queued")
+}
+
+func TestQueuePauseAndResume(t *testing.T) {
+	store := newFakeStore()
+	q := NewQueue(store)
+
+	var worked []string
+	var job *models.Job
+	q.Register("test", func(ctx context.Context, _ *models.Job, item *models.JobItem) {
+		worked = append(worked, item.ItemID)
+		item.Status = models.JobItemSucceeded
+		if item.ItemID == "b" {
+			paused, err := q.Pause(job.ID)
+			require.NoError(t, err)
+			assert.True(t, paused)
+			assert.Error(t, ctx.Err(), "pausing stops the running job")
+		}
+	})
+
+	job, err := q.Enqueue("user", "test", false, []string{"a", "b", "c"})
+	require.NoError(t, err)
+	_, err = q.runNext(context.Background())
+	require.NoError(t, err)
+
+	paused, err := store.GetJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusPaused, paused.Status)
+	assert.Equal(t, 2, paused.Processed, "the item being worked when paused is kept")
+
+	resumed, err := q.Resume(job.ID)
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	_, err = q.runNext(context.Background())
+	require.NoError(t, err)
+
+	done, err := store.GetJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCompleted, done.Status)
+	assert.Equal(t, []string{"a", "b", "c"}, worked, "resuming starts at the first unfinished item")
+
+	resumed, err = q.Resume(job.ID)
+	require.NoError(t, err)
+	assert.False(t, resumed, "a finished job can't be resumed")
+}
+
+func TestQueueWorksConcurrently(t *testing.T) {
+	store := newFakeStore()
+	q := NewQueue(store)
+
+	var active, peak atomic.Int32
+	q.RegisterConcurrent("test", func(ctx context.Context, _ *models.Job, item *models.JobItem) {
+		n := active.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(20 * time.Millisecond)
+		active.Add(-1)
+		item.Status = models.JobItemSucceeded
+	}, 3)
+
+	job, err := q.Enqueue("user", "test", false, []string{"a", "b", "c", "d", "e", "f"})
+	require.NoError(t, err)
+	_, err = q.runNext(context.Background())
+	require.NoError(t, err)
+
+	job, err = store.GetJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCompleted, job.Status)
+	assert.Equal(t, 6, job.Succeeded)
+	assert.Equal(t, int32(3), peak.Load(), "no more than three items are worked at once")
+}
+
+func TestQueueResumesInterruptedJobs(t *testing.T) {
+	store := newFakeStore()
+	q := NewQueue(store)
+
+	worked := make(chan string, 3)
+	q.Register("test", func(ctx context.Context, _ *models.Job, item *models.JobItem) {
+		worked <- item.ItemID
+		item.Status = models.JobItemSucceeded
+	})
+
+	// Running with its first item done when the server stopped
+	job := &models.Job{ID: "job", UserID: "user", Kind: "test", Status: models.JobStatusRunning}
+	require.NoError(t, store.CreateJob(job, []string{"a", "b"}))
+	require.NoError(t, store.FinishJobItem(&models.JobItem{JobID: "job", Seq: 0, ItemID: "a",
+		Status: models.JobItemSucceeded}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		job, err := store.GetJob("job")
+		return err == nil && job.Status == models.JobStatusCompleted
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "b", <-worked)
+	assert.Empty(t, worked)
+}
+
+func TestQueueWait(t *testing.T) {
+	store := newFakeStore()
+	q := NewQueue(store)
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+	q.Register("test", func(ctx context.Context, _ *models.Job, item *models.JobItem) {
+		close(started)
+		<-ctx.Done()
+		// Work that doesn't stop for ctx, like encoding an image
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		item.Status = models.JobItemSucceeded
+	})
+	_, err := q.Enqueue("user", "test", false, []string{"a"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Start(ctx)
+	<-started
+	cancel()
+	q.Wait()
+	assert.True(t, finished.Load(), "the item being worked is finished first")
+}
@@ -0,0 +1,70 @@
+package locale
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords are frequent short words that identify a language. Words shared
+// between languages count toward each of them.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "was", "he", "she", "with", "for", "his", "her", "you", "not", "but"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ich", "sie", "er", "mit", "den", "ein", "eine", "zu", "von", "auf", "sich", "dem"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "que", "qui", "dans", "pas", "il", "elle", "pour", "sur", "avec", "ne", "je"},
+	"es": {"el", "la", "los", "las", "y", "que", "de", "en", "es", "una", "por", "con", "no", "se", "del", "su", "para", "pero"},
+	"it": {"il", "lo", "gli", "e", "che", "di", "non", "è", "una", "per", "con", "si", "sono", "del", "della", "ma", "mi", "un"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "zijn", "ik", "op", "te", "met", "voor", "hij", "zij", "maar"},
+	"pt": {"o", "os", "as", "e", "que", "de", "não", "uma", "um", "com", "para", "por", "se", "do", "da", "em", "mas", "ele"},
+}
+
+// Detection needs this many words, and the best language must beat the
+// runner-up by this factor, before a guess is made
+const (
+	minDetectWords = 20
+	minDetectLead  = 1.5
+)
+
+// stopWordLanguages maps each stop word to the languages it belongs to
+var stopWordLanguages = func() map[string][]string {
+	m := map[string][]string{}
+	for lang, words := range stopWords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// Detect guesses the language of text from its stop words and returns a
+// two-letter code, or "" when the text is too short or too ambiguous to tell
+func Detect(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) < minDetectWords {
+		return ""
+	}
+
+	scores := map[string]int{}
+	for _, w := range words {
+		for _, lang := range stopWordLanguages[w] {
+			scores[lang]++
+		}
+	}
+
+	var best, second int
+	var guess string
+	for lang, score := range scores {
+		switch {
+		case score > best:
+			second = best
+			best, guess = score, lang
+		case score > second:
+			second = score
+		}
+	}
+	if best == 0 || float64(best) < float64(second)*minDetectLead {
+		return ""
+	}
+	return guess
+}
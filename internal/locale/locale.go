@@ -0,0 +1,187 @@
+// Package locale handles book languages: normalizing language codes,
+// guessing a book's language from its text, and ordering titles the way
+// readers of a language expect.
+package locale
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultSortLocale is used when a user hasn't chosen a sort locale
+const DefaultSortLocale = "en"
+
+// threeLetterCodes maps the ISO 639-2 codes some EPUBs use to the two-letter
+// codes used everywhere else
+var threeLetterCodes = map[string]string{
+	"eng": "en",
+	"ger": "de", "deu": "de",
+	"fre": "fr", "fra": "fr",
+	"spa": "es",
+	"ita": "it",
+	"dut": "nl", "nld": "nl",
+	"por": "pt",
+	"jpn": "ja",
+	"chi": "zh", "zho": "zh",
+	"rus": "ru",
+}
+
+// Normalize reduces a language tag to its lowercase base language, so
+// "en-US", "en_GB", and "eng" all become "en". Unrecognized values are
+// returned lowercased.
+func Normalize(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if two, ok := threeLetterCodes[code]; ok {
+		return two
+	}
+	return code
+}
+
+// ValidSortLocale reports whether tag is a BCP 47 language tag titles can be
+// sorted by
+func ValidSortLocale(tag string) bool {
+	_, err := language.Parse(tag)
+	return err == nil
+}
+
+// leadingArticles are the articles ignored at the start of titles, by
+// language. Elided forms like "l'" include the apostrophe instead of a
+// trailing space.
+var leadingArticles = map[string][]string{
+	"en": {"the ", "a ", "an "},
+	"de": {"der ", "die ", "das ", "den ", "dem ", "des ", "ein ", "eine ", "einen ", "einem ", "einer ", "eines "},
+	"fr": {"le ", "la ", "les ", "l'", "l’", "un ", "une ", "des "},
+	"es": {"el ", "la ", "los ", "las ", "un ", "una ", "unos ", "unas "},
+	"it": {"il ", "lo ", "la ", "i ", "gli ", "le ", "l'", "l’", "un ", "uno ", "una ", "un'"},
+	"nl": {"de ", "het ", "een ", "'t "},
+	"pt": {"o ", "a ", "os ", "as ", "um ", "uma ", "uns ", "umas "},
+}
+
+// StripArticle removes a leading article from title using the articles of
+// lang, or English when lang is empty or has none. A title that is only an
+// article is returned unchanged.
+func StripArticle(title, lang string) string {
+	articles, ok := leadingArticles[Normalize(lang)]
+	if !ok {
+		articles = leadingArticles["en"]
+	}
+
+	trimmed := strings.TrimSpace(title)
+	lower := strings.ToLower(trimmed)
+	for _, article := range articles {
+		if strings.HasPrefix(lower, article) && len(trimmed) > len(article) {
+			return strings.TrimSpace(trimmed[len(article):])
+		}
+	}
+	return trimmed
+}
+
+// TitleSorter orders titles for a locale, optionally ignoring leading
+// articles. It isn't safe for concurrent use.
+type TitleSorter struct {
+	collator       *collate.Collator
+	ignoreArticles bool
+}
+
+// NewTitleSorter creates a sorter for the BCP 47 tag sortLocale, falling back
+// to DefaultSortLocale if it doesn't parse
+func NewTitleSorter(sortLocale string, ignoreArticles bool) *TitleSorter {
+	tag, err := language.Parse(sortLocale)
+	if err != nil {
+		tag = language.MustParse(DefaultSortLocale)
+	}
+	return &TitleSorter{
+		collator:       collate.New(tag, collate.IgnoreCase, collate.Numeric),
+		ignoreArticles: ignoreArticles,
+	}
+}
+
+// Key returns the string a title is sorted by, given the language the
+// title is written in
+func (s *TitleSorter) Key(title, lang string) string {
+	if s.ignoreArticles {
+		return StripArticle(title, lang)
+	}
+	return strings.TrimSpace(title)
+}
+
+// Compare orders two sort keys, returning -1, 0, or 1
+func (s *TitleSorter) Compare(a, b string) int {
+	return s.collator.CompareString(a, b)
+}
+
+// IndexLetter returns the letter a sort key is filed under in an A–Z index:
+// its first letter in upper case without accents, so "émile" is under "E",
+// or "#" if it doesn't start with a letter
+func IndexLetter(key string) string {
+	for _, r := range norm.NFD.String(strings.TrimSpace(key)) {
+		if !unicode.IsLetter(r) {
+			return "#"
+		}
+		return string(unicode.ToUpper(r))
+	}
+	return "#"
+}
+
+// nameSuffixes are generational and academic suffixes kept after the given
+// names when an author is put in "Last, First" form
+var nameSuffixes = map[string]bool{
+	"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "phd": true, "md": true,
+}
+
+// nameParticles are the prepositions and articles that can begin a surname
+var nameParticles = map[string]bool{
+	"de": true, "del": true, "della": true, "di": true, "da": true, "du": true, "des": true,
+	"la": true, "le": true, "van": true, "von": true, "der": true, "den": true, "ten": true, "ter": true,
+}
+
+// AuthorSort puts each author in "Last, First" form, so "J.R.R. Tolkien" and
+// "Tolkien, J.R.R." both become "Tolkien, J.R.R.". Multiple authors joined
+// with "&" or ";" are converted one by one and joined with " & ". Names
+// already containing a comma are only respaced.
+func AuthorSort(author string) string {
+	parts := strings.FieldsFunc(author, func(r rune) bool { return r == '&' || r == ';' })
+	var sorted []string
+	for _, name := range parts {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			sorted = append(sorted, nameSort(name))
+		}
+	}
+	return strings.Join(sorted, " & ")
+}
+
+// nameSort converts one author's name to "Last, First" form
+func nameSort(name string) string {
+	if last, first, ok := strings.Cut(name, ","); ok {
+		return strings.TrimSpace(last) + ", " + strings.TrimSpace(first)
+	}
+
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return name
+	}
+
+	lastIdx := len(fields) - 1
+	var suffix string
+	if len(fields) > 2 && nameSuffixes[strings.ToLower(strings.Trim(fields[lastIdx], "."))] {
+		suffix = " " + fields[lastIdx]
+		lastIdx--
+	}
+
+	// A capitalized particle is part of the surname ("Le Guin, Ursula K.");
+	// a lowercase one follows the given names ("Beethoven, Ludwig van")
+	surname := fields[lastIdx]
+	given := fields[:lastIdx]
+	if n := len(given); n > 1 && nameParticles[strings.ToLower(given[n-1])] && given[n-1] != strings.ToLower(given[n-1]) {
+		surname = given[n-1] + " " + surname
+		given = given[:n-1]
+	}
+	return surname + ", " + strings.Join(given, " ") + suffix
+}
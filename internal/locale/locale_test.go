@@ -0,0 +1,116 @@
+package locale
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"en":     "en",
+		"en-US":  "en",
+		"EN_gb":  "en",
+		"eng":    "en",
+		"ger":    "de",
+		" fra ":  "fr",
+		"":       "",
+		"tlh-XX": "tlh",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, Normalize(in), in)
+	}
+}
+
+func TestStripArticle(t *testing.T) {
+	tests := []struct {
+		title, lang, want string
+	}{
+		{"The Hobbit", "en", "Hobbit"},
+		{"The Hobbit", "", "Hobbit"},
+		{"An Unexpected Party", "en-GB", "Unexpected Party"},
+		{"Die Verwandlung", "de", "Verwandlung"},
+		{"Die Hard", "en", "Die Hard"},
+		{"Le Petit Prince", "fr", "Petit Prince"},
+		{"L'Étranger", "fr", "Étranger"},
+		{"El Aleph", "es", "Aleph"},
+		{"Theory of Everything", "en", "Theory of Everything"},
+		{"The", "en", "The"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, StripArticle(tt.title, tt.lang), tt.title)
+	}
+}
+
+func TestTitleSorter(t *testing.T) {
+	type book struct{ title, lang string }
+	books := []book{
+		{"The Hobbit", "en"},
+		{"Zebra", "en"},
+		{"Die Verwandlung", "de"},
+		{"Émile", "fr"},
+		{"apple", "en"},
+		{"Book 10", "en"},
+		{"Book 2", "en"},
+	}
+
+	s := NewTitleSorter("en", true)
+	sort.SliceStable(books, func(i, j int) bool {
+		return s.Compare(s.Key(books[i].title, books[i].lang), s.Key(books[j].title, books[j].lang)) < 0
+	})
+
+	var titles []string
+	for _, b := range books {
+		titles = append(titles, b.title)
+	}
+	assert.Equal(t, []string{"apple", "Book 2", "Book 10", "Émile", "The Hobbit", "Die Verwandlung", "Zebra"}, titles)
+
+	literal := NewTitleSorter("not a locale", false)
+	assert.Equal(t, "The Hobbit", literal.Key("The Hobbit", "en"))
+	assert.Negative(t, literal.Compare("The Hobbit", "Zebra"))
+}
+
+func TestDetect(t *testing.T) {
+	english := "It was the best of times, it was the worst of times, it was the age of wisdom, it was the age of foolishness, and the epoch of belief for all of us."
+	german := "Als Gregor Samsa eines Morgens aus unruhigen Träumen erwachte, fand er sich in seinem Bett zu einem ungeheueren Ungeziefer verwandelt. Er lag auf seinem panzerartig harten Rücken und sah, wenn er den Kopf ein wenig hob, seinen gewölbten Bauch, und die Bettdecke war nicht mehr."
+	french := "Aujourd'hui, maman est morte. Ou peut-être hier, je ne sais pas. J'ai reçu un télégramme de l'asile : « Mère décédée. Enterrement demain. » Cela ne veut rien dire, et je ne le sais pas, mais il est dans la chambre avec elle pour le soir."
+
+	assert.Equal(t, "en", Detect(english))
+	assert.Equal(t, "de", Detect(german))
+	assert.Equal(t, "fr", Detect(french))
+	assert.Equal(t, "", Detect("Too short to tell"))
+}
+
+func TestAuthorSort(t *testing.T) {
+	tests := map[string]string{
+		"J.R.R. Tolkien":                "Tolkien, J.R.R.",
+		"Tolkien, J.R.R.":               "Tolkien, J.R.R.",
+		"Tolkien,J.R.R.":                "Tolkien, J.R.R.",
+		"  Ursula   K. Le Guin ":        "Le Guin, Ursula K.",
+		"Ludwig van Beethoven":          "Beethoven, Ludwig van",
+		"Martin Luther King Jr.":        "King, Martin Luther Jr.",
+		"Plato":                         "Plato",
+		"Neil Gaiman & Terry Pratchett": "Gaiman, Neil & Pratchett, Terry",
+		"":                              "",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, AuthorSort(in), in)
+	}
+}
+
+func TestIndexLetter(t *testing.T) {
+	tests := map[string]string{
+		"Hobbit":   "H",
+		"zebra":    "Z",
+		" Émile":   "E",
+		"Ørsted":   "Ø",
+		"1984":     "#",
+		"'Salem's": "#",
+		"Война":    "В",
+		"":         "#",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, IndexLetter(in), in)
+	}
+}
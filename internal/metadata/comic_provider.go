@@ -39,3 +39,48 @@ type ComicProvider interface {
 	// GetIssueDetails retrieves full details for a specific issue by source ID
 	GetIssueDetails(ctx context.Context, sourceID string) (*ComicMetadata, error)
 }
+
+// LatestIssuesProvider is implemented by comic providers that can list a series' newest issues
+type LatestIssuesProvider interface {
+	// GetLatestIssues returns the most recent issues of a series, newest first
+	GetLatestIssues(ctx context.Context, series string) ([]ComicMetadata, error)
+}
+
+// SeriesMetadata represents a comic series (a ComicVine volume)
+type SeriesMetadata struct {
+	Name        string `json:"name"`
+	Publisher   string `json:"publisher,omitempty"`
+	StartYear   int    `json:"start_year,omitempty"`
+	TotalIssues int    `json:"total_issues,omitempty"`
+	Description string `json:"description,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty"`
+	Source      string `json:"source"`
+	SourceID    string `json:"source_id,omitempty"`
+}
+
+// SeriesProvider is implemented by comic providers that can look up a series
+type SeriesProvider interface {
+	// GetSeries returns the series best matching a name
+	GetSeries(ctx context.Context, series string) (*SeriesMetadata, error)
+}
+
+// StoryArcMetadata represents a story arc spanning issues of one or more
+// series, such as a crossover event
+type StoryArcMetadata struct {
+	Name        string          `json:"name"`
+	Publisher   string          `json:"publisher,omitempty"`
+	Description string          `json:"description,omitempty"`
+	IssueCount  int             `json:"issue_count,omitempty"`
+	Issues      []ComicMetadata `json:"issues,omitempty"` // In reading order; only filled in by GetStoryArc
+	Source      string          `json:"source"`
+	SourceID    string          `json:"source_id,omitempty"`
+}
+
+// StoryArcProvider is implemented by comic providers that know story arcs
+type StoryArcProvider interface {
+	// SearchStoryArcs searches for story arcs matching a name
+	SearchStoryArcs(ctx context.Context, name string) ([]StoryArcMetadata, error)
+
+	// GetStoryArc retrieves a story arc with its issues by source ID
+	GetStoryArc(ctx context.Context, sourceID string) (*StoryArcMetadata, error)
+}
@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"context"
+	"errors"
 	"strconv"
 	"strings"
 	"time"
@@ -22,45 +23,57 @@ func NewComicService(provider ComicProvider) *ComicService {
 }
 
 // LookupComic attempts to find metadata using series/issue or title
-// year is optional (0 means ignore) and used to filter/rank results
+// year is optional (0 means ignore) and used to filter/rank results.
+// It returns ErrRateLimited rather than ErrNoMatch when the provider turned
+// the lookup away, so callers can try again later.
 func (s *ComicService) LookupComic(ctx context.Context, series, issueNumber, title string, year int) (*ComicMetadata, error) {
-	s.rateLimit.Wait()
+	limited := false
+	search := func(fn func() ([]ComicMetadata, error)) []ComicMetadata {
+		if err := s.rateLimit.WaitContext(ctx); err != nil {
+			return nil
+		}
+		results, err := fn()
+		s.rateLimit.Record(err)
+		limited = limited || errors.Is(err, ErrRateLimited)
+		if err != nil {
+			return nil
+		}
+		return s.filterAndRankByYear(results, year)
+	}
 
 	// Try series + issue lookup first (most accurate for comics)
 	if series != "" {
-		results, err := s.provider.SearchBySeriesAndIssue(ctx, series, issueNumber)
-		if err == nil && len(results) > 0 {
-			results = s.filterAndRankByYear(results, year)
-			if len(results) > 0 {
-				return s.selectBestMatch(results, series, issueNumber), nil
-			}
+		results := search(func() ([]ComicMetadata, error) {
+			return s.provider.SearchBySeriesAndIssue(ctx, series, issueNumber)
+		})
+		if len(results) > 0 {
+			return s.selectBestMatch(results, series, issueNumber), nil
 		}
 	}
 
 	// Fall back to title search
 	if title != "" {
-		s.rateLimit.Wait()
-		results, err := s.provider.SearchByTitle(ctx, title)
-		if err == nil && len(results) > 0 {
-			results = s.filterAndRankByYear(results, year)
-			if len(results) > 0 {
-				return s.selectBestMatch(results, title, issueNumber), nil
-			}
+		results := search(func() ([]ComicMetadata, error) {
+			return s.provider.SearchByTitle(ctx, title)
+		})
+		if len(results) > 0 {
+			return s.selectBestMatch(results, title, issueNumber), nil
 		}
 	}
 
 	// If we have a series but no results, try searching by series as title
 	if series != "" && title == "" {
-		s.rateLimit.Wait()
-		results, err := s.provider.SearchByTitle(ctx, series)
-		if err == nil && len(results) > 0 {
-			results = s.filterAndRankByYear(results, year)
-			if len(results) > 0 {
-				return s.selectBestMatch(results, series, issueNumber), nil
-			}
+		results := search(func() ([]ComicMetadata, error) {
+			return s.provider.SearchByTitle(ctx, series)
+		})
+		if len(results) > 0 {
+			return s.selectBestMatch(results, series, issueNumber), nil
 		}
 	}
 
+	if limited {
+		return nil, ErrRateLimited
+	}
 	return nil, ErrNoMatch
 }
 
@@ -147,6 +160,47 @@ func (s *ComicService) SearchComics(ctx context.Context, series, issueNumber, ti
 	return s.rankResults(results, series, issueNumber), nil
 }
 
+// LatestIssues returns the newest issues of a series, if the provider supports it
+func (s *ComicService) LatestIssues(ctx context.Context, series string) ([]ComicMetadata, error) {
+	lp, ok := s.provider.(LatestIssuesProvider)
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	s.rateLimit.Wait()
+	return lp.GetLatestIssues(ctx, series)
+}
+
+// LookupSeries returns details of a series, if the provider supports it
+func (s *ComicService) LookupSeries(ctx context.Context, series string) (*SeriesMetadata, error) {
+	sp, ok := s.provider.(SeriesProvider)
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	s.rateLimit.Wait()
+	return sp.GetSeries(ctx, series)
+}
+
+// SearchStoryArcs searches for story arcs, if the provider supports them
+func (s *ComicService) SearchStoryArcs(ctx context.Context, name string) ([]StoryArcMetadata, error) {
+	ap, ok := s.provider.(StoryArcProvider)
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	s.rateLimit.Wait()
+	return ap.SearchStoryArcs(ctx, name)
+}
+
+// GetStoryArc retrieves a story arc with its issues, if the provider
+// supports them
+func (s *ComicService) GetStoryArc(ctx context.Context, sourceID string) (*StoryArcMetadata, error) {
+	ap, ok := s.provider.(StoryArcProvider)
+	if !ok {
+		return nil, ErrNoMatch
+	}
+	s.rateLimit.Wait()
+	return ap.GetStoryArc(ctx, sourceID)
+}
+
 // GetIssueDetails retrieves full details for a specific issue
 func (s *ComicService) GetIssueDetails(ctx context.Context, sourceID string) (*ComicMetadata, error) {
 	s.rateLimit.Wait()
@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -103,6 +105,28 @@ type cvVolumeData struct {
 	CountOfIssues int     `json:"count_of_issues"`
 }
 
+type cvStoryArcSearchResponse struct {
+	Error      string           `json:"error"`
+	StatusCode int              `json:"status_code"`
+	Results    []cvStoryArcData `json:"results"`
+}
+
+type cvStoryArcResponse struct {
+	Error      string         `json:"error"`
+	StatusCode int            `json:"status_code"`
+	Results    cvStoryArcData `json:"results"`
+}
+
+type cvStoryArcData struct {
+	ID          int           `json:"id"`
+	Name        string        `json:"name"`
+	Deck        string        `json:"deck"`
+	Description string        `json:"description"`
+	Publisher   cvPublisher   `json:"publisher"`
+	IssueCount  int           `json:"count_of_isssue_appearances"` // Misspelled by ComicVine
+	Issues      []cvVolumeRef `json:"issues"`
+}
+
 type cvVolumeRef struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
@@ -281,6 +305,246 @@ func (p *ComicVineProvider) GetIssueDetails(ctx context.Context, sourceID string
 	return &meta, nil
 }
 
+// GetLatestIssues returns the newest issues of the best matching volume
+func (p *ComicVineProvider) GetLatestIssues(ctx context.Context, series string) ([]ComicMetadata, error) {
+	if !p.IsConfigured() {
+		return nil, fmt.Errorf("ComicVine API key not configured")
+	}
+
+	volumes, err := p.searchVolumes(ctx, series)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	// Prefer an exact name match, otherwise take the top search result
+	vol := volumes[0]
+	for _, v := range volumes {
+		if strings.EqualFold(v.Name, series) {
+			vol = v
+			break
+		}
+	}
+
+	params := url.Values{}
+	params.Set("api_key", p.apiKey)
+	params.Set("format", "json")
+	params.Set("filter", fmt.Sprintf("volume:%d", vol.ID))
+	params.Set("sort", "cover_date:desc")
+	params.Set("limit", "10")
+	params.Set("field_list", "id,name,issue_number,description,cover_date,image,volume")
+
+	issuesURL := fmt.Sprintf("%s/issues/?%s", p.baseURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", issuesURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Webby/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, ErrRateLimited
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	var data cvSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if len(data.Results) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	var results []ComicMetadata
+	for _, issue := range data.Results {
+		meta := p.convertIssueToMetadata(&issue, &vol)
+		meta.Confidence = 1.0
+		results = append(results, meta)
+	}
+	return results, nil
+}
+
+// GetSeries returns the volume best matching a series name
+func (p *ComicVineProvider) GetSeries(ctx context.Context, series string) (*SeriesMetadata, error) {
+	if !p.IsConfigured() {
+		return nil, fmt.Errorf("ComicVine API key not configured")
+	}
+
+	volumes, err := p.searchVolumes(ctx, series)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	// Prefer an exact name match, otherwise take the top search result
+	vol := volumes[0]
+	for _, v := range volumes {
+		if strings.EqualFold(v.Name, series) {
+			vol = v
+			break
+		}
+	}
+
+	meta := &SeriesMetadata{
+		Name:        vol.Name,
+		Publisher:   vol.Publisher.Name,
+		TotalIssues: vol.CountOfIssues,
+		Description: stripHTML(vol.Description),
+		CoverURL:    vol.Image.MediumURL,
+		Source:      p.Name(),
+		SourceID:    fmt.Sprintf("%d", vol.ID),
+	}
+	if year, err := strconv.Atoi(strings.TrimSpace(vol.StartYear)); err == nil {
+		meta.StartYear = year
+	}
+	return meta, nil
+}
+
+// SearchStoryArcs searches for story arcs matching a name
+func (p *ComicVineProvider) SearchStoryArcs(ctx context.Context, name string) ([]StoryArcMetadata, error) {
+	if !p.IsConfigured() {
+		return nil, fmt.Errorf("ComicVine API key not configured")
+	}
+
+	params := url.Values{}
+	params.Set("api_key", p.apiKey)
+	params.Set("format", "json")
+	params.Set("resources", "story_arc")
+	params.Set("query", name)
+	params.Set("limit", "10")
+	params.Set("field_list", "id,name,deck,publisher,count_of_isssue_appearances")
+
+	var data cvStoryArcSearchResponse
+	if err := p.getJSON(ctx, fmt.Sprintf("%s/search/?%s", p.baseURL, params.Encode()), &data); err != nil {
+		return nil, err
+	}
+	if data.StatusCode != 1 {
+		return nil, fmt.Errorf("API error: %s", data.Error)
+	}
+	if len(data.Results) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	results := make([]StoryArcMetadata, 0, len(data.Results))
+	for _, arc := range data.Results {
+		results = append(results, p.convertStoryArc(&arc))
+	}
+	return results, nil
+}
+
+// GetStoryArc retrieves a story arc with its issues, ordered by cover date
+func (p *ComicVineProvider) GetStoryArc(ctx context.Context, sourceID string) (*StoryArcMetadata, error) {
+	if !p.IsConfigured() {
+		return nil, fmt.Errorf("ComicVine API key not configured")
+	}
+
+	params := url.Values{}
+	params.Set("api_key", p.apiKey)
+	params.Set("format", "json")
+	params.Set("field_list", "id,name,deck,description,publisher,count_of_isssue_appearances,issues")
+
+	var data cvStoryArcResponse
+	if err := p.getJSON(ctx, fmt.Sprintf("%s/story_arc/4045-%s/?%s", p.baseURL, sourceID, params.Encode()), &data); err != nil {
+		return nil, err
+	}
+	if data.StatusCode != 1 {
+		return nil, fmt.Errorf("API error: %s", data.Error)
+	}
+
+	arc := p.convertStoryArc(&data.Results)
+
+	// The arc only lists its issues' IDs, so fetch their series and numbers
+	// in batches of the API's page size
+	const batchSize = 100
+	issues := data.Results.Issues
+	for start := 0; start < len(issues); start += batchSize {
+		end := start + batchSize
+		if end > len(issues) {
+			end = len(issues)
+		}
+		ids := make([]string, 0, end-start)
+		for _, issue := range issues[start:end] {
+			ids = append(ids, strconv.Itoa(issue.ID))
+		}
+
+		params := url.Values{}
+		params.Set("api_key", p.apiKey)
+		params.Set("format", "json")
+		params.Set("filter", "id:"+strings.Join(ids, "|"))
+		params.Set("limit", strconv.Itoa(batchSize))
+		params.Set("field_list", "id,name,issue_number,cover_date,store_date,image,volume")
+
+		var batch cvSearchResponse
+		if err := p.getJSON(ctx, fmt.Sprintf("%s/issues/?%s", p.baseURL, params.Encode()), &batch); err != nil {
+			return nil, err
+		}
+		for _, issue := range batch.Results {
+			arc.Issues = append(arc.Issues, p.convertIssueToMetadata(&issue, nil))
+		}
+	}
+
+	// Events are read in publication order
+	sort.SliceStable(arc.Issues, func(i, j int) bool {
+		return arc.Issues[i].ReleaseDate < arc.Issues[j].ReleaseDate
+	})
+	return &arc, nil
+}
+
+// getJSON fetches a ComicVine API URL and decodes its JSON response
+func (p *ComicVineProvider) getJSON(ctx context.Context, apiURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Webby/1.0")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return ErrRateLimited
+	}
+	if resp.StatusCode == 404 {
+		return ErrNoMatch
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// convertStoryArc converts ComicVine story arc data to our metadata format
+func (p *ComicVineProvider) convertStoryArc(arc *cvStoryArcData) StoryArcMetadata {
+	meta := StoryArcMetadata{
+		Name:        arc.Name,
+		Publisher:   arc.Publisher.Name,
+		Description: strings.TrimSpace(arc.Deck),
+		IssueCount:  arc.IssueCount,
+		Source:      p.Name(),
+		SourceID:    fmt.Sprintf("%d", arc.ID),
+	}
+	if meta.Description == "" && arc.Description != "" {
+		meta.Description = stripHTML(arc.Description)
+	}
+	return meta
+}
+
 // searchVolumes searches for comic volumes (series)
 func (p *ComicVineProvider) searchVolumes(ctx context.Context, name string) ([]cvVolumeData, error) {
 	params := url.Values{}
@@ -0,0 +1,158 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultPluginTimeout is how long a plugin gets to answer a request
+const DefaultPluginTimeout = 10 * time.Second
+
+// maxPluginOutput is the most a plugin may write to stdout
+const maxPluginOutput = 4 << 20
+
+// PluginRequest is the JSON a plugin reads from stdin: an ISBN lookup, or a
+// search by title and optional author
+type PluginRequest struct {
+	Action string `json:"action"` // "isbn" or "search"
+	ISBN   string `json:"isbn,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+}
+
+// Plugin request actions
+const (
+	PluginActionISBN   = "isbn"
+	PluginActionSearch = "search"
+)
+
+// PluginResponse is the JSON a plugin writes to stdout. No results means
+// no match; an error of "rate_limited" or "no_match" maps to ErrRateLimited
+// or ErrNoMatch, and any other error to ErrProviderDown.
+type PluginResponse struct {
+	Results []BookMetadata `json:"results"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// ExecProvider is a metadata provider run as an external program, letting
+// operators add sources webby doesn't know about. Each request starts the
+// program, writes a PluginRequest to its stdin and reads a PluginResponse
+// from its stdout; a program that exits non-zero or runs past the timeout
+// counts as the provider being down.
+type ExecProvider struct {
+	name    string
+	command string
+	timeout time.Duration
+}
+
+// NewExecProvider creates a provider named name that runs command, which
+// is given timeout to answer each request
+func NewExecProvider(name, command string, timeout time.Duration) *ExecProvider {
+	if timeout <= 0 {
+		timeout = DefaultPluginTimeout
+	}
+	return &ExecProvider{name: name, command: command, timeout: timeout}
+}
+
+// Name returns the provider identifier
+func (p *ExecProvider) Name() string {
+	return p.name
+}
+
+// LookupByISBN asks the plugin for the book with an ISBN
+func (p *ExecProvider) LookupByISBN(ctx context.Context, isbn string) (*BookMetadata, error) {
+	results, err := p.run(ctx, PluginRequest{Action: PluginActionISBN, ISBN: isbn})
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// Search asks the plugin for books matching title and author
+func (p *ExecProvider) Search(ctx context.Context, title, author string) ([]BookMetadata, error) {
+	return p.run(ctx, PluginRequest{Action: PluginActionSearch, Title: title, Author: author})
+}
+
+// GetCoverURL returns no URL; plugins give covers in their results
+func (p *ExecProvider) GetCoverURL(isbn string, size CoverSize) string {
+	return ""
+}
+
+// run sends req to the plugin and returns its results, with the plugin's
+// name as their source where it gave none
+func (p *ExecProvider) run(ctx context.Context, req PluginRequest) ([]BookMetadata, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: maxPluginOutput}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: 4096, truncate: true}
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%w: plugin %s timed out after %s", ErrProviderDown, p.name, p.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("%w: plugin %s failed: %v", ErrProviderDown, p.name, err)
+	}
+
+	var resp PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("%w: plugin %s wrote invalid JSON: %v", ErrProviderDown, p.name, err)
+	}
+	switch resp.Error {
+	case "":
+	case "no_match":
+		return nil, ErrNoMatch
+	case "rate_limited":
+		return nil, ErrRateLimited
+	default:
+		return nil, fmt.Errorf("%w: plugin %s: %s", ErrProviderDown, p.name, resp.Error)
+	}
+	if len(resp.Results) == 0 {
+		return nil, ErrNoMatch
+	}
+	for i := range resp.Results {
+		if resp.Results[i].Source == "" {
+			resp.Results[i].Source = p.name
+		}
+	}
+	return resp.Results, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it, so a runaway
+// plugin can't fill memory. Writes past the limit fail, or are dropped if
+// truncate is set.
+type limitedBuffer struct {
+	buf      *bytes.Buffer
+	limit    int
+	truncate bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		if !b.truncate {
+			return 0, fmt.Errorf("output over %d bytes", b.limit)
+		}
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
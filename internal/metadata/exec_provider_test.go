@@ -0,0 +1,102 @@
+package metadata
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePlugin writes a shell script plugin to a temporary directory and
+// returns its path
+func writePlugin(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts need a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755))
+	return path
+}
+
+func TestExecProviderLookup(t *testing.T) {
+	// Saves each request next to itself, so the test sees what it was sent
+	path := writePlugin(t, `cat > "$0.request"
+echo '{"results":[{"title":"Dune","authors":["Frank Herbert"]}]}'
+`)
+	sent := func() string {
+		data, err := os.ReadFile(path + ".request")
+		require.NoError(t, err)
+		return string(data)
+	}
+	p := NewExecProvider("local", path, time.Second)
+
+	result, err := p.LookupByISBN(context.Background(), "9780441013593")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"action":"isbn","isbn":"9780441013593"}`, sent())
+	assert.Equal(t, "Dune", result.Title)
+	assert.Equal(t, []string{"Frank Herbert"}, result.Authors)
+	assert.Equal(t, "local", result.Source, "results without a source are the plugin's")
+
+	results, err := p.Search(context.Background(), "Dune", "Herbert")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.JSONEq(t, `{"action":"search","title":"Dune","author":"Herbert"}`, sent())
+}
+
+func TestExecProviderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   error
+	}{
+		{"no results", `echo '{"results":[]}'`, ErrNoMatch},
+		{"no match", `echo '{"error":"no_match"}'`, ErrNoMatch},
+		{"rate limited", `echo '{"error":"rate_limited"}'`, ErrRateLimited},
+		{"other error", `echo '{"error":"site changed its layout"}'`, ErrProviderDown},
+		{"invalid JSON", `echo 'not json'`, ErrProviderDown},
+		{"non-zero exit", `echo 'broken' >&2; exit 3`, ErrProviderDown},
+		{"timeout", `sleep 5`, ErrProviderDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewExecProvider("local", writePlugin(t, tt.script), 200*time.Millisecond)
+			start := time.Now()
+			_, err := p.Search(context.Background(), "Dune", "")
+			assert.ErrorIs(t, err, tt.want)
+			assert.Less(t, time.Since(start), 3*time.Second)
+		})
+	}
+}
+
+func TestServiceUsing(t *testing.T) {
+	primary := &MockProvider{name: "primary", lookupResult: &BookMetadata{Title: "From Primary"}}
+	plugin := &MockProvider{name: "plugin", lookupResult: &BookMetadata{Title: "From Plugin"}}
+	service := NewService(primary, nil)
+	service.AddPlugin(plugin)
+
+	assert.Equal(t, []string{"primary", "plugin"}, service.ProviderNames())
+
+	result, err := service.LookupBook(context.Background(), "123", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "From Primary", result.Title, "plugins aren't used unless asked for")
+
+	using, ok := service.Using("plugin")
+	require.True(t, ok)
+	result, err = using.LookupBook(context.Background(), "123", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "From Plugin", result.Title)
+
+	using, ok = service.Using("")
+	assert.True(t, ok)
+	assert.Same(t, service, using)
+
+	_, ok = service.Using("missing")
+	assert.False(t, ok)
+}
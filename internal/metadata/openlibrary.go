@@ -114,6 +114,20 @@ func (p *OpenLibraryProvider) Search(ctx context.Context, title, author string)
 		params.Set("author", author)
 	}
 	params.Set("limit", "5")
+	return p.search(ctx, params)
+}
+
+// SearchByAuthor returns an author's books, newest first
+func (p *OpenLibraryProvider) SearchByAuthor(ctx context.Context, author string) ([]BookMetadata, error) {
+	params := url.Values{}
+	params.Set("author", author)
+	params.Set("sort", "new")
+	params.Set("limit", "10")
+	return p.search(ctx, params)
+}
+
+// search runs a query against the search API and converts the results
+func (p *OpenLibraryProvider) search(ctx context.Context, params url.Values) ([]BookMetadata, error) {
 	params.Set("fields", "key,title,author_name,publisher,first_publish_year,isbn,cover_i,subject")
 
 	searchURL := fmt.Sprintf("%s/search.json?%s", p.baseURL, params.Encode())
@@ -52,3 +52,9 @@ type Provider interface {
 	// GetCoverURL returns URL for book cover image
 	GetCoverURL(isbn string, size CoverSize) string
 }
+
+// AuthorProvider is implemented by providers that can list books by an author
+type AuthorProvider interface {
+	// SearchByAuthor returns an author's books, newest first
+	SearchByAuthor(ctx context.Context, author string) ([]BookMetadata, error)
+}
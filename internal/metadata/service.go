@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"sync"
 	"time"
@@ -10,72 +11,159 @@ import (
 
 // Service orchestrates metadata lookups across providers
 type Service struct {
-	primary   Provider
-	fallback  Provider
-	rateLimit *RateLimiter
+	primary  Provider
+	fallback Provider
+	plugins  []Provider              // Chosen by name, never tried otherwise
+	limits   map[string]*RateLimiter // Keyed by provider name
 }
 
-// NewService creates a metadata service with primary and fallback providers
+// providerIntervals is the minimum time between calls to each provider,
+// for those that ask for more than defaultInterval
+var providerIntervals = map[string]time.Duration{}
+
+// defaultInterval is the minimum time between calls to a provider
+const defaultInterval = 500 * time.Millisecond
+
+// NewService creates a metadata service with primary and fallback providers.
+// Each provider is rate limited separately, so a slow fallback doesn't hold
+// up the primary.
 func NewService(primary, fallback Provider) *Service {
-	return &Service{
-		primary:   primary,
-		fallback:  fallback,
-		rateLimit: NewRateLimiter(500 * time.Millisecond),
+	s := &Service{
+		primary:  primary,
+		fallback: fallback,
+		limits:   make(map[string]*RateLimiter),
+	}
+	for _, p := range []Provider{primary, fallback} {
+		if p != nil {
+			s.addLimit(p)
+		}
+	}
+	return s
+}
+
+// addLimit sets up provider p's rate limit
+func (s *Service) addLimit(p Provider) {
+	interval, ok := providerIntervals[p.Name()]
+	if !ok {
+		interval = defaultInterval
+	}
+	s.limits[p.Name()] = NewRateLimiter(interval)
+}
+
+// AddPlugin registers a provider that lookups use only when it's asked for
+// by name, such as an ExecProvider. Plugins are added before the service is
+// used.
+func (s *Service) AddPlugin(p Provider) {
+	s.plugins = append(s.plugins, p)
+	s.addLimit(p)
+}
+
+// ProviderNames lists the providers that can be asked for by name: the
+// primary, the fallback if there is one, and the plugins
+func (s *Service) ProviderNames() []string {
+	var names []string
+	for _, p := range append(s.providers(), s.plugins...) {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Using returns a service that looks books up only with the provider
+// named name, or the service itself if name is empty. It reports false if
+// there is no such provider.
+func (s *Service) Using(name string) (*Service, bool) {
+	if name == "" {
+		return s, true
+	}
+	for _, p := range append(s.providers(), s.plugins...) {
+		if p.Name() == name {
+			return &Service{primary: p, limits: s.limits}, true
+		}
+	}
+	return nil, false
+}
+
+// call runs fn once provider p's rate limit allows, backing p off while it
+// answers with 429s
+func (s *Service) call(ctx context.Context, p Provider, fn func() error) error {
+	limit := s.limits[p.Name()]
+	if err := limit.WaitContext(ctx); err != nil {
+		return err
+	}
+	err := fn()
+	limit.Record(err)
+	return err
+}
+
+// lookupISBN looks an ISBN up with provider p
+func (s *Service) lookupISBN(ctx context.Context, p Provider, isbn string) (*BookMetadata, error) {
+	var result *BookMetadata
+	err := s.call(ctx, p, func() (err error) {
+		result, err = p.LookupByISBN(ctx, isbn)
+		return err
+	})
+	return result, err
+}
+
+// search searches provider p by title and author
+func (s *Service) search(ctx context.Context, p Provider, title, author string) ([]BookMetadata, error) {
+	var results []BookMetadata
+	err := s.call(ctx, p, func() (err error) {
+		results, err = p.Search(ctx, title, author)
+		return err
+	})
+	return results, err
+}
+
+// providers returns the primary provider and the fallback, if there is one
+func (s *Service) providers() []Provider {
+	if s.fallback == nil {
+		return []Provider{s.primary}
 	}
+	return []Provider{s.primary, s.fallback}
 }
 
-// LookupBook attempts to find metadata using ISBN first, then title/author
+// LookupBook attempts to find metadata using ISBN first, then title/author.
+// It returns ErrRateLimited rather than ErrNoMatch when a provider turned
+// the lookup away, so callers can try again later.
 func (s *Service) LookupBook(ctx context.Context, isbn, title, author string) (*BookMetadata, error) {
-	s.rateLimit.Wait()
+	limited := false
 
-	// Try ISBN lookup first (most accurate)
+	// Try ISBN lookup first (most accurate), then the fallback
 	if isbn != "" {
-		if result, err := s.primary.LookupByISBN(ctx, isbn); err == nil && result != nil {
-			result.Confidence = 1.0 // Exact ISBN match
-			return result, nil
-		}
-		// Try fallback
-		if s.fallback != nil {
-			s.rateLimit.Wait()
-			if result, err := s.fallback.LookupByISBN(ctx, isbn); err == nil && result != nil {
-				result.Confidence = 1.0
+		for _, p := range s.providers() {
+			result, err := s.lookupISBN(ctx, p, isbn)
+			if err == nil && result != nil {
+				result.Confidence = 1.0 // Exact ISBN match
 				return result, nil
 			}
+			limited = limited || errors.Is(err, ErrRateLimited)
 		}
 	}
 
 	// Fall back to title/author search
 	if title != "" {
-		results, err := s.primary.Search(ctx, title, author)
-		if err == nil && len(results) > 0 {
-			return s.selectBestMatch(results, title, author), nil
-		}
-		// Try fallback
-		if s.fallback != nil {
-			s.rateLimit.Wait()
-			results, err = s.fallback.Search(ctx, title, author)
+		for _, p := range s.providers() {
+			results, err := s.search(ctx, p, title, author)
 			if err == nil && len(results) > 0 {
 				return s.selectBestMatch(results, title, author), nil
 			}
+			limited = limited || errors.Is(err, ErrRateLimited)
 		}
 	}
 
+	if limited {
+		return nil, ErrRateLimited
+	}
 	return nil, ErrNoMatch
 }
 
 // SearchBooks searches for metadata and returns all results with confidence scores
 func (s *Service) SearchBooks(ctx context.Context, isbn, title, author string) ([]BookMetadata, error) {
-	s.rateLimit.Wait()
-
 	// Try ISBN lookup first (most accurate) - returns single result
 	if isbn != "" {
-		if result, err := s.primary.LookupByISBN(ctx, isbn); err == nil && result != nil {
-			result.Confidence = 1.0
-			return []BookMetadata{*result}, nil
-		}
-		if s.fallback != nil {
-			s.rateLimit.Wait()
-			if result, err := s.fallback.LookupByISBN(ctx, isbn); err == nil && result != nil {
+		for _, p := range s.providers() {
+			if result, err := s.lookupISBN(ctx, p, isbn); err == nil && result != nil {
 				result.Confidence = 1.0
 				return []BookMetadata{*result}, nil
 			}
@@ -84,13 +172,8 @@ func (s *Service) SearchBooks(ctx context.Context, isbn, title, author string) (
 
 	// Search by title/author and return all results
 	if title != "" {
-		results, err := s.primary.Search(ctx, title, author)
-		if err == nil && len(results) > 0 {
-			return s.rankResults(results, title, author), nil
-		}
-		if s.fallback != nil {
-			s.rateLimit.Wait()
-			results, err = s.fallback.Search(ctx, title, author)
+		for _, p := range s.providers() {
+			results, err := s.search(ctx, p, title, author)
 			if err == nil && len(results) > 0 {
 				return s.rankResults(results, title, author), nil
 			}
@@ -100,6 +183,26 @@ func (s *Service) SearchBooks(ctx context.Context, isbn, title, author string) (
 	return nil, ErrNoMatch
 }
 
+// SearchByAuthor lists an author's books, newest first, using whichever
+// provider supports author searches
+func (s *Service) SearchByAuthor(ctx context.Context, author string) ([]BookMetadata, error) {
+	for _, p := range s.providers() {
+		ap, ok := p.(AuthorProvider)
+		if !ok {
+			continue
+		}
+		var results []BookMetadata
+		err := s.call(ctx, p, func() (err error) {
+			results, err = ap.SearchByAuthor(ctx, author)
+			return err
+		})
+		if err == nil && len(results) > 0 {
+			return results, nil
+		}
+	}
+	return nil, ErrNoMatch
+}
+
 // rankResults calculates confidence scores for all results and sorts by confidence
 func (s *Service) rankResults(results []BookMetadata, title, author string) []BookMetadata {
 	for i := range results {
@@ -209,28 +312,71 @@ func stringSimilarity(a, b string) float64 {
 	return float64(matches) / float64(total)
 }
 
-// RateLimiter provides simple rate limiting
+// Backoff bounds for a provider answering 429s: the first adds
+// minBackoff between calls, each one after doubles it up to maxBackoff
+const (
+	minBackoff = 2 * time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// RateLimiter spaces out calls to a provider, and backs off exponentially
+// while the provider reports it's being called too often
 type RateLimiter struct {
-	mu       sync.Mutex
-	interval time.Duration
-	lastCall time.Time
+	mu         sync.Mutex
+	interval   time.Duration
+	lastCall   time.Time
+	backoff    time.Duration // Added to interval after 429s, zero otherwise
+	minBackoff time.Duration
 }
 
 // NewRateLimiter creates a rate limiter with the given minimum interval
 func NewRateLimiter(interval time.Duration) *RateLimiter {
 	return &RateLimiter{
-		interval: interval,
+		interval:   interval,
+		minBackoff: minBackoff,
 	}
 }
 
 // Wait blocks until it's safe to make another request
 func (r *RateLimiter) Wait() {
+	r.WaitContext(context.Background())
+}
+
+// WaitContext blocks until it's safe to make another request, or ctx is
+// done
+func (r *RateLimiter) WaitContext(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	since := time.Since(r.lastCall)
-	if since < r.interval {
-		time.Sleep(r.interval - since)
+	if delay := r.interval + r.backoff - time.Since(r.lastCall); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 	r.lastCall = time.Now()
+	return nil
+}
+
+// Record notes the outcome of a call: ErrRateLimited doubles the backoff,
+// and anything else, even a failed lookup, shows the provider is answering
+// again and clears it
+func (r *RateLimiter) Record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !errors.Is(err, ErrRateLimited) {
+		r.backoff = 0
+		return
+	}
+	r.backoff *= 2
+	if r.backoff < r.minBackoff {
+		r.backoff = r.minBackoff
+	}
+	if r.backoff > maxBackoff {
+		r.backoff = maxBackoff
+	}
 }
@@ -3,6 +3,7 @@ package metadata
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -116,13 +117,19 @@ func TestCalculateConfidence(t *testing.T) {
 
 // MockProvider implements Provider interface for testing
 type MockProvider struct {
+	name         string // "mock" if empty
 	lookupResult *BookMetadata
 	lookupErr    error
 	searchResult []BookMetadata
 	searchErr    error
 }
 
-func (m *MockProvider) Name() string { return "mock" }
+func (m *MockProvider) Name() string {
+	if m.name == "" {
+		return "mock"
+	}
+	return m.name
+}
 
 func (m *MockProvider) LookupByISBN(ctx context.Context, isbn string) (*BookMetadata, error) {
 	return m.lookupResult, m.lookupErr
@@ -216,3 +223,39 @@ func TestRateLimiter(t *testing.T) {
 		limiter.Wait()
 	}
 }
+
+func TestRateLimiterBackoff(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	limiter.minBackoff = time.Millisecond
+
+	for _, want := range []time.Duration{1, 2, 4} {
+		limiter.Record(ErrRateLimited)
+		assert.Equal(t, want*time.Millisecond, limiter.backoff)
+	}
+	limiter.Record(ErrNoMatch)
+	assert.Zero(t, limiter.backoff, "any answer but a 429 clears the backoff")
+
+	for i := 0; i < 30; i++ {
+		limiter.Record(ErrRateLimited)
+	}
+	assert.Equal(t, maxBackoff, limiter.backoff)
+
+	limiter.lastCall = time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.WaitContext(ctx), context.Canceled, "a backed-off wait gives up with its caller")
+}
+
+func TestLookupBookRateLimited(t *testing.T) {
+	primary := &MockProvider{lookupErr: ErrRateLimited}
+	service := NewService(primary, nil)
+
+	_, err := service.LookupBook(context.Background(), "9780441013593", "", "")
+	assert.ErrorIs(t, err, ErrRateLimited, "a 429 isn't reported as no match")
+	assert.Equal(t, minBackoff, service.limits["mock"].backoff)
+
+	primary.lookupErr = ErrNoMatch
+	service.limits["mock"].backoff = 0
+	_, err = service.LookupBook(context.Background(), "9780441013593", "", "")
+	assert.ErrorIs(t, err, ErrNoMatch)
+}
@@ -0,0 +1,151 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// KeyHeader names the header a server sends its sync key for the other
+// server in
+const KeyHeader = "X-Sync-Key"
+
+// PushRequest is what a source sends a destination to sync to it
+type PushRequest struct {
+	Manifest     Manifest `json:"manifest"`
+	ConflictRule string   `json:"conflict_rule"`
+	IncludeFiles bool     `json:"include_files"`
+}
+
+// PushResponse is how a push went on the destination, and the books whose
+// files it wants uploaded before they can be added
+type PushResponse struct {
+	Result    models.MirrorResult `json:"result"`
+	NeedFiles []string            `json:"need_files"`
+}
+
+// Client talks to the mirror endpoints of another Webby server
+type Client struct {
+	base string
+	key  string
+	http *http.Client
+}
+
+// NewClient creates a client for the server at base, its URL including any
+// path it's served under, authenticating with key. Requests run until
+// their context ends, since book files can take a while to copy.
+func NewClient(base, key string) *Client {
+	return &Client{base: strings.TrimRight(base, "/"), key: key, http: &http.Client{}}
+}
+
+// Manifest asks the server for the collections with the given names
+func (c *Client) Manifest(ctx context.Context, collections []string) (*Manifest, error) {
+	query := url.Values{"collection": collections}
+	resp, err := c.do(ctx, http.MethodGet, "/api/mirror/manifest?"+query.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Push sends the server a manifest to sync into its library
+func (c *Client) Push(ctx context.Context, req PushRequest) (*PushResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/api/mirror/push", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var pushed PushResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pushed); err != nil {
+		return nil, fmt.Errorf("reading push result: %w", err)
+	}
+	return &pushed, nil
+}
+
+// DownloadFile requests the file of a book on the server. The caller
+// closes the response body.
+func (c *Client) DownloadFile(ctx context.Context, bookID string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, "/api/mirror/books/"+url.PathEscape(bookID)+"/file", "", nil)
+}
+
+// UploadFile sends the server the file of a book it asked for in a push,
+// read from r and named filename, with the book's metadata
+func (c *Client) UploadFile(ctx context.Context, book Book, filename string, r io.Reader) error {
+	meta, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+
+	// The form is streamed so large files aren't held in memory
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		err := form.WriteField("book", string(meta))
+		if err == nil {
+			var part io.Writer
+			if part, err = form.CreateFormFile("file", filename); err == nil {
+				if _, err = io.Copy(part, r); err == nil {
+					err = form.Close()
+				}
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := c.do(ctx, http.MethodPost, "/api/mirror/books/"+url.PathEscape(book.ID)+"/file", form.FormDataContentType(), pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a request to the server with the sync key, returning an error
+// with the server's message for anything but a 2xx response
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Webby")
+	req.Header.Set(KeyHeader, c.key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure) == nil && failure.Error != "" {
+			return nil, fmt.Errorf("%s answered %s: %s", req.URL.Host, resp.Status, failure.Error)
+		}
+		return nil, fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return resp, nil
+}
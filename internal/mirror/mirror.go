@@ -0,0 +1,154 @@
+// Package mirror replicates collections between two Webby servers. The
+// server being read from, the source, describes the books in the
+// collections it's asked for in a manifest; the destination matches them
+// to its own books, keeps their metadata in step, and optionally copies
+// their files. Books are matched by the source's ID, remembered once
+// they're first synced, so each side keeps its own IDs.
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// Manifest is what a source sends of the collections it was asked for
+type Manifest struct {
+	Collections []Collection `json:"collections"`
+	Books       []Book       `json:"books"`
+}
+
+// Collection is a collection by name, listing its books by the source's IDs.
+// Smart collections are sent as the books they hold at the time.
+type Collection struct {
+	Name    string   `json:"name"`
+	BookIDs []string `json:"book_ids"`
+}
+
+// Book is a book as a source describes it: the metadata that's kept in
+// step, and what's needed to fetch and match its file
+type Book struct {
+	ID              string     `json:"id"`
+	Title           string     `json:"title"`
+	Author          string     `json:"author"`
+	Series          string     `json:"series,omitempty"`
+	SeriesIndex     float64    `json:"series_index,omitempty"`
+	ISBN            string     `json:"isbn,omitempty"`
+	Publisher       string     `json:"publisher,omitempty"`
+	PublishDate     string     `json:"publish_date,omitempty"`
+	Description     string     `json:"description,omitempty"`
+	Language        string     `json:"language,omitempty"`
+	Subjects        string     `json:"subjects,omitempty"`
+	MetadataSource  string     `json:"metadata_source,omitempty"`
+	MetadataUpdated *time.Time `json:"metadata_updated,omitempty"`
+	ContentType     string     `json:"content_type"`
+	ContentSource   string     `json:"content_source"`
+	FileFormat      string     `json:"file_format,omitempty"`
+	FileSize        int64      `json:"file_size,omitempty"`
+	FileHash        string     `json:"file_hash,omitempty"`
+}
+
+// FromBook describes a library book for a manifest
+func FromBook(b *models.Book) Book {
+	return Book{
+		ID:              b.ID,
+		Title:           b.Title,
+		Author:          b.Author,
+		Series:          b.Series,
+		SeriesIndex:     b.SeriesIndex,
+		ISBN:            b.ISBN,
+		Publisher:       b.Publisher,
+		PublishDate:     b.PublishDate,
+		Description:     b.Description,
+		Language:        b.Language,
+		Subjects:        b.Subjects,
+		MetadataSource:  b.MetadataSource,
+		MetadataUpdated: b.MetadataUpdated,
+		ContentType:     b.ContentType,
+		ContentSource:   b.ContentSource,
+		FileFormat:      b.FileFormat,
+		FileSize:        b.FileSize,
+		FileHash:        b.FileHash,
+	}
+}
+
+// ApplyTo copies the book's metadata onto a library book. Its metadata
+// source and time are kept, so a later sync compares when each side was
+// really edited.
+func (b Book) ApplyTo(book *models.Book) {
+	book.Title = b.Title
+	book.Author = b.Author
+	book.Series = b.Series
+	book.SeriesIndex = b.SeriesIndex
+	book.ISBN = b.ISBN
+	book.Publisher = b.Publisher
+	book.PublishDate = b.PublishDate
+	book.Description = b.Description
+	book.Language = b.Language
+	book.Subjects = b.Subjects
+	book.MetadataSource = b.MetadataSource
+	book.MetadataUpdated = b.MetadataUpdated
+}
+
+// IsPhysical reports whether the book is a paper book with no file to copy
+func (b Book) IsPhysical() bool {
+	return b.ContentSource == models.ContentSourcePhysical
+}
+
+// Fingerprint identifies the book's metadata, so each side can tell whether
+// it changed since the last sync without comparing clocks
+func (b Book) Fingerprint() string {
+	fields := []string{
+		b.Title, b.Author, b.Series, strconv.FormatFloat(b.SeriesIndex, 'f', -1, 64),
+		b.ISBN, b.Publisher, b.PublishDate, b.Description, b.Language, b.Subjects,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Outcome is what a sync does with a book the destination already has
+type Outcome int
+
+const (
+	Unchanged    Outcome = iota // Both sides match, or only the destination changed
+	TakeSource                  // Only the source changed, so its metadata is copied
+	ConflictKept                // Both changed and the destination's edit is kept
+	ConflictTook                // Both changed and the source's edit wins
+)
+
+// Resolve decides what a sync does with a book both sides have. synced is
+// the fingerprint of the source's metadata when the book was last synced,
+// or "" if it never was. When both sides changed since then, rule picks
+// the winner: the source, the destination, or whichever was edited last.
+func Resolve(rule string, source, dest Book, synced string) Outcome {
+	sourcePrint, destPrint := source.Fingerprint(), dest.Fingerprint()
+	switch {
+	case sourcePrint == destPrint, sourcePrint == synced:
+		return Unchanged
+	case destPrint == synced:
+		return TakeSource
+	}
+
+	switch rule {
+	case models.MirrorConflictDestination:
+		return ConflictKept
+	case models.MirrorConflictNewest:
+		if editedAt(dest).After(editedAt(source)) {
+			return ConflictKept
+		}
+	}
+	return ConflictTook
+}
+
+// editedAt is when a book's metadata was last changed, or the zero time if
+// it never was after its import
+func editedAt(b Book) time.Time {
+	if b.MetadataUpdated == nil {
+		return time.Time{}
+	}
+	return *b.MetadataUpdated
+}
@@ -0,0 +1,51 @@
+package mirror
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestFingerprint(t *testing.T) {
+	b := Book{ID: "a", Title: "Walden", Author: "Henry David Thoreau", FileHash: "abc"}
+	same := b
+	same.ID, same.FileHash = "b", "def"
+	assert.Equal(t, b.Fingerprint(), same.Fingerprint(), "only metadata is fingerprinted")
+
+	edited := b
+	edited.SeriesIndex = 1
+	assert.NotEqual(t, b.Fingerprint(), edited.Fingerprint())
+}
+
+func TestResolve(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	synced := Book{Title: "Walden"}
+	source := Book{Title: "Walden; or, Life in the Woods", MetadataUpdated: &earlier}
+	dest := Book{Title: "Walden (Annotated)", MetadataUpdated: &later}
+
+	tests := []struct {
+		name         string
+		rule         string
+		source, dest Book
+		synced       string
+		want         Outcome
+	}{
+		{"both match", models.MirrorConflictSource, source, source, synced.Fingerprint(), Unchanged},
+		{"only the destination changed", models.MirrorConflictSource, synced, dest, synced.Fingerprint(), Unchanged},
+		{"only the source changed", models.MirrorConflictDestination, source, synced, synced.Fingerprint(), TakeSource},
+		{"never synced", models.MirrorConflictSource, source, dest, "", ConflictTook},
+		{"source wins", models.MirrorConflictSource, source, dest, synced.Fingerprint(), ConflictTook},
+		{"destination wins", models.MirrorConflictDestination, source, dest, synced.Fingerprint(), ConflictKept},
+		{"newest is the destination", models.MirrorConflictNewest, source, dest, synced.Fingerprint(), ConflictKept},
+		{"newest is the source", models.MirrorConflictNewest, dest, source, synced.Fingerprint(), ConflictTook},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Resolve(tt.rule, tt.source, tt.dest, tt.synced))
+		})
+	}
+}
@@ -1,16 +1,26 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // User represents a registered user
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"-"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
+// AccountTokenPurpose constants for single-use tokens sent by email
+const (
+	AccountTokenPasswordReset     = "password_reset"
+	AccountTokenEmailVerification = "email_verification"
+)
+
 // ContentType constants for books vs comics
 const (
 	ContentTypeBook  = "book"
@@ -24,14 +34,171 @@ const (
 	ReadStatusCompleted = "completed"
 )
 
+// ContentSource constants for books with a file vs paper books tracked without one
+const (
+	ContentSourceDigital  = "digital"
+	ContentSourcePhysical = "physical"
+)
+
 // FileFormat constants for different file types
 const (
 	FileFormatEPUB = "epub"
 	FileFormatPDF  = "pdf"
 	FileFormatCBZ  = "cbz"
 	FileFormatCBR  = "cbr"
+	FileFormatMOBI = "mobi" // Only as an extra edition for download; it can't be read in the browser
+)
+
+// ValidFileFormat reports whether format is one of the file formats above
+func ValidFileFormat(format string) bool {
+	switch format {
+	case FileFormatEPUB, FileFormatPDF, FileFormatCBZ, FileFormatCBR, FileFormatMOBI:
+		return true
+	}
+	return false
+}
+
+// ReadingDirection constants for the order comic pages are read in
+const (
+	ReadingDirectionLTR = "ltr"
+	ReadingDirectionRTL = "rtl" // Manga
+)
+
+// ValidReadingDirection reports whether dir is "ltr" or "rtl"
+func ValidReadingDirection(dir string) bool {
+	return dir == ReadingDirectionLTR || dir == ReadingDirectionRTL
+}
+
+// BookVisibility constants for who besides the owner and share recipients
+// can see a book
+const (
+	BookVisibilityPrivate   = "private"
+	BookVisibilityHousehold = "household" // Shared with everyone the owner shares books with
+	BookVisibilityPublic    = "public"    // Listed and readable by everyone
+)
+
+// ValidBookVisibility reports whether v is "private", "household", or "public"
+func ValidBookVisibility(v string) bool {
+	return v == BookVisibilityPrivate || v == BookVisibilityHousehold || v == BookVisibilityPublic
+}
+
+// AgeRating constants for who a book is suitable for, youngest audience
+// first. Books without one are unrated.
+const (
+	AgeRatingAllAges = "all_ages"
+	AgeRatingTeen    = "teen"
+	AgeRatingMature  = "mature" // 17 and up
+	AgeRatingAdult   = "adult"  // 18 and up, explicit
+)
+
+// AgeRatings lists the age ratings from youngest audience to oldest
+var AgeRatings = []string{AgeRatingAllAges, AgeRatingTeen, AgeRatingMature, AgeRatingAdult}
+
+// ValidAgeRating reports whether rating is one of the age ratings above
+func ValidAgeRating(rating string) bool {
+	return ageRatingRank(rating) >= 0
+}
+
+// AgeRatingAllowed reports whether a book rated rating may be seen by a
+// user whose content restriction is max. An empty max means the user is
+// unrestricted; unrated books are only seen by unrestricted users.
+func AgeRatingAllowed(max, rating string) bool {
+	if max == "" {
+		return true
+	}
+	r := ageRatingRank(rating)
+	return r >= 0 && r <= ageRatingRank(max)
+}
+
+// AgeRatingsUpTo returns the age ratings a user whose content restriction
+// is max may see, youngest first
+func AgeRatingsUpTo(max string) []string {
+	return AgeRatings[:ageRatingRank(max)+1]
+}
+
+func ageRatingRank(rating string) int {
+	for i, r := range AgeRatings {
+		if r == rating {
+			return i
+		}
+	}
+	return -1
+}
+
+// NormalizeAgeRating maps an age rating as found in book metadata, such as
+// ComicInfo.xml's AgeRating ("Everyone 10+", "Teen", "Mature 17+", "Adults
+// Only 18+", "R18+") or a plain "PG-13", to one of the age ratings above.
+// It returns "" for values it doesn't recognize, including "Unknown" and
+// "Rating Pending".
+func NormalizeAgeRating(raw string) string {
+	r := strings.ToLower(strings.TrimSpace(raw))
+	r = strings.NewReplacer("_", " ", "-", " ").Replace(r)
+	switch r {
+	case "all ages", "everyone", "everyone 10+", "early childhood", "kids to adults", "g", "pg", "e", "e10+", "u":
+		return AgeRatingAllAges
+	case "teen", "t", "pg 13", "12+", "13+", "15+", "m15+", "ma15+", "older teen":
+		return AgeRatingTeen
+	case "mature", "mature 17+", "m", "17+", "r", "r16":
+		return AgeRatingMature
+	case "adult", "adults only 18+", "adults only", "ao", "18+", "r18+", "x18+", "x", "nc 17", "explicit":
+		return AgeRatingAdult
+	}
+	return ""
+}
+
+// LetterBucket is one letter of an A–Z index of the library: how many books
+// are filed under it and where the first is in the sorted list
+type LetterBucket struct {
+	Letter string `json:"letter"`
+	Count  int    `json:"count"`
+	Offset int    `json:"offset"`
+}
+
+// BookFacets counts the books of a library view by the values they could be
+// filtered on, for building a filter sidebar
+type BookFacets struct {
+	Total        int            `json:"total"`
+	Formats      map[string]int `json:"formats"`
+	ContentTypes map[string]int `json:"content_types"`
+	ReadStatuses map[string]int `json:"read_statuses"`
+	Languages    map[string]int `json:"languages"` // "" for books without a language
+	Ratings      map[int]int    `json:"ratings"`   // 0 for unrated books
+	Tags         []TagFacet     `json:"tags"`      // Most used first
+}
+
+// TagFacet is one of a user's tags with how many books in view have it
+type TagFacet struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	Count int    `json:"count"`
+}
+
+// Kinds of search suggestion
+const (
+	SuggestionTitle  = "title"
+	SuggestionAuthor = "author"
+	SuggestionSeries = "series"
+	SuggestionTag    = "tag"
 )
 
+// SearchSuggestion is a title, author, series, or tag matching what has been
+// typed into a search box so far
+type SearchSuggestion struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	ID    string `json:"id,omitempty"`    // Book ID of a title, tag ID of a tag
+	Count int    `json:"count,omitempty"` // Books by the author, in the series, or with the tag
+}
+
+// AnonymousClaim is what moved to an account when it took over the library
+// kept without signing in
+type AnonymousClaim struct {
+	BookIDs     []string `json:"book_ids"`
+	Positions   int      `json:"positions"` // Reading positions saved while signed out
+	Collections int      `json:"collections"`
+}
+
 // Book represents a book in the library (EPUB, PDF, or CBZ)
 type Book struct {
 	ID          string    `json:"id"`
@@ -47,9 +214,32 @@ type Book struct {
 	ContentType string    `json:"content_type"`  // "book" or "comic"
 	FileFormat  string    `json:"file_format"`   // "epub", "pdf", or "cbz"
 
+	// Physical books are catalogued without a file
+	ContentSource string `json:"content_source"` // "digital" or "physical"
+
 	// File hash for duplicate detection
 	FileHash string `json:"file_hash,omitempty"`
 
+	// Page order readers render comics in, "ltr" or "rtl"
+	ReadingDirection string `json:"reading_direction,omitempty"`
+
+	// Whether readers show a comic as one continuous vertical strip rather
+	// than page by page, as webtoons are read
+	LongStrip bool `json:"long_strip,omitempty"`
+
+	// Who besides the owner can see the book: "private", "household", or "public"
+	Visibility string `json:"visibility,omitempty"`
+
+	// Who the book is suitable for, one of the AgeRating constants, or
+	// empty if unrated. Users with a content restriction only see books
+	// rated at or below it.
+	AgeRating string `json:"age_rating,omitempty"`
+
+	// Ordering keys computed from the title, language, and author: the title
+	// without its leading article and the author as "Last, First"
+	SortTitle  string `json:"sort_title,omitempty"`
+	SortAuthor string `json:"sort_author,omitempty"`
+
 	// Extended metadata fields
 	ISBN            string     `json:"isbn,omitempty"`
 	Publisher       string     `json:"publisher,omitempty"`
@@ -66,6 +256,83 @@ type Book struct {
 
 	// Star rating (0-5, 0 means no rating)
 	Rating int `json:"rating"`
+
+	// Pages in a PDF or comic, or estimated from an EPUB's text; 0 when
+	// unknown. Only set on single-book responses.
+	PageCount int `json:"page_count,omitempty"`
+
+	// Dominant colors of the cover as "#rrggbb", the most common first, for
+	// a placeholder while it loads; empty without a cover
+	CoverPalette []string `json:"cover_palette,omitempty"`
+
+	// Minutes of reading left at the user's pace, from their position; nil
+	// when the book's length or their pace isn't known yet
+	EstimatedMinutesRemaining *int `json:"estimated_minutes_remaining,omitempty"`
+
+	// The user's values of custom fields, keyed by field key: strings for
+	// text, date, and enum fields, numbers, and booleans
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"`
+}
+
+// IsPhysical reports whether the book is a paper book with no file attached
+func (b *Book) IsPhysical() bool {
+	return b.ContentSource == ContentSourcePhysical
+}
+
+// BookFile is one of a book's files. A book's main file is recorded on the
+// book itself; other editions of the same work, such as a PDF alongside an
+// EPUB, are attached as extra files.
+type BookFile struct {
+	ID         string    `json:"id"`
+	BookID     string    `json:"book_id"`
+	FileFormat string    `json:"file_format"`
+	FilePath   string    `json:"-"`
+	FileSize   int64     `json:"file_size"`
+	FileHash   string    `json:"file_hash,omitempty"`
+	Primary    bool      `json:"primary"` // The book's main file, listed alongside its editions
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DeletedBook is the tombstone left by a deleted book. It keeps the owner's
+// reading data so it can be restored if the same file is uploaded again.
+type DeletedBook struct {
+	ID        string          `json:"id"` // The deleted book's ID
+	UserID    string          `json:"-"`
+	FileHash  string          `json:"file_hash"`
+	Title     string          `json:"title"`
+	Author    string          `json:"author"`
+	DeletedAt time.Time       `json:"deleted_at"`
+	Data      DeletedBookData `json:"-"`
+
+	// What a restore brings back
+	Annotations  int    `json:"annotations"`
+	Notes        int    `json:"notes"`
+	Tags         int    `json:"tags"`
+	ReadingLists int    `json:"reading_lists"`
+	Collections  int    `json:"collections"`
+	HasPosition  bool   `json:"has_position"`
+	ReadStatus   string `json:"read_status,omitempty"`
+}
+
+// DeletedBookData is the reading data kept in a DeletedBook. Tags, lists,
+// and collections are kept by ID, so ones deleted since aren't restored.
+type DeletedBookData struct {
+	Annotations    []*Annotation    `json:"annotations,omitempty"`
+	Notes          []*BookNote      `json:"notes,omitempty"`
+	Position       *ReadingPosition `json:"position,omitempty"`
+	ReadStatus     string           `json:"read_status,omitempty"`
+	DateCompleted  *time.Time       `json:"date_completed,omitempty"`
+	Rating         int              `json:"rating,omitempty"`
+	TagIDs         []string         `json:"tag_ids,omitempty"`
+	ReadingListIDs []string         `json:"reading_list_ids,omitempty"`
+	CollectionIDs  []string         `json:"collection_ids,omitempty"`
+}
+
+// Empty reports whether there is nothing worth restoring
+func (d *DeletedBookData) Empty() bool {
+	return len(d.Annotations) == 0 && len(d.Notes) == 0 && d.Position == nil &&
+		(d.ReadStatus == "" || d.ReadStatus == ReadStatusUnread) && d.Rating == 0 &&
+		len(d.TagIDs) == 0 && len(d.ReadingListIDs) == 0 && len(d.CollectionIDs) == 0
 }
 
 // Collection represents a user-defined collection of books
@@ -74,6 +341,11 @@ type Collection struct {
 	UserID    string    `json:"user_id,omitempty"`
 	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
+	// When its name, rules, or books last changed. A smart collection's
+	// matches also change with the library.
+	UpdatedAt time.Time `json:"updated_at"`
+	// ParentID is the collection this one is nested in, if any
+	ParentID string `json:"parent_id,omitempty"`
 
 	// Smart collection fields
 	IsSmart   bool              `json:"is_smart"`
@@ -94,6 +366,10 @@ const (
 	RuleFieldReadStatus  = "read_status"
 	RuleFieldFileSize    = "file_size"
 	RuleFieldContentType = "content_type"
+
+	// RuleFieldCustomPrefix starts the field of a rule on a custom field,
+	// followed by its key, as in "custom:shelf"
+	RuleFieldCustomPrefix = "custom:"
 )
 
 // Rule operator constants
@@ -111,7 +387,7 @@ const (
 type CollectionRule struct {
 	ID           string `json:"id"`
 	CollectionID string `json:"collection_id"`
-	Field        string `json:"field"`    // author, title, format, year, series, tags, rating, read_status, file_size
+	Field        string `json:"field"`    // author, title, format, year, series, tags, rating, read_status, file_size, custom:<key>
 	Operator     string `json:"operator"` // equals, contains, starts_with, greater_than, less_than, between, in
 	Value        string `json:"value"`    // The value to match (JSON for complex values like ranges)
 }
@@ -121,7 +397,8 @@ type ReadingPosition struct {
 	BookID    string    `json:"book_id"`
 	UserID    string    `json:"user_id,omitempty"`
 	Chapter   string    `json:"chapter"`
-	Position  float64   `json:"position"` // Percentage through chapter
+	Position  float64   `json:"position"`      // Percentage through chapter
+	CFI       string    `json:"cfi,omitempty"` // The same place as an EPUB CFI, for EPUBs
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
@@ -185,6 +462,13 @@ const (
 	HighlightColorOrange = "orange"
 )
 
+// Annotation visibility constants. Shared annotations are shown to the users
+// a book is shared with, and to its owner.
+const (
+	AnnotationVisibilityPrivate = "private"
+	AnnotationVisibilityShared  = "shared"
+)
+
 // Annotation represents a highlight or note on a book
 type Annotation struct {
 	ID            string    `json:"id"`
@@ -197,8 +481,53 @@ type Annotation struct {
 	SelectedText  string    `json:"selected_text"`            // The highlighted text
 	Note          string    `json:"note,omitempty"`           // User's note/comment
 	Color         string    `json:"color"`                    // Highlight color
+	Visibility    string    `json:"visibility"`               // private or shared
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Joined fields
+	Username string `json:"username,omitempty"` // Author, in views mixing users' annotations
+}
+
+// AnnotationReview records when a highlight was last shown in the daily
+// review and when it's due to be shown again
+type AnnotationReview struct {
+	AnnotationID   string    `json:"annotation_id"`
+	ReviewCount    int       `json:"review_count"`
+	LastReviewedAt time.Time `json:"last_reviewed_at"`
+	NextReviewAt   time.Time `json:"next_review_at"`
+}
+
+// ReviewHighlight is a highlight in the daily review feed
+type ReviewHighlight struct {
+	Annotation     *Annotation `json:"annotation"`
+	BookTitle      string      `json:"book_title"`
+	BookAuthor     string      `json:"book_author"`
+	ReviewCount    int         `json:"review_count"`               // 0 if never reviewed
+	LastReviewedAt *time.Time  `json:"last_reviewed_at,omitempty"` // Unset if never reviewed
+}
+
+// BookNote is a long-form Markdown note about a whole book, kept apart
+// from the highlights made in its text
+type BookNote struct {
+	ID        string    `json:"id"`
+	BookID    string    `json:"book_id"`
+	UserID    string    `json:"user_id"`
+	Title     string    `json:"title,omitempty"`
+	Body      string    `json:"body"`     // Markdown
+	Revision  int       `json:"revision"` // 1 when created, incremented by each edit
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BookNoteRevision is an earlier version of a book note, kept when the
+// note is edited
+type BookNoteRevision struct {
+	NoteID    string    `json:"note_id"`
+	Revision  int       `json:"revision"`
+	Title     string    `json:"title,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"` // When this version was written
 }
 
 // ReadingSession represents a single reading session
@@ -210,7 +539,10 @@ type ReadingSession struct {
 	EndTime         *time.Time `json:"end_time,omitempty"`
 	PagesRead       int        `json:"pages_read"`
 	ChaptersRead    int        `json:"chapters_read"`
-	DurationSeconds int        `json:"duration_seconds"`
+	DurationSeconds int        `json:"duration_seconds"` // Excludes paused_seconds
+	PausedAt        *time.Time `json:"paused_at,omitempty"`
+	PausedSeconds   int        `json:"paused_seconds"` // Time paused or idle, not counted as reading
+	LastActiveAt    *time.Time `json:"last_active_at,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 
 	// Computed/joined fields
@@ -218,6 +550,59 @@ type ReadingSession struct {
 	BookAuthor string `json:"book_author,omitempty"`
 }
 
+// Pause stops the session's clock at now
+func (s *ReadingSession) Pause(now time.Time) {
+	if s.PausedAt == nil {
+		s.PausedAt = &now
+	}
+}
+
+// Resume restarts a paused session's clock at now, leaving the time it was
+// paused out of the session
+func (s *ReadingSession) Resume(now time.Time) {
+	if s.PausedAt == nil {
+		return
+	}
+	s.PausedSeconds += int(now.Sub(*s.PausedAt).Seconds())
+	s.PausedAt = nil
+	s.LastActiveAt = &now
+}
+
+// Heartbeat records that the reader was active at now, resuming the session
+// if it was paused. A gap since the last activity longer than idleTimeout
+// is left out of the session; a zero idleTimeout counts every gap.
+func (s *ReadingSession) Heartbeat(now time.Time, idleTimeout time.Duration) {
+	if s.PausedAt != nil {
+		s.Resume(now)
+		return
+	}
+
+	last := s.StartTime
+	if s.LastActiveAt != nil {
+		last = *s.LastActiveAt
+	}
+	if gap := now.Sub(last); idleTimeout > 0 && gap > idleTimeout {
+		s.PausedSeconds += int(gap.Seconds())
+	}
+	s.LastActiveAt = &now
+}
+
+// Finish ends the session at end and sets its duration, leaving out time
+// paused and idle. Without heartbeats the session is assumed active
+// throughout; with them, a final gap longer than idleTimeout is idle.
+func (s *ReadingSession) Finish(end time.Time, idleTimeout time.Duration) {
+	switch {
+	case s.PausedAt != nil:
+		s.PausedSeconds += int(end.Sub(*s.PausedAt).Seconds())
+		s.PausedAt = nil
+	case s.LastActiveAt != nil && idleTimeout > 0 && end.Sub(*s.LastActiveAt) > idleTimeout:
+		s.PausedSeconds += int(end.Sub(*s.LastActiveAt).Seconds())
+	}
+
+	s.EndTime = &end
+	s.DurationSeconds = max(0, int(end.Sub(s.StartTime).Seconds())-s.PausedSeconds)
+}
+
 // UserStatistics represents aggregated reading statistics for a user
 type UserStatistics struct {
 	UserID             string     `json:"user_id"`
@@ -245,3 +630,966 @@ type DailyReadingStats struct {
 	TimeSeconds  int       `json:"time_seconds"`
 	BooksTouched int       `json:"books_touched"`
 }
+
+// MemoryType constants for what happened on a day in an earlier year
+const (
+	MemoryFinished  = "finished"
+	MemoryHighlight = "highlight"
+)
+
+// Memory is a book finished or a highlight made on this calendar date in an
+// earlier year
+type Memory struct {
+	Type       string      `json:"type"` // "finished" or "highlight"
+	Date       time.Time   `json:"date"`
+	YearsAgo   int         `json:"years_ago"`
+	BookID     string      `json:"book_id"`
+	BookTitle  string      `json:"book_title"`
+	BookAuthor string      `json:"book_author"`
+	Annotation *Annotation `json:"annotation,omitempty"` // Highlights only
+}
+
+// NotificationChannelType constants for notification delivery channels
+const (
+	NotificationChannelEmail   = "email"
+	NotificationChannelWebhook = "webhook"
+	NotificationChannelNtfy    = "ntfy"
+	NotificationChannelGotify  = "gotify"
+)
+
+// NotificationEvent constants for events a user can subscribe to
+const (
+	NotificationEventBookShared     = "book_shared"
+	NotificationEventImportFinished = "import_finished"
+	NotificationEventSeriesNewBook  = "series_new_book"
+	NotificationEventAuthorNewBook  = "author_new_book"
+	NotificationEventLoanOverdue    = "loan_overdue"
+	NotificationEventAchievement    = "achievement_earned"
+)
+
+// NotificationEvents lists all subscribable events with a description
+var NotificationEvents = map[string]string{
+	NotificationEventBookShared:     "A book was shared with you",
+	NotificationEventImportFinished: "A book you uploaded finished importing",
+	NotificationEventSeriesNewBook:  "A new release in a series you follow",
+	NotificationEventAuthorNewBook:  "A new release by an author you follow",
+	NotificationEventLoanOverdue:    "A book you lent or borrowed is overdue",
+	NotificationEventAchievement:    "You earned an achievement",
+}
+
+// NotificationChannel represents a user's configured notification destination
+type NotificationChannel struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Type      string    `json:"type"`   // email, webhook, ntfy, gotify
+	Name      string    `json:"name"`   // User-facing label
+	Target    string    `json:"target"` // Email address, webhook URL, ntfy topic URL, or Gotify server URL
+	Token     string    `json:"-"`      // Auth token for webhook/ntfy/Gotify (never returned)
+	HasToken  bool      `json:"has_token"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationSubscription represents a user's opt-in setting for an event
+type NotificationSubscription struct {
+	EventType   string `json:"event_type"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// FollowType constants for what a user can follow
+const (
+	FollowTypeAuthor = "author"
+	FollowTypeSeries = "series"
+)
+
+// Follow represents a user following an author or series for new releases
+type Follow struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	FollowType    string     `json:"follow_type"` // author or series
+	Name          string     `json:"name"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	UnseenCount   int        `json:"unseen_count"`
+}
+
+// FollowUpdate represents a new release found for a followed author or series
+type FollowUpdate struct {
+	ID          string    `json:"id"`
+	FollowID    string    `json:"follow_id"`
+	UserID      string    `json:"user_id"`
+	Title       string    `json:"title"`
+	Author      string    `json:"author,omitempty"`
+	Series      string    `json:"series,omitempty"`
+	IssueNumber string    `json:"issue_number,omitempty"`
+	ReleaseDate string    `json:"release_date,omitempty"`
+	CoverURL    string    `json:"cover_url,omitempty"`
+	Source      string    `json:"source"`
+	SourceID    string    `json:"source_id"`
+	Seen        bool      `json:"seen"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Joined fields
+	FollowType string `json:"follow_type,omitempty"`
+	FollowName string `json:"follow_name,omitempty"`
+}
+
+// BookReview represents a user's rating and review of a book
+type BookReview struct {
+	ID        string     `json:"id"`
+	BookID    string     `json:"book_id"`
+	UserID    string     `json:"user_id"`
+	Rating    float64    `json:"rating"` // 0-5 in 0.5 steps, 0 = not rated
+	Review    string     `json:"review,omitempty"`
+	Spoiler   bool       `json:"spoiler"`
+	ReadDate  *time.Time `json:"read_date,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Joined fields
+	Username   string `json:"username,omitempty"`
+	BookTitle  string `json:"book_title,omitempty"`
+	BookAuthor string `json:"book_author,omitempty"`
+}
+
+// BookLoan represents a book lent to a person, who may or may not be a user
+type BookLoan struct {
+	ID             string     `json:"id"`
+	BookID         string     `json:"book_id"`
+	UserID         string     `json:"user_id"`                    // Lender
+	BorrowerName   string     `json:"borrower_name"`              // Display name, or the borrower's username
+	BorrowerUserID string     `json:"borrower_user_id,omitempty"` // Set when lent to a user
+	Notes          string     `json:"notes,omitempty"`
+	LentAt         time.Time  `json:"lent_at"`
+	DueDate        *time.Time `json:"due_date,omitempty"`
+	ReturnedAt     *time.Time `json:"returned_at,omitempty"`
+	RemindedAt     *time.Time `json:"reminded_at,omitempty"`
+
+	// Joined/computed fields
+	BookTitle  string `json:"book_title,omitempty"`
+	BookAuthor string `json:"book_author,omitempty"`
+	Overdue    bool   `json:"overdue"`
+}
+
+// IsOverdue reports whether the loan is outstanding past its due date
+func (l *BookLoan) IsOverdue(now time.Time) bool {
+	return l.ReturnedAt == nil && l.DueDate != nil && l.DueDate.Before(now)
+}
+
+// BookClub is a group of users reading one of the owner's books together on
+// a chapter-by-chapter schedule
+type BookClub struct {
+	ID          string    `json:"id"`
+	OwnerID     string    `json:"owner_id"`
+	BookID      string    `json:"book_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Joined fields
+	BookTitle   string                   `json:"book_title,omitempty"`
+	BookAuthor  string                   `json:"book_author,omitempty"`
+	MemberCount int                      `json:"member_count"`
+	Members     []*BookClubMember        `json:"members,omitempty"`
+	Schedule    []*BookClubScheduleEntry `json:"schedule,omitempty"`
+}
+
+// BookClubMember is a user in a book club. The owner is a member too.
+type BookClubMember struct {
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	SharedBook bool      `json:"-"` // Joining shared the book, so leaving unshares it
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+// BookClubScheduleEntry is when a club should have read up to a chapter
+type BookClubScheduleEntry struct {
+	Chapter int       `json:"chapter"`
+	Title   string    `json:"title,omitempty"`
+	DueDate time.Time `json:"due_date"`
+}
+
+// BookClubComment is a comment in a club's discussion of a chapter. Replies
+// have a ParentID and belong to their parent's chapter.
+type BookClubComment struct {
+	ID        string    `json:"id"`
+	ClubID    string    `json:"club_id"`
+	UserID    string    `json:"user_id"`
+	Chapter   int       `json:"chapter"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Joined/computed fields
+	Username string `json:"username"`
+	Spoiler  bool   `json:"spoiler"` // Ahead of the reader's position; Body is withheld
+}
+
+// Reader theme constants, shared by the web reader and TUI clients
+const (
+	ReaderThemeDay   = "day"
+	ReaderThemeSepia = "sepia"
+	ReaderThemeNight = "night"
+)
+
+// Page-turn mode constants for the EPUB reader
+const (
+	PageTurnPaginated  = "paginated"
+	PageTurnContinuous = "continuous"
+)
+
+// Comic fit mode constants for the CBZ/CBR reader
+const (
+	ComicFitContain = "contain"
+	ComicFitWidth   = "width"
+	ComicFitHeight  = "height"
+)
+
+// ReaderPreferences holds a user's reader settings so they follow them
+// across browsers and clients
+type ReaderPreferences struct {
+	UserID       string    `json:"-"`
+	FontFamily   string    `json:"font_family"`
+	FontSize     int       `json:"font_size"`      // Pixels
+	LineHeight   float64   `json:"line_height"`    // Multiple of font size
+	Margins      int       `json:"margins"`        // Percent of page width on each side
+	Theme        string    `json:"theme"`          // day, sepia, night
+	PageTurnMode string    `json:"page_turn_mode"` // paginated, continuous
+	ComicFitMode string    `json:"comic_fit_mode"` // contain, width, height
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// DefaultReaderPreferences returns the settings used before a user saves any
+func DefaultReaderPreferences(userID string) *ReaderPreferences {
+	return &ReaderPreferences{
+		UserID:       userID,
+		FontFamily:   "Georgia",
+		FontSize:     18,
+		LineHeight:   1.8,
+		Margins:      5,
+		Theme:        ReaderThemeDay,
+		PageTurnMode: PageTurnPaginated,
+		ComicFitMode: ComicFitContain,
+	}
+}
+
+// StatsPreferences holds the timezone a user's reading stats and streaks
+// count days in, and whether their reading is tracked at all
+type StatsPreferences struct {
+	UserID      string    `json:"-"`
+	Timezone    string    `json:"timezone"`     // IANA name, e.g. "America/New_York"; "" uses the server's
+	PrivacyMode bool      `json:"privacy_mode"` // No sessions, daily stats, or published activity
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Location returns the timezone days are counted in, falling back to the
+// server's if none is set or it's unknown
+func (p *StatsPreferences) Location() *time.Location {
+	if p.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// LibraryPreferences holds how a user's library lists are ordered and
+// whether metadata subjects become tags
+type LibraryPreferences struct {
+	UserID            string            `json:"-"`
+	SortLocale        string            `json:"sort_locale"`        // BCP 47 tag titles are collated by
+	IgnoreArticles    bool              `json:"ignore_articles"`    // Sort "The Hobbit" under H
+	SubjectTags       bool              `json:"subject_tags"`       // Keep tags in sync with metadata subjects
+	SubjectTagMap     map[string]string `json:"subject_tag_map"`    // Lowercased subject to tag name; "" ignores the subject
+	DefaultVisibility string            `json:"default_visibility"` // Visibility of new uploads; "" uses the server default
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// DefaultLibraryPreferences returns the settings used before a user saves any
+func DefaultLibraryPreferences(userID string) *LibraryPreferences {
+	return &LibraryPreferences{
+		UserID:         userID,
+		SortLocale:     "en",
+		IgnoreArticles: true,
+		SubjectTagMap:  map[string]string{},
+	}
+}
+
+// Activity event type constants
+const (
+	ActivityBookAdded    = "book_added"
+	ActivityBookFinished = "book_finished"
+	ActivityBookRated    = "book_rated"
+)
+
+// ActivityEvent is something a user did that they publish to the users they
+// share books with
+type ActivityEvent struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Type      string    `json:"type"`
+	BookID    string    `json:"book_id"`
+	Rating    int       `json:"rating,omitempty"` // For book_rated
+	CreatedAt time.Time `json:"created_at"`
+
+	// Joined fields
+	Username   string `json:"username"`
+	BookTitle  string `json:"book_title"`
+	BookAuthor string `json:"book_author"`
+}
+
+// ActivityPreferences holds which of a user's activity is published. Nothing
+// is published until the user turns it on.
+type ActivityPreferences struct {
+	UserID          string    `json:"-"`
+	PublishAdded    bool      `json:"publish_added"`    // Adding a book to their library
+	PublishFinished bool      `json:"publish_finished"` // Marking a book completed
+	PublishRated    bool      `json:"publish_rated"`    // Rating a book
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Publishes reports whether events of the given type are published
+func (p *ActivityPreferences) Publishes(eventType string) bool {
+	switch eventType {
+	case ActivityBookAdded:
+		return p.PublishAdded
+	case ActivityBookFinished:
+		return p.PublishFinished
+	case ActivityBookRated:
+		return p.PublishRated
+	}
+	return false
+}
+
+// SeriesReadingDirection is the reading direction a user's new uploads in a
+// series get
+type SeriesReadingDirection struct {
+	UserID           string    `json:"-"`
+	Series           string    `json:"series"`
+	ReadingDirection string    `json:"reading_direction"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ComicSeries is a comic series in a user's library. Its issues are the
+// comics whose series matches its name; series details can be filled in
+// from ComicVine.
+type ComicSeries struct {
+	ID             string    `json:"id"`
+	UserID         string    `json:"-"`
+	Name           string    `json:"name"`
+	Publisher      string    `json:"publisher,omitempty"`
+	StartYear      int       `json:"start_year,omitempty"`
+	Volume         int       `json:"volume,omitempty"`
+	TotalIssues    int       `json:"total_issues"` // 0 if unknown
+	Description    string    `json:"description,omitempty"`
+	MetadataSource string    `json:"metadata_source,omitempty"`
+	SourceID       string    `json:"source_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Computed fields
+	OwnedIssues int           `json:"owned_issues"`
+	ReadIssues  int           `json:"read_issues"`
+	Issues      []*ComicIssue `json:"issues,omitempty"`
+}
+
+// ComicIssue is one entry in a series' issue checklist. Issues that aren't
+// in the library have no BookID but can still be marked read.
+type ComicIssue struct {
+	Number string     `json:"number"`
+	BookID string     `json:"book_id,omitempty"`
+	Title  string     `json:"title,omitempty"`
+	Read   bool       `json:"read"`
+	ReadAt *time.Time `json:"read_at,omitempty"`
+}
+
+// ReadingOrder is a user's custom order for reading issues that may span
+// several series, such as a crossover event. Story arcs imported from
+// ComicVine are reading orders with a source.
+type ReadingOrder struct {
+	ID             string    `json:"id"`
+	UserID         string    `json:"-"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	MetadataSource string    `json:"metadata_source,omitempty"`
+	SourceID       string    `json:"source_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Computed fields
+	EntryCount int                  `json:"entry_count"`
+	Entries    []*ReadingOrderEntry `json:"entries,omitempty"`
+}
+
+// ReadingOrderEntry is an issue at a position in a reading order
+type ReadingOrderEntry struct {
+	Position    int    `json:"position"`
+	SeriesID    string `json:"series_id"`
+	SeriesName  string `json:"series_name"`
+	IssueNumber string `json:"issue_number"`
+	BookID      string `json:"book_id,omitempty"`
+	Read        bool   `json:"read"`
+}
+
+// StyleOverride is a user's CSS applied to EPUB chapters. An empty BookID
+// means it applies to every book; a book's own override is applied after it.
+type StyleOverride struct {
+	UserID    string    `json:"-"`
+	BookID    string    `json:"book_id,omitempty"`
+	CSS       string    `json:"css"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SyncEntity constants for the kinds of data the sync API reports changes to
+const (
+	SyncEntityBook            = "book"
+	SyncEntityPosition        = "position"
+	SyncEntityAnnotation      = "annotation"
+	SyncEntityTag             = "tag"
+	SyncEntityBookTag         = "book_tag" // ID is "book_id:tag_id"
+	SyncEntityReadingList     = "reading_list"
+	SyncEntityReadingListBook = "reading_list_book" // ID is "list_id:book_id"
+)
+
+// SyncChange is one entry in the sync change log: the latest write to an
+// entity a user owns
+type SyncChange struct {
+	Seq       int64
+	Entity    string
+	EntityID  string
+	UserID    string
+	Deleted   bool
+	ChangedAt time.Time
+}
+
+// SyncDeletion tells a sync client to drop an entity
+type SyncDeletion struct {
+	Entity string `json:"entity"`
+	ID     string `json:"id"`
+}
+
+// SyncDelta is what changed in a user's library since a sync cursor. A full
+// delta holds everything and replaces what the client has.
+type SyncDelta struct {
+	Cursor           int64             `json:"cursor"`   // Pass as ?since= next time
+	Full             bool              `json:"full"`     // Everything, not just changes
+	HasMore          bool              `json:"has_more"` // Sync again from cursor for the rest
+	Books            []*Book           `json:"books"`
+	Positions        []ReadingPosition `json:"positions"`
+	Annotations      []*Annotation     `json:"annotations"`
+	Tags             []*Tag            `json:"tags"`
+	BookTags         []BookTag         `json:"book_tags"`
+	ReadingLists     []ReadingList     `json:"reading_lists"`
+	ReadingListBooks []ReadingListBook `json:"reading_list_books"`
+	Deleted          []SyncDeletion    `json:"deleted"`
+}
+
+// Device is an e-reader, phone, or other client a user downloads books to.
+// Downloads and OPDS feeds that name the device get the format and size it
+// wants.
+type Device struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"user_id"`
+	Name            string     `json:"name"`
+	PreferredFormat string     `json:"preferred_format"` // Empty serves each book's main file
+	MaxFileSize     int64      `json:"max_file_size"`    // Bytes; 0 for no limit
+	ScreenWidth     int        `json:"screen_width"`     // Pixels; 0 leaves comic pages at full size
+	ScreenHeight    int        `json:"screen_height"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ChallengeMetric constants for what a reading challenge counts
+const (
+	ChallengeMetricPages   = "pages"   // Pages read in reading sessions
+	ChallengeMetricMinutes = "minutes" // Time spent in reading sessions
+	ChallengeMetricBooks   = "books"   // Books marked completed
+)
+
+// ValidChallengeMetric reports whether metric is "pages", "minutes", or "books"
+func ValidChallengeMetric(metric string) bool {
+	return metric == ChallengeMetricPages || metric == ChallengeMetricMinutes || metric == ChallengeMetricBooks
+}
+
+// ReadingChallenge is a contest between users over their reading between
+// two dates, such as the most pages in a month or finishing 5 books
+type ReadingChallenge struct {
+	ID          string    `json:"id"`
+	OwnerID     string    `json:"owner_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Metric      string    `json:"metric"`
+	Target      int       `json:"target"` // 0 when the most wins
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Joined fields
+	OwnerUsername    string                  `json:"owner_username,omitempty"`
+	ParticipantCount int                     `json:"participant_count"` // Joined participants
+	Joined           bool                    `json:"joined"`            // Whether the current user takes part
+	Participants     []*ChallengeParticipant `json:"participants,omitempty"`
+}
+
+// Ended reports whether the challenge is over at now
+func (c *ReadingChallenge) Ended(now time.Time) bool {
+	return now.After(c.EndsAt)
+}
+
+// ChallengeParticipant is a user invited to a challenge. They take part once
+// they join.
+type ChallengeParticipant struct {
+	UserID    string     `json:"user_id"`
+	Username  string     `json:"username"`
+	InvitedAt time.Time  `json:"invited_at"`
+	JoinedAt  *time.Time `json:"joined_at,omitempty"`
+}
+
+// ChallengeStanding is a participant's place on a challenge's leaderboard
+type ChallengeStanding struct {
+	Rank      int    `json:"rank"` // Tied participants share a rank
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Progress  int    `json:"progress"`  // In the challenge's metric
+	Completed bool   `json:"completed"` // Reached the target
+}
+
+// BadgeType constants for how a badge was earned
+const (
+	BadgeTypeCompleted = "completed" // Reached a challenge's target
+	BadgeTypeWinner    = "winner"    // Led a challenge when it ended
+)
+
+// UserBadge is an award for a reading challenge, kept after the challenge
+// is deleted
+type UserBadge struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	ChallengeID string    `json:"challenge_id,omitempty"` // Empty once the challenge is deleted
+	Type        string    `json:"type"`
+	Name        string    `json:"name"` // The challenge's name
+	AwardedAt   time.Time `json:"awarded_at"`
+}
+
+// Achievement IDs
+const (
+	AchievementFirstBook     = "first_book"     // Finished a book
+	AchievementWeekStreak    = "week_streak"    // Read 7 days in a row
+	AchievementHighlights100 = "highlights_100" // Made 100 highlights
+	AchievementGenres10      = "genres_10"      // Finished books in 10 genres
+)
+
+// Achievement is a milestone in a user's reading and their progress
+// towards it
+type Achievement struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Target      int        `json:"target"`
+	Progress    int        `json:"progress"` // Capped at the target
+	Earned      bool       `json:"earned"`
+	EarnedAt    *time.Time `json:"earned_at,omitempty"`
+}
+
+// StorageUsage is how much disk space the data directory takes, by what
+// it holds
+type StorageUsage struct {
+	BooksBytes    int64 `json:"books_bytes"` // Book files and other editions
+	CoversBytes   int64 `json:"covers_bytes"`
+	DatabaseBytes int64 `json:"database_bytes"`
+	TotalBytes    int64 `json:"total_bytes"`
+}
+
+// StorageSnapshot is a day's record of disk use, for showing growth over
+// time
+type StorageSnapshot struct {
+	Date          string    `json:"date"` // YYYY-MM-DD
+	FreeBytes     int64     `json:"free_bytes"`
+	BooksBytes    int64     `json:"books_bytes"`
+	CoversBytes   int64     `json:"covers_bytes"`
+	DatabaseBytes int64     `json:"database_bytes"`
+	RecordedAt    time.Time `json:"recorded_at"`
+}
+
+// Kinds of leftover file the data directory cleanup removes
+const (
+	CleanupKindUploads    = "uploads"    // Uploads and replacements whose import never finished
+	CleanupKindCovers     = "covers"     // Covers of books that are gone
+	CleanupKindThumbnails = "thumbnails" // Cached page thumbnails of books that are gone
+	CleanupKindText       = "text"       // Cached PDF page text of books that are gone
+	CleanupKindTemp       = "temp"       // Half-written temporary files
+	CleanupKindObjects    = "objects"    // Stored book files no book uses
+)
+
+// CleanupCount is how many files of one kind a cleanup removed and the
+// space they took
+type CleanupCount struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// CleanupRun is what one pass of the data directory cleanup removed
+type CleanupRun struct {
+	ID    int64                   `json:"id"`
+	Files int                     `json:"files"`
+	Bytes int64                   `json:"bytes"`
+	Kinds map[string]CleanupCount `json:"kinds"`
+	RanAt time.Time               `json:"ran_at"`
+}
+
+// Problems a book's file can have when verified against what's recorded
+const (
+	FileProblemMissing      = "missing"
+	FileProblemUnreadable   = "unreadable"
+	FileProblemModified     = "modified"      // Content hash changed: corrupted or edited outside webby
+	FileProblemSizeMismatch = "size_mismatch" // Size differs from the recorded size
+)
+
+// FileProblem is a book whose file failed its last verification
+type FileProblem struct {
+	BookID    string    `json:"book_id"`
+	Title     string    `json:"title"`
+	FilePath  string    `json:"file_path"`
+	Problem   string    `json:"problem"`
+	Expected  string    `json:"expected,omitempty"` // Recorded hash or size
+	Actual    string    `json:"actual,omitempty"`   // Hash or size found on disk
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Metadata issue kinds, as reported for a library
+const (
+	MetadataIssueDuplicateISBN      = "duplicate_isbn"
+	MetadataIssueMissingCover       = "missing_cover"
+	MetadataIssueMissingDescription = "missing_description"
+	MetadataIssueSuspiciousTitle    = "suspicious_title"
+	MetadataIssueEmptyFile          = "empty_file"
+	MetadataIssueUnknownAuthor      = "unknown_author"
+)
+
+// ReportedBook is a book as listed in a metadata issues report
+type ReportedBook struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Author     string   `json:"author"`
+	ISBN       string   `json:"isbn,omitempty"`
+	FileFormat string   `json:"file_format"`
+	Issues     []string `json:"issues"`
+}
+
+// ISBNGroup is books sharing an ISBN
+type ISBNGroup struct {
+	ISBN  string         `json:"isbn"` // As an ISBN-13 when valid
+	Books []ReportedBook `json:"books"`
+}
+
+// MetadataReport lists the books in a library with metadata worth fixing
+type MetadataReport struct {
+	TotalBooks     int            `json:"total_books"`
+	Counts         map[string]int `json:"counts"` // Books with each kind of issue
+	DuplicateISBNs []ISBNGroup    `json:"duplicate_isbns"`
+	Books          []ReportedBook `json:"books"` // Every book with an issue, with its issues
+}
+
+// Job kinds run by the background job queue
+const (
+	JobKindMetadataRefresh = "metadata_refresh"
+	JobKindCoverOptimize   = "cover_optimize"
+	JobKindHashCompute     = "hash_compute"
+	JobKindFileVerify      = "file_verify"
+	JobKindMirrorSync      = "mirror_sync"
+)
+
+// Job statuses. A queued job waits its turn, and a paused one waits to be
+// resumed; the others are finished.
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusPaused    = "paused"
+	JobStatusCompleted = "completed"
+)
+
+// Job item statuses
+const (
+	JobItemPending   = "pending"
+	JobItemSucceeded = "succeeded"
+	JobItemFailed    = "failed"
+	JobItemSkipped   = "skipped"
+)
+
+// Job is a long-running task over a list of items, such as refreshing the
+// metadata of many books, worked through in the background. Each item's
+// result is saved as it finishes, so a paused or interrupted job carries on
+// where it stopped.
+type Job struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	DryRun     bool       `json:"dry_run"`            // Items record what would change without changing it
+	Provider   string     `json:"provider,omitempty"` // Metadata provider a refresh looks books up with, if not the usual ones
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"` // Succeeded, failed or skipped
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobItem is one item of a job, such as a book, and how it went
+type JobItem struct {
+	JobID     string        `json:"job_id"`
+	Seq       int           `json:"seq"` // Order items are worked in
+	ItemID    string        `json:"item_id"`
+	Status    string        `json:"status"`
+	Reason    string        `json:"reason,omitempty"`  // Why it failed or was skipped
+	Changes   []FieldChange `json:"changes,omitempty"` // Made, or in a dry run that would be made
+	Attempts  int           `json:"attempts"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// FieldChange is a field an update changes, or a bulk operation would
+// change in a dry run
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// FileMove is a file a bulk operation moves, or would move in a dry run
+type FileMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// BookChange is what a bulk operation changes in one book. A dry run
+// returns these without applying them.
+type BookChange struct {
+	BookID       string        `json:"book_id"`
+	Title        string        `json:"title"`
+	Fields       []FieldChange `json:"fields,omitempty"`
+	Moves        []FileMove    `json:"moves,omitempty"`
+	TagsAdded    []string      `json:"tags_added,omitempty"`
+	TagsRemoved  []string      `json:"tags_removed,omitempty"`
+	Deleted      bool          `json:"deleted,omitempty"`
+	DeletedFiles []string      `json:"deleted_files,omitempty"`
+}
+
+// Metadata revision sources other than the metadata providers
+const (
+	MetadataSourceManual   = "manual"
+	MetadataSourceFilename = "filename"
+	MetadataSourceRevert   = "revert"
+	MetadataSourceOPDS     = "opds" // A remote OPDS catalog the book was imported from
+)
+
+// MetadataRevision is one change to a book's metadata: the fields it
+// changed, where the new values came from, and who made it. Revisions are
+// numbered from 1 for each book.
+type MetadataRevision struct {
+	BookID    string        `json:"book_id"`
+	Revision  int           `json:"revision"`
+	UserID    string        `json:"user_id"`
+	Source    string        `json:"source"` // Provider name, manual, filename or revert
+	Changes   []FieldChange `json:"changes"`
+	RevertOf  int           `json:"revert_of,omitempty"` // Revision a revert undid
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ComicFilenamePattern is a regular expression an admin added for comic
+// filenames the built-in parser gets wrong. Its named groups (series,
+// issue, volume, year, title) say what each part of the name is. Patterns
+// are tried in the order they were added.
+type ComicFilenamePattern struct {
+	ID          string    `json:"id"`
+	Pattern     string    `json:"pattern"`
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Types of custom field
+const (
+	CustomFieldText   = "text"
+	CustomFieldNumber = "number"
+	CustomFieldBool   = "bool"
+	CustomFieldDate   = "date" // Stored as YYYY-MM-DD
+	CustomFieldEnum   = "enum"
+)
+
+// ValidCustomFieldType reports whether t is a custom field type
+func ValidCustomFieldType(t string) bool {
+	switch t {
+	case CustomFieldText, CustomFieldNumber, CustomFieldBool, CustomFieldDate, CustomFieldEnum:
+		return true
+	}
+	return false
+}
+
+// CustomField is a field admins add to every book, like a Calibre custom
+// column. Each user keeps their own value of it for each book.
+type CustomField struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`               // Used in requests and smart collection rules
+	Name      string    `json:"name"`              // Label shown to users
+	Type      string    `json:"type"`              // text, number, bool, date, or enum
+	Options   []string  `json:"options,omitempty"` // Choices of an enum
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OPDSSource is a remote OPDS catalog, such as another Calibre-Web or
+// Kavita server, that a user browses and imports books from
+type OPDSSource struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"` // The catalog's root feed
+	Username    string    `json:"username,omitempty"`
+	Password    string    `json:"-"`
+	HasPassword bool      `json:"has_password"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SyncKey lets another Webby server mirror collections to or from a user's
+// library, acting as that user. It only reaches the collections with the
+// names it was made for. Requests name a key by its token, stored hashed.
+type SyncKey struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	Collections []string   `json:"collections"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Mirror directions: a pull copies from the other server, a push to it
+const (
+	MirrorPull = "pull"
+	MirrorPush = "push"
+)
+
+// Mirror conflict rules, for books whose metadata changed on both servers
+// since their last sync
+const (
+	MirrorConflictSource      = "source"      // The server being copied from wins
+	MirrorConflictDestination = "destination" // The server being copied to keeps its edit
+	MirrorConflictNewest      = "newest"      // Whichever was edited last wins
+)
+
+// Mirror status values
+const (
+	MirrorStatusOK     = "ok"
+	MirrorStatusFailed = "failed"
+)
+
+// Mirror keeps collections in step with another Webby server, such as a
+// home server and a VPS. Collections are matched by name on both servers.
+type Mirror struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"user_id"`
+	Name            string        `json:"name"`
+	URL             string        `json:"url"` // The other server, with any path it's served under
+	APIKey          string        `json:"-"`   // A sync key made on the other server
+	Direction       string        `json:"direction"`
+	Collections     []string      `json:"collections"`
+	IncludeFiles    bool          `json:"include_files"`    // Books missing on the destination are copied with their files
+	ConflictRule    string        `json:"conflict_rule"`
+	IntervalMinutes int           `json:"interval_minutes"` // 0 syncs only when asked
+	CreatedAt       time.Time     `json:"created_at"`
+	LastJobID       string        `json:"last_job_id,omitempty"`
+	LastSyncAt      *time.Time    `json:"last_sync_at,omitempty"`
+	LastStatus      string        `json:"last_status,omitempty"`
+	LastError       string        `json:"last_error,omitempty"`
+	LastResult      *MirrorResult `json:"last_result,omitempty"`
+}
+
+// MirrorResult is what a sync changed on the destination
+type MirrorResult struct {
+	Created     int              `json:"created"`
+	Updated     int              `json:"updated"`
+	Unchanged   int              `json:"unchanged"`
+	FilesCopied int              `json:"files_copied"`
+	Collections int              `json:"collections"`
+	Conflicts   []MirrorConflict `json:"conflicts"`
+	Skipped     []MirrorSkip     `json:"skipped"`
+}
+
+// MirrorConflict is a book whose metadata changed on both servers, and
+// which side's the conflict rule kept
+type MirrorConflict struct {
+	BookID string `json:"book_id"` // On the destination
+	Title  string `json:"title"`
+	Kept   string `json:"kept"` // "source" or "destination"
+}
+
+// MirrorSkip is a book a sync couldn't add to the destination, and why
+type MirrorSkip struct {
+	SourceID string `json:"source_id"`
+	Title    string `json:"title"`
+	Reason   string `json:"reason"`
+}
+
+// Tracker types for the services read status changes are sent to
+const (
+	TrackerWebhook   = "webhook"
+	TrackerHardcover = "hardcover"
+)
+
+// Tracker events sent when a user's read status for a book changes
+const (
+	TrackerEventStatusChanged = "read_status_changed"
+	TrackerEventBookFinished  = "book_finished" // The status changed to completed
+)
+
+// TrackerConnection is a user's link to an external reading tracker, which
+// is sent their read status changes as they happen
+type TrackerConnection struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Type       string     `json:"type"` // webhook or hardcover
+	Name       string     `json:"name"`
+	Target     string     `json:"target"` // Webhook URL, or the tracker's API URL
+	Token      string     `json:"-"`      // Bearer token or API key (never returned)
+	HasToken   bool       `json:"has_token"`
+	Enabled    bool       `json:"enabled"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"` // Why the last update failed, cleared by the next that's sent
+}
+
+// ContentRestriction is the highest age rating an admin lets a user see
+type ContentRestriction struct {
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+	MaxAgeRating string `json:"max_age_rating"` // Empty if unrestricted
+}
+
+// Profile is a restricted profile, such as a child's, that an account can
+// switch to. It only sees the books in its collections, up to its age
+// rating, and can read them but not change the library.
+type Profile struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	Name          string    `json:"name"`
+	MaxAgeRating  string    `json:"max_age_rating,omitempty"` // Empty for no age limit beyond the collections
+	CollectionIDs []string  `json:"collection_ids"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ProfileBook is the simplified view of a book shown in a profile
+type ProfileBook struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Author      string  `json:"author"`
+	Series      string  `json:"series,omitempty"`
+	SeriesIndex float64 `json:"series_index,omitempty"`
+	ContentType string  `json:"content_type"`
+	FileFormat  string  `json:"file_format"`
+	ReadStatus  string  `json:"read_status"`
+}
@@ -0,0 +1,232 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// SMTPChannel delivers notifications by email
+type SMTPChannel struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPChannel creates an email channel
+// Reads settings from WEBBY_SMTP_HOST, WEBBY_SMTP_PORT, WEBBY_SMTP_USERNAME,
+// WEBBY_SMTP_PASSWORD and WEBBY_SMTP_FROM environment variables
+func NewSMTPChannel() *SMTPChannel {
+	port := os.Getenv("WEBBY_SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPChannel{
+		host:     os.Getenv("WEBBY_SMTP_HOST"),
+		port:     port,
+		username: os.Getenv("WEBBY_SMTP_USERNAME"),
+		password: os.Getenv("WEBBY_SMTP_PASSWORD"),
+		from:     os.Getenv("WEBBY_SMTP_FROM"),
+	}
+}
+
+// Type returns the channel identifier
+func (c *SMTPChannel) Type() string {
+	return models.NotificationChannelEmail
+}
+
+// IsConfigured returns true if an SMTP server and sender are set
+func (c *SMTPChannel) IsConfigured() bool {
+	return c.host != "" && c.from != ""
+}
+
+// Send emails the event to the destination address
+func (c *SMTPChannel) Send(ctx context.Context, dest *models.NotificationChannel, event Event) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", dest.Target)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", sanitizeHeader(event.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Timestamp.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(event.Message)
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if c.username != "" {
+		auth = smtp.PlainAuth("", c.username, c.password, c.host)
+	}
+
+	// net/smtp has no context support, so run the send in the background and
+	// give up waiting when the context expires
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(c.host, c.port), auth, c.from, []string{dest.Target}, msg.Bytes())
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WebhookChannel delivers notifications as JSON POSTs to a user-supplied URL
+type WebhookChannel struct {
+	client *http.Client
+}
+
+// NewWebhookChannel creates a generic webhook channel
+func NewWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Type returns the channel identifier
+func (c *WebhookChannel) Type() string {
+	return models.NotificationChannelWebhook
+}
+
+// IsConfigured always returns true since webhooks need no server settings
+func (c *WebhookChannel) IsConfigured() bool {
+	return true
+}
+
+// Send posts the event as JSON to the destination URL
+func (c *WebhookChannel) Send(ctx context.Context, dest *models.NotificationChannel, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", dest.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if dest.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+dest.Token)
+	}
+
+	return doRequest(c.client, req)
+}
+
+// NtfyChannel delivers notifications to an ntfy topic
+type NtfyChannel struct {
+	client *http.Client
+}
+
+// NewNtfyChannel creates an ntfy channel
+func NewNtfyChannel() *NtfyChannel {
+	return &NtfyChannel{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Type returns the channel identifier
+func (c *NtfyChannel) Type() string {
+	return models.NotificationChannelNtfy
+}
+
+// IsConfigured always returns true since the topic URL is per-user
+func (c *NtfyChannel) IsConfigured() bool {
+	return true
+}
+
+// Send publishes the event to the destination topic URL (e.g., https://ntfy.sh/my-topic)
+func (c *NtfyChannel) Send(ctx context.Context, dest *models.NotificationChannel, event Event) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", dest.Target, strings.NewReader(event.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", sanitizeHeader(event.Title))
+	req.Header.Set("Tags", "books,"+event.Type)
+	if dest.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+dest.Token)
+	}
+
+	return doRequest(c.client, req)
+}
+
+// GotifyChannel delivers notifications to a Gotify server
+type GotifyChannel struct {
+	client *http.Client
+}
+
+// NewGotifyChannel creates a Gotify channel
+func NewGotifyChannel() *GotifyChannel {
+	return &GotifyChannel{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Type returns the channel identifier
+func (c *GotifyChannel) Type() string {
+	return models.NotificationChannelGotify
+}
+
+// IsConfigured always returns true since the server URL is per-user
+func (c *GotifyChannel) IsConfigured() bool {
+	return true
+}
+
+// Send posts the event to the Gotify message API using the application token
+func (c *GotifyChannel) Send(ctx context.Context, dest *models.NotificationChannel, event Event) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    event.Title,
+		"message":  event.Message,
+		"priority": 5,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(dest.Target, "/") + "/message"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", dest.Token)
+
+	return doRequest(c.client, req)
+}
+
+// doRequest performs an HTTP request and treats any non-2xx status as an error
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sanitizeHeader strips line breaks so values are safe to use in headers
+func sanitizeHeader(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
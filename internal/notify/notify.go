@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// Common errors
+var (
+	ErrUnsupportedChannel = errors.New("notification channel type not supported")
+	ErrChannelNotReady    = errors.New("notification channel is not configured on this server")
+)
+
+// Event represents something that happened which a user may be notified about
+type Event struct {
+	Type      string    `json:"event"`
+	UserID    string    `json:"user_id"` // Recipient
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	BookID    string    `json:"book_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Channel delivers events to a single kind of destination
+type Channel interface {
+	// Type returns the channel identifier (e.g., "email", "webhook")
+	Type() string
+
+	// IsConfigured reports whether the server has what this channel needs to send
+	IsConfigured() bool
+
+	// Send delivers an event to the user's configured destination
+	Send(ctx context.Context, dest *models.NotificationChannel, event Event) error
+}
+
+// Service consumes the event stream and fans events out to subscribed channels
+type Service struct {
+	db       *storage.Database
+	channels map[string]Channel
+	events   chan Event
+	timeout  time.Duration
+}
+
+// NewService creates a notification service with the given channels and starts
+// the dispatcher that drains the event stream
+func NewService(db *storage.Database, channels ...Channel) *Service {
+	s := &Service{
+		db:       db,
+		channels: make(map[string]Channel),
+		events:   make(chan Event, 256),
+		timeout:  15 * time.Second,
+	}
+	for _, ch := range channels {
+		s.channels[ch.Type()] = ch
+	}
+
+	go s.run()
+	return s
+}
+
+// NewDefaultService creates a notification service with all built-in channels.
+// SMTP settings are read from WEBBY_SMTP_* environment variables.
+func NewDefaultService(db *storage.Database) *Service {
+	return NewService(db,
+		NewSMTPChannel(),
+		NewWebhookChannel(),
+		NewNtfyChannel(),
+		NewGotifyChannel(),
+	)
+}
+
+// Publish adds an event to the stream without blocking the caller
+func (s *Service) Publish(event Event) {
+	if event.UserID == "" {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		log.Printf("Warning: notification queue full, dropping %s event for user %s", event.Type, event.UserID)
+	}
+}
+
+// Send delivers an event to one destination immediately
+func (s *Service) Send(ctx context.Context, dest *models.NotificationChannel, event Event) error {
+	ch, ok := s.channels[dest.Type]
+	if !ok {
+		return ErrUnsupportedChannel
+	}
+	if !ch.IsConfigured() {
+		return ErrChannelNotReady
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	return ch.Send(ctx, dest, event)
+}
+
+// SendEmail emails one address immediately. It's for account mail such as
+// password resets, which goes out whatever the user's notification settings.
+func (s *Service) SendEmail(ctx context.Context, to, subject, body string) error {
+	dest := &models.NotificationChannel{Type: models.NotificationChannelEmail, Target: to}
+	return s.Send(ctx, dest, Event{Title: subject, Message: body})
+}
+
+// EmailConfigured reports whether the server can send email
+func (s *Service) EmailConfigured() bool {
+	ch, ok := s.channels[models.NotificationChannelEmail]
+	return ok && ch.IsConfigured()
+}
+
+// IsSupported reports whether a channel type is registered
+func (s *Service) IsSupported(channelType string) bool {
+	_, ok := s.channels[channelType]
+	return ok
+}
+
+// AvailableChannels returns channel types and whether each is usable on this server
+func (s *Service) AvailableChannels() map[string]bool {
+	available := make(map[string]bool, len(s.channels))
+	for name, ch := range s.channels {
+		available[name] = ch.IsConfigured()
+	}
+	return available
+}
+
+// run drains the event stream and dispatches each event
+func (s *Service) run() {
+	for event := range s.events {
+		s.dispatch(event)
+	}
+}
+
+// dispatch sends an event to every channel the recipient has subscribed with
+func (s *Service) dispatch(event Event) {
+	dests, err := s.db.GetNotificationChannelsForEvent(event.UserID, event.Type)
+	if err != nil {
+		log.Printf("Warning: failed to load notification channels for user %s: %v", event.UserID, err)
+		return
+	}
+
+	for _, dest := range dests {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		if err := s.Send(ctx, dest, event); err != nil {
+			log.Printf("Warning: failed to deliver %s notification via %s channel %s: %v", event.Type, dest.Type, dest.ID, err)
+		}
+		cancel()
+	}
+}
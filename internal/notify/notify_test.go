@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestWebhookChannelSend(t *testing.T) {
+	var received Event
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dest := &models.NotificationChannel{Type: models.NotificationChannelWebhook, Target: server.URL, Token: "secret"}
+	event := Event{Type: models.NotificationEventBookShared, UserID: "user-1", Title: "Shared", Message: "hello", BookID: "book-1", Timestamp: time.Now()}
+
+	err := NewWebhookChannel().Send(context.Background(), dest, event)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer secret", authHeader)
+	assert.Equal(t, event.Type, received.Type)
+	assert.Equal(t, event.BookID, received.BookID)
+	assert.Equal(t, event.Message, received.Message)
+}
+
+func TestNtfyChannelSend(t *testing.T) {
+	var title, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title = r.Header.Get("Title")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	dest := &models.NotificationChannel{Type: models.NotificationChannelNtfy, Target: server.URL + "/books"}
+	event := Event{Type: models.NotificationEventImportFinished, Title: "Import\nfinished", Message: "ready"}
+
+	err := NewNtfyChannel().Send(context.Background(), dest, event)
+	require.NoError(t, err)
+	assert.Equal(t, "Import finished", title)
+	assert.Equal(t, "ready", body)
+}
+
+func TestWebhookChannelErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dest := &models.NotificationChannel{Type: models.NotificationChannelWebhook, Target: server.URL}
+	err := NewWebhookChannel().Send(context.Background(), dest, Event{})
+	assert.Error(t, err)
+}
+
+func TestServiceSendUnconfigured(t *testing.T) {
+	s := &Service{channels: map[string]Channel{}}
+	s.channels[models.NotificationChannelEmail] = &SMTPChannel{}
+
+	dest := &models.NotificationChannel{Type: models.NotificationChannelEmail, Target: "user@example.com"}
+	assert.Equal(t, ErrChannelNotReady, s.Send(context.Background(), dest, Event{}))
+	assert.Equal(t, ErrChannelNotReady, s.SendEmail(context.Background(), "user@example.com", "Subject", "Body"))
+	assert.False(t, s.EmailConfigured())
+
+	dest.Type = "carrier-pigeon"
+	assert.Equal(t, ErrUnsupportedChannel, s.Send(context.Background(), dest, Event{}))
+}
@@ -0,0 +1,360 @@
+package opds
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/justyntemme/webby/internal/epub"
+)
+
+// maxCatalogSize is the largest catalog page read from a remote server
+const maxCatalogSize = 10 << 20
+
+// ErrPrivateAddress is returned when a catalog URL, or one it redirects
+// to, leads to an address on the server's own network, so users can't have
+// webby reach hosts they couldn't themselves
+var ErrPrivateAddress = errors.New("address isn't on the public internet")
+
+// privatePrefixes are the ranges besides loopback and RFC 1918/4193 private
+// ones that don't lead to the public internet
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT, and VPNs like Tailscale
+}
+
+// CatalogPage is a page of a remote OPDS catalog, with every link resolved
+// against the page's URL
+type CatalogPage struct {
+	Title    string         `json:"title"`
+	URL      string         `json:"url"`
+	Next     string         `json:"next,omitempty"`
+	Previous string         `json:"previous,omitempty"`
+	Search   string         `json:"search,omitempty"` // OpenSearch description, or a template with {searchTerms}
+	Entries  []CatalogEntry `json:"entries"`
+}
+
+// CatalogEntry is an entry of a remote catalog: a book with the files it
+// can be downloaded as, or a link to another page of the catalog
+type CatalogEntry struct {
+	ID           string        `json:"id"`
+	Title        string        `json:"title"`
+	Author       string        `json:"author,omitempty"`
+	Summary      string        `json:"summary,omitempty"`
+	Publisher    string        `json:"publisher,omitempty"`
+	Language     string        `json:"language,omitempty"`
+	Issued       string        `json:"issued,omitempty"`
+	Categories   []string      `json:"categories,omitempty"`
+	Cover        string        `json:"cover,omitempty"`
+	Navigation   string        `json:"navigation,omitempty"` // Page this entry leads to, for entries that aren't books
+	Acquisitions []Acquisition `json:"acquisitions,omitempty"`
+}
+
+// Acquisition is a file a remote catalog entry can be downloaded as
+type Acquisition struct {
+	Href   string `json:"href"`
+	Type   string `json:"type"`
+	Format string `json:"format,omitempty"` // Webby file format, empty if webby can't import it
+}
+
+// Credentials are what a remote catalog is logged in to with, if anything
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// remoteFeed and remoteEntry are what is read of an Atom feed; element
+// names are matched in any namespace, since servers differ in which Dublin
+// Core namespace they use
+type remoteFeed struct {
+	Title   string        `xml:"title"`
+	Links   []Link        `xml:"link"`
+	Entries []remoteEntry `xml:"entry"`
+}
+
+type remoteEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Authors []Author `xml:"author"`
+	Summary string   `xml:"summary"`
+	Content struct {
+		Type  string `xml:"type,attr"`
+		Text  string `xml:",chardata"`
+		Inner string `xml:",innerxml"`
+	} `xml:"content"`
+	Publisher  string `xml:"publisher"`
+	Language   string `xml:"language"`
+	Issued     string `xml:"issued"`
+	Categories []struct {
+		Term  string `xml:"term,attr"`
+		Label string `xml:"label,attr"`
+	} `xml:"category"`
+	Links []Link `xml:"link"`
+}
+
+// ParseCatalog reads an OPDS feed fetched from pageURL
+func ParseCatalog(r io.Reader, pageURL *url.URL) (*CatalogPage, error) {
+	var feed remoteFeed
+	if err := xml.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("not an OPDS feed: %w", err)
+	}
+
+	resolve := func(href string) string {
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			return ""
+		}
+		return pageURL.ResolveReference(ref).String()
+	}
+
+	page := &CatalogPage{Title: strings.TrimSpace(feed.Title), URL: pageURL.String(), Entries: []CatalogEntry{}}
+	for _, link := range feed.Links {
+		switch link.Rel {
+		case "next":
+			page.Next = resolve(link.Href)
+		case "previous", "prev":
+			page.Previous = resolve(link.Href)
+		case OPDSLinkRelSearch:
+			if page.Search == "" || strings.Contains(link.Href, "{searchTerms}") {
+				page.Search = resolve(link.Href)
+			}
+		}
+	}
+	// Templates keep their braces rather than being escaped by resolving
+	page.Search = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(page.Search)
+
+	for _, e := range feed.Entries {
+		entry := CatalogEntry{
+			ID:        strings.TrimSpace(e.ID),
+			Title:     strings.TrimSpace(e.Title),
+			Summary:   strings.TrimSpace(epub.StripHTML(e.Summary)),
+			Publisher: strings.TrimSpace(e.Publisher),
+			Language:  strings.TrimSpace(e.Language),
+			Issued:    strings.TrimSpace(e.Issued),
+		}
+		var authors []string
+		for _, a := range e.Authors {
+			if name := strings.TrimSpace(a.Name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+		entry.Author = strings.Join(authors, ", ")
+		if entry.Summary == "" {
+			// XHTML content is markup; HTML content is escaped text
+			content := e.Content.Text
+			if e.Content.Type == "xhtml" {
+				content = e.Content.Inner
+			}
+			entry.Summary = strings.TrimSpace(epub.StripHTML(content))
+		}
+		for _, cat := range e.Categories {
+			if label := strings.TrimSpace(cat.Label); label != "" {
+				entry.Categories = append(entry.Categories, label)
+			} else if term := strings.TrimSpace(cat.Term); term != "" {
+				entry.Categories = append(entry.Categories, term)
+			}
+		}
+
+		for _, link := range e.Links {
+			href := resolve(link.Href)
+			if href == "" {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(link.Rel, OPDSLinkRelAcquisition):
+				entry.Acquisitions = append(entry.Acquisitions, Acquisition{
+					Href:   href,
+					Type:   link.Type,
+					Format: FormatForMIMEType(link.Type),
+				})
+			case link.Rel == OPDSLinkRelImage || link.Rel == "x-stanza-cover-image":
+				entry.Cover = href
+			case (link.Rel == OPDSLinkRelThumbnail || link.Rel == "x-stanza-cover-image-thumbnail") && entry.Cover == "":
+				entry.Cover = href
+			case strings.HasPrefix(link.Type, "application/atom+xml") || link.Rel == "subsection":
+				entry.Navigation = href
+			}
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	return page, nil
+}
+
+// FormatForMIMEType returns the file format webby imports files of a MIME
+// type as, or "" if it doesn't import them
+func FormatForMIMEType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	for _, format := range []string{"epub", "pdf", "cbz", "cbr"} {
+		if GetMIMEType(format) == mediaType {
+			return format
+		}
+	}
+	switch mediaType {
+	case "application/x-cbz", "application/zip+comic":
+		return "cbz"
+	case "application/x-cbr", "application/x-rar-compressed":
+		return "cbr"
+	}
+	return ""
+}
+
+// Client fetches pages and files from remote OPDS catalogs
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for remote catalogs. Requests run until their
+// context ends, since book files can take a while to download.
+//
+// Addresses are checked as connections are made, so hosts that redirect or
+// resolve to a private address are refused too. allowPrivate lets the
+// client reach loopback and private addresses, such as a catalog on the
+// same LAN; link-local ones, including cloud metadata services, are always
+// refused.
+func NewClient(allowPrivate bool) *Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address, allowPrivate)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &Client{http: &http.Client{Transport: transport}}
+}
+
+// checkAddress returns ErrPrivateAddress if the client may not connect to
+// address, a resolved IP and port
+func checkAddress(address string, allowPrivate bool) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() || ip.IsLinkLocalMulticast() {
+		return ErrPrivateAddress
+	}
+	if allowPrivate {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() {
+		return ErrPrivateAddress
+	}
+	for _, prefix := range privatePrefixes {
+		if prefix.Contains(ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// Get requests rawURL, logging in with creds only if it's on the same host
+// as base, so a catalog linking files elsewhere doesn't hand out its
+// password. The caller closes the response body.
+func (c *Client) Get(ctx context.Context, rawURL string, base *url.URL, creds Credentials) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q isn't an http or https URL", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Webby")
+	if creds.Username != "" && u.Host == base.Host {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s answered %s", u.Host, resp.Status)
+	}
+	return resp, nil
+}
+
+// Catalog fetches and parses the catalog page at pageURL, giving up after
+// timeout
+func (c *Client) Catalog(ctx context.Context, pageURL string, base *url.URL, creds Credentials, timeout time.Duration) (*CatalogPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := c.Get(ctx, pageURL, base, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ParseCatalog(io.LimitReader(resp.Body, maxCatalogSize), resp.Request.URL)
+}
+
+// SearchURL returns the URL of the page of results for query in the
+// catalog whose page is given, following its OpenSearch description if it
+// doesn't link a template directly. It returns "" if the catalog can't be
+// searched.
+func (c *Client) SearchURL(ctx context.Context, page *CatalogPage, query string, base *url.URL, creds Credentials, timeout time.Duration) (string, error) {
+	template := page.Search
+	if template != "" && !strings.Contains(template, "{searchTerms}") {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		resp, err := c.Get(ctx, template, base, creds)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		var desc struct {
+			URLs []struct {
+				Type     string `xml:"type,attr"`
+				Template string `xml:"template,attr"`
+			} `xml:"Url"`
+		}
+		if err := xml.NewDecoder(io.LimitReader(resp.Body, maxCatalogSize)).Decode(&desc); err != nil {
+			return "", fmt.Errorf("not an OpenSearch description: %w", err)
+		}
+		template = ""
+		for _, u := range desc.URLs {
+			if strings.HasPrefix(u.Type, "application/atom+xml") || template == "" {
+				template = u.Template
+			}
+		}
+		if ref, err := url.Parse(template); err == nil && template != "" {
+			template = resp.Request.URL.ResolveReference(ref).String()
+			template = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(template)
+		}
+	}
+	if template == "" {
+		return "", nil
+	}
+
+	// Optional parameters, such as {startPage?}, are left out
+	expanded := strings.ReplaceAll(template, "{searchTerms}", url.QueryEscape(query))
+	for {
+		start := strings.Index(expanded, "{")
+		end := strings.Index(expanded, "}")
+		if start < 0 || end < start {
+			break
+		}
+		expanded = expanded[:start] + expanded[end+1:]
+	}
+	return expanded, nil
+}
@@ -3,9 +3,11 @@ package opds
 import (
 	"encoding/xml"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/justyntemme/webby/internal/books"
 	"github.com/justyntemme/webby/internal/models"
 )
 
@@ -13,6 +15,7 @@ const (
 	// OPDS Link Relations
 	OPDSLinkRelNavigation  = "http://opds-spec.org/navigation"
 	OPDSLinkRelAcquisition = "http://opds-spec.org/acquisition"
+	OPDSLinkRelSample      = "http://opds-spec.org/acquisition/sample"
 	OPDSLinkRelImage       = "http://opds-spec.org/image"
 	OPDSLinkRelThumbnail   = "http://opds-spec.org/image/thumbnail"
 	OPDSLinkRelSearch      = "search"
@@ -27,6 +30,7 @@ const (
 	MIMETypePDF  = "application/pdf"
 	MIMETypeCBZ  = "application/vnd.comicbook+zip"
 	MIMETypeCBR  = "application/vnd.comicbook-rar"
+	MIMETypeMOBI = "application/x-mobipocket-ebook"
 )
 
 // Feed represents an OPDS Atom feed
@@ -35,12 +39,19 @@ type Feed struct {
 	Xmlns     string    `xml:"xmlns,attr"`
 	XmlnsDC   string    `xml:"xmlns:dc,attr,omitempty"`
 	XmlnsOpds string    `xml:"xmlns:opds,attr,omitempty"`
+	XmlnsOS   string    `xml:"xmlns:opensearch,attr,omitempty"`
 	ID        string    `xml:"id"`
 	Title     string    `xml:"title"`
 	Updated   time.Time `xml:"updated"`
 	Author    *Author   `xml:"author,omitempty"`
 	Links     []Link    `xml:"link"`
-	Entries   []Entry   `xml:"entry"`
+
+	// OpenSearch paging, set by Paginate
+	TotalResults int `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex   int `xml:"opensearch:startIndex,omitempty"`
+
+	Entries []Entry `xml:"entry"`
 }
 
 // Entry represents an OPDS feed entry
@@ -138,6 +149,17 @@ func (f *Feed) AddNavigationEntry(title, id, href, summary string) {
 	f.Entries = append(f.Entries, entry)
 }
 
+// AddNavigationEntryWithImage adds a navigation entry pictured by the
+// image at imageURL, such as a collection's cover mosaic
+func (f *Feed) AddNavigationEntryWithImage(title, id, href, summary, imageURL string) {
+	f.AddNavigationEntry(title, id, href, summary)
+	entry := &f.Entries[len(f.Entries)-1]
+	entry.Links = append(entry.Links,
+		Link{Rel: OPDSLinkRelImage, Href: imageURL, Type: "image/jpeg"},
+		Link{Rel: OPDSLinkRelThumbnail, Href: imageURL, Type: "image/jpeg"},
+	)
+}
+
 // AddSearchLink adds an OpenSearch link to the feed
 func (f *Feed) AddSearchLink(href string) {
 	f.Links = append(f.Links, Link{
@@ -147,8 +169,55 @@ func (f *Feed) AddSearchLink(href string) {
 	})
 }
 
-// BookToEntry converts a Book model to an OPDS entry
-func BookToEntry(book *models.Book, baseURL string) Entry {
+// AddQueryParam adds name=value to the query of each link of the feed and
+// its entries whose href starts with prefix
+func (f *Feed) AddQueryParam(prefix, name, value string) {
+	param := url.QueryEscape(name) + "=" + url.QueryEscape(value)
+	addTo := func(links []Link) {
+		for i := range links {
+			if !strings.HasPrefix(links[i].Href, prefix) {
+				continue
+			}
+			if strings.Contains(links[i].Href, "?") {
+				links[i].Href += "&" + param
+			} else {
+				links[i].Href += "?" + param
+			}
+		}
+	}
+
+	addTo(f.Links)
+	for i := range f.Entries {
+		addTo(f.Entries[i].Links)
+	}
+}
+
+// Paginate records which page of total results the feed holds and adds
+// first, previous, next, and last links. pageURL returns the href of a
+// 1-based page number.
+func (f *Feed) Paginate(page, size, total int, pageURL func(page int) string) {
+	f.XmlnsOS = "http://a9.com/-/spec/opensearch/1.1/"
+	f.TotalResults = total
+	f.ItemsPerPage = size
+	f.StartIndex = (page-1)*size + 1
+
+	lastPage := (total + size - 1) / size
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	f.Links = append(f.Links, Link{Rel: "first", Href: pageURL(1), Type: OPDSFeedType})
+	if page > 1 {
+		f.Links = append(f.Links, Link{Rel: "previous", Href: pageURL(page - 1), Type: OPDSFeedType})
+	}
+	if page < lastPage {
+		f.Links = append(f.Links, Link{Rel: "next", Href: pageURL(page + 1), Type: OPDSFeedType})
+	}
+	f.Links = append(f.Links, Link{Rel: "last", Href: pageURL(lastPage), Type: OPDSFeedType})
+}
+
+// BookToEntry converts a Book model to an OPDS entry, with an acquisition
+// link for its main file, one for each extra edition, and one for a sample
+func BookToEntry(book *models.Book, baseURL string, editions ...models.BookFile) Entry {
 	downloadURL := fmt.Sprintf("%s/opds/v1.2/books/%s/download", baseURL, book.ID)
 	coverURL := fmt.Sprintf("%s/api/books/%s/cover", baseURL, book.ID)
 
@@ -163,6 +232,12 @@ func BookToEntry(book *models.Book, baseURL string) Entry {
 				Href: downloadURL,
 				Type: GetMIMEType(book.FileFormat),
 			},
+			// The start of the book, to preview before downloading
+			{
+				Rel:  OPDSLinkRelSample,
+				Href: fmt.Sprintf("%s/api/books/%s/sample", baseURL, book.ID),
+				Type: GetMIMEType(books.SampleFormat(book.FileFormat)),
+			},
 			// Cover image
 			{
 				Rel:  OPDSLinkRelImage,
@@ -178,6 +253,14 @@ func BookToEntry(book *models.Book, baseURL string) Entry {
 		},
 	}
 
+	for _, edition := range editions {
+		entry.Links = append(entry.Links, Link{
+			Rel:  OPDSLinkRelAcquisition,
+			Href: downloadURL + "?format=" + edition.FileFormat,
+			Type: GetMIMEType(edition.FileFormat),
+		})
+	}
+
 	if book.Author != "" {
 		entry.Author = &Author{Name: book.Author}
 	}
@@ -212,6 +295,8 @@ func GetMIMEType(format string) string {
 		return MIMETypeCBZ
 	case "cbr":
 		return MIMETypeCBR
+	case "mobi":
+		return MIMETypeMOBI
 	default:
 		return "application/octet-stream"
 	}
@@ -226,14 +311,23 @@ func (f *Feed) ToXML() ([]byte, error) {
 	return append([]byte(xml.Header), output...), nil
 }
 
-// OpenSearchDescription generates an OpenSearch description document
+// OpenSearchDescription generates an OpenSearch description document. The
+// search template accepts the optional page and size parameters readers
+// use to page through results.
 func OpenSearchDescription(baseURL, searchURL string) string {
+	// searchURL may carry a query of its own, such as a device token
+	sep := "?"
+	if strings.Contains(searchURL, "?") {
+		sep = "&"
+	}
+	template := strings.ReplaceAll(searchURL+sep, "&", "&amp;")
 	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
   <ShortName>Webby Library</ShortName>
   <Description>Search the Webby ebook library</Description>
   <InputEncoding>UTF-8</InputEncoding>
   <OutputEncoding>UTF-8</OutputEncoding>
-  <Url type="%s" template="%s?q={searchTerms}"/>
-</OpenSearchDescription>`, OPDSFeedType, searchURL)
+  <Url type="%s" template="%sq={searchTerms}&amp;page={startPage?}&amp;size={count?}" pageOffset="1"/>
+  <Url type="application/atom+xml" template="%sq={searchTerms}&amp;page={startPage?}&amp;size={count?}" pageOffset="1"/>
+</OpenSearchDescription>`, OPDSFeedType, template, template)
 }
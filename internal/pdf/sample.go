@@ -0,0 +1,23 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// WriteFirstPages writes a PDF of the first n pages of a PDF to w
+func WriteFirstPages(w io.Writer, filePath string, n int) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer f.Close()
+
+	conf := model.NewDefaultConfiguration()
+	return api.Trim(f, w, []string{"1-" + strconv.Itoa(n)}, conf)
+}
@@ -0,0 +1,655 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// PageText is the text extracted from one page of a PDF
+type PageText struct {
+	Page int    `json:"page"`
+	Text string `json:"text"`
+	// ImageOnly is set for pages with images but no text, such as scans
+	ImageOnly bool `json:"image_only"`
+}
+
+// Form XObjects nested deeper than this are skipped
+const maxFormDepth = 4
+
+// ExtractText returns the text of every page of the PDF at filePath, in
+// reading order as far as the content streams give it. Fonts with a
+// ToUnicode map are decoded through it, other simple fonts as Latin-1;
+// composite fonts without one can't be decoded and are skipped.
+func ExtractText(filePath string) ([]PageText, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ctx, err := api.ReadContext(f, model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, err
+	}
+
+	pages := make([]PageText, 0, ctx.PageCount)
+	for page := 1; page <= ctx.PageCount; page++ {
+		pageDict, _, inherited, err := ctx.PageDict(page, false)
+		if err != nil {
+			return nil, err
+		}
+		content, err := ctx.PageContent(pageDict, page)
+		if err != nil && !errors.Is(err, model.ErrNoContent) {
+			return nil, err
+		}
+
+		var resources types.Dict
+		if inherited != nil {
+			resources = inherited.Resources
+		}
+		e := &textExtractor{xref: ctx.XRefTable}
+		e.run(content, resources, 0)
+		text := e.text()
+		pages = append(pages, PageText{Page: page, Text: text, ImageOnly: text == "" && e.images > 0})
+	}
+	return pages, nil
+}
+
+// textExtractor collects the text shown by content streams
+type textExtractor struct {
+	xref   *model.XRefTable
+	out    strings.Builder
+	images int
+}
+
+// text returns the collected text with each line's surrounding space
+// trimmed and runs of blank lines collapsed
+func (e *textExtractor) text() string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(e.out.String(), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank && len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// newline ends the current line, if it has anything on it
+func (e *textExtractor) newline() {
+	s := e.out.String()
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		e.out.WriteByte('\n')
+	}
+}
+
+// space separates words, unless the line already ends in a separator
+func (e *textExtractor) space() {
+	s := e.out.String()
+	if s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		e.out.WriteByte(' ')
+	}
+}
+
+// run interprets a content stream's text and XObject operators
+func (e *textExtractor) run(content []byte, resources types.Dict, depth int) {
+	fonts := e.fonts(resources)
+	var font *fontDecoder
+	var operands []interface{}
+	lastY, haveY := 0.0, false
+
+	lex := &contentLexer{data: content}
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		op, isOp := tok.(contentOperator)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(contentName); ok {
+					font = fonts[string(name)]
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				e.show(font, operands[len(operands)-1])
+			}
+		case "'", "\"":
+			e.newline()
+			if len(operands) >= 1 {
+				e.show(font, operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if items, ok := operands[len(operands)-1].([]interface{}); ok {
+					for _, item := range items {
+						// A wide negative adjustment is a gap between words
+						if n, ok := item.(float64); ok && n < -250 {
+							e.space()
+						} else {
+							e.show(font, item)
+						}
+					}
+				}
+			}
+		case "T*":
+			e.newline()
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[len(operands)-2].(float64)
+				ty, _ := operands[len(operands)-1].(float64)
+				if ty != 0 {
+					e.newline()
+				} else if tx != 0 {
+					e.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[len(operands)-1].(float64)
+				if haveY && y != lastY {
+					e.newline()
+				} else {
+					e.space()
+				}
+				lastY, haveY = y, true
+			}
+		case "ET":
+			e.space()
+		case "Do":
+			if len(operands) >= 1 {
+				if name, ok := operands[len(operands)-1].(contentName); ok {
+					e.xobject(resources, string(name), depth)
+				}
+			}
+		case "BI":
+			// Inline image; the lexer skips its data
+			e.images++
+		}
+		operands = operands[:0]
+	}
+}
+
+// show writes a string operand decoded through font
+func (e *textExtractor) show(font *fontDecoder, operand interface{}) {
+	s, ok := operand.(contentString)
+	if !ok {
+		return
+	}
+	e.out.WriteString(font.decode([]byte(s)))
+}
+
+// xobject runs a form XObject's content stream or counts an image
+func (e *textExtractor) xobject(resources types.Dict, name string, depth int) {
+	xobjects := e.dict(resources, "XObject")
+	if xobjects == nil {
+		return
+	}
+	entry, ok := xobjects.Find(name)
+	if !ok {
+		return
+	}
+	sd, _, err := e.xref.DereferenceStreamDict(entry)
+	if err != nil || sd == nil {
+		return
+	}
+
+	switch subtype := sd.Dict.NameEntry("Subtype"); {
+	case subtype == nil:
+	case *subtype == "Image":
+		e.images++
+	case *subtype == "Form" && depth < maxFormDepth:
+		if err := sd.Decode(); err != nil {
+			return
+		}
+		formResources := e.dict(sd.Dict, "Resources")
+		if formResources == nil {
+			formResources = resources
+		}
+		e.run(sd.Content, formResources, depth+1)
+	}
+}
+
+// dict returns the dictionary at key in d, or nil
+func (e *textExtractor) dict(d types.Dict, key string) types.Dict {
+	if d == nil {
+		return nil
+	}
+	entry, ok := d.Find(key)
+	if !ok {
+		return nil
+	}
+	found, err := e.xref.DereferenceDict(entry)
+	if err != nil {
+		return nil
+	}
+	return found
+}
+
+// fonts returns decoders for the fonts in resources by name
+func (e *textExtractor) fonts(resources types.Dict) map[string]*fontDecoder {
+	fonts := map[string]*fontDecoder{}
+	fontDicts := e.dict(resources, "Font")
+	for name, entry := range fontDicts {
+		fontDict, err := e.xref.DereferenceDict(entry)
+		if err != nil || fontDict == nil {
+			continue
+		}
+		decoder := &fontDecoder{}
+		if subtype := fontDict.NameEntry("Subtype"); subtype != nil && *subtype == "Type0" {
+			decoder.composite = true
+		}
+		if entry, ok := fontDict.Find("ToUnicode"); ok {
+			if sd, _, err := e.xref.DereferenceStreamDict(entry); err == nil && sd != nil && sd.Decode() == nil {
+				decoder.cmap, decoder.codeWidth = parseToUnicode(sd.Content)
+			}
+		}
+		fonts[name] = decoder
+	}
+	return fonts
+}
+
+// fontDecoder turns the bytes of a shown string into text
+type fontDecoder struct {
+	cmap      map[uint32]string // From the font's ToUnicode map
+	codeWidth int               // Bytes per character code in cmap
+	composite bool              // Type0 font, with multi-byte codes
+}
+
+// decode returns the text for the character codes in b. A nil decoder,
+// for text shown before any font is set, reads them as Latin-1.
+func (d *fontDecoder) decode(b []byte) string {
+	if d != nil && len(d.cmap) > 0 {
+		var sb strings.Builder
+		for i := 0; i+d.codeWidth <= len(b); i += d.codeWidth {
+			var code uint32
+			for _, c := range b[i : i+d.codeWidth] {
+				code = code<<8 | uint32(c)
+			}
+			if text, ok := d.cmap[code]; ok {
+				sb.WriteString(text)
+			} else if d.codeWidth == 1 {
+				sb.WriteString(latin1(b[i : i+1]))
+			}
+		}
+		return sb.String()
+	}
+	if d != nil && d.composite {
+		return ""
+	}
+	return latin1(b)
+}
+
+// latin1 decodes b as Latin-1, dropping control characters
+func latin1(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '\t' || c == '\n' || c == '\r':
+			sb.WriteByte(' ')
+		case c >= 0x20 && c != 0x7f:
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap,
+// returning them with the width in bytes of their character codes
+func parseToUnicode(data []byte) (map[uint32]string, int) {
+	cmap := map[uint32]string{}
+	width := 0
+	lex := &contentLexer{data: data}
+	var operands []interface{}
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		op, isOp := tok.(contentOperator)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(contentString)
+				dst, ok2 := operands[i+1].(contentString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				if width == 0 {
+					width = len(src)
+				}
+				cmap[codeOf(src)] = utf16BE(dst)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(contentString)
+				hi, ok2 := operands[i+1].(contentString)
+				if !ok1 || !ok2 || codeOf(hi) < codeOf(lo) || codeOf(hi)-codeOf(lo) > 0xffff {
+					continue
+				}
+				if width == 0 {
+					width = len(lo)
+				}
+				switch dst := operands[i+2].(type) {
+				case contentString:
+					// Consecutive codes map to consecutive text, by
+					// incrementing the last UTF-16 unit
+					units := utf16Units(dst)
+					if len(units) == 0 {
+						continue
+					}
+					for code := codeOf(lo); code <= codeOf(hi); code++ {
+						cmap[code] = string(utf16.Decode(units))
+						units[len(units)-1]++
+					}
+				case []interface{}:
+					for j, item := range dst {
+						if s, ok := item.(contentString); ok {
+							cmap[codeOf(lo)+uint32(j)] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	if width == 0 {
+		width = 1
+	}
+	return cmap, width
+}
+
+// codeOf reads a character code from its bytes
+func codeOf(s contentString) uint32 {
+	var code uint32
+	for _, c := range []byte(s) {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+// utf16Units splits UTF-16BE bytes into units
+func utf16Units(s contentString) []uint16 {
+	b := []byte(s)
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+// utf16BE decodes UTF-16BE bytes
+func utf16BE(s contentString) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// Content stream tokens. Numbers are float64 and arrays []interface{};
+// dictionaries are skipped.
+type (
+	contentOperator string
+	contentName     string
+	contentString   string
+)
+
+// contentLexer splits a content stream, or a CMap, into tokens
+type contentLexer struct {
+	data []byte
+	pos  int
+}
+
+// next returns the next token, or false at the end of the data
+func (l *contentLexer) next() (interface{}, bool) {
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, false
+		}
+
+		c := l.data[l.pos]
+		switch {
+		case c == '(':
+			return l.literal(), true
+		case c == '<' && l.peek(1) == '<':
+			l.skipDict()
+			continue
+		case c == '<':
+			return l.hexString(), true
+		case c == '[':
+			l.pos++
+			var items []interface{}
+			for {
+				l.skipSpace()
+				if l.pos >= len(l.data) {
+					return items, true
+				}
+				if l.data[l.pos] == ']' {
+					l.pos++
+					return items, true
+				}
+				item, ok := l.next()
+				if !ok {
+					return items, true
+				}
+				items = append(items, item)
+			}
+		case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+			l.pos++
+			continue
+		case c == '/':
+			l.pos++
+			return contentName(l.word()), true
+		case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			word := l.word()
+			n, err := strconv.ParseFloat(word, 64)
+			if err != nil {
+				continue
+			}
+			return n, true
+		default:
+			word := l.word()
+			if word == "" {
+				l.pos++
+				continue
+			}
+			if word == "ID" {
+				l.skipInlineImage()
+			}
+			return contentOperator(word), true
+		}
+	}
+}
+
+// peek returns the byte ahead of the current one, or 0
+func (l *contentLexer) peek(ahead int) byte {
+	if l.pos+ahead < len(l.data) {
+		return l.data[l.pos+ahead]
+	}
+	return 0
+}
+
+// skipSpace skips whitespace and comments
+func (l *contentLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// word reads up to the next whitespace or delimiter
+func (l *contentLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literal reads a (string), with its escapes and balanced parentheses
+func (l *contentLexer) literal() contentString {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return contentString(b)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return contentString(b)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return contentString(b)
+}
+
+// hexString reads a <hex string>. An odd final digit is padded with 0.
+func (l *contentLexer) hexString() contentString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return ""
+	}
+	return contentString(b)
+}
+
+// skipDict skips a << dictionary >>, including nested ones
+func (l *contentLexer) skipDict() {
+	depth := 0
+	for l.pos < len(l.data) {
+		switch {
+		case l.data[l.pos] == '(':
+			l.literal()
+			continue
+		case l.data[l.pos] == '<' && l.peek(1) == '<':
+			depth++
+			l.pos += 2
+		case l.data[l.pos] == '>' && l.peek(1) == '>':
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return
+			}
+		default:
+			l.pos++
+		}
+	}
+}
+
+// skipInlineImage skips an inline image's data, which runs from after ID
+// to an EI on its own
+func (l *contentLexer) skipInlineImage() {
+	l.pos++
+	end := bytes.Index(l.data[l.pos:], []byte("EI"))
+	for end >= 0 {
+		at := l.pos + end
+		before := at == 0 || isSpace(l.data[at-1])
+		after := at+2 >= len(l.data) || isSpace(l.data[at+2])
+		if before && after {
+			l.pos = at + 2
+			return
+		}
+		next := bytes.Index(l.data[at+2:], []byte("EI"))
+		if next < 0 {
+			break
+		}
+		end += 2 + next
+	}
+	l.pos = len(l.data)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
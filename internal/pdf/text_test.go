@@ -0,0 +1,92 @@
+package pdf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPDF writes a PDF with one page per content stream. Every page
+// has a Latin-1 font F1, a font F2 with a ToUnicode map, and an image Im1.
+func writeTestPDF(t *testing.T, contents ...string) string {
+	t.Helper()
+
+	cmap := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <0048> <0002> <00E9> endbfchar\n" +
+		"1 beginbfrange <0010> <0012> <0061> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // Pages, filled in below
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(cmap), cmap),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Custom /Encoding /Identity-H /ToUnicode 4 0 R >>",
+		"<< /Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 /Length 1 >>\nstream\n\x00\nendstream",
+	}
+	var kids []string
+	for _, content := range contents {
+		pageNum := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageNum))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R "+
+				"/Resources << /Font << /F1 3 0 R /F2 5 0 R >> /XObject << /Im1 6 0 R >> >> >>", pageNum+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var sb strings.Builder
+	sb.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = sb.Len()
+		fmt.Fprintf(&sb, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := sb.Len()
+	fmt.Fprintf(&sb, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&sb, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&sb, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	path := filepath.Join(t.TempDir(), "test.pdf")
+	require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0644))
+	return path
+}
+
+func TestExtractText(t *testing.T) {
+	path := writeTestPDF(t,
+		// Latin-1 text over two lines, with a kerned word gap and an escape
+		"BT /F1 12 Tf 72 720 Td (Chapter \\(One\\)) Tj 0 -14 Td [(It was a) -300 (dark night.)] TJ ET",
+		// A ToUnicode font: "Hé" then "abc" from the range
+		"BT /F2 12 Tf 72 720 Td <00010002> Tj T* <001000110012> Tj ET",
+		// A scan: an image and no text
+		"q 612 0 0 792 0 0 cm /Im1 Do Q",
+		// A blank page
+		"",
+	)
+
+	pages, err := ExtractText(path)
+	require.NoError(t, err)
+	require.Len(t, pages, 4)
+
+	assert.Equal(t, PageText{Page: 1, Text: "Chapter (One)\nIt was a dark night."}, pages[0])
+	assert.Equal(t, PageText{Page: 2, Text: "Hé\nabc"}, pages[1])
+	assert.Equal(t, PageText{Page: 3, Text: "", ImageOnly: true}, pages[2])
+	assert.Equal(t, PageText{Page: 4, Text: ""}, pages[3])
+}
+
+func TestExtractText_NotAPDF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.pdf")
+	require.NoError(t, os.WriteFile(path, []byte("not a pdf"), 0644))
+
+	_, err := ExtractText(path)
+	assert.Error(t, err)
+}
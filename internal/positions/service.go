@@ -0,0 +1,258 @@
+// Package positions converts places in a book between the forms clients
+// record them in: a chapter index with progress through the chapter, raw
+// character offsets, and EPUB CFIs. For EPUBs the CFI is canonical, so a
+// position or highlight saved by one client opens in the same place in
+// another. Storage is behind the Store interface so the rules can be tested
+// without a database.
+package positions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+var (
+	// ErrInvalidPosition is returned for a CFI or chapter that doesn't
+	// point into the book
+	ErrInvalidPosition = errors.New("invalid position")
+	// ErrUnsupportedFormat is returned when converting positions in a book
+	// that isn't an EPUB, which CFIs don't address
+	ErrUnsupportedFormat = errors.New("CFIs are only supported for EPUBs")
+)
+
+// Store is the subset of storage.Database the position service uses
+type Store interface {
+	GetBook(id string) (*models.Book, error)
+	GetReadingPositionsForBook(bookID string) ([]models.ReadingPosition, error)
+	SetReadingPositionCFI(bookID, userID, cfi string) error
+	ListAnnotationsWithoutCFI(bookID string) ([]*models.Annotation, error)
+	SetAnnotationCFI(annotationID, cfi string) error
+	ListBooksWithoutCFIs() ([]string, error)
+}
+
+// Service implements position conversions on top of a Store
+type Service struct {
+	store Store
+}
+
+// NewService creates a position service
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+// Location is a place in an EPUB in each form clients use
+type Location struct {
+	Chapter  int     `json:"chapter"`  // Index into the table of contents
+	Progress float64 `json:"progress"` // Fraction of the chapter's text before it, from 0 to 1
+	Offset   int     `json:"offset"`   // Characters of the chapter's text before it
+	CFI      string  `json:"cfi"`
+}
+
+// invalid wraps an error from the epub package that means the position is
+// at fault rather than the file
+func invalid(err error) error {
+	if errors.Is(err, epub.ErrInvalidCFI) || errors.Is(err, epub.ErrChapterNotFound) {
+		return fmt.Errorf("%w: %v", ErrInvalidPosition, err)
+	}
+	return err
+}
+
+// FromCFI resolves a CFI in book. The CFI returned is its canonical form,
+// pointing at a character of text, which is what a range or an element's
+// CFI from another reader resolves to.
+func (s *Service) FromCFI(book *models.Book, cfi string) (*Location, error) {
+	if book.FileFormat != models.FileFormatEPUB {
+		return nil, ErrUnsupportedFormat
+	}
+	loc, err := epub.ResolveCFI(book.FilePath, cfi)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	canonical, err := epub.OffsetCFI(book.FilePath, loc.Chapter, loc.Offset)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return &Location{Chapter: loc.Chapter, Progress: loc.Progress, Offset: loc.Offset, CFI: canonical}, nil
+}
+
+// FromChapter returns the location progress of the way through a chapter
+func (s *Service) FromChapter(book *models.Book, chapter int, progress float64) (*Location, error) {
+	if book.FileFormat != models.FileFormatEPUB {
+		return nil, ErrUnsupportedFormat
+	}
+	progress = max(0, min(progress, 1))
+	cfi, err := epub.ChapterCFI(book.FilePath, chapter, progress)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return s.FromCFI(book, cfi)
+}
+
+// FromOffset returns the location offset characters into a chapter's text
+func (s *Service) FromOffset(book *models.Book, chapter, offset int) (*Location, error) {
+	if book.FileFormat != models.FileFormatEPUB {
+		return nil, ErrUnsupportedFormat
+	}
+	cfi, err := epub.OffsetCFI(book.FilePath, chapter, max(0, offset))
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return s.FromCFI(book, cfi)
+}
+
+// NormalizePosition completes a reading position in an EPUB. One saved with
+// a CFI gets the chapter and progress it resolves to; a legacy one with only
+// a chapter and progress gets its CFI. Positions in other formats are left
+// as they are.
+func (s *Service) NormalizePosition(book *models.Book, pos *models.ReadingPosition) error {
+	if book.FileFormat != models.FileFormatEPUB {
+		pos.CFI = ""
+		return nil
+	}
+	if pos.CFI != "" {
+		loc, err := s.FromCFI(book, pos.CFI)
+		if err != nil {
+			return err
+		}
+		pos.Chapter, pos.Position, pos.CFI = strconv.Itoa(loc.Chapter), loc.Progress, loc.CFI
+		return nil
+	}
+
+	chapter, err := strconv.Atoi(pos.Chapter)
+	if err != nil {
+		return fmt.Errorf("%w: chapter %q isn't an index", ErrInvalidPosition, pos.Chapter)
+	}
+	loc, err := s.FromChapter(book, chapter, pos.Position)
+	if err != nil {
+		return err
+	}
+	// The progress saved is kept, as the CFI only approximates it
+	pos.CFI = loc.CFI
+	return nil
+}
+
+// NormalizeAnnotation completes an annotation in an EPUB. One created with
+// a CFI is moved to the chapter it resolves to. Otherwise the CFI is that
+// of the start of its selected text in its chapter, or failing that of its
+// start offset. An annotation neither finds keeps an empty CFI.
+func (s *Service) NormalizeAnnotation(book *models.Book, ann *models.Annotation) error {
+	if book.FileFormat != models.FileFormatEPUB {
+		return nil
+	}
+	if ann.CFI != "" {
+		loc, err := s.FromCFI(book, ann.CFI)
+		if err != nil {
+			return err
+		}
+		ann.Chapter, ann.CFI = strconv.Itoa(loc.Chapter), loc.CFI
+		return nil
+	}
+
+	chapter, err := strconv.Atoi(ann.Chapter)
+	if err != nil {
+		return fmt.Errorf("%w: chapter %q isn't an index", ErrInvalidPosition, ann.Chapter)
+	}
+	cfi, err := epub.TextCFI(book.FilePath, chapter, ann.SelectedText)
+	if errors.Is(err, epub.ErrTextNotFound) {
+		if ann.StartOffset <= 0 {
+			return nil
+		}
+		cfi, err = epub.OffsetCFI(book.FilePath, chapter, ann.StartOffset)
+	}
+	if err != nil {
+		return invalid(err)
+	}
+	ann.CFI = cfi
+	return nil
+}
+
+// Result is what normalizing records did
+type Result struct {
+	Positions   int // Reading positions given a CFI
+	Annotations int // Annotations given a CFI
+	Failed      int // Records that couldn't be placed, left without one
+}
+
+func (r *Result) add(other *Result) {
+	r.Positions += other.Positions
+	r.Annotations += other.Annotations
+	r.Failed += other.Failed
+}
+
+// NormalizeBook gives every reading position and annotation in a book that
+// has no CFI one. Nothing changes for the readers, so no timestamps move.
+func (s *Service) NormalizeBook(book *models.Book) (*Result, error) {
+	result := &Result{}
+	if book.FileFormat != models.FileFormatEPUB || book.FilePath == "" {
+		return result, nil
+	}
+
+	positions, err := s.store.GetReadingPositionsForBook(book.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, pos := range positions {
+		if pos.CFI != "" {
+			continue
+		}
+		if err := s.NormalizePosition(book, &pos); err != nil || pos.CFI == "" {
+			result.Failed++
+			continue
+		}
+		if err := s.store.SetReadingPositionCFI(pos.BookID, pos.UserID, pos.CFI); err != nil {
+			return nil, err
+		}
+		result.Positions++
+	}
+
+	annotations, err := s.store.ListAnnotationsWithoutCFI(book.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ann := range annotations {
+		if err := s.NormalizeAnnotation(book, ann); err != nil || ann.CFI == "" {
+			result.Failed++
+			continue
+		}
+		if err := s.store.SetAnnotationCFI(ann.ID, ann.CFI); err != nil {
+			return nil, err
+		}
+		result.Annotations++
+	}
+	return result, nil
+}
+
+// NormalizeAll converts the legacy records of every EPUB that has any,
+// stopping early when ctx is done. A book that fails is logged and
+// skipped.
+func (s *Service) NormalizeAll(ctx context.Context) (*Result, error) {
+	ids, err := s.store.ListBooksWithoutCFIs()
+	if err != nil {
+		return nil, err
+	}
+
+	total := &Result{}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		book, err := s.store.GetBook(id)
+		if err != nil {
+			log.Printf("Warning: failed to fetch book %s: %v", id, err)
+			continue
+		}
+		result, err := s.NormalizeBook(book)
+		if err != nil {
+			log.Printf("Warning: failed to normalize positions in %s: %v", id, err)
+			continue
+		}
+		total.add(result)
+	}
+	return total, nil
+}
@@ -0,0 +1,230 @@
+package positions
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// fakeStore keeps positions and annotations in memory
+type fakeStore struct {
+	books       map[string]*models.Book
+	positions   []models.ReadingPosition
+	annotations []*models.Annotation
+}
+
+func (f *fakeStore) GetBook(id string) (*models.Book, error) {
+	book, ok := f.books[id]
+	if !ok {
+		return nil, fmt.Errorf("book %s not found", id)
+	}
+	return book, nil
+}
+
+func (f *fakeStore) GetReadingPositionsForBook(bookID string) ([]models.ReadingPosition, error) {
+	var positions []models.ReadingPosition
+	for _, pos := range f.positions {
+		if pos.BookID == bookID {
+			positions = append(positions, pos)
+		}
+	}
+	return positions, nil
+}
+
+func (f *fakeStore) SetReadingPositionCFI(bookID, userID, cfi string) error {
+	for i := range f.positions {
+		if f.positions[i].BookID == bookID && f.positions[i].UserID == userID {
+			f.positions[i].CFI = cfi
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) ListAnnotationsWithoutCFI(bookID string) ([]*models.Annotation, error) {
+	var annotations []*models.Annotation
+	for _, ann := range f.annotations {
+		if ann.BookID == bookID && ann.CFI == "" {
+			copied := *ann
+			annotations = append(annotations, &copied)
+		}
+	}
+	return annotations, nil
+}
+
+func (f *fakeStore) SetAnnotationCFI(annotationID, cfi string) error {
+	for _, ann := range f.annotations {
+		if ann.ID == annotationID {
+			ann.CFI = cfi
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) ListBooksWithoutCFIs() ([]string, error) {
+	pending := make(map[string]bool)
+	for _, pos := range f.positions {
+		pending[pos.BookID] = pending[pos.BookID] || pos.CFI == ""
+	}
+	for _, ann := range f.annotations {
+		pending[ann.BookID] = pending[ann.BookID] || ann.CFI == ""
+	}
+	var ids []string
+	for id, ok := range pending {
+		if ok && f.books[id].FileFormat == models.FileFormatEPUB {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// writeEPUB writes an EPUB with a chapter for each body
+func writeEPUB(t *testing.T, bodies ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "book.epub")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	defer out.Close()
+
+	var manifest, spine strings.Builder
+	w := zip.NewWriter(out)
+	for i, body := range bodies {
+		id := fmt.Sprintf("ch%d", i+1)
+		fmt.Fprintf(&manifest, `<item id="%s" href="%s.xhtml" media-type="application/xhtml+xml"/>`, id, id)
+		fmt.Fprintf(&spine, `<itemref idref="%s"/>`, id)
+		f, err := w.Create("OEBPS/" + id + ".xhtml")
+		require.NoError(t, err)
+		f.Write([]byte(`<html xmlns="http://www.w3.org/1999/xhtml"><body>` + body + `</body></html>`))
+	}
+	files := map[string]string{
+		"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+		"OEBPS/content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Positions</dc:title></metadata>
+  <manifest>` + manifest.String() + `</manifest>
+  <spine>` + spine.String() + `</spine>
+</package>`,
+	}
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, w.Close())
+	return path
+}
+
+func testBook(t *testing.T) *models.Book {
+	return &models.Book{
+		ID:         "book-1",
+		FileFormat: models.FileFormatEPUB,
+		FilePath: writeEPUB(t,
+			"<p>Foreword.</p>",
+			"<p>It was a dark and stormy night; the rain fell in torrents.</p>",
+		),
+	}
+}
+
+func TestConversions(t *testing.T) {
+	svc := NewService(&fakeStore{})
+	book := testBook(t)
+
+	loc, err := svc.FromChapter(book, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:0)", loc.CFI)
+
+	// Another reader's range CFI resolves to its start, in canonical form
+	loc, err = svc.FromCFI(book, "epubcfi(/6/4[ch2]!/4/2,/1:7,/1:11)")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loc.Chapter)
+	assert.Equal(t, 7, loc.Offset)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:7)", loc.CFI)
+	assert.Greater(t, loc.Progress, 0.0)
+
+	loc, err = svc.FromOffset(book, 1, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:7)", loc.CFI)
+
+	_, err = svc.FromCFI(book, "not a cfi")
+	assert.ErrorIs(t, err, ErrInvalidPosition)
+	_, err = svc.FromChapter(book, 5, 0)
+	assert.ErrorIs(t, err, ErrInvalidPosition)
+	_, err = svc.FromChapter(&models.Book{FileFormat: models.FileFormatPDF}, 0, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestNormalize(t *testing.T) {
+	book := testBook(t)
+	svc := NewService(&fakeStore{})
+
+	// A client that only knows CFIs gets the chapter and progress
+	pos := &models.ReadingPosition{CFI: "epubcfi(/6/4[ch2]!/4/2/1:7)"}
+	require.NoError(t, svc.NormalizePosition(book, pos))
+	assert.Equal(t, "1", pos.Chapter)
+	assert.Greater(t, pos.Position, 0.0)
+
+	// and one that only knows chapters gets the CFI, keeping its progress
+	pos = &models.ReadingPosition{Chapter: "1", Position: 0.5}
+	require.NoError(t, svc.NormalizePosition(book, pos))
+	assert.Equal(t, 0.5, pos.Position)
+	assert.True(t, strings.HasPrefix(pos.CFI, "epubcfi(/6/4[ch2]!"), pos.CFI)
+
+	pos = &models.ReadingPosition{Chapter: "intro"}
+	assert.ErrorIs(t, svc.NormalizePosition(book, pos), ErrInvalidPosition)
+
+	ann := &models.Annotation{Chapter: "0", CFI: "epubcfi(/6/4[ch2]!/4/2/1:0)"}
+	require.NoError(t, svc.NormalizeAnnotation(book, ann))
+	assert.Equal(t, "1", ann.Chapter, "the CFI decides the chapter")
+
+	ann = &models.Annotation{Chapter: "1", SelectedText: "the rain\n fell"}
+	require.NoError(t, svc.NormalizeAnnotation(book, ann))
+	assert.Equal(t, fmt.Sprintf("epubcfi(/6/4[ch2]!/4/2/1:%d)", len("It was a dark and stormy night; ")), ann.CFI)
+
+	ann = &models.Annotation{Chapter: "1", SelectedText: "edited since", StartOffset: 7}
+	require.NoError(t, svc.NormalizeAnnotation(book, ann))
+	assert.Equal(t, "epubcfi(/6/4[ch2]!/4/2/1:7)", ann.CFI, "falls back to the raw offset")
+
+	ann = &models.Annotation{Chapter: "1", SelectedText: "edited since"}
+	require.NoError(t, svc.NormalizeAnnotation(book, ann))
+	assert.Empty(t, ann.CFI)
+}
+
+func TestNormalizeAll(t *testing.T) {
+	book := testBook(t)
+	store := &fakeStore{
+		books: map[string]*models.Book{
+			book.ID: book,
+			"pdf":   {ID: "pdf", FileFormat: models.FileFormatPDF, FilePath: "book.pdf"},
+		},
+		positions: []models.ReadingPosition{
+			{BookID: book.ID, UserID: "user-1", Chapter: "1", Position: 0.25},
+			{BookID: book.ID, UserID: "user-2", Chapter: "0", CFI: "epubcfi(/6/2[ch1]!/4/2/1:0)"},
+			{BookID: "pdf", UserID: "user-1", Chapter: "12"},
+		},
+		annotations: []*models.Annotation{
+			{ID: "ann-1", BookID: book.ID, Chapter: "1", SelectedText: "stormy night"},
+			{ID: "ann-2", BookID: book.ID, Chapter: "1", SelectedText: "not in the book"},
+		},
+	}
+	svc := NewService(store)
+
+	result, err := svc.NormalizeAll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Positions: 1, Annotations: 1, Failed: 1}, result)
+	assert.NotEmpty(t, store.positions[0].CFI)
+	assert.Equal(t, "epubcfi(/6/2[ch1]!/4/2/1:0)", store.positions[1].CFI, "CFIs already saved are kept")
+	assert.Empty(t, store.positions[2].CFI, "PDFs aren't addressed by CFIs")
+	assert.Equal(t, fmt.Sprintf("epubcfi(/6/4[ch2]!/4/2/1:%d)", len("It was a dark and ")), store.annotations[0].CFI)
+	assert.Empty(t, store.annotations[1].CFI)
+}
@@ -0,0 +1,185 @@
+// Package search matches free text against book fields forgivingly: case,
+// accents, and word boundaries are ignored, camel-cased words are split,
+// and a single typo in a longer word still matches, so "tolkein" finds
+// Tolkien and "lecarre" finds le Carré.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// How well a query word matches a word of a field
+const (
+	matchExact     = 1.0
+	matchPrefix    = 0.8
+	matchTypo      = 0.6
+	matchSubstring = 0.5
+)
+
+// minTypoLength is the shortest query word a typo is forgiven in; shorter
+// words are too easily one edit away from unrelated ones
+const minTypoLength = 4
+
+// minSubstringLength is the shortest query word matched inside a word
+const minSubstringLength = 3
+
+// Field is text to match a query against, with a weight saying how much a
+// match in it counts for
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+// Query is search text split into the words each result must match
+type Query struct {
+	words  []string
+	phrase string
+}
+
+// NewQuery parses search text
+func NewQuery(text string) *Query {
+	words := Tokens(text)
+	return &Query{words: words, phrase: strings.Join(words, " ")}
+}
+
+// Empty reports whether the query has no words to match, such as when it
+// is only punctuation
+func (q *Query) Empty() bool {
+	return len(q.words) == 0
+}
+
+// Score rates how well fields match the query. Every query word must match
+// a word of some field, exactly, as a prefix, inside it, or with one typo,
+// or be found in the field with its spaces removed; otherwise the score is
+// 0. Better matches in heavier fields score higher, and the whole query
+// appearing in a field, or being all of it, adds more.
+func (q *Query) Score(fields ...Field) float64 {
+	if q.Empty() {
+		return 0
+	}
+
+	tokenized := make([][]string, len(fields))
+	compact := make([]string, len(fields))
+	for i, f := range fields {
+		tokenized[i] = Tokens(f.Text)
+		compact[i] = strings.Join(tokenized[i], "")
+	}
+
+	var score float64
+	for _, word := range q.words {
+		var best float64
+		for i, f := range fields {
+			for _, token := range tokenized[i] {
+				if m := matchWord(word, token) * f.Weight; m > best {
+					best = m
+				}
+			}
+			// A word written without the field's spaces or hyphens, like
+			// "spiderman" for "Spider-Man"
+			if m := matchSubstring * f.Weight; m > best && len([]rune(word)) >= minSubstringLength && strings.Contains(compact[i], word) {
+				best = m
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+
+	for i, f := range fields {
+		joined := strings.Join(tokenized[i], " ")
+		if joined == q.phrase {
+			score += 2 * f.Weight
+		} else if len(q.words) > 1 && strings.Contains(joined, q.phrase) {
+			score += f.Weight
+		}
+	}
+	return score
+}
+
+// matchWord rates how well a query word matches one word of a field
+func matchWord(word, token string) float64 {
+	switch {
+	case word == token:
+		return matchExact
+	case strings.HasPrefix(token, word):
+		return matchPrefix
+	case len([]rune(word)) >= minTypoLength && withinOneEdit(word, token):
+		return matchTypo
+	case len([]rune(word)) >= minSubstringLength && strings.Contains(token, word):
+		return matchSubstring
+	}
+	return 0
+}
+
+// withinOneEdit reports whether a and b differ by at most one inserted,
+// deleted, or replaced letter, or two swapped neighbouring letters
+func withinOneEdit(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) > len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(rb)-len(ra) > 1 {
+		return false
+	}
+
+	i := 0
+	for i < len(ra) && ra[i] == rb[i] {
+		i++
+	}
+	if i == len(ra) {
+		return true
+	}
+	if len(ra) == len(rb) {
+		rest := string(ra[i+1:]) == string(rb[i+1:])
+		swapped := i+1 < len(ra) && ra[i] == rb[i+1] && ra[i+1] == rb[i] && string(ra[i+2:]) == string(rb[i+2:])
+		return rest || swapped
+	}
+	return string(ra[i:]) == string(rb[i+1:])
+}
+
+// Tokens splits text into lowercase words without accents. Words break at
+// anything other than a letter or digit, between letters and digits, and
+// where camel case starts a new word, so "McBook2go" gives "mc", "book",
+// "2", "go" and "XMLParser" gives "xml", "parser".
+func Tokens(text string) []string {
+	var runes []rune
+	for _, r := range norm.NFD.String(text) {
+		if !unicode.Is(unicode.Mn, r) {
+			runes = append(runes, r)
+		}
+	}
+
+	var tokens []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if len(current) > 0 {
+			prev := current[len(current)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			switch {
+			case unicode.IsDigit(prev) != unicode.IsDigit(r):
+				flush()
+			case unicode.IsLower(prev) && unicode.IsUpper(r):
+				flush()
+			case unicode.IsUpper(prev) && unicode.IsUpper(r) && nextLower:
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,56 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The Hobbit", []string{"the", "hobbit"}},
+		{"Le Carré", []string{"le", "carre"}},
+		{"Spider-Man 2099", []string{"spider", "man", "2099"}},
+		{"McBook2go", []string{"mc", "book", "2", "go"}},
+		{"XMLParser", []string{"xml", "parser"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Tokens(tt.text), tt.text)
+	}
+}
+
+func TestWithinOneEdit(t *testing.T) {
+	assert.True(t, withinOneEdit("tolkein", "tolkien"), "swapped letters")
+	assert.True(t, withinOneEdit("tolkin", "tolkien"), "missing letter")
+	assert.True(t, withinOneEdit("tolkiens", "tolkien"), "extra letter")
+	assert.True(t, withinOneEdit("tolkian", "tolkien"), "wrong letter")
+	assert.True(t, withinOneEdit("tolkien", "tolkien"))
+	assert.False(t, withinOneEdit("tolkan", "tolkien"))
+	assert.False(t, withinOneEdit("tlokein", "tolkien"))
+}
+
+func TestScore(t *testing.T) {
+	book := func(title, author, series, subjects string) []Field {
+		return []Field{{title, 3}, {author, 2}, {series, 2}, {subjects, 1}}
+	}
+	hobbit := book("The Hobbit", "J. R. R. Tolkien", "Middle-earth", "Fantasy, Dragons")
+	spy := book("The Spy Who Came in from the Cold", "John le Carré", "George Smiley", "Espionage")
+
+	assert.Greater(t, NewQuery("tolkein").Score(hobbit...), 0.0)
+	assert.Greater(t, NewQuery("hob").Score(hobbit...), 0.0, "prefix")
+	assert.Greater(t, NewQuery("middleearth").Score(hobbit...), 0.0, "without the hyphen")
+	assert.Greater(t, NewQuery("lecarre").Score(spy...), 0.0)
+	assert.Greater(t, NewQuery("dragons tolkien").Score(hobbit...), 0.0, "words from different fields")
+	assert.Zero(t, NewQuery("tolkien smiley").Score(hobbit...), "every word must match")
+	assert.Zero(t, NewQuery("dne").Score(book("Dune", "", "", "")...), "no typos in short words")
+	assert.Zero(t, NewQuery("?!").Score(hobbit...))
+
+	// Exact words beat typos, and titles beat subjects
+	assert.Greater(t, NewQuery("tolkien").Score(hobbit...), NewQuery("tolkein").Score(hobbit...))
+	assert.Greater(t, NewQuery("spy").Score(book("Spy", "", "", "")...), NewQuery("spy").Score(book("Dune", "", "", "Spy")...))
+	assert.Greater(t, NewQuery("the hobbit").Score(hobbit...), NewQuery("hobbit the").Score(hobbit...), "the whole title")
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Achievement Methods ====================
+
+// ListCompletedBookSubjects returns the comma-separated subjects of each
+// book a user has finished that has any
+func (d *Database) ListCompletedBookSubjects(userID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT b.subjects FROM user_book_state s
+		INNER JOIN books b ON b.id = s.book_id
+		WHERE s.user_id = ? AND s.read_status = ? AND COALESCE(b.subjects, '') != ''`,
+		userID, models.ReadStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subjects []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, s)
+	}
+	return subjects, rows.Err()
+}
+
+// GetUserAchievements returns when a user earned each of their achievements,
+// keyed by achievement ID
+func (d *Database) GetUserAchievements(userID string) (map[string]time.Time, error) {
+	rows, err := d.db.Query(`SELECT achievement, earned_at FROM user_achievements WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	earned := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		earned[id] = at
+	}
+	return earned, rows.Err()
+}
+
+// AwardAchievement records that a user earned an achievement. It returns
+// false if they already had it.
+func (d *Database) AwardAchievement(userID, achievementID string, at time.Time) (bool, error) {
+	result, err := d.db.Exec(`
+		INSERT OR IGNORE INTO user_achievements (user_id, achievement, earned_at)
+		VALUES (?, ?, ?)`, userID, achievementID, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
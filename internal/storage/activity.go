@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Activity Methods ====================
+
+// GetActivityPreferences returns what a user publishes to the activity feed.
+// Users who haven't saved any publish nothing.
+func (d *Database) GetActivityPreferences(userID string) (*models.ActivityPreferences, error) {
+	p := &models.ActivityPreferences{UserID: userID}
+	err := d.db.QueryRow(`
+		SELECT publish_added, publish_finished, publish_rated, updated_at
+		FROM activity_preferences WHERE user_id = ?`, userID).Scan(
+		&p.PublishAdded, &p.PublishFinished, &p.PublishRated, &p.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return &models.ActivityPreferences{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SaveActivityPreferences creates or replaces a user's activity settings
+func (d *Database) SaveActivityPreferences(p *models.ActivityPreferences) error {
+	_, err := d.db.Exec(`
+		INSERT INTO activity_preferences (user_id, publish_added, publish_finished, publish_rated, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			publish_added = excluded.publish_added,
+			publish_finished = excluded.publish_finished,
+			publish_rated = excluded.publish_rated,
+			updated_at = excluded.updated_at`,
+		p.UserID, p.PublishAdded, p.PublishFinished, p.PublishRated, p.UpdatedAt,
+	)
+	return err
+}
+
+// RecordActivity saves an activity event, replacing the user's previous
+// event of the same type for the book
+func (d *Database) RecordActivity(event *models.ActivityEvent) error {
+	_, err := d.db.Exec(`
+		INSERT INTO activity_events (id, user_id, type, book_id, rating, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, type, book_id) DO UPDATE SET
+			id = excluded.id,
+			rating = excluded.rating,
+			created_at = excluded.created_at`,
+		event.ID, event.UserID, event.Type, event.BookID, event.Rating, event.CreatedAt,
+	)
+	return err
+}
+
+// DeleteActivity removes a user's event of a type for a book, such as when
+// a finished book is marked unread again
+func (d *Database) DeleteActivity(userID, eventType, bookID string) error {
+	_, err := d.db.Exec(`DELETE FROM activity_events WHERE user_id = ? AND type = ? AND book_id = ?`,
+		userID, eventType, bookID)
+	return err
+}
+
+// ListActivityFeed returns the newest activity of a user and the users they
+// share books with, in either direction. Events whose type their author has
+// since stopped publishing, or whose author is in privacy mode, are left out.
+func (d *Database) ListActivityFeed(userID string, limit int) ([]*models.ActivityEvent, error) {
+	rows, err := d.db.Query(`
+		SELECT e.id, e.user_id, e.type, e.book_id, e.rating, e.created_at, u.username, b.title, b.author
+		FROM activity_events e
+		INNER JOIN users u ON u.id = e.user_id
+		INNER JOIN books b ON b.id = e.book_id
+		INNER JOIN activity_preferences p ON p.user_id = e.user_id
+		LEFT JOIN stats_preferences sp ON sp.user_id = e.user_id
+		WHERE COALESCE(sp.privacy_mode, 0) = 0
+			AND (e.user_id = ?
+				OR e.user_id IN (SELECT shared_with_id FROM book_shares WHERE owner_id = ?)
+				OR e.user_id IN (SELECT owner_id FROM book_shares WHERE shared_with_id = ?))
+			AND ((e.type = ? AND p.publish_added = 1)
+				OR (e.type = ? AND p.publish_finished = 1)
+				OR (e.type = ? AND p.publish_rated = 1))
+		ORDER BY e.created_at DESC
+		LIMIT ?`,
+		userID, userID, userID,
+		models.ActivityBookAdded, models.ActivityBookFinished, models.ActivityBookRated, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.ActivityEvent
+	for rows.Next() {
+		e := &models.ActivityEvent{}
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &e.BookID, &e.Rating, &e.CreatedAt,
+			&e.Username, &e.BookTitle, &e.BookAuthor); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
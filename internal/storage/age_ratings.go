@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Age Rating Methods ====================
+
+// UpdateBookAgeRating sets who a book is suitable for, "" for unrated
+func (d *Database) UpdateBookAgeRating(bookID, rating string) error {
+	_, err := d.db.Exec(`UPDATE books SET age_rating = ? WHERE id = ?`, rating, bookID)
+	return err
+}
+
+// GetUserMaxAgeRating returns the highest age rating a user may see, or ""
+// if they are unrestricted or don't exist
+func (d *Database) GetUserMaxAgeRating(userID string) (string, error) {
+	var max string
+	err := d.db.QueryRow(`SELECT max_age_rating FROM users WHERE id = ?`, userID).Scan(&max)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return max, err
+}
+
+// SetUserMaxAgeRating sets the highest age rating a user may see, "" to
+// lift their restriction
+func (d *Database) SetUserMaxAgeRating(userID, max string) error {
+	_, err := d.db.Exec(`UPDATE users SET max_age_rating = ? WHERE id = ?`, max, userID)
+	return err
+}
+
+// ListContentRestrictions returns the users with a content restriction, by
+// username
+func (d *Database) ListContentRestrictions() ([]models.ContentRestriction, error) {
+	rows, err := d.db.Query(`
+		SELECT id, username, max_age_rating FROM users
+		WHERE max_age_rating != ''
+		ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var restrictions []models.ContentRestriction
+	for rows.Next() {
+		var r models.ContentRestriction
+		if err := rows.Scan(&r.UserID, &r.Username, &r.MaxAgeRating); err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+	return restrictions, rows.Err()
+}
+
+// IsBookHiddenFrom reports whether a user's content restriction hides a
+// book from them
+func (d *Database) IsBookHiddenFrom(bookID, userID string) (bool, error) {
+	max, err := d.GetUserMaxAgeRating(userID)
+	if err != nil || max == "" {
+		return false, err
+	}
+	var rating string
+	err = d.db.QueryRow(`SELECT age_rating FROM books WHERE id = ?`, bookID).Scan(&rating)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !models.AgeRatingAllowed(max, rating), nil
+}
+
+// HiddenBookIDs returns the IDs of the books a user's content restriction
+// hides from them, or nil if they are unrestricted
+func (d *Database) HiddenBookIDs(userID string) (map[string]bool, error) {
+	max, err := d.GetUserMaxAgeRating(userID)
+	if err != nil || max == "" {
+		return nil, err
+	}
+
+	in, args := allowedAgeRatings(max)
+	rows, err := d.db.Query(`SELECT id FROM books WHERE age_rating NOT `+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hidden := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden[id] = true
+	}
+	return hidden, rows.Err()
+}
+
+// allowedAgeRatings returns an "IN (?, ...)" condition and its arguments
+// matching the age ratings a user whose content restriction is max may see
+func allowedAgeRatings(max string) (string, []interface{}) {
+	allowed := models.AgeRatingsUpTo(max)
+	args := make([]interface{}, len(allowed))
+	for i, r := range allowed {
+		args[i] = r
+	}
+	return "IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(allowed)), ", ") + ")", args
+}
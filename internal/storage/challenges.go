@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Reading Challenge Methods ====================
+
+// challengeColumns is the column list scanned by queryReadingChallenges. Its
+// placeholder is the user whose participation is reported as Joined.
+const challengeColumns = `c.id, c.owner_id, c.name, c.description, c.metric, c.target, c.starts_at, c.ends_at,
+	c.created_at, u.username,
+	(SELECT COUNT(*) FROM reading_challenge_participants WHERE challenge_id = c.id AND joined_at IS NOT NULL),
+	EXISTS (SELECT 1 FROM reading_challenge_participants
+		WHERE challenge_id = c.id AND user_id = ? AND joined_at IS NOT NULL)`
+
+// CreateReadingChallenge creates a challenge with its owner taking part and
+// the other users invited
+func (d *Database) CreateReadingChallenge(ch *models.ReadingChallenge, inviteeIDs []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO reading_challenges (id, owner_id, name, description, metric, target, starts_at, ends_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ch.ID, ch.OwnerID, ch.Name, ch.Description, ch.Metric, ch.Target, ch.StartsAt, ch.EndsAt, ch.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO reading_challenge_participants (challenge_id, user_id, invited_at, joined_at)
+		VALUES (?, ?, ?, ?)`,
+		ch.ID, ch.OwnerID, ch.CreatedAt, ch.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, userID := range inviteeIDs {
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO reading_challenge_participants (challenge_id, user_id, invited_at)
+			VALUES (?, ?, ?)`,
+			ch.ID, userID, ch.CreatedAt,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetReadingChallenge returns a challenge by ID, with whether userID takes
+// part, or sql.ErrNoRows if there is none
+func (d *Database) GetReadingChallenge(challengeID, userID string) (*models.ReadingChallenge, error) {
+	challenges, err := d.queryReadingChallenges(`
+		SELECT `+challengeColumns+`
+		FROM reading_challenges c
+		INNER JOIN users u ON u.id = c.owner_id
+		WHERE c.id = ?`, userID, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(challenges) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return challenges[0], nil
+}
+
+// ListReadingChallengesForUser returns the challenges a user takes part in
+// or is invited to, the latest to end first
+func (d *Database) ListReadingChallengesForUser(userID string) ([]*models.ReadingChallenge, error) {
+	return d.queryReadingChallenges(`
+		SELECT `+challengeColumns+`
+		FROM reading_challenges c
+		INNER JOIN users u ON u.id = c.owner_id
+		INNER JOIN reading_challenge_participants p ON p.challenge_id = c.id
+		WHERE p.user_id = ?
+		ORDER BY c.ends_at DESC, c.created_at DESC`, userID, userID)
+}
+
+// DeleteReadingChallenge deletes a challenge. Badges earned in it are kept.
+func (d *Database) DeleteReadingChallenge(challengeID string) error {
+	_, err := d.db.Exec(`DELETE FROM reading_challenges WHERE id = ?`, challengeID)
+	return err
+}
+
+// queryReadingChallenges runs a challenge query and scans the results
+func (d *Database) queryReadingChallenges(query string, args ...interface{}) ([]*models.ReadingChallenge, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var challenges []*models.ReadingChallenge
+	for rows.Next() {
+		c := &models.ReadingChallenge{}
+		if err := rows.Scan(&c.ID, &c.OwnerID, &c.Name, &c.Description, &c.Metric, &c.Target, &c.StartsAt, &c.EndsAt,
+			&c.CreatedAt, &c.OwnerUsername, &c.ParticipantCount, &c.Joined); err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, c)
+	}
+	return challenges, rows.Err()
+}
+
+// ==================== Challenge Participant Methods ====================
+
+// ListChallengeParticipants returns everyone invited to a challenge, those
+// taking part first
+func (d *Database) ListChallengeParticipants(challengeID string) ([]*models.ChallengeParticipant, error) {
+	rows, err := d.db.Query(`
+		SELECT p.user_id, u.username, p.invited_at, p.joined_at
+		FROM reading_challenge_participants p
+		INNER JOIN users u ON u.id = p.user_id
+		WHERE p.challenge_id = ?
+		ORDER BY p.joined_at IS NULL, u.username`, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []*models.ChallengeParticipant
+	for rows.Next() {
+		p := &models.ChallengeParticipant{}
+		if err := rows.Scan(&p.UserID, &p.Username, &p.InvitedAt, &p.JoinedAt); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
+
+// GetChallengeParticipant returns a user's invitation to a challenge, or
+// sql.ErrNoRows if they weren't invited
+func (d *Database) GetChallengeParticipant(challengeID, userID string) (*models.ChallengeParticipant, error) {
+	p := &models.ChallengeParticipant{}
+	err := d.db.QueryRow(`
+		SELECT p.user_id, u.username, p.invited_at, p.joined_at
+		FROM reading_challenge_participants p
+		INNER JOIN users u ON u.id = p.user_id
+		WHERE p.challenge_id = ? AND p.user_id = ?`, challengeID, userID,
+	).Scan(&p.UserID, &p.Username, &p.InvitedAt, &p.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// InviteChallengeParticipant invites a user to a challenge
+func (d *Database) InviteChallengeParticipant(challengeID, userID string, at time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT OR IGNORE INTO reading_challenge_participants (challenge_id, user_id, invited_at)
+		VALUES (?, ?, ?)`, challengeID, userID, at)
+	return err
+}
+
+// JoinReadingChallenge records that an invited user takes part
+func (d *Database) JoinReadingChallenge(challengeID, userID string, at time.Time) error {
+	_, err := d.db.Exec(`
+		UPDATE reading_challenge_participants SET joined_at = ?
+		WHERE challenge_id = ? AND user_id = ? AND joined_at IS NULL`, at, challengeID, userID)
+	return err
+}
+
+// RemoveChallengeParticipant removes a user, or their invitation, from a
+// challenge
+func (d *Database) RemoveChallengeParticipant(challengeID, userID string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM reading_challenge_participants WHERE challenge_id = ? AND user_id = ?`, challengeID, userID)
+	return err
+}
+
+// challengeProgress is the subquery counting a participant's progress in
+// each metric between two times
+var challengeProgress = map[string]string{
+	models.ChallengeMetricPages: `SELECT COALESCE(SUM(pages_read), 0) FROM reading_sessions
+		WHERE user_id = p.user_id AND start_time BETWEEN ? AND ?`,
+	models.ChallengeMetricMinutes: `SELECT COALESCE(SUM(duration_seconds), 0) / 60 FROM reading_sessions
+		WHERE user_id = p.user_id AND start_time BETWEEN ? AND ?`,
+	models.ChallengeMetricBooks: `SELECT COUNT(*) FROM user_book_state
+		WHERE user_id = p.user_id AND read_status = 'completed' AND date_completed BETWEEN ? AND ?`,
+}
+
+// GetChallengeStandings returns the leaderboard of a challenge's
+// participants, computed from their reading between its start and end.
+// Invited users who haven't joined aren't on it.
+func (d *Database) GetChallengeStandings(ch *models.ReadingChallenge) ([]models.ChallengeStanding, error) {
+	progress, ok := challengeProgress[ch.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown challenge metric %q", ch.Metric)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT p.user_id, u.username, (`+progress+`) AS progress
+		FROM reading_challenge_participants p
+		INNER JOIN users u ON u.id = p.user_id
+		WHERE p.challenge_id = ? AND p.joined_at IS NOT NULL
+		ORDER BY progress DESC, u.username`, ch.StartsAt, ch.EndsAt, ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []models.ChallengeStanding
+	for rows.Next() {
+		var s models.ChallengeStanding
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Progress); err != nil {
+			return nil, err
+		}
+		s.Rank = len(standings) + 1
+		if prev := len(standings) - 1; prev >= 0 && standings[prev].Progress == s.Progress {
+			s.Rank = standings[prev].Rank
+		}
+		s.Completed = ch.Target > 0 && s.Progress >= ch.Target
+		standings = append(standings, s)
+	}
+	return standings, rows.Err()
+}
+
+// ==================== Badge Methods ====================
+
+// AwardBadge saves a badge unless the user already has one of its type for
+// the challenge
+func (d *Database) AwardBadge(badge *models.UserBadge) error {
+	_, err := d.db.Exec(`
+		INSERT OR IGNORE INTO user_badges (id, user_id, challenge_id, type, name, awarded_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		badge.ID, badge.UserID, badge.ChallengeID, badge.Type, badge.Name, badge.AwardedAt)
+	return err
+}
+
+// ListUserBadges returns a user's badges, newest first
+func (d *Database) ListUserBadges(userID string) ([]*models.UserBadge, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, COALESCE(challenge_id, ''), type, name, awarded_at
+		FROM user_badges WHERE user_id = ?
+		ORDER BY awarded_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var badges []*models.UserBadge
+	for rows.Next() {
+		b := &models.UserBadge{}
+		if err := rows.Scan(&b.ID, &b.UserID, &b.ChallengeID, &b.Type, &b.Name, &b.AwardedAt); err != nil {
+			return nil, err
+		}
+		badges = append(badges, b)
+	}
+	return badges, rows.Err()
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/epub"
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// cleanupGracePeriod is how long a leftover file must have been untouched
+// before Cleanup removes it, so uploads and writes still in progress are
+// left alone
+const cleanupGracePeriod = 24 * time.Hour
+
+// Cleanup removes what's left behind in the data directory: uploads and
+// replacement files whose import never finished, covers, page thumbnails
+// and PDF text of books that are gone, half-written temporary files, and
+// stored book files no book uses. Files in the books directory's author
+// folders are only removed if they're temporary, since people sometimes
+// keep their own files there.
+func (fs *FileStorage) Cleanup() (*models.CleanupRun, error) {
+	run := &models.CleanupRun{Kinds: make(map[string]models.CleanupCount), RanAt: time.Now()}
+	if fs.refs == nil {
+		return run, nil
+	}
+	cutoff := run.RanAt.Add(-cleanupGracePeriod)
+	remove := func(kind, path string, info os.FileInfo) error {
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		epub.Invalidate(path)
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		count := run.Kinds[kind]
+		count.Files++
+		count.Bytes += info.Size()
+		run.Kinds[kind] = count
+		return nil
+	}
+
+	// Temporary files anywhere in the data directory, and EPUBs left by
+	// metadata writes that were cut off
+	err := filepath.Walk(fs.basePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && isTempFile(info.Name()) {
+			return remove(models.CleanupKindTemp, path, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if leftovers, err := filepath.Glob(filepath.Join(os.TempDir(), epub.TempFilePattern)); err == nil {
+		for _, path := range leftovers {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				if err := remove(models.CleanupKindTemp, path, info); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	referenced, err := fs.refs.ReferencedFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	if err := removeUnreferenced(fs.booksDir, referenced, func(path string, info os.FileInfo) error {
+		return remove(models.CleanupKindUploads, path, info)
+	}); err != nil {
+		return nil, err
+	}
+
+	covers, err := fs.refs.ReferencedCoverPaths()
+	if err != nil {
+		return nil, err
+	}
+	if err := removeUnreferenced(fs.coversDir, covers, func(path string, info os.FileInfo) error {
+		return remove(models.CleanupKindCovers, path, info)
+	}); err != nil {
+		return nil, err
+	}
+
+	bookIDs, err := fs.refs.BookIDs()
+	if err != nil {
+		return nil, err
+	}
+	for kind, dir := range map[string]string{models.CleanupKindThumbnails: fs.thumbsDir, models.CleanupKindText: fs.textDir} {
+		if err := removeUnreferenced(dir, nil, func(path string, info os.FileInfo) error {
+			if bookIDs[strings.TrimSuffix(info.Name(), ".json")] {
+				return nil
+			}
+			return remove(kind, path, info)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	pruned, err := fs.PruneObjects()
+	if err != nil {
+		return nil, err
+	}
+	if pruned.Files > 0 {
+		run.Kinds[models.CleanupKindObjects] = models.CleanupCount{Files: pruned.Files, Bytes: pruned.Bytes}
+	}
+
+	for _, count := range run.Kinds {
+		run.Files += count.Files
+		run.Bytes += count.Bytes
+	}
+	return run, nil
+}
+
+// isTempFile reports whether a file name is one of the temporary files
+// written on the way to a cover, cache file or book file
+func isTempFile(name string) bool {
+	return strings.HasSuffix(name, ".tmp") || strings.HasPrefix(name, ".cache-") || strings.HasPrefix(name, ".thumbnails-")
+}
+
+// removeUnreferenced calls remove with each regular file directly in dir
+// that isn't in referenced and isn't temporary; those are removed first.
+// Paths are compared as absolute paths, so a data directory configured as
+// a relative path still matches the paths recorded for it.
+func removeUnreferenced(dir string, referenced map[string]bool, remove func(path string, info os.FileInfo) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	absolute := make(map[string]bool, len(referenced))
+	for path := range referenced {
+		if abs, err := filepath.Abs(path); err == nil {
+			absolute[abs] = true
+		}
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		abs, err := filepath.Abs(path)
+		if err != nil || !entry.Type().IsRegular() || absolute[abs] || isTempFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since it was listed
+		}
+		if err := remove(path, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ==================== Cleanup Methods ====================
+
+// ReferencedCoverPaths returns the paths of every book's cover
+func (d *Database) ReferencedCoverPaths() (map[string]bool, error) {
+	return d.pathSet(`SELECT cover_path FROM books WHERE cover_path != ''`)
+}
+
+// BookIDs returns the ID of every book
+func (d *Database) BookIDs() (map[string]bool, error) {
+	return d.pathSet(`SELECT id FROM books`)
+}
+
+// pathSet returns the set of strings a single-column query selects
+func (d *Database) pathSet(query string) (map[string]bool, error) {
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := make(map[string]bool)
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		set[s] = true
+	}
+	return set, rows.Err()
+}
+
+// SaveCleanupRun records what a cleanup removed, setting its ID
+func (d *Database) SaveCleanupRun(run *models.CleanupRun) error {
+	kinds, err := json.Marshal(run.Kinds)
+	if err != nil {
+		return err
+	}
+	res, err := d.db.Exec(`INSERT INTO cleanup_runs (files, bytes, kinds, ran_at) VALUES (?, ?, ?, ?)`,
+		run.Files, run.Bytes, string(kinds), run.RanAt)
+	if err != nil {
+		return err
+	}
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListCleanupRuns returns up to limit of the latest cleanups, newest first
+func (d *Database) ListCleanupRuns(limit int) ([]models.CleanupRun, error) {
+	rows, err := d.db.Query(`
+		SELECT id, files, bytes, kinds, ran_at FROM cleanup_runs
+		ORDER BY ran_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.CleanupRun
+	for rows.Next() {
+		var run models.CleanupRun
+		var kinds string
+		if err := rows.Scan(&run.ID, &run.Files, &run.Bytes, &kinds, &run.RanAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(kinds), &run.Kinds); err != nil {
+			run.Kinds = map[string]models.CleanupCount{}
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// CleanupTotals returns how many files every cleanup so far has removed,
+// and the space they took
+func (d *Database) CleanupTotals() (files int, bytes int64, err error) {
+	err = d.db.QueryRow(`SELECT COALESCE(SUM(files), 0), COALESCE(SUM(bytes), 0) FROM cleanup_runs`).Scan(&files, &bytes)
+	return files, bytes, err
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestCleanup(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	files, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	files.SetFileReferences(db)
+
+	old := time.Now().Add(-2 * cleanupGracePeriod)
+	write := func(path, content string, aged bool) string {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		if aged {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+		return path
+	}
+
+	bookPath := write(filepath.Join(files.booksDir, "book-1.epub"), "dune", true)
+	coverPath := write(filepath.Join(files.coversDir, "book-1.jpg"), "cover", true)
+	thumbsPath := write(files.ThumbnailsPath("book-1"), "[]", true)
+	require.NoError(t, db.CreateBook(&models.Book{ID: "book-1", UserID: "user-1", Title: "Dune",
+		FilePath: bookPath, CoverPath: coverPath, FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}))
+	ownFile := write(filepath.Join(files.booksDir, "Frank Herbert", "notes.txt"), "mine", true)
+
+	leftovers := []string{
+		write(filepath.Join(files.booksDir, "abandoned.epub"), "upload", true),
+		write(filepath.Join(files.booksDir, "book-1-replacement.epub"), "new", true),
+		write(filepath.Join(files.coversDir, "gone.png"), "cover", true),
+		write(files.ThumbnailsPath("gone"), "[]", true),
+		write(files.PDFTextPath("gone"), "{}", true),
+		write(filepath.Join(files.booksDir, "Frank Herbert", "Dune.jpg.tmp"), "half", true),
+		write(filepath.Join(files.thumbsDir, ".thumbnails-123"), "half", true),
+		write(filepath.Join(files.textDir, ".cache-123"), "half", true),
+	}
+	recent := write(filepath.Join(files.booksDir, "uploading.epub"), "upload", false)
+
+	run, err := files.Cleanup()
+	require.NoError(t, err)
+	assert.Equal(t, 8, run.Files)
+	assert.Equal(t, int64(len("uploadnewcover[]{}halfhalfhalf")), run.Bytes)
+	assert.Equal(t, map[string]models.CleanupCount{
+		models.CleanupKindUploads:    {Files: 2, Bytes: int64(len("uploadnew"))},
+		models.CleanupKindCovers:     {Files: 1, Bytes: int64(len("cover"))},
+		models.CleanupKindThumbnails: {Files: 1, Bytes: int64(len("[]"))},
+		models.CleanupKindText:       {Files: 1, Bytes: int64(len("{}"))},
+		models.CleanupKindTemp:       {Files: 3, Bytes: int64(len("halfhalfhalf"))},
+	}, run.Kinds)
+	for _, path := range leftovers {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+	for _, path := range []string{bookPath, coverPath, thumbsPath, ownFile, recent} {
+		_, err := os.Stat(path)
+		assert.NoError(t, err, "%s is kept", path)
+	}
+
+	require.NoError(t, db.SaveCleanupRun(run))
+	second, err := files.Cleanup()
+	require.NoError(t, err)
+	assert.Zero(t, second.Files)
+	require.NoError(t, db.SaveCleanupRun(second))
+
+	runs, err := db.ListCleanupRuns(10)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, second.ID, runs[0].ID, "newest first")
+	assert.Equal(t, run.Kinds, runs[1].Kinds)
+	total, bytes, err := db.CleanupTotals()
+	require.NoError(t, err)
+	assert.Equal(t, 8, total)
+	assert.Equal(t, run.Bytes, bytes)
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Book Club Methods ====================
+
+// clubColumns is the column list scanned by queryBookClubs
+const clubColumns = `c.id, c.owner_id, c.book_id, c.name, c.description, c.created_at, c.updated_at,
+	b.title, b.author, (SELECT COUNT(*) FROM book_club_members WHERE club_id = c.id)`
+
+// CreateBookClub creates a club with its owner as the first member
+func (d *Database) CreateBookClub(club *models.BookClub) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO book_clubs (id, owner_id, book_id, name, description, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		club.ID, club.OwnerID, club.BookID, club.Name, club.Description, club.CreatedAt, club.UpdatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO book_club_members (club_id, user_id, joined_at) VALUES (?, ?, ?)`,
+		club.ID, club.OwnerID, club.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBookClub returns a club by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetBookClub(clubID string) (*models.BookClub, error) {
+	clubs, err := d.queryBookClubs(`
+		SELECT `+clubColumns+`
+		FROM book_clubs c
+		INNER JOIN books b ON b.id = c.book_id
+		WHERE c.id = ?`, clubID)
+	if err != nil {
+		return nil, err
+	}
+	if len(clubs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return clubs[0], nil
+}
+
+// ListBookClubsForUser returns the clubs a user is a member of, most
+// recently created first
+func (d *Database) ListBookClubsForUser(userID string) ([]*models.BookClub, error) {
+	return d.queryBookClubs(`
+		SELECT `+clubColumns+`
+		FROM book_clubs c
+		INNER JOIN books b ON b.id = c.book_id
+		INNER JOIN book_club_members m ON m.club_id = c.id
+		WHERE m.user_id = ?
+		ORDER BY c.created_at DESC`, userID)
+}
+
+// UpdateBookClub saves a club's name and description
+func (d *Database) UpdateBookClub(club *models.BookClub) error {
+	_, err := d.db.Exec(`
+		UPDATE book_clubs SET name = ?, description = ?, updated_at = ? WHERE id = ?`,
+		club.Name, club.Description, club.UpdatedAt, club.ID,
+	)
+	return err
+}
+
+// DeleteBookClub deletes a club, unsharing the book from members who only
+// had it through the club
+func (d *Database) DeleteBookClub(club *models.BookClub) error {
+	members, err := d.ListBookClubMembers(club.ID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := releaseClubShare(tx, club, m); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM book_clubs WHERE id = ?`, club.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryBookClubs runs a club query and scans the results
+func (d *Database) queryBookClubs(query string, args ...interface{}) ([]*models.BookClub, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clubs []*models.BookClub
+	for rows.Next() {
+		c := &models.BookClub{}
+		if err := rows.Scan(&c.ID, &c.OwnerID, &c.BookID, &c.Name, &c.Description, &c.CreatedAt, &c.UpdatedAt,
+			&c.BookTitle, &c.BookAuthor, &c.MemberCount); err != nil {
+			return nil, err
+		}
+		clubs = append(clubs, c)
+	}
+	return clubs, rows.Err()
+}
+
+// GetBookClubMember returns a user's membership of a club, or sql.ErrNoRows
+// if they aren't a member
+func (d *Database) GetBookClubMember(clubID, userID string) (*models.BookClubMember, error) {
+	m := &models.BookClubMember{}
+	err := d.db.QueryRow(`
+		SELECT m.user_id, u.username, m.shared_book, m.joined_at
+		FROM book_club_members m
+		INNER JOIN users u ON u.id = m.user_id
+		WHERE m.club_id = ? AND m.user_id = ?`, clubID, userID,
+	).Scan(&m.UserID, &m.Username, &m.SharedBook, &m.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ListBookClubMembers returns a club's members in the order they joined
+func (d *Database) ListBookClubMembers(clubID string) ([]*models.BookClubMember, error) {
+	rows, err := d.db.Query(`
+		SELECT m.user_id, u.username, m.shared_book, m.joined_at
+		FROM book_club_members m
+		INNER JOIN users u ON u.id = m.user_id
+		WHERE m.club_id = ?
+		ORDER BY m.joined_at ASC, u.username ASC`, clubID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.BookClubMember
+	for rows.Next() {
+		m := &models.BookClubMember{}
+		if err := rows.Scan(&m.UserID, &m.Username, &m.SharedBook, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// AddBookClubMember adds a user to a club and shares the club's book with
+// them if it isn't already
+func (d *Database) AddBookClubMember(club *models.BookClub, userID string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Same composite ID as ShareBook
+	result, err := tx.Exec(`
+		INSERT OR IGNORE INTO book_shares (id, book_id, owner_id, shared_with_id, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID+"-"+club.BookID, club.BookID, club.OwnerID, userID, time.Now(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	shared, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO book_club_members (club_id, user_id, shared_book, joined_at) VALUES (?, ?, ?, ?)`,
+		club.ID, userID, shared > 0, time.Now(),
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveBookClubMember removes a user from a club, unsharing the book if
+// they only had it through the club
+func (d *Database) RemoveBookClubMember(club *models.BookClub, member *models.BookClubMember) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := releaseClubShare(tx, club, member); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM book_club_members WHERE club_id = ? AND user_id = ?`,
+		club.ID, member.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// releaseClubShare undoes the book share a club membership created. If the
+// member is in another club for the same book, that club takes over the
+// share instead.
+func releaseClubShare(tx *sql.Tx, club *models.BookClub, member *models.BookClubMember) error {
+	if !member.SharedBook {
+		return nil
+	}
+
+	result, err := tx.Exec(`
+		UPDATE book_club_members SET shared_book = 1
+		WHERE user_id = ? AND club_id = (
+			SELECT m.club_id FROM book_club_members m
+			INNER JOIN book_clubs c ON c.id = m.club_id
+			WHERE m.user_id = ? AND c.book_id = ? AND c.id != ?
+			LIMIT 1)`,
+		member.UserID, member.UserID, club.BookID, club.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM book_shares WHERE book_id = ? AND shared_with_id = ?`, club.BookID, member.UserID)
+	return err
+}
+
+// GetBookClubSchedule returns a club's reading schedule in chapter order
+func (d *Database) GetBookClubSchedule(clubID string) ([]*models.BookClubScheduleEntry, error) {
+	rows, err := d.db.Query(`
+		SELECT chapter, title, due_date FROM book_club_schedule
+		WHERE club_id = ? ORDER BY chapter ASC`, clubID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedule []*models.BookClubScheduleEntry
+	for rows.Next() {
+		e := &models.BookClubScheduleEntry{}
+		if err := rows.Scan(&e.Chapter, &e.Title, &e.DueDate); err != nil {
+			return nil, err
+		}
+		schedule = append(schedule, e)
+	}
+	return schedule, rows.Err()
+}
+
+// SetBookClubSchedule replaces a club's reading schedule
+func (d *Database) SetBookClubSchedule(clubID string, schedule []*models.BookClubScheduleEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM book_club_schedule WHERE club_id = ?`, clubID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, e := range schedule {
+		if _, err := tx.Exec(`
+			INSERT INTO book_club_schedule (club_id, chapter, title, due_date) VALUES (?, ?, ?, ?)`,
+			clubID, e.Chapter, e.Title, e.DueDate,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// commentColumns is the column list scanned by queryBookClubComments
+const commentColumns = `cc.id, cc.club_id, cc.user_id, cc.chapter, COALESCE(cc.parent_id, ''), cc.body,
+	cc.created_at, cc.updated_at, u.username`
+
+// CreateBookClubComment saves a new comment
+func (d *Database) CreateBookClubComment(comment *models.BookClubComment) error {
+	var parentID interface{}
+	if comment.ParentID != "" {
+		parentID = comment.ParentID
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO book_club_comments (id, club_id, user_id, chapter, parent_id, body, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		comment.ID, comment.ClubID, comment.UserID, comment.Chapter, parentID, comment.Body,
+		comment.CreatedAt, comment.UpdatedAt,
+	)
+	return err
+}
+
+// GetBookClubComment returns a comment by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetBookClubComment(commentID string) (*models.BookClubComment, error) {
+	comments, err := d.queryBookClubComments(`
+		SELECT `+commentColumns+`
+		FROM book_club_comments cc
+		INNER JOIN users u ON u.id = cc.user_id
+		WHERE cc.id = ?`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return comments[0], nil
+}
+
+// ListBookClubComments returns a club's comments oldest first, by chapter.
+// A negative chapter returns every chapter's comments.
+func (d *Database) ListBookClubComments(clubID string, chapter int) ([]*models.BookClubComment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM book_club_comments cc
+		INNER JOIN users u ON u.id = cc.user_id
+		WHERE cc.club_id = ?`
+	args := []interface{}{clubID}
+	if chapter >= 0 {
+		query += ` AND cc.chapter = ?`
+		args = append(args, chapter)
+	}
+	query += ` ORDER BY cc.chapter ASC, cc.created_at ASC`
+	return d.queryBookClubComments(query, args...)
+}
+
+// DeleteBookClubComment deletes a comment and its replies
+func (d *Database) DeleteBookClubComment(commentID string) error {
+	_, err := d.db.Exec(`DELETE FROM book_club_comments WHERE id = ?`, commentID)
+	return err
+}
+
+// queryBookClubComments runs a comment query and scans the results
+func (d *Database) queryBookClubComments(query string, args ...interface{}) ([]*models.BookClubComment, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*models.BookClubComment
+	for rows.Next() {
+		c := &models.BookClubComment{}
+		if err := rows.Scan(&c.ID, &c.ClubID, &c.UserID, &c.Chapter, &c.ParentID, &c.Body,
+			&c.CreatedAt, &c.UpdatedAt, &c.Username); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Comic Filename Pattern Methods ====================
+
+// CreateComicFilenamePattern saves a custom comic filename pattern
+func (d *Database) CreateComicFilenamePattern(pattern *models.ComicFilenamePattern) error {
+	_, err := d.db.Exec(`
+		INSERT INTO comic_filename_patterns (id, pattern, description, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		pattern.ID, pattern.Pattern, pattern.Description, pattern.CreatedBy, pattern.CreatedAt,
+	)
+	return err
+}
+
+// ListComicFilenamePatterns returns the custom comic filename patterns in
+// the order they're tried, oldest first
+func (d *Database) ListComicFilenamePatterns() ([]*models.ComicFilenamePattern, error) {
+	rows, err := d.db.Query(`
+		SELECT id, pattern, description, created_by, created_at
+		FROM comic_filename_patterns ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []*models.ComicFilenamePattern
+	for rows.Next() {
+		p := &models.ComicFilenamePattern{}
+		if err := rows.Scan(&p.ID, &p.Pattern, &p.Description, &p.CreatedBy, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, rows.Err()
+}
+
+// DeleteComicFilenamePattern removes a custom comic filename pattern, or
+// returns sql.ErrNoRows if there is none with that ID
+func (d *Database) DeleteComicFilenamePattern(id string) error {
+	result, err := d.db.Exec(`DELETE FROM comic_filename_patterns WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
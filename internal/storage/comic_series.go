@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Comic Series Methods ====================
+
+// comicSeriesColumns is the column list scanned by queryComicSeries
+const comicSeriesColumns = `id, user_id, name, publisher, start_year, volume, total_issues, description,
+	metadata_source, source_id, created_at, updated_at`
+
+// EnsureComicSeries creates a series for every comic series in the user's
+// library, including shared comics, that doesn't have one yet
+func (d *Database) EnsureComicSeries(userID string) error {
+	rows, err := d.db.Query(`
+		SELECT DISTINCT b.series FROM books b
+		WHERE b.series != '' AND b.content_type = ?
+			AND (b.user_id = ? OR b.id IN (SELECT book_id FROM book_shares WHERE shared_with_id = ?))
+			AND NOT EXISTS (SELECT 1 FROM comic_series s WHERE s.user_id = ? AND s.name = b.series COLLATE NOCASE)`,
+		models.ContentTypeComic, userID, userID, userID)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		// Names differing only in case are one series
+		if _, err := d.db.Exec(`
+			INSERT OR IGNORE INTO comic_series (id, user_id, name, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			uuid.New().String(), userID, name, now, now,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateComicSeries saves a new series
+func (d *Database) CreateComicSeries(s *models.ComicSeries) error {
+	_, err := d.db.Exec(`
+		INSERT INTO comic_series (`+comicSeriesColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.UserID, s.Name, s.Publisher, s.StartYear, s.Volume, s.TotalIssues, s.Description,
+		s.MetadataSource, s.SourceID, s.CreatedAt, s.UpdatedAt,
+	)
+	return err
+}
+
+// GetComicSeries returns a series by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetComicSeries(seriesID string) (*models.ComicSeries, error) {
+	series, err := d.queryComicSeries(`SELECT `+comicSeriesColumns+` FROM comic_series WHERE id = ?`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return series[0], nil
+}
+
+// GetComicSeriesByName returns a user's series by name, ignoring case, or
+// sql.ErrNoRows if there is none
+func (d *Database) GetComicSeriesByName(userID, name string) (*models.ComicSeries, error) {
+	series, err := d.queryComicSeries(`
+		SELECT `+comicSeriesColumns+` FROM comic_series
+		WHERE user_id = ? AND name = ? COLLATE NOCASE`, userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(series) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return series[0], nil
+}
+
+// ListComicSeries returns a user's series by name
+func (d *Database) ListComicSeries(userID string) ([]*models.ComicSeries, error) {
+	return d.queryComicSeries(`
+		SELECT `+comicSeriesColumns+` FROM comic_series
+		WHERE user_id = ?
+		ORDER BY name COLLATE NOCASE`, userID)
+}
+
+// UpdateComicSeries saves a series' details. The name can't change, since
+// it is what links the series to its issues.
+func (d *Database) UpdateComicSeries(s *models.ComicSeries) error {
+	_, err := d.db.Exec(`
+		UPDATE comic_series SET publisher = ?, start_year = ?, volume = ?, total_issues = ?, description = ?,
+			metadata_source = ?, source_id = ?, updated_at = ?
+		WHERE id = ?`,
+		s.Publisher, s.StartYear, s.Volume, s.TotalIssues, s.Description,
+		s.MetadataSource, s.SourceID, s.UpdatedAt, s.ID,
+	)
+	return err
+}
+
+// DeleteComicSeries deletes a series along with its read marks and reading
+// order entries. Its comics are kept.
+func (d *Database) DeleteComicSeries(seriesID string) error {
+	_, err := d.db.Exec(`DELETE FROM comic_series WHERE id = ?`, seriesID)
+	return err
+}
+
+// queryComicSeries runs a series query and scans the results
+func (d *Database) queryComicSeries(query string, args ...interface{}) ([]*models.ComicSeries, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var series []*models.ComicSeries
+	for rows.Next() {
+		s := &models.ComicSeries{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Name, &s.Publisher, &s.StartYear, &s.Volume, &s.TotalIssues,
+			&s.Description, &s.MetadataSource, &s.SourceID, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+	return series, rows.Err()
+}
+
+// ListComicSeriesBooks returns the comics in a user's library, including
+// shared ones, whose series matches name, with the user's read status
+func (d *Database) ListComicSeriesBooks(userID, name string) ([]models.Book, error) {
+	rows, err := d.db.Query(`
+		SELECT b.id, b.title, b.series, b.series_index, COALESCE(s.read_status, 'unread'), s.date_completed
+		FROM books b
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+		WHERE b.series = ? COLLATE NOCASE AND b.content_type = ?
+			AND (b.user_id = ? OR b.id IN (SELECT book_id FROM book_shares WHERE shared_with_id = ?))
+		ORDER BY b.series_index, b.title`,
+		userID, name, models.ContentTypeComic, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var b models.Book
+		if err := rows.Scan(&b.ID, &b.Title, &b.Series, &b.SeriesIndex, &b.ReadStatus, &b.DateCompleted); err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// ListComicIssueReads returns when each issue of a series that isn't in the
+// library was marked read, by issue number
+func (d *Database) ListComicIssueReads(seriesID string) (map[string]time.Time, error) {
+	rows, err := d.db.Query(`SELECT issue_number, read_at FROM comic_issue_reads WHERE series_id = ?`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reads := make(map[string]time.Time)
+	for rows.Next() {
+		var number string
+		var at time.Time
+		if err := rows.Scan(&number, &at); err != nil {
+			return nil, err
+		}
+		reads[number] = at
+	}
+	return reads, rows.Err()
+}
+
+// MarkComicIssueRead marks an issue of a series read
+func (d *Database) MarkComicIssueRead(seriesID, issueNumber string, at time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT INTO comic_issue_reads (series_id, issue_number, read_at) VALUES (?, ?, ?)
+		ON CONFLICT(series_id, issue_number) DO UPDATE SET read_at = excluded.read_at`,
+		seriesID, issueNumber, at,
+	)
+	return err
+}
+
+// UnmarkComicIssueRead removes an issue's read mark
+func (d *Database) UnmarkComicIssueRead(seriesID, issueNumber string) error {
+	_, err := d.db.Exec(`DELETE FROM comic_issue_reads WHERE series_id = ? AND issue_number = ?`,
+		seriesID, issueNumber)
+	return err
+}
+
+// ==================== Reading Order Methods ====================
+
+// readingOrderColumns is the column list scanned by queryReadingOrders
+const readingOrderColumns = `o.id, o.user_id, o.name, o.description, o.metadata_source, o.source_id,
+	o.created_at, o.updated_at, (SELECT COUNT(*) FROM reading_order_entries WHERE order_id = o.id)`
+
+// CreateReadingOrder saves a new, empty reading order
+func (d *Database) CreateReadingOrder(o *models.ReadingOrder) error {
+	_, err := d.db.Exec(`
+		INSERT INTO reading_orders (id, user_id, name, description, metadata_source, source_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.ID, o.UserID, o.Name, o.Description, o.MetadataSource, o.SourceID, o.CreatedAt, o.UpdatedAt,
+	)
+	return err
+}
+
+// GetReadingOrder returns a reading order by ID, or sql.ErrNoRows if there
+// is none
+func (d *Database) GetReadingOrder(orderID string) (*models.ReadingOrder, error) {
+	orders, err := d.queryReadingOrders(`SELECT `+readingOrderColumns+` FROM reading_orders o WHERE o.id = ?`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return orders[0], nil
+}
+
+// ListReadingOrders returns a user's reading orders by name
+func (d *Database) ListReadingOrders(userID string) ([]*models.ReadingOrder, error) {
+	return d.queryReadingOrders(`
+		SELECT `+readingOrderColumns+` FROM reading_orders o
+		WHERE o.user_id = ?
+		ORDER BY o.name COLLATE NOCASE`, userID)
+}
+
+// UpdateReadingOrder saves a reading order's name and description
+func (d *Database) UpdateReadingOrder(o *models.ReadingOrder) error {
+	_, err := d.db.Exec(`
+		UPDATE reading_orders SET name = ?, description = ?, updated_at = ? WHERE id = ?`,
+		o.Name, o.Description, o.UpdatedAt, o.ID,
+	)
+	return err
+}
+
+// DeleteReadingOrder deletes a reading order and its entries
+func (d *Database) DeleteReadingOrder(orderID string) error {
+	_, err := d.db.Exec(`DELETE FROM reading_orders WHERE id = ?`, orderID)
+	return err
+}
+
+// queryReadingOrders runs a reading order query and scans the results
+func (d *Database) queryReadingOrders(query string, args ...interface{}) ([]*models.ReadingOrder, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.ReadingOrder
+	for rows.Next() {
+		o := &models.ReadingOrder{}
+		if err := rows.Scan(&o.ID, &o.UserID, &o.Name, &o.Description, &o.MetadataSource, &o.SourceID,
+			&o.CreatedAt, &o.UpdatedAt, &o.EntryCount); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// SetReadingOrderEntries replaces a reading order's entries. Positions are
+// assigned from their order in entries.
+func (d *Database) SetReadingOrderEntries(orderID string, entries []*models.ReadingOrderEntry) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reading_order_entries WHERE order_id = ?`, orderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i, e := range entries {
+		e.Position = i + 1
+		if _, err := tx.Exec(`
+			INSERT INTO reading_order_entries (order_id, position, series_id, issue_number)
+			VALUES (?, ?, ?, ?)`,
+			orderID, e.Position, e.SeriesID, e.IssueNumber,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE reading_orders SET updated_at = ? WHERE id = ?`, time.Now(), orderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListReadingOrderEntries returns a reading order's entries in order, with
+// their series' names
+func (d *Database) ListReadingOrderEntries(orderID string) ([]*models.ReadingOrderEntry, error) {
+	rows, err := d.db.Query(`
+		SELECT e.position, e.series_id, s.name, e.issue_number
+		FROM reading_order_entries e
+		INNER JOIN comic_series s ON s.id = e.series_id
+		WHERE e.order_id = ?
+		ORDER BY e.position`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.ReadingOrderEntry
+	for rows.Next() {
+		e := &models.ReadingOrderEntry{}
+		if err := rows.Scan(&e.Position, &e.SeriesID, &e.SeriesName, &e.IssueNumber); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
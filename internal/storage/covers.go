@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Cover Palette Methods ====================
+
+// GetCoverPalettes returns the cover palettes of the given books, keyed by
+// book ID. Books without one are left out.
+func (d *Database) GetCoverPalettes(bookIDs []string) (map[string][]string, error) {
+	palettes := make(map[string][]string)
+	// Stay well under SQLite's limit on query parameters
+	const chunk = 500
+	for start := 0; start < len(bookIDs); start += chunk {
+		ids := bookIDs[start:min(start+chunk, len(bookIDs))]
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		rows, err := d.db.Query(`
+			SELECT id, cover_palette FROM books
+			WHERE cover_palette != '' AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id, palette string
+			if err := rows.Scan(&id, &palette); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			palettes[id] = strings.Split(palette, ",")
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return palettes, nil
+}
+
+// ListBooksWithoutCoverPalette returns up to limit books with a cover whose
+// palette hasn't been computed, with only their ID, owner, and cover path
+// set
+func (d *Database) ListBooksWithoutCoverPalette(limit int) ([]models.Book, error) {
+	rows, err := d.db.Query(`
+		SELECT id, COALESCE(user_id, ''), cover_path FROM books
+		WHERE cover_palette IS NULL AND cover_path != ''
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var b models.Book
+		if err := rows.Scan(&b.ID, &b.UserID, &b.CoverPath); err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+// ListBookIDsWithCovers returns the IDs of every book with a cover, oldest
+// first
+func (d *Database) ListBookIDsWithCovers() ([]string, error) {
+	rows, err := d.db.Query(`SELECT id FROM books WHERE cover_path != '' ORDER BY uploaded_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetCoverPalette records a book's cover palette. An empty palette marks
+// the cover as done so it isn't read again.
+func (d *Database) SetCoverPalette(bookID string, palette []string) error {
+	res, err := d.db.Exec(`UPDATE books SET cover_palette = ? WHERE id = ?`, strings.Join(palette, ","), bookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Custom Field Methods ====================
+
+// CreateCustomField saves a custom field definition
+func (d *Database) CreateCustomField(field *models.CustomField) error {
+	options, err := encodeOptions(field.Options)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO custom_fields (id, key, name, type, options, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		field.ID, field.Key, field.Name, field.Type, options, field.CreatedAt,
+	)
+	return err
+}
+
+// ListCustomFields returns the custom fields in the order they were added
+func (d *Database) ListCustomFields() ([]*models.CustomField, error) {
+	rows, err := d.db.Query(`
+		SELECT id, key, name, type, options, created_at
+		FROM custom_fields ORDER BY created_at, key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fields []*models.CustomField
+	for rows.Next() {
+		field, err := scanCustomField(rows)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, rows.Err()
+}
+
+// GetCustomField returns a custom field by ID
+func (d *Database) GetCustomField(id string) (*models.CustomField, error) {
+	return scanCustomField(d.db.QueryRow(`
+		SELECT id, key, name, type, options, created_at
+		FROM custom_fields WHERE id = ?`, id))
+}
+
+// GetCustomFieldByKey returns a custom field by key
+func (d *Database) GetCustomFieldByKey(key string) (*models.CustomField, error) {
+	return scanCustomField(d.db.QueryRow(`
+		SELECT id, key, name, type, options, created_at
+		FROM custom_fields WHERE key = ?`, key))
+}
+
+// scanCustomField reads a custom field from a row
+func scanCustomField(row interface{ Scan(...interface{}) error }) (*models.CustomField, error) {
+	field := &models.CustomField{}
+	var options string
+	if err := row.Scan(&field.ID, &field.Key, &field.Name, &field.Type, &options, &field.CreatedAt); err != nil {
+		return nil, err
+	}
+	if options != "" {
+		if err := json.Unmarshal([]byte(options), &field.Options); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// encodeOptions stores an enum's choices as a JSON array, and no choices as
+// an empty string
+func encodeOptions(options []string) (string, error) {
+	if len(options) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(options)
+	return string(data), err
+}
+
+// UpdateCustomField saves a custom field's name and options. Values of an
+// enum that are no longer among its options are removed.
+func (d *Database) UpdateCustomField(field *models.CustomField) error {
+	options, err := encodeOptions(field.Options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE custom_fields SET name = ?, options = ? WHERE id = ?`, field.Name, options, field.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if field.Type == models.CustomFieldEnum {
+		args := []interface{}{field.ID}
+		for _, option := range field.Options {
+			args = append(args, option)
+		}
+		query := `DELETE FROM book_custom_values WHERE field_id = ?`
+		if len(field.Options) > 0 {
+			query += ` AND value NOT IN (?` + strings.Repeat(", ?", len(field.Options)-1) + `)`
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteCustomField removes a custom field and every value of it, or
+// returns sql.ErrNoRows if there is none with that ID
+func (d *Database) DeleteCustomField(id string) error {
+	result, err := d.db.Exec(`DELETE FROM custom_fields WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetBookCustomValues saves userID's values of custom fields for each of
+// the given books. values is keyed by field ID; an empty value clears the
+// field.
+func (d *Database) SetBookCustomValues(userID string, bookIDs []string, values map[string]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, bookID := range bookIDs {
+		for fieldID, value := range values {
+			if value == "" {
+				_, err = tx.Exec(`DELETE FROM book_custom_values WHERE book_id = ? AND user_id = ? AND field_id = ?`,
+					bookID, userID, fieldID)
+			} else {
+				_, err = tx.Exec(`
+					INSERT INTO book_custom_values (book_id, user_id, field_id, value) VALUES (?, ?, ?, ?)
+					ON CONFLICT(book_id, user_id, field_id) DO UPDATE SET value = excluded.value`,
+					bookID, userID, fieldID, value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBookCustomValues returns userID's custom field values for the given
+// books, keyed by book ID and then field ID
+func (d *Database) GetBookCustomValues(userID string, bookIDs []string) (map[string]map[string]string, error) {
+	values := make(map[string]map[string]string)
+	err := queryBookChunks(bookIDs, func(placeholders string, args []interface{}) error {
+		rows, err := d.db.Query(`
+			SELECT book_id, field_id, value FROM book_custom_values
+			WHERE user_id = ? AND book_id IN (`+placeholders+`)`,
+			append([]interface{}{userID}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bookID, fieldID, value string
+			if err := rows.Scan(&bookID, &fieldID, &value); err != nil {
+				return err
+			}
+			if values[bookID] == nil {
+				values[bookID] = make(map[string]string)
+			}
+			values[bookID][fieldID] = value
+		}
+		return rows.Err()
+	})
+	return values, err
+}
+
+// customRuleCondition builds the SQL condition of a smart collection rule
+// on the custom field with the given key, matching books whose owner has a
+// value for it that satisfies the rule. Numbers compare numerically and
+// dates as YYYY-MM-DD text; unknown fields and operators match nothing.
+func (d *Database) customRuleCondition(key string, rule models.CollectionRule) (string, []interface{}) {
+	field, err := d.GetCustomFieldByKey(key)
+	if err != nil {
+		return "0", nil
+	}
+
+	value := "v.value"
+	arg := interface{}(rule.Value)
+	var cond string
+	switch field.Type {
+	case models.CustomFieldNumber:
+		value, arg = "CAST(v.value AS REAL)", strings.TrimSpace(rule.Value)
+		switch rule.Operator {
+		case models.RuleOpEquals:
+			cond = value + " = CAST(? AS REAL)"
+		case models.RuleOpGreaterThan:
+			cond = value + " > CAST(? AS REAL)"
+		case models.RuleOpLessThan:
+			cond = value + " < CAST(? AS REAL)"
+		}
+	case models.CustomFieldDate:
+		switch rule.Operator {
+		case models.RuleOpEquals:
+			cond = value + " = ?"
+		case models.RuleOpGreaterThan:
+			cond = value + " > ?"
+		case models.RuleOpLessThan:
+			cond = value + " < ?"
+		}
+	case models.CustomFieldBool, models.CustomFieldEnum:
+		if rule.Operator == models.RuleOpEquals {
+			cond = "LOWER(" + value + ") = LOWER(?)"
+		}
+	default:
+		switch rule.Operator {
+		case models.RuleOpEquals:
+			cond = "LOWER(" + value + ") = LOWER(?)"
+		case models.RuleOpContains:
+			cond, arg = "LOWER("+value+") LIKE LOWER(?)", "%"+rule.Value+"%"
+		case models.RuleOpStartsWith:
+			cond, arg = "LOWER("+value+") LIKE LOWER(?)", rule.Value+"%"
+		}
+	}
+	if cond == "" {
+		return "0", nil
+	}
+
+	return `EXISTS (SELECT 1 FROM book_custom_values v
+		WHERE v.book_id = b.id AND v.user_id = b.user_id AND v.field_id = ? AND ` + cond + `)`,
+		[]interface{}{field.ID, arg}
+}
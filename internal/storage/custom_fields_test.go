@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestCustomFieldSmartCollectionRules(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	for _, f := range []*models.CustomField{
+		{ID: "f-price", Key: "price", Name: "Price", Type: models.CustomFieldNumber},
+		{ID: "f-note", Key: "note", Name: "Note", Type: models.CustomFieldText},
+		{ID: "f-signed", Key: "signed", Name: "Signed", Type: models.CustomFieldBool},
+	} {
+		f.CreatedAt = time.Now()
+		require.NoError(t, db.CreateCustomField(f))
+	}
+	for _, id := range []string{"cheap", "dear", "bare"} {
+		require.NoError(t, db.CreateBook(&models.Book{ID: id, UserID: "user-1", Title: id, FilePath: "/" + id, UploadedAt: time.Now()}))
+	}
+	require.NoError(t, db.SetBookCustomValues("user-1", []string{"cheap"}, map[string]string{"f-price": "9.5", "f-note": "From a Market stall"}))
+	require.NoError(t, db.SetBookCustomValues("user-1", []string{"dear"}, map[string]string{"f-price": "120", "f-signed": "true"}))
+	// Another user's values don't count for the owner's collections
+	require.NoError(t, db.SetBookCustomValues("user-2", []string{"bare"}, map[string]string{"f-price": "500"}))
+
+	collections := 0
+	match := func(rule models.CollectionRule) []string {
+		collections++
+		collection := &models.Collection{ID: fmt.Sprintf("col-%d", collections), UserID: "user-1", Name: "Smart", IsSmart: true, CreatedAt: time.Now()}
+		require.NoError(t, db.CreateCollection(collection))
+		rule.ID = collection.ID + "-rule"
+		rule.CollectionID = collection.ID
+		require.NoError(t, db.CreateCollectionRule(&rule))
+		books, err := db.GetSmartCollectionBooks(collection.ID, "user-1")
+		require.NoError(t, err)
+		var ids []string
+		for _, b := range books {
+			ids = append(ids, b.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"dear"}, match(models.CollectionRule{Field: "custom:price", Operator: models.RuleOpGreaterThan, Value: "20"}), "compared as numbers")
+	assert.Equal(t, []string{"cheap"}, match(models.CollectionRule{Field: "custom:price", Operator: models.RuleOpLessThan, Value: "100"}))
+	assert.Equal(t, []string{"cheap"}, match(models.CollectionRule{Field: "custom:note", Operator: models.RuleOpContains, Value: "market"}))
+	assert.Equal(t, []string{"dear"}, match(models.CollectionRule{Field: "custom:signed", Operator: models.RuleOpEquals, Value: "true"}))
+	assert.Empty(t, match(models.CollectionRule{Field: "custom:gone", Operator: models.RuleOpEquals, Value: "x"}), "unknown fields match nothing")
+
+	// Values go with the field
+	require.NoError(t, db.DeleteCustomField("f-price"))
+	values, err := db.GetBookCustomValues("user-1", []string{"cheap", "dear"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{"cheap": {"f-note": "From a Market stall"}, "dear": {"f-signed": "true"}}, values)
+}
@@ -7,300 +7,43 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/justyntemme/webby/internal/locale"
 	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/search"
 )
 
 // Database handles all database operations
 type Database struct {
-	db *sql.DB
+	db *sqliteDB
 }
 
 // NewDatabase creates and initializes the SQLite database
 func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := openSQLite(dbPath)
 	if err != nil {
 		return nil, err
 	}
 
 	d := &Database{db: db}
 	if err := d.migrate(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return d, nil
 }
 
-func (d *Database) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		username TEXT UNIQUE NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS books (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL DEFAULT '',
-		title TEXT NOT NULL,
-		author TEXT NOT NULL DEFAULT 'Unknown',
-		series TEXT DEFAULT '',
-		series_index REAL DEFAULT 0,
-		file_path TEXT NOT NULL,
-		cover_path TEXT DEFAULT '',
-		file_size INTEGER DEFAULT 0,
-		uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS collections (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL DEFAULT '',
-		name TEXT NOT NULL,
-		is_smart INTEGER DEFAULT 0,
-		rule_logic TEXT DEFAULT 'AND',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS collection_rules (
-		id TEXT PRIMARY KEY,
-		collection_id TEXT NOT NULL,
-		field TEXT NOT NULL,
-		operator TEXT NOT NULL,
-		value TEXT NOT NULL,
-		FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS book_collections (
-		book_id TEXT NOT NULL,
-		collection_id TEXT NOT NULL,
-		PRIMARY KEY (book_id, collection_id),
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-		FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS reading_positions (
-		book_id TEXT NOT NULL,
-		user_id TEXT NOT NULL DEFAULT '',
-		chapter TEXT NOT NULL,
-		position REAL DEFAULT 0,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY (book_id, user_id),
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS book_shares (
-		id TEXT PRIMARY KEY,
-		book_id TEXT NOT NULL,
-		owner_id TEXT NOT NULL,
-		shared_with_id TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(book_id, shared_with_id),
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
-		FOREIGN KEY (shared_with_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_books_author ON books(author);
-	CREATE INDEX IF NOT EXISTS idx_books_series ON books(series);
-	CREATE INDEX IF NOT EXISTS idx_books_user ON books(user_id);
-	CREATE INDEX IF NOT EXISTS idx_collections_user ON collections(user_id);
-	CREATE INDEX IF NOT EXISTS idx_book_shares_shared_with ON book_shares(shared_with_id);
-	`
-
-	_, err := d.db.Exec(schema)
+// OpenDatabase opens the SQLite database without migrating it, for
+// inspecting or changing the schema version by hand
+func OpenDatabase(dbPath string) (*Database, error) {
+	db, err := openSQLite(dbPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Add new metadata columns if they don't exist (migration for existing databases)
-	metadataColumns := []string{
-		"ALTER TABLE books ADD COLUMN isbn TEXT DEFAULT ''",
-		"ALTER TABLE books ADD COLUMN publisher TEXT DEFAULT ''",
-		"ALTER TABLE books ADD COLUMN publish_date TEXT DEFAULT ''",
-		"ALTER TABLE books ADD COLUMN description TEXT DEFAULT ''",
-		"ALTER TABLE books ADD COLUMN language TEXT DEFAULT ''",
-		"ALTER TABLE books ADD COLUMN subjects TEXT DEFAULT ''",
-		"ALTER TABLE books ADD COLUMN metadata_source TEXT DEFAULT 'epub'",
-		"ALTER TABLE books ADD COLUMN metadata_updated DATETIME",
-		"ALTER TABLE books ADD COLUMN content_type TEXT DEFAULT 'book'",
-		"ALTER TABLE books ADD COLUMN file_format TEXT DEFAULT 'epub'",
-	}
-
-	for _, col := range metadataColumns {
-		// Ignore errors - column may already exist
-		d.db.Exec(col)
-	}
-
-	// Add file_hash column for duplicate detection
-	d.db.Exec("ALTER TABLE books ADD COLUMN file_hash TEXT DEFAULT ''")
-
-	// Add read status tracking columns
-	d.db.Exec("ALTER TABLE books ADD COLUMN read_status TEXT DEFAULT 'unread'")
-	d.db.Exec("ALTER TABLE books ADD COLUMN date_completed DATETIME")
-
-	// Add star rating column (0-5, 0 means no rating)
-	d.db.Exec("ALTER TABLE books ADD COLUMN rating INTEGER DEFAULT 0")
-
-	// Add smart collections support
-	d.db.Exec("ALTER TABLE collections ADD COLUMN is_smart INTEGER DEFAULT 0")
-	d.db.Exec("ALTER TABLE collections ADD COLUMN rule_logic TEXT DEFAULT 'AND'")
-
-	// Create collection_rules table if it doesn't exist
-	d.db.Exec(`
-		CREATE TABLE IF NOT EXISTS collection_rules (
-			id TEXT PRIMARY KEY,
-			collection_id TEXT NOT NULL,
-			field TEXT NOT NULL,
-			operator TEXT NOT NULL,
-			value TEXT NOT NULL,
-			FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
-		)
-	`)
-	d.db.Exec("CREATE INDEX IF NOT EXISTS idx_collection_rules_collection ON collection_rules(collection_id)")
-
-	// Add indexes
-	d.db.Exec("CREATE INDEX IF NOT EXISTS idx_books_isbn ON books(isbn)")
-	d.db.Exec("CREATE INDEX IF NOT EXISTS idx_books_content_type ON books(content_type)")
-	d.db.Exec("CREATE INDEX IF NOT EXISTS idx_books_file_format ON books(file_format)")
-	d.db.Exec("CREATE INDEX IF NOT EXISTS idx_books_file_hash ON books(file_hash)")
-	d.db.Exec("CREATE INDEX IF NOT EXISTS idx_books_read_status ON books(read_status)")
-
-	// Create reading lists tables
-	readingListsSchema := `
-	CREATE TABLE IF NOT EXISTS reading_lists (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		name TEXT NOT NULL,
-		list_type TEXT NOT NULL DEFAULT 'custom',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS book_reading_list (
-		book_id TEXT NOT NULL,
-		list_id TEXT NOT NULL,
-		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		position INTEGER DEFAULT 0,
-		PRIMARY KEY (book_id, list_id),
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-		FOREIGN KEY (list_id) REFERENCES reading_lists(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_reading_lists_user ON reading_lists(user_id);
-	CREATE INDEX IF NOT EXISTS idx_reading_lists_type ON reading_lists(list_type);
-	CREATE INDEX IF NOT EXISTS idx_book_reading_list_list ON book_reading_list(list_id);
-	`
-	d.db.Exec(readingListsSchema)
-
-	// Create custom tags tables
-	tagsSchema := `
-	CREATE TABLE IF NOT EXISTS tags (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		name TEXT NOT NULL,
-		color TEXT DEFAULT '#3b82f6',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(user_id, name),
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS book_tags (
-		book_id TEXT NOT NULL,
-		tag_id TEXT NOT NULL,
-		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY (book_id, tag_id),
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_tags_user ON tags(user_id);
-	CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(name);
-	CREATE INDEX IF NOT EXISTS idx_book_tags_tag ON book_tags(tag_id);
-	`
-	d.db.Exec(tagsSchema)
-
-	// Create annotations table for highlights and notes
-	annotationsSchema := `
-	CREATE TABLE IF NOT EXISTS annotations (
-		id TEXT PRIMARY KEY,
-		book_id TEXT NOT NULL,
-		user_id TEXT NOT NULL,
-		chapter TEXT NOT NULL,
-		cfi TEXT DEFAULT '',
-		start_offset INTEGER DEFAULT 0,
-		end_offset INTEGER DEFAULT 0,
-		selected_text TEXT NOT NULL,
-		note TEXT DEFAULT '',
-		color TEXT DEFAULT 'yellow',
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_annotations_book ON annotations(book_id);
-	CREATE INDEX IF NOT EXISTS idx_annotations_user ON annotations(user_id);
-	CREATE INDEX IF NOT EXISTS idx_annotations_book_user ON annotations(book_id, user_id);
-	CREATE INDEX IF NOT EXISTS idx_annotations_chapter ON annotations(chapter);
-	`
-	d.db.Exec(annotationsSchema)
-
-	// Create reading sessions and statistics tables
-	readingStatsSchema := `
-	CREATE TABLE IF NOT EXISTS reading_sessions (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		book_id TEXT NOT NULL,
-		start_time DATETIME NOT NULL,
-		end_time DATETIME,
-		pages_read INTEGER DEFAULT 0,
-		chapters_read INTEGER DEFAULT 0,
-		duration_seconds INTEGER DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS user_statistics (
-		user_id TEXT PRIMARY KEY,
-		total_books_read INTEGER DEFAULT 0,
-		total_pages_read INTEGER DEFAULT 0,
-		total_chapters_read INTEGER DEFAULT 0,
-		total_time_seconds INTEGER DEFAULT 0,
-		current_streak INTEGER DEFAULT 0,
-		longest_streak INTEGER DEFAULT 0,
-		last_reading_date DATE,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS daily_reading_stats (
-		id TEXT PRIMARY KEY,
-		user_id TEXT NOT NULL,
-		reading_date DATE NOT NULL,
-		pages_read INTEGER DEFAULT 0,
-		chapters_read INTEGER DEFAULT 0,
-		time_seconds INTEGER DEFAULT 0,
-		books_touched INTEGER DEFAULT 0,
-		UNIQUE(user_id, reading_date),
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_reading_sessions_user ON reading_sessions(user_id);
-	CREATE INDEX IF NOT EXISTS idx_reading_sessions_book ON reading_sessions(book_id);
-	CREATE INDEX IF NOT EXISTS idx_reading_sessions_start ON reading_sessions(start_time);
-	CREATE INDEX IF NOT EXISTS idx_daily_stats_user ON daily_reading_stats(user_id);
-	CREATE INDEX IF NOT EXISTS idx_daily_stats_date ON daily_reading_stats(reading_date);
-	`
-	d.db.Exec(readingStatsSchema)
-
-	return nil
+	return &Database{db: db}, nil
 }
 
 // CreateBook inserts a new book into the database
@@ -310,9 +53,14 @@ func (d *Database) CreateBook(book *models.Book) error {
 	if contentType == "" {
 		contentType = models.ContentTypeBook
 	}
-	// Default to "epub" if file format not set
+	// Default to "digital" if content source not set
+	contentSource := book.ContentSource
+	if contentSource == "" {
+		contentSource = models.ContentSourceDigital
+	}
+	// Default to "epub" if file format not set (physical books have no format)
 	fileFormat := book.FileFormat
-	if fileFormat == "" {
+	if fileFormat == "" && contentSource != models.ContentSourcePhysical {
 		fileFormat = models.FileFormatEPUB
 	}
 	// Default to "unread" if read status not set
@@ -320,29 +68,50 @@ func (d *Database) CreateBook(book *models.Book) error {
 	if readStatus == "" {
 		readStatus = models.ReadStatusUnread
 	}
+	// Default to left-to-right if reading direction not set
+	if book.ReadingDirection == "" {
+		book.ReadingDirection = models.ReadingDirectionLTR
+	}
+	// Default to private if visibility not set
+	if book.Visibility == "" {
+		book.Visibility = models.BookVisibilityPrivate
+	}
+	setSortKeys(book)
 	_, err := d.db.Exec(`
 		INSERT INTO books (id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at,
-			isbn, publisher, publish_date, description, language, subjects, metadata_source, metadata_updated, content_type, file_format, file_hash, read_status, date_completed, rating)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			isbn, publisher, publish_date, description, language, subjects, metadata_source, metadata_updated, content_type, file_format, file_hash, read_status, date_completed, rating, content_source,
+			sort_title, sort_author, reading_direction, long_strip, visibility, cover_palette, age_rating)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		book.ID, book.UserID, book.Title, book.Author, book.Series, book.SeriesIndex,
 		book.FilePath, book.CoverPath, book.FileSize, book.UploadedAt,
 		book.ISBN, book.Publisher, book.PublishDate, book.Description,
-		book.Language, book.Subjects, book.MetadataSource, book.MetadataUpdated, contentType, fileFormat, book.FileHash, readStatus, book.DateCompleted, book.Rating,
+		book.Language, book.Subjects, book.MetadataSource, book.MetadataUpdated, contentType, fileFormat, book.FileHash, readStatus, book.DateCompleted, book.Rating, contentSource,
+		book.SortTitle, book.SortAuthor, book.ReadingDirection, book.LongStrip, book.Visibility, strings.Join(book.CoverPalette, ","), book.AgeRating,
 	)
 	return err
 }
 
+// setSortKeys computes a book's ordering keys from its title, language, and
+// author
+func setSortKeys(book *models.Book) {
+	book.SortTitle = locale.StripArticle(book.Title, book.Language)
+	book.SortAuthor = locale.AuthorSort(book.Author)
+}
+
 // UpdateBookMetadata updates the metadata fields for a book
 func (d *Database) UpdateBookMetadata(book *models.Book) error {
+	setSortKeys(book)
 	_, err := d.db.Exec(`
 		UPDATE books SET
 			title = ?, author = ?, series = ?, series_index = ?,
 			isbn = ?, publisher = ?, publish_date = ?, description = ?,
-			language = ?, subjects = ?, metadata_source = ?, metadata_updated = ?
+			language = ?, subjects = ?, metadata_source = ?, metadata_updated = ?,
+			sort_title = ?, sort_author = ?
 		WHERE id = ?`,
 		book.Title, book.Author, book.Series, book.SeriesIndex,
 		book.ISBN, book.Publisher, book.PublishDate, book.Description,
 		book.Language, book.Subjects, book.MetadataSource, book.MetadataUpdated,
+		book.SortTitle, book.SortAuthor,
 		book.ID,
 	)
 	return err
@@ -357,28 +126,62 @@ func (d *Database) UpdateBookFilePaths(bookID, filePath, coverPath string) error
 	return err
 }
 
-// GetBook retrieves a book by ID
+// UpdateBookFile records a replacement file for a book: its path, format,
+// and cover with its palette, the metadata parsed from it, and its reading
+// direction. The stored structure and file check are cleared since they
+// described the old file.
+func (d *Database) UpdateBookFile(book *models.Book) error {
+	setSortKeys(book)
+	_, err := d.db.Exec(`
+		UPDATE books SET
+			file_path = ?, cover_path = ?, file_size = ?, file_format = ?, file_hash = ?, content_type = ?,
+			title = ?, author = ?, series = ?, series_index = ?,
+			isbn = ?, publisher = ?, publish_date = ?, description = ?,
+			language = ?, subjects = ?, metadata_source = ?, metadata_updated = ?,
+			sort_title = ?, sort_author = ?, reading_direction = ?, long_strip = ?, cover_palette = ?,
+			toc_json = '', page_count = 0, structure_updated_at = NULL
+		WHERE id = ?`,
+		book.FilePath, book.CoverPath, book.FileSize, book.FileFormat, book.FileHash, book.ContentType,
+		book.Title, book.Author, book.Series, book.SeriesIndex,
+		book.ISBN, book.Publisher, book.PublishDate, book.Description,
+		book.Language, book.Subjects, book.MetadataSource, book.MetadataUpdated,
+		book.SortTitle, book.SortAuthor, book.ReadingDirection, book.LongStrip, strings.Join(book.CoverPalette, ","),
+		book.ID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`DELETE FROM file_checks WHERE book_id = ?`, book.ID)
+	return err
+}
+
+// GetBook retrieves a book by ID, with the owner's read status and rating
 func (d *Database) GetBook(id string) (*models.Book, error) {
 	book := &models.Book{}
 	err := d.db.QueryRow(`
-		SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at,
-			COALESCE(isbn, ''), COALESCE(publisher, ''), COALESCE(publish_date, ''), COALESCE(description, ''),
-			COALESCE(language, ''), COALESCE(subjects, ''), COALESCE(metadata_source, 'epub'), metadata_updated,
-			COALESCE(content_type, 'book'), COALESCE(file_format, 'epub'), COALESCE(file_hash, ''),
-			COALESCE(read_status, 'unread'), date_completed, COALESCE(rating, 0)
-		FROM books WHERE id = ?`, id,
+		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at,
+			COALESCE(b.isbn, ''), COALESCE(b.publisher, ''), COALESCE(b.publish_date, ''), COALESCE(b.description, ''),
+			COALESCE(b.language, ''), COALESCE(b.subjects, ''), COALESCE(b.metadata_source, 'epub'), b.metadata_updated,
+			COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'), COALESCE(b.file_hash, ''),
+			COALESCE(s.read_status, 'unread'), s.date_completed, COALESCE(s.rating, 0), COALESCE(b.content_source, 'digital'),
+			b.sort_title, b.sort_author, b.reading_direction, b.long_strip, b.visibility, b.age_rating
+		FROM books b
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = b.user_id
+		WHERE b.id = ?`, id,
 	).Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
 		&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt,
 		&book.ISBN, &book.Publisher, &book.PublishDate, &book.Description,
 		&book.Language, &book.Subjects, &book.MetadataSource, &book.MetadataUpdated, &book.ContentType, &book.FileFormat, &book.FileHash,
-		&book.ReadStatus, &book.DateCompleted, &book.Rating)
+		&book.ReadStatus, &book.DateCompleted, &book.Rating, &book.ContentSource, &book.SortTitle, &book.SortAuthor,
+		&book.ReadingDirection, &book.LongStrip, &book.Visibility, &book.AgeRating)
 	if err != nil {
 		return nil, err
 	}
 	return book, nil
 }
 
-// GetBookForUser retrieves a book by ID if user has access (owner or shared)
+// GetBookForUser retrieves a book by ID if user has access (owner, shared,
+// or public) and their content restriction allows it
 func (d *Database) GetBookForUser(id, userID string) (*models.Book, error) {
 	book := &models.Book{}
 	err := d.db.QueryRow(`
@@ -386,18 +189,30 @@ func (d *Database) GetBookForUser(id, userID string) (*models.Book, error) {
 			COALESCE(b.isbn, ''), COALESCE(b.publisher, ''), COALESCE(b.publish_date, ''), COALESCE(b.description, ''),
 			COALESCE(b.language, ''), COALESCE(b.subjects, ''), COALESCE(b.metadata_source, 'epub'), b.metadata_updated,
 			COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'), COALESCE(b.file_hash, ''),
-			COALESCE(b.read_status, 'unread'), b.date_completed, COALESCE(b.rating, 0)
+			COALESCE(s.read_status, 'unread'), s.date_completed, COALESCE(s.rating, 0), COALESCE(b.content_source, 'digital'),
+			b.sort_title, b.sort_author, b.reading_direction, b.long_strip, b.visibility, b.age_rating
 		FROM books b
 		LEFT JOIN book_shares bs ON b.id = bs.book_id AND bs.shared_with_id = ?
-		WHERE b.id = ? AND (b.user_id = ? OR b.user_id = '' OR bs.id IS NOT NULL)`, userID, id, userID,
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+		WHERE b.id = ? AND (b.user_id = ? OR b.user_id = '' OR b.visibility = 'public' OR bs.id IS NOT NULL)`, userID, userID, id, userID,
 	).Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
 		&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt,
 		&book.ISBN, &book.Publisher, &book.PublishDate, &book.Description,
 		&book.Language, &book.Subjects, &book.MetadataSource, &book.MetadataUpdated, &book.ContentType, &book.FileFormat, &book.FileHash,
-		&book.ReadStatus, &book.DateCompleted, &book.Rating)
+		&book.ReadStatus, &book.DateCompleted, &book.Rating, &book.ContentSource, &book.SortTitle, &book.SortAuthor,
+		&book.ReadingDirection, &book.LongStrip, &book.Visibility, &book.AgeRating)
+	if err != nil {
+		return nil, err
+	}
+
+	// Books the user's content restriction hides are as good as missing
+	max, err := d.GetUserMaxAgeRating(userID)
 	if err != nil {
 		return nil, err
 	}
+	if !models.AgeRatingAllowed(max, book.AgeRating) {
+		return nil, sql.ErrNoRows
+	}
 	return book, nil
 }
 
@@ -421,9 +236,9 @@ func (d *Database) ListBooksForUserWithFilters(userID, sortBy, order, contentTyp
 	// Define sort columns - each column needs order applied
 	// Using COALESCE to handle NULL/empty authors - sort them at the end
 	validSort := map[string][]string{
-		"title":  {"title"},
-		"author": {"CASE WHEN author = '' OR author IS NULL THEN 1 ELSE 0 END", "author", "series", "series_index", "title"},
-		"series": {"series", "series_index", "title"},
+		"title":  {"sort_title COLLATE NOCASE", "title"},
+		"author": {"CASE WHEN author = '' OR author IS NULL THEN 1 ELSE 0 END", "sort_author COLLATE NOCASE", "series", "series_index", "sort_title COLLATE NOCASE"},
+		"series": {"series", "series_index", "sort_title COLLATE NOCASE"},
 		"date":   {"uploaded_at"},
 	}
 
@@ -447,24 +262,26 @@ func (d *Database) ListBooksForUserWithFilters(userID, sortBy, order, contentTyp
 	var query string
 	var args []interface{}
 
-	baseSelect := "SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at, COALESCE(content_type, 'book'), COALESCE(file_format, 'epub'), COALESCE(read_status, 'unread') FROM books WHERE "
+	baseSelect := "SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at, COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'), COALESCE(s.read_status, 'unread'), COALESCE(b.content_source, 'digital'), COALESCE(b.language, ''), b.sort_title, b.sort_author FROM books b " +
+		"LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ? WHERE "
+	args = append(args, userID)
 
 	if userID != "" {
-		query = baseSelect + "user_id = ?"
+		query = baseSelect + "b.user_id = ?"
 		args = append(args, userID)
 	} else {
-		query = baseSelect + "user_id = ''"
+		query = baseSelect + "(b.user_id = '' OR b.visibility = 'public')"
 	}
 
 	// Add content type filter if specified
 	if contentType != "" && (contentType == models.ContentTypeBook || contentType == models.ContentTypeComic) {
-		query += " AND COALESCE(content_type, 'book') = ?"
+		query += " AND COALESCE(b.content_type, 'book') = ?"
 		args = append(args, contentType)
 	}
 
 	// Add read status filter if specified
 	if readStatus != "" && (readStatus == models.ReadStatusUnread || readStatus == models.ReadStatusReading || readStatus == models.ReadStatusCompleted) {
-		query += " AND COALESCE(read_status, 'unread') = ?"
+		query += " AND COALESCE(s.read_status, 'unread') = ?"
 		args = append(args, readStatus)
 	}
 
@@ -480,7 +297,8 @@ func (d *Database) ListBooksForUserWithFilters(userID, sortBy, order, contentTyp
 	for rows.Next() {
 		var book models.Book
 		err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
-			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentType, &book.FileFormat, &book.ReadStatus)
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentType, &book.FileFormat, &book.ReadStatus, &book.ContentSource, &book.Language,
+			&book.SortTitle, &book.SortAuthor)
 		if err != nil {
 			return nil, err
 		}
@@ -490,32 +308,87 @@ func (d *Database) ListBooksForUserWithFilters(userID, sortBy, order, contentTyp
 	return books, nil
 }
 
+// ListRecentlyUpdatedBooks returns up to limit of a user's books, or the
+// anonymous library's and public books when userID is empty, whose metadata
+// has been edited or refreshed since they were added, most recently changed
+// first
+func (d *Database) ListRecentlyUpdatedBooks(userID string, limit int) ([]models.Book, error) {
+	where := "b.user_id = ?"
+	args := []interface{}{userID}
+	if userID == "" {
+		where = "(b.user_id = '' OR b.visibility = 'public')"
+		args = nil
+	}
+	rows, err := d.db.Query(`
+		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at, COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'),
+			COALESCE(b.content_source, 'digital'), COALESCE(b.language, ''), b.sort_title, b.sort_author, b.metadata_updated
+		FROM books b
+		WHERE `+where+` AND b.metadata_updated > b.uploaded_at
+		ORDER BY b.metadata_updated DESC
+		LIMIT ?`, append(args, limit)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentType, &book.FileFormat, &book.ContentSource, &book.Language,
+			&book.SortTitle, &book.SortAuthor, &book.MetadataUpdated); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
 // SearchBooks searches books by title, author, or series
 func (d *Database) SearchBooks(query string) ([]models.Book, error) {
 	return d.SearchBooksForUser(query, "")
 }
 
-// SearchBooksForUser searches books for a specific user
+// Weights of the book fields SearchBooksForUser matches
+const (
+	searchWeightTitle    = 3
+	searchWeightSeries   = 2
+	searchWeightAuthor   = 2
+	searchWeightSubjects = 1
+)
+
+// SearchBooksForUser searches a user's books, or the anonymous library's and
+// public books when userID is empty, by title, author, series, and subjects.
+// Matching forgives accents, case, and single typos (see package search);
+// results come best match first, then in title order.
 func (d *Database) SearchBooksForUser(query, userID string) ([]models.Book, error) {
-	searchTerm := "%" + query + "%"
+	q := search.NewQuery(query)
+	if q.Empty() {
+		return nil, nil
+	}
+
 	var rows *sql.Rows
 	var err error
 
 	if userID != "" {
 		rows, err = d.db.Query(`
-			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at, COALESCE(content_type, 'book'), COALESCE(file_format, 'epub')
-			FROM books
-			WHERE user_id = ? AND (title LIKE ? OR author LIKE ? OR series LIKE ?)
-			ORDER BY title`,
-			userID, searchTerm, searchTerm, searchTerm,
+			SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at, COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'),
+				COALESCE(s.read_status, 'unread'), COALESCE(b.content_source, 'digital'), COALESCE(b.language, ''), b.sort_title, b.sort_author, COALESCE(b.subjects, '')
+			FROM books b
+			LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = b.user_id
+			WHERE b.user_id = ?
+			ORDER BY b.sort_title COLLATE NOCASE, b.title`,
+			userID,
 		)
 	} else {
 		rows, err = d.db.Query(`
-			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at, COALESCE(content_type, 'book'), COALESCE(file_format, 'epub')
-			FROM books
-			WHERE user_id = '' AND (title LIKE ? OR author LIKE ? OR series LIKE ?)
-			ORDER BY title`,
-			searchTerm, searchTerm, searchTerm,
+			SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at, COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'),
+				COALESCE(s.read_status, 'unread'), COALESCE(b.content_source, 'digital'), COALESCE(b.language, ''), b.sort_title, b.sort_author, COALESCE(b.subjects, '')
+			FROM books b
+			LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ''
+			WHERE (b.user_id = '' OR b.visibility = 'public')
+			ORDER BY b.sort_title COLLATE NOCASE, b.title`,
 		)
 	}
 
@@ -524,20 +397,161 @@ func (d *Database) SearchBooksForUser(query, userID string) ([]models.Book, erro
 	}
 	defer rows.Close()
 
-	var books []models.Book
+	type match struct {
+		book  models.Book
+		score float64
+	}
+	var matches []match
 	for rows.Next() {
 		var book models.Book
 		err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
-			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentType, &book.FileFormat)
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentType, &book.FileFormat, &book.ReadStatus, &book.ContentSource, &book.Language,
+			&book.SortTitle, &book.SortAuthor, &book.Subjects)
 		if err != nil {
 			return nil, err
 		}
-		books = append(books, book)
+		score := q.Score(
+			search.Field{Text: book.Title, Weight: searchWeightTitle},
+			search.Field{Text: book.Series, Weight: searchWeightSeries},
+			search.Field{Text: book.Author, Weight: searchWeightAuthor},
+			search.Field{Text: book.Subjects, Weight: searchWeightSubjects},
+		)
+		if score > 0 {
+			matches = append(matches, match{book, score})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	var books []models.Book
+	for _, m := range matches {
+		books = append(books, m.book)
+	}
 	return books, nil
 }
 
+// SearchCatalog returns one page of the user's downloadable books whose
+// title, author, series, subjects, or description contain query, in title
+// order, along with the total number of matches. Books the user's content
+// restriction hides are left out.
+func (d *Database) SearchCatalog(userID, query string, offset, limit int) ([]models.Book, int, error) {
+	term := "%" + query + "%"
+	where := `
+		WHERE b.user_id = ? AND COALESCE(b.content_source, 'digital') != 'physical'
+			AND (b.title LIKE ? OR b.author LIKE ? OR b.series LIKE ?
+				OR COALESCE(b.subjects, '') LIKE ? OR COALESCE(b.description, '') LIKE ?)`
+	args := []interface{}{userID, term, term, term, term, term}
+
+	// Books the user's content restriction hides aren't counted either
+	max, err := d.GetUserMaxAgeRating(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if max != "" {
+		in, ratings := allowedAgeRatings(max)
+		where += ` AND b.age_rating ` + in
+		args = append(args, ratings...)
+	}
+
+	var total int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM books b`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at,
+			COALESCE(b.publisher, ''), COALESCE(b.publish_date, ''), COALESCE(b.description, ''), COALESCE(b.language, ''),
+			COALESCE(b.subjects, ''), COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'), COALESCE(b.content_source, 'digital')
+		FROM books b`+where+`
+		ORDER BY b.sort_title COLLATE NOCASE, b.title
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt,
+			&book.Publisher, &book.PublishDate, &book.Description, &book.Language,
+			&book.Subjects, &book.ContentType, &book.FileFormat, &book.ContentSource); err != nil {
+			return nil, 0, err
+		}
+		books = append(books, book)
+	}
+	return books, total, rows.Err()
+}
+
+// FindBooksByISBN returns books in the user's library (owned or public) whose
+// ISBN matches any of the given ISBNs. Hyphens and spaces in stored ISBNs are ignored.
+func (d *Database) FindBooksByISBN(userID string, isbns ...string) ([]models.Book, error) {
+	var placeholders []string
+	args := []interface{}{userID}
+	for _, isbn := range isbns {
+		if isbn == "" {
+			continue
+		}
+		placeholders = append(placeholders, "?")
+		args = append(args, isbn)
+	}
+	if len(placeholders) == 0 {
+		return nil, nil
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at,
+			COALESCE(isbn, ''), COALESCE(content_type, 'book'), COALESCE(file_format, 'epub'), COALESCE(content_source, 'digital')
+		FROM books
+		WHERE (user_id = ? OR user_id = '')
+			AND UPPER(REPLACE(REPLACE(COALESCE(isbn, ''), '-', ''), ' ', '')) IN (`+strings.Join(placeholders, ",")+`)
+		ORDER BY title`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ISBN, &book.ContentType, &book.FileFormat, &book.ContentSource); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// ListBooksForMetadataReport returns the books a user owns with the fields
+// the metadata issues report checks, ordered by title
+func (d *Database) ListBooksForMetadataReport(userID string) ([]models.Book, error) {
+	rows, err := d.db.Query(`
+		SELECT id, title, author, COALESCE(isbn, ''), COALESCE(description, ''), cover_path, file_path, file_size,
+			COALESCE(file_format, 'epub'), COALESCE(content_source, 'digital')
+		FROM books
+		WHERE user_id = ?
+		ORDER BY title COLLATE NOCASE, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Description, &book.CoverPath,
+			&book.FilePath, &book.FileSize, &book.FileFormat, &book.ContentSource); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
 // GetBooksByAuthor returns books grouped by author (legacy - no user filter)
 func (d *Database) GetBooksByAuthor() (map[string][]models.Book, error) {
 	return d.GetBooksByAuthorForUser("")
@@ -550,9 +564,18 @@ func (d *Database) GetBooksByAuthorForUser(userID string) (map[string][]models.B
 		return nil, err
 	}
 
+	// Spellings of the same name ("J.R.R. Tolkien", "Tolkien, J.R.R.") share
+	// a sort author and are grouped under the first spelling seen
 	grouped := make(map[string][]models.Book)
+	names := make(map[string]string)
 	for _, book := range books {
-		grouped[book.Author] = append(grouped[book.Author], book)
+		key := strings.ToLower(book.SortAuthor)
+		name, ok := names[key]
+		if !ok {
+			name = book.Author
+			names[key] = name
+		}
+		grouped[name] = append(grouped[name], book)
 	}
 
 	return grouped, nil
@@ -570,15 +593,17 @@ func (d *Database) GetBooksBySeriesForUser(userID string) (map[string][]models.B
 
 	if userID != "" {
 		rows, err = d.db.Query(`
-			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at
+			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at,
+				COALESCE(content_source, 'digital')
 			FROM books
 			WHERE user_id = ? AND series != ''
 			ORDER BY series, series_index`, userID)
 	} else {
 		rows, err = d.db.Query(`
-			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at
+			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size, uploaded_at,
+				COALESCE(content_source, 'digital')
 			FROM books
-			WHERE user_id = '' AND series != ''
+			WHERE (user_id = '' OR visibility = 'public') AND series != ''
 			ORDER BY series, series_index`)
 	}
 
@@ -591,7 +616,7 @@ func (d *Database) GetBooksBySeriesForUser(userID string) (map[string][]models.B
 	for rows.Next() {
 		var book models.Book
 		err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
-			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt)
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentSource)
 		if err != nil {
 			return nil, err
 		}
@@ -610,13 +635,14 @@ func (d *Database) DeleteBook(id string) error {
 // SaveReadingPosition saves or updates reading position for a user
 func (d *Database) SaveReadingPosition(pos *models.ReadingPosition) error {
 	_, err := d.db.Exec(`
-		INSERT INTO reading_positions (book_id, user_id, chapter, position, updated_at)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO reading_positions (book_id, user_id, chapter, position, cfi, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
 		ON CONFLICT(book_id, user_id) DO UPDATE SET
 			chapter = excluded.chapter,
 			position = excluded.position,
+			cfi = excluded.cfi,
 			updated_at = excluded.updated_at`,
-		pos.BookID, pos.UserID, pos.Chapter, pos.Position, time.Now(),
+		pos.BookID, pos.UserID, pos.Chapter, pos.Position, pos.CFI, time.Now(),
 	)
 	return err
 }
@@ -625,15 +651,56 @@ func (d *Database) SaveReadingPosition(pos *models.ReadingPosition) error {
 func (d *Database) GetReadingPosition(bookID, userID string) (*models.ReadingPosition, error) {
 	pos := &models.ReadingPosition{}
 	err := d.db.QueryRow(`
-		SELECT book_id, user_id, chapter, position, updated_at
+		SELECT book_id, user_id, chapter, position, cfi, updated_at
 		FROM reading_positions WHERE book_id = ? AND user_id = ?`, bookID, userID,
-	).Scan(&pos.BookID, &pos.UserID, &pos.Chapter, &pos.Position, &pos.UpdatedAt)
+	).Scan(&pos.BookID, &pos.UserID, &pos.Chapter, &pos.Position, &pos.CFI, &pos.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return pos, nil
 }
 
+// GetReadingPositionsForBook returns every user's reading position in a book
+func (d *Database) GetReadingPositionsForBook(bookID string) ([]models.ReadingPosition, error) {
+	rows, err := d.db.Query(`
+		SELECT book_id, user_id, chapter, position, cfi, updated_at
+		FROM reading_positions WHERE book_id = ?`, bookID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanReadingPositions(rows)
+}
+
+// GetReadingPositionsForUser returns a user's reading position in every book
+// they've opened
+func (d *Database) GetReadingPositionsForUser(userID string) ([]models.ReadingPosition, error) {
+	rows, err := d.db.Query(`
+		SELECT book_id, user_id, chapter, position, cfi, updated_at
+		FROM reading_positions WHERE user_id = ?
+		ORDER BY updated_at DESC`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanReadingPositions(rows)
+}
+
+// scanReadingPositions reads reading positions, closing rows
+func scanReadingPositions(rows *sql.Rows) ([]models.ReadingPosition, error) {
+	defer rows.Close()
+
+	var positions []models.ReadingPosition
+	for rows.Next() {
+		var pos models.ReadingPosition
+		if err := rows.Scan(&pos.BookID, &pos.UserID, &pos.Chapter, &pos.Position, &pos.CFI, &pos.UpdatedAt); err != nil {
+			return nil, err
+		}
+		positions = append(positions, pos)
+	}
+	return positions, rows.Err()
+}
+
 // CreateCollection creates a new collection
 func (d *Database) CreateCollection(collection *models.Collection) error {
 	isSmart := 0
@@ -645,10 +712,13 @@ func (d *Database) CreateCollection(collection *models.Collection) error {
 		ruleLogic = "AND"
 	}
 	_, err := d.db.Exec(`
-		INSERT INTO collections (id, user_id, name, is_smart, rule_logic, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		collection.ID, collection.UserID, collection.Name, isSmart, ruleLogic, collection.CreatedAt,
+		INSERT INTO collections (id, user_id, name, is_smart, rule_logic, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		collection.ID, collection.UserID, collection.Name, isSmart, ruleLogic, collection.CreatedAt, collection.CreatedAt,
 	)
+	if err == nil {
+		collection.UpdatedAt = collection.CreatedAt
+	}
 	return err
 }
 
@@ -657,14 +727,16 @@ func (d *Database) GetCollection(id string) (*models.Collection, error) {
 	collection := &models.Collection{}
 	var isSmart int
 	var userID, ruleLogic sql.NullString
+	var updatedAt sql.NullTime
 	err := d.db.QueryRow(`
-		SELECT id, user_id, name, COALESCE(is_smart, 0), COALESCE(rule_logic, 'AND'), created_at
+		SELECT id, user_id, name, COALESCE(is_smart, 0), COALESCE(rule_logic, 'AND'), created_at, updated_at, COALESCE(parent_id, '')
 		FROM collections WHERE id = ?`, id,
-	).Scan(&collection.ID, &userID, &collection.Name, &isSmart, &ruleLogic, &collection.CreatedAt)
+	).Scan(&collection.ID, &userID, &collection.Name, &isSmart, &ruleLogic, &collection.CreatedAt, &updatedAt, &collection.ParentID)
 	if err != nil {
 		return nil, err
 	}
 	collection.IsSmart = isSmart == 1
+	collection.UpdatedAt = collectionUpdatedAt(collection.CreatedAt, updatedAt)
 	if userID.Valid {
 		collection.UserID = userID.String
 	}
@@ -679,7 +751,7 @@ func (d *Database) GetCollection(id string) (*models.Collection, error) {
 // ListCollections returns all collections
 func (d *Database) ListCollections() ([]models.Collection, error) {
 	rows, err := d.db.Query(`
-		SELECT id, user_id, name, COALESCE(is_smart, 0), COALESCE(rule_logic, 'AND'), created_at
+		SELECT id, user_id, name, COALESCE(is_smart, 0), COALESCE(rule_logic, 'AND'), created_at, updated_at, COALESCE(parent_id, '')
 		FROM collections ORDER BY name`)
 	if err != nil {
 		return nil, err
@@ -691,10 +763,12 @@ func (d *Database) ListCollections() ([]models.Collection, error) {
 		var c models.Collection
 		var isSmart int
 		var userID, ruleLogic sql.NullString
-		if err := rows.Scan(&c.ID, &userID, &c.Name, &isSmart, &ruleLogic, &c.CreatedAt); err != nil {
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &userID, &c.Name, &isSmart, &ruleLogic, &c.CreatedAt, &updatedAt, &c.ParentID); err != nil {
 			return nil, err
 		}
 		c.IsSmart = isSmart == 1
+		c.UpdatedAt = collectionUpdatedAt(c.CreatedAt, updatedAt)
 		if userID.Valid {
 			c.UserID = userID.String
 		}
@@ -708,6 +782,103 @@ func (d *Database) ListCollections() ([]models.Collection, error) {
 	return collections, nil
 }
 
+// ListCollectionsWithCounts returns all collections with their book counts:
+// the books added to static collections, and the books in userID's library
+// matching smart collections' rules. The counts are taken in one statement,
+// so they agree with each other even while books are being added.
+func (d *Database) ListCollectionsWithCounts(userID string) ([]models.Collection, error) {
+	rules, err := d.smartCollectionRules()
+	if err != nil {
+		return nil, err
+	}
+
+	// Static collections count their members; each smart collection with
+	// rules adds a row counting its matches
+	counts := []string{`
+		SELECT bc.collection_id AS id, COUNT(*) AS books
+		FROM book_collections bc
+		JOIN books b ON b.id = bc.book_id
+		JOIN collections sc ON sc.id = bc.collection_id AND COALESCE(sc.is_smart, 0) = 0
+		GROUP BY bc.collection_id`}
+	var args []interface{}
+	for id, set := range rules {
+		from, fromArgs := d.smartCollectionFrom(set.logic, set.rules, userID)
+		counts = append(counts, `SELECT ?, COUNT(DISTINCT b.id) `+from)
+		args = append(append(args, id), fromArgs...)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT c.id, c.user_id, c.name, COALESCE(c.is_smart, 0), COALESCE(c.rule_logic, 'AND'), c.created_at, c.updated_at,
+			COALESCE(c.parent_id, ''), COALESCE(n.books, 0)
+		FROM collections c
+		LEFT JOIN (`+strings.Join(counts, " UNION ALL ")+`) n ON n.id = c.id
+		ORDER BY c.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []models.Collection
+	for rows.Next() {
+		var c models.Collection
+		var isSmart int
+		var userID, ruleLogic sql.NullString
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &userID, &c.Name, &isSmart, &ruleLogic, &c.CreatedAt, &updatedAt, &c.ParentID, &c.BookCount); err != nil {
+			return nil, err
+		}
+		c.IsSmart = isSmart == 1
+		c.UserID = userID.String
+		c.RuleLogic = ruleLogic.String
+		c.UpdatedAt = collectionUpdatedAt(c.CreatedAt, updatedAt)
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// collectionUpdatedAt returns when a collection last changed, which for
+// rows never changed since updated_at was added is when it was created
+func collectionUpdatedAt(createdAt time.Time, updatedAt sql.NullTime) time.Time {
+	if updatedAt.Valid {
+		return updatedAt.Time
+	}
+	return createdAt
+}
+
+// smartRuleSet is a smart collection's rules and how they combine
+type smartRuleSet struct {
+	logic string
+	rules []models.CollectionRule
+}
+
+// smartCollectionRules returns the rules of every smart collection that has
+// any, by collection ID
+func (d *Database) smartCollectionRules() (map[string]*smartRuleSet, error) {
+	rows, err := d.db.Query(`
+		SELECT c.id, COALESCE(c.rule_logic, 'AND'), r.id, r.field, r.operator, r.value
+		FROM collections c
+		JOIN collection_rules r ON r.collection_id = c.id
+		WHERE c.is_smart = 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := map[string]*smartRuleSet{}
+	for rows.Next() {
+		var logic string
+		var r models.CollectionRule
+		if err := rows.Scan(&r.CollectionID, &logic, &r.ID, &r.Field, &r.Operator, &r.Value); err != nil {
+			return nil, err
+		}
+		if sets[r.CollectionID] == nil {
+			sets[r.CollectionID] = &smartRuleSet{logic: logic}
+		}
+		sets[r.CollectionID].rules = append(sets[r.CollectionID].rules, r)
+	}
+	return sets, rows.Err()
+}
+
 // UpdateCollection updates a collection's name
 func (d *Database) UpdateCollection(id, name string) error {
 	_, err := d.db.Exec(`UPDATE collections SET name = ? WHERE id = ?`, name, id)
@@ -720,12 +891,15 @@ func (d *Database) DeleteCollection(id string) error {
 	return err
 }
 
-// AddBookToCollection adds a book to a collection
+// addToCollection adds a book at the end of a collection, leaving it where
+// it is if it's already there
+const addToCollection = `
+	INSERT OR IGNORE INTO book_collections (book_id, collection_id, position)
+	SELECT ?, ?, COALESCE(MAX(position), -1) + 1 FROM book_collections WHERE collection_id = ?`
+
+// AddBookToCollection adds a book to the end of a collection
 func (d *Database) AddBookToCollection(bookID, collectionID string) error {
-	_, err := d.db.Exec(`
-		INSERT OR IGNORE INTO book_collections (book_id, collection_id)
-		VALUES (?, ?)`, bookID, collectionID,
-	)
+	_, err := d.db.Exec(addToCollection, bookID, collectionID, collectionID)
 	return err
 }
 
@@ -738,14 +912,14 @@ func (d *Database) RemoveBookFromCollection(bookID, collectionID string) error {
 	return err
 }
 
-// GetBooksInCollection returns all books in a collection
+// GetBooksInCollection returns all books in a collection, in its order
 func (d *Database) GetBooksInCollection(collectionID string) ([]models.Book, error) {
 	rows, err := d.db.Query(`
 		SELECT b.id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size, b.uploaded_at
 		FROM books b
 		JOIN book_collections bc ON b.id = bc.book_id
 		WHERE bc.collection_id = ?
-		ORDER BY b.title`, collectionID,
+		ORDER BY bc.position, b.title`, collectionID,
 	)
 	if err != nil {
 		return nil, err
@@ -768,7 +942,7 @@ func (d *Database) GetBooksInCollection(collectionID string) ([]models.Book, err
 // GetCollectionsForBook returns all collections a book belongs to
 func (d *Database) GetCollectionsForBook(bookID string) ([]models.Collection, error) {
 	rows, err := d.db.Query(`
-		SELECT c.id, c.name, c.created_at
+		SELECT c.id, c.name, c.created_at, c.updated_at
 		FROM collections c
 		JOIN book_collections bc ON c.id = bc.collection_id
 		WHERE bc.book_id = ?
@@ -782,22 +956,25 @@ func (d *Database) GetCollectionsForBook(bookID string) ([]models.Collection, er
 	var collections []models.Collection
 	for rows.Next() {
 		var c models.Collection
-		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt); err != nil {
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt, &updatedAt); err != nil {
 			return nil, err
 		}
+		c.UpdatedAt = collectionUpdatedAt(c.CreatedAt, updatedAt)
 		collections = append(collections, c)
 	}
 	return collections, nil
 }
 
-// BulkAddBooksToCollection adds multiple books to a collection
+// BulkAddBooksToCollection adds multiple books to the end of a collection,
+// in the order given
 func (d *Database) BulkAddBooksToCollection(bookIDs []string, collectionID string) error {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO book_collections (book_id, collection_id) VALUES (?, ?)`)
+	stmt, err := tx.Prepare(addToCollection)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -805,7 +982,32 @@ func (d *Database) BulkAddBooksToCollection(bookIDs []string, collectionID strin
 	defer stmt.Close()
 
 	for _, bookID := range bookIDs {
-		if _, err := stmt.Exec(bookID, collectionID); err != nil {
+		if _, err := stmt.Exec(bookID, collectionID, collectionID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReorderCollection sets the order of books in a collection. Books left
+// out keep their positions.
+func (d *Database) ReorderCollection(collectionID string, bookIDs []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`UPDATE book_collections SET position = ? WHERE book_id = ? AND collection_id = ?`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for i, bookID := range bookIDs {
+		if _, err := stmt.Exec(i, bookID, collectionID); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -814,6 +1016,17 @@ func (d *Database) BulkAddBooksToCollection(bookIDs []string, collectionID strin
 	return tx.Commit()
 }
 
+// SetCollectionParent moves a collection inside another, or to the top
+// level if parentID is empty
+func (d *Database) SetCollectionParent(id, parentID string) error {
+	var parent interface{}
+	if parentID != "" {
+		parent = parentID
+	}
+	_, err := d.db.Exec(`UPDATE collections SET parent_id = ? WHERE id = ?`, parent, id)
+	return err
+}
+
 // UpdateSmartCollection updates a smart collection's settings
 func (d *Database) UpdateSmartCollection(id, name, ruleLogic string) error {
 	_, err := d.db.Exec(`UPDATE collections SET name = ?, rule_logic = ? WHERE id = ?`, name, ruleLogic, id)
@@ -877,44 +1090,19 @@ func (d *Database) GetSmartCollectionBooks(collectionID, userID string) ([]model
 		return []models.Book{}, nil
 	}
 
-	// Build dynamic query based on rules
+	from, args := d.smartCollectionFrom(collection.RuleLogic, rules, userID)
 	query := `SELECT DISTINCT b.id, b.title, b.author, b.series, b.series_index,
 		b.file_path, b.cover_path, b.file_size, b.uploaded_at,
 		COALESCE(b.isbn, ''), COALESCE(b.publisher, ''), COALESCE(b.publish_date, ''),
 		COALESCE(b.description, ''), COALESCE(b.language, ''), COALESCE(b.subjects, ''),
 		COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'),
-		COALESCE(b.read_status, 'unread'), COALESCE(b.rating, 0)
-		FROM books b
-		LEFT JOIN book_tags bt ON b.id = bt.book_id
-		LEFT JOIN tags t ON bt.tag_id = t.id
-		WHERE b.user_id = ?`
-
-	args := []interface{}{userID}
-	conditions := []string{}
+		COALESCE(s.read_status, 'unread'), COALESCE(s.rating, 0) ` + from + ` ORDER BY b.title`
 
-	for _, rule := range rules {
-		cond, ruleArgs := d.buildRuleCondition(rule)
-		if cond != "" {
-			conditions = append(conditions, cond)
-			args = append(args, ruleArgs...)
-		}
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
-
-	if len(conditions) > 0 {
-		joiner := " AND "
-		if collection.RuleLogic == "OR" {
-			joiner = " OR "
-		}
-		query += " AND (" + strings.Join(conditions, joiner) + ")"
-	}
-
-	query += " ORDER BY b.title"
-
-	rows, err := d.db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	defer rows.Close()
 
 	var books []models.Book
 	for rows.Next() {
@@ -932,10 +1120,44 @@ func (d *Database) GetSmartCollectionBooks(collectionID, userID string) ([]model
 	return books, nil
 }
 
+// smartCollectionFrom builds the FROM and WHERE clauses selecting the books
+// in userID's library that match a smart collection's rules, as b
+func (d *Database) smartCollectionFrom(ruleLogic string, rules []models.CollectionRule, userID string) (string, []interface{}) {
+	from := `FROM books b
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = b.user_id
+		LEFT JOIN book_tags bt ON b.id = bt.book_id
+		LEFT JOIN tags t ON bt.tag_id = t.id AND t.user_id = b.user_id
+		WHERE b.user_id = ?`
+
+	args := []interface{}{userID}
+	conditions := []string{}
+
+	for _, rule := range rules {
+		cond, ruleArgs := d.buildRuleCondition(rule)
+		if cond != "" {
+			conditions = append(conditions, cond)
+			args = append(args, ruleArgs...)
+		}
+	}
+
+	if len(conditions) > 0 {
+		joiner := " AND "
+		if ruleLogic == "OR" {
+			joiner = " OR "
+		}
+		from += " AND (" + strings.Join(conditions, joiner) + ")"
+	}
+	return from, args
+}
+
 // buildRuleCondition builds a SQL condition for a single rule
 func (d *Database) buildRuleCondition(rule models.CollectionRule) (string, []interface{}) {
 	var args []interface{}
 
+	if key, ok := strings.CutPrefix(rule.Field, models.RuleFieldCustomPrefix); ok {
+		return d.customRuleCondition(key, rule)
+	}
+
 	switch rule.Field {
 	case models.RuleFieldAuthor:
 		switch rule.Operator {
@@ -987,15 +1209,15 @@ func (d *Database) buildRuleCondition(rule models.CollectionRule) (string, []int
 	case models.RuleFieldRating:
 		switch rule.Operator {
 		case models.RuleOpEquals:
-			return "b.rating = ?", []interface{}{rule.Value}
+			return "COALESCE(s.rating, 0) = ?", []interface{}{rule.Value}
 		case models.RuleOpGreaterThan:
-			return "b.rating > ?", []interface{}{rule.Value}
+			return "COALESCE(s.rating, 0) > ?", []interface{}{rule.Value}
 		case models.RuleOpLessThan:
-			return "b.rating < ?", []interface{}{rule.Value}
+			return "COALESCE(s.rating, 0) < ?", []interface{}{rule.Value}
 		}
 
 	case models.RuleFieldReadStatus:
-		return "b.read_status = ?", []interface{}{rule.Value}
+		return "COALESCE(s.read_status, 'unread') = ?", []interface{}{rule.Value}
 
 	case models.RuleFieldFileSize:
 		switch rule.Operator {
@@ -1012,7 +1234,7 @@ func (d *Database) buildRuleCondition(rule models.CollectionRule) (string, []int
 // ListSmartCollections returns all smart collections for a user
 func (d *Database) ListSmartCollections(userID string) ([]models.Collection, error) {
 	rows, err := d.db.Query(`
-		SELECT id, user_id, name, COALESCE(is_smart, 0), COALESCE(rule_logic, 'AND'), created_at
+		SELECT id, user_id, name, COALESCE(is_smart, 0), COALESCE(rule_logic, 'AND'), created_at, updated_at
 		FROM collections WHERE is_smart = 1 AND user_id = ? ORDER BY name`, userID)
 	if err != nil {
 		return nil, err
@@ -1024,10 +1246,12 @@ func (d *Database) ListSmartCollections(userID string) ([]models.Collection, err
 		var c models.Collection
 		var isSmart int
 		var uID, ruleLogic sql.NullString
-		if err := rows.Scan(&c.ID, &uID, &c.Name, &isSmart, &ruleLogic, &c.CreatedAt); err != nil {
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &uID, &c.Name, &isSmart, &ruleLogic, &c.CreatedAt, &updatedAt); err != nil {
 			return nil, err
 		}
 		c.IsSmart = isSmart == 1
+		c.UpdatedAt = collectionUpdatedAt(c.CreatedAt, updatedAt)
 		if uID.Valid {
 			c.UserID = uID.String
 		}
@@ -1044,9 +1268,9 @@ func (d *Database) ListSmartCollections(userID string) ([]models.Collection, err
 // CreateUser creates a new user
 func (d *Database) CreateUser(user *models.User) error {
 	_, err := d.db.Exec(`
-		INSERT INTO users (id, username, email, password_hash, created_at)
-		VALUES (?, ?, ?, ?, ?)`,
-		user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt,
+		INSERT INTO users (id, username, email, password_hash, email_verified, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Username, user.Email, user.PasswordHash, user.EmailVerified, user.CreatedAt,
 	)
 	return err
 }
@@ -1055,9 +1279,9 @@ func (d *Database) CreateUser(user *models.User) error {
 func (d *Database) GetUserByID(id string) (*models.User, error) {
 	user := &models.User{}
 	err := d.db.QueryRow(`
-		SELECT id, username, email, password_hash, created_at
+		SELECT id, username, email, password_hash, email_verified, created_at
 		FROM users WHERE id = ?`, id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.EmailVerified, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -1068,9 +1292,9 @@ func (d *Database) GetUserByID(id string) (*models.User, error) {
 func (d *Database) GetUserByUsername(username string) (*models.User, error) {
 	user := &models.User{}
 	err := d.db.QueryRow(`
-		SELECT id, username, email, password_hash, created_at
+		SELECT id, username, email, password_hash, email_verified, created_at
 		FROM users WHERE username = ?`, username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.EmailVerified, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -1081,9 +1305,9 @@ func (d *Database) GetUserByUsername(username string) (*models.User, error) {
 func (d *Database) GetUserByEmail(email string) (*models.User, error) {
 	user := &models.User{}
 	err := d.db.QueryRow(`
-		SELECT id, username, email, password_hash, created_at
+		SELECT id, username, email, password_hash, email_verified, created_at
 		FROM users WHERE email = ?`, email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.EmailVerified, &user.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -1103,13 +1327,162 @@ func (d *Database) UserExists(username, email string) (bool, error) {
 	return count > 0, nil
 }
 
+// CountUsers returns how many accounts there are
+func (d *Database) CountUsers() (int, error) {
+	var count int
+	// User '' holds what was stored without signing in; it isn't an account
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM users WHERE id != ''`).Scan(&count)
+	return count, err
+}
+
+// UpdateUserPassword replaces a user's password hash
+func (d *Database) UpdateUserPassword(userID, passwordHash string) error {
+	result, err := d.db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetEmailVerified marks a user's email address as confirmed
+func (d *Database) SetEmailVerified(userID string) error {
+	result, err := d.db.Exec(`UPDATE users SET email_verified = 1 WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateAccountToken stores the hash of a single-use token for userID,
+// replacing any earlier token with the same purpose so only the newest link
+// works. Expired tokens of every user are purged at the same time.
+func (d *Database) CreateAccountToken(tokenHash, userID, purpose string, expiresAt time.Time) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM account_tokens WHERE expires_at < ? OR (user_id = ? AND purpose = ?)`,
+		time.Now(), userID, purpose); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO account_tokens (token_hash, user_id, purpose, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		tokenHash, userID, purpose, expiresAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsumeAccountToken deletes the token with the given hash and purpose and
+// returns the user it was issued to. Unknown and expired tokens return
+// sql.ErrNoRows.
+func (d *Database) ConsumeAccountToken(tokenHash, purpose string) (string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	var userID string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		SELECT user_id, expires_at FROM account_tokens
+		WHERE token_hash = ? AND purpose = ?`, tokenHash, purpose,
+	).Scan(&userID, &expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if _, err := tx.Exec(`DELETE FROM account_tokens WHERE token_hash = ?`, tokenHash); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	if time.Now().After(expiresAt) {
+		return "", sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+// DeleteAccountTokens removes a user's outstanding tokens with the given
+// purpose, such as reset links once the password has been changed
+func (d *Database) DeleteAccountTokens(userID, purpose string) error {
+	_, err := d.db.Exec(`DELETE FROM account_tokens WHERE user_id = ? AND purpose = ?`, userID, purpose)
+	return err
+}
+
+// DeleteUser removes a user with their books and everything else they own.
+// Rows that refer to the user without a foreign key are cleared here; the
+// rest go by cascade. Files on disk are left for the caller.
+func (d *Database) DeleteUser(userID string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{
+		`DELETE FROM user_book_state WHERE user_id = ?`,
+		`DELETE FROM book_custom_values WHERE user_id = ?`,
+		`DELETE FROM library_revisions WHERE user_id = ?`,
+		`UPDATE book_loans SET borrower_user_id = '' WHERE borrower_user_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if rows == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+
+	// The cascade above logs tombstones no client of the user will read
+	if _, err := tx.Exec(`DELETE FROM sync_changes WHERE user_id = ?`, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // SearchUsers searches for users by username (for sharing)
 func (d *Database) SearchUsers(query string, excludeUserID string) ([]models.User, error) {
 	searchTerm := "%" + query + "%"
 	rows, err := d.db.Query(`
 		SELECT id, username, email, created_at
 		FROM users
-		WHERE username LIKE ? AND id != ?
+		WHERE username LIKE ? AND id != ? AND id != ''
 		LIMIT 10`,
 		searchTerm, excludeUserID,
 	)
@@ -1213,6 +1586,150 @@ func (d *Database) IsBookSharedWith(bookID, userID string) (bool, error) {
 	return count > 0, nil
 }
 
+// UpdateBookLanguage sets a book's language, recomputing its sort title
+// since leading articles depend on the language
+func (d *Database) UpdateBookLanguage(bookID, language string) error {
+	var title string
+	if err := d.db.QueryRow(`SELECT title FROM books WHERE id = ?`, bookID).Scan(&title); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(`UPDATE books SET language = ?, sort_title = ? WHERE id = ?`,
+		language, locale.StripArticle(title, language), bookID)
+	return err
+}
+
+// UpdateBookReadingDirection sets the page order a book is read in
+func (d *Database) UpdateBookReadingDirection(bookID, direction string) error {
+	_, err := d.db.Exec(`UPDATE books SET reading_direction = ? WHERE id = ?`, direction, bookID)
+	return err
+}
+
+// UpdateBookLongStrip sets whether a comic is read as one continuous strip
+func (d *Database) UpdateBookLongStrip(bookID string, longStrip bool) error {
+	_, err := d.db.Exec(`UPDATE books SET long_strip = ? WHERE id = ?`, longStrip, bookID)
+	return err
+}
+
+// GetBookStructure returns a book's stored table of contents JSON and page
+// count. ok is false if they haven't been computed since the file was
+// added or last replaced.
+func (d *Database) GetBookStructure(bookID string) (tocJSON string, pageCount int, ok bool, err error) {
+	var updatedAt sql.NullTime
+	err = d.db.QueryRow(`
+		SELECT toc_json, page_count, structure_updated_at FROM books WHERE id = ?`, bookID,
+	).Scan(&tocJSON, &pageCount, &updatedAt)
+	if err != nil {
+		return "", 0, false, err
+	}
+	return tocJSON, pageCount, updatedAt.Valid, nil
+}
+
+// SaveBookStructure stores the table of contents JSON and page count read
+// from a book's file
+func (d *Database) SaveBookStructure(bookID, tocJSON string, pageCount int) error {
+	_, err := d.db.Exec(`
+		UPDATE books SET toc_json = ?, page_count = ?, structure_updated_at = ? WHERE id = ?`,
+		tocJSON, pageCount, time.Now(), bookID)
+	return err
+}
+
+// ClearBookStructure forgets a book's stored structure so it's read from
+// the file again, for when the file is replaced
+func (d *Database) ClearBookStructure(bookID string) error {
+	_, err := d.db.Exec(`
+		UPDATE books SET toc_json = '', page_count = 0, structure_updated_at = NULL WHERE id = ?`, bookID)
+	return err
+}
+
+// bookFileColumns are the book_files columns scanBookFiles reads
+const bookFileColumns = `id, book_id, file_format, file_path, file_size, file_hash, created_at`
+
+// scanBookFiles reads book files selected with bookFileColumns and closes rows
+func scanBookFiles(rows *sql.Rows) ([]models.BookFile, error) {
+	defer rows.Close()
+	var files []models.BookFile
+	for rows.Next() {
+		var f models.BookFile
+		if err := rows.Scan(&f.ID, &f.BookID, &f.FileFormat, &f.FilePath, &f.FileSize, &f.FileHash, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// CreateBookFile attaches an extra edition to a book
+func (d *Database) CreateBookFile(file *models.BookFile) error {
+	_, err := d.db.Exec(`
+		INSERT INTO book_files (id, book_id, file_format, file_path, file_size, file_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		file.ID, file.BookID, file.FileFormat, file.FilePath, file.FileSize, file.FileHash, file.CreatedAt,
+	)
+	return err
+}
+
+// GetBookFile returns an extra edition by ID, or sql.ErrNoRows
+func (d *Database) GetBookFile(fileID string) (*models.BookFile, error) {
+	rows, err := d.db.Query(`SELECT `+bookFileColumns+` FROM book_files WHERE id = ?`, fileID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := scanBookFiles(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &files[0], nil
+}
+
+// GetBookFiles returns a book's extra editions, oldest first
+func (d *Database) GetBookFiles(bookID string) ([]models.BookFile, error) {
+	rows, err := d.db.Query(`
+		SELECT `+bookFileColumns+` FROM book_files WHERE book_id = ? ORDER BY created_at`, bookID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBookFiles(rows)
+}
+
+// GetBookFilesForBooks returns the extra editions of the given books,
+// keyed by book ID
+func (d *Database) GetBookFilesForBooks(bookIDs []string) (map[string][]models.BookFile, error) {
+	byBook := make(map[string][]models.BookFile)
+	// Stay well under SQLite's limit on query parameters
+	const chunk = 500
+	for start := 0; start < len(bookIDs); start += chunk {
+		ids := bookIDs[start:min(start+chunk, len(bookIDs))]
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		rows, err := d.db.Query(`
+			SELECT `+bookFileColumns+` FROM book_files
+			WHERE book_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+			ORDER BY created_at`, args...)
+		if err != nil {
+			return nil, err
+		}
+		files, err := scanBookFiles(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			byBook[f.BookID] = append(byBook[f.BookID], f)
+		}
+	}
+	return byBook, nil
+}
+
+// DeleteBookFile removes an extra edition's record
+func (d *Database) DeleteBookFile(fileID string) error {
+	_, err := d.db.Exec(`DELETE FROM book_files WHERE id = ?`, fileID)
+	return err
+}
+
 // UpdateBookFileHash updates the file hash for a book
 func (d *Database) UpdateBookFileHash(bookID, fileHash string) error {
 	_, err := d.db.Exec(`UPDATE books SET file_hash = ? WHERE id = ?`, fileHash, bookID)
@@ -1323,6 +1840,60 @@ func (d *Database) FindDuplicateBooks(userID string) ([]DuplicateGroup, error) {
 	return groups, nil
 }
 
+// EditionGroup is books with the same title and author in different
+// formats, which a merge can combine into one book with several editions
+type EditionGroup struct {
+	Title  string
+	Author string
+	Books  []models.Book
+}
+
+// FindEditionCandidates returns groups of books that share a title and
+// author, ignoring case, but not a file format
+func (d *Database) FindEditionCandidates(userID string) ([]EditionGroup, error) {
+	inner, outer := `COALESCE(content_source, 'digital') != 'physical'`, `COALESCE(b.content_source, 'digital') != 'physical'`
+	var args []interface{}
+	if userID != "" {
+		inner += ` AND user_id = ?`
+		outer += ` AND b.user_id = ?`
+		args = append(args, userID, userID)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index,
+			b.file_path, b.cover_path, b.file_size, b.uploaded_at,
+			COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'), COALESCE(b.file_hash, '')
+		FROM books b
+		JOIN (
+			SELECT LOWER(title) AS t, LOWER(author) AS a FROM books
+			WHERE `+inner+`
+			GROUP BY t, a
+			HAVING COUNT(DISTINCT file_format) > 1
+		) g ON LOWER(b.title) = g.t AND LOWER(b.author) = g.a
+		WHERE `+outer+`
+		ORDER BY LOWER(b.title), LOWER(b.author), b.uploaded_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []EditionGroup
+	for rows.Next() {
+		var book models.Book
+		err := rows.Scan(&book.ID, &book.UserID, &book.Title, &book.Author, &book.Series, &book.SeriesIndex,
+			&book.FilePath, &book.CoverPath, &book.FileSize, &book.UploadedAt, &book.ContentType, &book.FileFormat, &book.FileHash)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(groups); n > 0 && strings.EqualFold(groups[n-1].Title, book.Title) && strings.EqualFold(groups[n-1].Author, book.Author) {
+			groups[n-1].Books = append(groups[n-1].Books, book)
+			continue
+		}
+		groups = append(groups, EditionGroup{Title: book.Title, Author: book.Author, Books: []models.Book{book}})
+	}
+	return groups, rows.Err()
+}
+
 // GetBooksWithoutHash returns books that don't have a file hash computed yet
 func (d *Database) GetBooksWithoutHash(userID string, limit int) ([]models.Book, error) {
 	var query string
@@ -1333,7 +1904,7 @@ func (d *Database) GetBooksWithoutHash(userID string, limit int) ([]models.Book,
 			SELECT id, user_id, title, author, file_path, file_size, uploaded_at,
 				COALESCE(content_type, 'book'), COALESCE(file_format, 'epub')
 			FROM books
-			WHERE user_id = ? AND (file_hash IS NULL OR file_hash = '')
+			WHERE user_id = ? AND (file_hash IS NULL OR file_hash = '') AND COALESCE(content_source, 'digital') != 'physical'
 			ORDER BY uploaded_at DESC
 			LIMIT ?`
 		args = append(args, userID, limit)
@@ -1342,7 +1913,7 @@ func (d *Database) GetBooksWithoutHash(userID string, limit int) ([]models.Book,
 			SELECT id, user_id, title, author, file_path, file_size, uploaded_at,
 				COALESCE(content_type, 'book'), COALESCE(file_format, 'epub')
 			FROM books
-			WHERE file_hash IS NULL OR file_hash = ''
+			WHERE (file_hash IS NULL OR file_hash = '') AND COALESCE(content_source, 'digital') != 'physical'
 			ORDER BY uploaded_at DESC
 			LIMIT ?`
 		args = append(args, limit)
@@ -1375,41 +1946,95 @@ func (d *Database) CountBooksWithoutHash(userID string) (int, error) {
 	if userID != "" {
 		err = d.db.QueryRow(`
 			SELECT COUNT(*) FROM books
-			WHERE user_id = ? AND (file_hash IS NULL OR file_hash = '')`, userID,
+			WHERE user_id = ? AND (file_hash IS NULL OR file_hash = '') AND COALESCE(content_source, 'digital') != 'physical'`, userID,
 		).Scan(&count)
 	} else {
 		err = d.db.QueryRow(`
 			SELECT COUNT(*) FROM books
-			WHERE file_hash IS NULL OR file_hash = ''`,
+			WHERE (file_hash IS NULL OR file_hash = '') AND COALESCE(content_source, 'digital') != 'physical'`,
 		).Scan(&count)
 	}
 	return count, err
 }
 
-// UpdateBookReadStatus updates the read status for a book
-func (d *Database) UpdateBookReadStatus(bookID, status string, dateCompleted *time.Time) error {
+// ListBookIDsWithoutHash returns the IDs of the books without file hashes,
+// oldest first. An empty userID lists every user's.
+func (d *Database) ListBookIDsWithoutHash(userID string) ([]string, error) {
+	query := `SELECT id FROM books
+		WHERE (file_hash IS NULL OR file_hash = '') AND COALESCE(content_source, 'digital') != 'physical'`
+	var args []interface{}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	rows, err := d.db.Query(query+` ORDER BY uploaded_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateBookReadStatus updates a user's read status for a book
+func (d *Database) UpdateBookReadStatus(userID, bookID, status string, dateCompleted *time.Time) error {
 	_, err := d.db.Exec(`
-		UPDATE books SET read_status = ?, date_completed = ? WHERE id = ?`,
-		status, dateCompleted, bookID,
+		INSERT INTO user_book_state (user_id, book_id, read_status, date_completed, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, book_id) DO UPDATE SET
+			read_status = excluded.read_status,
+			date_completed = excluded.date_completed,
+			updated_at = excluded.updated_at`,
+		userID, bookID, status, dateCompleted, time.Now(),
 	)
 	return err
 }
 
-// GetBookReadStatus returns the read status for a book
-func (d *Database) GetBookReadStatus(bookID string) (string, *time.Time, error) {
+// GetBookReadStatus returns a user's read status for a book
+func (d *Database) GetBookReadStatus(userID, bookID string) (string, *time.Time, error) {
 	var status string
 	var dateCompleted *time.Time
 	err := d.db.QueryRow(`
-		SELECT COALESCE(read_status, 'unread'), date_completed FROM books WHERE id = ?`, bookID,
+		SELECT COALESCE(read_status, 'unread'), date_completed FROM user_book_state WHERE user_id = ? AND book_id = ?`,
+		userID, bookID,
 	).Scan(&status, &dateCompleted)
+	if err == sql.ErrNoRows {
+		return models.ReadStatusUnread, nil, nil
+	}
 	if err != nil {
 		return "", nil, err
 	}
 	return status, dateCompleted, nil
 }
 
-// BulkUpdateBookReadStatus updates read status for multiple books
-func (d *Database) BulkUpdateBookReadStatus(bookIDs []string, status string, dateCompleted *time.Time) error {
+// GetUserBookState returns a user's read status and rating for a book
+func (d *Database) GetUserBookState(userID, bookID string) (string, *time.Time, int, error) {
+	var status string
+	var dateCompleted *time.Time
+	var rating int
+	err := d.db.QueryRow(`
+		SELECT COALESCE(read_status, 'unread'), date_completed, COALESCE(rating, 0) FROM user_book_state WHERE user_id = ? AND book_id = ?`,
+		userID, bookID,
+	).Scan(&status, &dateCompleted, &rating)
+	if err == sql.ErrNoRows {
+		return models.ReadStatusUnread, nil, 0, nil
+	}
+	if err != nil {
+		return "", nil, 0, err
+	}
+	return status, dateCompleted, rating, nil
+}
+
+// BulkUpdateBookReadStatus updates a user's read status for multiple books
+func (d *Database) BulkUpdateBookReadStatus(userID string, bookIDs []string, status string, dateCompleted *time.Time) error {
 	if len(bookIDs) == 0 {
 		return nil
 	}
@@ -1419,15 +2044,22 @@ func (d *Database) BulkUpdateBookReadStatus(bookIDs []string, status string, dat
 		return err
 	}
 
-	stmt, err := tx.Prepare(`UPDATE books SET read_status = ?, date_completed = ? WHERE id = ?`)
+	stmt, err := tx.Prepare(`
+		INSERT INTO user_book_state (user_id, book_id, read_status, date_completed, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, book_id) DO UPDATE SET
+			read_status = excluded.read_status,
+			date_completed = excluded.date_completed,
+			updated_at = excluded.updated_at`)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
+	now := time.Now()
 	for _, bookID := range bookIDs {
-		if _, err := stmt.Exec(status, dateCompleted, bookID); err != nil {
+		if _, err := stmt.Exec(userID, bookID, status, dateCompleted, now); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -1444,61 +2076,37 @@ type ReadStatusCounts struct {
 	Total     int `json:"total"`
 }
 
-// UpdateBookRating updates the star rating for a book (0-5)
-func (d *Database) UpdateBookRating(bookID string, rating int) error {
+// UpdateBookRating updates a user's star rating for a book (0-5)
+func (d *Database) UpdateBookRating(userID, bookID string, rating int) error {
 	if rating < 0 || rating > 5 {
 		rating = 0
 	}
-	_, err := d.db.Exec(`UPDATE books SET rating = ? WHERE id = ?`, rating, bookID)
+	_, err := d.db.Exec(`
+		INSERT INTO user_book_state (user_id, book_id, rating, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, book_id) DO UPDATE SET
+			rating = excluded.rating,
+			updated_at = excluded.updated_at`,
+		userID, bookID, rating, time.Now(),
+	)
 	return err
 }
 
-// GetReadStatusCounts returns counts of books by read status
+// GetReadStatusCounts returns counts of a user's books by their read status
 func (d *Database) GetReadStatusCounts(userID string) (*ReadStatusCounts, error) {
 	counts := &ReadStatusCounts{}
 
-	var query string
-	var args []interface{}
-
-	if userID != "" {
-		query = `
-			SELECT
-				COUNT(*) FILTER (WHERE COALESCE(read_status, 'unread') = 'unread') as unread,
-				COUNT(*) FILTER (WHERE read_status = 'reading') as reading,
-				COUNT(*) FILTER (WHERE read_status = 'completed') as completed,
-				COUNT(*) as total
-			FROM books WHERE user_id = ?`
-		args = append(args, userID)
-	} else {
-		query = `
-			SELECT
-				COUNT(*) FILTER (WHERE COALESCE(read_status, 'unread') = 'unread') as unread,
-				COUNT(*) FILTER (WHERE read_status = 'reading') as reading,
-				COUNT(*) FILTER (WHERE read_status = 'completed') as completed,
-				COUNT(*) as total
-			FROM books WHERE user_id = ''`
-	}
-
 	// SQLite doesn't support FILTER, use CASE instead
-	if userID != "" {
-		query = `
-			SELECT
-				SUM(CASE WHEN COALESCE(read_status, 'unread') = 'unread' THEN 1 ELSE 0 END) as unread,
-				SUM(CASE WHEN read_status = 'reading' THEN 1 ELSE 0 END) as reading,
-				SUM(CASE WHEN read_status = 'completed' THEN 1 ELSE 0 END) as completed,
-				COUNT(*) as total
-			FROM books WHERE user_id = ?`
-	} else {
-		query = `
-			SELECT
-				SUM(CASE WHEN COALESCE(read_status, 'unread') = 'unread' THEN 1 ELSE 0 END) as unread,
-				SUM(CASE WHEN read_status = 'reading' THEN 1 ELSE 0 END) as reading,
-				SUM(CASE WHEN read_status = 'completed' THEN 1 ELSE 0 END) as completed,
-				COUNT(*) as total
-			FROM books WHERE user_id = ''`
-	}
-
-	err := d.db.QueryRow(query, args...).Scan(&counts.Unread, &counts.Reading, &counts.Completed, &counts.Total)
+	err := d.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN COALESCE(s.read_status, 'unread') = 'unread' THEN 1 ELSE 0 END), 0) as unread,
+			COALESCE(SUM(CASE WHEN s.read_status = 'reading' THEN 1 ELSE 0 END), 0) as reading,
+			COALESCE(SUM(CASE WHEN s.read_status = 'completed' THEN 1 ELSE 0 END), 0) as completed,
+			COUNT(*) as total
+		FROM books b
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+		WHERE b.user_id = ?`, userID, userID,
+	).Scan(&counts.Unread, &counts.Reading, &counts.Completed, &counts.Total)
 	if err != nil {
 		return nil, err
 	}
@@ -1617,9 +2225,11 @@ func (d *Database) GetBooksInReadingList(listID string) ([]models.Book, error) {
 		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index,
 			b.file_path, b.cover_path, b.file_size, b.uploaded_at,
 			COALESCE(b.content_type, 'book'), COALESCE(b.file_format, 'epub'),
-			COALESCE(b.read_status, 'unread')
+			COALESCE(s.read_status, 'unread')
 		FROM books b
 		JOIN book_reading_list brl ON b.id = brl.book_id
+		JOIN reading_lists rl ON rl.id = brl.list_id
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = rl.user_id
 		WHERE brl.list_id = ?
 		ORDER BY brl.position, brl.added_at`, listID,
 	)
@@ -1811,30 +2421,103 @@ func (d *Database) DeleteTag(tagID string) error {
 	return err
 }
 
-// AddTagToBook adds a tag to a book
+// AddTagToBook adds a tag to a book. Adding a tag the subject sync put
+// there makes it a manual tag, which the sync leaves alone.
 func (d *Database) AddTagToBook(bookID, tagID string) error {
 	_, err := d.db.Exec(`
-		INSERT OR IGNORE INTO book_tags (book_id, tag_id, added_at)
-		VALUES (?, ?, ?)`,
+		INSERT INTO book_tags (book_id, tag_id, added_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(book_id, tag_id) DO UPDATE SET from_subjects = 0`,
 		bookID, tagID, time.Now(),
 	)
 	return err
 }
 
+// SyncSubjectTags makes the user's subject tags on a book exactly names,
+// creating tags that don't exist yet. Names match existing tags ignoring
+// case. Tags the user added by hand are never removed.
+func (d *Database) SyncSubjectTags(bookID, userID string, names []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	keep := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		var tagID string
+		err := tx.QueryRow(`SELECT id FROM tags WHERE user_id = ? AND name = ? COLLATE NOCASE`, userID, name).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			tagID = uuid.New().String()
+			_, err = tx.Exec(`INSERT INTO tags (id, user_id, name, created_at) VALUES (?, ?, ?, ?)`, tagID, userID, name, now)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.Exec(`
+			INSERT OR IGNORE INTO book_tags (book_id, tag_id, added_at, from_subjects)
+			VALUES (?, ?, ?, 1)`, bookID, tagID, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+		keep = append(keep, tagID)
+	}
+
+	// Drop subject tags whose subject is gone
+	query := `DELETE FROM book_tags WHERE book_id = ? AND from_subjects = 1
+		AND tag_id IN (SELECT id FROM tags WHERE user_id = ?)`
+	args := []interface{}{bookID, userID}
+	if len(keep) > 0 {
+		query += ` AND tag_id NOT IN (` + strings.TrimSuffix(strings.Repeat("?,", len(keep)), ",") + `)`
+		args = append(args, keep...)
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSubjectTagNames returns the names of the user's tags on a book that
+// came from its subjects rather than being added by hand
+func (d *Database) GetSubjectTagNames(bookID, userID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT t.name FROM tags t
+		INNER JOIN book_tags bt ON t.id = bt.tag_id
+		WHERE bt.book_id = ? AND t.user_id = ? AND bt.from_subjects = 1
+		ORDER BY t.name ASC`, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
 // RemoveTagFromBook removes a tag from a book
 func (d *Database) RemoveTagFromBook(bookID, tagID string) error {
 	_, err := d.db.Exec(`DELETE FROM book_tags WHERE book_id = ? AND tag_id = ?`, bookID, tagID)
 	return err
 }
 
-// GetBookTags returns all tags for a specific book
-func (d *Database) GetBookTags(bookID string) ([]*models.Tag, error) {
+// GetBookTags returns the user's tags on a specific book
+func (d *Database) GetBookTags(bookID, userID string) ([]*models.Tag, error) {
 	rows, err := d.db.Query(`
 		SELECT t.id, t.user_id, t.name, t.color, t.created_at
 		FROM tags t
 		INNER JOIN book_tags bt ON t.id = bt.tag_id
-		WHERE bt.book_id = ?
-		ORDER BY t.name ASC`, bookID)
+		WHERE bt.book_id = ? AND t.user_id = ?
+		ORDER BY t.name ASC`, bookID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -1851,14 +2534,17 @@ func (d *Database) GetBookTags(bookID string) ([]*models.Tag, error) {
 	return tags, rows.Err()
 }
 
-// GetBooksByTag returns all books with a specific tag
+// GetBooksByTag returns all books with a specific tag that the tag's owner can still access
 func (d *Database) GetBooksByTag(tagID string) ([]*models.Book, error) {
 	rows, err := d.db.Query(`
 		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path,
-			b.file_size, b.uploaded_at, b.content_type, b.file_format, b.read_status, b.rating
+			b.file_size, b.uploaded_at, b.content_type, b.file_format, COALESCE(s.read_status, 'unread'), COALESCE(s.rating, 0)
 		FROM books b
 		INNER JOIN book_tags bt ON b.id = bt.book_id
-		WHERE bt.tag_id = ?
+		INNER JOIN tags t ON t.id = bt.tag_id
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = t.user_id
+		WHERE bt.tag_id = ? AND (b.user_id = t.user_id OR b.user_id = '' OR
+			EXISTS (SELECT 1 FROM book_shares bs WHERE bs.book_id = b.id AND bs.shared_with_id = t.user_id))
 		ORDER BY b.title ASC`, tagID)
 	if err != nil {
 		return nil, err
@@ -1904,10 +2590,10 @@ func (d *Database) ToggleBookTag(bookID, tagID string) (bool, error) {
 // CreateAnnotation creates a new annotation/highlight
 func (d *Database) CreateAnnotation(ann *models.Annotation) error {
 	_, err := d.db.Exec(`
-		INSERT INTO annotations (id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		INSERT INTO annotations (id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		ann.ID, ann.BookID, ann.UserID, ann.Chapter, ann.CFI, ann.StartOffset, ann.EndOffset,
-		ann.SelectedText, ann.Note, ann.Color, ann.CreatedAt, ann.UpdatedAt,
+		ann.SelectedText, ann.Note, ann.Color, ann.Visibility, ann.CreatedAt, ann.UpdatedAt,
 	)
 	return err
 }
@@ -1916,10 +2602,10 @@ func (d *Database) CreateAnnotation(ann *models.Annotation) error {
 func (d *Database) GetAnnotation(annotationID string) (*models.Annotation, error) {
 	ann := &models.Annotation{}
 	err := d.db.QueryRow(`
-		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, created_at, updated_at
+		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility, created_at, updated_at
 		FROM annotations WHERE id = ?`, annotationID).Scan(
 		&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
-		&ann.SelectedText, &ann.Note, &ann.Color, &ann.CreatedAt, &ann.UpdatedAt,
+		&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -1930,7 +2616,7 @@ func (d *Database) GetAnnotation(annotationID string) (*models.Annotation, error
 // GetAnnotationsForBook returns all annotations for a book by a user
 func (d *Database) GetAnnotationsForBook(bookID, userID string) ([]*models.Annotation, error) {
 	rows, err := d.db.Query(`
-		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, created_at, updated_at
+		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility, created_at, updated_at
 		FROM annotations
 		WHERE book_id = ? AND user_id = ?
 		ORDER BY chapter ASC, start_offset ASC`, bookID, userID)
@@ -1943,7 +2629,7 @@ func (d *Database) GetAnnotationsForBook(bookID, userID string) ([]*models.Annot
 	for rows.Next() {
 		ann := &models.Annotation{}
 		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
-			&ann.SelectedText, &ann.Note, &ann.Color, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
 			return nil, err
 		}
 		annotations = append(annotations, ann)
@@ -1954,7 +2640,7 @@ func (d *Database) GetAnnotationsForBook(bookID, userID string) ([]*models.Annot
 // GetAnnotationsForChapter returns annotations for a specific chapter
 func (d *Database) GetAnnotationsForChapter(bookID, userID, chapter string) ([]*models.Annotation, error) {
 	rows, err := d.db.Query(`
-		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, created_at, updated_at
+		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility, created_at, updated_at
 		FROM annotations
 		WHERE book_id = ? AND user_id = ? AND chapter = ?
 		ORDER BY start_offset ASC`, bookID, userID, chapter)
@@ -1967,7 +2653,39 @@ func (d *Database) GetAnnotationsForChapter(bookID, userID, chapter string) ([]*
 	for rows.Next() {
 		ann := &models.Annotation{}
 		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
-			&ann.SelectedText, &ann.Note, &ann.Color, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, ann)
+	}
+	return annotations, rows.Err()
+}
+
+// GetVisibleAnnotationsForChapter returns the annotations in a chapter that
+// userID can see: their own, and the shared annotations of the book's owner
+// and the users it's shared with
+func (d *Database) GetVisibleAnnotationsForChapter(bookID, userID, chapter string) ([]*models.Annotation, error) {
+	rows, err := d.db.Query(`
+		SELECT a.id, a.book_id, a.user_id, a.chapter, a.cfi, a.start_offset, a.end_offset, a.selected_text, a.note, a.color, a.visibility,
+			a.created_at, a.updated_at, u.username
+		FROM annotations a
+		INNER JOIN books b ON b.id = a.book_id
+		INNER JOIN users u ON u.id = a.user_id
+		WHERE a.book_id = ? AND a.chapter = ?
+			AND (a.user_id = ? OR (a.visibility = ?
+				AND (a.user_id = b.user_id OR EXISTS (
+					SELECT 1 FROM book_shares bs WHERE bs.book_id = a.book_id AND bs.shared_with_id = a.user_id))))
+		ORDER BY a.start_offset ASC`, bookID, chapter, userID, models.AnnotationVisibilityShared)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var annotations []*models.Annotation
+	for rows.Next() {
+		ann := &models.Annotation{}
+		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt, &ann.Username); err != nil {
 			return nil, err
 		}
 		annotations = append(annotations, ann)
@@ -1978,7 +2696,7 @@ func (d *Database) GetAnnotationsForChapter(bookID, userID, chapter string) ([]*
 // GetAllAnnotationsForUser returns all annotations across all books for a user
 func (d *Database) GetAllAnnotationsForUser(userID string) ([]*models.Annotation, error) {
 	rows, err := d.db.Query(`
-		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, created_at, updated_at
+		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility, created_at, updated_at
 		FROM annotations
 		WHERE user_id = ?
 		ORDER BY updated_at DESC`, userID)
@@ -1991,7 +2709,7 @@ func (d *Database) GetAllAnnotationsForUser(userID string) ([]*models.Annotation
 	for rows.Next() {
 		ann := &models.Annotation{}
 		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
-			&ann.SelectedText, &ann.Note, &ann.Color, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
 			return nil, err
 		}
 		annotations = append(annotations, ann)
@@ -1999,10 +2717,17 @@ func (d *Database) GetAllAnnotationsForUser(userID string) ([]*models.Annotation
 	return annotations, rows.Err()
 }
 
-// UpdateAnnotation updates an annotation's note and/or color
-func (d *Database) UpdateAnnotation(annotationID, note, color string) error {
-	_, err := d.db.Exec(`UPDATE annotations SET note = ?, color = ?, updated_at = ? WHERE id = ?`,
-		note, color, time.Now(), annotationID)
+// UpdateAnnotation updates an annotation's note, color, and visibility
+func (d *Database) UpdateAnnotation(annotationID, note, color, visibility string) error {
+	_, err := d.db.Exec(`UPDATE annotations SET note = ?, color = ?, visibility = ?, updated_at = ? WHERE id = ?`,
+		note, color, visibility, time.Now(), annotationID)
+	return err
+}
+
+// UpdateAnnotationChapter moves an annotation to another chapter. It isn't
+// an edit by its author, so updated_at is left alone.
+func (d *Database) UpdateAnnotationChapter(annotationID, chapter string) error {
+	_, err := d.db.Exec(`UPDATE annotations SET chapter = ? WHERE id = ?`, chapter, annotationID)
 	return err
 }
 
@@ -2035,6 +2760,204 @@ func (d *Database) GetAnnotationStats(userID string) (totalAnnotations int, book
 	return totalAnnotations, booksWithAnnotations, err
 }
 
+// GetAnnotationsForReview returns up to limit of a user's highlights that
+// are due for review at now. Highlights never reviewed come first, oldest
+// first, then the rest by how long ago they were last reviewed.
+func (d *Database) GetAnnotationsForReview(userID string, now time.Time, limit int) ([]*models.ReviewHighlight, error) {
+	rows, err := d.db.Query(`
+		SELECT a.id, a.book_id, a.user_id, a.chapter, a.cfi, a.start_offset, a.end_offset, a.selected_text, a.note, a.color, a.visibility,
+			a.created_at, a.updated_at, b.title, b.author, COALESCE(r.review_count, 0), r.last_reviewed_at
+		FROM annotations a
+		INNER JOIN books b ON b.id = a.book_id
+		LEFT JOIN annotation_reviews r ON r.annotation_id = a.id
+		WHERE a.user_id = ? AND a.selected_text != '' AND (r.annotation_id IS NULL OR r.next_review_at <= ?)
+		ORDER BY r.annotation_id IS NOT NULL, COALESCE(r.last_reviewed_at, a.created_at) ASC
+		LIMIT ?`, userID, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var highlights []*models.ReviewHighlight
+	for rows.Next() {
+		ann := &models.Annotation{}
+		h := &models.ReviewHighlight{Annotation: ann}
+		var lastReviewed sql.NullTime
+		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt, &h.BookTitle, &h.BookAuthor,
+			&h.ReviewCount, &lastReviewed); err != nil {
+			return nil, err
+		}
+		if lastReviewed.Valid {
+			h.LastReviewedAt = &lastReviewed.Time
+		}
+		highlights = append(highlights, h)
+	}
+	return highlights, rows.Err()
+}
+
+// GetAnnotationReview returns the review record of a highlight, or
+// sql.ErrNoRows if it has never been reviewed
+func (d *Database) GetAnnotationReview(annotationID string) (*models.AnnotationReview, error) {
+	r := &models.AnnotationReview{}
+	err := d.db.QueryRow(`
+		SELECT annotation_id, review_count, last_reviewed_at, next_review_at
+		FROM annotation_reviews WHERE annotation_id = ?`, annotationID).Scan(
+		&r.AnnotationID, &r.ReviewCount, &r.LastReviewedAt, &r.NextReviewAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SaveAnnotationReview creates or replaces a highlight's review record
+func (d *Database) SaveAnnotationReview(r *models.AnnotationReview) error {
+	_, err := d.db.Exec(`
+		INSERT INTO annotation_reviews (annotation_id, review_count, last_reviewed_at, next_review_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(annotation_id) DO UPDATE SET
+			review_count = excluded.review_count,
+			last_reviewed_at = excluded.last_reviewed_at,
+			next_review_at = excluded.next_review_at`,
+		r.AnnotationID, r.ReviewCount, r.LastReviewedAt, r.NextReviewAt,
+	)
+	return err
+}
+
+// ==================== Book Note Methods ====================
+
+const bookNoteColumns = `id, book_id, user_id, title, body, revision, created_at, updated_at`
+
+// scanBookNotes reads book notes selected with bookNoteColumns
+func scanBookNotes(rows *sql.Rows) ([]*models.BookNote, error) {
+	defer rows.Close()
+	var notes []*models.BookNote
+	for rows.Next() {
+		n := &models.BookNote{}
+		if err := rows.Scan(&n.ID, &n.BookID, &n.UserID, &n.Title, &n.Body, &n.Revision, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// CreateBookNote creates a new book note
+func (d *Database) CreateBookNote(note *models.BookNote) error {
+	_, err := d.db.Exec(`
+		INSERT INTO book_notes (`+bookNoteColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		note.ID, note.BookID, note.UserID, note.Title, note.Body, note.Revision, note.CreatedAt, note.UpdatedAt,
+	)
+	return err
+}
+
+// GetBookNote returns a book note by ID
+func (d *Database) GetBookNote(noteID string) (*models.BookNote, error) {
+	rows, err := d.db.Query(`SELECT `+bookNoteColumns+` FROM book_notes WHERE id = ?`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := scanBookNotes(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return notes[0], nil
+}
+
+// GetBookNotesForBook returns a user's notes on a book, oldest first
+func (d *Database) GetBookNotesForBook(bookID, userID string) ([]*models.BookNote, error) {
+	rows, err := d.db.Query(`
+		SELECT `+bookNoteColumns+` FROM book_notes
+		WHERE book_id = ? AND user_id = ?
+		ORDER BY created_at ASC`, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBookNotes(rows)
+}
+
+// GetAllBookNotesForUser returns all of a user's book notes, grouped by book
+func (d *Database) GetAllBookNotesForUser(userID string) ([]*models.BookNote, error) {
+	rows, err := d.db.Query(`
+		SELECT `+bookNoteColumns+` FROM book_notes
+		WHERE user_id = ?
+		ORDER BY book_id, created_at ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBookNotes(rows)
+}
+
+// UpdateBookNote saves the note's current version as a revision, then
+// replaces its title and body and bumps its revision number. note is
+// updated to match.
+func (d *Database) UpdateBookNote(note *models.BookNote, title, body string, updatedAt time.Time) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO book_note_revisions (note_id, revision, title, body, created_at)
+		SELECT id, revision, title, body, updated_at FROM book_notes WHERE id = ?`, note.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE book_notes SET title = ?, body = ?, revision = revision + 1, updated_at = ?
+		WHERE id = ?`, title, body, updatedAt, note.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.QueryRow(`SELECT revision FROM book_notes WHERE id = ?`, note.ID).Scan(&note.Revision); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	note.Title = title
+	note.Body = body
+	note.UpdatedAt = updatedAt
+	return nil
+}
+
+// GetBookNoteRevisions returns a note's earlier versions, newest first
+func (d *Database) GetBookNoteRevisions(noteID string) ([]*models.BookNoteRevision, error) {
+	rows, err := d.db.Query(`
+		SELECT note_id, revision, title, body, created_at
+		FROM book_note_revisions WHERE note_id = ?
+		ORDER BY revision DESC`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.BookNoteRevision
+	for rows.Next() {
+		r := &models.BookNoteRevision{}
+		if err := rows.Scan(&r.NoteID, &r.Revision, &r.Title, &r.Body, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// DeleteBookNote removes a book note and its revisions
+func (d *Database) DeleteBookNote(noteID string) error {
+	_, err := d.db.Exec(`DELETE FROM book_notes WHERE id = ?`, noteID)
+	return err
+}
+
 // SimilarBook represents a book with a similarity score
 type SimilarBook struct {
 	Book    *models.Book `json:"book"`
@@ -2080,11 +3003,12 @@ func (d *Database) GetSimilarBooks(bookID, userID string, limit int) ([]*Similar
 	// 1. Find books by same author (weight: 30)
 	if book.Author != "" {
 		rows, err := d.db.Query(`
-			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size,
-				   uploaded_at, content_type, file_format, read_status, rating
-			FROM books
-			WHERE author = ? AND id != ? AND (user_id = ? OR user_id = '')
-			LIMIT 20`, book.Author, bookID, userID)
+			SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size,
+				   b.uploaded_at, b.content_type, b.file_format, COALESCE(s.read_status, 'unread'), COALESCE(s.rating, 0)
+			FROM books b
+			LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+			WHERE b.author = ? AND b.id != ? AND (b.user_id = ? OR b.user_id = '')
+			LIMIT 20`, userID, book.Author, bookID, userID)
 		if err == nil {
 			for rows.Next() {
 				b := &models.Book{}
@@ -2103,12 +3027,13 @@ func (d *Database) GetSimilarBooks(bookID, userID string, limit int) ([]*Similar
 	// 2. Find books in same series (weight: 50)
 	if book.Series != "" {
 		rows, err := d.db.Query(`
-			SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size,
-				   uploaded_at, content_type, file_format, read_status, rating
-			FROM books
-			WHERE series = ? AND id != ? AND (user_id = ? OR user_id = '')
-			ORDER BY series_index ASC
-			LIMIT 20`, book.Series, bookID, userID)
+			SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size,
+				   b.uploaded_at, b.content_type, b.file_format, COALESCE(s.read_status, 'unread'), COALESCE(s.rating, 0)
+			FROM books b
+			LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+			WHERE b.series = ? AND b.id != ? AND (b.user_id = ? OR b.user_id = '')
+			ORDER BY b.series_index ASC
+			LIMIT 20`, userID, book.Series, bookID, userID)
 		if err == nil {
 			for rows.Next() {
 				b := &models.Book{}
@@ -2133,11 +3058,12 @@ func (d *Database) GetSimilarBooks(bookID, userID string, limit int) ([]*Similar
 				continue
 			}
 			rows, err := d.db.Query(`
-				SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size,
-					   uploaded_at, content_type, file_format, read_status, rating
-				FROM books
-				WHERE subjects LIKE ? AND id != ? AND (user_id = ? OR user_id = '')
-				LIMIT 20`, "%"+subject+"%", bookID, userID)
+				SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size,
+					   b.uploaded_at, b.content_type, b.file_format, COALESCE(s.read_status, 'unread'), COALESCE(s.rating, 0)
+				FROM books b
+				LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+				WHERE b.subjects LIKE ? AND b.id != ? AND (b.user_id = ? OR b.user_id = '')
+				LIMIT 20`, userID, "%"+subject+"%", bookID, userID)
 			if err == nil {
 				for rows.Next() {
 					b := &models.Book{}
@@ -2158,10 +3084,11 @@ func (d *Database) GetSimilarBooks(bookID, userID string, limit int) ([]*Similar
 	tagRows, err := d.db.Query(`
 		SELECT DISTINCT bt2.book_id
 		FROM book_tags bt1
+		JOIN tags t ON t.id = bt1.tag_id AND t.user_id = ?
 		JOIN book_tags bt2 ON bt1.tag_id = bt2.tag_id
 		JOIN books b ON bt2.book_id = b.id
 		WHERE bt1.book_id = ? AND bt2.book_id != ? AND (b.user_id = ? OR b.user_id = '')
-		LIMIT 50`, bookID, bookID, userID)
+		LIMIT 50`, userID, bookID, bookID, userID)
 	if err == nil {
 		for tagRows.Next() {
 			var relatedBookID string
@@ -2197,11 +3124,12 @@ func (d *Database) GetSimilarBooks(bookID, userID string, limit int) ([]*Similar
 
 	// 5. Find books with same content type (weight: 5)
 	rows, err := d.db.Query(`
-		SELECT id, user_id, title, author, series, series_index, file_path, cover_path, file_size,
-			   uploaded_at, content_type, file_format, read_status, rating
-		FROM books
-		WHERE content_type = ? AND id != ? AND (user_id = ? OR user_id = '')
-		LIMIT 50`, book.ContentType, bookID, userID)
+		SELECT b.id, b.user_id, b.title, b.author, b.series, b.series_index, b.file_path, b.cover_path, b.file_size,
+			   b.uploaded_at, b.content_type, b.file_format, COALESCE(s.read_status, 'unread'), COALESCE(s.rating, 0)
+		FROM books b
+		LEFT JOIN user_book_state s ON s.book_id = b.id AND s.user_id = ?
+		WHERE b.content_type = ? AND b.id != ? AND (b.user_id = ? OR b.user_id = '')
+		LIMIT 50`, userID, book.ContentType, bookID, userID)
 	if err == nil {
 		for rows.Next() {
 			b := &models.Book{}
@@ -2257,24 +3185,151 @@ func (d *Database) CreateReadingSession(session *models.ReadingSession) error {
 func (d *Database) UpdateReadingSession(session *models.ReadingSession) error {
 	_, err := d.db.Exec(`
 		UPDATE reading_sessions SET
-			end_time = ?, pages_read = ?, chapters_read = ?, duration_seconds = ?
+			end_time = ?, pages_read = ?, chapters_read = ?, duration_seconds = ?,
+			paused_at = ?, paused_seconds = ?, last_active_at = ?
 		WHERE id = ?`,
-		session.EndTime, session.PagesRead, session.ChaptersRead, session.DurationSeconds, session.ID,
+		session.EndTime, session.PagesRead, session.ChaptersRead, session.DurationSeconds,
+		session.PausedAt, session.PausedSeconds, session.LastActiveAt, session.ID,
 	)
 	return err
 }
 
+// FinishReadingSession saves an ended session and rolls it into the daily and user statistics
+func (d *Database) FinishReadingSession(session *models.ReadingSession) error {
+	if err := d.UpdateReadingSession(session); err != nil {
+		return err
+	}
+
+	endTime := time.Now()
+	if session.EndTime != nil {
+		endTime = *session.EndTime
+	}
+
+	// Update daily stats
+	d.UpdateDailyStats(session.UserID, endTime, session.PagesRead, session.ChaptersRead, session.DurationSeconds, session.BookID)
+
+	// Update user statistics
+	stats, _ := d.GetOrCreateUserStatistics(session.UserID)
+	if stats != nil {
+		stats.TotalPagesRead += session.PagesRead
+		stats.TotalChaptersRead += session.ChaptersRead
+		stats.TotalTimeSeconds += session.DurationSeconds
+		if stats.LastReadingDate == nil || endTime.After(*stats.LastReadingDate) {
+			stats.LastReadingDate = &endTime
+		}
+
+		// Update streak
+		current, longest, _ := d.CalculateStreak(session.UserID)
+		stats.CurrentStreak = current
+		if longest > stats.LongestStreak {
+			stats.LongestStreak = longest
+		}
+
+		// Update completed books count
+		completedCount, _ := d.GetCompletedBooksCount(session.UserID)
+		stats.TotalBooksRead = completedCount
+
+		d.UpdateUserStatistics(stats)
+	}
+
+	return nil
+}
+
+// CloseStaleReadingSessions ends sessions that started before the cutoff and were never ended.
+// The user's last reading position update for the book or heartbeat is used as the end time, or
+// when the session was paused; sessions with no activity after they started are closed with zero
+// duration. Returns the number closed.
+func (d *Database) CloseStaleReadingSessions(cutoff time.Time) (int, error) {
+	rows, err := d.db.Query(`
+		SELECT rs.id, rs.user_id, rs.book_id, rs.start_time, rs.pages_read, rs.chapters_read,
+			rs.paused_at, rs.paused_seconds, rs.last_active_at, rs.created_at, rp.updated_at
+		FROM reading_sessions rs
+		LEFT JOIN reading_positions rp ON rp.book_id = rs.book_id AND rp.user_id = rs.user_id
+		WHERE rs.end_time IS NULL AND rs.start_time < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	var sessions []*models.ReadingSession
+	var lastActivity []sql.NullTime
+	for rows.Next() {
+		session := &models.ReadingSession{}
+		var activity sql.NullTime
+		if err := rows.Scan(&session.ID, &session.UserID, &session.BookID, &session.StartTime,
+			&session.PagesRead, &session.ChaptersRead, &session.PausedAt, &session.PausedSeconds,
+			&session.LastActiveAt, &session.CreatedAt, &activity); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sessions = append(sessions, session)
+		lastActivity = append(lastActivity, activity)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	closed := 0
+	for i, session := range sessions {
+		endTime := session.StartTime
+		if activity := lastActivity[i]; activity.Valid && activity.Time.After(session.StartTime) && activity.Time.Before(now) {
+			endTime = activity.Time
+		}
+		if last := session.LastActiveAt; last != nil && last.After(endTime) && last.Before(now) {
+			endTime = *last
+		}
+		// A paused session was last read when it was paused
+		if paused := session.PausedAt; paused != nil {
+			endTime = *paused
+		}
+
+		session.Finish(endTime, 0)
+		if err := d.FinishReadingSession(session); err != nil {
+			return closed, err
+		}
+		closed++
+	}
+
+	return closed, nil
+}
+
+// DiscardActiveReadingSessions deletes a user's sessions that haven't ended,
+// without counting them towards their stats
+func (d *Database) DiscardActiveReadingSessions(userID string) error {
+	_, err := d.db.Exec(`DELETE FROM reading_sessions WHERE user_id = ? AND end_time IS NULL`, userID)
+	return err
+}
+
+// PurgeReadingHistory deletes a user's reading sessions, daily and overall
+// reading stats, and published activity
+func (d *Database) PurgeReadingHistory(userID string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"reading_sessions", "daily_reading_stats", "user_statistics", "activity_events"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // GetActiveReadingSession gets an active (not ended) reading session for a user and book
 func (d *Database) GetActiveReadingSession(userID, bookID string) (*models.ReadingSession, error) {
 	session := &models.ReadingSession{}
 	err := d.db.QueryRow(`
-		SELECT id, user_id, book_id, start_time, end_time, pages_read, chapters_read, duration_seconds, created_at
+		SELECT id, user_id, book_id, start_time, end_time, pages_read, chapters_read, duration_seconds,
+			paused_at, paused_seconds, last_active_at, created_at
 		FROM reading_sessions
 		WHERE user_id = ? AND book_id = ? AND end_time IS NULL
 		ORDER BY start_time DESC LIMIT 1`,
 		userID, bookID,
 	).Scan(&session.ID, &session.UserID, &session.BookID, &session.StartTime, &session.EndTime,
-		&session.PagesRead, &session.ChaptersRead, &session.DurationSeconds, &session.CreatedAt)
+		&session.PagesRead, &session.ChaptersRead, &session.DurationSeconds,
+		&session.PausedAt, &session.PausedSeconds, &session.LastActiveAt, &session.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -2288,8 +3343,8 @@ func (d *Database) GetRecentReadingSessions(userID string, limit int) ([]models.
 	}
 	rows, err := d.db.Query(`
 		SELECT rs.id, rs.user_id, rs.book_id, rs.start_time, rs.end_time,
-			rs.pages_read, rs.chapters_read, rs.duration_seconds, rs.created_at,
-			b.title, b.author
+			rs.pages_read, rs.chapters_read, rs.duration_seconds, rs.paused_at, rs.paused_seconds,
+			rs.last_active_at, rs.created_at, b.title, b.author
 		FROM reading_sessions rs
 		JOIN books b ON rs.book_id = b.id
 		WHERE rs.user_id = ? AND rs.end_time IS NOT NULL
@@ -2298,14 +3353,37 @@ func (d *Database) GetRecentReadingSessions(userID string, limit int) ([]models.
 	if err != nil {
 		return nil, err
 	}
+	return scanReadingSessions(rows)
+}
+
+// GetAllReadingSessions returns every reading session of a user, oldest
+// first, including one still in progress
+func (d *Database) GetAllReadingSessions(userID string) ([]models.ReadingSession, error) {
+	rows, err := d.db.Query(`
+		SELECT rs.id, rs.user_id, rs.book_id, rs.start_time, rs.end_time,
+			rs.pages_read, rs.chapters_read, rs.duration_seconds, rs.paused_at, rs.paused_seconds,
+			rs.last_active_at, rs.created_at, b.title, b.author
+		FROM reading_sessions rs
+		JOIN books b ON rs.book_id = b.id
+		WHERE rs.user_id = ?
+		ORDER BY rs.start_time`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReadingSessions(rows)
+}
+
+// scanReadingSessions reads sessions joined with their book's title and
+// author, closing rows
+func scanReadingSessions(rows *sql.Rows) ([]models.ReadingSession, error) {
 	defer rows.Close()
 
 	var sessions []models.ReadingSession
 	for rows.Next() {
 		var s models.ReadingSession
 		if err := rows.Scan(&s.ID, &s.UserID, &s.BookID, &s.StartTime, &s.EndTime,
-			&s.PagesRead, &s.ChaptersRead, &s.DurationSeconds, &s.CreatedAt,
-			&s.BookTitle, &s.BookAuthor); err != nil {
+			&s.PagesRead, &s.ChaptersRead, &s.DurationSeconds, &s.PausedAt, &s.PausedSeconds,
+			&s.LastActiveAt, &s.CreatedAt, &s.BookTitle, &s.BookAuthor); err != nil {
 			return nil, err
 		}
 		sessions = append(sessions, s)
@@ -2352,6 +3430,22 @@ func (d *Database) GetOrCreateUserStatistics(userID string) (*models.UserStatist
 	return stats, nil
 }
 
+// GetReadingPace returns how many minutes a user takes to read a page over
+// all their finished sessions, or 0 if they haven't recorded any pages
+func (d *Database) GetReadingPace(userID string) (float64, error) {
+	var pages, seconds int
+	err := d.db.QueryRow(`
+		SELECT total_pages_read, total_time_seconds FROM user_statistics WHERE user_id = ?`, userID,
+	).Scan(&pages, &seconds)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil || pages == 0 {
+		return 0, err
+	}
+	return float64(seconds) / 60.0 / float64(pages), nil
+}
+
 // UpdateUserStatistics updates the user's aggregated statistics
 func (d *Database) UpdateUserStatistics(stats *models.UserStatistics) error {
 	_, err := d.db.Exec(`
@@ -2382,19 +3476,19 @@ func (d *Database) GetDailyReadingStats(userID string, startDate, endDate time.T
 	var stats []models.DailyReadingStats
 	for rows.Next() {
 		var s models.DailyReadingStats
-		var dateStr string
-		if err := rows.Scan(&s.ID, &s.UserID, &dateStr, &s.PagesRead, &s.ChaptersRead, &s.TimeSeconds, &s.BooksTouched); err != nil {
+		// The driver reads DATE columns as midnight UTC
+		if err := rows.Scan(&s.ID, &s.UserID, &s.ReadingDate, &s.PagesRead, &s.ChaptersRead, &s.TimeSeconds, &s.BooksTouched); err != nil {
 			return nil, err
 		}
-		s.ReadingDate, _ = time.Parse("2006-01-02", dateStr)
 		stats = append(stats, s)
 	}
 	return stats, nil
 }
 
-// UpdateDailyStats updates or creates daily reading stats
+// UpdateDailyStats updates or creates daily reading stats for the day date
+// falls on in the user's timezone
 func (d *Database) UpdateDailyStats(userID string, date time.Time, pagesRead, chaptersRead, timeSeconds int, bookID string) error {
-	dateStr := date.Format("2006-01-02")
+	dateStr := date.In(d.UserLocation(userID)).Format("2006-01-02")
 
 	// Check if record exists
 	var existingID string
@@ -2426,36 +3520,45 @@ func (d *Database) UpdateDailyStats(userID string, date time.Time, pagesRead, ch
 	return err
 }
 
-// CalculateStreak calculates the current reading streak for a user
+// CalculateStreak calculates the current reading streak for a user, counting
+// days in their timezone
 func (d *Database) CalculateStreak(userID string) (current, longest int, err error) {
-	// Get distinct reading dates in descending order
+	loc := d.UserLocation(userID)
+
 	rows, err := d.db.Query(`
-		SELECT DISTINCT DATE(start_time) as reading_date
-		FROM reading_sessions
-		WHERE user_id = ? AND end_time IS NOT NULL
-		ORDER BY reading_date DESC`, userID)
+		SELECT start_time FROM reading_sessions
+		WHERE user_id = ? AND end_time IS NOT NULL`, userID)
 	if err != nil {
 		return 0, 0, err
 	}
 	defer rows.Close()
 
+	// Get distinct reading dates in descending order
+	seen := make(map[time.Time]bool)
 	var dates []time.Time
 	for rows.Next() {
-		var dateStr string
-		if err := rows.Scan(&dateStr); err != nil {
+		var start time.Time
+		if err := rows.Scan(&start); err != nil {
 			return 0, 0, err
 		}
-		d, _ := time.Parse("2006-01-02", dateStr)
-		dates = append(dates, d)
+		day := calendarDay(start.In(loc))
+		if !seen[day] {
+			seen[day] = true
+			dates = append(dates, day)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
 	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].After(dates[j]) })
 
 	if len(dates) == 0 {
 		return 0, 0, nil
 	}
 
-	today := time.Now().Truncate(24 * time.Hour)
+	today := calendarDay(time.Now().In(loc))
 	yesterday := today.AddDate(0, 0, -1)
-	lastReading := dates[0].Truncate(24 * time.Hour)
+	lastReading := dates[0]
 
 	// If last reading wasn't today or yesterday, streak is broken
 	if !lastReading.Equal(today) && !lastReading.Equal(yesterday) {
@@ -2467,9 +3570,7 @@ func (d *Database) CalculateStreak(userID string) (current, longest int, err err
 	// Count current streak
 	current = 1
 	for i := 0; i < len(dates)-1; i++ {
-		curr := dates[i].Truncate(24 * time.Hour)
-		prev := dates[i+1].Truncate(24 * time.Hour)
-		if curr.AddDate(0, 0, -1).Equal(prev) {
+		if dates[i].AddDate(0, 0, -1).Equal(dates[i+1]) {
 			current++
 		} else {
 			break
@@ -2485,6 +3586,12 @@ func (d *Database) CalculateStreak(userID string) (current, longest int, err err
 	return current, longest, nil
 }
 
+// calendarDay returns midnight UTC of t's date where t is, so days from
+// different timezones compare by date alone
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
 func (d *Database) calculateLongestStreak(dates []time.Time) int {
 	if len(dates) == 0 {
 		return 0
@@ -2523,10 +3630,941 @@ func (d *Database) GetReadingStatsForBook(userID, bookID string) (totalTime, pag
 func (d *Database) GetCompletedBooksCount(userID string) (int, error) {
 	var count int
 	err := d.db.QueryRow(`
-		SELECT COUNT(*) FROM books WHERE user_id = ? AND read_status = 'completed'`, userID).Scan(&count)
+		SELECT COUNT(*) FROM user_book_state s
+		INNER JOIN books b ON b.id = s.book_id
+		WHERE s.user_id = ? AND s.read_status = 'completed'`, userID).Scan(&count)
 	return count, err
 }
 
+// GetMemories returns the books a user finished and the highlights they made
+// on any of monthDays ("MM-DD") in years before year, newest first. Dates
+// are matched as stored, in the time zone they were recorded in.
+func (d *Database) GetMemories(userID string, monthDays []string, year int) ([]models.Memory, error) {
+	if len(monthDays) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(monthDays)), ",")
+	before := fmt.Sprintf("%04d", year)
+
+	args := []interface{}{userID}
+	for _, md := range monthDays {
+		args = append(args, md)
+	}
+	args = append(args, before)
+
+	rows, err := d.db.Query(`
+		SELECT s.book_id, s.date_completed, b.title, b.author
+		FROM user_book_state s
+		INNER JOIN books b ON b.id = s.book_id
+		WHERE s.user_id = ? AND s.read_status = 'completed' AND s.date_completed IS NOT NULL
+			AND SUBSTR(s.date_completed, 6, 5) IN (`+placeholders+`)
+			AND SUBSTR(s.date_completed, 1, 4) < ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memories []models.Memory
+	for rows.Next() {
+		m := models.Memory{Type: models.MemoryFinished}
+		if err := rows.Scan(&m.BookID, &m.Date, &m.BookTitle, &m.BookAuthor); err != nil {
+			return nil, err
+		}
+		memories = append(memories, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = d.db.Query(`
+		SELECT a.id, a.book_id, a.user_id, a.chapter, a.cfi, a.start_offset, a.end_offset, a.selected_text, a.note, a.color, a.visibility,
+			a.created_at, a.updated_at, b.title, b.author
+		FROM annotations a
+		INNER JOIN books b ON b.id = a.book_id
+		WHERE a.user_id = ?
+			AND SUBSTR(a.created_at, 6, 5) IN (`+placeholders+`)
+			AND SUBSTR(a.created_at, 1, 4) < ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ann := &models.Annotation{}
+		m := models.Memory{Type: models.MemoryHighlight, Annotation: ann}
+		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &ann.CFI, &ann.StartOffset, &ann.EndOffset,
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt, &m.BookTitle, &m.BookAuthor); err != nil {
+			return nil, err
+		}
+		m.BookID = ann.BookID
+		m.Date = ann.CreatedAt
+		memories = append(memories, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(memories, func(i, j int) bool {
+		return memories[i].Date.After(memories[j].Date)
+	})
+	return memories, nil
+}
+
+// ==================== Notification Methods ====================
+
+// CreateNotificationChannel creates a new notification channel for a user
+func (d *Database) CreateNotificationChannel(ch *models.NotificationChannel) error {
+	_, err := d.db.Exec(`
+		INSERT INTO notification_channels (id, user_id, type, name, target, token, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		ch.ID, ch.UserID, ch.Type, ch.Name, ch.Target, ch.Token, ch.Enabled, ch.CreatedAt,
+	)
+	return err
+}
+
+// GetNotificationChannel returns a notification channel by ID
+func (d *Database) GetNotificationChannel(channelID string) (*models.NotificationChannel, error) {
+	ch := &models.NotificationChannel{}
+	err := d.db.QueryRow(`
+		SELECT id, user_id, type, name, target, COALESCE(token, ''), COALESCE(enabled, 1), created_at
+		FROM notification_channels WHERE id = ?`, channelID).Scan(
+		&ch.ID, &ch.UserID, &ch.Type, &ch.Name, &ch.Target, &ch.Token, &ch.Enabled, &ch.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ch.HasToken = ch.Token != ""
+	return ch, nil
+}
+
+// ListNotificationChannels returns all notification channels for a user
+func (d *Database) ListNotificationChannels(userID string) ([]*models.NotificationChannel, error) {
+	return d.queryNotificationChannels(`
+		SELECT id, user_id, type, name, target, COALESCE(token, ''), COALESCE(enabled, 1), created_at
+		FROM notification_channels
+		WHERE user_id = ?
+		ORDER BY created_at ASC`, userID)
+}
+
+// GetNotificationChannelsForEvent returns the enabled channels that should receive an event.
+// Users are subscribed to every event unless they have explicitly disabled it.
+func (d *Database) GetNotificationChannelsForEvent(userID, eventType string) ([]*models.NotificationChannel, error) {
+	return d.queryNotificationChannels(`
+		SELECT c.id, c.user_id, c.type, c.name, c.target, COALESCE(c.token, ''), COALESCE(c.enabled, 1), c.created_at
+		FROM notification_channels c
+		LEFT JOIN notification_subscriptions s ON s.user_id = c.user_id AND s.event_type = ?
+		WHERE c.user_id = ? AND c.enabled = 1 AND COALESCE(s.enabled, 1) = 1
+		ORDER BY c.created_at ASC`, eventType, userID)
+}
+
+// queryNotificationChannels runs a channel query and scans the results
+func (d *Database) queryNotificationChannels(query string, args ...interface{}) ([]*models.NotificationChannel, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*models.NotificationChannel
+	for rows.Next() {
+		ch := &models.NotificationChannel{}
+		if err := rows.Scan(&ch.ID, &ch.UserID, &ch.Type, &ch.Name, &ch.Target, &ch.Token, &ch.Enabled, &ch.CreatedAt); err != nil {
+			return nil, err
+		}
+		ch.HasToken = ch.Token != ""
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// UpdateNotificationChannel updates a notification channel's settings
+func (d *Database) UpdateNotificationChannel(ch *models.NotificationChannel) error {
+	_, err := d.db.Exec(`
+		UPDATE notification_channels SET name = ?, target = ?, token = ?, enabled = ?
+		WHERE id = ?`,
+		ch.Name, ch.Target, ch.Token, ch.Enabled, ch.ID,
+	)
+	return err
+}
+
+// DeleteNotificationChannel removes a notification channel
+func (d *Database) DeleteNotificationChannel(channelID string) error {
+	_, err := d.db.Exec(`DELETE FROM notification_channels WHERE id = ?`, channelID)
+	return err
+}
+
+// GetNotificationSubscriptions returns the user's setting for every known event.
+// Events without a stored setting default to enabled.
+func (d *Database) GetNotificationSubscriptions(userID string) ([]models.NotificationSubscription, error) {
+	rows, err := d.db.Query(`
+		SELECT event_type, enabled FROM notification_subscriptions WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]bool)
+	for rows.Next() {
+		var eventType string
+		var enabled bool
+		if err := rows.Scan(&eventType, &enabled); err != nil {
+			return nil, err
+		}
+		settings[eventType] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	subs := make([]models.NotificationSubscription, 0, len(models.NotificationEvents))
+	for eventType, description := range models.NotificationEvents {
+		enabled, ok := settings[eventType]
+		if !ok {
+			enabled = true
+		}
+		subs = append(subs, models.NotificationSubscription{
+			EventType:   eventType,
+			Description: description,
+			Enabled:     enabled,
+		})
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].EventType < subs[j].EventType })
+	return subs, nil
+}
+
+// SetNotificationSubscription enables or disables an event for a user
+func (d *Database) SetNotificationSubscription(userID, eventType string, enabled bool) error {
+	_, err := d.db.Exec(`
+		INSERT INTO notification_subscriptions (user_id, event_type, enabled)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id, event_type) DO UPDATE SET enabled = excluded.enabled`,
+		userID, eventType, enabled,
+	)
+	return err
+}
+
+// ==================== Follow Methods ====================
+
+// CreateFollow creates a new author or series follow
+func (d *Database) CreateFollow(f *models.Follow) error {
+	_, err := d.db.Exec(`
+		INSERT INTO follows (id, user_id, follow_type, name, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		f.ID, f.UserID, f.FollowType, f.Name, f.CreatedAt,
+	)
+	return err
+}
+
+// GetFollow returns a follow by ID
+func (d *Database) GetFollow(followID string) (*models.Follow, error) {
+	f := &models.Follow{}
+	err := d.db.QueryRow(`
+		SELECT f.id, f.user_id, f.follow_type, f.name, f.created_at, f.last_checked_at,
+			(SELECT COUNT(*) FROM follow_updates WHERE follow_id = f.id AND seen = 0) as unseen_count
+		FROM follows f WHERE f.id = ?`, followID).Scan(
+		&f.ID, &f.UserID, &f.FollowType, &f.Name, &f.CreatedAt, &f.LastCheckedAt, &f.UnseenCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// GetFollowByName returns a user's follow for an author or series name
+func (d *Database) GetFollowByName(userID, followType, name string) (*models.Follow, error) {
+	f := &models.Follow{}
+	err := d.db.QueryRow(`
+		SELECT f.id, f.user_id, f.follow_type, f.name, f.created_at, f.last_checked_at,
+			(SELECT COUNT(*) FROM follow_updates WHERE follow_id = f.id AND seen = 0) as unseen_count
+		FROM follows f WHERE f.user_id = ? AND f.follow_type = ? AND f.name = ?`,
+		userID, followType, name).Scan(
+		&f.ID, &f.UserID, &f.FollowType, &f.Name, &f.CreatedAt, &f.LastCheckedAt, &f.UnseenCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ListFollows returns all follows for a user
+func (d *Database) ListFollows(userID string) ([]*models.Follow, error) {
+	return d.queryFollows(`
+		SELECT f.id, f.user_id, f.follow_type, f.name, f.created_at, f.last_checked_at,
+			(SELECT COUNT(*) FROM follow_updates WHERE follow_id = f.id AND seen = 0) as unseen_count
+		FROM follows f
+		WHERE f.user_id = ?
+		ORDER BY f.follow_type ASC, f.name ASC`, userID)
+}
+
+// ListFollowsDueForCheck returns follows across all users not checked since the cutoff
+func (d *Database) ListFollowsDueForCheck(cutoff time.Time) ([]*models.Follow, error) {
+	return d.queryFollows(`
+		SELECT f.id, f.user_id, f.follow_type, f.name, f.created_at, f.last_checked_at, 0
+		FROM follows f
+		WHERE f.last_checked_at IS NULL OR f.last_checked_at < ?
+		ORDER BY f.last_checked_at ASC`, cutoff)
+}
+
+// queryFollows runs a follow query and scans the results
+func (d *Database) queryFollows(query string, args ...interface{}) ([]*models.Follow, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var follows []*models.Follow
+	for rows.Next() {
+		f := &models.Follow{}
+		if err := rows.Scan(&f.ID, &f.UserID, &f.FollowType, &f.Name, &f.CreatedAt, &f.LastCheckedAt, &f.UnseenCount); err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+	return follows, rows.Err()
+}
+
+// UpdateFollowChecked records when a follow was last checked for releases
+func (d *Database) UpdateFollowChecked(followID string, checkedAt time.Time) error {
+	_, err := d.db.Exec(`UPDATE follows SET last_checked_at = ? WHERE id = ?`, checkedAt, followID)
+	return err
+}
+
+// DeleteFollow removes a follow and its updates
+func (d *Database) DeleteFollow(followID string) error {
+	_, err := d.db.Exec(`DELETE FROM follows WHERE id = ?`, followID)
+	return err
+}
+
+// CreateFollowUpdate records a release for a follow.
+// Returns false if the release was already recorded.
+func (d *Database) CreateFollowUpdate(u *models.FollowUpdate) (bool, error) {
+	result, err := d.db.Exec(`
+		INSERT OR IGNORE INTO follow_updates (id, follow_id, user_id, title, author, series, issue_number,
+			release_date, cover_url, source, source_id, seen, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.FollowID, u.UserID, u.Title, u.Author, u.Series, u.IssueNumber,
+		u.ReleaseDate, u.CoverURL, u.Source, u.SourceID, u.Seen, u.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListFollowUpdates returns a user's release feed, newest first
+func (d *Database) ListFollowUpdates(userID string, unseenOnly bool, limit int) ([]*models.FollowUpdate, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	query := `
+		SELECT u.id, u.follow_id, u.user_id, u.title, COALESCE(u.author, ''), COALESCE(u.series, ''),
+			COALESCE(u.issue_number, ''), COALESCE(u.release_date, ''), COALESCE(u.cover_url, ''),
+			u.source, u.source_id, u.seen, u.created_at, f.follow_type, f.name
+		FROM follow_updates u
+		INNER JOIN follows f ON f.id = u.follow_id
+		WHERE u.user_id = ?`
+	if unseenOnly {
+		query += " AND u.seen = 0"
+	}
+	query += " ORDER BY u.created_at DESC LIMIT ?"
+
+	rows, err := d.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []*models.FollowUpdate
+	for rows.Next() {
+		u := &models.FollowUpdate{}
+		if err := rows.Scan(&u.ID, &u.FollowID, &u.UserID, &u.Title, &u.Author, &u.Series,
+			&u.IssueNumber, &u.ReleaseDate, &u.CoverURL, &u.Source, &u.SourceID, &u.Seen,
+			&u.CreatedAt, &u.FollowType, &u.FollowName); err != nil {
+			return nil, err
+		}
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
+
+// MarkFollowUpdatesSeen marks a user's updates as seen.
+// If no IDs are given, all of the user's updates are marked.
+func (d *Database) MarkFollowUpdatesSeen(userID string, updateIDs []string) error {
+	if len(updateIDs) == 0 {
+		_, err := d.db.Exec(`UPDATE follow_updates SET seen = 1 WHERE user_id = ?`, userID)
+		return err
+	}
+
+	placeholders := make([]string, len(updateIDs))
+	args := []interface{}{userID}
+	for i, id := range updateIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	_, err := d.db.Exec(`UPDATE follow_updates SET seen = 1 WHERE user_id = ? AND id IN (`+
+		strings.Join(placeholders, ",")+`)`, args...)
+	return err
+}
+
+// HasBookWithTitle checks whether a title is already in the user's library
+func (d *Database) HasBookWithTitle(userID, title string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`
+		SELECT COUNT(*) FROM books
+		WHERE (user_id = ? OR user_id = '') AND LOWER(title) = LOWER(?)`,
+		userID, title).Scan(&count)
+	return count > 0, err
+}
+
+// HasBookInSeries checks whether a series entry is already in the user's library
+func (d *Database) HasBookInSeries(userID, series string, seriesIndex float64) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`
+		SELECT COUNT(*) FROM books
+		WHERE (user_id = ? OR user_id = '') AND LOWER(series) = LOWER(?) AND series_index = ?`,
+		userID, series, seriesIndex).Scan(&count)
+	return count > 0, err
+}
+
+// ==================== Review Methods ====================
+
+// SaveBookReview creates or replaces a user's review of a book
+func (d *Database) SaveBookReview(review *models.BookReview) error {
+	_, err := d.db.Exec(`
+		INSERT INTO book_reviews (id, book_id, user_id, rating, review, spoiler, read_date, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(book_id, user_id) DO UPDATE SET
+			rating = excluded.rating,
+			review = excluded.review,
+			spoiler = excluded.spoiler,
+			read_date = excluded.read_date,
+			updated_at = excluded.updated_at`,
+		review.ID, review.BookID, review.UserID, review.Rating, review.Review, review.Spoiler,
+		review.ReadDate, review.CreatedAt, review.UpdatedAt,
+	)
+	return err
+}
+
+// GetBookReview returns a user's review of a book
+func (d *Database) GetBookReview(bookID, userID string) (*models.BookReview, error) {
+	r := &models.BookReview{}
+	err := d.db.QueryRow(`
+		SELECT r.id, r.book_id, r.user_id, r.rating, COALESCE(r.review, ''), r.spoiler, r.read_date,
+			r.created_at, r.updated_at, u.username, b.title, b.author
+		FROM book_reviews r
+		INNER JOIN users u ON u.id = r.user_id
+		INNER JOIN books b ON b.id = r.book_id
+		WHERE r.book_id = ? AND r.user_id = ?`, bookID, userID).Scan(
+		&r.ID, &r.BookID, &r.UserID, &r.Rating, &r.Review, &r.Spoiler, &r.ReadDate,
+		&r.CreatedAt, &r.UpdatedAt, &r.Username, &r.BookTitle, &r.BookAuthor,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DeleteBookReview removes a user's review of a book
+func (d *Database) DeleteBookReview(bookID, userID string) error {
+	_, err := d.db.Exec(`DELETE FROM book_reviews WHERE book_id = ? AND user_id = ?`, bookID, userID)
+	return err
+}
+
+// ListReviewsByUser returns all of a user's reviews, most recently updated first
+func (d *Database) ListReviewsByUser(userID string) ([]*models.BookReview, error) {
+	return d.queryBookReviews(`
+		SELECT r.id, r.book_id, r.user_id, r.rating, COALESCE(r.review, ''), r.spoiler, r.read_date,
+			r.created_at, r.updated_at, u.username, b.title, b.author
+		FROM book_reviews r
+		INNER JOIN users u ON u.id = r.user_id
+		INNER JOIN books b ON b.id = r.book_id
+		WHERE r.user_id = ?
+		ORDER BY r.updated_at DESC`, userID)
+}
+
+// ListHouseholdReviews returns reviews of a book by everyone who shares it:
+// the owner and the users it has been shared with. Public books (no owner)
+// return every review.
+func (d *Database) ListHouseholdReviews(bookID string) ([]*models.BookReview, error) {
+	return d.queryBookReviews(`
+		SELECT r.id, r.book_id, r.user_id, r.rating, COALESCE(r.review, ''), r.spoiler, r.read_date,
+			r.created_at, r.updated_at, u.username, b.title, b.author
+		FROM book_reviews r
+		INNER JOIN users u ON u.id = r.user_id
+		INNER JOIN books b ON b.id = r.book_id
+		WHERE r.book_id = ? AND (
+			b.user_id = '' OR r.user_id = b.user_id OR
+			r.user_id IN (SELECT shared_with_id FROM book_shares WHERE book_id = r.book_id)
+		)
+		ORDER BY r.updated_at DESC`, bookID)
+}
+
+// queryBookReviews runs a review query and scans the results
+func (d *Database) queryBookReviews(query string, args ...interface{}) ([]*models.BookReview, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []*models.BookReview
+	for rows.Next() {
+		r := &models.BookReview{}
+		if err := rows.Scan(&r.ID, &r.BookID, &r.UserID, &r.Rating, &r.Review, &r.Spoiler, &r.ReadDate,
+			&r.CreatedAt, &r.UpdatedAt, &r.Username, &r.BookTitle, &r.BookAuthor); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+	return reviews, rows.Err()
+}
+
+// ==================== Loan Methods ====================
+
+// loanColumns is the column list scanned by queryBookLoans
+const loanColumns = `l.id, l.book_id, l.user_id, l.borrower_name, COALESCE(l.borrower_user_id, ''),
+	COALESCE(l.notes, ''), l.lent_at, l.due_date, l.returned_at, l.reminded_at, b.title, b.author`
+
+// CreateBookLoan records a book being lent out
+func (d *Database) CreateBookLoan(loan *models.BookLoan) error {
+	_, err := d.db.Exec(`
+		INSERT INTO book_loans (id, book_id, user_id, borrower_name, borrower_user_id, notes, lent_at, due_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		loan.ID, loan.BookID, loan.UserID, loan.BorrowerName, loan.BorrowerUserID, loan.Notes,
+		loan.LentAt, loan.DueDate,
+	)
+	return err
+}
+
+// GetBookLoan returns a loan by ID
+func (d *Database) GetBookLoan(loanID string) (*models.BookLoan, error) {
+	loans, err := d.queryBookLoans(`
+		SELECT `+loanColumns+`
+		FROM book_loans l
+		INNER JOIN books b ON b.id = l.book_id
+		WHERE l.id = ?`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if len(loans) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return loans[0], nil
+}
+
+// GetActiveBookLoan returns the user's outstanding loan of a book, if any
+func (d *Database) GetActiveBookLoan(userID, bookID string) (*models.BookLoan, error) {
+	loans, err := d.queryBookLoans(`
+		SELECT `+loanColumns+`
+		FROM book_loans l
+		INNER JOIN books b ON b.id = l.book_id
+		WHERE l.user_id = ? AND l.book_id = ? AND l.returned_at IS NULL`, userID, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if len(loans) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return loans[0], nil
+}
+
+// ListBookLoans returns the books a user has lent out, outstanding loans
+// first (soonest due first), then returned loans when includeReturned is set
+func (d *Database) ListBookLoans(userID string, includeReturned bool) ([]*models.BookLoan, error) {
+	query := `
+		SELECT ` + loanColumns + `
+		FROM book_loans l
+		INNER JOIN books b ON b.id = l.book_id
+		WHERE l.user_id = ?`
+	if !includeReturned {
+		query += ` AND l.returned_at IS NULL`
+	}
+	query += `
+		ORDER BY l.returned_at IS NOT NULL, l.due_date IS NULL, l.due_date ASC, l.lent_at DESC`
+	return d.queryBookLoans(query, userID)
+}
+
+// ListBorrowedBooks returns outstanding loans where the user is the borrower
+func (d *Database) ListBorrowedBooks(userID string) ([]*models.BookLoan, error) {
+	return d.queryBookLoans(`
+		SELECT `+loanColumns+`
+		FROM book_loans l
+		INNER JOIN books b ON b.id = l.book_id
+		WHERE l.borrower_user_id = ? AND l.returned_at IS NULL
+		ORDER BY l.due_date IS NULL, l.due_date ASC, l.lent_at DESC`, userID)
+}
+
+// ListOverdueLoansToRemind returns outstanding loans across all users that
+// were due before now and haven't had a reminder sent yet
+func (d *Database) ListOverdueLoansToRemind(now time.Time) ([]*models.BookLoan, error) {
+	return d.queryBookLoans(`
+		SELECT `+loanColumns+`
+		FROM book_loans l
+		INNER JOIN books b ON b.id = l.book_id
+		WHERE l.returned_at IS NULL AND l.due_date IS NOT NULL AND l.due_date < ? AND l.reminded_at IS NULL
+		ORDER BY l.due_date ASC`, now)
+}
+
+// MarkBookLoanReturned records a loan's book as returned
+func (d *Database) MarkBookLoanReturned(loanID string, returnedAt time.Time) error {
+	_, err := d.db.Exec(`UPDATE book_loans SET returned_at = ? WHERE id = ?`, returnedAt, loanID)
+	return err
+}
+
+// MarkBookLoanReminded records that an overdue reminder was sent for a loan
+func (d *Database) MarkBookLoanReminded(loanID string, remindedAt time.Time) error {
+	_, err := d.db.Exec(`UPDATE book_loans SET reminded_at = ? WHERE id = ?`, remindedAt, loanID)
+	return err
+}
+
+// DeleteBookLoan removes a loan record
+func (d *Database) DeleteBookLoan(loanID string) error {
+	_, err := d.db.Exec(`DELETE FROM book_loans WHERE id = ?`, loanID)
+	return err
+}
+
+// queryBookLoans runs a loan query and scans the results
+func (d *Database) queryBookLoans(query string, args ...interface{}) ([]*models.BookLoan, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var loans []*models.BookLoan
+	for rows.Next() {
+		l := &models.BookLoan{}
+		if err := rows.Scan(&l.ID, &l.BookID, &l.UserID, &l.BorrowerName, &l.BorrowerUserID, &l.Notes,
+			&l.LentAt, &l.DueDate, &l.ReturnedAt, &l.RemindedAt, &l.BookTitle, &l.BookAuthor); err != nil {
+			return nil, err
+		}
+		l.Overdue = l.IsOverdue(now)
+		loans = append(loans, l)
+	}
+	return loans, rows.Err()
+}
+
+// ==================== Reader Preference Methods ====================
+
+// GetReaderPreferences returns a user's reader settings, or the defaults if
+// they haven't saved any
+func (d *Database) GetReaderPreferences(userID string) (*models.ReaderPreferences, error) {
+	p := &models.ReaderPreferences{UserID: userID}
+	err := d.db.QueryRow(`
+		SELECT font_family, font_size, line_height, margins, theme, page_turn_mode, comic_fit_mode, updated_at
+		FROM reader_preferences WHERE user_id = ?`, userID).Scan(
+		&p.FontFamily, &p.FontSize, &p.LineHeight, &p.Margins, &p.Theme, &p.PageTurnMode, &p.ComicFitMode, &p.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return models.DefaultReaderPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SaveReaderPreferences creates or replaces a user's reader settings
+func (d *Database) SaveReaderPreferences(p *models.ReaderPreferences) error {
+	_, err := d.db.Exec(`
+		INSERT INTO reader_preferences (user_id, font_family, font_size, line_height, margins, theme, page_turn_mode, comic_fit_mode, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			font_family = excluded.font_family,
+			font_size = excluded.font_size,
+			line_height = excluded.line_height,
+			margins = excluded.margins,
+			theme = excluded.theme,
+			page_turn_mode = excluded.page_turn_mode,
+			comic_fit_mode = excluded.comic_fit_mode,
+			updated_at = excluded.updated_at`,
+		p.UserID, p.FontFamily, p.FontSize, p.LineHeight, p.Margins, p.Theme, p.PageTurnMode, p.ComicFitMode, p.UpdatedAt,
+	)
+	return err
+}
+
+// ==================== Stats Preference Methods ====================
+
+// GetStatsPreferences returns a user's stats settings, or the defaults if
+// they haven't saved any
+func (d *Database) GetStatsPreferences(userID string) (*models.StatsPreferences, error) {
+	p := &models.StatsPreferences{UserID: userID}
+	err := d.db.QueryRow(`
+		SELECT timezone, privacy_mode, updated_at FROM stats_preferences WHERE user_id = ?`, userID,
+	).Scan(&p.Timezone, &p.PrivacyMode, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return &models.StatsPreferences{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SaveStatsPreferences creates or replaces a user's stats settings
+func (d *Database) SaveStatsPreferences(p *models.StatsPreferences) error {
+	_, err := d.db.Exec(`
+		INSERT INTO stats_preferences (user_id, timezone, privacy_mode, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			timezone = excluded.timezone,
+			privacy_mode = excluded.privacy_mode,
+			updated_at = excluded.updated_at`,
+		p.UserID, p.Timezone, p.PrivacyMode, p.UpdatedAt,
+	)
+	return err
+}
+
+// InPrivacyMode reports whether a user has turned reading tracking off.
+// If their settings can't be read they're treated as having done so.
+func (d *Database) InPrivacyMode(userID string) bool {
+	prefs, err := d.GetStatsPreferences(userID)
+	if err != nil {
+		return true
+	}
+	return prefs.PrivacyMode
+}
+
+// UserLocation returns the timezone a user's reading days are counted in,
+// the server's if they haven't set one or it can't be read
+func (d *Database) UserLocation(userID string) *time.Location {
+	prefs, err := d.GetStatsPreferences(userID)
+	if err != nil {
+		return time.Local
+	}
+	return prefs.Location()
+}
+
+// ==================== Library Preference Methods ====================
+
+// GetLibraryPreferences returns how a user's library is ordered, or the
+// defaults if they haven't saved any
+func (d *Database) GetLibraryPreferences(userID string) (*models.LibraryPreferences, error) {
+	p := &models.LibraryPreferences{UserID: userID}
+	err := d.db.QueryRow(`
+		SELECT sort_locale, ignore_articles, subject_tags, default_visibility, updated_at
+		FROM library_preferences WHERE user_id = ?`, userID).Scan(
+		&p.SortLocale, &p.IgnoreArticles, &p.SubjectTags, &p.DefaultVisibility, &p.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return models.DefaultLibraryPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`SELECT subject, tag FROM subject_tag_map WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p.SubjectTagMap = map[string]string{}
+	for rows.Next() {
+		var subject, tag string
+		if err := rows.Scan(&subject, &tag); err != nil {
+			return nil, err
+		}
+		p.SubjectTagMap[subject] = tag
+	}
+	return p, rows.Err()
+}
+
+// SaveLibraryPreferences creates or replaces a user's library settings
+func (d *Database) SaveLibraryPreferences(p *models.LibraryPreferences) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO library_preferences (user_id, sort_locale, ignore_articles, subject_tags, default_visibility, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			sort_locale = excluded.sort_locale,
+			ignore_articles = excluded.ignore_articles,
+			subject_tags = excluded.subject_tags,
+			default_visibility = excluded.default_visibility,
+			updated_at = excluded.updated_at`,
+		p.UserID, p.SortLocale, p.IgnoreArticles, p.SubjectTags, p.DefaultVisibility, p.UpdatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM subject_tag_map WHERE user_id = ?`, p.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for subject, tag := range p.SubjectTagMap {
+		if _, err := tx.Exec(`INSERT INTO subject_tag_map (user_id, subject, tag) VALUES (?, ?, ?)`,
+			p.UserID, subject, tag); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ==================== Series Reading Direction Methods ====================
+
+// GetSeriesReadingDirection returns the reading direction a user's new
+// uploads in series get, or "" if they haven't set one
+func (d *Database) GetSeriesReadingDirection(userID, series string) (string, error) {
+	var direction string
+	err := d.db.QueryRow(`
+		SELECT reading_direction FROM series_reading_directions
+		WHERE user_id = ? AND series = ?`, userID, series).Scan(&direction)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return direction, err
+}
+
+// ListSeriesReadingDirections returns a user's series reading directions
+// ordered by series
+func (d *Database) ListSeriesReadingDirections(userID string) ([]*models.SeriesReadingDirection, error) {
+	rows, err := d.db.Query(`
+		SELECT series, reading_direction, updated_at
+		FROM series_reading_directions WHERE user_id = ?
+		ORDER BY series`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var directions []*models.SeriesReadingDirection
+	for rows.Next() {
+		s := &models.SeriesReadingDirection{UserID: userID}
+		if err := rows.Scan(&s.Series, &s.ReadingDirection, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		directions = append(directions, s)
+	}
+	return directions, rows.Err()
+}
+
+// SaveSeriesReadingDirection creates or replaces a series reading direction
+func (d *Database) SaveSeriesReadingDirection(s *models.SeriesReadingDirection) error {
+	_, err := d.db.Exec(`
+		INSERT INTO series_reading_directions (user_id, series, reading_direction, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, series) DO UPDATE SET
+			reading_direction = excluded.reading_direction,
+			updated_at = excluded.updated_at`,
+		s.UserID, s.Series, s.ReadingDirection, s.UpdatedAt,
+	)
+	return err
+}
+
+// DeleteSeriesReadingDirection removes a series reading direction, returning
+// sql.ErrNoRows if there is none
+func (d *Database) DeleteSeriesReadingDirection(userID, series string) error {
+	result, err := d.db.Exec(`
+		DELETE FROM series_reading_directions WHERE user_id = ? AND series = ?`, userID, series)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ==================== Style Override Methods ====================
+
+// GetStyleOverride returns a user's CSS override for a book, or their global
+// override when bookID is empty
+func (d *Database) GetStyleOverride(userID, bookID string) (*models.StyleOverride, error) {
+	o := &models.StyleOverride{UserID: userID, BookID: bookID}
+	err := d.db.QueryRow(`
+		SELECT css, updated_at FROM style_overrides WHERE user_id = ? AND book_id = ?`,
+		userID, bookID).Scan(&o.CSS, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// GetStyleOverridesForBook returns the CSS to apply to a book for a user:
+// their global override followed by the book's own
+func (d *Database) GetStyleOverridesForBook(userID, bookID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT css FROM style_overrides
+		WHERE user_id = ? AND (book_id = '' OR book_id = ?)
+		ORDER BY book_id = '' DESC`, userID, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sheets []string
+	for rows.Next() {
+		var css string
+		if err := rows.Scan(&css); err != nil {
+			return nil, err
+		}
+		sheets = append(sheets, css)
+	}
+	return sheets, rows.Err()
+}
+
+// SaveStyleOverride creates or replaces a CSS override
+func (d *Database) SaveStyleOverride(o *models.StyleOverride) error {
+	_, err := d.db.Exec(`
+		INSERT INTO style_overrides (user_id, book_id, css, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, book_id) DO UPDATE SET
+			css = excluded.css,
+			updated_at = excluded.updated_at`,
+		o.UserID, o.BookID, o.CSS, o.UpdatedAt,
+	)
+	return err
+}
+
+// DeleteStyleOverride removes a CSS override
+func (d *Database) DeleteStyleOverride(userID, bookID string) error {
+	_, err := d.db.Exec(`DELETE FROM style_overrides WHERE user_id = ? AND book_id = ?`, userID, bookID)
+	return err
+}
+
+// ==================== Library Revision Methods ====================
+
+// GetLibraryRevision returns a counter that changes whenever the user's
+// library changes. Users with no recorded writes are at revision 0.
+func (d *Database) GetLibraryRevision(userID string) (int64, error) {
+	var revision int64
+	err := d.db.QueryRow("SELECT revision FROM library_revisions WHERE user_id = ?", userID).Scan(&revision)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return revision, err
+}
+
+// BumpLibraryRevisions increments the library revision of each user
+func (d *Database) BumpLibraryRevisions(userIDs ...string) error {
+	seen := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		_, err := d.db.Exec(`
+			INSERT INTO library_revisions (user_id, revision) VALUES (?, 1)
+			ON CONFLICT(user_id) DO UPDATE SET revision = revision + 1`, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Helper function to format duration
 func formatDuration(seconds int) string {
 	hours := seconds / 3600
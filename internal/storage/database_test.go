@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"database/sql"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,11 +25,27 @@ func setupTestDB(t *testing.T) (*Database, func()) {
 	cleanup := func() {
 		db.Close()
 		os.Remove(tmpFile.Name())
+		os.Remove(tmpFile.Name() + "-wal")
+		os.Remove(tmpFile.Name() + "-shm")
 	}
 
 	return db, cleanup
 }
 
+// createTestUsers adds users with the given IDs so rows that reference them
+// satisfy foreign keys
+func createTestUsers(t *testing.T, db *Database, ids ...string) {
+	for _, id := range ids {
+		require.NoError(t, db.CreateUser(&models.User{
+			ID:           id,
+			Username:     id,
+			Email:        id + "@example.com",
+			PasswordHash: "hash",
+			CreatedAt:    time.Now(),
+		}))
+	}
+}
+
 func TestCreateAndGetUser(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -95,6 +114,7 @@ func TestUserExists(t *testing.T) {
 func TestCreateAndGetBook(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "test-user-id")
 
 	book := &models.Book{
 		ID:          "test-book-id",
@@ -120,9 +140,227 @@ func TestCreateAndGetBook(t *testing.T) {
 	assert.Equal(t, book.Author, retrieved.Author)
 }
 
+func TestUpdateUserPassword(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	require.NoError(t, db.UpdateUserPassword("user-1", "new-hash"))
+	user, err := db.GetUserByID("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "new-hash", user.PasswordHash)
+
+	assert.ErrorIs(t, db.UpdateUserPassword("missing", "hash"), sql.ErrNoRows)
+}
+
+func TestDeleteUser(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	mine := &models.Book{ID: "book-1", UserID: "user-1", Title: "Mine", FilePath: "/path/1.epub", UploadedAt: time.Now()}
+	theirs := &models.Book{ID: "book-2", UserID: "user-2", Title: "Theirs", FilePath: "/path/2.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(mine))
+	require.NoError(t, db.CreateBook(theirs))
+	require.NoError(t, db.UpdateBookReadStatus("user-1", "book-2", models.ReadStatusReading, nil))
+	require.NoError(t, db.UpdateBookReadStatus("user-2", "book-2", models.ReadStatusReading, nil))
+	require.NoError(t, db.CreateBookLoan(&models.BookLoan{
+		ID: "loan-1", BookID: "book-2", UserID: "user-2", BorrowerName: "user-1", BorrowerUserID: "user-1", LentAt: time.Now(),
+	}))
+
+	require.NoError(t, db.DeleteUser("user-1"))
+
+	_, err := db.GetUserByID("user-1")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = db.GetBook("book-1")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "owned books go with the account")
+	status, _, err := db.GetBookReadStatus("user-1", "book-2")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusUnread, status)
+
+	// Other users keep their books, state, and loans
+	status, _, err = db.GetBookReadStatus("user-2", "book-2")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusReading, status)
+	loan, err := db.GetBookLoan("loan-1")
+	require.NoError(t, err)
+	assert.Empty(t, loan.BorrowerUserID)
+	assert.Equal(t, "user-1", loan.BorrowerName)
+
+	assert.ErrorIs(t, db.DeleteUser("user-1"), sql.ErrNoRows)
+}
+
+func TestTombstoneBook(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	book := &models.Book{ID: "book-1", UserID: "user-1", Title: "Deleted", FilePath: "/path/1.epub", FileHash: "hash-1", UploadedAt: time.Now()}
+	untouched := &models.Book{ID: "book-2", UserID: "user-1", Title: "Never Opened", FilePath: "/path/2.epub", FileHash: "hash-2", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.CreateBook(untouched))
+
+	require.NoError(t, db.CreateAnnotation(&models.Annotation{
+		ID: "ann-1", BookID: "book-1", UserID: "user-1", Chapter: "3", SelectedText: "Keep this", Color: "yellow", CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}))
+	require.NoError(t, db.SaveReadingPosition(&models.ReadingPosition{BookID: "book-1", UserID: "user-1", Chapter: "3", Position: 0.5}))
+	require.NoError(t, db.UpdateBookReadStatus("user-1", "book-1", models.ReadStatusReading, nil))
+	require.NoError(t, db.UpdateBookRating("user-1", "book-1", 4))
+	require.NoError(t, db.CreateTag(&models.Tag{ID: "tag-1", UserID: "user-1", Name: "classics", Color: "#fff", CreatedAt: time.Now()}))
+	require.NoError(t, db.AddTagToBook("book-1", "tag-1"))
+	require.NoError(t, db.CreateReadingList(&models.ReadingList{ID: "list-1", UserID: "user-1", Name: "Favourites", ListType: "custom", CreatedAt: time.Now()}))
+	require.NoError(t, db.AddBookToReadingList("book-1", "list-1"))
+	require.NoError(t, db.CreateCollection(&models.Collection{ID: "col-1", UserID: "user-1", Name: "Shelf", CreatedAt: time.Now()}))
+	require.NoError(t, db.AddBookToCollection("book-1", "col-1"))
+
+	// A book with nothing to keep leaves no tombstone
+	require.NoError(t, db.TombstoneBook(untouched))
+	_, err := db.GetDeletedBookByHash("user-1", "hash-2")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, db.TombstoneBook(book))
+	_, err = db.GetBook("book-1")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	deleted, err := db.GetDeletedBookByHash("user-1", "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, "book-1", deleted.ID)
+	assert.Equal(t, "Deleted", deleted.Title)
+	assert.Equal(t, 1, deleted.Annotations)
+	assert.Equal(t, 1, deleted.Tags)
+	assert.Equal(t, 1, deleted.ReadingLists)
+	assert.Equal(t, 1, deleted.Collections)
+	assert.True(t, deleted.HasPosition)
+	_, err = db.GetDeletedBookByHash("user-2", "hash-1")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "tombstones belong to the owner")
+
+	// The same file comes back; the collection was deleted in the meantime
+	require.NoError(t, db.DeleteCollection("col-1"))
+	reuploaded := &models.Book{ID: "book-3", UserID: "user-1", Title: "Deleted", FilePath: "/path/3.epub", FileHash: "hash-1", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(reuploaded))
+	require.NoError(t, db.RestoreDeletedBook(deleted, "book-3"))
+
+	annotations, err := db.GetAnnotationsForBook("book-3", "user-1")
+	require.NoError(t, err)
+	require.Len(t, annotations, 1)
+	assert.Equal(t, "Keep this", annotations[0].SelectedText)
+	pos, err := db.GetReadingPosition("book-3", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "3", pos.Chapter)
+	status, _, err := db.GetBookReadStatus("user-1", "book-3")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusReading, status)
+	tags, err := db.GetBookTags("book-3", "user-1")
+	require.NoError(t, err)
+	assert.Len(t, tags, 1)
+	lists, err := db.GetReadingListsForBook("book-3", "user-1")
+	require.NoError(t, err)
+	assert.Len(t, lists, 1)
+	collections, err := db.GetCollectionsForBook("book-3")
+	require.NoError(t, err)
+	assert.Empty(t, collections)
+
+	_, err = db.GetDeletedBookByHash("user-1", "hash-1")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "a tombstone is used up by restoring it")
+}
+
+func TestGetMemories(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	for _, id := range []string{"book-1", "book-2", "book-3"} {
+		require.NoError(t, db.CreateBook(&models.Book{ID: id, UserID: "user-1", Title: id, FilePath: "/path/" + id, UploadedAt: time.Now()}))
+	}
+
+	finished := func(bookID string, date time.Time) {
+		require.NoError(t, db.UpdateBookReadStatus("user-1", bookID, models.ReadStatusCompleted, &date))
+	}
+	finished("book-1", time.Date(2022, time.March, 14, 20, 0, 0, 0, time.Local))
+	finished("book-2", time.Date(2024, time.March, 15, 9, 0, 0, 0, time.Local))  // Another day
+	finished("book-3", time.Date(2025, time.March, 14, 10, 0, 0, 0, time.Local)) // This year
+
+	highlight := &models.Annotation{
+		ID: "ann-1", BookID: "book-2", UserID: "user-1", Chapter: "1", SelectedText: "Remember this",
+		CreatedAt: time.Date(2024, time.March, 14, 8, 0, 0, 0, time.Local), UpdatedAt: time.Now(),
+	}
+	require.NoError(t, db.CreateAnnotation(highlight))
+
+	memories, err := db.GetMemories("user-1", []string{"03-14"}, 2025)
+	require.NoError(t, err)
+	require.Len(t, memories, 2)
+	assert.Equal(t, models.MemoryHighlight, memories[0].Type, "newest first")
+	assert.Equal(t, "Remember this", memories[0].Annotation.SelectedText)
+	assert.Equal(t, "book-2", memories[0].BookTitle)
+	assert.Equal(t, models.MemoryFinished, memories[1].Type)
+	assert.Equal(t, "book-1", memories[1].BookID)
+	assert.Equal(t, 2022, memories[1].Date.Year())
+
+	memories, err = db.GetMemories("user-2", []string{"03-14"}, 2025)
+	require.NoError(t, err)
+	assert.Empty(t, memories)
+}
+
+func TestAccountTokens(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	expires := time.Now().Add(time.Hour)
+	require.NoError(t, db.CreateAccountToken("hash-1", "user-1", models.AccountTokenPasswordReset, expires))
+
+	// A token only works for its own purpose, and only once
+	_, err := db.ConsumeAccountToken("hash-1", models.AccountTokenEmailVerification)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	userID, err := db.ConsumeAccountToken("hash-1", models.AccountTokenPasswordReset)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", userID)
+	_, err = db.ConsumeAccountToken("hash-1", models.AccountTokenPasswordReset)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// A newer token replaces an older one
+	require.NoError(t, db.CreateAccountToken("hash-2", "user-1", models.AccountTokenPasswordReset, expires))
+	require.NoError(t, db.CreateAccountToken("hash-3", "user-1", models.AccountTokenPasswordReset, expires))
+	_, err = db.ConsumeAccountToken("hash-2", models.AccountTokenPasswordReset)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, db.DeleteAccountTokens("user-1", models.AccountTokenPasswordReset))
+	_, err = db.ConsumeAccountToken("hash-3", models.AccountTokenPasswordReset)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Expired tokens are rejected
+	require.NoError(t, db.CreateAccountToken("hash-4", "user-1", models.AccountTokenEmailVerification, time.Now().Add(-time.Minute)))
+	_, err = db.ConsumeAccountToken("hash-4", models.AccountTokenEmailVerification)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSetEmailVerified(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, db.CreateUser(&models.User{
+		ID:           "user-1",
+		Username:     "newuser",
+		Email:        "new@example.com",
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	}))
+	user, err := db.GetUserByID("user-1")
+	require.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+
+	require.NoError(t, db.SetEmailVerified("user-1"))
+	user, err = db.GetUserByID("user-1")
+	require.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+
+	assert.ErrorIs(t, db.SetEmailVerified("missing"), sql.ErrNoRows)
+}
+
 func TestListBooksForUser(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
 
 	// Create books for two users
 	book1 := &models.Book{
@@ -199,6 +437,7 @@ func TestBookSharing(t *testing.T) {
 func TestCollections(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "user-id")
 
 	collection := &models.Collection{
 		ID:        "collection-id",
@@ -231,9 +470,98 @@ func TestCollections(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestListCollectionsWithCounts(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	for _, id := range []string{"dune", "emma", "other"} {
+		owner := "user-1"
+		if id == "other" {
+			owner = "user-2"
+		}
+		require.NoError(t, db.CreateBook(&models.Book{ID: id, UserID: owner, Title: id, Author: id + " author", FilePath: "/" + id, UploadedAt: time.Now()}))
+	}
+	created := time.Now().Add(-time.Hour)
+	for _, c := range []*models.Collection{
+		{ID: "shelf", UserID: "user-1", Name: "Shelf", CreatedAt: created},
+		{ID: "empty", UserID: "user-1", Name: "Empty", CreatedAt: created},
+		{ID: "smart", UserID: "user-1", Name: "Smart", IsSmart: true, RuleLogic: "OR", CreatedAt: created},
+		{ID: "norules", UserID: "user-1", Name: "No rules", IsSmart: true, CreatedAt: created},
+	} {
+		require.NoError(t, db.CreateCollection(c))
+	}
+	require.NoError(t, db.BulkAddBooksToCollection([]string{"dune", "emma", "other"}, "shelf"))
+	for i, title := range []string{"dune", "emma", "other"} {
+		require.NoError(t, db.CreateCollectionRule(&models.CollectionRule{ID: fmt.Sprintf("rule-%d", i), CollectionID: "smart",
+			Field: models.RuleFieldTitle, Operator: models.RuleOpEquals, Value: title}))
+	}
+
+	collections, err := db.ListCollectionsWithCounts("user-1")
+	require.NoError(t, err)
+	counts := map[string]int{}
+	updated := map[string]time.Time{}
+	for _, c := range collections {
+		counts[c.ID] = c.BookCount
+		updated[c.ID] = c.UpdatedAt
+	}
+	assert.Equal(t, map[string]int{"shelf": 3, "empty": 0, "smart": 2, "norules": 0}, counts, "smart collections only match the user's books")
+	assert.True(t, updated["empty"].Equal(created))
+	assert.True(t, updated["shelf"].After(created), "adding books changes the collection")
+	assert.True(t, updated["smart"].After(created), "adding rules changes the collection")
+
+	smart, err := db.GetSmartCollectionBooks("smart", "user-1")
+	require.NoError(t, err)
+	assert.Len(t, smart, counts["smart"])
+}
+
+func TestCollectionOrderAndParent(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, db.CreateBook(&models.Book{ID: id, UserID: "user-1", Title: id, FilePath: "/" + id, UploadedAt: time.Now()}))
+	}
+	for _, c := range []*models.Collection{
+		{ID: "parent", UserID: "user-1", Name: "Parent", CreatedAt: time.Now()},
+		{ID: "child", UserID: "user-1", Name: "Child", CreatedAt: time.Now()},
+	} {
+		require.NoError(t, db.CreateCollection(c))
+	}
+
+	// Books are kept in the order they're added, after the title
+	require.NoError(t, db.AddBookToCollection("c", "parent"))
+	require.NoError(t, db.BulkAddBooksToCollection([]string{"a", "b"}, "parent"))
+	bookIDs := func() []string {
+		books, err := db.GetBooksInCollection("parent")
+		require.NoError(t, err)
+		var ids []string
+		for _, b := range books {
+			ids = append(ids, b.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"c", "a", "b"}, bookIDs())
+	require.NoError(t, db.ReorderCollection("parent", []string{"b", "c", "a"}))
+	assert.Equal(t, []string{"b", "c", "a"}, bookIDs())
+
+	require.NoError(t, db.SetCollectionParent("child", "parent"))
+	child, err := db.GetCollection("child")
+	require.NoError(t, err)
+	assert.Equal(t, "parent", child.ParentID)
+
+	// Deleting a parent moves its children to the top level
+	require.NoError(t, db.DeleteCollection("parent"))
+	child, err = db.GetCollection("child")
+	require.NoError(t, err)
+	assert.Empty(t, child.ParentID)
+}
+
 func TestReadingPositionPerUser(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
 
 	// Create a book
 	book := &models.Book{
@@ -287,6 +615,7 @@ func TestReadingPositionPerUser(t *testing.T) {
 func TestReadingPositionUpdate(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "user-1")
 
 	// Create a book
 	book := &models.Book{
@@ -324,6 +653,7 @@ func TestReadingPositionUpdate(t *testing.T) {
 func TestReadingPositionUnauthenticated(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "auth-user")
 
 	// Create a book
 	book := &models.Book{
@@ -393,6 +723,7 @@ func TestReadingPositionNotFound(t *testing.T) {
 func TestGetBooksByAuthorForUser(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
 
 	// Create books for two different users with same author
 	book1 := &models.Book{
@@ -455,9 +786,79 @@ func TestGetBooksByAuthorForUser(t *testing.T) {
 	assert.Len(t, grouped2["Author A"], 1)
 }
 
+func TestSortKeys(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	for _, b := range []*models.Book{
+		{ID: "hobbit", Title: "The Hobbit", Author: "J.R.R. Tolkien"},
+		{ID: "silmarillion", Title: "Silmarillion", Author: "Tolkien, J.R.R."},
+		{ID: "gaiman", Title: "American Gods", Author: "Neil Gaiman"},
+		{ID: "kafka", Title: "Das Schloss", Author: "Franz Kafka", Language: "de"},
+	} {
+		b.UserID = "user-1"
+		b.FilePath = "/" + b.ID + ".epub"
+		b.UploadedAt = time.Now()
+		require.NoError(t, db.CreateBook(b))
+	}
+
+	book, err := db.GetBook("hobbit")
+	require.NoError(t, err)
+	assert.Equal(t, "Hobbit", book.SortTitle)
+	assert.Equal(t, "Tolkien, J.R.R.", book.SortAuthor)
+
+	titles := func(books []models.Book) []string {
+		var out []string
+		for _, b := range books {
+			out = append(out, b.ID)
+		}
+		return out
+	}
+	books, err := db.ListBooksForUser("user-1", "title", "asc")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gaiman", "hobbit", "kafka", "silmarillion"}, titles(books))
+
+	books, err = db.ListBooksForUser("user-1", "author", "asc")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gaiman", "kafka", "hobbit", "silmarillion"}, titles(books))
+
+	grouped, err := db.GetBooksByAuthorForUser("user-1")
+	require.NoError(t, err)
+	assert.Len(t, grouped, 3)
+	assert.Len(t, grouped["J.R.R. Tolkien"], 2, "both spellings are grouped")
+
+	// Metadata edits and language changes recompute the keys
+	book.Title = "A Hobbit's Tale"
+	book.Author = "John Ronald Reuel Tolkien"
+	require.NoError(t, db.UpdateBookMetadata(book))
+	book, err = db.GetBook("hobbit")
+	require.NoError(t, err)
+	assert.Equal(t, "Hobbit's Tale", book.SortTitle)
+	assert.Equal(t, "Tolkien, John Ronald Reuel", book.SortAuthor)
+
+	require.NoError(t, db.UpdateBookLanguage("kafka", "en"))
+	book, err = db.GetBook("kafka")
+	require.NoError(t, err)
+	assert.Equal(t, "Das Schloss", book.SortTitle)
+
+	// Books from before the sort keys existed are filled in on migration.
+	// Revert back to before 0003_sort_keys and migrate again.
+	statuses, err := db.MigrationStatus()
+	require.NoError(t, err)
+	_, err = db.MigrateDown(len(statuses)-2, false)
+	require.NoError(t, err)
+	require.NoError(t, db.migrate())
+	book, err = db.GetBook("silmarillion")
+	require.NoError(t, err)
+	assert.Equal(t, "Silmarillion", book.SortTitle)
+	assert.Equal(t, "Tolkien, J.R.R.", book.SortAuthor)
+}
+
 func TestGetBooksBySeriesForUser(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
 
 	// Create books with series for two users
 	book1 := &models.Book{
@@ -531,6 +932,7 @@ func TestGetBooksBySeriesForUser(t *testing.T) {
 func TestCreateAndGetBookWithMetadata(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "test-user-id")
 
 	now := time.Now()
 	book := &models.Book{
@@ -576,6 +978,7 @@ func TestCreateAndGetBookWithMetadata(t *testing.T) {
 func TestUpdateBookMetadata(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
+	createTestUsers(t, db, "test-user-id")
 
 	// Create initial book
 	book := &models.Book{
@@ -817,7 +1220,7 @@ func TestUpdateAnnotation(t *testing.T) {
 	require.NoError(t, db.CreateAnnotation(ann))
 
 	// Update annotation
-	err := db.UpdateAnnotation(ann.ID, "Updated note", "green")
+	err := db.UpdateAnnotation(ann.ID, "Updated note", "green", models.AnnotationVisibilityShared)
 	require.NoError(t, err)
 
 	// Verify update
@@ -825,6 +1228,7 @@ func TestUpdateAnnotation(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "Updated note", retrieved.Note)
 	assert.Equal(t, "green", retrieved.Color)
+	assert.Equal(t, models.AnnotationVisibilityShared, retrieved.Visibility)
 }
 
 func TestDeleteAnnotation(t *testing.T) {
@@ -947,3 +1351,1265 @@ func TestAnnotationsPerUser(t *testing.T) {
 	assert.Len(t, annotations2, 1)
 	assert.Equal(t, "User 2 highlight", annotations2[0].SelectedText)
 }
+
+func TestVisibleAnnotationsForChapter(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "owner", "partner", "former")
+
+	book := &models.Book{ID: "book-id", UserID: "owner", Title: "Shared Book", FilePath: "/path.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.ShareBook(book.ID, "owner", "partner"))
+
+	now := time.Now()
+	for _, ann := range []*models.Annotation{
+		{ID: "owner-shared", UserID: "owner", Chapter: "1", StartOffset: 10, Visibility: models.AnnotationVisibilityShared},
+		{ID: "owner-private", UserID: "owner", Chapter: "1", StartOffset: 20, Visibility: models.AnnotationVisibilityPrivate},
+		{ID: "partner-shared", UserID: "partner", Chapter: "1", StartOffset: 30, Visibility: models.AnnotationVisibilityShared},
+		{ID: "partner-other-chapter", UserID: "partner", Chapter: "2", Visibility: models.AnnotationVisibilityShared},
+		// No longer has access to the book
+		{ID: "former-shared", UserID: "former", Chapter: "1", StartOffset: 40, Visibility: models.AnnotationVisibilityShared},
+	} {
+		ann.BookID = book.ID
+		ann.SelectedText = ann.ID
+		ann.Color = models.HighlightColorYellow
+		ann.CreatedAt, ann.UpdatedAt = now, now
+		require.NoError(t, db.CreateAnnotation(ann))
+	}
+
+	ids := func(userID string) []string {
+		anns, err := db.GetVisibleAnnotationsForChapter(book.ID, userID, "1")
+		require.NoError(t, err)
+		var ids []string
+		for _, ann := range anns {
+			ids = append(ids, ann.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"owner-shared", "owner-private", "partner-shared"}, ids("owner"))
+	assert.Equal(t, []string{"owner-shared", "partner-shared"}, ids("partner"))
+
+	anns, err := db.GetVisibleAnnotationsForChapter(book.ID, "partner", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "owner", anns[0].Username)
+}
+
+func TestAnnotationReviews(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	book := &models.Book{ID: "book-id", UserID: "user-1", Title: "Old Favourite", Author: "Author", FilePath: "/path.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	now := time.Now()
+	for i, id := range []string{"ann-old", "ann-new", "ann-seen", "ann-due"} {
+		created := now.AddDate(-4+i, 0, 0)
+		require.NoError(t, db.CreateAnnotation(&models.Annotation{
+			ID: id, BookID: book.ID, UserID: "user-1", Chapter: "1", SelectedText: id, Color: "yellow", CreatedAt: created, UpdatedAt: created,
+		}))
+	}
+
+	_, err := db.GetAnnotationReview("ann-seen")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, db.SaveAnnotationReview(&models.AnnotationReview{
+		AnnotationID: "ann-seen", ReviewCount: 1, LastReviewedAt: now, NextReviewAt: now.Add(24 * time.Hour),
+	}))
+	require.NoError(t, db.SaveAnnotationReview(&models.AnnotationReview{
+		AnnotationID: "ann-due", ReviewCount: 1, LastReviewedAt: now.Add(-48 * time.Hour), NextReviewAt: now.Add(-24 * time.Hour),
+	}))
+	require.NoError(t, db.SaveAnnotationReview(&models.AnnotationReview{
+		AnnotationID: "ann-due", ReviewCount: 2, LastReviewedAt: now.Add(-96 * time.Hour), NextReviewAt: now.Add(-time.Hour),
+	}), "saving again replaces the record")
+
+	review, err := db.GetAnnotationReview("ann-due")
+	require.NoError(t, err)
+	assert.Equal(t, 2, review.ReviewCount)
+
+	highlights, err := db.GetAnnotationsForReview("user-1", now, 10)
+	require.NoError(t, err)
+	var ids []string
+	for _, h := range highlights {
+		ids = append(ids, h.Annotation.ID)
+	}
+	assert.Equal(t, []string{"ann-old", "ann-new", "ann-due"}, ids, "unreviewed oldest first, then those due")
+	assert.Equal(t, "Old Favourite", highlights[0].BookTitle)
+	assert.Nil(t, highlights[0].LastReviewedAt)
+	assert.Equal(t, 2, highlights[2].ReviewCount)
+	require.NotNil(t, highlights[2].LastReviewedAt)
+
+	highlights, err = db.GetAnnotationsForReview("user-1", now, 1)
+	require.NoError(t, err)
+	assert.Len(t, highlights, 1)
+
+	highlights, err = db.GetAnnotationsForReview("user-2", now, 10)
+	require.NoError(t, err)
+	assert.Empty(t, highlights)
+
+	require.NoError(t, db.DeleteAnnotation("ann-due"))
+	_, err = db.GetAnnotationReview("ann-due")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "reviews go with their highlight")
+}
+
+func TestBookStructure(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	book := &models.Book{ID: "book-id", UserID: "user-1", Title: "Book", Author: "Author", FilePath: "/path.cbz", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	_, _, ok, err := db.GetBookStructure(book.ID)
+	require.NoError(t, err)
+	assert.False(t, ok, "a new book has no stored structure")
+
+	require.NoError(t, db.SaveBookStructure(book.ID, "[]", 24))
+	toc, pages, ok, err := db.GetBookStructure(book.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "[]", toc)
+	assert.Equal(t, 24, pages)
+
+	require.NoError(t, db.ClearBookStructure(book.ID))
+	_, pages, ok, err = db.GetBookStructure(book.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Zero(t, pages)
+}
+
+func TestUpdateBookFile(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	book := &models.Book{ID: "book-id", UserID: "user-1", Title: "Scan", Author: "Author", FilePath: "/scan.pdf", FileFormat: models.FileFormatPDF, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.SaveBookStructure(book.ID, "[]", 300))
+	require.NoError(t, db.SaveReadingPosition(&models.ReadingPosition{BookID: book.ID, UserID: "user-1", Chapter: "150"}))
+	require.NoError(t, db.SaveReadingPosition(&models.ReadingPosition{BookID: book.ID, UserID: "user-2", Chapter: "12"}))
+
+	book.Title = "The Retail Edition"
+	book.FilePath = "/retail.epub"
+	book.FileFormat = models.FileFormatEPUB
+	require.NoError(t, db.UpdateBookFile(book))
+
+	got, err := db.GetBook(book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "The Retail Edition", got.Title)
+	assert.Equal(t, "Retail Edition", got.SortTitle)
+	assert.Equal(t, "/retail.epub", got.FilePath)
+	assert.Equal(t, models.FileFormatEPUB, got.FileFormat)
+
+	_, _, ok, err := db.GetBookStructure(book.ID)
+	require.NoError(t, err)
+	assert.False(t, ok, "the old file's structure is cleared")
+
+	positions, err := db.GetReadingPositionsForBook(book.ID)
+	require.NoError(t, err)
+	assert.Len(t, positions, 2)
+}
+
+func TestBookFiles(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	book := &models.Book{ID: "book-id", UserID: "user-1", Title: "Book", Author: "Author", FilePath: "/book.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	pdfFile := &models.BookFile{ID: "file-1", BookID: book.ID, FileFormat: models.FileFormatPDF, FilePath: "/book.pdf", FileSize: 10, CreatedAt: time.Now().Add(-time.Minute)}
+	mobiFile := &models.BookFile{ID: "file-2", BookID: book.ID, FileFormat: models.FileFormatMOBI, FilePath: "/book.mobi", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateBookFile(pdfFile))
+	require.NoError(t, db.CreateBookFile(mobiFile))
+	assert.Error(t, db.CreateBookFile(&models.BookFile{ID: "file-3", BookID: book.ID, FileFormat: models.FileFormatPDF, FilePath: "/other.pdf", CreatedAt: time.Now()}),
+		"one file per format")
+
+	got, err := db.GetBookFile("file-1")
+	require.NoError(t, err)
+	assert.Equal(t, "/book.pdf", got.FilePath)
+	assert.Equal(t, int64(10), got.FileSize)
+
+	files, err := db.GetBookFiles(book.ID)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, models.FileFormatPDF, files[0].FileFormat)
+
+	byBook, err := db.GetBookFilesForBooks([]string{book.ID, "other"})
+	require.NoError(t, err)
+	assert.Len(t, byBook[book.ID], 2)
+	assert.Empty(t, byBook["other"])
+
+	require.NoError(t, db.DeleteBookFile("file-2"))
+	_, err = db.GetBookFile("file-2")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// Editions go with their book
+	require.NoError(t, db.DeleteBook(book.ID))
+	files, err = db.GetBookFiles(book.ID)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestFindEditionCandidates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	for _, b := range []*models.Book{
+		{ID: "epub", Title: "Dune", Author: "Frank Herbert", FileFormat: models.FileFormatEPUB},
+		{ID: "pdf", Title: "DUNE", Author: "frank herbert", FileFormat: models.FileFormatPDF},
+		{ID: "copy", Title: "Emma", Author: "Jane Austen", FileFormat: models.FileFormatEPUB},
+		{ID: "copy2", Title: "Emma", Author: "Jane Austen", FileFormat: models.FileFormatEPUB},
+	} {
+		b.UserID = "user-1"
+		b.FilePath = "/" + b.ID
+		b.UploadedAt = time.Now()
+		require.NoError(t, db.CreateBook(b))
+	}
+
+	groups, err := db.FindEditionCandidates("user-1")
+	require.NoError(t, err)
+	require.Len(t, groups, 1, "same-format copies aren't editions")
+	assert.Len(t, groups[0].Books, 2)
+	assert.True(t, strings.EqualFold("Dune", groups[0].Title))
+}
+
+func TestBookNotes(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	book := &models.Book{ID: "book-id", UserID: "user-1", Title: "Book", Author: "Author", FilePath: "/path.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	created := time.Now().Add(-time.Hour)
+	note := &models.BookNote{ID: "note-1", BookID: book.ID, UserID: "user-1", Title: "Draft", Body: "first", Revision: 1, CreatedAt: created, UpdatedAt: created}
+	require.NoError(t, db.CreateBookNote(note))
+
+	require.NoError(t, db.UpdateBookNote(note, "Final", "second", time.Now()))
+	assert.Equal(t, 2, note.Revision)
+
+	got, err := db.GetBookNote(note.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Final", got.Title)
+	assert.Equal(t, "second", got.Body)
+	assert.Equal(t, 2, got.Revision)
+
+	revisions, err := db.GetBookNoteRevisions(note.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "Draft", revisions[0].Title)
+	assert.Equal(t, "first", revisions[0].Body)
+	assert.WithinDuration(t, created, revisions[0].CreatedAt, time.Second, "a revision is dated when it was written")
+
+	notes, err := db.GetBookNotesForBook(book.ID, "user-1")
+	require.NoError(t, err)
+	assert.Len(t, notes, 1)
+
+	// Deleting the book removes its notes and their history
+	require.NoError(t, db.DeleteBook(book.ID))
+	_, err = db.GetBookNote(note.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	revisions, err = db.GetBookNoteRevisions(note.ID)
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+}
+
+func TestNotificationChannelsForEvent(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	now := time.Now()
+	webhook := &models.NotificationChannel{ID: "ch-1", UserID: user.ID, Type: models.NotificationChannelWebhook, Name: "Hook", Target: "https://example.com/hook", Token: "secret", Enabled: true, CreatedAt: now}
+	ntfy := &models.NotificationChannel{ID: "ch-2", UserID: user.ID, Type: models.NotificationChannelNtfy, Name: "Phone", Target: "https://ntfy.sh/topic", Enabled: false, CreatedAt: now.Add(time.Second)}
+	require.NoError(t, db.CreateNotificationChannel(webhook))
+	require.NoError(t, db.CreateNotificationChannel(ntfy))
+
+	retrieved, err := db.GetNotificationChannel(webhook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", retrieved.Token)
+	assert.True(t, retrieved.HasToken)
+
+	channels, err := db.ListNotificationChannels(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, channels, 2)
+
+	// Disabled channels are skipped and events default to subscribed
+	channels, err = db.GetNotificationChannelsForEvent(user.ID, models.NotificationEventBookShared)
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, webhook.ID, channels[0].ID)
+
+	// Unsubscribing from an event stops delivery for that event only
+	require.NoError(t, db.SetNotificationSubscription(user.ID, models.NotificationEventBookShared, false))
+	channels, err = db.GetNotificationChannelsForEvent(user.ID, models.NotificationEventBookShared)
+	require.NoError(t, err)
+	assert.Empty(t, channels)
+
+	channels, err = db.GetNotificationChannelsForEvent(user.ID, models.NotificationEventImportFinished)
+	require.NoError(t, err)
+	assert.Len(t, channels, 1)
+
+	subs, err := db.GetNotificationSubscriptions(user.ID)
+	require.NoError(t, err)
+	assert.Len(t, subs, len(models.NotificationEvents))
+	for _, sub := range subs {
+		assert.Equal(t, sub.EventType != models.NotificationEventBookShared, sub.Enabled, sub.EventType)
+	}
+}
+
+func TestCloseStaleReadingSessions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	book1 := &models.Book{ID: "book-1", UserID: user.ID, Title: "Book 1", Author: "Author", FilePath: "/path1.epub", UploadedAt: time.Now()}
+	book2 := &models.Book{ID: "book-2", UserID: user.ID, Title: "Book 2", Author: "Author", FilePath: "/path2.epub", UploadedAt: time.Now()}
+	book3 := &models.Book{ID: "book-3", UserID: user.ID, Title: "Book 3", Author: "Author", FilePath: "/path3.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book1))
+	require.NoError(t, db.CreateBook(book2))
+	require.NoError(t, db.CreateBook(book3))
+
+	now := time.Now()
+	start := now.Add(-24 * time.Hour)
+
+	// Abandoned session with reading activity 30 minutes after it started
+	stale := &models.ReadingSession{ID: "session-1", UserID: user.ID, BookID: book1.ID, StartTime: start, CreatedAt: start}
+	require.NoError(t, db.CreateReadingSession(stale))
+	require.NoError(t, db.SaveReadingPosition(&models.ReadingPosition{BookID: book1.ID, UserID: user.ID, Chapter: "ch1", Position: 0.5}))
+	_, err := db.db.Exec(`UPDATE reading_positions SET updated_at = ? WHERE book_id = ?`, start.Add(30*time.Minute), book1.ID)
+	require.NoError(t, err)
+
+	// Abandoned session with no activity
+	idle := &models.ReadingSession{ID: "session-2", UserID: user.ID, BookID: book2.ID, StartTime: start, CreatedAt: start}
+	require.NoError(t, db.CreateReadingSession(idle))
+
+	// Session still in progress
+	active := &models.ReadingSession{ID: "session-3", UserID: user.ID, BookID: book3.ID, StartTime: now, CreatedAt: now}
+	require.NoError(t, db.CreateReadingSession(active))
+
+	closed, err := db.CloseStaleReadingSessions(now.Add(-6 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, closed)
+
+	// Closed sessions no longer block new ones
+	_, err = db.GetActiveReadingSession(user.ID, book1.ID)
+	assert.Error(t, err)
+	_, err = db.GetActiveReadingSession(user.ID, book3.ID)
+	assert.NoError(t, err)
+
+	totalTime, _, sessions, err := db.GetReadingStatsForBook(user.ID, book1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sessions)
+	assert.Equal(t, 30*60, totalTime)
+
+	totalTime, _, sessions, err = db.GetReadingStatsForBook(user.ID, book2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sessions)
+	assert.Equal(t, 0, totalTime)
+
+	stats, err := db.GetOrCreateUserStatistics(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 30*60, stats.TotalTimeSeconds)
+}
+
+func TestBookReviews(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	owner := &models.User{ID: "owner-id", Username: "owner", Email: "owner@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	friend := &models.User{ID: "friend-id", Username: "friend", Email: "friend@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	stranger := &models.User{ID: "stranger-id", Username: "stranger", Email: "stranger@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(owner))
+	require.NoError(t, db.CreateUser(friend))
+	require.NoError(t, db.CreateUser(stranger))
+
+	book := &models.Book{ID: "book-1", UserID: owner.ID, Title: "Book 1", Author: "Author", FilePath: "/path1.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.ShareBook(book.ID, owner.ID, friend.ID))
+
+	now := time.Now()
+	readDate := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, r := range []*models.BookReview{
+		{ID: "review-1", BookID: book.ID, UserID: owner.ID, Rating: 4.5, Review: "Great", ReadDate: &readDate, CreatedAt: now, UpdatedAt: now},
+		{ID: "review-2", BookID: book.ID, UserID: friend.ID, Rating: 3, Spoiler: true, CreatedAt: now, UpdatedAt: now},
+		{ID: "review-3", BookID: book.ID, UserID: stranger.ID, Rating: 1, CreatedAt: now, UpdatedAt: now},
+	} {
+		require.NoError(t, db.SaveBookReview(r))
+	}
+
+	// Saving again updates the existing review
+	updated := &models.BookReview{ID: "review-1", BookID: book.ID, UserID: owner.ID, Rating: 5, Review: "Even better", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, db.SaveBookReview(updated))
+
+	review, err := db.GetBookReview(book.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, review.Rating)
+	assert.Equal(t, "Even better", review.Review)
+
+	mine, err := db.ListReviewsByUser(friend.ID)
+	require.NoError(t, err)
+	require.Len(t, mine, 1)
+	assert.True(t, mine[0].Spoiler)
+	assert.Equal(t, "Book 1", mine[0].BookTitle)
+
+	// Only the owner and users the book is shared with are included
+	household, err := db.ListHouseholdReviews(book.ID)
+	require.NoError(t, err)
+	assert.Len(t, household, 2)
+	for _, r := range household {
+		assert.NotEqual(t, stranger.ID, r.UserID)
+	}
+
+	require.NoError(t, db.DeleteBookReview(book.ID, friend.ID))
+	_, err = db.GetBookReview(book.ID, friend.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestUserBookStateIsPerUser(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	owner := &models.User{ID: "owner-id", Username: "owner", Email: "owner@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	friend := &models.User{ID: "friend-id", Username: "friend", Email: "friend@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(owner))
+	require.NoError(t, db.CreateUser(friend))
+
+	book := &models.Book{ID: "book-1", UserID: owner.ID, Title: "Book 1", Author: "Author", FilePath: "/path1.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.ShareBook(book.ID, owner.ID, friend.ID))
+
+	now := time.Now()
+	require.NoError(t, db.UpdateBookReadStatus(friend.ID, book.ID, models.ReadStatusCompleted, &now))
+	require.NoError(t, db.UpdateBookRating(friend.ID, book.ID, 4))
+
+	// The friend's state doesn't leak to the owner
+	ownerView, err := db.GetBookForUser(book.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusUnread, ownerView.ReadStatus)
+	assert.Equal(t, 0, ownerView.Rating)
+
+	friendView, err := db.GetBookForUser(book.ID, friend.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusCompleted, friendView.ReadStatus)
+	assert.Equal(t, 4, friendView.Rating)
+	assert.NotNil(t, friendView.DateCompleted)
+
+	// Setting the rating keeps the read status
+	status, _, err := db.GetBookReadStatus(friend.ID, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusCompleted, status)
+
+	counts, err := db.GetReadStatusCounts(owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, counts.Unread)
+	assert.Equal(t, 0, counts.Completed)
+
+	completed, err := db.GetCompletedBooksCount(friend.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, completed)
+}
+
+func TestUserBookStateMigratesLegacyColumns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	owner := &models.User{ID: "owner-id", Username: "owner", Email: "owner@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(owner))
+
+	book := &models.Book{ID: "book-1", UserID: owner.ID, Title: "Book 1", Author: "Author", FilePath: "/path1.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	// Simulate state written to the books row by an older version, from
+	// before the baseline migration
+	_, err := db.db.Exec(`UPDATE books SET read_status = 'reading', rating = 3 WHERE id = ?`, book.ID)
+	require.NoError(t, err)
+	_, err = db.db.Exec(`DELETE FROM schema_migrations WHERE version = 1`)
+	require.NoError(t, err)
+	require.NoError(t, db.migrate())
+
+	got, err := db.GetBookForUser(book.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusReading, got.ReadStatus)
+	assert.Equal(t, 3, got.Rating)
+
+	// Running the migration again doesn't overwrite newer per-user state
+	require.NoError(t, db.UpdateBookReadStatus(owner.ID, book.ID, models.ReadStatusUnread, nil))
+	_, err = db.db.Exec(`DELETE FROM schema_migrations WHERE version = 1`)
+	require.NoError(t, err)
+	require.NoError(t, db.migrate())
+	status, _, err := db.GetBookReadStatus(owner.ID, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadStatusUnread, status)
+}
+
+func TestFindBooksByISBN(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "other-user")
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	book := &models.Book{ID: "book-1", UserID: user.ID, Title: "Book 1", Author: "Author", FilePath: "/path1.epub", ISBN: "978-0-306-40615-7", UploadedAt: time.Now()}
+	other := &models.Book{ID: "book-2", UserID: "other-user", Title: "Book 2", Author: "Author", FilePath: "/path2.epub", ISBN: "9780306406157", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.CreateBook(other))
+
+	books, err := db.FindBooksByISBN(user.ID, "9780306406157", "0306406152")
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, book.ID, books[0].ID)
+
+	books, err = db.FindBooksByISBN(user.ID, "9781861972712")
+	require.NoError(t, err)
+	assert.Empty(t, books)
+}
+
+func TestSearchCatalog(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	books := []*models.Book{
+		{ID: "book-1", UserID: user.ID, Title: "The Dragon Road", Author: "Author", FilePath: "/path1.epub", UploadedAt: time.Now()},
+		{ID: "book-2", UserID: user.ID, Title: "Another Tale", Author: "Author", FilePath: "/path2.epub", Subjects: "Fantasy, Dragons", UploadedAt: time.Now()},
+		{ID: "book-3", UserID: user.ID, Title: "Quiet Waters", Author: "Author", FilePath: "/path3.epub", Description: "A dragon sleeps beneath the lake.", UploadedAt: time.Now()},
+		{ID: "book-4", UserID: user.ID, Title: "Dragon Field Guide", Author: "Author", ContentSource: models.ContentSourcePhysical, UploadedAt: time.Now()},
+		{ID: "book-5", UserID: user.ID, Title: "Unrelated", Author: "Author", FilePath: "/path5.epub", UploadedAt: time.Now()},
+	}
+	for _, book := range books {
+		require.NoError(t, db.CreateBook(book))
+	}
+
+	// Subjects and descriptions match; physical books are left out
+	got, total, err := db.SearchCatalog(user.ID, "dragon", 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, got, 3)
+	assert.Equal(t, "book-2", got[0].ID, "ordered by sort title")
+	assert.Equal(t, "book-1", got[1].ID)
+	assert.Equal(t, "book-3", got[2].ID)
+	assert.Equal(t, "A dragon sleeps beneath the lake.", got[2].Description)
+
+	got, total, err = db.SearchCatalog(user.ID, "dragon", 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+	require.Len(t, got, 1)
+	assert.Equal(t, "book-3", got[0].ID)
+
+	got, total, err = db.SearchCatalog("", "dragon", 0, 10)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, got)
+}
+
+func TestPhysicalBooks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	digital := &models.Book{ID: "book-1", UserID: user.ID, Title: "Digital", Author: "Author", FilePath: "/path1.epub", UploadedAt: time.Now()}
+	paper := &models.Book{ID: "book-2", UserID: user.ID, Title: "Paper", Author: "Author", ContentSource: models.ContentSourcePhysical, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(digital))
+	require.NoError(t, db.CreateBook(paper))
+
+	got, err := db.GetBook(paper.ID)
+	require.NoError(t, err)
+	assert.True(t, got.IsPhysical())
+	assert.Empty(t, got.FileFormat)
+
+	got, err = db.GetBook(digital.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ContentSourceDigital, got.ContentSource)
+	assert.Equal(t, "epub", got.FileFormat)
+
+	// Physical books are listed alongside digital ones
+	books, err := db.ListBooksForUserWithFilters(user.ID, "title", "asc", "", "")
+	require.NoError(t, err)
+	assert.Len(t, books, 2)
+
+	// ...but have no file to hash
+	books, err = db.GetBooksWithoutHash(user.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, digital.ID, books[0].ID)
+	ids, err := db.ListBookIDsWithoutHash(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{digital.ID}, ids)
+}
+
+func TestBookLoans(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	lender := &models.User{ID: "lender-id", Username: "lender", Email: "lender@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	borrower := &models.User{ID: "borrower-id", Username: "borrower", Email: "borrower@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(lender))
+	require.NoError(t, db.CreateUser(borrower))
+
+	book := &models.Book{ID: "book-1", UserID: lender.ID, Title: "Paper", Author: "Author", ContentSource: models.ContentSourcePhysical, UploadedAt: time.Now()}
+	other := &models.Book{ID: "book-2", UserID: lender.ID, Title: "Other", Author: "Author", ContentSource: models.ContentSourcePhysical, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.CreateBook(other))
+
+	past := time.Now().Add(-48 * time.Hour)
+	future := time.Now().Add(48 * time.Hour)
+	overdue := &models.BookLoan{ID: "loan-1", BookID: book.ID, UserID: lender.ID, BorrowerName: "borrower", BorrowerUserID: borrower.ID, LentAt: past.Add(-time.Hour), DueDate: &past}
+	current := &models.BookLoan{ID: "loan-2", BookID: other.ID, UserID: lender.ID, BorrowerName: "Sam", LentAt: time.Now(), DueDate: &future}
+	require.NoError(t, db.CreateBookLoan(overdue))
+	require.NoError(t, db.CreateBookLoan(current))
+
+	loans, err := db.ListBookLoans(lender.ID, false)
+	require.NoError(t, err)
+	require.Len(t, loans, 2)
+	assert.Equal(t, overdue.ID, loans[0].ID, "soonest due first")
+	assert.True(t, loans[0].Overdue)
+	assert.False(t, loans[1].Overdue)
+	assert.Equal(t, "Paper", loans[0].BookTitle)
+
+	active, err := db.GetActiveBookLoan(lender.ID, book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, overdue.ID, active.ID)
+
+	borrowed, err := db.ListBorrowedBooks(borrower.ID)
+	require.NoError(t, err)
+	require.Len(t, borrowed, 1)
+	assert.Equal(t, overdue.ID, borrowed[0].ID)
+
+	// Only loans past due get a reminder, and only once
+	due, err := db.ListOverdueLoansToRemind(time.Now())
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, overdue.ID, due[0].ID)
+
+	require.NoError(t, db.MarkBookLoanReminded(overdue.ID, time.Now()))
+	due, err = db.ListOverdueLoansToRemind(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	// Returned loans drop out of the active list
+	require.NoError(t, db.MarkBookLoanReturned(overdue.ID, time.Now()))
+	_, err = db.GetActiveBookLoan(lender.ID, book.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	loans, err = db.ListBookLoans(lender.ID, false)
+	require.NoError(t, err)
+	require.Len(t, loans, 1)
+	assert.Equal(t, current.ID, loans[0].ID)
+
+	loans, err = db.ListBookLoans(lender.ID, true)
+	require.NoError(t, err)
+	require.Len(t, loans, 2)
+	assert.Equal(t, overdue.ID, loans[1].ID, "returned loans last")
+	assert.False(t, loans[1].Overdue)
+
+	require.NoError(t, db.DeleteBookLoan(current.ID))
+	_, err = db.GetBookLoan(current.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestReaderPreferences(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	// Defaults before anything is saved
+	prefs, err := db.GetReaderPreferences(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultReaderPreferences(user.ID), prefs)
+
+	prefs.Theme = models.ReaderThemeNight
+	prefs.FontSize = 22
+	prefs.PageTurnMode = models.PageTurnContinuous
+	prefs.UpdatedAt = time.Now()
+	require.NoError(t, db.SaveReaderPreferences(prefs))
+
+	prefs.ComicFitMode = models.ComicFitWidth
+	require.NoError(t, db.SaveReaderPreferences(prefs))
+
+	got, err := db.GetReaderPreferences(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReaderThemeNight, got.Theme)
+	assert.Equal(t, 22, got.FontSize)
+	assert.Equal(t, 1.8, got.LineHeight)
+	assert.Equal(t, models.PageTurnContinuous, got.PageTurnMode)
+	assert.Equal(t, models.ComicFitWidth, got.ComicFitMode)
+}
+
+func TestLibraryPreferences(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-id")
+
+	prefs, err := db.GetLibraryPreferences("user-id")
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultLibraryPreferences("user-id"), prefs)
+
+	prefs.SortLocale = "de"
+	prefs.IgnoreArticles = false
+	prefs.UpdatedAt = time.Now()
+	require.NoError(t, db.SaveLibraryPreferences(prefs))
+
+	got, err := db.GetLibraryPreferences("user-id")
+	require.NoError(t, err)
+	assert.Equal(t, "de", got.SortLocale)
+	assert.False(t, got.IgnoreArticles)
+
+	got.SubjectTags = true
+	got.SubjectTagMap = map[string]string{"sci-fi": "Science Fiction", "fiction": ""}
+	require.NoError(t, db.SaveLibraryPreferences(got))
+	got, err = db.GetLibraryPreferences("user-id")
+	require.NoError(t, err)
+	assert.True(t, got.SubjectTags)
+	assert.Equal(t, map[string]string{"sci-fi": "Science Fiction", "fiction": ""}, got.SubjectTagMap)
+
+	got.SubjectTagMap = map[string]string{}
+	require.NoError(t, db.SaveLibraryPreferences(got))
+	got, err = db.GetLibraryPreferences("user-id")
+	require.NoError(t, err)
+	assert.Empty(t, got.SubjectTagMap, "saving replaces the map")
+}
+
+func TestSyncSubjectTags(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-id")
+
+	book := &models.Book{ID: "book-1", UserID: "user-id", Title: "Dune", FilePath: "/dune.epub", FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.CreateTag(&models.Tag{ID: "tag-scifi", UserID: "user-id", Name: "Science Fiction", CreatedAt: time.Now()}))
+	require.NoError(t, db.CreateTag(&models.Tag{ID: "tag-fav", UserID: "user-id", Name: "Favorites", CreatedAt: time.Now()}))
+
+	tagNames := func() []string {
+		tags, err := db.GetBookTags(book.ID, "user-id")
+		require.NoError(t, err)
+		var names []string
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		return names
+	}
+
+	require.NoError(t, db.AddTagToBook(book.ID, "tag-fav"))
+	require.NoError(t, db.SyncSubjectTags(book.ID, "user-id", []string{"science fiction", "Ecology"}))
+	assert.Equal(t, []string{"Ecology", "Favorites", "Science Fiction"}, tagNames(), "existing tags match ignoring case")
+
+	// Adding a subject tag by hand keeps it when its subject goes away
+	require.NoError(t, db.AddTagToBook(book.ID, "tag-scifi"))
+	require.NoError(t, db.SyncSubjectTags(book.ID, "user-id", []string{"Desert"}))
+	assert.Equal(t, []string{"Desert", "Favorites", "Science Fiction"}, tagNames())
+
+	require.NoError(t, db.SyncSubjectTags(book.ID, "user-id", nil))
+	assert.Equal(t, []string{"Favorites", "Science Fiction"}, tagNames())
+}
+
+func TestReadingDirection(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-id")
+
+	book := &models.Book{ID: "book-1", UserID: "user-id", Title: "Comic", Series: "Manga Series", FilePath: "/path1.cbz", FileFormat: models.FileFormatCBZ, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+
+	got, err := db.GetBook(book.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadingDirectionLTR, got.ReadingDirection, "defaults to left-to-right")
+
+	require.NoError(t, db.UpdateBookReadingDirection(book.ID, models.ReadingDirectionRTL))
+	got, err = db.GetBookForUser(book.ID, "user-id")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadingDirectionRTL, got.ReadingDirection)
+
+	direction, err := db.GetSeriesReadingDirection("user-id", "Manga Series")
+	require.NoError(t, err)
+	assert.Empty(t, direction)
+
+	require.NoError(t, db.SaveSeriesReadingDirection(&models.SeriesReadingDirection{
+		UserID: "user-id", Series: "Manga Series", ReadingDirection: models.ReadingDirectionRTL, UpdatedAt: time.Now(),
+	}))
+	direction, err = db.GetSeriesReadingDirection("user-id", "manga series")
+	require.NoError(t, err)
+	assert.Equal(t, models.ReadingDirectionRTL, direction, "series names match case-insensitively")
+
+	list, err := db.ListSeriesReadingDirections("user-id")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "Manga Series", list[0].Series)
+
+	require.NoError(t, db.DeleteSeriesReadingDirection("user-id", "Manga Series"))
+	assert.ErrorIs(t, db.DeleteSeriesReadingDirection("user-id", "Manga Series"), sql.ErrNoRows)
+}
+
+func TestListBooksIncludesLanguage(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-id")
+
+	book := &models.Book{ID: "book-1", UserID: "user-id", Title: "Der Process", FilePath: "/path.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.UpdateBookLanguage(book.ID, "de"))
+
+	books, err := db.ListBooksForUser("user-id", "title", "asc")
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "de", books[0].Language)
+
+	books, err = db.SearchBooksForUser("Process", "user-id")
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "de", books[0].Language)
+}
+
+func TestStyleOverrides(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := &models.User{ID: "user-id", Username: "user", Email: "user@example.com", PasswordHash: "hash", CreatedAt: time.Now()}
+	require.NoError(t, db.CreateUser(user))
+
+	_, err := db.GetStyleOverride(user.ID, "")
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// Saved book-first to check the global override still comes first
+	require.NoError(t, db.SaveStyleOverride(&models.StyleOverride{UserID: user.ID, BookID: "book-1", CSS: "p { margin: 0; }", UpdatedAt: time.Now()}))
+	require.NoError(t, db.SaveStyleOverride(&models.StyleOverride{UserID: user.ID, CSS: "body { color: red; }", UpdatedAt: time.Now()}))
+	require.NoError(t, db.SaveStyleOverride(&models.StyleOverride{UserID: user.ID, CSS: "body { color: blue; }", UpdatedAt: time.Now()}))
+
+	global, err := db.GetStyleOverride(user.ID, "")
+	require.NoError(t, err)
+	assert.Equal(t, "body { color: blue; }", global.CSS)
+
+	sheets, err := db.GetStyleOverridesForBook(user.ID, "book-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"body { color: blue; }", "p { margin: 0; }"}, sheets)
+
+	sheets, err = db.GetStyleOverridesForBook(user.ID, "book-2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"body { color: blue; }"}, sheets)
+
+	require.NoError(t, db.DeleteStyleOverride(user.ID, ""))
+	sheets, err = db.GetStyleOverridesForBook(user.ID, "book-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p { margin: 0; }"}, sheets)
+}
+
+func TestLibraryRevisions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	rev, err := db.GetLibraryRevision("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rev)
+
+	// Duplicate IDs are only bumped once
+	require.NoError(t, db.BumpLibraryRevisions("user-1", "", "user-1"))
+	require.NoError(t, db.BumpLibraryRevisions("user-1"))
+
+	rev, err = db.GetLibraryRevision("user-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), rev)
+
+	rev, err = db.GetLibraryRevision("")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rev)
+
+	rev, err = db.GetLibraryRevision("user-2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rev)
+}
+
+func TestBookClubs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "owner", "friend", "member")
+
+	book := &models.Book{ID: "book-1", UserID: "owner", Title: "Middlemarch", FilePath: "/m.epub", FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.ShareBook(book.ID, "owner", "friend"))
+
+	newClub := func(id string) *models.BookClub {
+		club := &models.BookClub{ID: id, OwnerID: "owner", BookID: book.ID, Name: id, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		require.NoError(t, db.CreateBookClub(club))
+		return club
+	}
+	club := newClub("club-1")
+	require.NoError(t, db.AddBookClubMember(club, "friend"))
+	require.NoError(t, db.AddBookClubMember(club, "member"))
+
+	got, err := db.GetBookClub(club.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.MemberCount, "the owner is a member")
+	assert.Equal(t, "Middlemarch", got.BookTitle)
+
+	clubs, err := db.ListBookClubsForUser("member")
+	require.NoError(t, err)
+	require.Len(t, clubs, 1)
+
+	_, err = db.GetBookForUser(book.ID, "member")
+	require.NoError(t, err, "joining shares the book")
+
+	// Leaving only unshares what the club shared
+	for _, userID := range []string{"friend", "member"} {
+		m, err := db.GetBookClubMember(club.ID, userID)
+		require.NoError(t, err)
+		require.NoError(t, db.RemoveBookClubMember(club, m))
+	}
+	_, err = db.GetBookForUser(book.ID, "friend")
+	assert.NoError(t, err, "shared before joining")
+	_, err = db.GetBookForUser(book.ID, "member")
+	assert.Error(t, err)
+
+	// Another club for the same book takes the share over
+	require.NoError(t, db.AddBookClubMember(club, "member"))
+	other := newClub("club-2")
+	require.NoError(t, db.AddBookClubMember(other, "member"))
+	require.NoError(t, db.DeleteBookClub(club))
+	_, err = db.GetBookForUser(book.ID, "member")
+	require.NoError(t, err, "still in club-2")
+	m, err := db.GetBookClubMember(other.ID, "member")
+	require.NoError(t, err)
+	assert.True(t, m.SharedBook)
+	require.NoError(t, db.DeleteBookClub(other))
+	_, err = db.GetBookForUser(book.ID, "member")
+	assert.Error(t, err)
+	_, err = db.GetBookClub(club.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	// Schedule and threaded comments
+	club = newClub("club-3")
+	require.NoError(t, db.SetBookClubSchedule(club.ID, []*models.BookClubScheduleEntry{
+		{Chapter: 7, DueDate: time.Now().AddDate(0, 0, 14)},
+		{Chapter: 3, Title: "Book One", DueDate: time.Now().AddDate(0, 0, 7)},
+	}))
+	schedule, err := db.GetBookClubSchedule(club.ID)
+	require.NoError(t, err)
+	require.Len(t, schedule, 2)
+	assert.Equal(t, 3, schedule[0].Chapter)
+	assert.Equal(t, "Book One", schedule[0].Title)
+
+	now := time.Now()
+	require.NoError(t, db.CreateBookClubComment(&models.BookClubComment{ID: "c1", ClubID: club.ID, UserID: "owner", Chapter: 3, Body: "Dorothea!", CreatedAt: now, UpdatedAt: now}))
+	require.NoError(t, db.CreateBookClubComment(&models.BookClubComment{ID: "c2", ClubID: club.ID, UserID: "owner", Chapter: 3, ParentID: "c1", Body: "Reply", CreatedAt: now.Add(time.Second), UpdatedAt: now}))
+	require.NoError(t, db.CreateBookClubComment(&models.BookClubComment{ID: "c3", ClubID: club.ID, UserID: "owner", Chapter: 1, Body: "Earlier", CreatedAt: now, UpdatedAt: now}))
+
+	comments, err := db.ListBookClubComments(club.ID, -1)
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	assert.Equal(t, "c3", comments[0].ID, "ordered by chapter")
+	assert.Equal(t, "c1", comments[2].ParentID)
+	assert.Equal(t, "owner", comments[0].Username)
+
+	require.NoError(t, db.DeleteBookClubComment("c1"))
+	comments, err = db.ListBookClubComments(club.ID, 3)
+	require.NoError(t, err)
+	assert.Empty(t, comments, "replies go with their parent")
+}
+
+func TestActivityFeed(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "owner", "friend", "stranger")
+
+	book := &models.Book{ID: "book-1", UserID: "owner", Title: "Kindred", FilePath: "/k.epub", FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.ShareBook(book.ID, "owner", "friend"))
+
+	prefs, err := db.GetActivityPreferences("friend")
+	require.NoError(t, err)
+	assert.False(t, prefs.Publishes(models.ActivityBookFinished), "nothing is published by default")
+
+	for _, userID := range []string{"owner", "friend", "stranger"} {
+		require.NoError(t, db.SaveActivityPreferences(&models.ActivityPreferences{
+			UserID: userID, PublishAdded: true, PublishFinished: true, PublishRated: true, UpdatedAt: time.Now(),
+		}))
+	}
+
+	record := func(id, userID, eventType string, rating int, at time.Time) {
+		require.NoError(t, db.RecordActivity(&models.ActivityEvent{
+			ID: id, UserID: userID, Type: eventType, BookID: book.ID, Rating: rating, CreatedAt: at,
+		}))
+	}
+	start := time.Now().Add(-time.Hour)
+	record("e1", "owner", models.ActivityBookAdded, 0, start)
+	record("e2", "friend", models.ActivityBookFinished, 0, start.Add(time.Minute))
+	record("e3", "friend", models.ActivityBookRated, 3, start.Add(2*time.Minute))
+	record("e4", "stranger", models.ActivityBookRated, 5, start.Add(3*time.Minute))
+
+	// Changing a rating replaces the earlier event
+	record("e5", "friend", models.ActivityBookRated, 4, start.Add(4*time.Minute))
+
+	events, err := db.ListActivityFeed("owner", 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3, "strangers' activity is left out")
+	assert.Equal(t, "e5", events[0].ID)
+	assert.Equal(t, 4, events[0].Rating)
+	assert.Equal(t, "friend", events[0].Username)
+	assert.Equal(t, "Kindred", events[0].BookTitle)
+
+	events, err = db.ListActivityFeed("friend", 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 3, "shares count in both directions")
+
+	// Turning a type off hides what was already published
+	prefs, err = db.GetActivityPreferences("friend")
+	require.NoError(t, err)
+	prefs.PublishRated = false
+	require.NoError(t, db.SaveActivityPreferences(prefs))
+	events, err = db.ListActivityFeed("owner", 10)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	require.NoError(t, db.DeleteActivity("friend", models.ActivityBookFinished, book.ID))
+	events, err = db.ListActivityFeed("owner", 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, models.ActivityBookAdded, events[0].Type)
+}
+
+func TestComicSeries(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "reader", "friend")
+
+	comic := func(id, userID, series string, index float64) {
+		require.NoError(t, db.CreateBook(&models.Book{
+			ID: id, UserID: userID, Title: id, Series: series, SeriesIndex: index,
+			FilePath: "/" + id + ".cbz", FileFormat: models.FileFormatCBZ, ContentType: models.ContentTypeComic, UploadedAt: time.Now(),
+		}))
+	}
+	comic("saga-1", "reader", "Saga", 1)
+	comic("saga-2", "reader", "saga", 2)
+	comic("shared-1", "friend", "Monstress", 1)
+	comic("private-1", "friend", "Paper Girls", 1)
+	require.NoError(t, db.ShareBook("shared-1", "friend", "reader"))
+
+	require.NoError(t, db.EnsureComicSeries("reader"))
+	require.NoError(t, db.EnsureComicSeries("reader"))
+	series, err := db.ListComicSeries("reader")
+	require.NoError(t, err)
+	require.Len(t, series, 2, "one series per name ignoring case, including shared comics")
+	assert.Equal(t, "Monstress", series[0].Name)
+
+	saga, err := db.GetComicSeriesByName("reader", "SAGA")
+	require.NoError(t, err)
+	books, err := db.ListComicSeriesBooks("reader", saga.Name)
+	require.NoError(t, err)
+	assert.Len(t, books, 2)
+
+	require.NoError(t, db.MarkComicIssueRead(saga.ID, "3", time.Now()))
+	reads, err := db.ListComicIssueReads(saga.ID)
+	require.NoError(t, err)
+	assert.Contains(t, reads, "3")
+	require.NoError(t, db.UnmarkComicIssueRead(saga.ID, "3"))
+	reads, err = db.ListComicIssueReads(saga.ID)
+	require.NoError(t, err)
+	assert.Empty(t, reads)
+
+	order := &models.ReadingOrder{ID: "order-1", UserID: "reader", Name: "Crossover", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, db.CreateReadingOrder(order))
+	require.NoError(t, db.SetReadingOrderEntries(order.ID, []*models.ReadingOrderEntry{
+		{SeriesID: saga.ID, IssueNumber: "2"},
+		{SeriesID: series[0].ID, IssueNumber: "1"},
+		{SeriesID: saga.ID, IssueNumber: "1"},
+	}))
+	entries, err := db.ListReadingOrderEntries(order.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "Monstress", entries[1].SeriesName)
+	assert.Equal(t, 3, entries[2].Position)
+
+	// Deleting a series drops its entries but keeps its comics
+	require.NoError(t, db.DeleteComicSeries(saga.ID))
+	got, err := db.GetReadingOrder(order.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.EntryCount)
+	_, err = db.GetBook("saga-1")
+	assert.NoError(t, err)
+}
+
+func TestBookVisibilityAndClaim(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "owner", "friend", "stranger")
+
+	for _, book := range []*models.Book{
+		{ID: "orphan-1", Title: "Dune", FilePath: "/d.epub"},
+		{ID: "orphan-2", Title: "Emma", FilePath: "/e.epub"},
+		{ID: "private", UserID: "owner", Title: "Beloved", FilePath: "/b.epub"},
+		{ID: "public", UserID: "owner", Title: "Carrie", FilePath: "/c.epub", Visibility: models.BookVisibilityPublic},
+	} {
+		book.UploadedAt = time.Now()
+		require.NoError(t, db.CreateBook(book))
+	}
+	require.NoError(t, db.ShareBook("private", "owner", "friend"))
+
+	got, err := db.GetBook("private")
+	require.NoError(t, err)
+	assert.Equal(t, models.BookVisibilityPrivate, got.Visibility, "books are private by default")
+
+	// Public books are listed with the ownerless ones and readable by anyone
+	anon, err := db.ListBooksForUser("", "title", "asc")
+	require.NoError(t, err)
+	var titles []string
+	for _, b := range anon {
+		titles = append(titles, b.Title)
+	}
+	assert.Equal(t, []string{"Carrie", "Dune", "Emma"}, titles)
+	_, err = db.GetBookForUser("public", "stranger")
+	assert.NoError(t, err)
+	_, err = db.GetBookForUser("private", "stranger")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	members, err := db.ListHouseholdMemberIDs("friend")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"owner"}, members)
+
+	// Claiming moves the anonymous read status with the book
+	require.NoError(t, db.UpdateBookReadStatus("", "orphan-1", models.ReadStatusCompleted, nil))
+	claimed, err := db.ClaimOrphanBooks("owner", models.BookVisibilityPrivate, []string{"orphan-1", "private", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orphan-1"}, claimed, "owned and missing books are skipped")
+
+	got, err = db.GetBook("orphan-1")
+	require.NoError(t, err)
+	assert.Equal(t, "owner", got.UserID)
+	assert.Equal(t, models.ReadStatusCompleted, got.ReadStatus)
+
+	claimed, err = db.ClaimOrphanBooks("friend", models.BookVisibilityPublic, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orphan-2"}, claimed)
+
+	orphans, err := db.ListOrphanBooks()
+	require.NoError(t, err)
+	assert.Empty(t, orphans)
+}
+
+func TestClaimAnonymousLibrary(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "owner")
+
+	for _, book := range []*models.Book{
+		{ID: "orphan", Title: "Dune", FilePath: "/d.epub"},
+		{ID: "owned", UserID: "owner", Title: "Emma", FilePath: "/e.epub", Visibility: models.BookVisibilityPublic},
+	} {
+		book.UploadedAt = time.Now()
+		require.NoError(t, db.CreateBook(book))
+	}
+	for _, pos := range []*models.ReadingPosition{
+		{BookID: "orphan", Chapter: "anon", Position: 0.5},
+		{BookID: "owned", Chapter: "anon", Position: 0.9},
+		{BookID: "owned", UserID: "owner", Chapter: "mine", Position: 0.1},
+	} {
+		require.NoError(t, db.SaveReadingPosition(pos))
+	}
+	_, err := db.db.Exec(`INSERT INTO collections (id, user_id, name) VALUES ('shelf', '', 'Shelf')`)
+	require.NoError(t, err)
+
+	claim, err := db.ClaimAnonymousLibrary("owner", models.BookVisibilityPrivate)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orphan"}, claim.BookIDs)
+	assert.Equal(t, 1, claim.Positions, "the owner's own position is kept")
+	assert.Equal(t, 1, claim.Collections)
+
+	pos, err := db.GetReadingPosition("owned", "owner")
+	require.NoError(t, err)
+	assert.Equal(t, "mine", pos.Chapter)
+	pos, err = db.GetReadingPosition("orphan", "owner")
+	require.NoError(t, err)
+	assert.Equal(t, "anon", pos.Chapter)
+	_, err = db.GetReadingPosition("owned", "")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "anonymous positions are gone")
+
+	count, err := db.CountUsers()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestStatsInUserTimezone(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user")
+	require.NoError(t, db.CreateBook(&models.Book{ID: "book", UserID: "user", Title: "Book", FilePath: "/b.epub", UploadedAt: time.Now()}))
+
+	prefs, err := db.GetStatsPreferences("user")
+	require.NoError(t, err)
+	assert.Equal(t, time.Local, prefs.Location(), "the server's timezone by default")
+
+	// Late evening in Los Angeles on consecutive days, both on January 2nd in UTC
+	la, err := time.LoadLocation("America/Los_Angeles")
+	require.NoError(t, err)
+	for i, start := range []time.Time{
+		time.Date(2026, 1, 1, 17, 0, 0, 0, la),
+		time.Date(2026, 1, 2, 15, 0, 0, 0, la),
+	} {
+		end := start.Add(30 * time.Minute)
+		require.NoError(t, db.CreateReadingSession(&models.ReadingSession{
+			ID: fmt.Sprintf("session-%d", i), UserID: "user", BookID: "book", StartTime: start.UTC(), EndTime: &end, CreatedAt: start,
+		}))
+	}
+
+	require.NoError(t, db.SaveStatsPreferences(&models.StatsPreferences{UserID: "user", Timezone: "UTC", UpdatedAt: time.Now()}))
+	_, longest, err := db.CalculateStreak("user")
+	require.NoError(t, err)
+	assert.Equal(t, 1, longest)
+
+	require.NoError(t, db.SaveStatsPreferences(&models.StatsPreferences{UserID: "user", Timezone: "America/Los_Angeles", UpdatedAt: time.Now()}))
+	_, longest, err = db.CalculateStreak("user")
+	require.NoError(t, err)
+	assert.Equal(t, 2, longest)
+
+	// Daily stats are bucketed on the user's date too
+	require.NoError(t, db.UpdateDailyStats("user", time.Date(2026, 1, 2, 1, 0, 0, 0, time.UTC), 10, 1, 600, "book"))
+	daily, err := db.GetDailyReadingStats("user", time.Date(2025, 12, 31, 0, 0, 0, 0, la), time.Date(2026, 1, 3, 0, 0, 0, 0, la))
+	require.NoError(t, err)
+	require.Len(t, daily, 1)
+	assert.Equal(t, "2026-01-01", daily[0].ReadingDate.Format("2006-01-02"))
+	assert.Equal(t, 10, daily[0].PagesRead)
+}
+
+func TestSearchBooksForUserRanksFuzzyMatches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-id")
+
+	for _, b := range []models.Book{
+		{ID: "silmarillion", Title: "The Silmarillion", Author: "J.R.R. Tolkien"},
+		{ID: "about", Title: "Tolkien: A Biography", Author: "Humphrey Carpenter"},
+		{ID: "essays", Title: "Essays", Author: "Various", Subjects: "Tolkien, Criticism"},
+		{ID: "dune", Title: "Dune", Author: "Frank Herbert"},
+	} {
+		b.UserID, b.FilePath, b.UploadedAt = "user-id", "/"+b.ID+".epub", time.Now()
+		require.NoError(t, db.CreateBook(&b))
+	}
+
+	ids := func(books []models.Book) []string {
+		var out []string
+		for _, b := range books {
+			out = append(out, b.ID)
+		}
+		return out
+	}
+
+	books, err := db.SearchBooksForUser("tolkein", "user-id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"about", "silmarillion", "essays"}, ids(books), "titles first, subjects last")
+
+	books, err = db.SearchBooksForUser("Tolkien", "other-user")
+	require.NoError(t, err)
+	assert.Empty(t, books)
+}
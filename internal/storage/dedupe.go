@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ==================== File Reference Methods ====================
+
+// CountFileReferences returns how many books and extra editions use the
+// file at path
+func (d *Database) CountFileReferences(path string) (int, error) {
+	var count int
+	err := d.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM books WHERE file_path = ?)
+			+ (SELECT COUNT(*) FROM book_files WHERE file_path = ?)`, path, path,
+	).Scan(&count)
+	return count, err
+}
+
+// ReferencedFilePaths returns the paths of every book file and extra
+// edition
+func (d *Database) ReferencedFilePaths() (map[string]bool, error) {
+	rows, err := d.db.Query(`
+		SELECT file_path FROM books WHERE file_path != ''
+		UNION SELECT file_path FROM book_files`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths[path] = true
+	}
+	return paths, rows.Err()
+}
+
+// StoredFile is a book's main file or one of its extra editions, as the
+// content-addressed store migration sees it
+type StoredFile struct {
+	BookID string
+	FileID string // Empty for a book's main file
+	Path   string
+	Hash   string
+}
+
+// ListStoredFiles returns every book file and extra edition on disk
+func (d *Database) ListStoredFiles() ([]StoredFile, error) {
+	rows, err := d.db.Query(`
+		SELECT id, '', file_path, COALESCE(file_hash, '') FROM books WHERE file_path != ''
+		UNION ALL
+		SELECT book_id, id, file_path, COALESCE(file_hash, '') FROM book_files
+		ORDER BY 1, 2`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []StoredFile
+	for rows.Next() {
+		var f StoredFile
+		if err := rows.Scan(&f.BookID, &f.FileID, &f.Path, &f.Hash); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// MoveStoredFile records that a book file or edition is now at path. Its
+// hash is set to hash if it had none; a recorded hash is kept since
+// tombstones and duplicate checks match on the hash of the upload.
+func (d *Database) MoveStoredFile(f StoredFile, path, hash string) error {
+	var res sql.Result
+	var err error
+	if f.FileID == "" {
+		res, err = d.db.Exec(`
+			UPDATE books SET file_path = ?,
+				file_hash = CASE WHEN COALESCE(file_hash, '') = '' THEN ? ELSE file_hash END
+			WHERE id = ? AND file_path = ?`, path, hash, f.BookID, f.Path)
+	} else {
+		res, err = d.db.Exec(`
+			UPDATE book_files SET file_path = ?,
+				file_hash = CASE WHEN COALESCE(file_hash, '') = '' THEN ? ELSE file_hash END
+			WHERE id = ? AND file_path = ?`, path, hash, f.FileID, f.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ==================== Content-Addressed Store Migration ====================
+
+// DedupeResult is what DedupeFiles did, or would do on a dry run
+type DedupeResult struct {
+	Moved      int   // Files moved into the store
+	Duplicates int   // Files whose content was already stored
+	BytesSaved int64 // Disk space freed by dropping duplicate copies
+	Failed     int   // Files that couldn't be read or moved
+	Pruned     *PruneResult
+}
+
+// DedupeFiles moves every book file and extra edition not yet in the
+// content-addressed store into it and records the new paths, so files
+// uploaded before the store existed share disk space too. Objects no book
+// uses are pruned afterwards. On a dry run nothing changes and the result
+// says what would.
+func DedupeFiles(db *Database, files *FileStorage, dryRun bool) (*DedupeResult, error) {
+	stored, err := db.ListStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DedupeResult{}
+	// Where each file went, for a path recorded more than once
+	moved := make(map[string]string)
+	// Objects a dry run would have created
+	seen := make(map[string]bool)
+	for _, f := range stored {
+		if files.IsObject(f.Path) {
+			continue
+		}
+		if dst, ok := moved[f.Path]; ok {
+			hash := strings.TrimSuffix(filepath.Base(dst), filepath.Ext(dst))
+			if err := db.MoveStoredFile(f, dst, hash); err != nil {
+				log.Printf("Failed to record new path of %s: %v", f.Path, err)
+				result.Failed++
+			}
+			continue
+		}
+
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			log.Printf("Skipping %s: %v", f.Path, err)
+			result.Failed++
+			continue
+		}
+		// Recorded hashes can predate metadata written into the file, so
+		// the store goes by what's on disk now
+		hash, err := HashFile(f.Path)
+		if err != nil {
+			log.Printf("Skipping %s: %v", f.Path, err)
+			result.Failed++
+			continue
+		}
+
+		dst := files.objectPath(hash, filepath.Ext(f.Path))
+		_, statErr := os.Stat(dst)
+		duplicate := statErr == nil || seen[dst]
+		if dryRun {
+			seen[dst] = true
+			moved[f.Path] = dst
+		} else {
+			if _, err := files.StoreObject(f.Path, hash); err != nil {
+				log.Printf("Failed to store %s: %v", f.Path, err)
+				result.Failed++
+				continue
+			}
+			moved[f.Path] = dst
+			if err := db.MoveStoredFile(f, dst, hash); err != nil {
+				log.Printf("Failed to record new path of %s: %v", f.Path, err)
+				// Put a copy back so the record still points at its file
+				if err := copyFile(dst, f.Path); err != nil {
+					log.Printf("Failed to restore %s: %v", f.Path, err)
+				}
+				delete(moved, f.Path)
+				result.Failed++
+				continue
+			}
+		}
+
+		if duplicate {
+			result.Duplicates++
+			result.BytesSaved += info.Size()
+		} else {
+			result.Moved++
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if result.Pruned, err = files.PruneObjects(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// copyFile copies the file at src to a new file at dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ageFile moves a file's modification time past the object grace period
+func ageFile(t *testing.T, path string) {
+	old := time.Now().Add(-2 * objectGracePeriod)
+	require.NoError(t, os.Chtimes(path, old, old))
+}
+
+func TestStoredObjectReferenceCounting(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	files, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	files.SetFileReferences(db)
+
+	store := func(id string) string {
+		path, err := files.SaveBookWithExt(id, strings.NewReader("same book"), ".epub")
+		require.NoError(t, err)
+		stored, err := files.StoreObject(path, HashBytes([]byte("same book")))
+		require.NoError(t, err)
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "the upload's own copy is gone")
+		return stored
+	}
+	first := store("book-1")
+	second := store("book-2")
+	assert.Equal(t, first, second, "identical files are stored once")
+	assert.True(t, files.IsObject(first))
+	assert.False(t, files.IsObject(files.GetBookPathWithExt("book-1", ".epub")))
+
+	for id, userID := range map[string]string{"book-1": "user-1", "book-2": "user-2"} {
+		require.NoError(t, db.CreateBook(&models.Book{ID: id, UserID: userID, Title: "Dune",
+			FilePath: first, FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}))
+	}
+	ageFile(t, first)
+
+	// Deleting one book leaves the file for the other
+	require.NoError(t, db.DeleteBook("book-1"))
+	require.NoError(t, files.DeleteFile(first))
+	_, err = os.Stat(first)
+	require.NoError(t, err, "still used by book-2")
+
+	require.NoError(t, db.DeleteBook("book-2"))
+	require.NoError(t, files.DeleteFile(first))
+	_, err = os.Stat(first)
+	assert.True(t, os.IsNotExist(err), "removed with the last book using it")
+
+	// A file just stored is kept until its book is saved
+	fresh := store("book-3")
+	require.NoError(t, files.DeleteFile(fresh))
+	_, err = os.Stat(fresh)
+	assert.NoError(t, err)
+
+	// and pruned once the grace period is over
+	result, err := files.PruneObjects()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Files)
+	ageFile(t, fresh)
+	result, err = files.PruneObjects()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Files)
+	assert.Equal(t, int64(len("same book")), result.Bytes)
+}
+
+func TestDetachObject(t *testing.T) {
+	files, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	path, err := files.SaveBookWithExt("upload", strings.NewReader("shared"), ".epub")
+	require.NoError(t, err)
+	stored, err := files.StoreObject(path, HashBytes([]byte("shared")))
+	require.NoError(t, err)
+
+	own, err := files.DetachObject("book-1", stored)
+	require.NoError(t, err)
+	assert.Equal(t, files.GetBookPathWithExt("book-1", ".epub"), own)
+	content, err := os.ReadFile(own)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", string(content))
+	_, err = os.Stat(stored)
+	assert.NoError(t, err, "the stored copy is left for the other books")
+
+	same, err := files.DetachObject("book-1", own)
+	require.NoError(t, err)
+	assert.Equal(t, own, same, "a file of the book's own isn't copied")
+}
+
+func TestDedupeFiles(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1", "user-2")
+
+	files, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	files.SetFileReferences(db)
+
+	saveBook := func(id, userID, content string) string {
+		path := filepath.Join(files.booksDir, id+".epub")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		require.NoError(t, db.CreateBook(&models.Book{ID: id, UserID: userID, Title: id,
+			FilePath: path, FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}))
+		return path
+	}
+	saveBook("book-1", "user-1", "dune")
+	copied := saveBook("book-2", "user-2", "dune")
+	saveBook("book-3", "user-1", "emma")
+	edition := filepath.Join(files.booksDir, "book-3.edition-pdf.pdf")
+	require.NoError(t, os.WriteFile(edition, []byte("emma pdf"), 0644))
+	require.NoError(t, db.CreateBookFile(&models.BookFile{ID: "file-1", BookID: "book-3",
+		FileFormat: models.FileFormatPDF, FilePath: edition, FileHash: "upload-hash", CreatedAt: time.Now()}))
+
+	result, err := DedupeFiles(db, files, true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Moved)
+	assert.Equal(t, 1, result.Duplicates)
+	assert.Equal(t, int64(len("dune")), result.BytesSaved)
+	_, err = os.Stat(copied)
+	assert.NoError(t, err, "a dry run changes nothing")
+
+	result, err = DedupeFiles(db, files, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Moved)
+	assert.Equal(t, 1, result.Duplicates)
+	assert.Equal(t, 0, result.Failed)
+
+	first, err := db.GetBook("book-1")
+	require.NoError(t, err)
+	second, err := db.GetBook("book-2")
+	require.NoError(t, err)
+	assert.True(t, files.IsObject(first.FilePath))
+	assert.Equal(t, first.FilePath, second.FilePath)
+	assert.Equal(t, HashBytes([]byte("dune")), first.FileHash, "missing hashes are filled in")
+	_, err = os.Stat(copied)
+	assert.True(t, os.IsNotExist(err), "the duplicate copy is gone")
+
+	editions, err := db.GetBookFiles("book-3")
+	require.NoError(t, err)
+	require.Len(t, editions, 1)
+	assert.True(t, files.IsObject(editions[0].FilePath))
+	assert.Equal(t, "upload-hash", editions[0].FileHash, "recorded hashes are kept")
+
+	// Running again finds nothing left to move
+	result, err = DedupeFiles(db, files, false)
+	require.NoError(t, err)
+	assert.Zero(t, result.Moved+result.Duplicates+result.Failed)
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Device Methods ====================
+
+// deviceColumns is the column list scanned by queryDevices
+const deviceColumns = `id, user_id, name, preferred_format, max_file_size, screen_width, screen_height,
+	created_at, last_used_at`
+
+// CreateDevice saves a new device, found later by the hash of its token
+func (d *Database) CreateDevice(device *models.Device, tokenHash string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO devices (`+deviceColumns+`, token_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		device.ID, device.UserID, device.Name, device.PreferredFormat, device.MaxFileSize,
+		device.ScreenWidth, device.ScreenHeight, device.CreatedAt, device.LastUsedAt, tokenHash,
+	)
+	return err
+}
+
+// ListDevices returns a user's devices, oldest first
+func (d *Database) ListDevices(userID string) ([]*models.Device, error) {
+	return d.queryDevices(`SELECT `+deviceColumns+` FROM devices WHERE user_id = ? ORDER BY created_at, id`, userID)
+}
+
+// GetDevice returns a device by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetDevice(deviceID string) (*models.Device, error) {
+	return d.queryDevice(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`, deviceID)
+}
+
+// GetDeviceByToken returns the device whose token has the given hash, or
+// sql.ErrNoRows if there is none
+func (d *Database) GetDeviceByToken(tokenHash string) (*models.Device, error) {
+	return d.queryDevice(`SELECT `+deviceColumns+` FROM devices WHERE token_hash = ?`, tokenHash)
+}
+
+// UpdateDevice saves a device's name and preferences
+func (d *Database) UpdateDevice(device *models.Device) error {
+	_, err := d.db.Exec(`
+		UPDATE devices SET name = ?, preferred_format = ?, max_file_size = ?, screen_width = ?, screen_height = ?
+		WHERE id = ?`,
+		device.Name, device.PreferredFormat, device.MaxFileSize, device.ScreenWidth, device.ScreenHeight, device.ID,
+	)
+	return err
+}
+
+// SetDeviceToken replaces a device's token, so the old one stops working
+func (d *Database) SetDeviceToken(deviceID, tokenHash string) error {
+	_, err := d.db.Exec(`UPDATE devices SET token_hash = ? WHERE id = ?`, tokenHash, deviceID)
+	return err
+}
+
+// TouchDevice records that a device was just used
+func (d *Database) TouchDevice(deviceID string, at time.Time) error {
+	_, err := d.db.Exec(`UPDATE devices SET last_used_at = ? WHERE id = ?`, at, deviceID)
+	return err
+}
+
+// DeleteDevice removes a device
+func (d *Database) DeleteDevice(deviceID string) error {
+	_, err := d.db.Exec(`DELETE FROM devices WHERE id = ?`, deviceID)
+	return err
+}
+
+// queryDevice returns the first device a query finds, or sql.ErrNoRows
+func (d *Database) queryDevice(query string, args ...interface{}) (*models.Device, error) {
+	devices, err := d.queryDevices(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return devices[0], nil
+}
+
+func (d *Database) queryDevices(query string, args ...interface{}) ([]*models.Device, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var devices []*models.Device
+	for rows.Next() {
+		device := &models.Device{}
+		if err := rows.Scan(&device.ID, &device.UserID, &device.Name, &device.PreferredFormat, &device.MaxFileSize,
+			&device.ScreenWidth, &device.ScreenHeight, &device.CreatedAt, &device.LastUsedAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// DiskSpace returns the free and total bytes of the filesystem the data
+// directory is on. Free is what an unprivileged process can use.
+func (fs *FileStorage) DiskSpace() (free, total uint64, err error) {
+	return diskSpace(fs.basePath)
+}
+
+// Usage returns the bytes taken by book files and by covers. The database
+// isn't counted; see Database.Size.
+func (fs *FileStorage) Usage() (books, covers int64, err error) {
+	if books, err = dirSize(fs.booksDir); err != nil {
+		return 0, 0, err
+	}
+	if covers, err = dirSize(fs.coversDir); err != nil {
+		return 0, 0, err
+	}
+	return books, covers, nil
+}
+
+// dirSize adds up the sizes of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
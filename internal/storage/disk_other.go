@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package storage
+
+import "errors"
+
+// diskSpace isn't implemented on this platform, so the free space guard
+// is skipped
+func diskSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
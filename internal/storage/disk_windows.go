@@ -0,0 +1,23 @@
+//go:build windows
+
+package storage
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// diskSpace returns the free and total bytes of the volume path is on
+func diskSpace(path string) (free, total uint64, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	proc := syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+	r, _, err := proc.Call(uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&free)), uintptr(unsafe.Pointer(&total)), 0)
+	if r == 0 {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
@@ -3,7 +3,12 @@ package storage
 import (
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/justyntemme/webby/internal/models"
 )
@@ -77,97 +82,169 @@ func (s *DuplicateService) ComputeHashForBook(book *models.Book) (string, error)
 	return hash, nil
 }
 
-// HashProgress tracks the progress of bulk hash computation
-type HashProgress struct {
-	Total     int `json:"total"`
-	Processed int `json:"processed"`
-	Failed    int `json:"failed"`
+// FindDuplicates returns all duplicate groups for a user
+func (s *DuplicateService) FindDuplicates(userID string) ([]DuplicateGroup, error) {
+	return s.db.FindDuplicateBooks(userID)
+}
+
+// FindEditionCandidates returns groups of books with the same title and
+// author in different formats
+func (s *DuplicateService) FindEditionCandidates(userID string) ([]EditionGroup, error) {
+	return s.db.FindEditionCandidates(userID)
 }
 
-// ComputeMissingHashes computes hashes for books that don't have them
-// Returns progress channel and error channel
-func (s *DuplicateService) ComputeMissingHashes(userID string, batchSize int) (*HashProgress, error) {
+// MergeResult contains the result of merging duplicates
+type MergeResult struct {
+	KeptBook     *models.Book        `json:"kept_book"`
+	DeletedBooks []string            `json:"deleted_books"`
+	Editions     []string            `json:"editions"` // Deleted books whose files were kept as editions
+	FilesRemoved int                 `json:"files_removed"`
+	Changes      []models.BookChange `json:"changes"` // Each deleted book's file moves and deletions
+}
+
+// mergeStep is what a merge does with one duplicate: delete it, keeping its
+// file as an edition of the kept book if asEdition is set
+type mergeStep struct {
+	book      *models.Book
+	asEdition bool
+}
+
+// PlanMerge returns what MergeDuplicates would do with the same arguments,
+// without changing anything
+func (s *DuplicateService) PlanMerge(keepBookID string, deleteBookIDs []string, userID string) (*MergeResult, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Get count first
-	total, err := s.db.CountBooksWithoutHash(userID)
+	keptBook, err := s.keptBook(keepBookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.planMerge(keptBook, deleteBookIDs, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	progress := &HashProgress{
-		Total:     total,
-		Processed: 0,
-		Failed:    0,
+	result := newMergeResult(keptBook)
+	for _, step := range steps {
+		change := s.mergeChange(keptBook.ID, step)
+		if step.asEdition {
+			result.Editions = append(result.Editions, step.book.ID)
+		}
+		if (!step.asEdition && step.book.FilePath != "") || step.book.CoverPath != "" {
+			result.FilesRemoved++
+		}
+		result.DeletedBooks = append(result.DeletedBooks, step.book.ID)
+		result.Changes = append(result.Changes, change)
 	}
+	return result, nil
+}
+
+// MergeDuplicates keeps one book and deletes the others
+// keepBookID is the ID of the book to keep, others in the group are deleted.
+// A book with the same title and author in a format the kept book lacks
+// becomes an edition of it: its file is kept and attached to the kept book.
+func (s *DuplicateService) MergeDuplicates(keepBookID string, deleteBookIDs []string, userID string) (*MergeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if total == 0 {
-		return progress, nil
+	keptBook, err := s.keptBook(keepBookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.planMerge(keptBook, deleteBookIDs, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Process in batches
-	for {
-		books, err := s.db.GetBooksWithoutHash(userID, batchSize)
-		if err != nil {
-			return progress, err
+	result := newMergeResult(keptBook)
+	for _, step := range steps {
+		book, bookID := step.book, step.book.ID
+		change := s.mergeChange(keptBook.ID, step)
+
+		if step.asEdition {
+			if err := s.attachEdition(keptBook.ID, book); err != nil {
+				log.Printf("Failed to keep book %s as an edition: %v", bookID, err)
+				continue
+			}
+			book.FilePath = "" // Moved, not deleted
+			result.Editions = append(result.Editions, bookID)
 		}
 
-		if len(books) == 0 {
-			break
+		// Delete from database first
+		if err := s.db.DeleteBook(bookID); err != nil {
+			log.Printf("Failed to delete book %s from database: %v", bookID, err)
+			continue
 		}
 
-		for _, book := range books {
-			_, err := s.ComputeHashForBook(&book)
-			if err != nil {
-				log.Printf("Failed to compute hash for book %s: %v", book.ID, err)
-				progress.Failed++
+		// Delete files directly since we have the full paths. A duplicate's
+		// file may be the stored object the kept book uses, which DeleteFile
+		// leaves in place.
+		filesDeleted := 0
+		if book.FilePath != "" {
+			if err := s.files.DeleteFile(book.FilePath); err != nil {
+				log.Printf("Failed to delete book file for %s: %v", bookID, err)
 			} else {
-				progress.Processed++
+				filesDeleted++
 			}
 		}
-	}
-
-	return progress, nil
-}
+		if book.CoverPath != "" {
+			if err := os.Remove(book.CoverPath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to delete cover file for %s: %v", bookID, err)
+			} else {
+				filesDeleted++
+			}
+		}
+		if filesDeleted > 0 {
+			result.FilesRemoved++
+		}
 
-// FindDuplicates returns all duplicate groups for a user
-func (s *DuplicateService) FindDuplicates(userID string) ([]DuplicateGroup, error) {
-	return s.db.FindDuplicateBooks(userID)
-}
+		result.DeletedBooks = append(result.DeletedBooks, bookID)
+		result.Changes = append(result.Changes, change)
+	}
 
-// MergeResult contains the result of merging duplicates
-type MergeResult struct {
-	KeptBook     *models.Book `json:"kept_book"`
-	DeletedBooks []string     `json:"deleted_books"`
-	FilesRemoved int          `json:"files_removed"`
+	return result, nil
 }
 
-// MergeDuplicates keeps one book and deletes the others
-// keepBookID is the ID of the book to keep, others in the group are deleted
-func (s *DuplicateService) MergeDuplicates(keepBookID string, deleteBookIDs []string, userID string) (*MergeResult, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Get the book to keep
+// keptBook returns the book a merge keeps, checking userID owns it if
+// given
+func (s *DuplicateService) keptBook(keepBookID, userID string) (*models.Book, error) {
 	keptBook, err := s.db.GetBook(keepBookID)
 	if err != nil {
 		return nil, err
 	}
-
-	// Verify ownership if userID is provided
 	if userID != "" && keptBook.UserID != userID {
 		return nil, ErrNotOwner
 	}
+	return keptBook, nil
+}
 
-	result := &MergeResult{
+func newMergeResult(keptBook *models.Book) *MergeResult {
+	return &MergeResult{
 		KeptBook:     keptBook,
 		DeletedBooks: make([]string, 0),
+		Editions:     make([]string, 0),
 		FilesRemoved: 0,
+		Changes:      make([]models.BookChange, 0),
+	}
+}
+
+// planMerge decides what merging does with each of deleteBookIDs. Books
+// that aren't the user's, or aren't the same file or another format of the
+// same work as the kept book, are left out.
+func (s *DuplicateService) planMerge(keptBook *models.Book, deleteBookIDs []string, userID string) ([]mergeStep, error) {
+	// Formats the kept book already has
+	formats := map[string]bool{keptBook.FileFormat: true}
+	editions, err := s.db.GetBookFiles(keptBook.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range editions {
+		formats[f.FileFormat] = true
 	}
 
+	var steps []mergeStep
 	for _, bookID := range deleteBookIDs {
-		if bookID == keepBookID {
+		if bookID == keptBook.ID {
 			continue // Don't delete the book we're keeping
 		}
 
@@ -183,42 +260,73 @@ func (s *DuplicateService) MergeDuplicates(keepBookID string, deleteBookIDs []st
 			continue
 		}
 
-		// Verify same hash
+		// Verify same hash, or that it's another format of the same title
+		asEdition := false
 		if book.FileHash != keptBook.FileHash {
-			log.Printf("Book %s has different hash, skipping", bookID)
-			continue
-		}
-
-		// Delete from database first
-		if err := s.db.DeleteBook(bookID); err != nil {
-			log.Printf("Failed to delete book %s from database: %v", bookID, err)
-			continue
-		}
-
-		// Delete files directly since we have the full paths
-		filesDeleted := 0
-		if book.FilePath != "" {
-			if err := os.Remove(book.FilePath); err != nil && !os.IsNotExist(err) {
-				log.Printf("Failed to delete book file for %s: %v", bookID, err)
-			} else {
-				filesDeleted++
-			}
-		}
-		if book.CoverPath != "" {
-			if err := os.Remove(book.CoverPath); err != nil && !os.IsNotExist(err) {
-				log.Printf("Failed to delete cover file for %s: %v", bookID, err)
-			} else {
-				filesDeleted++
+			if !sameWork(book, keptBook) || book.IsPhysical() || formats[book.FileFormat] {
+				log.Printf("Book %s has different hash, skipping", bookID)
+				continue
 			}
+			asEdition = true
+			formats[book.FileFormat] = true
 		}
-		if filesDeleted > 0 {
-			result.FilesRemoved++
-		}
+		steps = append(steps, mergeStep{book: book, asEdition: asEdition})
+	}
+	return steps, nil
+}
 
-		result.DeletedBooks = append(result.DeletedBooks, bookID)
+// mergeChange describes the files a merge step moves and deletes. Stored
+// objects are never deleted by a merge: a copy's is the kept book's too, and
+// an edition's stays where it is.
+func (s *DuplicateService) mergeChange(keepBookID string, step mergeStep) models.BookChange {
+	book := step.book
+	change := models.BookChange{BookID: book.ID, Title: book.Title, Deleted: true}
+	switch {
+	case book.FilePath == "" || s.files.IsObject(book.FilePath):
+	case step.asEdition:
+		change.Moves = append(change.Moves, models.FileMove{
+			From: book.FilePath,
+			To:   s.files.editionPath(keepBookID, book.FileFormat, filepath.Ext(book.FilePath)),
+		})
+	default:
+		change.DeletedFiles = append(change.DeletedFiles, book.FilePath)
 	}
+	if book.CoverPath != "" {
+		change.DeletedFiles = append(change.DeletedFiles, book.CoverPath)
+	}
+	return change
+}
 
-	return result, nil
+// sameWork reports whether two books have the same title and author,
+// ignoring case
+func sameWork(a, b *models.Book) bool {
+	return strings.EqualFold(strings.TrimSpace(a.Title), strings.TrimSpace(b.Title)) &&
+		strings.EqualFold(strings.TrimSpace(a.Author), strings.TrimSpace(b.Author))
+}
+
+// attachEdition moves book's file to be an edition of keepBookID
+func (s *DuplicateService) attachEdition(keepBookID string, book *models.Book) error {
+	path, err := s.files.MoveToEdition(keepBookID, book.FilePath, book.FileFormat)
+	if err != nil {
+		return err
+	}
+	edition := &models.BookFile{
+		ID:         uuid.New().String(),
+		BookID:     keepBookID,
+		FileFormat: book.FileFormat,
+		FilePath:   path,
+		FileSize:   book.FileSize,
+		FileHash:   book.FileHash,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.db.CreateBookFile(edition); err != nil {
+		// Put the file back so the book is left as it was
+		if moveErr := moveFile(path, book.FilePath); moveErr != nil {
+			log.Printf("Failed to restore file of book %s: %v", book.ID, moveErr)
+		}
+		return err
+	}
+	return nil
 }
 
 // Error types for duplicate service
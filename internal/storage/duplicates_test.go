@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestMergeDuplicatesAsEditions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	files, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+	service := NewDuplicateService(db, files)
+
+	saveBook := func(id, format, hash, content string) *models.Book {
+		path := filepath.Join(files.booksDir, id+"."+format)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		book := &models.Book{ID: id, UserID: "user-1", Title: "Dune", Author: "Frank Herbert",
+			FilePath: path, FileFormat: format, FileHash: hash, UploadedAt: time.Now()}
+		require.NoError(t, db.CreateBook(book))
+		return book
+	}
+	saveBook("keep", models.FileFormatEPUB, "hash-a", "epub")
+	copied := saveBook("copy", models.FileFormatEPUB, "hash-a", "epub")
+	pdf := saveBook("pdf", models.FileFormatPDF, "hash-b", "pdf")
+	otherEPUB := saveBook("other-epub", models.FileFormatEPUB, "hash-c", "epub 2")
+
+	// A dry run reports the merge without making it
+	planned, err := service.PlanMerge("keep", []string{"copy", "pdf", "other-epub"}, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"copy", "pdf"}, planned.DeletedBooks)
+	require.Len(t, planned.Changes, 2)
+	assert.Equal(t, []string{copied.FilePath}, planned.Changes[0].DeletedFiles)
+	assert.Equal(t, []models.FileMove{{From: pdf.FilePath, To: files.editionPath("keep", models.FileFormatPDF, ".pdf")}},
+		planned.Changes[1].Moves)
+	_, err = os.Stat(copied.FilePath)
+	assert.NoError(t, err)
+	_, err = db.GetBook("copy")
+	assert.NoError(t, err)
+
+	result, err := service.MergeDuplicates("keep", []string{"copy", "pdf", "other-epub"}, "user-1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"copy", "pdf"}, result.DeletedBooks)
+	assert.Equal(t, []string{"pdf"}, result.Editions)
+	assert.Equal(t, planned.Changes, result.Changes)
+	assert.Equal(t, planned.FilesRemoved, result.FilesRemoved)
+
+	// The identical copy is gone; the PDF lives on as an edition
+	_, err = os.Stat(copied.FilePath)
+	assert.True(t, os.IsNotExist(err))
+	editions, err := db.GetBookFiles("keep")
+	require.NoError(t, err)
+	require.Len(t, editions, 1)
+	assert.Equal(t, models.FileFormatPDF, editions[0].FileFormat)
+	assert.Equal(t, "hash-b", editions[0].FileHash)
+	content, err := os.ReadFile(editions[0].FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "pdf", string(content))
+	_, err = os.Stat(pdf.FilePath)
+	assert.True(t, os.IsNotExist(err), "moved, not copied")
+
+	// A different file in a format the book already has is left alone
+	_, err = db.GetBook(otherEPUB.ID)
+	assert.NoError(t, err)
+
+	// Deleting the book removes its editions' files
+	require.NoError(t, files.DeleteBook("keep"))
+	_, err = os.Stat(editions[0].FilePath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,77 @@
+package storage
+
+import "strings"
+
+// ==================== Facet Methods ====================
+
+// facetChunk keeps queries over many books well under SQLite's limit on
+// query parameters
+const facetChunk = 500
+
+// GetBookRatings returns userID's ratings of the given books, keyed by book
+// ID. Books they haven't rated are left out.
+func (d *Database) GetBookRatings(userID string, bookIDs []string) (map[string]int, error) {
+	ratings := make(map[string]int)
+	err := queryBookChunks(bookIDs, func(placeholders string, args []interface{}) error {
+		rows, err := d.db.Query(`
+			SELECT book_id, rating FROM user_book_state
+			WHERE user_id = ? AND rating > 0 AND book_id IN (`+placeholders+`)`,
+			append([]interface{}{userID}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			var rating int
+			if err := rows.Scan(&id, &rating); err != nil {
+				return err
+			}
+			ratings[id] = rating
+		}
+		return rows.Err()
+	})
+	return ratings, err
+}
+
+// GetBookTagIDs returns the IDs of userID's tags on each of the given
+// books, keyed by book ID
+func (d *Database) GetBookTagIDs(userID string, bookIDs []string) (map[string][]string, error) {
+	tagged := make(map[string][]string)
+	err := queryBookChunks(bookIDs, func(placeholders string, args []interface{}) error {
+		rows, err := d.db.Query(`
+			SELECT bt.book_id, bt.tag_id FROM book_tags bt
+			JOIN tags t ON t.id = bt.tag_id
+			WHERE t.user_id = ? AND bt.book_id IN (`+placeholders+`)`,
+			append([]interface{}{userID}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bookID, tagID string
+			if err := rows.Scan(&bookID, &tagID); err != nil {
+				return err
+			}
+			tagged[bookID] = append(tagged[bookID], tagID)
+		}
+		return rows.Err()
+	})
+	return tagged, err
+}
+
+// queryBookChunks calls query with the book IDs a chunk at a time, as
+// placeholders for an IN list and their arguments
+func queryBookChunks(bookIDs []string, query func(placeholders string, args []interface{}) error) error {
+	for start := 0; start < len(bookIDs); start += facetChunk {
+		ids := bookIDs[start:min(start+facetChunk, len(bookIDs))]
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		if err := query("?"+strings.Repeat(", ?", len(ids)-1), args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/justyntemme/webby/internal/epub"
 )
 
 // FileStorage handles file system operations for EPUBs
@@ -14,6 +16,11 @@ type FileStorage struct {
 	basePath   string
 	booksDir   string
 	coversDir  string
+	thumbsDir  string // Cached comic page thumbnails
+	mosaicsDir string // Cached cover mosaics of collections, tags and reading lists
+	textDir    string // Cached text of PDF pages
+	objectsDir string // Book files stored by content hash; see StoreObject
+	refs       FileReferences
 }
 
 // NewFileStorage creates a new file storage handler
@@ -22,7 +29,13 @@ func NewFileStorage(basePath string) (*FileStorage, error) {
 		basePath:  basePath,
 		booksDir:  filepath.Join(basePath, "books"),
 		coversDir: filepath.Join(basePath, "covers"),
+		thumbsDir: filepath.Join(basePath, "thumbnails"),
 	}
+	fs.mosaicsDir = filepath.Join(basePath, "mosaics")
+	fs.textDir = filepath.Join(basePath, "text")
+	// A leading dot keeps it apart from the Author folders ReorganizeBook
+	// makes, since sanitized names can't start with one
+	fs.objectsDir = filepath.Join(fs.booksDir, ".objects")
 
 	// Create directories if they don't exist
 	if err := os.MkdirAll(fs.booksDir, 0755); err != nil {
@@ -31,6 +44,15 @@ func NewFileStorage(basePath string) (*FileStorage, error) {
 	if err := os.MkdirAll(fs.coversDir, 0755); err != nil {
 		return nil, err
 	}
+	if err := os.MkdirAll(fs.thumbsDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(fs.mosaicsDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(fs.textDir, 0755); err != nil {
+		return nil, err
+	}
 
 	return fs, nil
 }
@@ -74,10 +96,29 @@ func (fs *FileStorage) SaveCover(id string, data []byte, ext string) (string, er
 	return filePath, nil
 }
 
+// SaveCoverAt writes a cover over the one at oldPath, giving it the
+// extension ext, and returns its path. A cover whose extension changes is
+// written beside the old one, which callers delete with DeleteFile once
+// the new path is recorded.
+func (fs *FileStorage) SaveCoverAt(oldPath string, data []byte, ext string) (string, error) {
+	newPath := strings.TrimSuffix(oldPath, filepath.Ext(oldPath)) + ext
+
+	// Written aside first so the cover is never served half written
+	tmpPath := newPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPath, newPath); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return newPath, nil
+}
+
 // GetBookPath returns the path to a book file (tries multiple extensions)
 func (fs *FileStorage) GetBookPath(id string) string {
 	// Try common extensions
-	for _, ext := range []string{".epub", ".pdf", ".cbz"} {
+	for _, ext := range []string{".epub", ".pdf", ".cbz", ".cbr"} {
 		path := filepath.Join(fs.booksDir, id+ext)
 		if _, err := os.Stat(path); err == nil {
 			return path
@@ -104,9 +145,72 @@ func (fs *FileStorage) GetCoverPath(id string) string {
 	return ""
 }
 
+// ThumbnailsPath returns where book id's page thumbnails are cached
+func (fs *FileStorage) ThumbnailsPath(id string) string {
+	return filepath.Join(fs.thumbsDir, id+".json")
+}
+
+// PDFTextPath returns where the text of book id's PDF pages is cached
+func (fs *FileStorage) PDFTextPath(id string) string {
+	return filepath.Join(fs.textDir, id+".json")
+}
+
+// MosaicPath returns where the cover mosaic of a collection, tag or
+// reading list is cached. signature identifies the covers in it, so a
+// mosaic of other covers is cached under another path.
+func (fs *FileStorage) MosaicPath(kind, id, signature string) string {
+	return filepath.Join(fs.mosaicsDir, kind+"-"+id+"-"+signature+".jpg")
+}
+
+// SaveMosaic caches a cover mosaic at path, which came from MosaicPath,
+// and removes the group's mosaics of other covers
+func (fs *FileStorage) SaveMosaic(path string, data []byte) error {
+	// Written aside first so the mosaic is never served half written
+	tmp, err := os.CreateTemp(fs.mosaicsDir, ".mosaic-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// The group ID is everything before the signature
+	prefix := path[:strings.LastIndex(path, "-")+1]
+	stale, _ := filepath.Glob(prefix + "*.jpg")
+	for _, old := range stale {
+		if old != path {
+			os.Remove(old)
+		}
+	}
+	return nil
+}
+
+// DeleteMosaics removes the cached cover mosaics of a collection, tag or
+// reading list
+func (fs *FileStorage) DeleteMosaics(kind, id string) {
+	paths, _ := filepath.Glob(filepath.Join(fs.mosaicsDir, kind+"-"+id+"-*.jpg"))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
 // DeleteBook removes a book file
 func (fs *FileStorage) DeleteBook(id string) error {
 	bookPath := fs.GetBookPath(id)
+	if bookPath != "" {
+		// Close the cached EPUB so its disk space is freed
+		epub.Invalidate(bookPath)
+	}
 	if err := os.Remove(bookPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -117,9 +221,79 @@ func (fs *FileStorage) DeleteBook(id string) error {
 		os.Remove(coverPath)
 	}
 
+	// And its cached page thumbnails and text
+	os.Remove(fs.ThumbnailsPath(id))
+	os.Remove(fs.PDFTextPath(id))
+
+	// And any extra editions
+	editions, _ := filepath.Glob(fs.editionPath(id, "*", ""))
+	for _, path := range editions {
+		fs.DeleteFile(path)
+	}
+
+	return nil
+}
+
+// editionPath returns where book id's extra edition in format is stored
+func (fs *FileStorage) editionPath(id, format, ext string) string {
+	return filepath.Join(fs.booksDir, id+".edition-"+format+ext)
+}
+
+// SaveEdition saves an extra edition of book id and returns its path
+func (fs *FileStorage) SaveEdition(id string, reader io.Reader, format, ext string) (string, error) {
+	return fs.SaveBookWithExt(id+".edition-"+format, reader, ext)
+}
+
+// MoveToEdition moves the file at srcPath to be book id's extra edition in
+// format, for when a duplicate book becomes an edition of another. It
+// returns the new path. A stored object stays where it is.
+func (fs *FileStorage) MoveToEdition(id, srcPath, format string) (string, error) {
+	if fs.IsObject(srcPath) {
+		return srcPath, nil
+	}
+	epub.Invalidate(srcPath)
+	dst := fs.editionPath(id, format, filepath.Ext(srcPath))
+	if err := moveFile(srcPath, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// DeleteFile removes a single file, such as an extra edition. A stored
+// object is only removed once no book uses it, so callers delete the
+// record referencing it first.
+func (fs *FileStorage) DeleteFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	if fs.IsObject(path) {
+		return fs.releaseObject(path)
+	}
+	epub.Invalidate(path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
+// ReplaceBookFile moves a staged upload into place as book id's file with
+// the given extension and removes the old file at oldPath if it differs.
+// It returns the new path.
+func (fs *FileStorage) ReplaceBookFile(id, oldPath, stagedPath, ext string) (string, error) {
+	newPath := fs.GetBookPathWithExt(id, ext)
+	if err := os.Rename(stagedPath, newPath); err != nil {
+		return "", err
+	}
+	epub.Invalidate(newPath)
+
+	if oldPath != "" && oldPath != newPath {
+		if err := fs.DeleteFile(oldPath); err != nil {
+			return newPath, err
+		}
+	}
+	return newPath, nil
+}
+
 // OpenBook opens a book file for reading
 func (fs *FileStorage) OpenBook(id string) (*os.File, error) {
 	return os.Open(fs.GetBookPath(id))
@@ -131,9 +305,16 @@ type ReorganizedPaths struct {
 	CoverPath string
 }
 
-// ReorganizeBook moves a book to the correct folder structure based on metadata
-// Structure: Author/Series/Title.epub or Author/Title.epub (if no series)
-func (fs *FileStorage) ReorganizeBook(currentBookPath, currentCoverPath, author, series, title string) (*ReorganizedPaths, error) {
+// PlanReorganize returns where ReorganizeBook would move a book and its
+// cover, without moving anything
+func (fs *FileStorage) PlanReorganize(currentBookPath, currentCoverPath, author, series, title string) *ReorganizedPaths {
+	_, paths := fs.reorganizedPaths(currentBookPath, currentCoverPath, author, series, title)
+	return paths
+}
+
+// reorganizedPaths returns the folder ReorganizeBook puts a book in and the
+// paths of its file and cover there
+func (fs *FileStorage) reorganizedPaths(currentBookPath, currentCoverPath, author, series, title string) (string, *ReorganizedPaths) {
 	// Sanitize names for filesystem
 	author = sanitizeFileName(author)
 	series = sanitizeFileName(series)
@@ -154,40 +335,54 @@ func (fs *FileStorage) ReorganizeBook(currentBookPath, currentCoverPath, author,
 		dirPath = filepath.Join(fs.booksDir, author)
 	}
 
+	// A stored object is shared, so it stays put. Other files keep their
+	// extension, with conflicts resolved by adding a number suffix.
+	result := &ReorganizedPaths{BookPath: currentBookPath}
+	if !fs.IsObject(currentBookPath) {
+		ext := filepath.Ext(currentBookPath)
+		if ext == "" {
+			ext = ".epub"
+		}
+		result.BookPath = resolveConflict(filepath.Join(dirPath, title+ext), currentBookPath)
+	}
+	if currentCoverPath != "" {
+		newCoverPath := filepath.Join(dirPath, title+filepath.Ext(currentCoverPath))
+		result.CoverPath = resolveConflict(newCoverPath, currentCoverPath)
+	}
+	return dirPath, result
+}
+
+// ReorganizeBook moves a book to the correct folder structure based on metadata
+// Structure: Author/Series/Title.epub or Author/Title.epub (if no series)
+// A book file in the content-addressed store may be shared, so it stays
+// where it is and only the cover moves.
+func (fs *FileStorage) ReorganizeBook(currentBookPath, currentCoverPath, author, series, title string) (*ReorganizedPaths, error) {
+	dirPath, planned := fs.reorganizedPaths(currentBookPath, currentCoverPath, author, series, title)
+
 	// Create directory structure
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
 		return nil, err
 	}
 
-	// Build new book path
-	newBookPath := filepath.Join(dirPath, title+".epub")
-
-	// Handle filename conflicts by adding a number suffix
-	newBookPath = resolveConflict(newBookPath, currentBookPath)
-
 	// Move the book file if paths are different
-	if currentBookPath != newBookPath {
-		if err := moveFile(currentBookPath, newBookPath); err != nil {
+	if currentBookPath != planned.BookPath {
+		if err := moveFile(currentBookPath, planned.BookPath); err != nil {
 			return nil, err
 		}
 	}
 
 	result := &ReorganizedPaths{
-		BookPath: newBookPath,
+		BookPath: planned.BookPath,
 	}
 
 	// Move cover if it exists
 	if currentCoverPath != "" {
-		ext := filepath.Ext(currentCoverPath)
-		newCoverPath := filepath.Join(dirPath, title+ext)
-		newCoverPath = resolveConflict(newCoverPath, currentCoverPath)
-
-		if currentCoverPath != newCoverPath {
-			if err := moveFile(currentCoverPath, newCoverPath); err != nil {
+		if currentCoverPath != planned.CoverPath {
+			if err := moveFile(currentCoverPath, planned.CoverPath); err != nil {
 				// Cover move failed, but book moved successfully - not fatal
 				result.CoverPath = currentCoverPath
 			} else {
-				result.CoverPath = newCoverPath
+				result.CoverPath = planned.CoverPath
 			}
 		} else {
 			result.CoverPath = currentCoverPath
@@ -195,7 +390,12 @@ func (fs *FileStorage) ReorganizeBook(currentBookPath, currentCoverPath, author,
 	}
 
 	// Clean up empty directories from old location
-	cleanEmptyDirs(filepath.Dir(currentBookPath), fs.booksDir)
+	if fs.IsObject(currentBookPath) {
+		// Nothing may have moved into the new folders
+		cleanEmptyDirs(dirPath, fs.booksDir)
+	} else {
+		cleanEmptyDirs(filepath.Dir(currentBookPath), fs.booksDir)
+	}
 
 	return result, nil
 }
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Job Methods ====================
+
+// jobColumns is the column list scanned by queryJobs
+const jobColumns = `id, user_id, kind, status, dry_run, provider, total, succeeded, failed, skipped, created_at, updated_at, finished_at`
+
+// jobItemCounters is the jobs column counting items that finished with each
+// status
+var jobItemCounters = map[string]string{
+	models.JobItemSucceeded: "succeeded",
+	models.JobItemFailed:    "failed",
+	models.JobItemSkipped:   "skipped",
+}
+
+// CreateJob saves a new job with an item for each of itemIDs, to be worked
+// in that order
+func (d *Database) CreateJob(job *models.Job, itemIDs []string) error {
+	job.Total = len(itemIDs)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO jobs (id, user_id, kind, status, dry_run, provider, total, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.UserID, job.Kind, job.Status, job.DryRun, job.Provider, job.Total, job.CreatedAt, job.UpdatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for seq, itemID := range itemIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO job_items (job_id, seq, item_id, status, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			job.ID, seq, itemID, models.JobItemPending, job.CreatedAt,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetJob returns a job by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetJob(jobID string) (*models.Job, error) {
+	jobs, err := d.queryJobs(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return jobs[0], nil
+}
+
+// ListJobs returns a user's jobs, newest first
+func (d *Database) ListJobs(userID string) ([]*models.Job, error) {
+	return d.queryJobs(`SELECT `+jobColumns+` FROM jobs WHERE user_id = ? ORDER BY created_at DESC, id`, userID)
+}
+
+// NextQueuedJob returns the job that has been queued longest, or
+// sql.ErrNoRows if none is waiting
+func (d *Database) NextQueuedJob() (*models.Job, error) {
+	jobs, err := d.queryJobs(`
+		SELECT `+jobColumns+` FROM jobs WHERE status = ? ORDER BY created_at, id LIMIT 1`, models.JobStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return jobs[0], nil
+}
+
+// TransitionJob moves a job to status if it's in one of from, reporting
+// whether it was. Completing a job records when it finished.
+func (d *Database) TransitionJob(jobID string, from []string, status string) (bool, error) {
+	now := time.Now()
+	var finishedAt *time.Time
+	if status == models.JobStatusCompleted {
+		finishedAt = &now
+	}
+	args := []interface{}{status, now, finishedAt, jobID}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	result, err := d.db.Exec(`
+		UPDATE jobs SET status = ?, updated_at = ?, finished_at = ?
+		WHERE id = ? AND status IN (?`+strings.Repeat(", ?", len(from)-1)+`)`, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// RequeueRunningJobs queues again the jobs that were running when the
+// server stopped, so they resume from their first pending item
+func (d *Database) RequeueRunningJobs() error {
+	_, err := d.db.Exec(`UPDATE jobs SET status = ? WHERE status = ?`, models.JobStatusQueued, models.JobStatusRunning)
+	return err
+}
+
+// ListJobItems returns a job's items in order, only those with status if
+// it isn't empty
+func (d *Database) ListJobItems(jobID, status string) ([]*models.JobItem, error) {
+	query := `SELECT job_id, seq, item_id, status, reason, changes, attempts, updated_at FROM job_items WHERE job_id = ?`
+	args := []interface{}{jobID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	rows, err := d.db.Query(query+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.JobItem
+	for rows.Next() {
+		item := &models.JobItem{}
+		var changes string
+		if err := rows.Scan(&item.JobID, &item.Seq, &item.ItemID, &item.Status, &item.Reason, &changes,
+			&item.Attempts, &item.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if changes != "" {
+			if err := json.Unmarshal([]byte(changes), &item.Changes); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// FinishJobItem records a pending item's result and counts it towards its
+// job's progress. This is the job's checkpoint: an item finished here isn't
+// worked again when the job resumes.
+func (d *Database) FinishJobItem(item *models.JobItem) error {
+	counter, ok := jobItemCounters[item.Status]
+	if !ok {
+		return fmt.Errorf("unknown job item status %q", item.Status)
+	}
+	item.UpdatedAt = time.Now()
+	var changes []byte
+	if len(item.Changes) > 0 {
+		var err error
+		if changes, err = json.Marshal(item.Changes); err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(`
+		UPDATE job_items SET status = ?, reason = ?, changes = ?, attempts = ?, updated_at = ?
+		WHERE job_id = ? AND seq = ? AND status = ?`,
+		item.Status, item.Reason, string(changes), item.Attempts, item.UpdatedAt, item.JobID, item.Seq, models.JobItemPending,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Already counted
+		tx.Rollback()
+		return nil
+	}
+	if _, err := tx.Exec(`UPDATE jobs SET `+counter+` = `+counter+` + 1, updated_at = ? WHERE id = ?`,
+		item.UpdatedAt, item.JobID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) queryJobs(query string, args ...interface{}) ([]*models.Job, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		if err := rows.Scan(&job.ID, &job.UserID, &job.Kind, &job.Status, &job.DryRun, &job.Provider, &job.Total, &job.Succeeded, &job.Failed,
+			&job.Skipped, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt); err != nil {
+			return nil, err
+		}
+		job.Processed = job.Succeeded + job.Failed + job.Skipped
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Vacuum rebuilds the database file to reclaim space left by deleted rows
+// and checkpoints the WAL into it
+func (d *Database) Vacuum() error {
+	if _, err := d.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// IntegrityCheck runs SQLite's integrity and foreign key checks and returns
+// the problems found. An empty result means the database is healthy.
+func (d *Database) IntegrityCheck() ([]string, error) {
+	var problems []string
+
+	rows, err := d.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fkRows, err := d.db.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer fkRows.Close()
+	for fkRows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := fkRows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return nil, err
+		}
+		problems = append(problems, fmt.Sprintf("%s row %d references a missing %s row", table, rowID.Int64, parent))
+	}
+	return problems, fkRows.Err()
+}
+
+// Size returns the bytes the database takes, not counting its WAL
+func (d *Database) Size() (int64, error) {
+	var pages, pageSize int64
+	if err := d.db.QueryRow(`PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := d.db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestVacuum(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	book := &models.Book{ID: "book-1", Title: "Book", FilePath: "/path.epub", UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.DeleteBook(book.ID))
+
+	require.NoError(t, db.Vacuum())
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	problems, err := db.IntegrityCheck()
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// A row written while foreign keys were off
+	conn, err := db.db.Conn(t.Context())
+	require.NoError(t, err)
+	_, err = conn.ExecContext(t.Context(), `PRAGMA foreign_keys = OFF`)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(t.Context(), `INSERT INTO books (id, user_id, title, file_path) VALUES ('orphan', 'missing-user', 'Orphan', '/orphan.epub')`)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(t.Context(), `PRAGMA foreign_keys = ON`)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	problems, err = db.IntegrityCheck()
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "books row")
+}
@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// Schema changes are numbered SQL files in migrations/: NNNN_name.up.sql
+// applies the change and NNNN_name.down.sql reverts it. Applied versions are
+// recorded in schema_migrations, and each migration runs in a transaction
+// with its record so a failure leaves the schema at the previous version.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded migrations in version order
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name", name)
+		}
+
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// migrate brings the schema up to date
+func (d *Database) migrate() error {
+	_, err := d.MigrateUp(false)
+	return err
+}
+
+// MigrationStatus lists every migration and whether it has been applied
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			at := at
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies pending migrations in order and returns them. With
+// dryRun it only returns what would be applied.
+func (d *Database) MigrateUp(dryRun bool) ([]Migration, error) {
+	statuses, err := d.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+
+	if err := d.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	// Databases from before versioned migrations get their missing books
+	// and collections columns first, so the baseline's indexes apply
+	if pending[0].Version == 1 {
+		if err := d.addLegacyColumns(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, m := range pending {
+		if err := d.applyMigration(m, m.Up, true); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, d.fillSortKeys()
+}
+
+// MigrateDown reverts the most recent steps applied migrations, newest
+// first, and returns them. With dryRun it only returns what would be
+// reverted.
+func (d *Database) MigrateDown(steps int, dryRun bool) ([]Migration, error) {
+	statuses, err := d.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverting []Migration
+	for i := len(statuses) - 1; i >= 0 && len(reverting) < steps; i-- {
+		if statuses[i].Applied {
+			reverting = append(reverting, statuses[i].Migration)
+		}
+	}
+	if dryRun {
+		return reverting, nil
+	}
+
+	for i, m := range reverting {
+		if err := d.applyMigration(m, m.Down, false); err != nil {
+			return reverting[:i], err
+		}
+	}
+	return reverting, nil
+}
+
+// applyMigration runs one migration's SQL and records or removes its
+// version in the same transaction
+func (d *Database) applyMigration(m Migration, script string, up bool) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// fillSortKeys computes the sort title and author of books that don't have
+// them yet. The keys need Go, so books from before the sort_keys migration
+// get theirs here.
+func (d *Database) fillSortKeys() error {
+	rows, err := d.db.Query(`
+		SELECT id, title, author, COALESCE(language, '') FROM books
+		WHERE (sort_title = '' AND title != '') OR (sort_author = '' AND author != '')`)
+	if err != nil {
+		return err
+	}
+	var books []models.Book
+	for rows.Next() {
+		var b models.Book
+		if err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.Language); err != nil {
+			rows.Close()
+			return err
+		}
+		books = append(books, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(books) == 0 {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range books {
+		setSortKeys(&books[i])
+		if _, err := tx.Exec(`UPDATE books SET sort_title = ?, sort_author = ? WHERE id = ?`,
+			books[i].SortTitle, books[i].SortAuthor, books[i].ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ensureMigrationsTable creates the table recording applied versions
+func (d *Database) ensureMigrationsTable() error {
+	_, err := d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`)
+	return err
+}
+
+// appliedMigrations returns when each applied version was applied. A
+// database without schema_migrations has none.
+func (d *Database) appliedMigrations() (map[int]time.Time, error) {
+	applied := map[int]time.Time{}
+
+	exists, err := d.tableExists("schema_migrations")
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := d.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// legacyColumns are the books and collections columns that were added with
+// ALTER TABLE before versioned migrations. The baseline creates them for new
+// databases.
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"books", "isbn", "TEXT DEFAULT ''"},
+	{"books", "publisher", "TEXT DEFAULT ''"},
+	{"books", "publish_date", "TEXT DEFAULT ''"},
+	{"books", "description", "TEXT DEFAULT ''"},
+	{"books", "language", "TEXT DEFAULT ''"},
+	{"books", "subjects", "TEXT DEFAULT ''"},
+	{"books", "metadata_source", "TEXT DEFAULT 'epub'"},
+	{"books", "metadata_updated", "DATETIME"},
+	{"books", "content_type", "TEXT DEFAULT 'book'"},
+	{"books", "file_format", "TEXT DEFAULT 'epub'"},
+	{"books", "file_hash", "TEXT DEFAULT ''"},
+	{"books", "read_status", "TEXT DEFAULT 'unread'"},
+	{"books", "date_completed", "DATETIME"},
+	{"books", "rating", "INTEGER DEFAULT 0"},
+	{"books", "content_source", "TEXT DEFAULT 'digital'"},
+	{"collections", "is_smart", "INTEGER DEFAULT 0"},
+	{"collections", "rule_logic", "TEXT DEFAULT 'AND'"},
+}
+
+// addLegacyColumns adds any legacy columns an existing table is missing
+func (d *Database) addLegacyColumns() error {
+	for _, col := range legacyColumns {
+		exists, err := d.tableExists(col.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		has, err := d.columnExists(col.table, col.column)
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+
+		if _, err := d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)); err != nil {
+			return fmt.Errorf("add %s.%s: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+// tableExists reports whether the schema has a table named name
+func (d *Database) tableExists(name string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count)
+	return count > 0, err
+}
+
+// columnExists reports whether table has a column named column
+func (d *Database) columnExists(table, column string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	return count > 0, err
+}
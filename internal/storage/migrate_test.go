@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "versions are sequential")
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	statuses, err := db.MigrationStatus()
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.True(t, s.Applied, "migration %d", s.Version)
+		assert.NotNil(t, s.AppliedAt)
+	}
+
+	pending, err := db.MigrateUp(true)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	statuses, err := db.MigrationStatus()
+	require.NoError(t, err)
+	all := len(statuses)
+
+	// Dry run changes nothing
+	reverting, err := db.MigrateDown(all, true)
+	require.NoError(t, err)
+	require.Len(t, reverting, all)
+	assert.Equal(t, 1, reverting[len(reverting)-1].Version, "newest first")
+	exists, err := db.tableExists("books")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	reverted, err := db.MigrateDown(all, false)
+	require.NoError(t, err)
+	assert.Len(t, reverted, all)
+	exists, err = db.tableExists("books")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	pending, err := db.MigrateUp(true)
+	require.NoError(t, err)
+	assert.Len(t, pending, all)
+
+	applied, err := db.MigrateUp(false)
+	require.NoError(t, err)
+	assert.Len(t, applied, all)
+	exists, err = db.tableExists("books")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "webby-test-*.db")
+	require.NoError(t, err)
+	tmpFile.Close()
+	defer func() {
+		os.Remove(tmpFile.Name())
+		os.Remove(tmpFile.Name() + "-wal")
+		os.Remove(tmpFile.Name() + "-shm")
+	}()
+
+	// A books table from before metadata columns and versioned migrations
+	raw, err := sql.Open("sqlite3", tmpFile.Name())
+	require.NoError(t, err)
+	_, err = raw.Exec(`
+		CREATE TABLE books (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL,
+			author TEXT NOT NULL DEFAULT 'Unknown',
+			series TEXT DEFAULT '',
+			series_index REAL DEFAULT 0,
+			file_path TEXT NOT NULL,
+			cover_path TEXT DEFAULT '',
+			file_size INTEGER DEFAULT 0,
+			uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO books (id, title, file_path) VALUES ('old-book', 'Old Book', '/old.epub');`)
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
+
+	db, err := NewDatabase(tmpFile.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	has, err := db.columnExists("books", "content_source")
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	book, err := db.GetBook("old-book")
+	require.NoError(t, err)
+	assert.Equal(t, "Old Book", book.Title)
+	assert.Equal(t, "book", book.ContentType)
+
+	statuses, err := db.MigrationStatus()
+	require.NoError(t, err)
+	assert.True(t, statuses[0].Applied)
+}
@@ -0,0 +1,26 @@
+-- Drops the whole schema, children before the tables they reference
+DROP TABLE IF EXISTS library_revisions;
+DROP TABLE IF EXISTS style_overrides;
+DROP TABLE IF EXISTS reader_preferences;
+DROP TABLE IF EXISTS book_loans;
+DROP TABLE IF EXISTS user_book_state;
+DROP TABLE IF EXISTS book_reviews;
+DROP TABLE IF EXISTS follow_updates;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS notification_subscriptions;
+DROP TABLE IF EXISTS notification_channels;
+DROP TABLE IF EXISTS daily_reading_stats;
+DROP TABLE IF EXISTS user_statistics;
+DROP TABLE IF EXISTS reading_sessions;
+DROP TABLE IF EXISTS annotations;
+DROP TABLE IF EXISTS book_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS book_reading_list;
+DROP TABLE IF EXISTS reading_lists;
+DROP TABLE IF EXISTS book_shares;
+DROP TABLE IF EXISTS reading_positions;
+DROP TABLE IF EXISTS book_collections;
+DROP TABLE IF EXISTS collection_rules;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS books;
+DROP TABLE IF EXISTS users;
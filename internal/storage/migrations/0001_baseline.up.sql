@@ -0,0 +1,375 @@
+-- Baseline schema. Every statement is idempotent so databases created
+-- before versioned migrations, which already have some of these tables, can
+-- be brought up to the baseline by running it.
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS books (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL DEFAULT '',
+	title TEXT NOT NULL,
+	author TEXT NOT NULL DEFAULT 'Unknown',
+	series TEXT DEFAULT '',
+	series_index REAL DEFAULT 0,
+	file_path TEXT NOT NULL,
+	cover_path TEXT DEFAULT '',
+	file_size INTEGER DEFAULT 0,
+	uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	isbn TEXT DEFAULT '',
+	publisher TEXT DEFAULT '',
+	publish_date TEXT DEFAULT '',
+	description TEXT DEFAULT '',
+	language TEXT DEFAULT '',
+	subjects TEXT DEFAULT '',
+	metadata_source TEXT DEFAULT 'epub',
+	metadata_updated DATETIME,
+	content_type TEXT DEFAULT 'book',
+	file_format TEXT DEFAULT 'epub',
+	file_hash TEXT DEFAULT '',
+	-- Legacy per-book state, superseded by user_book_state
+	read_status TEXT DEFAULT 'unread',
+	date_completed DATETIME,
+	rating INTEGER DEFAULT 0,
+	-- "digital" for uploaded files, "physical" for paper books
+	content_source TEXT DEFAULT 'digital',
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL,
+	is_smart INTEGER DEFAULT 0,
+	rule_logic TEXT DEFAULT 'AND',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS collection_rules (
+	id TEXT PRIMARY KEY,
+	collection_id TEXT NOT NULL,
+	field TEXT NOT NULL,
+	operator TEXT NOT NULL,
+	value TEXT NOT NULL,
+	FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS book_collections (
+	book_id TEXT NOT NULL,
+	collection_id TEXT NOT NULL,
+	PRIMARY KEY (book_id, collection_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS reading_positions (
+	book_id TEXT NOT NULL,
+	user_id TEXT NOT NULL DEFAULT '',
+	chapter TEXT NOT NULL,
+	position REAL DEFAULT 0,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (book_id, user_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS book_shares (
+	id TEXT PRIMARY KEY,
+	book_id TEXT NOT NULL,
+	owner_id TEXT NOT NULL,
+	shared_with_id TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(book_id, shared_with_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (shared_with_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_books_author ON books(author);
+CREATE INDEX IF NOT EXISTS idx_books_series ON books(series);
+CREATE INDEX IF NOT EXISTS idx_books_user ON books(user_id);
+CREATE INDEX IF NOT EXISTS idx_collections_user ON collections(user_id);
+CREATE INDEX IF NOT EXISTS idx_book_shares_shared_with ON book_shares(shared_with_id);
+CREATE INDEX IF NOT EXISTS idx_collection_rules_collection ON collection_rules(collection_id);
+CREATE INDEX IF NOT EXISTS idx_books_isbn ON books(isbn);
+CREATE INDEX IF NOT EXISTS idx_books_content_type ON books(content_type);
+CREATE INDEX IF NOT EXISTS idx_books_file_format ON books(file_format);
+CREATE INDEX IF NOT EXISTS idx_books_file_hash ON books(file_hash);
+CREATE INDEX IF NOT EXISTS idx_books_read_status ON books(read_status);
+
+-- Books, positions, and collections created without signing in are stored
+-- under user ''. With foreign keys enforced that ID needs a row; it has no
+-- password hash, so nobody can sign in as it.
+INSERT OR IGNORE INTO users (id, username, email, password_hash) VALUES ('', '', '', '');
+
+-- Reading lists
+CREATE TABLE IF NOT EXISTS reading_lists (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	list_type TEXT NOT NULL DEFAULT 'custom',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS book_reading_list (
+	book_id TEXT NOT NULL,
+	list_id TEXT NOT NULL,
+	added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	position INTEGER DEFAULT 0,
+	PRIMARY KEY (book_id, list_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (list_id) REFERENCES reading_lists(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_lists_user ON reading_lists(user_id);
+CREATE INDEX IF NOT EXISTS idx_reading_lists_type ON reading_lists(list_type);
+CREATE INDEX IF NOT EXISTS idx_book_reading_list_list ON book_reading_list(list_id);
+
+-- Custom tags
+CREATE TABLE IF NOT EXISTS tags (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	color TEXT DEFAULT '#3b82f6',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(user_id, name),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS book_tags (
+	book_id TEXT NOT NULL,
+	tag_id TEXT NOT NULL,
+	added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (book_id, tag_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tags_user ON tags(user_id);
+CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(name);
+CREATE INDEX IF NOT EXISTS idx_book_tags_tag ON book_tags(tag_id);
+
+-- Highlights and notes
+CREATE TABLE IF NOT EXISTS annotations (
+	id TEXT PRIMARY KEY,
+	book_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	chapter TEXT NOT NULL,
+	cfi TEXT DEFAULT '',
+	start_offset INTEGER DEFAULT 0,
+	end_offset INTEGER DEFAULT 0,
+	selected_text TEXT NOT NULL,
+	note TEXT DEFAULT '',
+	color TEXT DEFAULT 'yellow',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_annotations_book ON annotations(book_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_user ON annotations(user_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_book_user ON annotations(book_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_annotations_chapter ON annotations(chapter);
+
+-- Reading sessions and statistics
+CREATE TABLE IF NOT EXISTS reading_sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	book_id TEXT NOT NULL,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME,
+	pages_read INTEGER DEFAULT 0,
+	chapters_read INTEGER DEFAULT 0,
+	duration_seconds INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS user_statistics (
+	user_id TEXT PRIMARY KEY,
+	total_books_read INTEGER DEFAULT 0,
+	total_pages_read INTEGER DEFAULT 0,
+	total_chapters_read INTEGER DEFAULT 0,
+	total_time_seconds INTEGER DEFAULT 0,
+	current_streak INTEGER DEFAULT 0,
+	longest_streak INTEGER DEFAULT 0,
+	last_reading_date DATE,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS daily_reading_stats (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	reading_date DATE NOT NULL,
+	pages_read INTEGER DEFAULT 0,
+	chapters_read INTEGER DEFAULT 0,
+	time_seconds INTEGER DEFAULT 0,
+	books_touched INTEGER DEFAULT 0,
+	UNIQUE(user_id, reading_date),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_sessions_user ON reading_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_reading_sessions_book ON reading_sessions(book_id);
+CREATE INDEX IF NOT EXISTS idx_reading_sessions_start ON reading_sessions(start_time);
+CREATE INDEX IF NOT EXISTS idx_daily_stats_user ON daily_reading_stats(user_id);
+CREATE INDEX IF NOT EXISTS idx_daily_stats_date ON daily_reading_stats(reading_date);
+
+-- Notification channels and subscriptions
+CREATE TABLE IF NOT EXISTS notification_channels (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	target TEXT NOT NULL,
+	token TEXT DEFAULT '',
+	enabled INTEGER DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS notification_subscriptions (
+	user_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	enabled INTEGER DEFAULT 1,
+	PRIMARY KEY (user_id, event_type),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channels_user ON notification_channels(user_id);
+
+-- Follows for new-release tracking
+CREATE TABLE IF NOT EXISTS follows (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	follow_type TEXT NOT NULL,
+	name TEXT NOT NULL COLLATE NOCASE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_checked_at DATETIME,
+	UNIQUE(user_id, follow_type, name),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS follow_updates (
+	id TEXT PRIMARY KEY,
+	follow_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	author TEXT DEFAULT '',
+	series TEXT DEFAULT '',
+	issue_number TEXT DEFAULT '',
+	release_date TEXT DEFAULT '',
+	cover_url TEXT DEFAULT '',
+	source TEXT NOT NULL,
+	source_id TEXT NOT NULL,
+	seen INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(follow_id, source, source_id),
+	FOREIGN KEY (follow_id) REFERENCES follows(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_follows_user ON follows(user_id);
+CREATE INDEX IF NOT EXISTS idx_follow_updates_user ON follow_updates(user_id, seen);
+
+-- Per-user book reviews
+CREATE TABLE IF NOT EXISTS book_reviews (
+	id TEXT PRIMARY KEY,
+	book_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	rating REAL DEFAULT 0,
+	review TEXT DEFAULT '',
+	spoiler INTEGER DEFAULT 0,
+	read_date DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(book_id, user_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_reviews_user ON book_reviews(user_id);
+
+-- Per-user read status and rating. These used to live on the books row,
+-- which leaked one user's progress to everyone a book was shared with.
+CREATE TABLE IF NOT EXISTS user_book_state (
+	user_id TEXT NOT NULL,
+	book_id TEXT NOT NULL,
+	read_status TEXT DEFAULT 'unread',
+	date_completed DATETIME,
+	rating INTEGER DEFAULT 0,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, book_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_book_state_book ON user_book_state(book_id);
+CREATE INDEX IF NOT EXISTS idx_user_book_state_status ON user_book_state(user_id, read_status);
+
+-- Book loans for the lending tracker
+CREATE TABLE IF NOT EXISTS book_loans (
+	id TEXT PRIMARY KEY,
+	book_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	borrower_name TEXT NOT NULL,
+	borrower_user_id TEXT DEFAULT '',
+	notes TEXT DEFAULT '',
+	lent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	due_date DATETIME,
+	returned_at DATETIME,
+	reminded_at DATETIME,
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_loans_user ON book_loans(user_id, returned_at);
+CREATE INDEX IF NOT EXISTS idx_book_loans_borrower ON book_loans(borrower_user_id);
+CREATE INDEX IF NOT EXISTS idx_book_loans_due ON book_loans(due_date) WHERE returned_at IS NULL;
+
+-- Reader preferences (one row per user)
+CREATE TABLE IF NOT EXISTS reader_preferences (
+	user_id TEXT PRIMARY KEY,
+	font_family TEXT NOT NULL,
+	font_size INTEGER NOT NULL,
+	line_height REAL NOT NULL,
+	margins INTEGER NOT NULL,
+	theme TEXT NOT NULL,
+	page_turn_mode TEXT NOT NULL,
+	comic_fit_mode TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- EPUB style overrides. book_id is '' for the user's global CSS.
+CREATE TABLE IF NOT EXISTS style_overrides (
+	user_id TEXT NOT NULL,
+	book_id TEXT NOT NULL DEFAULT '',
+	css TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, book_id),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Library revisions for ETags. user_id is '' for books uploaded without an
+-- account.
+CREATE TABLE IF NOT EXISTS library_revisions (
+	user_id TEXT PRIMARY KEY,
+	revision INTEGER NOT NULL DEFAULT 0
+);
+
+-- Copy legacy per-book state to the book's owner. Existing rows win, so this
+-- is a no-op on new databases and once a user has changed their own state.
+INSERT OR IGNORE INTO user_book_state (user_id, book_id, read_status, date_completed, rating, updated_at)
+SELECT user_id, id, COALESCE(read_status, 'unread'), date_completed, COALESCE(rating, 0), CURRENT_TIMESTAMP
+FROM books
+WHERE COALESCE(read_status, 'unread') != 'unread' OR COALESCE(rating, 0) > 0;
@@ -0,0 +1 @@
+DROP TABLE library_preferences;
@@ -0,0 +1,8 @@
+-- How each user's library lists are ordered
+CREATE TABLE library_preferences (
+	user_id TEXT PRIMARY KEY,
+	sort_locale TEXT NOT NULL,
+	ignore_articles INTEGER NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
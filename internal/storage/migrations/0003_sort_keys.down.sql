@@ -0,0 +1,4 @@
+DROP INDEX idx_books_user_sort_author;
+DROP INDEX idx_books_user_sort_title;
+ALTER TABLE books DROP COLUMN sort_author;
+ALTER TABLE books DROP COLUMN sort_title;
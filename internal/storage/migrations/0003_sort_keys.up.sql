@@ -0,0 +1,7 @@
+-- Title without its leading article and author in "Last, First" form, used
+-- for ordering. They're computed in Go, so existing books are filled in
+-- after migrating.
+ALTER TABLE books ADD COLUMN sort_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN sort_author TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_books_user_sort_title ON books(user_id, sort_title);
+CREATE INDEX idx_books_user_sort_author ON books(user_id, sort_author);
@@ -0,0 +1,2 @@
+DROP TABLE series_reading_directions;
+ALTER TABLE books DROP COLUMN reading_direction;
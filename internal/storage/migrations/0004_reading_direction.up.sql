@@ -0,0 +1,12 @@
+-- Page order comics are read in; manga is right-to-left
+ALTER TABLE books ADD COLUMN reading_direction TEXT NOT NULL DEFAULT 'ltr';
+
+-- Reading direction given to each user's new uploads in a series
+CREATE TABLE series_reading_directions (
+	user_id TEXT NOT NULL,
+	series TEXT NOT NULL COLLATE NOCASE,
+	reading_direction TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, series),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE book_note_revisions;
+DROP TABLE book_notes;
@@ -0,0 +1,27 @@
+-- Long-form Markdown notes about a whole book, separate from highlights
+CREATE TABLE book_notes (
+	id TEXT PRIMARY KEY,
+	book_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL,
+	revision INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_book_notes_book_user ON book_notes(book_id, user_id);
+CREATE INDEX idx_book_notes_user ON book_notes(user_id);
+
+-- Earlier versions of each note, saved when it's edited
+CREATE TABLE book_note_revisions (
+	note_id TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	body TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (note_id, revision),
+	FOREIGN KEY (note_id) REFERENCES book_notes(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE books DROP COLUMN structure_updated_at;
+ALTER TABLE books DROP COLUMN page_count;
+ALTER TABLE books DROP COLUMN toc_json;
@@ -0,0 +1,6 @@
+-- Table of contents (EPUB) and page count (CBZ, CBR, PDF) read from each
+-- book's file, so browsing doesn't reopen it. structure_updated_at is NULL
+-- until they're computed and again after the file is replaced.
+ALTER TABLE books ADD COLUMN toc_json TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN structure_updated_at DATETIME;
@@ -0,0 +1,13 @@
+-- Extra editions of a book, such as a PDF or MOBI alongside its EPUB. The
+-- main file stays on the books row.
+CREATE TABLE book_files (
+	id TEXT PRIMARY KEY,
+	book_id TEXT NOT NULL,
+	file_format TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	file_size INTEGER NOT NULL DEFAULT 0,
+	file_hash TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (book_id, file_format),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
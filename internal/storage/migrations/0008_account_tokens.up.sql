@@ -0,0 +1,16 @@
+-- Accounts registered while email verification is required start
+-- unverified; everyone else, including existing users, counts as verified.
+ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 1;
+
+-- Single-use tokens for password resets and email verification. Only a
+-- SHA-256 hash of each token is stored, so a leaked database can't be used
+-- to take over accounts.
+CREATE TABLE account_tokens (
+	token_hash TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	purpose TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_account_tokens_user ON account_tokens(user_id, purpose);
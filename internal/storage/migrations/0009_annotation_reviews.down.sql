@@ -0,0 +1 @@
+DROP TABLE annotation_reviews;
@@ -0,0 +1,10 @@
+-- When each highlight was last shown in the daily review and when it's due
+-- again. Highlights without a row have never been reviewed.
+CREATE TABLE annotation_reviews (
+	annotation_id TEXT PRIMARY KEY,
+	review_count INTEGER NOT NULL DEFAULT 0,
+	last_reviewed_at DATETIME NOT NULL,
+	next_review_at DATETIME NOT NULL,
+	FOREIGN KEY (annotation_id) REFERENCES annotations(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_annotation_reviews_next ON annotation_reviews(next_review_at);
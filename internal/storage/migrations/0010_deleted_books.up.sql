@@ -0,0 +1,14 @@
+-- Tombstones of deleted books, keyed by file hash, holding the owner's
+-- annotations, position, tags, and lists as JSON so uploading the same file
+-- again can bring them back.
+CREATE TABLE deleted_books (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	file_hash TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	author TEXT NOT NULL DEFAULT '',
+	data TEXT NOT NULL,
+	deleted_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_deleted_books_hash ON deleted_books(user_id, file_hash);
@@ -0,0 +1,3 @@
+ALTER TABLE book_tags DROP COLUMN from_subjects;
+DROP TABLE subject_tag_map;
+ALTER TABLE library_preferences DROP COLUMN subject_tags;
@@ -0,0 +1,15 @@
+-- Opt-in syncing of metadata subjects into tags. subject_tag_map renames
+-- subjects (stored lowercased) to tag names; an empty tag ignores the
+-- subject. Book tags added by the sync are marked so a later sync can
+-- remove the ones whose subject is gone without touching manual tags.
+ALTER TABLE library_preferences ADD COLUMN subject_tags INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE subject_tag_map (
+	user_id TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (user_id, subject),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+ALTER TABLE book_tags ADD COLUMN from_subjects INTEGER NOT NULL DEFAULT 0;
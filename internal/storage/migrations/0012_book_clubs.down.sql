@@ -0,0 +1,4 @@
+DROP TABLE book_club_comments;
+DROP TABLE book_club_schedule;
+DROP TABLE book_club_members;
+DROP TABLE book_clubs;
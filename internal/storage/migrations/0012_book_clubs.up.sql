@@ -0,0 +1,51 @@
+-- Book clubs: members read one book on a shared schedule and discuss it
+-- chapter by chapter. Chapters are indexes, as in reading_positions.
+CREATE TABLE book_clubs (
+	id TEXT PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	book_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_book_clubs_book ON book_clubs(book_id);
+
+-- shared_book is set when joining the club is what shared the book with
+-- the member, so that leaving unshares it again
+CREATE TABLE book_club_members (
+	club_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	shared_book INTEGER NOT NULL DEFAULT 0,
+	joined_at DATETIME NOT NULL,
+	PRIMARY KEY (club_id, user_id),
+	FOREIGN KEY (club_id) REFERENCES book_clubs(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_book_club_members_user ON book_club_members(user_id);
+
+CREATE TABLE book_club_schedule (
+	club_id TEXT NOT NULL,
+	chapter INTEGER NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	due_date DATETIME NOT NULL,
+	PRIMARY KEY (club_id, chapter),
+	FOREIGN KEY (club_id) REFERENCES book_clubs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE book_club_comments (
+	id TEXT PRIMARY KEY,
+	club_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	chapter INTEGER NOT NULL,
+	parent_id TEXT,
+	body TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (club_id) REFERENCES book_clubs(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (parent_id) REFERENCES book_club_comments(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_book_club_comments_club ON book_club_comments(club_id, chapter, created_at);
@@ -0,0 +1 @@
+ALTER TABLE annotations DROP COLUMN visibility;
@@ -0,0 +1,2 @@
+-- Whether an annotation is shown to the other users who can read its book
+ALTER TABLE annotations ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private';
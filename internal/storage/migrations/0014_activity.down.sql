@@ -0,0 +1,2 @@
+DROP TABLE activity_events;
+DROP TABLE activity_preferences;
@@ -0,0 +1,24 @@
+-- What each user publishes to the activity feed of the users they share
+-- books with. Users without a row publish nothing.
+CREATE TABLE activity_preferences (
+	user_id TEXT PRIMARY KEY,
+	publish_added INTEGER NOT NULL DEFAULT 0,
+	publish_finished INTEGER NOT NULL DEFAULT 0,
+	publish_rated INTEGER NOT NULL DEFAULT 0,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Published events. Each user keeps only the latest event of a type per book.
+CREATE TABLE activity_events (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	book_id TEXT NOT NULL,
+	rating INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_activity_events_user ON activity_events(user_id, created_at);
+CREATE UNIQUE INDEX idx_activity_events_book ON activity_events(user_id, type, book_id);
@@ -0,0 +1,4 @@
+DROP TABLE reading_order_entries;
+DROP TABLE reading_orders;
+DROP TABLE comic_issue_reads;
+DROP TABLE comic_series;
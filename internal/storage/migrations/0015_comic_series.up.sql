@@ -0,0 +1,49 @@
+-- Comic series as entities. Issues are the comics whose series matches the
+-- name; issue numbers are stored normalized, as in the issue checklist.
+CREATE TABLE comic_series (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	publisher TEXT NOT NULL DEFAULT '',
+	start_year INTEGER NOT NULL DEFAULT 0,
+	volume INTEGER NOT NULL DEFAULT 0,
+	total_issues INTEGER NOT NULL DEFAULT 0,
+	description TEXT NOT NULL DEFAULT '',
+	metadata_source TEXT NOT NULL DEFAULT '',
+	source_id TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_comic_series_user_name ON comic_series(user_id, name COLLATE NOCASE);
+
+-- Issues marked read that aren't in the library. Issues that are use the
+-- book's read status.
+CREATE TABLE comic_issue_reads (
+	series_id TEXT NOT NULL,
+	issue_number TEXT NOT NULL,
+	read_at DATETIME NOT NULL,
+	PRIMARY KEY (series_id, issue_number),
+	FOREIGN KEY (series_id) REFERENCES comic_series(id) ON DELETE CASCADE
+);
+
+CREATE TABLE reading_orders (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_reading_orders_user ON reading_orders(user_id);
+
+CREATE TABLE reading_order_entries (
+	order_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	series_id TEXT NOT NULL,
+	issue_number TEXT NOT NULL,
+	PRIMARY KEY (order_id, position),
+	FOREIGN KEY (order_id) REFERENCES reading_orders(id) ON DELETE CASCADE,
+	FOREIGN KEY (series_id) REFERENCES comic_series(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE reading_orders DROP COLUMN source_id;
+ALTER TABLE reading_orders DROP COLUMN metadata_source;
@@ -0,0 +1,4 @@
+-- Reading orders imported from a story arc remember where it came from so
+-- they can be refreshed as the arc grows
+ALTER TABLE reading_orders ADD COLUMN metadata_source TEXT NOT NULL DEFAULT '';
+ALTER TABLE reading_orders ADD COLUMN source_id TEXT NOT NULL DEFAULT '';
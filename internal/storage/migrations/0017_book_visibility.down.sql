@@ -0,0 +1,2 @@
+ALTER TABLE library_preferences DROP COLUMN default_visibility;
+ALTER TABLE books DROP COLUMN visibility;
@@ -0,0 +1,5 @@
+-- Who besides the owner and share recipients can see a book. Public books
+-- are listed with the ownerless pool and readable by everyone. Each user may
+-- pick the visibility of their new uploads; '' uses the server default.
+ALTER TABLE books ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private';
+ALTER TABLE library_preferences ADD COLUMN default_visibility TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,24 @@
+DROP TRIGGER sync_book_reading_list_delete;
+DROP TRIGGER sync_book_reading_list_update;
+DROP TRIGGER sync_book_reading_list_insert;
+DROP TRIGGER sync_book_tags_delete;
+DROP TRIGGER sync_book_tags_update;
+DROP TRIGGER sync_book_tags_insert;
+DROP TRIGGER sync_reading_lists_delete;
+DROP TRIGGER sync_reading_lists_update;
+DROP TRIGGER sync_reading_lists_insert;
+DROP TRIGGER sync_tags_delete;
+DROP TRIGGER sync_tags_update;
+DROP TRIGGER sync_tags_insert;
+DROP TRIGGER sync_annotations_delete;
+DROP TRIGGER sync_annotations_update;
+DROP TRIGGER sync_annotations_insert;
+DROP TRIGGER sync_reading_positions_delete;
+DROP TRIGGER sync_reading_positions_update;
+DROP TRIGGER sync_reading_positions_insert;
+DROP TRIGGER sync_book_state_update;
+DROP TRIGGER sync_book_state_insert;
+DROP TRIGGER sync_books_delete;
+DROP TRIGGER sync_books_update;
+DROP TRIGGER sync_books_insert;
+DROP TABLE sync_changes;
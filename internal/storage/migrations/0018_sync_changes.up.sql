@@ -0,0 +1,141 @@
+-- Change log for delta sync. Triggers keep one row per entity and user:
+-- each write replaces the row, giving it the next seq, so a client that
+-- last synced at seq N needs only the rows after N. Deleted rows stay as
+-- tombstones. Pair entities (a book's tag, a list's book) use
+-- "first_id:second_id" as their ID and belong to the tag or list's owner.
+-- Triggers delete the old row rather than using OR REPLACE, since an outer
+-- statement's OR IGNORE would override it.
+CREATE TABLE sync_changes (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	entity TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	deleted INTEGER NOT NULL DEFAULT 0,
+	changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (entity, entity_id, user_id)
+);
+CREATE INDEX idx_sync_changes_user ON sync_changes(user_id, seq);
+
+CREATE TRIGGER sync_books_insert AFTER INSERT ON books BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('book', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_books_update AFTER UPDATE ON books BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('book', NEW.id, NEW.user_id, 0);
+	DELETE FROM sync_changes WHERE entity = 'book' AND entity_id = OLD.id AND user_id = OLD.user_id AND OLD.user_id != NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) SELECT 'book', OLD.id, OLD.user_id, 1 WHERE OLD.user_id != NEW.user_id;
+END;
+
+CREATE TRIGGER sync_books_delete AFTER DELETE ON books BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book' AND entity_id = OLD.id AND user_id = OLD.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('book', OLD.id, OLD.user_id, 1);
+END;
+
+-- A user's read status and rating are part of the book
+CREATE TRIGGER sync_book_state_insert AFTER INSERT ON user_book_state BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book' AND entity_id = NEW.book_id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('book', NEW.book_id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_book_state_update AFTER UPDATE ON user_book_state BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book' AND entity_id = NEW.book_id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('book', NEW.book_id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_reading_positions_insert AFTER INSERT ON reading_positions BEGIN
+	DELETE FROM sync_changes WHERE entity = 'position' AND entity_id = NEW.book_id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('position', NEW.book_id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_reading_positions_update AFTER UPDATE ON reading_positions BEGIN
+	DELETE FROM sync_changes WHERE entity = 'position' AND entity_id = NEW.book_id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('position', NEW.book_id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_reading_positions_delete AFTER DELETE ON reading_positions BEGIN
+	DELETE FROM sync_changes WHERE entity = 'position' AND entity_id = OLD.book_id AND user_id = OLD.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('position', OLD.book_id, OLD.user_id, 1);
+END;
+
+CREATE TRIGGER sync_annotations_insert AFTER INSERT ON annotations BEGIN
+	DELETE FROM sync_changes WHERE entity = 'annotation' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('annotation', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_annotations_update AFTER UPDATE ON annotations BEGIN
+	DELETE FROM sync_changes WHERE entity = 'annotation' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('annotation', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_annotations_delete AFTER DELETE ON annotations BEGIN
+	DELETE FROM sync_changes WHERE entity = 'annotation' AND entity_id = OLD.id AND user_id = OLD.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('annotation', OLD.id, OLD.user_id, 1);
+END;
+
+CREATE TRIGGER sync_tags_insert AFTER INSERT ON tags BEGIN
+	DELETE FROM sync_changes WHERE entity = 'tag' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('tag', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_tags_update AFTER UPDATE ON tags BEGIN
+	DELETE FROM sync_changes WHERE entity = 'tag' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('tag', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_tags_delete AFTER DELETE ON tags BEGIN
+	DELETE FROM sync_changes WHERE entity = 'tag' AND entity_id = OLD.id AND user_id = OLD.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('tag', OLD.id, OLD.user_id, 1);
+END;
+
+CREATE TRIGGER sync_reading_lists_insert AFTER INSERT ON reading_lists BEGIN
+	DELETE FROM sync_changes WHERE entity = 'reading_list' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('reading_list', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_reading_lists_update AFTER UPDATE ON reading_lists BEGIN
+	DELETE FROM sync_changes WHERE entity = 'reading_list' AND entity_id = NEW.id AND user_id = NEW.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('reading_list', NEW.id, NEW.user_id, 0);
+END;
+
+CREATE TRIGGER sync_reading_lists_delete AFTER DELETE ON reading_lists BEGIN
+	DELETE FROM sync_changes WHERE entity = 'reading_list' AND entity_id = OLD.id AND user_id = OLD.user_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted) VALUES ('reading_list', OLD.id, OLD.user_id, 1);
+END;
+
+CREATE TRIGGER sync_book_tags_insert AFTER INSERT ON book_tags BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book_tag' AND entity_id = NEW.book_id || ':' || NEW.tag_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted)
+	SELECT 'book_tag', NEW.book_id || ':' || NEW.tag_id, user_id, 0 FROM tags WHERE id = NEW.tag_id;
+END;
+
+CREATE TRIGGER sync_book_tags_update AFTER UPDATE ON book_tags BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book_tag' AND entity_id = NEW.book_id || ':' || NEW.tag_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted)
+	SELECT 'book_tag', NEW.book_id || ':' || NEW.tag_id, user_id, 0 FROM tags WHERE id = NEW.tag_id;
+END;
+
+CREATE TRIGGER sync_book_tags_delete AFTER DELETE ON book_tags BEGIN
+	DELETE FROM sync_changes WHERE entity = 'book_tag' AND entity_id = OLD.book_id || ':' || OLD.tag_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted)
+	SELECT 'book_tag', OLD.book_id || ':' || OLD.tag_id, user_id, 1 FROM tags WHERE id = OLD.tag_id;
+END;
+
+CREATE TRIGGER sync_book_reading_list_insert AFTER INSERT ON book_reading_list BEGIN
+	DELETE FROM sync_changes WHERE entity = 'reading_list_book' AND entity_id = NEW.list_id || ':' || NEW.book_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted)
+	SELECT 'reading_list_book', NEW.list_id || ':' || NEW.book_id, user_id, 0 FROM reading_lists WHERE id = NEW.list_id;
+END;
+
+CREATE TRIGGER sync_book_reading_list_update AFTER UPDATE ON book_reading_list BEGIN
+	DELETE FROM sync_changes WHERE entity = 'reading_list_book' AND entity_id = NEW.list_id || ':' || NEW.book_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted)
+	SELECT 'reading_list_book', NEW.list_id || ':' || NEW.book_id, user_id, 0 FROM reading_lists WHERE id = NEW.list_id;
+END;
+
+CREATE TRIGGER sync_book_reading_list_delete AFTER DELETE ON book_reading_list BEGIN
+	DELETE FROM sync_changes WHERE entity = 'reading_list_book' AND entity_id = OLD.list_id || ':' || OLD.book_id;
+	INSERT INTO sync_changes (entity, entity_id, user_id, deleted)
+	SELECT 'reading_list_book', OLD.list_id || ':' || OLD.book_id, user_id, 1 FROM reading_lists WHERE id = OLD.list_id;
+END;
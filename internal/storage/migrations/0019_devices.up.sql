@@ -0,0 +1,16 @@
+-- Devices a user downloads books to, with the format and size each wants.
+-- Requests name a device by its token, stored hashed.
+CREATE TABLE devices (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	preferred_format TEXT NOT NULL DEFAULT '',
+	max_file_size INTEGER NOT NULL DEFAULT 0,
+	screen_width INTEGER NOT NULL DEFAULT 0,
+	screen_height INTEGER NOT NULL DEFAULT 0,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	last_used_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_devices_user ON devices(user_id);
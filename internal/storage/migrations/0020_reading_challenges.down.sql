@@ -0,0 +1,3 @@
+DROP TABLE user_badges;
+DROP TABLE reading_challenge_participants;
+DROP TABLE reading_challenges;
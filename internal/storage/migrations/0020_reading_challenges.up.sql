@@ -0,0 +1,40 @@
+-- Reading challenges: participants compete over the pages they read, their
+-- reading time, or the books they finish between two dates. A target of 0
+-- means the most wins.
+CREATE TABLE reading_challenges (
+	id TEXT PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	metric TEXT NOT NULL,
+	target INTEGER NOT NULL DEFAULT 0,
+	starts_at DATETIME NOT NULL,
+	ends_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Invited users only take part once they join; joined_at is NULL until then
+CREATE TABLE reading_challenge_participants (
+	challenge_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	invited_at DATETIME NOT NULL,
+	joined_at DATETIME,
+	PRIMARY KEY (challenge_id, user_id),
+	FOREIGN KEY (challenge_id) REFERENCES reading_challenges(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_reading_challenge_participants_user ON reading_challenge_participants(user_id);
+
+-- Badges earned in challenges. They keep the challenge's name and outlive it.
+CREATE TABLE user_badges (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	challenge_id TEXT,
+	type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	awarded_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY (challenge_id) REFERENCES reading_challenges(id) ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX idx_user_badges_challenge ON user_badges(user_id, challenge_id, type);
@@ -0,0 +1,9 @@
+-- Achievements a user has earned. Which exist, and what earns them, is
+-- defined in code; a row records only when each was earned.
+CREATE TABLE user_achievements (
+	user_id TEXT NOT NULL,
+	achievement TEXT NOT NULL,
+	earned_at DATETIME NOT NULL,
+	PRIMARY KEY (user_id, achievement),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+-- The timezone a user's reading is counted in: which day a session falls on
+-- for daily stats and streaks. '' uses the server's.
+CREATE TABLE stats_preferences (
+	user_id TEXT PRIMARY KEY,
+	timezone TEXT NOT NULL DEFAULT '',
+	updated_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
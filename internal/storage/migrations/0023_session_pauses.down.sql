@@ -0,0 +1,3 @@
+ALTER TABLE reading_sessions DROP COLUMN last_active_at;
+ALTER TABLE reading_sessions DROP COLUMN paused_seconds;
+ALTER TABLE reading_sessions DROP COLUMN paused_at;
@@ -0,0 +1,5 @@
+-- Time left out of a session's duration: while paused, and gaps between
+-- the reader's heartbeats long enough to count as idle
+ALTER TABLE reading_sessions ADD COLUMN paused_at DATETIME;
+ALTER TABLE reading_sessions ADD COLUMN paused_seconds INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reading_sessions ADD COLUMN last_active_at DATETIME;
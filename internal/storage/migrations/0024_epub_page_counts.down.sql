@@ -0,0 +1 @@
+-- Nothing to undo: the estimates are kept and are harmless
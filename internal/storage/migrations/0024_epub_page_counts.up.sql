@@ -0,0 +1,3 @@
+-- EPUB page counts are now estimated from their text, so read their
+-- structure again on next use
+UPDATE books SET structure_updated_at = NULL WHERE file_format = 'epub';
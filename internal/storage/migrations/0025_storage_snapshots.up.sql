@@ -0,0 +1,9 @@
+-- Daily record of disk use, so admins can see how fast the library grows
+CREATE TABLE IF NOT EXISTS storage_snapshots (
+    snapshot_date TEXT PRIMARY KEY, -- YYYY-MM-DD
+    free_bytes INTEGER NOT NULL DEFAULT 0,
+    books_bytes INTEGER NOT NULL DEFAULT 0,
+    covers_bytes INTEGER NOT NULL DEFAULT 0,
+    database_bytes INTEGER NOT NULL DEFAULT 0,
+    recorded_at DATETIME NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Dominant colors of each book's cover, comma-separated "#rrggbb"; NULL
+-- until computed, empty when the cover has none that can be read
+ALTER TABLE books ADD COLUMN cover_palette TEXT;
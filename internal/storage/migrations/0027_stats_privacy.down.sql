@@ -0,0 +1 @@
+ALTER TABLE stats_preferences DROP COLUMN privacy_mode;
@@ -0,0 +1,3 @@
+-- Privacy mode stops recording a user's reading sessions and daily stats
+-- and hides their activity from the feed
+ALTER TABLE stats_preferences ADD COLUMN privacy_mode INTEGER NOT NULL DEFAULT 0;
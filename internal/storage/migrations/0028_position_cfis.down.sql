@@ -0,0 +1 @@
+ALTER TABLE reading_positions DROP COLUMN cfi;
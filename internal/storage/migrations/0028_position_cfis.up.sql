@@ -0,0 +1,3 @@
+-- Reading positions in EPUBs are also kept as a CFI, which other readers
+-- understand. Empty until the position is normalized.
+ALTER TABLE reading_positions ADD COLUMN cfi TEXT NOT NULL DEFAULT '';
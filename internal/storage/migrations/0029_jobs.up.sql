@@ -0,0 +1,31 @@
+-- Background jobs over many items, such as bulk metadata refreshes. Items
+-- are saved with their results as they finish, so a job resumes where it
+-- stopped after being paused or the server restarting.
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'queued',
+	total INTEGER NOT NULL DEFAULT 0,
+	succeeded INTEGER NOT NULL DEFAULT 0,
+	failed INTEGER NOT NULL DEFAULT 0,
+	skipped INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	finished_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_jobs_user ON jobs(user_id, created_at);
+CREATE INDEX idx_jobs_status ON jobs(status, created_at);
+
+CREATE TABLE job_items (
+	job_id TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	item_id TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	reason TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	updated_at DATETIME NOT NULL,
+	PRIMARY KEY (job_id, seq),
+	FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE job_items DROP COLUMN changes;
+ALTER TABLE jobs DROP COLUMN dry_run;
@@ -0,0 +1,3 @@
+-- Dry-run jobs, and what each job item changed or would change
+ALTER TABLE jobs ADD COLUMN dry_run BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE job_items ADD COLUMN changes TEXT NOT NULL DEFAULT '';
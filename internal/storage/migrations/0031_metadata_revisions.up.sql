@@ -0,0 +1,13 @@
+-- Each change to a book's metadata, with the old and new values, so a bad
+-- refresh can be undone
+CREATE TABLE metadata_revisions (
+	book_id TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	user_id TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '[]',
+	revert_of INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (book_id, revision),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+DROP TABLE comic_filename_patterns;
@@ -0,0 +1,8 @@
+-- Custom comic filename patterns, tried before the built-in parser's
+CREATE TABLE comic_filename_patterns (
+	id TEXT PRIMARY KEY,
+	pattern TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL
+);
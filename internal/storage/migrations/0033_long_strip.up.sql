@@ -0,0 +1,2 @@
+-- Comics read as one continuous vertical strip, such as webtoons
+ALTER TABLE books ADD COLUMN long_strip BOOLEAN NOT NULL DEFAULT 0;
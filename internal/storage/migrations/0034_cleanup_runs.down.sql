@@ -0,0 +1 @@
+DROP TABLE cleanup_runs;
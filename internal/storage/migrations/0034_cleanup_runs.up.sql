@@ -0,0 +1,8 @@
+-- What each pass of the data directory cleanup removed
+CREATE TABLE cleanup_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	files INTEGER NOT NULL DEFAULT 0,
+	bytes INTEGER NOT NULL DEFAULT 0,
+	kinds TEXT NOT NULL DEFAULT '{}', -- JSON counts by kind of leftover
+	ran_at DATETIME NOT NULL
+);
@@ -0,0 +1,11 @@
+-- How each book's file last looked on disk when verified, and what it
+-- should look like once webby has written to it itself
+CREATE TABLE file_checks (
+	book_id TEXT PRIMARY KEY REFERENCES books(id) ON DELETE CASCADE,
+	hash TEXT,    -- Expected content hash; NULL uses the book's file_hash
+	size INTEGER, -- Expected size; NULL uses the book's file_size
+	problem TEXT NOT NULL DEFAULT '', -- missing, unreadable, modified or size_mismatch
+	expected TEXT NOT NULL DEFAULT '',
+	actual TEXT NOT NULL DEFAULT '',
+	checked_at DATETIME NOT NULL
+);
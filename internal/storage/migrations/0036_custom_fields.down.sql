@@ -0,0 +1,2 @@
+DROP TABLE book_custom_values;
+DROP TABLE custom_fields;
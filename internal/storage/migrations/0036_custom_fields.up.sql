@@ -0,0 +1,20 @@
+-- Fields admins add to every book, like Calibre's custom columns
+CREATE TABLE custom_fields (
+	id TEXT PRIMARY KEY,
+	key TEXT NOT NULL UNIQUE,         -- Name used in requests and smart collection rules
+	name TEXT NOT NULL,               -- Label shown to users
+	type TEXT NOT NULL,               -- text, number, bool, date or enum
+	options TEXT NOT NULL DEFAULT '', -- JSON array of an enum's choices
+	created_at DATETIME NOT NULL
+);
+
+-- Each user's value of a custom field for a book, in the canonical text
+-- form of the field's type
+CREATE TABLE book_custom_values (
+	book_id TEXT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	field_id TEXT NOT NULL REFERENCES custom_fields(id) ON DELETE CASCADE,
+	value TEXT NOT NULL,
+	PRIMARY KEY (book_id, user_id, field_id)
+);
+CREATE INDEX idx_book_custom_values_user ON book_custom_values(user_id, field_id);
@@ -0,0 +1,3 @@
+-- The metadata provider a bulk refresh job was asked to use, such as a
+-- plugin, or '' for the usual ones
+ALTER TABLE jobs ADD COLUMN provider TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP TABLE opds_sources;
@@ -0,0 +1,14 @@
+-- Remote OPDS catalogs, such as another Calibre-Web or Kavita server, that
+-- a user browses and imports books from. The password is kept as entered
+-- since the remote server needs it to log in.
+CREATE TABLE opds_sources (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,             -- The catalog's root feed
+	username TEXT NOT NULL DEFAULT '',
+	password TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_opds_sources_user ON opds_sources(user_id, name);
@@ -0,0 +1,3 @@
+DROP TABLE mirror_books;
+DROP TABLE mirrors;
+DROP TABLE sync_keys;
@@ -0,0 +1,50 @@
+-- Keys other Webby servers mirror collections with, acting as the key's
+-- user. Only a SHA-256 hash of each key is stored.
+CREATE TABLE sync_keys (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL,
+	last_used_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_sync_keys_user ON sync_keys(user_id);
+
+-- Other servers a user's collections are pulled from or pushed to. The
+-- API key is the other server's, so it's kept as given.
+CREATE TABLE mirrors (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	api_key TEXT NOT NULL,
+	direction TEXT NOT NULL,
+	collections TEXT NOT NULL DEFAULT '[]', -- JSON array of collection names
+	include_files INTEGER NOT NULL DEFAULT 0,
+	conflict_rule TEXT NOT NULL,
+	interval_minutes INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	last_job_id TEXT NOT NULL DEFAULT '',
+	last_sync_at DATETIME,
+	last_status TEXT NOT NULL DEFAULT '',
+	last_error TEXT NOT NULL DEFAULT '',
+	last_result TEXT NOT NULL DEFAULT '', -- JSON MirrorResult
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_mirrors_user ON mirrors(user_id);
+
+-- Books a destination got from a source, by the source's ID. peer_id is
+-- the mirror that pulled them, or the sync key they were pushed with.
+-- synced_print is the fingerprint of the source's metadata at the last
+-- sync, which tells each side whether it changed since.
+CREATE TABLE mirror_books (
+	peer_id TEXT NOT NULL,
+	source_id TEXT NOT NULL,
+	book_id TEXT NOT NULL,
+	synced_print TEXT NOT NULL DEFAULT '',
+	synced_at DATETIME NOT NULL,
+	PRIMARY KEY (peer_id, source_id),
+	FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_mirror_books_book ON mirror_books(book_id);
@@ -0,0 +1 @@
+DROP TABLE tracker_connections;
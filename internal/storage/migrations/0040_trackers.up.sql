@@ -0,0 +1,17 @@
+-- External reading trackers, such as Hardcover or a user's own webhook,
+-- that are sent a user's read status changes. The token is kept as entered
+-- since the tracker needs it.
+CREATE TABLE tracker_connections (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	target TEXT NOT NULL,
+	token TEXT NOT NULL DEFAULT '',
+	enabled INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL,
+	last_sent_at DATETIME,
+	last_error TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_tracker_connections_user ON tracker_connections(user_id, created_at);
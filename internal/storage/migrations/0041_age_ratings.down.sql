@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN max_age_rating;
+ALTER TABLE books DROP COLUMN age_rating;
@@ -0,0 +1,5 @@
+-- Age ratings on books, from metadata or set by hand, and the highest
+-- rating each user may see. An empty restriction means the user sees
+-- everything.
+ALTER TABLE books ADD COLUMN age_rating TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN max_age_rating TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN profile_pin_hash;
+DROP TABLE profile_collections;
+DROP TABLE profiles;
@@ -0,0 +1,22 @@
+-- Restricted profiles, such as one for each child, that an account can
+-- switch to. A profile only sees the books in the collections it is
+-- allowed, and leaving it takes the account's profile PIN.
+CREATE TABLE profiles (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	max_age_rating TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_profiles_user ON profiles(user_id, name);
+
+CREATE TABLE profile_collections (
+	profile_id TEXT NOT NULL,
+	collection_id TEXT NOT NULL,
+	PRIMARY KEY (profile_id, collection_id),
+	FOREIGN KEY (profile_id) REFERENCES profiles(id) ON DELETE CASCADE,
+	FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+);
+
+ALTER TABLE users ADD COLUMN profile_pin_hash TEXT NOT NULL DEFAULT '';
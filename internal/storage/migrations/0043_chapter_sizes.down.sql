@@ -0,0 +1 @@
+-- Nothing to undo: the sizes are kept and are harmless
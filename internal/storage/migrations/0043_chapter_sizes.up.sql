@@ -0,0 +1,3 @@
+-- EPUB tables of contents now give each chapter's size, so read their
+-- structure again on next use
+UPDATE books SET structure_updated_at = NULL WHERE file_format = 'epub';
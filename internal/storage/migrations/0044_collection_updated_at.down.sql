@@ -0,0 +1,6 @@
+DROP TRIGGER collections_touch_rule_delete;
+DROP TRIGGER collections_touch_rule_insert;
+DROP TRIGGER collections_touch_book_delete;
+DROP TRIGGER collections_touch_book_insert;
+DROP TRIGGER collections_touch_update;
+ALTER TABLE collections DROP COLUMN updated_at;
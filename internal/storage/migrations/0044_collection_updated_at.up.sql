@@ -0,0 +1,24 @@
+-- When a collection's name, rules, or books last changed, so clients can
+-- tell which collections to fetch again
+ALTER TABLE collections ADD COLUMN updated_at DATETIME;
+UPDATE collections SET updated_at = created_at;
+
+CREATE TRIGGER collections_touch_update AFTER UPDATE OF name, rule_logic ON collections BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER collections_touch_book_insert AFTER INSERT ON book_collections BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.collection_id;
+END;
+
+CREATE TRIGGER collections_touch_book_delete AFTER DELETE ON book_collections BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = OLD.collection_id;
+END;
+
+CREATE TRIGGER collections_touch_rule_insert AFTER INSERT ON collection_rules BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.collection_id;
+END;
+
+CREATE TRIGGER collections_touch_rule_delete AFTER DELETE ON collection_rules BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = OLD.collection_id;
+END;
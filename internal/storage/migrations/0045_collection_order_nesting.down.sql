@@ -0,0 +1,9 @@
+DROP TRIGGER collections_touch_update;
+CREATE TRIGGER collections_touch_update AFTER UPDATE OF name, rule_logic ON collections BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.id;
+END;
+
+DROP TRIGGER collections_delete_parent;
+DROP INDEX idx_collections_parent;
+ALTER TABLE collections DROP COLUMN parent_id;
+ALTER TABLE book_collections DROP COLUMN position;
@@ -0,0 +1,18 @@
+-- Books in a static collection keep the order they're put in, like a
+-- reading list's. Books already in one sort by title until reordered.
+ALTER TABLE book_collections ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+
+-- A collection can sit inside another; deleting the outer one moves its
+-- subcollections to the top level
+ALTER TABLE collections ADD COLUMN parent_id TEXT;
+CREATE INDEX idx_collections_parent ON collections(parent_id);
+
+CREATE TRIGGER collections_delete_parent AFTER DELETE ON collections BEGIN
+	UPDATE collections SET parent_id = NULL WHERE parent_id = OLD.id;
+END;
+
+-- Moving a collection changes it too
+DROP TRIGGER collections_touch_update;
+CREATE TRIGGER collections_touch_update AFTER UPDATE OF name, rule_logic, parent_id ON collections BEGIN
+	UPDATE collections SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.id;
+END;
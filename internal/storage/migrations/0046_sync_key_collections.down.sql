@@ -0,0 +1 @@
+ALTER TABLE sync_keys DROP COLUMN collections;
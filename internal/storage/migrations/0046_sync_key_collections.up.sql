@@ -0,0 +1,3 @@
+-- A sync key only reaches the collections it was made for. Keys made
+-- before reach none, and have to be made again.
+ALTER TABLE sync_keys ADD COLUMN collections TEXT NOT NULL DEFAULT '[]'; -- JSON array of collection names
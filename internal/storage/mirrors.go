@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Sync Key Methods ====================
+
+// CreateSyncKey saves a new sync key, found later by the hash of its token
+func (d *Database) CreateSyncKey(key *models.SyncKey, tokenHash string) error {
+	collections, err := json.Marshal(key.Collections)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO sync_keys (id, user_id, name, collections, token_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.UserID, key.Name, string(collections), tokenHash, key.CreatedAt,
+	)
+	return err
+}
+
+// ListSyncKeys returns a user's sync keys, oldest first
+func (d *Database) ListSyncKeys(userID string) ([]*models.SyncKey, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, collections, created_at, last_used_at
+		FROM sync_keys WHERE user_id = ? ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.SyncKey
+	for rows.Next() {
+		key, err := scanSyncKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetSyncKeyByToken returns the sync key whose token has the given hash,
+// or sql.ErrNoRows if there is none
+func (d *Database) GetSyncKeyByToken(tokenHash string) (*models.SyncKey, error) {
+	return scanSyncKey(d.db.QueryRow(`
+		SELECT id, user_id, name, collections, created_at, last_used_at
+		FROM sync_keys WHERE token_hash = ?`, tokenHash))
+}
+
+// scanSyncKey reads a sync key from a row
+func scanSyncKey(row interface{ Scan(...interface{}) error }) (*models.SyncKey, error) {
+	key := &models.SyncKey{}
+	var collections string
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &collections, &key.CreatedAt, &key.LastUsedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(collections), &key.Collections); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchSyncKey records that a sync key was just used
+func (d *Database) TouchSyncKey(keyID string, at time.Time) error {
+	_, err := d.db.Exec(`UPDATE sync_keys SET last_used_at = ? WHERE id = ?`, at, keyID)
+	return err
+}
+
+// DeleteSyncKey removes a user's sync key and forgets which books were
+// pushed with it, or returns sql.ErrNoRows if the user has no such key.
+// The books themselves are kept.
+func (d *Database) DeleteSyncKey(keyID, userID string) error {
+	result, err := d.db.Exec(`DELETE FROM sync_keys WHERE id = ? AND user_id = ?`, keyID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = d.db.Exec(`DELETE FROM mirror_books WHERE peer_id = ?`, keyID)
+	return err
+}
+
+// ==================== Mirror Methods ====================
+
+// mirrorColumns is the column list scanned by queryMirrors
+const mirrorColumns = `id, user_id, name, url, api_key, direction, collections, include_files, conflict_rule,
+	interval_minutes, created_at, last_job_id, last_sync_at, last_status, last_error, last_result`
+
+// CreateMirror saves a new mirror
+func (d *Database) CreateMirror(mirror *models.Mirror) error {
+	collections, err := json.Marshal(mirror.Collections)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO mirrors (id, user_id, name, url, api_key, direction, collections, include_files,
+			conflict_rule, interval_minutes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		mirror.ID, mirror.UserID, mirror.Name, mirror.URL, mirror.APIKey, mirror.Direction, string(collections),
+		mirror.IncludeFiles, mirror.ConflictRule, mirror.IntervalMinutes, mirror.CreatedAt,
+	)
+	return err
+}
+
+// ListMirrors returns a user's mirrors by name
+func (d *Database) ListMirrors(userID string) ([]*models.Mirror, error) {
+	return d.queryMirrors(`SELECT `+mirrorColumns+` FROM mirrors WHERE user_id = ?
+		ORDER BY name COLLATE NOCASE, created_at`, userID)
+}
+
+// ListScheduledMirrors returns every user's mirrors that sync on an
+// interval
+func (d *Database) ListScheduledMirrors() ([]*models.Mirror, error) {
+	return d.queryMirrors(`SELECT ` + mirrorColumns + ` FROM mirrors WHERE interval_minutes > 0`)
+}
+
+// GetMirror returns a mirror by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetMirror(id string) (*models.Mirror, error) {
+	mirrors, err := d.queryMirrors(`SELECT `+mirrorColumns+` FROM mirrors WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(mirrors) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return mirrors[0], nil
+}
+
+// queryMirrors returns the mirrors a query finds
+func (d *Database) queryMirrors(query string, args ...interface{}) ([]*models.Mirror, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mirrors []*models.Mirror
+	for rows.Next() {
+		mirror := &models.Mirror{}
+		var collections, result string
+		if err := rows.Scan(&mirror.ID, &mirror.UserID, &mirror.Name, &mirror.URL, &mirror.APIKey,
+			&mirror.Direction, &collections, &mirror.IncludeFiles, &mirror.ConflictRule, &mirror.IntervalMinutes,
+			&mirror.CreatedAt, &mirror.LastJobID, &mirror.LastSyncAt, &mirror.LastStatus, &mirror.LastError, &result); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(collections), &mirror.Collections); err != nil {
+			return nil, err
+		}
+		if result != "" {
+			mirror.LastResult = &models.MirrorResult{}
+			if err := json.Unmarshal([]byte(result), mirror.LastResult); err != nil {
+				return nil, err
+			}
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return mirrors, rows.Err()
+}
+
+// SetMirrorJob records the job syncing a mirror
+func (d *Database) SetMirrorJob(mirrorID, jobID string) error {
+	_, err := d.db.Exec(`UPDATE mirrors SET last_job_id = ? WHERE id = ?`, jobID, mirrorID)
+	return err
+}
+
+// FinishMirrorSync records how a mirror's sync went. result is nil for a
+// sync that failed before changing anything.
+func (d *Database) FinishMirrorSync(mirrorID string, at time.Time, status, errMsg string, result *models.MirrorResult) error {
+	var data []byte
+	if result != nil {
+		var err error
+		if data, err = json.Marshal(result); err != nil {
+			return err
+		}
+	}
+	_, err := d.db.Exec(`
+		UPDATE mirrors SET last_sync_at = ?, last_status = ?, last_error = ?, last_result = ?
+		WHERE id = ?`,
+		at, status, errMsg, string(data), mirrorID,
+	)
+	return err
+}
+
+// DeleteMirror removes a mirror and forgets which books it pulled, or
+// returns sql.ErrNoRows if there is none with that ID. The books
+// themselves are kept.
+func (d *Database) DeleteMirror(id string) error {
+	result, err := d.db.Exec(`DELETE FROM mirrors WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = d.db.Exec(`DELETE FROM mirror_books WHERE peer_id = ?`, id)
+	return err
+}
+
+// ==================== Mirrored Book Methods ====================
+
+// GetMirrorBook returns the book a destination got from a peer under the
+// source's ID, and the fingerprint of its metadata at the last sync, or
+// sql.ErrNoRows if it has none
+func (d *Database) GetMirrorBook(peerID, sourceID string) (bookID, syncedPrint string, err error) {
+	err = d.db.QueryRow(`
+		SELECT book_id, synced_print FROM mirror_books WHERE peer_id = ? AND source_id = ?`,
+		peerID, sourceID,
+	).Scan(&bookID, &syncedPrint)
+	return bookID, syncedPrint, err
+}
+
+// SaveMirrorBook records that bookID is the destination's copy of a peer's
+// book, synced with the given fingerprint
+func (d *Database) SaveMirrorBook(peerID, sourceID, bookID, syncedPrint string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO mirror_books (peer_id, source_id, book_id, synced_print, synced_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (peer_id, source_id) DO UPDATE SET
+			book_id = excluded.book_id, synced_print = excluded.synced_print, synced_at = excluded.synced_at`,
+		peerID, sourceID, bookID, syncedPrint, time.Now(),
+	)
+	return err
+}
+
+// ListMirrorBookIDs returns the IDs of the books a destination got from a
+// peer
+func (d *Database) ListMirrorBookIDs(peerID string) ([]string, error) {
+	rows, err := d.db.Query(`SELECT book_id FROM mirror_books WHERE peer_id = ?`, peerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
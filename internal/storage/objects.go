@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/epub"
+)
+
+// objectGracePeriod is how long a newly stored object is kept even when
+// nothing references it yet, so an upload saving the record that will use
+// it isn't raced by a delete of the last book sharing it
+const objectGracePeriod = time.Hour
+
+// FileReferences counts the book records using a stored file, so a file
+// shared by several books is only removed with the last of them. Cleanup
+// also asks it which covers and books exist.
+type FileReferences interface {
+	CountFileReferences(path string) (int, error)
+	ReferencedFilePaths() (map[string]bool, error)
+	ReferencedCoverPaths() (map[string]bool, error)
+	BookIDs() (map[string]bool, error)
+}
+
+// SetFileReferences sets what DeleteFile, PruneObjects and Cleanup ask
+// whether a file is still used. Without it nothing is removed.
+func (fs *FileStorage) SetFileReferences(refs FileReferences) {
+	fs.refs = refs
+}
+
+// objectPath returns where content with the given SHA-256 hash and
+// extension is stored
+func (fs *FileStorage) objectPath(hash, ext string) string {
+	return filepath.Join(fs.objectsDir, hash[:2], hash+strings.ToLower(ext))
+}
+
+// IsObject reports whether path is in the content-addressed store, where
+// one file may be shared by several books
+func (fs *FileStorage) IsObject(path string) bool {
+	rel, err := filepath.Rel(fs.objectsDir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// StoreObject moves the file at path, whose SHA-256 hash is hash, into the
+// content-addressed store and returns its new path. If the same content is
+// already stored the file at path is removed instead, so identical uploads
+// take disk space once.
+func (fs *FileStorage) StoreObject(path, hash string) (string, error) {
+	if len(hash) < 2 {
+		return "", fmt.Errorf("invalid content hash %q", hash)
+	}
+	dst := fs.objectPath(hash, filepath.Ext(path))
+	if dst == path {
+		return dst, nil
+	}
+
+	epub.Invalidate(path)
+	if _, err := os.Stat(dst); err == nil {
+		if err := os.Remove(path); err != nil {
+			return "", err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return "", err
+		}
+		if err := moveFile(path, dst); err != nil {
+			return "", err
+		}
+	}
+
+	// Restarts the grace period until the caller's record references it
+	now := time.Now()
+	if err := os.Chtimes(dst, now, now); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// DetachObject copies a stored object to a file of book id's own and
+// returns its path, for changes such as writing metadata into the file that
+// mustn't reach the other books sharing it. Any other path is returned as
+// it is. The caller records the new path, then releases the object with
+// DeleteFile.
+func (fs *FileStorage) DetachObject(id, path string) (string, error) {
+	if !fs.IsObject(path) {
+		return path, nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	return fs.SaveBookWithExt(id, src, filepath.Ext(path))
+}
+
+// releaseObject removes a stored object unless a book still uses it or it
+// was stored too recently to tell. PruneObjects catches objects kept here
+// that end up unused.
+func (fs *FileStorage) releaseObject(path string) error {
+	if fs.refs == nil {
+		return nil
+	}
+	count, err := fs.refs.CountFileReferences(path)
+	if err != nil || count > 0 {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if time.Since(info.ModTime()) < objectGracePeriod {
+		return nil
+	}
+
+	epub.Invalidate(path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(filepath.Dir(path)) // Only succeeds once the directory is empty
+	return nil
+}
+
+// PruneResult is what PruneObjects removed
+type PruneResult struct {
+	Files int
+	Bytes int64
+}
+
+// PruneObjects removes stored objects no book uses, other than those still
+// in their grace period
+func (fs *FileStorage) PruneObjects() (*PruneResult, error) {
+	result := &PruneResult{}
+	if fs.refs == nil {
+		return result, nil
+	}
+	referenced, err := fs.refs.ReferencedFilePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-objectGracePeriod)
+	err = filepath.Walk(fs.objectsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == fs.objectsDir {
+				return filepath.SkipDir // Nothing stored yet
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || referenced[path] || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		epub.Invalidate(path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		result.Files++
+		result.Bytes += info.Size()
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== OPDS Source Methods ====================
+
+// CreateOPDSSource saves a remote OPDS catalog for a user
+func (d *Database) CreateOPDSSource(source *models.OPDSSource) error {
+	_, err := d.db.Exec(`
+		INSERT INTO opds_sources (id, user_id, name, url, username, password, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		source.ID, source.UserID, source.Name, source.URL, source.Username, source.Password, source.CreatedAt,
+	)
+	source.HasPassword = source.Password != ""
+	return err
+}
+
+// ListOPDSSources returns a user's remote OPDS catalogs by name
+func (d *Database) ListOPDSSources(userID string) ([]*models.OPDSSource, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, url, username, password, created_at
+		FROM opds_sources WHERE user_id = ? ORDER BY name COLLATE NOCASE, created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*models.OPDSSource
+	for rows.Next() {
+		source, err := scanOPDSSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, rows.Err()
+}
+
+// GetOPDSSource returns a remote OPDS catalog by ID
+func (d *Database) GetOPDSSource(id string) (*models.OPDSSource, error) {
+	return scanOPDSSource(d.db.QueryRow(`
+		SELECT id, user_id, name, url, username, password, created_at
+		FROM opds_sources WHERE id = ?`, id))
+}
+
+// scanOPDSSource reads a remote OPDS catalog from a row
+func scanOPDSSource(row interface{ Scan(...interface{}) error }) (*models.OPDSSource, error) {
+	source := &models.OPDSSource{}
+	if err := row.Scan(&source.ID, &source.UserID, &source.Name, &source.URL,
+		&source.Username, &source.Password, &source.CreatedAt); err != nil {
+		return nil, err
+	}
+	source.HasPassword = source.Password != ""
+	return source, nil
+}
+
+// DeleteOPDSSource removes a remote OPDS catalog, or returns sql.ErrNoRows
+// if there is none with that ID. Books imported from it are kept.
+func (d *Database) DeleteOPDSSource(id string) error {
+	result, err := d.db.Exec(`DELETE FROM opds_sources WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
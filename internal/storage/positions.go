@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Position CFI Methods ====================
+
+// SetReadingPositionCFI records the CFI of a reading position. Normalizing
+// doesn't move the reader, so updated_at is left alone.
+func (d *Database) SetReadingPositionCFI(bookID, userID, cfi string) error {
+	_, err := d.db.Exec(`UPDATE reading_positions SET cfi = ? WHERE book_id = ? AND user_id = ?`, cfi, bookID, userID)
+	return err
+}
+
+// SetAnnotationCFI records the CFI of an annotation, leaving updated_at
+// alone like UpdateAnnotationChapter
+func (d *Database) SetAnnotationCFI(annotationID, cfi string) error {
+	_, err := d.db.Exec(`UPDATE annotations SET cfi = ? WHERE id = ?`, cfi, annotationID)
+	return err
+}
+
+// ListAnnotationsWithoutCFI returns every user's annotations in a book that
+// have no CFI
+func (d *Database) ListAnnotationsWithoutCFI(bookID string) ([]*models.Annotation, error) {
+	rows, err := d.db.Query(`
+		SELECT id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, visibility, created_at, updated_at
+		FROM annotations
+		WHERE book_id = ? AND COALESCE(cfi, '') = ''
+		ORDER BY chapter ASC, start_offset ASC`, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var annotations []*models.Annotation
+	for rows.Next() {
+		ann := &models.Annotation{}
+		var cfi *string // Empty or NULL, which older rows can have
+		if err := rows.Scan(&ann.ID, &ann.BookID, &ann.UserID, &ann.Chapter, &cfi, &ann.StartOffset, &ann.EndOffset,
+			&ann.SelectedText, &ann.Note, &ann.Color, &ann.Visibility, &ann.CreatedAt, &ann.UpdatedAt); err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, ann)
+	}
+	return annotations, rows.Err()
+}
+
+// ListBooksWithoutCFIs returns the IDs of EPUBs with a reading position or
+// annotation that has no CFI yet
+func (d *Database) ListBooksWithoutCFIs() ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT id FROM books
+		WHERE file_format = ? AND (
+			EXISTS (SELECT 1 FROM reading_positions rp WHERE rp.book_id = books.id AND rp.cfi = '')
+			OR EXISTS (SELECT 1 FROM annotations a WHERE a.book_id = books.id AND COALESCE(a.cfi, '') = ''))
+		ORDER BY id`, models.FileFormatEPUB)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ClearBookCFIs forgets the CFIs of every position and annotation in a
+// book, for when its file is replaced and they no longer point anywhere
+func (d *Database) ClearBookCFIs(bookID string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"reading_positions", "annotations"} {
+		if _, err := tx.Exec(`UPDATE `+table+` SET cfi = '' WHERE book_id = ?`, bookID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
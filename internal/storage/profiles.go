@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Profile Methods ====================
+
+// CreateProfile saves a new restricted profile and the collections it may
+// see
+func (d *Database) CreateProfile(profile *models.Profile) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO profiles (id, user_id, name, max_age_rating, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		profile.ID, profile.UserID, profile.Name, profile.MaxAgeRating, profile.CreatedAt,
+	); err != nil {
+		return err
+	}
+	if err := setProfileCollections(tx, profile); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateProfile saves a profile's name, age rating, and collections
+func (d *Database) UpdateProfile(profile *models.Profile) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE profiles SET name = ?, max_age_rating = ? WHERE id = ?`,
+		profile.Name, profile.MaxAgeRating, profile.ID); err != nil {
+		return err
+	}
+	if err := setProfileCollections(tx, profile); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setProfileCollections replaces the collections a profile may see
+func setProfileCollections(tx *sql.Tx, profile *models.Profile) error {
+	if _, err := tx.Exec(`DELETE FROM profile_collections WHERE profile_id = ?`, profile.ID); err != nil {
+		return err
+	}
+	for _, collectionID := range profile.CollectionIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO profile_collections (profile_id, collection_id) VALUES (?, ?)`,
+			profile.ID, collectionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListProfiles returns an account's profiles by name
+func (d *Database) ListProfiles(userID string) ([]*models.Profile, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, max_age_rating, created_at FROM profiles
+		WHERE user_id = ? ORDER BY name COLLATE NOCASE, created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []*models.Profile
+	for rows.Next() {
+		p := &models.Profile{}
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.MaxAgeRating, &p.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range profiles {
+		if p.CollectionIDs, err = d.listProfileCollectionIDs(p.ID); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// GetProfile returns a profile by ID, or sql.ErrNoRows if there is none
+func (d *Database) GetProfile(id string) (*models.Profile, error) {
+	p := &models.Profile{}
+	err := d.db.QueryRow(`SELECT id, user_id, name, max_age_rating, created_at FROM profiles WHERE id = ?`, id).
+		Scan(&p.ID, &p.UserID, &p.Name, &p.MaxAgeRating, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if p.CollectionIDs, err = d.listProfileCollectionIDs(p.ID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// listProfileCollectionIDs returns the IDs of the collections a profile may
+// see
+func (d *Database) listProfileCollectionIDs(profileID string) ([]string, error) {
+	rows, err := d.db.Query(`SELECT collection_id FROM profile_collections WHERE profile_id = ? ORDER BY collection_id`, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteProfile removes a profile. Tokens issued for it stop working.
+func (d *Database) DeleteProfile(id string) error {
+	_, err := d.db.Exec(`DELETE FROM profiles WHERE id = ?`, id)
+	return err
+}
+
+// GetProfilePINHash returns the hash of the PIN that leaves an account's
+// profiles, or "" if none is set
+func (d *Database) GetProfilePINHash(userID string) (string, error) {
+	var hash string
+	err := d.db.QueryRow(`SELECT profile_pin_hash FROM users WHERE id = ?`, userID).Scan(&hash)
+	return hash, err
+}
+
+// SetProfilePINHash sets the hash of the PIN that leaves an account's
+// profiles
+func (d *Database) SetProfilePINHash(userID, hash string) error {
+	_, err := d.db.Exec(`UPDATE users SET profile_pin_hash = ? WHERE id = ?`, hash, userID)
+	return err
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Metadata Revision Methods ====================
+
+// AddMetadataRevision saves a change to a book's metadata as its next
+// revision, setting rev.Revision
+func (d *Database) AddMetadataRevision(rev *models.MetadataRevision) error {
+	changes, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(revision), 0) + 1 FROM metadata_revisions WHERE book_id = ?`,
+		rev.BookID).Scan(&rev.Revision); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO metadata_revisions (book_id, revision, user_id, source, changes, revert_of, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rev.BookID, rev.Revision, rev.UserID, rev.Source, string(changes), rev.RevertOf, rev.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListMetadataRevisions returns a book's metadata revisions, newest first
+func (d *Database) ListMetadataRevisions(bookID string) ([]*models.MetadataRevision, error) {
+	return d.queryMetadataRevisions(`
+		SELECT book_id, revision, user_id, source, changes, revert_of, created_at
+		FROM metadata_revisions WHERE book_id = ? ORDER BY revision DESC`, bookID)
+}
+
+// GetMetadataRevision returns one of a book's metadata revisions, or
+// sql.ErrNoRows if it has no such revision
+func (d *Database) GetMetadataRevision(bookID string, rev int) (*models.MetadataRevision, error) {
+	revs, err := d.queryMetadataRevisions(`
+		SELECT book_id, revision, user_id, source, changes, revert_of, created_at
+		FROM metadata_revisions WHERE book_id = ? AND revision = ?`, bookID, rev)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return revs[0], nil
+}
+
+func (d *Database) queryMetadataRevisions(query string, args ...interface{}) ([]*models.MetadataRevision, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revs []*models.MetadataRevision
+	for rows.Next() {
+		rev := &models.MetadataRevision{}
+		var changes string
+		if err := rows.Scan(&rev.BookID, &rev.Revision, &rev.UserID, &rev.Source, &changes, &rev.RevertOf,
+			&rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &rev.Changes); err != nil {
+			return nil, err
+		}
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Storage Snapshot Methods ====================
+
+// SaveStorageSnapshot records a day's disk use, replacing any recorded
+// earlier the same day
+func (d *Database) SaveStorageSnapshot(s *models.StorageSnapshot) error {
+	_, err := d.db.Exec(`
+		INSERT INTO storage_snapshots (snapshot_date, free_bytes, books_bytes, covers_bytes, database_bytes, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(snapshot_date) DO UPDATE SET
+			free_bytes = excluded.free_bytes,
+			books_bytes = excluded.books_bytes,
+			covers_bytes = excluded.covers_bytes,
+			database_bytes = excluded.database_bytes,
+			recorded_at = excluded.recorded_at`,
+		s.Date, s.FreeBytes, s.BooksBytes, s.CoversBytes, s.DatabaseBytes, s.RecordedAt)
+	return err
+}
+
+// ListStorageSnapshots returns the snapshots from since onwards, oldest
+// first
+func (d *Database) ListStorageSnapshots(since time.Time) ([]models.StorageSnapshot, error) {
+	rows, err := d.db.Query(`
+		SELECT snapshot_date, free_bytes, books_bytes, covers_bytes, database_bytes, recorded_at
+		FROM storage_snapshots WHERE snapshot_date >= ?
+		ORDER BY snapshot_date`, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []models.StorageSnapshot
+	for rows.Next() {
+		var s models.StorageSnapshot
+		if err := rows.Scan(&s.Date, &s.FreeBytes, &s.BooksBytes, &s.CoversBytes, &s.DatabaseBytes, &s.RecordedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
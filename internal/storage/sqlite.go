@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLite connection tuning. WAL lets readers run alongside the single
+// writer; the busy timeout makes a writer wait for the lock instead of
+// failing with "database is locked".
+const (
+	busyTimeout     = 5 * time.Second
+	maxOpenConns    = 8
+	connMaxIdleTime = 5 * time.Minute
+
+	// Retries for statements that still hit SQLITE_BUSY after the busy
+	// timeout, with the delay doubling after each attempt
+	busyRetries    = 3
+	busyRetryDelay = 50 * time.Millisecond
+)
+
+// openSQLite opens the database at path with WAL journaling, enforced
+// foreign keys, a busy timeout, and a bounded connection pool. Write
+// transactions take the lock when they begin rather than failing part way
+// through.
+func openSQLite(path string) (*sqliteDB, error) {
+	params := url.Values{}
+	params.Set("_journal_mode", "WAL")
+	params.Set("_synchronous", "NORMAL")
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", strconv.FormatInt(busyTimeout.Milliseconds(), 10))
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxOpenConns)
+	db.SetConnMaxIdleTime(connMaxIdleTime)
+
+	// Open is lazy; connect now so a bad path or locked file fails here
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteDB{DB: db}, nil
+}
+
+// sqliteDB retries statements that fail with SQLITE_BUSY or SQLITE_LOCKED.
+// QueryRow can't be retried since its error only surfaces at Scan, so it
+// relies on the busy timeout alone.
+type sqliteDB struct {
+	*sql.DB
+}
+
+// Exec runs a statement, retrying while the database is busy
+func (s *sqliteDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := retryBusy(func() error {
+		var err error
+		result, err = s.DB.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// Query runs a query, retrying while the database is busy
+func (s *sqliteDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := retryBusy(func() error {
+		var err error
+		rows, err = s.DB.Query(query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// Begin starts a transaction, retrying while the database is busy.
+// Statements inside the transaction aren't retried; callers roll back and
+// report the error.
+func (s *sqliteDB) Begin() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retryBusy(func() error {
+		var err error
+		tx, err = s.DB.Begin()
+		return err
+	})
+	return tx, err
+}
+
+// retryBusy calls fn until it succeeds, fails with an error other than
+// busy or locked, or runs out of retries
+func retryBusy(fn func() error) error {
+	delay := busyRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt == busyRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isBusy reports whether err means another connection holds the lock
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestSQLitePragmas(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var journalMode string
+	require.NoError(t, db.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	var foreignKeys, timeout int
+	require.NoError(t, db.db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	assert.Equal(t, 1, foreignKeys)
+	require.NoError(t, db.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout))
+	assert.Equal(t, int(busyTimeout.Milliseconds()), timeout)
+}
+
+func TestForeignKeysEnforced(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	book := &models.Book{ID: "book-1", UserID: "missing-user", Title: "Orphan", FilePath: "/path.epub", UploadedAt: time.Now()}
+	assert.Error(t, db.CreateBook(book))
+
+	// Books added without signing in belong to the reserved '' user
+	book.UserID = ""
+	require.NoError(t, db.CreateBook(book))
+
+	users, err := db.SearchUsers("", "")
+	require.NoError(t, err)
+	assert.Empty(t, users, "the reserved user isn't searchable")
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.CreateBook(&models.Book{
+				ID: uuid.New().String(), UserID: "user-1", Title: "Book", FilePath: "/path.epub", UploadedAt: time.Now(),
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	books, err := db.ListBooksForUser("user-1", "title", "asc")
+	require.NoError(t, err)
+	assert.Len(t, books, 40)
+}
+
+func TestRetryBusy(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+
+	calls := 0
+	err := retryBusy(func() error {
+		calls++
+		if calls < 3 {
+			return busy
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = retryBusy(func() error {
+		calls++
+		return busy
+	})
+	assert.True(t, isBusy(err))
+	assert.Equal(t, busyRetries+1, calls)
+
+	calls = 0
+	other := errors.New("constraint failed")
+	err = retryBusy(func() error {
+		calls++
+		return other
+	})
+	assert.Equal(t, other, err)
+	assert.Equal(t, 1, calls, "other errors aren't retried")
+}
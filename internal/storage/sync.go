@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Sync Methods ====================
+
+// GetSyncCursor returns the newest position in the sync change log
+func (d *Database) GetSyncCursor() (int64, error) {
+	var seq int64
+	err := d.db.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM sync_changes`).Scan(&seq)
+	return seq, err
+}
+
+// ListSyncChanges returns up to limit of a user's changes after since,
+// oldest first
+func (d *Database) ListSyncChanges(userID string, since int64, limit int) ([]models.SyncChange, error) {
+	rows, err := d.db.Query(`
+		SELECT seq, entity, entity_id, user_id, deleted, changed_at
+		FROM sync_changes
+		WHERE user_id = ? AND seq > ?
+		ORDER BY seq
+		LIMIT ?`, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []models.SyncChange
+	for rows.Next() {
+		var ch models.SyncChange
+		if err := rows.Scan(&ch.Seq, &ch.Entity, &ch.EntityID, &ch.UserID, &ch.Deleted, &ch.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, ch)
+	}
+	return changes, rows.Err()
+}
+
+// GetBookTag returns a book's membership in a tag
+func (d *Database) GetBookTag(bookID, tagID string) (*models.BookTag, error) {
+	bt := &models.BookTag{}
+	err := d.db.QueryRow(`
+		SELECT book_id, tag_id, added_at FROM book_tags WHERE book_id = ? AND tag_id = ?`,
+		bookID, tagID).Scan(&bt.BookID, &bt.TagID, &bt.AddedAt)
+	if err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
+
+// ListBookTagsForUser returns which books are in each of a user's tags
+func (d *Database) ListBookTagsForUser(userID string) ([]models.BookTag, error) {
+	rows, err := d.db.Query(`
+		SELECT bt.book_id, bt.tag_id, bt.added_at
+		FROM book_tags bt
+		INNER JOIN tags t ON t.id = bt.tag_id
+		WHERE t.user_id = ?
+		ORDER BY bt.tag_id, bt.added_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.BookTag
+	for rows.Next() {
+		var bt models.BookTag
+		if err := rows.Scan(&bt.BookID, &bt.TagID, &bt.AddedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, bt)
+	}
+	return tags, rows.Err()
+}
+
+// GetReadingListBook returns a book's place in a reading list
+func (d *Database) GetReadingListBook(listID, bookID string) (*models.ReadingListBook, error) {
+	lb := &models.ReadingListBook{}
+	err := d.db.QueryRow(`
+		SELECT book_id, list_id, added_at, position FROM book_reading_list WHERE list_id = ? AND book_id = ?`,
+		listID, bookID).Scan(&lb.BookID, &lb.ListID, &lb.AddedAt, &lb.Position)
+	if err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// ListReadingListBooksForUser returns the books in each of a user's reading
+// lists, in list order
+func (d *Database) ListReadingListBooksForUser(userID string) ([]models.ReadingListBook, error) {
+	rows, err := d.db.Query(`
+		SELECT brl.book_id, brl.list_id, brl.added_at, brl.position
+		FROM book_reading_list brl
+		INNER JOIN reading_lists rl ON rl.id = brl.list_id
+		WHERE rl.user_id = ?
+		ORDER BY brl.list_id, brl.position, brl.added_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.ReadingListBook
+	for rows.Next() {
+		var lb models.ReadingListBook
+		if err := rows.Scan(&lb.BookID, &lb.ListID, &lb.AddedAt, &lb.Position); err != nil {
+			return nil, err
+		}
+		books = append(books, lb)
+	}
+	return books, rows.Err()
+}
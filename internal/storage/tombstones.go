@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// deletedBookRetention is how long a deleted book's reading data is kept
+const deletedBookRetention = 90 * 24 * time.Hour
+
+// TombstoneBook deletes a book, first keeping its owner's annotations,
+// notes, position, read status, tags, lists, and collections in a
+// tombstone keyed by the file's hash. Uploading the same file again can then
+// restore them. Books without a hash or without any reading data are just
+// deleted.
+func (d *Database) TombstoneBook(book *models.Book) error {
+	if book.FileHash == "" {
+		return d.DeleteBook(book.ID)
+	}
+
+	data, err := d.bookDataForTombstone(book.ID, book.UserID)
+	if err != nil {
+		return err
+	}
+	if data.Empty() {
+		return d.DeleteBook(book.ID)
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Expired tombstones go, and so does an older one for the same file,
+	// which this one supersedes
+	now := time.Now()
+	if _, err := tx.Exec(`DELETE FROM deleted_books WHERE deleted_at < ? OR (user_id = ? AND file_hash = ?)`,
+		now.Add(-deletedBookRetention), book.UserID, book.FileHash); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO deleted_books (id, user_id, file_hash, title, author, data, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		book.ID, book.UserID, book.FileHash, book.Title, book.Author, string(encoded), now,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM books WHERE id = ?`, book.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// bookDataForTombstone gathers a user's reading data for a book
+func (d *Database) bookDataForTombstone(bookID, userID string) (*models.DeletedBookData, error) {
+	data := &models.DeletedBookData{}
+	var err error
+
+	if data.Annotations, err = d.GetAnnotationsForBook(bookID, userID); err != nil {
+		return nil, err
+	}
+	if data.Notes, err = d.GetBookNotesForBook(bookID, userID); err != nil {
+		return nil, err
+	}
+
+	data.Position, err = d.GetReadingPosition(bookID, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	err = d.db.QueryRow(`
+		SELECT COALESCE(read_status, 'unread'), date_completed, COALESCE(rating, 0)
+		FROM user_book_state WHERE user_id = ? AND book_id = ?`, userID, bookID,
+	).Scan(&data.ReadStatus, &data.DateCompleted, &data.Rating)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	for _, q := range []struct {
+		ids   *[]string
+		query string
+	}{
+		{&data.TagIDs, `SELECT t.id FROM tags t
+			INNER JOIN book_tags bt ON bt.tag_id = t.id
+			WHERE bt.book_id = ? AND t.user_id = ?`},
+		{&data.ReadingListIDs, `SELECT rl.id FROM reading_lists rl
+			INNER JOIN book_reading_list brl ON brl.list_id = rl.id
+			WHERE brl.book_id = ? AND rl.user_id = ?`},
+		{&data.CollectionIDs, `SELECT c.id FROM collections c
+			INNER JOIN book_collections bc ON bc.collection_id = c.id
+			WHERE bc.book_id = ? AND c.user_id = ?`},
+	} {
+		if *q.ids, err = d.queryIDs(q.query, bookID, userID); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// queryIDs returns the first column of every row a query selects
+func (d *Database) queryIDs(query string, args ...interface{}) ([]string, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetDeletedBookByHash returns the user's most recent unexpired tombstone
+// for a file hash, or sql.ErrNoRows if there is none
+func (d *Database) GetDeletedBookByHash(userID, fileHash string) (*models.DeletedBook, error) {
+	return d.scanDeletedBook(d.db.QueryRow(`
+		SELECT id, user_id, file_hash, title, author, data, deleted_at
+		FROM deleted_books
+		WHERE user_id = ? AND file_hash = ? AND deleted_at >= ?
+		ORDER BY deleted_at DESC LIMIT 1`,
+		userID, fileHash, time.Now().Add(-deletedBookRetention)))
+}
+
+// GetDeletedBook returns a tombstone by the deleted book's ID, or
+// sql.ErrNoRows if there is none
+func (d *Database) GetDeletedBook(id string) (*models.DeletedBook, error) {
+	return d.scanDeletedBook(d.db.QueryRow(`
+		SELECT id, user_id, file_hash, title, author, data, deleted_at
+		FROM deleted_books WHERE id = ? AND deleted_at >= ?`,
+		id, time.Now().Add(-deletedBookRetention)))
+}
+
+func (d *Database) scanDeletedBook(row *sql.Row) (*models.DeletedBook, error) {
+	deleted := &models.DeletedBook{}
+	var data string
+	if err := row.Scan(&deleted.ID, &deleted.UserID, &deleted.FileHash, &deleted.Title, &deleted.Author,
+		&data, &deleted.DeletedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &deleted.Data); err != nil {
+		return nil, err
+	}
+
+	deleted.Annotations = len(deleted.Data.Annotations)
+	deleted.Notes = len(deleted.Data.Notes)
+	deleted.Tags = len(deleted.Data.TagIDs)
+	deleted.ReadingLists = len(deleted.Data.ReadingListIDs)
+	deleted.Collections = len(deleted.Data.CollectionIDs)
+	deleted.HasPosition = deleted.Data.Position != nil
+	deleted.ReadStatus = deleted.Data.ReadStatus
+	return deleted, nil
+}
+
+// RestoreDeletedBook copies a tombstone's reading data onto bookID and
+// removes the tombstone. Tags, lists, and collections the owner has
+// deleted since are skipped.
+func (d *Database) RestoreDeletedBook(deleted *models.DeletedBook, bookID string) error {
+	data := deleted.Data
+	userID := deleted.UserID
+	now := time.Now()
+
+	type stmt struct {
+		query string
+		args  []interface{}
+	}
+	var stmts []stmt
+
+	for _, ann := range data.Annotations {
+		stmts = append(stmts, stmt{`
+			INSERT INTO annotations (id, book_id, user_id, chapter, cfi, start_offset, end_offset, selected_text, note, color, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			[]interface{}{uuid.New().String(), bookID, userID, ann.Chapter, ann.CFI, ann.StartOffset, ann.EndOffset,
+				ann.SelectedText, ann.Note, ann.Color, ann.CreatedAt, ann.UpdatedAt}})
+	}
+	for _, note := range data.Notes {
+		stmts = append(stmts, stmt{`
+			INSERT INTO book_notes (` + bookNoteColumns + `)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			[]interface{}{uuid.New().String(), bookID, userID, note.Title, note.Body, note.Revision, note.CreatedAt, note.UpdatedAt}})
+	}
+	if pos := data.Position; pos != nil {
+		stmts = append(stmts, stmt{`
+			INSERT INTO reading_positions (book_id, user_id, chapter, position, cfi, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(book_id, user_id) DO UPDATE SET
+				chapter = excluded.chapter,
+				position = excluded.position,
+				cfi = excluded.cfi,
+				updated_at = excluded.updated_at`,
+			[]interface{}{bookID, userID, pos.Chapter, pos.Position, pos.CFI, pos.UpdatedAt}})
+	}
+	if data.ReadStatus != "" || data.Rating != 0 {
+		status := data.ReadStatus
+		if status == "" {
+			status = models.ReadStatusUnread
+		}
+		stmts = append(stmts, stmt{`
+			INSERT INTO user_book_state (user_id, book_id, read_status, date_completed, rating, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, book_id) DO UPDATE SET
+				read_status = excluded.read_status,
+				date_completed = excluded.date_completed,
+				rating = excluded.rating,
+				updated_at = excluded.updated_at`,
+			[]interface{}{userID, bookID, status, data.DateCompleted, data.Rating, now}})
+	}
+	for _, tagID := range data.TagIDs {
+		stmts = append(stmts, stmt{`
+			INSERT OR IGNORE INTO book_tags (book_id, tag_id, added_at)
+			SELECT ?, id, ? FROM tags WHERE id = ? AND user_id = ?`,
+			[]interface{}{bookID, now, tagID, userID}})
+	}
+	for _, listID := range data.ReadingListIDs {
+		stmts = append(stmts, stmt{`
+			INSERT OR IGNORE INTO book_reading_list (book_id, list_id, added_at, position)
+			SELECT ?, id, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM book_reading_list WHERE list_id = ?)
+			FROM reading_lists WHERE id = ? AND user_id = ?`,
+			[]interface{}{bookID, now, listID, listID, userID}})
+	}
+	for _, collectionID := range data.CollectionIDs {
+		stmts = append(stmts, stmt{`
+			INSERT OR IGNORE INTO book_collections (book_id, collection_id)
+			SELECT ?, id FROM collections WHERE id = ? AND user_id = ?`,
+			[]interface{}{bookID, collectionID, userID}})
+	}
+	stmts = append(stmts, stmt{`DELETE FROM deleted_books WHERE id = ?`, []interface{}{deleted.ID}})
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, s := range stmts {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Tracker Connection Methods ====================
+
+// trackerColumns is the column list scanned by scanTrackerConnection
+const trackerColumns = `id, user_id, type, name, target, token, enabled, created_at, last_sent_at, last_error`
+
+// CreateTrackerConnection saves a user's link to a reading tracker
+func (d *Database) CreateTrackerConnection(conn *models.TrackerConnection) error {
+	_, err := d.db.Exec(`
+		INSERT INTO tracker_connections (id, user_id, type, name, target, token, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		conn.ID, conn.UserID, conn.Type, conn.Name, conn.Target, conn.Token, conn.Enabled, conn.CreatedAt,
+	)
+	conn.HasToken = conn.Token != ""
+	return err
+}
+
+// ListTrackerConnections returns a user's reading trackers, oldest first
+func (d *Database) ListTrackerConnections(userID string) ([]*models.TrackerConnection, error) {
+	return d.queryTrackerConnections(`SELECT `+trackerColumns+` FROM tracker_connections
+		WHERE user_id = ? ORDER BY created_at, id`, userID)
+}
+
+// ListEnabledTrackerConnections returns the reading trackers a user's read
+// status changes are sent to
+func (d *Database) ListEnabledTrackerConnections(userID string) ([]*models.TrackerConnection, error) {
+	return d.queryTrackerConnections(`SELECT `+trackerColumns+` FROM tracker_connections
+		WHERE user_id = ? AND enabled = 1 ORDER BY created_at, id`, userID)
+}
+
+// GetTrackerConnection returns a reading tracker by ID, or sql.ErrNoRows if
+// there is none
+func (d *Database) GetTrackerConnection(id string) (*models.TrackerConnection, error) {
+	conns, err := d.queryTrackerConnections(`SELECT `+trackerColumns+` FROM tracker_connections WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(conns) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return conns[0], nil
+}
+
+// queryTrackerConnections returns the reading trackers a query finds
+func (d *Database) queryTrackerConnections(query string, args ...interface{}) ([]*models.TrackerConnection, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conns []*models.TrackerConnection
+	for rows.Next() {
+		conn := &models.TrackerConnection{}
+		if err := rows.Scan(&conn.ID, &conn.UserID, &conn.Type, &conn.Name, &conn.Target, &conn.Token,
+			&conn.Enabled, &conn.CreatedAt, &conn.LastSentAt, &conn.LastError); err != nil {
+			return nil, err
+		}
+		conn.HasToken = conn.Token != ""
+		conns = append(conns, conn)
+	}
+	return conns, rows.Err()
+}
+
+// UpdateTrackerConnection saves a reading tracker's settings
+func (d *Database) UpdateTrackerConnection(conn *models.TrackerConnection) error {
+	_, err := d.db.Exec(`
+		UPDATE tracker_connections SET name = ?, target = ?, token = ?, enabled = ?
+		WHERE id = ?`,
+		conn.Name, conn.Target, conn.Token, conn.Enabled, conn.ID,
+	)
+	conn.HasToken = conn.Token != ""
+	return err
+}
+
+// RecordTrackerSend records when an update was last sent to a reading
+// tracker, and why it failed, or "" if it didn't
+func (d *Database) RecordTrackerSend(id string, at time.Time, errMsg string) error {
+	_, err := d.db.Exec(`UPDATE tracker_connections SET last_sent_at = ?, last_error = ? WHERE id = ?`, at, errMsg, id)
+	return err
+}
+
+// DeleteTrackerConnection removes a reading tracker, or returns
+// sql.ErrNoRows if there is none with that ID
+func (d *Database) DeleteTrackerConnection(id string) error {
+	result, err := d.db.Exec(`DELETE FROM tracker_connections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
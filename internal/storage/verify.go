@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// VerifyFile checks the file at path against the content hash and size
+// it's expected to have, returning the problem found, if any, with what
+// was expected and what's on disk. An empty hash or a zero size isn't
+// checked.
+func VerifyFile(path, hash string, size int64) (problem, expected, actual string) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return models.FileProblemMissing, "", ""
+	}
+	if err != nil {
+		return models.FileProblemUnreadable, "", ""
+	}
+	if hash != "" {
+		found, err := HashFile(path)
+		if err != nil {
+			return models.FileProblemUnreadable, "", ""
+		}
+		if found != hash {
+			return models.FileProblemModified, hash, found
+		}
+	}
+	if size > 0 && info.Size() != size {
+		return models.FileProblemSizeMismatch, strconv.FormatInt(size, 10), strconv.FormatInt(info.Size(), 10)
+	}
+	return "", "", ""
+}
+
+// ==================== File Check Methods ====================
+
+// ListBookIDsWithFiles returns the IDs of every book with a file on disk,
+// oldest first
+func (d *Database) ListBookIDsWithFiles() ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT id FROM books
+		WHERE file_path != '' AND COALESCE(content_source, 'digital') != 'physical'
+		ORDER BY uploaded_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ExpectedFile returns the content hash and size a book's file should
+// have: what webby last wrote to it, or else what was uploaded
+func (d *Database) ExpectedFile(bookID string) (hash string, size int64, err error) {
+	err = d.db.QueryRow(`
+		SELECT COALESCE(fc.hash, b.file_hash, ''), COALESCE(fc.size, b.file_size, 0)
+		FROM books b LEFT JOIN file_checks fc ON fc.book_id = b.id
+		WHERE b.id = ?`, bookID).Scan(&hash, &size)
+	return hash, size, err
+}
+
+// SetExpectedFile records the content hash and size a book's file should
+// now have, after webby has written to it or an admin has accepted it as
+// it is, clearing any problem found before
+func (d *Database) SetExpectedFile(bookID, hash string, size int64) error {
+	_, err := d.db.Exec(`
+		INSERT INTO file_checks (book_id, hash, size, checked_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(book_id) DO UPDATE SET
+			hash = excluded.hash, size = excluded.size,
+			problem = '', expected = '', actual = '', checked_at = excluded.checked_at`,
+		bookID, hash, size, time.Now())
+	return err
+}
+
+// SaveFileCheck records the result of verifying a book's file; an empty
+// problem means it's as expected
+func (d *Database) SaveFileCheck(bookID, problem, expected, actual string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO file_checks (book_id, problem, expected, actual, checked_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(book_id) DO UPDATE SET
+			problem = excluded.problem, expected = excluded.expected, actual = excluded.actual,
+			checked_at = excluded.checked_at`,
+		bookID, problem, expected, actual, time.Now())
+	return err
+}
+
+// ListFileProblems returns the books whose files failed their last
+// verification, most recently checked first
+func (d *Database) ListFileProblems() ([]models.FileProblem, error) {
+	rows, err := d.db.Query(`
+		SELECT fc.book_id, b.title, b.file_path, fc.problem, fc.expected, fc.actual, fc.checked_at
+		FROM file_checks fc JOIN books b ON b.id = fc.book_id
+		WHERE fc.problem != ''
+		ORDER BY fc.checked_at DESC, b.sort_title`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []models.FileProblem
+	for rows.Next() {
+		var p models.FileProblem
+		if err := rows.Scan(&p.BookID, &p.Title, &p.FilePath, &p.Problem, &p.Expected, &p.Actual, &p.CheckedAt); err != nil {
+			return nil, err
+		}
+		problems = append(problems, p)
+	}
+	return problems, rows.Err()
+}
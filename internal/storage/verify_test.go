@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestVerifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	require.NoError(t, os.WriteFile(path, []byte("dune"), 0644))
+	hash := HashBytes([]byte("dune"))
+
+	problem, _, _ := VerifyFile(path, hash, 4)
+	assert.Empty(t, problem)
+
+	problem, expected, actual := VerifyFile(path, HashBytes([]byte("other")), 4)
+	assert.Equal(t, models.FileProblemModified, problem)
+	assert.Equal(t, HashBytes([]byte("other")), expected)
+	assert.Equal(t, hash, actual)
+
+	problem, expected, actual = VerifyFile(path, "", 10)
+	assert.Equal(t, models.FileProblemSizeMismatch, problem, "the size is checked without a hash")
+	assert.Equal(t, "10", expected)
+	assert.Equal(t, "4", actual)
+
+	problem, _, _ = VerifyFile(path, "", 0)
+	assert.Empty(t, problem, "nothing recorded, nothing to compare")
+
+	problem, _, _ = VerifyFile(filepath.Join(t.TempDir(), "gone.epub"), hash, 4)
+	assert.Equal(t, models.FileProblemMissing, problem)
+}
+
+func TestFileChecks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	createTestUsers(t, db, "user-1")
+
+	book := &models.Book{ID: "book-1", UserID: "user-1", Title: "Dune", FilePath: "/books/dune.epub",
+		FileSize: 4, FileHash: "uploaded", FileFormat: models.FileFormatEPUB, UploadedAt: time.Now()}
+	require.NoError(t, db.CreateBook(book))
+	require.NoError(t, db.CreateBook(&models.Book{ID: "physical", UserID: "user-1", Title: "Paper",
+		ContentSource: models.ContentSourcePhysical, UploadedAt: time.Now()}))
+
+	ids, err := db.ListBookIDsWithFiles()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"book-1"}, ids)
+
+	hash, size, err := db.ExpectedFile("book-1")
+	require.NoError(t, err)
+	assert.Equal(t, "uploaded", hash, "the uploaded file's hash until webby writes to it")
+	assert.Equal(t, int64(4), size)
+
+	require.NoError(t, db.SaveFileCheck("book-1", models.FileProblemModified, "uploaded", "changed"))
+	problems, err := db.ListFileProblems()
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, "Dune", problems[0].Title)
+	assert.Equal(t, "changed", problems[0].Actual)
+
+	require.NoError(t, db.SetExpectedFile("book-1", "written", 9))
+	hash, size, err = db.ExpectedFile("book-1")
+	require.NoError(t, err)
+	assert.Equal(t, "written", hash)
+	assert.Equal(t, int64(9), size)
+	problems, err = db.ListFileProblems()
+	require.NoError(t, err)
+	assert.Empty(t, problems, "accepting the file clears its problem")
+
+	book.FileHash, book.FileSize = "replaced", 7
+	require.NoError(t, db.UpdateBookFile(book))
+	hash, size, err = db.ExpectedFile("book-1")
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", hash, "a replacement file's own hash is expected")
+	assert.Equal(t, int64(7), size)
+}
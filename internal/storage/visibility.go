@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// ==================== Visibility Methods ====================
+
+// SetBookVisibility changes who besides the owner can see a book
+func (d *Database) SetBookVisibility(bookID, visibility string) error {
+	_, err := d.db.Exec(`UPDATE books SET visibility = ? WHERE id = ?`, visibility, bookID)
+	return err
+}
+
+// ListHouseholdMemberIDs returns the users a user shares books with, in
+// either direction
+func (d *Database) ListHouseholdMemberIDs(userID string) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT shared_with_id FROM book_shares WHERE owner_id = ? AND shared_with_id != ?
+		UNION
+		SELECT owner_id FROM book_shares WHERE shared_with_id = ? AND owner_id != ?`,
+		userID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListOrphanBooks returns the books without an owner, such as those uploaded
+// before accounts existed or by anonymous visitors
+func (d *Database) ListOrphanBooks() ([]models.Book, error) {
+	rows, err := d.db.Query(`
+		SELECT id, title, author, COALESCE(content_type, 'book'), uploaded_at
+		FROM books WHERE user_id = ''
+		ORDER BY uploaded_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.ContentType, &book.UploadedAt); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// ClaimOrphanBooks gives books without an owner to userID, or every such
+// book when bookIDs is empty. The anonymous read status and reading
+// position of each claimed book move with it unless the user already has
+// their own. Books that already have an owner are skipped. It returns the
+// IDs of the books claimed.
+func (d *Database) ClaimOrphanBooks(userID, visibility string, bookIDs []string) ([]string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, err := claimOrphanBooks(tx, userID, visibility, bookIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return claimed, tx.Commit()
+}
+
+// ClaimAnonymousLibrary gives everything kept without signing in to userID,
+// as when the first account is made on a server used anonymously until
+// then: every book without an owner, the read status and reading positions
+// saved while signed out, in any book, and the collections made then.
+// Progress the user already has in a book is kept over the anonymous one.
+func (d *Database) ClaimAnonymousLibrary(userID, visibility string) (*models.AnonymousClaim, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	claim := &models.AnonymousClaim{}
+	for _, table := range readStateTables {
+		res, err := tx.Exec(`UPDATE OR IGNORE `+table+` SET user_id = ? WHERE user_id = ''`, userID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if table == "reading_positions" {
+			n, _ := res.RowsAffected()
+			claim.Positions = int(n)
+		}
+		if _, err := tx.Exec(`DELETE FROM ` + table + ` WHERE user_id = ''`); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	res, err := tx.Exec(`UPDATE collections SET user_id = ? WHERE user_id = ''`, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	n, _ := res.RowsAffected()
+	claim.Collections = int(n)
+
+	if claim.BookIDs, err = claimOrphanBooks(tx, userID, visibility, nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return claim, tx.Commit()
+}
+
+// claimOrphanBooks does the work of ClaimOrphanBooks in tx
+func claimOrphanBooks(tx *sql.Tx, userID, visibility string, bookIDs []string) ([]string, error) {
+	if len(bookIDs) == 0 {
+		rows, err := tx.Query(`SELECT id FROM books WHERE user_id = ''`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			bookIDs = append(bookIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var claimed []string
+	for _, id := range bookIDs {
+		res, err := tx.Exec(`UPDATE books SET user_id = ?, visibility = ? WHERE id = ? AND user_id = ''`,
+			userID, visibility, id)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		claimed = append(claimed, id)
+
+		if err := moveReadState(tx, id, "", userID); err != nil {
+			return nil, err
+		}
+	}
+	return claimed, nil
+}
+
+// ==================== Ownership Methods ====================
+
+// TransferBook gives a book to another user. Its shares are kept, now from
+// the new owner, except a share with the new owner themselves. With
+// keepReadState the previous owner's read status, rating, and reading
+// position move with the book unless the new owner already has their own;
+// otherwise both are cleared and the book starts unread.
+func (d *Database) TransferBook(bookID, toUserID string, keepReadState bool) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var fromUserID string
+	if err := tx.QueryRow(`SELECT user_id FROM books WHERE id = ?`, bookID).Scan(&fromUserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE books SET user_id = ? WHERE id = ?`, toUserID, bookID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM book_shares WHERE book_id = ? AND shared_with_id = ?`, bookID, toUserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE book_shares SET owner_id = ? WHERE book_id = ?`, toUserID, bookID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if keepReadState {
+		err = moveReadState(tx, bookID, fromUserID, toUserID)
+	} else {
+		err = clearReadState(tx, bookID, fromUserID, toUserID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// readStateTables hold a user's progress in a book, and their custom field
+// values for it, which move with it when it changes owner
+var readStateTables = []string{"user_book_state", "reading_positions", "book_custom_values"}
+
+// moveReadState gives fromUserID's progress in a book to toUserID, unless
+// toUserID has their own
+func moveReadState(tx *sql.Tx, bookID, fromUserID, toUserID string) error {
+	for _, table := range readStateTables {
+		if _, err := tx.Exec(`UPDATE OR IGNORE `+table+` SET user_id = ? WHERE book_id = ? AND user_id = ?`,
+			toUserID, bookID, fromUserID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE book_id = ? AND user_id = ?`, bookID, fromUserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearReadState removes the users' progress in a book
+func clearReadState(tx *sql.Tx, bookID string, userIDs ...string) error {
+	for _, table := range readStateTables {
+		for _, userID := range userIDs {
+			if _, err := tx.Exec(`DELETE FROM `+table+` WHERE book_id = ? AND user_id = ?`, bookID, userID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package tracker keeps external reading trackers, such as Hardcover or a
+// user's own webhook, up to date with their read status in Webby. Updates
+// are sent in the background as statuses change.
+package tracker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+	"github.com/justyntemme/webby/internal/storage"
+)
+
+// ErrUnsupportedTracker is returned for a connection to a tracker type
+// that isn't registered
+var ErrUnsupportedTracker = errors.New("tracker type not supported")
+
+// Update is a change to a user's read status for a book
+type Update struct {
+	Event         string     `json:"event"` // read_status_changed or book_finished
+	UserID        string     `json:"user_id"`
+	BookID        string     `json:"book_id"`
+	Title         string     `json:"title"`
+	Author        string     `json:"author,omitempty"`
+	ISBN          string     `json:"isbn,omitempty"`
+	Series        string     `json:"series,omitempty"`
+	SeriesIndex   float64    `json:"series_index,omitempty"`
+	Status        string     `json:"status"` // unread, reading, or completed
+	DateCompleted *time.Time `json:"date_completed,omitempty"`
+	Timestamp     time.Time  `json:"timestamp"`
+}
+
+// NewUpdate describes a user's new read status for a book
+func NewUpdate(userID string, book *models.Book, status string, dateCompleted *time.Time) Update {
+	event := models.TrackerEventStatusChanged
+	if status == models.ReadStatusCompleted {
+		event = models.TrackerEventBookFinished
+	}
+	return Update{
+		Event:         event,
+		UserID:        userID,
+		BookID:        book.ID,
+		Title:         book.Title,
+		Author:        book.Author,
+		ISBN:          book.ISBN,
+		Series:        book.Series,
+		SeriesIndex:   book.SeriesIndex,
+		Status:        status,
+		DateCompleted: dateCompleted,
+		Timestamp:     time.Now(),
+	}
+}
+
+// Tracker sends updates to one kind of reading tracker
+type Tracker interface {
+	// Type returns the tracker identifier (e.g., "webhook", "hardcover")
+	Type() string
+
+	// Send delivers an update to the user's account on the tracker
+	Send(ctx context.Context, conn *models.TrackerConnection, update Update) error
+
+	// Check confirms the connection works without changing anything on the
+	// user's account
+	Check(ctx context.Context, conn *models.TrackerConnection) error
+}
+
+// Service consumes read status updates and sends each to the user's
+// enabled trackers
+type Service struct {
+	db       *storage.Database
+	trackers map[string]Tracker
+	updates  chan Update
+	timeout  time.Duration
+}
+
+// NewService creates a tracker service with the given trackers and starts
+// the dispatcher that drains the update stream
+func NewService(db *storage.Database, trackers ...Tracker) *Service {
+	s := &Service{
+		db:       db,
+		trackers: make(map[string]Tracker),
+		updates:  make(chan Update, 256),
+		timeout:  15 * time.Second,
+	}
+	for _, t := range trackers {
+		s.trackers[t.Type()] = t
+	}
+
+	go s.run()
+	return s
+}
+
+// NewDefaultService creates a tracker service with all built-in trackers
+func NewDefaultService(db *storage.Database) *Service {
+	return NewService(db,
+		NewWebhookTracker(),
+		NewHardcoverTracker(),
+	)
+}
+
+// Publish adds an update to the stream without blocking the caller
+func (s *Service) Publish(update Update) {
+	if update.UserID == "" {
+		return
+	}
+
+	select {
+	case s.updates <- update:
+	default:
+		log.Printf("Warning: tracker queue full, dropping %s update for user %s", update.Event, update.UserID)
+	}
+}
+
+// Send delivers an update to one tracker connection immediately
+func (s *Service) Send(ctx context.Context, conn *models.TrackerConnection, update Update) error {
+	t, ok := s.trackers[conn.Type]
+	if !ok {
+		return ErrUnsupportedTracker
+	}
+	if update.Timestamp.IsZero() {
+		update.Timestamp = time.Now()
+	}
+	return t.Send(ctx, conn, update)
+}
+
+// Check confirms one tracker connection works
+func (s *Service) Check(ctx context.Context, conn *models.TrackerConnection) error {
+	t, ok := s.trackers[conn.Type]
+	if !ok {
+		return ErrUnsupportedTracker
+	}
+	return t.Check(ctx, conn)
+}
+
+// IsSupported reports whether a tracker type is registered
+func (s *Service) IsSupported(trackerType string) bool {
+	_, ok := s.trackers[trackerType]
+	return ok
+}
+
+// Types returns the registered tracker types in order
+func (s *Service) Types() []string {
+	types := make([]string, 0, len(s.trackers))
+	for name := range s.trackers {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// run drains the update stream and dispatches each update
+func (s *Service) run() {
+	for update := range s.updates {
+		s.dispatch(update)
+	}
+}
+
+// dispatch sends an update to each of the user's enabled trackers,
+// recording on each whether it was sent
+func (s *Service) dispatch(update Update) {
+	conns, err := s.db.ListEnabledTrackerConnections(update.UserID)
+	if err != nil {
+		log.Printf("Warning: failed to load trackers for user %s: %v", update.UserID, err)
+		return
+	}
+
+	for _, conn := range conns {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		errMsg := ""
+		if err := s.Send(ctx, conn, update); err != nil {
+			log.Printf("Warning: failed to send %s update to %s tracker %s: %v", update.Event, conn.Type, conn.ID, err)
+			errMsg = err.Error()
+		}
+		cancel()
+		if err := s.db.RecordTrackerSend(conn.ID, time.Now(), errMsg); err != nil {
+			log.Printf("Warning: failed to record send to tracker %s: %v", conn.ID, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package tracker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+func TestNewUpdate(t *testing.T) {
+	book := &models.Book{ID: "book-1", Title: "Dune", Author: "Frank Herbert", ISBN: "978-0441013593"}
+	assert.Equal(t, models.TrackerEventStatusChanged, NewUpdate("user-1", book, models.ReadStatusReading, nil).Event)
+
+	update := NewUpdate("user-1", book, models.ReadStatusCompleted, nil)
+	assert.Equal(t, models.TrackerEventBookFinished, update.Event)
+	assert.Equal(t, "978-0441013593", update.ISBN)
+	assert.False(t, update.Timestamp.IsZero())
+}
+
+func TestWebhookTrackerSend(t *testing.T) {
+	var received Update
+	var authHeader, event string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		event = r.Header.Get("X-Webby-Event")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	conn := &models.TrackerConnection{Type: models.TrackerWebhook, Target: server.URL, Token: "secret"}
+	update := NewUpdate("user-1", &models.Book{ID: "book-1", Title: "Dune"}, models.ReadStatusCompleted, nil)
+
+	require.NoError(t, NewWebhookTracker().Send(context.Background(), conn, update))
+	assert.Equal(t, "Bearer secret", authHeader)
+	assert.Equal(t, models.TrackerEventBookFinished, event)
+	assert.Equal(t, "book-1", received.BookID)
+	assert.Equal(t, models.ReadStatusCompleted, received.Status)
+}
+
+func TestHardcoverTrackerSend(t *testing.T) {
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, body)
+		if strings.HasPrefix(body["query"].(string), "query") {
+			if body["variables"].(map[string]interface{})["isbn"] == "9780441013593" {
+				w.Write([]byte(`{"data": {"editions": [{"id": 30, "book_id": 7}]}}`))
+				return
+			}
+			w.Write([]byte(`{"data": {"editions": []}}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"insert_user_book": {"id": 99}}}`))
+	}))
+	defer server.Close()
+
+	conn := &models.TrackerConnection{Type: models.TrackerHardcover, Target: server.URL, Token: "Bearer key"}
+	tracker := NewHardcoverTracker()
+	book := &models.Book{ID: "book-1", Title: "Dune", ISBN: "978-0441013593"}
+
+	require.NoError(t, tracker.Send(context.Background(), conn, NewUpdate("user-1", book, models.ReadStatusCompleted, nil)))
+	require.Len(t, requests, 2)
+	assert.Equal(t, map[string]interface{}{"book": 7.0, "edition": 30.0, "status": 3.0}, requests[1]["variables"])
+
+	requests = nil
+	require.NoError(t, tracker.Send(context.Background(), conn, NewUpdate("user-1", book, models.ReadStatusUnread, nil)))
+	assert.Empty(t, requests, "Hardcover has no unread status")
+
+	err := tracker.Send(context.Background(), conn, NewUpdate("user-1", &models.Book{ID: "book-2"}, models.ReadStatusReading, nil))
+	assert.ErrorIs(t, err, ErrNoISBN)
+
+	book.ISBN = "0000000000"
+	err = tracker.Send(context.Background(), conn, NewUpdate("user-1", book, models.ReadStatusReading, nil))
+	assert.ErrorContains(t, err, "no edition")
+}
+
+func TestHardcoverTrackerCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.Write([]byte(`{"errors": [{"message": "Unable to verify token"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"me": [{"id": 1}]}}`))
+	}))
+	defer server.Close()
+
+	tracker := NewHardcoverTracker()
+	conn := &models.TrackerConnection{Type: models.TrackerHardcover, Target: server.URL, Token: "key"}
+	assert.NoError(t, tracker.Check(context.Background(), conn))
+
+	conn.Token = "wrong"
+	assert.ErrorContains(t, tracker.Check(context.Background(), conn), "Unable to verify token")
+}
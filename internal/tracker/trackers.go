@@ -0,0 +1,211 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/justyntemme/webby/internal/models"
+)
+
+// WebhookTracker sends updates as JSON POSTs to a user-supplied URL, for
+// trackers without an API of their own to be bridged to
+type WebhookTracker struct {
+	client *http.Client
+}
+
+// NewWebhookTracker creates a generic webhook tracker
+func NewWebhookTracker() *WebhookTracker {
+	return &WebhookTracker{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Type returns the tracker identifier
+func (t *WebhookTracker) Type() string {
+	return models.TrackerWebhook
+}
+
+// Send posts the update as JSON to the connection's URL
+func (t *WebhookTracker) Send(ctx context.Context, conn *models.TrackerConnection, update Update) error {
+	return t.post(ctx, conn, update.Event, update)
+}
+
+// Check posts a test event, with no book, to the connection's URL
+func (t *WebhookTracker) Check(ctx context.Context, conn *models.TrackerConnection) error {
+	return t.post(ctx, conn, "test", map[string]interface{}{"event": "test", "timestamp": time.Now()})
+}
+
+// post sends a JSON body for an event to the connection's URL
+func (t *WebhookTracker) post(ctx context.Context, conn *models.TrackerConnection, event string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", conn.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webby-Event", event)
+	if conn.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+conn.Token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// HardcoverAPI is the GraphQL endpoint of Hardcover's API
+const HardcoverAPI = "https://api.hardcover.app/v1/graphql"
+
+// ErrNoISBN is returned for a book a tracker can only find by ISBN
+var ErrNoISBN = errors.New("book has no ISBN to find it by")
+
+// hardcoverStatuses maps read statuses to Hardcover's status IDs. Unread
+// books aren't sent, since Hardcover has no status for them.
+var hardcoverStatuses = map[string]int{
+	models.ReadStatusReading:   2, // Currently Reading
+	models.ReadStatusCompleted: 3, // Read
+}
+
+// HardcoverTracker sets the status of books on a Hardcover account, found by
+// ISBN, using the account's API key
+type HardcoverTracker struct {
+	client *http.Client
+}
+
+// NewHardcoverTracker creates a Hardcover tracker
+func NewHardcoverTracker() *HardcoverTracker {
+	return &HardcoverTracker{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Type returns the tracker identifier
+func (t *HardcoverTracker) Type() string {
+	return models.TrackerHardcover
+}
+
+// Send finds the book's edition by ISBN and adds it to the account's
+// library with the update's status
+func (t *HardcoverTracker) Send(ctx context.Context, conn *models.TrackerConnection, update Update) error {
+	status, ok := hardcoverStatuses[update.Status]
+	if !ok {
+		return nil
+	}
+	isbn := strings.NewReplacer("-", "", " ", "").Replace(update.ISBN)
+	if isbn == "" {
+		return ErrNoISBN
+	}
+
+	var found struct {
+		Editions []struct {
+			ID     int `json:"id"`
+			BookID int `json:"book_id"`
+		} `json:"editions"`
+	}
+	err := t.query(ctx, conn, `query Edition($isbn: String!) {
+  editions(where: {_or: [{isbn_13: {_eq: $isbn}}, {isbn_10: {_eq: $isbn}}]}, limit: 1) { id book_id }
+}`, map[string]interface{}{"isbn": isbn}, &found)
+	if err != nil {
+		return err
+	}
+	if len(found.Editions) == 0 {
+		return fmt.Errorf("no edition with ISBN %s on Hardcover", isbn)
+	}
+
+	var added struct {
+		InsertUserBook struct {
+			ID    int    `json:"id"`
+			Error string `json:"error"`
+		} `json:"insert_user_book"`
+	}
+	edition := found.Editions[0]
+	err = t.query(ctx, conn, `mutation Track($book: Int!, $edition: Int!, $status: Int!) {
+  insert_user_book(object: {book_id: $book, edition_id: $edition, status_id: $status}) { id error }
+}`, map[string]interface{}{"book": edition.BookID, "edition": edition.ID, "status": status}, &added)
+	if err != nil {
+		return err
+	}
+	if added.InsertUserBook.Error != "" {
+		return errors.New(added.InsertUserBook.Error)
+	}
+	return nil
+}
+
+// Check asks Hardcover who the API key belongs to
+func (t *HardcoverTracker) Check(ctx context.Context, conn *models.TrackerConnection) error {
+	var me struct {
+		Me []struct {
+			ID int `json:"id"`
+		} `json:"me"`
+	}
+	if err := t.query(ctx, conn, `query Me { me { id } }`, nil, &me); err != nil {
+		return err
+	}
+	if len(me.Me) == 0 {
+		return errors.New("API key doesn't belong to a Hardcover account")
+	}
+	return nil
+}
+
+// query runs a GraphQL query against the connection's API and decodes its
+// data into out
+func (t *HardcoverTracker) query(ctx context.Context, conn *models.TrackerConnection, query string, variables map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", conn.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Hardcover shows API keys with their scheme, so either form is accepted
+	req.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(conn.Token, "Bearer "))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return errors.New(result.Errors[0].Message)
+	}
+	return json.Unmarshal(result.Data, out)
+}
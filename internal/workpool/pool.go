@@ -0,0 +1,130 @@
+// Package workpool bounds how many CPU-heavy tasks, such as parsing an
+// uploaded book or scaling comic pages, run at once, so a burst of them
+// can't starve lighter requests on a small server. Tasks past the limit
+// wait their turn, and once too many are waiting new ones are turned away
+// for the caller to retry later.
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSaturated is returned when every worker is busy and the queue of
+// waiting tasks is full
+var ErrSaturated = errors.New("worker pool is saturated")
+
+// Stats describes a pool's load
+type Stats struct {
+	Workers    int   `json:"workers"`     // Tasks run at once
+	Busy       int   `json:"busy"`        // Tasks running
+	Waiting    int   `json:"waiting"`     // Tasks queued for a worker
+	MaxWaiting int   `json:"max_waiting"` // Tasks queued before more are rejected
+	Completed  int64 `json:"completed"`
+	Rejected   int64 `json:"rejected"`
+	AverageMS  int64 `json:"average_ms"` // Recent tasks' average run time
+}
+
+// averageWeight is how much each finished task moves the average run time
+const averageWeight = 0.2
+
+// Pool runs up to a fixed number of tasks at once
+type Pool struct {
+	slots      chan struct{}
+	maxWaiting int
+
+	mu        sync.Mutex
+	waiting   int
+	completed int64
+	rejected  int64
+	average   time.Duration // Moving average of task run times
+}
+
+// New creates a pool running up to workers tasks at once, with up to
+// maxWaiting more queued behind them
+func New(workers, maxWaiting int) *Pool {
+	return &Pool{
+		slots:      make(chan struct{}, max(workers, 1)),
+		maxWaiting: max(maxWaiting, 0),
+	}
+}
+
+// Acquire waits for a worker, returning the function that frees it once
+// the task is done. It returns ErrSaturated without waiting if the queue is
+// full, or ctx's error if ctx is done first.
+func (p *Pool) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaser(), nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.waiting >= p.maxWaiting {
+		p.rejected++
+		p.mu.Unlock()
+		return nil, ErrSaturated
+	}
+	p.waiting++
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.waiting--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+		return p.releaser(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns the function freeing a worker taken now, recording how
+// long it was held
+func (p *Pool) releaser() func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			elapsed := time.Since(start)
+			p.mu.Lock()
+			p.completed++
+			if p.average == 0 {
+				p.average = elapsed
+			} else {
+				p.average += time.Duration(averageWeight * float64(elapsed-p.average))
+			}
+			p.mu.Unlock()
+			<-p.slots
+		})
+	}
+}
+
+// RetryAfter estimates how long until a rejected task would find room: the
+// time for the queue ahead of it to be worked through, at least a second
+func (p *Pool) RetryAfter() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rounds := float64(p.waiting)/float64(cap(p.slots)) + 1
+	wait := time.Duration(rounds * float64(p.average)).Round(time.Second)
+	return max(wait, time.Second)
+}
+
+// Stats returns the pool's current load
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		Workers:    cap(p.slots),
+		Busy:       len(p.slots),
+		Waiting:    p.waiting,
+		MaxWaiting: p.maxWaiting,
+		Completed:  p.completed,
+		Rejected:   p.rejected,
+		AverageMS:  p.average.Milliseconds(),
+	}
+}
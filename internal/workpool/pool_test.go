@@ -0,0 +1,61 @@
+package workpool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolQueuesThenRejects(t *testing.T) {
+	p := New(1, 1)
+
+	release, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+
+	acquired := make(chan func())
+	go func() {
+		next, err := p.Acquire(context.Background())
+		assert.NoError(t, err)
+		acquired <- next
+	}()
+	require.Eventually(t, func() bool { return p.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+	_, err = p.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrSaturated, "the queue is full")
+
+	release()
+	release() // Releasing twice frees one worker
+	next := <-acquired
+	stats := p.Stats()
+	assert.Equal(t, 1, stats.Busy)
+	assert.Equal(t, 0, stats.Waiting)
+	assert.Equal(t, int64(1), stats.Completed)
+	assert.Equal(t, int64(1), stats.Rejected)
+	next()
+	assert.Equal(t, 0, p.Stats().Busy)
+}
+
+func TestPoolStopsWaitingWhenCancelled(t *testing.T) {
+	p := New(1, 5)
+	release, err := p.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 0, p.Stats().Waiting)
+}
+
+func TestPoolRetryAfter(t *testing.T) {
+	p := New(2, 4)
+	assert.Equal(t, time.Second, p.RetryAfter(), "at least a second")
+
+	p.average = 3 * time.Second
+	p.waiting = 4
+	assert.Equal(t, 9*time.Second, p.RetryAfter(), "two rounds of queued tasks and one running")
+}
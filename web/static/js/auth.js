@@ -51,7 +51,7 @@ export function getAuthHeaders() {
 export async function checkAuth() {
     const token = getAuthToken();
     if (!token) {
-        window.location.href = '/auth';
+        window.location.href = 'auth';
         return false;
     }
 
@@ -65,11 +65,11 @@ export async function checkAuth() {
             return true;
         } else {
             clearAuthToken();
-            window.location.href = '/auth';
+            window.location.href = 'auth';
             return false;
         }
     } catch (err) {
-        window.location.href = '/auth';
+        window.location.href = 'auth';
         return false;
     }
 }
@@ -106,7 +106,7 @@ export function renderUserSection(user) {
         }
     } else {
         section.innerHTML = DOMPurify.sanitize(`
-            <a href="/auth" class="auth-btn primary">Sign In</a>
+            <a href="auth" class="auth-btn primary">Sign In</a>
         `);
     }
 }
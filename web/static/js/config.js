@@ -3,7 +3,7 @@
  * Application-wide constants and configuration
  */
 
-export const API_BASE = '/api';
+export const API_BASE = new URL('api', document.baseURI).pathname;
 
 // Mobile interaction settings
 export const LONG_PRESS_DURATION = 500; // ms